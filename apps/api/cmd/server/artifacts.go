@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"streamlation/packages/backend/archive"
+	outputpkg "streamlation/packages/backend/output"
+
+	"go.uber.org/zap"
+)
+
+// ArtifactRegistry lists the artifacts recorded for a session.
+type ArtifactRegistry interface {
+	Artifacts(ctx context.Context, sessionID string) ([]outputpkg.Artifact, error)
+}
+
+type artifactList struct {
+	Artifacts []outputpkg.Artifact `json:"artifacts"`
+}
+
+// getArtifactStore reads the store the worker keeps generated artifacts in
+// from APP_ARTIFACT_BACKEND, "file", "s3", or "gcs" (unset disables
+// downloads), and the APP_ARTIFACT_* settings of the backend, which mirror
+// the worker's WORKER_ARTIFACT_* settings.
+func getArtifactStore(getenv func(string) string) (outputpkg.ArtifactStore, error) {
+	backend := getenv("APP_ARTIFACT_BACKEND")
+	if backend == "" {
+		return nil, nil
+	}
+	return archive.OpenStore(archive.StoreConfig{
+		Backend: backend,
+		Dir:     getenv("APP_ARTIFACT_DIR"),
+		S3: archive.S3Config{
+			Bucket:               getenv("APP_ARTIFACT_BUCKET"),
+			Prefix:               getenv("APP_ARTIFACT_PREFIX"),
+			Region:               getenv("APP_ARTIFACT_REGION"),
+			Endpoint:             getenv("APP_ARTIFACT_ENDPOINT"),
+			PathStyle:            getenv("APP_ARTIFACT_PATH_STYLE") == "true",
+			AccessKeyID:          getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey:      getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:         getenv("AWS_SESSION_TOKEN"),
+			RoleARN:              getenv("AWS_ROLE_ARN"),
+			WebIdentityTokenFile: getenv("AWS_WEB_IDENTITY_TOKEN_FILE"),
+			RoleSessionName:      getenv("AWS_ROLE_SESSION_NAME"),
+			STSEndpoint:          getenv("AWS_ENDPOINT_URL_STS"),
+		},
+		GCS: archive.GCSConfig{
+			Bucket:          getenv("APP_ARTIFACT_BUCKET"),
+			Prefix:          getenv("APP_ARTIFACT_PREFIX"),
+			Endpoint:        getenv("APP_ARTIFACT_ENDPOINT"),
+			AccessToken:     getenv("APP_ARTIFACT_ACCESS_TOKEN"),
+			CredentialsFile: getenv("GOOGLE_APPLICATION_CREDENTIALS"),
+		},
+	})
+}
+
+// listArtifactsHandler lists the artifacts recorded for a session, narrowed
+// to those of the comma-separated "languages" and "kinds" of the query.
+func listArtifactsHandler(store SessionStore, registry ArtifactRegistry, logger *zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.PathValue("id")
+		if !sessionIDPattern.MatchString(sessionID) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid session id"))
+			return
+		}
+
+		ctx := r.Context()
+
+		if !sessionExists(ctx, w, store, sessionID, logger) {
+			return
+		}
+
+		recorded, err := registry.Artifacts(ctx, sessionID)
+		if err != nil {
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load artifacts: %w", err))
+			return
+		}
+		languages := splitQueryList(r.URL.Query().Get("languages"))
+		kinds := splitQueryList(r.URL.Query().Get("kinds"))
+		artifacts := make([]outputpkg.Artifact, 0, len(recorded))
+		for _, artifact := range recorded {
+			if len(languages) > 0 && !slices.ContainsFunc(languages, func(language string) bool { return strings.EqualFold(language, artifact.Language) }) {
+				continue
+			}
+			if len(kinds) > 0 && !slices.Contains(kinds, string(artifact.Kind)) {
+				continue
+			}
+			artifacts = append(artifacts, artifact)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(artifactList{Artifacts: artifacts}); err != nil {
+			logger.Errorw("failed to encode response", "error", err)
+		}
+	}
+}
+
+// downloadArtifactHandler serves the artifact recorded for a session under
+// "<session>/<kind>/<file>", such as "/sessions/abc/artifacts/subtitles/es.srt".
+func downloadArtifactHandler(store SessionStore, registry ArtifactRegistry, artifacts outputpkg.ArtifactStore, logger *zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.PathValue("id")
+		if !sessionIDPattern.MatchString(sessionID) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid session id"))
+			return
+		}
+		if artifacts == nil {
+			writeError(w, logger, http.StatusServiceUnavailable, errors.New("artifact storage not configured"))
+			return
+		}
+
+		ctx := r.Context()
+
+		if !sessionExists(ctx, w, store, sessionID, logger) {
+			return
+		}
+
+		recorded, err := registry.Artifacts(ctx, sessionID)
+		if err != nil {
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load artifacts: %w", err))
+			return
+		}
+		// Only recorded keys are served, which keeps requests from reaching
+		// objects outside the session.
+		key := sessionID + "/" + r.PathValue("kind") + "/" + r.PathValue("file")
+		var artifact *outputpkg.Artifact
+		for i := range recorded {
+			if recorded[i].Key == key {
+				artifact = &recorded[i]
+				break
+			}
+		}
+		if artifact == nil {
+			writeError(w, logger, http.StatusNotFound, fmt.Errorf("artifact %s not found", key))
+			return
+		}
+
+		serveArtifact(w, r, artifacts, *artifact, logger)
+	}
+}
+
+// subtitlesHandler serves the subtitles of a session in the language and
+// format the query selects, such as "?language=es&format=vtt", the first
+// format recorded in key order (SRT, when it is) when none is selected,
+// or the package bundling every language when no language is.
+func subtitlesHandler(store SessionStore, registry ArtifactRegistry, artifacts outputpkg.ArtifactStore, logger *zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.PathValue("id")
+		if !sessionIDPattern.MatchString(sessionID) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid session id"))
+			return
+		}
+		if artifacts == nil {
+			writeError(w, logger, http.StatusServiceUnavailable, errors.New("artifact storage not configured"))
+			return
+		}
+
+		ctx := r.Context()
+
+		if !sessionExists(ctx, w, store, sessionID, logger) {
+			return
+		}
+
+		recorded, err := registry.Artifacts(ctx, sessionID)
+		if err != nil {
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load artifacts: %w", err))
+			return
+		}
+		language, format := r.URL.Query().Get("language"), strings.ToLower(r.URL.Query().Get("format"))
+		for _, artifact := range recorded {
+			var selected bool
+			if language == "" {
+				selected = artifact.Kind == outputpkg.ArtifactPackage
+			} else {
+				selected = artifact.Kind == outputpkg.ArtifactSubtitles && strings.EqualFold(artifact.Language, language) && (format == "" || artifact.Format == format)
+			}
+			if selected {
+				serveArtifact(w, r, artifacts, artifact, logger)
+				return
+			}
+		}
+		if language == "" {
+			writeError(w, logger, http.StatusNotFound, errors.New("no subtitle package recorded"))
+			return
+		}
+		writeError(w, logger, http.StatusNotFound, fmt.Errorf("no %s subtitles recorded", language))
+	}
+}
+
+// transcriptHandler serves the JSONL transcript of a session, which aligns
+// its source text with its translations.
+func transcriptHandler(store SessionStore, registry ArtifactRegistry, artifacts outputpkg.ArtifactStore, logger *zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.PathValue("id")
+		if !sessionIDPattern.MatchString(sessionID) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid session id"))
+			return
+		}
+		if artifacts == nil {
+			writeError(w, logger, http.StatusServiceUnavailable, errors.New("artifact storage not configured"))
+			return
+		}
+
+		ctx := r.Context()
+
+		if !sessionExists(ctx, w, store, sessionID, logger) {
+			return
+		}
+
+		recorded, err := registry.Artifacts(ctx, sessionID)
+		if err != nil {
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load artifacts: %w", err))
+			return
+		}
+		for _, artifact := range recorded {
+			if artifact.Kind == outputpkg.ArtifactTranscript {
+				serveArtifact(w, r, artifacts, artifact, logger)
+				return
+			}
+		}
+		writeError(w, logger, http.StatusNotFound, errors.New("no transcript recorded"))
+	}
+}
+
+// serveArtifact writes the body of artifact, as a download named after its
+// session and file.
+func serveArtifact(w http.ResponseWriter, r *http.Request, artifacts outputpkg.ArtifactStore, artifact outputpkg.Artifact, logger *zap.SugaredLogger) {
+	body, err := artifacts.Get(r.Context(), artifact.Key)
+	if err != nil {
+		if errors.Is(err, outputpkg.ErrArtifactNotFound) {
+			writeError(w, logger, http.StatusNotFound, fmt.Errorf("artifact %s not found", artifact.Key))
+			return
+		}
+		writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load artifact: %w", err))
+		return
+	}
+	defer func() { _ = body.Close() }()
+
+	filename := artifact.SessionID + "-" + path.Base(artifact.Key)
+	w.Header().Set("Content-Type", artifact.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(artifact.Size, 10))
+	w.Header().Set("ETag", strconv.Quote(artifact.SHA256))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if _, err := io.Copy(w, body); err != nil {
+		logger.Errorw("failed to write artifact", "error", err, "key", artifact.Key)
+	}
+}
+
+// sessionExists writes the error response and returns false unless the
+// session exists.
+func sessionExists(ctx context.Context, w http.ResponseWriter, store SessionStore, sessionID string, logger *zap.SugaredLogger) bool {
+	if _, err := store.Get(ctx, sessionID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			writeError(w, logger, http.StatusNotFound, fmt.Errorf("session %s not found", sessionID))
+			return false
+		}
+		writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load session: %w", err))
+		return false
+	}
+	return true
+}
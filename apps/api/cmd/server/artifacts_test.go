@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"streamlation/packages/backend/archive"
+	outputpkg "streamlation/packages/backend/output"
+)
+
+type stubArtifactRegistry struct {
+	artifacts []outputpkg.Artifact
+}
+
+func (r *stubArtifactRegistry) Artifacts(_ context.Context, sessionID string) ([]outputpkg.Artifact, error) {
+	var artifacts []outputpkg.Artifact
+	for _, artifact := range r.artifacts {
+		if artifact.SessionID == sessionID {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts, nil
+}
+
+func (r *stubArtifactRegistry) Record(_ context.Context, artifact outputpkg.Artifact) error {
+	for i := range r.artifacts {
+		if r.artifacts[i].Key == artifact.Key {
+			r.artifacts[i] = artifact
+			return nil
+		}
+	}
+	r.artifacts = append(r.artifacts, artifact)
+	return nil
+}
+
+func newArtifactFixture(t *testing.T) (*stubArtifactRegistry, outputpkg.ArtifactStore) {
+	t.Helper()
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	writer, err := outputpkg.NewArtifactWriter(store, nil)
+	if err != nil {
+		t.Fatalf("new artifact writer: %v", err)
+	}
+	artifact, err := writer.Persist(context.Background(), outputpkg.Artifact{SessionID: "session123", Kind: outputpkg.ArtifactSubtitles, Language: "es", Format: "srt"}, strings.NewReader("1\n00:00:00,000 --> 00:00:01,000\nhola\n"))
+	if err != nil {
+		t.Fatalf("persist artifact: %v", err)
+	}
+	// Stored but never recorded, so not downloadable.
+	if err := store.Put(context.Background(), "session123/subtitles/fr.srt", strings.NewReader("bonjour")); err != nil {
+		t.Fatalf("put object: %v", err)
+	}
+	return &stubArtifactRegistry{artifacts: []outputpkg.Artifact{artifact}}, store
+}
+
+func TestListArtifactsHandler(t *testing.T) {
+	registry, _ := newArtifactFixture(t)
+	handler := listArtifactsHandler(&stubSessionStore{}, registry, newLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions/session123/artifacts", nil)
+	req.SetPathValue("id", "session123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var list artifactList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list.Artifacts) != 1 || list.Artifacts[0].Key != "session123/subtitles/es.srt" {
+		t.Fatalf("unexpected artifacts: %#v", list.Artifacts)
+	}
+}
+
+func TestListArtifactsHandlerFiltersLanguages(t *testing.T) {
+	registry, _ := newArtifactFixture(t)
+	registry.artifacts = append(registry.artifacts,
+		outputpkg.Artifact{SessionID: "session123", Key: "session123/subtitles/fr.srt", Kind: outputpkg.ArtifactSubtitles, Language: "fr", Format: "srt"},
+		outputpkg.Artifact{SessionID: "session123", Key: "session123/package/mul.zip", Kind: outputpkg.ArtifactPackage, Language: outputpkg.PackageLanguage, Format: "zip"},
+	)
+	handler := listArtifactsHandler(&stubSessionStore{}, registry, newLogger())
+
+	list := func(query string) []outputpkg.Artifact {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/session123/artifacts?"+query, nil)
+		req.SetPathValue("id", "session123")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		var list artifactList
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return list.Artifacts
+	}
+
+	if artifacts := list("languages=FR"); len(artifacts) != 1 || artifacts[0].Language != "fr" {
+		t.Fatalf("expected the French artifact, got %#v", artifacts)
+	}
+	if artifacts := list("languages=es,fr&kinds=subtitles"); len(artifacts) != 2 {
+		t.Fatalf("expected the subtitles of both languages, got %#v", artifacts)
+	}
+	if artifacts := list("kinds=package"); len(artifacts) != 1 || artifacts[0].Format != "zip" {
+		t.Fatalf("expected the package, got %#v", artifacts)
+	}
+}
+
+func TestSubtitlesHandlerSelectsLanguages(t *testing.T) {
+	registry, store := newArtifactFixture(t)
+	writer, err := outputpkg.NewArtifactWriter(store, nil)
+	if err != nil {
+		t.Fatalf("new artifact writer: %v", err)
+	}
+	vtt, err := writer.Persist(context.Background(), outputpkg.Artifact{SessionID: "session123", Kind: outputpkg.ArtifactSubtitles, Language: "es", Format: "vtt"}, strings.NewReader("WEBVTT\n"))
+	if err != nil {
+		t.Fatalf("persist artifact: %v", err)
+	}
+	registry.artifacts = append(registry.artifacts, vtt)
+	handler := subtitlesHandler(&stubSessionStore{}, registry, store, newLogger())
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/session123/subtitles?"+query, nil)
+		req.SetPathValue("id", "session123")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := get("language=es"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "hola") {
+		t.Fatalf("expected the SRT subtitles by default, got %d: %q", rr.Code, rr.Body.String())
+	}
+	if rr := get("language=ES&format=VTT"); rr.Code != http.StatusOK || rr.Body.String() != "WEBVTT\n" || rr.Header().Get("Content-Type") != "text/vtt; charset=utf-8" {
+		t.Fatalf("expected the WebVTT subtitles, got %d: %q", rr.Code, rr.Body.String())
+	}
+	if rr := get("language=fr"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected unrecorded languages to be missing, got %d", rr.Code)
+	}
+	if rr := get(""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected a missing package without a language, got %d", rr.Code)
+	}
+
+	pkg, err := writer.PersistPackage(context.Background(), "session123", registry.artifacts)
+	if err != nil {
+		t.Fatalf("persist package: %v", err)
+	}
+	registry.artifacts = append(registry.artifacts, pkg)
+	rr := get("")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/zip" || !strings.Contains(rr.Header().Get("Content-Disposition"), `filename="session123-mul.zip"`) {
+		t.Fatalf("expected the package without a language, got %d with headers %v", rr.Code, rr.Header())
+	}
+}
+
+func TestTranscriptHandler(t *testing.T) {
+	registry, store := newArtifactFixture(t)
+	handler := transcriptHandler(&stubSessionStore{}, registry, store, newLogger())
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/session123/transcript", nil)
+		req.SetPathValue("id", "session123")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := get(); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected a missing transcript, got %d", rr.Code)
+	}
+
+	writer, err := outputpkg.NewArtifactWriter(store, nil)
+	if err != nil {
+		t.Fatalf("new artifact writer: %v", err)
+	}
+	transcript, err := writer.PersistTranscript(context.Background(), "session123", []outputpkg.TranscriptRecord{{SourceText: "hello", Translations: []outputpkg.TranscriptTranslation{{Language: "es", Text: "hola"}}}})
+	if err != nil {
+		t.Fatalf("persist transcript: %v", err)
+	}
+	registry.artifacts = append(registry.artifacts, transcript)
+	rr := get()
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/x-ndjson" || !strings.Contains(rr.Body.String(), `"text":"hola"`) {
+		t.Fatalf("expected the transcript, got %d: %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestDownloadArtifactHandler(t *testing.T) {
+	registry, store := newArtifactFixture(t)
+	handler := downloadArtifactHandler(&stubSessionStore{}, registry, store, newLogger())
+
+	download := func(file string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/session123/artifacts/subtitles/"+file, nil)
+		req.SetPathValue("id", "session123")
+		req.SetPathValue("kind", "subtitles")
+		req.SetPathValue("file", file)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := download("es.srt")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Content-Type") != "application/x-subrip" || !strings.Contains(rr.Header().Get("Content-Disposition"), `filename="session123-es.srt"`) {
+		t.Fatalf("unexpected headers: %v", rr.Header())
+	}
+	if !strings.Contains(rr.Body.String(), "hola") || rr.Header().Get("ETag") != strconv.Quote(registry.artifacts[0].SHA256) {
+		t.Fatalf("unexpected download %q with headers %v", rr.Body.String(), rr.Header())
+	}
+
+	if rr := download("fr.srt"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected an unrecorded artifact to be missing, got %d", rr.Code)
+	}
+
+	unconfigured := downloadArtifactHandler(&stubSessionStore{}, registry, nil, newLogger())
+	req := httptest.NewRequest(http.MethodGet, "/sessions/session123/artifacts/subtitles/es.srt", nil)
+	req.SetPathValue("id", "session123")
+	rr = httptest.NewRecorder()
+	unconfigured.ServeHTTP(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 without artifact storage, got %d", rr.Code)
+	}
+}
+
+func TestArtifactHandlersRejectUnknownSessions(t *testing.T) {
+	registry, store := newArtifactFixture(t)
+	sessions := &stubSessionStore{getFunc: func(context.Context, string) (TranslationSession, error) {
+		return TranslationSession{}, ErrSessionNotFound
+	}}
+
+	for _, handler := range []http.HandlerFunc{
+		listArtifactsHandler(sessions, registry, newLogger()),
+		downloadArtifactHandler(sessions, registry, store, newLogger()),
+		subtitlesHandler(sessions, registry, store, newLogger()),
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/session404/artifacts", nil)
+		req.SetPathValue("id", "session404")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Fatalf("expected status 404, got %d", rr.Code)
+		}
+	}
+}
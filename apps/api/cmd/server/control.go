@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+
+	queuepkg "streamlation/packages/backend/queue"
+
+	"go.uber.org/zap"
+)
+
+// workerIDPattern matches the IDs workers announce, by default their
+// hostname and process ID.
+var workerIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// ControlSender broadcasts control messages to the workers.
+type ControlSender interface {
+	SendControl(ctx context.Context, msg queuepkg.ControlMessage) error
+}
+
+// getOperatorTokens reads the bearer tokens that authorize control requests
+// from APP_OPERATOR_TOKENS, a comma-separated list. Without any, workers
+// cannot be controlled through the API.
+func getOperatorTokens(getenv func(string) string) []string {
+	return splitQueryList(getenv("APP_OPERATOR_TOKENS"))
+}
+
+// authorizeControl writes the error response and returns false unless
+// control requests are configured and r carries an operator token.
+func authorizeControl(w http.ResponseWriter, r *http.Request, sender ControlSender, tokens []string, logger *zap.SugaredLogger) bool {
+	if sender == nil || len(tokens) == 0 {
+		writeError(w, logger, http.StatusServiceUnavailable, errors.New("worker control not configured"))
+		return false
+	}
+	if !authorizedEditor(r, tokens) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, logger, http.StatusUnauthorized, errors.New("operator token required"))
+		return false
+	}
+	return true
+}
+
+// sendControl broadcasts msg and answers 202 with it, as the workers act on
+// it asynchronously.
+func sendControl(w http.ResponseWriter, r *http.Request, sender ControlSender, msg queuepkg.ControlMessage, logger *zap.SugaredLogger) {
+	if err := sender.SendControl(r.Context(), msg); err != nil {
+		writeError(w, logger, http.StatusBadGateway, fmt.Errorf("failed to send control message: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(msg); err != nil {
+		logger.Errorw("failed to encode response", "error", err)
+	}
+}
+
+// cancelSessionHandler asks the worker running a session to stop its
+// pipeline.
+func cancelSessionHandler(store SessionStore, sender ControlSender, tokens []string, logger *zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.PathValue("id")
+		if !sessionIDPattern.MatchString(sessionID) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid session id"))
+			return
+		}
+		if !authorizeControl(w, r, sender, tokens, logger) {
+			return
+		}
+		if !sessionExists(r.Context(), w, store, sessionID, logger) {
+			return
+		}
+		sendControl(w, r, sender, queuepkg.ControlMessage{Kind: queuepkg.ControlCancelSession, SessionID: sessionID}, logger)
+	}
+}
+
+// updateOptionsHandler changes the options of a session. The options are
+// validated as those of POST /sessions and applied over the session's
+// stored options, so that fields left out keep their values, and may not
+// change its stage selection. The result is stored, broadcast to the
+// worker running the session, if any, and returned.
+func updateOptionsHandler(store SessionStore, sender ControlSender, tokens []string, logger *zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.PathValue("id")
+		if !sessionIDPattern.MatchString(sessionID) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid session id"))
+			return
+		}
+		if !authorizeControl(w, r, sender, tokens, logger) {
+			return
+		}
+
+		var input translationOptionsInput
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&input); err != nil {
+			writeError(w, logger, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+
+		session, err := store.Get(r.Context(), sessionID)
+		if err != nil {
+			if errors.Is(err, ErrSessionNotFound) {
+				writeError(w, logger, http.StatusNotFound, fmt.Errorf("session %s not found", sessionID))
+				return
+			}
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load session: %w", err))
+			return
+		}
+		options, err := mergeOptions(session.TargetLanguage, session.Options, &input)
+		if err != nil {
+			writeError(w, logger, http.StatusBadRequest, err)
+			return
+		}
+		// Running pipelines keep their stage implementations.
+		if !maps.Equal(options.Stages, session.Options.Stages) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("options.stages cannot change while a session runs"))
+			return
+		}
+		if err := store.UpdateOptions(r.Context(), sessionID, options); err != nil {
+			if errors.Is(err, ErrSessionNotFound) {
+				writeError(w, logger, http.StatusNotFound, fmt.Errorf("session %s not found", sessionID))
+				return
+			}
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to store options: %w", err))
+			return
+		}
+		// The options are stored, so a failed broadcast can be retried by
+		// repeating the request.
+		if err := sender.SendControl(r.Context(), queuepkg.ControlMessage{Kind: queuepkg.ControlUpdateOptions, SessionID: sessionID, Options: &options}); err != nil {
+			writeError(w, logger, http.StatusBadGateway, fmt.Errorf("failed to send control message: %w", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(options); err != nil {
+			logger.Errorw("failed to encode response", "error", err)
+		}
+	}
+}
+
+// drainWorkerHandler stops a worker from taking new jobs while its running
+// sessions finish.
+func drainWorkerHandler(sender ControlSender, tokens []string, logger *zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workerID := r.PathValue("id")
+		if !workerIDPattern.MatchString(workerID) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid worker id"))
+			return
+		}
+		if !authorizeControl(w, r, sender, tokens, logger) {
+			return
+		}
+		sendControl(w, r, sender, queuepkg.ControlMessage{Kind: queuepkg.ControlDrainWorker, WorkerID: workerID}, logger)
+	}
+}
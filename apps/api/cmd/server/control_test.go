@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	queuepkg "streamlation/packages/backend/queue"
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+type stubControlSender struct {
+	sent []queuepkg.ControlMessage
+}
+
+func (s *stubControlSender) SendControl(_ context.Context, msg queuepkg.ControlMessage) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func controlRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer operator")
+	return req
+}
+
+func TestCancelSessionHandlerSendsControl(t *testing.T) {
+	sender := &stubControlSender{}
+	handler := cancelSessionHandler(&stubSessionStore{}, sender, []string{"operator"}, newLogger())
+
+	req := controlRequest(http.MethodPost, "/sessions/session123/cancel", "")
+	req.SetPathValue("id", "session123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(sender.sent) != 1 || sender.sent[0].Kind != queuepkg.ControlCancelSession || sender.sent[0].SessionID != "session123" {
+		t.Fatalf("unexpected control messages: %#v", sender.sent)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/sessions/session123/cancel", nil)
+	req.SetPathValue("id", "session123")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 without a token, got %d", rr.Code)
+	}
+	if len(sender.sent) != 1 {
+		t.Fatal("expected an unauthorized request to send nothing")
+	}
+}
+
+func TestUpdateOptionsHandlerValidatesOptions(t *testing.T) {
+	sender := &stubControlSender{}
+	stored := TranslationOptions{
+		LatencyToleranceMs:  5000,
+		ModelProfile:        "cpu-basic",
+		AdditionalLanguages: []string{"fr"},
+		Vocabulary:          []string{"Streamlation"},
+		Glossary:            &sessionpkg.Glossary{DoNotTranslate: []string{"Streamlation"}},
+		VoiceID:             "voice-1",
+	}
+	store := &stubSessionStore{
+		getFunc: func(_ context.Context, id string) (TranslationSession, error) {
+			return TranslationSession{ID: id, TargetLanguage: "es", Options: stored}, nil
+		},
+		updateFunc: func(_ context.Context, _ string, options TranslationOptions) error {
+			stored = options
+			return nil
+		},
+	}
+	handler := updateOptionsHandler(store, sender, []string{"operator"}, newLogger())
+
+	req := controlRequest(http.MethodPut, "/sessions/session123/options", `{"enableDubbing": true, "modelProfile": "gpu-accelerated"}`)
+	req.SetPathValue("id", "session123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var returned TranslationOptions
+	if err := json.NewDecoder(rr.Body).Decode(&returned); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !reflect.DeepEqual(returned, stored) {
+		t.Fatalf("expected the stored options to be returned, got %#v, stored %#v", returned, stored)
+	}
+	if !stored.EnableDubbing || stored.ModelProfile != "gpu-accelerated" || stored.LatencyToleranceMs != 5000 {
+		t.Fatalf("expected the submitted options to be stored, got %#v", stored)
+	}
+	if !slices.Equal(stored.AdditionalLanguages, []string{"fr"}) || !slices.Equal(stored.Vocabulary, []string{"Streamlation"}) || stored.Glossary == nil || stored.VoiceID != "voice-1" {
+		t.Fatalf("expected the options left out to be kept, got %#v", stored)
+	}
+	if len(sender.sent) != 1 || sender.sent[0].Kind != queuepkg.ControlUpdateOptions || !reflect.DeepEqual(*sender.sent[0].Options, stored) {
+		t.Fatalf("unexpected control messages: %#v", sender.sent)
+	}
+
+	req = controlRequest(http.MethodPut, "/sessions/session123/options", `{"modelProfile": "quantum"}`)
+	req.SetPathValue("id", "session123")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid options, got %d", rr.Code)
+	}
+	if len(sender.sent) != 1 {
+		t.Fatalf("expected invalid options not to be sent, got %#v", sender.sent)
+	}
+
+	req = controlRequest(http.MethodPut, "/sessions/session123/options", `{"stages": {"asr": "whisper"}}`)
+	req.SetPathValue("id", "session123")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a stage selection change, got %d", rr.Code)
+	}
+}
+
+func TestDrainWorkerHandler(t *testing.T) {
+	sender := &stubControlSender{}
+	handler := drainWorkerHandler(sender, []string{"operator"}, newLogger())
+
+	req := controlRequest(http.MethodPost, "/workers/worker-a/drain", "")
+	req.SetPathValue("id", "worker-a")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(sender.sent) != 1 || sender.sent[0].Kind != queuepkg.ControlDrainWorker || sender.sent[0].WorkerID != "worker-a" {
+		t.Fatalf("unexpected control messages: %#v", sender.sent)
+	}
+
+	unconfigured := drainWorkerHandler(sender, nil, newLogger())
+	rr = httptest.NewRecorder()
+	unconfigured.ServeHTTP(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 without operator tokens, got %d", rr.Code)
+	}
+}
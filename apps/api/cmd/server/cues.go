@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	outputpkg "streamlation/packages/backend/output"
+	translationpkg "streamlation/packages/backend/translation"
+
+	"go.uber.org/zap"
+)
+
+// cueIDPattern matches the IDs of the cues of a language, such as "es-12"
+// or "pt-BR-3".
+var cueIDPattern = regexp.MustCompile(`^([A-Za-z]{2,3}(?:-[A-Za-z0-9]{2,8})*)-(\d+)$`)
+
+type cueList struct {
+	Language string          `json:"language"`
+	Cues     []outputpkg.Cue `json:"cues"`
+}
+
+// cueEditInput overrides the text or timing of a cue; fields left out keep
+// their earlier values. Times are in nanoseconds, like those of subtitle
+// events.
+type cueEditInput struct {
+	Text      *string        `json:"text"`
+	StartTime *time.Duration `json:"startTime"`
+	EndTime   *time.Duration `json:"endTime"`
+}
+
+type cueEditView struct {
+	// Cue is the cue edited, unless the session has no cue list yet.
+	Cue  *outputpkg.Cue    `json:"cue,omitempty"`
+	Edit outputpkg.CueEdit `json:"edit"`
+}
+
+// GeneratorSource builds the generator that renders the subtitle files of
+// a session, the one its runs render them with.
+type GeneratorSource interface {
+	Generator(session TranslationSession) (outputpkg.SubtitleGenerator, error)
+}
+
+// sessionLocks serializes the edits of each session, keeping a lock only
+// while edits of its session are waiting or under way.
+type sessionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+type sessionLock struct {
+	sync.Mutex
+	holders int
+}
+
+// lock locks sessionID and returns the function that unlocks it.
+func (l *sessionLocks) lock(sessionID string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sessionLock)
+	}
+	lock := l.locks[sessionID]
+	if lock == nil {
+		lock = &sessionLock{}
+		l.locks[sessionID] = lock
+	}
+	lock.holders++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if lock.holders--; lock.holders == 0 {
+			delete(l.locks, sessionID)
+		}
+	}
+}
+
+// getEditorTokens reads the bearer tokens that authorize cue edits from
+// APP_EDITOR_TOKENS, a comma-separated list. Without any, cues cannot be
+// edited.
+func getEditorTokens(getenv func(string) string) []string {
+	return splitQueryList(getenv("APP_EDITOR_TOKENS"))
+}
+
+// authorizedEditor reports whether r carries one of tokens as its bearer
+// token.
+func authorizedEditor(r *http.Request, tokens []string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	for _, candidate := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// listCuesHandler lists the cues of a session in the language the query
+// selects, with their edits applied and marked.
+func listCuesHandler(store SessionStore, registry ArtifactRegistry, artifacts outputpkg.ArtifactStore, edits outputpkg.CueEditStore, logger *zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.PathValue("id")
+		if !sessionIDPattern.MatchString(sessionID) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid session id"))
+			return
+		}
+		if artifacts == nil || edits == nil {
+			writeError(w, logger, http.StatusServiceUnavailable, errors.New("cue editing not configured"))
+			return
+		}
+		language := r.URL.Query().Get("language")
+		if language == "" {
+			writeError(w, logger, http.StatusBadRequest, errors.New("language required"))
+			return
+		}
+
+		ctx := r.Context()
+
+		if !sessionExists(ctx, w, store, sessionID, logger) {
+			return
+		}
+
+		cues, _, err := loadCues(ctx, registry, artifacts, sessionID, language)
+		if err != nil {
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load cues: %w", err))
+			return
+		}
+		if cues == nil {
+			writeError(w, logger, http.StatusNotFound, fmt.Errorf("no %s cues recorded", language))
+			return
+		}
+		recorded, err := edits.CueEdits(ctx, sessionID)
+		if err != nil {
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load cue edits: %w", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(cueList{Language: language, Cues: outputpkg.ApplyCueEdits(cues, recorded)}); err != nil {
+			logger.Errorw("failed to encode response", "error", err)
+		}
+	}
+}
+
+// editCueHandler records an edit of a cue of a session, layered over the
+// cue generated. When the session's cues are recorded, the edit is
+// validated against the cue, and the subtitle files of its language, the
+// transcript, and the package holding them are rendered again with the
+// session's generator; otherwise the edit is accepted for the run to apply
+// once it completes. Edits of a session are made one at a time, so that
+// none renders over another.
+func editCueHandler(store SessionStore, registry ArtifactRegistry, writer *outputpkg.ArtifactWriter, edits outputpkg.CueEditStore, generators GeneratorSource, tokens []string, logger *zap.SugaredLogger) http.HandlerFunc {
+	var locks sessionLocks
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.PathValue("id")
+		if !sessionIDPattern.MatchString(sessionID) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid session id"))
+			return
+		}
+		match := cueIDPattern.FindStringSubmatch(r.PathValue("cue"))
+		if match == nil {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid cue id"))
+			return
+		}
+		cueID, language := match[0], match[1]
+		if writer == nil || edits == nil || generators == nil || len(tokens) == 0 {
+			writeError(w, logger, http.StatusServiceUnavailable, errors.New("cue editing not configured"))
+			return
+		}
+		if !authorizedEditor(r, tokens) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, logger, http.StatusUnauthorized, errors.New("editor token required"))
+			return
+		}
+
+		var input cueEditInput
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&input); err != nil {
+			writeError(w, logger, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		if input.Text == nil && input.StartTime == nil && input.EndTime == nil {
+			writeError(w, logger, http.StatusBadRequest, errors.New("text, startTime, or endTime required"))
+			return
+		}
+
+		ctx := r.Context()
+
+		session, err := store.Get(ctx, sessionID)
+		if err != nil {
+			if errors.Is(err, ErrSessionNotFound) {
+				writeError(w, logger, http.StatusNotFound, fmt.Errorf("session %s not found", sessionID))
+				return
+			}
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load session: %w", err))
+			return
+		}
+
+		unlock := locks.lock(sessionID)
+		defer unlock()
+
+		recorded, err := edits.CueEdits(ctx, sessionID)
+		if err != nil {
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load cue edits: %w", err))
+			return
+		}
+		edit := outputpkg.CueEdit{CueID: cueID}
+		for _, earlier := range recorded {
+			if earlier.CueID == cueID {
+				edit = earlier
+			}
+		}
+		edit = edit.Merge(outputpkg.CueEdit{Text: input.Text, StartTime: input.StartTime, EndTime: input.EndTime, EditedAt: time.Now().UTC()})
+
+		cues, artifacts, err := loadCues(ctx, registry, writer.Store(), sessionID, language)
+		if err != nil {
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load cues: %w", err))
+			return
+		}
+		var cue *outputpkg.Cue
+		var position int
+		for i := range cues {
+			if cues[i].ID == cueID {
+				cue, position = &cues[i], i
+			}
+		}
+		switch {
+		case cues != nil && cue == nil:
+			writeError(w, logger, http.StatusNotFound, fmt.Errorf("cue %s not found", cueID))
+			return
+		case cue != nil:
+			if err := outputpkg.ValidateCueEdit(*cue, edit); err != nil {
+				writeError(w, logger, http.StatusBadRequest, err)
+				return
+			}
+		default:
+			// The run has yet to list its cues; check what can be.
+			if edit.Text != nil && *edit.Text == "" {
+				writeError(w, logger, http.StatusBadRequest, errors.New("cue text required"))
+				return
+			}
+			if edit.StartTime != nil && edit.EndTime != nil && *edit.EndTime <= *edit.StartTime {
+				writeError(w, logger, http.StatusBadRequest, errors.New("cue must start before it ends"))
+				return
+			}
+		}
+
+		var generator outputpkg.SubtitleGenerator
+		if cue != nil {
+			if generator, err = generators.Generator(session); err != nil {
+				writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to build subtitle generator: %w", err))
+				return
+			}
+		}
+
+		if err := edits.SaveCueEdit(ctx, sessionID, edit); err != nil {
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to save cue edit: %w", err))
+			return
+		}
+
+		status, view := http.StatusAccepted, cueEditView{Edit: edit}
+		if cue != nil {
+			recorded = append(recorded, edit)
+			if err := renderCues(ctx, writer, generator, sessionID, language, cues, recorded, artifacts); err != nil {
+				writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to render edited subtitles: %w", err))
+				return
+			}
+			status, view.Cue = http.StatusOK, &outputpkg.ApplyCueEdits(cues, recorded)[position]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(view); err != nil {
+			logger.Errorw("failed to encode response", "error", err)
+		}
+	}
+}
+
+// loadCues returns the cue list recorded for sessionID in language, nil
+// when none is, along with every artifact recorded for the session.
+func loadCues(ctx context.Context, registry ArtifactRegistry, artifacts outputpkg.ArtifactStore, sessionID, language string) ([]outputpkg.Cue, []outputpkg.Artifact, error) {
+	recorded, err := registry.Artifacts(ctx, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, artifact := range recorded {
+		if artifact.Kind != outputpkg.ArtifactCues || !strings.EqualFold(artifact.Language, language) {
+			continue
+		}
+		body, err := artifacts.Get(ctx, artifact.Key)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer func() { _ = body.Close() }()
+		cues := make([]outputpkg.Cue, 0)
+		if err := json.NewDecoder(body).Decode(&cues); err != nil {
+			return nil, nil, fmt.Errorf("decode %s: %w", artifact.Key, err)
+		}
+		return cues, recorded, nil
+	}
+	return nil, recorded, nil
+}
+
+// renderCues persists again, with generator, the subtitle files recorded
+// for sessionID in language from cues with edits applied, the transcript
+// with the edits of those cues applied, and the package bundling the files
+// of the session when one is recorded.
+func renderCues(ctx context.Context, writer *outputpkg.ArtifactWriter, generator outputpkg.SubtitleGenerator, sessionID, language string, cues []outputpkg.Cue, edits []outputpkg.CueEdit, recorded []outputpkg.Artifact) error {
+	edited := outputpkg.ApplyCueEdits(cues, edits)
+	var packaged []outputpkg.Artifact
+	var bundled bool
+	for _, artifact := range recorded {
+		switch artifact.Kind {
+		case outputpkg.ArtifactPackage:
+			bundled = true
+		case outputpkg.ArtifactTranscript:
+			rendered, err := editTranscript(ctx, writer, sessionID, artifact.Key, language, cues, edits)
+			if err != nil {
+				return err
+			}
+			packaged = append(packaged, rendered)
+		case outputpkg.ArtifactSubtitles:
+			if strings.EqualFold(artifact.Language, language) {
+				translations := make(chan translationpkg.Translation, len(edited))
+				for _, translated := range outputpkg.CueTranslations(artifact.Language, edited) {
+					translations <- translated
+				}
+				close(translations)
+				// The cues are formatted already, so the generator renders
+				// them as they are.
+				rendered, err := writer.PersistSubtitles(ctx, generator, outputpkg.SubtitleFormat(artifact.Format), sessionID, artifact.Language, translations)
+				if err != nil {
+					return err
+				}
+				artifact = rendered
+			}
+			packaged = append(packaged, artifact)
+		}
+	}
+	if bundled {
+		if _, err := writer.PersistPackage(ctx, sessionID, packaged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// editTranscript persists the transcript of sessionID stored under key
+// again with the edits of cues, the cues of language, applied.
+func editTranscript(ctx context.Context, writer *outputpkg.ArtifactWriter, sessionID, key, language string, cues []outputpkg.Cue, edits []outputpkg.CueEdit) (outputpkg.Artifact, error) {
+	body, err := writer.Store().Get(ctx, key)
+	if err != nil {
+		return outputpkg.Artifact{}, err
+	}
+	defer func() { _ = body.Close() }()
+	records, err := outputpkg.ReadTranscript(body)
+	if err != nil {
+		return outputpkg.Artifact{}, fmt.Errorf("read %s: %w", key, err)
+	}
+	return writer.PersistTranscript(ctx, sessionID, outputpkg.EditTranscript(records, language, cues, edits))
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/archive"
+	outputpkg "streamlation/packages/backend/output"
+	translationpkg "streamlation/packages/backend/translation"
+)
+
+type stubCueEditStore struct {
+	edits []outputpkg.CueEdit
+}
+
+func (s *stubCueEditStore) SaveCueEdit(_ context.Context, _ string, edit outputpkg.CueEdit) error {
+	for i := range s.edits {
+		if s.edits[i].CueID == edit.CueID {
+			s.edits[i] = edit
+			return nil
+		}
+	}
+	s.edits = append(s.edits, edit)
+	return nil
+}
+
+func (s *stubCueEditStore) CueEdits(context.Context, string) ([]outputpkg.CueEdit, error) {
+	return append([]outputpkg.CueEdit(nil), s.edits...), nil
+}
+
+type stubGeneratorSource struct {
+	sessions []TranslationSession
+}
+
+func (s *stubGeneratorSource) Generator(session TranslationSession) (outputpkg.SubtitleGenerator, error) {
+	s.sessions = append(s.sessions, session)
+	return outputpkg.NewStubGenerator(), nil
+}
+
+func newCueFixture(t *testing.T) (*stubArtifactRegistry, *outputpkg.ArtifactWriter) {
+	t.Helper()
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	registry := &stubArtifactRegistry{}
+	writer, err := outputpkg.NewArtifactWriter(store, registry)
+	if err != nil {
+		t.Fatalf("new artifact writer: %v", err)
+	}
+	ctx := context.Background()
+	cues := []outputpkg.Cue{
+		{ID: "es-0", EndTime: time.Second, Text: "Hola."},
+		{ID: "es-1", Index: 1, StartTime: 2 * time.Second, EndTime: 3 * time.Second, Text: "Adiós."},
+	}
+	if _, err := writer.PersistCues(ctx, "session123", "es", cues); err != nil {
+		t.Fatalf("persist cues: %v", err)
+	}
+	var subtitles []outputpkg.Artifact
+	for _, format := range []outputpkg.SubtitleFormat{outputpkg.FormatSRT, outputpkg.FormatVTT} {
+		translations := make(chan translationpkg.Translation, 2)
+		for _, translated := range outputpkg.CueTranslations("es", cues) {
+			translations <- translated
+		}
+		close(translations)
+		artifact, err := writer.PersistSubtitles(ctx, outputpkg.NewStubGenerator(), format, "session123", "es", translations)
+		if err != nil {
+			t.Fatalf("persist subtitles: %v", err)
+		}
+		subtitles = append(subtitles, artifact)
+	}
+	transcript, err := writer.PersistTranscript(ctx, "session123", []outputpkg.TranscriptRecord{
+		{EndTime: time.Second, SourceText: "Hello.", Translations: []outputpkg.TranscriptTranslation{{Language: "es", Text: "Hola."}}},
+		{Index: 1, StartTime: 2 * time.Second, EndTime: 3 * time.Second, SourceText: "Goodbye.", Translations: []outputpkg.TranscriptTranslation{{Language: "es", Text: "Adiós."}}},
+	})
+	if err != nil {
+		t.Fatalf("persist transcript: %v", err)
+	}
+	if _, err := writer.PersistPackage(ctx, "session123", append(subtitles, transcript)); err != nil {
+		t.Fatalf("persist package: %v", err)
+	}
+	return registry, writer
+}
+
+func TestEditCueHandlerRendersEditedSubtitles(t *testing.T) {
+	registry, writer := newCueFixture(t)
+	edits := &stubCueEditStore{}
+	generators := &stubGeneratorSource{}
+	sessions := &stubSessionStore{getFunc: func(context.Context, string) (TranslationSession, error) {
+		return TranslationSession{ID: "session123"}, nil
+	}}
+	handler := editCueHandler(sessions, registry, writer, edits, generators, []string{"secret"}, newLogger())
+
+	patch := func(cue, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/sessions/session123/cues/"+cue, strings.NewReader(body))
+		req.SetPathValue("id", "session123")
+		req.SetPathValue("cue", cue)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := patch("es-1", "", `{"text":"Hasta luego."}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected edits without a token to be refused, got %d", rr.Code)
+	}
+	if rr := patch("es-1", "guess", `{"text":"Hasta luego."}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected edits with an unknown token to be refused, got %d", rr.Code)
+	}
+
+	rr := patch("es-1", "secret", `{"text":"Hasta luego."}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the edit to be applied, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var view cueEditView
+	if err := json.NewDecoder(rr.Body).Decode(&view); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if view.Cue == nil || view.Cue.Text != "Hasta luego." || !view.Cue.Edited || view.Cue.StartTime != 2*time.Second {
+		t.Fatalf("expected the edited cue, got %+v", view)
+	}
+	if rr := patch("es-1", "secret", `{"endTime":2500000000}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected a second edit to be applied, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(edits.edits) != 1 || *edits.edits[0].Text != "Hasta luego." || *edits.edits[0].EndTime != 2500*time.Millisecond {
+		t.Fatalf("expected the edits of the cue merged, got %+v", edits.edits)
+	}
+
+	if srt := readArtifact(t, writer, "session123/subtitles/es.srt"); !strings.Contains(srt, "00:00:02,000 --> 00:00:02,500\nHasta luego.") {
+		t.Fatalf("expected the SRT rendered again, got %q", srt)
+	}
+	if vtt := readArtifact(t, writer, "session123/subtitles/es.vtt"); !strings.Contains(vtt, "Hasta luego.") {
+		t.Fatalf("expected the WebVTT rendered again, got %q", vtt)
+	}
+	if len(generators.sessions) != 2 || generators.sessions[0].ID != "session123" {
+		t.Fatalf("expected the session's generator to render each edit, got %+v", generators.sessions)
+	}
+	records, err := outputpkg.ReadTranscript(strings.NewReader(readArtifact(t, writer, "session123/transcript/mul.jsonl")))
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+	if len(records) != 2 || records[0].Translations[0].Text != "Hola." || records[1].Translations[0].Text != "Hasta luego." {
+		t.Fatalf("expected the transcript rendered again, got %+v", records)
+	}
+	pkg := readArtifact(t, writer, "session123/package/mul.zip")
+	files, err := zip.NewReader(strings.NewReader(pkg), int64(len(pkg)))
+	if err != nil {
+		t.Fatalf("open package: %v", err)
+	}
+	if len(files.File) != 4 {
+		t.Fatalf("expected the subtitles, transcript, and manifest packaged, got %d files", len(files.File))
+	}
+	for _, file := range files.File {
+		if file.Name == "manifest.json" {
+			continue
+		}
+		body, _ := file.Open()
+		packaged, _ := io.ReadAll(body)
+		if !strings.Contains(string(packaged), "Hasta luego.") {
+			t.Fatalf("expected the package rebuilt, got %s: %q", file.Name, packaged)
+		}
+	}
+
+	if rr := patch("es-1", "secret", `{"startTime":3000000000}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected an edit ending the cue before it starts to be rejected, got %d", rr.Code)
+	}
+	if rr := patch("es-9", "secret", `{"text":"x"}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown cues to be missing, got %d", rr.Code)
+	}
+	if rr := patch("es-1", "secret", `{}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected empty edits to be rejected, got %d", rr.Code)
+	}
+	if rr := patch("fr-0", "secret", `{"text":"Salut."}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected edits of cues not listed yet to be accepted, got %d", rr.Code)
+	}
+}
+
+func TestEditCueHandlerSerializesEditsOfASession(t *testing.T) {
+	registry, writer := newCueFixture(t)
+	edits := &stubCueEditStore{}
+	handler := editCueHandler(&stubSessionStore{}, registry, writer, edits, &stubGeneratorSource{}, []string{"secret"}, newLogger())
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 8)
+	for i := 0; i < cap(codes); i++ {
+		cue := []string{"es-0", "es-1"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPatch, "/sessions/session123/cues/"+cue, strings.NewReader(`{"text":"Editado `+cue+`"}`))
+			req.SetPathValue("id", "session123")
+			req.SetPathValue("cue", cue)
+			req.Header.Set("Authorization", "Bearer secret")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			codes <- rr.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("expected every edit to be applied, got %d", code)
+		}
+	}
+
+	srt := readArtifact(t, writer, "session123/subtitles/es.srt")
+	if !strings.Contains(srt, "Editado es-0") || !strings.Contains(srt, "Editado es-1") {
+		t.Fatalf("expected both cues edited in the SRT, got %q", srt)
+	}
+}
+
+func TestListCuesHandlerMarksEdits(t *testing.T) {
+	registry, writer := newCueFixture(t)
+	text := "Buenas."
+	edits := &stubCueEditStore{edits: []outputpkg.CueEdit{{CueID: "es-0", Text: &text}}}
+	handler := listCuesHandler(&stubSessionStore{}, registry, writer.Store(), edits, newLogger())
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/session123/cues?"+query, nil)
+		req.SetPathValue("id", "session123")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("language=es")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the cues, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var list cueList
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(list.Cues) != 2 || list.Cues[0].Text != text || !list.Cues[0].Edited || list.Cues[1].Edited {
+		t.Fatalf("expected the first cue edited, got %+v", list.Cues)
+	}
+	if rr := get("language=fr"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected languages without cues to be missing, got %d", rr.Code)
+	}
+}
+
+func readArtifact(t *testing.T, writer *outputpkg.ArtifactWriter, key string) string {
+	t.Helper()
+	body, err := writer.Store().Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	defer func() { _ = body.Close() }()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	statuspkg "streamlation/packages/backend/status"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 500
+)
+
+// StatusHistory reads the persisted status timeline of a session.
+type StatusHistory interface {
+	History(ctx context.Context, sessionID string, after int64, limit int) ([]statuspkg.HistoryEntry, error)
+}
+
+type statusHistoryPage struct {
+	Events     []statuspkg.HistoryEntry `json:"events"`
+	NextCursor int64                    `json:"nextCursor,omitempty"`
+}
+
+func sessionHistoryHandler(store SessionStore, history StatusHistory, logger *zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionID := r.PathValue("id")
+		if !sessionIDPattern.MatchString(sessionID) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid session id"))
+			return
+		}
+
+		query := r.URL.Query()
+
+		limit := defaultHistoryLimit
+		if limitParam := query.Get("limit"); limitParam != "" {
+			value, err := strconv.Atoi(limitParam)
+			if err != nil || value <= 0 || value > maxHistoryLimit {
+				writeError(w, logger, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit))
+				return
+			}
+			limit = value
+		}
+
+		var after int64
+		if afterParam := query.Get("after"); afterParam != "" {
+			value, err := strconv.ParseInt(afterParam, 10, 64)
+			if err != nil || value < 0 {
+				writeError(w, logger, http.StatusBadRequest, errors.New("after must be a non-negative event id"))
+				return
+			}
+			after = value
+		}
+
+		ctx := r.Context()
+
+		if _, err := store.Get(ctx, sessionID); err != nil {
+			if errors.Is(err, ErrSessionNotFound) {
+				writeError(w, logger, http.StatusNotFound, fmt.Errorf("session %s not found", sessionID))
+				return
+			}
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load session: %w", err))
+			return
+		}
+
+		entries, err := history.History(ctx, sessionID, after, limit)
+		if err != nil {
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load status history: %w", err))
+			return
+		}
+
+		page := statusHistoryPage{Events: entries}
+		if len(entries) == limit {
+			page.NextCursor = entries[len(entries)-1].ID
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			logger.Errorw("failed to encode response", "error", err)
+		}
+	}
+}
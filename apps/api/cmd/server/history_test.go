@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestSessionHistoryHandler_Paginates(t *testing.T) {
+	var gotAfter int64
+	var gotLimit int
+	history := &stubStatusHistory{historyFunc: func(_ context.Context, sessionID string, after int64, limit int) ([]statuspkg.HistoryEntry, error) {
+		gotAfter, gotLimit = after, limit
+		return []statuspkg.HistoryEntry{
+			{ID: 11, SessionStatusEvent: statuspkg.SessionStatusEvent{SessionID: sessionID, Stage: "ingestion", State: "queued", Timestamp: time.Now().UTC()}},
+			{ID: 12, SessionStatusEvent: statuspkg.SessionStatusEvent{SessionID: sessionID, Stage: "asr", State: "running", Timestamp: time.Now().UTC()}},
+		}, nil
+	}}
+
+	logger := newLogger()
+	handler := sessionHistoryHandler(&stubSessionStore{}, history, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions/session123/events/history?after=10&limit=2", nil)
+	req.SetPathValue("id", "session123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if gotAfter != 10 || gotLimit != 2 {
+		t.Fatalf("unexpected pagination args after=%d limit=%d", gotAfter, gotLimit)
+	}
+
+	var page statusHistoryPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(page.Events) != 2 || page.Events[1].Stage != "asr" {
+		t.Fatalf("unexpected events: %#v", page.Events)
+	}
+	if page.NextCursor != 12 {
+		t.Fatalf("expected next cursor 12 for a full page, got %d", page.NextCursor)
+	}
+}
+
+func TestSessionHistoryHandler_LastPageHasNoCursor(t *testing.T) {
+	history := &stubStatusHistory{historyFunc: func(context.Context, string, int64, int) ([]statuspkg.HistoryEntry, error) {
+		return []statuspkg.HistoryEntry{{ID: 3}}, nil
+	}}
+	handler := sessionHistoryHandler(&stubSessionStore{}, history, newLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions/session123/events/history", nil)
+	req.SetPathValue("id", "session123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if _, ok := raw["nextCursor"]; ok {
+		t.Fatalf("expected no cursor on a partial page: %s", rr.Body.String())
+	}
+}
+
+func TestSessionHistoryHandler_RejectsBadParams(t *testing.T) {
+	handler := sessionHistoryHandler(&stubSessionStore{}, &stubStatusHistory{}, newLogger())
+
+	for _, query := range []string{"?limit=0", "?limit=501", "?after=-1", "?after=abc"} {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/session123/events/history"+query, nil)
+		req.SetPathValue("id", "session123")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("query %s: expected status 400, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestSessionHistoryHandler_NotFound(t *testing.T) {
+	store := &stubSessionStore{getFunc: func(context.Context, string) (TranslationSession, error) {
+		return TranslationSession{}, ErrSessionNotFound
+	}}
+	handler := sessionHistoryHandler(store, &stubStatusHistory{}, newLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions/missing123/events/history", nil)
+	req.SetPathValue("id", "missing123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rr.Code)
+	}
+}
+
+type stubStatusHistory struct {
+	historyFunc func(context.Context, string, int64, int) ([]statuspkg.HistoryEntry, error)
+}
+
+func (s *stubStatusHistory) History(ctx context.Context, sessionID string, after int64, limit int) ([]statuspkg.HistoryEntry, error) {
+	if s.historyFunc != nil {
+		return s.historyFunc(ctx, sessionID, after, limit)
+	}
+	return nil, nil
+}
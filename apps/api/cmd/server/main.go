@@ -12,8 +12,11 @@ import (
 	"syscall"
 	"time"
 
+	"streamlation/packages/backend/metrics"
+	outputpkg "streamlation/packages/backend/output"
 	postgres "streamlation/packages/backend/postgres"
 	queuepkg "streamlation/packages/backend/queue"
+	sessionpkg "streamlation/packages/backend/session"
 	statuspkg "streamlation/packages/backend/status"
 
 	"go.uber.org/zap"
@@ -51,7 +54,40 @@ func main() {
 		logger.Fatalw("failed to ensure session schema", "error", err)
 	}
 
+	if err := postgres.EnsureStatusEventSchema(ctx, pgClient); err != nil {
+		logger.Fatalw("failed to ensure status event schema", "error", err)
+	}
+
+	if err := postgres.EnsureArtifactSchema(ctx, pgClient); err != nil {
+		logger.Fatalw("failed to ensure artifact schema", "error", err)
+	}
+
 	sessionStore := postgres.NewSessionStore(pgClient)
+	statusHistory := postgres.NewStatusEventStore(pgClient)
+	artifactRegistry := postgres.NewArtifactRegistry(pgClient)
+
+	artifactStore, err := getArtifactStore(os.Getenv)
+	if err != nil {
+		logger.Fatalw("failed to configure artifact storage", "error", err)
+	}
+
+	var artifactWriter *outputpkg.ArtifactWriter
+	var cueEdits outputpkg.CueEditStore
+	if artifactStore != nil {
+		if err := postgres.EnsureCueEditSchema(ctx, pgClient); err != nil {
+			logger.Fatalw("failed to ensure cue edit schema", "error", err)
+		}
+		cueEdits = postgres.NewCueEditStore(pgClient)
+		if artifactWriter, err = outputpkg.NewArtifactWriter(artifactStore, artifactRegistry); err != nil {
+			logger.Fatalw("failed to configure artifacts", "error", err)
+		}
+	}
+	editorTokens := getEditorTokens(os.Getenv)
+
+	playlists, err := getPlaylistConfig(os.Getenv)
+	if err != nil {
+		logger.Fatalw("failed to configure muxed playlists", "error", err)
+	}
 
 	redisAddr := getRedisAddr()
 	enqueuer, err := queuepkg.NewRedisIngestionEnqueuer(redisAddr)
@@ -60,28 +96,79 @@ func main() {
 	}
 	defer func() { _ = enqueuer.Close() }()
 
-	statusPublisher, err := statuspkg.NewRedisStatusPublisher(redisAddr)
+	controlPublisher, err := queuepkg.NewRedisControlPublisher(redisAddr)
+	if err != nil {
+		logger.Fatalw("failed to create redis control publisher", "error", err)
+	}
+	defer func() { _ = controlPublisher.Close() }()
+	operatorTokens := getOperatorTokens(os.Getenv)
+
+	statusBackend := getStatusBackendConfig(redisAddr)
+	transportPublisher, err := statuspkg.NewPublisher(statusBackend)
+	if err != nil {
+		logger.Fatalw("failed to create status publisher", "error", err, "backend", statusBackend.Backend)
+	}
+	defer func() { _ = transportPublisher.Close() }()
+
+	progressStore, err := statuspkg.NewRedisProgressStore(redisAddr)
 	if err != nil {
-		logger.Fatalw("failed to create redis status publisher", "error", err)
+		logger.Fatalw("failed to create redis progress store", "error", err)
 	}
-	defer func() { _ = statusPublisher.Close() }()
+	defer func() { _ = progressStore.Close() }()
 
-	statusSubscriber, err := statuspkg.NewRedisStatusSubscriber(redisAddr)
+	statusPublisher := statuspkg.NewRecordingPublisher(
+		statuspkg.NewRecordingPublisher(transportPublisher, progressStore),
+		statusHistory,
+	)
+
+	stallTimeout, err := getStallTimeout(os.Getenv)
 	if err != nil {
-		logger.Fatalw("failed to create redis status subscriber", "error", err)
+		logger.Fatalw("failed to configure stall watchdog", "error", err)
+	}
+	go runWatchdog(ctx, statuspkg.NewWatchdog(progressStore, stallTimeout), statusPublisher, defaultStallCheckInterval, logger)
+
+	statusSubscriber, err := statuspkg.NewSubscriber(statusBackend)
+	if err != nil {
+		logger.Fatalw("failed to create status subscriber", "error", err, "backend", statusBackend.Backend)
 	}
 	defer func() { _ = statusSubscriber.Close() }()
 
+	preflighter, err := newPreflighter(os.Getenv("APP_PIPELINE_DEFINITION"))
+	if err != nil {
+		logger.Fatalw("failed to configure pipeline preflight", "error", err)
+	}
+
+	credentialsKey, err := getCredentialsKey()
+	if err != nil {
+		logger.Fatalw("failed to read source credentials key", "error", err)
+	}
+
+	registry := metrics.NewRegistry()
+	enqueuer.Instrument(registry)
+
 	mux := http.NewServeMux()
 	mux.Handle("/healthz", healthHandler(logger))
-	mux.HandleFunc("POST /sessions", createSessionHandler(sessionStore, enqueuer, statusPublisher, logger))
-	mux.HandleFunc("GET /sessions", listSessionsHandler(sessionStore, logger))
-	mux.HandleFunc("GET /sessions/{id}", getSessionHandler(sessionStore, logger))
+	mux.HandleFunc("POST /sessions", createSessionHandler(sessionStore, enqueuer, statusPublisher, credentialsKey, logger))
+	mux.HandleFunc("POST /sessions/preflight", preflightSessionHandler(preflighter, logger))
+	mux.HandleFunc("GET /sessions", listSessionsHandler(sessionStore, progressStore, logger))
+	mux.HandleFunc("GET /sessions/{id}", getSessionHandler(sessionStore, progressStore, logger))
+	mux.HandleFunc("POST /sessions/{id}/cancel", cancelSessionHandler(sessionStore, controlPublisher, operatorTokens, logger))
+	mux.HandleFunc("PUT /sessions/{id}/options", updateOptionsHandler(sessionStore, controlPublisher, operatorTokens, logger))
+	mux.HandleFunc("POST /workers/{id}/drain", drainWorkerHandler(controlPublisher, operatorTokens, logger))
 	mux.HandleFunc("GET /sessions/{id}/events", sessionStatusHandler(statusSubscriber, logger))
+	mux.HandleFunc("GET /sessions/{id}/events/history", sessionHistoryHandler(sessionStore, statusHistory, logger))
+	mux.HandleFunc("GET /sessions/{id}/artifacts", listArtifactsHandler(sessionStore, artifactRegistry, logger))
+	mux.HandleFunc("GET /sessions/{id}/artifacts/{kind}/{file}", downloadArtifactHandler(sessionStore, artifactRegistry, artifactStore, logger))
+	mux.HandleFunc("GET /sessions/{id}/subtitles", subtitlesHandler(sessionStore, artifactRegistry, artifactStore, logger))
+	mux.HandleFunc("GET /sessions/{id}/cues", listCuesHandler(sessionStore, artifactRegistry, artifactStore, cueEdits, logger))
+	mux.HandleFunc("PATCH /sessions/{id}/cues/{cue}", editCueHandler(sessionStore, artifactRegistry, artifactWriter, cueEdits, preflighter, editorTokens, logger))
+	mux.HandleFunc("GET /sessions/{id}/transcript", transcriptHandler(sessionStore, artifactRegistry, artifactStore, logger))
+	mux.HandleFunc("GET /sessions/{id}/playlist.m3u8", playlistHandler(sessionStore, playlists, logger))
+	mux.HandleFunc("GET /metrics", metrics.Handler(registry))
 
 	server := &http.Server{
 		Addr:              addr,
-		Handler:           loggingMiddleware(logger)(mux),
+		Handler:           loggingMiddleware(logger)(metricsMiddleware(registry, mux)(mux)),
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
@@ -134,6 +221,27 @@ func getRedisAddr() string {
 	return defaultRedisAddr
 }
 
+// getStatusBackendConfig selects the status event transport. APP_STATUS_BACKEND
+// is redis (default) or nats; APP_NATS_URL addresses the NATS server.
+func getStatusBackendConfig(redisAddr string) statuspkg.BackendConfig {
+	return statuspkg.BackendConfig{
+		Backend:   os.Getenv("APP_STATUS_BACKEND"),
+		RedisAddr: redisAddr,
+		NATSURL:   os.Getenv("APP_NATS_URL"),
+	}
+}
+
+// getCredentialsKey returns the key that source credentials are sealed
+// with, read from APP_SOURCE_CREDENTIALS_KEY as 32 base64 encoded bytes.
+// Without it, sessions with source credentials are rejected.
+func getCredentialsKey() ([]byte, error) {
+	raw := os.Getenv("APP_SOURCE_CREDENTIALS_KEY")
+	if raw == "" {
+		return nil, nil
+	}
+	return sessionpkg.ParseCredentialsKey(raw)
+}
+
 func healthHandler(logger *zap.SugaredLogger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -192,6 +300,17 @@ func newLogger() *zap.SugaredLogger {
 		cfg.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
 	}
 
+	// APP_LOG_FORMAT selects json (default) or console entries, and
+	// APP_LOG_FILE a file entries are also written to, rotated at 100 MB.
+	if format := os.Getenv("APP_LOG_FORMAT"); format != "" {
+		cfg.Encoding = format
+	}
+	if path := os.Getenv("APP_LOG_FILE"); path != "" {
+		cfg.OutputPaths = append(cfg.OutputPaths, path)
+		cfg.ErrorOutputPaths = append(cfg.ErrorOutputPaths, path)
+		cfg.Rotation = &zap.RotationConfig{MaxSize: 100, MaxBackups: 5}
+	}
+
 	logger, err := cfg.Build()
 	if err != nil {
 		panic(fmt.Sprintf("failed to initialize logger: %v", err))
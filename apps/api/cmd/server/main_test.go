@@ -3,6 +3,9 @@ package main
 import (
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"go.uber.org/zap"
@@ -60,6 +63,25 @@ func TestNewLoggerHonorsEnv(t *testing.T) {
 	}
 }
 
+func TestNewLoggerWritesLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.log")
+	t.Setenv("APP_LOG_FORMAT", "console")
+	t.Setenv("APP_LOG_FILE", path)
+	logger := newLogger()
+	logger.With("sessionID", "abc").Infow("request completed", "status", 200)
+	logger.Errorw("request failed")
+	_ = logger.Sync()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "\tINFO\trequest completed\t{\"sessionID\":\"abc\",\"status\":200}") || !strings.HasSuffix(lines[1], "\tERROR\trequest failed") {
+		t.Fatalf("unexpected log file:\n%s", data)
+	}
+}
+
 // Ensure newLogger does not panic when env is unset.
 func TestNewLoggerDefaultLevel(t *testing.T) {
 	t.Setenv("APP_LOG_LEVEL", "")
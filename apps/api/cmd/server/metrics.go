@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"streamlation/packages/backend/metrics"
+)
+
+// metricsMiddleware counts the requests next serves, by method, route, and
+// status code, and observes how long they took, in registry. Routes are
+// the patterns the requests match in routes, so that session IDs do not
+// become labels; requests matching none count as "unmatched".
+func metricsMiddleware(registry *metrics.Registry, routes *http.ServeMux) func(http.Handler) http.Handler {
+	requests := registry.NewCounter("streamlation_api_requests_total", "HTTP requests served, by method, route, and status code.", "method", "route", "code")
+	durations := registry.NewHistogram("streamlation_api_request_duration_seconds", "HTTP request latencies, by method and route.", nil, "method", "route")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, route := routes.Handler(r)
+			if route == "" {
+				route = "unmatched"
+			}
+			start := time.Now()
+			lrw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(lrw, r)
+			durations.ObserveDuration(time.Since(start), r.Method, route)
+			requests.Inc(r.Method, route, strconv.Itoa(lrw.statusCode))
+		})
+	}
+}
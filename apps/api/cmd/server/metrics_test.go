@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"streamlation/packages/backend/metrics"
+)
+
+func TestMetricsMiddlewareCountsRoutes(t *testing.T) {
+	registry := metrics.NewRegistry()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "missing" {
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("GET /metrics", metrics.Handler(registry))
+	handler := metricsMiddleware(registry, mux)(mux)
+
+	for _, path := range []string{"/sessions/abc", "/sessions/def", "/sessions/missing", "/nowhere"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		`streamlation_api_requests_total{method="GET",route="GET /sessions/{id}",code="200"} 2`,
+		`streamlation_api_requests_total{method="GET",route="GET /sessions/{id}",code="404"} 1`,
+		`streamlation_api_requests_total{method="GET",route="unmatched",code="404"} 1`,
+		`streamlation_api_request_duration_seconds_count{method="GET",route="GET /sessions/{id}"} 3`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %s in metrics:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	outputpkg "streamlation/packages/backend/output"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// playlistFetchTimeout bounds fetching a session's source playlist.
+	playlistFetchTimeout = 10 * time.Second
+	// maxSourcePlaylistBytes bounds the source playlists that are muxed.
+	maxSourcePlaylistBytes = 1 << 20
+	// playlistBandwidth is the bandwidth a muxed playlist gives a source
+	// that is a media playlist, whose bandwidth is unknown.
+	playlistBandwidth = 2000000
+)
+
+// playlistConfig locates the renditions the worker publishes, which muxed
+// playlists add to the sessions' sources.
+type playlistConfig struct {
+	// subtitles and dubs are the URLs the worker's subtitle and dub track
+	// directories are served from; nil when they are not.
+	subtitles *url.URL
+	dubs      *url.URL
+	client    *http.Client
+}
+
+// getPlaylistConfig reads the URLs the worker's subtitle and dub tracks are
+// served from, APP_SUBTITLE_TRACK_URL and APP_DUB_TRACK_URL, such as
+// "https://cdn.example.com/subtitles/".
+func getPlaylistConfig(getenv func(string) string) (playlistConfig, error) {
+	cfg := playlistConfig{client: &http.Client{Timeout: playlistFetchTimeout}}
+	for _, setting := range []struct {
+		name   string
+		target **url.URL
+	}{
+		{"APP_SUBTITLE_TRACK_URL", &cfg.subtitles},
+		{"APP_DUB_TRACK_URL", &cfg.dubs},
+	} {
+		raw := getenv(setting.name)
+		if raw == "" {
+			continue
+		}
+		base, err := url.Parse(raw)
+		if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+			return playlistConfig{}, fmt.Errorf("invalid %s %q", setting.name, raw)
+		}
+		if !strings.HasSuffix(base.Path, "/") {
+			base.Path += "/"
+		}
+		*setting.target = base
+	}
+	return cfg, nil
+}
+
+// playlistHandler serves the master playlist of a session's HLS source
+// rewritten to also offer the session's subtitle tracks and, when it is
+// dubbed, its dub tracks, so that players need a single URL.
+func playlistHandler(store SessionStore, cfg playlistConfig, logger *zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.PathValue("id")
+		if !sessionIDPattern.MatchString(sessionID) {
+			writeError(w, logger, http.StatusBadRequest, errors.New("invalid session id"))
+			return
+		}
+		if cfg.subtitles == nil && cfg.dubs == nil {
+			writeError(w, logger, http.StatusServiceUnavailable, errors.New("track urls not configured"))
+			return
+		}
+
+		ctx := r.Context()
+
+		session, err := store.Get(ctx, sessionID)
+		if err != nil {
+			if errors.Is(err, ErrSessionNotFound) {
+				writeError(w, logger, http.StatusNotFound, fmt.Errorf("session %s not found", sessionID))
+				return
+			}
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to load session: %w", err))
+			return
+		}
+		if session.Source.Type != "hls" {
+			writeError(w, logger, http.StatusConflict, fmt.Errorf("session source is %s, not hls", session.Source.Type))
+			return
+		}
+		// Players could not send the credentials of a protected source
+		// along with their requests for its media.
+		if session.Source.Credentials != "" {
+			writeError(w, logger, http.StatusConflict, errors.New("session source requires credentials"))
+			return
+		}
+		sourceURL, err := url.Parse(session.Source.URI)
+		if err != nil {
+			writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("invalid source uri: %w", err))
+			return
+		}
+
+		languages := append([]string{session.TargetLanguage}, session.Options.AdditionalLanguages...)
+		var subtitles []outputpkg.HLSSubtitleMedia
+		var dubs []outputpkg.HLSAudioMedia
+		for _, language := range languages {
+			if cfg.subtitles != nil {
+				subtitles = append(subtitles, outputpkg.HLSSubtitleMedia{
+					Name:     language,
+					Language: language,
+					URI:      trackURL(cfg.subtitles, sessionID, "subs-"+language),
+				})
+			}
+			if cfg.dubs != nil && session.Options.EnableDubbing {
+				dubs = append(dubs, outputpkg.HLSAudioMedia{
+					Name:     language + " (dubbed)",
+					Language: language,
+					URI:      trackURL(cfg.dubs, sessionID, "dub-"+language),
+				})
+			}
+		}
+
+		source, err := fetchPlaylist(r, cfg.client, sourceURL)
+		if err != nil {
+			writeError(w, logger, http.StatusBadGateway, fmt.Errorf("failed to fetch source playlist: %w", err))
+			return
+		}
+		playlist, err := outputpkg.MuxHLSMasterPlaylist(source, sourceURL, subtitles, dubs, playlistBandwidth)
+		if err != nil {
+			writeError(w, logger, http.StatusBadGateway, fmt.Errorf("failed to rewrite source playlist: %w", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		// The source's playlist may change, as live ones do.
+		w.Header().Set("Cache-Control", "no-cache")
+		if _, err := w.Write(playlist); err != nil {
+			logger.Errorw("failed to write playlist", "error", err)
+		}
+	}
+}
+
+// trackURL returns the URL of the media playlist of a session's track,
+// which the worker publishes as "<session>/hls/<name>.m3u8".
+func trackURL(base *url.URL, sessionID, name string) string {
+	return base.JoinPath(sessionID, "hls", name+".m3u8").String()
+}
+
+// fetchPlaylist fetches the playlist at target for the request r.
+func fetchPlaylist(r *http.Request, client *http.Client, target *url.URL) ([]byte, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSourcePlaylistBytes))
+}
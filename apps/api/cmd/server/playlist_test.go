@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPlaylistHandlerMuxesTracks(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000000\nvideo/index.m3u8\n"))
+	}))
+	defer source.Close()
+
+	session := TranslationSession{
+		ID:             "session123",
+		Source:         TranslationSource{Type: "hls", URI: source.URL + "/live/master.m3u8"},
+		TargetLanguage: "es",
+		Options:        TranslationOptions{EnableDubbing: true, AdditionalLanguages: []string{"fr"}},
+	}
+	store := &stubSessionStore{getFunc: func(context.Context, string) (TranslationSession, error) { return session, nil }}
+	cfg, err := getPlaylistConfig(func(name string) string {
+		return map[string]string{
+			"APP_SUBTITLE_TRACK_URL": "https://tracks.example.com/subtitles",
+			"APP_DUB_TRACK_URL":      "https://tracks.example.com/dubs/",
+		}[name]
+	})
+	if err != nil {
+		t.Fatalf("getPlaylistConfig failed: %v", err)
+	}
+	handler := playlistHandler(store, cfg, newLogger())
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/session123/playlist.m3u8", nil)
+		req.SetPathValue("id", "session123")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get()
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/vnd.apple.mpegurl" {
+		t.Fatalf("expected a playlist, got %d: %q", rr.Code, rr.Body.String())
+	}
+	for _, want := range []string{
+		`URI="https://tracks.example.com/subtitles/session123/hls/subs-es.m3u8"`,
+		`URI="https://tracks.example.com/subtitles/session123/hls/subs-fr.m3u8"`,
+		`NAME="fr (dubbed)",LANGUAGE="fr",DEFAULT=NO,AUTOSELECT=YES,URI="https://tracks.example.com/dubs/session123/hls/dub-fr.m3u8"`,
+		"SUBTITLES=\"subs\",AUDIO=\"dubs\"\n" + source.URL + "/live/video/index.m3u8\n",
+	} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Fatalf("expected playlist to contain %q, got:\n%s", want, rr.Body.String())
+		}
+	}
+
+	session.Options.EnableDubbing = false
+	if rr := get(); strings.Contains(rr.Body.String(), "dub-") {
+		t.Fatalf("expected no dub tracks for sessions that are not dubbed, got:\n%s", rr.Body.String())
+	}
+
+	session.Source.Type = "rtmp"
+	if rr := get(); rr.Code != http.StatusConflict {
+		t.Fatalf("expected sources that are not HLS to conflict, got %d", rr.Code)
+	}
+}
+
+func TestPlaylistHandlerRequiresTrackURLs(t *testing.T) {
+	cfg, err := getPlaylistConfig(func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("getPlaylistConfig failed: %v", err)
+	}
+	handler := playlistHandler(&stubSessionStore{}, cfg, newLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions/session123/playlist.m3u8", nil)
+	req.SetPathValue("id", "session123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without track urls, got %d", rr.Code)
+	}
+	if _, err := getPlaylistConfig(func(string) string { return "ftp://tracks" }); err == nil {
+		t.Fatal("expected an error for track urls that are not http")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"streamlation/packages/backend/ingestion"
+	outputpkg "streamlation/packages/backend/output"
+	pipelinepkg "streamlation/packages/backend/pipeline"
+	sessionpkg "streamlation/packages/backend/session"
+
+	"go.uber.org/zap"
+)
+
+// Preflighter dry-runs the pipeline a session would be processed with.
+type Preflighter interface {
+	Preflight(session TranslationSession) pipelinepkg.PreflightReport
+	// PreflightSource also probes the session's source, authenticating
+	// with auth when it is set.
+	PreflightSource(ctx context.Context, session TranslationSession, auth *sessionpkg.SourceAuth) pipelinepkg.PreflightReport
+}
+
+// pipelinePreflighter checks sessions against a stage registry and pipeline
+// definition that mirror the workers'.
+type pipelinePreflighter struct {
+	registry   *pipelinepkg.Registry
+	definition pipelinepkg.Definition
+}
+
+// newPreflighter builds a preflighter from the pipeline definition document
+// at path, as the workers load it from WORKER_PIPELINE_DEFINITION. Stages the
+// document does not configure, or every stage if path is empty, use the
+// stub implementation.
+func newPreflighter(path string) (*pipelinePreflighter, error) {
+	registry := pipelinepkg.NewRegistry()
+	if err := pipelinepkg.RegisterStubs(registry); err != nil {
+		return nil, err
+	}
+	if err := pipelinepkg.RegisterNative(registry); err != nil {
+		return nil, err
+	}
+	var definition pipelinepkg.Definition
+	if path != "" {
+		loaded, err := pipelinepkg.LoadDefinition(path)
+		if err != nil {
+			return nil, err
+		}
+		definition = loaded
+	}
+	defaults := pipelinepkg.Definition{Stages: make(map[string]pipelinepkg.StageDefinition)}
+	for _, stage := range pipelinepkg.ConfigurableStages {
+		defaults.Stages[stage] = pipelinepkg.StageDefinition{Implementation: pipelinepkg.StubImplementation}
+	}
+	definition = defaults.Override(definition)
+	if err := definition.Validate(registry); err != nil {
+		return nil, fmt.Errorf("validate pipeline definition: %w", err)
+	}
+	return &pipelinePreflighter{registry: registry, definition: definition}, nil
+}
+
+func (p *pipelinePreflighter) Preflight(session TranslationSession) pipelinepkg.PreflightReport {
+	return pipelinepkg.Preflight(p.registry, p.definition, session)
+}
+
+// PreflightSource opens the session's source as the workers would. The
+// session has not been registered, so its credentials are still in auth
+// rather than sealed in the session.
+func (p *pipelinePreflighter) PreflightSource(ctx context.Context, session TranslationSession, auth *sessionpkg.SourceAuth) pipelinepkg.PreflightReport {
+	sources := func(session TranslationSession) (ingestion.StreamSource, error) {
+		var config ingestion.SessionSourceConfig
+		if auth != nil {
+			client, err := ingestion.NewAuthenticatedClient(nil, session.Source.URI, *auth)
+			if err != nil {
+				return nil, err
+			}
+			config.HTTPClient = client
+		}
+		return ingestion.NewSessionSource(session, config)
+	}
+	return pipelinepkg.PreflightSource(ctx, p.registry, p.definition, sources, session)
+}
+
+// preflightSessionHandler validates a session payload, as accepted by
+// POST /sessions, and reports whether its pipeline can be built and is
+// healthy, without creating the session. Its source is only opened, and
+// probed, when the probe query parameter is true.
+func preflightSessionHandler(preflighter Preflighter, logger *zap.SugaredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := r.Body.Close(); err != nil {
+				logger.Errorw("failed to close request body", "error", err)
+			}
+		}()
+
+		var input translationSessionInput
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&input); err != nil {
+			writeError(w, logger, http.StatusBadRequest, fmt.Errorf("invalid payload: %w", err))
+			return
+		}
+
+		session, err := normalizeAndValidateSession(input)
+		if err != nil {
+			writeError(w, logger, http.StatusBadRequest, err)
+			return
+		}
+
+		var report pipelinepkg.PreflightReport
+		if r.URL.Query().Get("probe") == "true" {
+			report = preflighter.PreflightSource(r.Context(), session, input.Source.Auth)
+		} else {
+			report = preflighter.Preflight(session)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logger.Errorw("failed to encode preflight report", "error", err, "sessionID", session.ID)
+		}
+	}
+}
+
+// Generator builds the output implementation the workers would render the
+// session's subtitle files with.
+func (p *pipelinePreflighter) Generator(session TranslationSession) (outputpkg.SubtitleGenerator, error) {
+	return pipelinepkg.SessionGenerator(p.registry, p.definition, session)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pipelinepkg "streamlation/packages/backend/pipeline"
+)
+
+func TestPreflightSessionHandler(t *testing.T) {
+	preflighter, err := newPreflighter("")
+	if err != nil {
+		t.Fatalf("new preflighter: %v", err)
+	}
+	logger := newLogger()
+	defer func() { _ = logger.Sync() }()
+	handler := preflightSessionHandler(preflighter, logger)
+
+	body, err := json.Marshal(map[string]any{
+		"id":             "session123",
+		"source":         map[string]any{"type": "hls", "uri": "https://example.com/stream.m3u8"},
+		"targetLanguage": "es",
+		"options":        map[string]any{"stages": map[string]string{"asr": "whisper"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal payload: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/sessions/preflight", bytes.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var report pipelinepkg.PreflightReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if report.Ready || len(report.Stages) != len(pipelinepkg.ConfigurableStages) {
+		t.Fatalf("expected an unknown asr implementation to fail the preflight, got %+v", report)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/sessions/preflight", bytes.NewBufferString(`{"id": "x"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an invalid session, got %d", rr.Code)
+	}
+}
+
+func TestNewPreflighterValidatesDefinition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipeline.json")
+	if err := os.WriteFile(path, []byte(`{"stages": {"asr": {"implementation": "whisper"}}}`), 0o600); err != nil {
+		t.Fatalf("write definition: %v", err)
+	}
+	if _, err := newPreflighter(path); err == nil {
+		t.Fatal("expected an unregistered implementation to be rejected")
+	}
+}
+
+func TestPreflightSessionHandlerProbesSource(t *testing.T) {
+	preflighter, err := newPreflighter("")
+	if err != nil {
+		t.Fatalf("new preflighter: %v", err)
+	}
+	logger := newLogger()
+	defer func() { _ = logger.Sync() }()
+	handler := preflightSessionHandler(preflighter, logger)
+
+	path := filepath.Join(t.TempDir(), "talk.wav")
+	if err := os.WriteFile(path, []byte("RIFF\x24\x00\x00\x00WAVEfmt "), 0o600); err != nil {
+		t.Fatalf("write media: %v", err)
+	}
+	body, err := json.Marshal(map[string]any{
+		"id":             "session123",
+		"source":         map[string]any{"type": "file", "uri": "file://" + path},
+		"targetLanguage": "es",
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal payload: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/sessions/preflight?probe=true", bytes.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var report pipelinepkg.PreflightReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if !report.Ready || report.Stages[0].Stage != "ingestion" {
+		t.Fatalf("expected a ready report led by the ingestion check, got %+v", report)
+	}
+	if report.Source == nil || report.Source.Container != "wav" || report.Source.Live {
+		t.Fatalf("expected the probed source in the report, got %+v", report.Source)
+	}
+}
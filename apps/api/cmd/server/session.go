@@ -8,9 +8,13 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	pipelinepkg "streamlation/packages/backend/pipeline"
 	postgres "streamlation/packages/backend/postgres"
 	sessionpkg "streamlation/packages/backend/session"
 	statuspkg "streamlation/packages/backend/status"
@@ -21,11 +25,13 @@ import (
 var (
 	sessionIDPattern      = regexp.MustCompile(`^[a-zA-Z0-9_-]{8,64}$`)
 	targetLanguagePattern = regexp.MustCompile(`^[a-z]{2}$`)
+	implementationPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
 
 	allowedSourceTypes = map[string]struct{}{
 		"hls":  {},
 		"dash": {},
 		"rtmp": {},
+		"rtsp": {},
 		"file": {},
 	}
 
@@ -47,21 +53,42 @@ type TranslationOptions = sessionpkg.TranslationOptions
 
 type translationSessionInput struct {
 	ID             string                   `json:"id"`
-	Source         *TranslationSource       `json:"source"`
+	Source         *translationSourceInput  `json:"source"`
 	TargetLanguage string                   `json:"targetLanguage"`
 	Options        *translationOptionsInput `json:"options"`
 }
 
+// translationSourceInput is a source as submitted, with its credentials in
+// the clear. They are sealed before the session is stored.
+type translationSourceInput struct {
+	Type string                 `json:"type"`
+	URI  string                 `json:"uri"`
+	Auth *sessionpkg.SourceAuth `json:"auth"`
+	// BackupURIs are redundant copies of the source to fail over to.
+	BackupURIs []string `json:"backupUris"`
+}
+
 type translationOptionsInput struct {
-	EnableDubbing      *bool   `json:"enableDubbing"`
-	LatencyToleranceMs *int    `json:"latencyToleranceMs"`
-	ModelProfile       *string `json:"modelProfile"`
+	EnableDubbing       *bool                           `json:"enableDubbing"`
+	LatencyToleranceMs  *int                            `json:"latencyToleranceMs"`
+	ModelProfile        *string                         `json:"modelProfile"`
+	Stages              map[string]string               `json:"stages"`
+	AdditionalLanguages []string                        `json:"additionalLanguages"`
+	AudioTrack          *sessionpkg.AudioTrackSelection `json:"audioTrack"`
+	SourceLanguage      string                          `json:"sourceLanguage"`
+	Vocabulary          []string                        `json:"vocabulary"`
+	Glossary            *sessionpkg.Glossary            `json:"glossary"`
+	Formality           string                          `json:"formality"`
+	VoiceID             string                          `json:"voiceId"`
+	VoiceGender         string                          `json:"voiceGender"`
+	VoiceStyle          string                          `json:"voiceStyle"`
 }
 
 // SessionStore persists and retrieves translation sessions.
 type SessionStore interface {
 	Create(ctx context.Context, session TranslationSession) error
 	Get(ctx context.Context, id string) (TranslationSession, error)
+	UpdateOptions(ctx context.Context, id string, options TranslationOptions) error
 	Delete(ctx context.Context, id string) error
 	List(ctx context.Context, limit int) ([]TranslationSession, error)
 }
@@ -74,9 +101,57 @@ var (
 	ErrSessionNotFound = postgres.ErrSessionNotFound
 )
 
-// IngestionEnqueuer enqueues ingestion jobs for downstream processing.
+// IngestionEnqueuer enqueues ingestion jobs for downstream processing. The
+// job carries a snapshot of the session so workers can skip the database.
 type IngestionEnqueuer interface {
-	EnqueueIngestion(ctx context.Context, sessionID string) error
+	EnqueueSession(ctx context.Context, session TranslationSession) error
+}
+
+// ProgressReader loads the aggregated progress projection of sessions.
+type ProgressReader interface {
+	Progress(ctx context.Context, sessionIDs ...string) (map[string]statuspkg.Progress, error)
+}
+
+// sessionView is a session as returned by the read endpoints, decorated with
+// its progress when one has been recorded.
+type sessionView struct {
+	TranslationSession
+	Progress *statuspkg.Progress `json:"progress,omitempty"`
+}
+
+// withProgress pairs each session with its projection. Failing to load
+// progress is logged and the sessions are returned undecorated.
+func withProgress(ctx context.Context, progress ProgressReader, sessions []TranslationSession, logger *zap.SugaredLogger) []sessionView {
+	views := make([]sessionView, len(sessions))
+	for i, session := range sessions {
+		views[i].TranslationSession = redactCredentials(session)
+	}
+	if progress == nil || len(sessions) == 0 {
+		return views
+	}
+
+	ids := make([]string, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+	}
+	projections, err := progress.Progress(ctx, ids...)
+	if err != nil {
+		logger.Errorw("failed to load session progress", "error", err)
+		return views
+	}
+	for i := range views {
+		if projection, ok := projections[views[i].ID]; ok {
+			views[i].Progress = &projection
+		}
+	}
+	return views
+}
+
+// redactCredentials drops the sealed source credentials from a session
+// returned to clients; they are only ever read by workers.
+func redactCredentials(session TranslationSession) TranslationSession {
+	session.Source.Credentials = ""
+	return session
 }
 
 // StatusPublisher emits session status updates to interested subscribers.
@@ -84,7 +159,10 @@ type StatusPublisher interface {
 	Publish(ctx context.Context, event statuspkg.SessionStatusEvent) error
 }
 
-func createSessionHandler(store SessionStore, enqueuer IngestionEnqueuer, publisher StatusPublisher, logger *zap.SugaredLogger) http.HandlerFunc {
+// createSessionHandler registers sessions. Source credentials are sealed
+// with credentialsKey; without a key, sessions with credentials are
+// rejected.
+func createSessionHandler(store SessionStore, enqueuer IngestionEnqueuer, publisher StatusPublisher, credentialsKey []byte, logger *zap.SugaredLogger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.Header().Set("Allow", http.MethodPost)
@@ -111,6 +189,16 @@ func createSessionHandler(store SessionStore, enqueuer IngestionEnqueuer, publis
 			writeError(w, logger, http.StatusBadRequest, err)
 			return
 		}
+		if auth := input.Source.Auth; auth != nil {
+			if credentialsKey == nil {
+				writeError(w, logger, http.StatusBadRequest, errors.New("source.auth is not supported: no credentials key is configured"))
+				return
+			}
+			if session.Source.Credentials, err = sessionpkg.SealSourceAuth(credentialsKey, *auth); err != nil {
+				writeError(w, logger, http.StatusInternalServerError, fmt.Errorf("failed to seal source credentials: %w", err))
+				return
+			}
+		}
 
 		ctx := r.Context()
 
@@ -137,7 +225,7 @@ func createSessionHandler(store SessionStore, enqueuer IngestionEnqueuer, publis
 			}
 		}
 
-		if err := enqueuer.EnqueueIngestion(ctx, session.ID); err != nil {
+		if err := enqueuer.EnqueueSession(ctx, session); err != nil {
 			logger.Errorw("failed to enqueue ingestion job", "error", err, "sessionID", session.ID)
 			if deleteErr := store.Delete(ctx, session.ID); deleteErr != nil {
 				logger.Errorw("failed to roll back session after enqueue error", "error", deleteErr, "sessionID", session.ID)
@@ -149,6 +237,9 @@ func createSessionHandler(store SessionStore, enqueuer IngestionEnqueuer, publis
 					State:     "error",
 					Detail:    "failed to enqueue ingestion job",
 					Timestamp: time.Now().UTC(),
+					Code:      statuspkg.CodeEnqueueFailed,
+					Severity:  statuspkg.SeverityError,
+					Retryable: true,
 				}
 				if err := publisher.Publish(ctx, failureEvent); err != nil {
 					logger.Errorw("failed to publish enqueue failure event", "error", err, "sessionID", session.ID)
@@ -173,13 +264,13 @@ func createSessionHandler(store SessionStore, enqueuer IngestionEnqueuer, publis
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		if err := json.NewEncoder(w).Encode(session); err != nil {
+		if err := json.NewEncoder(w).Encode(redactCredentials(session)); err != nil {
 			logger.Errorw("failed to encode response", "error", err)
 		}
 	}
 }
 
-func getSessionHandler(store SessionStore, logger *zap.SugaredLogger) http.HandlerFunc {
+func getSessionHandler(store SessionStore, progress ProgressReader, logger *zap.SugaredLogger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			w.Header().Set("Allow", http.MethodGet)
@@ -205,14 +296,16 @@ func getSessionHandler(store SessionStore, logger *zap.SugaredLogger) http.Handl
 			return
 		}
 
+		view := withProgress(ctx, progress, []TranslationSession{session}, logger)[0]
+
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(session); err != nil {
+		if err := json.NewEncoder(w).Encode(view); err != nil {
 			logger.Errorw("failed to encode response", "error", err)
 		}
 	}
 }
 
-func listSessionsHandler(store SessionStore, logger *zap.SugaredLogger) http.HandlerFunc {
+func listSessionsHandler(store SessionStore, progress ProgressReader, logger *zap.SugaredLogger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			w.Header().Set("Allow", http.MethodGet)
@@ -236,8 +329,10 @@ func listSessionsHandler(store SessionStore, logger *zap.SugaredLogger) http.Han
 			return
 		}
 
+		views := withProgress(r.Context(), progress, sessions, logger)
+
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(sessions); err != nil {
+		if err := json.NewEncoder(w).Encode(views); err != nil {
 			logger.Errorw("failed to encode response", "error", err)
 		}
 	}
@@ -260,42 +355,319 @@ func normalizeAndValidateSession(input translationSessionInput) (TranslationSess
 		return TranslationSession{}, fmt.Errorf("invalid source.uri: %w", err)
 	}
 
+	if err := validateBackupURIs(input.Source.URI, input.Source.BackupURIs); err != nil {
+		return TranslationSession{}, err
+	}
+
+	if input.Source.Auth != nil {
+		if err := validateSourceAuth(input.Source.Type, *input.Source.Auth); err != nil {
+			return TranslationSession{}, err
+		}
+	}
+
 	if !targetLanguagePattern.MatchString(input.TargetLanguage) {
 		return TranslationSession{}, errors.New("targetLanguage must be a two-letter lowercase code")
 	}
 
-	options := TranslationOptions{
+	options, err := normalizeOptions(input.TargetLanguage, input.Options)
+	if err != nil {
+		return TranslationSession{}, err
+	}
+
+	session := TranslationSession{
+		ID:             input.ID,
+		Source:         TranslationSource{Type: input.Source.Type, URI: input.Source.URI, BackupURIs: input.Source.BackupURIs},
+		TargetLanguage: input.TargetLanguage,
+		Options:        options,
+	}
+
+	return session, nil
+}
+
+// normalizeOptions validates submitted options and fills in the defaults of
+// those left out.
+func normalizeOptions(targetLanguage string, input *translationOptionsInput) (TranslationOptions, error) {
+	return mergeOptions(targetLanguage, TranslationOptions{
 		EnableDubbing:      false,
 		LatencyToleranceMs: 5000,
 		ModelProfile:       "cpu-basic",
+	}, input)
+}
+
+// mergeOptions validates submitted options and applies them over options.
+// Fields the input leaves out keep their values in options.
+func mergeOptions(targetLanguage string, options TranslationOptions, input *translationOptionsInput) (TranslationOptions, error) {
+	if input != nil {
+		if input.EnableDubbing != nil {
+			options.EnableDubbing = *input.EnableDubbing
+		}
+		if input.LatencyToleranceMs != nil {
+			if *input.LatencyToleranceMs < 0 || *input.LatencyToleranceMs > 60000 {
+				return TranslationOptions{}, errors.New("options.latencyToleranceMs must be between 0 and 60000")
+			}
+			options.LatencyToleranceMs = *input.LatencyToleranceMs
+		}
+		if input.ModelProfile != nil {
+			if _, ok := allowedModelProfiles[*input.ModelProfile]; !ok {
+				return TranslationOptions{}, fmt.Errorf("unsupported options.modelProfile: %s", *input.ModelProfile)
+			}
+			options.ModelProfile = *input.ModelProfile
+		}
+		if err := validateStages(input.Stages); err != nil {
+			return TranslationOptions{}, err
+		}
+		if len(input.Stages) > 0 {
+			options.Stages = input.Stages
+		}
+		if err := validateAdditionalLanguages(targetLanguage, input.AdditionalLanguages); err != nil {
+			return TranslationOptions{}, err
+		}
+		if len(input.AdditionalLanguages) > 0 {
+			options.AdditionalLanguages = input.AdditionalLanguages
+		}
+		if input.AudioTrack != nil {
+			if err := validateAudioTrack(*input.AudioTrack); err != nil {
+				return TranslationOptions{}, err
+			}
+			options.AudioTrack = input.AudioTrack
+		}
+		if language := input.SourceLanguage; language != "" {
+			if language != sessionpkg.AutoSourceLanguage && !targetLanguagePattern.MatchString(language) {
+				return TranslationOptions{}, fmt.Errorf("invalid options.sourceLanguage: %q", language)
+			}
+			options.SourceLanguage = language
+		}
+		if input.Vocabulary != nil {
+			vocabulary, err := normalizeVocabulary(input.Vocabulary)
+			if err != nil {
+				return TranslationOptions{}, err
+			}
+			options.Vocabulary = vocabulary
+		}
+		if input.Glossary != nil {
+			options.Glossary = input.Glossary
+		}
+		// A kept glossary is checked against the languages as well, which
+		// the input may have changed.
+		if options.Glossary != nil {
+			glossary, err := normalizeGlossary(append([]string{targetLanguage}, options.AdditionalLanguages...), *options.Glossary)
+			if err != nil {
+				return TranslationOptions{}, err
+			}
+			options.Glossary = glossary
+		}
+		switch formality := input.Formality; formality {
+		case "":
+		case sessionpkg.FormalityDefault:
+			options.Formality = ""
+		case sessionpkg.FormalityFormal, sessionpkg.FormalityInformal:
+			options.Formality = formality
+		default:
+			return TranslationOptions{}, fmt.Errorf("unsupported options.formality: %s", formality)
+		}
+		if err := normalizeVoice(&options, *input); err != nil {
+			return TranslationOptions{}, err
+		}
 	}
+	return options, nil
+}
 
-	if input.Options != nil {
-		if input.Options.EnableDubbing != nil {
-			options.EnableDubbing = *input.Options.EnableDubbing
+// validateBackupURIs checks that backup URIs are well-formed and distinct
+// from each other and from the primary URI.
+func validateBackupURIs(primary string, backups []string) error {
+	if len(backups) > sessionpkg.MaxBackupURIs {
+		return fmt.Errorf("source.backupUris supports at most %d URIs", sessionpkg.MaxBackupURIs)
+	}
+	seen := map[string]bool{primary: true}
+	for _, backup := range backups {
+		if _, err := url.ParseRequestURI(backup); err != nil {
+			return fmt.Errorf("invalid source.backupUris entry: %w", err)
 		}
-		if input.Options.LatencyToleranceMs != nil {
-			if *input.Options.LatencyToleranceMs < 0 || *input.Options.LatencyToleranceMs > 60000 {
-				return TranslationSession{}, errors.New("options.latencyToleranceMs must be between 0 and 60000")
+		if seen[backup] {
+			return fmt.Errorf("duplicate source URI in source.backupUris: %s", backup)
+		}
+		seen[backup] = true
+	}
+	return nil
+}
+
+// validateSourceAuth checks that credentials are given for an HTTP source
+// and can be sent as headers, cookies, and query parameters.
+func validateSourceAuth(sourceType string, auth sessionpkg.SourceAuth) error {
+	if sourceType != "hls" && sourceType != "dash" {
+		return fmt.Errorf("source.auth is not supported for %s sources", sourceType)
+	}
+	for field, values := range map[string]map[string]string{"headers": auth.Headers, "cookies": auth.Cookies, "query": auth.Query} {
+		for name, value := range values {
+			if name == "" || strings.ContainsAny(name, " \t\r\n:;=") || strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("invalid source.auth.%s entry: %q", field, name)
 			}
-			options.LatencyToleranceMs = *input.Options.LatencyToleranceMs
 		}
-		if input.Options.ModelProfile != nil {
-			if _, ok := allowedModelProfiles[*input.Options.ModelProfile]; !ok {
-				return TranslationSession{}, fmt.Errorf("unsupported options.modelProfile: %s", *input.Options.ModelProfile)
+	}
+	if auth.RefreshURL != "" {
+		refreshURL, err := url.ParseRequestURI(auth.RefreshURL)
+		if err != nil || (refreshURL.Scheme != "http" && refreshURL.Scheme != "https") {
+			return fmt.Errorf("invalid source.auth.refreshUrl: %q", auth.RefreshURL)
+		}
+	}
+	return nil
+}
+
+// validateStages checks that stage overrides name configurable stages and
+// well-formed implementation names. Whether an implementation is registered
+// is only known to the worker, which fails the run if it is not.
+func validateStages(stages map[string]string) error {
+	for stage, name := range stages {
+		configurable := false
+		for _, known := range pipelinepkg.ConfigurableStages {
+			if stage == known {
+				configurable = true
+				break
 			}
-			options.ModelProfile = *input.Options.ModelProfile
+		}
+		if !configurable {
+			return fmt.Errorf("unsupported options.stages key: %s", stage)
+		}
+		if !implementationPattern.MatchString(name) {
+			return fmt.Errorf("invalid options.stages.%s: %q", stage, name)
 		}
 	}
+	return nil
+}
 
-	session := TranslationSession{
-		ID:             input.ID,
-		Source:         *input.Source,
-		TargetLanguage: input.TargetLanguage,
-		Options:        options,
+// validateAdditionalLanguages checks that additional target languages are
+// well-formed and distinct from each other and from the primary language.
+func validateAdditionalLanguages(target string, languages []string) error {
+	if len(languages) > sessionpkg.MaxAdditionalLanguages {
+		return fmt.Errorf("options.additionalLanguages supports at most %d languages", sessionpkg.MaxAdditionalLanguages)
+	}
+	seen := map[string]bool{target: true}
+	for _, language := range languages {
+		if !targetLanguagePattern.MatchString(language) {
+			return fmt.Errorf("invalid options.additionalLanguages entry: %q", language)
+		}
+		if seen[language] {
+			return fmt.Errorf("duplicate target language in options.additionalLanguages: %s", language)
+		}
+		seen[language] = true
 	}
+	return nil
+}
 
-	return session, nil
+// normalizeVocabulary trims the terms of a session's vocabulary and drops
+// duplicates, and checks that there are not too many nor too long ones.
+func normalizeVocabulary(terms []string) ([]string, error) {
+	if len(terms) > sessionpkg.MaxVocabularyTerms {
+		return nil, fmt.Errorf("options.vocabulary supports at most %d terms", sessionpkg.MaxVocabularyTerms)
+	}
+	var vocabulary []string
+	seen := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		if term == "" || strings.ContainsAny(term, "\r\n") {
+			return nil, fmt.Errorf("invalid options.vocabulary entry: %q", term)
+		}
+		if utf8.RuneCountInString(term) > sessionpkg.MaxVocabularyTermLength {
+			return nil, fmt.Errorf("options.vocabulary entries must be at most %d characters", sessionpkg.MaxVocabularyTermLength)
+		}
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		vocabulary = append(vocabulary, term)
+	}
+	return vocabulary, nil
+}
+
+// normalizeVoice sets the trimmed voice preferences input gives on options,
+// checking that the voice ID and style are single lines that are not too
+// long and that the gender is known.
+func normalizeVoice(options *TranslationOptions, input translationOptionsInput) error {
+	id, style := strings.TrimSpace(input.VoiceID), strings.TrimSpace(input.VoiceStyle)
+	if strings.ContainsAny(id, " \t\r\n") || utf8.RuneCountInString(id) > sessionpkg.MaxVoiceIDLength {
+		return fmt.Errorf("invalid options.voiceId: %q", id)
+	}
+	if strings.ContainsAny(style, "\r\n") || utf8.RuneCountInString(style) > sessionpkg.MaxVoiceStyleLength {
+		return fmt.Errorf("invalid options.voiceStyle: %q", style)
+	}
+	switch gender := input.VoiceGender; gender {
+	case "":
+	case sessionpkg.VoiceGenderFemale, sessionpkg.VoiceGenderMale, sessionpkg.VoiceGenderNeutral:
+		options.VoiceGender = gender
+	default:
+		return fmt.Errorf("unsupported options.voiceGender: %s", gender)
+	}
+	if id != "" {
+		options.VoiceID = id
+	}
+	if style != "" {
+		options.VoiceStyle = style
+	}
+	return nil
+}
+
+// normalizeGlossary trims the terms of a session's glossary and checks that
+// there are not too many nor too long ones, that no source term is given
+// two translations in one language, and that terms restricted to a
+// language name one of the session's target languages. It returns nil for
+// an empty glossary.
+func normalizeGlossary(languages []string, glossary sessionpkg.Glossary) (*sessionpkg.Glossary, error) {
+	if len(glossary.Terms) > sessionpkg.MaxGlossaryTerms {
+		return nil, fmt.Errorf("options.glossary.terms supports at most %d terms", sessionpkg.MaxGlossaryTerms)
+	}
+	if len(glossary.DoNotTranslate) > sessionpkg.MaxGlossaryTerms {
+		return nil, fmt.Errorf("options.glossary.doNotTranslate supports at most %d terms", sessionpkg.MaxGlossaryTerms)
+	}
+	validTerm := func(term string) bool {
+		return term != "" && !strings.ContainsAny(term, "\r\n") && utf8.RuneCountInString(term) <= sessionpkg.MaxGlossaryTermLength
+	}
+
+	var normalized sessionpkg.Glossary
+	translated := make(map[sessionpkg.GlossaryTerm]bool, len(glossary.Terms))
+	for _, term := range glossary.Terms {
+		term.Source, term.Target = strings.TrimSpace(term.Source), strings.TrimSpace(term.Target)
+		if !validTerm(term.Source) || !validTerm(term.Target) {
+			return nil, fmt.Errorf("invalid options.glossary.terms entry: %q", term.Source)
+		}
+		if term.Language != "" && !slices.Contains(languages, term.Language) {
+			return nil, fmt.Errorf("options.glossary.terms entry %q names language %q, which is not a target language", term.Source, term.Language)
+		}
+		key := sessionpkg.GlossaryTerm{Source: strings.ToLower(term.Source), Language: term.Language}
+		if translated[key] {
+			return nil, fmt.Errorf("duplicate options.glossary.terms entry: %q", term.Source)
+		}
+		translated[key] = true
+		normalized.Terms = append(normalized.Terms, term)
+	}
+	seen := make(map[string]bool, len(glossary.DoNotTranslate))
+	for _, term := range glossary.DoNotTranslate {
+		term = strings.TrimSpace(term)
+		if !validTerm(term) {
+			return nil, fmt.Errorf("invalid options.glossary.doNotTranslate entry: %q", term)
+		}
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		normalized.DoNotTranslate = append(normalized.DoNotTranslate, term)
+	}
+	if len(normalized.Terms) == 0 && len(normalized.DoNotTranslate) == 0 {
+		return nil, nil
+	}
+	return &normalized, nil
+}
+
+// validateAudioTrack checks that an audio track is selected by a
+// well-formed language or a non-negative index. Whether the source carries
+// the track is only known once the worker reads it.
+func validateAudioTrack(track sessionpkg.AudioTrackSelection) error {
+	if track.Language != "" && !targetLanguagePattern.MatchString(track.Language) {
+		return fmt.Errorf("invalid options.audioTrack.language: %q", track.Language)
+	}
+	if track.Index < 0 {
+		return errors.New("options.audioTrack.index must not be negative")
+	}
+	return nil
 }
 
 func writeError(w http.ResponseWriter, logger *zap.SugaredLogger, status int, err error) {
@@ -7,8 +7,12 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
+	sessionpkg "streamlation/packages/backend/session"
 	statuspkg "streamlation/packages/backend/status"
 )
 
@@ -25,8 +29,8 @@ func TestCreateSessionHandler_Success(t *testing.T) {
 		deleteFunc: func(context.Context, string) error { return nil },
 	}
 	var enqueued string
-	enqueuer := &stubEnqueuer{enqueueFunc: func(_ context.Context, sessionID string) error {
-		enqueued = sessionID
+	enqueuer := &stubEnqueuer{enqueueFunc: func(_ context.Context, session TranslationSession) error {
+		enqueued = session.ID
 		return nil
 	}}
 
@@ -53,7 +57,7 @@ func TestCreateSessionHandler_Success(t *testing.T) {
 		return nil
 	}}
 
-	handler := createSessionHandler(store, enqueuer, publisher, logger)
+	handler := createSessionHandler(store, enqueuer, publisher, nil, logger)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusCreated {
@@ -94,7 +98,7 @@ func TestCreateSessionHandler_InvalidPayload(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	publisher := &stubStatusPublisher{}
-	handler := createSessionHandler(store, enqueuer, publisher, logger)
+	handler := createSessionHandler(store, enqueuer, publisher, nil, logger)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusBadRequest {
@@ -127,7 +131,7 @@ func TestCreateSessionHandler_Duplicate(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	publisher := &stubStatusPublisher{}
-	handler := createSessionHandler(store, enqueuer, publisher, logger)
+	handler := createSessionHandler(store, enqueuer, publisher, nil, logger)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusConflict {
@@ -144,7 +148,7 @@ func TestCreateSessionHandler_EnqueueFailureRollsBack(t *testing.T) {
 			return nil
 		},
 	}
-	enqueuer := &stubEnqueuer{enqueueFunc: func(context.Context, string) error {
+	enqueuer := &stubEnqueuer{enqueueFunc: func(context.Context, TranslationSession) error {
 		return errors.New("enqueue failed")
 	}}
 
@@ -170,7 +174,7 @@ func TestCreateSessionHandler_EnqueueFailureRollsBack(t *testing.T) {
 		return nil
 	}}
 
-	handler := createSessionHandler(store, enqueuer, publisher, logger)
+	handler := createSessionHandler(store, enqueuer, publisher, nil, logger)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusInternalServerError {
@@ -199,7 +203,7 @@ func TestGetSessionHandler_NotFound(t *testing.T) {
 	req.SetPathValue("id", "missing")
 	rr := httptest.NewRecorder()
 
-	handler := getSessionHandler(store, logger)
+	handler := getSessionHandler(store, nil, logger)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusNotFound {
@@ -233,7 +237,7 @@ func TestGetSessionHandler_Success(t *testing.T) {
 	req.SetPathValue("id", "existing1")
 	rr := httptest.NewRecorder()
 
-	handler := getSessionHandler(store, logger)
+	handler := getSessionHandler(store, nil, logger)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusOK {
@@ -245,7 +249,7 @@ func TestGetSessionHandler_Success(t *testing.T) {
 		t.Fatalf("failed to decode response: %v", err)
 	}
 
-	if got != expected {
+	if !reflect.DeepEqual(got, expected) {
 		t.Fatalf("unexpected session: %#v", got)
 	}
 }
@@ -267,7 +271,7 @@ func TestListSessionsHandler_Success(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
 	rr := httptest.NewRecorder()
 
-	handler := listSessionsHandler(store, logger)
+	handler := listSessionsHandler(store, nil, logger)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusOK {
@@ -292,7 +296,7 @@ func TestListSessionsHandler_InvalidLimit(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/sessions?limit=abc", nil)
 	rr := httptest.NewRecorder()
 
-	handler := listSessionsHandler(store, logger)
+	handler := listSessionsHandler(store, nil, logger)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusBadRequest {
@@ -300,9 +304,71 @@ func TestListSessionsHandler_InvalidLimit(t *testing.T) {
 	}
 }
 
+func TestGetSessionHandler_IncludesProgress(t *testing.T) {
+	store := &stubSessionStore{
+		getFunc: func(_ context.Context, id string) (TranslationSession, error) {
+			return TranslationSession{ID: id, TargetLanguage: "de"}, nil
+		},
+	}
+	progress := &stubProgressReader{progressFunc: func(_ context.Context, ids ...string) (map[string]statuspkg.Progress, error) {
+		return map[string]statuspkg.Progress{
+			ids[0]: {SessionID: ids[0], CurrentStage: "asr", CurrentState: "running", PercentComplete: 40},
+		}, nil
+	}}
+	logger := newLogger()
+	defer func() { _ = logger.Sync() }()
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions/existing1", nil)
+	req.SetPathValue("id", "existing1")
+	rr := httptest.NewRecorder()
+
+	getSessionHandler(store, progress, logger).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var got sessionView
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if got.ID != "existing1" || got.Progress == nil || got.Progress.PercentComplete != 40 {
+		t.Fatalf("unexpected session view: %#v", got)
+	}
+}
+
+func TestListSessionsHandler_ProgressFailureStillListsSessions(t *testing.T) {
+	store := &stubSessionStore{listFunc: func(context.Context, int) ([]TranslationSession, error) {
+		return []TranslationSession{{ID: "s1"}, {ID: "s2"}}, nil
+	}}
+	progress := &stubProgressReader{progressFunc: func(context.Context, ...string) (map[string]statuspkg.Progress, error) {
+		return nil, errors.New("redis down")
+	}}
+	logger := newLogger()
+	defer func() { _ = logger.Sync() }()
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+	rr := httptest.NewRecorder()
+
+	listSessionsHandler(store, progress, logger).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var views []sessionView
+	if err := json.Unmarshal(rr.Body.Bytes(), &views); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(views) != 2 || views[0].Progress != nil {
+		t.Fatalf("unexpected sessions: %#v", views)
+	}
+}
+
 type stubSessionStore struct {
 	createFunc func(context.Context, TranslationSession) error
 	getFunc    func(context.Context, string) (TranslationSession, error)
+	updateFunc func(context.Context, string, TranslationOptions) error
 	deleteFunc func(context.Context, string) error
 	listFunc   func(context.Context, int) ([]TranslationSession, error)
 }
@@ -321,6 +387,13 @@ func (s *stubSessionStore) Get(ctx context.Context, id string) (TranslationSessi
 	return TranslationSession{}, nil
 }
 
+func (s *stubSessionStore) UpdateOptions(ctx context.Context, id string, options TranslationOptions) error {
+	if s.updateFunc != nil {
+		return s.updateFunc(ctx, id, options)
+	}
+	return nil
+}
+
 func (s *stubSessionStore) Delete(ctx context.Context, id string) error {
 	if s.deleteFunc != nil {
 		return s.deleteFunc(ctx, id)
@@ -336,12 +409,12 @@ func (s *stubSessionStore) List(ctx context.Context, limit int) ([]TranslationSe
 }
 
 type stubEnqueuer struct {
-	enqueueFunc func(context.Context, string) error
+	enqueueFunc func(context.Context, TranslationSession) error
 }
 
-func (e *stubEnqueuer) EnqueueIngestion(ctx context.Context, sessionID string) error {
+func (e *stubEnqueuer) EnqueueSession(ctx context.Context, session TranslationSession) error {
 	if e.enqueueFunc != nil {
-		return e.enqueueFunc(ctx, sessionID)
+		return e.enqueueFunc(ctx, session)
 	}
 	return nil
 }
@@ -356,3 +429,375 @@ func (s *stubStatusPublisher) Publish(ctx context.Context, event statuspkg.Sessi
 	}
 	return nil
 }
+
+type stubProgressReader struct {
+	progressFunc func(context.Context, ...string) (map[string]statuspkg.Progress, error)
+}
+
+func (s *stubProgressReader) Progress(ctx context.Context, sessionIDs ...string) (map[string]statuspkg.Progress, error) {
+	if s.progressFunc != nil {
+		return s.progressFunc(ctx, sessionIDs...)
+	}
+	return nil, nil
+}
+
+func TestNormalizeAndValidateSessionStages(t *testing.T) {
+	base := func(stages map[string]string) translationSessionInput {
+		return translationSessionInput{
+			ID:             "session123",
+			Source:         &translationSourceInput{Type: "hls", URI: "https://example.com/stream.m3u8"},
+			TargetLanguage: "es",
+			Options:        &translationOptionsInput{Stages: stages},
+		}
+	}
+
+	session, err := normalizeAndValidateSession(base(map[string]string{"asr": "whisper", "translation": "stub"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if session.Options.Stages["asr"] != "whisper" || session.Options.Stages["translation"] != "stub" {
+		t.Fatalf("unexpected stages: %v", session.Options.Stages)
+	}
+
+	for _, stages := range []map[string]string{
+		{"ingestion": "hls"},
+		{"asr": ""},
+		{"asr": "Whisper Large"},
+	} {
+		if _, err := normalizeAndValidateSession(base(stages)); err == nil {
+			t.Fatalf("expected %v to be rejected", stages)
+		}
+	}
+}
+
+func TestNormalizeAndValidateSessionAdditionalLanguages(t *testing.T) {
+	base := func(languages ...string) translationSessionInput {
+		return translationSessionInput{
+			ID:             "session123",
+			Source:         &translationSourceInput{Type: "hls", URI: "https://example.com/stream.m3u8"},
+			TargetLanguage: "es",
+			Options:        &translationOptionsInput{AdditionalLanguages: languages},
+		}
+	}
+
+	session, err := normalizeAndValidateSession(base("fr", "de"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := session.TargetLanguages(); !reflect.DeepEqual(got, []string{"es", "fr", "de"}) {
+		t.Fatalf("unexpected target languages: %v", got)
+	}
+
+	for _, languages := range [][]string{
+		{"es"},
+		{"fr", "fr"},
+		{"FR"},
+		{"aa", "bb", "cc", "dd", "ee", "ff", "gg", "hh", "ii"},
+	} {
+		if _, err := normalizeAndValidateSession(base(languages...)); err == nil {
+			t.Fatalf("expected %v to be rejected", languages)
+		}
+	}
+}
+
+func TestNormalizeAndValidateSessionAudioTrack(t *testing.T) {
+	base := func(track sessionpkg.AudioTrackSelection) translationSessionInput {
+		return translationSessionInput{
+			ID:             "session123",
+			Source:         &translationSourceInput{Type: "hls", URI: "https://example.com/stream.m3u8"},
+			TargetLanguage: "es",
+			Options:        &translationOptionsInput{AudioTrack: &track},
+		}
+	}
+
+	session, err := normalizeAndValidateSession(base(sessionpkg.AudioTrackSelection{Language: "en"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if session.Options.AudioTrack == nil || session.Options.AudioTrack.Language != "en" {
+		t.Fatalf("unexpected audio track: %+v", session.Options.AudioTrack)
+	}
+	if _, err := normalizeAndValidateSession(base(sessionpkg.AudioTrackSelection{Index: 2})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, track := range []sessionpkg.AudioTrackSelection{
+		{Language: "eng"},
+		{Language: "EN"},
+		{Index: -1},
+	} {
+		if _, err := normalizeAndValidateSession(base(track)); err == nil {
+			t.Fatalf("expected %+v to be rejected", track)
+		}
+	}
+}
+
+func TestNormalizeAndValidateSessionSourceLanguage(t *testing.T) {
+	base := func(language string) translationSessionInput {
+		return translationSessionInput{
+			ID:             "session123",
+			Source:         &translationSourceInput{Type: "hls", URI: "https://example.com/stream.m3u8"},
+			TargetLanguage: "es",
+			Options:        &translationOptionsInput{SourceLanguage: language},
+		}
+	}
+
+	for _, language := range []string{"en", sessionpkg.AutoSourceLanguage} {
+		session, err := normalizeAndValidateSession(base(language))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if session.Options.SourceLanguage != language {
+			t.Fatalf("expected source language %q, got %q", language, session.Options.SourceLanguage)
+		}
+	}
+	for _, language := range []string{"eng", "EN", "Auto"} {
+		if _, err := normalizeAndValidateSession(base(language)); err == nil {
+			t.Fatalf("expected %q to be rejected", language)
+		}
+	}
+}
+
+func TestNormalizeAndValidateSessionVocabulary(t *testing.T) {
+	base := func(terms []string) translationSessionInput {
+		return translationSessionInput{
+			ID:             "session123",
+			Source:         &translationSourceInput{Type: "hls", URI: "https://example.com/stream.m3u8"},
+			TargetLanguage: "es",
+			Options:        &translationOptionsInput{Vocabulary: terms},
+		}
+	}
+
+	session, err := normalizeAndValidateSession(base([]string{" Streamlation ", "Jobaben", "Streamlation"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"Streamlation", "Jobaben"}; !reflect.DeepEqual(session.Options.Vocabulary, want) {
+		t.Fatalf("expected vocabulary %v, got %v", want, session.Options.Vocabulary)
+	}
+
+	tooMany := make([]string, sessionpkg.MaxVocabularyTerms+1)
+	for i := range tooMany {
+		tooMany[i] = "term" + strconv.Itoa(i)
+	}
+	for _, terms := range [][]string{{""}, {"two\nlines"}, {strings.Repeat("x", sessionpkg.MaxVocabularyTermLength+1)}, tooMany} {
+		if _, err := normalizeAndValidateSession(base(terms)); err == nil {
+			t.Fatalf("expected %q to be rejected", terms)
+		}
+	}
+}
+
+func TestNormalizeAndValidateSessionGlossary(t *testing.T) {
+	base := func(glossary sessionpkg.Glossary) translationSessionInput {
+		return translationSessionInput{
+			ID:             "session123",
+			Source:         &translationSourceInput{Type: "hls", URI: "https://example.com/stream.m3u8"},
+			TargetLanguage: "es",
+			Options:        &translationOptionsInput{AdditionalLanguages: []string{"fr"}, Glossary: &glossary},
+		}
+	}
+
+	session, err := normalizeAndValidateSession(base(sessionpkg.Glossary{
+		Terms:          []sessionpkg.GlossaryTerm{{Source: " live ", Target: "en directo", Language: "es"}, {Source: "live", Target: "en direct", Language: "fr"}},
+		DoNotTranslate: []string{"Streamlation", " Streamlation"},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &sessionpkg.Glossary{
+		Terms:          []sessionpkg.GlossaryTerm{{Source: "live", Target: "en directo", Language: "es"}, {Source: "live", Target: "en direct", Language: "fr"}},
+		DoNotTranslate: []string{"Streamlation"},
+	}
+	if !reflect.DeepEqual(session.Options.Glossary, want) {
+		t.Fatalf("expected glossary %+v, got %+v", want, session.Options.Glossary)
+	}
+
+	session, err = normalizeAndValidateSession(base(sessionpkg.Glossary{}))
+	if err != nil || session.Options.Glossary != nil {
+		t.Fatalf("expected an empty glossary to be dropped, got %+v, %v", session.Options.Glossary, err)
+	}
+
+	tooMany := make([]string, sessionpkg.MaxGlossaryTerms+1)
+	for i := range tooMany {
+		tooMany[i] = "term" + strconv.Itoa(i)
+	}
+	for _, glossary := range []sessionpkg.Glossary{
+		{Terms: []sessionpkg.GlossaryTerm{{Source: "live", Target: ""}}},
+		{Terms: []sessionpkg.GlossaryTerm{{Source: "two\nlines", Target: "x"}}},
+		{Terms: []sessionpkg.GlossaryTerm{{Source: "live", Target: "en vivo", Language: "de"}}},
+		{Terms: []sessionpkg.GlossaryTerm{{Source: "live", Target: "en vivo"}, {Source: "Live", Target: "en directo"}}},
+		{DoNotTranslate: []string{strings.Repeat("x", sessionpkg.MaxGlossaryTermLength+1)}},
+		{DoNotTranslate: tooMany},
+	} {
+		if _, err := normalizeAndValidateSession(base(glossary)); err == nil {
+			t.Fatalf("expected %+v to be rejected", glossary)
+		}
+	}
+}
+
+func TestNormalizeAndValidateSessionFormality(t *testing.T) {
+	base := func(formality string) translationSessionInput {
+		return translationSessionInput{
+			ID:             "session123",
+			Source:         &translationSourceInput{Type: "hls", URI: "https://example.com/stream.m3u8"},
+			TargetLanguage: "de",
+			Options:        &translationOptionsInput{Formality: formality},
+		}
+	}
+
+	for formality, want := range map[string]string{"": "", "default": "", "formal": "formal", "informal": "informal"} {
+		session, err := normalizeAndValidateSession(base(formality))
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", formality, err)
+		}
+		if session.Options.Formality != want {
+			t.Fatalf("%q: expected formality %q, got %q", formality, want, session.Options.Formality)
+		}
+	}
+	if _, err := normalizeAndValidateSession(base("polite")); err == nil || !strings.Contains(err.Error(), "options.formality") {
+		t.Fatalf("expected an unsupported formality to be rejected, got %v", err)
+	}
+}
+
+func TestNormalizeAndValidateSessionVoice(t *testing.T) {
+	base := func(options translationOptionsInput) translationSessionInput {
+		return translationSessionInput{
+			ID:             "session123",
+			Source:         &translationSourceInput{Type: "hls", URI: "https://example.com/stream.m3u8"},
+			TargetLanguage: "es",
+			Options:        &options,
+		}
+	}
+
+	session, err := normalizeAndValidateSession(base(translationOptionsInput{VoiceID: " es-es-2 ", VoiceGender: "female", VoiceStyle: " narration "}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if options := session.Options; options.VoiceID != "es-es-2" || options.VoiceGender != "female" || options.VoiceStyle != "narration" {
+		t.Fatalf("unexpected voice preferences %q %q %q", options.VoiceID, options.VoiceGender, options.VoiceStyle)
+	}
+	for field, options := range map[string]translationOptionsInput{
+		"options.voiceId":     {VoiceID: "two words"},
+		"options.voiceGender": {VoiceGender: "robot"},
+		"options.voiceStyle":  {VoiceStyle: strings.Repeat("a", 65)},
+	} {
+		if _, err := normalizeAndValidateSession(base(options)); err == nil || !strings.Contains(err.Error(), field) {
+			t.Fatalf("expected an invalid %s to be rejected, got %v", field, err)
+		}
+	}
+}
+
+func TestCreateSessionHandler_SealsSourceCredentials(t *testing.T) {
+	var stored TranslationSession
+	store := &stubSessionStore{createFunc: func(_ context.Context, session TranslationSession) error {
+		stored = session
+		return nil
+	}}
+	var enqueued TranslationSession
+	enqueuer := &stubEnqueuer{enqueueFunc: func(_ context.Context, session TranslationSession) error {
+		enqueued = session
+		return nil
+	}}
+	logger := newLogger()
+	defer func() { _ = logger.Sync() }()
+
+	payload := map[string]any{
+		"id": "protected1",
+		"source": map[string]any{
+			"type": "hls",
+			"uri":  "https://cdn.example.com/stream.m3u8",
+			"auth": map[string]any{"headers": map[string]string{"Authorization": "Bearer secret"}},
+		},
+		"targetLanguage": "es",
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("failed to marshal payload: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	createSessionHandler(store, enqueuer, &stubStatusPublisher{}, nil, logger).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/sessions", bytes.NewReader(body)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected credentials without a key to be rejected, got %d", rr.Code)
+	}
+
+	key := bytes.Repeat([]byte{9}, sessionpkg.CredentialsKeySize)
+	rr = httptest.NewRecorder()
+	createSessionHandler(store, enqueuer, &stubStatusPublisher{}, key, logger).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/sessions", bytes.NewReader(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if bytes.Contains(rr.Body.Bytes(), []byte("secret")) || bytes.Contains(rr.Body.Bytes(), []byte(stored.Source.Credentials)) {
+		t.Fatalf("response leaks source credentials: %s", rr.Body.String())
+	}
+	if enqueued.Source.Credentials != stored.Source.Credentials {
+		t.Fatal("expected the enqueued session to carry the sealed credentials")
+	}
+	auth, err := sessionpkg.OpenSourceAuth(key, stored.Source.Credentials)
+	if err != nil {
+		t.Fatalf("open stored credentials: %v", err)
+	}
+	if auth.Headers["Authorization"] != "Bearer secret" {
+		t.Fatalf("unexpected stored credentials %+v", auth)
+	}
+}
+
+func TestNormalizeAndValidateSessionBackupURIs(t *testing.T) {
+	base := func(backups ...string) translationSessionInput {
+		return translationSessionInput{
+			ID:             "session123",
+			Source:         &translationSourceInput{Type: "hls", URI: "https://a.example.com/stream.m3u8", BackupURIs: backups},
+			TargetLanguage: "es",
+		}
+	}
+
+	session, err := normalizeAndValidateSession(base("https://b.example.com/stream.m3u8"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(session.Source.BackupURIs, []string{"https://b.example.com/stream.m3u8"}) {
+		t.Fatalf("unexpected backup URIs: %v", session.Source.BackupURIs)
+	}
+
+	for _, backups := range [][]string{
+		{"not a uri"},
+		{"https://a.example.com/stream.m3u8"},
+		{"https://b.example.com/1", "https://b.example.com/1"},
+		{"https://b.example.com/1", "https://b.example.com/2", "https://b.example.com/3", "https://b.example.com/4", "https://b.example.com/5"},
+	} {
+		if _, err := normalizeAndValidateSession(base(backups...)); err == nil {
+			t.Fatalf("expected %v to be rejected", backups)
+		}
+	}
+}
+
+func TestNormalizeAndValidateSessionSourceAuth(t *testing.T) {
+	base := func(sourceType string, auth sessionpkg.SourceAuth) translationSessionInput {
+		return translationSessionInput{
+			ID:             "session123",
+			Source:         &translationSourceInput{Type: sourceType, URI: "https://example.com/stream", Auth: &auth},
+			TargetLanguage: "es",
+		}
+	}
+
+	valid := sessionpkg.SourceAuth{
+		Headers:    map[string]string{"Authorization": "Bearer token"},
+		Query:      map[string]string{"Key-Pair-Id": "K123"},
+		RefreshURL: "https://auth.example.com/refresh",
+	}
+	if _, err := normalizeAndValidateSession(base("dash", valid)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, input := range map[string]translationSessionInput{
+		"rtmp source":  base("rtmp", valid),
+		"header name":  base("hls", sessionpkg.SourceAuth{Headers: map[string]string{"Bad Header": "x"}}),
+		"header value": base("hls", sessionpkg.SourceAuth{Headers: map[string]string{"X-Token": "a\r\nInjected: b"}}),
+		"refresh URL":  base("hls", sessionpkg.SourceAuth{RefreshURL: "ftp://auth.example.com"}),
+		"cookie name":  base("hls", sessionpkg.SourceAuth{Cookies: map[string]string{"a=b": "c"}}),
+	} {
+		if _, err := normalizeAndValidateSession(input); err == nil {
+			t.Fatalf("expected invalid %s to be rejected", name)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,9 +22,75 @@ import (
 
 const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
 
-// StatusSubscriber subscribes to status events for a translation session.
+// StatusSubscriber subscribes to status events for a translation session,
+// replaying buffered events before live delivery and dropping events that do
+// not match the filter.
 type StatusSubscriber interface {
-	Subscribe(ctx context.Context, sessionID string) (statuspkg.StatusStream, error)
+	SubscribeFrom(ctx context.Context, sessionID string, replay statuspkg.Replay, filter statuspkg.Filter) (statuspkg.StatusStream, error)
+}
+
+// parseStatusReplay reads the replay selection from the query string. By
+// default every buffered event is replayed; "last" narrows that (0 disables
+// replay), while "since" and "sinceSequence" resume after a previously
+// received streamId or sequence number.
+func parseStatusReplay(r *http.Request) (statuspkg.Replay, error) {
+	query := r.URL.Query()
+	replay := statuspkg.Replay{Last: statuspkg.DefaultReplayLength}
+
+	if lastParam := query.Get("last"); lastParam != "" {
+		value, err := strconv.Atoi(lastParam)
+		if err != nil || value < 0 || value > statuspkg.DefaultReplayLength {
+			return statuspkg.Replay{}, fmt.Errorf("last must be between 0 and %d", statuspkg.DefaultReplayLength)
+		}
+		replay.Last = value
+	}
+
+	if since := query.Get("since"); since != "" {
+		if !statuspkg.ValidStreamID(since) {
+			return statuspkg.Replay{}, fmt.Errorf("invalid since stream id")
+		}
+		replay.After = since
+	}
+
+	if sinceSequence := query.Get("sinceSequence"); sinceSequence != "" {
+		value, err := strconv.ParseInt(sinceSequence, 10, 64)
+		if err != nil || value < 0 {
+			return statuspkg.Replay{}, fmt.Errorf("sinceSequence must be a non-negative integer")
+		}
+		replay.AfterSequence = value
+	}
+	return replay, nil
+}
+
+// parseStatusFilter reads the subscription filter from the query string.
+// "stages", "states", and "languages" take comma-separated lists and
+// "minSeverity" one of info, warning, error, or critical. Omitted parameters
+// match everything.
+func parseStatusFilter(r *http.Request) (statuspkg.Filter, error) {
+	query := r.URL.Query()
+	filter := statuspkg.Filter{
+		Stages:    splitQueryList(query.Get("stages")),
+		States:    splitQueryList(query.Get("states")),
+		Languages: splitQueryList(query.Get("languages")),
+	}
+	if minSeverity := query.Get("minSeverity"); minSeverity != "" {
+		severity, err := statuspkg.ParseSeverity(minSeverity)
+		if err != nil {
+			return statuspkg.Filter{}, fmt.Errorf("minSeverity must be info, warning, error, or critical")
+		}
+		filter.MinSeverity = severity
+	}
+	return filter, nil
+}
+
+func splitQueryList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func sessionStatusHandler(subscriber StatusSubscriber, logger *zap.SugaredLogger) http.HandlerFunc {
@@ -40,6 +107,18 @@ func sessionStatusHandler(subscriber StatusSubscriber, logger *zap.SugaredLogger
 			return
 		}
 
+		replay, err := parseStatusReplay(r)
+		if err != nil {
+			writeError(w, logger, http.StatusBadRequest, err)
+			return
+		}
+
+		filter, err := parseStatusFilter(r)
+		if err != nil {
+			writeError(w, logger, http.StatusBadRequest, err)
+			return
+		}
+
 		if !strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") || strings.ToLower(r.Header.Get("Upgrade")) != "websocket" {
 			http.Error(w, "websocket upgrade required", http.StatusBadRequest)
 			return
@@ -84,7 +163,7 @@ func sessionStatusHandler(subscriber StatusSubscriber, logger *zap.SugaredLogger
 		ctx, cancel := context.WithCancel(r.Context())
 		defer cancel()
 
-		stream, err := subscriber.Subscribe(ctx, sessionID)
+		stream, err := subscriber.SubscribeFrom(ctx, sessionID, replay, filter)
 		if err != nil {
 			logger.Errorw("failed to subscribe to status stream", "error", err, "sessionID", sessionID)
 			if frameErr := writeWebSocketCloseFrame(conn, 1011); frameErr != nil {
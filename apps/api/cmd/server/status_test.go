@@ -19,7 +19,7 @@ import (
 )
 
 func TestSessionStatusHandler_WebSocketUpgradeAndEvent(t *testing.T) {
-	subscriber := &stubStatusSubscriber{}
+	subscriber := newStubStatusSubscriber()
 	logger := newLogger()
 	defer func() { _ = logger.Sync() }()
 
@@ -51,8 +51,12 @@ func TestSessionStatusHandler_WebSocketUpgradeAndEvent(t *testing.T) {
 	if !strings.Contains(response, "101 Switching Protocols") {
 		t.Fatalf("expected switching protocols response, got %s", response)
 	}
-	if subscriber.lastSessionID != "session123" {
-		t.Fatalf("expected subscriber to receive session ID, got %s", subscriber.lastSessionID)
+	subscription := subscriber.wait(t)
+	if subscription.sessionID != "session123" {
+		t.Fatalf("expected subscriber to receive session ID, got %s", subscription.sessionID)
+	}
+	if subscription.replay.Last != statuspkg.DefaultReplayLength || subscription.replay.After != "" {
+		t.Fatalf("expected full buffer replay by default, got %#v", subscription.replay)
 	}
 
 	event := statuspkg.SessionStatusEvent{SessionID: "session123", Stage: "ingestion", State: "queued", Timestamp: time.Now().UTC()}
@@ -60,7 +64,7 @@ func TestSessionStatusHandler_WebSocketUpgradeAndEvent(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to marshal event: %v", err)
 	}
-	subscriber.stream.events <- event
+	subscription.stream.events <- event
 
 	framePayload, opcode, err := readWebSocketFrame(reader)
 	if err != nil {
@@ -75,7 +79,7 @@ func TestSessionStatusHandler_WebSocketUpgradeAndEvent(t *testing.T) {
 }
 
 func TestSessionStatusHandler_InvalidUpgrade(t *testing.T) {
-	subscriber := &stubStatusSubscriber{}
+	subscriber := newStubStatusSubscriber()
 	logger := newLogger()
 	defer func() { _ = logger.Sync() }()
 
@@ -91,15 +95,119 @@ func TestSessionStatusHandler_InvalidUpgrade(t *testing.T) {
 	}
 }
 
+func TestParseStatusReplay(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/sessions/session123/events?last=5&since=1700000000000-2", nil)
+	replay, err := parseStatusReplay(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if replay.Last != 5 || replay.After != "1700000000000-2" {
+		t.Fatalf("unexpected replay: %#v", replay)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/sessions/session123/events?sinceSequence=42", nil)
+	replay, err = parseStatusReplay(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if replay.AfterSequence != 42 {
+		t.Fatalf("unexpected replay: %#v", replay)
+	}
+
+	for _, query := range []string{"last=-1", "last=abc", "last=1000", "since=latest", "sinceSequence=-1", "sinceSequence=abc"} {
+		req := httptest.NewRequest(http.MethodGet, "/sessions/session123/events?"+query, nil)
+		if _, err := parseStatusReplay(req); err == nil {
+			t.Errorf("expected error for %q", query)
+		}
+	}
+}
+
+func TestParseStatusFilter(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/sessions/session123/events?stages=asr,+translation&states=completed,failed&minSeverity=warning&languages=es,fr", nil)
+	filter, err := parseStatusFilter(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filter.Stages) != 2 || filter.Stages[1] != "translation" {
+		t.Fatalf("unexpected stages: %#v", filter.Stages)
+	}
+	if len(filter.States) != 2 || filter.States[0] != "completed" {
+		t.Fatalf("unexpected states: %#v", filter.States)
+	}
+	if filter.MinSeverity != statuspkg.SeverityWarning {
+		t.Fatalf("unexpected severity: %q", filter.MinSeverity)
+	}
+	if len(filter.Languages) != 2 || filter.Languages[1] != "fr" {
+		t.Fatalf("unexpected languages: %#v", filter.Languages)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/sessions/session123/events", nil)
+	if filter, err := parseStatusFilter(req); err != nil || len(filter.Stages) != 0 || len(filter.States) != 0 || len(filter.Languages) != 0 || filter.MinSeverity != "" {
+		t.Fatalf("expected empty filter, got %#v (%v)", filter, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/sessions/session123/events?minSeverity=loud", nil)
+	if _, err := parseStatusFilter(req); err == nil {
+		t.Fatal("expected error for unknown severity")
+	}
+}
+
+func TestSessionStatusHandler_InvalidReplay(t *testing.T) {
+	subscriber := newStubStatusSubscriber()
+	logger := newLogger()
+	defer func() { _ = logger.Sync() }()
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions/session123/events?since=latest", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	rr := httptest.NewRecorder()
+
+	req.SetPathValue("id", "session123")
+	sessionStatusHandler(subscriber, logger).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rr.Code)
+	}
+	select {
+	case <-subscriber.subscribed:
+		t.Fatal("expected no subscription for invalid replay")
+	default:
+	}
+}
+
+// stubStatusSubscriber hands each subscription the handler makes to the
+// test over subscribed, as the handler subscribes on its own goroutine.
 type stubStatusSubscriber struct {
-	stream        *stubStatusStream
-	lastSessionID string
+	subscribed chan stubSubscription
+}
+
+type stubSubscription struct {
+	stream    *stubStatusStream
+	sessionID string
+	replay    statuspkg.Replay
+	filter    statuspkg.Filter
 }
 
-func (s *stubStatusSubscriber) Subscribe(_ context.Context, sessionID string) (statuspkg.StatusStream, error) {
-	s.lastSessionID = sessionID
-	s.stream = newStubStatusStream()
-	return s.stream, nil
+func newStubStatusSubscriber() *stubStatusSubscriber {
+	return &stubStatusSubscriber{subscribed: make(chan stubSubscription, 1)}
+}
+
+func (s *stubStatusSubscriber) SubscribeFrom(_ context.Context, sessionID string, replay statuspkg.Replay, filter statuspkg.Filter) (statuspkg.StatusStream, error) {
+	stream := newStubStatusStream()
+	s.subscribed <- stubSubscription{stream: stream, sessionID: sessionID, replay: replay, filter: filter}
+	return stream, nil
+}
+
+// wait returns the next subscription the handler makes.
+func (s *stubStatusSubscriber) wait(t *testing.T) stubSubscription {
+	t.Helper()
+	select {
+	case subscription := <-s.subscribed:
+		return subscription
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a subscription")
+		return stubSubscription{}
+	}
 }
 
 type stubStatusStream struct {
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultStallTimeout       = time.Minute
+	defaultStallCheckInterval = 10 * time.Second
+)
+
+// getStallTimeout returns how long a session may go without a heartbeat
+// before it is reported as stalled, from APP_STALL_TIMEOUT.
+func getStallTimeout(getenv func(string) string) (time.Duration, error) {
+	raw := getenv("APP_STALL_TIMEOUT")
+	if raw == "" {
+		return defaultStallTimeout, nil
+	}
+	timeout, err := time.ParseDuration(raw)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid APP_STALL_TIMEOUT %q", raw)
+	}
+	return timeout, nil
+}
+
+// runWatchdog publishes a pipeline stalled event for each session the
+// watchdog finds silent, checking every interval until ctx is cancelled.
+// The check runs here rather than in the workers, so that a worker that
+// hangs or dies still has its sessions reported.
+func runWatchdog(ctx context.Context, watchdog *statuspkg.Watchdog, publisher StatusPublisher, interval time.Duration, logger *zap.SugaredLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stalls, err := watchdog.Check(ctx)
+		if err != nil {
+			logger.Errorw("failed to check for stalled sessions", "error", err)
+			continue
+		}
+		for _, stall := range stalls {
+			logger.Warnw("pipeline stalled", "sessionID", stall.SessionID, "lastSeen", stall.LastSeen, "silence", stall.Silence.String())
+			if err := publisher.Publish(ctx, statuspkg.SessionStatusEvent{
+				SessionID: stall.SessionID,
+				Stage:     "pipeline",
+				State:     statuspkg.StalledState,
+				Detail:    fmt.Sprintf("no heartbeat for %s", stall.Silence.Round(time.Second)),
+				Timestamp: time.Now().UTC(),
+				Code:      statuspkg.CodePipelineStalled,
+				Severity:  statuspkg.SeverityWarning,
+				Retryable: true,
+			}); err != nil {
+				logger.Errorw("failed to publish stall event", "error", err, "sessionID", stall.SessionID)
+			}
+		}
+	}
+}
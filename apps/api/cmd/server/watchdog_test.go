@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+
+	"go.uber.org/zap"
+)
+
+type stubHeartbeatSource struct {
+	stalls []statuspkg.Stall
+}
+
+func (s *stubHeartbeatSource) SilentSince(context.Context, time.Time) ([]statuspkg.Stall, error) {
+	stalls := s.stalls
+	s.stalls = nil
+	return stalls, nil
+}
+
+func TestGetStallTimeout(t *testing.T) {
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+
+	timeout, err := getStallTimeout(getenv)
+	if err != nil || timeout != defaultStallTimeout {
+		t.Fatalf("expected default timeout, got %v (%v)", timeout, err)
+	}
+
+	env["APP_STALL_TIMEOUT"] = "90s"
+	if timeout, err = getStallTimeout(getenv); err != nil || timeout != 90*time.Second {
+		t.Fatalf("expected 90s, got %v (%v)", timeout, err)
+	}
+
+	for _, raw := range []string{"soon", "-1s"} {
+		env["APP_STALL_TIMEOUT"] = raw
+		if _, err := getStallTimeout(getenv); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestRunWatchdogPublishesStalls(t *testing.T) {
+	source := &stubHeartbeatSource{stalls: []statuspkg.Stall{{
+		SessionID: "session123",
+		LastSeen:  time.Now().Add(-2 * time.Minute),
+	}}}
+	events := make(chan statuspkg.SessionStatusEvent, 1)
+	publisher := &stubStatusPublisher{publishFunc: func(_ context.Context, event statuspkg.SessionStatusEvent) error {
+		events <- event
+		return nil
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runWatchdog(ctx, statuspkg.NewWatchdog(source, time.Minute), publisher, time.Millisecond, zap.NewNop().Sugar())
+
+	select {
+	case event := <-events:
+		if event.SessionID != "session123" || event.Stage != "pipeline" || event.State != statuspkg.StalledState {
+			t.Fatalf("unexpected event %+v", event)
+		}
+		if event.Code != statuspkg.CodePipelineStalled || !event.Retryable {
+			t.Fatalf("expected retryable stall code, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a stall event")
+	}
+}
@@ -15,7 +15,7 @@ const API_BASE = API_BASE_RAW.endsWith("/")
   ? API_BASE_RAW.slice(0, API_BASE_RAW.length - 1)
   : API_BASE_RAW;
 
-const sourceTypes = ["hls", "dash", "rtmp", "file"] as const;
+const sourceTypes = ["hls", "dash", "rtmp", "rtsp", "file"] as const;
 const modelProfiles = ["cpu-basic", "cpu-advanced", "gpu-accelerated"] as const;
 const languageSuggestions = ["en", "es", "fr", "de", "it", "ja", "ko", "pt", "hi"];
 
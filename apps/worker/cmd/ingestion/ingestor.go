@@ -3,14 +3,13 @@ package main
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net"
 	"net/http"
-	"net/url"
 	"time"
 
 	ingestionpkg "streamlation/packages/backend/ingestion"
 	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
 
 	"go.uber.org/zap"
 )
@@ -24,12 +23,16 @@ type streamIngestor struct {
 	sampleWindow      time.Duration
 	fileChunkSize     int
 	fileChunkDuration time.Duration
+	// credentialsKey opens the sealed credentials of protected sources.
+	credentialsKey []byte
+	// resolver resolves HLS sources naming a Twitch or YouTube page.
+	resolver *ingestionpkg.PlatformResolver
 }
 
 func newStreamIngestor(logger *zap.SugaredLogger) *streamIngestor {
 	return &streamIngestor{
 		logger:            logger,
-		httpClient:        &http.Client{Timeout: 10 * time.Second},
+		httpClient:        ingestionpkg.NewHTTPClient(10 * time.Second),
 		dialer:            &net.Dialer{Timeout: 5 * time.Second},
 		bufferSize:        16,
 		sampleWindow:      3 * time.Second,
@@ -44,7 +47,7 @@ func (s *streamIngestor) Ingest(ctx context.Context, session sessionpkg.Translat
 
 	source, err := s.buildSource(session)
 	if err != nil {
-		return err
+		return &statuspkg.StageError{Code: statuspkg.CodeSourceInvalid, Err: err}
 	}
 
 	chunks, errs := source.Stream(streamCtx)
@@ -63,8 +66,11 @@ func (s *streamIngestor) Ingest(ctx context.Context, session sessionpkg.Translat
 				errs = nil
 				continue
 			}
+			if errors.Is(err, statuspkg.ErrSourceEnded) {
+				return nil
+			}
 			if err != nil {
-				return err
+				return &statuspkg.StageError{Code: statuspkg.CodeSourceUnreachable, Retryable: !errors.Is(err, statuspkg.ErrFatal), Err: err}
 			}
 		case chunk, ok := <-chunks:
 			if !ok {
@@ -76,57 +82,14 @@ func (s *streamIngestor) Ingest(ctx context.Context, session sessionpkg.Translat
 }
 
 func (s *streamIngestor) buildSource(session sessionpkg.TranslationSession) (ingestionpkg.StreamSource, error) {
-	switch session.Source.Type {
-	case "hls":
-		return ingestionpkg.NewHLSStreamSource(ingestionpkg.HLSConfig{
-			PlaylistURL:  session.Source.URI,
-			Client:       s.httpClient,
-			BufferSize:   s.bufferSize,
-			PollInterval: 1 * time.Second,
-		})
-	case "rtmp":
-		return ingestionpkg.NewRTMPStreamSource(ingestionpkg.RTMPConfig{
-			URL:            session.Source.URI,
-			Dialer:         s.dialer,
-			BufferSize:     s.bufferSize,
-			ReconnectDelay: 500 * time.Millisecond,
-			ReadTimeout:    3 * time.Second,
-		})
-	case "file":
-		return s.buildFileSource(session)
-	case "dash":
-		return nil, fmt.Errorf("ingestion adapter for %s not yet implemented", session.Source.Type)
-	default:
-		return nil, errors.New("unsupported source type")
-	}
-}
-
-func (s *streamIngestor) buildFileSource(session sessionpkg.TranslationSession) (ingestionpkg.StreamSource, error) {
-	uri, err := url.Parse(session.Source.URI)
-	if err != nil {
-		return nil, fmt.Errorf("invalid file source uri: %w", err)
-	}
-	if uri.Scheme != "file" {
-		return nil, errors.New("file sources must use file:// URIs")
-	}
-
-	path := uri.Path
-	if uri.Host != "" {
-		path = fmt.Sprintf("//%s%s", uri.Host, uri.Path)
-	}
-	if path == "" {
-		return nil, errors.New("file source missing path")
-	}
-
-	return ingestionpkg.NewFileStreamSource(ingestionpkg.FileConfig{
-		Path:          path,
-		ChunkSize:     s.fileChunkSize,
-		ChunkDuration: s.fileChunkDuration,
-		BufferSize:    s.bufferSize,
-		Metadata: map[string]string{
-			"source":  "file",
-			"session": session.ID,
-		},
+	return ingestionpkg.NewSessionSource(session, ingestionpkg.SessionSourceConfig{
+		HTTPClient:        s.httpClient,
+		Dialer:            s.dialer,
+		BufferSize:        s.bufferSize,
+		FileChunkSize:     s.fileChunkSize,
+		FileChunkDuration: s.fileChunkDuration,
+		CredentialsKey:    s.credentialsKey,
+		Resolver:          s.resolver,
 	})
 }
 
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -15,6 +16,7 @@ import (
 	"time"
 
 	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
 )
 
 func TestStreamIngestorIngestsHLS(t *testing.T) {
@@ -146,10 +148,27 @@ func TestStreamIngestorUnsupportedSource(t *testing.T) {
 	ingestor := newStreamIngestor(newTestLogger(t))
 	session := sessionpkg.TranslationSession{
 		ID:     "session-unsupported",
-		Source: sessionpkg.TranslationSource{Type: "dash", URI: "http://example.com"},
+		Source: sessionpkg.TranslationSource{Type: "srt", URI: "http://example.com"},
 	}
 	err := ingestor.Ingest(context.Background(), session)
 	if err == nil {
 		t.Fatal("expected error for unsupported source")
 	}
 }
+
+func TestStreamIngestorClassifiesInvalidSource(t *testing.T) {
+	ingestor := newStreamIngestor(newTestLogger(t))
+	session := sessionpkg.TranslationSession{
+		ID:     "session-bad",
+		Source: sessionpkg.TranslationSource{Type: "file", URI: "https://example.com/video.mp4"},
+	}
+
+	err := ingestor.Ingest(context.Background(), session)
+	var stageErr *statuspkg.StageError
+	if !errors.As(err, &stageErr) {
+		t.Fatalf("expected stage error, got %v", err)
+	}
+	if stageErr.Code != statuspkg.CodeSourceInvalid || stageErr.Retryable {
+		t.Fatalf("unexpected classification: %#v", stageErr)
+	}
+}
@@ -7,12 +7,15 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	ingestionpkg "streamlation/packages/backend/ingestion"
 	postgres "streamlation/packages/backend/postgres"
 	queuepkg "streamlation/packages/backend/queue"
+	sessionpkg "streamlation/packages/backend/session"
 	statuspkg "streamlation/packages/backend/status"
 
 	"go.uber.org/zap"
@@ -61,6 +64,10 @@ func main() {
 		logger.Fatalw("failed to ensure session schema", "error", err)
 	}
 
+	if err := postgres.EnsureStatusEventSchema(ctx, pgClient); err != nil {
+		logger.Fatalw("failed to ensure status event schema", "error", err)
+	}
+
 	sessionStore := postgres.NewSessionStore(pgClient)
 	queue, err := queuepkg.NewRedisIngestionConsumer(redisAddr)
 	if err != nil {
@@ -68,12 +75,49 @@ func main() {
 	}
 	defer func() { _ = queue.Close() }()
 
-	publisher, err := statuspkg.NewRedisStatusPublisher(redisAddr)
+	statusBackend := statuspkg.BackendConfig{
+		Backend:   getEnv("WORKER_STATUS_BACKEND", statuspkg.BackendRedis),
+		RedisAddr: redisAddr,
+		NATSURL:   getEnv("WORKER_NATS_URL", ""),
+	}
+	transportPublisher, err := statuspkg.NewPublisher(statusBackend)
 	if err != nil {
-		logger.Fatalw("failed to create redis status publisher", "error", err)
+		logger.Fatalw("failed to create status publisher", "error", err, "backend", statusBackend.Backend)
 	}
-	defer func() { _ = publisher.Close() }()
+	defer func() { _ = transportPublisher.Close() }()
+
+	spoolSize := getIntEnv("WORKER_STATUS_SPOOL_SIZE", statuspkg.DefaultSpoolCapacity)
+	spool, err := statuspkg.NewSpoolingPublisher(transportPublisher, spoolSize, getEnv("WORKER_INGESTION_STATUS_SPOOL_PATH", ""))
+	if err != nil {
+		logger.Fatalw("failed to open status spool", "error", err)
+	}
+	go spool.Run(ctx, 5*time.Second)
+
+	progressStore, err := statuspkg.NewRedisProgressStore(redisAddr)
+	if err != nil {
+		logger.Fatalw("failed to create redis progress store", "error", err)
+	}
+	defer func() { _ = progressStore.Close() }()
+
+	publisher := statuspkg.NewRecordingPublisher(
+		statuspkg.NewRecordingPublisher(spool, progressStore),
+		postgres.NewStatusEventStore(pgClient),
+	)
 	ingestor := newStreamIngestor(logger)
+	if raw := getEnv("WORKER_SOURCE_CREDENTIALS_KEY", ""); raw != "" {
+		if ingestor.credentialsKey, err = sessionpkg.ParseCredentialsKey(raw); err != nil {
+			logger.Fatalw("failed to read source credentials key", "error", err)
+		}
+	}
+	switch resolver := getEnv("WORKER_PLATFORM_RESOLVER", ""); {
+	case resolver == "":
+	case resolver == "builtin":
+		ingestor.resolver = ingestionpkg.NewPlatformResolver(ingestionpkg.PlatformResolverConfig{Client: ingestor.httpClient})
+	case strings.HasPrefix(resolver, "http://") || strings.HasPrefix(resolver, "https://"):
+		ingestor.resolver = ingestionpkg.NewPlatformResolver(ingestionpkg.PlatformResolverConfig{Client: ingestor.httpClient, HookURL: resolver})
+	default:
+		logger.Fatalw("WORKER_PLATFORM_RESOLVER must be \"builtin\" or a hook URL", "value", resolver)
+	}
 
 	worker := NewIngestionWorker(queue, sessionStore, publisher, ingestor, logger, pollInterval)
 	if err := worker.Run(ctx); err != nil {
@@ -106,6 +150,19 @@ func getDurationEnv(key string, fallback time.Duration) time.Duration {
 	return d
 }
 
+func getIntEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		fmt.Fprintf(os.Stderr, "invalid value for %s: %q\n", key, value)
+		return fallback
+	}
+	return n
+}
+
 func newLogger() *zap.SugaredLogger {
 	level := strings.ToLower(os.Getenv("WORKER_LOG_LEVEL"))
 	cfg := zap.NewProductionConfig()
@@ -121,6 +178,17 @@ func newLogger() *zap.SugaredLogger {
 		cfg.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
 	}
 
+	// WORKER_LOG_FORMAT selects json (default) or console entries, and
+	// WORKER_LOG_FILE a file entries are also written to, rotated at 100 MB.
+	if format := os.Getenv("WORKER_LOG_FORMAT"); format != "" {
+		cfg.Encoding = format
+	}
+	if path := os.Getenv("WORKER_LOG_FILE"); path != "" {
+		cfg.OutputPaths = append(cfg.OutputPaths, path)
+		cfg.ErrorOutputPaths = append(cfg.ErrorOutputPaths, path)
+		cfg.Rotation = &zap.RotationConfig{MaxSize: 100, MaxBackups: 5}
+	}
+
 	logger, err := cfg.Build()
 	if err != nil {
 		panic(fmt.Sprintf("failed to initialize logger: %v", err))
@@ -14,6 +14,8 @@ import (
 
 type queueConsumer interface {
 	Pop(ctx context.Context, timeout time.Duration) (*queuepkg.IngestionJob, error)
+	Ack(ctx context.Context, job *queuepkg.IngestionJob) error
+	DeadLetter(ctx context.Context, job *queuepkg.IngestionJob) error
 }
 
 type sessionGetter interface {
@@ -87,7 +89,7 @@ func (w *IngestionWorker) handleJob(ctx context.Context, job *queuepkg.Ingestion
 	start := time.Now().UTC()
 	w.logger.Infow("processing ingestion job", "sessionID", job.SessionID)
 
-	session, err := w.sessions.Get(ctx, job.SessionID)
+	session, err := w.loadSession(ctx, job)
 	if err != nil {
 		w.publishStatus(ctx, statuspkg.SessionStatusEvent{
 			SessionID: job.SessionID,
@@ -95,8 +97,9 @@ func (w *IngestionWorker) handleJob(ctx context.Context, job *queuepkg.Ingestion
 			State:     "error",
 			Detail:    "failed to load session",
 			Timestamp: time.Now().UTC(),
-		})
+		}.WithError(err, statuspkg.CodeSessionLoadFailed))
 		w.logger.Errorw("failed to load session", "error", err, "sessionID", job.SessionID)
+		w.settle(ctx, job, true)
 		return
 	}
 
@@ -111,6 +114,7 @@ func (w *IngestionWorker) handleJob(ctx context.Context, job *queuepkg.Ingestion
 	if err := w.ingestor.Ingest(ctx, session); err != nil {
 		if errors.Is(err, context.Canceled) {
 			w.logger.Warnw("ingestion canceled", "sessionID", session.ID)
+			w.settle(ctx, job, false)
 			return
 		}
 		w.publishStatus(ctx, statuspkg.SessionStatusEvent{
@@ -119,8 +123,9 @@ func (w *IngestionWorker) handleJob(ctx context.Context, job *queuepkg.Ingestion
 			State:     "error",
 			Detail:    "ingestion pipeline failed",
 			Timestamp: time.Now().UTC(),
-		})
+		}.WithError(err, statuspkg.CodeIngestionFailed))
 		w.logger.Errorw("ingestion failed", "error", err, "sessionID", session.ID)
+		w.settle(ctx, job, true)
 		return
 	}
 
@@ -132,6 +137,31 @@ func (w *IngestionWorker) handleJob(ctx context.Context, job *queuepkg.Ingestion
 		Timestamp: time.Now().UTC(),
 	})
 	w.logger.Infow("ingestion completed", "sessionID", session.ID, "duration", time.Since(start).String())
+	w.settle(ctx, job, false)
+}
+
+// settle removes job from the processing queue, dead-lettering it when it
+// failed. Jobs interrupted by shutdown stay in processing for recovery.
+func (w *IngestionWorker) settle(ctx context.Context, job *queuepkg.IngestionJob, failed bool) {
+	if w.queue == nil || ctx.Err() != nil {
+		return
+	}
+	settle := w.queue.Ack
+	if failed {
+		settle = w.queue.DeadLetter
+	}
+	if err := settle(ctx, job); err != nil {
+		w.logger.Errorw("failed to settle ingestion job", "error", err, "sessionID", job.SessionID)
+	}
+}
+
+// loadSession uses the session snapshot carried by the job when it is
+// current, falling back to the session store otherwise.
+func (w *IngestionWorker) loadSession(ctx context.Context, job *queuepkg.IngestionJob) (sessionpkg.TranslationSession, error) {
+	if session, ok := job.Snapshot(); ok {
+		return session, nil
+	}
+	return w.sessions.Get(ctx, job.SessionID)
 }
 
 func (w *IngestionWorker) publishStatus(ctx context.Context, event statuspkg.SessionStatusEvent) {
@@ -106,7 +106,9 @@ func TestHandleJobWhenIngestFails(t *testing.T) {
 func TestHandleJobWhenSessionMissing(t *testing.T) {
 	publisher := &capturingPublisher{}
 	store := &stubSessionStore{err: errors.New("not found")}
+	queue := &stubQueue{}
 	worker := &IngestionWorker{
+		queue:     queue,
 		sessions:  store,
 		publisher: publisher,
 		ingestor:  &stubIngestor{},
@@ -114,6 +116,9 @@ func TestHandleJobWhenSessionMissing(t *testing.T) {
 	}
 
 	worker.handleJob(context.Background(), &queuepkg.IngestionJob{SessionID: "missing"})
+	if len(queue.deadLettered) != 1 || len(queue.acked) != 0 {
+		t.Fatalf("expected the job to be dead-lettered, got acked %v and dead-lettered %v", queue.acked, queue.deadLettered)
+	}
 
 	events := publisher.Events()
 	if len(events) != 1 {
@@ -155,6 +160,8 @@ func TestRunStopsOnContextCancel(t *testing.T) {
 type stubQueue struct {
 	jobs []*queuepkg.IngestionJob
 	err  error
+
+	acked, deadLettered []string
 }
 
 func (s *stubQueue) Pop(ctx context.Context, timeout time.Duration) (*queuepkg.IngestionJob, error) {
@@ -174,6 +181,16 @@ func (s *stubQueue) Pop(ctx context.Context, timeout time.Duration) (*queuepkg.I
 	return job, nil
 }
 
+func (s *stubQueue) Ack(_ context.Context, job *queuepkg.IngestionJob) error {
+	s.acked = append(s.acked, job.SessionID)
+	return nil
+}
+
+func (s *stubQueue) DeadLetter(_ context.Context, job *queuepkg.IngestionJob) error {
+	s.deadLettered = append(s.deadLettered, job.SessionID)
+	return nil
+}
+
 func newTestLogger(t *testing.T) *zap.SugaredLogger {
 	t.Helper()
 	cfg := zap.NewProductionConfig()
@@ -0,0 +1,278 @@
+// Package main provides an operator CLI for inspecting and repairing the
+// Redis job queues.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	queuepkg "streamlation/packages/backend/queue"
+)
+
+const defaultRedisAddr = "127.0.0.1:6379"
+
+// queueAliases maps short operator-friendly names onto Redis list keys.
+var queueAliases = map[string]string{
+	"main":        queuepkg.IngestionQueueName,
+	"processing":  queuepkg.IngestionProcessingQueueName,
+	"dead-letter": queuepkg.IngestionDeadLetterQueueName,
+	"dlq":         queuepkg.IngestionDeadLetterQueueName,
+}
+
+type queueAdmin interface {
+	Count(ctx context.Context, queueName string) (int, error)
+	Peek(ctx context.Context, queueName string, limit int) ([]string, error)
+	Purge(ctx context.Context, queueName string) (int, error)
+	Move(ctx context.Context, from, to string, limit int) (int, error)
+	Close() error
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	newAdmin := func(addr string) (queueAdmin, error) {
+		return queuepkg.NewRedisQueueAdmin(addr)
+	}
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr, newAdmin))
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, newAdmin func(addr string) (queueAdmin, error)) int {
+	global := flag.NewFlagSet("queueadmin", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	redisAddr := global.String("redis", getRedisAddr(), "Redis address or redis:// URL")
+	dryRun := global.Bool("dry-run", false, "report what purge or move would do without changing anything")
+	global.Usage = func() { printUsage(stderr) }
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+
+	rest := global.Args()
+	if len(rest) == 0 {
+		printUsage(stderr)
+		return 2
+	}
+
+	admin, err := newAdmin(*redisAddr)
+	if err != nil {
+		fmt.Fprintf(stderr, "connect redis: %v\n", err)
+		return 1
+	}
+	defer func() { _ = admin.Close() }()
+
+	cmd := &command{ctx: ctx, admin: admin, stdout: stdout, stderr: stderr, dryRun: *dryRun}
+	switch rest[0] {
+	case "count":
+		err = cmd.count(rest[1:])
+	case "peek":
+		err = cmd.peek(rest[1:])
+	case "purge":
+		err = cmd.purge(rest[1:])
+	case "move":
+		err = cmd.move(rest[1:])
+	case "help":
+		printUsage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n", rest[0])
+		printUsage(stderr)
+		return 2
+	}
+	if err != nil {
+		var usage usageError
+		if errors.As(err, &usage) {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		fmt.Fprintf(stderr, "%s: %v\n", rest[0], err)
+		return 1
+	}
+	return 0
+}
+
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+type command struct {
+	ctx    context.Context
+	admin  queueAdmin
+	stdout io.Writer
+	stderr io.Writer
+	dryRun bool
+}
+
+func (c *command) count(args []string) error {
+	fs := c.flags("count")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() == 0 {
+		return usageError("count requires at least one queue")
+	}
+	for _, name := range fs.Args() {
+		queueName, err := resolveQueue(name)
+		if err != nil {
+			return err
+		}
+		n, err := c.admin.Count(c.ctx, queueName)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.stdout, "%s\t%d\n", queueName, n)
+	}
+	return nil
+}
+
+func (c *command) peek(args []string) error {
+	fs := c.flags("peek")
+	limit := fs.Int("n", 10, "number of jobs to show, oldest first")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() != 1 {
+		return usageError("peek requires exactly one queue")
+	}
+	queueName, err := resolveQueue(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	payloads, err := c.admin.Peek(c.ctx, queueName, *limit)
+	if err != nil {
+		return err
+	}
+	for _, payload := range payloads {
+		fmt.Fprintln(c.stdout, payload)
+	}
+	return nil
+}
+
+func (c *command) purge(args []string) error {
+	fs := c.flags("purge")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() != 1 {
+		return usageError("purge requires exactly one queue")
+	}
+	queueName, err := resolveQueue(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if c.dryRun {
+		n, err := c.admin.Count(c.ctx, queueName)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.stdout, "dry run: would purge %d jobs from %s\n", n, queueName)
+		return nil
+	}
+	n, err := c.admin.Purge(c.ctx, queueName)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "purged %d jobs from %s\n", n, queueName)
+	return nil
+}
+
+func (c *command) move(args []string) error {
+	fs := c.flags("move")
+	limit := fs.Int("n", 0, "maximum number of jobs to move, oldest first (0 moves all)")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() != 2 {
+		return usageError("move requires a source and a destination queue")
+	}
+	from, err := resolveQueue(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	to, err := resolveQueue(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return usageError("source and destination queues must differ")
+	}
+	if c.dryRun {
+		n, err := c.admin.Count(c.ctx, from)
+		if err != nil {
+			return err
+		}
+		if *limit > 0 && *limit < n {
+			n = *limit
+		}
+		fmt.Fprintf(c.stdout, "dry run: would move %d jobs from %s to %s\n", n, from, to)
+		if n == 0 {
+			return nil
+		}
+		payloads, err := c.admin.Peek(c.ctx, from, n)
+		if err != nil {
+			return err
+		}
+		for _, payload := range payloads {
+			fmt.Fprintln(c.stdout, payload)
+		}
+		return nil
+	}
+	n, err := c.admin.Move(c.ctx, from, to, *limit)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "moved %d jobs from %s to %s\n", n, from, to)
+	return nil
+}
+
+func (c *command) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+// resolveQueue accepts either an alias or a fully qualified queue key.
+func resolveQueue(name string) (string, error) {
+	if queueName, ok := queueAliases[name]; ok {
+		return queueName, nil
+	}
+	if strings.HasPrefix(name, "streamlation:") {
+		return name, nil
+	}
+	return "", usageError(fmt.Sprintf("unknown queue %q", name))
+}
+
+func getRedisAddr() string {
+	if addr := os.Getenv("WORKER_REDIS_ADDR"); addr != "" {
+		return addr
+	}
+	return defaultRedisAddr
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: queueadmin [-redis addr] [-dry-run] <command> [args]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "commands:")
+	fmt.Fprintln(w, "  count <queue>...            show queue lengths")
+	fmt.Fprintln(w, "  peek [-n N] <queue>         print the oldest N payloads")
+	fmt.Fprintln(w, "  purge <queue>               delete every job in a queue")
+	fmt.Fprintln(w, "  move [-n N] <from> <to>     move the oldest N jobs (default all)")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "queues:")
+	aliases := make([]string, 0, len(queueAliases))
+	for alias := range queueAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		fmt.Fprintf(w, "  %-12s %s\n", alias, queueAliases[alias])
+	}
+	fmt.Fprintln(w, "  or any full key starting with streamlation:")
+}
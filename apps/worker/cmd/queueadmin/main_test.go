@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	queuepkg "streamlation/packages/backend/queue"
+)
+
+func TestRunCount(t *testing.T) {
+	admin := newStubAdmin()
+	admin.lists[queuepkg.IngestionQueueName] = []string{"a", "b"}
+
+	stdout, stderr, code := runWith(t, admin, "count", "main", "dlq")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+	want := queuepkg.IngestionQueueName + "\t2\n" + queuepkg.IngestionDeadLetterQueueName + "\t0\n"
+	if stdout != want {
+		t.Fatalf("unexpected output %q", stdout)
+	}
+}
+
+func TestRunPurgeDryRunLeavesQueue(t *testing.T) {
+	admin := newStubAdmin()
+	admin.lists[queuepkg.IngestionDeadLetterQueueName] = []string{"a", "b", "c"}
+
+	stdout, stderr, code := runWith(t, admin, "-dry-run", "purge", "dead-letter")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "would purge 3 jobs") {
+		t.Fatalf("unexpected output %q", stdout)
+	}
+	if admin.purged != 0 || len(admin.lists[queuepkg.IngestionDeadLetterQueueName]) != 3 {
+		t.Fatal("dry run must not purge")
+	}
+}
+
+func TestRunMove(t *testing.T) {
+	admin := newStubAdmin()
+	admin.lists[queuepkg.IngestionDeadLetterQueueName] = []string{"a", "b", "c"}
+
+	stdout, _, code := runWith(t, admin, "-dry-run", "move", "-n", "2", "dlq", "main")
+	if code != 0 {
+		t.Fatalf("dry run exit code %d", code)
+	}
+	if !strings.Contains(stdout, "would move 2 jobs") || !strings.Contains(stdout, "a\nb\n") {
+		t.Fatalf("unexpected dry run output %q", stdout)
+	}
+	if admin.moves != 0 {
+		t.Fatal("dry run must not move jobs")
+	}
+
+	stdout, _, code = runWith(t, admin, "move", "-n", "2", "dlq", "main")
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	if !strings.Contains(stdout, "moved 2 jobs") {
+		t.Fatalf("unexpected output %q", stdout)
+	}
+}
+
+func TestRunRejectsBadInput(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"explode"},
+		{"count", "nowhere"},
+		{"move", "main"},
+		{"move", "main", "main"},
+		{"peek"},
+	} {
+		if _, _, code := runWith(t, newStubAdmin(), args...); code != 2 {
+			t.Fatalf("args %v: expected usage exit code 2, got %d", args, code)
+		}
+	}
+}
+
+func TestResolveQueueAcceptsFullKeys(t *testing.T) {
+	got, err := resolveQueue("streamlation:custom")
+	if err != nil || got != "streamlation:custom" {
+		t.Fatalf("resolveQueue = %q, %v", got, err)
+	}
+}
+
+func runWith(t *testing.T, admin *stubAdmin, args ...string) (string, string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr, func(string) (queueAdmin, error) {
+		return admin, nil
+	})
+	return stdout.String(), stderr.String(), code
+}
+
+type stubAdmin struct {
+	lists  map[string][]string
+	purged int
+	moves  int
+}
+
+func newStubAdmin() *stubAdmin {
+	return &stubAdmin{lists: make(map[string][]string)}
+}
+
+func (s *stubAdmin) Count(_ context.Context, queueName string) (int, error) {
+	return len(s.lists[queueName]), nil
+}
+
+func (s *stubAdmin) Peek(_ context.Context, queueName string, limit int) ([]string, error) {
+	items := s.lists[queueName]
+	if limit < len(items) {
+		items = items[:limit]
+	}
+	return append([]string(nil), items...), nil
+}
+
+func (s *stubAdmin) Purge(_ context.Context, queueName string) (int, error) {
+	n := len(s.lists[queueName])
+	delete(s.lists, queueName)
+	s.purged += n
+	return n, nil
+}
+
+func (s *stubAdmin) Move(_ context.Context, from, to string, limit int) (int, error) {
+	items := s.lists[from]
+	if limit <= 0 || limit > len(items) {
+		limit = len(items)
+	}
+	s.lists[to] = append(s.lists[to], items[:limit]...)
+	s.lists[from] = items[limit:]
+	s.moves += limit
+	return limit, nil
+}
+
+func (s *stubAdmin) Close() error { return nil }
@@ -0,0 +1,217 @@
+// Package main provides a CLI that tails status events for one session or
+// for every session, for debugging pipelines from a terminal.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+const defaultRedisAddr = "127.0.0.1:6379"
+
+const (
+	colorReset  = "\033[0m"
+	colorDim    = "\033[2m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+)
+
+type statusSubscriber interface {
+	SubscribeFrom(ctx context.Context, sessionID string, replay statuspkg.Replay, filter statuspkg.Filter) (statuspkg.StatusStream, error)
+	SubscribeAll(ctx context.Context, filter statuspkg.Filter) (statuspkg.StatusStream, error)
+	Close() error
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	newSubscriber := func(cfg statuspkg.BackendConfig) (statusSubscriber, error) {
+		return statuspkg.NewSubscriber(cfg)
+	}
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr, newSubscriber))
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, newSubscriber func(statuspkg.BackendConfig) (statusSubscriber, error)) int {
+	fs := flag.NewFlagSet("statustail", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	redisAddr := fs.String("redis", getEnv("WORKER_REDIS_ADDR", defaultRedisAddr), "Redis address or redis:// URL")
+	backend := fs.String("backend", getEnv("WORKER_STATUS_BACKEND", statuspkg.BackendRedis), "status backend: redis or nats")
+	natsURL := fs.String("nats", os.Getenv("WORKER_NATS_URL"), "NATS server URL")
+	last := fs.Int("last", 0, "replay up to this many buffered events before tailing (single session only)")
+	stages := fs.String("stages", "", "comma-separated stages to show")
+	states := fs.String("states", "", "comma-separated states to show")
+	languages := fs.String("languages", "", "comma-separated target languages to show")
+	minSeverity := fs.String("min-severity", "", "only show events at or above this severity")
+	raw := fs.Bool("json", false, "print events as raw JSON lines")
+	noColor := fs.Bool("no-color", os.Getenv("NO_COLOR") != "", "disable colored output")
+	fs.Usage = func() { printUsage(stderr, fs) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		printUsage(stderr, fs)
+		return 2
+	}
+	sessionID := fs.Arg(0)
+	if sessionID == "" && *last > 0 {
+		fmt.Fprintln(stderr, "-last requires a session id")
+		return 2
+	}
+
+	filter := statuspkg.Filter{Stages: splitList(*stages), States: splitList(*states), Languages: splitList(*languages)}
+	if *minSeverity != "" {
+		severity, err := statuspkg.ParseSeverity(*minSeverity)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		filter.MinSeverity = severity
+	}
+
+	subscriber, err := newSubscriber(statuspkg.BackendConfig{Backend: *backend, RedisAddr: *redisAddr, NATSURL: *natsURL})
+	if err != nil {
+		fmt.Fprintf(stderr, "connect status backend: %v\n", err)
+		return 1
+	}
+	defer func() { _ = subscriber.Close() }()
+
+	var stream statuspkg.StatusStream
+	if sessionID == "" {
+		stream, err = subscriber.SubscribeAll(ctx, filter)
+	} else {
+		stream, err = subscriber.SubscribeFrom(ctx, sessionID, statuspkg.Replay{Last: *last}, filter)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "subscribe: %v\n", err)
+		return 1
+	}
+	defer func() { _ = stream.Close() }()
+
+	printer := &printer{out: stdout, color: !*noColor, raw: *raw, showSession: sessionID == ""}
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case event, ok := <-stream.Events():
+			if !ok {
+				return 0
+			}
+			printer.print(event)
+		case err, ok := <-stream.Errors():
+			if !ok {
+				return 0
+			}
+			if err != nil {
+				fmt.Fprintf(stderr, "stream error: %v\n", err)
+			}
+		}
+	}
+}
+
+// printer renders one event per line.
+type printer struct {
+	out         io.Writer
+	color       bool
+	raw         bool
+	showSession bool
+}
+
+func (p *printer) print(event statuspkg.SessionStatusEvent) {
+	if p.raw {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(p.out, string(payload))
+		return
+	}
+
+	timestamp := event.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	var b strings.Builder
+	b.WriteString(p.paint(colorDim, timestamp.Local().Format("15:04:05.000")))
+	if p.showSession {
+		b.WriteString(" " + p.paint(colorCyan, event.SessionID))
+	}
+	b.WriteString(" " + p.paint(eventColor(event), event.Stage+"/"+event.State))
+	if event.Sequence > 0 {
+		b.WriteString(p.paint(colorDim, fmt.Sprintf(" #%d", event.Sequence)))
+	}
+	if event.Code != "" {
+		b.WriteString(" [" + string(event.Code) + "]")
+	}
+	if event.Detail != "" {
+		b.WriteString(" " + event.Detail)
+	}
+	if t := event.Throughput; t != nil {
+		b.WriteString(p.paint(colorDim, fmt.Sprintf(" chunks=%d transcripts=%d subtitles=%d latency=%dms",
+			t.ChunksProcessed, t.TranscriptsProduced, t.SubtitlesEmitted, t.LatencyMs)))
+	}
+	fmt.Fprintln(p.out, b.String())
+}
+
+func (p *printer) paint(color, text string) string {
+	if !p.color || text == "" {
+		return text
+	}
+	return color + text + colorReset
+}
+
+func eventColor(event statuspkg.SessionStatusEvent) string {
+	switch {
+	case event.Severity == statuspkg.SeverityError || event.Severity == statuspkg.SeverityCritical ||
+		event.State == "error" || event.State == "failed":
+		return colorRed
+	case event.Severity == statuspkg.SeverityWarning:
+		return colorYellow
+	case event.State == statuspkg.HeartbeatState:
+		return colorDim
+	case event.State == "completed":
+		return colorGreen
+	}
+	return ""
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func printUsage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, `usage: statustail [flags] [session-id]
+
+Tails status events for one session, or for every session when no id is
+given.
+
+flags:`)
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
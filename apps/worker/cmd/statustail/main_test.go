@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestRunTailsSession(t *testing.T) {
+	subscriber := &stubSubscriber{events: []statuspkg.SessionStatusEvent{
+		{SessionID: "abc", Stage: "asr", State: "running", Sequence: 3, Timestamp: time.Now()},
+		{SessionID: "abc", Stage: "asr", State: "failed", Detail: "model crashed", Code: statuspkg.CodeASRFailed, Severity: statuspkg.SeverityError},
+	}}
+
+	stdout, stderr, code := runWith(t, subscriber, "-no-color", "-last", "5", "-states", "running,failed", "abc")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+	if subscriber.sessionID != "abc" || subscriber.replay.Last != 5 || len(subscriber.filter.States) != 2 {
+		t.Fatalf("unexpected subscription: %q %#v %#v", subscriber.sessionID, subscriber.replay, subscriber.filter)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", stdout)
+	}
+	if !strings.Contains(lines[0], "asr/running #3") || strings.Contains(lines[0], "abc") {
+		t.Fatalf("unexpected first line %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "asr/failed [ASR_RECOGNITION_FAILED] model crashed") {
+		t.Fatalf("unexpected second line %q", lines[1])
+	}
+	if strings.Contains(stdout, "\033[") {
+		t.Fatalf("expected no color codes, got %q", stdout)
+	}
+}
+
+func TestRunTailsFirehoseWithColor(t *testing.T) {
+	subscriber := &stubSubscriber{events: []statuspkg.SessionStatusEvent{
+		{SessionID: "abc", Stage: "output", State: "completed"},
+	}}
+
+	stdout, stderr, code := runWith(t, subscriber, "-min-severity", "info")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+	if !subscriber.all || subscriber.filter.MinSeverity != statuspkg.SeverityInfo {
+		t.Fatalf("expected firehose subscription, got %#v", subscriber)
+	}
+	if !strings.Contains(stdout, colorCyan+"abc"+colorReset) || !strings.Contains(stdout, colorGreen+"output/completed"+colorReset) {
+		t.Fatalf("unexpected output %q", stdout)
+	}
+}
+
+func TestRunRejectsInvalidArguments(t *testing.T) {
+	for _, args := range [][]string{
+		{"-last", "5"},
+		{"-min-severity", "loud", "abc"},
+		{"abc", "def"},
+	} {
+		if _, _, code := runWith(t, &stubSubscriber{}, args...); code != 2 {
+			t.Errorf("expected usage error for %v, got %d", args, code)
+		}
+	}
+}
+
+func TestRunPrintsRawJSON(t *testing.T) {
+	subscriber := &stubSubscriber{events: []statuspkg.SessionStatusEvent{
+		{SessionID: "abc", Stage: "asr", State: "running"},
+	}}
+
+	stdout, _, code := runWith(t, subscriber, "-json", "abc")
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	if !strings.HasPrefix(stdout, `{"sessionId":"abc","stage":"asr","state":"running"`) {
+		t.Fatalf("unexpected output %q", stdout)
+	}
+}
+
+func runWith(t *testing.T, subscriber *stubSubscriber, args ...string) (string, string, int) {
+	t.Helper()
+	t.Setenv("NO_COLOR", "")
+	var stdout, stderr bytes.Buffer
+	newSubscriber := func(statuspkg.BackendConfig) (statusSubscriber, error) { return subscriber, nil }
+	code := run(context.Background(), args, &stdout, &stderr, newSubscriber)
+	return stdout.String(), stderr.String(), code
+}
+
+type stubSubscriber struct {
+	events    []statuspkg.SessionStatusEvent
+	sessionID string
+	replay    statuspkg.Replay
+	filter    statuspkg.Filter
+	all       bool
+}
+
+func (s *stubSubscriber) SubscribeFrom(_ context.Context, sessionID string, replay statuspkg.Replay, filter statuspkg.Filter) (statuspkg.StatusStream, error) {
+	s.sessionID = sessionID
+	s.replay = replay
+	s.filter = filter
+	return newStubStream(s.events), nil
+}
+
+func (s *stubSubscriber) SubscribeAll(_ context.Context, filter statuspkg.Filter) (statuspkg.StatusStream, error) {
+	s.all = true
+	s.filter = filter
+	return newStubStream(s.events), nil
+}
+
+func (s *stubSubscriber) Close() error { return nil }
+
+type stubStream struct {
+	events chan statuspkg.SessionStatusEvent
+	errors chan error
+}
+
+// newStubStream returns a stream that delivers events and then ends.
+func newStubStream(events []statuspkg.SessionStatusEvent) *stubStream {
+	s := &stubStream{
+		events: make(chan statuspkg.SessionStatusEvent, len(events)),
+		errors: make(chan error),
+	}
+	for _, event := range events {
+		s.events <- event
+	}
+	close(s.events)
+	return s
+}
+
+func (s *stubStream) Events() <-chan statuspkg.SessionStatusEvent { return s.events }
+func (s *stubStream) Errors() <-chan error                        { return s.errors }
+func (s *stubStream) Close() error                                { return nil }
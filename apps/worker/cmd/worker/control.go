@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+
+	pipelinepkg "streamlation/packages/backend/pipeline"
+	queuepkg "streamlation/packages/backend/queue"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+type controlSubscriber interface {
+	SubscribeControl(ctx context.Context) (queuepkg.ControlStream, error)
+}
+
+// startControlLoop subscribes to the control channel and applies messages
+// until ctx is cancelled. drain is invoked when a DrainWorker message
+// targets this worker.
+func (p *ingestionProcessor) startControlLoop(ctx context.Context, drain context.CancelFunc) {
+	if p.controls == nil {
+		return
+	}
+
+	stream, err := p.controls.SubscribeControl(ctx)
+	if err != nil {
+		p.logger.Errorw("failed to subscribe to control channel", "error", err)
+		return
+	}
+
+	go func() {
+		defer func() { _ = stream.Close() }()
+		for {
+			select {
+			case msg, ok := <-stream.Messages():
+				if !ok {
+					return
+				}
+				p.handleControl(ctx, msg, drain)
+			case err, ok := <-stream.Errors():
+				if !ok {
+					return
+				}
+				if err != nil {
+					p.logger.Errorw("control stream error", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (p *ingestionProcessor) handleControl(ctx context.Context, msg queuepkg.ControlMessage, drain context.CancelFunc) {
+	if !msg.AppliesTo(p.workerID) {
+		return
+	}
+
+	switch msg.Kind {
+	case queuepkg.ControlCancelSession:
+		if p.cancelSession(msg.SessionID) {
+			p.logger.Infow("session cancelled by control message", "sessionID", msg.SessionID)
+		}
+	case queuepkg.ControlUpdateOptions:
+		// Every worker receives the broadcast; only the one running the
+		// session applies it.
+		p.mu.Lock()
+		updates, ok := p.updates[msg.SessionID]
+		if ok {
+			// Only the latest options matter to a running pipeline.
+			select {
+			case <-updates:
+			default:
+			}
+			updates <- *msg.Options
+		}
+		p.mu.Unlock()
+		if !ok {
+			return
+		}
+
+		p.logger.Infow("session options updated by control message", "sessionID", msg.SessionID)
+		_ = p.publish(ctx, statuspkg.SessionStatusEvent{
+			SessionID: msg.SessionID,
+			Stage:     "session",
+			State:     "options_updated",
+			Detail:    "options update received by worker " + p.workerID,
+		})
+	case queuepkg.ControlDrainWorker:
+		p.logger.Infow("drain requested; no longer accepting jobs", "workerID", p.workerID)
+		if drain != nil {
+			drain()
+		}
+	}
+}
+
+// track registers a cancellable context for sessionID so control messages
+// can stop its pipeline or update its options while it runs. The returned
+// release func must be called when the run finishes.
+func (p *ingestionProcessor) track(ctx context.Context, sessionID string) (context.Context, func()) {
+	runCtx, cancel := context.WithCancel(ctx)
+	updates := make(chan sessionpkg.TranslationOptions, 1)
+
+	p.mu.Lock()
+	if p.active == nil {
+		p.active = make(map[string]context.CancelFunc)
+		p.updates = make(map[string]chan sessionpkg.TranslationOptions)
+	}
+	p.active[sessionID] = cancel
+	p.updates[sessionID] = updates
+	p.mu.Unlock()
+
+	return pipelinepkg.WithOptionUpdates(runCtx, updates), func() {
+		p.mu.Lock()
+		delete(p.active, sessionID)
+		delete(p.updates, sessionID)
+		p.mu.Unlock()
+		cancel()
+	}
+}
+
+func (p *ingestionProcessor) cancelSession(sessionID string) bool {
+	p.mu.Lock()
+	cancel, ok := p.active[sessionID]
+	p.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
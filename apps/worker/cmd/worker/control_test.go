@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pipelinepkg "streamlation/packages/backend/pipeline"
+	queuepkg "streamlation/packages/backend/queue"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestIngestionProcessorCancelsSessionOnControlMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	controls := newStubControlStream()
+	started := make(chan struct{})
+	store := &stubSessionStore{getFunc: func(_ context.Context, id string) (sessionpkg.TranslationSession, error) {
+		return sessionpkg.TranslationSession{ID: id}, nil
+	}}
+	consumer := &stubConsumer{jobs: []*queuepkg.IngestionJob{{SessionID: "cancel-me"}}}
+
+	var mu sync.Mutex
+	var events []statuspkg.SessionStatusEvent
+	publisher := &stubStatusPublisher{publishFunc: func(_ context.Context, event statuspkg.SessionStatusEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+		return nil
+	}}
+
+	pipeline := &stubPipeline{runFunc: func(ctx context.Context, _ sessionpkg.TranslationSession, _ func(statuspkg.SessionStatusEvent) error) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	logger := newLogger()
+	processor := &ingestionProcessor{
+		store:         store,
+		consumer:      consumer,
+		publisher:     publisher,
+		pipeline:      pipeline,
+		controls:      controls,
+		workerID:      "worker-a",
+		logger:        logger,
+		maxConcurrent: 1,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		processor.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for pipeline start")
+	}
+
+	controls.messages <- queuepkg.ControlMessage{Kind: queuepkg.ControlCancelSession, SessionID: "cancel-me"}
+
+	deadline := time.After(2 * time.Second)
+	for {
+		mu.Lock()
+		var last statuspkg.SessionStatusEvent
+		if len(events) > 0 {
+			last = events[len(events)-1]
+		}
+		mu.Unlock()
+		if last.State == "cancelled" {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for cancelled event, last event %#v", last)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	<-done
+}
+
+func TestIngestionProcessorDrainStopsRun(t *testing.T) {
+	controls := newStubControlStream()
+	processor := &ingestionProcessor{
+		store:         &stubSessionStore{},
+		consumer:      &stubConsumer{},
+		controls:      controls,
+		workerID:      "worker-a",
+		logger:        newLogger(),
+		maxConcurrent: 1,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		processor.Run(context.Background())
+		close(done)
+	}()
+
+	controls.messages <- queuepkg.ControlMessage{Kind: queuepkg.ControlDrainWorker, WorkerID: "worker-b"}
+	select {
+	case <-done:
+		t.Fatal("drain addressed to another worker stopped this worker")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	controls.messages <- queuepkg.ControlMessage{Kind: queuepkg.ControlDrainWorker, WorkerID: "worker-a"}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for worker to drain")
+	}
+}
+
+func TestUpdateOptionsIgnoredForUntrackedSession(t *testing.T) {
+	var published []statuspkg.SessionStatusEvent
+	processor := &ingestionProcessor{
+		logger: newLogger(),
+		publisher: &stubStatusPublisher{publishFunc: func(_ context.Context, event statuspkg.SessionStatusEvent) error {
+			published = append(published, event)
+			return nil
+		}},
+	}
+	options := sessionpkg.TranslationOptions{ModelProfile: "gpu-accelerated"}
+	processor.handleControl(context.Background(), queuepkg.ControlMessage{
+		Kind:      queuepkg.ControlUpdateOptions,
+		SessionID: "elsewhere",
+		Options:   &options,
+	}, nil)
+
+	if len(published) != 0 {
+		t.Fatalf("expected no status event, got %#v", published)
+	}
+}
+
+func TestUpdateOptionsReachesRunningPipeline(t *testing.T) {
+	processor := &ingestionProcessor{logger: newLogger()}
+	runCtx, release := processor.track(context.Background(), "session-1")
+	defer release()
+
+	for _, profile := range []string{"cpu-advanced", "gpu-accelerated"} {
+		options := sessionpkg.TranslationOptions{ModelProfile: profile}
+		processor.handleControl(context.Background(), queuepkg.ControlMessage{
+			Kind:      queuepkg.ControlUpdateOptions,
+			SessionID: "session-1",
+			Options:   &options,
+		}, nil)
+	}
+
+	updates := pipelinepkg.OptionUpdatesFromContext(runCtx)
+	select {
+	case got := <-updates:
+		if got.ModelProfile != "gpu-accelerated" {
+			t.Fatalf("expected the latest options, got %#v", got)
+		}
+	default:
+		t.Fatal("expected the running pipeline to receive the update")
+	}
+}
+
+type stubControlStream struct {
+	messages chan queuepkg.ControlMessage
+	errors   chan error
+}
+
+func newStubControlStream() *stubControlStream {
+	return &stubControlStream{
+		messages: make(chan queuepkg.ControlMessage),
+		errors:   make(chan error),
+	}
+}
+
+func (s *stubControlStream) SubscribeControl(context.Context) (queuepkg.ControlStream, error) {
+	return s, nil
+}
+
+func (s *stubControlStream) Messages() <-chan queuepkg.ControlMessage { return s.messages }
+
+func (s *stubControlStream) Errors() <-chan error { return s.errors }
+
+func (s *stubControlStream) Close() error { return nil }
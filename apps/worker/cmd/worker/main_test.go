@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -42,6 +44,67 @@ func TestGetWorkerConcurrency(t *testing.T) {
 	}
 }
 
+func TestGetStatusBackendConfig(t *testing.T) {
+	t.Setenv("WORKER_STATUS_BACKEND", "nats")
+	t.Setenv("WORKER_NATS_URL", "nats://nats:4222")
+
+	cfg := getStatusBackendConfig("redis:6379")
+	if cfg.Backend != "nats" || cfg.NATSURL != "nats://nats:4222" || cfg.RedisAddr != "redis:6379" {
+		t.Fatalf("unexpected backend config: %#v", cfg)
+	}
+}
+
+func TestGetStatusRateLimit(t *testing.T) {
+	t.Setenv("WORKER_STATUS_RATE_LIMIT", "")
+	if got := getStatusRateLimit(); got != 20 {
+		t.Fatalf("expected default rate limit 20, got %d", got)
+	}
+
+	t.Setenv("WORKER_STATUS_RATE_LIMIT", "0")
+	if got := getStatusRateLimit(); got != 0 {
+		t.Fatalf("expected zero to disable the limit, got %d", got)
+	}
+
+	t.Setenv("WORKER_STATUS_RATE_LIMIT", "-3")
+	if got := getStatusRateLimit(); got != 20 {
+		t.Fatalf("expected fallback for negative values, got %d", got)
+	}
+}
+
+func TestGetStatusSpoolSize(t *testing.T) {
+	t.Setenv("WORKER_STATUS_SPOOL_SIZE", "")
+	if got := getStatusSpoolSize(); got != statuspkg.DefaultSpoolCapacity {
+		t.Fatalf("expected default spool size, got %d", got)
+	}
+
+	t.Setenv("WORKER_STATUS_SPOOL_SIZE", "250")
+	if got := getStatusSpoolSize(); got != 250 {
+		t.Fatalf("expected overridden spool size, got %d", got)
+	}
+
+	t.Setenv("WORKER_STATUS_SPOOL_SIZE", "0")
+	if got := getStatusSpoolSize(); got != statuspkg.DefaultSpoolCapacity {
+		t.Fatalf("expected fallback for non-positive size, got %d", got)
+	}
+}
+
+func TestGetDurationEnv(t *testing.T) {
+	t.Setenv("WORKER_HEARTBEAT_INTERVAL", "")
+	if got := getDurationEnv("WORKER_HEARTBEAT_INTERVAL", time.Minute); got != time.Minute {
+		t.Fatalf("expected default duration, got %s", got)
+	}
+
+	t.Setenv("WORKER_HEARTBEAT_INTERVAL", "90s")
+	if got := getDurationEnv("WORKER_HEARTBEAT_INTERVAL", time.Minute); got != 90*time.Second {
+		t.Fatalf("expected overridden duration, got %s", got)
+	}
+
+	t.Setenv("WORKER_HEARTBEAT_INTERVAL", "soon")
+	if got := getDurationEnv("WORKER_HEARTBEAT_INTERVAL", time.Minute); got != time.Minute {
+		t.Fatalf("expected fallback for invalid duration, got %s", got)
+	}
+}
+
 func TestIngestionProcessorProcessesJob(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -177,6 +240,56 @@ func TestIngestionProcessorHandlesMissingSession(t *testing.T) {
 	}
 }
 
+func TestLoadSessionPrefersSnapshot(t *testing.T) {
+	store := &stubSessionStore{getFunc: func(context.Context, string) (sessionpkg.TranslationSession, error) {
+		t.Fatal("store should not be consulted for a fresh snapshot")
+		return sessionpkg.TranslationSession{}, nil
+	}}
+	processor := &ingestionProcessor{store: store, logger: newLogger()}
+
+	snapshot := sessionpkg.TranslationSession{ID: "snap", TargetLanguage: "de"}
+	session, err := processor.loadSession(context.Background(), &queuepkg.IngestionJob{
+		SessionID:       "snap",
+		SnapshotVersion: queuepkg.SessionSnapshotVersion,
+		Session:         &snapshot,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if session.TargetLanguage != "de" {
+		t.Fatalf("expected snapshot session, got %#v", session)
+	}
+}
+
+func TestLoadSessionFallsBackForStaleSnapshot(t *testing.T) {
+	calls := 0
+	store := &stubSessionStore{getFunc: func(_ context.Context, id string) (sessionpkg.TranslationSession, error) {
+		calls++
+		return sessionpkg.TranslationSession{ID: id, TargetLanguage: "es"}, nil
+	}}
+	processor := &ingestionProcessor{store: store, logger: newLogger()}
+
+	stale := sessionpkg.TranslationSession{ID: "snap", TargetLanguage: "de"}
+	session, err := processor.loadSession(context.Background(), &queuepkg.IngestionJob{SessionID: "snap", Session: &stale})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 1 || session.TargetLanguage != "es" {
+		t.Fatalf("expected store lookup for stale snapshot, calls=%d session=%#v", calls, session)
+	}
+
+	store.getFunc = func(context.Context, string) (sessionpkg.TranslationSession, error) {
+		return sessionpkg.TranslationSession{}, errors.New("connection refused")
+	}
+	session, err = processor.loadSession(context.Background(), &queuepkg.IngestionJob{SessionID: "snap", Session: &stale})
+	if err != nil {
+		t.Fatalf("expected stale snapshot during outage, got error %v", err)
+	}
+	if session.TargetLanguage != "de" {
+		t.Fatalf("expected stale snapshot during outage, got %#v", session)
+	}
+}
+
 type stubSessionStore struct {
 	getFunc func(context.Context, string) (sessionpkg.TranslationSession, error)
 }
@@ -190,6 +303,9 @@ func (s *stubSessionStore) Get(ctx context.Context, id string) (sessionpkg.Trans
 
 type stubConsumer struct {
 	jobs []*queuepkg.IngestionJob
+
+	mu                  sync.Mutex
+	acked, deadLettered []string
 }
 
 func (s *stubConsumer) Pop(ctx context.Context, timeout time.Duration) (*queuepkg.IngestionJob, error) {
@@ -206,6 +322,20 @@ func (s *stubConsumer) Pop(ctx context.Context, timeout time.Duration) (*queuepk
 	return job, nil
 }
 
+func (s *stubConsumer) Ack(_ context.Context, job *queuepkg.IngestionJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked = append(s.acked, job.SessionID)
+	return nil
+}
+
+func (s *stubConsumer) DeadLetter(_ context.Context, job *queuepkg.IngestionJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLettered = append(s.deadLettered, job.SessionID)
+	return nil
+}
+
 type stubStatusPublisher struct {
 	publishFunc func(context.Context, statuspkg.SessionStatusEvent) error
 }
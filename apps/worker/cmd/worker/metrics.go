@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"streamlation/packages/backend/metrics"
+
+	"go.uber.org/zap"
+)
+
+// serveMetrics exposes /metrics on addr until ctx is cancelled. An empty addr
+// disables the endpoint.
+func serveMetrics(ctx context.Context, addr string, collector metrics.Collector, logger *zap.SugaredLogger) {
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", metrics.Handler(collector))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	go func() {
+		logger.Infow("metrics endpoint listening", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorw("metrics endpoint failed", "error", err)
+		}
+	}()
+}
+
+// instrument counts the jobs p handles, by outcome, and samples the sessions
+// it runs, in registry.
+func (p *ingestionProcessor) instrument(registry *metrics.Registry) {
+	p.jobs = registry.NewCounter("streamlation_worker_jobs_total", "Ingestion jobs handled, by outcome.", "outcome")
+	registry.NewGaugeFunc("streamlation_worker_active_sessions", "Sessions whose pipelines are running.", func() float64 {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return float64(len(p.active))
+	})
+}
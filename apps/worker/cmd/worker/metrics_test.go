@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/metrics"
+	postgres "streamlation/packages/backend/postgres"
+	queuepkg "streamlation/packages/backend/queue"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestMetricsHandlerExposesStageDurations(t *testing.T) {
+	durations := statuspkg.NewStageDurationPublisher(&stubStatusPublisher{})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_ = durations.Publish(context.Background(), statuspkg.SessionStatusEvent{SessionID: "abc", Stage: "asr", State: "processing", Timestamp: start})
+	_ = durations.Publish(context.Background(), statuspkg.SessionStatusEvent{SessionID: "abc", Stage: "asr", State: "completed", Timestamp: start.Add(time.Second)})
+
+	rec := httptest.NewRecorder()
+	metrics.Handler(durations)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `streamlation_stage_duration_seconds_count{stage="asr"} 1`) {
+		t.Fatalf("unexpected metrics body:\n%s", rec.Body.String())
+	}
+}
+
+func TestMetricsHandlerCombinesSources(t *testing.T) {
+	drops := statuspkg.NewDropMetricsPublisher(&stubStatusPublisher{})
+	retries := statuspkg.NewRetryMetricsPublisher(drops)
+	durations := statuspkg.NewStageDurationPublisher(retries)
+	_ = durations.Publish(context.Background(), statuspkg.SessionStatusEvent{SessionID: "abc", Stage: "translation", State: statuspkg.RetryingState, Attempt: 2})
+	_ = durations.Publish(context.Background(), statuspkg.SessionStatusEvent{SessionID: "abc", Stage: "asr", State: statuspkg.DroppingState, Dropped: 5})
+
+	registry := metrics.NewRegistry()
+	registry.Register(durations)
+	registry.Register(retries)
+	registry.Register(drops)
+	rec := httptest.NewRecorder()
+	metrics.Handler(registry)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "# TYPE streamlation_stage_duration_seconds histogram") ||
+		!strings.Contains(body, `streamlation_stage_retries_total{stage="translation"} 1`) ||
+		!strings.Contains(body, `streamlation_stage_dropped_total{stage="asr"} 5`) {
+		t.Fatalf("unexpected metrics body:\n%s", body)
+	}
+}
+
+func TestIngestionProcessorCountsJobs(t *testing.T) {
+	registry := metrics.NewRegistry()
+	store := &stubSessionStore{getFunc: func(_ context.Context, id string) (sessionpkg.TranslationSession, error) {
+		if id == "missing" {
+			return sessionpkg.TranslationSession{}, postgres.ErrSessionNotFound
+		}
+		return sessionpkg.TranslationSession{ID: id}, nil
+	}}
+	pipeline := &stubPipeline{runFunc: func(_ context.Context, session sessionpkg.TranslationSession, _ func(statuspkg.SessionStatusEvent) error) error {
+		if session.ID == "broken" {
+			return errors.New("boom")
+		}
+		return nil
+	}}
+	consumer := &stubConsumer{}
+	processor := &ingestionProcessor{store: store, consumer: consumer, publisher: &stubStatusPublisher{}, pipeline: pipeline, logger: newLogger()}
+	processor.instrument(registry)
+
+	for _, id := range []string{"abc", "def", "missing", "broken"} {
+		processor.handleJob(context.Background(), &queuepkg.IngestionJob{SessionID: id})
+	}
+	if !slices.Equal(consumer.acked, []string{"abc", "def", "missing"}) || !slices.Equal(consumer.deadLettered, []string{"broken"}) {
+		t.Fatalf("expected failed jobs dead-lettered and others acknowledged, got %v and %v", consumer.acked, consumer.deadLettered)
+	}
+
+	var b strings.Builder
+	if err := registry.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	for _, want := range []string{
+		`streamlation_worker_jobs_total{outcome="completed"} 2`,
+		`streamlation_worker_jobs_total{outcome="failed"} 1`,
+		`streamlation_worker_jobs_total{outcome="not_found"} 1`,
+		"streamlation_worker_active_sessions 0",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Fatalf("expected %s in metrics:\n%s", want, b.String())
+		}
+	}
+}
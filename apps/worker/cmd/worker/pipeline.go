@@ -0,0 +1,553 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"streamlation/packages/backend/archive"
+	asrpkg "streamlation/packages/backend/asr"
+	ingestionpkg "streamlation/packages/backend/ingestion"
+	mediapkg "streamlation/packages/backend/media"
+	outputpkg "streamlation/packages/backend/output"
+	pipelinepkg "streamlation/packages/backend/pipeline"
+	postgres "streamlation/packages/backend/postgres"
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+const (
+	pipelineModeStub      = "stub"
+	pipelineModeStreaming = "streaming"
+)
+
+// newPipeline builds the runner selected by WORKER_PIPELINE. The default
+// "stub" mode emits synthetic stage events. "streaming" ingests the
+// session's source and runs it through the stages declared by definition,
+// whose implementations individual sessions may override, with the
+// checkpointing of base. Sources are opened with the settings of sources.
+func newPipeline(mode string, definition pipelinepkg.Definition, sources ingestionpkg.SessionSourceConfig, base pipelinepkg.StreamingConfig) (pipelinepkg.Runner, error) {
+	switch mode {
+	case "", pipelineModeStub:
+		return pipelinepkg.NewSequentialStub([]pipelinepkg.Step{
+			{Stage: "ingestion", State: "buffering", Detail: "fetching stream metadata"},
+			{Stage: "media", State: "normalizing", Detail: "standardizing audio"},
+			{Stage: "asr", State: "processing", Detail: "transcribing audio chunks"},
+			{Stage: "translation", State: "generating", Detail: "producing target language captions"},
+			{Stage: "output", State: "rendering", Detail: "assembling subtitle artifacts"},
+		}), nil
+	case pipelineModeStreaming:
+	default:
+		return nil, fmt.Errorf("unknown pipeline mode %q", mode)
+	}
+
+	registry := pipelinepkg.NewRegistry()
+	if err := pipelinepkg.RegisterStubs(registry); err != nil {
+		return nil, err
+	}
+	if err := pipelinepkg.RegisterNative(registry); err != nil {
+		return nil, err
+	}
+	if err := pipelinepkg.RegisterWhisper(registry); err != nil {
+		return nil, err
+	}
+	if err := pipelinepkg.RegisterGRPC(registry); err != nil {
+		return nil, err
+	}
+	if err := pipelinepkg.RegisterOpenAI(registry); err != nil {
+		return nil, err
+	}
+	if err := pipelinepkg.RegisterMT(registry); err != nil {
+		return nil, err
+	}
+	if err := pipelinepkg.RegisterLLM(registry); err != nil {
+		return nil, err
+	}
+	if err := pipelinepkg.RegisterElevenLabs(registry); err != nil {
+		return nil, err
+	}
+
+	base.Sources = func(session sessionpkg.TranslationSession) (ingestionpkg.StreamSource, error) {
+		return ingestionpkg.NewSessionSource(session, sources)
+	}
+	return pipelinepkg.NewDefinedRunner(registry, definition, base)
+}
+
+// getSourceConfig returns the settings the streaming pipeline opens session
+// sources with. WORKER_SOURCE_CREDENTIALS_KEY holds the
+// base64 encoded key that the API sealed session source credentials with.
+// WORKER_PLATFORM_RESOLVER lets HLS sources name Twitch and YouTube pages:
+// "builtin" resolves them through the platforms' public APIs, and a URL
+// names an external resolver hook to ask instead. WORKER_SOURCE_BACKPRESSURE
+// selects what live sources do with chunks while the pipeline is behind:
+// "drop-newest" (the default), "drop-oldest", or "block", and
+// WORKER_SOURCE_HIGH_WATER_MARK the number of buffered chunks at which the
+// source's OnHighWater callback runs. WORKER_SOURCE_BUFFER_DIR buffers
+// network sources on disk in that directory, bounded by
+// WORKER_SOURCE_BUFFER_MAX_BYTES and WORKER_SOURCE_BUFFER_MAX_DURATION.
+// Sources with backup URIs fail over after WORKER_SOURCE_FAILOVER_ERRORS
+// consecutive errors or WORKER_SOURCE_FAILOVER_TIMEOUT without a chunk.
+// WORKER_SOURCE_ADAPTIVE_LAG lets HLS and DASH sources switch variants:
+// they step down once segment downloads keep taking that fraction of the
+// segment duration, for example 0.8. WORKER_HLS_CONCURRENCY is the number
+// of HLS segments downloaded at once. WORKER_RTMP_LISTEN_ADDR accepts RTMP
+// publishes on that address for the sessions whose RTMP URI has no host;
+// rtmp:///live/key takes the stream published to the application "live"
+// under the stream key "key".
+func getSourceConfig(getenv func(string) string) (ingestionpkg.SessionSourceConfig, error) {
+	config := ingestionpkg.SessionSourceConfig{
+		HTTPClient:        ingestionpkg.NewHTTPClient(10 * time.Second),
+		Dialer:            &net.Dialer{Timeout: 5 * time.Second},
+		BufferSize:        pipelinepkg.DefaultStageBuffer,
+		FileChunkSize:     64 * 1024,
+		FileChunkDuration: 200 * time.Millisecond,
+	}
+	if raw := getenv("WORKER_HLS_CONCURRENCY"); raw != "" {
+		concurrency, err := strconv.Atoi(raw)
+		if err != nil || concurrency <= 0 {
+			return ingestionpkg.SessionSourceConfig{}, fmt.Errorf("WORKER_HLS_CONCURRENCY must be a positive integer, got %q", raw)
+		}
+		config.HLSConcurrency = concurrency
+	}
+	if raw := getenv("WORKER_SOURCE_CREDENTIALS_KEY"); raw != "" {
+		key, err := sessionpkg.ParseCredentialsKey(raw)
+		if err != nil {
+			return ingestionpkg.SessionSourceConfig{}, fmt.Errorf("parse WORKER_SOURCE_CREDENTIALS_KEY: %w", err)
+		}
+		config.CredentialsKey = key
+	}
+	policy, err := ingestionpkg.ParseBackpressurePolicy(getenv("WORKER_SOURCE_BACKPRESSURE"))
+	if err != nil {
+		return ingestionpkg.SessionSourceConfig{}, fmt.Errorf("parse WORKER_SOURCE_BACKPRESSURE: %w", err)
+	}
+	config.Backpressure.Policy = policy
+	if raw := getenv("WORKER_SOURCE_HIGH_WATER_MARK"); raw != "" {
+		mark, err := strconv.Atoi(raw)
+		if err != nil || mark <= 0 {
+			return ingestionpkg.SessionSourceConfig{}, fmt.Errorf("WORKER_SOURCE_HIGH_WATER_MARK must be a positive integer, got %q", raw)
+		}
+		config.Backpressure.HighWaterMark = mark
+	}
+	if dir := getenv("WORKER_SOURCE_BUFFER_DIR"); dir != "" {
+		buffer := &ingestionpkg.DiskBufferConfig{Dir: dir, BufferSize: config.BufferSize}
+		if raw := getenv("WORKER_SOURCE_BUFFER_MAX_BYTES"); raw != "" {
+			limit, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || limit <= 0 {
+				return ingestionpkg.SessionSourceConfig{}, fmt.Errorf("WORKER_SOURCE_BUFFER_MAX_BYTES must be a positive integer, got %q", raw)
+			}
+			buffer.MaxBytes = limit
+		}
+		if raw := getenv("WORKER_SOURCE_BUFFER_MAX_DURATION"); raw != "" {
+			limit, err := time.ParseDuration(raw)
+			if err != nil || limit <= 0 {
+				return ingestionpkg.SessionSourceConfig{}, fmt.Errorf("WORKER_SOURCE_BUFFER_MAX_DURATION must be a positive duration, got %q", raw)
+			}
+			buffer.MaxDuration = limit
+		}
+		config.DiskBuffer = buffer
+	}
+	if raw := getenv("WORKER_SOURCE_FAILOVER_ERRORS"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return ingestionpkg.SessionSourceConfig{}, fmt.Errorf("WORKER_SOURCE_FAILOVER_ERRORS must be a positive integer, got %q", raw)
+		}
+		config.Failover.MaxErrors = limit
+	}
+	if raw := getenv("WORKER_SOURCE_FAILOVER_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			return ingestionpkg.SessionSourceConfig{}, fmt.Errorf("WORKER_SOURCE_FAILOVER_TIMEOUT must be a positive duration, got %q", raw)
+		}
+		config.Failover.StallTimeout = timeout
+	}
+	if raw := getenv("WORKER_SOURCE_ADAPTIVE_LAG"); raw != "" {
+		ratio, err := strconv.ParseFloat(raw, 64)
+		if err != nil || ratio <= 0 {
+			return ingestionpkg.SessionSourceConfig{}, fmt.Errorf("WORKER_SOURCE_ADAPTIVE_LAG must be a positive number, got %q", raw)
+		}
+		config.Adaptive = &ingestionpkg.AdaptiveConfig{LagRatio: ratio}
+	}
+	switch resolver := getenv("WORKER_PLATFORM_RESOLVER"); {
+	case resolver == "":
+	case resolver == "builtin":
+		config.Resolver = ingestionpkg.NewPlatformResolver(ingestionpkg.PlatformResolverConfig{Client: config.HTTPClient})
+	case strings.HasPrefix(resolver, "http://") || strings.HasPrefix(resolver, "https://"):
+		config.Resolver = ingestionpkg.NewPlatformResolver(ingestionpkg.PlatformResolverConfig{Client: config.HTTPClient, HookURL: resolver})
+	default:
+		return ingestionpkg.SessionSourceConfig{}, fmt.Errorf("WORKER_PLATFORM_RESOLVER must be \"builtin\" or a hook URL, got %q", resolver)
+	}
+	if addr := getenv("WORKER_RTMP_LISTEN_ADDR"); addr != "" {
+		listener, err := ingestionpkg.NewRTMPListener(ingestionpkg.RTMPListenerConfig{Addr: addr})
+		if err != nil {
+			return ingestionpkg.SessionSourceConfig{}, fmt.Errorf("configure WORKER_RTMP_LISTEN_ADDR: %w", err)
+		}
+		config.RTMPListener = listener
+	}
+	return config, nil
+}
+
+// newCheckpointer returns the checkpoint store selected by
+// WORKER_CHECKPOINT_BACKEND: "redis", "postgres", or empty to disable
+// checkpointing.
+func newCheckpointer(ctx context.Context, backend, redisAddr string, pgClient *postgres.Client) (pipelinepkg.Checkpointer, error) {
+	switch backend {
+	case "":
+		return nil, nil
+	case "redis":
+		return pipelinepkg.NewRedisCheckpointer(redisAddr)
+	case "postgres":
+		if err := postgres.EnsureCheckpointSchema(ctx, pgClient); err != nil {
+			return nil, fmt.Errorf("ensure checkpoint schema: %w", err)
+		}
+		return postgres.NewCheckpointStore(pgClient), nil
+	default:
+		return nil, fmt.Errorf("unknown checkpoint backend %q", backend)
+	}
+}
+
+// newArchiveStore returns a file store in dir, or nil when dir is empty.
+func newArchiveStore(dir string) (archive.Store, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	store, err := archive.NewFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// getArchiveStore reads the store that streaming sessions are archived
+// into from WORKER_ARCHIVE_BACKEND and the WORKER_ARCHIVE_* settings of the
+// backend, as getArtifactStore does. Unset disables archiving, unless
+// WORKER_ARCHIVE_DIR alone names a directory, which selects "file".
+func getArchiveStore(getenv func(string) string) (archive.Store, error) {
+	backend := getenv("WORKER_ARCHIVE_BACKEND")
+	if backend == "" && getenv("WORKER_ARCHIVE_DIR") != "" {
+		backend = "file"
+	}
+	return openObjectStore(getenv, backend, "WORKER_ARCHIVE")
+}
+
+// getArtifactStore reads the store that generated artifacts are kept in
+// from WORKER_ARTIFACT_BACKEND, "file", "s3", or "gcs" (unset disables
+// artifacts), and the WORKER_ARTIFACT_* settings of the backend: DIR for
+// "file"; BUCKET and PREFIX for both buckets; REGION, ENDPOINT, and
+// PATH_STYLE for "s3", signed with AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN or else with the role of
+// AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE; and ENDPOINT and
+// ACCESS_TOKEN for "gcs", which otherwise takes its tokens from the key in
+// GOOGLE_APPLICATION_CREDENTIALS or the metadata server.
+func getArtifactStore(getenv func(string) string) (archive.Store, error) {
+	return openObjectStore(getenv, getenv("WORKER_ARTIFACT_BACKEND"), "WORKER_ARTIFACT")
+}
+
+// openObjectStore opens backend with the settings named by prefix, or
+// returns nil when backend is empty.
+func openObjectStore(getenv func(string) string, backend, prefix string) (archive.Store, error) {
+	if backend == "" {
+		return nil, nil
+	}
+	return archive.OpenStore(archive.StoreConfig{
+		Backend: backend,
+		Dir:     getenv(prefix + "_DIR"),
+		S3: archive.S3Config{
+			Bucket:               getenv(prefix + "_BUCKET"),
+			Prefix:               getenv(prefix + "_PREFIX"),
+			Region:               getenv(prefix + "_REGION"),
+			Endpoint:             getenv(prefix + "_ENDPOINT"),
+			PathStyle:            getenv(prefix+"_PATH_STYLE") == "true",
+			AccessKeyID:          getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey:      getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:         getenv("AWS_SESSION_TOKEN"),
+			RoleARN:              getenv("AWS_ROLE_ARN"),
+			WebIdentityTokenFile: getenv("AWS_WEB_IDENTITY_TOKEN_FILE"),
+			RoleSessionName:      getenv("AWS_ROLE_SESSION_NAME"),
+			STSEndpoint:          getenv("AWS_ENDPOINT_URL_STS"),
+		},
+		GCS: archive.GCSConfig{
+			Bucket:          getenv(prefix + "_BUCKET"),
+			Prefix:          getenv(prefix + "_PREFIX"),
+			Endpoint:        getenv(prefix + "_ENDPOINT"),
+			AccessToken:     getenv(prefix + "_ACCESS_TOKEN"),
+			CredentialsFile: getenv("GOOGLE_APPLICATION_CREDENTIALS"),
+		},
+	})
+}
+
+// newArtifactWriter returns the writer that persists the subtitle files of
+// completed runs into store and records them in Postgres, or nil when
+// artifacts are disabled.
+func newArtifactWriter(ctx context.Context, store archive.Store, pgClient *postgres.Client) (*outputpkg.ArtifactWriter, error) {
+	if store == nil {
+		return nil, nil
+	}
+	if err := postgres.EnsureArtifactSchema(ctx, pgClient); err != nil {
+		return nil, fmt.Errorf("ensure artifact schema: %w", err)
+	}
+	return outputpkg.NewArtifactWriter(store, postgres.NewArtifactRegistry(pgClient))
+}
+
+// newCueEditStore returns the store of the cue edits the API records, when
+// WORKER_CUE_EDITS is "true" and artifacts are persisted, so that completed
+// runs persist cue lists and render their files with the edits applied.
+func newCueEditStore(ctx context.Context, getenv func(string) string, artifacts *outputpkg.ArtifactWriter, pgClient *postgres.Client) (outputpkg.CueEditStore, error) {
+	if artifacts == nil || getenv("WORKER_CUE_EDITS") != "true" {
+		return nil, nil
+	}
+	if err := postgres.EnsureCueEditSchema(ctx, pgClient); err != nil {
+		return nil, fmt.Errorf("ensure cue edit schema: %w", err)
+	}
+	return postgres.NewCueEditStore(pgClient), nil
+}
+
+// getArtifactFormats reads the subtitle formats persisted for every
+// completed run from WORKER_ARTIFACT_FORMATS, a comma-separated list such
+// as "srt,vtt,ttml". Unset keeps the pipeline's defaults.
+func getArtifactFormats(getenv func(string) string) []outputpkg.SubtitleFormat {
+	var formats []outputpkg.SubtitleFormat
+	for _, format := range strings.Split(getenv("WORKER_ARTIFACT_FORMATS"), ",") {
+		if format = strings.ToLower(strings.TrimSpace(format)); format != "" {
+			formats = append(formats, outputpkg.SubtitleFormat(format))
+		}
+	}
+	return formats
+}
+
+// getCueRules reads the readability rules of subtitle cues from
+// WORKER_CUE_RULES, a semicolon-separated list of rules such as
+// "cps=20;ja:chars=13,cps=4", each a comma-separated list of chars, lines,
+// min, max, or cps settings that applies to every language, or to the one
+// it is prefixed with. "default" applies the default rules, and unset
+// disables cue formatting.
+func getCueRules(getenv func(string) string) (*outputpkg.CueFormatterConfig, error) {
+	raw := getenv("WORKER_CUE_RULES")
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	config := &outputpkg.CueFormatterConfig{Languages: make(map[string]outputpkg.CueRules)}
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || entry == "default" {
+			continue
+		}
+		language, settings, ok := strings.Cut(entry, ":")
+		if !ok {
+			language, settings = "", entry
+		}
+		language = strings.TrimSpace(language)
+		rules := config.Rules
+		if language != "" {
+			rules = config.Languages[language]
+		}
+		for _, setting := range strings.Split(settings, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(setting), "=")
+			var err error
+			switch strings.TrimSpace(name) {
+			case "chars":
+				rules.MaxLineChars, err = strconv.Atoi(value)
+			case "lines":
+				rules.MaxLines, err = strconv.Atoi(value)
+			case "min":
+				rules.MinDuration, err = time.ParseDuration(value)
+			case "max":
+				rules.MaxDuration, err = time.ParseDuration(value)
+			case "cps":
+				rules.MaxCharsPerSecond, err = strconv.ParseFloat(value, 64)
+			default:
+				err = errors.New("unknown setting")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid WORKER_CUE_RULES setting %q: want chars, lines, min, max, or cps", setting)
+			}
+		}
+		if language != "" {
+			config.Languages[language] = rules
+		} else {
+			config.Rules = rules
+		}
+	}
+	return config, nil
+}
+
+// getAudioDump reads the debug audio dump from WORKER_AUDIO_DUMP_DIR, below
+// which each session's recognition audio is written to WAV files (unset
+// disables it), WORKER_AUDIO_DUMP_MAX_BYTES, the size of each file, and
+// WORKER_AUDIO_DUMP_MAX_FILES, how many files a session keeps.
+func getAudioDump(getenv func(string) string) (*mediapkg.AudioDumpConfig, error) {
+	dir := getenv("WORKER_AUDIO_DUMP_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+	config := &mediapkg.AudioDumpConfig{Dir: dir}
+	if raw := getenv("WORKER_AUDIO_DUMP_MAX_BYTES"); raw != "" {
+		limit, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("WORKER_AUDIO_DUMP_MAX_BYTES must be a positive integer, got %q", raw)
+		}
+		config.MaxFileSize = limit
+	}
+	if raw := getenv("WORKER_AUDIO_DUMP_MAX_FILES"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("WORKER_AUDIO_DUMP_MAX_FILES must be a positive integer, got %q", raw)
+		}
+		config.MaxFiles = limit
+	}
+	return config, nil
+}
+
+// getOpenCaptions reads the open captions from WORKER_OPEN_CAPTION_DIR,
+// below which each run's HLS source is republished with its subtitles
+// burned in (unset disables it), WORKER_OPEN_CAPTION_FFMPEG, the ffmpeg
+// command, and WORKER_OPEN_CAPTION_STYLE, the libass style of the
+// subtitles.
+func getOpenCaptions(getenv func(string) string) (*outputpkg.OpenCaptionConfig, error) {
+	store, err := newArchiveStore(getenv("WORKER_OPEN_CAPTION_DIR"))
+	if err != nil || store == nil {
+		return nil, err
+	}
+	return &outputpkg.OpenCaptionConfig{
+		Store:   store,
+		Command: strings.Fields(getenv("WORKER_OPEN_CAPTION_FFMPEG")),
+		Style:   getenv("WORKER_OPEN_CAPTION_STYLE"),
+	}, nil
+}
+
+// getModelManager reads the ASR models from WORKER_ASR_MODELS, a list of
+// profile=file pairs such as "cpu-basic=/models/ggml-base.bin" (unset
+// disables model management), and WORKER_ASR_MODEL_BUDGET_BYTES, the memory
+// the models loaded at once may take.
+func getModelManager(getenv func(string) string) (*asrpkg.ModelManager, error) {
+	raw := getenv("WORKER_ASR_MODELS")
+	if raw == "" {
+		return nil, nil
+	}
+	config := asrpkg.ModelManagerConfig{Models: make(map[asrpkg.ModelProfile]string)}
+	for _, pair := range strings.Split(raw, ",") {
+		profile, model, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		profile, model = strings.TrimSpace(profile), strings.TrimSpace(model)
+		if !ok || profile == "" || model == "" {
+			return nil, fmt.Errorf("invalid WORKER_ASR_MODELS entry %q: want profile=file", pair)
+		}
+		config.Models[asrpkg.ModelProfile(profile)] = model
+	}
+	if raw := getenv("WORKER_ASR_MODEL_BUDGET_BYTES"); raw != "" {
+		budget, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || budget <= 0 {
+			return nil, fmt.Errorf("WORKER_ASR_MODEL_BUDGET_BYTES must be a positive integer, got %q", raw)
+		}
+		config.Budget = budget
+	}
+	return asrpkg.NewModelManager(config), nil
+}
+
+// getPipelineDefinition reads the pipeline definition document named by
+// WORKER_PIPELINE_DEFINITION, if any. The implementations listed in
+// WORKER_PIPELINE_STAGES, the candidates listed in WORKER_STAGE_CANDIDATES,
+// and the policies set by the other WORKER_STAGE_* variables override the
+// document, and stages that are chosen nowhere use the stub implementation.
+func getPipelineDefinition(getenv func(string) string) (pipelinepkg.Definition, error) {
+	var definition pipelinepkg.Definition
+	if path := getenv("WORKER_PIPELINE_DEFINITION"); path != "" {
+		loaded, err := pipelinepkg.LoadDefinition(path)
+		if err != nil {
+			return pipelinepkg.Definition{}, err
+		}
+		definition = loaded
+	}
+
+	selection, err := pipelinepkg.ParseStageSelection(getenv("WORKER_PIPELINE_STAGES"))
+	if err != nil {
+		return pipelinepkg.Definition{}, fmt.Errorf("parse WORKER_PIPELINE_STAGES: %w", err)
+	}
+	candidates, err := pipelinepkg.ParseStageSelection(getenv("WORKER_STAGE_CANDIDATES"))
+	if err != nil {
+		return pipelinepkg.Definition{}, fmt.Errorf("parse WORKER_STAGE_CANDIDATES: %w", err)
+	}
+	policies, err := getStagePolicies(getenv)
+	if err != nil {
+		return pipelinepkg.Definition{}, err
+	}
+	overrides := pipelinepkg.Definition{Stages: make(map[string]pipelinepkg.StageDefinition)}
+	for _, stage := range pipelinepkg.ConfigurableStages {
+		implementation := selection[stage]
+		if implementation == "" && definition.Stages[stage].Implementation == "" {
+			implementation = pipelinepkg.StubImplementation
+		}
+		overrides.Stages[stage] = pipelinepkg.StageDefinition{Implementation: implementation, Policy: policies[stage], Candidate: candidates[stage]}
+	}
+	return definition.Override(overrides), nil
+}
+
+// getStagePolicies reads the per-stage policies from the environment. Each
+// variable lists stage=value pairs:
+//
+//   - WORKER_STAGE_TIMEOUTS: the longest a stage may hold input without
+//     producing output (for example "asr=30s").
+//   - WORKER_STAGE_RETRIES: how often a timed-out stage is restarted before
+//     the session fails (for example "asr=2").
+//   - WORKER_STAGE_FAILURE_RETRIES: how many consecutive transient failures,
+//     such as a translation provider answering 503, a stage may recover from
+//     (for example "translation=3").
+//   - WORKER_STAGE_RETRY_BACKOFF: the wait before the first of those retries
+//     (for example "translation=500ms").
+//   - WORKER_STAGE_QUEUE_CAPACITY: the size of a stage's input queue (for
+//     example "asr=64").
+//   - WORKER_STAGE_DROP_POLICY: what a full input queue does with new input,
+//     one of block, drop-oldest, or drop-newest (for example
+//     "asr=drop-oldest").
+func getStagePolicies(getenv func(string) string) (map[string]pipelinepkg.StagePolicy, error) {
+	policies := make(map[string]pipelinepkg.StagePolicy)
+	for _, setting := range []struct {
+		env   string
+		apply func(policy *pipelinepkg.StagePolicy, value string) bool
+	}{
+		{"WORKER_STAGE_TIMEOUTS", func(policy *pipelinepkg.StagePolicy, value string) bool {
+			timeout, err := time.ParseDuration(value)
+			policy.Timeout = timeout
+			return err == nil && timeout > 0
+		}},
+		{"WORKER_STAGE_RETRIES", func(policy *pipelinepkg.StagePolicy, value string) bool {
+			count, err := strconv.Atoi(value)
+			policy.Retries = count
+			return err == nil && count >= 0
+		}},
+		{"WORKER_STAGE_FAILURE_RETRIES", func(policy *pipelinepkg.StagePolicy, value string) bool {
+			count, err := strconv.Atoi(value)
+			policy.Retry.Attempts = count
+			return err == nil && count >= 0
+		}},
+		{"WORKER_STAGE_RETRY_BACKOFF", func(policy *pipelinepkg.StagePolicy, value string) bool {
+			backoff, err := time.ParseDuration(value)
+			policy.Retry.Backoff = backoff
+			return err == nil && backoff > 0
+		}},
+		{"WORKER_STAGE_QUEUE_CAPACITY", func(policy *pipelinepkg.StagePolicy, value string) bool {
+			capacity, err := strconv.Atoi(value)
+			policy.Capacity = capacity
+			return err == nil && capacity > 0
+		}},
+		{"WORKER_STAGE_DROP_POLICY", func(policy *pipelinepkg.StagePolicy, value string) bool {
+			drop, err := pipelinepkg.ParseDropPolicy(value)
+			policy.Drop = drop
+			return err == nil
+		}},
+	} {
+		values, err := pipelinepkg.ParseStageSelection(getenv(setting.env))
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", setting.env, err)
+		}
+		for stage, value := range values {
+			policy := policies[stage]
+			if !setting.apply(&policy, value) {
+				return nil, fmt.Errorf("invalid %s value for %s: %q", setting.env, stage, value)
+			}
+			policies[stage] = policy
+		}
+	}
+	return policies, nil
+}
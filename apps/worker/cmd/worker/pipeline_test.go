@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/archive"
+	ingestionpkg "streamlation/packages/backend/ingestion"
+	outputpkg "streamlation/packages/backend/output"
+	pipelinepkg "streamlation/packages/backend/pipeline"
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+func stagesDefinition(t *testing.T, stages string) pipelinepkg.Definition {
+	t.Helper()
+	definition, err := getPipelineDefinition(func(key string) string {
+		if key == "WORKER_PIPELINE_STAGES" {
+			return stages
+		}
+		return ""
+	})
+	if err != nil {
+		t.Fatalf("pipeline definition: %v", err)
+	}
+	return definition
+}
+
+func TestNewPipelineSelectsMode(t *testing.T) {
+	runner, err := newPipeline("", pipelinepkg.Definition{}, ingestionpkg.SessionSourceConfig{}, pipelinepkg.StreamingConfig{})
+	if err != nil {
+		t.Fatalf("default pipeline: %v", err)
+	}
+	if _, ok := runner.(*pipelinepkg.SequentialStub); !ok {
+		t.Fatalf("expected stub pipeline by default, got %T", runner)
+	}
+
+	runner, err = newPipeline("streaming", stagesDefinition(t, "asr=stub"), ingestionpkg.SessionSourceConfig{}, pipelinepkg.StreamingConfig{})
+	if err != nil {
+		t.Fatalf("streaming pipeline: %v", err)
+	}
+	if _, ok := runner.(*pipelinepkg.ConfiguredRunner); !ok {
+		t.Fatalf("expected configured runner, got %T", runner)
+	}
+
+	if _, err := newPipeline("streaming", stagesDefinition(t, "asr=unregistered"), ingestionpkg.SessionSourceConfig{}, pipelinepkg.StreamingConfig{}); err == nil {
+		t.Fatal("expected unregistered implementation to be rejected")
+	}
+	if _, err := newPipeline("batch", pipelinepkg.Definition{}, ingestionpkg.SessionSourceConfig{}, pipelinepkg.StreamingConfig{}); err == nil {
+		t.Fatal("expected unknown mode to be rejected")
+	}
+}
+
+func TestGetPipelineDefinitionAppliesEnvironmentOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipeline.json")
+	document := `{
+		"bufferSize": 32,
+		"stages": {
+			"asr": {"implementation": "stub", "timeout": "10s", "capacity": 8},
+			"translation": {"implementation": "stub", "options": {"glossary": "sports"}}
+		},
+		"profiles": {"low-latency": {"stages": {"asr": {"capacity": 2, "drop": "drop-oldest"}}}}
+	}`
+	if err := os.WriteFile(path, []byte(document), 0o600); err != nil {
+		t.Fatalf("write definition: %v", err)
+	}
+	env := map[string]string{
+		"WORKER_PIPELINE_DEFINITION": path,
+		"WORKER_STAGE_TIMEOUTS":      "asr=30s",
+		"WORKER_STAGE_CANDIDATES":    "translation=stub",
+	}
+	definition, err := getPipelineDefinition(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("pipeline definition: %v", err)
+	}
+
+	if definition.BufferSize != 32 {
+		t.Fatalf("expected buffer size from the document, got %d", definition.BufferSize)
+	}
+	asr := definition.Stages["asr"]
+	if asr.Policy.Timeout != 30*time.Second || asr.Policy.Capacity != 8 {
+		t.Fatalf("expected the environment timeout over the document's capacity, got %+v", asr.Policy)
+	}
+	if got := definition.Stages["translation"].Candidate; got != "stub" {
+		t.Fatalf("expected the translation candidate from the environment, got %q", got)
+	}
+	if got := definition.Stages["translation"].Options["glossary"]; got != "sports" {
+		t.Fatalf("expected translation options to be kept, got %q", got)
+	}
+	for _, stage := range pipelinepkg.ConfigurableStages {
+		if definition.Stages[stage].Implementation == "" {
+			t.Fatalf("expected %s to default to an implementation", stage)
+		}
+	}
+	if drop := definition.Profile("low-latency").Stages["asr"].Policy.Drop; drop != pipelinepkg.DropOldest {
+		t.Fatalf("expected profile drop policy, got %q", drop)
+	}
+
+	env["WORKER_PIPELINE_DEFINITION"] = filepath.Join(t.TempDir(), "missing.json")
+	if _, err := getPipelineDefinition(func(key string) string { return env[key] }); err == nil {
+		t.Fatal("expected a missing definition document to be rejected")
+	}
+}
+
+func TestNewCheckpointerSelectsBackend(t *testing.T) {
+	checkpointer, err := newCheckpointer(context.Background(), "", "127.0.0.1:6379", nil)
+	if err != nil || checkpointer != nil {
+		t.Fatalf("expected checkpointing to be disabled by default, got %v (%v)", checkpointer, err)
+	}
+	checkpointer, err = newCheckpointer(context.Background(), "redis", "127.0.0.1:6379", nil)
+	if err != nil {
+		t.Fatalf("redis checkpointer: %v", err)
+	}
+	if _, ok := checkpointer.(*pipelinepkg.RedisCheckpointer); !ok {
+		t.Fatalf("expected redis checkpointer, got %T", checkpointer)
+	}
+	if _, err := newCheckpointer(context.Background(), "etcd", "", nil); err == nil {
+		t.Fatal("expected unknown backend to be rejected")
+	}
+}
+
+func TestNewArchiveStore(t *testing.T) {
+	store, err := newArchiveStore("")
+	if err != nil || store != nil {
+		t.Fatalf("expected archiving to be disabled by default, got %v (%v)", store, err)
+	}
+	store, err = newArchiveStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("archive store: %v", err)
+	}
+	if _, ok := store.(*archive.FileStore); !ok {
+		t.Fatalf("expected file store, got %T", store)
+	}
+}
+
+func TestGetArchiveStore(t *testing.T) {
+	store, err := getArchiveStore(func(string) string { return "" })
+	if err != nil || store != nil {
+		t.Fatalf("expected archiving to be disabled by default, got %v (%v)", store, err)
+	}
+	env := map[string]string{"WORKER_ARCHIVE_DIR": t.TempDir()}
+	store, err = getArchiveStore(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("archive store: %v", err)
+	}
+	if _, ok := store.(*archive.FileStore); !ok {
+		t.Fatalf("expected a file store, got %T", store)
+	}
+	env = map[string]string{
+		"WORKER_ARCHIVE_BACKEND": "s3",
+		"WORKER_ARCHIVE_BUCKET":  "archive",
+		"AWS_ACCESS_KEY_ID":      "key",
+		"AWS_SECRET_ACCESS_KEY":  "secret",
+	}
+	store, err = getArchiveStore(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("archive store: %v", err)
+	}
+	if _, ok := store.(*archive.S3Store); !ok {
+		t.Fatalf("expected an S3 store, got %T", store)
+	}
+	env["WORKER_ARCHIVE_BACKEND"] = "gcs"
+	env["WORKER_ARCHIVE_ACCESS_TOKEN"] = "token"
+	store, err = getArchiveStore(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("archive store: %v", err)
+	}
+	if _, ok := store.(*archive.GCSStore); !ok {
+		t.Fatalf("expected a GCS store, got %T", store)
+	}
+}
+
+func TestGetAudioDump(t *testing.T) {
+	config, err := getAudioDump(func(string) string { return "" })
+	if err != nil || config != nil {
+		t.Fatalf("expected no audio dump by default, got %+v, %v", config, err)
+	}
+	env := map[string]string{
+		"WORKER_AUDIO_DUMP_DIR":       "/var/lib/streamlation/dumps",
+		"WORKER_AUDIO_DUMP_MAX_BYTES": "1048576",
+		"WORKER_AUDIO_DUMP_MAX_FILES": "4",
+	}
+	config, err = getAudioDump(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("audio dump: %v", err)
+	}
+	if config == nil || config.Dir != "/var/lib/streamlation/dumps" || config.MaxFileSize != 1<<20 || config.MaxFiles != 4 {
+		t.Fatalf("unexpected audio dump %+v", config)
+	}
+	env["WORKER_AUDIO_DUMP_MAX_FILES"] = "none"
+	if _, err := getAudioDump(func(name string) string { return env[name] }); err == nil {
+		t.Fatal("expected an invalid file count to be rejected")
+	}
+}
+
+func TestGetOpenCaptions(t *testing.T) {
+	config, err := getOpenCaptions(func(string) string { return "" })
+	if err != nil || config != nil {
+		t.Fatalf("expected no open captions by default, got %+v, %v", config, err)
+	}
+	env := map[string]string{
+		"WORKER_OPEN_CAPTION_DIR":    t.TempDir(),
+		"WORKER_OPEN_CAPTION_FFMPEG": "docker run --rm ffmpeg",
+		"WORKER_OPEN_CAPTION_STYLE":  "FontSize=24",
+	}
+	config, err = getOpenCaptions(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("open captions: %v", err)
+	}
+	if config == nil || config.Store == nil || len(config.Command) != 4 || config.Command[0] != "docker" || config.Style != "FontSize=24" {
+		t.Fatalf("unexpected open captions %+v", config)
+	}
+}
+
+func TestGetArtifactStore(t *testing.T) {
+	store, err := getArtifactStore(func(string) string { return "" })
+	if err != nil || store != nil {
+		t.Fatalf("expected no artifact store by default, got %+v, %v", store, err)
+	}
+	env := map[string]string{
+		"WORKER_ARTIFACT_BACKEND": "s3",
+		"WORKER_ARTIFACT_BUCKET":  "artifacts",
+		"AWS_ACCESS_KEY_ID":       "key",
+		"AWS_SECRET_ACCESS_KEY":   "secret",
+	}
+	store, err = getArtifactStore(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("artifact store: %v", err)
+	}
+	if _, ok := store.(*archive.S3Store); !ok {
+		t.Fatalf("expected an S3 store, got %T", store)
+	}
+	delete(env, "AWS_SECRET_ACCESS_KEY")
+	if _, err := getArtifactStore(func(name string) string { return env[name] }); err == nil {
+		t.Fatal("expected missing credentials to be rejected")
+	}
+	env["WORKER_ARTIFACT_BACKEND"] = "ftp"
+	if _, err := getArtifactStore(func(name string) string { return env[name] }); err == nil {
+		t.Fatal("expected an unknown backend to be rejected")
+	}
+}
+
+func TestGetArtifactFormats(t *testing.T) {
+	if formats := getArtifactFormats(func(string) string { return "" }); formats != nil {
+		t.Fatalf("expected the pipeline defaults, got %v", formats)
+	}
+	formats := getArtifactFormats(func(string) string { return "SRT, ttml," })
+	if len(formats) != 2 || formats[0] != outputpkg.FormatSRT || formats[1] != outputpkg.FormatTTML {
+		t.Fatalf("unexpected formats %v", formats)
+	}
+}
+
+func TestGetCueRules(t *testing.T) {
+	if rules, err := getCueRules(func(string) string { return "" }); err != nil || rules != nil {
+		t.Fatalf("expected no cue formatting by default, got %+v, %v", rules, err)
+	}
+	if rules, err := getCueRules(func(string) string { return "default" }); err != nil || rules == nil || rules.Rules != (outputpkg.CueRules{}) {
+		t.Fatalf("expected the default rules, got %+v, %v", rules, err)
+	}
+	rules, err := getCueRules(func(string) string { return "cps=20, lines=3; ja:chars=13,min=1.5s ; de:max=6s" })
+	if err != nil {
+		t.Fatalf("cue rules: %v", err)
+	}
+	if rules.Rules != (outputpkg.CueRules{MaxCharsPerSecond: 20, MaxLines: 3}) {
+		t.Fatalf("unexpected rules %+v", rules.Rules)
+	}
+	if rules.Languages["ja"] != (outputpkg.CueRules{MaxLineChars: 13, MinDuration: 1500 * time.Millisecond}) || rules.Languages["de"] != (outputpkg.CueRules{MaxDuration: 6 * time.Second}) {
+		t.Fatalf("unexpected language rules %+v", rules.Languages)
+	}
+	if _, err := getCueRules(func(string) string { return "ja:width=13" }); err == nil {
+		t.Fatal("expected unknown settings to be rejected")
+	}
+}
+
+func TestGetModelManager(t *testing.T) {
+	models, err := getModelManager(func(string) string { return "" })
+	if err != nil || models != nil {
+		t.Fatalf("expected no model manager by default, got %+v, %v", models, err)
+	}
+	model := filepath.Join(t.TempDir(), "ggml-base.bin")
+	if err := os.WriteFile(model, make([]byte, 1024), 0o600); err != nil {
+		t.Fatalf("write model: %v", err)
+	}
+	env := map[string]string{
+		"WORKER_ASR_MODELS":             "cpu-basic=" + model + ", cpu-advanced = " + model,
+		"WORKER_ASR_MODEL_BUDGET_BYTES": "4096",
+	}
+	models, err = getModelManager(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("model manager: %v", err)
+	}
+	lease, err := models.Acquire(context.Background(), "cpu-advanced", nil)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if lease.Model() != model {
+		t.Fatalf("expected model %s, got %s", model, lease.Model())
+	}
+	lease.Release()
+
+	env["WORKER_ASR_MODEL_BUDGET_BYTES"] = "lots"
+	if _, err := getModelManager(func(name string) string { return env[name] }); err == nil {
+		t.Fatal("expected an invalid budget to be rejected")
+	}
+	env["WORKER_ASR_MODELS"] = "cpu-basic"
+	if _, err := getModelManager(func(name string) string { return env[name] }); err == nil {
+		t.Fatal("expected an entry without a file to be rejected")
+	}
+}
+
+func TestGetSourceConfigReadsCredentialsKey(t *testing.T) {
+	key := bytes.Repeat([]byte{5}, sessionpkg.CredentialsKeySize)
+	config, err := getSourceConfig(func(name string) string {
+		if name == "WORKER_SOURCE_CREDENTIALS_KEY" {
+			return base64.StdEncoding.EncodeToString(key)
+		}
+		return ""
+	})
+	if err != nil {
+		t.Fatalf("source config: %v", err)
+	}
+	if !bytes.Equal(config.CredentialsKey, key) {
+		t.Fatalf("unexpected credentials key %x", config.CredentialsKey)
+	}
+	if _, err := getSourceConfig(func(name string) string {
+		if name == "WORKER_SOURCE_CREDENTIALS_KEY" {
+			return "c2hvcnQ="
+		}
+		return ""
+	}); err == nil {
+		t.Fatal("expected a short key to be rejected")
+	}
+}
+
+func TestGetSourceConfigReadsBackpressure(t *testing.T) {
+	env := map[string]string{
+		"WORKER_SOURCE_BACKPRESSURE":    "drop-oldest",
+		"WORKER_SOURCE_HIGH_WATER_MARK": "12",
+	}
+	config, err := getSourceConfig(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("source config: %v", err)
+	}
+	if config.Backpressure.Policy != ingestionpkg.BackpressureDropOldest || config.Backpressure.HighWaterMark != 12 {
+		t.Fatalf("unexpected backpressure %+v", config.Backpressure)
+	}
+	env["WORKER_SOURCE_BACKPRESSURE"] = "lossless"
+	if _, err := getSourceConfig(func(name string) string { return env[name] }); err == nil {
+		t.Fatal("expected an unknown policy to be rejected")
+	}
+}
+
+func TestGetSourceConfigReadsDiskBuffer(t *testing.T) {
+	config, err := getSourceConfig(func(string) string { return "" })
+	if err != nil || config.DiskBuffer != nil {
+		t.Fatalf("expected no disk buffer by default, got %+v, %v", config.DiskBuffer, err)
+	}
+	env := map[string]string{
+		"WORKER_SOURCE_BUFFER_DIR":          "/var/cache/streamlation",
+		"WORKER_SOURCE_BUFFER_MAX_BYTES":    "1048576",
+		"WORKER_SOURCE_BUFFER_MAX_DURATION": "30s",
+	}
+	config, err = getSourceConfig(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("source config: %v", err)
+	}
+	if buffer := config.DiskBuffer; buffer == nil || buffer.Dir != "/var/cache/streamlation" || buffer.MaxBytes != 1<<20 || buffer.MaxDuration != 30*time.Second {
+		t.Fatalf("unexpected disk buffer %+v", config.DiskBuffer)
+	}
+	env["WORKER_SOURCE_BUFFER_MAX_DURATION"] = "soon"
+	if _, err := getSourceConfig(func(name string) string { return env[name] }); err == nil {
+		t.Fatal("expected an invalid duration to be rejected")
+	}
+}
+
+func TestGetSourceConfigReadsFailoverPolicy(t *testing.T) {
+	env := map[string]string{
+		"WORKER_SOURCE_FAILOVER_ERRORS":  "5",
+		"WORKER_SOURCE_FAILOVER_TIMEOUT": "20s",
+	}
+	config, err := getSourceConfig(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("source config: %v", err)
+	}
+	if config.Failover.MaxErrors != 5 || config.Failover.StallTimeout != 20*time.Second {
+		t.Fatalf("unexpected failover policy %+v", config.Failover)
+	}
+	env["WORKER_SOURCE_FAILOVER_ERRORS"] = "0"
+	if _, err := getSourceConfig(func(name string) string { return env[name] }); err == nil {
+		t.Fatal("expected a zero error threshold to be rejected")
+	}
+}
+
+func TestGetSourceConfigReadsHLSConcurrency(t *testing.T) {
+	env := map[string]string{"WORKER_HLS_CONCURRENCY": "4"}
+	config, err := getSourceConfig(func(name string) string { return env[name] })
+	if err != nil || config.HLSConcurrency != 4 {
+		t.Fatalf("expected a concurrency of 4, got %d, %v", config.HLSConcurrency, err)
+	}
+	env["WORKER_HLS_CONCURRENCY"] = "-1"
+	if _, err := getSourceConfig(func(name string) string { return env[name] }); err == nil {
+		t.Fatal("expected a negative concurrency to be rejected")
+	}
+}
+
+func TestGetSourceConfigReadsAdaptiveLag(t *testing.T) {
+	config, err := getSourceConfig(func(string) string { return "" })
+	if err != nil || config.Adaptive != nil {
+		t.Fatalf("expected adaptive switching off by default, got %+v, %v", config.Adaptive, err)
+	}
+	env := map[string]string{"WORKER_SOURCE_ADAPTIVE_LAG": "0.75"}
+	config, err = getSourceConfig(func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("source config: %v", err)
+	}
+	if config.Adaptive == nil || config.Adaptive.LagRatio != 0.75 {
+		t.Fatalf("unexpected adaptive config %+v", config.Adaptive)
+	}
+	env["WORKER_SOURCE_ADAPTIVE_LAG"] = "fast"
+	if _, err := getSourceConfig(func(name string) string { return env[name] }); err == nil {
+		t.Fatal("expected an invalid ratio to be rejected")
+	}
+}
+
+func TestGetSourceConfigSelectsPlatformResolver(t *testing.T) {
+	for value, enabled := range map[string]bool{"": false, "builtin": true, "http://resolver:8080/resolve": true} {
+		config, err := getSourceConfig(func(name string) string {
+			if name == "WORKER_PLATFORM_RESOLVER" {
+				return value
+			}
+			return ""
+		})
+		if err != nil {
+			t.Fatalf("source config for %q: %v", value, err)
+		}
+		if (config.Resolver != nil) != enabled {
+			t.Fatalf("resolver for %q = %v, want enabled %v", value, config.Resolver, enabled)
+		}
+	}
+	if _, err := getSourceConfig(func(name string) string {
+		if name == "WORKER_PLATFORM_RESOLVER" {
+			return "yes"
+		}
+		return ""
+	}); err == nil {
+		t.Fatal("expected an unknown resolver to be rejected")
+	}
+}
+
+func TestGetSourceConfigCreatesRTMPListener(t *testing.T) {
+	config, err := getSourceConfig(func(string) string { return "" })
+	if err != nil || config.RTMPListener != nil {
+		t.Fatalf("expected no rtmp listener by default, got %v, %v", config.RTMPListener, err)
+	}
+	config, err = getSourceConfig(func(name string) string {
+		if name == "WORKER_RTMP_LISTEN_ADDR" {
+			return ":1935"
+		}
+		return ""
+	})
+	if err != nil {
+		t.Fatalf("source config: %v", err)
+	}
+	if config.RTMPListener == nil {
+		t.Fatal("expected an rtmp listener")
+	}
+}
+
+func TestGetStagePolicies(t *testing.T) {
+	env := map[string]string{
+		"WORKER_STAGE_TIMEOUTS":        "asr=30s, translation=5s",
+		"WORKER_STAGE_RETRIES":         "asr=2",
+		"WORKER_STAGE_FAILURE_RETRIES": "translation=3",
+		"WORKER_STAGE_RETRY_BACKOFF":   "translation=500ms",
+		"WORKER_STAGE_QUEUE_CAPACITY":  "asr=64",
+		"WORKER_STAGE_DROP_POLICY":     "asr=drop-oldest",
+	}
+	policies, err := getStagePolicies(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("parse policies: %v", err)
+	}
+	want := map[string]pipelinepkg.StagePolicy{
+		"asr":         {Timeout: 30 * time.Second, Retries: 2, Capacity: 64, Drop: pipelinepkg.DropOldest},
+		"translation": {Timeout: 5 * time.Second, Retry: pipelinepkg.RetryPolicy{Attempts: 3, Backoff: 500 * time.Millisecond}},
+	}
+	if !reflect.DeepEqual(policies, want) {
+		t.Fatalf("expected %v, got %v", want, policies)
+	}
+
+	for _, tc := range [][2]string{
+		{"WORKER_STAGE_TIMEOUTS", "asr=soon"},
+		{"WORKER_STAGE_TIMEOUTS", "asr=-1s"},
+		{"WORKER_STAGE_TIMEOUTS", "media=1s"},
+		{"WORKER_STAGE_RETRIES", "asr=-1"},
+		{"WORKER_STAGE_FAILURE_RETRIES", "translation=many"},
+		{"WORKER_STAGE_RETRY_BACKOFF", "translation=0s"},
+		{"WORKER_STAGE_QUEUE_CAPACITY", "asr=0"},
+		{"WORKER_STAGE_DROP_POLICY", "asr=drop-all"},
+	} {
+		getenv := func(key string) string {
+			if key == tc[0] {
+				return tc[1]
+			}
+			return ""
+		}
+		if _, err := getStagePolicies(getenv); err == nil {
+			t.Fatalf("expected %s=%q to be rejected", tc[0], tc[1])
+		}
+	}
+}
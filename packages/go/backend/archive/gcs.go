@@ -0,0 +1,145 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"streamlation/packages/backend/cloudauth"
+)
+
+// Defaults of GCSConfig.
+const (
+	// DefaultGCSEndpoint is Google Cloud Storage's JSON API.
+	DefaultGCSEndpoint = "https://storage.googleapis.com"
+	// DefaultGCSTokenURL is the metadata server's endpoint for the access
+	// token of the instance's default service account.
+	DefaultGCSTokenURL = cloudauth.DefaultGCPTokenURL
+)
+
+// GCSConfig configures a GCSStore. Zero values fall back to the defaults.
+type GCSConfig struct {
+	// Bucket holds the objects.
+	Bucket string
+	// Prefix is prepended to every key, such as "streamlation/".
+	Prefix string
+	// Endpoint is the base URL of the JSON API. Defaults to
+	// DefaultGCSEndpoint.
+	Endpoint string
+	// AccessToken authorizes the requests. When empty, tokens are issued
+	// for the service account key in CredentialsFile, or else fetched from
+	// TokenURL, and renewed before they expire.
+	AccessToken     string
+	CredentialsFile string
+	// TokenURL serves access tokens the way the metadata server of a
+	// Compute Engine instance or a GKE workload does. Defaults to
+	// DefaultGCSTokenURL.
+	TokenURL string
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// GCSStore stores objects in a Google Cloud Storage bucket through its
+// JSON API.
+type GCSStore struct {
+	cfg    GCSConfig
+	tokens *cloudauth.GCPTokenSource
+}
+
+// NewGCSStore returns a store keeping its objects in cfg.Bucket.
+func NewGCSStore(cfg GCSConfig) (*GCSStore, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("gcs bucket required")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultGCSEndpoint
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = DefaultGCSTokenURL
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	tokens := cloudauth.NewGCPTokenSource(cloudauth.GCPConfig{
+		AccessToken:     cfg.AccessToken,
+		CredentialsFile: cfg.CredentialsFile,
+		TokenURL:        cfg.TokenURL,
+		Scope:           cloudauth.GCSReadWriteScope,
+		Client:          cfg.Client,
+	})
+	return &GCSStore{cfg: cfg, tokens: tokens}, nil
+}
+
+// Put uploads the object in a single request.
+func (s *GCSStore) Put(ctx context.Context, key string, body io.Reader) error {
+	if key == "" {
+		return errors.New("object key required")
+	}
+	target := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", s.cfg.Endpoint, url.PathEscape(s.cfg.Bucket), url.QueryEscape(s.cfg.Prefix+key))
+	resp, err := s.do(ctx, http.MethodPost, target, body)
+	if err != nil {
+		return fmt.Errorf("put object %s: %w", key, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("put object %s: %w", key, gcsError(resp))
+	}
+	return nil
+}
+
+// Get downloads the object, or returns ErrNotFound.
+func (s *GCSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if key == "" {
+		return nil, errors.New("object key required")
+	}
+	target := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", s.cfg.Endpoint, url.PathEscape(s.cfg.Bucket), url.PathEscape(s.cfg.Prefix+key))
+	resp, err := s.do(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get object %s: %w", key, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+	case resp.StatusCode/100 != 2:
+		defer func() { _ = resp.Body.Close() }()
+		return nil, fmt.Errorf("get object %s: %w", key, gcsError(resp))
+	}
+	return resp.Body, nil
+}
+
+// do sends an authorized request.
+func (s *GCSStore) do(ctx context.Context, method, target string, body io.Reader) (*http.Response, error) {
+	token, err := s.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	return s.cfg.Client.Do(req)
+}
+
+// gcsError returns the status and the message GCS answered resp with.
+func gcsError(resp *http.Response) error {
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&body); err == nil && body.Error.Message != "" {
+		return fmt.Errorf("%s: %s", resp.Status, body.Error.Message)
+	}
+	return errors.New(resp.Status)
+}
@@ -0,0 +1,87 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGCSStorePutsAndGetsObjects(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	objects := make(map[string]string)
+	tokens := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/token" {
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				http.Error(w, "missing header", http.StatusForbidden)
+				return
+			}
+			tokens++
+			_, _ = io.WriteString(w, `{"access_token":"token","expires_in":3600,"token_type":"Bearer"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, `{"error":{"code":401,"message":"Invalid Credentials"}}`)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/artifacts/o":
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Query().Get("name")] = string(body)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/storage/v1/b/artifacts/o/") && r.URL.Query().Get("alt") == "media":
+			body, ok := objects[strings.TrimPrefix(r.URL.Path, "/storage/v1/b/artifacts/o/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = io.WriteString(w, body)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewGCSStore(GCSConfig{Bucket: "artifacts", Prefix: "streamlation/", Endpoint: server.URL, TokenURL: server.URL + "/token"})
+	if err != nil {
+		t.Fatalf("NewGCSStore: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, "session/subtitles/es.srt", strings.NewReader("hola")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if objects["streamlation/session/subtitles/es.srt"] != "hola" {
+		t.Fatalf("expected the object under the prefix, got %v", objects)
+	}
+	body, err := store.Get(ctx, "session/subtitles/es.srt")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer func() { _ = body.Close() }()
+	if data, _ := io.ReadAll(body); string(data) != "hola" {
+		t.Fatalf("expected the stored object, got %q", data)
+	}
+	if _, err := store.Get(ctx, "session/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if tokens != 1 {
+		t.Fatalf("expected the access token to be fetched once, got %d", tokens)
+	}
+
+	expired, err := NewGCSStore(GCSConfig{Bucket: "artifacts", Endpoint: server.URL, AccessToken: "expired"})
+	if err != nil {
+		t.Fatalf("NewGCSStore: %v", err)
+	}
+	if err := expired.Put(ctx, "session/denied", strings.NewReader("x")); err == nil || !strings.Contains(err.Error(), "Invalid Credentials") {
+		t.Fatalf("expected GCS's error message, got %v", err)
+	}
+}
@@ -0,0 +1,366 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+)
+
+// UndeterminedLanguage keys the subtitles of events that carry no language.
+const UndeterminedLanguage = "und"
+
+// Manifest lists the objects archived for a session. It is stored as
+// "<session>/manifest.json" and rewritten after every flush, so it always
+// describes the objects that were written successfully.
+type Manifest struct {
+	SessionID string    `json:"sessionId"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Complete is set once the session's run completed. A run that failed
+	// or was cancelled leaves it unset, and a later run of the session
+	// appends to the same manifest.
+	Complete    bool          `json:"complete"`
+	Audio       []AudioObject `json:"audio,omitempty"`
+	Transcripts []TextObject  `json:"transcripts,omitempty"`
+	Subtitles   []TextObject  `json:"subtitles,omitempty"`
+}
+
+// AudioObject describes a WAV file of normalized 16-bit PCM audio.
+type AudioObject struct {
+	Key        string        `json:"key"`
+	Start      time.Duration `json:"start"`
+	Duration   time.Duration `json:"duration"`
+	SampleRate int           `json:"sampleRate"`
+	Channels   int           `json:"channels"`
+}
+
+// TextObject describes a JSON Lines file holding one transcript or subtitle
+// event per line.
+type TextObject struct {
+	Key string `json:"key"`
+	// Language is the subtitles' target language. It is empty for
+	// transcripts.
+	Language string        `json:"language,omitempty"`
+	Records  int           `json:"records"`
+	Start    time.Duration `json:"start"`
+	End      time.Duration `json:"end"`
+}
+
+// Recorder archives a session's normalized audio, final source-language
+// transcripts, and final subtitles. The Add methods buffer records in memory
+// and may be called concurrently; Flush writes them to the store as new
+// objects and rewrites the manifest.
+type Recorder struct {
+	store     Store
+	sessionID string
+
+	mu          sync.Mutex
+	audio       []media.AudioChunk
+	transcripts []asr.Transcript
+	subtitles   map[string][]output.SubtitleEvent
+
+	// flushing serialises Flush and Close, which own the manifest.
+	flushing sync.Mutex
+	manifest Manifest
+}
+
+// NewRecorder returns a recorder for the session. When the store already
+// holds a manifest for the session, from an earlier run, the recorder
+// appends to it.
+func NewRecorder(ctx context.Context, store Store, sessionID string) (*Recorder, error) {
+	if store == nil {
+		return nil, errors.New("archive store required")
+	}
+	if sessionID == "" {
+		return nil, errors.New("session id required")
+	}
+	recorder := &Recorder{
+		store:     store,
+		sessionID: sessionID,
+		subtitles: make(map[string][]output.SubtitleEvent),
+		manifest:  Manifest{SessionID: sessionID, StartedAt: time.Now().UTC()},
+	}
+	manifest, err := LoadManifest(ctx, store, sessionID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		return nil, err
+	default:
+		manifest.Complete = false
+		recorder.manifest = manifest
+	}
+	return recorder, nil
+}
+
+// LoadManifest reads the manifest archived for the session. It returns
+// ErrNotFound when nothing was archived for it.
+func LoadManifest(ctx context.Context, store Store, sessionID string) (Manifest, error) {
+	body, err := store.Get(ctx, manifestKey(sessionID))
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer func() { _ = body.Close() }()
+	var manifest Manifest
+	if err := json.NewDecoder(body).Decode(&manifest); err != nil {
+		return Manifest{}, fmt.Errorf("decode manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// AddAudio buffers a chunk of normalized audio.
+func (r *Recorder) AddAudio(chunk media.AudioChunk) {
+	if len(chunk.PCMData) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.audio = append(r.audio, chunk)
+}
+
+// AddTranscript buffers a final transcript. Partial transcripts are
+// ignored.
+func (r *Recorder) AddTranscript(transcript asr.Transcript) {
+	if transcript.Partial {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transcripts = append(r.transcripts, transcript)
+}
+
+// AddSubtitle buffers a final subtitle event. Partial cues and removals are
+// ignored.
+func (r *Recorder) AddSubtitle(event output.SubtitleEvent) {
+	if event.Partial || event.Type == "remove" {
+		return
+	}
+	language := event.Language
+	if language == "" {
+		language = UndeterminedLanguage
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subtitles[language] = append(r.subtitles[language], event)
+}
+
+// Manifest returns a copy of the manifest as of the last flush.
+func (r *Recorder) Manifest() Manifest {
+	r.flushing.Lock()
+	defer r.flushing.Unlock()
+	manifest := r.manifest
+	manifest.Audio = append([]AudioObject(nil), manifest.Audio...)
+	manifest.Transcripts = append([]TextObject(nil), manifest.Transcripts...)
+	manifest.Subtitles = append([]TextObject(nil), manifest.Subtitles...)
+	return manifest
+}
+
+// Flush writes the buffered records and the updated manifest. Audio that
+// fails to upload is discarded rather than held in memory; transcripts and
+// subtitles are kept and retried on the next flush.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.flushing.Lock()
+	defer r.flushing.Unlock()
+	return r.flush(ctx)
+}
+
+// Close flushes the remaining records and marks the manifest complete when
+// complete is set.
+func (r *Recorder) Close(ctx context.Context, complete bool) error {
+	r.flushing.Lock()
+	defer r.flushing.Unlock()
+	if complete {
+		r.manifest.Complete = true
+	}
+	return r.flush(ctx)
+}
+
+func (r *Recorder) flush(ctx context.Context) error {
+	r.mu.Lock()
+	audio, transcripts, subtitles := r.audio, r.transcripts, r.subtitles
+	r.audio, r.transcripts, r.subtitles = nil, nil, make(map[string][]output.SubtitleEvent)
+	r.mu.Unlock()
+
+	var errs []error
+	for _, segment := range splitSegments(audio) {
+		if err := r.putAudio(ctx, segment); err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+	if len(transcripts) > 0 {
+		if err := r.putTranscripts(ctx, transcripts); err != nil {
+			errs = append(errs, err)
+			r.requeue(func() { r.transcripts = append(transcripts, r.transcripts...) })
+		}
+	}
+	for language, events := range subtitles {
+		if err := r.putSubtitles(ctx, language, events); err != nil {
+			errs = append(errs, err)
+			r.requeue(func() { r.subtitles[language] = append(events, r.subtitles[language]...) })
+		}
+	}
+
+	r.manifest.UpdatedAt = time.Now().UTC()
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r.manifest); err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	if err := r.store.Put(ctx, manifestKey(r.sessionID), &buf); err != nil {
+		errs = append(errs, fmt.Errorf("store manifest: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Recorder) requeue(restore func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	restore()
+}
+
+func (r *Recorder) putAudio(ctx context.Context, segment []media.AudioChunk) error {
+	first := segment[0]
+	object := AudioObject{
+		Key:        fmt.Sprintf("%s/audio/%06d.wav", r.sessionID, len(r.manifest.Audio)+1),
+		Start:      first.Timestamp,
+		SampleRate: first.SampleRate,
+		Channels:   first.Channels,
+	}
+	var size int
+	for _, chunk := range segment {
+		size += len(chunk.PCMData)
+		object.Duration += chunk.Duration
+	}
+	var buf bytes.Buffer
+	buf.Grow(wavHeaderSize + size)
+	writeWAVHeader(&buf, object.SampleRate, object.Channels, size)
+	for _, chunk := range segment {
+		buf.Write(chunk.PCMData)
+	}
+	if err := r.store.Put(ctx, object.Key, &buf); err != nil {
+		return fmt.Errorf("store audio: %w", err)
+	}
+	r.manifest.Audio = append(r.manifest.Audio, object)
+	return nil
+}
+
+func (r *Recorder) putTranscripts(ctx context.Context, transcripts []asr.Transcript) error {
+	object := TextObject{
+		Key:     fmt.Sprintf("%s/transcripts/%06d.jsonl", r.sessionID, len(r.manifest.Transcripts)+1),
+		Records: len(transcripts),
+		Start:   transcripts[0].StartTime,
+		End:     transcripts[len(transcripts)-1].EndTime,
+	}
+	records := make([]any, len(transcripts))
+	for i, transcript := range transcripts {
+		records[i] = transcript
+	}
+	if err := r.putLines(ctx, object.Key, records); err != nil {
+		return fmt.Errorf("store transcripts: %w", err)
+	}
+	r.manifest.Transcripts = append(r.manifest.Transcripts, object)
+	return nil
+}
+
+func (r *Recorder) putSubtitles(ctx context.Context, language string, events []output.SubtitleEvent) error {
+	part := 1
+	for _, object := range r.manifest.Subtitles {
+		if object.Language == language {
+			part++
+		}
+	}
+	object := TextObject{
+		Key:      fmt.Sprintf("%s/subtitles/%s/%06d.jsonl", r.sessionID, language, part),
+		Language: language,
+		Records:  len(events),
+		Start:    events[0].StartTime,
+		End:      events[len(events)-1].EndTime,
+	}
+	records := make([]any, len(events))
+	for i, event := range events {
+		records[i] = event
+	}
+	if err := r.putLines(ctx, object.Key, records); err != nil {
+		return fmt.Errorf("store %s subtitles: %w", language, err)
+	}
+	r.manifest.Subtitles = append(r.manifest.Subtitles, object)
+	return nil
+}
+
+// putLines stores records as JSON Lines.
+func (r *Recorder) putLines(ctx context.Context, key string, records []any) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("marshal record: %w", err)
+		}
+	}
+	return r.store.Put(ctx, key, &buf)
+}
+
+// splitSegments groups consecutive chunks that share an audio format, since
+// a WAV file holds a single format.
+func splitSegments(chunks []media.AudioChunk) [][]media.AudioChunk {
+	var segments [][]media.AudioChunk
+	for i, chunk := range chunks {
+		if i == 0 || chunk.SampleRate != chunks[i-1].SampleRate || chunk.Channels != chunks[i-1].Channels {
+			segments = append(segments, nil)
+		}
+		segments[len(segments)-1] = append(segments[len(segments)-1], chunk)
+	}
+	return segments
+}
+
+const wavHeaderSize = 44
+
+// writeWAVHeader writes the RIFF header of a 16-bit PCM WAV file holding
+// size bytes of samples.
+func writeWAVHeader(w io.Writer, sampleRate, channels, size int) {
+	blockAlign := channels * 2
+	header := struct {
+		RIFF          [4]byte
+		ChunkSize     uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     uint32(wavHeaderSize - 8 + size),
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		Format:        1,
+		Channels:      uint16(channels),
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * blockAlign),
+		BlockAlign:    uint16(blockAlign),
+		BitsPerSample: 16,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      uint32(size),
+	}
+	_ = binary.Write(w, binary.LittleEndian, header)
+}
+
+func manifestKey(sessionID string) string {
+	return sessionID + "/manifest.json"
+}
@@ -0,0 +1,193 @@
+package archive
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+)
+
+// failingStore rejects every write under keys containing fail.
+type failingStore struct {
+	Store
+	fail string
+}
+
+func (s *failingStore) Put(ctx context.Context, key string, body io.Reader) error {
+	if strings.Contains(key, s.fail) {
+		return errors.New("bucket unavailable")
+	}
+	return s.Store.Put(ctx, key, body)
+}
+
+func newTestStore(t *testing.T) *FileStore {
+	t.Helper()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	return store
+}
+
+func readObject(t *testing.T, store Store, key string) []byte {
+	t.Helper()
+	body, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	defer func() { _ = body.Close() }()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return data
+}
+
+func TestRecorderWritesObjectsAndManifest(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := newTestStore(t)
+	recorder, err := NewRecorder(ctx, store, "session123")
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+
+	recorder.AddAudio(media.AudioChunk{Timestamp: time.Second, SampleRate: 16000, Channels: 1, PCMData: []byte{1, 0, 2, 0}, Duration: 100 * time.Millisecond})
+	recorder.AddAudio(media.AudioChunk{Timestamp: 1100 * time.Millisecond, SampleRate: 16000, Channels: 1, PCMData: []byte{3, 0}, Duration: 100 * time.Millisecond})
+	recorder.AddAudio(media.AudioChunk{Timestamp: 1200 * time.Millisecond, SampleRate: 48000, Channels: 2, PCMData: []byte{4, 0, 5, 0}, Duration: 100 * time.Millisecond})
+	recorder.AddTranscript(asr.Transcript{Text: "hello", Partial: true})
+	recorder.AddTranscript(asr.Transcript{Text: "hello world", StartTime: time.Second, EndTime: 2 * time.Second})
+	recorder.AddSubtitle(output.SubtitleEvent{Type: "add", Index: 1, Text: "hola", Partial: true, Language: "es"})
+	recorder.AddSubtitle(output.SubtitleEvent{Type: "update", Index: 1, Text: "hola mundo", Language: "es"})
+	recorder.AddSubtitle(output.SubtitleEvent{Type: "remove", Index: 1, Language: "es"})
+	recorder.AddSubtitle(output.SubtitleEvent{Type: "add", Index: 1, Text: "bonjour"})
+	if err := recorder.Close(ctx, true); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	manifest, err := LoadManifest(ctx, store, "session123")
+	if err != nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	if !manifest.Complete || manifest.SessionID != "session123" {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+	if len(manifest.Audio) != 2 {
+		t.Fatalf("expected a WAV file per audio format, got %+v", manifest.Audio)
+	}
+	first := manifest.Audio[0]
+	if first.Key != "session123/audio/000001.wav" || first.Start != time.Second || first.Duration != 200*time.Millisecond || first.SampleRate != 16000 {
+		t.Fatalf("unexpected audio object %+v", first)
+	}
+	wav := readObject(t, store, first.Key)
+	if string(wav[:4]) != "RIFF" || string(wav[8:12]) != "WAVE" || binary.LittleEndian.Uint32(wav[24:]) != 16000 || binary.LittleEndian.Uint32(wav[40:]) != 6 || len(wav) != wavHeaderSize+6 {
+		t.Fatalf("unexpected WAV file % x", wav)
+	}
+
+	if len(manifest.Transcripts) != 1 || manifest.Transcripts[0].Records != 1 {
+		t.Fatalf("expected only the final transcript to be archived, got %+v", manifest.Transcripts)
+	}
+	var transcript asr.Transcript
+	if err := json.Unmarshal(readObject(t, store, manifest.Transcripts[0].Key), &transcript); err != nil || transcript.Text != "hello world" {
+		t.Fatalf("unexpected transcript %+v (%v)", transcript, err)
+	}
+
+	subtitles := make(map[string]TextObject)
+	for _, object := range manifest.Subtitles {
+		subtitles[object.Language] = object
+	}
+	if object := subtitles["es"]; object.Key != "session123/subtitles/es/000001.jsonl" || object.Records != 1 {
+		t.Fatalf("expected only the final es cue to be archived, got %+v", object)
+	}
+	if object := subtitles[UndeterminedLanguage]; object.Records != 1 {
+		t.Fatalf("expected cues without a language to be archived as %s, got %+v", UndeterminedLanguage, manifest.Subtitles)
+	}
+}
+
+func TestRecorderResumesManifestAndRetriesText(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	files := newTestStore(t)
+	store := &failingStore{Store: files, fail: "transcripts"}
+	recorder, err := NewRecorder(ctx, store, "session123")
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+	recorder.AddAudio(media.AudioChunk{SampleRate: 16000, Channels: 1, PCMData: []byte{1, 0}, Duration: time.Millisecond})
+	recorder.AddTranscript(asr.Transcript{Text: "first"})
+	if err := recorder.Close(ctx, false); err == nil || !strings.Contains(err.Error(), "bucket unavailable") {
+		t.Fatalf("expected the transcript write to fail, got %v", err)
+	}
+
+	// A later run of the session appends to the manifest of the first.
+	store.fail = "nothing"
+	recorder, err = NewRecorder(ctx, store, "session123")
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+	recorder.AddAudio(media.AudioChunk{SampleRate: 16000, Channels: 1, PCMData: []byte{2, 0}, Duration: time.Millisecond})
+	recorder.AddTranscript(asr.Transcript{Text: "second"})
+	if err := recorder.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	manifest := recorder.Manifest()
+	if manifest.Complete || len(manifest.Audio) != 2 || manifest.Audio[1].Key != "session123/audio/000002.wav" {
+		t.Fatalf("expected the audio numbering to continue, got %+v", manifest)
+	}
+	if len(manifest.Transcripts) != 1 {
+		t.Fatalf("expected one transcript part, got %+v", manifest.Transcripts)
+	}
+
+	// Text that failed to upload is retried on the next flush.
+	store.fail = "transcripts"
+	recorder.AddTranscript(asr.Transcript{Text: "third"})
+	if err := recorder.Flush(ctx); err == nil {
+		t.Fatal("expected the transcript write to fail")
+	}
+	store.fail = "nothing"
+	recorder.AddTranscript(asr.Transcript{Text: "fourth"})
+	if err := recorder.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	manifest = recorder.Manifest()
+	if len(manifest.Transcripts) != 2 || manifest.Transcripts[1].Records != 2 {
+		t.Fatalf("expected the failed transcript to be retried, got %+v", manifest.Transcripts)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(readObject(t, files, manifest.Transcripts[1].Key))))
+	var texts []string
+	for scanner.Scan() {
+		var transcript asr.Transcript
+		if err := json.Unmarshal(scanner.Bytes(), &transcript); err != nil {
+			t.Fatalf("decode transcript: %v", err)
+		}
+		texts = append(texts, transcript.Text)
+	}
+	if strings.Join(texts, ",") != "third,fourth" {
+		t.Fatalf("expected transcripts in order, got %v", texts)
+	}
+}
+
+func TestFileStoreRejectsKeysOutsideRoot(t *testing.T) {
+	t.Parallel()
+
+	store := newTestStore(t)
+	for _, key := range []string{"", "/etc/passwd", "../escape", "a/../../b", "a//b"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x")); err == nil {
+			t.Fatalf("expected key %q to be rejected", key)
+		}
+	}
+	if _, err := store.Get(context.Background(), "missing/manifest.json"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
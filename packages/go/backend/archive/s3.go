@@ -0,0 +1,172 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"streamlation/packages/backend/cloudauth"
+)
+
+// DefaultS3Region is the region of an S3Store whose config names none.
+const DefaultS3Region = "us-east-1"
+
+// S3Config configures an S3Store. Zero values fall back to the defaults.
+type S3Config struct {
+	// Bucket holds the objects.
+	Bucket string
+	// Prefix is prepended to every key, such as "streamlation/".
+	Prefix string
+	// Region is the bucket's region. Defaults to DefaultS3Region.
+	Region string
+	// Endpoint is the base URL of an S3-compatible service, such as
+	// "http://minio:9000". Defaults to AWS's endpoint for the region.
+	Endpoint string
+	// PathStyle addresses the bucket in the path instead of the host name,
+	// as most S3-compatible services other than AWS expect.
+	PathStyle bool
+	// AccessKeyID and SecretAccessKey sign the requests, along with
+	// SessionToken for temporary credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// RoleARN is assumed with the web identity token in
+	// WebIdentityTokenFile when no static credentials are set, as IRSA
+	// configures them. RoleSessionName and STSEndpoint default as in
+	// cloudauth.AWSConfig.
+	RoleARN              string
+	WebIdentityTokenFile string
+	RoleSessionName      string
+	STSEndpoint          string
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// S3Store stores objects in an Amazon S3 bucket, or in the bucket of a
+// service that speaks its API, signing requests with AWS Signature
+// Version 4. Objects are buffered in memory to sign their payload.
+type S3Store struct {
+	cfg         S3Config
+	endpoint    *url.URL
+	credentials *cloudauth.AWSCredentialProvider
+	now         func() time.Time
+}
+
+// NewS3Store returns a store keeping its objects in cfg.Bucket.
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 bucket required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = DefaultS3Region
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	credentials := cloudauth.NewAWSCredentialProvider(cloudauth.AWSConfig{
+		AccessKeyID:          cfg.AccessKeyID,
+		SecretAccessKey:      cfg.SecretAccessKey,
+		SessionToken:         cfg.SessionToken,
+		RoleARN:              cfg.RoleARN,
+		WebIdentityTokenFile: cfg.WebIdentityTokenFile,
+		RoleSessionName:      cfg.RoleSessionName,
+		STSEndpoint:          cfg.STSEndpoint,
+		Region:               cfg.Region,
+		Client:               cfg.Client,
+	})
+	if !credentials.Configured() {
+		return nil, errors.New("s3 credentials required")
+	}
+	return &S3Store{cfg: cfg, endpoint: endpoint, credentials: credentials, now: time.Now}, nil
+}
+
+// Put uploads the object in a single request.
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("read object %s: %w", key, err)
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return fmt.Errorf("put object %s: %w", key, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("put object %s: %w", key, s3Error(resp))
+	}
+	return nil
+}
+
+// Get downloads the object, or returns ErrNotFound.
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get object %s: %w", key, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+	case resp.StatusCode/100 != 2:
+		defer func() { _ = resp.Body.Close() }()
+		return nil, fmt.Errorf("get object %s: %w", key, s3Error(resp))
+	}
+	return resp.Body, nil
+}
+
+// do sends a signed request for the object under key.
+func (s *S3Store) do(ctx context.Context, method, key string, payload []byte) (*http.Response, error) {
+	if key == "" {
+		return nil, errors.New("object key required")
+	}
+	target := *s.endpoint
+	object := "/" + s.cfg.Prefix + key
+	if s.cfg.PathStyle {
+		target.Path = strings.TrimSuffix(target.Path, "/") + "/" + s.cfg.Bucket + object
+	} else {
+		target.Host = s.cfg.Bucket + "." + target.Host
+		target.Path = strings.TrimSuffix(target.Path, "/") + object
+	}
+	target.RawPath = cloudauth.URIEncode(target.Path, false)
+
+	credentials, err := s.credentials.Credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		req.Body, req.ContentLength = http.NoBody, 0
+	}
+	sum := sha256.Sum256(payload)
+	cloudauth.SignV4(req, *credentials, s.cfg.Region, "s3", hex.EncodeToString(sum[:]), s.now())
+	return s.cfg.Client.Do(req)
+}
+
+// s3Error returns the status and the error code S3 answered resp with.
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if start := bytes.Index(body, []byte("<Code>")); start >= 0 {
+		if end := bytes.Index(body[start:], []byte("</Code>")); end >= 0 {
+			return fmt.Errorf("%s: %s", resp.Status, body[start+len("<Code>"):start+end])
+		}
+	}
+	return errors.New(resp.Status)
+}
@@ -0,0 +1,166 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestS3StorePutsAndGetsObjects(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	objects := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") || r.Header.Get("X-Amz-Security-Token") != "token" {
+			http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.EscapedPath()] = string(body)
+		case http.MethodGet:
+			body, ok := objects[r.URL.EscapedPath()]
+			if !ok {
+				http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+				return
+			}
+			_, _ = io.WriteString(w, body)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewS3Store(S3Config{
+		Bucket:          "artifacts",
+		Prefix:          "streamlation/",
+		Endpoint:        server.URL,
+		PathStyle:       true,
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, "session/subtitles/es la.srt", strings.NewReader("hola")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, ok := objects["/artifacts/streamlation/session/subtitles/es%20la.srt"]; !ok {
+		t.Fatalf("expected the object under the bucket and prefix, got %v", objects)
+	}
+	body, err := store.Get(ctx, "session/subtitles/es la.srt")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer func() { _ = body.Close() }()
+	if data, _ := io.ReadAll(body); string(data) != "hola" {
+		t.Fatalf("expected the stored object, got %q", data)
+	}
+	if _, err := store.Get(ctx, "session/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	unsigned, err := NewS3Store(S3Config{
+		Bucket:          "artifacts",
+		Endpoint:        server.URL,
+		PathStyle:       true,
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	if err := unsigned.Put(ctx, "session/denied", strings.NewReader("x")); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Fatalf("expected S3's error code, got %v", err)
+	}
+}
+
+func TestS3StoreAssumesWebIdentityRole(t *testing.T) {
+	t.Parallel()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("web-identity\n"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	var assumed atomic.Int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("/sts", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("Action") != "AssumeRoleWithWebIdentity" || r.FormValue("WebIdentityToken") != "web-identity" || r.FormValue("RoleArn") != "arn:aws:iam::1:role/worker" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assumed.Add(1)
+		fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIATEMP</AccessKeyId><SecretAccessKey>temp</SecretAccessKey><SessionToken>irsa</SessionToken>
+<Expiration>%s</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	})
+	handler.HandleFunc("/artifacts/", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential=ASIATEMP/") || r.Header.Get("X-Amz-Security-Token") != "irsa" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	if _, err := NewS3Store(S3Config{Bucket: "artifacts", RoleARN: "arn:aws:iam::1:role/worker"}); err == nil {
+		t.Fatal("expected a role without a web identity token to be rejected")
+	}
+	store, err := NewS3Store(S3Config{
+		Bucket:               "artifacts",
+		Endpoint:             server.URL,
+		PathStyle:            true,
+		RoleARN:              "arn:aws:iam::1:role/worker",
+		WebIdentityTokenFile: tokenFile,
+		STSEndpoint:          server.URL + "/sts",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	for _, key := range []string{"session/a.srt", "session/b.srt"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x")); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+	if assumed.Load() != 1 {
+		t.Fatalf("expected the role to be assumed once, got %d", assumed.Load())
+	}
+}
+
+func TestOpenStoreSelectsBackends(t *testing.T) {
+	t.Parallel()
+
+	for backend, want := range map[string]any{"file": &FileStore{}, "s3": &S3Store{}, "gcs": &GCSStore{}} {
+		store, err := OpenStore(StoreConfig{
+			Backend: backend,
+			Dir:     t.TempDir(),
+			S3:      S3Config{Bucket: "artifacts", AccessKeyID: "key", SecretAccessKey: "secret"},
+			GCS:     GCSConfig{Bucket: "artifacts"},
+		})
+		if err != nil {
+			t.Fatalf("OpenStore(%s): %v", backend, err)
+		}
+		if reflect.TypeOf(store) != reflect.TypeOf(want) {
+			t.Fatalf("expected a %T for %s, got %T", want, backend, store)
+		}
+	}
+	if _, err := OpenStore(StoreConfig{Backend: "ftp"}); err == nil {
+		t.Fatal("expected an unknown backend to be rejected")
+	}
+}
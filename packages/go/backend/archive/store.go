@@ -0,0 +1,132 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"streamlation/packages/backend/output"
+)
+
+// ErrNotFound is returned by Store.Get when no object exists under a key.
+// It is output.ErrArtifactNotFound, so that stores serve as artifact
+// stores.
+var ErrNotFound = output.ErrArtifactNotFound
+
+var (
+	_ output.ArtifactStore = (*FileStore)(nil)
+	_ output.ArtifactStore = (*S3Store)(nil)
+	_ output.ArtifactStore = (*GCSStore)(nil)
+)
+
+// Store is an object storage backend. Keys are slash-separated paths such as
+// "session123/manifest.json". Put replaces any existing object under the key.
+type Store interface {
+	Put(ctx context.Context, key string, body io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// FileStore stores objects as files below a root directory, such as a
+// mounted bucket or a volume that is synchronised to one.
+type FileStore struct {
+	root string
+}
+
+// NewFileStore creates the root directory if needed and returns a store
+// that keeps its objects below it.
+func NewFileStore(root string) (*FileStore, error) {
+	if root == "" {
+		return nil, errors.New("archive root required")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("create archive root: %w", err)
+	}
+	return &FileStore{root: root}, nil
+}
+
+// Put writes the object to a temporary file and renames it into place, so
+// readers never observe a partially written object.
+func (s *FileStore) Put(ctx context.Context, key string, body io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("create object directory: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(name), ".put-*")
+	if err != nil {
+		return fmt.Errorf("create object: %w", err)
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+	if _, err := io.Copy(file, body); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("write object %s: %w", key, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("write object %s: %w", key, err)
+	}
+	if err := os.Rename(file.Name(), name); err != nil {
+		return fmt.Errorf("store object %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open object %s: %w", key, err)
+	}
+	return file, nil
+}
+
+// path maps key to a file below the root, rejecting keys that would escape
+// it.
+func (s *FileStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// StoreConfig selects and configures a Store.
+type StoreConfig struct {
+	// Backend is "file", "s3", or "gcs".
+	Backend string
+	// Dir is the root directory of the "file" backend.
+	Dir string
+	S3  S3Config
+	GCS GCSConfig
+}
+
+// OpenStore returns the store of the backend cfg selects.
+func OpenStore(cfg StoreConfig) (Store, error) {
+	switch cfg.Backend {
+	case "file":
+		return NewFileStore(cfg.Dir)
+	case "s3":
+		return NewS3Store(cfg.S3)
+	case "gcs":
+		return NewGCSStore(cfg.GCS)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,148 @@
+package asr
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+// Defaults of BatcherConfig.
+const (
+	DefaultMaxBatch     = 8
+	DefaultMaxBatchWait = 50 * time.Millisecond
+)
+
+// BatchRequest is one session's window of audio in an inference batch.
+type BatchRequest struct {
+	SessionID string
+	// Model, Language, and Prompt are the decoding settings of the
+	// request. Only requests that agree on them share a batch.
+	Model    string
+	Language string
+	Prompt   string
+	// Audio is the audio to transcribe. Speech in its first Skip, which was
+	// transcribed before, and from Length on, which is padding, is dropped.
+	Audio        media.AudioChunk
+	Skip, Length time.Duration
+}
+
+// BatchBackend runs inference on batches of audio, such as a GPU-backed
+// model that transcribes many windows in about the time it takes for one.
+type BatchBackend interface {
+	// RecognizeBatch transcribes every request and returns the transcripts
+	// of each, in the order of requests.
+	RecognizeBatch(ctx context.Context, requests []BatchRequest) ([][]Transcript, error)
+}
+
+// BatcherConfig configures a Batcher. Zero values fall back to the
+// defaults.
+type BatcherConfig struct {
+	Backend BatchBackend
+	// MaxBatch bounds the requests in one batch. Defaults to
+	// DefaultMaxBatch.
+	MaxBatch int
+	// MaxWait is the longest the first request of a batch waits for others
+	// to join it. Defaults to DefaultMaxBatchWait.
+	MaxWait time.Duration
+}
+
+// Batcher aggregates the requests of concurrent sessions into batches for
+// its backend. A batch runs once it holds MaxBatch requests or its first
+// request has waited MaxWait, whichever comes first, so many sessions
+// that each send a little audio keep the backend busy with full batches,
+// while a lone session waits at most MaxWait longer. A Batcher is safe for
+// concurrent use.
+type Batcher struct {
+	cfg BatcherConfig
+
+	mu      sync.Mutex
+	pending map[batchKey]*batch
+}
+
+// batchKey holds the decoding settings requests must agree on to share a
+// batch.
+type batchKey struct {
+	model, language, prompt string
+}
+
+type batch struct {
+	requests []BatchRequest
+	results  []chan batchResult
+	timer    *time.Timer
+}
+
+type batchResult struct {
+	transcripts []Transcript
+	err         error
+}
+
+// NewBatcher returns a batcher running the batches of cfg.Backend.
+func NewBatcher(cfg BatcherConfig) *Batcher {
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = DefaultMaxBatch
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = DefaultMaxBatchWait
+	}
+	return &Batcher{cfg: cfg, pending: make(map[batchKey]*batch)}
+}
+
+// Recognize adds request to the next batch with its decoding settings and
+// returns its transcripts once the batch ran. A batch that fails fails
+// every request in it. Cancelling ctx stops the wait, not the batch, which
+// other sessions share.
+func (b *Batcher) Recognize(ctx context.Context, request BatchRequest) ([]Transcript, error) {
+	key := batchKey{model: request.Model, language: request.Language, prompt: request.Prompt}
+	result := make(chan batchResult, 1)
+
+	b.mu.Lock()
+	pending := b.pending[key]
+	if pending == nil {
+		pending = &batch{}
+		b.pending[key] = pending
+		pending.timer = time.AfterFunc(b.cfg.MaxWait, func() { b.run(key, pending) })
+	}
+	pending.requests = append(pending.requests, request)
+	pending.results = append(pending.results, result)
+	full := len(pending.requests) >= b.cfg.MaxBatch
+	if full {
+		delete(b.pending, key)
+	}
+	b.mu.Unlock()
+	// A timer that already fired runs the batch itself.
+	if full && pending.timer.Stop() {
+		go b.run(key, pending)
+	}
+
+	select {
+	case result := <-result:
+		return result.transcripts, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run takes pending from the batches that accept requests, runs it, and
+// hands each request its result.
+func (b *Batcher) run(key batchKey, pending *batch) {
+	b.mu.Lock()
+	if b.pending[key] == pending {
+		delete(b.pending, key)
+	}
+	b.mu.Unlock()
+
+	transcripts, err := b.cfg.Backend.RecognizeBatch(context.Background(), pending.requests)
+	if err == nil && len(transcripts) != len(pending.requests) {
+		err = fmt.Errorf("recognize batch: %d results for %d requests", len(transcripts), len(pending.requests))
+	}
+	for i, result := range pending.results {
+		if err != nil {
+			result <- batchResult{err: err}
+			continue
+		}
+		result <- batchResult{transcripts: transcripts[i]}
+	}
+}
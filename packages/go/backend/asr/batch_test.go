@@ -0,0 +1,80 @@
+package asr
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingBackend transcribes each request as its session ID and records
+// the sessions of every batch.
+type recordingBackend struct {
+	mu      sync.Mutex
+	batches [][]string
+	err     error
+}
+
+func (r *recordingBackend) RecognizeBatch(_ context.Context, requests []BatchRequest) ([][]Transcript, error) {
+	sessions := make([]string, len(requests))
+	results := make([][]Transcript, len(requests))
+	for i, request := range requests {
+		sessions[i] = request.SessionID
+		results[i] = []Transcript{{SessionID: request.SessionID, Text: request.SessionID}}
+	}
+	sort.Strings(sessions)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, sessions)
+	return results, r.err
+}
+
+func TestBatcherGroupsRequestsBySettings(t *testing.T) {
+	t.Parallel()
+
+	backend := &recordingBackend{}
+	batcher := NewBatcher(BatcherConfig{Backend: backend, MaxBatch: 2, MaxWait: 20 * time.Millisecond})
+
+	var wg sync.WaitGroup
+	for _, request := range []BatchRequest{
+		{SessionID: "a", Language: "en"},
+		{SessionID: "b", Language: "en"},
+		{SessionID: "c", Language: "es"},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			transcripts, err := batcher.Recognize(context.Background(), request)
+			if err != nil || len(transcripts) != 1 || transcripts[0].Text != request.SessionID {
+				t.Errorf("unexpected result for %s: %+v, %v", request.SessionID, transcripts, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The English requests fill a batch; the Spanish one runs alone once
+	// it has waited.
+	sort.Slice(backend.batches, func(i, j int) bool { return backend.batches[i][0] < backend.batches[j][0] })
+	if want := [][]string{{"a", "b"}, {"c"}}; !reflect.DeepEqual(backend.batches, want) {
+		t.Fatalf("expected batches %v, got %v", want, backend.batches)
+	}
+}
+
+func TestBatcherFailsEveryRequestOfAFailedBatch(t *testing.T) {
+	t.Parallel()
+
+	backend := &recordingBackend{err: errors.New("out of memory")}
+	batcher := NewBatcher(BatcherConfig{Backend: backend, MaxWait: time.Millisecond})
+	if _, err := batcher.Recognize(context.Background(), BatchRequest{SessionID: "a"}); err == nil {
+		t.Fatal("expected the batch failure")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewBatcher(BatcherConfig{Backend: &recordingBackend{}, MaxWait: time.Minute}).Recognize(ctx, BatchRequest{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the wait to end with ctx, got %v", err)
+	}
+}
@@ -0,0 +1,276 @@
+package asr
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/media"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// GRPCRecognizePath is the gRPC method a GRPCRecognizer calls.
+const GRPCRecognizePath = "/streamlation.asr.v1.StreamingRecognizer/Recognize"
+
+// DefaultGRPCConnectTimeout bounds how long NewGRPCClient takes to
+// establish a connection.
+const DefaultGRPCConnectTimeout = 10 * time.Second
+
+// gRPC status codes after which a new stream may succeed.
+const (
+	grpcDeadlineExceeded  = 4
+	grpcResourceExhausted = 8
+	grpcUnavailable       = 14
+)
+
+// GRPCConfig configures a GRPCRecognizer.
+type GRPCConfig struct {
+	// Endpoint is the https URL of the recognition service, such as
+	// https://asr.internal:50051.
+	Endpoint string
+	// Client carries the streams. Recognizers that share a client share its
+	// connections; it defaults to a client of its own from NewGRPCClient.
+	// Services without TLS need a client whose transport speaks HTTP/2 in
+	// cleartext.
+	Client *http.Client
+	// Metadata is sent with every stream, such as an authorization header.
+	Metadata map[string]string
+	// Language is the spoken language as an ISO 639-1 code. Empty lets the
+	// service detect it. A session's LanguageLock takes precedence for the
+	// streams opened once it is set.
+	Language string
+}
+
+// GRPCRecognizer transcribes audio with an external recognition service,
+// such as a Python Whisper or RIVA server, over the bidirectional gRPC
+// streaming protocol described in grpc_wire.go. Each session opens one
+// stream, which starts with the session's configuration and then carries
+// its audio as it arrives, while transcripts flow back on the same stream.
+//
+// Sending is paced by HTTP/2 flow control: when the service falls behind,
+// writes block and the recognizer stops reading audio, so the queue of the
+// stage before it fills up. The stream ends when the audio does and the
+// service closes its side. A stream that fails ends the output with
+// ASR_RECOGNITION_FAILED, reported through statuspkg.ReportStageError and
+// marked retryable when the service was unreachable or overloaded.
+type GRPCRecognizer struct {
+	cfg GRPCConfig
+	url string
+
+	mu      sync.RWMutex
+	profile ModelProfile
+	loaded  bool
+	lastErr error
+}
+
+// NewGRPCClient returns an HTTP/2 client for GRPCRecognizers. The streams of
+// every recognizer sharing it are multiplexed over one connection per
+// endpoint, which is re-established on demand after it fails. tlsConfig
+// may be nil.
+func NewGRPCClient(tlsConfig *tls.Config, connectTimeout time.Duration) *http.Client {
+	if connectTimeout <= 0 {
+		connectTimeout = DefaultGRPCConnectTimeout
+	}
+	return &http.Client{Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: connectTimeout,
+		ForceAttemptHTTP2:   true,
+		IdleConnTimeout:     90 * time.Second,
+	}}
+}
+
+// NewGRPCRecognizer returns a recognizer streaming to cfg.Endpoint.
+func NewGRPCRecognizer(cfg GRPCConfig) (*GRPCRecognizer, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "https" && endpoint.Scheme != "http") {
+		return nil, fmt.Errorf("invalid recognition endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Client == nil {
+		cfg.Client = NewGRPCClient(nil, 0)
+	}
+	return &GRPCRecognizer{cfg: cfg, url: strings.TrimSuffix(endpoint.String(), "/") + GRPCRecognizePath}, nil
+}
+
+// LoadModel selects the model profile the service is asked to use for the
+// streams opened from now on. The service loads the model itself.
+func (g *GRPCRecognizer) LoadModel(profile ModelProfile) error {
+	if profile == "" {
+		return errors.New("model profile required")
+	}
+	g.mu.Lock()
+	g.profile, g.loaded = profile, true
+	g.mu.Unlock()
+	return nil
+}
+
+// Recognize opens a stream for the session and transcribes the audio from
+// chunks over it.
+func (g *GRPCRecognizer) Recognize(ctx context.Context, sessionID string, chunks <-chan media.AudioChunk) (<-chan Transcript, error) {
+	return g.recognize(ctx, sessionID, chunks, false)
+}
+
+// RecognizePartial behaves like Recognize, and also asks the service for
+// interim results, which are stabilized by policy.
+func (g *GRPCRecognizer) RecognizePartial(ctx context.Context, sessionID string, chunks <-chan media.AudioChunk, policy StabilizationPolicy) (<-chan Transcript, error) {
+	transcripts, err := g.recognize(ctx, sessionID, chunks, true)
+	if err != nil {
+		return nil, err
+	}
+	return Stabilize(ctx, transcripts, policy), nil
+}
+
+func (g *GRPCRecognizer) recognize(ctx context.Context, sessionID string, chunks <-chan media.AudioChunk, interim bool) (<-chan Transcript, error) {
+	g.mu.RLock()
+	profile := g.profile
+	g.mu.RUnlock()
+	language := sessionLanguage(ctx, g.cfg.Language)
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	body, requests := io.Pipe()
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodPost, g.url, body)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("create recognition stream: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	for key, value := range g.cfg.Metadata {
+		req.Header.Set(key, value)
+	}
+
+	go func() {
+		// Unblock a pending write once the stream is torn down.
+		defer func() { _ = requests.CloseWithError(streamCtx.Err()) }()
+		if err := writeGRPCMessage(requests, encodeConfigRequest(sessionID, profile, language, interim, sessionVocabulary(ctx))); err != nil {
+			return
+		}
+		statuspkg.RecordUsage(ctx, statuspkg.ProviderUsage{Stage: "asr", Provider: "grpc", Requests: 1})
+		for {
+			select {
+			case <-streamCtx.Done():
+				return
+			case chunk, ok := <-chunks:
+				if !ok {
+					_ = requests.Close()
+					<-streamCtx.Done()
+					return
+				}
+				if len(chunk.PCMData) == 0 {
+					continue
+				}
+				msg := encodeAudioRequest(chunk.PCMData, chunk.Timestamp.Milliseconds(), chunk.SampleRate, chunk.Channels)
+				if err := writeGRPCMessage(requests, msg); err != nil {
+					return
+				}
+				if frameSize := 2 * chunk.Channels; frameSize > 0 && chunk.SampleRate > 0 {
+					length := time.Duration(len(chunk.PCMData)/frameSize) * time.Second / time.Duration(chunk.SampleRate)
+					statuspkg.RecordUsage(ctx, statuspkg.ProviderUsage{Stage: "asr", Provider: "grpc", AudioMs: length.Milliseconds()})
+				}
+			}
+		}
+	}()
+
+	out := make(chan Transcript)
+	go func() {
+		defer close(out)
+		defer cancel()
+		err := g.receive(streamCtx, req, sessionID, language, out)
+		g.mu.Lock()
+		g.lastErr = err
+		g.mu.Unlock()
+		if err != nil && ctx.Err() == nil {
+			statuspkg.ReportStageError(ctx, err)
+		}
+	}()
+	return out, nil
+}
+
+// receive sends req and forwards the transcripts the service streams back
+// until the service ends the stream.
+func (g *GRPCRecognizer) receive(ctx context.Context, req *http.Request, sessionID, language string, out chan<- Transcript) error {
+	resp, err := g.cfg.Client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return &statuspkg.StageError{Code: statuspkg.CodeASRFailed, Retryable: true, Err: fmt.Errorf("open recognition stream: %w", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statuspkg.StageError{
+			Code:      statuspkg.CodeASRFailed,
+			Retryable: resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests,
+			Err:       fmt.Errorf("open recognition stream: %s", resp.Status),
+		}
+	}
+	// A service that fails at once answers with its status in the headers.
+	if err := grpcStatus(resp.Header); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := readGRPCMessage(resp.Body)
+		if errors.Is(err, io.EOF) {
+			return grpcStatus(resp.Trailer)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return &statuspkg.StageError{Code: statuspkg.CodeASRFailed, Retryable: true, Err: fmt.Errorf("read recognition stream: %w", err)}
+		}
+		transcript, err := decodeResponse(msg)
+		if err != nil {
+			return &statuspkg.StageError{Code: statuspkg.CodeASRFailed, Err: fmt.Errorf("decode recognition response: %w", err)}
+		}
+		transcript.SessionID = sessionID
+		if transcript.Language == "" {
+			transcript.Language = language
+		}
+		select {
+		case out <- transcript:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// grpcStatus returns the error that the grpc-status field of header
+// reports, or nil for OK and when the field is absent.
+func grpcStatus(header http.Header) error {
+	raw := header.Get("Grpc-Status")
+	if raw == "" || raw == "0" {
+		return nil
+	}
+	code, err := strconv.Atoi(raw)
+	if err != nil {
+		return &statuspkg.StageError{Code: statuspkg.CodeASRFailed, Err: fmt.Errorf("malformed grpc-status %q", raw)}
+	}
+	message, _ := url.PathUnescape(header.Get("Grpc-Message"))
+	return &statuspkg.StageError{
+		Code:      statuspkg.CodeASRFailed,
+		Retryable: code == grpcUnavailable || code == grpcResourceExhausted || code == grpcDeadlineExceeded,
+		Err:       fmt.Errorf("recognition service returned status %d: %s", code, message),
+	}
+}
+
+// Health reports the outcome of the most recent stream.
+func (g *GRPCRecognizer) Health() HealthStatus {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.lastErr != nil {
+		return HealthStatus{Message: g.lastErr.Error(), ModelLoaded: g.loaded}
+	}
+	return HealthStatus{Healthy: true, Message: "streaming to " + g.cfg.Endpoint, ModelLoaded: g.loaded}
+}
@@ -0,0 +1,231 @@
+package asr
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// grpcResponse encodes a RecognizeResponse as a service would.
+func grpcResponse(text string, start, end time.Duration, confidence float32, words ...Word) []byte {
+	var w protoWriter
+	w.string(1, text)
+	w.varint(2, start.Milliseconds())
+	w.varint(3, end.Milliseconds())
+	w.tag(4, wireFixed32)
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, math.Float32bits(confidence))
+	for _, word := range words {
+		var encoded protoWriter
+		encoded.string(1, word.Text)
+		encoded.varint(2, word.StartTime.Milliseconds())
+		encoded.varint(3, word.EndTime.Milliseconds())
+		w.message(6, encoded.buf)
+	}
+	return w.buf
+}
+
+// newGRPCService starts an HTTP/2 server whose recognition method is
+// handled by recognize.
+func newGRPCService(t *testing.T, recognize http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != GRPCRecognizePath || r.Header.Get("Content-Type") != "application/grpc" {
+			http.Error(w, "not a gRPC call", http.StatusBadRequest)
+			return
+		}
+		recognize(w, r)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGRPCRecognizerStreamsAudioAndTranscripts(t *testing.T) {
+	t.Parallel()
+
+	var (
+		config     []protoField
+		timestamps []int64
+		auth       string
+	)
+	server := newGRPCService(t, func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			msg, err := readGRPCMessage(r.Body)
+			if err != nil {
+				break
+			}
+			request, _ := parseProto(msg)
+			switch request[0].number {
+			case 1:
+				config, _ = parseProto(request[0].data)
+			case 2:
+				audio, _ := parseProto(request[0].data)
+				// An absent timestamp is zero, as protocol buffers omit
+				// default values.
+				var timestamp int64
+				for _, field := range audio {
+					if field.number == 2 {
+						timestamp = int64(field.value)
+					}
+				}
+				timestamps = append(timestamps, timestamp)
+				start := time.Duration(timestamp) * time.Millisecond
+				response := grpcResponse("hola mundo", start, start+time.Second, 0.5,
+					Word{Text: "hola", StartTime: start, EndTime: start + 400*time.Millisecond},
+					Word{Text: "mundo", StartTime: start + 500*time.Millisecond, EndTime: start + time.Second})
+				_ = writeGRPCMessage(w, response)
+				w.(http.Flusher).Flush()
+			}
+		}
+		w.Header().Set("Grpc-Status", "0")
+	})
+
+	recognizer, err := NewGRPCRecognizer(GRPCConfig{
+		Endpoint: server.URL,
+		Client:   server.Client(),
+		Metadata: map[string]string{"Authorization": "Bearer token"},
+		Language: "es",
+	})
+	if err != nil {
+		t.Fatalf("NewGRPCRecognizer: %v", err)
+	}
+	if err := recognizer.LoadModel(ModelGPU); err != nil {
+		t.Fatalf("LoadModel: %v", err)
+	}
+	chunks := make(chan media.AudioChunk, 2)
+	for i := 0; i < 2; i++ {
+		chunks <- media.AudioChunk{Timestamp: time.Duration(i) * time.Second, SampleRate: 16000, Channels: 1, PCMData: make([]byte, 32000), Duration: time.Second}
+	}
+	close(chunks)
+
+	out, err := recognizer.Recognize(context.Background(), "grpc-session", chunks)
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	var transcripts []Transcript
+	for transcript := range out {
+		transcripts = append(transcripts, transcript)
+	}
+	if len(transcripts) != 2 {
+		t.Fatalf("expected two transcripts, got %+v", transcripts)
+	}
+	want := Transcript{
+		SessionID:  "grpc-session",
+		Text:       "hola mundo",
+		StartTime:  time.Second,
+		EndTime:    2 * time.Second,
+		Confidence: 0.5,
+		Language:   "es",
+		Words: []Word{
+			{Text: "hola", StartTime: time.Second, EndTime: 1400 * time.Millisecond},
+			{Text: "mundo", StartTime: 1500 * time.Millisecond, EndTime: 2 * time.Second},
+		},
+	}
+	if !reflect.DeepEqual(transcripts[1], want) {
+		t.Fatalf("expected %+v, got %+v", want, transcripts[1])
+	}
+	if !reflect.DeepEqual(timestamps, []int64{0, 1000}) {
+		t.Fatalf("expected audio at 0ms and 1000ms, got %v", timestamps)
+	}
+	if len(config) != 3 || string(config[0].data) != "grpc-session" || string(config[1].data) != string(ModelGPU) || string(config[2].data) != "es" {
+		t.Fatalf("unexpected stream configuration %+v", config)
+	}
+	if auth != "Bearer token" {
+		t.Fatalf("expected metadata to be sent, got %q", auth)
+	}
+	if health := recognizer.Health(); !health.Healthy || !health.ModelLoaded {
+		t.Fatalf("expected a healthy recognizer, got %+v", health)
+	}
+}
+
+func TestGRPCRecognizerReportsServiceStatus(t *testing.T) {
+	t.Parallel()
+
+	server := newGRPCService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "14")
+		w.Header().Set("Grpc-Message", "model%20warming%20up")
+		w.WriteHeader(http.StatusOK)
+	})
+	recognizer, err := NewGRPCRecognizer(GRPCConfig{Endpoint: server.URL, Client: server.Client()})
+	if err != nil {
+		t.Fatalf("NewGRPCRecognizer: %v", err)
+	}
+
+	var reported error
+	ctx := statuspkg.WithStageErrorReporter(context.Background(), func(err error) { reported = err })
+	chunks := make(chan media.AudioChunk)
+	defer close(chunks)
+	out, err := recognizer.Recognize(ctx, "grpc-session", chunks)
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	for transcript := range out {
+		t.Fatalf("expected no transcripts, got %+v", transcript)
+	}
+	var stageErr *statuspkg.StageError
+	if !errors.As(reported, &stageErr) || stageErr.Code != statuspkg.CodeASRFailed || !errors.Is(reported, statuspkg.ErrTransient) {
+		t.Fatalf("expected a retryable recognition failure, got %v", reported)
+	}
+	if health := recognizer.Health(); health.Healthy {
+		t.Fatalf("expected the failure to show in health, got %+v", health)
+	}
+
+	if _, err := NewGRPCRecognizer(GRPCConfig{Endpoint: "asr.internal:50051"}); err == nil {
+		t.Fatal("expected an endpoint without a scheme to be rejected")
+	}
+}
+
+func TestGRPCWireRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	msg := encodeAudioRequest([]byte{1, 2, 3, 4}, 1500, 16000, 1)
+	fields, err := parseProto(msg)
+	if err != nil || len(fields) != 1 || fields[0].number != 2 {
+		t.Fatalf("unexpected request %+v: %v", fields, err)
+	}
+	audio, err := parseProto(fields[0].data)
+	if err != nil || len(audio) != 4 || !reflect.DeepEqual(audio[0].data, []byte{1, 2, 3, 4}) || audio[1].value != 1500 || audio[2].value != 16000 {
+		t.Fatalf("unexpected audio %+v: %v", audio, err)
+	}
+
+	config, err := parseProto(encodeConfigRequest("grpc-session", ModelCPUBasic, "", true, []string{"Streamlation", "Jobaben"}))
+	if err != nil || len(config) != 1 {
+		t.Fatalf("unexpected request %+v: %v", config, err)
+	}
+	settings, err := parseProto(config[0].data)
+	if err != nil || len(settings) != 5 || settings[2].number != 4 || settings[2].value != 1 {
+		t.Fatalf("expected interim results to be requested, got %+v: %v", settings, err)
+	}
+	if settings[3].number != 5 || string(settings[3].data) != "Streamlation" || string(settings[4].data) != "Jobaben" {
+		t.Fatalf("expected phrase hints, got %+v", settings[3:])
+	}
+
+	if _, err := decodeResponse([]byte{0x0a, 0x05, 'h'}); err == nil {
+		t.Fatal("expected a truncated response to be rejected")
+	}
+	// Fields the recognizer does not know are skipped.
+	transcript, err := decodeResponse(append(grpcResponse("hi", 0, time.Second, 1), 0x45, 0, 0, 0, 0, 0x50, 1))
+	if err != nil || transcript.Text != "hi" || transcript.EndTime != time.Second {
+		t.Fatalf("unexpected transcript %+v: %v", transcript, err)
+	}
+	transcript, err = decodeResponse(append(grpcResponse("hi", 0, time.Second, 1), 0x42, 2, 'S', '2'))
+	if err != nil || transcript.Speaker != "S2" {
+		t.Fatalf("expected the speaker of a diarizing service, got %+v: %v", transcript, err)
+	}
+}
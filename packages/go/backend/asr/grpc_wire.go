@@ -0,0 +1,267 @@
+package asr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// The messages of the streaming recognition protocol, encoded as protocol
+// buffers by hand so the backend needs no generated code:
+//
+//	service StreamingRecognizer {
+//	  rpc Recognize(stream RecognizeRequest) returns (stream RecognizeResponse);
+//	}
+//	message RecognizeRequest {
+//	  oneof request {
+//	    RecognitionConfig config = 1;
+//	    Audio audio = 2;
+//	  }
+//	}
+//	message RecognitionConfig {
+//	  string session_id = 1;
+//	  string model_profile = 2;
+//	  string language = 3;
+//	  bool interim_results = 4;
+//	  repeated string phrases = 5;  // names and terms to favour
+//	}
+//	message Audio {
+//	  bytes pcm = 1;            // 16-bit little-endian interleaved
+//	  int64 timestamp_ms = 2;
+//	  int32 sample_rate = 3;
+//	  int32 channels = 4;
+//	}
+//	message RecognizeResponse {
+//	  string text = 1;
+//	  int64 start_ms = 2;
+//	  int64 end_ms = 3;
+//	  float confidence = 4;
+//	  string language = 5;
+//	  repeated Word words = 6;
+//	  bool partial = 7;
+//	  string speaker = 8;       // set by services that diarize
+//	}
+//	message Word {
+//	  string text = 1;
+//	  int64 start_ms = 2;
+//	  int64 end_ms = 3;
+//	}
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// maxGRPCMessage bounds the size of a message read from the server.
+const maxGRPCMessage = 4 << 20
+
+// protoWriter appends fields of a protocol buffer message.
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) tag(field, wireType int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (w *protoWriter) varint(field int, value int64) {
+	if value == 0 {
+		return
+	}
+	w.tag(field, wireVarint)
+	w.buf = binary.AppendUvarint(w.buf, uint64(value))
+}
+
+func (w *protoWriter) bytes(field int, value []byte) {
+	if len(value) == 0 {
+		return
+	}
+	w.tag(field, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(value)))
+	w.buf = append(w.buf, value...)
+}
+
+func (w *protoWriter) string(field int, value string) {
+	w.bytes(field, []byte(value))
+}
+
+// message appends the embedded message msg, even when it is empty.
+func (w *protoWriter) message(field int, msg []byte) {
+	w.tag(field, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(msg)))
+	w.buf = append(w.buf, msg...)
+}
+
+// protoField is one field of a decoded message. Varint and fixed fields
+// carry their value in value, length-delimited ones in data.
+type protoField struct {
+	number   int
+	wireType int
+	value    uint64
+	data     []byte
+}
+
+// parseProto splits msg into its fields.
+func parseProto(msg []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errors.New("malformed field key")
+		}
+		msg = msg[n:]
+		field := protoField{number: int(key >> 3), wireType: int(key & 7)}
+		switch field.wireType {
+		case wireVarint:
+			field.value, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return nil, fmt.Errorf("malformed varint in field %d", field.number)
+			}
+			msg = msg[n:]
+		case wireFixed64:
+			if len(msg) < 8 {
+				return nil, fmt.Errorf("truncated field %d", field.number)
+			}
+			field.value, msg = binary.LittleEndian.Uint64(msg), msg[8:]
+		case wireFixed32:
+			if len(msg) < 4 {
+				return nil, fmt.Errorf("truncated field %d", field.number)
+			}
+			field.value, msg = uint64(binary.LittleEndian.Uint32(msg)), msg[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return nil, fmt.Errorf("truncated field %d", field.number)
+			}
+			field.data, msg = msg[n:n+int(size)], msg[n+int(size):]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in field %d", field.wireType, field.number)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// encodeConfigRequest encodes the RecognizeRequest that opens a stream.
+func encodeConfigRequest(sessionID string, profile ModelProfile, language string, interim bool, phrases []string) []byte {
+	var config protoWriter
+	config.string(1, sessionID)
+	config.string(2, string(profile))
+	config.string(3, language)
+	if interim {
+		config.varint(4, 1)
+	}
+	for _, phrase := range phrases {
+		config.string(5, phrase)
+	}
+	var request protoWriter
+	request.message(1, config.buf)
+	return request.buf
+}
+
+// encodeAudioRequest encodes a RecognizeRequest carrying audio.
+func encodeAudioRequest(pcm []byte, timestampMs int64, sampleRate, channels int) []byte {
+	var audio protoWriter
+	audio.bytes(1, pcm)
+	audio.varint(2, timestampMs)
+	audio.varint(3, int64(sampleRate))
+	audio.varint(4, int64(channels))
+	var request protoWriter
+	request.message(2, audio.buf)
+	return request.buf
+}
+
+// decodeResponse decodes a RecognizeResponse. Unknown fields are skipped.
+func decodeResponse(msg []byte) (Transcript, error) {
+	fields, err := parseProto(msg)
+	if err != nil {
+		return Transcript{}, err
+	}
+	var transcript Transcript
+	for _, field := range fields {
+		switch {
+		case field.number == 1 && field.wireType == wireBytes:
+			transcript.Text = string(field.data)
+		case field.number == 2 && field.wireType == wireVarint:
+			transcript.StartTime = protoMillis(field.value)
+		case field.number == 3 && field.wireType == wireVarint:
+			transcript.EndTime = protoMillis(field.value)
+		case field.number == 4 && field.wireType == wireFixed32:
+			transcript.Confidence = float64(math.Float32frombits(uint32(field.value)))
+		case field.number == 5 && field.wireType == wireBytes:
+			transcript.Language = string(field.data)
+		case field.number == 6 && field.wireType == wireBytes:
+			word, err := decodeWord(field.data)
+			if err != nil {
+				return Transcript{}, fmt.Errorf("word: %w", err)
+			}
+			transcript.Words = append(transcript.Words, word)
+		case field.number == 7 && field.wireType == wireVarint:
+			transcript.Partial = field.value != 0
+		case field.number == 8 && field.wireType == wireBytes:
+			transcript.Speaker = string(field.data)
+		}
+	}
+	return transcript, nil
+}
+
+func decodeWord(msg []byte) (Word, error) {
+	fields, err := parseProto(msg)
+	if err != nil {
+		return Word{}, err
+	}
+	var word Word
+	for _, field := range fields {
+		switch {
+		case field.number == 1 && field.wireType == wireBytes:
+			word.Text = string(field.data)
+		case field.number == 2 && field.wireType == wireVarint:
+			word.StartTime = protoMillis(field.value)
+		case field.number == 3 && field.wireType == wireVarint:
+			word.EndTime = protoMillis(field.value)
+		}
+	}
+	return word, nil
+}
+
+func protoMillis(value uint64) time.Duration {
+	return time.Duration(int64(value)) * time.Millisecond
+}
+
+// writeGRPCMessage writes msg to w as an uncompressed gRPC message.
+func writeGRPCMessage(w io.Writer, msg []byte) error {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	_, err := w.Write(append(frame, msg...))
+	return err
+}
+
+// readGRPCMessage reads the next gRPC message from r. It returns io.EOF
+// when the stream ends between messages.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errors.New("truncated gRPC message")
+		}
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed gRPC messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxGRPCMessage {
+		return nil, fmt.Errorf("gRPC message of %d bytes exceeds the limit", size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, errors.New("truncated gRPC message")
+	}
+	return msg, nil
+}
@@ -0,0 +1,60 @@
+package asr
+
+import (
+	"context"
+	"sync"
+)
+
+// LanguageLock holds the spoken language of a session. A session that
+// names its language starts with the lock set; one that asks for the
+// language to be identified starts with it empty, and the first language
+// identified locks it. Recognizers that find a lock in their context
+// transcribe in its language once it is set, rather than in their
+// configured one, so a stream keeps to one language after it is known.
+type LanguageLock struct {
+	mu       sync.RWMutex
+	language string
+}
+
+// NewLanguageLock returns a lock holding language, which may be empty.
+func NewLanguageLock(language string) *LanguageLock {
+	return &LanguageLock{language: language}
+}
+
+// Lock sets the language unless it is already set, and reports whether it
+// did.
+func (l *LanguageLock) Lock(language string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.language != "" || language == "" {
+		return false
+	}
+	l.language = language
+	return true
+}
+
+// Language returns the locked language, or "" while it is not known.
+func (l *LanguageLock) Language() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.language
+}
+
+type languageLockKey struct{}
+
+// WithLanguageLock returns a context carrying lock to the recognizers that
+// receive it.
+func WithLanguageLock(ctx context.Context, lock *LanguageLock) context.Context {
+	return context.WithValue(ctx, languageLockKey{}, lock)
+}
+
+// sessionLanguage returns the language locked for the session of ctx, or
+// fallback while there is none.
+func sessionLanguage(ctx context.Context, fallback string) string {
+	if lock, ok := ctx.Value(languageLockKey{}).(*LanguageLock); ok && lock != nil {
+		if language := lock.Language(); language != "" {
+			return language
+		}
+	}
+	return fallback
+}
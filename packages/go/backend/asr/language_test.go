@@ -0,0 +1,36 @@
+package asr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+func TestLanguageLockOverridesConfiguredLanguage(t *testing.T) {
+	t.Parallel()
+
+	lock := NewLanguageLock("")
+	ctx := WithLanguageLock(context.Background(), lock)
+	if language := sessionLanguage(ctx, "en"); language != "en" {
+		t.Fatalf("expected the configured language until the lock is set, got %q", language)
+	}
+	if !lock.Lock("es") || lock.Lock("fr") {
+		t.Fatal("expected only the first language to lock")
+	}
+
+	recognizer := NewStubRecognizer(&StubRecognizerConfig{DefaultLanguage: "en"})
+	chunks := make(chan media.AudioChunk, 1)
+	chunks <- media.AudioChunk{Duration: 100 * time.Millisecond}
+	close(chunks)
+	out, err := recognizer.Recognize(ctx, "language-session", chunks)
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	for transcript := range out {
+		if transcript.Language != "es" {
+			t.Fatalf("expected the locked language, got %q", transcript.Language)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package asr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrModelBudget is returned when a model does not fit the memory budget
+// of a ModelManager, even after the models no session uses are unloaded.
+// Acquiring it may succeed once other sessions release their models.
+var ErrModelBudget = errors.New("model exceeds memory budget")
+
+// ModelLoader brings the models a ModelManager manages into memory.
+type ModelLoader interface {
+	// Size returns how many bytes of memory model occupies once loaded. It
+	// is called before the model is loaded and should be quick.
+	Size(model string) (int64, error)
+	// Load brings model into memory and returns a function that releases
+	// it, which may be nil.
+	Load(ctx context.Context, model string) (unload func(), err error)
+}
+
+// ModelManagerConfig configures a ModelManager.
+type ModelManagerConfig struct {
+	// Models maps model profiles to the models that serve them, such as
+	// model files. Profiles mapped to the same model share it.
+	Models map[ModelProfile]string
+	// Budget bounds the memory, in bytes, of the models loaded at once.
+	// Zero leaves it unbounded.
+	Budget int64
+	// Loader loads the models. Defaults to FileModelLoader.
+	Loader ModelLoader
+}
+
+// ModelWarmup describes the progress of a model load a session waits for.
+type ModelWarmup struct {
+	Profile ModelProfile
+	Model   string
+	// Loaded is set once the model is ready, with Elapsed the time the
+	// session waited for it.
+	Loaded  bool
+	Elapsed time.Duration
+}
+
+// ModelManager loads the models of model profiles lazily, when the first
+// session needs them, and shares them between the sessions that use them
+// at the same time. Models stay loaded once no session uses them, so that
+// the next session starts without warmup, until a model that does not fit
+// the memory budget needs their memory; they are then unloaded, least
+// recently used first. A ModelManager is safe for concurrent use.
+type ModelManager struct {
+	cfg ModelManagerConfig
+
+	mu     sync.Mutex
+	models map[string]*managedModel
+	used   int64
+	clock  uint64
+}
+
+// managedModel is a model that is loaded or loading. Its fields other than
+// loaded, which is closed once loading ends, are guarded by the manager.
+type managedModel struct {
+	name     string
+	size     int64
+	refs     int
+	lastUsed uint64
+	loaded   chan struct{}
+	err      error
+	unload   func()
+}
+
+func (m *managedModel) ready() bool {
+	select {
+	case <-m.loaded:
+		return m.err == nil
+	default:
+		return false
+	}
+}
+
+// NewModelManager returns a manager of the models cfg maps profiles to.
+func NewModelManager(cfg ModelManagerConfig) *ModelManager {
+	if cfg.Loader == nil {
+		cfg.Loader = FileModelLoader{}
+	}
+	return &ModelManager{cfg: cfg, models: make(map[string]*managedModel)}
+}
+
+// ModelLease is a session's hold on a loaded model. The model stays loaded
+// until every lease on it is released.
+type ModelLease struct {
+	manager *ModelManager
+	model   *managedModel
+	once    sync.Once
+}
+
+// Model returns the model the lease holds.
+func (l *ModelLease) Model() string {
+	if l == nil {
+		return ""
+	}
+	return l.model.name
+}
+
+// Release gives the model up. Releasing a nil lease, or a lease more than
+// once, does nothing.
+func (l *ModelLease) Release() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() { l.manager.release(l.model) })
+}
+
+// Acquire returns a lease on the model of profile, loading it first unless
+// it is loaded already. While the session waits for the model to load,
+// warmup, which may be nil, is called once when the wait starts and once
+// the model is ready. A load continues when ctx is cancelled, for the other
+// sessions that wait for it.
+func (m *ModelManager) Acquire(ctx context.Context, profile ModelProfile, warmup func(ModelWarmup)) (*ModelLease, error) {
+	name := m.cfg.Models[profile]
+	if name == "" {
+		return nil, fmt.Errorf("no model configured for profile %s", profile)
+	}
+
+	m.mu.Lock()
+	model, unloads, err := m.reserve(name)
+	m.mu.Unlock()
+	for _, unload := range unloads {
+		unload()
+	}
+	if err != nil {
+		return nil, err
+	}
+	lease := &ModelLease{manager: m, model: model}
+
+	select {
+	case <-model.loaded:
+	default:
+		started := time.Now()
+		if warmup != nil {
+			warmup(ModelWarmup{Profile: profile, Model: name})
+		}
+		select {
+		case <-model.loaded:
+		case <-ctx.Done():
+			lease.Release()
+			return nil, ctx.Err()
+		}
+		if warmup != nil && model.err == nil {
+			warmup(ModelWarmup{Profile: profile, Model: name, Loaded: true, Elapsed: time.Since(started)})
+		}
+	}
+	if model.err != nil {
+		return nil, fmt.Errorf("load model %s: %w", name, model.err)
+	}
+	return lease, nil
+}
+
+// reserve takes a reference on the model name, starting its load when it
+// is not loaded, and returns the unload functions of the models evicted to
+// make room for it. The caller holds m.mu.
+func (m *ModelManager) reserve(name string) (*managedModel, []func(), error) {
+	if model, ok := m.models[name]; ok {
+		model.refs++
+		return model, nil, nil
+	}
+	size, err := m.cfg.Loader.Size(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("size model %s: %w", name, err)
+	}
+	unloads, err := m.evict(size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s needs %d bytes, %d of %d in use", ErrModelBudget, name, size, m.used, m.cfg.Budget)
+	}
+	model := &managedModel{name: name, size: size, refs: 1, loaded: make(chan struct{})}
+	m.models[name] = model
+	m.used += size
+	go m.load(model)
+	return model, unloads, nil
+}
+
+// evict unloads the least recently used models no session holds until size
+// bytes fit the budget. It unloads nothing when they would not fit even
+// then. The caller holds m.mu.
+func (m *ModelManager) evict(size int64) ([]func(), error) {
+	if m.cfg.Budget <= 0 {
+		return nil, nil
+	}
+	held := m.used
+	for _, model := range m.models {
+		if model.refs == 0 && model.ready() {
+			held -= model.size
+		}
+	}
+	if held+size > m.cfg.Budget {
+		return nil, ErrModelBudget
+	}
+	var unloads []func()
+	for m.used+size > m.cfg.Budget {
+		var oldest *managedModel
+		for _, model := range m.models {
+			if model.refs == 0 && model.ready() && (oldest == nil || model.lastUsed < oldest.lastUsed) {
+				oldest = model
+			}
+		}
+		delete(m.models, oldest.name)
+		m.used -= oldest.size
+		if oldest.unload != nil {
+			unloads = append(unloads, oldest.unload)
+		}
+	}
+	return unloads, nil
+}
+
+// load loads model and, when loading fails, forgets it so that a later
+// Acquire tries again.
+func (m *ModelManager) load(model *managedModel) {
+	unload, err := m.cfg.Loader.Load(context.Background(), model.name)
+	m.mu.Lock()
+	model.unload, model.err = unload, err
+	if err != nil {
+		delete(m.models, model.name)
+		m.used -= model.size
+	}
+	m.mu.Unlock()
+	close(model.loaded)
+}
+
+func (m *ModelManager) release(model *managedModel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	model.refs--
+	m.clock++
+	model.lastUsed = m.clock
+}
+
+// Loaded returns the models that are loaded, with how many sessions use
+// each.
+func (m *ModelManager) Loaded() map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	loaded := make(map[string]int)
+	for name, model := range m.models {
+		if model.ready() {
+			loaded[name] = model.refs
+		}
+	}
+	return loaded
+}
+
+// FileModelLoader loads model files, such as the ggml models of
+// whisper.cpp, which map them into memory on every run. Loading reads the
+// file once, so that it is in the operating system's cache when the first
+// segment is transcribed; a model's size is that of its file.
+type FileModelLoader struct{}
+
+// Size returns the size of the model file.
+func (FileModelLoader) Size(model string) (int64, error) {
+	info, err := os.Stat(model)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Load reads the model file.
+func (FileModelLoader) Load(_ context.Context, model string) (func(), error) {
+	file, err := os.Open(model)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := io.Copy(io.Discard, file); err != nil {
+		return nil, fmt.Errorf("read model %s: %w", model, err)
+	}
+	return nil, nil
+}
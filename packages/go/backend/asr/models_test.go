@@ -0,0 +1,170 @@
+package asr
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeModelLoader loads models of fixed sizes, blocking each load until
+// release is closed when it is set.
+type fakeModelLoader struct {
+	sizes   map[string]int64
+	release chan struct{}
+
+	mu       sync.Mutex
+	loads    []string
+	unloaded []string
+	fail     error
+}
+
+func (f *fakeModelLoader) Size(model string) (int64, error) {
+	return f.sizes[model], nil
+}
+
+func (f *fakeModelLoader) Load(_ context.Context, model string) (func(), error) {
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loads = append(f.loads, model)
+	if f.fail != nil {
+		return nil, f.fail
+	}
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.unloaded = append(f.unloaded, model)
+	}, nil
+}
+
+func TestModelManagerSharesLoadsBetweenSessions(t *testing.T) {
+	t.Parallel()
+
+	loader := &fakeModelLoader{sizes: map[string]int64{"base": 100}, release: make(chan struct{})}
+	manager := NewModelManager(ModelManagerConfig{
+		Models: map[ModelProfile]string{ModelCPUBasic: "base", ModelCPUAdvanced: "base"},
+		Loader: loader,
+	})
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		warmups []ModelWarmup
+	)
+	started := make(chan struct{}, 2)
+	leases := make([]*ModelLease, 2)
+	for i, profile := range []ModelProfile{ModelCPUBasic, ModelCPUAdvanced} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lease, err := manager.Acquire(context.Background(), profile, func(warmup ModelWarmup) {
+				mu.Lock()
+				warmups = append(warmups, warmup)
+				mu.Unlock()
+				if !warmup.Loaded {
+					started <- struct{}{}
+				}
+			})
+			if err != nil {
+				t.Errorf("acquire %s: %v", profile, err)
+			}
+			leases[i] = lease
+		}()
+	}
+	<-started
+	<-started
+	close(loader.release)
+	wg.Wait()
+
+	if !reflect.DeepEqual(loader.loads, []string{"base"}) {
+		t.Fatalf("expected the shared model to load once, got %v", loader.loads)
+	}
+	loaded := 0
+	for _, warmup := range warmups {
+		if warmup.Loaded {
+			loaded++
+		}
+	}
+	if len(warmups) != 4 || loaded != 2 {
+		t.Fatalf("expected both sessions to see loading and loaded, got %+v", warmups)
+	}
+	if got := manager.Loaded(); got["base"] != 2 {
+		t.Fatalf("expected the model held twice, got %v", got)
+	}
+	leases[0].Release()
+	leases[0].Release()
+	leases[1].Release()
+	if got := manager.Loaded(); got["base"] != 0 {
+		t.Fatalf("expected the released model to stay loaded unused, got %v", got)
+	}
+
+	// A loaded model is reused without warmup.
+	lease, err := manager.Acquire(context.Background(), ModelCPUBasic, func(warmup ModelWarmup) {
+		t.Errorf("unexpected warmup %+v", warmup)
+	})
+	if err != nil || lease.Model() != "base" {
+		t.Fatalf("expected the loaded model, got %v, %v", lease, err)
+	}
+}
+
+func TestModelManagerEnforcesBudget(t *testing.T) {
+	t.Parallel()
+
+	loader := &fakeModelLoader{sizes: map[string]int64{"base": 60, "large": 70, "small": 30}}
+	manager := NewModelManager(ModelManagerConfig{
+		Models: map[ModelProfile]string{ModelCPUBasic: "base", ModelGPU: "large", ModelCPUAdvanced: "small"},
+		Budget: 100,
+		Loader: loader,
+	})
+	ctx := context.Background()
+
+	base, err := manager.Acquire(ctx, ModelCPUBasic, nil)
+	if err != nil {
+		t.Fatalf("acquire base: %v", err)
+	}
+	if _, err := manager.Acquire(ctx, ModelGPU, nil); !errors.Is(err, ErrModelBudget) {
+		t.Fatalf("expected the model in use to keep its memory, got %v", err)
+	}
+	small, err := manager.Acquire(ctx, ModelCPUAdvanced, nil)
+	if err != nil {
+		t.Fatalf("acquire small: %v", err)
+	}
+
+	// Released models are unloaded, least recently used first, once the
+	// memory is needed.
+	base.Release()
+	small.Release()
+	if _, err := manager.Acquire(ctx, ModelGPU, nil); err != nil {
+		t.Fatalf("acquire large: %v", err)
+	}
+	if !reflect.DeepEqual(loader.unloaded, []string{"base"}) {
+		t.Fatalf("expected only base unloaded, got %v", loader.unloaded)
+	}
+	if got := manager.Loaded(); !reflect.DeepEqual(got, map[string]int{"large": 1, "small": 0}) {
+		t.Fatalf("unexpected loaded models %v", got)
+	}
+}
+
+func TestModelManagerRetriesFailedLoads(t *testing.T) {
+	t.Parallel()
+
+	loader := &fakeModelLoader{sizes: map[string]int64{"base": 10}, fail: errors.New("corrupt model")}
+	manager := NewModelManager(ModelManagerConfig{Models: map[ModelProfile]string{ModelCPUBasic: "base"}, Loader: loader})
+
+	if _, err := manager.Acquire(context.Background(), ModelCPUBasic, nil); err == nil {
+		t.Fatal("expected the failed load to be reported")
+	}
+	loader.mu.Lock()
+	loader.fail = nil
+	loader.mu.Unlock()
+	if _, err := manager.Acquire(context.Background(), ModelCPUBasic, nil); err != nil {
+		t.Fatalf("expected the load to be retried, got %v", err)
+	}
+	if _, err := manager.Acquire(context.Background(), ModelGPU, nil); err == nil {
+		t.Fatal("expected a profile without a model to be rejected")
+	}
+}
@@ -0,0 +1,402 @@
+package asr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/provider"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// Defaults of OpenAIConfig.
+const (
+	// DefaultOpenAIModel is the model requested when no other is set.
+	DefaultOpenAIModel = "whisper-1"
+	// DefaultOpenAIBatch is how much audio each request carries.
+	DefaultOpenAIBatch = 10 * time.Second
+)
+
+// OpenAIConfig configures an OpenAIRecognizer. Zero values fall back to the
+// defaults.
+type OpenAIConfig struct {
+	// Endpoint is the base URL of the API, such as https://api.openai.com/v1.
+	// Audio is posted to its /audio/transcriptions path.
+	Endpoint string
+	// APIKey is sent as a bearer token when set.
+	APIKey string
+	// Model is the model requested until a profile is loaded, and for
+	// profiles without an entry in Models. Defaults to DefaultOpenAIModel.
+	Model string
+	// Models maps model profiles to the models that serve them.
+	Models map[ModelProfile]string
+	// Language is the spoken language as an ISO 639-1 code. Empty lets the
+	// service detect it. A session's LanguageLock takes precedence from the
+	// next batch once it is set.
+	Language string
+	// Client sends the requests. Defaults to a client with a one minute
+	// timeout.
+	Client *http.Client
+	// Batch is how much audio is collected into each request.
+	Batch time.Duration
+	// Limiter paces, bounds, and retries the requests. Recognizers using one
+	// API key should share one, so that their sessions together stay within
+	// its rate limit. Nil sends requests as soon as audio is ready.
+	Limiter *provider.Limiter
+}
+
+// OpenAIRecognizer transcribes audio with a service that implements the
+// OpenAI audio transcription API, such as OpenAI itself or a self-hosted
+// Whisper server, for deployments without local models.
+//
+// Audio is collected into batches of cfg.Batch, ending early at a gap or a
+// change of format, and each batch is posted as a 16kHz mono WAV file with
+// a request for segment and word timestamps. Windowed audio is batched
+// without the overlap and padding of its windows, so no audio is sent
+// twice. Requests of one session are sent one at a time and in order;
+// while one is in flight no audio is read, which holds back the stages
+// before recognition.
+//
+// Requests that fail with a rate limit, a server error, or a network error
+// are retried. A request that keeps failing, or fails otherwise, ends the
+// stream with ASR_RECOGNITION_FAILED, reported through
+// statuspkg.ReportStageError.
+type OpenAIRecognizer struct {
+	cfg OpenAIConfig
+	url string
+
+	mu      sync.RWMutex
+	model   string
+	loaded  bool
+	lastErr error
+}
+
+// NewOpenAIRecognizer returns a recognizer posting to cfg.Endpoint.
+func NewOpenAIRecognizer(cfg OpenAIConfig) (*OpenAIRecognizer, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "https" && endpoint.Scheme != "http") {
+		return nil, fmt.Errorf("invalid transcription endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Model == "" {
+		cfg.Model = DefaultOpenAIModel
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: time.Minute}
+	}
+	if cfg.Batch <= 0 {
+		cfg.Batch = DefaultOpenAIBatch
+	}
+	return &OpenAIRecognizer{
+		cfg:   cfg,
+		url:   strings.TrimSuffix(endpoint.String(), "/") + "/audio/transcriptions",
+		model: cfg.Model,
+	}, nil
+}
+
+// LoadModel selects the model of profile for the requests sent from now on.
+func (o *OpenAIRecognizer) LoadModel(profile ModelProfile) error {
+	model := o.cfg.Models[profile]
+	if model == "" {
+		model = o.cfg.Model
+	}
+	o.mu.Lock()
+	o.model, o.loaded = model, true
+	o.mu.Unlock()
+	return nil
+}
+
+// Recognize transcribes the audio from chunks.
+func (o *OpenAIRecognizer) Recognize(ctx context.Context, sessionID string, chunks <-chan media.AudioChunk) (<-chan Transcript, error) {
+	out := make(chan Transcript)
+	go func() {
+		defer close(out)
+
+		transcribe := func(batch *audioSegment) bool {
+			if batch == nil {
+				return true
+			}
+			transcripts, err := o.transcribe(ctx, sessionID, batch)
+			o.mu.Lock()
+			o.lastErr = err
+			o.mu.Unlock()
+			if err != nil {
+				if ctx.Err() == nil {
+					statuspkg.ReportStageError(ctx, err)
+				}
+				return false
+			}
+			for _, transcript := range transcripts {
+				select {
+				case out <- transcript:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
+		var pending *audioSegment
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk, ok := <-chunks:
+				if !ok {
+					transcribe(pending)
+					return
+				}
+				chunk = trimWindow(chunk)
+				if chunk.SampleRate <= 0 || chunk.Channels <= 0 || len(chunk.PCMData) == 0 {
+					continue
+				}
+				if pending != nil && !pending.continues(chunk) {
+					if !transcribe(pending) {
+						return
+					}
+					pending = nil
+				}
+				if pending == nil {
+					pending = newAudioSegment(chunk)
+				} else {
+					pending.add(chunk)
+				}
+				if pending.length >= o.cfg.Batch {
+					if !transcribe(pending) {
+						return
+					}
+					pending = nil
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Health reports the outcome of the most recent request.
+func (o *OpenAIRecognizer) Health() HealthStatus {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.lastErr != nil {
+		return HealthStatus{Message: o.lastErr.Error(), ModelLoaded: o.loaded}
+	}
+	return HealthStatus{Healthy: true, Message: "transcribing with " + o.model + " at " + o.cfg.Endpoint, ModelLoaded: o.loaded}
+}
+
+// trimWindow returns the audio of a windowed chunk that no other window
+// carries: without the overlap repeated from the previous window and the
+// padding that fills a short one. Chunks that are not windowed are
+// returned unchanged.
+func trimWindow(chunk media.AudioChunk) media.AudioChunk {
+	if chunk.Window == nil || chunk.SampleRate <= 0 || chunk.Channels <= 0 {
+		return chunk
+	}
+	frameSize := 2 * chunk.Channels
+	size := func(d time.Duration) int {
+		return int(d*time.Duration(chunk.SampleRate)/time.Second) * frameSize
+	}
+	start := min(size(chunk.Window.Overlap), len(chunk.PCMData))
+	end := max(len(chunk.PCMData)-size(chunk.Window.Padding), start)
+	chunk.PCMData = chunk.PCMData[start:end]
+	chunk.Timestamp += chunk.Window.Overlap
+	chunk.Duration = time.Duration(len(chunk.PCMData)/frameSize) * time.Second / time.Duration(chunk.SampleRate)
+	return chunk
+}
+
+// transcribe posts batch through the limiter and returns its
+// transcripts.
+func (o *OpenAIRecognizer) transcribe(ctx context.Context, sessionID string, batch *audioSegment) ([]Transcript, error) {
+	audio, err := batch.wav()
+	if err != nil {
+		return nil, &statuspkg.StageError{Code: statuspkg.CodeASRFailed, Err: err}
+	}
+	o.mu.RLock()
+	model := o.model
+	o.mu.RUnlock()
+	language := sessionLanguage(ctx, o.cfg.Language)
+
+	var result openAITranscription
+	err = o.cfg.Limiter.Do(ctx, func(ctx context.Context) (time.Duration, error) {
+		var (
+			retryAfter time.Duration
+			err        error
+		)
+		result, retryAfter, err = o.post(ctx, audio, model, language)
+		return retryAfter, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	statuspkg.RecordUsage(ctx, statuspkg.ProviderUsage{Stage: "asr", Provider: "openai/" + model, Requests: 1, AudioMs: batch.length.Milliseconds()})
+	return result.transcripts(sessionID, batch.start, language), nil
+}
+
+// post sends one transcription request. Along with a failure it returns
+// how long the service asked to wait before retrying, if it did.
+func (o *OpenAIRecognizer) post(ctx context.Context, audio []byte, model, language string) (openAITranscription, time.Duration, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "audio.wav")
+	if err == nil {
+		_, err = file.Write(audio)
+	}
+	fields := [][2]string{
+		{"model", model},
+		{"response_format", "verbose_json"},
+		{"timestamp_granularities[]", "segment"},
+		{"timestamp_granularities[]", "word"},
+	}
+	if language != "" {
+		fields = append(fields, [2]string{"language", language})
+	}
+	if prompt := vocabularyPrompt(ctx); prompt != "" {
+		fields = append(fields, [2]string{"prompt", prompt})
+	}
+	for _, field := range fields {
+		if err == nil {
+			err = form.WriteField(field[0], field[1])
+		}
+	}
+	if err == nil {
+		err = form.Close()
+	}
+	if err != nil {
+		return openAITranscription{}, 0, &statuspkg.StageError{Code: statuspkg.CodeASRFailed, Err: fmt.Errorf("encode transcription request: %w", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, &body)
+	if err != nil {
+		return openAITranscription{}, 0, &statuspkg.StageError{Code: statuspkg.CodeASRFailed, Err: fmt.Errorf("create transcription request: %w", err)}
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if o.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.cfg.APIKey)
+	}
+	resp, err := o.cfg.Client.Do(req)
+	if err != nil {
+		return openAITranscription{}, 0, &statuspkg.StageError{Code: statuspkg.CodeASRFailed, Retryable: true, Err: fmt.Errorf("send transcription request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return openAITranscription{}, retryAfter, &statuspkg.StageError{
+			Code:      statuspkg.CodeASRFailed,
+			Retryable: retryable,
+			Err:       fmt.Errorf("transcription request: %s: %s", resp.Status, strings.TrimSpace(string(detail))),
+		}
+	}
+	var result openAITranscription
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return openAITranscription{}, 0, &statuspkg.StageError{Code: statuspkg.CodeASRFailed, Retryable: true, Err: fmt.Errorf("decode transcription response: %w", err)}
+	}
+	return result, 0, nil
+}
+
+// openAITranscription is a verbose_json transcription response, timed in
+// seconds from the start of the audio.
+type openAITranscription struct {
+	Language string          `json:"language"`
+	Text     string          `json:"text"`
+	Segments []openAISegment `json:"segments"`
+	Words    []struct {
+		Word  string  `json:"word"`
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+	} `json:"words"`
+}
+
+type openAISegment struct {
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	Text       string  `json:"text"`
+	AvgLogprob float64 `json:"avg_logprob"`
+}
+
+// transcripts maps the response for audio starting at start to one
+// transcript per segment, each with the words that start within it.
+// Responses without segments become a single transcript.
+func (r openAITranscription) transcripts(sessionID string, start time.Duration, language string) []Transcript {
+	if language == "" {
+		language = languageCode(r.Language)
+	}
+	at := func(seconds float64) time.Duration {
+		return start + time.Duration(seconds*float64(time.Second)).Round(time.Millisecond)
+	}
+
+	segments := r.Segments
+	if len(segments) == 0 && strings.TrimSpace(r.Text) != "" {
+		end := 0.0
+		if len(r.Words) > 0 {
+			end = r.Words[len(r.Words)-1].End
+		}
+		segments = []openAISegment{{End: end, Text: r.Text}}
+	}
+
+	var transcripts []Transcript
+	words := r.Words
+	for i, segment := range segments {
+		text := strings.TrimSpace(segment.Text)
+		if text == "" {
+			continue
+		}
+		transcript := Transcript{
+			SessionID: sessionID,
+			Text:      text,
+			StartTime: at(segment.Start),
+			EndTime:   at(segment.End),
+			Language:  language,
+		}
+		if segment.AvgLogprob != 0 {
+			transcript.Confidence = min(math.Exp(segment.AvgLogprob), 1)
+		}
+		last := i == len(segments)-1
+		for len(words) > 0 && (last || words[0].Start < segments[i+1].Start) {
+			transcript.Words = append(transcript.Words, Word{
+				Text:      strings.TrimSpace(words[0].Word),
+				StartTime: at(words[0].Start),
+				EndTime:   at(words[0].End),
+			})
+			words = words[1:]
+		}
+		transcripts = append(transcripts, transcript)
+	}
+	return transcripts
+}
+
+// languageCodes maps the language names the Whisper API reports to ISO
+// 639-1 codes, for the languages most often transcribed.
+var languageCodes = map[string]string{
+	"arabic": "ar", "chinese": "zh", "czech": "cs", "danish": "da",
+	"dutch": "nl", "english": "en", "finnish": "fi", "french": "fr",
+	"german": "de", "greek": "el", "hebrew": "he", "hindi": "hi",
+	"hungarian": "hu", "indonesian": "id", "italian": "it", "japanese": "ja",
+	"korean": "ko", "norwegian": "no", "polish": "pl", "portuguese": "pt",
+	"romanian": "ro", "russian": "ru", "spanish": "es", "swedish": "sv",
+	"thai": "th", "turkish": "tr", "ukrainian": "uk", "vietnamese": "vi",
+}
+
+// languageCode returns the ISO 639-1 code of a language the API reports,
+// which may already be a code. Unknown names are returned as they are.
+func languageCode(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if code, ok := languageCodes[language]; ok {
+		return code
+	}
+	return language
+}
@@ -0,0 +1,195 @@
+package asr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/provider"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+const openAIResponse = `{
+	"language": "spanish",
+	"text": "Hola mundo. Adiós.",
+	"segments": [
+		{"start": 0.0, "end": 1.5, "text": " Hola mundo.", "avg_logprob": -0.105},
+		{"start": 2.0, "end": 3.0, "text": " Adiós.", "avg_logprob": -0.5}
+	],
+	"words": [
+		{"word": "Hola", "start": 0.0, "end": 0.6},
+		{"word": "mundo.", "start": 0.7, "end": 1.5},
+		{"word": "Adiós.", "start": 2.0, "end": 3.0}
+	]
+}`
+
+func TestOpenAIRecognizerBatchesAudioIntoRequests(t *testing.T) {
+	t.Parallel()
+
+	var requests []int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("model") != "whisper-large" || r.FormValue("response_format") != "verbose_json" || len(r.MultipartForm.Value["timestamp_granularities[]"]) != 2 || r.FormValue("prompt") != "Streamlation, Jobaben" {
+			http.Error(w, "unexpected form", http.StatusBadRequest)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "no file", http.StatusBadRequest)
+			return
+		}
+		size, _ := io.Copy(io.Discard, file)
+		requests = append(requests, size)
+		_, _ = io.WriteString(w, openAIResponse)
+	}))
+	defer server.Close()
+
+	recognizer, err := NewOpenAIRecognizer(OpenAIConfig{
+		Endpoint: server.URL + "/v1/",
+		APIKey:   "secret",
+		Models:   map[ModelProfile]string{ModelGPU: "whisper-large"},
+		Batch:    4 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewOpenAIRecognizer: %v", err)
+	}
+	if err := recognizer.LoadModel(ModelGPU); err != nil {
+		t.Fatalf("LoadModel: %v", err)
+	}
+
+	// Six continuous seconds of 16kHz mono: one full batch of four seconds
+	// and a last batch of two.
+	chunks := make(chan media.AudioChunk, 6)
+	for i := 0; i < 6; i++ {
+		chunks <- media.AudioChunk{Timestamp: time.Duration(i) * time.Second, SampleRate: 16000, Channels: 1, PCMData: make([]byte, 32000), Duration: time.Second}
+	}
+	close(chunks)
+	ctx := WithVocabulary(context.Background(), []string{"Streamlation", "Jobaben"})
+	out, err := recognizer.Recognize(ctx, "openai-session", chunks)
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	var transcripts []Transcript
+	for transcript := range out {
+		transcripts = append(transcripts, transcript)
+	}
+
+	if want := []int64{44 + 4*32000, 44 + 2*32000}; !reflect.DeepEqual(requests, want) {
+		t.Fatalf("expected WAV uploads of %v bytes, got %v", want, requests)
+	}
+	if len(transcripts) != 4 {
+		t.Fatalf("expected two transcripts per request, got %+v", transcripts)
+	}
+	second := transcripts[3]
+	if second.Text != "Adiós." || second.StartTime != 6*time.Second || second.EndTime != 7*time.Second || second.Language != "es" || second.SessionID != "openai-session" {
+		t.Fatalf("unexpected transcript %+v", second)
+	}
+	first := transcripts[0]
+	if want := []Word{{Text: "Hola", EndTime: 600 * time.Millisecond}, {Text: "mundo.", StartTime: 700 * time.Millisecond, EndTime: 1500 * time.Millisecond}}; !reflect.DeepEqual(first.Words, want) {
+		t.Fatalf("expected words %+v, got %+v", want, first.Words)
+	}
+	if first.Confidence < 0.89 || first.Confidence > 0.91 {
+		t.Fatalf("expected confidence from the average log probability, got %f", first.Confidence)
+	}
+}
+
+func TestOpenAIRecognizerRetriesTransientFailures(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch attempts.Add(1) {
+		case 1:
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+		case 2:
+			http.Error(w, "overloaded", http.StatusBadGateway)
+		default:
+			_, _ = io.WriteString(w, openAIResponse)
+		}
+	}))
+	defer server.Close()
+
+	recognizer, err := NewOpenAIRecognizer(OpenAIConfig{Endpoint: server.URL, Limiter: provider.NewLimiter(provider.LimiterConfig{Code: statuspkg.CodeASRFailed, RequestsPerMinute: 6000, RetryBackoff: time.Millisecond})})
+	if err != nil {
+		t.Fatalf("NewOpenAIRecognizer: %v", err)
+	}
+	chunks := make(chan media.AudioChunk, 1)
+	chunks <- media.AudioChunk{SampleRate: 16000, Channels: 1, PCMData: make([]byte, 32000), Duration: time.Second}
+	close(chunks)
+	out, err := recognizer.Recognize(context.Background(), "openai-session", chunks)
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	count := 0
+	for range out {
+		count++
+	}
+	if count != 2 || attempts.Load() != 3 {
+		t.Fatalf("expected the third attempt to succeed, got %d transcripts after %d attempts", count, attempts.Load())
+	}
+}
+
+func TestOpenAIRecognizerReportsRejectedRequests(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		http.Error(w, `{"error": {"message": "invalid api key"}}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	recognizer, err := NewOpenAIRecognizer(OpenAIConfig{Endpoint: server.URL})
+	if err != nil {
+		t.Fatalf("NewOpenAIRecognizer: %v", err)
+	}
+	var reported error
+	ctx := statuspkg.WithStageErrorReporter(context.Background(), func(err error) { reported = err })
+	chunks := make(chan media.AudioChunk, 1)
+	chunks <- media.AudioChunk{SampleRate: 16000, Channels: 1, PCMData: make([]byte, 3200), Duration: 100 * time.Millisecond}
+	close(chunks)
+	out, err := recognizer.Recognize(ctx, "openai-session", chunks)
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	for transcript := range out {
+		t.Fatalf("expected no transcripts, got %+v", transcript)
+	}
+	var stageErr *statuspkg.StageError
+	if !errors.As(reported, &stageErr) || stageErr.Code != statuspkg.CodeASRFailed || stageErr.Retryable {
+		t.Fatalf("expected a permanent recognition failure, got %v", reported)
+	}
+	if attempts.Load() != 1 {
+		t.Fatalf("expected no retries of a rejected request, got %d attempts", attempts.Load())
+	}
+	if health := recognizer.Health(); health.Healthy {
+		t.Fatalf("expected the failure to show in health, got %+v", health)
+	}
+}
+
+func TestTrimWindowDropsOverlapAndPadding(t *testing.T) {
+	t.Parallel()
+
+	window := media.AudioChunk{
+		Timestamp:  time.Second,
+		SampleRate: 1000,
+		Channels:   1,
+		PCMData:    make([]byte, 2*2000),
+		Duration:   2 * time.Second,
+		Window:     &media.WindowAlignment{Index: 1, Overlap: 500 * time.Millisecond, Padding: 250 * time.Millisecond},
+	}
+	trimmed := trimWindow(window)
+	if trimmed.Timestamp != 1500*time.Millisecond || trimmed.Duration != 1250*time.Millisecond || len(trimmed.PCMData) != 2*1250 {
+		t.Fatalf("unexpected trimmed window at %s lasting %s with %d bytes", trimmed.Timestamp, trimmed.Duration, len(trimmed.PCMData))
+	}
+}
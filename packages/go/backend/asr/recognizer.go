@@ -30,6 +30,17 @@ type Transcript struct {
 	Language string `json:"language"`
 	// Words contains word-level timing for subtitle alignment.
 	Words []Word `json:"words,omitempty"`
+	// Partial marks an unstable hypothesis for a segment that is still being
+	// spoken. Later transcripts refine it until one with Partial unset
+	// finalizes the segment.
+	Partial bool `json:"partial,omitempty"`
+	// Stable is the number of leading words of a partial transcript that a
+	// Stabilizer found settled. Later partials of the segment keep them.
+	Stable int `json:"stable,omitempty"`
+	// Speaker labels who spoke the segment, such as "S1", when the
+	// recognizer or a diarization stage attributes speakers. Labels are
+	// only meaningful within a session.
+	Speaker string `json:"speaker,omitempty"`
 }
 
 // ModelProfile specifies the ASR model configuration.
@@ -0,0 +1,59 @@
+package asr
+
+import (
+	"fmt"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+const (
+	// segmentSampleRate is the sample rate segments are transcribed at.
+	segmentSampleRate = 16000
+	// segmentTolerance is how far a chunk may start from where the audio
+	// collected so far ends and still continue it.
+	segmentTolerance = 20 * time.Millisecond
+)
+
+// audioSegment is audio collected to be transcribed at once.
+type audioSegment struct {
+	start                time.Duration
+	sampleRate, channels int
+	pcm                  []byte
+	// length is the duration of the audio to transcribe, and skip the
+	// duration at its start that was transcribed before.
+	length, skip time.Duration
+}
+
+func newAudioSegment(chunk media.AudioChunk) *audioSegment {
+	segment := &audioSegment{start: chunk.Timestamp, sampleRate: chunk.SampleRate, channels: chunk.Channels}
+	segment.add(chunk)
+	return segment
+}
+
+// continues reports whether chunk carries on the audio of the segment.
+func (s *audioSegment) continues(chunk media.AudioChunk) bool {
+	gap := chunk.Timestamp - (s.start + s.length)
+	return chunk.SampleRate == s.sampleRate && chunk.Channels == s.channels && gap <= segmentTolerance && gap >= -segmentTolerance
+}
+
+func (s *audioSegment) add(chunk media.AudioChunk) {
+	frameSize := 2 * s.channels
+	s.pcm = append(s.pcm, chunk.PCMData[:len(chunk.PCMData)/frameSize*frameSize]...)
+	s.length = time.Duration(len(s.pcm)/frameSize) * time.Second / time.Duration(s.sampleRate)
+}
+
+// wav returns the segment as a 16kHz mono WAV file, the format Whisper
+// models are trained on.
+func (s *audioSegment) wav() ([]byte, error) {
+	mono := media.Downmix(media.AudioChunk{SampleRate: s.sampleRate, Channels: s.channels, PCMData: s.pcm})
+	pcm := mono.PCMData
+	if s.sampleRate != segmentSampleRate {
+		resampler, err := media.NewResampler(media.ResamplerConfig{InputRate: s.sampleRate, OutputRate: segmentSampleRate})
+		if err != nil {
+			return nil, fmt.Errorf("resample audio: %w", err)
+		}
+		pcm = append(resampler.Process(pcm), resampler.Flush()...)
+	}
+	return append(media.WAVHeader(segmentSampleRate, 1, int64(len(pcm))), pcm...), nil
+}
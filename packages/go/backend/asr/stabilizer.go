@@ -0,0 +1,141 @@
+package asr
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+// DefaultStabilizationWindow is how much later audio a word must survive
+// before it is stable, when a StabilizationPolicy does not say.
+const DefaultStabilizationWindow = 800 * time.Millisecond
+
+// StabilizationPolicy decides when the words of partial transcripts stop
+// changing, trading latency against how often subtitles are rewritten.
+type StabilizationPolicy struct {
+	// Window is how much audio after a word the recognizer must have heard,
+	// without revising the word, before the word is stable. Defaults to
+	// DefaultStabilizationWindow.
+	Window time.Duration
+	// MinInterval spaces the partial transcripts of a segment: a partial
+	// ending less than MinInterval of audio after the previous one is
+	// dropped, unless it makes more words stable or is the segment's first.
+	// Zero keeps every partial.
+	MinInterval time.Duration
+}
+
+// PartialRecognizer is implemented by recognizers that can emit partial
+// transcripts for the low-latency subtitle path.
+type PartialRecognizer interface {
+	Recognizer
+
+	// RecognizePartial behaves like Recognize, and also emits partial
+	// transcripts while a segment is still being spoken. Partials of a
+	// segment share its StartTime and carry the number of their leading
+	// words that policy made stable; the segment ends with a final
+	// transcript, with Partial unset, which may still revise any word.
+	RecognizePartial(ctx context.Context, sessionID string, chunks <-chan media.AudioChunk, policy StabilizationPolicy) (<-chan Transcript, error)
+}
+
+// Stabilizer applies a StabilizationPolicy to the partial transcripts of a
+// recognizer. A word of a partial is stable once it ends at least
+// policy.Window before the partial does and the previous partial of the
+// segment had the same word in the same place. Stable words are kept: later
+// partials that revise them have them restored, so a subtitle showing them
+// never changes them before the final transcript.
+//
+// Transcripts of one segment share a StartTime; a final transcript or a
+// partial with another StartTime starts the next segment. A Stabilizer is
+// not safe for concurrent use.
+type Stabilizer struct {
+	policy StabilizationPolicy
+
+	// start identifies the current segment. stable holds its stable words,
+	// previous the words of its latest partial, and emitted the end of the
+	// latest partial emitted.
+	start    time.Duration
+	open     bool
+	stable   []string
+	previous []string
+	emitted  time.Duration
+}
+
+// NewStabilizer returns a stabilizer for one stream of transcripts.
+func NewStabilizer(policy StabilizationPolicy) *Stabilizer {
+	if policy.Window <= 0 {
+		policy.Window = DefaultStabilizationWindow
+	}
+	return &Stabilizer{policy: policy}
+}
+
+// Push returns transcript with its stable words set, and reports false when
+// the policy drops it. Final transcripts always pass unchanged.
+func (s *Stabilizer) Push(transcript Transcript) (Transcript, bool) {
+	if !transcript.Partial {
+		s.open = false
+		return transcript, true
+	}
+	first := !s.open || transcript.StartTime != s.start
+	if first {
+		s.start, s.open = transcript.StartTime, true
+		s.stable, s.previous = nil, nil
+	}
+
+	words := strings.Fields(transcript.Text)
+	if len(words) < len(s.stable) {
+		words = append(words[:0:0], s.stable...)
+	} else {
+		words = append(append(words[:0:0], s.stable...), words[len(s.stable):]...)
+	}
+	stable := len(s.stable)
+	for stable < len(words) && stable < len(s.previous) && words[stable] == s.previous[stable] &&
+		transcript.EndTime-wordEnd(transcript, stable, len(words)) >= s.policy.Window {
+		stable++
+	}
+	s.previous = words
+
+	grew := stable > len(s.stable)
+	s.stable = words[:stable:stable]
+	if !first && !grew && s.policy.MinInterval > 0 && transcript.EndTime-s.emitted < s.policy.MinInterval {
+		return Transcript{}, false
+	}
+	s.emitted = transcript.EndTime
+	transcript.Text = strings.Join(words, " ")
+	transcript.Stable = stable
+	return transcript, true
+}
+
+// wordEnd returns when word i of the n words of transcript ends: from its
+// word timings when they cover every word, otherwise by spreading the words
+// evenly over the transcript.
+func wordEnd(transcript Transcript, i, n int) time.Duration {
+	if len(transcript.Words) == n {
+		return transcript.Words[i].EndTime
+	}
+	span := transcript.EndTime - transcript.StartTime
+	return transcript.StartTime + span*time.Duration(i+1)/time.Duration(n)
+}
+
+// Stabilize applies policy to the transcripts from in, for recognizers that
+// implement RecognizePartial by stabilizing the partials of Recognize.
+func Stabilize(ctx context.Context, in <-chan Transcript, policy StabilizationPolicy) <-chan Transcript {
+	out := make(chan Transcript)
+	go func() {
+		defer close(out)
+		stabilizer := NewStabilizer(policy)
+		for transcript := range in {
+			transcript, ok := stabilizer.Push(transcript)
+			if !ok {
+				continue
+			}
+			select {
+			case out <- transcript:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,92 @@
+package asr
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+func partial(text string, start, end time.Duration) Transcript {
+	return Transcript{Text: text, StartTime: start, EndTime: end, Partial: true}
+}
+
+func TestStabilizerKeepsStableWords(t *testing.T) {
+	t.Parallel()
+
+	stabilizer := NewStabilizer(StabilizationPolicy{Window: 500 * time.Millisecond})
+	steps := []struct {
+		in     Transcript
+		text   string
+		stable int
+	}{
+		{partial("the cat", 0, time.Second), "the cat", 0},
+		// Both words were heard before and end at least 500ms before the
+		// partial does; "sat" is new.
+		{partial("the cat sat", 0, 1500*time.Millisecond), "the cat sat", 2},
+		// The revision of a stable word is undone.
+		{partial("a cat sat on", 0, 2*time.Second), "the cat sat on", 3},
+		// The final transcript may revise anything.
+		{Transcript{Text: "a cat sat on the mat", EndTime: 3 * time.Second}, "a cat sat on the mat", 0},
+		// A new segment starts without stable words.
+		{partial("it", 3*time.Second, 4*time.Second), "it", 0},
+	}
+	for i, step := range steps {
+		got, ok := stabilizer.Push(step.in)
+		if !ok {
+			t.Fatalf("step %d: expected the transcript to pass", i)
+		}
+		if got.Text != step.text || got.Stable != step.stable || got.Partial != step.in.Partial {
+			t.Fatalf("step %d: expected %q with %d stable words, got %q with %d", i, step.text, step.stable, got.Text, got.Stable)
+		}
+	}
+}
+
+func TestStabilizerSpacesPartials(t *testing.T) {
+	t.Parallel()
+
+	stabilizer := NewStabilizer(StabilizationPolicy{Window: time.Minute, MinInterval: time.Second})
+	var kept []time.Duration
+	for _, end := range []time.Duration{200 * time.Millisecond, 600 * time.Millisecond, 1300 * time.Millisecond, 1500 * time.Millisecond} {
+		if got, ok := stabilizer.Push(partial("one two", 0, end)); ok {
+			kept = append(kept, got.EndTime)
+		}
+	}
+	if want := []time.Duration{200 * time.Millisecond, 1300 * time.Millisecond}; !reflect.DeepEqual(kept, want) {
+		t.Fatalf("expected partials ending at %v, got %v", want, kept)
+	}
+}
+
+func TestStubRecognizerRecognizePartial(t *testing.T) {
+	t.Parallel()
+
+	var recognizer PartialRecognizer = NewStubRecognizer(&StubRecognizerConfig{
+		DefaultLanguage: "en",
+		Transcripts:     map[int]string{0: "one two three four"},
+	})
+	chunks := make(chan media.AudioChunk, 1)
+	chunks <- media.AudioChunk{Duration: 400 * time.Millisecond}
+	close(chunks)
+
+	out, err := recognizer.RecognizePartial(context.Background(), "partial-session", chunks, StabilizationPolicy{Window: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("RecognizePartial: %v", err)
+	}
+	var stable []int
+	var final Transcript
+	for transcript := range out {
+		if !transcript.Partial {
+			final = transcript
+			continue
+		}
+		stable = append(stable, transcript.Stable)
+	}
+	if want := []int{0, 1, 2}; !reflect.DeepEqual(stable, want) {
+		t.Fatalf("expected stable word counts %v, got %v", want, stable)
+	}
+	if final.Text != "one two three four" || final.SessionID != "partial-session" {
+		t.Fatalf("unexpected final transcript %+v", final)
+	}
+}
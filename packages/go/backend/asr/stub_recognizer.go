@@ -2,6 +2,7 @@ package asr
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"streamlation/packages/backend/media"
@@ -18,6 +19,9 @@ type StubRecognizerConfig struct {
 	Transcripts map[int]string
 	// ErrorAfter causes an error after N transcripts (0 = no error).
 	ErrorAfter int
+	// Partials emits a partial transcript for each growing prefix of a
+	// chunk's words before its final transcript.
+	Partials bool
 }
 
 // DefaultStubRecognizerConfig returns sensible defaults for testing.
@@ -91,12 +95,22 @@ func (s *StubRecognizer) Recognize(ctx context.Context, sessionID string, chunks
 				StartTime:  chunk.Timestamp,
 				EndTime:    chunk.Timestamp + chunk.Duration,
 				Confidence: 0.95,
-				Language:   s.config.DefaultLanguage,
+				Language:   sessionLanguage(ctx, s.config.DefaultLanguage),
 				Words: []Word{
 					{Text: text, StartTime: chunk.Timestamp, EndTime: chunk.Timestamp + chunk.Duration},
 				},
 			}
 
+			if s.config.Partials {
+				for _, partial := range partialTranscripts(transcript) {
+					select {
+					case out <- partial:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+
 			select {
 			case out <- transcript:
 				chunkIndex++
@@ -109,6 +123,38 @@ func (s *StubRecognizer) Recognize(ctx context.Context, sessionID string, chunks
 	return out, nil
 }
 
+// RecognizePartial emits a partial transcript for each growing prefix of
+// every chunk's words, stabilized by policy, before its final transcript.
+func (s *StubRecognizer) RecognizePartial(ctx context.Context, sessionID string, chunks <-chan media.AudioChunk, policy StabilizationPolicy) (<-chan Transcript, error) {
+	config := *s.config
+	config.Partials = true
+	transcripts, err := (&StubRecognizer{config: &config, modelLoaded: s.modelLoaded}).Recognize(ctx, sessionID, chunks)
+	if err != nil {
+		return nil, err
+	}
+	return Stabilize(ctx, transcripts, policy), nil
+}
+
+// partialTranscripts returns the hypotheses leading up to final, one per
+// prefix of its words, with the end time spread evenly across them.
+func partialTranscripts(final Transcript) []Transcript {
+	words := strings.Fields(final.Text)
+	if len(words) < 2 {
+		return nil
+	}
+	partials := make([]Transcript, 0, len(words)-1)
+	span := final.EndTime - final.StartTime
+	for n := 1; n < len(words); n++ {
+		partial := final
+		partial.Text = strings.Join(words[:n], " ")
+		partial.EndTime = final.StartTime + span*time.Duration(n)/time.Duration(len(words))
+		partial.Words = []Word{{Text: partial.Text, StartTime: partial.StartTime, EndTime: partial.EndTime}}
+		partial.Partial = true
+		partials = append(partials, partial)
+	}
+	return partials
+}
+
 // Health returns the health status of the stub recognizer.
 func (s *StubRecognizer) Health() HealthStatus {
 	return HealthStatus{
@@ -60,6 +60,49 @@ func TestStubRecognizer_Recognize(t *testing.T) {
 	}
 }
 
+func TestStubRecognizer_RecognizePartials(t *testing.T) {
+	t.Parallel()
+
+	recognizer := NewStubRecognizer(&StubRecognizerConfig{
+		DefaultLanguage: "en",
+		Transcripts:     map[int]string{0: "This is a test."},
+		Partials:        true,
+	})
+
+	chunks := make(chan media.AudioChunk, 1)
+	chunks <- media.AudioChunk{Timestamp: time.Second, Duration: 400 * time.Millisecond}
+	close(chunks)
+
+	transcripts, err := recognizer.Recognize(context.Background(), "test-session", chunks)
+	if err != nil {
+		t.Fatalf("Recognize failed: %v", err)
+	}
+
+	var received []Transcript
+	for transcript := range transcripts {
+		received = append(received, transcript)
+	}
+
+	expectedTexts := []string{"This", "This is", "This is a", "This is a test."}
+	if len(received) != len(expectedTexts) {
+		t.Fatalf("expected %d transcripts, got %d", len(expectedTexts), len(received))
+	}
+	for i, transcript := range received {
+		if transcript.Text != expectedTexts[i] {
+			t.Errorf("transcript %d: expected text %q, got %q", i, expectedTexts[i], transcript.Text)
+		}
+		if final := i == len(received)-1; transcript.Partial == final {
+			t.Errorf("transcript %d: expected partial=%v", i, !final)
+		}
+		if transcript.StartTime != time.Second {
+			t.Errorf("transcript %d: expected start 1s, got %v", i, transcript.StartTime)
+		}
+	}
+	if received[0].EndTime != 1100*time.Millisecond || received[3].EndTime != 1400*time.Millisecond {
+		t.Errorf("expected end times to grow with the hypothesis, got %v and %v", received[0].EndTime, received[3].EndTime)
+	}
+}
+
 func TestStubRecognizer_LoadModel(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,31 @@
+package asr
+
+import (
+	"context"
+	"strings"
+)
+
+type vocabularyKey struct{}
+
+// WithVocabulary returns a context carrying the names and terms of a
+// session. Recognizers that support biasing favour them when the audio is
+// ambiguous: whisper.cpp and OpenAI-compatible services receive them as a
+// prompt, and gRPC services as phrase hints.
+func WithVocabulary(ctx context.Context, terms []string) context.Context {
+	if len(terms) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, vocabularyKey{}, terms)
+}
+
+// sessionVocabulary returns the terms ctx carries.
+func sessionVocabulary(ctx context.Context) []string {
+	terms, _ := ctx.Value(vocabularyKey{}).([]string)
+	return terms
+}
+
+// vocabularyPrompt returns the terms of ctx as a prompt for recognizers
+// biased by text that precedes the audio, or "" without terms.
+func vocabularyPrompt(ctx context.Context) string {
+	return strings.Join(sessionVocabulary(ctx), ", ")
+}
@@ -0,0 +1,396 @@
+package asr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/media"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// Defaults of WhisperConfig.
+const (
+	// DefaultWhisperCommand is whisper.cpp's command-line tool.
+	DefaultWhisperCommand = "whisper-cli"
+	// DefaultWhisperSegment is how much audio that is not cut into windows
+	// is collected for each run of whisper.cpp.
+	DefaultWhisperSegment = 5 * time.Second
+)
+
+// WhisperConfig configures a WhisperRecognizer. Zero values fall back to
+// the defaults.
+type WhisperConfig struct {
+	// Command runs whisper.cpp's command-line tool: the binary, followed by
+	// any arguments that precede whisper's own, such as those of a wrapper
+	// that runs it in a container. Defaults to DefaultWhisperCommand.
+	Command []string
+	// Model is the ggml model file used until a profile is loaded, and for
+	// profiles without an entry in Models.
+	Model string
+	// Models maps model profiles to the ggml model files that serve them.
+	Models map[ModelProfile]string
+	// Language is the spoken language as an ISO 639-1 code, or "auto", the
+	// default, to have whisper.cpp detect it. A session's LanguageLock takes
+	// precedence from the next segment once it is set.
+	Language string
+	// Threads is the number of threads whisper.cpp uses. Zero leaves the
+	// tool's default.
+	Threads int
+	// Segment is how much audio is collected before it is transcribed, for
+	// audio that a Windower has not already cut into windows.
+	Segment time.Duration
+	// TempDir holds the files exchanged with whisper.cpp. Defaults to the
+	// system's temporary directory.
+	TempDir string
+	// Batcher, when set, transcribes segments in batches shared with the
+	// other sessions that use it, such as those of a GPU-backed
+	// whisper.cpp, instead of running whisper.cpp for each segment.
+	Batcher *Batcher
+}
+
+// WhisperRecognizer transcribes audio on the host with whisper.cpp, running
+// its command-line tool once per segment of audio and mapping the segments
+// it recognizes, with their word timestamps, to transcripts.
+//
+// Windowed audio is transcribed a window at a time. Segments that lie in a
+// window's overlap, which the previous window already transcribed, and in
+// its padding are dropped. Other audio is collected into segments of
+// cfg.Segment, ending early at a gap or a change of format. whisper.cpp is
+// given 16kHz mono, to which audio is mixed down and resampled as needed.
+//
+// With a Batcher, the segments of the sessions sharing it are transcribed
+// together, in one run of whisper.cpp per batch, which keeps a GPU busy when
+// many sessions each send little audio.
+//
+// A failing run of whisper.cpp ends the stream with ASR_RECOGNITION_FAILED,
+// reported through statuspkg.ReportStageError.
+type WhisperRecognizer struct {
+	cfg WhisperConfig
+
+	mu    sync.RWMutex
+	model string
+}
+
+// NewWhisperRecognizer returns a recognizer that runs whisper.cpp as cfg
+// describes.
+func NewWhisperRecognizer(cfg WhisperConfig) *WhisperRecognizer {
+	if len(cfg.Command) == 0 {
+		cfg.Command = []string{DefaultWhisperCommand}
+	}
+	if cfg.Language == "" {
+		cfg.Language = "auto"
+	}
+	if cfg.Segment <= 0 {
+		cfg.Segment = DefaultWhisperSegment
+	}
+	return &WhisperRecognizer{cfg: cfg, model: cfg.Model}
+}
+
+// LoadModel selects the model file of profile for the segments transcribed
+// from now on. The file must exist.
+func (w *WhisperRecognizer) LoadModel(profile ModelProfile) error {
+	model := w.cfg.Models[profile]
+	if model == "" {
+		model = w.cfg.Model
+	}
+	if model == "" {
+		return fmt.Errorf("no whisper model configured for profile %s", profile)
+	}
+	if _, err := os.Stat(model); err != nil {
+		return fmt.Errorf("load whisper model: %w", err)
+	}
+	w.mu.Lock()
+	w.model = model
+	w.mu.Unlock()
+	return nil
+}
+
+// Recognize transcribes the audio from chunks.
+func (w *WhisperRecognizer) Recognize(ctx context.Context, sessionID string, chunks <-chan media.AudioChunk) (<-chan Transcript, error) {
+	if w.currentModel() == "" {
+		return nil, errors.New("no whisper model loaded")
+	}
+	out := make(chan Transcript)
+	go func() {
+		defer close(out)
+
+		transcribe := func(segment *audioSegment) bool {
+			if segment == nil {
+				return true
+			}
+			transcripts, err := w.transcribe(ctx, sessionID, segment)
+			if err != nil {
+				if ctx.Err() == nil {
+					statuspkg.ReportStageError(ctx, &statuspkg.StageError{Code: statuspkg.CodeASRFailed, Err: err})
+				}
+				return false
+			}
+			for _, transcript := range transcripts {
+				select {
+				case out <- transcript:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
+		var pending *audioSegment
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk, ok := <-chunks:
+				if !ok {
+					transcribe(pending)
+					return
+				}
+				if chunk.SampleRate <= 0 || chunk.Channels <= 0 || len(chunk.PCMData) == 0 {
+					continue
+				}
+				if chunk.Window != nil {
+					if !transcribe(pending) {
+						return
+					}
+					pending = nil
+					window := newAudioSegment(chunk)
+					window.skip = chunk.Window.Overlap
+					window.length -= chunk.Window.Padding
+					if !transcribe(window) {
+						return
+					}
+					continue
+				}
+				if pending != nil && !pending.continues(chunk) {
+					if !transcribe(pending) {
+						return
+					}
+					pending = nil
+				}
+				if pending == nil {
+					pending = newAudioSegment(chunk)
+				} else {
+					pending.add(chunk)
+				}
+				if pending.length >= w.cfg.Segment {
+					if !transcribe(pending) {
+						return
+					}
+					pending = nil
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Health reports whether whisper.cpp can be run and a model is selected.
+func (w *WhisperRecognizer) Health() HealthStatus {
+	model := w.currentModel()
+	if _, err := exec.LookPath(w.cfg.Command[0]); err != nil {
+		return HealthStatus{Message: fmt.Sprintf("whisper.cpp not found: %v", err), ModelLoaded: model != ""}
+	}
+	if model == "" {
+		return HealthStatus{Message: "no whisper model loaded"}
+	}
+	return HealthStatus{Healthy: true, Message: "whisper.cpp ready with " + filepath.Base(model), ModelLoaded: true}
+}
+
+func (w *WhisperRecognizer) currentModel() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.model
+}
+
+// transcribe runs whisper.cpp on segment, through cfg.Batcher when it is
+// set, and returns the transcripts of the speech in it that was not
+// transcribed before.
+func (w *WhisperRecognizer) transcribe(ctx context.Context, sessionID string, segment *audioSegment) ([]Transcript, error) {
+	if segment.length <= segment.skip {
+		return nil, nil
+	}
+	request := BatchRequest{
+		SessionID: sessionID,
+		Model:     w.currentModel(),
+		Language:  sessionLanguage(ctx, w.cfg.Language),
+		Prompt:    vocabularyPrompt(ctx),
+		Audio:     media.AudioChunk{Timestamp: segment.start, SampleRate: segment.sampleRate, Channels: segment.channels, PCMData: segment.pcm},
+		Skip:      segment.skip,
+		Length:    segment.length,
+	}
+	if w.cfg.Batcher != nil {
+		return w.cfg.Batcher.Recognize(ctx, request)
+	}
+	transcripts, err := w.RecognizeBatch(ctx, []BatchRequest{request})
+	if err != nil {
+		return nil, err
+	}
+	return transcripts[0], nil
+}
+
+// RecognizeBatch transcribes requests in a single run of whisper.cpp,
+// which loads the model once for all of them. The requests must agree on
+// their model, language, and prompt, as those of a Batcher's batch do.
+func (w *WhisperRecognizer) RecognizeBatch(ctx context.Context, requests []BatchRequest) ([][]Transcript, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	dir, err := os.MkdirTemp(w.cfg.TempDir, "whisper-")
+	if err != nil {
+		return nil, fmt.Errorf("create whisper directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := requests[0]
+	args := append(append([]string(nil), w.cfg.Command[1:]...), "-m", first.Model, "-ojf", "-np", "-l", first.Language)
+	if w.cfg.Threads > 0 {
+		args = append(args, "-t", strconv.Itoa(w.cfg.Threads))
+	}
+	if first.Prompt != "" {
+		args = append(args, "--prompt", first.Prompt)
+	}
+	segments := make([]*audioSegment, len(requests))
+	outputs := make([]string, len(requests))
+	for i, request := range requests {
+		segments[i] = &audioSegment{
+			start:      request.Audio.Timestamp,
+			sampleRate: request.Audio.SampleRate,
+			channels:   request.Audio.Channels,
+			pcm:        request.Audio.PCMData,
+			length:     request.Length,
+			skip:       request.Skip,
+		}
+		audio, err := segments[i].wav()
+		if err != nil {
+			return nil, err
+		}
+		input := filepath.Join(dir, fmt.Sprintf("segment-%d.wav", i))
+		outputs[i] = filepath.Join(dir, fmt.Sprintf("segment-%d", i))
+		if err := os.WriteFile(input, audio, 0o600); err != nil {
+			return nil, fmt.Errorf("write whisper input: %w", err)
+		}
+		args = append(args, "-f", input, "-of", outputs[i])
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, w.cfg.Command[0], args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return nil, fmt.Errorf("run whisper.cpp: %w: %s", err, lastLine(detail))
+		}
+		return nil, fmt.Errorf("run whisper.cpp: %w", err)
+	}
+
+	results := make([][]Transcript, len(requests))
+	for i, request := range requests {
+		raw, err := os.ReadFile(outputs[i] + ".json")
+		if err != nil {
+			return nil, fmt.Errorf("read whisper output: %w", err)
+		}
+		var result whisperOutput
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return nil, fmt.Errorf("decode whisper output: %w", err)
+		}
+		language := request.Language
+		if language == "auto" {
+			language = result.Result.Language
+		}
+		for _, recognized := range result.Transcription {
+			transcript, ok := recognized.transcript(segments[i])
+			if !ok {
+				continue
+			}
+			transcript.SessionID, transcript.Language = request.SessionID, language
+			results[i] = append(results[i], transcript)
+		}
+	}
+	return results, nil
+}
+
+func lastLine(text string) string {
+	return text[strings.LastIndexByte(text, '\n')+1:]
+}
+
+// whisperOutput is the document whisper.cpp writes with -ojf.
+type whisperOutput struct {
+	Result struct {
+		Language string `json:"language"`
+	} `json:"result"`
+	Transcription []whisperRecognized `json:"transcription"`
+}
+
+// whisperRecognized is a segment of speech whisper.cpp recognized, timed in
+// milliseconds from the start of its input.
+type whisperRecognized struct {
+	Offsets whisperOffsets `json:"offsets"`
+	Text    string         `json:"text"`
+	Tokens  []whisperToken `json:"tokens"`
+}
+
+type whisperOffsets struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+type whisperToken struct {
+	Text    string         `json:"text"`
+	Offsets whisperOffsets `json:"offsets"`
+	P       float64        `json:"p"`
+}
+
+// transcript maps the recognized speech to a transcript of segment. It
+// reports false for speech in the segment's overlap or padding, and for
+// annotations such as [BLANK_AUDIO] that are not speech.
+func (r whisperRecognized) transcript(segment *audioSegment) (Transcript, bool) {
+	text := strings.TrimSpace(r.Text)
+	if text == "" || strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+		return Transcript{}, false
+	}
+	from, to := whisperOffset(r.Offsets.From), min(whisperOffset(r.Offsets.To), segment.length)
+	if (from+to)/2 < segment.skip || from >= segment.length {
+		return Transcript{}, false
+	}
+
+	transcript := Transcript{Text: text, StartTime: segment.start + from, EndTime: segment.start + to}
+	var confidence float64
+	tokens := 0
+	for _, token := range r.Tokens {
+		// Special tokens, such as [_BEG_] and timestamps, are not text.
+		if strings.HasPrefix(token.Text, "[_") || token.Text == "" {
+			continue
+		}
+		confidence += token.P
+		tokens++
+		start := segment.start + whisperOffset(token.Offsets.From)
+		end := segment.start + min(whisperOffset(token.Offsets.To), segment.length)
+		// Tokens starting with a space start a word; others continue it.
+		if word := strings.TrimSpace(token.Text); strings.HasPrefix(token.Text, " ") || len(transcript.Words) == 0 {
+			if word != "" {
+				transcript.Words = append(transcript.Words, Word{Text: word, StartTime: start, EndTime: end})
+			}
+		} else {
+			last := &transcript.Words[len(transcript.Words)-1]
+			last.Text += word
+			last.EndTime = max(last.EndTime, end)
+		}
+	}
+	if tokens > 0 {
+		transcript.Confidence = confidence / float64(tokens)
+	}
+	return transcript, true
+}
+
+func whisperOffset(milliseconds int64) time.Duration {
+	return time.Duration(milliseconds) * time.Millisecond
+}
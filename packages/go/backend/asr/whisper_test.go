@@ -0,0 +1,270 @@
+package asr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// TestWhisperHelperProcess stands in for whisper.cpp when the test binary
+// is run as a WhisperRecognizer's command. It transcribes every input as
+// "Hello world." spoken over its first second. With -runs, it appends the
+// number of inputs of each run to the file it names.
+func TestWhisperHelperProcess(t *testing.T) {
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return
+	}
+	flags := make(map[string]string)
+	var inputs, outputs []string
+	for i := 1; i+1 < len(args); i++ {
+		flags[args[i]] = args[i+1]
+		switch args[i] {
+		case "-f":
+			inputs = append(inputs, args[i+1])
+		case "-of":
+			outputs = append(outputs, args[i+1])
+		}
+	}
+	if filepath.Base(flags["-m"]) != "ggml-base.bin" {
+		os.Stderr.WriteString("error: failed to load model\n")
+		os.Exit(1)
+	}
+	for _, input := range inputs {
+		if info, err := os.Stat(input); err != nil || info.Size() <= 44 {
+			os.Stderr.WriteString("error: failed to read input\n")
+			os.Exit(1)
+		}
+	}
+	if runs := flags["-runs"]; runs != "" {
+		file, err := os.OpenFile(runs, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			os.Exit(1)
+		}
+		fmt.Fprintln(file, len(inputs))
+		file.Close()
+	}
+	result := map[string]any{
+		"result": map[string]any{"language": "en"},
+		"transcription": []map[string]any{
+			{
+				"offsets": map[string]any{"from": 0, "to": 1000},
+				"text":    " Hello world.",
+				"tokens": []map[string]any{
+					{"text": "[_BEG_]", "offsets": map[string]any{"from": 0, "to": 0}, "p": 0.99},
+					{"text": " Hello", "offsets": map[string]any{"from": 0, "to": 400}, "p": 0.9},
+					{"text": " wor", "offsets": map[string]any{"from": 400, "to": 700}, "p": 0.8},
+					{"text": "ld", "offsets": map[string]any{"from": 700, "to": 900}, "p": 0.7},
+					{"text": ".", "offsets": map[string]any{"from": 900, "to": 1000}, "p": 0.6},
+				},
+			},
+			{
+				"offsets": map[string]any{"from": 1000, "to": 2000},
+				"text":    " [BLANK_AUDIO]",
+			},
+		},
+	}
+	raw, _ := json.Marshal(result)
+	for _, output := range outputs {
+		if err := os.WriteFile(output+".json", raw, 0o600); err != nil {
+			os.Exit(1)
+		}
+	}
+	os.Exit(0)
+}
+
+func newTestWhisper(t *testing.T, cfg WhisperConfig) *WhisperRecognizer {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"ggml-base.bin", "ggml-tiny.bin"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("model"), 0o600); err != nil {
+			t.Fatalf("write model: %v", err)
+		}
+	}
+	cfg.Command = []string{os.Args[0], "-test.run=TestWhisperHelperProcess", "--"}
+	cfg.Model = filepath.Join(dir, "ggml-base.bin")
+	cfg.Models = map[ModelProfile]string{
+		ModelCPUBasic: filepath.Join(dir, "ggml-tiny.bin"),
+		ModelGPU:      filepath.Join(dir, "missing.bin"),
+	}
+	cfg.TempDir = dir
+	return NewWhisperRecognizer(cfg)
+}
+
+func TestWhisperRecognizerMapsSegmentsToTranscripts(t *testing.T) {
+	t.Parallel()
+
+	recognizer := newTestWhisper(t, WhisperConfig{})
+	chunks := make(chan media.AudioChunk, 3)
+	// Two seconds of 8kHz stereo, in chunks that continue each other.
+	for i := 0; i < 2; i++ {
+		chunks <- media.AudioChunk{
+			Timestamp:  2*time.Second + time.Duration(i)*time.Second,
+			SampleRate: 8000,
+			Channels:   2,
+			PCMData:    make([]byte, 8000*4),
+			Duration:   time.Second,
+		}
+	}
+	close(chunks)
+
+	out, err := recognizer.Recognize(context.Background(), "whisper-session", chunks)
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	var transcripts []Transcript
+	for transcript := range out {
+		transcripts = append(transcripts, transcript)
+	}
+	if len(transcripts) != 1 {
+		t.Fatalf("expected one transcript, got %+v", transcripts)
+	}
+	got := transcripts[0]
+	if got.SessionID != "whisper-session" || got.Text != "Hello world." || got.Language != "en" {
+		t.Fatalf("unexpected transcript %+v", got)
+	}
+	if got.StartTime != 2*time.Second || got.EndTime != 3*time.Second {
+		t.Fatalf("expected the transcript to span 2s-3s, got %s-%s", got.StartTime, got.EndTime)
+	}
+	if got.Confidence < 0.749 || got.Confidence > 0.751 {
+		t.Fatalf("expected the mean token probability, got %f", got.Confidence)
+	}
+	want := []Word{
+		{Text: "Hello", StartTime: 2 * time.Second, EndTime: 2400 * time.Millisecond},
+		{Text: "world.", StartTime: 2400 * time.Millisecond, EndTime: 3 * time.Second},
+	}
+	if !reflect.DeepEqual(got.Words, want) {
+		t.Fatalf("expected words %+v, got %+v", want, got.Words)
+	}
+}
+
+func TestWhisperRecognizerSkipsWindowOverlap(t *testing.T) {
+	t.Parallel()
+
+	recognizer := newTestWhisper(t, WhisperConfig{})
+	chunks := make(chan media.AudioChunk, 2)
+	for i, overlap := range []time.Duration{0, time.Second} {
+		chunks <- media.AudioChunk{
+			Timestamp:  time.Duration(i) * time.Second,
+			SampleRate: 16000,
+			Channels:   1,
+			PCMData:    make([]byte, 2*16000*2),
+			Duration:   2 * time.Second,
+			Window:     &media.WindowAlignment{Index: int64(i), Overlap: overlap},
+		}
+	}
+	close(chunks)
+
+	out, err := recognizer.Recognize(context.Background(), "whisper-session", chunks)
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	var starts []time.Duration
+	for transcript := range out {
+		starts = append(starts, transcript.StartTime)
+	}
+	// The second window's speech lies in the overlap the first transcribed.
+	if want := []time.Duration{0}; !reflect.DeepEqual(starts, want) {
+		t.Fatalf("expected transcripts starting at %v, got %v", want, starts)
+	}
+}
+
+func TestWhisperRecognizerLoadsModelPerProfile(t *testing.T) {
+	t.Parallel()
+
+	recognizer := newTestWhisper(t, WhisperConfig{})
+	if err := recognizer.LoadModel(ModelCPUAdvanced); err != nil {
+		t.Fatalf("LoadModel falls back to the default model: %v", err)
+	}
+	if err := recognizer.LoadModel(ModelGPU); err == nil {
+		t.Fatal("expected an error for a missing model file")
+	}
+	if err := recognizer.LoadModel(ModelCPUBasic); err != nil {
+		t.Fatalf("LoadModel: %v", err)
+	}
+	if health := recognizer.Health(); !health.ModelLoaded {
+		t.Fatalf("expected the model to be loaded, got %+v", health)
+	}
+
+	// The helper only accepts ggml-base.bin, so runs with the tiny model fail.
+	chunks := make(chan media.AudioChunk, 1)
+	chunks <- media.AudioChunk{SampleRate: 16000, Channels: 1, PCMData: make([]byte, 3200), Duration: 100 * time.Millisecond}
+	close(chunks)
+	var reported error
+	ctx := statuspkg.WithStageErrorReporter(context.Background(), func(err error) { reported = err })
+	out, err := recognizer.Recognize(ctx, "whisper-session", chunks)
+	if err != nil {
+		t.Fatalf("Recognize: %v", err)
+	}
+	for transcript := range out {
+		t.Fatalf("expected no transcripts from a failing run, got %+v", transcript)
+	}
+	var stageErr *statuspkg.StageError
+	if !errors.As(reported, &stageErr) || stageErr.Code != statuspkg.CodeASRFailed {
+		t.Fatalf("expected the failed run to be reported, got %v", reported)
+	}
+
+	if _, err := NewWhisperRecognizer(WhisperConfig{}).Recognize(context.Background(), "whisper-session", chunks); err == nil {
+		t.Fatal("expected an error without a model")
+	}
+}
+
+func TestWhisperRecognizerBatchesSessions(t *testing.T) {
+	t.Parallel()
+
+	runs := filepath.Join(t.TempDir(), "runs")
+	backend := newTestWhisper(t, WhisperConfig{})
+	backend.cfg.Command = append(backend.cfg.Command, "-runs", runs)
+	batcher := NewBatcher(BatcherConfig{Backend: backend, MaxBatch: 3, MaxWait: time.Minute})
+
+	// The sessions share the model, so their segments share batches.
+	cfg := backend.cfg
+	cfg.Batcher = batcher
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		recognizer := NewWhisperRecognizer(cfg)
+		chunks := make(chan media.AudioChunk, 1)
+		chunks <- media.AudioChunk{SampleRate: 16000, Channels: 1, PCMData: make([]byte, 2*16000), Duration: time.Second}
+		close(chunks)
+		sessionID := fmt.Sprintf("session-%d", i)
+		out, err := recognizer.Recognize(context.Background(), sessionID, chunks)
+		if err != nil {
+			t.Fatalf("Recognize: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var transcripts []Transcript
+			for transcript := range out {
+				transcripts = append(transcripts, transcript)
+			}
+			if len(transcripts) != 1 || transcripts[0].SessionID != sessionID || transcripts[0].Text != "Hello world." {
+				t.Errorf("unexpected transcripts for %s: %+v", sessionID, transcripts)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The full batch runs at once, without waiting for MaxWait.
+	raw, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatalf("read runs: %v", err)
+	}
+	if got := strings.Fields(string(raw)); !reflect.DeepEqual(got, []string{"3"}) {
+		t.Fatalf("expected one run of three inputs, got %v", got)
+	}
+}
@@ -0,0 +1,313 @@
+// Package cloudauth authorizes requests to the object storage of AWS and
+// Google Cloud: it signs S3 requests with Signature Version 4, assuming IAM
+// roles for them when needed, and fetches Cloud Storage access tokens.
+package cloudauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// EmptyPayloadHash is the SHA-256 of an empty request body.
+const EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// expiryMargin is how long before they expire that temporary credentials
+// and access tokens are renewed.
+const expiryMargin = 5 * time.Minute
+
+// AWSCredentials sign requests, along with SessionToken for temporary
+// credentials, which expire at Expires.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time
+}
+
+// AWSConfig configures an AWSCredentialProvider. Static credentials take
+// precedence over the role.
+type AWSConfig struct {
+	// AccessKeyID and SecretAccessKey are static credentials, along with
+	// SessionToken for temporary ones.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// RoleARN is assumed with the web identity token read from
+	// WebIdentityTokenFile, as IRSA configures them.
+	RoleARN              string
+	WebIdentityTokenFile string
+	// RoleSessionName names the assumed role's session. Defaults to
+	// "streamlation".
+	RoleSessionName string
+	// STSEndpoint is the base URL of STS. Defaults to the regional endpoint.
+	STSEndpoint string
+	// Region is the region of STS. Defaults to "us-east-1".
+	Region string
+	// Client sends the STS requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// AWSConfigFromEnv reads the standard AWS_* variables: the static
+// credentials, AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE,
+// AWS_ROLE_SESSION_NAME, AWS_ENDPOINT_URL_STS, and AWS_REGION or
+// AWS_DEFAULT_REGION.
+func AWSConfigFromEnv(getenv func(string) string) AWSConfig {
+	region := getenv("AWS_REGION")
+	if region == "" {
+		region = getenv("AWS_DEFAULT_REGION")
+	}
+	return AWSConfig{
+		AccessKeyID:          getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey:      getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:         getenv("AWS_SESSION_TOKEN"),
+		RoleARN:              getenv("AWS_ROLE_ARN"),
+		WebIdentityTokenFile: getenv("AWS_WEB_IDENTITY_TOKEN_FILE"),
+		RoleSessionName:      getenv("AWS_ROLE_SESSION_NAME"),
+		STSEndpoint:          getenv("AWS_ENDPOINT_URL_STS"),
+		Region:               region,
+	}
+}
+
+// AWSCredentialProvider hands out the credentials of an AWSConfig,
+// assuming its role through STS and renewing the temporary credentials
+// before they expire.
+type AWSCredentialProvider struct {
+	cfg AWSConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	assumed *AWSCredentials
+}
+
+// NewAWSCredentialProvider returns a provider of cfg's credentials.
+func NewAWSCredentialProvider(cfg AWSConfig) *AWSCredentialProvider {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.RoleSessionName == "" {
+		cfg.RoleSessionName = "streamlation"
+	}
+	if cfg.STSEndpoint == "" {
+		cfg.STSEndpoint = "https://sts." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &AWSCredentialProvider{cfg: cfg, now: time.Now}
+}
+
+// Configured reports whether the provider has static credentials or a
+// role to assume.
+func (p *AWSCredentialProvider) Configured() bool {
+	return p.static() || p.cfg.RoleARN != "" && p.cfg.WebIdentityTokenFile != ""
+}
+
+func (p *AWSCredentialProvider) static() bool {
+	return p.cfg.AccessKeyID != "" && p.cfg.SecretAccessKey != ""
+}
+
+// Credentials returns the credentials to sign with, or nil when none are
+// configured.
+func (p *AWSCredentialProvider) Credentials(ctx context.Context) (*AWSCredentials, error) {
+	if p.static() {
+		return &AWSCredentials{
+			AccessKeyID:     p.cfg.AccessKeyID,
+			SecretAccessKey: p.cfg.SecretAccessKey,
+			SessionToken:    p.cfg.SessionToken,
+		}, nil
+	}
+	if !p.Configured() {
+		return nil, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.assumed != nil && p.now().Before(p.assumed.Expires.Add(-expiryMargin)) {
+		return p.assumed, nil
+	}
+	credentials, err := p.assumeRole(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.assumed = credentials
+	return credentials, nil
+}
+
+// assumeRole exchanges the web identity token for temporary credentials.
+func (p *AWSCredentialProvider) assumeRole(ctx context.Context) (*AWSCredentials, error) {
+	token, err := os.ReadFile(p.cfg.WebIdentityTokenFile)
+	if err != nil {
+		return nil, statuspkg.Fatal(fmt.Errorf("read web identity token: %w", err))
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {p.cfg.RoleARN},
+		"RoleSessionName":  {p.cfg.RoleSessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.STSEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("build assume role request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := p.cfg.Client.Do(req)
+	if err != nil {
+		return nil, statuspkg.Transient(fmt.Errorf("assume role: %w", err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("assume role", resp)
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode assume role response: %w", err)
+	}
+	if result.Credentials.AccessKeyID == "" {
+		return nil, errors.New("assume role response carries no credentials")
+	}
+	return &AWSCredentials{
+		AccessKeyID:     result.Credentials.AccessKeyID,
+		SecretAccessKey: result.Credentials.SecretAccessKey,
+		SessionToken:    result.Credentials.SessionToken,
+		Expires:         result.Credentials.Expiration,
+	}, nil
+}
+
+// SignV4 signs req, made at now, with AWS Signature Version 4 for service
+// in region. payloadHash is the hex SHA-256 of the body, such as
+// EmptyPayloadHash. The host, the Range and Content-Type headers, and the
+// x-amz-* headers are signed.
+func SignV4(req *http.Request, credentials AWSCredentials, region, service, payloadHash string, now time.Time) {
+	timestamp := now.UTC().Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", timestamp[:8], region, service)
+	req.Header.Set("X-Amz-Date", timestamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		URIEncode(path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", timestamp, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{timestamp[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery sorts the query by key and value and encodes it as
+// Signature Version 4 expects, with spaces as %20 rather than '+'.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, URIEncode(key, true)+"="+URIEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// URIEncode percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash is set, as Signature Version 4 requires.
+func URIEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			encoded.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			encoded.WriteByte(c)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+// responseError describes an unexpected response to a request for what.
+// Server errors and rate limiting are transient; client errors, such as
+// rejected credentials, are fatal.
+func responseError(what string, resp *http.Response) error {
+	err := fmt.Errorf("%s returned %s", what, resp.Status)
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError,
+		resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests:
+		return statuspkg.Transient(err)
+	case resp.StatusCode >= http.StatusBadRequest:
+		return statuspkg.Fatal(err)
+	default:
+		return err
+	}
+}
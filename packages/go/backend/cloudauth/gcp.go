@@ -0,0 +1,220 @@
+package cloudauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// Scopes of Cloud Storage access tokens.
+const (
+	GCSReadOnlyScope  = "https://www.googleapis.com/auth/devstorage.read_only"
+	GCSReadWriteScope = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+// DefaultGCPTokenURL is the metadata server's endpoint for the access token
+// of the instance's default service account.
+const DefaultGCPTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCPConfig configures a GCPTokenSource. The first of AccessToken,
+// CredentialsFile, and TokenURL that is set is used.
+type GCPConfig struct {
+	// AccessToken authorizes every request as is.
+	AccessToken string
+	// CredentialsFile is a service account key, as
+	// GOOGLE_APPLICATION_CREDENTIALS names it, whose signed JWTs are
+	// exchanged for access tokens.
+	CredentialsFile string
+	// TokenURL serves access tokens the way the metadata server of a
+	// Compute Engine instance or a GKE workload does. Defaults to
+	// DefaultGCPTokenURL.
+	TokenURL string
+	// Scope is requested for service account tokens. Defaults to
+	// GCSReadOnlyScope.
+	Scope string
+	// Client sends the token requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// GCPTokenSource hands out OAuth access tokens, fetching and renewing them
+// before they expire.
+type GCPTokenSource struct {
+	cfg GCPConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewGCPTokenSource returns a source of cfg's access tokens.
+func NewGCPTokenSource(cfg GCPConfig) *GCPTokenSource {
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = DefaultGCPTokenURL
+	}
+	if cfg.Scope == "" {
+		cfg.Scope = GCSReadOnlyScope
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &GCPTokenSource{cfg: cfg, now: time.Now}
+}
+
+// Token returns the access token to authorize with.
+func (s *GCPTokenSource) Token(ctx context.Context) (string, error) {
+	if s.cfg.AccessToken != "" {
+		return s.cfg.AccessToken, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && s.now().Before(s.expires.Add(-expiryMargin)) {
+		return s.token, nil
+	}
+	var (
+		token string
+		ttl   time.Duration
+		err   error
+	)
+	if s.cfg.CredentialsFile != "" {
+		token, ttl, err = s.serviceAccountToken(ctx)
+	} else {
+		token, ttl, err = s.metadataToken(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+	s.token, s.expires = token, s.now().Add(ttl)
+	return token, nil
+}
+
+// serviceAccountToken exchanges a JWT signed with the service account's
+// key for an access token.
+func (s *GCPTokenSource) serviceAccountToken(ctx context.Context) (string, time.Duration, error) {
+	data, err := os.ReadFile(s.cfg.CredentialsFile)
+	if err != nil {
+		return "", 0, statuspkg.Fatal(fmt.Errorf("read service account key: %w", err))
+	}
+	var account struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &account); err != nil {
+		return "", 0, statuspkg.Fatal(fmt.Errorf("decode service account key: %w", err))
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	key, err := parseRSAPrivateKey(account.PrivateKey)
+	if err != nil {
+		return "", 0, statuspkg.Fatal(err)
+	}
+
+	issued := s.now()
+	assertion, err := signJWT(key, map[string]any{
+		"iss":   account.ClientEmail,
+		"scope": s.cfg.Scope,
+		"aud":   account.TokenURI,
+		"iat":   issued.Unix(),
+		"exp":   issued.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.fetchToken(req)
+}
+
+// metadataToken fetches the access token of the instance's service account.
+func (s *GCPTokenSource) metadataToken(ctx context.Context) (string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.TokenURL, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("build token request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return s.fetchToken(req)
+}
+
+func (s *GCPTokenSource) fetchToken(req *http.Request) (string, time.Duration, error) {
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return "", 0, statuspkg.Transient(fmt.Errorf("fetch access token: %w", err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, responseError("access token", resp)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return "", 0, fmt.Errorf("decode access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", 0, errors.New("token response carries no access token")
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
+func parseRSAPrivateKey(value string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, errors.New("service account private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse service account private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// signJWT returns claims as a JWT signed with RS256.
+func signJWT(key *rsa.PrivateKey, claims map[string]any) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("encode JWT claims: %w", err)
+	}
+	encoding := base64.RawURLEncoding
+	unsigned := encoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + encoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign JWT: %w", err)
+	}
+	return unsigned + "." + encoding.EncodeToString(signature), nil
+}
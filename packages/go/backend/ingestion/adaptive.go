@@ -0,0 +1,114 @@
+package ingestion
+
+import (
+	"strconv"
+	"time"
+)
+
+// AdaptiveConfig enables adaptive variant switching in the HLS and DASH
+// sources. With it, a source starts with the highest-bandwidth variant,
+// steps down one variant once segment downloads keep lagging behind real
+// time, and steps back up once they have kept up for a while. Without it,
+// the lowest-bandwidth variant is followed throughout.
+type AdaptiveConfig struct {
+	// LagRatio is the download time, as a fraction of the segment's
+	// duration, at or above which a download lags. Defaults to 0.8.
+	LagRatio float64
+	// RecoverRatio is the download time, as a fraction of the segment's
+	// duration, at or below which a download keeps up. Defaults to 0.4.
+	RecoverRatio float64
+	// DownAfter is the number of lagging downloads in a row that steps
+	// down a variant. Defaults to 3.
+	DownAfter int
+	// UpAfter is the number of downloads in a row that keep up before
+	// stepping up a variant. Defaults to 10.
+	UpAfter int
+}
+
+// adaptiveController picks the variant a source follows from how long its
+// segment downloads take. Variants are numbered from the lowest bandwidth.
+type adaptiveController struct {
+	cfg              AdaptiveConfig
+	levels, level    int
+	lagging, healthy int
+}
+
+// newAdaptiveController returns nil when cfg is nil, leaving switching off.
+func newAdaptiveController(cfg *AdaptiveConfig) *adaptiveController {
+	if cfg == nil {
+		return nil
+	}
+	c := *cfg
+	if c.LagRatio <= 0 {
+		c.LagRatio = 0.8
+	}
+	if c.RecoverRatio <= 0 || c.RecoverRatio >= c.LagRatio {
+		c.RecoverRatio = min(0.4, c.LagRatio/2)
+	}
+	if c.DownAfter <= 0 {
+		c.DownAfter = 3
+	}
+	if c.UpAfter <= 0 {
+		c.UpAfter = 10
+	}
+	return &adaptiveController{cfg: c}
+}
+
+// setLevels tells the controller how many variants the stream offers and
+// returns the one to follow. The current variant is kept while the number
+// stays the same, as when a manifest is refreshed; otherwise the controller
+// starts over with the highest.
+func (c *adaptiveController) setLevels(levels int) int {
+	if levels != c.levels {
+		c.levels, c.level = levels, max(levels-1, 0)
+		c.lagging, c.healthy = 0, 0
+	}
+	return c.level
+}
+
+// observe records that a segment lasting duration took elapsed to
+// download. It returns the variant to switch to, and true, once downloads
+// have lagged or kept up for long enough.
+func (c *adaptiveController) observe(elapsed, duration time.Duration) (int, bool) {
+	if duration <= 0 || c.levels < 2 {
+		return c.level, false
+	}
+	switch ratio := float64(elapsed) / float64(duration); {
+	case ratio >= c.cfg.LagRatio:
+		c.lagging, c.healthy = c.lagging+1, 0
+		if c.lagging >= c.cfg.DownAfter && c.level > 0 {
+			c.level, c.lagging = c.level-1, 0
+			return c.level, true
+		}
+	case ratio <= c.cfg.RecoverRatio:
+		c.lagging, c.healthy = 0, c.healthy+1
+		if c.healthy >= c.cfg.UpAfter && c.level < c.levels-1 {
+			c.level, c.healthy = c.level+1, 0
+			return c.level, true
+		}
+	default:
+		c.lagging, c.healthy = 0, 0
+	}
+	return c.level, false
+}
+
+// variantSwitch describes a switch between variants until the first chunk
+// of the new variant is emitted.
+type variantSwitch struct {
+	up        bool
+	bandwidth int64
+}
+
+// mark adds the switch to the metadata of the first chunk after it:
+// "variantSwitch" says whether the source stepped "up" or "down", and
+// "bandwidth" gives the new variant's. The chunk is also marked as a
+// discontinuity, as the variants may be encoded differently.
+func (v *variantSwitch) mark(metadata map[string]string) {
+	direction := "down"
+	if v.up {
+		direction = "up"
+	}
+	metadata["variantSwitch"] = direction
+	metadata["bandwidth"] = strconv.FormatInt(v.bandwidth, 10)
+	metadata["discontinuity"] = "true"
+}
@@ -0,0 +1,48 @@
+package ingestion
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveControllerStepsDownAndBackUp(t *testing.T) {
+	controller := newAdaptiveController(&AdaptiveConfig{DownAfter: 2, UpAfter: 3})
+	if level := controller.setLevels(3); level != 2 {
+		t.Fatalf("expected to start with the highest variant, got %d", level)
+	}
+
+	second := time.Second
+	if _, ok := controller.observe(900*time.Millisecond, second); ok {
+		t.Fatal("expected one lagging download to be tolerated")
+	}
+	// A download between the thresholds breaks the run.
+	controller.observe(600*time.Millisecond, second)
+	controller.observe(900*time.Millisecond, second)
+	if level, ok := controller.observe(2*second, second); !ok || level != 1 {
+		t.Fatalf("expected to step down to variant 1, got %d, %v", level, ok)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, ok := controller.observe(100*time.Millisecond, second); ok {
+			t.Fatal("expected to wait for three fast downloads")
+		}
+	}
+	if level, ok := controller.observe(100*time.Millisecond, second); !ok || level != 2 {
+		t.Fatalf("expected to step back up to variant 2, got %d, %v", level, ok)
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := controller.observe(100*time.Millisecond, second); ok {
+			t.Fatal("expected to stay at the highest variant")
+		}
+	}
+
+	if level := controller.setLevels(3); level != 2 {
+		t.Fatalf("expected a refresh to keep the variant, got %d", level)
+	}
+	if level := controller.setLevels(1); level != 0 {
+		t.Fatalf("expected a single variant to be followed, got %d", level)
+	}
+	if _, ok := controller.observe(5*second, second); ok {
+		t.Fatal("expected no switch without variants to switch to")
+	}
+}
@@ -0,0 +1,200 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+// credentialsRefreshMargin is how long before they expire that credentials
+// with a refresh URL are renewed.
+const credentialsRefreshMargin = 30 * time.Second
+
+// NewAuthenticatedClient returns a copy of client whose requests for the
+// origin of sourceURL, or for one of auth's hosts, carry the headers,
+// cookies, and query parameters of auth. Requests for other hosts, such as
+// segments or redirects pointing elsewhere, are sent without them. When auth
+// has a refresh URL, the credentials are renewed through it shortly before
+// they expire and whenever an authenticated request is rejected with 401 or
+// 403, which is then retried once. client itself is used for refresh
+// requests.
+func NewAuthenticatedClient(client *http.Client, sourceURL string, auth sessionpkg.SourceAuth) (*http.Client, error) {
+	source, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse source url: %w", err)
+	}
+	if source.Scheme == "" || source.Host == "" {
+		return nil, fmt.Errorf("source url %q has no origin", sourceURL)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	authenticated := *client
+	authenticated.Transport = &authTransport{
+		base:    base,
+		refresh: client,
+		scheme:  strings.ToLower(source.Scheme),
+		host:    strings.ToLower(source.Host),
+		auth:    auth,
+		now:     time.Now,
+	}
+	return &authenticated, nil
+}
+
+// authTransport authenticates the requests of a source.
+type authTransport struct {
+	base    http.RoundTripper
+	refresh *http.Client
+	now     func() time.Time
+	// scheme and host are the origin of the source, whose requests carry
+	// the credentials.
+	scheme string
+	host   string
+
+	mu   sync.Mutex
+	auth sessionpkg.SourceAuth
+	// generation counts refreshes, so concurrent rejections of the same
+	// credentials renew them once.
+	generation int
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.trusted(req.URL) {
+		return t.base.RoundTrip(req)
+	}
+	auth, generation, err := t.current(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(authorize(req, auth))
+	if err != nil {
+		return nil, err
+	}
+	rejected := resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden
+	if !rejected || auth.RefreshURL == "" || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if auth, err = t.renew(req.Context(), generation); err != nil {
+		return nil, err
+	}
+	retry := req
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("rewind request body: %w", err)
+		}
+		retry = req.Clone(req.Context())
+		retry.Body = body
+	}
+	return t.base.RoundTrip(authorize(retry, auth))
+}
+
+// trusted reports whether requests for u may carry the credentials: u must
+// use the source's scheme and address its host or one of the credentials'
+// hosts.
+func (t *authTransport) trusted(u *url.URL) bool {
+	if !strings.EqualFold(u.Scheme, t.scheme) {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	if host == t.host {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, allowed := range t.auth.Hosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// current returns the credentials to use, renewing them first when they
+// are about to expire.
+func (t *authTransport) current(ctx context.Context) (sessionpkg.SourceAuth, int, error) {
+	t.mu.Lock()
+	auth, generation := t.auth, t.generation
+	t.mu.Unlock()
+	if auth.RefreshURL == "" || auth.ExpiresAt.IsZero() || t.now().Before(auth.ExpiresAt.Add(-credentialsRefreshMargin)) {
+		return auth, generation, nil
+	}
+	auth, err := t.renew(ctx, generation)
+	if err != nil {
+		return sessionpkg.SourceAuth{}, 0, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return auth, t.generation, nil
+}
+
+// renew fetches fresh credentials from the refresh URL, unless another
+// request already renewed the credentials of the given generation.
+func (t *authTransport) renew(ctx context.Context, generation int) (sessionpkg.SourceAuth, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.generation != generation {
+		return t.auth, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.auth.RefreshURL, nil)
+	if err != nil {
+		return sessionpkg.SourceAuth{}, fmt.Errorf("build credentials refresh request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := t.refresh.Do(req)
+	if err != nil {
+		return sessionpkg.SourceAuth{}, fmt.Errorf("refresh source credentials: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return sessionpkg.SourceAuth{}, fmt.Errorf("refresh source credentials: unexpected status %d", resp.StatusCode)
+	}
+	var auth sessionpkg.SourceAuth
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&auth); err != nil {
+		return sessionpkg.SourceAuth{}, fmt.Errorf("decode refreshed source credentials: %w", err)
+	}
+	if auth.RefreshURL == "" {
+		auth.RefreshURL = t.auth.RefreshURL
+	}
+	if auth.Hosts == nil {
+		auth.Hosts = t.auth.Hosts
+	}
+	t.auth = auth
+	t.generation++
+	return auth, nil
+}
+
+// authorize returns a copy of req carrying auth.
+func authorize(req *http.Request, auth sessionpkg.SourceAuth) *http.Request {
+	authorized := req.Clone(req.Context())
+	for name, value := range auth.Headers {
+		authorized.Header.Set(name, value)
+	}
+	for name, value := range auth.Cookies {
+		authorized.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	if len(auth.Query) > 0 {
+		query := authorized.URL.Query()
+		for name, value := range auth.Query {
+			query.Set(name, value)
+		}
+		authorized.URL.RawQuery = query.Encode()
+	}
+	return authorized
+}
@@ -0,0 +1,194 @@
+package ingestion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+func TestSessionSourceAuthenticatesAndRefreshesCredentials(t *testing.T) {
+	var refreshes atomic.Int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		refreshes.Add(1)
+		_ = json.NewEncoder(w).Encode(sessionpkg.SourceAuth{
+			Headers: map[string]string{"X-Customer": "acme"},
+			Cookies: map[string]string{"session": "cookie"},
+			Query:   map[string]string{"token": "fresh"},
+		})
+	})
+	handler.HandleFunc("/stream/", func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("session")
+		if r.Header.Get("X-Customer") != "acme" || err != nil || cookie.Value != "cookie" || r.URL.Query().Get("token") != "fresh" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/stream/index.m3u8" {
+			_, _ = w.Write([]byte("#EXTM3U\n#EXTINF:2.0,\nseg-1.ts?v=1\n"))
+			return
+		}
+		if r.URL.Query().Get("v") != "1" {
+			t.Errorf("segment query was replaced: %s", r.URL.RawQuery)
+		}
+		_, _ = w.Write([]byte("segment-1"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	key := bytes.Repeat([]byte{3}, sessionpkg.CredentialsKeySize)
+	credentials, err := sessionpkg.SealSourceAuth(key, sessionpkg.SourceAuth{
+		Headers:    map[string]string{"X-Customer": "acme"},
+		Cookies:    map[string]string{"session": "cookie"},
+		Query:      map[string]string{"token": "stale"},
+		RefreshURL: server.URL + "/refresh",
+	})
+	if err != nil {
+		t.Fatalf("seal credentials: %v", err)
+	}
+	session := sessionpkg.TranslationSession{
+		ID:     "protected",
+		Source: sessionpkg.TranslationSource{Type: "hls", URI: server.URL + "/stream/index.m3u8", Credentials: credentials},
+	}
+
+	if _, err := NewSessionSource(session, SessionSourceConfig{HTTPClient: server.Client()}); err == nil {
+		t.Fatal("expected credentials without a key to be rejected")
+	}
+	source, err := NewSessionSource(session, SessionSourceConfig{HTTPClient: server.Client(), CredentialsKey: key})
+	if err != nil {
+		t.Fatalf("NewSessionSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+	select {
+	case <-ctx.Done():
+		t.Fatal("context done waiting for a segment")
+	case err := <-errs:
+		t.Fatalf("stream returned error: %v", err)
+	case chunk := <-chunks:
+		if string(chunk.Payload) != "segment-1" {
+			t.Fatalf("payload = %q", chunk.Payload)
+		}
+	}
+	if got := refreshes.Load(); got != 1 {
+		t.Fatalf("expected the credentials to be refreshed once, got %d", got)
+	}
+}
+
+func TestAuthenticatedClientRefreshesBeforeExpiry(t *testing.T) {
+	var refreshes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/refresh" {
+			refreshes.Add(1)
+			_ = json.NewEncoder(w).Encode(sessionpkg.SourceAuth{
+				Headers:   map[string]string{"Authorization": "Bearer renewed"},
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	client, err := NewAuthenticatedClient(server.Client(), server.URL+"/index.m3u8", sessionpkg.SourceAuth{
+		Headers:    map[string]string{"Authorization": "Bearer expiring"},
+		ExpiresAt:  time.Now().Add(10 * time.Second),
+		RefreshURL: server.URL + "/refresh",
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticatedClient error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL + "/media")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		var body bytes.Buffer
+		_, _ = body.ReadFrom(resp.Body)
+		resp.Body.Close()
+		if body.String() != "Bearer renewed" {
+			t.Fatalf("request %d authorized with %q", i, body.String())
+		}
+	}
+	if got := refreshes.Load(); got != 1 {
+		t.Fatalf("expected one refresh, got %d", got)
+	}
+}
+
+func TestAuthenticatedClientWithholdsCredentialsFromOtherHosts(t *testing.T) {
+	credentialed := func(r *http.Request) bool {
+		_, err := r.Cookie("session")
+		return r.Header.Get("Authorization") != "" || err == nil || r.URL.Query().Get("token") != ""
+	}
+	var leaked atomic.Int32
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if credentialed(r) {
+			leaked.Add(1)
+		}
+		_, _ = w.Write([]byte("segment"))
+	}))
+	defer cdn.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !credentialed(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, cdn.URL+"/redirected.ts", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("#EXTM3U\n"))
+	}))
+	defer origin.Close()
+
+	auth := sessionpkg.SourceAuth{
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+		Cookies: map[string]string{"session": "cookie"},
+		Query:   map[string]string{"token": "signed"},
+	}
+	client, err := NewAuthenticatedClient(nil, origin.URL+"/index.m3u8", auth)
+	if err != nil {
+		t.Fatalf("NewAuthenticatedClient error: %v", err)
+	}
+	for _, target := range []string{origin.URL + "/index.m3u8", cdn.URL + "/segment.ts", origin.URL + "/redirect"} {
+		resp, err := client.Get(target)
+		if err != nil {
+			t.Fatalf("get %s: %v", target, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("get %s: status %d", target, resp.StatusCode)
+		}
+	}
+	if got := leaked.Load(); got != 0 {
+		t.Fatalf("%d cross-host requests carried credentials", got)
+	}
+
+	// A host listed in the credentials receives them.
+	auth.Hosts = []string{strings.TrimPrefix(cdn.URL, "http://")}
+	client, err = NewAuthenticatedClient(nil, origin.URL+"/index.m3u8", auth)
+	if err != nil {
+		t.Fatalf("NewAuthenticatedClient error: %v", err)
+	}
+	resp, err := client.Get(cdn.URL + "/segment.ts")
+	if err != nil {
+		t.Fatalf("get segment: %v", err)
+	}
+	resp.Body.Close()
+	if got := leaked.Load(); got != 1 {
+		t.Fatalf("expected the listed host to receive the credentials, got %d credentialed requests", got)
+	}
+
+	if _, err := NewAuthenticatedClient(nil, "index.m3u8", auth); err == nil {
+		t.Fatal("expected a source url without an origin to be rejected")
+	}
+}
@@ -0,0 +1,116 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+)
+
+// BackpressurePolicy selects what a live stream source does with a chunk
+// when its consumer has fallen behind and the chunk buffer is full.
+type BackpressurePolicy string
+
+const (
+	// BackpressureDropNewest discards the chunk that does not fit, keeping
+	// the buffered ones. It is the default.
+	BackpressureDropNewest BackpressurePolicy = "drop-newest"
+	// BackpressureDropOldest discards the oldest buffered chunk to make room,
+	// so the consumer catches up with the live edge.
+	BackpressureDropOldest BackpressurePolicy = "drop-oldest"
+	// BackpressureBlock waits for room, so no chunk is lost. The source stops
+	// reading meanwhile, which suits VOD; a live server may time it out.
+	BackpressureBlock BackpressurePolicy = "block"
+)
+
+// ParseBackpressurePolicy returns the policy named by value, or the
+// default for an empty value.
+func ParseBackpressurePolicy(value string) (BackpressurePolicy, error) {
+	switch policy := BackpressurePolicy(value); policy {
+	case "":
+		return BackpressureDropNewest, nil
+	case BackpressureDropNewest, BackpressureDropOldest, BackpressureBlock:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown backpressure policy %q (want %s, %s, or %s)", value, BackpressureDropNewest, BackpressureDropOldest, BackpressureBlock)
+	}
+}
+
+// Backpressure configures how a stream source handles a consumer that
+// falls behind.
+type Backpressure struct {
+	Policy BackpressurePolicy
+	// HighWaterMark is the number of buffered chunks at which OnHighWater
+	// is called. Defaults to the buffer size.
+	HighWaterMark int
+	// OnHighWater is called with the number of buffered chunks each time
+	// the buffer fills up to HighWaterMark after having drained below it.
+	// It runs on the source's goroutine and must not block.
+	OnHighWater func(buffered int)
+}
+
+// chunkEmitter hands chunks to a source's consumer under a backpressure
+// policy, counting the chunks received and dropped.
+type chunkEmitter struct {
+	chunks   chan MediaChunk
+	cfg      Backpressure
+	counters *streamCounters
+	// high is set while the buffer is at or above the high-water mark.
+	high bool
+}
+
+func newChunkEmitter(chunks chan MediaChunk, cfg Backpressure, counters *streamCounters) *chunkEmitter {
+	if cfg.HighWaterMark <= 0 || cfg.HighWaterMark > cap(chunks) {
+		cfg.HighWaterMark = cap(chunks)
+	}
+	return &chunkEmitter{chunks: chunks, cfg: cfg, counters: counters}
+}
+
+// emit hands chunk to the consumer. It returns false when ctx is done
+// before a blocked chunk could be handed over.
+func (e *chunkEmitter) emit(ctx context.Context, chunk MediaChunk) bool {
+	defer e.checkHighWater()
+	switch e.cfg.Policy {
+	case BackpressureBlock:
+		select {
+		case e.chunks <- chunk:
+			e.counters.receive(chunk)
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case e.chunks <- chunk:
+				e.counters.receive(chunk)
+				return true
+			default:
+			}
+			select {
+			case <-e.chunks:
+				e.counters.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case e.chunks <- chunk:
+			e.counters.receive(chunk)
+		default:
+			e.counters.dropped.Add(1)
+		}
+		return true
+	}
+}
+
+func (e *chunkEmitter) checkHighWater() {
+	buffered := len(e.chunks)
+	switch {
+	case buffered < e.cfg.HighWaterMark:
+		e.high = false
+	case !e.high:
+		e.high = true
+		if e.cfg.OnHighWater != nil {
+			e.cfg.OnHighWater(buffered)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package ingestion
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func emitSequence(t *testing.T, emitter *chunkEmitter, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		emitter.emit(context.Background(), MediaChunk{Sequence: int64(i)})
+	}
+}
+
+func drainSequences(chunks chan MediaChunk) []int64 {
+	var sequences []int64
+	for len(chunks) > 0 {
+		sequences = append(sequences, (<-chunks).Sequence)
+	}
+	return sequences
+}
+
+func TestChunkEmitterDropsNewChunksByDefault(t *testing.T) {
+	chunks := make(chan MediaChunk, 2)
+	counters := &streamCounters{}
+	emitSequence(t, newChunkEmitter(chunks, Backpressure{}, counters), 4)
+
+	if got := drainSequences(chunks); len(got) != 2 || got[0] != 0 || got[1] != 1 {
+		t.Fatalf("expected the first chunks to be kept, got %v", got)
+	}
+	if metrics := counters.snapshot(); metrics.ReceivedChunks != 2 || metrics.DroppedChunks != 2 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+}
+
+func TestChunkEmitterDropsOldestChunks(t *testing.T) {
+	chunks := make(chan MediaChunk, 2)
+	counters := &streamCounters{}
+	emitSequence(t, newChunkEmitter(chunks, Backpressure{Policy: BackpressureDropOldest}, counters), 4)
+
+	if got := drainSequences(chunks); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Fatalf("expected the newest chunks to be kept, got %v", got)
+	}
+	if metrics := counters.snapshot(); metrics.ReceivedChunks != 4 || metrics.DroppedChunks != 2 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+}
+
+func TestChunkEmitterBlocksUntilConsumed(t *testing.T) {
+	chunks := make(chan MediaChunk, 1)
+	counters := &streamCounters{}
+	emitter := newChunkEmitter(chunks, Backpressure{Policy: BackpressureBlock}, counters)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		emitSequence(t, emitter, 3)
+	}()
+	for want := int64(0); want < 3; want++ {
+		select {
+		case chunk := <-chunks:
+			if chunk.Sequence != want {
+				t.Fatalf("chunk sequence = %d, want %d", chunk.Sequence, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a chunk")
+		}
+	}
+	<-done
+	if metrics := counters.snapshot(); metrics.ReceivedChunks != 3 || metrics.DroppedChunks != 0 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+
+	// A blocked chunk is abandoned when the context ends.
+	chunks <- MediaChunk{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if emitter.emit(ctx, MediaChunk{}) {
+		t.Fatal("expected the blocked emit to give up")
+	}
+}
+
+func TestChunkEmitterReportsHighWaterMark(t *testing.T) {
+	chunks := make(chan MediaChunk, 4)
+	var reports []int
+	emitter := newChunkEmitter(chunks, Backpressure{
+		HighWaterMark: 2,
+		OnHighWater:   func(buffered int) { reports = append(reports, buffered) },
+	}, &streamCounters{})
+
+	emitSequence(t, emitter, 4)
+	if len(reports) != 1 || reports[0] != 2 {
+		t.Fatalf("expected one report at the mark, got %v", reports)
+	}
+	drainSequences(chunks)
+	emitSequence(t, emitter, 2)
+	if len(reports) != 2 {
+		t.Fatalf("expected another report after draining, got %v", reports)
+	}
+}
+
+func TestParseBackpressurePolicy(t *testing.T) {
+	if policy, err := ParseBackpressurePolicy(""); err != nil || policy != BackpressureDropNewest {
+		t.Fatalf("default policy = %q, %v", policy, err)
+	}
+	if policy, err := ParseBackpressurePolicy("block"); err != nil || policy != BackpressureBlock {
+		t.Fatalf("block policy = %q, %v", policy, err)
+	}
+	if _, err := ParseBackpressurePolicy("drop"); err == nil {
+		t.Fatal("expected unknown policies to be rejected")
+	}
+}
@@ -0,0 +1,892 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// DASHConfig tunes behaviour of the MPEG-DASH stream source.
+type DASHConfig struct {
+	ManifestURL string
+	Client      *http.Client
+	// PollInterval is how often the source checks for new segments, and how
+	// often it refreshes a live manifest that sets no minimumUpdatePeriod.
+	PollInterval    time.Duration
+	BufferSize      int
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// LiveEdgeSegments is how many of the newest segments a live stream
+	// starts with. Older segments in the time-shift buffer are skipped.
+	LiveEdgeSegments int
+	// Adaptive, when set, switches between the representations a period
+	// offers as downloads lag or keep up.
+	Adaptive *AdaptiveConfig
+	// AudioTrack, when set, selects the audio adaptation set of each
+	// period by language or index instead of following all of them.
+	AudioTrack *sessionpkg.AudioTrackSelection
+}
+
+// NewDASHStreamSource constructs a StreamSource that pulls media chunks from
+// an MPEG-DASH manifest.
+func NewDASHStreamSource(cfg DASHConfig) (*DASHStreamSource, error) {
+	if cfg.ManifestURL == "" {
+		return nil, errors.New("manifest URL is required")
+	}
+	if cfg.Client == nil {
+		cfg.Client = NewHTTPClient(10 * time.Second)
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 2 * time.Second
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 8
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxRetryBackoff <= 0 {
+		cfg.MaxRetryBackoff = 5 * time.Second
+	}
+	if cfg.LiveEdgeSegments <= 0 {
+		cfg.LiveEdgeSegments = 3
+	}
+	manifestURL, err := url.Parse(cfg.ManifestURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest URL: %w", err)
+	}
+	return &DASHStreamSource{
+		cfg:         cfg,
+		manifestURL: manifestURL,
+		counters:    &streamCounters{},
+		now:         time.Now,
+	}, nil
+}
+
+// DASHStreamSource implements StreamSource for MPEG-DASH manifests that
+// address their segments with a SegmentTemplate, with or without a
+// SegmentTimeline. It follows the lowest-bandwidth audio representation, of
+// the adaptation set cfg.AudioTrack selects when it is set, or the
+// lowest-bandwidth representation when the manifest has no separate audio,
+// or switches between those representations under cfg.Adaptive. Each
+// representation's initialization segment is emitted before its first media
+// segment.
+//
+// Live ("dynamic") manifests are refreshed every minimumUpdatePeriod and
+// followed at the live edge. Once a static manifest has been streamed in
+// full, the source reports status.ErrSourceEnded.
+type DASHStreamSource struct {
+	cfg         DASHConfig
+	manifestURL *url.URL
+	counters    *streamCounters
+	// now is the clock that places the live edge of dynamic manifests.
+	now func() time.Time
+}
+
+// Metrics returns the current counters snapshot.
+func (s *DASHStreamSource) Metrics() StreamMetrics {
+	return s.counters.snapshot()
+}
+
+// Stream starts following the manifest and emits its segments in
+// presentation order.
+func (s *DASHStreamSource) Stream(ctx context.Context) (<-chan MediaChunk, <-chan error) {
+	chunks := make(chan MediaChunk, s.cfg.BufferSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(chunks)
+		defer close(errs)
+
+		report := func(err error) {
+			s.counters.errors.Add(1)
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+		wait := func(d time.Duration) bool {
+			select {
+			case <-time.After(d):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		poller := newDocumentPoller()
+		var (
+			manifest    *dashManifest
+			refreshedAt time.Time
+			// cursor is the presentation time up to which segments have
+			// been emitted. It is unset until the first segment list.
+			cursor    time.Duration
+			started   bool
+			lastInit  string
+			backoff   = s.cfg.RetryBackoff
+			reconnect bool
+			// listedEnd is where the newest segment listed ends.
+			listedEnd time.Duration
+			// level is the representation followed, numbered from the
+			// lowest bandwidth.
+			level        int
+			adaptive     = newAdaptiveController(s.cfg.Adaptive)
+			pendingMarks *variantSwitch
+		)
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if manifest == nil || (manifest.live && time.Since(refreshedAt) >= manifest.refreshInterval(s.cfg.PollInterval)) {
+				refreshed, err := s.fetchManifest(ctx, poller)
+				if err != nil {
+					report(err)
+					if !wait(backoff) {
+						return
+					}
+					if next := backoff * 2; next <= s.cfg.MaxRetryBackoff {
+						backoff = next
+					}
+					reconnect = true
+					continue
+				}
+				if reconnect {
+					s.counters.reconnect.Add(1)
+					reconnect = false
+				}
+				backoff = s.cfg.RetryBackoff
+				manifest, refreshedAt = refreshed, time.Now()
+				if adaptive != nil {
+					level = adaptive.setLevels(manifest.variants())
+				}
+				manifest.selectVariant(level)
+			}
+
+			segments, err := manifest.segments(s.now())
+			if err != nil {
+				report(err)
+				return
+			}
+			if n := len(segments); n > 0 && segments[n-1].end > listedEnd {
+				listedEnd = segments[n-1].end
+				s.counters.playlistUpdated()
+			}
+			if !started {
+				started = true
+				if manifest.live && len(segments) > s.cfg.LiveEdgeSegments {
+					cursor = segments[len(segments)-s.cfg.LiveEdgeSegments].start
+				}
+			}
+
+			switched := false
+			for _, segment := range segments {
+				if segment.start < cursor {
+					continue
+				}
+				if segment.init != "" && segment.init != lastInit {
+					data, err := s.download(ctx, segment.init, "initialization segment")
+					if err != nil {
+						report(err)
+						break
+					}
+					lastInit = segment.init
+					if !s.emit(ctx, chunks, MediaChunk{
+						Payload:  data,
+						Metadata: map[string]string{"uri": segment.init, "representation": segment.representation, "initialization": "true"},
+					}) {
+						return
+					}
+				}
+				started := time.Now()
+				data, err := s.download(ctx, segment.uri, "segment")
+				if err != nil {
+					report(err)
+					if errors.Is(err, statuspkg.ErrFatal) {
+						// The segment is gone; move on to the next one.
+						cursor = segment.end
+						continue
+					}
+					break
+				}
+				cursor = segment.end
+				chunk := MediaChunk{
+					Duration: segment.end - segment.start,
+					Payload:  data,
+					Metadata: map[string]string{"uri": segment.uri, "representation": segment.representation},
+				}
+				if pendingMarks != nil {
+					pendingMarks.mark(chunk.Metadata)
+					pendingMarks = nil
+				}
+				if !s.emit(ctx, chunks, chunk) {
+					return
+				}
+				if adaptive == nil {
+					continue
+				}
+				if next, ok := adaptive.observe(time.Since(started), chunk.Duration); ok {
+					pendingMarks = &variantSwitch{up: next > level, bandwidth: manifest.selectVariant(next)}
+					level, switched = next, true
+					s.counters.switches.Add(1)
+					break
+				}
+			}
+			if switched {
+				continue
+			}
+
+			if !manifest.live && (len(segments) == 0 || cursor >= segments[len(segments)-1].end) {
+				select {
+				case errs <- statuspkg.ErrSourceEnded:
+				default:
+				}
+				return
+			}
+			if !wait(s.cfg.PollInterval) {
+				return
+			}
+		}
+	}()
+
+	return chunks, errs
+}
+
+// emit hands chunk to the consumer. Unlike the HLS source it waits for
+// room rather than dropping the chunk: a static manifest lists every
+// segment at once, so bursts are expected.
+func (s *DASHStreamSource) emit(ctx context.Context, chunks chan<- MediaChunk, chunk MediaChunk) bool {
+	chunk.Sequence = s.counters.sequence.Add(1)
+	chunk.Timestamp = time.Now().UTC()
+	select {
+	case chunks <- chunk:
+		s.counters.receive(chunk)
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Probe fetches the manifest to report the declared codecs, bandwidth,
+// and segment duration of the representation the source would start with
+// in the last period, and whether the manifest is dynamic.
+func (s *DASHStreamSource) Probe(ctx context.Context) (SourceProbe, error) {
+	manifest, err := s.fetchManifest(ctx, nil)
+	if err != nil {
+		return SourceProbe{}, err
+	}
+	variants := manifest.periods[len(manifest.periods)-1].variants
+	variant := variants[0]
+	if s.cfg.Adaptive != nil {
+		variant = variants[len(variants)-1]
+	}
+	return SourceProbe{
+		Container:       mimeContainers[variant.mimeType],
+		Codecs:          variant.codecs,
+		Bitrate:         variant.bandwidth,
+		SegmentDuration: variant.segmentDuration(),
+		Live:            manifest.live,
+	}, nil
+}
+
+// fetchManifest fetches the manifest through poller.
+func (s *DASHStreamSource) fetchManifest(ctx context.Context, poller *documentPoller) (*dashManifest, error) {
+	body, err := poller.fetch(ctx, s.cfg.Client, s.manifestURL.String(), "manifest")
+	if err != nil {
+		return nil, err
+	}
+	return parseMPD(body, s.manifestURL, s.cfg.AudioTrack)
+}
+
+func (s *DASHStreamSource) download(ctx context.Context, uri, what string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build %s request: %w", what, err)
+	}
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, statuspkg.Transient(fmt.Errorf("fetch %s: %w", what, err))
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(what, resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, statuspkg.Transient(fmt.Errorf("read %s: %w", what, err))
+	}
+	return data, nil
+}
+
+// The subset of the MPD schema the source understands.
+type (
+	mpdDocument struct {
+		XMLName                   xml.Name    `xml:"MPD"`
+		Type                      string      `xml:"type,attr"`
+		AvailabilityStartTime     string      `xml:"availabilityStartTime,attr"`
+		MinimumUpdatePeriod       string      `xml:"minimumUpdatePeriod,attr"`
+		MediaPresentationDuration string      `xml:"mediaPresentationDuration,attr"`
+		TimeShiftBufferDepth      string      `xml:"timeShiftBufferDepth,attr"`
+		BaseURL                   string      `xml:"BaseURL"`
+		Periods                   []mpdPeriod `xml:"Period"`
+	}
+	mpdPeriod struct {
+		ID              string             `xml:"id,attr"`
+		Start           string             `xml:"start,attr"`
+		Duration        string             `xml:"duration,attr"`
+		BaseURL         string             `xml:"BaseURL"`
+		SegmentTemplate *mpdTemplate       `xml:"SegmentTemplate"`
+		AdaptationSets  []mpdAdaptationSet `xml:"AdaptationSet"`
+	}
+	mpdAdaptationSet struct {
+		ContentType     string              `xml:"contentType,attr"`
+		Lang            string              `xml:"lang,attr"`
+		MimeType        string              `xml:"mimeType,attr"`
+		Codecs          string              `xml:"codecs,attr"`
+		BaseURL         string              `xml:"BaseURL"`
+		SegmentTemplate *mpdTemplate        `xml:"SegmentTemplate"`
+		Representations []mpdRepresentation `xml:"Representation"`
+	}
+	mpdRepresentation struct {
+		ID              string       `xml:"id,attr"`
+		Bandwidth       int64        `xml:"bandwidth,attr"`
+		MimeType        string       `xml:"mimeType,attr"`
+		Codecs          string       `xml:"codecs,attr"`
+		BaseURL         string       `xml:"BaseURL"`
+		SegmentTemplate *mpdTemplate `xml:"SegmentTemplate"`
+	}
+	mpdTemplate struct {
+		Media                  string       `xml:"media,attr"`
+		Initialization         string       `xml:"initialization,attr"`
+		Timescale              *uint64      `xml:"timescale,attr"`
+		Duration               *uint64      `xml:"duration,attr"`
+		StartNumber            *uint64      `xml:"startNumber,attr"`
+		PresentationTimeOffset *uint64      `xml:"presentationTimeOffset,attr"`
+		Timeline               *mpdTimeline `xml:"SegmentTimeline"`
+	}
+	mpdTimeline struct {
+		Segments []mpdTimelineSegment `xml:"S"`
+	}
+	mpdTimelineSegment struct {
+		T *uint64 `xml:"t,attr"`
+		D uint64  `xml:"d,attr"`
+		R int64   `xml:"r,attr"`
+	}
+)
+
+// inherit returns t with the attributes it leaves unset taken from parent.
+func (t *mpdTemplate) inherit(parent *mpdTemplate) *mpdTemplate {
+	if t == nil {
+		return parent
+	}
+	if parent == nil {
+		return t
+	}
+	merged := *t
+	if merged.Media == "" {
+		merged.Media = parent.Media
+	}
+	if merged.Initialization == "" {
+		merged.Initialization = parent.Initialization
+	}
+	if merged.Timescale == nil {
+		merged.Timescale = parent.Timescale
+	}
+	if merged.Duration == nil {
+		merged.Duration = parent.Duration
+	}
+	if merged.StartNumber == nil {
+		merged.StartNumber = parent.StartNumber
+	}
+	if merged.PresentationTimeOffset == nil {
+		merged.PresentationTimeOffset = parent.PresentationTimeOffset
+	}
+	if merged.Timeline == nil {
+		merged.Timeline = parent.Timeline
+	}
+	return &merged
+}
+
+// dashManifest is a parsed manifest reduced to the representation the
+// source follows in each period.
+type dashManifest struct {
+	live                  bool
+	availabilityStartTime time.Time
+	minimumUpdatePeriod   time.Duration
+	timeShiftBufferDepth  time.Duration
+	periods               []dashPeriod
+}
+
+type dashPeriod struct {
+	start time.Duration
+	// end is zero when the period is open-ended.
+	end            time.Duration
+	base           *url.URL
+	representation string
+	bandwidth      int64
+	template       mpdTemplate
+	// variants are the representations the period offers, in order of
+	// bandwidth. The fields above describe the one followed.
+	variants []dashRepresentation
+}
+
+type dashRepresentation struct {
+	id        string
+	bandwidth int64
+	base      *url.URL
+	template  mpdTemplate
+	// mimeType and codecs are the representation's, or else its
+	// adaptation set's.
+	mimeType string
+	codecs   []string
+}
+
+// withVariant returns the period following its level-th representation,
+// or its highest-bandwidth one when it offers fewer.
+func (p dashPeriod) withVariant(level int) dashPeriod {
+	if len(p.variants) == 0 {
+		return p
+	}
+	variant := p.variants[min(level, len(p.variants)-1)]
+	p.representation, p.bandwidth = variant.id, variant.bandwidth
+	p.base, p.template = variant.base, variant.template
+	return p
+}
+
+// segmentDuration returns the duration the representation's template gives
+// its segments, or that of the first segment of its timeline.
+func (r dashRepresentation) segmentDuration() time.Duration {
+	template := r.template
+	timescale := uint64(1)
+	if template.Timescale != nil && *template.Timescale > 0 {
+		timescale = *template.Timescale
+	}
+	switch {
+	case template.Duration != nil:
+		return ticksToDuration(int64(*template.Duration), timescale)
+	case template.Timeline != nil && len(template.Timeline.Segments) > 0:
+		return ticksToDuration(int64(template.Timeline.Segments[0].D), timescale)
+	}
+	return 0
+}
+
+// dashSegment is a media segment placed on the presentation timeline.
+type dashSegment struct {
+	uri            string
+	init           string
+	representation string
+	start, end     time.Duration
+}
+
+// variants returns the number of representations offered by the last
+// period, where a live stream is followed.
+func (m *dashManifest) variants() int {
+	return len(m.periods[len(m.periods)-1].variants)
+}
+
+// selectVariant makes every period follow its level-th representation and
+// returns the bandwidth of the last period's.
+func (m *dashManifest) selectVariant(level int) int64 {
+	for i := range m.periods {
+		m.periods[i] = m.periods[i].withVariant(level)
+	}
+	return m.periods[len(m.periods)-1].bandwidth
+}
+
+func (m *dashManifest) refreshInterval(fallback time.Duration) time.Duration {
+	if m.minimumUpdatePeriod > 0 {
+		return m.minimumUpdatePeriod
+	}
+	return fallback
+}
+
+// parseMPD parses a manifest fetched from manifestURL. When track is set,
+// each period follows the audio adaptation set it selects.
+func parseMPD(body []byte, manifestURL *url.URL, track *sessionpkg.AudioTrackSelection) (*dashManifest, error) {
+	var doc mpdDocument
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+
+	manifest := &dashManifest{live: doc.Type == "dynamic"}
+	var err error
+	if manifest.minimumUpdatePeriod, err = parseOptionalISODuration(doc.MinimumUpdatePeriod); err != nil {
+		return nil, fmt.Errorf("parse minimumUpdatePeriod: %w", err)
+	}
+	if manifest.timeShiftBufferDepth, err = parseOptionalISODuration(doc.TimeShiftBufferDepth); err != nil {
+		return nil, fmt.Errorf("parse timeShiftBufferDepth: %w", err)
+	}
+	presentationDuration, err := parseOptionalISODuration(doc.MediaPresentationDuration)
+	if err != nil {
+		return nil, fmt.Errorf("parse mediaPresentationDuration: %w", err)
+	}
+	if doc.AvailabilityStartTime != "" {
+		if manifest.availabilityStartTime, err = time.Parse(time.RFC3339, doc.AvailabilityStartTime); err != nil {
+			return nil, fmt.Errorf("parse availabilityStartTime: %w", err)
+		}
+	}
+
+	base, err := resolveBaseURL(manifestURL, doc.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	var previousEnd time.Duration
+	for i, period := range doc.Periods {
+		parsed, err := parsePeriod(period, base, previousEnd, track)
+		if err != nil {
+			return nil, fmt.Errorf("period %d: %w", i, err)
+		}
+		if i > 0 && manifest.periods[i-1].end == 0 {
+			manifest.periods[i-1].end = parsed.start
+		}
+		manifest.periods = append(manifest.periods, parsed)
+		previousEnd = parsed.end
+	}
+	if len(manifest.periods) == 0 {
+		return nil, statuspkg.Fatal(errors.New("manifest has no periods"))
+	}
+	if last := &manifest.periods[len(manifest.periods)-1]; last.end == 0 && presentationDuration > 0 {
+		last.end = presentationDuration
+	}
+	return manifest, nil
+}
+
+func parsePeriod(period mpdPeriod, parent *url.URL, defaultStart time.Duration, track *sessionpkg.AudioTrackSelection) (dashPeriod, error) {
+	parsed := dashPeriod{start: defaultStart}
+	if period.Start != "" {
+		start, err := parseISODuration(period.Start)
+		if err != nil {
+			return dashPeriod{}, fmt.Errorf("parse start: %w", err)
+		}
+		parsed.start = start
+	}
+	if period.Duration != "" {
+		duration, err := parseISODuration(period.Duration)
+		if err != nil {
+			return dashPeriod{}, fmt.Errorf("parse duration: %w", err)
+		}
+		parsed.end = parsed.start + duration
+	}
+	periodBase, err := resolveBaseURL(parent, period.BaseURL)
+	if err != nil {
+		return dashPeriod{}, err
+	}
+
+	// Prefer audio; sessions only need the soundtrack. Manifests that
+	// multiplex audio into their video representations are followed
+	// through those.
+	isAudio := func(set mpdAdaptationSet, rep mpdRepresentation) bool {
+		return set.ContentType == "audio" || strings.HasPrefix(set.MimeType, "audio/") || strings.HasPrefix(rep.MimeType, "audio/")
+	}
+	selected, err := selectAdaptationSet(period.AdaptationSets, track, isAudio)
+	if err != nil {
+		return dashPeriod{}, err
+	}
+	audio := false
+	for i, set := range period.AdaptationSets {
+		for _, rep := range set.Representations {
+			repAudio := isAudio(set, rep)
+			if audio && !repAudio {
+				continue
+			}
+			if repAudio && selected >= 0 && i != selected {
+				continue
+			}
+			template := rep.SegmentTemplate.inherit(set.SegmentTemplate.inherit(period.SegmentTemplate))
+			if template == nil || template.Media == "" {
+				continue
+			}
+			setBase, err := resolveBaseURL(periodBase, set.BaseURL)
+			if err != nil {
+				return dashPeriod{}, err
+			}
+			repBase, err := resolveBaseURL(setBase, rep.BaseURL)
+			if err != nil {
+				return dashPeriod{}, err
+			}
+			if repAudio && !audio {
+				parsed.variants, audio = nil, true
+			}
+			variant := dashRepresentation{id: rep.ID, bandwidth: rep.Bandwidth, base: repBase, template: *template, mimeType: rep.MimeType, codecs: splitCodecs(rep.Codecs)}
+			if variant.mimeType == "" {
+				variant.mimeType = set.MimeType
+			}
+			if len(variant.codecs) == 0 {
+				variant.codecs = splitCodecs(set.Codecs)
+			}
+			parsed.variants = append(parsed.variants, variant)
+		}
+	}
+	if len(parsed.variants) == 0 {
+		return dashPeriod{}, statuspkg.Fatal(errors.New("no representation with a SegmentTemplate"))
+	}
+	for _, variant := range parsed.variants {
+		if variant.template.Timeline == nil && (variant.template.Duration == nil || *variant.template.Duration == 0) {
+			return dashPeriod{}, statuspkg.Fatal(errors.New("SegmentTemplate needs a duration or a SegmentTimeline"))
+		}
+	}
+	sort.SliceStable(parsed.variants, func(i, j int) bool { return parsed.variants[i].bandwidth < parsed.variants[j].bandwidth })
+	return parsed.withVariant(0), nil
+}
+
+// selectAdaptationSet returns the position of the audio adaptation set that
+// track selects by language or index among those carrying audio, or -1 when
+// there is no selection or no audio adaptation set to select from.
+func selectAdaptationSet(sets []mpdAdaptationSet, track *sessionpkg.AudioTrackSelection, isAudio func(mpdAdaptationSet, mpdRepresentation) bool) (int, error) {
+	if track == nil {
+		return -1, nil
+	}
+	var positions []int
+	var languages []string
+	for i, set := range sets {
+		for _, rep := range set.Representations {
+			if isAudio(set, rep) {
+				positions = append(positions, i)
+				languages = append(languages, set.Lang)
+				break
+			}
+		}
+	}
+	if len(positions) == 0 {
+		return -1, nil
+	}
+	index, err := track.Select(languages)
+	if err != nil {
+		return -1, statuspkg.Fatal(fmt.Errorf("select audio adaptation set: %w", err))
+	}
+	return positions[index], nil
+}
+
+func resolveBaseURL(parent *url.URL, base string) (*url.URL, error) {
+	base = strings.TrimSpace(base)
+	if base == "" {
+		return parent, nil
+	}
+	resolved, err := parent.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("resolve BaseURL %q: %w", base, err)
+	}
+	return resolved, nil
+}
+
+// segments lists the segments of every period available at now. For a
+// static manifest that is every segment.
+func (m *dashManifest) segments(now time.Time) ([]dashSegment, error) {
+	// liveEdge is the presentation time up to which media is available.
+	liveEdge := time.Duration(math.MaxInt64)
+	if m.live {
+		if m.availabilityStartTime.IsZero() {
+			return nil, statuspkg.Fatal(errors.New("live manifest without availabilityStartTime"))
+		}
+		liveEdge = now.Sub(m.availabilityStartTime)
+	}
+	var segments []dashSegment
+	for _, period := range m.periods {
+		if period.start >= liveEdge {
+			break
+		}
+		limit := liveEdge
+		if period.end > 0 && period.end < limit {
+			limit = period.end
+		}
+		if limit == time.Duration(math.MaxInt64) {
+			return nil, statuspkg.Fatal(errors.New("static manifest without a duration"))
+		}
+		periodSegments, err := period.segments(limit)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, periodSegments...)
+	}
+	if m.live && m.timeShiftBufferDepth > 0 {
+		oldest := liveEdge - m.timeShiftBufferDepth
+		for len(segments) > 0 && segments[0].start < oldest {
+			segments = segments[1:]
+		}
+	}
+	return segments, nil
+}
+
+// segments lists the period's segments that end by limit, a presentation
+// time.
+func (p dashPeriod) segments(limit time.Duration) ([]dashSegment, error) {
+	template := p.template
+	timescale := uint64(1)
+	if template.Timescale != nil && *template.Timescale > 0 {
+		timescale = *template.Timescale
+	}
+	number := uint64(1)
+	if template.StartNumber != nil {
+		number = *template.StartNumber
+	}
+	var offset uint64
+	if template.PresentationTimeOffset != nil {
+		offset = *template.PresentationTimeOffset
+	}
+	// at converts a media time in timescale units to presentation time.
+	at := func(ticks uint64) time.Duration {
+		return p.start + ticksToDuration(int64(ticks)-int64(offset), timescale)
+	}
+
+	var init string
+	if template.Initialization != "" {
+		uri, err := p.resolve(template.Initialization, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		init = uri
+	}
+	var segments []dashSegment
+	add := func(ticks, duration uint64) (bool, error) {
+		start, end := at(ticks), at(ticks+duration)
+		if end > limit {
+			return false, nil
+		}
+		uri, err := p.resolve(template.Media, number, ticks)
+		if err != nil {
+			return false, err
+		}
+		segments = append(segments, dashSegment{uri: uri, init: init, representation: p.representation, start: start, end: end})
+		number++
+		return true, nil
+	}
+
+	if template.Timeline != nil {
+		var ticks uint64
+		entries := template.Timeline.Segments
+		for i, entry := range entries {
+			if entry.T != nil {
+				ticks = *entry.T
+			}
+			if entry.D == 0 {
+				return nil, statuspkg.Fatal(errors.New("SegmentTimeline entry without a duration"))
+			}
+			repeats := entry.R
+			if repeats < 0 {
+				// Repeat up to the next entry, or for as long as the
+				// period has media.
+				repeats = math.MaxInt64
+				if i+1 < len(entries) && entries[i+1].T != nil {
+					repeats = int64((*entries[i+1].T-ticks)/entry.D) - 1
+				}
+			}
+			for r := int64(0); r <= repeats; r++ {
+				ok, err := add(ticks, entry.D)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					return segments, nil
+				}
+				ticks += entry.D
+			}
+		}
+		return segments, nil
+	}
+
+	duration := *template.Duration
+	ticks := offset
+	for {
+		ok, err := add(ticks, duration)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return segments, nil
+		}
+		ticks += duration
+	}
+}
+
+func ticksToDuration(ticks int64, timescale uint64) time.Duration {
+	seconds := ticks / int64(timescale)
+	remainder := ticks % int64(timescale)
+	return time.Duration(seconds)*time.Second + time.Duration(remainder)*time.Second/time.Duration(timescale)
+}
+
+// templateIdentifier matches the $Identifier$ and $Identifier%0Nd$
+// placeholders of a SegmentTemplate.
+var templateIdentifier = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth|)(%0\d+d)?\$`)
+
+// resolve expands a SegmentTemplate URL and resolves it against the
+// period's base URL.
+func (p dashPeriod) resolve(template string, number, ticks uint64) (string, error) {
+	expanded := templateIdentifier.ReplaceAllStringFunc(template, func(placeholder string) string {
+		match := templateIdentifier.FindStringSubmatch(placeholder)
+		var value string
+		switch match[1] {
+		case "":
+			return "$"
+		case "RepresentationID":
+			return p.representation
+		case "Number":
+			value = strconv.FormatUint(number, 10)
+		case "Time":
+			value = strconv.FormatUint(ticks, 10)
+		case "Bandwidth":
+			value = strconv.FormatInt(p.bandwidth, 10)
+		}
+		if match[2] != "" {
+			width, _ := strconv.Atoi(match[2][2 : len(match[2])-1])
+			if pad := width - len(value); pad > 0 {
+				value = strings.Repeat("0", pad) + value
+			}
+		}
+		return value
+	})
+	uri, err := p.base.Parse(expanded)
+	if err != nil {
+		return "", fmt.Errorf("resolve segment URL %q: %w", expanded, err)
+	}
+	return uri.String(), nil
+}
+
+// isoDuration matches the xs:duration values used by MPDs, such as
+// "PT1H2M3.5S" and "P1D".
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+func parseISODuration(value string) (time.Duration, error) {
+	match := isoDuration.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	var total time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute} {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(match[i+1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+		total += time.Duration(n) * unit
+	}
+	if match[4] != "" {
+		seconds, err := strconv.ParseFloat(match[4], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+		total += time.Duration(seconds * float64(time.Second))
+	}
+	return total, nil
+}
+
+func parseOptionalISODuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return parseISODuration(value)
+}
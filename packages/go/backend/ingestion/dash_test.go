@@ -0,0 +1,354 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func serveDASHSegments(handler *http.ServeMux) {
+	handler.HandleFunc("/media/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/media/")))
+	})
+}
+
+func TestDASHStreamSourceStreamsStaticManifest(t *testing.T) {
+	const manifest = `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT6S">
+  <BaseURL>../media/</BaseURL>
+  <Period>
+    <AdaptationSet contentType="video">
+      <SegmentTemplate media="$RepresentationID$-$Number$.m4s" duration="2" timescale="1"/>
+      <Representation id="video" bandwidth="100"/>
+    </AdaptationSet>
+    <AdaptationSet mimeType="audio/mp4">
+      <SegmentTemplate initialization="$RepresentationID$-init.mp4" media="$RepresentationID$-$Number%03d$.m4s" duration="96000" timescale="48000" startNumber="0"/>
+      <Representation id="audio-hi" bandwidth="128000"/>
+      <Representation id="audio-lo" bandwidth="64000"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+	handler := http.NewServeMux()
+	handler.HandleFunc("/stream/manifest.mpd", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(manifest))
+	})
+	serveDASHSegments(handler)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewDASHStreamSource(DASHConfig{
+		ManifestURL:  server.URL + "/stream/manifest.mpd",
+		Client:       server.Client(),
+		PollInterval: 10 * time.Millisecond,
+		BufferSize:   1,
+	})
+	if err != nil {
+		t.Fatalf("NewDASHStreamSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+
+	var received []MediaChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	if err := <-errs; !errors.Is(err, statuspkg.ErrSourceEnded) {
+		t.Fatalf("expected the source to end, got %v", err)
+	}
+
+	want := []string{"audio-lo-init.mp4", "audio-lo-000.m4s", "audio-lo-001.m4s", "audio-lo-002.m4s"}
+	if len(received) != len(want) {
+		t.Fatalf("expected %d chunks, got %d", len(want), len(received))
+	}
+	for i, chunk := range received {
+		if string(chunk.Payload) != want[i] {
+			t.Fatalf("chunk %d payload = %q, want %q", i, chunk.Payload, want[i])
+		}
+		if chunk.Metadata["representation"] != "audio-lo" {
+			t.Fatalf("chunk %d came from representation %q", i, chunk.Metadata["representation"])
+		}
+		if chunk.Sequence != int64(i+1) {
+			t.Fatalf("chunk %d sequence = %d", i, chunk.Sequence)
+		}
+	}
+	if received[0].Metadata["initialization"] != "true" || received[0].Duration != 0 {
+		t.Fatalf("expected the initialization segment first, got %+v", received[0])
+	}
+	if received[1].Duration != 2*time.Second {
+		t.Fatalf("segment duration = %v, want 2s", received[1].Duration)
+	}
+	metrics := source.Metrics()
+	if metrics.ReceivedChunks != int64(len(want)) {
+		t.Fatalf("metrics.ReceivedChunks = %d, want %d", metrics.ReceivedChunks, len(want))
+	}
+	if bytes := int64(len(strings.Join(want, ""))); metrics.ReceivedBytes != bytes {
+		t.Fatalf("metrics.ReceivedBytes = %d, want %d", metrics.ReceivedBytes, bytes)
+	}
+	if metrics.PlaylistUpdated.IsZero() {
+		t.Fatal("expected the manifest update to be recorded")
+	}
+}
+
+func TestDASHStreamSourceFollowsLiveTimeline(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		published = 5
+	)
+	availabilityStart := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	handler := http.NewServeMux()
+	handler.HandleFunc("/live/manifest.mpd", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// Every refresh publishes one more segment.
+		_, _ = fmt.Fprintf(w, `<MPD type="dynamic" availabilityStartTime="%s" minimumUpdatePeriod="PT0.01S">
+  <Period id="live" start="PT0S">
+    <AdaptationSet contentType="audio">
+      <Representation id="a" bandwidth="64000">
+        <SegmentTemplate media="/media/seg-$Time$.m4s" timescale="1000">
+          <SegmentTimeline><S t="%d" d="2000" r="-1"/></SegmentTimeline>
+        </SegmentTemplate>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`, availabilityStart, (published-5)*2000)
+		if published < 8 {
+			published++
+		}
+	})
+	serveDASHSegments(handler)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewDASHStreamSource(DASHConfig{
+		ManifestURL:      server.URL + "/live/manifest.mpd",
+		Client:           server.Client(),
+		PollInterval:     10 * time.Millisecond,
+		LiveEdgeSegments: 2,
+	})
+	if err != nil {
+		t.Fatalf("NewDASHStreamSource error: %v", err)
+	}
+	// Only the segments the manifest has published so far are available.
+	source.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		start, _ := time.Parse(time.RFC3339, availabilityStart)
+		return start.Add(time.Duration(published*2) * time.Second)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+
+	// The first manifest has six segments available; the source starts two
+	// from the live edge and then picks up each newly published segment.
+	want := []string{"seg-8000.m4s", "seg-10000.m4s", "seg-12000.m4s", "seg-14000.m4s"}
+	for i := range want {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("context done after %d segments", i)
+		case err := <-errs:
+			t.Fatalf("stream returned error: %v", err)
+		case chunk := <-chunks:
+			if string(chunk.Payload) != want[i] {
+				t.Fatalf("segment %d = %q, want %q", i, chunk.Payload, want[i])
+			}
+		}
+	}
+}
+
+func TestDASHStreamSourceClassifiesManifestErrors(t *testing.T) {
+	for status, fatal := range map[int]bool{
+		http.StatusNotFound:           true,
+		http.StatusServiceUnavailable: false,
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+
+		source, err := NewDASHStreamSource(DASHConfig{
+			ManifestURL:  server.URL + "/manifest.mpd",
+			Client:       server.Client(),
+			RetryBackoff: time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("NewDASHStreamSource error: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, errs := source.Stream(ctx)
+		streamErr := <-errs
+		cancel()
+		server.Close()
+
+		if got := errors.Is(streamErr, statuspkg.ErrFatal); got != fatal {
+			t.Fatalf("status %d: expected fatal %v, got error %v", status, fatal, streamErr)
+		}
+	}
+}
+
+func TestDASHPeriodResolvesTemplates(t *testing.T) {
+	base, _ := url.Parse("https://cdn.example.com/live/")
+	period := dashPeriod{base: base, representation: "audio=64000", bandwidth: 64000}
+
+	for template, want := range map[string]string{
+		"$RepresentationID$/$Number$.m4s":    "https://cdn.example.com/live/audio=64000/42.m4s",
+		"chunk-$Number%05d$-$Time$.m4s":      "https://cdn.example.com/live/chunk-00042-90000.m4s",
+		"$Bandwidth$/t$Time%03d$.m4s?x=$$":   "https://cdn.example.com/live/64000/t90000.m4s?x=$",
+		"/absolute/$Number%01d$.m4s":         "https://cdn.example.com/absolute/42.m4s",
+		"https://other.example.com/$Number$": "https://other.example.com/42",
+	} {
+		got, err := period.resolve(template, 42, 90000)
+		if err != nil {
+			t.Fatalf("resolve %q: %v", template, err)
+		}
+		if got != want {
+			t.Fatalf("resolve %q = %q, want %q", template, got, want)
+		}
+	}
+}
+
+func TestDASHManifestSelectsAudioAdaptationSet(t *testing.T) {
+	manifestURL, _ := url.Parse("https://cdn.example.com/vod/manifest.mpd")
+	manifest := []byte(`<MPD type="static" mediaPresentationDuration="PT4S">
+  <Period>
+    <AdaptationSet contentType="audio" lang="eng">
+      <SegmentTemplate media="en/$Number$.m4s" duration="2" timescale="1"/>
+      <Representation id="en-high" bandwidth="128000"/>
+      <Representation id="en-low" bandwidth="64000"/>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" lang="es">
+      <SegmentTemplate media="es/$Number$.m4s" duration="2" timescale="1"/>
+      <Representation id="es" bandwidth="96000"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`)
+
+	for _, tc := range []struct {
+		track *sessionpkg.AudioTrackSelection
+		want  string
+	}{
+		// Without a selection every audio representation is a candidate.
+		{track: nil, want: "en-low"},
+		{track: &sessionpkg.AudioTrackSelection{Language: "es"}, want: "es"},
+		{track: &sessionpkg.AudioTrackSelection{Language: "en"}, want: "en-low"},
+		{track: &sessionpkg.AudioTrackSelection{Index: 1}, want: "es"},
+	} {
+		parsed, err := parseMPD(manifest, manifestURL, tc.track)
+		if err != nil {
+			t.Fatalf("parse manifest: %v", err)
+		}
+		if got := parsed.periods[0].representation; got != tc.want {
+			t.Fatalf("track %+v: following %q, want %q", tc.track, got, tc.want)
+		}
+	}
+
+	if _, err := parseMPD(manifest, manifestURL, &sessionpkg.AudioTrackSelection{Index: 2}); !errors.Is(err, statuspkg.ErrFatal) {
+		t.Fatalf("expected a fatal error for a missing track, got %v", err)
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"PT0S":       0,
+		"PT2.5S":     2500 * time.Millisecond,
+		"PT1H2M3S":   time.Hour + 2*time.Minute + 3*time.Second,
+		"P1DT30M":    24*time.Hour + 30*time.Minute,
+		"PT1M0.040S": time.Minute + 40*time.Millisecond,
+	} {
+		got, err := parseISODuration(value)
+		if err != nil {
+			t.Fatalf("parse %q: %v", value, err)
+		}
+		if got != want {
+			t.Fatalf("parse %q = %v, want %v", value, got, want)
+		}
+	}
+	for _, value := range []string{"", "P", "PT", "1S", "PT1X"} {
+		if _, err := parseISODuration(value); err == nil {
+			t.Fatalf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestDASHStreamSourceSwitchesRepresentationsOnLag(t *testing.T) {
+	const manifest = `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT0.4S">
+  <BaseURL>../media/</BaseURL>
+  <Period>
+    <AdaptationSet mimeType="audio/mp4">
+      <SegmentTemplate initialization="$RepresentationID$-init.mp4" media="$RepresentationID$-$Number$.m4s" duration="50" timescale="1000" startNumber="0"/>
+      <Representation id="audio-lo" bandwidth="64000"/>
+      <Representation id="audio-hi" bandwidth="128000"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+	handler := http.NewServeMux()
+	handler.HandleFunc("/stream/manifest.mpd", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(manifest))
+	})
+	handler.HandleFunc("/media/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/media/")
+		// The high representation downloads slower than real time.
+		if strings.HasPrefix(name, "audio-hi-") && !strings.HasSuffix(name, "init.mp4") {
+			time.Sleep(60 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte(name))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewDASHStreamSource(DASHConfig{
+		ManifestURL:  server.URL + "/stream/manifest.mpd",
+		Client:       server.Client(),
+		PollInterval: 10 * time.Millisecond,
+		Adaptive:     &AdaptiveConfig{DownAfter: 2, UpAfter: 100},
+	})
+	if err != nil {
+		t.Fatalf("NewDASHStreamSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+	var received []MediaChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	if err := <-errs; !errors.Is(err, statuspkg.ErrSourceEnded) {
+		t.Fatalf("expected the source to end, got %v", err)
+	}
+
+	var payloads []string
+	for _, chunk := range received {
+		payloads = append(payloads, string(chunk.Payload))
+	}
+	want := []string{
+		"audio-hi-init.mp4", "audio-hi-0.m4s", "audio-hi-1.m4s",
+		"audio-lo-init.mp4", "audio-lo-2.m4s", "audio-lo-3.m4s", "audio-lo-4.m4s", "audio-lo-5.m4s", "audio-lo-6.m4s", "audio-lo-7.m4s",
+	}
+	if strings.Join(payloads, " ") != strings.Join(want, " ") {
+		t.Fatalf("chunks = %v, want %v", payloads, want)
+	}
+	if marked := received[4].Metadata; marked["variantSwitch"] != "down" || marked["bandwidth"] != "64000" {
+		t.Fatalf("expected the first low segment to be marked, got %v", marked)
+	}
+	if metrics := source.Metrics(); metrics.VariantSwitches != 1 {
+		t.Fatalf("metrics.VariantSwitches = %d, want 1", metrics.VariantSwitches)
+	}
+}
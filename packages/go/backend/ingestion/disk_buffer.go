@@ -0,0 +1,406 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// DiskBufferConfig configures NewDiskBufferedSource.
+type DiskBufferConfig struct {
+	// Dir holds the buffer's segment files, in a directory of their own
+	// that is removed once the stream stops. Defaults to os.TempDir().
+	Dir string
+	// MaxBytes bounds the size of the segment files. Defaults to 256 MiB.
+	MaxBytes int64
+	// MaxDuration bounds how long chunks may wait in the buffer. Zero
+	// leaves only MaxBytes in effect.
+	MaxDuration time.Duration
+	// BufferSize controls the channel buffer size for emitted chunks. Defaults to 4 when zero.
+	BufferSize int
+}
+
+// ringSegments is the number of segment files the buffer's bounds are
+// divided into; the oldest segment is discarded whole once a bound is hit.
+const ringSegments = 16
+
+// NewDiskBufferedSource wraps source so that its chunks are written to a
+// bounded buffer on disk as fast as they arrive and read back as fast as
+// the consumer takes them. A consumer that stalls for a few seconds thus
+// neither loses live content nor holds the source up. Once the buffer is
+// full, its oldest chunks are dropped.
+func NewDiskBufferedSource(source StreamSource, cfg DiskBufferConfig) (*DiskBufferedSource, error) {
+	if source == nil {
+		return nil, errors.New("source is required")
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = os.TempDir()
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 256 << 20
+	}
+	if cfg.MaxDuration < 0 {
+		return nil, errors.New("max buffer duration cannot be negative")
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 4
+	}
+	return &DiskBufferedSource{source: source, cfg: cfg}, nil
+}
+
+// DiskBufferedSource implements StreamSource by buffering another source on
+// disk.
+type DiskBufferedSource struct {
+	source  StreamSource
+	cfg     DiskBufferConfig
+	dropped atomic.Int64
+}
+
+// Stream streams the wrapped source through the buffer. Errors of the
+// wrapped source are reported as they occur, except for the end of the
+// source, which is reported once the buffered chunks have been emitted.
+func (s *DiskBufferedSource) Stream(ctx context.Context) (<-chan MediaChunk, <-chan error) {
+	chunks := make(chan MediaChunk, s.cfg.BufferSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(chunks)
+		defer close(errs)
+
+		report := func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+		dir, err := os.MkdirTemp(s.cfg.Dir, "chunks-")
+		if err != nil {
+			report(statuspkg.Fatal(fmt.Errorf("create chunk buffer: %w", err)))
+			return
+		}
+		defer os.RemoveAll(dir)
+		ring := newChunkRing(dir, s.cfg.MaxBytes, s.cfg.MaxDuration, &s.dropped)
+		defer ring.release()
+
+		sourceCtx, cancel := context.WithCancel(ctx)
+		written := make(chan struct{})
+		defer func() {
+			cancel()
+			<-written
+		}()
+		in, inErrs := s.source.Stream(sourceCtx)
+		go func() {
+			defer close(written)
+			var ended error
+			defer func() { ring.finish(ended) }()
+			for in != nil || inErrs != nil {
+				select {
+				case chunk, ok := <-in:
+					if !ok {
+						in = nil
+						continue
+					}
+					if err := ring.push(chunk); err != nil {
+						report(err)
+						cancel()
+						return
+					}
+				case err, ok := <-inErrs:
+					if !ok {
+						inErrs = nil
+						continue
+					}
+					if errors.Is(err, statuspkg.ErrSourceEnded) {
+						ended = err
+						continue
+					}
+					report(err)
+				}
+			}
+		}()
+
+		for {
+			chunk, ok, err := ring.next(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				report(err)
+				return
+			}
+			if !ok {
+				if ended := ring.ended(); ended != nil {
+					report(ended)
+				}
+				return
+			}
+			select {
+			case chunks <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return chunks, errs
+}
+
+// Metrics returns the wrapped source's counters, with the chunks the
+// buffer dropped added to its drops.
+func (s *DiskBufferedSource) Metrics() StreamMetrics {
+	metrics := s.source.Metrics()
+	metrics.DroppedChunks += s.dropped.Load()
+	return metrics
+}
+
+// Probe probes the wrapped source.
+func (s *DiskBufferedSource) Probe(ctx context.Context) (SourceProbe, error) {
+	prober, ok := s.source.(Prober)
+	if !ok {
+		return SourceProbe{}, ErrProbeUnsupported
+	}
+	return prober.Probe(ctx)
+}
+
+// chunkRing is a queue of chunks kept in a series of append-only segment
+// files. Chunks are written to the newest segment and read from the
+// oldest, which is deleted once read; when the buffer exceeds its bounds,
+// the oldest segment is deleted unread.
+type chunkRing struct {
+	dir          string
+	maxBytes     int64
+	maxAge       time.Duration
+	segmentBytes int64
+	segmentAge   time.Duration
+	dropped      *atomic.Int64
+	now          func() time.Time
+	// ready is signalled whenever a chunk is pushed or the writer finishes.
+	ready chan struct{}
+
+	mu       sync.Mutex
+	segments []*ringSegment
+	bytes    int64
+	created  int
+	finished bool
+	endErr   error
+}
+
+type ringSegment struct {
+	file    *os.File
+	created time.Time
+	size    int64
+	records int
+	// read and readOffset track the records already read.
+	read       int
+	readOffset int64
+}
+
+func newChunkRing(dir string, maxBytes int64, maxAge time.Duration, dropped *atomic.Int64) *chunkRing {
+	return &chunkRing{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		maxAge:       maxAge,
+		segmentBytes: max(maxBytes/ringSegments, 1),
+		segmentAge:   maxAge / ringSegments,
+		dropped:      dropped,
+		now:          time.Now,
+		ready:        make(chan struct{}, 1),
+	}
+}
+
+// push appends chunk to the newest segment, starting a new one when it is
+// full, and enforces the buffer's bounds.
+func (r *chunkRing) push(chunk MediaChunk) error {
+	record, err := encodeRingRecord(chunk)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	var segment *ringSegment
+	if len(r.segments) > 0 {
+		segment = r.segments[len(r.segments)-1]
+	}
+	if segment == nil || segment.size >= r.segmentBytes || (r.segmentAge > 0 && now.Sub(segment.created) >= r.segmentAge) {
+		if segment, err = r.rotate(now); err != nil {
+			return err
+		}
+	}
+	if _, err := segment.file.WriteAt(record, segment.size); err != nil {
+		return statuspkg.Transient(fmt.Errorf("buffer chunk: %w", err))
+	}
+	segment.size += int64(len(record))
+	segment.records++
+	r.bytes += int64(len(record))
+
+	for len(r.segments) > 1 {
+		oldest := r.segments[0]
+		if r.bytes <= r.maxBytes && (r.maxAge <= 0 || now.Sub(oldest.created) <= r.maxAge) {
+			break
+		}
+		r.dropped.Add(int64(oldest.records - oldest.read))
+		r.removeOldest()
+	}
+	r.signal()
+	return nil
+}
+
+func (r *chunkRing) rotate(now time.Time) (*ringSegment, error) {
+	r.created++
+	path := filepath.Join(r.dir, fmt.Sprintf("%08d.chunks", r.created))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, statuspkg.Transient(fmt.Errorf("create buffer segment: %w", err))
+	}
+	segment := &ringSegment{file: file, created: now}
+	r.segments = append(r.segments, segment)
+	return segment, nil
+}
+
+// next returns the oldest buffered chunk, waiting for one to be pushed.
+// It returns false once the writer has finished and every chunk was read.
+func (r *chunkRing) next(ctx context.Context) (MediaChunk, bool, error) {
+	for {
+		r.mu.Lock()
+		if len(r.segments) > 0 {
+			oldest := r.segments[0]
+			newest := r.segments[len(r.segments)-1]
+			if oldest.read < oldest.records {
+				offset := oldest.readOffset
+				// The segment is read outside the lock; if it is dropped
+				// meanwhile, the chunk was counted as dropped and is skipped.
+				r.mu.Unlock()
+				chunk, n, err := readRingRecord(oldest.file, offset)
+				r.mu.Lock()
+				if len(r.segments) == 0 || r.segments[0] != oldest {
+					r.mu.Unlock()
+					continue
+				}
+				if err != nil {
+					r.mu.Unlock()
+					return MediaChunk{}, false, err
+				}
+				oldest.read++
+				oldest.readOffset += n
+				r.mu.Unlock()
+				return chunk, true, nil
+			}
+			if oldest != newest {
+				r.removeOldest()
+				r.mu.Unlock()
+				continue
+			}
+		}
+		if r.finished {
+			r.mu.Unlock()
+			return MediaChunk{}, false, nil
+		}
+		r.mu.Unlock()
+		select {
+		case <-r.ready:
+		case <-ctx.Done():
+			return MediaChunk{}, false, ctx.Err()
+		}
+	}
+}
+
+// finish records that no more chunks will be pushed, and why.
+func (r *chunkRing) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finished, r.endErr = true, err
+	r.signal()
+}
+
+func (r *chunkRing) ended() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.endErr
+}
+
+// release closes and deletes the remaining segments.
+func (r *chunkRing) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(r.segments) > 0 {
+		r.removeOldest()
+	}
+}
+
+func (r *chunkRing) removeOldest() {
+	oldest := r.segments[0]
+	_ = oldest.file.Close()
+	_ = os.Remove(oldest.file.Name())
+	r.bytes -= oldest.size
+	r.segments = r.segments[1:]
+}
+
+func (r *chunkRing) signal() {
+	select {
+	case r.ready <- struct{}{}:
+	default:
+	}
+}
+
+// ringRecord is the header of a buffered chunk. A record is stored as the
+// lengths of its JSON header and payload, then the two themselves.
+type ringRecord struct {
+	Sequence  int64             `json:"sequence"`
+	Timestamp time.Time         `json:"timestamp"`
+	Duration  time.Duration     `json:"duration"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+func encodeRingRecord(chunk MediaChunk) ([]byte, error) {
+	header, err := json.Marshal(ringRecord{
+		Sequence:  chunk.Sequence,
+		Timestamp: chunk.Timestamp,
+		Duration:  chunk.Duration,
+		Metadata:  chunk.Metadata,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encode chunk: %w", err)
+	}
+	record := make([]byte, 8, 8+len(header)+len(chunk.Payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(header)))
+	binary.BigEndian.PutUint32(record[4:8], uint32(len(chunk.Payload)))
+	record = append(record, header...)
+	return append(record, chunk.Payload...), nil
+}
+
+// readRingRecord reads the record at offset, returning the chunk and the
+// record's length.
+func readRingRecord(file *os.File, offset int64) (MediaChunk, int64, error) {
+	lengths := make([]byte, 8)
+	if _, err := file.ReadAt(lengths, offset); err != nil {
+		return MediaChunk{}, 0, fmt.Errorf("read buffered chunk: %w", err)
+	}
+	headerLength := int(binary.BigEndian.Uint32(lengths[0:4]))
+	body := make([]byte, headerLength+int(binary.BigEndian.Uint32(lengths[4:8])))
+	if _, err := file.ReadAt(body, offset+8); err != nil {
+		return MediaChunk{}, 0, fmt.Errorf("read buffered chunk: %w", err)
+	}
+	var header ringRecord
+	if err := json.Unmarshal(body[:headerLength], &header); err != nil {
+		return MediaChunk{}, 0, fmt.Errorf("decode buffered chunk: %w", err)
+	}
+	return MediaChunk{
+		Sequence:  header.Sequence,
+		Timestamp: header.Timestamp,
+		Duration:  header.Duration,
+		Payload:   body[headerLength:],
+		Metadata:  header.Metadata,
+	}, int64(8 + len(body)), nil
+}
+
+var _ StreamSource = (*DiskBufferedSource)(nil)
@@ -0,0 +1,133 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// burstSource emits its chunks without waiting for the consumer, dropping
+// those that do not fit, and then ends.
+type burstSource struct {
+	chunks   []MediaChunk
+	counters streamCounters
+	done     chan struct{}
+}
+
+func newBurstSource(count, size int) *burstSource {
+	source := &burstSource{done: make(chan struct{})}
+	for i := 0; i < count; i++ {
+		payload := make([]byte, size)
+		copy(payload, fmt.Sprintf("chunk-%d", i))
+		source.chunks = append(source.chunks, MediaChunk{
+			Sequence:  int64(i),
+			Timestamp: time.Unix(int64(i), 0).UTC(),
+			Duration:  time.Second,
+			Payload:   payload,
+			Metadata:  map[string]string{"index": fmt.Sprint(i)},
+		})
+	}
+	return source
+}
+
+func (s *burstSource) Stream(ctx context.Context) (<-chan MediaChunk, <-chan error) {
+	chunks := make(chan MediaChunk, 1)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		defer close(errs)
+		defer close(s.done)
+		emitter := newChunkEmitter(chunks, Backpressure{}, &s.counters)
+		for _, chunk := range s.chunks {
+			emitter.emit(ctx, chunk)
+			// Give the buffer a moment to take each chunk.
+			time.Sleep(time.Millisecond)
+		}
+		errs <- statuspkg.ErrSourceEnded
+	}()
+	return chunks, errs
+}
+
+func (s *burstSource) Metrics() StreamMetrics {
+	return s.counters.snapshot()
+}
+
+func TestDiskBufferedSourceHoldsChunksForStalledConsumers(t *testing.T) {
+	dir := t.TempDir()
+	inner := newBurstSource(50, 1024)
+	source, err := NewDiskBufferedSource(inner, DiskBufferConfig{Dir: dir, MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("NewDiskBufferedSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+	// The consumer stalls until the source has emitted everything.
+	<-inner.done
+
+	var received []MediaChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	if err := <-errs; !errors.Is(err, statuspkg.ErrSourceEnded) {
+		t.Fatalf("expected the source to end, got %v", err)
+	}
+	if len(received) != 50 {
+		t.Fatalf("received %d chunks, want 50", len(received))
+	}
+	for i, chunk := range received {
+		want := inner.chunks[i]
+		if chunk.Sequence != want.Sequence || !chunk.Timestamp.Equal(want.Timestamp) || chunk.Duration != want.Duration ||
+			string(chunk.Payload) != string(want.Payload) || chunk.Metadata["index"] != want.Metadata["index"] {
+			t.Fatalf("chunk %d = %+v, want %+v", i, chunk, want)
+		}
+	}
+	if metrics := source.Metrics(); metrics.DroppedChunks != 0 {
+		t.Fatalf("expected no drops, got %+v", metrics)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected the buffer to be removed, found %v", entries)
+	}
+}
+
+func TestDiskBufferedSourceDropsOldestChunksWhenFull(t *testing.T) {
+	inner := newBurstSource(64, 1024)
+	source, err := NewDiskBufferedSource(inner, DiskBufferConfig{Dir: t.TempDir(), MaxBytes: 16 << 10})
+	if err != nil {
+		t.Fatalf("NewDiskBufferedSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+	<-inner.done
+
+	var received []MediaChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	if err := <-errs; !errors.Is(err, statuspkg.ErrSourceEnded) {
+		t.Fatalf("expected the source to end, got %v", err)
+	}
+	if len(received) == 0 || len(received) >= 64 {
+		t.Fatalf("expected the buffer to keep part of the stream, got %d chunks", len(received))
+	}
+	if last := received[len(received)-1].Sequence; last != 63 {
+		t.Fatalf("expected the newest chunk to be kept, last is %d", last)
+	}
+	for i := 1; i < len(received); i++ {
+		if received[i].Sequence <= received[i-1].Sequence {
+			t.Fatalf("expected the kept chunks in order, got %d after %d", received[i].Sequence, received[i-1].Sequence)
+		}
+	}
+	metrics := source.Metrics()
+	if metrics.DroppedChunks+int64(len(received)) != 64 {
+		t.Fatalf("expected every chunk to be received or dropped, got %d received and %+v", len(received), metrics)
+	}
+}
@@ -0,0 +1,329 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// FailoverPolicy says when a source is given up for the next one.
+type FailoverPolicy struct {
+	// MaxErrors is the number of errors a source may report, with no chunk
+	// in between, before it is given up. A fatal error gives it up at once.
+	// Defaults to 3.
+	MaxErrors int
+	// StallTimeout gives a source up once it has emitted no chunk for this
+	// long. Defaults to 15s.
+	StallTimeout time.Duration
+}
+
+// FailoverConfig configures NewFailoverSource.
+type FailoverConfig struct {
+	// URIs name redundant copies of the stream, primary first.
+	URIs []string
+	// Open creates the source for one of the URIs.
+	Open   func(uri string) (StreamSource, error)
+	Policy FailoverPolicy
+	// BufferSize controls the channel buffer size for emitted chunks. Defaults to 8 when zero.
+	BufferSize int
+}
+
+// NewFailoverSource constructs a StreamSource that streams the first of
+// several redundant URIs and switches to the next one when the current one
+// keeps failing or stalls.
+func NewFailoverSource(cfg FailoverConfig) (*FailoverSource, error) {
+	if len(cfg.URIs) == 0 {
+		return nil, errors.New("at least one source URI is required")
+	}
+	if cfg.Open == nil {
+		return nil, errors.New("source opener is required")
+	}
+	if cfg.Policy.MaxErrors <= 0 {
+		cfg.Policy.MaxErrors = 3
+	}
+	if cfg.Policy.StallTimeout <= 0 {
+		cfg.Policy.StallTimeout = 15 * time.Second
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 8
+	}
+	return &FailoverSource{cfg: cfg, counters: &streamCounters{}}, nil
+}
+
+// FailoverSource implements StreamSource over redundant copies of a stream.
+// The first chunk after a switch carries "failover" and "discontinuity"
+// metadata, with the index of the URI switched to in "sourceIndex". Chunks
+// the new source repeats from before the switch are skipped: HLS segments
+// by media sequence number, and other chunks by the path of their URI.
+// Once every URI has failed in turn, the last error is reported.
+type FailoverSource struct {
+	cfg      FailoverConfig
+	counters *streamCounters
+
+	mu sync.Mutex
+	// current is the source being streamed, and dropped and switches the
+	// drops and variant switches of the sources given up.
+	current  StreamSource
+	dropped  int64
+	switches int64
+}
+
+// Stream streams the current URI, failing over as the policy says.
+func (s *FailoverSource) Stream(ctx context.Context) (<-chan MediaChunk, <-chan error) {
+	chunks := make(chan MediaChunk, s.cfg.BufferSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(chunks)
+		defer close(errs)
+		defer s.retire()
+
+		dedupe := newChunkDeduper()
+		// failures counts the URIs given up in a row without any of them
+		// emitting a chunk.
+		index, failures := 0, 0
+		for {
+			progressed, err := s.stream(ctx, s.cfg.URIs[index], chunks, dedupe)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil || errors.Is(err, statuspkg.ErrSourceEnded) {
+				if err != nil {
+					errs <- err
+				}
+				return
+			}
+			if progressed {
+				failures = 0
+			}
+			failures++
+			if failures >= len(s.cfg.URIs) {
+				errs <- err
+				return
+			}
+			index = (index + 1) % len(s.cfg.URIs)
+			s.counters.reconnect.Add(1)
+			dedupe.failover(index)
+		}
+	}()
+
+	return chunks, errs
+}
+
+// stream forwards the chunks of the source at uri until it ends, which
+// returns nil or statuspkg.ErrSourceEnded, or is given up, which returns
+// why. It also reports whether the source emitted any chunk.
+func (s *FailoverSource) stream(ctx context.Context, uri string, chunks chan<- MediaChunk, dedupe *chunkDeduper) (bool, error) {
+	source, err := s.cfg.Open(uri)
+	if err != nil {
+		s.counters.errors.Add(1)
+		return false, statuspkg.Fatal(fmt.Errorf("open source: %w", err))
+	}
+	s.retire()
+	s.mu.Lock()
+	s.current = source
+	s.mu.Unlock()
+
+	sourceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	in, inErrs := source.Stream(sourceCtx)
+	stall := time.NewTimer(s.cfg.Policy.StallTimeout)
+	defer stall.Stop()
+	var (
+		errorCount int
+		progressed bool
+		ended      error
+	)
+	for in != nil || inErrs != nil {
+		select {
+		case <-ctx.Done():
+			return progressed, ctx.Err()
+		case <-stall.C:
+			s.counters.errors.Add(1)
+			return progressed, statuspkg.Transient(fmt.Errorf("source emitted no chunk for %s", s.cfg.Policy.StallTimeout))
+		case err, ok := <-inErrs:
+			if !ok {
+				inErrs = nil
+				continue
+			}
+			if errors.Is(err, statuspkg.ErrSourceEnded) {
+				ended = err
+				continue
+			}
+			s.counters.errors.Add(1)
+			errorCount++
+			if errors.Is(err, statuspkg.ErrFatal) || errorCount >= s.cfg.Policy.MaxErrors {
+				return progressed, err
+			}
+		case chunk, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			errorCount, progressed = 0, true
+			if chunk, ok = dedupe.admit(chunk); ok {
+				chunk.Sequence = s.counters.sequence.Add(1)
+				select {
+				case chunks <- chunk:
+					s.counters.receive(chunk)
+				case <-ctx.Done():
+					return progressed, ctx.Err()
+				}
+			}
+			// Time spent waiting for the consumer does not count as a stall.
+			if !stall.Stop() {
+				select {
+				case <-stall.C:
+				default:
+				}
+			}
+			stall.Reset(s.cfg.Policy.StallTimeout)
+		}
+	}
+	return progressed, ended
+}
+
+// retire folds the drops and variant switches of the current source into
+// the totals.
+func (s *FailoverSource) retire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil {
+		metrics := s.current.Metrics()
+		s.dropped += metrics.DroppedChunks
+		s.switches += metrics.VariantSwitches
+		s.current = nil
+	}
+}
+
+// Metrics returns the failover counters, with ReconnectCount counting the
+// switches between URIs. PlaylistUpdated is the current source's.
+func (s *FailoverSource) Metrics() StreamMetrics {
+	metrics := s.counters.snapshot()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	metrics.DroppedChunks, metrics.VariantSwitches = s.dropped, s.switches
+	if s.current != nil {
+		current := s.current.Metrics()
+		metrics.DroppedChunks += current.DroppedChunks
+		metrics.VariantSwitches += current.VariantSwitches
+		metrics.PlaylistUpdated = current.PlaylistUpdated
+	}
+	return metrics
+}
+
+// Probe probes the URIs in order and returns the first description one of
+// them gives, or the last error once every URI has failed.
+func (s *FailoverSource) Probe(ctx context.Context) (SourceProbe, error) {
+	var err error
+	for _, uri := range s.cfg.URIs {
+		var source StreamSource
+		if source, err = s.cfg.Open(uri); err != nil {
+			continue
+		}
+		prober, ok := source.(Prober)
+		if !ok {
+			err = ErrProbeUnsupported
+			continue
+		}
+		var probe SourceProbe
+		if probe, err = prober.Probe(ctx); err == nil {
+			return probe, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return SourceProbe{}, err
+}
+
+// dedupeWindow bounds the chunk URIs remembered to detect repeats.
+const dedupeWindow = 256
+
+// chunkDeduper recognizes the chunks a backup source repeats from before a
+// failover, and marks the first chunk after it.
+type chunkDeduper struct {
+	// lastSequence is the newest media sequence number emitted, and
+	// boundary its value at the last failover.
+	lastSequence, boundary int64
+	haveSequence, switched bool
+	// paths holds the most recent chunk URI paths, oldest first in order.
+	paths map[string]bool
+	order []string
+	// pending holds the index of the source switched to until its first
+	// chunk is admitted.
+	pending string
+}
+
+func newChunkDeduper() *chunkDeduper {
+	return &chunkDeduper{paths: make(map[string]bool)}
+}
+
+func (d *chunkDeduper) failover(index int) {
+	d.pending = strconv.Itoa(index)
+	d.boundary, d.switched = d.lastSequence, d.haveSequence
+}
+
+// admit reports whether chunk is new, returning it with the failover marks
+// added.
+func (d *chunkDeduper) admit(chunk MediaChunk) (MediaChunk, bool) {
+	// Initialization chunks are needed to decode whatever follows them.
+	if chunk.Metadata["initialization"] != "true" {
+		if raw, ok := chunk.Metadata["mediaSequence"]; ok {
+			if sequence, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				// Parts share their segment's number, so only numbers up to
+				// the last one before the failover are repeats.
+				if d.switched && sequence <= d.boundary {
+					return chunk, false
+				}
+				if !d.haveSequence || sequence > d.lastSequence {
+					d.lastSequence, d.haveSequence = sequence, true
+				}
+			}
+		} else if path := chunkPath(chunk); path != "" {
+			if d.paths[path] {
+				return chunk, false
+			}
+			d.paths[path] = true
+			d.order = append(d.order, path)
+			if len(d.order) > dedupeWindow {
+				delete(d.paths, d.order[0])
+				d.order = d.order[1:]
+			}
+		}
+	}
+	if d.pending != "" {
+		metadata := make(map[string]string, len(chunk.Metadata)+3)
+		for k, v := range chunk.Metadata {
+			metadata[k] = v
+		}
+		metadata["failover"] = "true"
+		metadata["discontinuity"] = "true"
+		metadata["sourceIndex"] = d.pending
+		chunk.Metadata = metadata
+		d.pending = ""
+	}
+	return chunk, true
+}
+
+// chunkPath returns the path of the resource a chunk was fetched from,
+// which redundant copies of a stream on different hosts share.
+func chunkPath(chunk MediaChunk) string {
+	raw := chunk.Metadata["uri"]
+	if raw == "" {
+		return ""
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return parsed.Path
+}
+
+var _ StreamSource = (*FailoverSource)(nil)
@@ -0,0 +1,139 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// scriptedSource emits chunks numbered by media sequence, then reports its
+// errors, and then either ends or stays silent until cancelled.
+type scriptedSource struct {
+	sequences []int64
+	errs      []error
+	hang      bool
+	ended     bool
+}
+
+func (s *scriptedSource) Stream(ctx context.Context) (<-chan MediaChunk, <-chan error) {
+	chunks := make(chan MediaChunk)
+	errs := make(chan error)
+	go func() {
+		defer close(chunks)
+		defer close(errs)
+		for _, sequence := range s.sequences {
+			chunk := MediaChunk{Payload: []byte(strconv.FormatInt(sequence, 10)), Metadata: map[string]string{"mediaSequence": strconv.FormatInt(sequence, 10)}}
+			select {
+			case chunks <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for _, err := range s.errs {
+			select {
+			case errs <- err:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if s.hang {
+			<-ctx.Done()
+		}
+		if s.ended {
+			select {
+			case errs <- statuspkg.ErrSourceEnded:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return chunks, errs
+}
+
+func (s *scriptedSource) Metrics() StreamMetrics {
+	return StreamMetrics{DroppedChunks: 1}
+}
+
+func collectFailover(t *testing.T, sources map[string]*scriptedSource, policy FailoverPolicy, uris ...string) ([]MediaChunk, error, *FailoverSource) {
+	t.Helper()
+	source, err := NewFailoverSource(FailoverConfig{
+		URIs:   uris,
+		Open:   func(uri string) (StreamSource, error) { return sources[uri], nil },
+		Policy: policy,
+	})
+	if err != nil {
+		t.Fatalf("NewFailoverSource error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+	var received []MediaChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	return received, <-errs, source
+}
+
+func TestFailoverSourceSwitchesAfterRepeatedErrors(t *testing.T) {
+	transient := statuspkg.Transient(errors.New("playlist returned 503 Service Unavailable"))
+	sources := map[string]*scriptedSource{
+		"primary": {sequences: []int64{10, 11, 12}, errs: []error{transient, transient}, hang: true},
+		"backup":  {sequences: []int64{11, 12, 13, 14}, ended: true},
+	}
+	received, err, source := collectFailover(t, sources, FailoverPolicy{MaxErrors: 2}, "primary", "backup")
+	if !errors.Is(err, statuspkg.ErrSourceEnded) {
+		t.Fatalf("expected the backup to end the stream, got %v", err)
+	}
+
+	var payloads []string
+	for i, chunk := range received {
+		payloads = append(payloads, string(chunk.Payload))
+		if chunk.Sequence != int64(i+1) {
+			t.Fatalf("chunk %d has sequence %d", i, chunk.Sequence)
+		}
+	}
+	if got := payloads; len(got) != 5 || got[2] != "12" || got[3] != "13" {
+		t.Fatalf("expected the overlap to be skipped, got %v", got)
+	}
+	if marked := received[3].Metadata; marked["failover"] != "true" || marked["discontinuity"] != "true" || marked["sourceIndex"] != "1" {
+		t.Fatalf("expected the first backup chunk to be marked, got %v", marked)
+	}
+	if received[4].Metadata["failover"] != "" {
+		t.Fatalf("expected only the first backup chunk to be marked, got %v", received[4].Metadata)
+	}
+	if metrics := source.Metrics(); metrics.ReconnectCount != 1 || metrics.ErrorCount != 2 || metrics.DroppedChunks != 2 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+}
+
+func TestFailoverSourceSwitchesStalledSources(t *testing.T) {
+	sources := map[string]*scriptedSource{
+		"primary": {sequences: []int64{1}, hang: true},
+		"backup":  {sequences: []int64{1, 2}, ended: true},
+	}
+	received, err, _ := collectFailover(t, sources, FailoverPolicy{StallTimeout: 20 * time.Millisecond}, "primary", "backup")
+	if !errors.Is(err, statuspkg.ErrSourceEnded) {
+		t.Fatalf("expected the backup to end the stream, got %v", err)
+	}
+	if len(received) != 2 || string(received[1].Payload) != "2" {
+		t.Fatalf("unexpected chunks %+v", received)
+	}
+}
+
+func TestFailoverSourceFailsOnceEveryURIFailed(t *testing.T) {
+	fatal := statuspkg.Fatal(errors.New("playlist returned 404 Not Found"))
+	sources := map[string]*scriptedSource{
+		"primary": {errs: []error{fatal}, hang: true},
+		"backup":  {errs: []error{fatal}, hang: true},
+	}
+	received, err, _ := collectFailover(t, sources, FailoverPolicy{}, "primary", "backup")
+	if !errors.Is(err, statuspkg.ErrFatal) {
+		t.Fatalf("expected the last fatal error, got %v", err)
+	}
+	if len(received) != 0 {
+		t.Fatalf("unexpected chunks %+v", received)
+	}
+}
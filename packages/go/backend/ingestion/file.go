@@ -5,10 +5,13 @@ import (
 	"context"
 	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
+
+	statuspkg "streamlation/packages/backend/status"
 )
 
 // FileConfig configures the file-backed stream source.
@@ -63,6 +66,9 @@ func (f *fileStreamSource) Stream(ctx context.Context) (<-chan MediaChunk, <-cha
 
 		file, err := os.Open(f.cfg.Path)
 		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+				err = statuspkg.Fatal(err)
+			}
 			errs <- err
 			f.recordError()
 			return
@@ -110,7 +116,7 @@ func (f *fileStreamSource) Stream(ctx context.Context) (<-chan MediaChunk, <-cha
 			case <-ctx.Done():
 				return
 			case chunks <- chunk:
-				f.recordChunk(sequence)
+				f.recordChunk(chunk)
 			}
 
 			sequence++
@@ -133,17 +139,32 @@ func (f *fileStreamSource) Stream(ctx context.Context) (<-chan MediaChunk, <-cha
 	return chunks, errs
 }
 
+// Probe sniffs the container from the start of the file, falling back to
+// its extension.
+func (f *fileStreamSource) Probe(ctx context.Context) (SourceProbe, error) {
+	file, err := os.Open(f.cfg.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			err = statuspkg.Fatal(err)
+		}
+		return SourceProbe{}, err
+	}
+	defer func() { _ = file.Close() }()
+	return probeHeader(file, f.cfg.Path)
+}
+
 func (f *fileStreamSource) Metrics() StreamMetrics {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	return f.metrics
 }
 
-func (f *fileStreamSource) recordChunk(sequence int64) {
+func (f *fileStreamSource) recordChunk(chunk MediaChunk) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	f.metrics.ReceivedChunks++
-	f.metrics.LastSequence = sequence
+	f.metrics.ReceivedBytes += int64(len(chunk.Payload))
+	f.metrics.LastSequence = chunk.Sequence
 }
 
 func (f *fileStreamSource) recordError() {
@@ -9,9 +9,13 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
 )
 
 // HLSConfig tunes behaviour of the HLS stream source.
@@ -23,6 +27,22 @@ type HLSConfig struct {
 	RetryBackoff    time.Duration
 	MaxRetryBackoff time.Duration
 	MaxSeenSegments int
+	// Backpressure selects what happens to segments while the consumer
+	// is behind. By default they are dropped.
+	Backpressure Backpressure
+	// Resolve, when set, returns the media playlist to poll in place of
+	// PlaylistURL. It is called before the first request and again when
+	// the playlist is refused, as signed playlist URLs expire.
+	Resolve func(ctx context.Context) (string, error)
+	// Adaptive, when set, switches between the variants of a master
+	// playlist as downloads lag or keep up.
+	Adaptive *AdaptiveConfig
+	// Concurrency is the number of segments downloaded at once. They are
+	// still emitted in playlist order. Defaults to 1.
+	Concurrency int
+	// AudioTrack, when set, selects the audio rendition of a master
+	// playlist to follow by language or index instead of its default.
+	AudioTrack *sessionpkg.AudioTrackSelection
 }
 
 // NewHLSStreamSource constructs a StreamSource that pulls media chunks from an HLS playlist.
@@ -31,7 +51,7 @@ func NewHLSStreamSource(cfg HLSConfig) (*HLSStreamSource, error) {
 		return nil, errors.New("playlist URL is required")
 	}
 	if cfg.Client == nil {
-		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+		cfg.Client = NewHTTPClient(10 * time.Second)
 	}
 	if cfg.PollInterval <= 0 {
 		cfg.PollInterval = 2 * time.Second
@@ -48,6 +68,9 @@ func NewHLSStreamSource(cfg HLSConfig) (*HLSStreamSource, error) {
 	if cfg.MaxSeenSegments <= 0 {
 		cfg.MaxSeenSegments = 256
 	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
 	playlistURL, err := url.Parse(cfg.PlaylistURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid playlist URL: %w", err)
@@ -60,6 +83,15 @@ func NewHLSStreamSource(cfg HLSConfig) (*HLSStreamSource, error) {
 }
 
 // HLSStreamSource implements StreamSource for HTTP Live Streaming playlists.
+// Segments encrypted with AES-128 or SAMPLE-AES under an identity key are
+// decrypted before they are emitted. Byte-range segments are fetched with
+// Range requests, and fMP4 segments are preceded by their #EXT-X-MAP
+// initialization section, emitted once each time it changes.
+//
+// A master playlist is narrowed to its audio-only variants, or its audio
+// rendition, when it has them; a rendition selected by cfg.AudioTrack takes
+// precedence over both. Of the remaining variants, the source follows
+// the lowest-bandwidth one, or switches between them under cfg.Adaptive.
 type HLSStreamSource struct {
 	cfg         HLSConfig
 	playlistURL *url.URL
@@ -67,6 +99,12 @@ type HLSStreamSource struct {
 }
 
 // Stream starts polling the playlist and emits newly discovered segments.
+// Low-latency playlists are followed part by part: each partial segment is
+// emitted as soon as it is listed, or as soon as it is published when the
+// playlist hints at it, and the playlist is reloaded with blocking requests
+// when the server supports them. Once a playlist marked with
+// #EXT-X-ENDLIST has been emitted in full, the source reports
+// status.ErrSourceEnded and stops.
 func (s *HLSStreamSource) Stream(ctx context.Context) (<-chan MediaChunk, <-chan error) {
 	chunks := make(chan MediaChunk, s.cfg.BufferSize)
 	errs := make(chan error, 1)
@@ -76,17 +114,238 @@ func (s *HLSStreamSource) Stream(ctx context.Context) (<-chan MediaChunk, <-chan
 		defer close(errs)
 
 		client := s.cfg.Client
+		poller := newDocumentPoller()
+		decrypter := newHLSDecrypter(client)
 		seenSegments := make(map[string]int64)
 		backoff := s.cfg.RetryBackoff
 		var seenCounter int64
 		maxSeen := s.cfg.MaxSeenSegments
+		// partial holds the media sequence numbers of segments emitted as
+		// parts, whose full segments must not be emitted again.
+		partial := make(map[int64]bool)
+		// reload carries the blocking reload parameters of the next playlist
+		// request.
+		var reload url.Values
+		// resolved is set once cfg.Resolve has returned the playlist URL
+		// currently polled.
+		var resolved bool
+		// lastSequence is the media sequence number of the newest chunk.
+		var (
+			lastSequence int64
+			emitted      bool
+			// lastInit identifies the initialization section emitted last.
+			lastInit string
+		)
+		// variants are those of the master playlist, if any, and level the
+		// one followed. Segments the previous variant emitted, up to
+		// media sequence number floor, are skipped after a switch.
+		var (
+			variants     []hlsVariant
+			level        int
+			adaptive     = newAdaptiveController(s.cfg.Adaptive)
+			switchTo     = -1
+			floor        int64
+			floored      bool
+			pendingMarks *variantSwitch
+		)
+		// newest describes the newest media the playlist listed, to tell
+		// when it last listed more.
+		type listing struct {
+			sequence int64
+			parts    int
+			complete bool
+		}
+		var newest listing
+
+		markSeen := func(key string) bool {
+			if _, seen := seenSegments[key]; seen {
+				return false
+			}
+			seenCounter++
+			seenSegments[key] = seenCounter
+			if len(seenSegments) > maxSeen {
+				threshold := seenCounter - int64(maxSeen)
+				for uri, seq := range seenSegments {
+					if seq <= threshold {
+						delete(seenSegments, uri)
+					}
+				}
+			}
+			return true
+		}
+		// fail reports a failed download and leaves it to be retried on the
+		// next reload.
+		fail := func(key string, err error) bool {
+			s.counters.errors.Add(1)
+			delete(seenSegments, key)
+			select {
+			case errs <- err:
+			default:
+			}
+			return false
+		}
+		emitter := newChunkEmitter(chunks, s.cfg.Backpressure, s.counters)
+		// deliver emits a downloaded segment or part. parallel is the
+		// number of downloads that shared the link with it.
+		deliver := func(f hlsFetch, result hlsDownload, parallel int) bool {
+			if result.err != nil {
+				return fail(f.key, result.err)
+			}
+			seg := f.seg
+			// fMP4 segments cannot be decoded without their initialization
+			// section, which precedes them whenever it changes.
+			if seg.init != nil && seg.init.id() != lastInit {
+				data := result.init
+				if !f.init {
+					// The download that was to fetch it failed.
+					var err error
+					if data, err = s.downloadInit(ctx, client, decrypter, f); err != nil {
+						return fail(f.key, err)
+					}
+				}
+				emitter.emit(ctx, MediaChunk{
+					Sequence:  s.counters.sequence.Add(1),
+					Timestamp: time.Now().UTC(),
+					Payload:   data,
+					Metadata: map[string]string{
+						"uri":            seg.init.uri,
+						"initialization": "true",
+					},
+				})
+				lastInit = seg.init.id()
+			}
+
+			uri, duration, _, _ := f.media()
+			// Hinted parts have no duration; their requests wait for the
+			// part to be published, so they say nothing about lag.
+			// Downloads sharing the link keep up when they finish within
+			// their combined duration.
+			if adaptive != nil && len(variants) > 1 {
+				if next, ok := adaptive.observe(result.elapsed, duration*time.Duration(parallel)); ok {
+					switchTo = next
+				}
+			}
+
+			chunk := MediaChunk{
+				Sequence:  s.counters.sequence.Add(1),
+				Timestamp: time.Now().UTC(),
+				Duration:  duration,
+				Payload:   result.data,
+				Metadata: map[string]string{
+					"uri":           uri,
+					"mediaSequence": strconv.FormatInt(seg.sequence, 10),
+				},
+			}
+			// Chunks that do not continue the previous one, whether the
+			// playlist says so or segments were skipped, are marked so later
+			// stages can reset their decoder and timestamp state.
+			if !emitted || seg.sequence != lastSequence {
+				jumped := emitted && seg.sequence != lastSequence+1
+				if jumped || seg.discontinuity {
+					chunk.Metadata["discontinuity"] = "true"
+				}
+			}
+			lastSequence, emitted = seg.sequence, true
+			if pendingMarks != nil {
+				pendingMarks.mark(chunk.Metadata)
+				pendingMarks = nil
+			}
+			if seg.init != nil {
+				chunk.Metadata["initSegment"] = seg.init.id()
+			}
+			if part := f.part; part != nil {
+				chunk.Metadata["part"] = "true"
+				if part.independent {
+					chunk.Metadata["independent"] = "true"
+				}
+			}
+			emitter.emit(ctx, chunk)
+			return true
+		}
+		// fetchAll downloads fetches, up to cfg.Concurrency at once, and
+		// emits them in order. It reports whether any was emitted and
+		// whether all were; it stops early when the variant is to be
+		// switched. Results wait for their turn in the download slots, so
+		// at most cfg.Concurrency segments are held at once.
+		fetchAll := func(fetches []hlsFetch) (progressed, complete bool) {
+			planned := lastInit
+			for i := range fetches {
+				fetches[i].playlist = s.playlistURL
+				if init := fetches[i].seg.init; init != nil && init.id() != planned {
+					fetches[i].init, planned = true, init.id()
+				}
+			}
+			batchCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			results := make([]chan hlsDownload, len(fetches))
+			for i := range results {
+				results[i] = make(chan hlsDownload, 1)
+			}
+			slots := make(chan struct{}, s.cfg.Concurrency)
+			go func() {
+				for i, f := range fetches {
+					select {
+					case slots <- struct{}{}:
+					case <-batchCtx.Done():
+						return
+					}
+					go func() {
+						results[i] <- s.download(batchCtx, client, decrypter, f)
+					}()
+				}
+			}()
+
+			// Fetches left undelivered are to be retried on the next reload.
+			unsee := func(rest []hlsFetch) {
+				for _, f := range rest {
+					delete(seenSegments, f.key)
+				}
+			}
+			parallel := min(s.cfg.Concurrency, len(fetches))
+			complete = true
+			for i, f := range fetches {
+				if switchTo >= 0 {
+					unsee(fetches[i:])
+					return progressed, false
+				}
+				var result hlsDownload
+				select {
+				case result = <-results[i]:
+				case <-ctx.Done():
+					return progressed, false
+				}
+				<-slots
+				if deliver(f, result, parallel) {
+					progressed = true
+				} else {
+					complete = false
+				}
+			}
+			return progressed, complete
+		}
 
 		for {
 			if ctx.Err() != nil {
 				return
 			}
 
-			segments, err := s.fetchSegments(ctx, client)
+			var (
+				playlist *hlsPlaylist
+				err      error
+			)
+			resolving := s.cfg.Resolve != nil && !resolved
+			if resolving {
+				err = s.resolvePlaylistURL(ctx)
+				resolved = err == nil
+			}
+			if err == nil {
+				playlist, err = s.fetchPlaylist(ctx, client, poller, reload)
+			}
+			if err != nil && s.cfg.Resolve != nil && resolved && !resolving && errors.Is(err, statuspkg.ErrFatal) {
+				resolved = false
+				reload = nil
+				continue
+			}
 			if err != nil {
 				s.counters.errors.Add(1)
 				select {
@@ -102,51 +361,92 @@ func (s *HLSStreamSource) Stream(ctx context.Context) (<-chan MediaChunk, <-chan
 					backoff = next
 				}
 				s.counters.reconnect.Add(1)
+				reload = nil
 				continue
 			}
 
 			backoff = s.cfg.RetryBackoff
-			for _, seg := range segments {
-				if _, seen := seenSegments[seg.uri]; seen {
+			if len(playlist.variants) > 0 {
+				variants, level = playlist.variants, 0
+				if adaptive != nil {
+					level = adaptive.setLevels(len(variants))
+				}
+				s.playlistURL = variants[level].uri
+				reload = nil
+				continue
+			}
+			if n := len(playlist.segments); n > 0 {
+				last := playlist.segments[n-1]
+				if listed := (listing{last.sequence, len(last.parts), last.uri != ""}); listed != newest {
+					newest = listed
+					s.counters.playlistUpdated()
+				}
+			}
+			var (
+				fetches    []hlsFetch
+				progressed bool
+			)
+			for _, seg := range playlist.segments {
+				if floored && seg.sequence <= floor {
 					continue
 				}
-				seenCounter++
-				seenSegments[seg.uri] = seenCounter
-				if len(seenSegments) > maxSeen {
-					threshold := seenCounter - int64(maxSeen)
-					for uri, seq := range seenSegments {
-						if seq <= threshold {
-							delete(seenSegments, uri)
+				if len(seg.parts) > 0 || partial[seg.sequence] {
+					for i := range seg.parts {
+						part := &seg.parts[i]
+						if part.gap || !markSeen(part.id()) {
+							continue
 						}
+						partial[seg.sequence] = true
+						fetches = append(fetches, hlsFetch{key: part.id(), seg: seg, part: part})
 					}
-				}
-
-				data, err := s.downloadSegment(ctx, client, seg.uri)
-				if err != nil {
-					s.counters.errors.Add(1)
-					delete(seenSegments, seg.uri)
-					select {
-					case errs <- err:
-					default:
+					if seg.uri != "" && markSeen(seg.id()) {
+						progressed = true
 					}
 					continue
 				}
-
-				chunk := MediaChunk{
-					Sequence:  s.counters.sequence.Add(1),
-					Timestamp: time.Now().UTC(),
-					Duration:  seg.duration,
-					Payload:   data,
-					Metadata: map[string]string{
-						"uri": seg.uri,
-					},
+				if seg.uri == "" || !markSeen(seg.id()) {
+					continue
 				}
-
+				fetches = append(fetches, hlsFetch{key: seg.id(), seg: seg})
+			}
+			fetched, complete := fetchAll(fetches)
+			progressed = progressed || fetched
+			if switchTo >= 0 {
+				pendingMarks = &variantSwitch{up: switchTo > level, bandwidth: variants[switchTo].bandwidth}
+				level, switchTo = switchTo, -1
+				s.playlistURL = variants[level].uri
+				floor, floored = lastSequence, emitted
+				s.counters.switches.Add(1)
+				reload = nil
+				continue
+			}
+			if playlist.ended && complete {
 				select {
-				case chunks <- chunk:
-					s.counters.received.Add(1)
+				case errs <- statuspkg.ErrSourceEnded:
 				default:
-					s.counters.dropped.Add(1)
+				}
+				return
+			}
+			if hint := playlist.hint; hint != nil && markSeen(hint.id()) {
+				// The server holds the request until the part is published.
+				seg := playlist.segments[len(playlist.segments)-1]
+				partial[seg.sequence] = true
+				fetched, _ := fetchAll([]hlsFetch{{key: hint.id(), seg: seg, part: hint}})
+				progressed = fetched || progressed
+			}
+			if len(playlist.segments) > 0 {
+				for sequence := range partial {
+					if sequence < playlist.segments[0].sequence {
+						delete(partial, sequence)
+					}
+				}
+			}
+
+			reload = nil
+			if playlist.canBlockReload {
+				reload = playlist.blockingReload()
+				if progressed {
+					continue
 				}
 			}
 
@@ -166,33 +466,264 @@ func (s *HLSStreamSource) Metrics() StreamMetrics {
 	return s.counters.snapshot()
 }
 
+// Probe fetches the playlist, and from a master playlist the variant the
+// source would start with, to report the variant's declared codecs and
+// bandwidth, the target segment duration, and whether the playlist is
+// live. The container is told by the first segment: fMP4 when it has an
+// initialization section, and otherwise by its extension.
+func (s *HLSStreamSource) Probe(ctx context.Context) (SourceProbe, error) {
+	// The probe polls with its own copy, leaving the playlist URL of a
+	// running stream alone.
+	probe := &HLSStreamSource{cfg: s.cfg, counters: &streamCounters{}}
+	probe.playlistURL, _ = url.Parse(s.cfg.PlaylistURL)
+	if s.cfg.Resolve != nil {
+		if err := probe.resolvePlaylistURL(ctx); err != nil {
+			return SourceProbe{}, err
+		}
+	}
+	playlist, err := probe.fetchPlaylist(ctx, s.cfg.Client, nil, nil)
+	if err != nil {
+		return SourceProbe{}, err
+	}
+	var result SourceProbe
+	if variants := playlist.variants; len(variants) > 0 {
+		variant := variants[0]
+		if s.cfg.Adaptive != nil {
+			variant = variants[len(variants)-1]
+		}
+		result.Codecs, result.Bitrate = variant.codecs, variant.bandwidth
+		probe.playlistURL = variant.uri
+		if playlist, err = probe.fetchPlaylist(ctx, s.cfg.Client, nil, nil); err != nil {
+			return SourceProbe{}, err
+		}
+	}
+	result.Live = !playlist.ended
+	result.SegmentDuration = playlist.targetDuration
+	if len(playlist.segments) > 0 {
+		first := playlist.segments[0]
+		switch {
+		case first.init != nil:
+			result.Container = "fmp4"
+		case first.uri != "":
+			result.Container = extensionContainer(first.uri)
+		case len(first.parts) > 0:
+			result.Container = extensionContainer(first.parts[0].uri)
+		}
+	}
+	return result, nil
+}
+
+// hlsFetch is a segment, or a part of one, to download.
+type hlsFetch struct {
+	key  string
+	seg  hlsSegment
+	part *hlsPart
+	// playlist is the URL of the playlist that listed it.
+	playlist *url.URL
+	// init is set when the segment's initialization section is to be
+	// downloaded with it.
+	init bool
+}
+
+// media returns the resource the fetch downloads and its duration.
+func (f hlsFetch) media() (uri string, duration time.Duration, offset, length int64) {
+	if f.part != nil {
+		return f.part.uri, f.part.duration, f.part.offset, f.part.length
+	}
+	return f.seg.uri, f.seg.duration, f.seg.offset, f.seg.length
+}
+
+// hlsDownload is the outcome of an hlsFetch.
+type hlsDownload struct {
+	init, data []byte
+	// elapsed is how long the media took to download.
+	elapsed time.Duration
+	err     error
+}
+
+// download fetches and decrypts what f names.
+func (s *HLSStreamSource) download(ctx context.Context, client *http.Client, decrypter *hlsDecrypter, f hlsFetch) hlsDownload {
+	var result hlsDownload
+	if f.init {
+		if result.init, result.err = s.downloadInit(ctx, client, decrypter, f); result.err != nil {
+			return result
+		}
+	}
+	uri, _, offset, length := f.media()
+	started := time.Now()
+	data, err := s.downloadSegment(ctx, client, f.playlist, uri, offset, length)
+	if err == nil {
+		data, err = decrypter.decrypt(ctx, f.seg, data)
+	}
+	result.data, result.elapsed, result.err = data, time.Since(started), err
+	return result
+}
+
+// downloadInit fetches and decrypts the initialization section of f's
+// segment.
+func (s *HLSStreamSource) downloadInit(ctx context.Context, client *http.Client, decrypter *hlsDecrypter, f hlsFetch) ([]byte, error) {
+	seg := f.seg
+	data, err := s.downloadSegment(ctx, client, f.playlist, seg.init.uri, seg.init.offset, seg.init.length)
+	if err == nil && seg.init.key != nil && seg.init.key.method == "AES-128" {
+		data, err = decrypter.decrypt(ctx, hlsSegment{sequence: seg.sequence, key: seg.init.key}, data)
+	}
+	return data, err
+}
+
 type hlsSegment struct {
 	uri      string
 	duration time.Duration
+	// offset and length select the segment's byte range of uri, set by
+	// #EXT-X-BYTERANGE; a zero length means the whole resource.
+	offset, length int64
+	init           *hlsInit
+	// sequence is the segment's media sequence number.
+	sequence int64
+	key      *hlsKey
+	// discontinuity is set by #EXT-X-DISCONTINUITY: the segment's encoding
+	// or timestamps do not continue the previous segment's.
+	discontinuity bool
+	// parts are the partial segments a low-latency playlist lists for the
+	// segment. The last segment of such a playlist may still be in
+	// progress, with parts but no uri.
+	parts []hlsPart
+}
+
+// hlsPart is a partial segment of a low-latency playlist, or the part it
+// hints at being published next. Hinted parts have no duration yet.
+type hlsPart struct {
+	uri      string
+	duration time.Duration
+	// offset and length select a byte range of uri; a zero length means
+	// the whole resource.
+	offset, length int64
+	independent    bool
+	gap            bool
+}
+
+// id identifies the part among those sharing its uri.
+func (p *hlsPart) id() string {
+	return rangeID(p.uri, p.offset, p.length)
+}
+
+// id identifies the segment among those sharing its uri.
+func (s *hlsSegment) id() string {
+	return rangeID(s.uri, s.offset, s.length)
+}
+
+// hlsInit is the initialization section, set by #EXT-X-MAP, that fMP4
+// segments need to be decoded.
+type hlsInit struct {
+	uri            string
+	offset, length int64
+	// key is the #EXT-X-KEY in effect at the #EXT-X-MAP tag.
+	key *hlsKey
+}
+
+func (i *hlsInit) id() string {
+	return rangeID(i.uri, i.offset, i.length)
+}
+
+// rangeID identifies a byte range of uri; a zero length means all of it.
+func rangeID(uri string, offset, length int64) string {
+	if length == 0 {
+		return uri
+	}
+	return fmt.Sprintf("%s@%d-%d", uri, offset, offset+length)
+}
+
+// hlsVariant is a variant stream, or the audio rendition, of a master
+// playlist.
+type hlsVariant struct {
+	uri       *url.URL
+	bandwidth int64
+	codecs    []string
+}
+
+type hlsPlaylist struct {
+	// variants are set instead of segments for a master playlist, in
+	// order of bandwidth.
+	variants       []hlsVariant
+	segments       []hlsSegment
+	canBlockReload bool
+	hint           *hlsPart
+	// ended is set by #EXT-X-ENDLIST: no segments will be added.
+	ended bool
+	// targetDuration is set by #EXT-X-TARGETDURATION: no segment lasts
+	// longer.
+	targetDuration time.Duration
+}
+
+// blockingReload returns the query parameters asking the server to hold
+// the next playlist request until the part after the newest one listed is
+// published. When that part was hinted at, it has already been fetched, so
+// the reload returns promptly with the hint for its successor.
+func (p *hlsPlaylist) blockingReload() url.Values {
+	msn, part := int64(0), 0
+	if n := len(p.segments); n > 0 {
+		last := p.segments[n-1]
+		msn, part = last.sequence, len(last.parts)
+		if last.uri != "" {
+			msn, part = last.sequence+1, 0
+		}
+	}
+	return url.Values{"_HLS_msn": {strconv.FormatInt(msn, 10)}, "_HLS_part": {strconv.Itoa(part)}}
 }
 
-func (s *HLSStreamSource) fetchSegments(ctx context.Context, client *http.Client) ([]hlsSegment, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.PlaylistURL, nil)
+// resolvePlaylistURL replaces the polled playlist URL with the one
+// cfg.Resolve returns.
+func (s *HLSStreamSource) resolvePlaylistURL(ctx context.Context) error {
+	resolved, err := s.cfg.Resolve(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("build playlist request: %w", err)
+		return fmt.Errorf("resolve playlist: %w", err)
 	}
-	resp, err := client.Do(req)
+	playlistURL, err := url.Parse(resolved)
 	if err != nil {
-		return nil, fmt.Errorf("fetch playlist: %w", err)
+		return statuspkg.Fatal(fmt.Errorf("invalid resolved playlist URL: %w", err))
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("playlist returned %s", resp.Status)
+	s.playlistURL = playlistURL
+	return nil
+}
+
+// fetchPlaylist fetches the polled playlist, with the blocking reload
+// parameters of reload, through poller.
+func (s *HLSStreamSource) fetchPlaylist(ctx context.Context, client *http.Client, poller *documentPoller, reload url.Values) (*hlsPlaylist, error) {
+	playlistURL := *s.playlistURL
+	if reload != nil {
+		query := playlistURL.Query()
+		for name, values := range reload {
+			query[name] = values
+		}
+		playlistURL.RawQuery = query.Encode()
 	}
-	buf, err := io.ReadAll(resp.Body)
+	buf, err := poller.fetch(ctx, client, playlistURL.String(), "playlist")
 	if err != nil {
-		return nil, fmt.Errorf("read playlist: %w", err)
+		return nil, err
 	}
 	return s.parsePlaylist(buf)
 }
 
-func (s *HLSStreamSource) downloadSegment(ctx context.Context, client *http.Client, segmentURI string) ([]byte, error) {
-	uri, err := s.playlistURL.Parse(segmentURI)
+// responseError describes an unexpected response to a request for what.
+// Server errors, timeouts, and rate limiting are transient; other client
+// errors, such as a missing playlist, are fatal.
+func responseError(what string, resp *http.Response) error {
+	err := fmt.Errorf("%s returned %s", what, resp.Status)
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError,
+		resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests:
+		return statuspkg.Transient(err)
+	case resp.StatusCode >= http.StatusBadRequest:
+		return statuspkg.Fatal(err)
+	default:
+		return err
+	}
+}
+
+// downloadSegment fetches a segment listed in playlistURL, or length bytes
+// of it from offset when length is not zero.
+func (s *HLSStreamSource) downloadSegment(ctx context.Context, client *http.Client, playlistURL *url.URL, segmentURI string, offset, length int64) ([]byte, error) {
+	uri, err := playlistURL.Parse(segmentURI)
 	if err != nil {
 		return nil, fmt.Errorf("resolve segment URI: %w", err)
 	}
@@ -200,28 +731,59 @@ func (s *HLSStreamSource) downloadSegment(ctx context.Context, client *http.Clie
 	if err != nil {
 		return nil, fmt.Errorf("build segment request: %w", err)
 	}
+	if length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("fetch segment: %w", err)
+		return nil, statuspkg.Transient(fmt.Errorf("fetch segment: %w", err))
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("segment returned %s", resp.Status)
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusOK && !(length > 0 && resp.StatusCode == http.StatusPartialContent) {
+		return nil, responseError("segment", resp)
 	}
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("read segment: %w", err)
 	}
+	// A server that ignores the Range header sends the whole resource.
+	if length > 0 && resp.StatusCode == http.StatusOK {
+		if offset+length > int64(len(data)) {
+			return nil, statuspkg.Fatal(fmt.Errorf("segment byte range %d-%d exceeds the %d bytes served", offset, offset+length, len(data)))
+		}
+		data = data[offset : offset+length]
+	}
 	return data, nil
 }
 
-func (s *HLSStreamSource) parsePlaylist(body []byte) ([]hlsSegment, error) {
+func (s *HLSStreamSource) parsePlaylist(body []byte) (*hlsPlaylist, error) {
 	scanner := bufio.NewScanner(bytes.NewReader(body))
 	scanner.Split(bufio.ScanLines)
 
 	var (
-		segments        []hlsSegment
+		playlist hlsPlaylist
+		segments []hlsSegment
+		parts    []hlsPart
+		// discontinuity applies to the next segment.
+		discontinuity bool
+		// rangeEnds tracks where the latest byte range of each uri ends,
+		// where a range without an offset starts.
+		rangeEnds = make(map[string]int64)
+		// byteRange is the #EXT-X-BYTERANGE of the next segment.
+		byteRange       string
+		init            *hlsInit
 		pendingDuration time.Duration
+		sequence        int64
+		key             *hlsKey
+		// keyTags counts the #EXT-X-KEY tags since the last segment. A
+		// playlist may offer one key in several formats; the identity
+		// format is preferred.
+		keyTags int
+		// streamInf holds the #EXT-X-STREAM-INF attributes of the next
+		// variant of a master playlist.
+		streamInf           map[string]string
+		variants, audioOnly []hlsVariant
+		renditions          []hlsRendition
 	)
 
 	for scanner.Scan() {
@@ -237,19 +799,243 @@ func (s *HLSStreamSource) parsePlaylist(body []byte) ([]hlsSegment, error) {
 			pendingDuration = duration
 			continue
 		}
+		if value, ok := strings.CutPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"); ok {
+			first, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid EXT-X-MEDIA-SEQUENCE %q: %w", value, err)
+			}
+			sequence = first
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "#EXT-X-KEY:"); ok {
+			parsed, err := parseKey(parseAttributeList(value), s.playlistURL)
+			if err != nil {
+				return nil, err
+			}
+			if keyTags == 0 || key == nil || key.format != "identity" {
+				key = parsed
+			}
+			keyTags++
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "#EXT-X-BYTERANGE:"); ok {
+			byteRange = strings.TrimSpace(value)
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "#EXT-X-MAP:"); ok {
+			attributes := parseAttributeList(value)
+			if attributes["URI"] == "" {
+				return nil, errors.New("EXT-X-MAP without a URI")
+			}
+			init = &hlsInit{uri: attributes["URI"], key: key}
+			if value := attributes["BYTERANGE"]; value != "" {
+				offset, length, err := parseByteRange(value, 0)
+				if err != nil {
+					return nil, fmt.Errorf("invalid EXT-X-MAP byte range: %w", err)
+				}
+				init.offset, init.length = offset, length
+			}
+			continue
+		}
+		if line == "#EXT-X-DISCONTINUITY" {
+			discontinuity = true
+			continue
+		}
+		if line == "#EXT-X-ENDLIST" {
+			playlist.ended = true
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "#EXT-X-TARGETDURATION:"); ok {
+			seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid EXT-X-TARGETDURATION %q: %w", value, err)
+			}
+			playlist.targetDuration = time.Duration(seconds * float64(time.Second))
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "#EXT-X-SERVER-CONTROL:"); ok {
+			playlist.canBlockReload = parseAttributeList(value)["CAN-BLOCK-RELOAD"] == "YES"
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "#EXT-X-PART:"); ok {
+			part, err := parsePart(parseAttributeList(value), rangeEnds)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "#EXT-X-PRELOAD-HINT:"); ok {
+			attributes := parseAttributeList(value)
+			// Hints at byte ranges of unknown length are left to the
+			// playlist reload that lists the part.
+			if attributes["TYPE"] == "PART" && attributes["URI"] != "" && attributes["BYTERANGE-START"] == "" {
+				playlist.hint = &hlsPart{uri: attributes["URI"]}
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "#EXT-X-STREAM-INF:"); ok {
+			streamInf = parseAttributeList(value)
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "#EXT-X-MEDIA:"); ok {
+			attributes := parseAttributeList(value)
+			if attributes["TYPE"] == "AUDIO" && attributes["URI"] != "" {
+				renditions = append(renditions, hlsRendition{
+					uri:       attributes["URI"],
+					group:     attributes["GROUP-ID"],
+					language:  attributes["LANGUAGE"],
+					isDefault: attributes["DEFAULT"] == "YES",
+				})
+			}
+			continue
+		}
 		if strings.HasPrefix(line, "#") {
 			continue
 		}
-		segments = append(segments, hlsSegment{
-			uri:      line,
-			duration: pendingDuration,
-		})
+		if streamInf != nil {
+			uri, err := s.playlistURL.Parse(line)
+			if err != nil {
+				return nil, statuspkg.Fatal(fmt.Errorf("invalid variant URI: %w", err))
+			}
+			// Variants without a bandwidth sort first.
+			bandwidth, _ := strconv.ParseInt(streamInf["BANDWIDTH"], 10, 64)
+			variant := hlsVariant{uri: uri, bandwidth: bandwidth, codecs: splitCodecs(streamInf["CODECS"])}
+			variants = append(variants, variant)
+			if streamInf["VIDEO"] == "audio_only" || isAudioCodecs(streamInf["CODECS"]) {
+				audioOnly = append(audioOnly, variant)
+			}
+			streamInf = nil
+			continue
+		}
+		segment := hlsSegment{
+			uri:           line,
+			duration:      pendingDuration,
+			sequence:      sequence,
+			key:           key,
+			init:          init,
+			discontinuity: discontinuity,
+			parts:         parts,
+		}
+		if byteRange != "" {
+			offset, length, err := parseByteRange(byteRange, rangeEnds[line])
+			if err != nil {
+				return nil, fmt.Errorf("invalid EXT-X-BYTERANGE: %w", err)
+			}
+			segment.offset, segment.length = offset, length
+			rangeEnds[line] = offset + length
+		}
+		segments = append(segments, segment)
+		byteRange = ""
 		pendingDuration = 0
+		discontinuity = false
+		sequence++
+		keyTags = 0
+		parts = nil
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("parse playlist: %w", err)
 	}
-	return segments, nil
+	rendition, err := s.selectRendition(renditions)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(audioOnly) > 0 && (s.cfg.AudioTrack == nil || rendition == ""):
+		variants = audioOnly
+	case rendition != "":
+		uri, err := s.playlistURL.Parse(rendition)
+		if err != nil {
+			return nil, statuspkg.Fatal(fmt.Errorf("invalid rendition URI: %w", err))
+		}
+		variants = []hlsVariant{{uri: uri}}
+	}
+	sort.SliceStable(variants, func(i, j int) bool { return variants[i].bandwidth < variants[j].bandwidth })
+	playlist.variants = variants
+	if len(parts) > 0 || playlist.hint != nil {
+		segments = append(segments, hlsSegment{sequence: sequence, key: key, init: init, discontinuity: discontinuity, parts: parts})
+	}
+	playlist.segments = segments
+	return &playlist, nil
+}
+
+// hlsRendition is an audio rendition listed by #EXT-X-MEDIA in a master
+// playlist.
+type hlsRendition struct {
+	uri, group, language string
+	isDefault            bool
+}
+
+// selectRendition returns the URI of the audio rendition to follow: the one
+// cfg.AudioTrack selects among the renditions of the first audio group, or
+// otherwise the default rendition. It returns "" without renditions.
+func (s *HLSStreamSource) selectRendition(renditions []hlsRendition) (string, error) {
+	if len(renditions) == 0 {
+		return "", nil
+	}
+	if s.cfg.AudioTrack != nil {
+		var group []hlsRendition
+		languages := make([]string, 0, len(renditions))
+		for _, rendition := range renditions {
+			if rendition.group == renditions[0].group {
+				group = append(group, rendition)
+				languages = append(languages, rendition.language)
+			}
+		}
+		index, err := s.cfg.AudioTrack.Select(languages)
+		if err != nil {
+			return "", statuspkg.Fatal(fmt.Errorf("select audio rendition: %w", err))
+		}
+		return group[index].uri, nil
+	}
+	selected := renditions[0].uri
+	for _, rendition := range renditions {
+		if rendition.isDefault {
+			selected = rendition.uri
+		}
+	}
+	return selected, nil
+}
+
+// parsePart interprets the attributes of an #EXT-X-PART tag.
+func parsePart(attributes map[string]string, rangeEnds map[string]int64) (hlsPart, error) {
+	part := hlsPart{
+		uri:         attributes["URI"],
+		independent: attributes["INDEPENDENT"] == "YES",
+		gap:         attributes["GAP"] == "YES",
+	}
+	if part.uri == "" {
+		return hlsPart{}, errors.New("EXT-X-PART without a URI")
+	}
+	seconds, err := strconv.ParseFloat(attributes["DURATION"], 64)
+	if err != nil {
+		return hlsPart{}, fmt.Errorf("invalid EXT-X-PART duration %q: %w", attributes["DURATION"], err)
+	}
+	part.duration = time.Duration(seconds * float64(time.Second))
+	if value := attributes["BYTERANGE"]; value != "" {
+		if part.offset, part.length, err = parseByteRange(value, rangeEnds[part.uri]); err != nil {
+			return hlsPart{}, fmt.Errorf("invalid EXT-X-PART byte range: %w", err)
+		}
+		rangeEnds[part.uri] = part.offset + part.length
+	}
+	return part, nil
+}
+
+// parseByteRange parses a "<length>[@<offset>]" byte range. A range
+// without an offset starts at next, where the previous range of the same
+// resource ended.
+func parseByteRange(value string, next int64) (offset, length int64, err error) {
+	lengthValue, offsetValue, hasOffset := strings.Cut(value, "@")
+	if length, err = strconv.ParseInt(lengthValue, 10, 64); err != nil || length <= 0 {
+		return 0, 0, fmt.Errorf("malformed byte range %q", value)
+	}
+	offset = next
+	if hasOffset {
+		if offset, err = strconv.ParseInt(offsetValue, 10, 64); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("malformed byte range %q", value)
+		}
+	}
+	return offset, length, nil
 }
 
 func parseDuration(line string) (time.Duration, error) {
@@ -0,0 +1,352 @@
+package ingestion
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// maxCachedKeys bounds the decryption keys an HLS stream keeps. Live streams
+// that rotate keys only ever need the few newest.
+const maxCachedKeys = 16
+
+// hlsKey is the #EXT-X-KEY in effect for a segment.
+type hlsKey struct {
+	method string
+	uri    string
+	format string
+	// iv is nil when the playlist leaves the IV to be derived from the
+	// segment's media sequence number.
+	iv []byte
+}
+
+// parseKey interprets the attributes of an #EXT-X-KEY tag. It returns nil
+// for METHOD=NONE, which marks the following segments as unencrypted.
+func parseKey(attributes map[string]string, base *url.URL) (*hlsKey, error) {
+	key := &hlsKey{method: attributes["METHOD"], format: attributes["KEYFORMAT"]}
+	switch key.method {
+	case "NONE":
+		return nil, nil
+	case "AES-128", "SAMPLE-AES":
+	default:
+		return nil, statuspkg.Fatal(fmt.Errorf("unsupported HLS encryption method %q", key.method))
+	}
+	if key.format == "" {
+		key.format = "identity"
+	}
+	uri, ok := attributes["URI"]
+	if !ok {
+		return nil, statuspkg.Fatal(errors.New("EXT-X-KEY without a URI"))
+	}
+	resolved, err := base.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("resolve key URI: %w", err)
+	}
+	key.uri = resolved.String()
+	if value := attributes["IV"]; value != "" {
+		iv, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X"))
+		if err != nil || len(iv) != aes.BlockSize {
+			return nil, statuspkg.Fatal(fmt.Errorf("invalid EXT-X-KEY IV %q", value))
+		}
+		key.iv = iv
+	}
+	return key, nil
+}
+
+// hlsDecrypter fetches and caches the keys of an HLS stream and decrypts its
+// segments. Key requests carry the credentials the stream's client adds,
+// which it only sends to the hosts the session's credentials allow. It may
+// be used by several downloads at once.
+type hlsDecrypter struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	keys  map[string][]byte
+	order []string
+}
+
+func newHLSDecrypter(client *http.Client) *hlsDecrypter {
+	return &hlsDecrypter{client: client, keys: make(map[string][]byte)}
+}
+
+// decrypt returns the clear content of a downloaded segment.
+func (d *hlsDecrypter) decrypt(ctx context.Context, segment hlsSegment, data []byte) ([]byte, error) {
+	if segment.key == nil {
+		return data, nil
+	}
+	if segment.key.format != "identity" {
+		return nil, statuspkg.Fatal(fmt.Errorf("unsupported HLS key format %q", segment.key.format))
+	}
+	key, err := d.key(ctx, segment.key.uri)
+	if err != nil {
+		return nil, err
+	}
+	iv := segment.key.iv
+	if iv == nil {
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], uint64(segment.sequence))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, statuspkg.Fatal(fmt.Errorf("invalid key: %w", err))
+	}
+	if segment.key.method == "SAMPLE-AES" {
+		return decryptSampleAES(block, iv, data)
+	}
+	return decryptAES128(block, iv, data)
+}
+
+func (d *hlsDecrypter) key(ctx context.Context, uri string) ([]byte, error) {
+	d.mu.Lock()
+	cached, ok := d.keys[uri]
+	d.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build key request: %w", err)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, statuspkg.Transient(fmt.Errorf("fetch key: %w", err))
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("key", resp)
+	}
+	key, err := io.ReadAll(io.LimitReader(resp.Body, aes.BlockSize+1))
+	if err != nil {
+		return nil, statuspkg.Transient(fmt.Errorf("read key: %w", err))
+	}
+	if len(key) != aes.BlockSize {
+		return nil, statuspkg.Fatal(fmt.Errorf("key is %d bytes, want %d", len(key), aes.BlockSize))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// A concurrent download may have cached the key meanwhile.
+	if _, ok := d.keys[uri]; ok {
+		return key, nil
+	}
+	d.keys[uri] = key
+	d.order = append(d.order, uri)
+	if len(d.order) > maxCachedKeys {
+		delete(d.keys, d.order[0])
+		d.order = d.order[1:]
+	}
+	return key, nil
+}
+
+// decryptAES128 decrypts a segment encrypted as a whole with AES-128 in CBC
+// mode and PKCS#7 padding.
+func decryptAES128(block cipher.Block, iv, data []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, statuspkg.Fatal(fmt.Errorf("encrypted segment of %d bytes is not a whole number of blocks", len(data)))
+	}
+	clear := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(clear, data)
+	padding := int(clear[len(clear)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(clear[len(clear)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, statuspkg.Fatal(errors.New("decrypted segment has invalid padding; is the key correct?"))
+	}
+	return clear[:len(clear)-padding], nil
+}
+
+// decryptSampleAES decrypts the AAC audio of a SAMPLE-AES segment, either
+// an MPEG-TS segment or packed audio. Only audio is decrypted; video
+// samples, which the pipeline does not use, are left as they are.
+func decryptSampleAES(block cipher.Block, iv, data []byte) ([]byte, error) {
+	clear := bytes.Clone(data)
+	if len(clear) > 0 && clear[0] == tsSyncByte {
+		if err := decryptTSAudio(block, iv, clear); err != nil {
+			return nil, err
+		}
+		return clear, nil
+	}
+	// Packed audio starts with an ID3 tag carrying its timestamp.
+	offset := 0
+	if len(clear) >= 10 && string(clear[:3]) == "ID3" {
+		offset = 10 + (int(clear[6])<<21 | int(clear[7])<<14 | int(clear[8])<<7 | int(clear[9]))
+	}
+	if offset > len(clear) {
+		return nil, statuspkg.Fatal(errors.New("truncated ID3 tag in packed audio segment"))
+	}
+	decryptADTSFrames(block, iv, clear[offset:])
+	return clear, nil
+}
+
+// decryptADTSFrames decrypts, in place, the ADTS frames in buf. Each frame
+// keeps its header and first 16 bytes in the clear and encrypts the
+// following whole blocks in CBC mode, restarting from iv.
+func decryptADTSFrames(block cipher.Block, iv, buf []byte) {
+	for len(buf) >= 7 && buf[0] == 0xff && buf[1]&0xf0 == 0xf0 {
+		header := 7
+		if buf[1]&0x01 == 0 {
+			// A CRC follows the header.
+			header = 9
+		}
+		length := int(buf[3]&0x03)<<11 | int(buf[4])<<3 | int(buf[5])>>5
+		if length < header || length > len(buf) {
+			return
+		}
+		if payload := buf[header:length]; len(payload) > aes.BlockSize {
+			encrypted := payload[aes.BlockSize:]
+			encrypted = encrypted[:len(encrypted)/aes.BlockSize*aes.BlockSize]
+			cipher.NewCBCDecrypter(block, iv).CryptBlocks(encrypted, encrypted)
+		}
+		buf = buf[length:]
+	}
+}
+
+const (
+	tsSyncByte   = 0x47
+	tsPacketSize = 188
+	// Stream types of AAC audio in a program map table; SAMPLE-AES streams
+	// announce theirs as 0xcf.
+	tsStreamTypeADTS          = 0x0f
+	tsStreamTypeEncryptedADTS = 0xcf
+)
+
+// decryptTSAudio decrypts, in place, the AAC elementary streams of an
+// MPEG-TS segment. A PES packet spans the payloads of several transport
+// packets, so each is gathered, decrypted, and scattered back.
+func decryptTSAudio(block cipher.Block, iv, segment []byte) error {
+	var (
+		pmtPID  = -1
+		audio   = make(map[int]bool)
+		pending = make(map[int][][]byte)
+	)
+	flush := func(pid int) {
+		parts := pending[pid]
+		delete(pending, pid)
+		pes := bytes.Join(parts, nil)
+		if len(pes) < 9 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+			return
+		}
+		start := 9 + int(pes[8])
+		if start > len(pes) {
+			return
+		}
+		decryptADTSFrames(block, iv, pes[start:])
+		for _, part := range parts {
+			pes = pes[copy(part, pes):]
+		}
+	}
+
+	for offset := 0; offset+tsPacketSize <= len(segment); offset += tsPacketSize {
+		packet := segment[offset : offset+tsPacketSize]
+		if packet[0] != tsSyncByte {
+			return statuspkg.Fatal(fmt.Errorf("lost MPEG-TS sync at byte %d", offset))
+		}
+		unitStart := packet[1]&0x40 != 0
+		pid := int(packet[1]&0x1f)<<8 | int(packet[2])
+		control := packet[3] >> 4 & 0x03
+		if control&0x01 == 0 {
+			continue
+		}
+		start := 4
+		if control&0x02 != 0 {
+			start += 1 + int(packet[4])
+		}
+		if start >= tsPacketSize {
+			continue
+		}
+		payload := packet[start:]
+
+		switch {
+		case pid == 0 && unitStart:
+			if section := psiSection(payload); len(section) >= 12 {
+				for entry := section[8 : len(section)-4]; len(entry) >= 4; entry = entry[4:] {
+					if program := int(entry[0])<<8 | int(entry[1]); program != 0 {
+						pmtPID = int(entry[2]&0x1f)<<8 | int(entry[3])
+						break
+					}
+				}
+			}
+		case pid == pmtPID && unitStart:
+			section := psiSection(payload)
+			if len(section) < 16 {
+				continue
+			}
+			streams := 12 + (int(section[10]&0x0f)<<8 | int(section[11]))
+			for streams+5 <= len(section)-4 {
+				streamType := section[streams]
+				streamPID := int(section[streams+1]&0x1f)<<8 | int(section[streams+2])
+				if streamType == tsStreamTypeADTS || streamType == tsStreamTypeEncryptedADTS {
+					audio[streamPID] = true
+				}
+				streams += 5 + (int(section[streams+3]&0x0f)<<8 | int(section[streams+4]))
+			}
+		case audio[pid]:
+			if unitStart {
+				flush(pid)
+			}
+			pending[pid] = append(pending[pid], payload)
+		}
+	}
+	for pid := range pending {
+		flush(pid)
+	}
+	if len(audio) == 0 {
+		return statuspkg.Fatal(errors.New("SAMPLE-AES segment has no AAC audio"))
+	}
+	return nil
+}
+
+// psiSection returns the table section starting in a transport packet
+// payload, bounded by its section length.
+func psiSection(payload []byte) []byte {
+	if len(payload) < 1 || 1+int(payload[0]) >= len(payload) {
+		return nil
+	}
+	section := payload[1+int(payload[0]):]
+	if len(section) < 3 {
+		return nil
+	}
+	length := 3 + (int(section[1]&0x0f)<<8 | int(section[2]))
+	if length > len(section) {
+		return nil
+	}
+	return section[:length]
+}
+
+// parseAttributeList splits an HLS attribute list, such as the value of an
+// #EXT-X-KEY tag, into its attributes. Quoted values lose their quotes and
+// may contain commas.
+func parseAttributeList(value string) map[string]string {
+	attributes := make(map[string]string)
+	for value != "" {
+		name, rest, ok := strings.Cut(value, "=")
+		if !ok {
+			break
+		}
+		var attribute string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				attribute, rest = rest[1:], ""
+			} else {
+				attribute, rest = rest[1:end+1], rest[end+2:]
+			}
+			_, rest, _ = strings.Cut(rest, ",")
+		} else {
+			attribute, rest, _ = strings.Cut(rest, ",")
+		}
+		attributes[strings.TrimSpace(name)] = attribute
+		value = strings.TrimSpace(rest)
+	}
+	return attributes
+}
@@ -0,0 +1,214 @@
+package ingestion
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+func encryptAES128(t *testing.T, iv, clear []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(testKey)
+	if err != nil {
+		t.Fatalf("new cipher: %v", err)
+	}
+	padding := aes.BlockSize - len(clear)%aes.BlockSize
+	padded := append(bytes.Clone(clear), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+	return encrypted
+}
+
+func sequenceIV(sequence uint64) []byte {
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], sequence)
+	return iv
+}
+
+func TestHLSStreamSourceDecryptsAES128Segments(t *testing.T) {
+	explicitIV := bytes.Repeat([]byte{0x0a}, aes.BlockSize)
+	segments := map[string][]byte{
+		// No IV: derived from the media sequence number.
+		"/stream/seg-7.ts": encryptAES128(t, sequenceIV(7), []byte("segment-7")),
+		"/stream/seg-8.ts": encryptAES128(t, explicitIV, []byte("segment-8")),
+		"/stream/seg-9.ts": []byte("segment-9"),
+	}
+	playlist := fmt.Sprintf(`#EXTM3U
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-KEY:METHOD=AES-128,URI="keys/key.bin"
+#EXTINF:2.0,
+seg-7.ts
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://drm",KEYFORMAT="com.apple.streamingkeydelivery"
+#EXT-X-KEY:METHOD=AES-128,URI="keys/key.bin",IV=0x%s,KEYFORMAT="identity"
+#EXTINF:2.0,
+seg-8.ts
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:2.0,
+seg-9.ts
+`, hex.EncodeToString(explicitIV))
+
+	var keyFetches atomic.Int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("/stream/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(playlist))
+	})
+	handler.HandleFunc("/stream/keys/key.bin", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		keyFetches.Add(1)
+		_, _ = w.Write(testKey)
+	})
+	for path, data := range segments {
+		data := data
+		handler.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(data)
+		})
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client, err := NewAuthenticatedClient(server.Client(), server.URL+"/stream/index.m3u8", sessionpkg.SourceAuth{
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticatedClient error: %v", err)
+	}
+	source, err := NewHLSStreamSource(HLSConfig{
+		PlaylistURL:  server.URL + "/stream/index.m3u8",
+		Client:       client,
+		PollInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewHLSStreamSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+
+	for _, want := range []string{"segment-7", "segment-8", "segment-9"} {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("context done waiting for %s", want)
+		case err := <-errs:
+			t.Fatalf("stream returned error: %v", err)
+		case chunk := <-chunks:
+			if string(chunk.Payload) != want {
+				t.Fatalf("payload = %q, want %q", chunk.Payload, want)
+			}
+		}
+	}
+	if fetches := keyFetches.Load(); fetches != 1 {
+		t.Fatalf("expected the key to be fetched once, got %d", fetches)
+	}
+}
+
+// adtsFrame returns an ADTS frame without CRC around payload.
+func adtsFrame(payload []byte) []byte {
+	length := 7 + len(payload)
+	header := []byte{0xff, 0xf1, 0x50, 0x80 | byte(length>>11), byte(length >> 3), byte(length<<5) | 0x1f, 0xfc}
+	return append(header, payload...)
+}
+
+// encryptSample applies SAMPLE-AES to the payload of an ADTS frame.
+func encryptSample(t *testing.T, iv, frame []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(testKey)
+	if err != nil {
+		t.Fatalf("new cipher: %v", err)
+	}
+	encrypted := bytes.Clone(frame)
+	body := encrypted[7+aes.BlockSize:]
+	body = body[:len(body)/aes.BlockSize*aes.BlockSize]
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(body, body)
+	return encrypted
+}
+
+func TestDecryptSampleAESPackedAudio(t *testing.T) {
+	iv := sequenceIV(3)
+	clear := append(adtsFrame(bytes.Repeat([]byte("a"), 53)), adtsFrame(bytes.Repeat([]byte("b"), 40))...)
+	id3 := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 2, 'x', 'y'}
+	segment := append(bytes.Clone(id3), encryptSample(t, iv, clear[:60])...)
+	segment = append(segment, encryptSample(t, iv, clear[60:])...)
+	if bytes.Equal(segment[len(id3):], clear) {
+		t.Fatal("expected the test segment to be encrypted")
+	}
+
+	block, _ := aes.NewCipher(testKey)
+	decrypted, err := decryptSampleAES(block, iv, segment)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if !bytes.Equal(decrypted, append(id3, clear...)) {
+		t.Fatalf("decrypted segment does not match the clear audio")
+	}
+}
+
+// tsPacket wraps payload in a transport packet, padding it with an
+// adaptation field.
+func tsPacket(pid int, unitStart bool, payload []byte) []byte {
+	packet := []byte{tsSyncByte, byte(pid >> 8 & 0x1f), byte(pid), 0x10}
+	if unitStart {
+		packet[1] |= 0x40
+	}
+	if stuffing := tsPacketSize - 4 - len(payload); stuffing > 0 {
+		packet[3] |= 0x20
+		field := make([]byte, stuffing)
+		field[0] = byte(stuffing - 1)
+		if stuffing > 1 {
+			field[1] = 0
+			for i := 2; i < stuffing; i++ {
+				field[i] = 0xff
+			}
+		}
+		packet = append(packet, field...)
+	}
+	return append(packet, payload...)
+}
+
+func TestDecryptSampleAESTransportStream(t *testing.T) {
+	iv := sequenceIV(0)
+	pat := []byte{0, 0x00, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 1, 0xe1, 0x00, 0, 0, 0, 0}
+	pmt := []byte{0, 0x02, 0xb0, 18, 0, 1, 0xc1, 0, 0, 0xe1, 0x01, 0xf0, 0, 0xcf, 0xe1, 0x01, 0xf0, 0, 0, 0, 0, 0}
+	clear := adtsFrame(bytes.Repeat([]byte("c"), 250))
+	pes := append([]byte{0, 0, 1, 0xc0, 0, 0, 0x80, 0x80, 5, 0x21, 0, 1, 0, 1}, encryptSample(t, iv, clear)...)
+
+	segment := append(tsPacket(0, true, pat), tsPacket(0x100, true, pmt)...)
+	segment = append(segment, tsPacket(0x101, true, pes[:184])...)
+	segment = append(segment, tsPacket(0x101, false, pes[184:])...)
+
+	block, _ := aes.NewCipher(testKey)
+	decrypted, err := decryptSampleAES(block, iv, segment)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	var audio []byte
+	audio = append(audio, decrypted[2*tsPacketSize+4:3*tsPacketSize]...)
+	second := decrypted[3*tsPacketSize:]
+	audio = append(audio, second[4+1+int(second[4]):]...)
+	if !bytes.Equal(audio[14:], clear) {
+		t.Fatal("decrypted audio does not match the clear frame")
+	}
+}
+
+func TestParseAttributeList(t *testing.T) {
+	attributes := parseAttributeList(`METHOD=AES-128,URI="https://keys.example.com/k?a=1,b=2",IV=0x1F`)
+	if attributes["METHOD"] != "AES-128" || attributes["URI"] != "https://keys.example.com/k?a=1,b=2" || attributes["IV"] != "0x1F" {
+		t.Fatalf("unexpected attributes %v", attributes)
+	}
+}
@@ -1,13 +1,20 @@
 package ingestion
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
 )
 
 func TestHLSStreamSourceStreamsSegments(t *testing.T) {
@@ -197,3 +204,617 @@ func TestHLSStreamSourcePrunesSeenSegments(t *testing.T) {
 		}
 	}
 }
+
+func TestHLSStreamSourceClassifiesPlaylistErrors(t *testing.T) {
+	for status, fatal := range map[int]bool{
+		http.StatusNotFound:            true,
+		http.StatusForbidden:           true,
+		http.StatusServiceUnavailable:  false,
+		http.StatusTooManyRequests:     false,
+		http.StatusInternalServerError: false,
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+
+		source, err := NewHLSStreamSource(HLSConfig{
+			PlaylistURL:  server.URL + "/index.m3u8",
+			Client:       server.Client(),
+			RetryBackoff: time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("NewHLSStreamSource error: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, errs := source.Stream(ctx)
+		streamErr := <-errs
+		cancel()
+		server.Close()
+
+		if got := errors.Is(streamErr, statuspkg.ErrFatal); got != fatal {
+			t.Fatalf("status %d: expected fatal %v, got error %v", status, fatal, streamErr)
+		}
+		if got := statuspkg.IsTransient(streamErr); got == fatal {
+			t.Fatalf("status %d: expected transient %v, got error %v", status, !fatal, streamErr)
+		}
+	}
+}
+
+func TestHLSStreamSourceFollowsLowLatencyParts(t *testing.T) {
+	const (
+		partsPerSegment = 3
+		totalParts      = 9
+	)
+	var (
+		mu        sync.Mutex
+		published = 1
+		blocking  int
+	)
+	// waitFor holds a request until n parts are published, like a server
+	// answering a blocking reload or a preload hint.
+	waitFor := func(r *http.Request, n int) bool {
+		for {
+			mu.Lock()
+			ready := published >= n
+			mu.Unlock()
+			if ready {
+				return true
+			}
+			select {
+			case <-r.Context().Done():
+				return false
+			case <-time.After(2 * time.Millisecond):
+			}
+		}
+	}
+
+	handler := http.NewServeMux()
+	handler.HandleFunc("/stream/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		if msn := r.URL.Query().Get("_HLS_msn"); msn != "" {
+			segment, _ := strconv.Atoi(msn)
+			part, _ := strconv.Atoi(r.URL.Query().Get("_HLS_part"))
+			mu.Lock()
+			blocking++
+			mu.Unlock()
+			if !waitFor(r, segment*partsPerSegment+part+1) {
+				return
+			}
+		}
+		mu.Lock()
+		n := published
+		mu.Unlock()
+
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=0.3\n#EXT-X-PART-INF:PART-TARGET=0.1\n")
+		for i := 0; i < n; i++ {
+			segment, part := i/partsPerSegment, i%partsPerSegment
+			fmt.Fprintf(&b, "#EXT-X-PART:DURATION=0.1,URI=\"part-%d.%d.mp4\",INDEPENDENT=YES\n", segment, part)
+			if part == partsPerSegment-1 {
+				fmt.Fprintf(&b, "#EXTINF:0.3,\nseg-%d.mp4\n", segment)
+			}
+		}
+		fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part-%d.%d.mp4\"\n", n/partsPerSegment, n%partsPerSegment)
+		_, _ = w.Write([]byte(b.String()))
+	})
+	handler.HandleFunc("/stream/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/stream/")
+		var segment, part int
+		if _, err := fmt.Sscanf(name, "part-%d.%d.mp4", &segment, &part); err != nil {
+			// Full segments are covered by their parts and never fetched.
+			_, _ = w.Write([]byte(name))
+			return
+		}
+		if waitFor(r, segment*partsPerSegment+part+1) {
+			_, _ = w.Write([]byte(strings.TrimSuffix(name, ".mp4")))
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	go func() {
+		for i := 1; i < totalParts; i++ {
+			time.Sleep(15 * time.Millisecond)
+			mu.Lock()
+			published++
+			mu.Unlock()
+		}
+	}()
+
+	source, err := NewHLSStreamSource(HLSConfig{
+		PlaylistURL: server.URL + "/stream/index.m3u8",
+		Client:      server.Client(),
+		// Only blocking reloads and preload hints can keep up.
+		PollInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewHLSStreamSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+
+	for i := 0; i < totalParts; i++ {
+		want := fmt.Sprintf("part-%d.%d", i/partsPerSegment, i%partsPerSegment)
+		select {
+		case <-ctx.Done():
+			t.Fatalf("context done waiting for %s", want)
+		case err := <-errs:
+			t.Fatalf("stream returned error: %v", err)
+		case chunk := <-chunks:
+			if string(chunk.Payload) != want {
+				t.Fatalf("chunk %d = %q, want %q", i, chunk.Payload, want)
+			}
+			// Hinted parts are fetched before the playlist lists their
+			// duration.
+			if chunk.Metadata["part"] != "true" || chunk.Duration != 0 && chunk.Duration != 100*time.Millisecond {
+				t.Fatalf("unexpected part chunk %+v", chunk)
+			}
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if blocking == 0 {
+		t.Fatal("expected blocking playlist reloads")
+	}
+}
+
+func TestHLSPlaylistResolvesPartByteRanges(t *testing.T) {
+	source, err := NewHLSStreamSource(HLSConfig{PlaylistURL: "https://example.com/live/index.m3u8"})
+	if err != nil {
+		t.Fatalf("NewHLSStreamSource error: %v", err)
+	}
+	playlist, err := source.parsePlaylist([]byte(`#EXTM3U
+#EXT-X-MEDIA-SEQUENCE:4
+#EXT-X-PART:DURATION=0.2,URI="seg-4.mp4",BYTERANGE="100@0"
+#EXT-X-PART:DURATION=0.2,URI="seg-4.mp4",BYTERANGE="150"
+#EXTINF:0.4,
+seg-4.mp4
+#EXT-X-PART:DURATION=0.2,URI="seg-5.mp4",BYTERANGE="120@0"
+`))
+	if err != nil {
+		t.Fatalf("parse playlist: %v", err)
+	}
+	if len(playlist.segments) != 2 || playlist.segments[1].uri != "" || playlist.segments[1].sequence != 5 {
+		t.Fatalf("expected a complete and an in-progress segment, got %+v", playlist.segments)
+	}
+	second := playlist.segments[0].parts[1]
+	if second.offset != 100 || second.length != 150 || second.id() != "seg-4.mp4@100-250" {
+		t.Fatalf("unexpected part %+v", second)
+	}
+	reload := playlist.blockingReload()
+	if reload.Get("_HLS_msn") != "5" || reload.Get("_HLS_part") != "1" {
+		t.Fatalf("unexpected blocking reload %v", reload)
+	}
+}
+
+func TestHLSPlaylistSelectsAudioRendition(t *testing.T) {
+	master := []byte(`#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",LANGUAGE="en",NAME="English",DEFAULT=YES,URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",LANGUAGE="fr-CA",NAME="Français",URI="audio/fr.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="ac3",LANGUAGE="fr",NAME="Français 5.1",URI="audio/fr-ac3.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=800000,CODECS="avc1.4d401f,mp4a.40.2",AUDIO="aac"
+video.m3u8
+`)
+	for _, tc := range []struct {
+		track *sessionpkg.AudioTrackSelection
+		want  string
+	}{
+		{track: nil, want: "https://example.com/live/audio/en.m3u8"},
+		{track: &sessionpkg.AudioTrackSelection{Language: "fr"}, want: "https://example.com/live/audio/fr.m3u8"},
+		{track: &sessionpkg.AudioTrackSelection{Index: 1}, want: "https://example.com/live/audio/fr.m3u8"},
+	} {
+		source, err := NewHLSStreamSource(HLSConfig{PlaylistURL: "https://example.com/live/index.m3u8", AudioTrack: tc.track})
+		if err != nil {
+			t.Fatalf("NewHLSStreamSource error: %v", err)
+		}
+		playlist, err := source.parsePlaylist(master)
+		if err != nil {
+			t.Fatalf("parse playlist: %v", err)
+		}
+		if len(playlist.variants) != 1 || playlist.variants[0].uri.String() != tc.want {
+			t.Fatalf("track %+v: unexpected variants %+v", tc.track, playlist.variants)
+		}
+	}
+
+	source, err := NewHLSStreamSource(HLSConfig{PlaylistURL: "https://example.com/live/index.m3u8", AudioTrack: &sessionpkg.AudioTrackSelection{Language: "de"}})
+	if err != nil {
+		t.Fatalf("NewHLSStreamSource error: %v", err)
+	}
+	if _, err := source.parsePlaylist(master); !errors.Is(err, statuspkg.ErrFatal) {
+		t.Fatalf("expected a fatal error for a missing language, got %v", err)
+	}
+}
+
+func TestHLSStreamSourceRevalidatesPlaylist(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		reloads     int
+		revalidated int
+	)
+	handler := http.NewServeMux()
+	handler.HandleFunc("/live/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		reloads++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidated++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:4.0,\nseg-0.ts\n"))
+	})
+	handler.HandleFunc("/live/seg-0.ts", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("segment-0"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewHLSStreamSource(HLSConfig{
+		PlaylistURL:  server.URL + "/live/index.m3u8",
+		Client:       server.Client(),
+		PollInterval: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewHLSStreamSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+
+	deadline := time.After(time.Second)
+	for {
+		mu.Lock()
+		done := revalidated >= 3
+		mu.Unlock()
+		if done {
+			break
+		}
+		select {
+		case chunk := <-chunks:
+			if string(chunk.Payload) != "segment-0" {
+				t.Fatalf("unexpected chunk %q", chunk.Payload)
+			}
+		case err := <-errs:
+			t.Fatalf("unexpected stream error: %v", err)
+		case <-deadline:
+			t.Fatal("timed out waiting for playlist revalidation")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if metrics := source.Metrics(); metrics.ReceivedChunks != 1 || metrics.ErrorCount != 0 {
+		t.Fatalf("expected one segment and no errors, got %+v", metrics)
+	}
+	cancel()
+	for range chunks {
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if revalidated != reloads-1 {
+		t.Fatalf("expected every reload after the first to be conditional, got %d of %d", revalidated, reloads)
+	}
+}
+
+func TestHLSStreamSourceEndsWithPlaylist(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/vod/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("#EXTM3U\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:4.0,\nseg-0.ts\n#EXT-X-DISCONTINUITY\n#EXTINF:4.0,\nseg-1.ts\n#EXT-X-ENDLIST\n"))
+	})
+	handler.HandleFunc("/vod/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/vod/")))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewHLSStreamSource(HLSConfig{
+		PlaylistURL:  server.URL + "/vod/index.m3u8",
+		Client:       server.Client(),
+		PollInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewHLSStreamSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+
+	var received []MediaChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	if err := <-errs; !errors.Is(err, statuspkg.ErrSourceEnded) {
+		t.Fatalf("expected the source to end, got %v", err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 segments, got %d", len(received))
+	}
+	if _, ok := received[0].Metadata["discontinuity"]; ok {
+		t.Fatalf("first segment unexpectedly marked discontinuous: %v", received[0].Metadata)
+	}
+	if received[1].Metadata["discontinuity"] != "true" {
+		t.Fatalf("expected the second segment to be marked discontinuous, got %v", received[1].Metadata)
+	}
+}
+
+func TestHLSStreamSourceMarksSequenceJumps(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		reloads int
+	)
+	handler := http.NewServeMux()
+	handler.HandleFunc("/live/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// The second reload skips segments 2 to 4, as after a stall.
+		first := []int{0, 5}[min(reloads, 1)]
+		reloads++
+		fmt.Fprintf(w, "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:%d\n#EXTINF:2.0,\nseg-%d.ts\n#EXTINF:2.0,\nseg-%d.ts\n", first, first, first+1)
+	})
+	handler.HandleFunc("/live/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/live/")))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewHLSStreamSource(HLSConfig{
+		PlaylistURL:  server.URL + "/live/index.m3u8",
+		Client:       server.Client(),
+		PollInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewHLSStreamSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	chunks, _ := source.Stream(ctx)
+
+	want := []struct {
+		sequence      string
+		discontinuity bool
+	}{{"0", false}, {"1", false}, {"5", true}, {"6", false}}
+	for i, expected := range want {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("context done after %d chunks", i)
+		case chunk := <-chunks:
+			if chunk.Metadata["mediaSequence"] != expected.sequence || (chunk.Metadata["discontinuity"] == "true") != expected.discontinuity {
+				t.Fatalf("chunk %d: unexpected metadata %v", i, chunk.Metadata)
+			}
+		}
+	}
+}
+
+func TestHLSStreamSourceFetchesInitSectionsAndByteRanges(t *testing.T) {
+	media := []byte("init-amoof-0moof-1moof-2")
+	handler := http.NewServeMux()
+	handler.HandleFunc("/fmp4/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-MAP:URI="media.mp4",BYTERANGE="6@0"
+#EXTINF:2.0,
+#EXT-X-BYTERANGE:6@6
+media.mp4
+#EXTINF:2.0,
+#EXT-X-BYTERANGE:6
+media.mp4
+#EXT-X-MAP:URI="init-b.mp4"
+#EXTINF:2.0,
+#EXT-X-BYTERANGE:6
+media.mp4
+#EXT-X-ENDLIST
+`))
+	})
+	handler.HandleFunc("/fmp4/media.mp4", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "media.mp4", time.Time{}, bytes.NewReader(media))
+	})
+	handler.HandleFunc("/fmp4/init-b.mp4", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			t.Errorf("unexpected range %q for a whole init section", r.Header.Get("Range"))
+		}
+		_, _ = w.Write([]byte("init-b"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewHLSStreamSource(HLSConfig{
+		PlaylistURL:  server.URL + "/fmp4/index.m3u8",
+		Client:       server.Client(),
+		PollInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewHLSStreamSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+
+	var received []MediaChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	if err := <-errs; !errors.Is(err, statuspkg.ErrSourceEnded) {
+		t.Fatalf("expected the source to end, got %v", err)
+	}
+
+	want := []string{"init-a", "moof-0", "moof-1", "init-b", "moof-2"}
+	if len(received) != len(want) {
+		t.Fatalf("expected %d chunks, got %d", len(want), len(received))
+	}
+	for i, chunk := range received {
+		if string(chunk.Payload) != want[i] {
+			t.Fatalf("chunk %d payload = %q, want %q", i, chunk.Payload, want[i])
+		}
+	}
+	for _, i := range []int{0, 3} {
+		if received[i].Metadata["initialization"] != "true" {
+			t.Fatalf("expected chunk %d to be an initialization section, got %v", i, received[i].Metadata)
+		}
+	}
+	if got := received[2].Metadata["initSegment"]; got != "media.mp4@0-6" {
+		t.Fatalf("initSegment = %q", got)
+	}
+	if got := received[4].Metadata["initSegment"]; got != "init-b.mp4" {
+		t.Fatalf("initSegment = %q", got)
+	}
+}
+
+func TestHLSStreamSourceSwitchesVariantsOnLag(t *testing.T) {
+	const segments = 8
+	handler := http.NewServeMux()
+	handler.HandleFunc("/stream/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("#EXTM3U\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=2000000,CODECS=\"avc1.64001f,mp4a.40.2\"\nvideo/index.m3u8\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=128000,CODECS=\"mp4a.40.2\"\nhigh/index.m3u8\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS=\"mp4a.40.2\"\nlow/index.m3u8\n"))
+	})
+	for _, variant := range []string{"video", "high", "low"} {
+		variant := variant
+		handler.HandleFunc("/stream/"+variant+"/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+			var playlist strings.Builder
+			playlist.WriteString("#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:0\n")
+			for i := 0; i < segments; i++ {
+				fmt.Fprintf(&playlist, "#EXTINF:0.05,\nseg-%d.ts\n", i)
+			}
+			playlist.WriteString("#EXT-X-ENDLIST\n")
+			_, _ = w.Write([]byte(playlist.String()))
+		})
+		handler.HandleFunc("/stream/"+variant+"/", func(w http.ResponseWriter, r *http.Request) {
+			// The high variant downloads slower than real time.
+			if variant == "high" {
+				time.Sleep(60 * time.Millisecond)
+			}
+			_, _ = w.Write([]byte(variant + "/" + strings.TrimPrefix(r.URL.Path, "/stream/"+variant+"/")))
+		})
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	stream := func(adaptive *AdaptiveConfig) ([]MediaChunk, *HLSStreamSource) {
+		source, err := NewHLSStreamSource(HLSConfig{
+			PlaylistURL:  server.URL + "/stream/master.m3u8",
+			Client:       server.Client(),
+			PollInterval: 10 * time.Millisecond,
+			BufferSize:   segments,
+			Adaptive:     adaptive,
+		})
+		if err != nil {
+			t.Fatalf("NewHLSStreamSource error: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		chunks, errs := source.Stream(ctx)
+		var received []MediaChunk
+		for chunk := range chunks {
+			received = append(received, chunk)
+		}
+		if err := <-errs; !errors.Is(err, statuspkg.ErrSourceEnded) {
+			t.Fatalf("expected the source to end, got %v", err)
+		}
+		return received, source
+	}
+
+	received, _ := stream(nil)
+	if len(received) != segments || string(received[0].Payload) != "low/seg-0.ts" {
+		t.Fatalf("expected the lowest audio variant without adaptation, got %d chunks starting %q", len(received), received[0].Payload)
+	}
+
+	received, source := stream(&AdaptiveConfig{DownAfter: 2, UpAfter: 100})
+	var payloads []string
+	for _, chunk := range received {
+		payloads = append(payloads, string(chunk.Payload))
+	}
+	want := []string{"high/seg-0.ts", "high/seg-1.ts", "low/seg-2.ts", "low/seg-3.ts", "low/seg-4.ts", "low/seg-5.ts", "low/seg-6.ts", "low/seg-7.ts"}
+	if strings.Join(payloads, " ") != strings.Join(want, " ") {
+		t.Fatalf("chunks = %v, want %v", payloads, want)
+	}
+	if marked := received[2].Metadata; marked["variantSwitch"] != "down" || marked["bandwidth"] != "64000" || marked["discontinuity"] != "true" {
+		t.Fatalf("expected the first low chunk to be marked, got %v", marked)
+	}
+	if received[3].Metadata["variantSwitch"] != "" {
+		t.Fatalf("expected only the first chunk after the switch to be marked, got %v", received[3].Metadata)
+	}
+	if metrics := source.Metrics(); metrics.VariantSwitches != 1 {
+		t.Fatalf("metrics.VariantSwitches = %d, want 1", metrics.VariantSwitches)
+	}
+}
+
+func TestHLSStreamSourceDownloadsConcurrentlyInOrder(t *testing.T) {
+	const segments = 6
+	var (
+		mu                sync.Mutex
+		inFlight, maxSeen int
+	)
+	handler := http.NewServeMux()
+	handler.HandleFunc("/stream/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		var playlist strings.Builder
+		playlist.WriteString("#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:0\n")
+		for i := 0; i < segments; i++ {
+			fmt.Fprintf(&playlist, "#EXTINF:2.0,\nseg-%d.ts\n", i)
+		}
+		playlist.WriteString("#EXT-X-ENDLIST\n")
+		_, _ = w.Write([]byte(playlist.String()))
+	})
+	handler.HandleFunc("/stream/", func(w http.ResponseWriter, r *http.Request) {
+		var index int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/stream/"), "seg-%d.ts", &index); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		inFlight++
+		maxSeen = max(maxSeen, inFlight)
+		mu.Unlock()
+		// Earlier segments take longer, so they finish last.
+		time.Sleep(time.Duration(segments-index) * 10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		_, _ = w.Write([]byte("segment-" + strconv.Itoa(index)))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewHLSStreamSource(HLSConfig{
+		PlaylistURL:  server.URL + "/stream/index.m3u8",
+		Client:       server.Client(),
+		PollInterval: 10 * time.Millisecond,
+		BufferSize:   segments,
+		Concurrency:  3,
+	})
+	if err != nil {
+		t.Fatalf("NewHLSStreamSource error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+
+	var received []MediaChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	if err := <-errs; !errors.Is(err, statuspkg.ErrSourceEnded) {
+		t.Fatalf("expected the source to end, got %v", err)
+	}
+	if len(received) != segments {
+		t.Fatalf("expected %d chunks, got %d", segments, len(received))
+	}
+	for i, chunk := range received {
+		if string(chunk.Payload) != "segment-"+strconv.Itoa(i) || chunk.Metadata["mediaSequence"] != strconv.Itoa(i) {
+			t.Fatalf("chunk %d = %q (sequence %s), want segment-%d", i, chunk.Payload, chunk.Metadata["mediaSequence"], i)
+		}
+		if chunk.Metadata["discontinuity"] != "" {
+			t.Fatalf("chunk %d is marked as a discontinuity", i)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if maxSeen < 2 || maxSeen > 3 {
+		t.Fatalf("expected up to 3 downloads at once, saw %d", maxSeen)
+	}
+}
@@ -1,21 +1,46 @@
 package ingestion
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
 type streamCounters struct {
 	received  atomic.Int64
+	bytes     atomic.Int64
 	dropped   atomic.Int64
 	errors    atomic.Int64
 	reconnect atomic.Int64
 	sequence  atomic.Int64
+	switches  atomic.Int64
+	// playlist is when the playlist last listed new media, in Unix
+	// nanoseconds.
+	playlist atomic.Int64
+}
+
+// receive counts a chunk handed to the consumer.
+func (c *streamCounters) receive(chunk MediaChunk) {
+	c.received.Add(1)
+	c.bytes.Add(int64(len(chunk.Payload)))
+}
+
+// playlistUpdated records that the playlist listed new media.
+func (c *streamCounters) playlistUpdated() {
+	c.playlist.Store(time.Now().UnixNano())
 }
 
 func (c *streamCounters) snapshot() StreamMetrics {
-	return StreamMetrics{
-		ReceivedChunks: c.received.Load(),
-		DroppedChunks:  c.dropped.Load(),
-		ErrorCount:     c.errors.Load(),
-		ReconnectCount: c.reconnect.Load(),
-		LastSequence:   c.sequence.Load(),
+	metrics := StreamMetrics{
+		ReceivedChunks:  c.received.Load(),
+		ReceivedBytes:   c.bytes.Load(),
+		DroppedChunks:   c.dropped.Load(),
+		ErrorCount:      c.errors.Load(),
+		ReconnectCount:  c.reconnect.Load(),
+		LastSequence:    c.sequence.Load(),
+		VariantSwitches: c.switches.Load(),
+	}
+	if updated := c.playlist.Load(); updated != 0 {
+		metrics.PlaylistUpdated = time.Unix(0, updated)
 	}
+	return metrics
 }
@@ -0,0 +1,271 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// ObjectConfig configures the object storage stream source.
+type ObjectConfig struct {
+	// URI names the object as s3://bucket/key or gs://bucket/object.
+	URI    string
+	Client *http.Client
+	// Getenv looks up the credentials and endpoints of the object store:
+	// the standard AWS_* variables, including the web identity token of
+	// IRSA, for S3, and GOOGLE_APPLICATION_CREDENTIALS, the metadata server,
+	// or GOOGLE_OAUTH_ACCESS_TOKEN for GCS. Defaults to os.Getenv.
+	Getenv func(string) string
+	// ChunkSize controls the number of bytes per emitted chunk. Defaults to 64 KiB when zero.
+	ChunkSize int
+	// ChunkDuration approximates the playback duration per chunk.
+	ChunkDuration time.Duration
+	// BufferSize controls the channel buffer size for emitted chunks. Defaults to 4 when zero.
+	BufferSize int
+	// MaxRetries bounds how often an interrupted download is resumed
+	// before the stream fails. Defaults to 5.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// Metadata carries additional key/value metadata to attach to each chunk.
+	Metadata map[string]string
+}
+
+// objectStore addresses and authorizes the objects of a storage service.
+type objectStore interface {
+	// request builds a GET for the object's bytes from offset onwards.
+	request(ctx context.Context, bucket, key string, offset int64) (*http.Request, error)
+}
+
+// NewObjectStreamSource constructs a StreamSource that streams an object
+// from S3 or Google Cloud Storage as discrete media chunks. Downloads that
+// are interrupted resume from the last byte received.
+func NewObjectStreamSource(cfg ObjectConfig) (*ObjectStreamSource, error) {
+	uri, err := url.Parse(cfg.URI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object URI: %w", err)
+	}
+	bucket, key := uri.Host, strings.TrimPrefix(uri.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, errors.New("object URI must name a bucket and an object")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{}
+	}
+	if cfg.Getenv == nil {
+		cfg.Getenv = os.Getenv
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = 64 * 1024
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 4
+	}
+	if cfg.ChunkDuration < 0 {
+		return nil, errors.New("chunk duration cannot be negative")
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 500 * time.Millisecond
+	}
+
+	var store objectStore
+	switch uri.Scheme {
+	case "s3":
+		store = newS3Store(cfg.Client, cfg.Getenv)
+	case "gs":
+		store = newGCSStore(cfg.Client, cfg.Getenv)
+	default:
+		return nil, fmt.Errorf("unsupported object URI scheme %q", uri.Scheme)
+	}
+	return &ObjectStreamSource{
+		cfg:      cfg,
+		store:    store,
+		bucket:   bucket,
+		key:      key,
+		counters: &streamCounters{},
+	}, nil
+}
+
+// ObjectStreamSource implements StreamSource for objects in S3 or Google
+// Cloud Storage.
+type ObjectStreamSource struct {
+	cfg      ObjectConfig
+	store    objectStore
+	bucket   string
+	key      string
+	counters *streamCounters
+}
+
+// Stream downloads the object and emits it in chunks, closing the channels
+// once it has been emitted in full.
+func (s *ObjectStreamSource) Stream(ctx context.Context) (<-chan MediaChunk, <-chan error) {
+	chunks := make(chan MediaChunk, s.cfg.BufferSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(chunks)
+		defer close(errs)
+
+		fail := func(err error) {
+			s.counters.errors.Add(1)
+			errs <- err
+		}
+
+		var (
+			offset   int64
+			sequence int64
+			retries  int
+			body     io.ReadCloser
+			// size is the length of the object, or -1 while it is unknown.
+			size int64 = -1
+		)
+		defer func() {
+			if body != nil {
+				_ = body.Close()
+			}
+		}()
+		start := time.Now().UTC()
+		buf := make([]byte, s.cfg.ChunkSize)
+
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			if body == nil {
+				var err error
+				if body, size, err = s.open(ctx, offset); err != nil {
+					if errors.Is(err, statuspkg.ErrFatal) || retries >= s.cfg.MaxRetries {
+						fail(err)
+						return
+					}
+					retries++
+					s.counters.reconnect.Add(1)
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(s.cfg.RetryBackoff):
+					}
+					continue
+				}
+			}
+
+			n, readErr := io.ReadFull(body, buf)
+			if n > 0 {
+				payload := make([]byte, n)
+				copy(payload, buf[:n])
+				chunk := MediaChunk{
+					Sequence:  sequence,
+					Timestamp: start.Add(time.Duration(sequence) * s.cfg.ChunkDuration),
+					Duration:  s.cfg.ChunkDuration,
+					Payload:   payload,
+					Metadata:  map[string]string{"offset": strconv.FormatInt(offset, 10)},
+				}
+				for k, v := range s.cfg.Metadata {
+					chunk.Metadata[k] = v
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case chunks <- chunk:
+					s.counters.receive(chunk)
+					s.counters.sequence.Store(sequence)
+				}
+				offset += int64(n)
+				sequence++
+				retries = 0
+			}
+
+			ended := errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF)
+			switch {
+			case readErr == nil:
+			case ended && (size < 0 || offset >= size):
+				return
+			default:
+				// The connection dropped mid-object; resume where it ended.
+				_ = body.Close()
+				body = nil
+				if ctx.Err() != nil {
+					return
+				}
+				if retries >= s.cfg.MaxRetries {
+					fail(statuspkg.Transient(fmt.Errorf("read object: %w", readErr)))
+					return
+				}
+				retries++
+				s.counters.reconnect.Add(1)
+			}
+		}
+	}()
+
+	return chunks, errs
+}
+
+// open requests the object from offset onwards. It also returns the size
+// of the object, or -1 when the response does not tell.
+func (s *ObjectStreamSource) open(ctx context.Context, offset int64) (io.ReadCloser, int64, error) {
+	req, err := s.store.request(ctx, s.bucket, s.key, offset)
+	if err != nil {
+		return nil, -1, err
+	}
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, -1, statuspkg.Transient(fmt.Errorf("fetch object: %w", err))
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK && offset == 0:
+		return resp.Body, resp.ContentLength, nil
+	case resp.StatusCode == http.StatusPartialContent:
+		size := int64(-1)
+		if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			if value, err := strconv.ParseInt(total, 10, 64); err == nil {
+				size = value
+			}
+		}
+		return resp.Body, size, nil
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The previous connection ended exactly at the end of the object.
+		resp.Body.Close()
+		return io.NopCloser(strings.NewReader("")), offset, nil
+	default:
+		defer resp.Body.Close()
+		return nil, -1, responseError("object", resp)
+	}
+}
+
+// Probe fetches the start of the object to sniff its container, falling
+// back to the extension of its key.
+func (s *ObjectStreamSource) Probe(ctx context.Context) (SourceProbe, error) {
+	body, _, err := s.open(ctx, 0)
+	if err != nil {
+		return SourceProbe{}, err
+	}
+	defer func() { _ = body.Close() }()
+	return probeHeader(body, s.key)
+}
+
+// Metrics returns the current counters snapshot.
+func (s *ObjectStreamSource) Metrics() StreamMetrics {
+	return s.counters.snapshot()
+}
+
+// rangeHeader returns the Range header requesting bytes from offset
+// onwards, or an empty string for the whole object.
+func rangeHeader(offset int64) string {
+	if offset == 0 {
+		return ""
+	}
+	return fmt.Sprintf("bytes=%d-", offset)
+}
+
+var _ StreamSource = (*ObjectStreamSource)(nil)
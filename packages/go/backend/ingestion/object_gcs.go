@@ -0,0 +1,62 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"streamlation/packages/backend/cloudauth"
+)
+
+// gcsStore authorizes requests for Cloud Storage objects with an OAuth
+// access token: GOOGLE_OAUTH_ACCESS_TOKEN when set, one issued for the
+// service account key in GOOGLE_APPLICATION_CREDENTIALS, or, on Google
+// Cloud, one from the metadata server. Requests to an emulator named by
+// STORAGE_EMULATOR_HOST are anonymous unless credentials are configured.
+type gcsStore struct {
+	endpoint  string
+	anonymous bool
+	tokens    *cloudauth.GCPTokenSource
+}
+
+func newGCSStore(client *http.Client, getenv func(string) string) *gcsStore {
+	cfg := cloudauth.GCPConfig{
+		AccessToken:     getenv("GOOGLE_OAUTH_ACCESS_TOKEN"),
+		CredentialsFile: getenv("GOOGLE_APPLICATION_CREDENTIALS"),
+		Client:          client,
+	}
+	if host := getenv("GCE_METADATA_HOST"); host != "" {
+		cfg.TokenURL = "http://" + host + "/computeMetadata/v1/instance/service-accounts/default/token"
+	}
+	store := &gcsStore{endpoint: "https://storage.googleapis.com", tokens: cloudauth.NewGCPTokenSource(cfg)}
+	if emulator := getenv("STORAGE_EMULATOR_HOST"); emulator != "" {
+		store.endpoint = emulator
+		if !strings.Contains(store.endpoint, "://") {
+			store.endpoint = "http://" + store.endpoint
+		}
+		store.anonymous = cfg.AccessToken == "" && cfg.CredentialsFile == ""
+	}
+	return store
+}
+
+func (s *gcsStore) request(ctx context.Context, bucket, key string, offset int64) (*http.Request, error) {
+	target := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", strings.TrimSuffix(s.endpoint, "/"), url.PathEscape(bucket), url.PathEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build object request: %w", err)
+	}
+	if value := rangeHeader(offset); value != "" {
+		req.Header.Set("Range", value)
+	}
+	if s.anonymous {
+		return req, nil
+	}
+	token, err := s.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, nil
+}
@@ -0,0 +1,68 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"streamlation/packages/backend/cloudauth"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// s3Store signs requests for S3 objects with Signature Version 4. Static
+// credentials come from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY; with
+// AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE, as IRSA sets them, the role
+// is assumed through STS instead. Without either, requests are anonymous.
+type s3Store struct {
+	credentials *cloudauth.AWSCredentialProvider
+	region      string
+	endpoint    string
+	now         func() time.Time
+}
+
+func newS3Store(client *http.Client, getenv func(string) string) *s3Store {
+	cfg := cloudauth.AWSConfigFromEnv(getenv)
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Client = client
+	endpoint := getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = getenv("AWS_ENDPOINT_URL")
+	}
+	return &s3Store{credentials: cloudauth.NewAWSCredentialProvider(cfg), region: cfg.Region, endpoint: endpoint, now: time.Now}
+}
+
+func (s *s3Store) request(ctx context.Context, bucket, key string, offset int64) (*http.Request, error) {
+	// Custom endpoints, such as MinIO, address buckets by path.
+	var target *url.URL
+	if s.endpoint != "" {
+		base, err := url.Parse(strings.TrimSuffix(s.endpoint, "/"))
+		if err != nil {
+			return nil, statuspkg.Fatal(fmt.Errorf("invalid S3 endpoint: %w", err))
+		}
+		target = base.JoinPath(bucket, key)
+	} else {
+		target = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, s.region), Path: "/" + key}
+	}
+	target.RawPath = cloudauth.URIEncode(target.Path, false)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("build object request: %w", err)
+	}
+	if value := rangeHeader(offset); value != "" {
+		req.Header.Set("Range", value)
+	}
+	credentials, err := s.credentials.Credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if credentials != nil {
+		cloudauth.SignV4(req, *credentials, s.region, "s3", cloudauth.EmptyPayloadHash, s.now())
+	}
+	return req, nil
+}
@@ -0,0 +1,236 @@
+package ingestion
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func collectObject(t *testing.T, source *ObjectStreamSource) ([]MediaChunk, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+	var received []MediaChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	return received, <-errs
+}
+
+func TestObjectStreamSourceResumesS3Downloads(t *testing.T) {
+	object := []byte("abcdefghijklmnopqrstuvwxyz")
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/media/uploads/talk%201.mp4" {
+			t.Errorf("unexpected path %q", r.URL.EscapedPath())
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || r.Header.Get("X-Amz-Security-Token") != "session" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if requests.Add(1) == 1 {
+			// Drop the connection after part of the object.
+			w.Header().Set("Content-Length", strconv.Itoa(len(object)))
+			_, _ = w.Write(object[:10])
+			return
+		}
+		// The partial chunk received before the drop was emitted, so the
+		// download resumes after it.
+		if r.Header.Get("Range") != "bytes=10-" {
+			t.Errorf("unexpected range %q", r.Header.Get("Range"))
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 10-%d/%d", len(object)-1, len(object)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(object[10:])
+	}))
+	defer server.Close()
+
+	env := map[string]string{
+		"AWS_ENDPOINT_URL_S3":   server.URL,
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_SESSION_TOKEN":     "session",
+	}
+	source, err := NewObjectStreamSource(ObjectConfig{
+		URI:          "s3://media/uploads/talk 1.mp4",
+		Client:       server.Client(),
+		Getenv:       func(key string) string { return env[key] },
+		ChunkSize:    8,
+		RetryBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewObjectStreamSource error: %v", err)
+	}
+
+	received, err := collectObject(t, source)
+	if err != nil {
+		t.Fatalf("unexpected stream error: %v", err)
+	}
+	var payload []byte
+	for i, chunk := range received {
+		if chunk.Sequence != int64(i) {
+			t.Fatalf("chunk %d has sequence %d", i, chunk.Sequence)
+		}
+		payload = append(payload, chunk.Payload...)
+	}
+	if string(payload) != string(object) {
+		t.Fatalf("payload = %q, want %q", payload, object)
+	}
+	if metrics := source.Metrics(); metrics.ReconnectCount != 1 {
+		t.Fatalf("expected one resumed download, got %+v", metrics)
+	}
+}
+
+func TestObjectStreamSourceAssumesWebIdentityRole(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("web-identity\n"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	var assumed atomic.Int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("/sts", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("Action") != "AssumeRoleWithWebIdentity" || r.FormValue("WebIdentityToken") != "web-identity" || r.FormValue("RoleArn") != "arn:aws:iam::1:role/worker" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assumed.Add(1)
+		fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIATEMP</AccessKeyId><SecretAccessKey>temp</SecretAccessKey><SessionToken>irsa</SessionToken>
+<Expiration>%s</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	})
+	handler.HandleFunc("/media/", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential=ASIATEMP/") || r.Header.Get("X-Amz-Security-Token") != "irsa" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("vod"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	env := map[string]string{
+		"AWS_ENDPOINT_URL":            server.URL,
+		"AWS_ENDPOINT_URL_STS":        server.URL + "/sts",
+		"AWS_ROLE_ARN":                "arn:aws:iam::1:role/worker",
+		"AWS_WEB_IDENTITY_TOKEN_FILE": tokenFile,
+	}
+	source, err := NewObjectStreamSource(ObjectConfig{
+		URI:    "s3://media/vod.mp4",
+		Client: server.Client(),
+		Getenv: func(key string) string { return env[key] },
+	})
+	if err != nil {
+		t.Fatalf("NewObjectStreamSource error: %v", err)
+	}
+	received, err := collectObject(t, source)
+	if err != nil {
+		t.Fatalf("unexpected stream error: %v", err)
+	}
+	if len(received) != 1 || string(received[0].Payload) != "vod" {
+		t.Fatalf("unexpected chunks %+v", received)
+	}
+	if assumed.Load() != 1 {
+		t.Fatalf("expected the role to be assumed once, got %d", assumed.Load())
+	}
+}
+
+func TestObjectStreamSourceAuthorizesGCSWithServiceAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	handler := http.NewServeMux()
+	handler.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if len(parts) != 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if !strings.Contains(string(claims), `"iss":"worker@project.iam.gserviceaccount.com"`) {
+			t.Errorf("unexpected claims %s", claims)
+		}
+		_, _ = w.Write([]byte(`{"access_token":"ya29.token","expires_in":3600}`))
+	})
+	handler.HandleFunc("/storage/v1/b/uploads/o/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.EscapedPath() != "/storage/v1/b/uploads/o/vod%2Fclip.mp4" || r.URL.Query().Get("alt") != "media" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("clip"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "account.json")
+	account, _ := json.Marshal(map[string]string{
+		"client_email": "worker@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"token_uri":    server.URL + "/token",
+	})
+	if err := os.WriteFile(keyFile, account, 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	env := map[string]string{
+		"STORAGE_EMULATOR_HOST":          server.URL,
+		"GOOGLE_APPLICATION_CREDENTIALS": keyFile,
+	}
+
+	source, err := NewObjectStreamSource(ObjectConfig{
+		URI:    "gs://uploads/vod/clip.mp4",
+		Client: server.Client(),
+		Getenv: func(key string) string { return env[key] },
+	})
+	if err != nil {
+		t.Fatalf("NewObjectStreamSource error: %v", err)
+	}
+	received, err := collectObject(t, source)
+	if err != nil {
+		t.Fatalf("unexpected stream error: %v", err)
+	}
+	if len(received) != 1 || string(received[0].Payload) != "clip" {
+		t.Fatalf("unexpected chunks %+v", received)
+	}
+
+	// Without credentials, the missing authorization is fatal.
+	delete(env, "GOOGLE_APPLICATION_CREDENTIALS")
+	source, _ = NewObjectStreamSource(ObjectConfig{
+		URI:    "gs://uploads/vod/clip.mp4",
+		Client: server.Client(),
+		Getenv: func(key string) string { return env[key] },
+	})
+	if _, err := collectObject(t, source); !errors.Is(err, statuspkg.ErrFatal) {
+		t.Fatalf("expected a fatal error, got %v", err)
+	}
+}
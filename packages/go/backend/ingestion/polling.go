@@ -0,0 +1,160 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// sourceTransport is shared by the clients of NewHTTPClient, so that every
+// source polling the same CDN reuses its connections. It keeps more idle
+// connections per host than http.DefaultTransport, which would otherwise
+// close those of concurrent segment downloads between polls.
+var sourceTransport = func() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConnsPerHost = 16
+	transport.IdleConnTimeout = 90 * time.Second
+	return transport
+}()
+
+// NewHTTPClient returns a client for fetching media over HTTP, with the
+// given overall request timeout. Its clients share one transport, which
+// negotiates HTTP/2 and keeps connections open between polls.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: sourceTransport, Timeout: timeout}
+}
+
+// maxDrainLength bounds how much of an unread response body closeBody
+// reads to let its connection be reused.
+const maxDrainLength = 64 * 1024
+
+// closeBody closes the body of resp after reading what is left of it, up
+// to maxDrainLength, so that HTTP/1.1 connections go back to the pool
+// rather than being closed.
+func closeBody(resp *http.Response) {
+	_, _ = io.CopyN(io.Discard, resp.Body, maxDrainLength)
+	resp.Body.Close()
+}
+
+// documentPoller fetches a document that is polled, such as a playlist or
+// manifest, with conditional requests. While the server's Cache-Control
+// says the last response is fresh, it is returned without a request; after
+// that it is revalidated with If-None-Match and If-Modified-Since, and a
+// 304 returns it again. A documentPoller is not safe for concurrent use; a
+// nil *documentPoller fetches unconditionally.
+type documentPoller struct {
+	now func() time.Time
+
+	uri          string
+	body         []byte
+	etag         string
+	lastModified string
+	expires      time.Time
+}
+
+func newDocumentPoller() *documentPoller {
+	return &documentPoller{now: time.Now}
+}
+
+// fetch returns the document at uri. what names it in errors.
+func (p *documentPoller) fetch(ctx context.Context, client *http.Client, uri, what string) ([]byte, error) {
+	var (
+		now    time.Time
+		cached bool
+	)
+	if p != nil {
+		now = p.now()
+		cached = p.body != nil && p.uri == uri
+		if cached && now.Before(p.expires) {
+			return p.body, nil
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build %s request: %w", what, err)
+	}
+	if cached {
+		if p.etag != "" {
+			req.Header.Set("If-None-Match", p.etag)
+		}
+		if p.lastModified != "" {
+			req.Header.Set("If-Modified-Since", p.lastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, statuspkg.Transient(fmt.Errorf("fetch %s: %w", what, err))
+	}
+	defer closeBody(resp)
+	if cached && resp.StatusCode == http.StatusNotModified {
+		p.expires = now.Add(freshness(resp.Header))
+		return p.body, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(what, resp)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, statuspkg.Transient(fmt.Errorf("read %s: %w", what, err))
+	}
+	if p != nil {
+		p.remember(uri, body, resp.Header, now)
+	}
+	return body, nil
+}
+
+// remember keeps body, fetched from uri at now, for revalidation unless
+// the server forbids storing it.
+func (p *documentPoller) remember(uri string, body []byte, header http.Header, now time.Time) {
+	p.uri, p.body, p.expires = "", nil, time.Time{}
+	etag, lastModified := header.Get("ETag"), header.Get("Last-Modified")
+	if cacheDirectives(header)["no-store"] != "" || (etag == "" && lastModified == "" && freshness(header) == 0) {
+		return
+	}
+	p.uri, p.body = uri, body
+	p.etag, p.lastModified = etag, lastModified
+	p.expires = now.Add(freshness(header))
+}
+
+// freshness returns how long a response with header stays fresh: its
+// Cache-Control max-age less its Age, or zero when it must be revalidated.
+func freshness(header http.Header) time.Duration {
+	directives := cacheDirectives(header)
+	if directives["no-cache"] != "" || directives["no-store"] != "" {
+		return 0
+	}
+	maxAge, err := strconv.Atoi(directives["max-age"])
+	if err != nil || maxAge <= 0 {
+		return 0
+	}
+	if age, err := strconv.Atoi(strings.TrimSpace(header.Get("Age"))); err == nil && age > 0 {
+		maxAge -= age
+	}
+	return time.Duration(max(maxAge, 0)) * time.Second
+}
+
+// cacheDirectives parses the Cache-Control header. Directives without a
+// value map to "true".
+func cacheDirectives(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, line := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(line, ",") {
+			name, value, found := strings.Cut(strings.TrimSpace(directive), "=")
+			if name = strings.ToLower(name); name == "" {
+				continue
+			}
+			if !found {
+				value = "true"
+			}
+			directives[name] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
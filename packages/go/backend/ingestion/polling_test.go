@@ -0,0 +1,122 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDocumentPollerRevalidatesWithValidators(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		requests   int
+		conditions []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		conditions = append(conditions, r.Header.Get("If-None-Match")+"|"+r.Header.Get("If-Modified-Since"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write([]byte("#EXTM3U\n"))
+	}))
+	defer server.Close()
+
+	poller := newDocumentPoller()
+	for i := 0; i < 2; i++ {
+		body, err := poller.fetch(context.Background(), server.Client(), server.URL+"/index.m3u8", "playlist")
+		if err != nil {
+			t.Fatalf("fetch %d: %v", i, err)
+		}
+		if string(body) != "#EXTM3U\n" {
+			t.Fatalf("fetch %d returned %q", i, body)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 2 {
+		t.Fatalf("expected 2 requests, got %d", requests)
+	}
+	if want := `"v1"|Mon, 02 Jan 2006 15:04:05 GMT`; conditions[0] != "|" || conditions[1] != want {
+		t.Fatalf("unexpected conditional headers %q", conditions)
+	}
+}
+
+func TestDocumentPollerHonorsCacheControl(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		conditional []bool
+		header      = "max-age=4"
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		conditional = append(conditional, r.Header.Get("If-None-Match") != "")
+		w.Header().Set("Cache-Control", header)
+		w.Header().Set("Age", "1")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("manifest"))
+	}))
+	defer server.Close()
+
+	now := time.Unix(0, 0)
+	poller := newDocumentPoller()
+	poller.now = func() time.Time { return now }
+	fetch := func() {
+		t.Helper()
+		if _, err := poller.fetch(context.Background(), server.Client(), server.URL, "manifest"); err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+	}
+
+	fetch()
+	now = now.Add(2 * time.Second)
+	fetch()
+	mu.Lock()
+	if len(conditional) != 1 {
+		t.Fatalf("expected the fresh response to be reused, got %d requests", len(conditional))
+	}
+	header = "no-store"
+	mu.Unlock()
+
+	// max-age=4 with an Age of 1 leaves the response fresh for 3s, after
+	// which it is revalidated. The no-store response is not kept.
+	now = now.Add(2 * time.Second)
+	fetch()
+	fetch()
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []bool{false, true, false}; fmt.Sprint(conditional) != fmt.Sprint(want) {
+		t.Fatalf("conditional requests = %v, want %v", conditional, want)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":                        0,
+		"max-age=10":              10 * time.Second,
+		"public, MAX-AGE=\"6\"":   6 * time.Second,
+		"max-age=10, no-cache":    0,
+		"no-store":                0,
+		"s-maxage=30":             0,
+		"max-age=invalid, public": 0,
+	} {
+		header := http.Header{}
+		if value != "" {
+			header.Set("Cache-Control", value)
+		}
+		if got := freshness(header); got != want {
+			t.Errorf("freshness(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package ingestion
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// SourceProbe describes the media a source carries, as far as it can be
+// told without streaming it. Fields a source does not reveal are left zero.
+type SourceProbe struct {
+	// Container is the format the media arrives in, such as "mpegts",
+	// "fmp4", "adts", "mp3", "wav", or "rtp".
+	Container string `json:"container,omitempty"`
+	// Codecs are the codecs the source declares, as RFC 6381 strings for
+	// HLS and DASH and as RTP encoding names for RTSP.
+	Codecs []string `json:"codecs,omitempty"`
+	// Bitrate is the declared bitrate in bits per second.
+	Bitrate int64 `json:"bitrate,omitempty"`
+	// SegmentDuration is the target duration of the segments of HLS and
+	// DASH sources.
+	SegmentDuration time.Duration `json:"segmentDuration,omitempty"`
+	// Live is set for sources that keep producing media, and unset for
+	// those that end, such as VOD playlists and files.
+	Live bool `json:"live"`
+}
+
+// Prober is implemented by the stream sources that can describe their media
+// before streaming it. Probing fetches only what it needs, such as the
+// playlist or the first bytes of a file, and may run alongside Stream.
+type Prober interface {
+	Probe(ctx context.Context) (SourceProbe, error)
+}
+
+// ErrProbeUnsupported is returned by ProbeSource for sources that do not
+// implement Prober.
+var ErrProbeUnsupported = errors.New("source does not support probing")
+
+// ProbeSource probes source when it implements Prober.
+func ProbeSource(ctx context.Context, source StreamSource) (SourceProbe, error) {
+	prober, ok := source.(Prober)
+	if !ok {
+		return SourceProbe{}, ErrProbeUnsupported
+	}
+	probe, err := prober.Probe(ctx)
+	if err != nil {
+		return SourceProbe{}, fmt.Errorf("probe source: %w", err)
+	}
+	return probe, nil
+}
+
+// sniffLength is how much of a file or object is read to sniff its
+// container.
+const sniffLength = 512
+
+// sniffContainer recognises the container of media starting with header.
+func sniffContainer(header []byte) string {
+	switch {
+	case len(header) > 188 && header[0] == 0x47 && header[188] == 0x47:
+		return "mpegts"
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return "wav"
+	case len(header) >= 8 && string(header[4:8]) == "ftyp":
+		return "mp4"
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return "flac"
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return "ogg"
+	case bytes.HasPrefix(header, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		return "matroska"
+	case bytes.HasPrefix(header, []byte("FLV")):
+		return "flv"
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return "mp3"
+	case len(header) >= 2 && header[0] == 0xff && header[1]&0xf6 == 0xf0:
+		// An ADTS sync word has a zero layer; MPEG audio frames do not.
+		return "adts"
+	case len(header) >= 2 && header[0] == 0xff && header[1]&0xe0 == 0xe0:
+		return "mp3"
+	}
+	return ""
+}
+
+// probeHeader describes media that ends, such as a file, read from r and
+// named name.
+func probeHeader(r io.Reader, name string) (SourceProbe, error) {
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return SourceProbe{}, fmt.Errorf("read header: %w", err)
+	}
+	container := sniffContainer(header[:n])
+	if container == "" {
+		container = extensionContainer(name)
+	}
+	return SourceProbe{Container: container}, nil
+}
+
+// extensionContainers maps file extensions to the containers they name.
+var extensionContainers = map[string]string{
+	".ts":   "mpegts",
+	".aac":  "adts",
+	".mp3":  "mp3",
+	".mp4":  "mp4",
+	".m4a":  "mp4",
+	".m4s":  "fmp4",
+	".wav":  "wav",
+	".flac": "flac",
+	".ogg":  "ogg",
+	".opus": "ogg",
+	".mkv":  "matroska",
+	".webm": "webm",
+	".flv":  "flv",
+}
+
+// extensionContainer guesses the container of the media at name, a path or
+// URI, from its extension.
+func extensionContainer(name string) string {
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	return extensionContainers[strings.ToLower(path.Ext(name))]
+}
+
+// mimeContainers maps the MIME types of DASH representations to the
+// containers of their segments.
+var mimeContainers = map[string]string{
+	"audio/mp4":  "fmp4",
+	"video/mp4":  "fmp4",
+	"audio/webm": "webm",
+	"video/webm": "webm",
+	"video/mp2t": "mpegts",
+}
+
+// splitCodecs splits a CODECS or codecs attribute into its codecs.
+func splitCodecs(value string) []string {
+	var codecs []string
+	for _, codec := range strings.Split(value, ",") {
+		if codec = strings.TrimSpace(codec); codec != "" {
+			codecs = append(codecs, codec)
+		}
+	}
+	return codecs
+}
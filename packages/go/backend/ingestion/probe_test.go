@@ -0,0 +1,226 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHLSStreamSourceProbesVariant(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/live/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=2000000,CODECS="avc1.64001f,mp4a.40.2"
+video.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=128000,CODECS="mp4a.40.2"
+audio-hi.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS="mp4a.40.5"
+audio-lo.m3u8
+`))
+	})
+	for _, name := range []string{"audio-hi", "audio-lo"} {
+		handler.HandleFunc("/live/"+name+".m3u8", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:4.0,
+segment-10.m4s
+`))
+		})
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	probe := func(adaptive *AdaptiveConfig) SourceProbe {
+		t.Helper()
+		source, err := NewHLSStreamSource(HLSConfig{PlaylistURL: server.URL + "/live/master.m3u8", Client: server.Client(), Adaptive: adaptive})
+		if err != nil {
+			t.Fatalf("NewHLSStreamSource error: %v", err)
+		}
+		probe, err := source.Probe(context.Background())
+		if err != nil {
+			t.Fatalf("Probe error: %v", err)
+		}
+		return probe
+	}
+
+	got := probe(nil)
+	if got.Container != "fmp4" || got.Bitrate != 64000 || got.SegmentDuration != 4*time.Second || !got.Live {
+		t.Fatalf("unexpected probe of the lowest variant %+v", got)
+	}
+	if len(got.Codecs) != 1 || got.Codecs[0] != "mp4a.40.5" {
+		t.Fatalf("unexpected codecs %v", got.Codecs)
+	}
+	if got := probe(&AdaptiveConfig{}); got.Bitrate != 128000 || got.Codecs[0] != "mp4a.40.2" {
+		t.Fatalf("expected an adaptive source to probe its highest variant, got %+v", got)
+	}
+}
+
+func TestHLSStreamSourceProbesVODPlaylist(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXTINF:6.0,
+segment-0.ts?token=abc
+#EXT-X-ENDLIST
+`))
+	}))
+	defer server.Close()
+
+	source, err := NewHLSStreamSource(HLSConfig{PlaylistURL: server.URL + "/vod.m3u8", Client: server.Client()})
+	if err != nil {
+		t.Fatalf("NewHLSStreamSource error: %v", err)
+	}
+	got, err := ProbeSource(context.Background(), source)
+	if err != nil {
+		t.Fatalf("ProbeSource error: %v", err)
+	}
+	if got.Container != "mpegts" || got.Live || got.SegmentDuration != 6*time.Second || got.Bitrate != 0 {
+		t.Fatalf("unexpected probe %+v", got)
+	}
+}
+
+func TestDASHStreamSourceProbesRepresentation(t *testing.T) {
+	const manifest = `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT6S">
+  <Period>
+    <AdaptationSet mimeType="audio/mp4" codecs="mp4a.40.2">
+      <SegmentTemplate media="$RepresentationID$-$Number$.m4s" duration="96000" timescale="48000"/>
+      <Representation id="audio-hi" bandwidth="128000"/>
+      <Representation id="audio-lo" bandwidth="64000" codecs="mp4a.40.5"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(manifest))
+	}))
+	defer server.Close()
+
+	source, err := NewDASHStreamSource(DASHConfig{ManifestURL: server.URL + "/manifest.mpd", Client: server.Client()})
+	if err != nil {
+		t.Fatalf("NewDASHStreamSource error: %v", err)
+	}
+	got, err := source.Probe(context.Background())
+	if err != nil {
+		t.Fatalf("Probe error: %v", err)
+	}
+	if got.Container != "fmp4" || got.Bitrate != 64000 || got.SegmentDuration != 2*time.Second || got.Live {
+		t.Fatalf("unexpected probe %+v", got)
+	}
+	if len(got.Codecs) != 1 || got.Codecs[0] != "mp4a.40.5" {
+		t.Fatalf("expected the representation's codecs, got %v", got.Codecs)
+	}
+
+	source.cfg.Adaptive = &AdaptiveConfig{}
+	if got, err := source.Probe(context.Background()); err != nil || got.Bitrate != 128000 || got.Codecs[0] != "mp4a.40.2" {
+		t.Fatalf("expected the highest representation with the set's codecs, got %+v, %v", got, err)
+	}
+}
+
+func TestRTSPStreamSourceProbesAudioTrack(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go serveRTSP(t, ln, nil)
+
+	source, err := NewRTSPStreamSource(RTSPConfig{URL: "rtsp://viewer:secret@" + ln.Addr().String() + "/live/stream", ReadTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewRTSPStreamSource: %v", err)
+	}
+	got, err := source.Probe(context.Background())
+	if err != nil {
+		t.Fatalf("Probe error: %v", err)
+	}
+	if got.Container != "rtp" || got.Bitrate != 128000 || !got.Live || len(got.Codecs) != 1 || got.Codecs[0] != "MPEG4-GENERIC" {
+		t.Fatalf("unexpected probe %+v", got)
+	}
+	if metrics := source.Metrics(); metrics.ReceivedChunks != 0 {
+		t.Fatalf("expected probing to emit nothing, got %+v", metrics)
+	}
+}
+
+func TestFileStreamSourceProbesContainer(t *testing.T) {
+	dir := t.TempDir()
+	wav := filepath.Join(dir, "speech.bin")
+	if err := os.WriteFile(wav, []byte("RIFF\x24\x00\x00\x00WAVEfmt "), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	aac := filepath.Join(dir, "speech.aac")
+	if err := os.WriteFile(aac, []byte("not a recognisable header"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	for path, want := range map[string]string{wav: "wav", aac: "adts"} {
+		source, err := NewFileStreamSource(FileConfig{Path: path})
+		if err != nil {
+			t.Fatalf("NewFileStreamSource error: %v", err)
+		}
+		got, err := ProbeSource(context.Background(), source)
+		if err != nil {
+			t.Fatalf("ProbeSource error: %v", err)
+		}
+		if got.Container != want || got.Live {
+			t.Fatalf("expected %s to probe as %s, got %+v", path, want, got)
+		}
+	}
+}
+
+func TestFailoverSourceProbesFirstAnsweringURI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.mp3")
+	if err := os.WriteFile(path, []byte("ID3\x04\x00"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	source, err := NewFailoverSource(FailoverConfig{
+		URIs: []string{"primary", "scripted", path},
+		Open: func(uri string) (StreamSource, error) {
+			switch uri {
+			case "primary":
+				return NewFileStreamSource(FileConfig{Path: filepath.Join(t.TempDir(), "missing.ts")})
+			case "scripted":
+				return &scriptedSource{}, nil
+			}
+			return NewFileStreamSource(FileConfig{Path: uri})
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewFailoverSource error: %v", err)
+	}
+	got, err := source.Probe(context.Background())
+	if err != nil || got.Container != "mp3" {
+		t.Fatalf("expected the backup to be probed, got %+v, %v", got, err)
+	}
+
+	if _, err := ProbeSource(context.Background(), &scriptedSource{}); !errors.Is(err, ErrProbeUnsupported) {
+		t.Fatalf("expected sources without Probe to be unsupported, got %v", err)
+	}
+}
+
+func TestSniffContainer(t *testing.T) {
+	ts := make([]byte, 376)
+	ts[0], ts[188] = 0x47, 0x47
+	for _, tc := range []struct {
+		header []byte
+		want   string
+	}{
+		{ts, "mpegts"},
+		{[]byte{0xff, 0xf1, 0x50, 0x80}, "adts"},
+		{[]byte{0xff, 0xfb, 0x90, 0x64}, "mp3"},
+		{[]byte("\x00\x00\x00\x18ftypmp42"), "mp4"},
+		{[]byte("OggS\x00\x02"), "ogg"},
+		{[]byte("plain text"), ""},
+	} {
+		if got := sniffContainer(tc.header); got != tc.want {
+			t.Errorf("sniffContainer(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package ingestion
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// twitchWebClientID is the client ID of Twitch's own web player, which its
+// playback access tokens are issued to.
+const twitchWebClientID = "kimne78kx3ncx6brgo4mv6wki5h1ko"
+
+const twitchTokenQuery = `query PlaybackAccessToken($login: String!, $isLive: Boolean!, $vodID: ID!, $isVod: Boolean!, $playerType: String!) {
+  streamPlaybackAccessToken(channelName: $login, params: {platform: "web", playerBackend: "mediaplayer", playerType: $playerType}) @include(if: $isLive) { value signature }
+  videoPlaybackAccessToken(id: $vodID, params: {platform: "web", playerBackend: "mediaplayer", playerType: $playerType}) @include(if: $isVod) { value signature }
+}`
+
+var (
+	youtubeVideoID      = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	youtubeCanonicalURL = regexp.MustCompile(`<link rel="canonical" href="https://www\.youtube\.com/watch\?v=([A-Za-z0-9_-]{11})"`)
+)
+
+// PlatformResolverConfig configures NewPlatformResolver.
+type PlatformResolverConfig struct {
+	Client *http.Client
+	// HookURL names an external resolver used instead of the built-in
+	// ones. It is called as GET HookURL?url=<page URL> and answers with a
+	// JSON object whose "url" is the HLS playlist of the page.
+	HookURL string
+}
+
+// PlatformResolver turns the URLs of Twitch channels and videos and of
+// YouTube live streams into the HLS media playlists they play, so sessions
+// can name a page instead of a playlist. Master playlists are narrowed to
+// their audio-only rendition, or their lowest-bandwidth variant.
+type PlatformResolver struct {
+	client  *http.Client
+	hookURL string
+
+	twitchGQLURL   string
+	twitchUsherURL string
+	youtubeURL     string
+}
+
+// NewPlatformResolver constructs a PlatformResolver.
+func NewPlatformResolver(cfg PlatformResolverConfig) *PlatformResolver {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &PlatformResolver{
+		client:         cfg.Client,
+		hookURL:        cfg.HookURL,
+		twitchGQLURL:   "https://gql.twitch.tv/gql",
+		twitchUsherURL: "https://usher.ttvnw.net",
+		youtubeURL:     "https://www.youtube.com",
+	}
+}
+
+// Supports reports whether uri is a page the resolver can resolve: any
+// URL but a playlist when a hook is configured, and otherwise a Twitch or
+// YouTube page.
+func (r *PlatformResolver) Supports(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	if r.hookURL != "" {
+		return !strings.HasSuffix(parsed.Path, ".m3u8")
+	}
+	return platformOf(parsed) != ""
+}
+
+// Resolve returns the HLS media playlist that the page at uri plays.
+func (r *PlatformResolver) Resolve(ctx context.Context, uri string) (string, error) {
+	page, err := url.Parse(uri)
+	if err != nil {
+		return "", statuspkg.Fatal(fmt.Errorf("invalid page URL: %w", err))
+	}
+	var playlist string
+	switch {
+	case r.hookURL != "":
+		playlist, err = r.resolveWithHook(ctx, uri)
+	case platformOf(page) == "twitch":
+		playlist, err = r.resolveTwitch(ctx, page)
+	case platformOf(page) == "youtube":
+		playlist, err = r.resolveYouTube(ctx, page)
+	default:
+		return "", statuspkg.Fatal(fmt.Errorf("no resolver for %s", page.Host))
+	}
+	if err != nil {
+		return "", err
+	}
+	return r.mediaPlaylist(ctx, playlist)
+}
+
+func platformOf(page *url.URL) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(page.Hostname()), "www."), "m.")
+	switch host {
+	case "twitch.tv":
+		return "twitch"
+	case "youtube.com", "youtu.be":
+		return "youtube"
+	default:
+		return ""
+	}
+}
+
+func (r *PlatformResolver) resolveWithHook(ctx context.Context, uri string) (string, error) {
+	hook, err := url.Parse(r.hookURL)
+	if err != nil {
+		return "", statuspkg.Fatal(fmt.Errorf("invalid resolver hook URL: %w", err))
+	}
+	query := hook.Query()
+	query.Set("url", uri)
+	hook.RawQuery = query.Encode()
+
+	var result struct {
+		URL string `json:"url"`
+	}
+	if err := r.getJSON(ctx, "resolver hook", hook.String(), &result); err != nil {
+		return "", err
+	}
+	if result.URL == "" {
+		return "", statuspkg.Fatal(errors.New("resolver hook returned no playlist URL"))
+	}
+	return result.URL, nil
+}
+
+// resolveTwitch requests a playback access token for a channel or video
+// and returns the master playlist it unlocks.
+func (r *PlatformResolver) resolveTwitch(ctx context.Context, page *url.URL) (string, error) {
+	segments := strings.Split(strings.Trim(page.Path, "/"), "/")
+	variables := map[string]any{"isLive": true, "login": "", "isVod": false, "vodID": "", "playerType": "site"}
+	var usher string
+	switch {
+	case len(segments) == 2 && segments[0] == "videos":
+		variables["isLive"], variables["isVod"], variables["vodID"] = false, true, segments[1]
+		usher = fmt.Sprintf("%s/vod/%s.m3u8", r.twitchUsherURL, url.PathEscape(segments[1]))
+	case len(segments) == 1 && segments[0] != "":
+		login := strings.ToLower(segments[0])
+		variables["login"] = login
+		usher = fmt.Sprintf("%s/api/channel/hls/%s.m3u8", r.twitchUsherURL, url.PathEscape(login))
+	default:
+		return "", statuspkg.Fatal(fmt.Errorf("not a Twitch channel or video URL: %s", page))
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"operationName": "PlaybackAccessToken",
+		"query":         twitchTokenQuery,
+		"variables":     variables,
+	})
+	if err != nil {
+		return "", fmt.Errorf("encode playback token request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.twitchGQLURL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("build playback token request: %w", err)
+	}
+	req.Header.Set("Client-ID", twitchWebClientID)
+	req.Header.Set("Content-Type", "application/json")
+	var result struct {
+		Data struct {
+			Stream *twitchToken `json:"streamPlaybackAccessToken"`
+			Video  *twitchToken `json:"videoPlaybackAccessToken"`
+		} `json:"data"`
+	}
+	if err := r.doJSON(req, "playback token", &result); err != nil {
+		return "", err
+	}
+	token := result.Data.Stream
+	if variables["isVod"] == true {
+		token = result.Data.Video
+	}
+	if token == nil || token.Value == "" {
+		return "", statuspkg.Fatal(fmt.Errorf("Twitch has no playback for %s; is the channel live?", page))
+	}
+
+	query := url.Values{
+		"token":            {token.Value},
+		"sig":              {token.Signature},
+		"allow_source":     {"true"},
+		"allow_audio_only": {"true"},
+		"p":                {strconv.Itoa(rand.Intn(1000000))},
+	}
+	return usher + "?" + query.Encode(), nil
+}
+
+type twitchToken struct {
+	Value     string `json:"value"`
+	Signature string `json:"signature"`
+}
+
+// resolveYouTube returns the HLS manifest of a YouTube live stream. A
+// channel's /live page is first resolved to the video it is streaming.
+func (r *PlatformResolver) resolveYouTube(ctx context.Context, page *url.URL) (string, error) {
+	segments := strings.Split(strings.Trim(page.Path, "/"), "/")
+	var videoID string
+	switch {
+	case strings.EqualFold(page.Hostname(), "youtu.be") && len(segments) == 1:
+		videoID = segments[0]
+	case len(segments) == 1 && segments[0] == "watch":
+		videoID = page.Query().Get("v")
+	case len(segments) == 2 && segments[0] == "live":
+		videoID = segments[1]
+	case len(segments) >= 2 && segments[len(segments)-1] == "live":
+		id, err := r.youtubeLiveVideo(ctx, page)
+		if err != nil {
+			return "", err
+		}
+		videoID = id
+	}
+	if !youtubeVideoID.MatchString(videoID) {
+		return "", statuspkg.Fatal(fmt.Errorf("not a YouTube video or live URL: %s", page))
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"videoId": videoID,
+		"context": map[string]any{"client": map[string]string{"clientName": "IOS", "clientVersion": "19.45.4", "hl": "en"}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("encode player request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.youtubeURL+"/youtubei/v1/player", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("build player request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var result struct {
+		PlayabilityStatus struct {
+			Status string `json:"status"`
+			Reason string `json:"reason"`
+		} `json:"playabilityStatus"`
+		StreamingData struct {
+			HLSManifestURL string `json:"hlsManifestUrl"`
+		} `json:"streamingData"`
+	}
+	if err := r.doJSON(req, "player", &result); err != nil {
+		return "", err
+	}
+	if status := result.PlayabilityStatus.Status; status != "" && status != "OK" {
+		return "", statuspkg.Fatal(fmt.Errorf("YouTube video %s is not playable: %s %s", videoID, status, result.PlayabilityStatus.Reason))
+	}
+	if result.StreamingData.HLSManifestURL == "" {
+		return "", statuspkg.Fatal(fmt.Errorf("YouTube video %s has no HLS manifest; only live streams can be resolved", videoID))
+	}
+	return result.StreamingData.HLSManifestURL, nil
+}
+
+// youtubeLiveVideo returns the video a channel's /live page redirects to.
+func (r *PlatformResolver) youtubeLiveVideo(ctx context.Context, page *url.URL) (string, error) {
+	target := r.youtubeURL + page.EscapedPath()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", fmt.Errorf("build channel request: %w", err)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", statuspkg.Transient(fmt.Errorf("fetch channel page: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError("channel page", resp)
+	}
+	html, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return "", statuspkg.Transient(fmt.Errorf("read channel page: %w", err))
+	}
+	match := youtubeCanonicalURL.FindSubmatch(html)
+	if match == nil {
+		return "", statuspkg.Fatal(fmt.Errorf("channel %s is not live", page))
+	}
+	return string(match[1]), nil
+}
+
+// mediaPlaylist returns playlist itself when it is a media playlist, and
+// otherwise the media playlist of the rendition to ingest: the audio-only
+// variant, the default audio rendition, or the lowest-bandwidth variant.
+func (r *PlatformResolver) mediaPlaylist(ctx context.Context, playlist string) (string, error) {
+	base, err := url.Parse(playlist)
+	if err != nil {
+		return "", statuspkg.Fatal(fmt.Errorf("invalid playlist URL: %w", err))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, playlist, nil)
+	if err != nil {
+		return "", fmt.Errorf("build playlist request: %w", err)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", statuspkg.Transient(fmt.Errorf("fetch playlist: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError("playlist", resp)
+	}
+
+	var (
+		audioOnly, audio, lowest string
+		lowestBandwidth          int64 = -1
+		pending                  map[string]string
+	)
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 1<<20))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			attributes := parseAttributeList(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			if attributes["TYPE"] == "AUDIO" && attributes["URI"] != "" && (audio == "" || attributes["DEFAULT"] == "YES") {
+				audio = attributes["URI"]
+			}
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			pending = parseAttributeList(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+		case line == "" || strings.HasPrefix(line, "#"):
+		case pending != nil:
+			if pending["VIDEO"] == "audio_only" || isAudioCodecs(pending["CODECS"]) {
+				audioOnly = line
+			}
+			bandwidth, err := strconv.ParseInt(pending["BANDWIDTH"], 10, 64)
+			if err == nil && (lowestBandwidth < 0 || bandwidth < lowestBandwidth) {
+				lowest, lowestBandwidth = line, bandwidth
+			}
+			pending = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", statuspkg.Transient(fmt.Errorf("read playlist: %w", err))
+	}
+
+	for _, choice := range []string{audioOnly, audio, lowest} {
+		if choice != "" {
+			resolved, err := base.Parse(choice)
+			if err != nil {
+				return "", statuspkg.Fatal(fmt.Errorf("invalid variant URI: %w", err))
+			}
+			return resolved.String(), nil
+		}
+	}
+	return playlist, nil
+}
+
+// isAudioCodecs reports whether a CODECS attribute lists only audio codecs.
+func isAudioCodecs(codecs string) bool {
+	if codecs == "" {
+		return false
+	}
+	for _, codec := range strings.Split(codecs, ",") {
+		codec = strings.TrimSpace(codec)
+		if !strings.HasPrefix(codec, "mp4a") && !strings.HasPrefix(codec, "ac-3") && !strings.HasPrefix(codec, "ec-3") && !strings.HasPrefix(codec, "opus") {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *PlatformResolver) getJSON(ctx context.Context, what, target string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("build %s request: %w", what, err)
+	}
+	return r.doJSON(req, what, result)
+}
+
+func (r *PlatformResolver) doJSON(req *http.Request, what string, result any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return statuspkg.Transient(fmt.Errorf("fetch %s: %w", what, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(what, resp)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(result); err != nil {
+		return fmt.Errorf("decode %s response: %w", what, err)
+	}
+	return nil
+}
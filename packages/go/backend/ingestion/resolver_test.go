@@ -0,0 +1,192 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+const twitchMaster = `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=6000000,CODECS="avc1.64002A,mp4a.40.2",VIDEO="chunked"
+https://video.example/chunked.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=160000,CODECS="mp4a.40.2",VIDEO="audio_only"
+audio_only.m3u8
+`
+
+func TestPlatformResolverResolvesTwitchChannels(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/gql", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Variables map[string]any `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || r.Header.Get("Client-ID") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if request.Variables["login"] != "somechannel" || request.Variables["isLive"] != true {
+			t.Errorf("unexpected variables %v", request.Variables)
+		}
+		_, _ = w.Write([]byte(`{"data":{"streamPlaybackAccessToken":{"value":"{\"channel\":\"somechannel\"}","signature":"abc"}}}`))
+	})
+	handler.HandleFunc("/api/channel/hls/somechannel.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sig") != "abc" || r.URL.Query().Get("token") != `{"channel":"somechannel"}` {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(twitchMaster))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resolver := NewPlatformResolver(PlatformResolverConfig{Client: server.Client()})
+	resolver.twitchGQLURL = server.URL + "/gql"
+	resolver.twitchUsherURL = server.URL
+
+	if !resolver.Supports("https://www.twitch.tv/SomeChannel") {
+		t.Fatal("expected Twitch channels to be supported")
+	}
+	if resolver.Supports("https://cdn.example/live.m3u8") {
+		t.Fatal("expected playlists not to be resolved")
+	}
+	playlist, err := resolver.Resolve(context.Background(), "https://www.twitch.tv/SomeChannel")
+	if err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+	if want := server.URL + "/api/channel/hls/audio_only.m3u8"; playlist != want {
+		t.Fatalf("playlist = %q, want the audio-only rendition %q", playlist, want)
+	}
+}
+
+func TestPlatformResolverReportsOfflineTwitchChannels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"streamPlaybackAccessToken":null}}`))
+	}))
+	defer server.Close()
+
+	resolver := NewPlatformResolver(PlatformResolverConfig{Client: server.Client()})
+	resolver.twitchGQLURL = server.URL
+	if _, err := resolver.Resolve(context.Background(), "https://twitch.tv/offline"); !errors.Is(err, statuspkg.ErrFatal) {
+		t.Fatalf("expected a fatal error, got %v", err)
+	}
+}
+
+func TestPlatformResolverResolvesYouTubeLiveStreams(t *testing.T) {
+	var server *httptest.Server
+	handler := http.NewServeMux()
+	handler.HandleFunc("/@newsroom/live", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><link rel="canonical" href="https://www.youtube.com/watch?v=dQw4w9WgXcQ"></head></html>`))
+	})
+	handler.HandleFunc("/youtubei/v1/player", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			VideoID string `json:"videoId"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		if request.VideoID != "dQw4w9WgXcQ" {
+			_, _ = w.Write([]byte(`{"playabilityStatus":{"status":"ERROR","reason":"Video unavailable"}}`))
+			return
+		}
+		fmt.Fprintf(w, `{"playabilityStatus":{"status":"OK"},"streamingData":{"hlsManifestUrl":"%s/manifest/index.m3u8"}}`, server.URL)
+	})
+	handler.HandleFunc("/manifest/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=2000000,CODECS="avc1.4d401f,mp4a.40.2"
+720p/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=300000,CODECS="avc1.4d400c,mp4a.40.5"
+144p/index.m3u8
+`))
+	})
+	server = httptest.NewServer(handler)
+	defer server.Close()
+
+	resolver := NewPlatformResolver(PlatformResolverConfig{Client: server.Client()})
+	resolver.youtubeURL = server.URL
+
+	for _, page := range []string{"https://youtu.be/dQw4w9WgXcQ", "https://www.youtube.com/@newsroom/live"} {
+		playlist, err := resolver.Resolve(context.Background(), page)
+		if err != nil {
+			t.Fatalf("Resolve(%s) error: %v", page, err)
+		}
+		if want := server.URL + "/manifest/144p/index.m3u8"; playlist != want {
+			t.Fatalf("Resolve(%s) = %q, want the lowest-bandwidth variant %q", page, playlist, want)
+		}
+	}
+	if _, err := resolver.Resolve(context.Background(), "https://www.youtube.com/watch?v=aaaaaaaaaaa"); !errors.Is(err, statuspkg.ErrFatal) {
+		t.Fatalf("expected unplayable videos to be fatal, got %v", err)
+	}
+}
+
+func TestHLSStreamSourceResolvesExpiredPlaylists(t *testing.T) {
+	var (
+		server      *httptest.Server
+		resolutions atomic.Int32
+		served      atomic.Int32
+	)
+	handler := http.NewServeMux()
+	handler.HandleFunc("/hook", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("url") != "https://video.example/channel" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"url":"%s/live.m3u8?token=%d"}`, server.URL, resolutions.Add(1))
+	})
+	handler.HandleFunc("/live.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("token") {
+		case "1":
+			// The first token expires once the resolver and the source
+			// have each fetched the playlist.
+			if served.Add(1) > 2 {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte("#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:1,\nseg0.ts\n"))
+		case "2":
+			_, _ = w.Write([]byte("#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:1,\nseg0.ts\n#EXTINF:1,\nseg1.ts\n#EXT-X-ENDLIST\n"))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})
+	handler.HandleFunc("/seg0.ts", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("zero")) })
+	handler.HandleFunc("/seg1.ts", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("one")) })
+	server = httptest.NewServer(handler)
+	defer server.Close()
+
+	resolver := NewPlatformResolver(PlatformResolverConfig{Client: server.Client(), HookURL: server.URL + "/hook"})
+	source, err := NewHLSStreamSource(HLSConfig{
+		PlaylistURL:  "https://video.example/channel",
+		Client:       server.Client(),
+		PollInterval: 5 * time.Millisecond,
+		RetryBackoff: time.Millisecond,
+		Resolve: func(ctx context.Context) (string, error) {
+			return resolver.Resolve(ctx, "https://video.example/channel")
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewHLSStreamSource error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+	var payloads []string
+	for chunk := range chunks {
+		payloads = append(payloads, string(chunk.Payload))
+	}
+	if err := <-errs; !errors.Is(err, statuspkg.ErrSourceEnded) {
+		t.Fatalf("expected the source to end, got %v", err)
+	}
+	if strings.Join(payloads, ",") != "zero,one" {
+		t.Fatalf("unexpected payloads %v", payloads)
+	}
+	if resolutions.Load() != 2 {
+		t.Fatalf("expected the page to be resolved twice, got %d", resolutions.Load())
+	}
+}
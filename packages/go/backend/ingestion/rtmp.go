@@ -9,6 +9,8 @@ import (
 	"net"
 	"net/url"
 	"time"
+
+	statuspkg "streamlation/packages/backend/status"
 )
 
 // RTMPConfig configures the RTMP stream source.
@@ -18,6 +20,9 @@ type RTMPConfig struct {
 	BufferSize     int
 	ReconnectDelay time.Duration
 	ReadTimeout    time.Duration
+	// Backpressure selects what happens to payloads while the consumer is
+	// behind. By default they are dropped.
+	Backpressure Backpressure
 }
 
 // NewRTMPStreamSource constructs an RTMP adapter emitting MediaChunks.
@@ -69,6 +74,7 @@ func (s *RTMPStreamSource) Stream(ctx context.Context) (<-chan MediaChunk, <-cha
 		defer close(chunks)
 		defer close(errs)
 
+		emitter := newChunkEmitter(chunks, s.cfg.Backpressure, s.counters)
 		for {
 			if ctx.Err() != nil {
 				return
@@ -105,7 +111,7 @@ func (s *RTMPStreamSource) Stream(ctx context.Context) (<-chan MediaChunk, <-cha
 				continue
 			}
 
-			if err := s.consumeStream(ctx, conn, chunks); err != nil {
+			if err := consumeFrames(ctx, conn, s.cfg.ReadTimeout, s.url.Path, s.counters, emitter); err != nil {
 				conn.Close()
 				if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
 					select {
@@ -139,37 +145,70 @@ func (s *RTMPStreamSource) Metrics() StreamMetrics {
 	return s.counters.snapshot()
 }
 
+// Probe connects and reads the first payload to sniff its container. RTMP
+// streams are always live.
+func (s *RTMPStreamSource) Probe(ctx context.Context) (SourceProbe, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return SourceProbe{}, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := s.handshake(conn); err != nil {
+		return SourceProbe{}, err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(s.cfg.ReadTimeout))
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return SourceProbe{}, statuspkg.Transient(fmt.Errorf("rtmp read header: %w", err))
+	}
+	payload := make([]byte, min(binary.BigEndian.Uint32(header), sniffLength))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return SourceProbe{}, statuspkg.Transient(fmt.Errorf("rtmp read payload: %w", err))
+	}
+	return SourceProbe{Container: sniffContainer(payload), Live: true}, nil
+}
+
 func (s *RTMPStreamSource) dial(ctx context.Context) (net.Conn, error) {
 	network := "tcp"
 	host := s.url.Host
-	return s.cfg.Dialer.DialContext(ctx, network, host)
+	conn, err := s.cfg.Dialer.DialContext(ctx, network, host)
+	if err != nil {
+		return nil, statuspkg.Transient(err)
+	}
+	return conn, nil
 }
 
 func (s *RTMPStreamSource) handshake(conn net.Conn) error {
 	if _, err := conn.Write([]byte(handshakeMagic)); err != nil {
-		return fmt.Errorf("rtmp handshake send: %w", err)
+		return statuspkg.Transient(fmt.Errorf("rtmp handshake send: %w", err))
 	}
 	buf := make([]byte, len(handshakeMagic))
 	if _, err := io.ReadFull(conn, buf); err != nil {
-		return fmt.Errorf("rtmp handshake receive: %w", err)
+		return statuspkg.Transient(fmt.Errorf("rtmp handshake receive: %w", err))
 	}
 	if string(buf) != handshakeMagic {
-		return fmt.Errorf("unexpected handshake response %q", string(buf))
+		return statuspkg.Fatal(fmt.Errorf("unexpected handshake response %q", string(buf)))
 	}
 	return nil
 }
 
-func (s *RTMPStreamSource) consumeStream(ctx context.Context, conn net.Conn, chunks chan<- MediaChunk) error {
+// consumeFrames emits the length-prefixed payloads read from conn, with
+// path in their metadata, until reading fails. A zero length is a
+// keep-alive. Waiting longer than readTimeout for a payload fails the read.
+func consumeFrames(ctx context.Context, conn net.Conn, readTimeout time.Duration, path string, counters *streamCounters, emitter *chunkEmitter) error {
 	header := make([]byte, 4)
 	for {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
-		if s.cfg.ReadTimeout > 0 {
-			_ = conn.SetReadDeadline(time.Now().Add(s.cfg.ReadTimeout))
+		if readTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
 		}
 		if _, err := io.ReadFull(conn, header); err != nil {
-			return fmt.Errorf("rtmp read header: %w", err)
+			return statuspkg.Transient(fmt.Errorf("rtmp read header: %w", err))
 		}
 		length := binary.BigEndian.Uint32(header)
 		if length == 0 {
@@ -177,21 +216,16 @@ func (s *RTMPStreamSource) consumeStream(ctx context.Context, conn net.Conn, chu
 		}
 		payload := make([]byte, length)
 		if _, err := io.ReadFull(conn, payload); err != nil {
-			return fmt.Errorf("rtmp read payload: %w", err)
+			return statuspkg.Transient(fmt.Errorf("rtmp read payload: %w", err))
 		}
 		chunk := MediaChunk{
-			Sequence:  s.counters.sequence.Add(1),
+			Sequence:  counters.sequence.Add(1),
 			Timestamp: time.Now().UTC(),
 			Payload:   payload,
 			Metadata: map[string]string{
-				"path": s.url.Path,
+				"path": path,
 			},
 		}
-		select {
-		case chunks <- chunk:
-			s.counters.received.Add(1)
-		default:
-			s.counters.dropped.Add(1)
-		}
+		emitter.emit(ctx, chunk)
 	}
 }
@@ -0,0 +1,451 @@
+package ingestion
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// RTMPListenerConfig configures an RTMPListener.
+type RTMPListenerConfig struct {
+	// Addr is the TCP address encoders publish to, such as ":1935".
+	Addr string
+	// HandshakeTimeout bounds the handshake and the commands up to the
+	// publish. Defaults to 5s.
+	HandshakeTimeout time.Duration
+	// ReadTimeout disconnects a publisher that sends nothing for this
+	// long. Defaults to 10s.
+	ReadTimeout time.Duration
+	// MaxHandshakes bounds the connections that have not yet published
+	// under a streaming key; further connections are closed on accept.
+	// Defaults to 16.
+	MaxHandshakes int
+}
+
+// RTMPPushConfig configures the source of one stream key of an
+// RTMPListener.
+type RTMPPushConfig struct {
+	// StreamKey is the key encoders publish the session's stream under.
+	StreamKey string
+	// BufferSize controls the channel buffer size. Defaults to 8 when zero.
+	BufferSize int
+	// Backpressure selects what happens to payloads while the pipeline is
+	// behind. By default they are dropped.
+	Backpressure Backpressure
+}
+
+// NewRTMPListener constructs a listener for encoders that push their
+// streams. It accepts nothing until ListenAndServe or Serve runs.
+func NewRTMPListener(cfg RTMPListenerConfig) (*RTMPListener, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("rtmp listen address is required")
+	}
+	if cfg.HandshakeTimeout <= 0 {
+		cfg.HandshakeTimeout = 5 * time.Second
+	}
+	if cfg.ReadTimeout <= 0 {
+		cfg.ReadTimeout = 10 * time.Second
+	}
+	if cfg.MaxHandshakes <= 0 {
+		cfg.MaxHandshakes = 16
+	}
+	return &RTMPListener{
+		cfg:        cfg,
+		streams:    make(map[string]*rtmpBinding),
+		handshakes: make(chan struct{}, cfg.MaxHandshakes),
+	}, nil
+}
+
+// RTMPListener accepts RTMP publishes from encoders and hands each to the
+// push source streaming its stream key. A publisher connects to an
+// application, such as "live", and publishes a stream name, such as "KEY",
+// under the stream key "live/KEY"; query strings on either are left out.
+// Publishes for keys no session is streaming, and for keys that are
+// already being published, are refused with NetStream.Publish.BadName.
+type RTMPListener struct {
+	cfg RTMPListenerConfig
+
+	mu      sync.Mutex
+	streams map[string]*rtmpBinding
+	// handshakes holds a slot for every connection until it publishes
+	// under a streaming key.
+	handshakes chan struct{}
+}
+
+// rtmpBinding ties a stream key to the push source streaming it.
+type rtmpBinding struct {
+	source  *RTMPPushSource
+	ctx     context.Context
+	emitter *chunkEmitter
+	errs    chan<- error
+	// publishing is set while a publisher is connected, and published once
+	// one has been.
+	publishing, published bool
+	// publishers tracks the connected publisher, which must be done
+	// emitting before the source's channels are closed.
+	publishers sync.WaitGroup
+}
+
+// Source returns the StreamSource for the publishes of cfg.StreamKey, which
+// is bound to it while it streams. A nil listener returns a source that
+// fails to stream.
+func (l *RTMPListener) Source(cfg RTMPPushConfig) (*RTMPPushSource, error) {
+	cfg.StreamKey = strings.Trim(cfg.StreamKey, "/")
+	if cfg.StreamKey == "" {
+		return nil, errors.New("rtmp stream key is required")
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 8
+	}
+	return &RTMPPushSource{listener: l, cfg: cfg, counters: &streamCounters{}}, nil
+}
+
+// ListenAndServe listens on cfg.Addr and serves publishes until ctx is
+// cancelled.
+func (l *RTMPListener) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", l.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("listen for rtmp publishes: %w", err)
+	}
+	return l.Serve(ctx, ln)
+}
+
+// Serve accepts publishes on ln until ctx is cancelled, then closes ln and
+// disconnects the publishers.
+func (l *RTMPListener) Serve(ctx context.Context, ln net.Listener) error {
+	defer ln.Close()
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+
+	var handlers sync.WaitGroup
+	defer handlers.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accept rtmp publish: %w", err)
+		}
+		select {
+		case l.handshakes <- struct{}{}:
+		default:
+			conn.Close()
+			continue
+		}
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			l.handle(ctx, conn)
+		}()
+	}
+}
+
+// handle serves one publisher until it disconnects, or until the listener
+// or the session streaming its key stops.
+func (l *RTMPListener) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	var handshaking sync.Once
+	endHandshake := func() { handshaking.Do(func() { <-l.handshakes }) }
+	defer endHandshake()
+
+	_ = conn.SetDeadline(time.Now().Add(l.cfg.HandshakeTimeout))
+	rc := newRTMPConn(conn)
+	key, streamID, err := negotiatePublish(rc)
+	if err != nil {
+		return
+	}
+	binding := l.claim(key)
+	if binding == nil {
+		_ = rc.writeCommand(streamID, "onStatus", 0, nil, publishStatus("error", "NetStream.Publish.BadName", "stream key "+key+" is not streaming"))
+		return
+	}
+	defer l.release(binding)
+	endHandshake()
+	stopSession := context.AfterFunc(binding.ctx, func() { conn.Close() })
+	defer stopSession()
+	if err := rc.writeCommand(streamID, "onStatus", 0, nil, publishStatus("status", "NetStream.Publish.Start", key+" is now published")); err != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	err = consumePublish(binding.ctx, conn, rc, l.cfg.ReadTimeout, "/"+key, binding.source.counters, binding.emitter)
+	if err == nil || errors.Is(err, io.EOF) || binding.ctx.Err() != nil || ctx.Err() != nil {
+		return
+	}
+	binding.source.counters.errors.Add(1)
+	select {
+	case binding.errs <- err:
+	default:
+	}
+}
+
+// negotiatePublish completes the handshake and answers the publisher's
+// commands until it publishes, returning the stream key it publishes under
+// and the message stream it publishes on.
+func negotiatePublish(rc *rtmpConn) (string, uint32, error) {
+	if err := rc.serverHandshake(); err != nil {
+		return "", 0, err
+	}
+	var (
+		app       string
+		connected bool
+		streams   uint32
+	)
+	for {
+		message, err := rc.readMessage()
+		if err != nil {
+			return "", 0, fmt.Errorf("rtmp read command: %w", err)
+		}
+		name, transaction, args, err := decodeCommand(message)
+		if err != nil {
+			return "", 0, err
+		}
+		switch name {
+		case "connect":
+			properties, _ := args[0].(map[string]any)
+			app, _ = properties["app"].(string)
+			connected = true
+			if err := rc.writeControl(rtmpWindowAckSize, rtmpWindowSize); err != nil {
+				return "", 0, err
+			}
+			// Dynamic limit type.
+			if err := rc.writeControl(rtmpSetPeerBandwidth, rtmpWindowSize, 2); err != nil {
+				return "", 0, err
+			}
+			if err := rc.writeControl(rtmpSetChunkSize, rtmpServerChunkSize); err != nil {
+				return "", 0, err
+			}
+			if err := rc.writeCommand(0, "_result", transaction,
+				amfObject{{"fmsVer", "FMS/3,0,1,123"}, {"capabilities", 31}},
+				amfObject{{"level", "status"}, {"code", "NetConnection.Connect.Success"}, {"description", "Connection succeeded."}, {"objectEncoding", 0}},
+			); err != nil {
+				return "", 0, err
+			}
+		case "createStream":
+			streams++
+			if err := rc.writeCommand(0, "_result", transaction, nil, int(streams)); err != nil {
+				return "", 0, err
+			}
+		case "publish":
+			if !connected {
+				return "", 0, errors.New("rtmp publish before connect")
+			}
+			stream, _ := args[1].(string)
+			stream, _, _ = strings.Cut(stream, "?")
+			if stream = strings.Trim(stream, "/"); stream == "" {
+				return "", 0, errors.New("rtmp publish without a stream name")
+			}
+			app, _, _ = strings.Cut(app, "?")
+			key := strings.TrimPrefix(strings.Trim(app, "/")+"/"+stream, "/")
+			// Stream Begin.
+			begin := binary.BigEndian.AppendUint32([]byte{0, 0}, message.streamID)
+			if err := rc.writeMessage(2, rtmpMessage{typeID: rtmpUserControl, payload: begin}); err != nil {
+				return "", 0, err
+			}
+			return key, message.streamID, nil
+		}
+	}
+}
+
+// decodeCommand returns the name, transaction ID, and arguments of an AMF0
+// or AMF3 command message, with two arguments at least. Other messages
+// decode with no name.
+func decodeCommand(message rtmpMessage) (string, float64, []any, error) {
+	payload := message.payload
+	switch message.typeID {
+	case rtmpCommandAMF0:
+	case rtmpCommandAMF3:
+		// AMF3 commands are AMF0 after a format byte.
+		if len(payload) == 0 {
+			return "", 0, nil, errors.New("empty rtmp command")
+		}
+		payload = payload[1:]
+	default:
+		return "", 0, nil, nil
+	}
+	values, err := decodeAMF0(payload)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("decode rtmp command: %w", err)
+	}
+	values = append(values, make([]any, max(0, 4-len(values)))...)
+	name, _ := values[0].(string)
+	transaction, _ := values[1].(float64)
+	return name, transaction, values[2:], nil
+}
+
+// publishStatus is the information object of an onStatus command.
+func publishStatus(level, code, description string) amfObject {
+	return amfObject{{"level", level}, {"code", code}, {"description", description}}
+}
+
+// setDataFrame prefixes the script data an encoder sends for the stream,
+// rather than for the server, and which FLV files store without it.
+var setDataFrame, _ = encodeAMF0("@setDataFrame")
+
+// consumePublish emits the publisher's stream, remuxed into FLV: a chunk
+// holding the FLV header, marked as initialization, then a chunk per
+// audio, video, and script data message holding its FLV tag, with path and
+// the message's timestamp in their metadata. It returns nil once the
+// publisher stops publishing. Waiting longer than readTimeout for a
+// message fails the read.
+func consumePublish(ctx context.Context, conn net.Conn, rc *rtmpConn, readTimeout time.Duration, path string, counters *streamCounters, emitter *chunkEmitter) error {
+	emitter.emit(ctx, MediaChunk{
+		Sequence:  counters.sequence.Add(1),
+		Timestamp: time.Now().UTC(),
+		Payload:   append([]byte(nil), flvHeader...),
+		Metadata:  map[string]string{"path": path, "initialization": "true"},
+	})
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if readTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+		}
+		message, err := rc.readMessage()
+		if err != nil {
+			return statuspkg.Transient(fmt.Errorf("rtmp read message: %w", err))
+		}
+		switch message.typeID {
+		case rtmpAudio, rtmpVideo:
+		case rtmpDataAMF0, rtmpDataAMF3:
+			if message.typeID == rtmpDataAMF3 && len(message.payload) > 0 {
+				message.payload = message.payload[1:]
+			}
+			message.typeID = rtmpDataAMF0
+			message.payload = bytes.TrimPrefix(message.payload, setDataFrame)
+		case rtmpCommandAMF0, rtmpCommandAMF3:
+			name, _, _, err := decodeCommand(message)
+			if err != nil {
+				return err
+			}
+			if name == "deleteStream" || name == "closeStream" || name == "FCUnpublish" {
+				return nil
+			}
+			continue
+		default:
+			continue
+		}
+		if len(message.payload) == 0 {
+			continue
+		}
+		emitter.emit(ctx, MediaChunk{
+			Sequence:  counters.sequence.Add(1),
+			Timestamp: time.Now().UTC(),
+			Payload:   flvTag(message),
+			Metadata: map[string]string{
+				"path":          path,
+				"rtmpTimestamp": strconv.FormatUint(uint64(message.timestamp), 10),
+			},
+		})
+	}
+}
+
+// claim returns the binding of key for a new publisher, or nil when no
+// session streams key or another publisher already is connected.
+func (l *RTMPListener) claim(key string) *rtmpBinding {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	binding := l.streams[key]
+	if binding == nil || binding.publishing {
+		return nil
+	}
+	if binding.published {
+		binding.source.counters.reconnect.Add(1)
+	}
+	binding.publishing, binding.published = true, true
+	binding.publishers.Add(1)
+	return binding
+}
+
+// release marks the publisher of binding as disconnected.
+func (l *RTMPListener) release(binding *rtmpBinding) {
+	l.mu.Lock()
+	binding.publishing = false
+	l.mu.Unlock()
+	binding.publishers.Done()
+}
+
+// bind routes the publishes of key to binding.
+func (l *RTMPListener) bind(key string, binding *rtmpBinding) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.streams[key]; ok {
+		return fmt.Errorf("rtmp stream key %q is already being streamed", key)
+	}
+	l.streams[key] = binding
+	return nil
+}
+
+// unbind stops routing the publishes of key. Publishes claimed before then
+// still run until their connections close.
+func (l *RTMPListener) unbind(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.streams, key)
+}
+
+// RTMPPushSource implements StreamSource for the publishes an RTMPListener
+// receives under one stream key, remuxed into FLV. The stream outlasts its
+// publishers: when one disconnects, the next publish under the key
+// continues the stream, starting with an FLV header again, and is counted
+// as a reconnect. Chunks carry the stream key as their "path".
+type RTMPPushSource struct {
+	listener *RTMPListener
+	cfg      RTMPPushConfig
+	counters *streamCounters
+}
+
+// Stream binds the stream key and emits the payloads published under it
+// until ctx is cancelled.
+func (s *RTMPPushSource) Stream(ctx context.Context) (<-chan MediaChunk, <-chan error) {
+	if s.listener == nil {
+		chunks, errs := make(chan MediaChunk), make(chan error, 1)
+		errs <- statuspkg.Fatal(errors.New("rtmp sources without a host need an rtmp listener to publish to"))
+		close(chunks)
+		close(errs)
+		return chunks, errs
+	}
+
+	chunks := make(chan MediaChunk, s.cfg.BufferSize)
+	errs := make(chan error, 1)
+	binding := &rtmpBinding{
+		source:  s,
+		ctx:     ctx,
+		emitter: newChunkEmitter(chunks, s.cfg.Backpressure, s.counters),
+		errs:    errs,
+	}
+	if err := s.listener.bind(s.cfg.StreamKey, binding); err != nil {
+		s.counters.errors.Add(1)
+		errs <- statuspkg.Fatal(err)
+		close(chunks)
+		close(errs)
+		return chunks, errs
+	}
+	go func() {
+		<-ctx.Done()
+		s.listener.unbind(s.cfg.StreamKey)
+		binding.publishers.Wait()
+		close(chunks)
+		close(errs)
+	}()
+	return chunks, errs
+}
+
+// Metrics returns the push source counters.
+func (s *RTMPPushSource) Metrics() StreamMetrics {
+	return s.counters.snapshot()
+}
@@ -0,0 +1,437 @@
+package ingestion
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// startRTMPListener serves a listener on a loopback port until the test
+// ends and returns it with its address.
+func startRTMPListener(t *testing.T) (*RTMPListener, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	listener, err := NewRTMPListener(RTMPListenerConfig{Addr: ln.Addr().String(), ReadTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewRTMPListener: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- listener.Serve(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return listener, ln.Addr().String()
+}
+
+func amfString(value string) []byte {
+	return append([]byte{0x02, byte(len(value) >> 8), byte(len(value))}, value...)
+}
+
+func amfNumber(value float64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{0x00}, math.Float64bits(value))
+}
+
+// amfStringObject encodes an object of string properties, given as name
+// and value pairs.
+func amfStringObject(pairs ...string) []byte {
+	object := []byte{0x03}
+	for i := 0; i < len(pairs); i += 2 {
+		name := amfString(pairs[i])[1:]
+		object = append(append(object, name...), amfString(pairs[i+1])...)
+	}
+	return append(object, 0x00, 0x00, 0x09)
+}
+
+// writeRTMPMessage writes a message on chunk stream id as encoders do: a
+// chunk with a full header, then continuation chunks of chunkSize.
+func writeRTMPMessage(t *testing.T, conn net.Conn, id, typeID byte, streamID, timestamp uint32, payload []byte, chunkSize int) {
+	t.Helper()
+	out := []byte{id, byte(timestamp >> 16), byte(timestamp >> 8), byte(timestamp),
+		byte(len(payload) >> 16), byte(len(payload) >> 8), byte(len(payload)), typeID}
+	out = binary.LittleEndian.AppendUint32(out, streamID)
+	for {
+		size := min(chunkSize, len(payload))
+		out, payload = append(out, payload[:size]...), payload[size:]
+		if len(payload) == 0 {
+			break
+		}
+		out = append(out, 0xc0|id)
+	}
+	if _, err := conn.Write(out); err != nil {
+		t.Fatalf("write message: %v", err)
+	}
+}
+
+// readRTMPCommand reads the server's messages until a command, and returns
+// its values.
+func readRTMPCommand(t *testing.T, rc *rtmpConn) []any {
+	t.Helper()
+	for {
+		message, err := rc.readMessage()
+		if err != nil {
+			t.Fatalf("read server message: %v", err)
+		}
+		if message.typeID != rtmpCommandAMF0 {
+			continue
+		}
+		values, err := decodeAMF0(message.payload)
+		if err != nil {
+			t.Fatalf("decode command: %v", err)
+		}
+		return values
+	}
+}
+
+// publishRTMP connects to addr as an encoder publishing name to app, and
+// returns the connection with the code of the server's onStatus reply.
+func publishRTMP(t *testing.T, addr, app, name string) (net.Conn, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	c1 := make([]byte, 1536)
+	copy(c1[8:], bytes.Repeat([]byte("c1"), 764))
+	if _, err := conn.Write(append([]byte{0x03}, c1...)); err != nil {
+		t.Fatalf("write C0 and C1: %v", err)
+	}
+	s0s1s2 := make([]byte, 1+2*1536)
+	if _, err := io.ReadFull(conn, s0s1s2); err != nil {
+		t.Fatalf("read S0, S1, and S2: %v", err)
+	}
+	if s0s1s2[0] != 0x03 || !bytes.Equal(s0s1s2[1+1536+8:], c1[8:]) {
+		t.Fatalf("expected S0 of version 3 and S2 echoing C1")
+	}
+	if _, err := conn.Write(s0s1s2[1 : 1+1536]); err != nil {
+		t.Fatalf("write C2: %v", err)
+	}
+
+	connect := append(append(amfString("connect"), amfNumber(1)...),
+		amfStringObject("app", app, "type", "nonprivate", "flashVer", "FMLE/3.0 (compatible; FMSc/1.0)", "tcUrl", "rtmp://127.0.0.1/"+app)...)
+	writeRTMPMessage(t, conn, 3, 0x14, 0, 0, connect, 128)
+	// Window Acknowledgement Size of 2500000, as the first reply.
+	reply := make([]byte, 16)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("read window acknowledgement size: %v", err)
+	}
+	if want := []byte{0x02, 0, 0, 0, 0, 0, 4, 0x05, 0, 0, 0, 0, 0x00, 0x26, 0x25, 0xa0}; !bytes.Equal(reply, want) {
+		t.Fatalf("unexpected first reply % x", reply)
+	}
+	rc := newRTMPConn(conn)
+	if values := readRTMPCommand(t, rc); values[0] != "_result" || values[3].(map[string]any)["code"] != "NetConnection.Connect.Success" {
+		t.Fatalf("unexpected connect reply %v", values)
+	}
+
+	writeRTMPMessage(t, conn, 3, 0x14, 0, 0, append(append(amfString("releaseStream"), amfNumber(2)...), append([]byte{0x05}, amfString(name)...)...), 128)
+	writeRTMPMessage(t, conn, 3, 0x14, 0, 0, append(append(amfString("createStream"), amfNumber(3)...), 0x05), 128)
+	values := readRTMPCommand(t, rc)
+	if values[0] != "_result" || values[1] != 3.0 || values[3] != 1.0 {
+		t.Fatalf("unexpected createStream reply %v", values)
+	}
+	publish := append(append(append(amfString("publish"), amfNumber(4)...), 0x05), append(amfString(name+"?token=x"), amfString("live")...)...)
+	writeRTMPMessage(t, conn, 8, 0x14, 1, 0, publish, 128)
+	values = readRTMPCommand(t, rc)
+	if values[0] != "onStatus" {
+		t.Fatalf("unexpected publish reply %v", values)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, values[3].(map[string]any)["code"].(string)
+}
+
+func receiveChunk(t *testing.T, chunks <-chan MediaChunk) MediaChunk {
+	t.Helper()
+	select {
+	case chunk := <-chunks:
+		return chunk
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a chunk")
+		return MediaChunk{}
+	}
+}
+
+func TestRTMPListenerRemuxesPublishesIntoFLV(t *testing.T) {
+	listener, addr := startRTMPListener(t)
+	source, err := listener.Source(RTMPPushConfig{StreamKey: "/live/alpha", BufferSize: 16})
+	if err != nil {
+		t.Fatalf("Source: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chunks, _ := source.Stream(ctx)
+
+	conn, code := publishRTMP(t, addr, "live", "alpha")
+	defer conn.Close()
+	if code != "NetStream.Publish.Start" {
+		t.Fatalf("expected the publish to start, got %s", code)
+	}
+
+	metadata := append(append(amfString("@setDataFrame"), amfString("onMetaData")...), amfStringObject("encoder", "obs")...)
+	writeRTMPMessage(t, conn, 4, 0x12, 1, 0, metadata, 128)
+	video := bytes.Repeat([]byte{0x17}, 300)
+	var stream []byte
+	// Set Chunk Size of 256.
+	stream = append(stream, 0x02, 0, 0, 0, 0, 0, 4, 0x01, 0, 0, 0, 0, 0, 0, 0x01, 0x00)
+	// Audio on chunk stream 4: a full header at 0ms, a type 2 header with a
+	// delta of 23ms, and a type 3 header repeating the delta.
+	stream = append(stream, 0x04, 0, 0, 0, 0, 0, 2, 0x08, 1, 0, 0, 0, 0xaf, 0x01)
+	stream = append(stream, 0x84, 0, 0, 23, 0xaf, 0x02)
+	stream = append(stream, 0xc4, 0xaf, 0x03)
+	// Video on chunk stream 6 spanning two chunks of 256 bytes, then a type
+	// 1 header with a delta of 33ms.
+	stream = append(stream, 0x06, 0, 0, 40, 0, 0x01, 0x2c, 0x09, 1, 0, 0, 0)
+	stream = append(append(append(stream, video[:256]...), 0xc6), video[256:]...)
+	stream = append(stream, 0x46, 0, 0, 33, 0, 0, 2, 0x09, 0x27, 0x01)
+	if _, err := conn.Write(stream); err != nil {
+		t.Fatalf("write stream: %v", err)
+	}
+
+	header := receiveChunk(t, chunks)
+	if !bytes.Equal(header.Payload, flvHeader) || header.Metadata["initialization"] != "true" || header.Metadata["path"] != "/live/alpha" {
+		t.Fatalf("expected the FLV header first, got % x with %v", header.Payload, header.Metadata)
+	}
+	for _, want := range []struct {
+		typeID    byte
+		timestamp string
+		data      []byte
+	}{
+		{0x12, "0", append(amfString("onMetaData"), amfStringObject("encoder", "obs")...)},
+		{0x08, "0", []byte{0xaf, 0x01}},
+		{0x08, "23", []byte{0xaf, 0x02}},
+		{0x08, "46", []byte{0xaf, 0x03}},
+		{0x09, "40", video},
+		{0x09, "73", []byte{0x27, 0x01}},
+	} {
+		chunk := receiveChunk(t, chunks)
+		tag := chunk.Payload
+		if len(tag) < 15 || tag[0] != want.typeID || !bytes.Equal(tag[11:len(tag)-4], want.data) || chunk.Metadata["rtmpTimestamp"] != want.timestamp {
+			t.Fatalf("expected a tag of type %d at %sms holding % x, got % x with %v", want.typeID, want.timestamp, want.data, tag, chunk.Metadata)
+		}
+		if size := binary.BigEndian.Uint32(tag[len(tag)-4:]); int(size) != len(tag)-4 {
+			t.Fatalf("expected the tag size %d to follow it, got %d", len(tag)-4, size)
+		}
+	}
+
+	cancel()
+	for range chunks {
+	}
+	if metrics := source.Metrics(); metrics.ReceivedChunks != 7 {
+		t.Fatalf("expected 7 received chunks, got %+v", metrics)
+	}
+}
+
+func TestRTMPListenerRefusesUnknownStreamKeys(t *testing.T) {
+	listener, addr := startRTMPListener(t)
+	source, err := listener.Source(RTMPPushConfig{StreamKey: "live/alpha"})
+	if err != nil {
+		t.Fatalf("Source: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	source.Stream(ctx)
+
+	conn, code := publishRTMP(t, addr, "live", "other")
+	defer conn.Close()
+	if code != "NetStream.Publish.BadName" {
+		t.Fatalf("expected the publish to be refused, got %s", code)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected the refused publisher to be disconnected, got %v", err)
+	}
+}
+
+func TestRTMPListenerEndsPublishesOnDeleteStream(t *testing.T) {
+	listener, addr := startRTMPListener(t)
+	source, err := listener.Source(RTMPPushConfig{StreamKey: "live/alpha"})
+	if err != nil {
+		t.Fatalf("Source: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+
+	conn, _ := publishRTMP(t, addr, "live", "alpha")
+	defer conn.Close()
+	receiveChunk(t, chunks)
+	writeRTMPMessage(t, conn, 3, 0x14, 0, 0, append(append(append(amfString("deleteStream"), amfNumber(5)...), 0x05), amfNumber(1)...), 128)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected the publisher to be disconnected, got %v", err)
+	}
+	select {
+	case err := <-errs:
+		t.Fatalf("expected a clean end of the publish, got %v", err)
+	default:
+	}
+}
+
+func TestRTMPListenerCountsRepublishesAsReconnects(t *testing.T) {
+	listener, addr := startRTMPListener(t)
+	source, err := listener.Source(RTMPPushConfig{StreamKey: "live/alpha"})
+	if err != nil {
+		t.Fatalf("Source: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chunks, _ := source.Stream(ctx)
+
+	first, _ := publishRTMP(t, addr, "live", "alpha")
+	receiveChunk(t, chunks)
+	first.Close()
+
+	// The first publisher is released once the listener sees it close.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		second, code := publishRTMP(t, addr, "live", "alpha")
+		second.Close()
+		if code == "NetStream.Publish.Start" {
+			if chunk := receiveChunk(t, chunks); chunk.Metadata["initialization"] != "true" {
+				t.Fatalf("expected the republish to start with an FLV header, got %v", chunk.Metadata)
+			}
+			if metrics := source.Metrics(); metrics.ReconnectCount != 1 {
+				t.Fatalf("expected 1 reconnect, got %+v", metrics)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("republish was never accepted")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRTMPPushSourceRejectsBoundStreamKeys(t *testing.T) {
+	listener, _ := startRTMPListener(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first, _ := listener.Source(RTMPPushConfig{StreamKey: "live/alpha"})
+	first.Stream(ctx)
+
+	second, _ := listener.Source(RTMPPushConfig{StreamKey: "live/alpha"})
+	_, errs := second.Stream(ctx)
+	if err := <-errs; !errors.Is(err, statuspkg.ErrFatal) {
+		t.Fatalf("expected a fatal error for a bound stream key, got %v", err)
+	}
+}
+
+func TestRTMPPushSourceWithoutListenerFails(t *testing.T) {
+	var listener *RTMPListener
+	source, err := listener.Source(RTMPPushConfig{StreamKey: "live/alpha"})
+	if err != nil {
+		t.Fatalf("Source: %v", err)
+	}
+	_, errs := source.Stream(context.Background())
+	if err := <-errs; !errors.Is(err, statuspkg.ErrFatal) {
+		t.Fatalf("expected a fatal error without a listener, got %v", err)
+	}
+}
+
+func TestDecodeAMF0RejectsTruncatedValues(t *testing.T) {
+	values, err := decodeAMF0(append(amfString("connect"), amfStringObject("app", "live")...))
+	if err != nil || len(values) != 2 || values[1].(map[string]any)["app"] != "live" {
+		t.Fatalf("expected a name and an object, got %v (%v)", values, err)
+	}
+	for _, data := range [][]byte{{0x02, 0, 5, 'a'}, {0x00, 0, 0}, {0x03, 0, 1, 'a'}, {0x0d}} {
+		if _, err := decodeAMF0(data); err == nil {
+			t.Fatalf("expected % x to be rejected, got %v", data, err)
+		}
+	}
+}
+
+func TestRTMPConnBoundsPeerInput(t *testing.T) {
+	// chunk returns a chunk of format 0 on chunk stream id announcing a
+	// message of length bytes, carrying payload.
+	chunk := func(id byte, length int, typeID byte, payload []byte) []byte {
+		out := []byte{id, 0, 0, 0, byte(length >> 16), byte(length >> 8), byte(length), typeID, 0, 0, 0, 0}
+		return append(out, payload...)
+	}
+	read := func(data []byte) error {
+		rc := newRTMPConn(bytes.NewBuffer(data))
+		for {
+			if _, err := rc.readMessage(); err != nil {
+				return err
+			}
+		}
+	}
+
+	largest := chunk(2, 4, rtmpSetChunkSize, binary.BigEndian.AppendUint32(nil, rtmpMaxChunkSize))
+	if err := read(largest); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected the largest chunk size to be accepted, got %v", err)
+	}
+	huge := chunk(2, 4, rtmpSetChunkSize, binary.BigEndian.AppendUint32(nil, 0x7fffffff))
+	if err := read(huge); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("expected a chunk size of 0x7fffffff to be rejected, got %v", err)
+	}
+	if err := read(chunk(3, rtmpMaxMessageSize+1, rtmpVideo, nil)); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("expected an oversized message to be rejected, got %v", err)
+	}
+	// A format 1 header shrinking the message after its first chunk.
+	shrinking := append(chunk(3, 200, rtmpVideo, make([]byte, 128)), 0x43, 0, 0, 0, 0, 0, 10, rtmpVideo)
+	if err := read(shrinking); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("expected a length change mid-message to be rejected, got %v", err)
+	}
+	// Chunk streams 64 and up, in the two-byte form of the basic header.
+	var streams []byte
+	for id := range rtmpMaxChunkStreams + 1 {
+		streams = append(streams, 0)
+		streams = append(streams, chunk(byte(id), 1, rtmpVideo, []byte{0})...)
+	}
+	if err := read(streams); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("expected too many chunk streams to be rejected, got %v", err)
+	}
+}
+
+func TestRTMPListenerBoundsHandshakes(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	listener, err := NewRTMPListener(RTMPListenerConfig{Addr: ln.Addr().String(), MaxHandshakes: 1})
+	if err != nil {
+		t.Fatalf("NewRTMPListener: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = listener.Serve(ctx, ln) }()
+
+	idle, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer idle.Close()
+	// Wait for the idle connection to take the only handshake slot.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(listener.handshakes) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle connection was not accepted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected a connection beyond the handshake limit to be closed, got %v", err)
+	}
+}
@@ -0,0 +1,530 @@
+package ingestion
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// RTMP message types (RTMP specification 1.0, sections 5.4 and 7.1).
+const (
+	rtmpSetChunkSize     = 1
+	rtmpAbort            = 2
+	rtmpAcknowledgement  = 3
+	rtmpUserControl      = 4
+	rtmpWindowAckSize    = 5
+	rtmpSetPeerBandwidth = 6
+	rtmpAudio            = 8
+	rtmpVideo            = 9
+	rtmpDataAMF3         = 15
+	rtmpCommandAMF3      = 17
+	rtmpDataAMF0         = 18
+	rtmpCommandAMF0      = 20
+)
+
+const (
+	// rtmpVersion is the protocol version of the handshake's C0 and S0.
+	rtmpVersion = 3
+	// rtmpHandshakeSize is the size of C1, S1, C2, and S2.
+	rtmpHandshakeSize = 1536
+	// rtmpDefaultChunkSize is the chunk size of both directions until a
+	// Set Chunk Size message changes it.
+	rtmpDefaultChunkSize = 128
+	// rtmpServerChunkSize is the chunk size of the messages the listener
+	// sends, and rtmpWindowSize the window it asks publishers to
+	// acknowledge.
+	rtmpServerChunkSize = 4096
+	rtmpWindowSize      = 2500000
+	// rtmpExtendedTimestamp marks a timestamp carried in the four bytes
+	// following the message header.
+	rtmpExtendedTimestamp = 0xffffff
+	// rtmpMaxChunkSize bounds the chunk size a peer may set, and
+	// rtmpMaxMessageSize the messages it may send, which are at most a
+	// video keyframe.
+	rtmpMaxChunkSize   = 64 << 10
+	rtmpMaxMessageSize = 4 << 20
+	// rtmpMaxChunkStreams bounds the chunk streams of a connection.
+	// Encoders use a handful.
+	rtmpMaxChunkStreams = 64
+)
+
+// rtmpMessage is a message reassembled from its chunks.
+type rtmpMessage struct {
+	typeID    byte
+	streamID  uint32
+	timestamp uint32
+	payload   []byte
+}
+
+// rtmpChunkStream is the state a chunk stream carries from one chunk to
+// the next, which later chunk headers leave out.
+type rtmpChunkStream struct {
+	timestamp uint32
+	delta     uint32
+	length    uint32
+	typeID    byte
+	streamID  uint32
+	extended  bool
+	payload   []byte
+}
+
+// rtmpConn reads the messages of a peer and writes messages to it, over
+// the chunk streams of an RTMP connection.
+type rtmpConn struct {
+	reader *bufio.Reader
+	writer io.Writer
+
+	readChunkSize  uint32
+	writeChunkSize uint32
+	streams        map[uint32]*rtmpChunkStream
+
+	// received counts the bytes read, which are acknowledged whenever
+	// ackWindow more have arrived since acknowledged.
+	received, acknowledged, ackWindow uint32
+}
+
+func newRTMPConn(rw io.ReadWriter) *rtmpConn {
+	return &rtmpConn{
+		reader:         bufio.NewReader(rw),
+		writer:         rw,
+		readChunkSize:  rtmpDefaultChunkSize,
+		writeChunkSize: rtmpDefaultChunkSize,
+		streams:        make(map[uint32]*rtmpChunkStream),
+	}
+}
+
+// serverHandshake answers the client's simple handshake: it reads C0 and
+// C1, sends S0, S1, and S2 echoing C1, and reads C2.
+func (c *rtmpConn) serverHandshake() error {
+	c0c1 := make([]byte, 1+rtmpHandshakeSize)
+	if err := c.readFull(c0c1); err != nil {
+		return fmt.Errorf("rtmp handshake receive: %w", err)
+	}
+	if c0c1[0] != rtmpVersion {
+		return fmt.Errorf("unsupported rtmp version %d", c0c1[0])
+	}
+	s0s1s2 := make([]byte, 1+2*rtmpHandshakeSize)
+	s0s1s2[0] = rtmpVersion
+	s1 := s0s1s2[1 : 1+rtmpHandshakeSize]
+	if _, err := rand.Read(s1[8:]); err != nil {
+		return fmt.Errorf("rtmp handshake: %w", err)
+	}
+	s2 := s0s1s2[1+rtmpHandshakeSize:]
+	copy(s2, c0c1[1:])
+	binary.BigEndian.PutUint32(s2[4:], uint32(time.Now().UnixMilli()))
+	if _, err := c.writer.Write(s0s1s2); err != nil {
+		return fmt.Errorf("rtmp handshake send: %w", err)
+	}
+	if err := c.readFull(make([]byte, rtmpHandshakeSize)); err != nil {
+		return fmt.Errorf("rtmp handshake receive: %w", err)
+	}
+	return nil
+}
+
+// readMessage returns the next complete message on any chunk stream. The
+// protocol control messages that configure the connection are applied and
+// returned as well.
+func (c *rtmpConn) readMessage() (rtmpMessage, error) {
+	for {
+		message, ok, err := c.readChunk()
+		if err != nil {
+			return rtmpMessage{}, err
+		}
+		if err := c.acknowledge(); err != nil {
+			return rtmpMessage{}, err
+		}
+		if !ok {
+			continue
+		}
+		switch message.typeID {
+		case rtmpSetChunkSize:
+			if len(message.payload) < 4 {
+				return rtmpMessage{}, errors.New("short rtmp set chunk size")
+			}
+			size := binary.BigEndian.Uint32(message.payload) & 0x7fffffff
+			if size == 0 || size > rtmpMaxChunkSize {
+				return rtmpMessage{}, fmt.Errorf("rtmp chunk size of %d outside 1-%d", size, rtmpMaxChunkSize)
+			}
+			c.readChunkSize = size
+		case rtmpAbort:
+			if len(message.payload) >= 4 {
+				if stream := c.streams[binary.BigEndian.Uint32(message.payload)]; stream != nil {
+					stream.payload = nil
+				}
+			}
+		case rtmpWindowAckSize:
+			if len(message.payload) >= 4 {
+				c.ackWindow = binary.BigEndian.Uint32(message.payload)
+			}
+		}
+		return message, nil
+	}
+}
+
+// readChunk reads a chunk and reports the message it completes, if any.
+func (c *rtmpConn) readChunk() (rtmpMessage, bool, error) {
+	first, err := c.readByte()
+	if err != nil {
+		return rtmpMessage{}, false, err
+	}
+	format, id := first>>6, uint32(first&0x3f)
+	switch id {
+	case 0:
+		b, err := c.readByte()
+		if err != nil {
+			return rtmpMessage{}, false, err
+		}
+		id = 64 + uint32(b)
+	case 1:
+		b := make([]byte, 2)
+		if err := c.readFull(b); err != nil {
+			return rtmpMessage{}, false, err
+		}
+		id = 64 + uint32(b[0]) + uint32(b[1])<<8
+	}
+
+	stream := c.streams[id]
+	if stream == nil {
+		if format != 0 {
+			return rtmpMessage{}, false, fmt.Errorf("rtmp chunk stream %d starts without a full header", id)
+		}
+		if len(c.streams) >= rtmpMaxChunkStreams {
+			return rtmpMessage{}, false, fmt.Errorf("rtmp connection exceeds %d chunk streams", rtmpMaxChunkStreams)
+		}
+		stream = &rtmpChunkStream{}
+		c.streams[id] = stream
+	}
+	starting := len(stream.payload) == 0
+
+	header := make([]byte, [4]int{11, 7, 3, 0}[format])
+	if err := c.readFull(header); err != nil {
+		return rtmpMessage{}, false, err
+	}
+	var timestamp uint32
+	if format < 3 {
+		timestamp = uint24(header)
+		stream.extended = timestamp == rtmpExtendedTimestamp
+	}
+	if format < 2 {
+		length := uint24(header[3:])
+		switch {
+		case length > rtmpMaxMessageSize:
+			return rtmpMessage{}, false, fmt.Errorf("rtmp message of %d bytes exceeds %d", length, rtmpMaxMessageSize)
+		case !starting && length != stream.length:
+			return rtmpMessage{}, false, fmt.Errorf("rtmp chunk stream %d changes its message length mid-message", id)
+		}
+		stream.length = length
+		stream.typeID = header[6]
+	}
+	if format == 0 {
+		stream.streamID = binary.LittleEndian.Uint32(header[7:])
+	}
+	if stream.extended {
+		extended := make([]byte, 4)
+		if err := c.readFull(extended); err != nil {
+			return rtmpMessage{}, false, err
+		}
+		if format < 3 {
+			timestamp = binary.BigEndian.Uint32(extended)
+		}
+	}
+	switch {
+	case format == 0:
+		stream.timestamp, stream.delta = timestamp, 0
+	case format < 3:
+		stream.delta = timestamp
+		stream.timestamp += timestamp
+	case starting:
+		// A new message under the previous header advances by its delta.
+		stream.timestamp += stream.delta
+	}
+
+	// The payload grows with the chunks that arrive, rather than by the
+	// length the header claims.
+	size := min(c.readChunkSize, stream.length-uint32(len(stream.payload)))
+	data := make([]byte, size)
+	if err := c.readFull(data); err != nil {
+		return rtmpMessage{}, false, err
+	}
+	stream.payload = append(stream.payload, data...)
+	if uint32(len(stream.payload)) < stream.length {
+		return rtmpMessage{}, false, nil
+	}
+	message := rtmpMessage{typeID: stream.typeID, streamID: stream.streamID, timestamp: stream.timestamp, payload: stream.payload}
+	stream.payload = nil
+	return message, true, nil
+}
+
+// acknowledge sends an Acknowledgement once the peer's window has been
+// received since the last.
+func (c *rtmpConn) acknowledge() error {
+	if c.ackWindow == 0 || c.received-c.acknowledged < c.ackWindow {
+		return nil
+	}
+	c.acknowledged = c.received
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, c.received)
+	return c.writeMessage(2, rtmpMessage{typeID: rtmpAcknowledgement, payload: payload})
+}
+
+func (c *rtmpConn) readByte() (byte, error) {
+	b, err := c.reader.ReadByte()
+	if err == nil {
+		c.received++
+	}
+	return b, err
+}
+
+func (c *rtmpConn) readFull(buf []byte) error {
+	n, err := io.ReadFull(c.reader, buf)
+	c.received += uint32(n)
+	return err
+}
+
+// writeMessage writes message on chunk stream id, split into chunks of the
+// connection's chunk size.
+func (c *rtmpConn) writeMessage(id byte, message rtmpMessage) error {
+	header := make([]byte, 12)
+	header[0] = id
+	putUint24(header[1:], min(message.timestamp, rtmpExtendedTimestamp-1))
+	putUint24(header[4:], uint32(len(message.payload)))
+	header[7] = message.typeID
+	binary.LittleEndian.PutUint32(header[8:], message.streamID)
+
+	out := header
+	payload := message.payload
+	for {
+		size := min(int(c.writeChunkSize), len(payload))
+		out = append(out, payload[:size]...)
+		payload = payload[size:]
+		if len(payload) == 0 {
+			break
+		}
+		out = append(out, 0xc0|id)
+	}
+	_, err := c.writer.Write(out)
+	return err
+}
+
+// writeControl writes a protocol control message with a 32-bit value, and
+// applies a chunk size it sets to the messages written after it.
+func (c *rtmpConn) writeControl(typeID byte, value uint32, extra ...byte) error {
+	payload := binary.BigEndian.AppendUint32(nil, value)
+	if err := c.writeMessage(2, rtmpMessage{typeID: typeID, payload: append(payload, extra...)}); err != nil {
+		return err
+	}
+	if typeID == rtmpSetChunkSize {
+		c.writeChunkSize = value
+	}
+	return nil
+}
+
+// writeCommand writes an AMF0 command on message stream streamID.
+func (c *rtmpConn) writeCommand(streamID uint32, values ...any) error {
+	payload, err := encodeAMF0(values...)
+	if err != nil {
+		return err
+	}
+	return c.writeMessage(3, rtmpMessage{typeID: rtmpCommandAMF0, streamID: streamID, payload: payload})
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+}
+
+// AMF0 type markers (AMF0 specification, section 2.1).
+const (
+	amf0Number      = 0x00
+	amf0Boolean     = 0x01
+	amf0String      = 0x02
+	amf0Object      = 0x03
+	amf0Null        = 0x05
+	amf0Undefined   = 0x06
+	amf0ECMAArray   = 0x08
+	amf0ObjectEnd   = 0x09
+	amf0StrictArray = 0x0a
+	amf0Date        = 0x0b
+	amf0LongString  = 0x0c
+)
+
+// amfObject is an AMF0 object whose properties are written in order.
+type amfObject []amfProperty
+
+type amfProperty struct {
+	name  string
+	value any
+}
+
+// encodeAMF0 encodes values, which are float64, int, bool, string, nil, or
+// amfObject.
+func encodeAMF0(values ...any) ([]byte, error) {
+	var out []byte
+	for _, value := range values {
+		var err error
+		if out, err = appendAMF0(out, value); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func appendAMF0(out []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(out, amf0Null), nil
+	case float64:
+		return binary.BigEndian.AppendUint64(append(out, amf0Number), math.Float64bits(v)), nil
+	case int:
+		return appendAMF0(out, float64(v))
+	case bool:
+		b := byte(0)
+		if v {
+			b = 1
+		}
+		return append(out, amf0Boolean, b), nil
+	case string:
+		if len(v) > math.MaxUint16 {
+			return binary.BigEndian.AppendUint32(append(out, amf0LongString), uint32(len(v))), nil
+		}
+		return appendAMF0Name(append(out, amf0String), v), nil
+	case amfObject:
+		out = append(out, amf0Object)
+		for _, property := range v {
+			var err error
+			if out, err = appendAMF0(appendAMF0Name(out, property.name), property.value); err != nil {
+				return nil, err
+			}
+		}
+		return append(out, 0, 0, amf0ObjectEnd), nil
+	default:
+		return nil, fmt.Errorf("cannot encode %T as AMF0", value)
+	}
+}
+
+func appendAMF0Name(out []byte, name string) []byte {
+	return append(binary.BigEndian.AppendUint16(out, uint16(len(name))), name...)
+}
+
+// decodeAMF0 decodes the values of data: numbers as float64, booleans,
+// strings, null and undefined as nil, objects and ECMA arrays as
+// map[string]any, and strict arrays as []any. Dates decode as their
+// milliseconds since the epoch.
+func decodeAMF0(data []byte) ([]any, error) {
+	var values []any
+	for len(data) > 0 {
+		value, rest, err := decodeAMF0Value(data)
+		if err != nil {
+			return nil, err
+		}
+		values, data = append(values, value), rest
+	}
+	return values, nil
+}
+
+var errShortAMF0 = errors.New("truncated AMF0 value")
+
+func decodeAMF0Value(data []byte) (any, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errShortAMF0
+	}
+	marker, data := data[0], data[1:]
+	switch marker {
+	case amf0Number, amf0Date:
+		size := 8
+		if marker == amf0Date {
+			size = 10
+		}
+		if len(data) < size {
+			return nil, nil, errShortAMF0
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[size:], nil
+	case amf0Boolean:
+		if len(data) < 1 {
+			return nil, nil, errShortAMF0
+		}
+		return data[0] != 0, data[1:], nil
+	case amf0String:
+		return decodeAMF0String(data)
+	case amf0LongString:
+		if len(data) < 4 || uint64(len(data)-4) < uint64(binary.BigEndian.Uint32(data)) {
+			return nil, nil, errShortAMF0
+		}
+		end := 4 + int(binary.BigEndian.Uint32(data))
+		return string(data[4:end]), data[end:], nil
+	case amf0Null, amf0Undefined:
+		return nil, data, nil
+	case amf0Object, amf0ECMAArray:
+		if marker == amf0ECMAArray {
+			if len(data) < 4 {
+				return nil, nil, errShortAMF0
+			}
+			// The count is a hint; the properties end like an object's.
+			data = data[4:]
+		}
+		object := make(map[string]any)
+		for {
+			if len(data) >= 3 && data[0] == 0 && data[1] == 0 && data[2] == amf0ObjectEnd {
+				return object, data[3:], nil
+			}
+			name, rest, err := decodeAMF0String(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			value, rest, err := decodeAMF0Value(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			object[name], data = value, rest
+		}
+	case amf0StrictArray:
+		if len(data) < 4 {
+			return nil, nil, errShortAMF0
+		}
+		count := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		var array []any
+		for i := uint32(0); i < count; i++ {
+			value, rest, err := decodeAMF0Value(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			array, data = append(array, value), rest
+		}
+		return array, data, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported AMF0 marker 0x%02x", marker)
+	}
+}
+
+func decodeAMF0String(data []byte) (string, []byte, error) {
+	if len(data) < 2 || len(data)-2 < int(binary.BigEndian.Uint16(data)) {
+		return "", nil, errShortAMF0
+	}
+	end := 2 + int(binary.BigEndian.Uint16(data))
+	return string(data[2:end]), data[end:], nil
+}
+
+// flvHeader starts an FLV stream with audio and video, followed by the
+// size of the tag before the first, which is none.
+var flvHeader = []byte{'F', 'L', 'V', 1, 0x05, 0, 0, 0, 9, 0, 0, 0, 0}
+
+// flvTag returns message, an audio, video, or script data message, as an
+// FLV tag followed by its size.
+func flvTag(message rtmpMessage) []byte {
+	tag := make([]byte, 11, 11+len(message.payload)+4)
+	tag[0] = message.typeID
+	putUint24(tag[1:], uint32(len(message.payload)))
+	putUint24(tag[4:], message.timestamp)
+	tag[7] = byte(message.timestamp >> 24)
+	tag = append(tag, message.payload...)
+	return binary.BigEndian.AppendUint32(tag, uint32(len(tag)))
+}
@@ -0,0 +1,689 @@
+package ingestion
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// maxRTSPBodySize bounds the body of an RTSP reply, which is at most a
+// session description.
+const maxRTSPBodySize = 64 << 10
+
+// RTSPConfig configures the RTSP stream source.
+type RTSPConfig struct {
+	URL            string
+	Dialer         *net.Dialer
+	BufferSize     int
+	ReconnectDelay time.Duration
+	ReadTimeout    time.Duration
+	// KeepAliveInterval is how often the session is refreshed while playing.
+	// It defaults to half the session timeout the server announces.
+	KeepAliveInterval time.Duration
+	// Backpressure selects what happens to packets while the consumer is
+	// behind. By default they are dropped.
+	Backpressure Backpressure
+}
+
+// NewRTSPStreamSource constructs an RTSP adapter emitting MediaChunks.
+func NewRTSPStreamSource(cfg RTSPConfig) (*RTSPStreamSource, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("rtsp url is required")
+	}
+	parsed, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rtsp url: %w", err)
+	}
+	if parsed.Scheme != "rtsp" {
+		return nil, fmt.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+	if cfg.Dialer == nil {
+		cfg.Dialer = &net.Dialer{Timeout: 5 * time.Second}
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 8
+	}
+	if cfg.ReconnectDelay <= 0 {
+		cfg.ReconnectDelay = 500 * time.Millisecond
+	}
+	if cfg.ReadTimeout <= 0 {
+		cfg.ReadTimeout = 5 * time.Second
+	}
+
+	// Credentials travel in Authorization headers, never in request URIs.
+	user := parsed.User
+	stripped := *parsed
+	stripped.User = nil
+	return &RTSPStreamSource{
+		cfg:      cfg,
+		url:      &stripped,
+		user:     user,
+		counters: &streamCounters{},
+	}, nil
+}
+
+// RTSPStreamSource pulls the audio track of an RTSP presentation, such as an
+// IP camera or a legacy encoder. It negotiates RTP over the RTSP connection
+// itself (TCP-interleaved, RFC 2326 section 10.12), so no UDP ports need to
+// be reachable, and authenticates with Basic or Digest credentials taken
+// from the URL.
+//
+// The first chunk of every connection is the session description, marked
+// as initialization like the DASH source's initialization segments. Each
+// following chunk is the payload of one RTP packet, with the track's
+// encoding, clock rate, and the packet's RTP timestamp in its metadata.
+type RTSPStreamSource struct {
+	cfg      RTSPConfig
+	url      *url.URL
+	user     *url.Userinfo
+	counters *streamCounters
+}
+
+// Stream connects to the RTSP server, starts playback, and emits the audio
+// track's packets until ctx is cancelled, reconnecting when the connection
+// drops.
+func (s *RTSPStreamSource) Stream(ctx context.Context) (<-chan MediaChunk, <-chan error) {
+	chunks := make(chan MediaChunk, s.cfg.BufferSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(chunks)
+		defer close(errs)
+
+		emitter := newChunkEmitter(chunks, s.cfg.Backpressure, s.counters)
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			err := s.play(ctx, emitter)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				s.counters.errors.Add(1)
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+			select {
+			case <-time.After(s.cfg.ReconnectDelay):
+			case <-ctx.Done():
+				return
+			}
+			s.counters.reconnect.Add(1)
+		}
+	}()
+
+	return chunks, errs
+}
+
+// Metrics returns the RTSP counters.
+func (s *RTSPStreamSource) Metrics() StreamMetrics {
+	return s.counters.snapshot()
+}
+
+// Probe asks the server to describe the presentation and reports the
+// encoding and bandwidth of its audio track, without starting playback.
+func (s *RTSPStreamSource) Probe(ctx context.Context) (SourceProbe, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return SourceProbe{}, err
+	}
+	defer conn.conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.conn.Close() })
+	defer stop()
+
+	described, err := conn.request("DESCRIBE", s.url.String(), map[string]string{"Accept": "application/sdp"})
+	if err != nil {
+		return SourceProbe{}, err
+	}
+	description, err := parseSDP(described.body)
+	if err != nil {
+		return SourceProbe{}, statuspkg.Fatal(err)
+	}
+	track, ok := description.audioTrack()
+	if !ok {
+		return SourceProbe{}, statuspkg.Fatal(errors.New("rtsp presentation has no audio track"))
+	}
+	probe := SourceProbe{Container: "rtp", Bitrate: track.bitrate, Live: true}
+	if track.encoding != "" {
+		probe.Codecs = []string{track.encoding}
+	}
+	return probe, nil
+}
+
+// dial opens a connection to the server.
+func (s *RTSPStreamSource) dial(ctx context.Context) (*rtspConn, error) {
+	host := s.url.Host
+	if s.url.Port() == "" {
+		host = net.JoinHostPort(s.url.Hostname(), "554")
+	}
+	netConn, err := s.cfg.Dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, statuspkg.Transient(err)
+	}
+	return &rtspConn{
+		conn:        netConn,
+		reader:      bufio.NewReader(netConn),
+		user:        s.user,
+		readTimeout: s.cfg.ReadTimeout,
+	}, nil
+}
+
+// play runs one RTSP session on a fresh connection.
+func (s *RTSPStreamSource) play(ctx context.Context, emitter *chunkEmitter) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	netConn := conn.conn
+	stop := context.AfterFunc(ctx, func() {
+		conn.send("TEARDOWN", s.url.String(), nil)
+		netConn.Close()
+	})
+	defer func() {
+		if stop() {
+			netConn.Close()
+		}
+	}()
+
+	described, err := conn.request("DESCRIBE", s.url.String(), map[string]string{"Accept": "application/sdp"})
+	if err != nil {
+		return err
+	}
+	base := s.url.String()
+	if value := described.header.Get("Content-Base"); value != "" {
+		base = value
+	} else if value := described.header.Get("Content-Location"); value != "" {
+		base = value
+	}
+	description, err := parseSDP(described.body)
+	if err != nil {
+		return statuspkg.Fatal(err)
+	}
+	track, ok := description.audioTrack()
+	if !ok {
+		return statuspkg.Fatal(errors.New("rtsp presentation has no audio track"))
+	}
+	emitter.emit(ctx, MediaChunk{
+		Sequence:  s.counters.sequence.Add(1),
+		Timestamp: time.Now().UTC(),
+		Payload:   described.body,
+		Metadata: map[string]string{
+			"path":           s.url.Path,
+			"initialization": "true",
+			"contentType":    "application/sdp",
+		},
+	})
+
+	setup, err := conn.request("SETUP", resolveControl(base, track.control), map[string]string{
+		"Transport": "RTP/AVP/TCP;unicast;interleaved=0-1",
+	})
+	if err != nil {
+		return err
+	}
+	channel := interleavedChannel(setup.header.Get("Transport"))
+	session, timeout := parseSessionHeader(setup.header.Get("Session"))
+	if session == "" {
+		return statuspkg.Fatal(errors.New("rtsp SETUP response has no session"))
+	}
+	conn.session = session
+
+	playURL := base
+	if description.control != "" {
+		playURL = resolveControl(base, description.control)
+	}
+	if _, err := conn.request("PLAY", playURL, map[string]string{"Range": "npt=0.000-"}); err != nil {
+		return err
+	}
+
+	keepAlive := s.cfg.KeepAliveInterval
+	if keepAlive <= 0 {
+		keepAlive = timeout / 2
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// The response is read, and discarded, by the packet loop.
+				if err := conn.send("GET_PARAMETER", playURL, nil); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return s.consume(ctx, conn, channel, track, emitter)
+}
+
+// consume reads interleaved packets until the connection fails.
+func (s *RTSPStreamSource) consume(ctx context.Context, conn *rtspConn, channel byte, track sdpMedia, emitter *chunkEmitter) error {
+	var (
+		header   = make([]byte, 4)
+		previous uint16
+		started  bool
+	)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		_ = conn.conn.SetReadDeadline(time.Now().Add(conn.readTimeout))
+		marker, err := conn.reader.Peek(1)
+		if err != nil {
+			return statuspkg.Transient(fmt.Errorf("rtsp read: %w", err))
+		}
+		if marker[0] != '$' {
+			// Responses to keep-alives, or requests from the server; neither
+			// needs an answer.
+			if _, err := conn.readMessage(); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.ReadFull(conn.reader, header); err != nil {
+			return statuspkg.Transient(fmt.Errorf("rtsp read frame header: %w", err))
+		}
+		frame := make([]byte, binary.BigEndian.Uint16(header[2:]))
+		if _, err := io.ReadFull(conn.reader, frame); err != nil {
+			return statuspkg.Transient(fmt.Errorf("rtsp read frame: %w", err))
+		}
+		if header[1] != channel {
+			// RTCP, or another track's packets.
+			continue
+		}
+		packet, err := parseRTP(frame)
+		if err != nil {
+			s.counters.dropped.Add(1)
+			continue
+		}
+		if started {
+			if gap := packet.sequence - previous - 1; gap > 0 && gap < 0x8000 {
+				s.counters.dropped.Add(int64(gap))
+			}
+		}
+		previous, started = packet.sequence, true
+		if len(packet.payload) == 0 {
+			continue
+		}
+		emitter.emit(ctx, MediaChunk{
+			Sequence:  s.counters.sequence.Add(1),
+			Timestamp: time.Now().UTC(),
+			Payload:   packet.payload,
+			Metadata: map[string]string{
+				"path":         s.url.Path,
+				"encoding":     track.encoding,
+				"clockRate":    strconv.Itoa(track.clockRate),
+				"channels":     strconv.Itoa(track.channels),
+				"rtpTimestamp": strconv.FormatUint(uint64(packet.timestamp), 10),
+			},
+		})
+	}
+}
+
+// rtspConn is the control connection of one RTSP session.
+type rtspConn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	user        *url.Userinfo
+	readTimeout time.Duration
+
+	// mu serialises writes, which the keep-alive loop also makes.
+	mu        sync.Mutex
+	cseq      int
+	session   string
+	challenge map[string]string
+}
+
+type rtspResponse struct {
+	status int
+	reason string
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// request sends a request and waits for its response, authenticating once
+// if the server asks for credentials.
+func (c *rtspConn) request(method, uri string, headers map[string]string) (*rtspResponse, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.send(method, uri, headers); err != nil {
+			return nil, err
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+		resp, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		if resp.status == 401 && attempt == 0 && c.user != nil {
+			c.mu.Lock()
+			c.challenge = parseChallenge(resp.header.Values("WWW-Authenticate"))
+			c.mu.Unlock()
+			if c.challenge != nil {
+				continue
+			}
+		}
+		if resp.status < 200 || resp.status > 299 {
+			return nil, rtspStatusError(method, resp)
+		}
+		return resp, nil
+	}
+}
+
+// send writes a request without waiting for the response.
+func (c *rtspConn) send(method, uri string, headers map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cseq++
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s RTSP/1.0\r\nCSeq: %d\r\nUser-Agent: Streamlation\r\n", method, uri, c.cseq)
+	if c.session != "" {
+		fmt.Fprintf(&b, "Session: %s\r\n", c.session)
+	}
+	if authorization := c.authorization(method, uri); authorization != "" {
+		fmt.Fprintf(&b, "Authorization: %s\r\n", authorization)
+	}
+	for name, value := range headers {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	b.WriteString("\r\n")
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return statuspkg.Transient(fmt.Errorf("rtsp send %s: %w", method, err))
+	}
+	return nil
+}
+
+// readMessage reads a response, or a request from the server, which is
+// returned with status zero.
+func (c *rtspConn) readMessage() (*rtspResponse, error) {
+	reader := textproto.NewReader(c.reader)
+	line, err := reader.ReadLine()
+	if err != nil {
+		return nil, statuspkg.Transient(fmt.Errorf("rtsp read response: %w", err))
+	}
+	resp := &rtspResponse{}
+	if version, rest, ok := strings.Cut(line, " "); ok && strings.HasPrefix(version, "RTSP/") {
+		code, reason, _ := strings.Cut(rest, " ")
+		if resp.status, err = strconv.Atoi(code); err != nil {
+			return nil, statuspkg.Fatal(fmt.Errorf("malformed rtsp status line %q", line))
+		}
+		resp.reason = reason
+	}
+	if resp.header, err = reader.ReadMIMEHeader(); err != nil {
+		return nil, statuspkg.Transient(fmt.Errorf("rtsp read headers: %w", err))
+	}
+	if length := resp.header.Get("Content-Length"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 {
+			return nil, statuspkg.Fatal(fmt.Errorf("malformed rtsp Content-Length %q", length))
+		}
+		if n > maxRTSPBodySize {
+			return nil, statuspkg.Fatal(fmt.Errorf("rtsp reply body of %d bytes exceeds %d", n, maxRTSPBodySize))
+		}
+		resp.body = make([]byte, n)
+		if _, err := io.ReadFull(c.reader, resp.body); err != nil {
+			return nil, statuspkg.Transient(fmt.Errorf("rtsp read body: %w", err))
+		}
+	}
+	return resp, nil
+}
+
+func rtspStatusError(method string, resp *rtspResponse) error {
+	err := fmt.Errorf("rtsp %s returned %d %s", method, resp.status, resp.reason)
+	switch {
+	case resp.status >= 500, resp.status == 408, resp.status == 453:
+		// Server errors, timeouts, and "not enough bandwidth" pass.
+		return statuspkg.Transient(err)
+	case resp.status >= 400:
+		return statuspkg.Fatal(err)
+	default:
+		return err
+	}
+}
+
+// parseChallenge picks the strongest scheme among WWW-Authenticate values.
+func parseChallenge(values []string) map[string]string {
+	var basic map[string]string
+	for _, value := range values {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(value), " ")
+		challenge := map[string]string{"scheme": strings.ToLower(scheme)}
+		for _, param := range strings.Split(params, ",") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok {
+				challenge[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+		switch challenge["scheme"] {
+		case "digest":
+			return challenge
+		case "basic":
+			basic = challenge
+		}
+	}
+	return basic
+}
+
+// authorization answers the server's challenge. The caller must hold c.mu.
+func (c *rtspConn) authorization(method, uri string) string {
+	if c.challenge == nil || c.user == nil {
+		return ""
+	}
+	username := c.user.Username()
+	password, _ := c.user.Password()
+	if c.challenge["scheme"] == "basic" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+
+	hash := func(parts ...string) string {
+		sum := md5.Sum([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(sum[:])
+	}
+	realm, nonce := c.challenge["realm"], c.challenge["nonce"]
+	ha1, ha2 := hash(username, realm, password), hash(method, uri)
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`, username, realm, nonce, uri)
+	if qop := c.challenge["qop"]; strings.Contains(qop, "auth") {
+		nonceCount := fmt.Sprintf("%08x", c.cseq)
+		random := make([]byte, 8)
+		_, _ = rand.Read(random)
+		cnonce := hex.EncodeToString(random)
+		header += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s", response="%s"`, nonceCount, cnonce, hash(ha1, nonce, nonceCount, cnonce, "auth", ha2))
+	} else {
+		header += fmt.Sprintf(`, response="%s"`, hash(ha1, nonce, ha2))
+	}
+	if opaque := c.challenge["opaque"]; opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return header
+}
+
+// parseSessionHeader splits a Session header into the session identifier
+// and its timeout, which defaults to 60 seconds.
+func parseSessionHeader(value string) (string, time.Duration) {
+	id, params, _ := strings.Cut(value, ";")
+	timeout := 60 * time.Second
+	for _, param := range strings.Split(params, ";") {
+		if name, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.EqualFold(name, "timeout") {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				timeout = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return strings.TrimSpace(id), timeout
+}
+
+// interleavedChannel returns the RTP channel the server assigned in its
+// Transport header, which may differ from the one requested.
+func interleavedChannel(transport string) byte {
+	for _, param := range strings.Split(transport, ";") {
+		if name, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && name == "interleaved" {
+			first, _, _ := strings.Cut(value, "-")
+			if channel, err := strconv.ParseUint(first, 10, 8); err == nil {
+				return byte(channel)
+			}
+		}
+	}
+	return 0
+}
+
+// resolveControl resolves an SDP control attribute against the base URL of
+// the presentation.
+func resolveControl(base, control string) string {
+	switch {
+	case control == "" || control == "*":
+		return base
+	case strings.HasPrefix(control, "rtsp://"):
+		return control
+	case strings.HasSuffix(base, "/"):
+		return base + control
+	default:
+		return base + "/" + control
+	}
+}
+
+// sessionDescription is the part of an SDP the source needs.
+type sessionDescription struct {
+	control string
+	media   []sdpMedia
+}
+
+type sdpMedia struct {
+	kind        string
+	control     string
+	payloadType int
+	encoding    string
+	clockRate   int
+	channels    int
+	// bitrate is the track's b=AS bandwidth in bits per second.
+	bitrate int64
+}
+
+// staticPayloadTypes describes the RFC 3551 audio payload types servers may
+// use without an rtpmap attribute.
+var staticPayloadTypes = map[int]sdpMedia{
+	0:  {encoding: "PCMU", clockRate: 8000, channels: 1},
+	8:  {encoding: "PCMA", clockRate: 8000, channels: 1},
+	10: {encoding: "L16", clockRate: 44100, channels: 2},
+	11: {encoding: "L16", clockRate: 44100, channels: 1},
+	14: {encoding: "MPA", clockRate: 90000, channels: 1},
+}
+
+func parseSDP(body []byte) (sessionDescription, error) {
+	var (
+		description sessionDescription
+		current     *sdpMedia
+	)
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		kind, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch {
+		case kind == "m":
+			fields := strings.Fields(value)
+			if len(fields) < 4 {
+				return sessionDescription{}, fmt.Errorf("malformed sdp media line %q", line)
+			}
+			payloadType, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return sessionDescription{}, fmt.Errorf("malformed sdp media line %q", line)
+			}
+			media := staticPayloadTypes[payloadType]
+			media.kind, media.payloadType = fields[0], payloadType
+			description.media = append(description.media, media)
+			current = &description.media[len(description.media)-1]
+		case kind == "b" && strings.HasPrefix(value, "AS:") && current != nil:
+			if kbps, err := strconv.ParseInt(strings.TrimPrefix(value, "AS:"), 10, 64); err == nil {
+				current.bitrate = kbps * 1000
+			}
+		case kind == "a" && strings.HasPrefix(value, "control:"):
+			control := strings.TrimPrefix(value, "control:")
+			if current == nil {
+				description.control = control
+			} else {
+				current.control = control
+			}
+		case kind == "a" && strings.HasPrefix(value, "rtpmap:") && current != nil:
+			payloadType, encoding, _ := strings.Cut(strings.TrimPrefix(value, "rtpmap:"), " ")
+			if pt, err := strconv.Atoi(payloadType); err != nil || pt != current.payloadType {
+				continue
+			}
+			parts := strings.Split(encoding, "/")
+			current.encoding = parts[0]
+			if len(parts) > 1 {
+				current.clockRate, _ = strconv.Atoi(parts[1])
+			}
+			current.channels = 1
+			if len(parts) > 2 {
+				current.channels, _ = strconv.Atoi(parts[2])
+			}
+		}
+	}
+	if len(description.media) == 0 {
+		return sessionDescription{}, errors.New("sdp describes no media")
+	}
+	return description, nil
+}
+
+func (d sessionDescription) audioTrack() (sdpMedia, bool) {
+	for _, media := range d.media {
+		if media.kind == "audio" {
+			return media, true
+		}
+	}
+	return sdpMedia{}, false
+}
+
+type rtpPacket struct {
+	sequence  uint16
+	timestamp uint32
+	payload   []byte
+}
+
+// parseRTP extracts the payload of an RTP packet (RFC 3550 section 5.1).
+func parseRTP(packet []byte) (rtpPacket, error) {
+	if len(packet) < 12 || packet[0]>>6 != 2 {
+		return rtpPacket{}, errors.New("not an rtp packet")
+	}
+	offset := 12 + 4*int(packet[0]&0x0f)
+	if packet[0]&0x10 != 0 {
+		if len(packet) < offset+4 {
+			return rtpPacket{}, errors.New("truncated rtp header extension")
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(packet[offset+2:]))
+	}
+	end := len(packet)
+	if packet[0]&0x20 != 0 && end > 0 {
+		end -= int(packet[end-1])
+	}
+	if offset > end {
+		return rtpPacket{}, errors.New("truncated rtp packet")
+	}
+	return rtpPacket{
+		sequence:  binary.BigEndian.Uint16(packet[2:]),
+		timestamp: binary.BigEndian.Uint32(packet[4:]),
+		payload:   packet[offset:end],
+	}, nil
+}
@@ -0,0 +1,248 @@
+package ingestion
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+const testSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=Camera\r\n" +
+	"a=control:*\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=control:trackID=0\r\n" +
+	"m=audio 0 RTP/AVP 97\r\n" +
+	"b=AS:128\r\n" +
+	"a=rtpmap:97 MPEG4-GENERIC/48000/2\r\n" +
+	"a=control:trackID=1\r\n"
+
+func rtpFrame(channel byte, sequence uint16, timestamp uint32, payload string) []byte {
+	packet := make([]byte, 12, 12+len(payload))
+	packet[0] = 2 << 6
+	packet[1] = 97
+	binary.BigEndian.PutUint16(packet[2:], sequence)
+	binary.BigEndian.PutUint32(packet[4:], timestamp)
+	packet = append(packet, payload...)
+	frame := []byte{'$', channel, 0, 0}
+	binary.BigEndian.PutUint16(frame[2:], uint16(len(packet)))
+	return append(frame, packet...)
+}
+
+// serveRTSP answers a single RTSP session that requires digest
+// authentication, then plays frames.
+func serveRTSP(t *testing.T, ln net.Listener, frames [][]byte) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reader := textproto.NewReader(bufio.NewReader(conn))
+
+	digest := func(method, uri string) string {
+		hash := func(parts ...string) string {
+			sum := md5.Sum([]byte(strings.Join(parts, ":")))
+			return hex.EncodeToString(sum[:])
+		}
+		return hash(hash("viewer", "camera", "secret"), "abc123", hash(method, uri))
+	}
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+		header, err := reader.ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		method, uri := fields[0], fields[1]
+		cseq := header.Get("CSeq")
+
+		if strings.Contains(uri, "viewer") {
+			t.Errorf("credentials leaked into request URI %q", uri)
+		}
+		if !strings.Contains(header.Get("Authorization"), fmt.Sprintf(`response="%s"`, digest(method, uri))) {
+			fmt.Fprintf(conn, "RTSP/1.0 401 Unauthorized\r\nCSeq: %s\r\nWWW-Authenticate: Basic realm=\"camera\"\r\nWWW-Authenticate: Digest realm=\"camera\", nonce=\"abc123\"\r\n\r\n", cseq)
+			continue
+		}
+		switch method {
+		case "DESCRIBE":
+			fmt.Fprintf(conn, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nContent-Base: %s/\r\nContent-Type: application/sdp\r\nContent-Length: %d\r\n\r\n%s", cseq, uri, len(testSDP), testSDP)
+		case "SETUP":
+			if !strings.HasSuffix(uri, "/trackID=1") || !strings.Contains(header.Get("Transport"), "RTP/AVP/TCP") {
+				t.Errorf("unexpected SETUP %s with transport %q", uri, header.Get("Transport"))
+			}
+			fmt.Fprintf(conn, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nTransport: RTP/AVP/TCP;unicast;interleaved=2-3\r\nSession: 12345678;timeout=60\r\n\r\n", cseq)
+		case "PLAY":
+			if header.Get("Session") != "12345678" {
+				t.Errorf("PLAY without the session, got %q", header.Get("Session"))
+			}
+			fmt.Fprintf(conn, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nSession: 12345678\r\n\r\n", cseq)
+			for _, frame := range frames {
+				if _, err := conn.Write(frame); err != nil {
+					return
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			return
+		}
+	}
+}
+
+func TestRTSPStreamSourceStreamsAudioTrack(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	go serveRTSP(t, ln, [][]byte{
+		rtpFrame(2, 100, 0, "first"),
+		// RTCP and other channels are skipped.
+		rtpFrame(3, 1, 0, "report"),
+		rtpFrame(0, 1, 0, "video"),
+		rtpFrame(2, 101, 1024, "second"),
+		// Sequence 102 was lost.
+		rtpFrame(2, 103, 3072, "third"),
+	})
+
+	source, err := NewRTSPStreamSource(RTSPConfig{
+		URL:            "rtsp://viewer:secret@" + ln.Addr().String() + "/live/stream",
+		BufferSize:     8,
+		ReconnectDelay: time.Hour,
+		ReadTimeout:    time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewRTSPStreamSource: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	chunks, errs := source.Stream(ctx)
+
+	var received []MediaChunk
+	for len(received) < 4 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("context done after %d chunks", len(received))
+		case err := <-errs:
+			t.Fatalf("rtsp stream error: %v", err)
+		case chunk := <-chunks:
+			received = append(received, chunk)
+		}
+	}
+
+	if received[0].Metadata["initialization"] != "true" || string(received[0].Payload) != testSDP {
+		t.Fatalf("expected the session description first, got %+v", received[0])
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		chunk := received[i+1]
+		if string(chunk.Payload) != want {
+			t.Fatalf("chunk %d payload = %q, want %q", i+1, chunk.Payload, want)
+		}
+		if chunk.Metadata["encoding"] != "MPEG4-GENERIC" || chunk.Metadata["clockRate"] != "48000" || chunk.Metadata["channels"] != "2" {
+			t.Fatalf("unexpected chunk metadata %v", chunk.Metadata)
+		}
+	}
+	if got := received[3].Metadata["rtpTimestamp"]; got != "3072" {
+		t.Fatalf("rtpTimestamp = %s, want 3072", got)
+	}
+	if metrics := source.Metrics(); metrics.DroppedChunks != 1 {
+		t.Fatalf("expected the lost packet to be counted, got %+v", metrics)
+	}
+}
+
+func TestRTSPStreamSourceRejectsPresentationWithoutAudio(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := textproto.NewReader(bufio.NewReader(conn))
+		if _, err := reader.ReadLine(); err != nil {
+			return
+		}
+		header, _ := reader.ReadMIMEHeader()
+		sdp := "v=0\r\nm=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n"
+		fmt.Fprintf(conn, "RTSP/1.0 200 OK\r\nCSeq: %s\r\nContent-Length: %d\r\n\r\n%s", header.Get("CSeq"), len(sdp), sdp)
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	source, err := NewRTSPStreamSource(RTSPConfig{
+		URL:            "rtsp://" + ln.Addr().String() + "/video-only",
+		ReconnectDelay: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewRTSPStreamSource: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, errs := source.Stream(ctx)
+	if err := <-errs; !errors.Is(err, statuspkg.ErrFatal) {
+		t.Fatalf("expected a fatal error, got %v", err)
+	}
+}
+
+func TestRTSPReadMessageBoundsBody(t *testing.T) {
+	read := func(reply string) (*rtspResponse, error) {
+		conn := &rtspConn{reader: bufio.NewReader(strings.NewReader(reply))}
+		return conn.readMessage()
+	}
+	body := strings.Repeat("a", maxRTSPBodySize)
+	resp, err := read(fmt.Sprintf("RTSP/1.0 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(body), body))
+	if err != nil {
+		t.Fatalf("readMessage: %v", err)
+	}
+	if len(resp.body) != maxRTSPBodySize {
+		t.Fatalf("body is %d bytes, want %d", len(resp.body), maxRTSPBodySize)
+	}
+
+	_, err = read(fmt.Sprintf("RTSP/1.0 200 OK\r\nContent-Length: %d\r\n\r\n", maxRTSPBodySize+1))
+	if !errors.Is(err, statuspkg.ErrFatal) {
+		t.Fatalf("expected an oversized body to be fatal, got %v", err)
+	}
+}
+
+func TestParseRTPStripsHeaderFields(t *testing.T) {
+	packet := []byte{
+		2<<6 | 0x20 | 0x10 | 1, 97, 0, 7, 0, 0, 0, 9, 0, 0, 0, 1,
+		// One CSRC.
+		0, 0, 0, 2,
+		// A one-word header extension.
+		0xbe, 0xde, 0, 1, 1, 2, 3, 4,
+		'o', 'k',
+		// Two bytes of padding.
+		0, 2,
+	}
+	parsed, err := parseRTP(packet)
+	if err != nil {
+		t.Fatalf("parseRTP: %v", err)
+	}
+	if string(parsed.payload) != "ok" || parsed.sequence != 7 || parsed.timestamp != 9 {
+		t.Fatalf("unexpected packet %+v", parsed)
+	}
+	if _, err := parseRTP([]byte("short")); err == nil {
+		t.Fatal("expected a short packet to be rejected")
+	}
+}
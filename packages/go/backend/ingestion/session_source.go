@@ -0,0 +1,204 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+// SessionSourceConfig tunes the sources created by NewSessionSource. Zero
+// values fall back to the defaults of each adapter.
+type SessionSourceConfig struct {
+	HTTPClient        *http.Client
+	Dialer            *net.Dialer
+	BufferSize        int
+	FileChunkSize     int
+	FileChunkDuration time.Duration
+	// HLSConcurrency is the number of HLS segments downloaded at once.
+	HLSConcurrency int
+	// CredentialsKey opens the sealed credentials of protected sessions.
+	CredentialsKey []byte
+	// Resolver, when set, resolves HLS sources naming a Twitch or YouTube
+	// page, rather than a playlist, to the playlist the page plays.
+	Resolver *PlatformResolver
+	// Backpressure applies to the live sources: HLS, RTMP, and RTSP. DASH
+	// and file sources always wait for the consumer.
+	Backpressure Backpressure
+	// DiskBuffer, when set, buffers the network sources on disk so that
+	// downstream stalls do not cost live content.
+	DiskBuffer *DiskBufferConfig
+	// Failover says when a session with backup URIs moves on to the next
+	// URI.
+	Failover FailoverPolicy
+	// Adaptive, when set, lets HLS and DASH sources switch variants as
+	// ingest lag changes.
+	Adaptive *AdaptiveConfig
+	// RTMPListener receives the publishes of RTMP sources whose URI has
+	// no host, such as rtmp:///live/key, under the stream key of the URI
+	// path.
+	RTMPListener *RTMPListener
+}
+
+// NewSessionSource returns the StreamSource matching the session's source
+// type.
+func NewSessionSource(session sessionpkg.TranslationSession, cfg SessionSourceConfig) (StreamSource, error) {
+	var (
+		source StreamSource
+		err    error
+	)
+	if len(session.Source.BackupURIs) > 0 {
+		source, err = NewFailoverSource(FailoverConfig{
+			URIs: append([]string{session.Source.URI}, session.Source.BackupURIs...),
+			Open: func(uri string) (StreamSource, error) {
+				redundant := session
+				redundant.Source.URI, redundant.Source.BackupURIs = uri, nil
+				return newSessionSource(redundant, cfg)
+			},
+			Policy:     cfg.Failover,
+			BufferSize: cfg.BufferSize,
+		})
+	} else {
+		source, err = newSessionSource(session, cfg)
+	}
+	if err != nil || cfg.DiskBuffer == nil || session.Source.Type == "file" {
+		return source, err
+	}
+	return NewDiskBufferedSource(source, *cfg.DiskBuffer)
+}
+
+func newSessionSource(session sessionpkg.TranslationSession, cfg SessionSourceConfig) (StreamSource, error) {
+	client, err := sessionHTTPClient(session, cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch session.Source.Type {
+	case "hls":
+		hlsCfg := HLSConfig{
+			PlaylistURL:  session.Source.URI,
+			Client:       client,
+			BufferSize:   cfg.BufferSize,
+			PollInterval: 1 * time.Second,
+			Backpressure: cfg.Backpressure,
+			Adaptive:     cfg.Adaptive,
+			Concurrency:  cfg.HLSConcurrency,
+			AudioTrack:   session.Options.AudioTrack,
+		}
+		if cfg.Resolver != nil && cfg.Resolver.Supports(session.Source.URI) {
+			hlsCfg.Resolve = func(ctx context.Context) (string, error) {
+				return cfg.Resolver.Resolve(ctx, session.Source.URI)
+			}
+		}
+		return NewHLSStreamSource(hlsCfg)
+	case "rtmp":
+		if uri, err := url.Parse(session.Source.URI); err == nil && uri.Scheme == "rtmp" && uri.Host == "" {
+			return cfg.RTMPListener.Source(RTMPPushConfig{
+				StreamKey:    uri.Path,
+				BufferSize:   cfg.BufferSize,
+				Backpressure: cfg.Backpressure,
+			})
+		}
+		return NewRTMPStreamSource(RTMPConfig{
+			URL:            session.Source.URI,
+			Dialer:         cfg.Dialer,
+			BufferSize:     cfg.BufferSize,
+			ReconnectDelay: 500 * time.Millisecond,
+			ReadTimeout:    3 * time.Second,
+			Backpressure:   cfg.Backpressure,
+		})
+	case "rtsp":
+		return NewRTSPStreamSource(RTSPConfig{
+			URL:            session.Source.URI,
+			Dialer:         cfg.Dialer,
+			BufferSize:     cfg.BufferSize,
+			ReconnectDelay: 500 * time.Millisecond,
+			ReadTimeout:    5 * time.Second,
+			Backpressure:   cfg.Backpressure,
+		})
+	case "file":
+		return newSessionFileSource(session, cfg)
+	case "dash":
+		return NewDASHStreamSource(DASHConfig{
+			ManifestURL:  session.Source.URI,
+			Client:       client,
+			BufferSize:   cfg.BufferSize,
+			PollInterval: 1 * time.Second,
+			Adaptive:     cfg.Adaptive,
+			AudioTrack:   session.Options.AudioTrack,
+		})
+	default:
+		return nil, errors.New("unsupported source type")
+	}
+}
+
+// sessionHTTPClient returns the client that HTTP sources fetch with,
+// authenticated with the session's credentials when it has any.
+func sessionHTTPClient(session sessionpkg.TranslationSession, cfg SessionSourceConfig) (*http.Client, error) {
+	if session.Source.Credentials == "" {
+		return cfg.HTTPClient, nil
+	}
+	if session.Source.Type != "hls" && session.Source.Type != "dash" {
+		return nil, fmt.Errorf("%s sources do not support credentials", session.Source.Type)
+	}
+	if cfg.CredentialsKey == nil {
+		return nil, errors.New("session has source credentials but no credentials key is configured")
+	}
+	auth, err := sessionpkg.OpenSourceAuth(cfg.CredentialsKey, session.Source.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuthenticatedClient(cfg.HTTPClient, session.Source.URI, auth)
+}
+
+func newSessionFileSource(session sessionpkg.TranslationSession, cfg SessionSourceConfig) (StreamSource, error) {
+	uri, err := url.Parse(session.Source.URI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file source uri: %w", err)
+	}
+	metadata := map[string]string{
+		"source":  "file",
+		"session": session.ID,
+	}
+	switch uri.Scheme {
+	case "file":
+	case "s3", "gs":
+		// Objects are streamed over one long response, which the overall
+		// timeout of the shared client would cut short.
+		var client http.Client
+		if cfg.HTTPClient != nil {
+			client = *cfg.HTTPClient
+			client.Timeout = 0
+		}
+		return NewObjectStreamSource(ObjectConfig{
+			URI:           session.Source.URI,
+			Client:        &client,
+			ChunkSize:     cfg.FileChunkSize,
+			ChunkDuration: cfg.FileChunkDuration,
+			BufferSize:    cfg.BufferSize,
+			Metadata:      metadata,
+		})
+	default:
+		return nil, errors.New("file sources must use file://, s3://, or gs:// URIs")
+	}
+
+	path := uri.Path
+	if uri.Host != "" {
+		path = fmt.Sprintf("//%s%s", uri.Host, uri.Path)
+	}
+	if path == "" {
+		return nil, errors.New("file source missing path")
+	}
+
+	return NewFileStreamSource(FileConfig{
+		Path:          path,
+		ChunkSize:     cfg.FileChunkSize,
+		ChunkDuration: cfg.FileChunkDuration,
+		BufferSize:    cfg.BufferSize,
+		Metadata:      metadata,
+	})
+}
@@ -17,10 +17,18 @@ type MediaChunk struct {
 // StreamMetrics captures aggregated statistics about a stream source.
 type StreamMetrics struct {
 	ReceivedChunks int64
+	// ReceivedBytes is the size of the payloads of the received chunks.
+	ReceivedBytes  int64
 	DroppedChunks  int64
 	ErrorCount     int64
 	ReconnectCount int64
 	LastSequence   int64
+	// VariantSwitches counts the switches between variants of an adaptive
+	// stream.
+	VariantSwitches int64
+	// PlaylistUpdated is when the playlist or manifest of an HLS or DASH
+	// source last listed new media. It is zero for other sources.
+	PlaylistUpdated time.Time
 }
 
 // StreamSource exposes a streaming interface for ingestion adapters.
@@ -0,0 +1,137 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrAACUnsupported is returned when AAC audio must be decoded by a build
+// without an AAC decoder. Building with the fdkaac tag, and cgo against
+// libfdk-aac, adds one.
+var ErrAACUnsupported = errors.New("AAC decoding is not supported by this build; build with -tags fdkaac")
+
+// ErrAACEncodingUnsupported is returned when audio must be encoded to AAC
+// by a build without an AAC encoder. Building with the fdkaac tag, and cgo
+// against libfdk-aac, adds one.
+var ErrAACEncodingUnsupported = errors.New("AAC encoding is not supported by this build; build with -tags fdkaac")
+
+// AACFrameSamples is the number of samples per channel of an AAC-LC frame.
+const AACFrameSamples = 1024
+
+// aacSampleRates maps the sampling frequency indexes of MPEG-4 audio to
+// rates in Hz.
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// AudioSpecificConfig is the MPEG-4 decoder configuration of an AAC
+// stream, as carried in an fMP4 esds box or derived from an ADTS header.
+type AudioSpecificConfig struct {
+	// ObjectType is the audio object type: 2 for AAC-LC, 5 for HE-AAC.
+	ObjectType int
+	// SampleRate is the core sample rate in Hz.
+	SampleRate int
+	// Channels is the channel configuration: the number of channels for
+	// configurations 1 to 6, 8 for configuration 7, and 0 when the
+	// layout is given in the stream.
+	Channels int
+	// Raw is the encoded configuration, as decoders are configured with.
+	Raw []byte
+}
+
+// ParseAudioSpecificConfig parses the fields of an encoded
+// AudioSpecificConfig that identify its stream.
+func ParseAudioSpecificConfig(raw []byte) (AudioSpecificConfig, error) {
+	bits := bitReader{data: raw}
+	config := AudioSpecificConfig{Raw: append([]byte(nil), raw...)}
+	config.ObjectType = bits.read(5)
+	if config.ObjectType == 31 {
+		config.ObjectType = 32 + bits.read(6)
+	}
+	if index := bits.read(4); index == 15 {
+		config.SampleRate = bits.read(24)
+	} else if index < len(aacSampleRates) {
+		config.SampleRate = aacSampleRates[index]
+	}
+	config.Channels = bits.read(4)
+	if config.Channels == 7 {
+		config.Channels = 8
+	}
+	if bits.overrun {
+		return AudioSpecificConfig{}, errors.New("truncated AudioSpecificConfig")
+	}
+	if config.ObjectType == 0 || config.SampleRate == 0 {
+		return AudioSpecificConfig{}, fmt.Errorf("invalid AudioSpecificConfig %x", raw)
+	}
+	return config, nil
+}
+
+// AACDecoder decodes the access units of one AAC stream.
+type AACDecoder interface {
+	// Decode decodes one access unit, a raw_data_block without transport
+	// framing, into interleaved 16-bit little-endian PCM. The chunk's
+	// Timestamp is left zero.
+	Decode(accessUnit []byte) (AudioChunk, error)
+	// Close releases the decoder.
+	Close() error
+}
+
+// NewAACDecoder returns a decoder for the stream config describes, or
+// ErrAACUnsupported when the build has no AAC decoder.
+func NewAACDecoder(config AudioSpecificConfig) (AACDecoder, error) {
+	if len(config.Raw) == 0 {
+		return nil, errors.New("AudioSpecificConfig required")
+	}
+	return newAACDecoder(config)
+}
+
+// AACEncoder encodes one stream of PCM into AAC-LC.
+type AACEncoder interface {
+	// Encode encodes interleaved 16-bit little-endian PCM and returns the
+	// ADTS frames it completed, each of AACFrameSamples samples per
+	// channel. Samples that do not fill a frame yet are kept for the next
+	// call.
+	Encode(pcm []byte) ([][]byte, error)
+	// Flush encodes the samples still kept, padded with silence, and
+	// returns the last frames of the stream.
+	Flush() ([][]byte, error)
+	// Close releases the encoder.
+	Close() error
+}
+
+// NewAACEncoder returns an encoder of mono or stereo audio at sampleRate
+// into AAC-LC of bitrate bits per second in ADTS frames, or
+// ErrAACEncodingUnsupported when the build has no AAC encoder.
+func NewAACEncoder(sampleRate, channels, bitrate int) (AACEncoder, error) {
+	if !slices.Contains(aacSampleRates, sampleRate) {
+		return nil, fmt.Errorf("unsupported AAC sample rate %d", sampleRate)
+	}
+	if channels != 1 && channels != 2 {
+		return nil, fmt.Errorf("unsupported AAC channel count %d", channels)
+	}
+	if bitrate <= 0 {
+		return nil, errors.New("AAC bitrate required")
+	}
+	return newAACEncoder(sampleRate, channels, bitrate)
+}
+
+// bitReader reads big-endian bit fields. Reads past the end return zero
+// bits and set overrun.
+type bitReader struct {
+	data    []byte
+	offset  int
+	overrun bool
+}
+
+func (r *bitReader) read(bits int) int {
+	var value int
+	for i := 0; i < bits; i++ {
+		value <<= 1
+		if r.offset >= 8*len(r.data) {
+			r.overrun = true
+			continue
+		}
+		value |= int(r.data[r.offset/8]>>(7-r.offset%8)) & 1
+		r.offset++
+	}
+	return value
+}
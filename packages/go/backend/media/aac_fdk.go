@@ -0,0 +1,232 @@
+//go:build cgo && fdkaac
+
+package media
+
+/*
+#cgo LDFLAGS: -lfdk-aac
+#include <fdk-aac/aacdecoder_lib.h>
+#include <fdk-aac/aacenc_lib.h>
+
+// The decoder takes arrays of buffers, which Go memory may not be passed
+// as, so single buffers are wrapped here.
+static AAC_DECODER_ERROR streamlation_config(HANDLE_AACDECODER decoder, UCHAR *config, UINT length) {
+	UCHAR *configs[1] = {config};
+	UINT lengths[1] = {length};
+	return aacDecoder_ConfigRaw(decoder, configs, lengths);
+}
+
+static AAC_DECODER_ERROR streamlation_fill(HANDLE_AACDECODER decoder, UCHAR *data, UINT length) {
+	UCHAR *buffers[1] = {data};
+	UINT lengths[1] = {length};
+	UINT valid = length;
+	return aacDecoder_Fill(decoder, buffers, lengths, &valid);
+}
+
+// streamlation_encode feeds samples, or the end of the stream when samples
+// is negative, to the encoder and reports the samples it consumed and the
+// bytes it wrote to out.
+static AACENC_ERROR streamlation_encode(HANDLE_AACENCODER encoder, INT_PCM *pcm, INT samples, UCHAR *out, INT size, INT *consumed, INT *written) {
+	void *inBufs[1] = {pcm};
+	INT inIDs[1] = {IN_AUDIO_DATA};
+	INT inSizes[1] = {samples > 0 ? samples * (INT)sizeof(INT_PCM) : 0};
+	INT inElSizes[1] = {sizeof(INT_PCM)};
+	void *outBufs[1] = {out};
+	INT outIDs[1] = {OUT_BITSTREAM_DATA};
+	INT outSizes[1] = {size};
+	INT outElSizes[1] = {1};
+	AACENC_BufDesc in = {1, inBufs, inIDs, inSizes, inElSizes};
+	AACENC_BufDesc output = {1, outBufs, outIDs, outSizes, outElSizes};
+	AACENC_InArgs args = {samples > 0 ? samples : -1, 0};
+	AACENC_OutArgs result = {0};
+	AACENC_ERROR err = aacEncEncode(encoder, &in, &output, &args, &result);
+	*consumed = result.numInSamples;
+	*written = result.numOutBytes;
+	return err;
+}
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// aacDecoding reports whether the build can decode AAC.
+const aacDecoding = true
+
+// fdkOutputSamples bounds the samples one access unit decodes to: 2048
+// frames, as with SBR, of up to eight channels.
+const fdkOutputSamples = 2048 * 8
+
+// fdkDecoder decodes AAC through libfdk-aac.
+type fdkDecoder struct {
+	handle C.HANDLE_AACDECODER
+	out    []int16
+}
+
+func newAACDecoder(config AudioSpecificConfig) (AACDecoder, error) {
+	if len(config.Raw) == 0 {
+		return nil, errors.New("AudioSpecificConfig required")
+	}
+	handle := C.aacDecoder_Open(C.TT_MP4_RAW, 1)
+	if handle == nil {
+		return nil, errors.New("open fdk-aac decoder")
+	}
+	raw := config.Raw
+	if code := C.streamlation_config(handle, (*C.UCHAR)(unsafe.Pointer(&raw[0])), C.UINT(len(raw))); code != C.AAC_DEC_OK {
+		C.aacDecoder_Close(handle)
+		return nil, fmt.Errorf("configure fdk-aac decoder: error %#x", int(code))
+	}
+	return &fdkDecoder{handle: handle, out: make([]int16, fdkOutputSamples)}, nil
+}
+
+func (d *fdkDecoder) Decode(accessUnit []byte) (AudioChunk, error) {
+	if d.handle == nil {
+		return AudioChunk{}, errors.New("decoder closed")
+	}
+	if len(accessUnit) == 0 {
+		return AudioChunk{}, errors.New("empty access unit")
+	}
+	if code := C.streamlation_fill(d.handle, (*C.UCHAR)(unsafe.Pointer(&accessUnit[0])), C.UINT(len(accessUnit))); code != C.AAC_DEC_OK {
+		return AudioChunk{}, fmt.Errorf("fill fdk-aac decoder: error %#x", int(code))
+	}
+	if code := C.aacDecoder_DecodeFrame(d.handle, (*C.INT_PCM)(unsafe.Pointer(&d.out[0])), C.INT(len(d.out)), 0); code != C.AAC_DEC_OK {
+		return AudioChunk{}, fmt.Errorf("decode AAC frame: error %#x", int(code))
+	}
+	info := C.aacDecoder_GetStreamInfo(d.handle)
+	if info == nil || info.sampleRate <= 0 || info.numChannels <= 0 {
+		return AudioChunk{}, errors.New("decode AAC frame: no stream info")
+	}
+	frames, channels := int(info.frameSize), int(info.numChannels)
+	pcm := make([]byte, 2*frames*channels)
+	for i, sample := range d.out[:frames*channels] {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(sample))
+	}
+	return AudioChunk{
+		SampleRate: int(info.sampleRate),
+		Channels:   channels,
+		PCMData:    pcm,
+		Duration:   time.Duration(frames) * time.Second / time.Duration(info.sampleRate),
+	}, nil
+}
+
+func (d *fdkDecoder) Close() error {
+	if d.handle != nil {
+		C.aacDecoder_Close(d.handle)
+		d.handle = nil
+	}
+	return nil
+}
+
+// fdkFrameBytes bounds the size of an ADTS frame of one or two channels.
+const fdkFrameBytes = 2*768 + 9
+
+// fdkEncoder encodes AAC-LC through libfdk-aac.
+type fdkEncoder struct {
+	handle  C.HANDLE_AACENCODER
+	pending []int16
+	out     []byte
+}
+
+func newAACEncoder(sampleRate, channels, bitrate int) (AACEncoder, error) {
+	var handle C.HANDLE_AACENCODER
+	if code := C.aacEncOpen(&handle, 0, C.UINT(channels)); code != C.AACENC_OK {
+		return nil, fmt.Errorf("open fdk-aac encoder: error %#x", int(code))
+	}
+	params := []struct {
+		param C.AACENC_PARAM
+		value int
+	}{
+		{C.AACENC_AOT, 2},
+		{C.AACENC_SAMPLERATE, sampleRate},
+		// Modes 1 and 2 are mono and stereo.
+		{C.AACENC_CHANNELMODE, channels},
+		{C.AACENC_BITRATE, bitrate},
+		{C.AACENC_TRANSMUX, int(C.TT_MP4_ADTS)},
+	}
+	for _, param := range params {
+		if code := C.aacEncoder_SetParam(handle, param.param, C.UINT(param.value)); code != C.AACENC_OK {
+			C.aacEncClose(&handle)
+			return nil, fmt.Errorf("configure fdk-aac encoder: error %#x", int(code))
+		}
+	}
+	if code := C.aacEncEncode(handle, nil, nil, nil, nil); code != C.AACENC_OK {
+		C.aacEncClose(&handle)
+		return nil, fmt.Errorf("initialize fdk-aac encoder: error %#x", int(code))
+	}
+	return &fdkEncoder{handle: handle, out: make([]byte, fdkFrameBytes)}, nil
+}
+
+func (e *fdkEncoder) Encode(pcm []byte) ([][]byte, error) {
+	if e.handle == nil {
+		return nil, errors.New("encoder closed")
+	}
+	for i := 0; i+1 < len(pcm); i += 2 {
+		e.pending = append(e.pending, int16(binary.LittleEndian.Uint16(pcm[i:])))
+	}
+	var frames [][]byte
+	for len(e.pending) > 0 {
+		frame, consumed, err := e.encode(e.pending)
+		if err != nil {
+			return frames, err
+		}
+		e.pending = e.pending[consumed:]
+		if frame == nil && consumed == 0 {
+			break
+		}
+		if frame != nil {
+			frames = append(frames, frame)
+		}
+	}
+	return frames, nil
+}
+
+func (e *fdkEncoder) Flush() ([][]byte, error) {
+	if e.handle == nil {
+		return nil, errors.New("encoder closed")
+	}
+	frames, err := e.Encode(nil)
+	if err != nil {
+		return frames, err
+	}
+	e.pending = nil
+	for {
+		var consumed, written C.INT
+		code := C.streamlation_encode(e.handle, nil, -1, (*C.UCHAR)(unsafe.Pointer(&e.out[0])), C.INT(len(e.out)), &consumed, &written)
+		if code == C.AACENC_ENCODE_EOF {
+			return frames, nil
+		}
+		if code != C.AACENC_OK {
+			return frames, fmt.Errorf("flush AAC encoder: error %#x", int(code))
+		}
+		if written == 0 {
+			return frames, nil
+		}
+		frames = append(frames, append([]byte(nil), e.out[:written]...))
+	}
+}
+
+// encode feeds samples to the encoder and returns the frame it completed,
+// if any, with the number of samples it consumed.
+func (e *fdkEncoder) encode(samples []int16) ([]byte, int, error) {
+	var consumed, written C.INT
+	code := C.streamlation_encode(e.handle, (*C.INT_PCM)(unsafe.Pointer(&samples[0])), C.INT(len(samples)), (*C.UCHAR)(unsafe.Pointer(&e.out[0])), C.INT(len(e.out)), &consumed, &written)
+	if code != C.AACENC_OK {
+		return nil, 0, fmt.Errorf("encode AAC frame: error %#x", int(code))
+	}
+	if written == 0 {
+		return nil, int(consumed), nil
+	}
+	return append([]byte(nil), e.out[:written]...), int(consumed), nil
+}
+
+func (e *fdkEncoder) Close() error {
+	if e.handle != nil {
+		C.aacEncClose(&e.handle)
+		e.handle = nil
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package media
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAudioSpecificConfig(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		raw    []byte
+		want   AudioSpecificConfig
+		failed bool
+	}{
+		{name: "aac-lc stereo 44.1kHz", raw: []byte{0x12, 0x10}, want: AudioSpecificConfig{ObjectType: 2, SampleRate: 44100, Channels: 2}},
+		{name: "aac-lc mono 48kHz", raw: []byte{0x11, 0x88}, want: AudioSpecificConfig{ObjectType: 2, SampleRate: 48000, Channels: 1}},
+		{name: "he-aac 5.1 24kHz", raw: []byte{0x2b, 0x30}, want: AudioSpecificConfig{ObjectType: 5, SampleRate: 24000, Channels: 6}},
+		{name: "configuration 7 is eight channels", raw: []byte{0x11, 0xb8}, want: AudioSpecificConfig{ObjectType: 2, SampleRate: 48000, Channels: 8}},
+		{name: "explicit rate", raw: []byte{0x17, 0x80, 0x1f, 0x40, 0x08}, want: AudioSpecificConfig{ObjectType: 2, SampleRate: 16000, Channels: 1}},
+		{name: "truncated", raw: []byte{0x12}, failed: true},
+		{name: "reserved frequency index", raw: []byte{0x16, 0x90}, failed: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			config, err := ParseAudioSpecificConfig(tc.raw)
+			if tc.failed {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAudioSpecificConfig: %v", err)
+			}
+			if config.ObjectType != tc.want.ObjectType || config.SampleRate != tc.want.SampleRate || config.Channels != tc.want.Channels {
+				t.Fatalf("expected %+v, got %+v", tc.want, config)
+			}
+			if string(config.Raw) != string(tc.raw) {
+				t.Fatalf("expected raw %x, got %x", tc.raw, config.Raw)
+			}
+		})
+	}
+}
+
+func TestNewAACDecoderWithoutDecoder(t *testing.T) {
+	t.Parallel()
+
+	if aacDecoding {
+		t.Skip("build decodes AAC")
+	}
+	if _, err := NewAACDecoder(AudioSpecificConfig{ObjectType: 2, SampleRate: 44100, Channels: 2, Raw: []byte{0x12, 0x10}}); !errors.Is(err, ErrAACUnsupported) {
+		t.Fatalf("expected ErrAACUnsupported, got %v", err)
+	}
+}
+
+func TestNewAACDecoderRequiresConfig(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewAACDecoder(AudioSpecificConfig{ObjectType: 2, SampleRate: 44100, Channels: 2}); err == nil || errors.Is(err, ErrAACUnsupported) {
+		t.Fatalf("expected a missing config error, got %v", err)
+	}
+	if _, err := newAACDecoder(AudioSpecificConfig{}); err == nil {
+		t.Fatal("expected an empty config to be rejected")
+	}
+}
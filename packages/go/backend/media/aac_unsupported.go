@@ -0,0 +1,14 @@
+//go:build !cgo || !fdkaac
+
+package media
+
+// aacDecoding reports whether the build can decode AAC.
+const aacDecoding = false
+
+func newAACDecoder(AudioSpecificConfig) (AACDecoder, error) {
+	return nil, ErrAACUnsupported
+}
+
+func newAACEncoder(int, int, int) (AACEncoder, error) {
+	return nil, ErrAACEncodingUnsupported
+}
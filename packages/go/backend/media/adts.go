@@ -0,0 +1,106 @@
+package media
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// accessUnitReader reads the access units of an AAC stream out of its
+// container.
+type accessUnitReader interface {
+	// next returns the next access unit and the configuration of the
+	// stream it belongs to. It returns io.EOF once the container ends.
+	next() (AudioSpecificConfig, []byte, error)
+}
+
+// adtsReader reads AAC access units from ADTS frames, as HLS packs audio
+// into .aac segments and MPEG-TS carries it. ID3 tags, which HLS puts at
+// the start of packed audio segments, are skipped, and so are bytes that do
+// not start a frame. Frames packing several raw data blocks, which
+// streaming encoders do not produce, are skipped too.
+type adtsReader struct {
+	r *bufio.Reader
+	// header holds the fields the current config was derived from.
+	header [2]byte
+	config AudioSpecificConfig
+}
+
+func newADTSReader(r io.Reader) *adtsReader {
+	return &adtsReader{r: bufio.NewReaderSize(r, 16*1024)}
+}
+
+func (a *adtsReader) next() (AudioSpecificConfig, []byte, error) {
+	for {
+		header, err := a.r.Peek(10)
+		if len(header) >= 10 && string(header[:3]) == "ID3" {
+			size := 10 + (int(header[6]&0x7f)<<21 | int(header[7]&0x7f)<<14 | int(header[8]&0x7f)<<7 | int(header[9]&0x7f))
+			if header[5]&0x10 != 0 {
+				size += 10
+			}
+			if _, err := a.r.Discard(size); err != nil {
+				return AudioSpecificConfig{}, nil, eofOr(err)
+			}
+			continue
+		}
+		if len(header) < 7 {
+			if err == nil {
+				err = io.EOF
+			}
+			return AudioSpecificConfig{}, nil, eofOr(err)
+		}
+		// A frame starts with the 12-bit sync word and a zero layer.
+		if header[0] != 0xff || header[1]&0xf6 != 0xf0 {
+			_, _ = a.r.Discard(1)
+			continue
+		}
+		headerSize := 7
+		if header[1]&0x01 == 0 {
+			headerSize = 9
+		}
+		length := int(header[3]&0x03)<<11 | int(header[4])<<3 | int(header[5])>>5
+		frequency := header[2] >> 2 & 0x0f
+		if length <= headerSize || int(frequency) >= len(aacSampleRates) {
+			_, _ = a.r.Discard(1)
+			continue
+		}
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(a.r, frame); err != nil {
+			return AudioSpecificConfig{}, nil, eofOr(err)
+		}
+		if frame[6]&0x03 != 0 {
+			continue
+		}
+		if err := a.configure(frame); err != nil {
+			return AudioSpecificConfig{}, nil, err
+		}
+		return a.config, frame[headerSize:], nil
+	}
+}
+
+// configure derives the stream's AudioSpecificConfig from the profile,
+// sampling frequency, and channel configuration in a frame header.
+func (a *adtsReader) configure(frame []byte) error {
+	fields := [2]byte{frame[2] &^ 0x02, frame[3] & 0xc0}
+	if len(a.config.Raw) > 0 && fields == a.header {
+		return nil
+	}
+	objectType := frame[2]>>6 + 1
+	frequency := frame[2] >> 2 & 0x0f
+	channels := (frame[2]&0x01)<<2 | frame[3]>>6
+	config, err := ParseAudioSpecificConfig([]byte{objectType<<3 | frequency>>1, (frequency&0x01)<<7 | channels<<3})
+	if err != nil {
+		return err
+	}
+	a.header, a.config = fields, config
+	return nil
+}
+
+// eofOr treats a container that stops partway through a frame or tag as
+// ended.
+func eofOr(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// adtsFrame frames payload in an ADTS header without CRC for an AAC-LC
+// stream of the given frequency index and channel configuration.
+func adtsFrame(frequency, channels byte, payload []byte) []byte {
+	length := 7 + len(payload)
+	header := []byte{
+		0xff,
+		0xf1,
+		1<<6 | frequency<<2 | channels>>2,
+		channels<<6 | byte(length>>11),
+		byte(length >> 3),
+		byte(length)<<5 | 0x1f,
+		0xfc,
+	}
+	return append(header, payload...)
+}
+
+func TestADTSReaderReadsAccessUnits(t *testing.T) {
+	t.Parallel()
+
+	var stream bytes.Buffer
+	// An ID3 tag with a 4-byte body, as HLS packed audio starts with.
+	stream.Write([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 4, 1, 2, 3, 4})
+	stream.Write(adtsFrame(4, 2, []byte{0x01, 0x02}))
+	// Garbage between frames is skipped.
+	stream.Write([]byte{0x00, 0xff, 0x13})
+	stream.Write(adtsFrame(4, 2, []byte{0x03}))
+	stream.Write(adtsFrame(3, 1, []byte{0x04, 0x05, 0x06}))
+	// A truncated frame ends the stream.
+	stream.Write(adtsFrame(3, 1, []byte{0x07, 0x08})[:8])
+
+	reader := newADTSReader(&stream)
+	want := []struct {
+		payload  []byte
+		rate     int
+		channels int
+	}{
+		{payload: []byte{0x01, 0x02}, rate: 44100, channels: 2},
+		{payload: []byte{0x03}, rate: 44100, channels: 2},
+		{payload: []byte{0x04, 0x05, 0x06}, rate: 48000, channels: 1},
+	}
+	for i, expected := range want {
+		config, accessUnit, err := reader.next()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if !bytes.Equal(accessUnit, expected.payload) {
+			t.Fatalf("frame %d: expected %x, got %x", i, expected.payload, accessUnit)
+		}
+		if config.ObjectType != 2 || config.SampleRate != expected.rate || config.Channels != expected.channels {
+			t.Fatalf("frame %d: unexpected config %+v", i, config)
+		}
+	}
+	if _, _, err := reader.next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package media
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/ingestion"
+)
+
+// SourceChunk identifies the ingested media chunk that normalized audio was
+// decoded from.
+type SourceChunk struct {
+	// Sequence is the chunk's sequence number in its source.
+	Sequence int64 `json:"sequence"`
+	// Time is the wall-clock time the audio starts at: the time the source
+	// gave the chunk, plus how far into the chunk the audio starts. Zero
+	// when the source did not time the chunk.
+	Time time.Time `json:"time,omitempty"`
+	// Metadata is the chunk's metadata, such as the URI of the segment an
+	// HLS or DASH source fetched. It is shared and must not be modified.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// ChunkNormalizer is implemented by normalizers that consume the media
+// chunks of a stream source themselves, rather than their payloads as one
+// byte stream, and record on the audio they emit the chunk it came from.
+type ChunkNormalizer interface {
+	Normalizer
+
+	// NormalizeChunks behaves like Normalize, or like NormalizeFormat when
+	// format is set, for the stream the chunks carry. Closing chunks ends
+	// the stream.
+	NormalizeChunks(ctx context.Context, chunks <-chan ingestion.MediaChunk, format *InputFormat) (<-chan AudioChunk, error)
+}
+
+// NormalizeChunks normalizes the stream of media chunks from chunks with
+// normalizer, so that ingestion sources and normalizers compose. A
+// ChunkNormalizer consumes the chunks itself. Other normalizers read their
+// payloads as one byte stream, through NormalizeFormat when they implement
+// FormatNormalizer and format is set, and the audio they emit is attributed
+// to its source chunk by timestamp: each chunk spans its Duration on the
+// stream's timeline, starting where the chunk before it ended. Chunks
+// without a duration take up no time, so audio is attributed to the latest
+// of them written before it. Closing chunks ends the stream.
+func NormalizeChunks(ctx context.Context, normalizer Normalizer, chunks <-chan ingestion.MediaChunk, format *InputFormat) (<-chan AudioChunk, error) {
+	if chunkNormalizer, ok := normalizer.(ChunkNormalizer); ok {
+		return chunkNormalizer.NormalizeChunks(ctx, chunks, format)
+	}
+
+	reader, writer := io.Pipe()
+	var (
+		audio <-chan AudioChunk
+		err   error
+	)
+	if formatNormalizer, ok := normalizer.(FormatNormalizer); ok && format != nil {
+		audio, err = formatNormalizer.NormalizeFormat(ctx, reader, *format)
+	} else {
+		audio, err = normalizer.Normalize(ctx, reader)
+	}
+	if err != nil {
+		_ = reader.Close()
+		return nil, err
+	}
+
+	timeline := &chunkTimeline{}
+	go func() {
+		// Unblock a pending write if the normalizer stops reading.
+		stop := context.AfterFunc(ctx, func() { _ = reader.CloseWithError(ctx.Err()) })
+		defer stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk, ok := <-chunks:
+				if !ok {
+					_ = writer.Close()
+					return
+				}
+				timeline.add(chunk)
+				if _, err := writer.Write(chunk.Payload); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	out := make(chan AudioChunk)
+	go func() {
+		defer close(out)
+		for chunk := range audio {
+			if chunk.Source == nil {
+				chunk.Source = timeline.source(chunk.Timestamp)
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// chunkTimeline lays the media chunks written to a normalizer out on the
+// timeline of the audio it emits. It is safe for concurrent use.
+type chunkTimeline struct {
+	mu sync.Mutex
+	// spans holds the chunks that audio may still be attributed to, in
+	// the order they were written, and end is where the last one ends.
+	spans []chunkSpan
+	end   time.Duration
+}
+
+type chunkSpan struct {
+	start  time.Duration
+	source SourceChunk
+}
+
+func (t *chunkTimeline) add(chunk ingestion.MediaChunk) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, chunkSpan{
+		start:  t.end,
+		source: SourceChunk{Sequence: chunk.Sequence, Time: chunk.Timestamp, Metadata: chunk.Metadata},
+	})
+	t.end += chunk.Duration
+}
+
+// source returns the chunk that audio at timestamp came from, or nil when
+// no chunk has been written. Chunks ending before timestamp are forgotten.
+func (t *chunkTimeline) source(timestamp time.Duration) *SourceChunk {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.spans) == 0 {
+		return nil
+	}
+	index := max(sort.Search(len(t.spans), func(i int) bool { return t.spans[i].start > timestamp })-1, 0)
+	t.spans = t.spans[index:]
+	span := t.spans[0]
+	source := span.source
+	if !source.Time.IsZero() && timestamp > span.start {
+		source.Time = source.Time.Add(timestamp - span.start)
+	}
+	return &source
+}
@@ -0,0 +1,112 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/ingestion"
+)
+
+func TestNormalizeChunksAttributesAudioToSourceChunks(t *testing.T) {
+	t.Parallel()
+
+	normalizer, err := NewNativeNormalizer(NativeNormalizerConfig{InputRate: 16000})
+	if err != nil {
+		t.Fatalf("NewNativeNormalizer: %v", err)
+	}
+	// Three 200ms segments of 16kHz mono PCM.
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	chunks := make(chan ingestion.MediaChunk, 3)
+	for i := 0; i < 3; i++ {
+		chunks <- ingestion.MediaChunk{
+			Sequence:  int64(10 + i),
+			Timestamp: base.Add(time.Duration(i) * 200 * time.Millisecond),
+			Duration:  200 * time.Millisecond,
+			Payload:   sinePCM(16000, 440, 0.5, 0.2),
+			Metadata:  map[string]string{"uri": fmt.Sprintf("segment%d.ts", i)},
+		}
+	}
+	close(chunks)
+
+	audio, err := NormalizeChunks(context.Background(), normalizer, chunks, nil)
+	if err != nil {
+		t.Fatalf("NormalizeChunks: %v", err)
+	}
+	var received []AudioChunk
+	for chunk := range audio {
+		received = append(received, chunk)
+	}
+	if len(received) != 6 {
+		t.Fatalf("expected 6 chunks, got %d", len(received))
+	}
+	for i, chunk := range received {
+		source := chunk.Source
+		if source == nil {
+			t.Fatalf("chunk %d: no source", i)
+		}
+		if source.Sequence != int64(10+i/2) || source.Metadata["uri"] != fmt.Sprintf("segment%d.ts", i/2) {
+			t.Fatalf("chunk %d: unexpected source %+v", i, source)
+		}
+		if want := base.Add(chunk.Timestamp); !source.Time.Equal(want) {
+			t.Fatalf("chunk %d: expected source time %v, got %v", i, want, source.Time)
+		}
+	}
+}
+
+// chunkEcho is a ChunkNormalizer that emits one chunk per media chunk.
+type chunkEcho struct {
+	StubNormalizer
+}
+
+func (c *chunkEcho) NormalizeChunks(ctx context.Context, chunks <-chan ingestion.MediaChunk, format *InputFormat) (<-chan AudioChunk, error) {
+	out := make(chan AudioChunk)
+	go func() {
+		defer close(out)
+		for chunk := range chunks {
+			out <- AudioChunk{PCMData: chunk.Payload, Source: &SourceChunk{Sequence: chunk.Sequence}}
+		}
+	}()
+	return out, nil
+}
+
+func TestNormalizeChunksUsesChunkNormalizers(t *testing.T) {
+	t.Parallel()
+
+	chunks := make(chan ingestion.MediaChunk, 2)
+	chunks <- ingestion.MediaChunk{Sequence: 1, Payload: []byte{1}}
+	chunks <- ingestion.MediaChunk{Sequence: 2, Payload: []byte{2}}
+	close(chunks)
+
+	audio, err := NormalizeChunks(context.Background(), &chunkEcho{}, chunks, nil)
+	if err != nil {
+		t.Fatalf("NormalizeChunks: %v", err)
+	}
+	var sequences []int64
+	for chunk := range audio {
+		sequences = append(sequences, chunk.Source.Sequence)
+	}
+	if len(sequences) != 2 || sequences[0] != 1 || sequences[1] != 2 {
+		t.Fatalf("unexpected sequences %v", sequences)
+	}
+}
+
+func TestChunkTimelineWithoutDurations(t *testing.T) {
+	t.Parallel()
+
+	timeline := &chunkTimeline{}
+	if source := timeline.source(0); source != nil {
+		t.Fatalf("expected no source before any chunk, got %+v", source)
+	}
+	timeline.add(ingestion.MediaChunk{Sequence: 1})
+	timeline.add(ingestion.MediaChunk{Sequence: 2})
+	if source := timeline.source(time.Second); source == nil || source.Sequence != 2 {
+		t.Fatalf("expected the latest chunk, got %+v", source)
+	}
+	timeline.add(ingestion.MediaChunk{Sequence: 3, Duration: time.Second})
+	timeline.add(ingestion.MediaChunk{Sequence: 4})
+	if source := timeline.source(500 * time.Millisecond); source == nil || source.Sequence != 3 {
+		t.Fatalf("expected the chunk spanning the audio, got %+v", source)
+	}
+}
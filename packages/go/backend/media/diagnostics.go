@@ -0,0 +1,31 @@
+package media
+
+import (
+	"errors"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+var (
+	// ErrUnsupportedCodec is returned, wrapped, when media is encoded in a
+	// codec the normalizer cannot decode.
+	ErrUnsupportedCodec = errors.New("unsupported codec")
+	// ErrNoAudio is returned, wrapped, when media carries no audio the
+	// normalizer can use: no audio track at all, not the track the session
+	// selected, or no audio frames.
+	ErrNoAudio = errors.New("no audio track")
+)
+
+// mediaError attaches to err the status code that describes it, so status
+// events report what is wrong with the media rather than a generic
+// normalization failure.
+func mediaError(err error) error {
+	code := statuspkg.CodeNormalizationFailed
+	switch {
+	case errors.Is(err, ErrUnsupportedCodec), errors.Is(err, ErrAACUnsupported):
+		code = statuspkg.CodeMediaUnsupportedCodec
+	case errors.Is(err, ErrNoAudio):
+		code = statuspkg.CodeMediaNoAudio
+	}
+	return &statuspkg.StageError{Code: code, Err: err}
+}
@@ -0,0 +1,58 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// The weights of each channel in a mono downmix, in the channel order of
+// SMPTE and WAVE layouts: front left, front right, centre, LFE, then
+// surrounds. The centre and surrounds are attenuated by 3 dB as in ITU-R
+// BS.775, and the LFE, which carries no speech, is dropped. Layouts not
+// listed weight every channel equally.
+var downmixWeights = map[int][]float64{
+	2: {1, 1},
+	6: {1, 1, math.Sqrt2 / 2, 0, math.Sqrt2 / 2, math.Sqrt2 / 2},
+	8: {1, 1, math.Sqrt2 / 2, 0, math.Sqrt2 / 2, math.Sqrt2 / 2, math.Sqrt2 / 2, math.Sqrt2 / 2},
+}
+
+// Downmix returns chunk mixed down to mono, so that recognition sees one
+// channel whatever the source layout. Each frame is the weighted mean of
+// its channels, so the mix cannot clip and the same input always yields
+// the same samples. Mono chunks and chunks whose PCM is not whole frames
+// are returned unchanged.
+//
+// Chunks must carry 16-bit little-endian interleaved PCM.
+func Downmix(chunk AudioChunk) AudioChunk {
+	channels := chunk.Channels
+	if channels <= 1 || len(chunk.PCMData)%(2*channels) != 0 {
+		return chunk
+	}
+	weights, ok := downmixWeights[channels]
+	if !ok {
+		weights = make([]float64, channels)
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	var total float64
+	for _, weight := range weights {
+		total += weight
+	}
+
+	frames := len(chunk.PCMData) / (2 * channels)
+	pcm := make([]byte, 2*frames)
+	for frame := 0; frame < frames; frame++ {
+		var sum float64
+		for channel, weight := range weights {
+			sum += weight * float64(int16(binary.LittleEndian.Uint16(chunk.PCMData[2*(frame*channels+channel):])))
+		}
+		binary.LittleEndian.PutUint16(pcm[2*frame:], uint16(int16(math.Round(sum/total))))
+	}
+
+	out := chunk
+	out.Channels = 1
+	out.PCMData = pcm
+	out.RMS = PCMRMS(pcm)
+	return out
+}
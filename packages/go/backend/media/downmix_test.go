@@ -0,0 +1,55 @@
+package media
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func pcm16(samples ...int16) []byte {
+	pcm := make([]byte, 2*len(samples))
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(sample))
+	}
+	return pcm
+}
+
+func TestDownmix(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		channels int
+		in       []int16
+		want     []int16
+	}{
+		{name: "stereo", channels: 2, in: []int16{100, 300, -32768, -32768, 1, 2}, want: []int16{200, -32768, 2}},
+		// Front channels at full weight, centre and surrounds at -3 dB,
+		// LFE dropped: (1000 + 1000 + 0.7071*(1000 + 2000 + 2000)) / 4.1213.
+		{name: "5.1", channels: 6, in: []int16{1000, 1000, 1000, 32767, 2000, 2000}, want: []int16{1343}},
+		{name: "7.1 silence but LFE", channels: 8, in: []int16{0, 0, 0, 32767, 0, 0, 0, 0}, want: []int16{0}},
+		{name: "other layout", channels: 3, in: []int16{300, 600, 900}, want: []int16{600}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := Downmix(AudioChunk{SampleRate: 16000, Channels: tc.channels, PCMData: pcm16(tc.in...)})
+			if out.Channels != 1 || out.SampleRate != 16000 {
+				t.Fatalf("unexpected format %d channels at %dHz", out.Channels, out.SampleRate)
+			}
+			if !reflect.DeepEqual(out.PCMData, pcm16(tc.want...)) {
+				t.Fatalf("unexpected samples %v, want %v", out.PCMData, pcm16(tc.want...))
+			}
+			if out.RMS != PCMRMS(out.PCMData) {
+				t.Fatalf("RMS %f not recomputed", out.RMS)
+			}
+		})
+	}
+}
+
+func TestDownmixLeavesMonoAndPartialFramesAlone(t *testing.T) {
+	mono := AudioChunk{Channels: 1, PCMData: pcm16(1, 2, 3), RMS: 0.5}
+	if out := Downmix(mono); !reflect.DeepEqual(out, mono) {
+		t.Fatalf("mono chunk changed: %+v", out)
+	}
+	partial := AudioChunk{Channels: 2, PCMData: pcm16(1, 2, 3)}
+	if out := Downmix(partial); !reflect.DeepEqual(out, partial) {
+		t.Fatalf("partial chunk changed: %+v", out)
+	}
+}
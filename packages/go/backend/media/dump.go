@@ -0,0 +1,195 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Defaults of AudioDumpConfig.
+const (
+	// DefaultDumpFileSize is the size, in bytes, a dump file grows to
+	// before the next one is started: about nine minutes of 16kHz mono.
+	DefaultDumpFileSize = 16 << 20
+	// DefaultDumpFiles is how many files a session's dump keeps.
+	DefaultDumpFiles = 8
+)
+
+// wavHeaderSize is the size of the header of a 16-bit PCM WAV file.
+const wavHeaderSize = 44
+
+// AudioDumpConfig configures an AudioDump. Zero values fall back to the
+// defaults.
+type AudioDumpConfig struct {
+	// Dir holds a directory of WAV files per session.
+	Dir string
+	// MaxFileSize bounds the size of each WAV file in bytes. A full file
+	// is closed and the next one started.
+	MaxFileSize int64
+	// MaxFiles bounds how many files a session keeps. Starting another
+	// removes the oldest.
+	MaxFiles int
+}
+
+// AudioDump writes the audio of one session to WAV files on disk, so that
+// operators can listen to exactly the audio a stage was given. Files are
+// named audio-000001.wav and so on in cfg.Dir/<session>, and a dump of a
+// session that already has files continues their numbering. Each file
+// holds audio of one sample rate and channel count; a change of format
+// starts a new file. The WAV header is updated after every write, so files
+// can be played while they are written.
+//
+// Chunks must carry 16-bit little-endian interleaved PCM. An AudioDump is
+// not safe for concurrent use.
+type AudioDump struct {
+	cfg AudioDumpConfig
+	dir string
+
+	// files lists the session's files, oldest first, and next numbers
+	// the file started after them.
+	files []string
+	next  int
+
+	file                 *os.File
+	size                 int64
+	sampleRate, channels int
+}
+
+// NewAudioDump creates the session's directory below cfg.Dir and returns a
+// dump writing to it.
+func NewAudioDump(cfg AudioDumpConfig, sessionID string) (*AudioDump, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("audio dump directory required")
+	}
+	if sessionID == "" || sessionID == "." || sessionID == ".." || strings.ContainsAny(sessionID, `/\`) {
+		return nil, fmt.Errorf("invalid session ID %q for an audio dump", sessionID)
+	}
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = DefaultDumpFileSize
+	}
+	if cfg.MaxFileSize < wavHeaderSize+1024 {
+		return nil, fmt.Errorf("audio dump files must be at least %d bytes", wavHeaderSize+1024)
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = DefaultDumpFiles
+	}
+
+	dir := filepath.Join(cfg.Dir, sessionID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create audio dump directory: %w", err)
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "audio-*.wav"))
+	if err != nil {
+		return nil, fmt.Errorf("list audio dump files: %w", err)
+	}
+	dump := &AudioDump{cfg: cfg, dir: dir, next: 1}
+	for _, name := range existing {
+		var number int
+		if _, err := fmt.Sscanf(filepath.Base(name), "audio-%06d.wav", &number); err == nil {
+			dump.files = append(dump.files, name)
+			dump.next = max(dump.next, number+1)
+		}
+	}
+	sort.Strings(dump.files)
+	return dump, nil
+}
+
+// Write appends the audio of chunk, starting new files as the current one
+// fills up or the format changes.
+func (d *AudioDump) Write(chunk AudioChunk) error {
+	if chunk.SampleRate <= 0 || chunk.Channels <= 0 {
+		return nil
+	}
+	frameSize := 2 * chunk.Channels
+	pcm := chunk.PCMData[:len(chunk.PCMData)/frameSize*frameSize]
+	capacity := (d.cfg.MaxFileSize - wavHeaderSize) / int64(frameSize) * int64(frameSize)
+	for len(pcm) > 0 {
+		if d.file == nil || chunk.SampleRate != d.sampleRate || chunk.Channels != d.channels || d.size >= capacity {
+			if err := d.rotate(chunk.SampleRate, chunk.Channels); err != nil {
+				return err
+			}
+		}
+		n := min(int64(len(pcm)), capacity-d.size)
+		if _, err := d.file.WriteAt(pcm[:n], wavHeaderSize+d.size); err != nil {
+			return fmt.Errorf("write audio dump: %w", err)
+		}
+		d.size += n
+		pcm = pcm[n:]
+		if err := d.writeHeader(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the current file.
+func (d *AudioDump) Close() error {
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	if err != nil {
+		return fmt.Errorf("close audio dump: %w", err)
+	}
+	return nil
+}
+
+// rotate closes the current file and starts the next, removing the oldest
+// files beyond cfg.MaxFiles.
+func (d *AudioDump) rotate(sampleRate, channels int) error {
+	if err := d.Close(); err != nil {
+		return err
+	}
+	name := filepath.Join(d.dir, fmt.Sprintf("audio-%06d.wav", d.next))
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("create audio dump file: %w", err)
+	}
+	d.next++
+	d.file, d.size, d.sampleRate, d.channels = file, 0, sampleRate, channels
+	d.files = append(d.files, name)
+	if err := d.writeHeader(); err != nil {
+		return err
+	}
+	for len(d.files) > d.cfg.MaxFiles {
+		if err := os.Remove(d.files[0]); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove audio dump file: %w", err)
+		}
+		d.files = d.files[1:]
+	}
+	return nil
+}
+
+// writeHeader writes the RIFF header of the current file for the audio
+// written to it so far.
+func (d *AudioDump) writeHeader() error {
+	if _, err := d.file.WriteAt(WAVHeader(d.sampleRate, d.channels, d.size), 0); err != nil {
+		return fmt.Errorf("write audio dump header: %w", err)
+	}
+	return nil
+}
+
+// WAVHeader returns the header of a WAV file holding size bytes of 16-bit
+// PCM at sampleRate with channels interleaved.
+func WAVHeader(sampleRate, channels int, size int64) []byte {
+	blockAlign := 2 * channels
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(wavHeaderSize-8+size))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(size))
+	return header
+}
@@ -0,0 +1,104 @@
+package media
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAudioDumpRotatesFiles(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	// Each file holds 2000 bytes of audio: 62.5ms of 16kHz mono.
+	dump, err := NewAudioDump(AudioDumpConfig{Dir: root, MaxFileSize: wavHeaderSize + 2000, MaxFiles: 3}, "session-1")
+	if err != nil {
+		t.Fatalf("NewAudioDump: %v", err)
+	}
+	// 100ms chunks of 3200 bytes fill 1.6 files each.
+	for i := 0; i < 5; i++ {
+		if err := dump.Write(AudioChunk{Timestamp: time.Duration(i) * 100 * time.Millisecond, SampleRate: 16000, Channels: 1, PCMData: make([]byte, 3200)}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := dump.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	names := dumpFiles(t, filepath.Join(root, "session-1"))
+	// 16000 bytes make eight files, of which the last three are kept.
+	if want := []string{"audio-000006.wav", "audio-000007.wav", "audio-000008.wav"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("files = %v, want %v", names, want)
+	}
+	for name, size := range map[string]int{"audio-000006.wav": 2000, "audio-000008.wav": 2000} {
+		rate, channels, dataSize := readWAVHeader(t, filepath.Join(root, "session-1", name))
+		if rate != 16000 || channels != 1 || dataSize != size {
+			t.Fatalf("%s: unexpected header %d Hz, %d channels, %d bytes", name, rate, channels, dataSize)
+		}
+	}
+}
+
+func TestAudioDumpStartsFileOnFormatChangeAndContinuesNumbering(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	dump, err := NewAudioDump(AudioDumpConfig{Dir: root}, "session-1")
+	if err != nil {
+		t.Fatalf("NewAudioDump: %v", err)
+	}
+	_ = dump.Write(AudioChunk{SampleRate: 16000, Channels: 1, PCMData: make([]byte, 320)})
+	_ = dump.Write(AudioChunk{SampleRate: 48000, Channels: 2, PCMData: make([]byte, 1920)})
+	if err := dump.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if rate, channels, size := readWAVHeader(t, filepath.Join(root, "session-1", "audio-000002.wav")); rate != 48000 || channels != 2 || size != 1920 {
+		t.Fatalf("unexpected header %d Hz, %d channels, %d bytes", rate, channels, size)
+	}
+
+	// A later run of the session continues after the existing files.
+	dump, err = NewAudioDump(AudioDumpConfig{Dir: root}, "session-1")
+	if err != nil {
+		t.Fatalf("NewAudioDump: %v", err)
+	}
+	_ = dump.Write(AudioChunk{SampleRate: 16000, Channels: 1, PCMData: make([]byte, 320)})
+	_ = dump.Close()
+	if names := dumpFiles(t, filepath.Join(root, "session-1")); len(names) != 3 || names[2] != "audio-000003.wav" {
+		t.Fatalf("unexpected files %v", names)
+	}
+
+	if _, err := NewAudioDump(AudioDumpConfig{Dir: root}, "../escape"); err == nil {
+		t.Fatal("expected an error for a session ID with a path separator")
+	}
+}
+
+func dumpFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names
+}
+
+func readWAVHeader(t *testing.T, name string) (int, int, int) {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if len(data) < wavHeaderSize || string(data[:4]) != "RIFF" || string(data[8:16]) != "WAVEfmt " || string(data[36:40]) != "data" {
+		t.Fatalf("%s: not a WAV file", name)
+	}
+	size := int(binary.LittleEndian.Uint32(data[40:]))
+	if size != len(data)-wavHeaderSize || int(binary.LittleEndian.Uint32(data[4:])) != len(data)-8 {
+		t.Fatalf("%s: header sizes do not match the %d bytes of the file", name, len(data))
+	}
+	return int(binary.LittleEndian.Uint32(data[24:])), int(binary.LittleEndian.Uint16(data[22:])), size
+}
@@ -0,0 +1,398 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+// maxFMP4Box bounds the size of the boxes an fmp4Reader holds in memory.
+// Media segments of a few seconds are far smaller.
+const maxFMP4Box = 64 << 20
+
+// fmp4Reader reads AAC access units from fragmented MP4, as HLS and DASH
+// deliver it: an initialization section whose moov box describes the
+// tracks, followed by moof and mdat boxes carrying the samples. Of several
+// audio tracks, the one track selects by language or index is read, or
+// else the first. Sample data is located from the start of its moof, as
+// CMAF requires; explicit base data offsets are taken as offsets into the
+// stream.
+type fmp4Reader struct {
+	r      io.Reader
+	track  *sessionpkg.AudioTrackSelection
+	offset int64
+
+	// trackID and config identify the audio track read, once a moov box
+	// has been seen.
+	trackID uint32
+	config  AudioSpecificConfig
+	// samples locates the samples the last moof box lists, and queue
+	// holds the access units read and not yet returned.
+	samples []fmp4Sample
+	queue   [][]byte
+}
+
+type fmp4Sample struct {
+	offset int64
+	size   int64
+}
+
+// fmp4Track is an audio track listed in a moov box.
+type fmp4Track struct {
+	id       uint32
+	language string
+	config   []byte
+	codec    string
+}
+
+func newFMP4Reader(r io.Reader, track *sessionpkg.AudioTrackSelection) *fmp4Reader {
+	return &fmp4Reader{r: r, track: track}
+}
+
+func (f *fmp4Reader) next() (AudioSpecificConfig, []byte, error) {
+	for len(f.queue) == 0 {
+		if err := f.readBox(); err != nil {
+			return AudioSpecificConfig{}, nil, err
+		}
+	}
+	accessUnit := f.queue[0]
+	f.queue = f.queue[1:]
+	return f.config, accessUnit, nil
+}
+
+// readBox reads the next top-level box and acts on it.
+func (f *fmp4Reader) readBox() error {
+	start := f.offset
+	var header [16]byte
+	if _, err := io.ReadFull(f.r, header[:8]); err != nil {
+		return eofOr(err)
+	}
+	size, kind, headerSize := int64(binary.BigEndian.Uint32(header[:4])), string(header[4:8]), int64(8)
+	if size == 1 {
+		if _, err := io.ReadFull(f.r, header[8:]); err != nil {
+			return eofOr(err)
+		}
+		size, headerSize = int64(binary.BigEndian.Uint64(header[8:])), 16
+	}
+	f.offset += headerSize
+
+	if kind != "moov" && kind != "moof" && kind != "mdat" {
+		if size == 0 {
+			return io.EOF
+		}
+		skipped, err := io.CopyN(io.Discard, f.r, size-headerSize)
+		f.offset += skipped
+		return eofOr(err)
+	}
+	var payload []byte
+	switch {
+	case size == 0:
+		data, err := io.ReadAll(io.LimitReader(f.r, maxFMP4Box+1))
+		if err != nil {
+			return err
+		}
+		payload = data
+	case size < headerSize || size-headerSize > maxFMP4Box:
+		return fmt.Errorf("unsupported %s box size %d", kind, size)
+	default:
+		payload = make([]byte, size-headerSize)
+		if _, err := io.ReadFull(f.r, payload); err != nil {
+			return eofOr(err)
+		}
+	}
+	if len(payload) > maxFMP4Box {
+		return fmt.Errorf("%s box exceeds %d bytes", kind, maxFMP4Box)
+	}
+	f.offset += int64(len(payload))
+
+	switch kind {
+	case "moov":
+		return f.readMovie(payload)
+	case "moof":
+		if f.trackID != 0 {
+			f.samples = fragmentSamples(payload, start, f.trackID)
+		}
+	case "mdat":
+		dataStart := start + headerSize
+		for _, sample := range f.samples {
+			if sample.offset >= dataStart && sample.offset+sample.size <= dataStart+int64(len(payload)) {
+				begin := sample.offset - dataStart
+				f.queue = append(f.queue, append([]byte(nil), payload[begin:begin+sample.size]...))
+			}
+		}
+		f.samples = nil
+	}
+	return nil
+}
+
+// readMovie picks the audio track to read from a moov box.
+func (f *fmp4Reader) readMovie(payload []byte) error {
+	var tracks []fmp4Track
+	forEachBox(payload, func(kind string, trak []byte) {
+		if kind == "trak" {
+			if track, ok := parseTrack(trak); ok {
+				tracks = append(tracks, track)
+			}
+		}
+	})
+	if len(tracks) == 0 {
+		return fmt.Errorf("fmp4 media: %w", ErrNoAudio)
+	}
+	index := 0
+	if f.track != nil {
+		languages := make([]string, len(tracks))
+		for i, track := range tracks {
+			languages[i] = track.language
+		}
+		var err error
+		if index, err = f.track.Select(languages); err != nil {
+			return fmt.Errorf("%w: %v", ErrNoAudio, err)
+		}
+	}
+	track := tracks[index]
+	if track.config == nil {
+		return fmt.Errorf("audio track %d is %s: %w", track.id, track.codec, ErrUnsupportedCodec)
+	}
+	config, err := ParseAudioSpecificConfig(track.config)
+	if err != nil {
+		return err
+	}
+	f.trackID, f.config = track.id, config
+	return nil
+}
+
+// parseTrack reads a trak box, reporting false unless it is an audio
+// track.
+func parseTrack(trak []byte) (fmp4Track, bool) {
+	var (
+		track fmp4Track
+		audio bool
+	)
+	forEachBox(trak, func(kind string, payload []byte) {
+		switch kind {
+		case "tkhd":
+			// The track ID follows the creation and modification times,
+			// which are 64-bit in version 1.
+			offset := 12
+			if len(payload) > 0 && payload[0] == 1 {
+				offset = 20
+			}
+			if len(payload) >= offset+4 {
+				track.id = binary.BigEndian.Uint32(payload[offset:])
+			}
+		case "mdia":
+			forEachBox(payload, func(kind string, payload []byte) {
+				switch kind {
+				case "mdhd":
+					offset := 20
+					if len(payload) > 0 && payload[0] == 1 {
+						offset = 32
+					}
+					if len(payload) >= offset+2 {
+						code := binary.BigEndian.Uint16(payload[offset:])
+						track.language = string([]byte{byte(code>>10&0x1f) + 0x60, byte(code>>5&0x1f) + 0x60, byte(code&0x1f) + 0x60})
+					}
+				case "hdlr":
+					audio = len(payload) >= 12 && string(payload[8:12]) == "soun"
+				case "minf":
+					parseSampleDescription(payload, &track)
+				}
+			})
+		}
+	})
+	return track, audio && track.id != 0
+}
+
+// parseSampleDescription reads the codec, and the AudioSpecificConfig of an
+// AAC track, from the stsd box within a minf box.
+func parseSampleDescription(minf []byte, track *fmp4Track) {
+	forEachBox(minf, func(kind string, stbl []byte) {
+		if kind != "stbl" {
+			return
+		}
+		forEachBox(stbl, func(kind string, stsd []byte) {
+			if kind != "stsd" || len(stsd) < 8 {
+				return
+			}
+			forEachBox(stsd[8:], func(kind string, entry []byte) {
+				if track.codec != "" {
+					return
+				}
+				track.codec = kind
+				// An AudioSampleEntry's boxes follow 28 bytes of fields.
+				if kind != "mp4a" || len(entry) < 28 {
+					return
+				}
+				forEachBox(entry[28:], func(kind string, esds []byte) {
+					if kind == "esds" {
+						track.config = decoderSpecificInfo(esds)
+					}
+				})
+			})
+		})
+	})
+}
+
+// decoderSpecificInfo returns the AudioSpecificConfig in an esds box, or
+// nil when the elementary stream is not MPEG-4 or MPEG-2 AAC.
+func decoderSpecificInfo(esds []byte) []byte {
+	if len(esds) < 4 {
+		return nil
+	}
+	tag, es, _ := descriptor(esds[4:])
+	if tag != 0x03 || len(es) < 3 {
+		return nil
+	}
+	// ES_ID, then flags announcing optional fields.
+	flags, offset := es[2], 3
+	if flags&0x80 != 0 {
+		offset += 2
+	}
+	if flags&0x40 != 0 && offset < len(es) {
+		offset += 1 + int(es[offset])
+	}
+	if flags&0x20 != 0 {
+		offset += 2
+	}
+	if offset > len(es) {
+		return nil
+	}
+	tag, decoderConfig, _ := descriptor(es[offset:])
+	// The object type indication is 0x40 for MPEG-4 audio and 0x66 to
+	// 0x68 for MPEG-2 AAC.
+	if tag != 0x04 || len(decoderConfig) < 13 || (decoderConfig[0] != 0x40 && (decoderConfig[0] < 0x66 || decoderConfig[0] > 0x68)) {
+		return nil
+	}
+	for rest := decoderConfig[13:]; len(rest) > 0; {
+		var body []byte
+		tag, body, rest = descriptor(rest)
+		if tag == 0x05 {
+			return append([]byte(nil), body...)
+		}
+		if tag == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// descriptor splits the MPEG-4 descriptor at the start of data into its
+// tag and body. It returns a zero tag when data does not hold one.
+func descriptor(data []byte) (byte, []byte, []byte) {
+	if len(data) < 2 {
+		return 0, nil, nil
+	}
+	tag, length, offset := data[0], 0, 1
+	for ; offset < len(data) && offset <= 4; offset++ {
+		length = length<<7 | int(data[offset]&0x7f)
+		if data[offset]&0x80 == 0 {
+			offset++
+			break
+		}
+	}
+	if offset+length > len(data) {
+		return 0, nil, nil
+	}
+	return tag, data[offset : offset+length], data[offset+length:]
+}
+
+// fragmentSamples locates the samples of trackID that a moof box starting
+// at offset in the stream lists.
+func fragmentSamples(moof []byte, offset int64, trackID uint32) []fmp4Sample {
+	var samples []fmp4Sample
+	forEachBox(moof, func(kind string, traf []byte) {
+		if kind != "traf" {
+			return
+		}
+		var (
+			matched     bool
+			base        = offset
+			defaultSize uint32
+		)
+		forEachBox(traf, func(kind string, payload []byte) {
+			switch kind {
+			case "tfhd":
+				if len(payload) < 8 {
+					return
+				}
+				flags := binary.BigEndian.Uint32(payload) & 0xffffff
+				matched = binary.BigEndian.Uint32(payload[4:]) == trackID
+				fields := payload[8:]
+				if flags&0x01 != 0 && len(fields) >= 8 {
+					base = int64(binary.BigEndian.Uint64(fields))
+					fields = fields[8:]
+				}
+				for _, flag := range []uint32{0x02, 0x08} {
+					if flags&flag != 0 && len(fields) >= 4 {
+						fields = fields[4:]
+					}
+				}
+				if flags&0x10 != 0 && len(fields) >= 4 {
+					defaultSize = binary.BigEndian.Uint32(fields)
+				}
+			case "trun":
+				if !matched || len(payload) < 8 {
+					return
+				}
+				flags := binary.BigEndian.Uint32(payload) & 0xffffff
+				count := binary.BigEndian.Uint32(payload[4:])
+				fields := payload[8:]
+				position := base
+				if len(samples) > 0 {
+					last := samples[len(samples)-1]
+					position = last.offset + last.size
+				}
+				if flags&0x01 != 0 && len(fields) >= 4 {
+					position = base + int64(int32(binary.BigEndian.Uint32(fields)))
+					fields = fields[4:]
+				}
+				if flags&0x04 != 0 && len(fields) >= 4 {
+					fields = fields[4:]
+				}
+				for i := uint32(0); i < count; i++ {
+					size := defaultSize
+					for _, flag := range []uint32{0x100, 0x200, 0x400, 0x800} {
+						if flags&flag == 0 {
+							continue
+						}
+						if len(fields) < 4 {
+							return
+						}
+						if flag == 0x200 {
+							size = binary.BigEndian.Uint32(fields)
+						}
+						fields = fields[4:]
+					}
+					samples = append(samples, fmp4Sample{offset: position, size: int64(size)})
+					position += int64(size)
+				}
+			}
+		})
+	})
+	return samples
+}
+
+// forEachBox calls fn with the type and payload of each box in data,
+// stopping at the first malformed box.
+func forEachBox(data []byte, fn func(kind string, payload []byte)) {
+	for len(data) >= 8 {
+		size, headerSize := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		kind := string(data[4:8])
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return
+			}
+			size, headerSize = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return
+		}
+		fn(kind, data[headerSize:size])
+		data = data[size:]
+	}
+}
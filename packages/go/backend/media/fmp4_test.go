@@ -0,0 +1,139 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+// box encodes an MP4 box of the given type around the concatenated parts.
+func box(kind string, parts ...[]byte) []byte {
+	payload := bytes.Join(parts, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(out, kind...), payload...)
+}
+
+func u32(values ...uint32) []byte {
+	var out []byte
+	for _, value := range values {
+		out = binary.BigEndian.AppendUint32(out, value)
+	}
+	return out
+}
+
+// audioTrak encodes the trak box of an AAC track in language, an ISO 639-2
+// code, configured with config.
+func audioTrak(id uint32, language string, config []byte) []byte {
+	code := uint16(language[0]-0x60)<<10 | uint16(language[1]-0x60)<<5 | uint16(language[2]-0x60)
+	decoderSpecific := append([]byte{0x05, byte(len(config))}, config...)
+	decoderConfig := append([]byte{0x04, byte(13 + len(decoderSpecific)), 0x40, 0x15}, make([]byte, 11)...)
+	decoderConfig = append(decoderConfig, decoderSpecific...)
+	es := append([]byte{0x03, byte(3 + len(decoderConfig)), 0, 1, 0}, decoderConfig...)
+	mp4a := box("mp4a", make([]byte, 28), box("esds", u32(0), es))
+	return box("trak",
+		box("tkhd", u32(0, 0, 0, id, 0)),
+		box("mdia",
+			box("mdhd", u32(0, 0, 0, 1000, 0), binary.BigEndian.AppendUint16(nil, code), []byte{0, 0}),
+			box("hdlr", u32(0, 0), []byte("soun"), make([]byte, 12)),
+			box("minf", box("stbl", box("stsd", u32(0, 1), mp4a))),
+		),
+	)
+}
+
+// fragment encodes a moof box listing samples for each track, in track
+// order, followed by the mdat box holding them.
+func fragment(tracks map[uint32][][]byte, order ...uint32) []byte {
+	// Every traf has the same size, so the data offsets can be worked out
+	// after laying the boxes out once.
+	build := func(offsets []uint32) []byte {
+		var trafs [][]byte
+		for i, id := range order {
+			samples := tracks[id]
+			trun := u32(0x201, uint32(len(samples)), offsets[i])
+			for _, sample := range samples {
+				trun = append(trun, u32(uint32(len(sample)))...)
+			}
+			trafs = append(trafs, box("traf", box("tfhd", u32(0x020000, id)), box("trun", trun)))
+		}
+		return box("moof", append([][]byte{box("mfhd", u32(0, 1))}, trafs...)...)
+	}
+	offsets := make([]uint32, len(order))
+	moofSize := uint32(len(build(offsets)))
+	var data [][]byte
+	position := moofSize + 8
+	for i, id := range order {
+		offsets[i] = position
+		for _, sample := range tracks[id] {
+			data = append(data, sample)
+			position += uint32(len(sample))
+		}
+	}
+	return append(build(offsets), box("mdat", data...)...)
+}
+
+func TestFMP4ReaderSelectsTrack(t *testing.T) {
+	t.Parallel()
+
+	var stream bytes.Buffer
+	stream.Write(box("ftyp", []byte("iso6"), u32(0)))
+	stream.Write(box("moov",
+		box("mvhd", make([]byte, 100)),
+		audioTrak(1, "eng", []byte{0x12, 0x10}),
+		audioTrak(2, "swe", []byte{0x11, 0x88}),
+	))
+	stream.Write(box("styp", []byte("msdh")))
+	stream.Write(fragment(map[uint32][][]byte{
+		1: {{0xe1}, {0xe2}},
+		2: {{0x51, 0x52}, {0x53}},
+	}, 1, 2))
+	stream.Write(fragment(map[uint32][][]byte{
+		1: {{0xe3}},
+		2: {{0x54, 0x55, 0x56}},
+	}, 1, 2))
+
+	cases := []struct {
+		name   string
+		track  *sessionpkg.AudioTrackSelection
+		rate   int
+		sample [][]byte
+	}{
+		{name: "default", rate: 44100, sample: [][]byte{{0xe1}, {0xe2}, {0xe3}}},
+		{name: "language", track: &sessionpkg.AudioTrackSelection{Language: "sv"}, rate: 48000, sample: [][]byte{{0x51, 0x52}, {0x53}, {0x54, 0x55, 0x56}}},
+		{name: "index", track: &sessionpkg.AudioTrackSelection{Index: 1}, rate: 48000, sample: [][]byte{{0x51, 0x52}, {0x53}, {0x54, 0x55, 0x56}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			reader := newFMP4Reader(bytes.NewReader(stream.Bytes()), tc.track)
+			for i, expected := range tc.sample {
+				config, accessUnit, err := reader.next()
+				if err != nil {
+					t.Fatalf("sample %d: %v", i, err)
+				}
+				if !bytes.Equal(accessUnit, expected) {
+					t.Fatalf("sample %d: expected %x, got %x", i, expected, accessUnit)
+				}
+				if config.SampleRate != tc.rate {
+					t.Fatalf("sample %d: expected %d Hz, got %+v", i, tc.rate, config)
+				}
+			}
+			if _, _, err := reader.next(); !errors.Is(err, io.EOF) {
+				t.Fatalf("expected io.EOF, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFMP4ReaderRejectsMissingTrack(t *testing.T) {
+	t.Parallel()
+
+	stream := box("moov", audioTrak(1, "eng", []byte{0x12, 0x10}))
+	reader := newFMP4Reader(bytes.NewReader(stream), &sessionpkg.AudioTrackSelection{Language: "de"})
+	if _, _, err := reader.next(); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("expected track selection error, got %v", err)
+	}
+}
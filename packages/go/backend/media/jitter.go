@@ -0,0 +1,191 @@
+package media
+
+import (
+	"sort"
+	"time"
+)
+
+// Defaults of JitterConfig.
+const (
+	// DefaultJitterDepth is how much audio is held to reorder chunks.
+	DefaultJitterDepth = 300 * time.Millisecond
+	// DefaultJitterTolerance is the timestamp error corrected silently.
+	DefaultJitterTolerance = 20 * time.Millisecond
+	// DefaultMaxTimestampGap is the largest jump in timestamps treated as
+	// missing audio rather than a discontinuity.
+	DefaultMaxTimestampGap = 2 * time.Second
+)
+
+// JitterConfig configures a JitterBuffer. Zero values fall back to the
+// defaults.
+type JitterConfig struct {
+	// Depth is how much audio, by duration, is held back so that chunks
+	// arriving out of order can be put back in order. Deeper buffers
+	// reorder more but delay every chunk by as much.
+	Depth time.Duration
+	// Tolerance is how far a chunk may start from where the previous one
+	// ended and still be moved to follow it exactly.
+	Tolerance time.Duration
+	// MaxGap is the largest jump in timestamps, forwards or backwards,
+	// kept as a gap in the audio. Larger jumps, such as a source resetting
+	// its clock, are discontinuities: the audio after them continues from
+	// where the audio before them ended.
+	MaxGap time.Duration
+}
+
+// JitterStats counts what a JitterBuffer corrected.
+type JitterStats struct {
+	// Reordered counts chunks that arrived before an earlier chunk.
+	Reordered int64 `json:"reordered"`
+	// Smoothed counts chunks moved by up to the tolerance to follow the
+	// previous chunk, or moved to follow it after overlapping it.
+	Smoothed int64 `json:"smoothed"`
+	// Gaps counts chunks emitted after missing audio.
+	Gaps int64 `json:"gaps"`
+	// Discontinuities counts jumps in timestamps beyond MaxGap.
+	Discontinuities int64 `json:"discontinuities"`
+	// Late counts chunks dropped because they arrived after the audio
+	// around them had been emitted.
+	Late int64 `json:"late"`
+}
+
+// JitterBuffer puts audio chunks from network sources back in timestamp
+// order and corrects their timestamps, so that downstream stages see time
+// that only moves forwards. Subtitle timing is derived from chunk
+// timestamps, so small errors from segment boundaries and packet jitter
+// would otherwise show up as subtitles that overlap or drift.
+//
+// Chunks are held until cfg.Depth of later audio has arrived and are then
+// emitted oldest first. A chunk starting within cfg.Tolerance of where the
+// previous one ended is moved to follow it exactly; a later start is kept
+// as a gap, and a jump beyond cfg.MaxGap is rebased to follow on from the
+// previous chunk. Chunks that arrive after audio following them has been
+// emitted, and so cannot be placed without moving time backwards, are
+// dropped.
+//
+// A JitterBuffer is not safe for concurrent use.
+type JitterBuffer struct {
+	cfg JitterConfig
+
+	// pending holds the chunks not yet emitted, in timestamp order.
+	pending []AudioChunk
+	// newest is the timestamp of the latest chunk pushed, and rebase is
+	// set when the oldest pending chunk follows a discontinuity.
+	newest time.Duration
+	rebase bool
+
+	started bool
+	// offset is added to source timestamps, moving them past the
+	// discontinuities seen so far, and next is where the last emitted
+	// chunk ended.
+	offset, next time.Duration
+
+	stats JitterStats
+}
+
+// NewJitterBuffer returns a jitter buffer for one stream.
+func NewJitterBuffer(cfg JitterConfig) *JitterBuffer {
+	if cfg.Depth <= 0 {
+		cfg.Depth = DefaultJitterDepth
+	}
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = DefaultJitterTolerance
+	}
+	if cfg.MaxGap <= 0 {
+		cfg.MaxGap = DefaultMaxTimestampGap
+	}
+	return &JitterBuffer{cfg: cfg}
+}
+
+// Push adds chunk to the buffer and returns the chunks, possibly none, that
+// are ready to be emitted, in order and with corrected timestamps.
+func (b *JitterBuffer) Push(chunk AudioChunk) []AudioChunk {
+	var out []AudioChunk
+	if len(b.pending) > 0 && abs(chunk.Timestamp-b.newest) > b.cfg.MaxGap {
+		// Audio from either side of a discontinuity is not reordered
+		// across it.
+		out = b.Flush()
+		b.rebase = true
+	} else if len(b.pending) == 0 && b.started && abs(chunk.Timestamp+b.offset-b.next) > b.cfg.MaxGap {
+		b.rebase = true
+	}
+	b.newest = chunk.Timestamp
+
+	position := sort.Search(len(b.pending), func(i int) bool { return b.pending[i].Timestamp > chunk.Timestamp })
+	if position < len(b.pending) {
+		b.stats.Reordered++
+	}
+	b.pending = append(b.pending, AudioChunk{})
+	copy(b.pending[position+1:], b.pending[position:])
+	b.pending[position] = chunk
+
+	for len(b.pending) > 0 && b.buffered() > b.cfg.Depth {
+		out = b.pop(out)
+	}
+	return out
+}
+
+// Flush returns every chunk still held, as when the stream ends.
+func (b *JitterBuffer) Flush() []AudioChunk {
+	var out []AudioChunk
+	for len(b.pending) > 0 {
+		out = b.pop(out)
+	}
+	return out
+}
+
+// Stats returns what the buffer has corrected so far.
+func (b *JitterBuffer) Stats() JitterStats {
+	return b.stats
+}
+
+// buffered returns how much audio the pending chunks span.
+func (b *JitterBuffer) buffered() time.Duration {
+	last := b.pending[len(b.pending)-1]
+	return last.Timestamp + last.Duration - b.pending[0].Timestamp
+}
+
+// pop corrects the oldest pending chunk and appends it to out, unless it
+// arrived too late to be placed.
+func (b *JitterBuffer) pop(out []AudioChunk) []AudioChunk {
+	chunk := b.pending[0]
+	b.pending = b.pending[1:]
+	rebase := b.rebase
+	b.rebase = false
+
+	timestamp := chunk.Timestamp + b.offset
+	if !b.started {
+		b.started = true
+	} else {
+		delta := timestamp - b.next
+		switch {
+		case rebase:
+			b.offset += b.next - timestamp
+			timestamp = b.next
+			b.stats.Discontinuities++
+		case abs(delta) <= b.cfg.Tolerance:
+			if delta != 0 {
+				timestamp = b.next
+				b.stats.Smoothed++
+			}
+		case delta > 0:
+			b.stats.Gaps++
+		case timestamp+chunk.Duration <= b.next:
+			b.stats.Late++
+			return out
+		default:
+			timestamp = b.next
+			b.stats.Smoothed++
+		}
+	}
+	chunk.Timestamp = timestamp
+	b.next = timestamp + chunk.Duration
+	return append(out, chunk)
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,89 @@
+package media
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// jitterChunks returns 100ms chunks at the given timestamps in
+// milliseconds.
+func jitterChunks(timestamps ...int) []AudioChunk {
+	chunks := make([]AudioChunk, len(timestamps))
+	for i, ms := range timestamps {
+		chunks[i] = AudioChunk{Timestamp: time.Duration(ms) * time.Millisecond, Duration: 100 * time.Millisecond, PCMData: []byte{byte(i)}}
+	}
+	return chunks
+}
+
+// runJitter pushes chunks through a buffer and returns the timestamps, in
+// milliseconds, and payloads of what it emits.
+func runJitter(cfg JitterConfig, chunks []AudioChunk) ([]int, []byte, JitterStats) {
+	buffer := NewJitterBuffer(cfg)
+	var out []AudioChunk
+	for _, chunk := range chunks {
+		out = append(out, buffer.Push(chunk)...)
+	}
+	out = append(out, buffer.Flush()...)
+	timestamps := make([]int, len(out))
+	var payloads []byte
+	for i, chunk := range out {
+		timestamps[i] = int(chunk.Timestamp / time.Millisecond)
+		payloads = append(payloads, chunk.PCMData...)
+	}
+	return timestamps, payloads, buffer.Stats()
+}
+
+func TestJitterBufferReordersChunks(t *testing.T) {
+	timestamps, payloads, stats := runJitter(JitterConfig{}, jitterChunks(0, 200, 100, 300, 500, 400))
+	if want := []int{0, 100, 200, 300, 400, 500}; !reflect.DeepEqual(timestamps, want) {
+		t.Fatalf("timestamps = %v, want %v", timestamps, want)
+	}
+	if want := []byte{0, 2, 1, 3, 5, 4}; !reflect.DeepEqual(payloads, want) {
+		t.Fatalf("payloads = %v, want %v", payloads, want)
+	}
+	if stats.Reordered != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestJitterBufferSmoothsTimestamps(t *testing.T) {
+	// Errors within the tolerance are absorbed; the 40ms and 150ms holes
+	// are kept.
+	timestamps, _, stats := runJitter(JitterConfig{}, jitterChunks(0, 105, 195, 340, 440, 690))
+	if want := []int{0, 100, 200, 340, 440, 690}; !reflect.DeepEqual(timestamps, want) {
+		t.Fatalf("timestamps = %v, want %v", timestamps, want)
+	}
+	if stats.Smoothed != 2 || stats.Gaps != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestJitterBufferRebasesDiscontinuities(t *testing.T) {
+	// The source clock resets after 300ms of audio, and later jumps ahead
+	// by an hour.
+	timestamps, _, stats := runJitter(JitterConfig{MaxGap: 150 * time.Millisecond}, jitterChunks(0, 100, 200, 0, 100, 3600000, 3600100))
+	if want := []int{0, 100, 200, 300, 400, 500, 600}; !reflect.DeepEqual(timestamps, want) {
+		t.Fatalf("timestamps = %v, want %v", timestamps, want)
+	}
+	if stats.Discontinuities != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestJitterBufferDropsLateChunks(t *testing.T) {
+	// The chunk at 100ms arrives once 300ms of later audio has been
+	// emitted past it.
+	timestamps, payloads, stats := runJitter(JitterConfig{Depth: 100 * time.Millisecond}, jitterChunks(0, 200, 300, 400, 100, 500))
+	for i := 1; i < len(timestamps); i++ {
+		if timestamps[i] <= timestamps[i-1] {
+			t.Fatalf("timestamps %v do not increase", timestamps)
+		}
+	}
+	if want := []byte{0, 1, 2, 3, 5}; !reflect.DeepEqual(payloads, want) {
+		t.Fatalf("payloads = %v, want %v", payloads, want)
+	}
+	if stats.Late != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,31 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// PCMRMS returns the root mean square amplitude of 16-bit little-endian PCM
+// samples relative to full scale, between 0 and 1. A trailing odd byte is
+// ignored.
+func PCMRMS(pcm []byte) float64 {
+	samples := len(pcm) / 2
+	if samples == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < samples; i++ {
+		sample := float64(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) / 32768
+		sum += sample * sample
+	}
+	return math.Sqrt(sum / float64(samples))
+}
+
+// Level returns the chunk's RMS amplitude, computing it from PCMData when
+// the normalizer did not set RMS.
+func (c AudioChunk) Level() float64 {
+	if c.RMS > 0 {
+		return c.RMS
+	}
+	return PCMRMS(c.PCMData)
+}
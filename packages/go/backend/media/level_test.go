@@ -0,0 +1,30 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestPCMRMS(t *testing.T) {
+	if got := PCMRMS(nil); got != 0 {
+		t.Fatalf("expected silence for no samples, got %f", got)
+	}
+
+	pcm := make([]byte, 8)
+	for i, sample := range []int16{16384, -16384, 16384, -16384} {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(sample))
+	}
+	if got := PCMRMS(pcm); math.Abs(got-0.5) > 1e-9 {
+		t.Fatalf("expected half-scale RMS, got %f", got)
+	}
+
+	chunk := AudioChunk{PCMData: pcm}
+	if got := chunk.Level(); math.Abs(got-0.5) > 1e-9 {
+		t.Fatalf("expected the level to be computed from PCM, got %f", got)
+	}
+	chunk.RMS = 0.1
+	if got := chunk.Level(); got != 0.1 {
+		t.Fatalf("expected the normalizer's RMS to be used, got %f", got)
+	}
+}
@@ -0,0 +1,294 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Defaults of LoudnessConfig.
+const (
+	// DefaultLoudnessTarget is the EBU R128 programme loudness, in LUFS.
+	DefaultLoudnessTarget = -23.0
+	// DefaultLoudnessWindow is how much recent audio the gain follows.
+	DefaultLoudnessWindow = 10 * time.Second
+	// DefaultMaxLoudnessGain is the largest boost, in dB, given to quiet
+	// audio.
+	DefaultMaxLoudnessGain = 20.0
+	// DefaultPeakCeiling is the sample peak, in dBFS, that gain may not
+	// push audio past.
+	DefaultPeakCeiling = -1.0
+)
+
+// The measurement constants of ITU-R BS.1770, which EBU R128 builds on.
+const (
+	// loudnessStep is the hop between gating blocks: 400ms blocks overlap
+	// by 75%.
+	loudnessStep = 100 * time.Millisecond
+	// momentarySteps and shortTermSteps are the 400ms gating block and the
+	// 3s short-term window, in steps.
+	momentarySteps = 4
+	shortTermSteps = 30
+	// absoluteGate is the loudness, in LUFS, below which blocks are
+	// ignored, and relativeGate how far below the loudness of the remaining
+	// blocks a block must be to be ignored too.
+	absoluteGate = -70.0
+	relativeGate = -10.0
+)
+
+// LoudnessConfig configures a LoudnessNormalizer. Zero values fall back to
+// the defaults.
+type LoudnessConfig struct {
+	// Target is the loudness, in LUFS, audio is normalized to.
+	Target float64
+	// Window is how much recent audio the gated loudness that sets the
+	// gain is measured over. Shorter windows follow level changes in the
+	// source sooner; longer ones keep the gain steadier.
+	Window time.Duration
+	// MaxGain bounds the boost, in dB, given to quiet audio, so that
+	// background noise is not raised to speech level. Attenuation is not
+	// bounded.
+	MaxGain float64
+	// PeakCeiling is the sample peak, in dBFS, that gain may not push
+	// audio past.
+	PeakCeiling float64
+}
+
+// LoudnessNormalizer measures the loudness of audio chunks as EBU R128
+// does and applies the gain that brings it to a target loudness, so that
+// wildly varying source levels reach recognition at a consistent level.
+//
+// Audio is K-weighted and measured in 400ms blocks every 100ms. The gain
+// follows the gated loudness of the blocks in the last cfg.Window: blocks
+// below -70 LUFS, and then those more than 10 LU below the rest, are
+// ignored, so silence and pauses do not raise the gain. Gain changes are
+// ramped across a chunk rather than applied at its start. Every channel is
+// weighted equally, as BS.1770 weights the front channels.
+//
+// Chunks must carry 16-bit little-endian interleaved PCM. A
+// LoudnessNormalizer is not safe for concurrent use.
+type LoudnessNormalizer struct {
+	cfg LoudnessConfig
+
+	sampleRate, channels int
+	filters              []kWeighting
+	// partial accumulates the weighted energy of the step being measured,
+	// and frames counts its frames.
+	partial float64
+	frames  int
+	// steps holds the mean-square energy of the steps in the window,
+	// oldest first.
+	steps []float64
+	// gain is the gain, in dB, applied at the end of the last chunk.
+	gain float64
+}
+
+// NewLoudnessNormalizer returns a normalizer for one stream.
+func NewLoudnessNormalizer(cfg LoudnessConfig) *LoudnessNormalizer {
+	if cfg.Target == 0 {
+		cfg.Target = DefaultLoudnessTarget
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultLoudnessWindow
+	}
+	if cfg.MaxGain <= 0 {
+		cfg.MaxGain = DefaultMaxLoudnessGain
+	}
+	if cfg.PeakCeiling == 0 {
+		cfg.PeakCeiling = DefaultPeakCeiling
+	}
+	return &LoudnessNormalizer{cfg: cfg}
+}
+
+// Process measures chunk and returns a copy with the gain applied to its
+// PCM, its RMS updated, and the measurement recorded in Loudness and Gain.
+// Chunks without a sample rate are returned unchanged.
+func (n *LoudnessNormalizer) Process(chunk AudioChunk) AudioChunk {
+	if chunk.SampleRate <= 0 || len(chunk.PCMData) < 2 {
+		return chunk
+	}
+	channels := max(chunk.Channels, 1)
+	if chunk.SampleRate != n.sampleRate || channels != n.channels {
+		n.reset(chunk.SampleRate, channels)
+	}
+
+	samples := len(chunk.PCMData) / 2
+	stepFrames := n.sampleRate * int(loudnessStep/time.Millisecond) / 1000
+	peak := 0.0
+	for i := 0; i < samples; i++ {
+		sample := float64(int16(binary.LittleEndian.Uint16(chunk.PCMData[2*i:]))) / 32768
+		peak = math.Max(peak, math.Abs(sample))
+		weighted := n.filters[i%channels].process(sample)
+		n.partial += weighted * weighted
+		if i%channels == channels-1 {
+			n.frames++
+			if n.frames == stepFrames {
+				n.push(n.partial / float64(stepFrames))
+				n.partial, n.frames = 0, 0
+			}
+		}
+	}
+
+	target := n.gain
+	if integrated, ok := n.gated(); ok {
+		target = math.Min(n.cfg.Target-integrated, n.cfg.MaxGain)
+	}
+	if peak > 0 {
+		target = math.Min(target, n.cfg.PeakCeiling-decibels(peak))
+	}
+
+	out := chunk
+	out.PCMData = make([]byte, len(chunk.PCMData))
+	copy(out.PCMData, chunk.PCMData)
+	frames := samples / channels
+	for i := 0; i < samples; i++ {
+		// The gain ramps from that of the previous chunk to target over
+		// the chunk.
+		progress := float64(i/channels+1) / float64(max(frames, 1))
+		gain := amplitude(n.gain + (target-n.gain)*progress)
+		sample := float64(int16(binary.LittleEndian.Uint16(chunk.PCMData[2*i:]))) * gain
+		sample = math.Max(math.Min(math.Round(sample), math.MaxInt16), math.MinInt16)
+		binary.LittleEndian.PutUint16(out.PCMData[2*i:], uint16(int16(sample)))
+	}
+	n.gain = target
+	out.RMS = PCMRMS(out.PCMData)
+	out.Loudness = n.shortTerm()
+	out.Gain = target
+	return out
+}
+
+// reset starts measuring a stream of the given format afresh.
+func (n *LoudnessNormalizer) reset(sampleRate, channels int) {
+	n.sampleRate, n.channels = sampleRate, channels
+	n.filters = make([]kWeighting, channels)
+	for i := range n.filters {
+		n.filters[i] = newKWeighting(float64(sampleRate))
+	}
+	n.partial, n.frames, n.steps = 0, 0, nil
+}
+
+// push records the energy of a completed step, forgetting steps that have
+// left the window.
+func (n *LoudnessNormalizer) push(energy float64) {
+	n.steps = append(n.steps, energy)
+	if limit := int(n.cfg.Window/loudnessStep) + momentarySteps - 1; len(n.steps) > limit {
+		n.steps = n.steps[len(n.steps)-limit:]
+	}
+}
+
+// shortTerm returns the loudness of the last 3s measured, or of what has
+// been measured when that is less, floored at the absolute gate.
+func (n *LoudnessNormalizer) shortTerm() float64 {
+	recent := n.steps[max(len(n.steps)-shortTermSteps, 0):]
+	stepFrames := n.sampleRate * int(loudnessStep/time.Millisecond) / 1000
+	sum, frames := n.partial, n.frames
+	for _, energy := range recent {
+		sum += energy * float64(stepFrames)
+		frames += stepFrames
+	}
+	if frames == 0 {
+		return absoluteGate
+	}
+	return math.Max(loudness(sum/float64(frames)), absoluteGate)
+}
+
+// gated returns the gated loudness of the 400ms blocks in the window. It
+// reports false when no block passes the absolute gate.
+func (n *LoudnessNormalizer) gated() (float64, bool) {
+	var blocks []float64
+	for end := momentarySteps; end <= len(n.steps); end++ {
+		var sum float64
+		for _, energy := range n.steps[end-momentarySteps : end] {
+			sum += energy
+		}
+		if energy := sum / momentarySteps; loudness(energy) > absoluteGate {
+			blocks = append(blocks, energy)
+		}
+	}
+	if len(blocks) == 0 {
+		return 0, false
+	}
+	threshold := loudness(mean(blocks)) + relativeGate
+	var kept []float64
+	for _, energy := range blocks {
+		if loudness(energy) > threshold {
+			kept = append(kept, energy)
+		}
+	}
+	return loudness(mean(kept)), true
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// loudness converts the mean-square energy of K-weighted audio to LUFS.
+func loudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+func decibels(amplitude float64) float64 {
+	return 20 * math.Log10(amplitude)
+}
+
+func amplitude(decibels float64) float64 {
+	return math.Pow(10, decibels/20)
+}
+
+// kWeighting is the K-weighting filter of BS.1770 for one channel: a high
+// shelf modelling the head, followed by the RLB high-pass.
+type kWeighting struct {
+	shelf, highPass biquad
+}
+
+// newKWeighting derives the filter for sampleRate from the analogue
+// prototypes of BS.1770, matching its published 48kHz coefficients.
+func newKWeighting(sampleRate float64) kWeighting {
+	var filter kWeighting
+
+	k := math.Tan(math.Pi * 1681.974450955533 / sampleRate)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	filter.shelf = biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * 38.13547087602444 / sampleRate)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	filter.highPass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return filter
+}
+
+func (f *kWeighting) process(sample float64) float64 {
+	return f.highPass.process(f.shelf.process(sample))
+}
+
+// biquad is a second-order IIR filter in direct form I.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x1, f.x2 = x, f.x1
+	f.y1, f.y2 = y, f.y1
+	return y
+}
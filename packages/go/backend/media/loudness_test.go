@@ -0,0 +1,144 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// sineChunks returns seconds of a 1kHz mono sine with the given peak
+// amplitude at 48kHz, in 100ms chunks.
+func sineChunks(peak float64, seconds int) []AudioChunk {
+	const (
+		rate  = 48000
+		chunk = rate / 10
+	)
+	var chunks []AudioChunk
+	for c := 0; c < seconds*10; c++ {
+		pcm := make([]byte, 2*chunk)
+		for i := 0; i < chunk; i++ {
+			n := c*chunk + i
+			sample := peak * math.Sin(2*math.Pi*1000*float64(n)/rate)
+			binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(math.Round(sample*32767))))
+		}
+		chunks = append(chunks, AudioChunk{
+			Timestamp:  time.Duration(c) * 100 * time.Millisecond,
+			SampleRate: rate,
+			Channels:   1,
+			PCMData:    pcm,
+			Duration:   100 * time.Millisecond,
+		})
+	}
+	return chunks
+}
+
+func TestKWeightingMatchesBS1770Coefficients(t *testing.T) {
+	filter := newKWeighting(48000)
+	for name, pair := range map[string][2]float64{
+		"shelf b0":    {filter.shelf.b0, 1.53512485958697},
+		"shelf b1":    {filter.shelf.b1, -2.69169618940638},
+		"shelf b2":    {filter.shelf.b2, 1.19839281085285},
+		"shelf a1":    {filter.shelf.a1, -1.69065929318241},
+		"shelf a2":    {filter.shelf.a2, 0.73248077421585},
+		"highpass a1": {filter.highPass.a1, -1.99004745483398},
+		"highpass a2": {filter.highPass.a2, 0.99007225036621},
+	} {
+		if math.Abs(pair[0]-pair[1]) > 1e-6 {
+			t.Errorf("%s = %.14f, want %.14f", name, pair[0], pair[1])
+		}
+	}
+}
+
+func TestLoudnessNormalizerMeasuresAndNormalizes(t *testing.T) {
+	// K-weighting raises 1kHz by the 0.691 dB that BS.1770 subtracts, so
+	// a 1kHz mono sine peaking at 0.1 measures -23 LUFS.
+	for _, tc := range []struct {
+		name      string
+		peak      float64
+		loudness  float64
+		gain      float64
+		tolerance float64
+	}{
+		{name: "at target", peak: 0.1, loudness: -23, gain: 0, tolerance: 0.1},
+		{name: "loud", peak: 0.8, loudness: -4.94, gain: -18.06, tolerance: 0.1},
+		// The boost is capped at MaxGain.
+		{name: "quiet", peak: 0.005, loudness: -49.03, gain: 20, tolerance: 0.1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			normalizer := NewLoudnessNormalizer(LoudnessConfig{})
+			var last AudioChunk
+			for _, chunk := range sineChunks(tc.peak, 5) {
+				last = normalizer.Process(chunk)
+			}
+			if math.Abs(last.Loudness-tc.loudness) > tc.tolerance {
+				t.Fatalf("loudness = %.2f LUFS, want %.2f", last.Loudness, tc.loudness)
+			}
+			if math.Abs(last.Gain-tc.gain) > tc.tolerance {
+				t.Fatalf("gain = %.2f dB, want %.2f", last.Gain, tc.gain)
+			}
+
+			// The normalized audio measures at the target, unless the
+			// boost was capped.
+			meter := NewLoudnessNormalizer(LoudnessConfig{})
+			var measured AudioChunk
+			for _, chunk := range sineChunks(tc.peak, 5) {
+				processed := normalizer.Process(chunk)
+				measured = meter.Process(processed)
+			}
+			want := DefaultLoudnessTarget
+			if tc.gain >= DefaultMaxLoudnessGain {
+				want = tc.loudness + DefaultMaxLoudnessGain
+			}
+			if math.Abs(measured.Loudness-want) > 0.5 {
+				t.Fatalf("normalized loudness = %.2f LUFS, want %.2f", measured.Loudness, want)
+			}
+		})
+	}
+}
+
+func TestLoudnessNormalizerRespectsPeakCeiling(t *testing.T) {
+	// Raising a -15 LUFS sine peaking at 0.25 to -10 LUFS would push it
+	// past -9 dBFS.
+	normalizer := NewLoudnessNormalizer(LoudnessConfig{Target: -10, PeakCeiling: -9})
+	var last AudioChunk
+	for _, chunk := range sineChunks(0.25, 3) {
+		last = normalizer.Process(chunk)
+	}
+	if math.Abs(last.Gain-(-9-decibels(0.25))) > 0.01 {
+		t.Fatalf("gain = %.2f dB, want it limited by the peak ceiling", last.Gain)
+	}
+	var peak int16
+	for i := 0; i < len(last.PCMData); i += 2 {
+		sample := int16(binary.LittleEndian.Uint16(last.PCMData[i:]))
+		if sample < 0 {
+			sample = -sample
+		}
+		peak = max(peak, sample)
+	}
+	if float64(peak)/32768 > amplitude(-9)+0.001 {
+		t.Fatalf("peak %d exceeds the ceiling", peak)
+	}
+}
+
+func TestLoudnessNormalizerLeavesSilenceAlone(t *testing.T) {
+	normalizer := NewLoudnessNormalizer(LoudnessConfig{})
+	chunk := AudioChunk{SampleRate: 48000, Channels: 1, PCMData: make([]byte, 9600), Duration: 100 * time.Millisecond}
+	for i := 0; i < 20; i++ {
+		out := normalizer.Process(chunk)
+		if out.Gain != 0 || out.Loudness != absoluteGate || out.RMS != 0 {
+			t.Fatalf("unexpected silence measurement %+v", out)
+		}
+	}
+
+	// Speech after the silence is measured without the silence pulling
+	// the gated loudness down; only the blocks straddling the onset lower
+	// it slightly.
+	var last AudioChunk
+	for _, chunk := range sineChunks(0.05, 2) {
+		last = normalizer.Process(chunk)
+	}
+	if math.Abs(last.Gain-6.02) > 0.5 {
+		t.Fatalf("gain after silence = %.2f dB, want about 6", last.Gain)
+	}
+}
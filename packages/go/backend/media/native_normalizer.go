@@ -0,0 +1,294 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// Defaults of NativeNormalizerConfig.
+const (
+	// DefaultNativeInputRate is the sample rate assumed of raw PCM input.
+	DefaultNativeInputRate = 48000
+	// DefaultNativeOutputRate is the sample rate recognition expects.
+	DefaultNativeOutputRate = 16000
+	// DefaultNativeChunkDuration is the duration of each emitted chunk.
+	DefaultNativeChunkDuration = 100 * time.Millisecond
+)
+
+// NativeNormalizerConfig configures a NativeNormalizer. Zero values fall
+// back to the defaults.
+type NativeNormalizerConfig struct {
+	// InputRate and Channels describe the raw 16-bit little-endian
+	// interleaved PCM the normalizer reads. Channels defaults to 1.
+	InputRate int
+	Channels  int
+	// OutputRate is the sample rate of the emitted chunks.
+	OutputRate int
+	// ChunkDuration is the duration of each emitted chunk. The last chunk
+	// of a stream may be shorter.
+	ChunkDuration time.Duration
+	// Taps sets the sharpness of the resampling filter; see
+	// ResamplerConfig.
+	Taps int
+	// AACDecoder creates the decoder of an AAC stream. It defaults to
+	// NewAACDecoder.
+	AACDecoder func(AudioSpecificConfig) (AACDecoder, error)
+}
+
+// NativeNormalizer normalizes audio in Go, without an external tool such
+// as ffmpeg on the host: it resamples the input to the output rate with a
+// Resampler and frames it into chunks of equal duration, timestamped from
+// the start of the stream. Channels are kept; the pipeline mixes them down.
+//
+// Normalize reads raw PCM. Given the format of its source, the normalizer
+// also decodes AAC carried in ADTS or fragmented MP4, as HLS and DASH
+// deliver audio, in builds with an AAC decoder. Decoded audio takes the
+// rate and channels its stream declares.
+type NativeNormalizer struct {
+	cfg NativeNormalizerConfig
+}
+
+// NewNativeNormalizer returns a native normalizer.
+func NewNativeNormalizer(cfg NativeNormalizerConfig) (*NativeNormalizer, error) {
+	if cfg.InputRate < 0 || cfg.OutputRate < 0 || cfg.Channels < 0 {
+		return nil, errors.New("sample rates and channels must not be negative")
+	}
+	if cfg.InputRate == 0 {
+		cfg.InputRate = DefaultNativeInputRate
+	}
+	if cfg.OutputRate == 0 {
+		cfg.OutputRate = DefaultNativeOutputRate
+	}
+	if cfg.Channels == 0 {
+		cfg.Channels = 1
+	}
+	if cfg.ChunkDuration <= 0 {
+		cfg.ChunkDuration = DefaultNativeChunkDuration
+	}
+	return &NativeNormalizer{cfg: cfg}, nil
+}
+
+// Normalize reads raw PCM from source until it ends and emits it
+// resampled. A read error other than io.EOF ends the stream early.
+func (n *NativeNormalizer) Normalize(ctx context.Context, source io.Reader) (<-chan AudioChunk, error) {
+	// Fail fast on a configuration the resampler rejects.
+	if _, err := n.newResampler(n.cfg.InputRate, n.cfg.Channels); err != nil {
+		return nil, err
+	}
+
+	out := make(chan AudioChunk)
+	go func() {
+		defer close(out)
+		sink := n.newSink(ctx, out)
+		buf := make([]byte, 32*1024)
+		for {
+			read, err := source.Read(buf)
+			if read > 0 && !sink.write(buf[:read], n.cfg.InputRate, n.cfg.Channels) {
+				return
+			}
+			if err != nil {
+				sink.flush()
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// NormalizeFormat decodes AAC from source when format is ADTS, or fMP4
+// that declares AAC among its codecs or declares none. Of several audio
+// tracks in fMP4, the one format.AudioTrack selects is decoded. Other
+// formats are read as raw PCM, as by Normalize. Access units that fail to
+// decode are skipped.
+//
+// Media the normalizer cannot use fails with a statuspkg.StageError whose
+// code says why: MEDIA_UNSUPPORTED_CODEC for codecs other than AAC, AAC
+// profiles the decoder rejects, and AAC in builds without a decoder, which
+// also match ErrAACUnsupported; MEDIA_NO_AUDIO_TRACK for fMP4 without the
+// selected audio track and streams that end without a single access unit.
+// Failures found once streaming has begun are reported through
+// statuspkg.ReportStageError and end the stream.
+func (n *NativeNormalizer) NormalizeFormat(ctx context.Context, source io.Reader, format InputFormat) (<-chan AudioChunk, error) {
+	var reader accessUnitReader
+	switch format.Container {
+	case "adts":
+		reader = newADTSReader(source)
+	case "fmp4":
+		if len(format.Codecs) > 0 && !slices.ContainsFunc(format.Codecs, isAACCodec) {
+			return nil, mediaError(fmt.Errorf("no AAC codec in %s: %w", strings.Join(format.Codecs, ","), ErrUnsupportedCodec))
+		}
+		reader = newFMP4Reader(source, format.AudioTrack)
+	default:
+		return n.Normalize(ctx, source)
+	}
+	newDecoder := n.cfg.AACDecoder
+	if newDecoder == nil {
+		if !aacDecoding {
+			return nil, mediaError(ErrAACUnsupported)
+		}
+		newDecoder = NewAACDecoder
+	}
+
+	out := make(chan AudioChunk)
+	go func() {
+		defer close(out)
+		sink := n.newSink(ctx, out)
+		var (
+			decoder AACDecoder
+			config  AudioSpecificConfig
+			units   int
+		)
+		defer func() {
+			if decoder != nil {
+				_ = decoder.Close()
+			}
+		}()
+		for ctx.Err() == nil {
+			next, accessUnit, err := reader.next()
+			if errors.Is(err, io.EOF) && units == 0 && ctx.Err() == nil {
+				err = fmt.Errorf("%s stream: %w", format.Container, ErrNoAudio)
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+					statuspkg.ReportStageError(ctx, mediaError(err))
+				}
+				sink.flush()
+				return
+			}
+			units++
+			if decoder == nil || !bytes.Equal(next.Raw, config.Raw) {
+				if decoder != nil {
+					_ = decoder.Close()
+				}
+				if decoder, err = newDecoder(next); err != nil {
+					decoder = nil
+					if !errors.Is(err, ErrAACUnsupported) {
+						err = fmt.Errorf("AAC object type %d at %d Hz: %w: %v", next.ObjectType, next.SampleRate, ErrUnsupportedCodec, err)
+					}
+					statuspkg.ReportStageError(ctx, mediaError(err))
+					sink.flush()
+					return
+				}
+				config = next
+			}
+			chunk, err := decoder.Decode(accessUnit)
+			if err != nil || chunk.SampleRate <= 0 || chunk.Channels <= 0 {
+				continue
+			}
+			if !sink.write(chunk.PCMData, chunk.SampleRate, chunk.Channels) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// isAACCodec reports whether an RFC 6381 codec string names MPEG-4 AAC
+// or MPEG-2 AAC.
+func isAACCodec(codec string) bool {
+	codec = strings.ToLower(strings.TrimSpace(codec))
+	return strings.HasPrefix(codec, "mp4a.40.") || codec == "mp4a.66" || codec == "mp4a.67" || codec == "mp4a.68"
+}
+
+func (n *NativeNormalizer) newResampler(rate, channels int) (*Resampler, error) {
+	return NewResampler(ResamplerConfig{
+		InputRate:  rate,
+		OutputRate: n.cfg.OutputRate,
+		Channels:   channels,
+		Taps:       n.cfg.Taps,
+	})
+}
+
+func (n *NativeNormalizer) newSink(ctx context.Context, out chan<- AudioChunk) *pcmSink {
+	return &pcmSink{
+		ctx:         ctx,
+		out:         out,
+		normalizer:  n,
+		chunkFrames: max(int(n.cfg.ChunkDuration.Seconds()*float64(n.cfg.OutputRate)), 1),
+	}
+}
+
+// pcmSink resamples the PCM a NativeNormalizer reads and emits it in
+// chunks. A change of input rate or channels flushes the audio buffered so
+// far and starts a new resampler.
+type pcmSink struct {
+	ctx         context.Context
+	out         chan<- AudioChunk
+	normalizer  *NativeNormalizer
+	chunkFrames int
+
+	resampler *Resampler
+	rate      int
+	channels  int
+	pending   []byte
+	// frames counts the output frames emitted, which time the chunks.
+	frames int64
+}
+
+// write adds PCM of the given rate and channels. It reports false once the
+// context is cancelled or a resampler cannot be created.
+func (s *pcmSink) write(pcm []byte, rate, channels int) bool {
+	if s.resampler == nil || rate != s.rate || channels != s.channels {
+		if s.resampler != nil && !s.flush() {
+			return false
+		}
+		resampler, err := s.normalizer.newResampler(rate, channels)
+		if err != nil {
+			return false
+		}
+		s.resampler, s.rate, s.channels = resampler, rate, channels
+	}
+	s.pending = append(s.pending, s.resampler.Process(pcm)...)
+	return s.emit(false)
+}
+
+// flush emits the audio buffered, ending with a shorter chunk if need be.
+func (s *pcmSink) flush() bool {
+	if s.resampler == nil {
+		return true
+	}
+	s.pending = append(s.pending, s.resampler.Flush()...)
+	return s.emit(true)
+}
+
+func (s *pcmSink) emit(all bool) bool {
+	outputRate := s.normalizer.cfg.OutputRate
+	frameSize := 2 * s.channels
+	chunkBytes := s.chunkFrames * frameSize
+	for len(s.pending) >= chunkBytes || (all && len(s.pending) > 0) {
+		size := min(chunkBytes, len(s.pending))
+		pcm := append([]byte(nil), s.pending[:size]...)
+		chunk := AudioChunk{
+			Timestamp:  time.Duration(s.frames) * time.Second / time.Duration(outputRate),
+			SampleRate: outputRate,
+			Channels:   s.channels,
+			PCMData:    pcm,
+			RMS:        PCMRMS(pcm),
+			Duration:   time.Duration(size/frameSize) * time.Second / time.Duration(outputRate),
+		}
+		select {
+		case s.out <- chunk:
+			s.frames += int64(size / frameSize)
+			s.pending = s.pending[size:]
+		case <-s.ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// Health reports the normalizer healthy; it has no external dependencies.
+func (n *NativeNormalizer) Health() HealthStatus {
+	return HealthStatus{Healthy: true, Message: "native normalizer ready"}
+}
@@ -0,0 +1,223 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestNativeNormalizerResamplesPCM(t *testing.T) {
+	t.Parallel()
+
+	normalizer, err := NewNativeNormalizer(NativeNormalizerConfig{InputRate: 44100})
+	if err != nil {
+		t.Fatalf("NewNativeNormalizer: %v", err)
+	}
+	// 1.05s of input: ten full chunks and a short last one.
+	chunks, err := normalizer.Normalize(context.Background(), bytes.NewReader(sinePCM(44100, 440, 0.5, 1.05)))
+	if err != nil {
+		t.Fatalf("Normalize: %v", err)
+	}
+
+	var received []AudioChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	if len(received) != 11 {
+		t.Fatalf("expected 11 chunks, got %d", len(received))
+	}
+	for i, chunk := range received[:10] {
+		if chunk.SampleRate != 16000 || chunk.Channels != 1 || len(chunk.PCMData) != 3200 {
+			t.Fatalf("chunk %d: unexpected format %d Hz, %d channels, %d bytes", i, chunk.SampleRate, chunk.Channels, len(chunk.PCMData))
+		}
+		if chunk.Timestamp != time.Duration(i)*100*time.Millisecond || chunk.Duration != 100*time.Millisecond {
+			t.Fatalf("chunk %d: unexpected timing %v+%v", i, chunk.Timestamp, chunk.Duration)
+		}
+		if chunk.RMS < 0.3 {
+			t.Fatalf("chunk %d: unexpected level %f", i, chunk.RMS)
+		}
+	}
+	if last := received[10]; last.Timestamp != time.Second || last.Duration != 50*time.Millisecond {
+		t.Fatalf("unexpected last chunk timing %v+%v", last.Timestamp, last.Duration)
+	}
+}
+
+func TestNativeNormalizerStopsOnCancel(t *testing.T) {
+	t.Parallel()
+
+	normalizer, err := NewNativeNormalizer(NativeNormalizerConfig{})
+	if err != nil {
+		t.Fatalf("NewNativeNormalizer: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	chunks, err := normalizer.Normalize(ctx, bytes.NewReader(make([]byte, 96000*4)))
+	if err != nil {
+		t.Fatalf("Normalize: %v", err)
+	}
+	<-chunks
+	cancel()
+	for range chunks {
+	}
+}
+
+// fakeAACDecoder decodes every access unit to 1024 frames of a constant
+// sample, the access unit's first byte scaled up, in the configured layout.
+type fakeAACDecoder struct {
+	config AudioSpecificConfig
+	closed *int
+}
+
+func (d *fakeAACDecoder) Decode(accessUnit []byte) (AudioChunk, error) {
+	if accessUnit[0] == 0 {
+		return AudioChunk{}, errors.New("corrupt access unit")
+	}
+	pcm := make([]byte, 2*1024*d.config.Channels)
+	for i := 0; i < len(pcm); i += 2 {
+		binary.LittleEndian.PutUint16(pcm[i:], uint16(accessUnit[0])<<7)
+	}
+	return AudioChunk{SampleRate: d.config.SampleRate, Channels: d.config.Channels, PCMData: pcm}, nil
+}
+
+func (d *fakeAACDecoder) Close() error {
+	*d.closed++
+	return nil
+}
+
+func TestNativeNormalizerDecodesADTS(t *testing.T) {
+	t.Parallel()
+
+	var (
+		configs []AudioSpecificConfig
+		closed  int
+	)
+	normalizer, err := NewNativeNormalizer(NativeNormalizerConfig{
+		AACDecoder: func(config AudioSpecificConfig) (AACDecoder, error) {
+			configs = append(configs, config)
+			return &fakeAACDecoder{config: config, closed: &closed}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewNativeNormalizer: %v", err)
+	}
+	// 16 stereo frames at 32kHz are 0.512s; a corrupt one is skipped. The
+	// stream then switches to mono.
+	var stream bytes.Buffer
+	for i := 0; i < 16; i++ {
+		stream.Write(adtsFrame(5, 2, []byte{100}))
+		if i == 3 {
+			stream.Write(adtsFrame(5, 2, []byte{0}))
+		}
+	}
+	for i := 0; i < 8; i++ {
+		stream.Write(adtsFrame(5, 1, []byte{100}))
+	}
+
+	chunks, err := normalizer.NormalizeFormat(context.Background(), &stream, InputFormat{Container: "adts"})
+	if err != nil {
+		t.Fatalf("NormalizeFormat: %v", err)
+	}
+	var stereo, mono time.Duration
+	var next time.Duration
+	for chunk := range chunks {
+		if chunk.SampleRate != 16000 {
+			t.Fatalf("unexpected sample rate %d", chunk.SampleRate)
+		}
+		if chunk.Timestamp != next {
+			t.Fatalf("expected chunk at %v, got %v", next, chunk.Timestamp)
+		}
+		next += chunk.Duration
+		switch chunk.Channels {
+		case 2:
+			stereo += chunk.Duration
+		case 1:
+			mono += chunk.Duration
+		}
+		if chunk.RMS < 0.3 {
+			t.Fatalf("chunk at %v: unexpected level %f", chunk.Timestamp, chunk.RMS)
+		}
+	}
+	if stereo != 512*time.Millisecond || mono != 256*time.Millisecond {
+		t.Fatalf("expected 512ms stereo and 256ms mono, got %v and %v", stereo, mono)
+	}
+	if len(configs) != 2 || configs[0].Channels != 2 || configs[1].Channels != 1 || configs[0].SampleRate != 32000 {
+		t.Fatalf("unexpected decoder configs %+v", configs)
+	}
+	if closed != 2 {
+		t.Fatalf("expected both decoders closed, got %d", closed)
+	}
+}
+
+func TestNativeNormalizerRejectsUndecodableFormats(t *testing.T) {
+	t.Parallel()
+
+	normalizer, err := NewNativeNormalizer(NativeNormalizerConfig{
+		AACDecoder: func(config AudioSpecificConfig) (AACDecoder, error) {
+			return &fakeAACDecoder{config: config, closed: new(int)}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewNativeNormalizer: %v", err)
+	}
+	if _, err := normalizer.NormalizeFormat(context.Background(), bytes.NewReader(nil), InputFormat{Container: "fmp4", Codecs: []string{"avc1.64001f", "ec-3"}}); !errors.Is(err, ErrUnsupportedCodec) || stageErrorCode(err) != statuspkg.CodeMediaUnsupportedCodec {
+		t.Fatalf("expected an unsupported codec error for fMP4 without AAC, got %v", err)
+	}
+	if _, err := normalizer.NormalizeFormat(context.Background(), bytes.NewReader(nil), InputFormat{Container: "fmp4", Codecs: []string{"avc1.64001f", "mp4a.40.2"}}); err != nil {
+		t.Fatalf("NormalizeFormat with AAC: %v", err)
+	}
+
+	if aacDecoding {
+		return
+	}
+	native, err := NewNativeNormalizer(NativeNormalizerConfig{})
+	if err != nil {
+		t.Fatalf("NewNativeNormalizer: %v", err)
+	}
+	if _, err := native.NormalizeFormat(context.Background(), bytes.NewReader(nil), InputFormat{Container: "adts"}); !errors.Is(err, ErrAACUnsupported) || stageErrorCode(err) != statuspkg.CodeMediaUnsupportedCodec {
+		t.Fatalf("expected ErrAACUnsupported, got %v", err)
+	}
+	// Raw PCM still normalizes.
+	chunks, err := native.NormalizeFormat(context.Background(), bytes.NewReader(make([]byte, 9600)), InputFormat{Container: "wav"})
+	if err != nil {
+		t.Fatalf("NormalizeFormat raw: %v", err)
+	}
+	for range chunks {
+	}
+}
+
+func TestNativeNormalizerReportsMediaWithoutAudio(t *testing.T) {
+	t.Parallel()
+
+	normalizer, err := NewNativeNormalizer(NativeNormalizerConfig{
+		AACDecoder: func(config AudioSpecificConfig) (AACDecoder, error) {
+			return &fakeAACDecoder{config: config, closed: new(int)}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewNativeNormalizer: %v", err)
+	}
+	var reported error
+	ctx := statuspkg.WithStageErrorReporter(context.Background(), func(err error) { reported = err })
+	chunks, err := normalizer.NormalizeFormat(ctx, bytes.NewReader([]byte("not an ADTS stream")), InputFormat{Container: "adts"})
+	if err != nil {
+		t.Fatalf("NormalizeFormat: %v", err)
+	}
+	for range chunks {
+		t.Fatal("expected no audio")
+	}
+	if !errors.Is(reported, ErrNoAudio) || stageErrorCode(reported) != statuspkg.CodeMediaNoAudio {
+		t.Fatalf("expected a missing audio error to be reported, got %v", reported)
+	}
+}
+
+func stageErrorCode(err error) statuspkg.ErrorCode {
+	var stageErr *statuspkg.StageError
+	if !errors.As(err, &stageErr) {
+		return ""
+	}
+	return stageErr.Code
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
 )
 
 // AudioChunk represents a normalized audio segment ready for ASR processing.
@@ -20,6 +22,19 @@ type AudioChunk struct {
 	RMS float64 `json:"rms"`
 	// Duration of this audio chunk.
 	Duration time.Duration `json:"duration"`
+	// Loudness is the short-term loudness of the source audio up to the
+	// end of this chunk in LUFS, as measured by a LoudnessNormalizer before
+	// its gain. Audio below -70 LUFS, which EBU R128 ignores, reports -70.
+	// Zero when loudness is not measured.
+	Loudness float64 `json:"loudness,omitempty"`
+	// Gain is the gain, in dB, a LoudnessNormalizer applied to this chunk.
+	Gain float64 `json:"gain,omitempty"`
+	// Window describes where this chunk lies among the fixed windows a
+	// Windower cut the audio into. Nil for audio that was not windowed.
+	Window *WindowAlignment `json:"window,omitempty"`
+	// Source identifies the ingested media chunk this audio starts in, when
+	// it was normalized from a stream of chunks. Nil otherwise.
+	Source *SourceChunk `json:"source,omitempty"`
 }
 
 // HealthStatus represents the health of a component.
@@ -39,3 +54,32 @@ type Normalizer interface {
 	// Health returns the current health status of the normalizer.
 	Health() HealthStatus
 }
+
+// InputFormat describes the media a normalizer is given, as probed from its
+// source before streaming. Fields the source does not reveal are zero.
+type InputFormat struct {
+	// Container is the format the media arrives in, such as "mpegts" or
+	// "fmp4".
+	Container string `json:"container,omitempty"`
+	// Codecs are the codecs the source declares.
+	Codecs []string `json:"codecs,omitempty"`
+	// Bitrate is the declared bitrate in bits per second.
+	Bitrate int64 `json:"bitrate,omitempty"`
+	// Live is set for sources that keep producing media.
+	Live bool `json:"live"`
+	// AudioTrack selects which of several audio streams in the media to
+	// normalize. It is set from the session rather than probed; without
+	// it, normalizers use the media's default audio stream.
+	AudioTrack *sessionpkg.AudioTrackSelection `json:"audioTrack,omitempty"`
+}
+
+// FormatNormalizer is implemented by normalizers that configure themselves,
+// such as by choosing a demuxer and decoder, from the probed format of
+// their input rather than detecting it in the stream.
+type FormatNormalizer interface {
+	Normalizer
+
+	// NormalizeFormat behaves like Normalize for a source of the given
+	// format.
+	NormalizeFormat(ctx context.Context, source io.Reader, format InputFormat) (<-chan AudioChunk, error)
+}
@@ -0,0 +1,49 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrOpusEncodingUnsupported is returned when audio must be encoded to Opus
+// by a build without an Opus encoder. Building with the opus tag, and cgo
+// against libopus, adds one.
+var ErrOpusEncodingUnsupported = errors.New("Opus encoding is not supported by this build; build with -tags opus")
+
+// OpusFrameDuration is the duration of the packets an OpusEncoder returns,
+// the frame size WebRTC and most players expect.
+const OpusFrameDuration = 20 * time.Millisecond
+
+// opusSampleRates are the input sample rates Opus encodes.
+var opusSampleRates = []int{8000, 12000, 16000, 24000, 48000}
+
+// OpusEncoder encodes one stream of PCM into Opus.
+type OpusEncoder interface {
+	// Encode encodes interleaved 16-bit little-endian PCM and returns the
+	// packets it completed, each of OpusFrameDuration. Samples that do not
+	// fill a packet yet are kept for the next call.
+	Encode(pcm []byte) ([][]byte, error)
+	// Flush encodes the samples still kept, padded with silence, and
+	// returns the last packet of the stream.
+	Flush() ([][]byte, error)
+	// Close releases the encoder.
+	Close() error
+}
+
+// NewOpusEncoder returns an encoder of mono or stereo audio at sampleRate
+// into Opus packets of bitrate bits per second, or
+// ErrOpusEncodingUnsupported when the build has no Opus encoder.
+func NewOpusEncoder(sampleRate, channels, bitrate int) (OpusEncoder, error) {
+	if !slices.Contains(opusSampleRates, sampleRate) {
+		return nil, fmt.Errorf("unsupported Opus sample rate %d", sampleRate)
+	}
+	if channels != 1 && channels != 2 {
+		return nil, fmt.Errorf("unsupported Opus channel count %d", channels)
+	}
+	if bitrate <= 0 {
+		return nil, errors.New("Opus bitrate required")
+	}
+	return newOpusEncoder(sampleRate, channels, bitrate)
+}
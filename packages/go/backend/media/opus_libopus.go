@@ -0,0 +1,109 @@
+//go:build cgo && opus
+
+package media
+
+/*
+#cgo LDFLAGS: -lopus
+#include <opus/opus.h>
+
+// opus_encoder_ctl is variadic, which cgo cannot call, so the requests
+// made are wrapped here.
+static int streamlation_opus_bitrate(OpusEncoder *encoder, opus_int32 bitrate) {
+	return opus_encoder_ctl(encoder, OPUS_SET_BITRATE(bitrate));
+}
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// opusEncoding reports whether the build can encode Opus.
+const opusEncoding = true
+
+// opusPacketBytes bounds the size of a packet, as libopus recommends.
+const opusPacketBytes = 4000
+
+// libopusEncoder encodes Opus through libopus.
+type libopusEncoder struct {
+	handle   *C.OpusEncoder
+	channels int
+	// frame is the number of samples of a packet, over all channels.
+	frame   int
+	pending []int16
+	out     []byte
+}
+
+func newOpusEncoder(sampleRate, channels, bitrate int) (OpusEncoder, error) {
+	var code C.int
+	handle := C.opus_encoder_create(C.opus_int32(sampleRate), C.int(channels), C.OPUS_APPLICATION_AUDIO, &code)
+	if code != C.OPUS_OK || handle == nil {
+		return nil, fmt.Errorf("open libopus encoder: error %d", int(code))
+	}
+	if code := C.streamlation_opus_bitrate(handle, C.opus_int32(bitrate)); code != C.OPUS_OK {
+		C.opus_encoder_destroy(handle)
+		return nil, fmt.Errorf("configure libopus encoder: error %d", int(code))
+	}
+	return &libopusEncoder{
+		handle:   handle,
+		channels: channels,
+		frame:    channels * int(int64(sampleRate)*int64(OpusFrameDuration)/int64(time.Second)),
+		out:      make([]byte, opusPacketBytes),
+	}, nil
+}
+
+func (e *libopusEncoder) Encode(pcm []byte) ([][]byte, error) {
+	if e.handle == nil {
+		return nil, errors.New("encoder closed")
+	}
+	for i := 0; i+1 < len(pcm); i += 2 {
+		e.pending = append(e.pending, int16(binary.LittleEndian.Uint16(pcm[i:])))
+	}
+	var packets [][]byte
+	for len(e.pending) >= e.frame {
+		packet, err := e.encode(e.pending[:e.frame])
+		if err != nil {
+			return packets, err
+		}
+		e.pending = e.pending[e.frame:]
+		packets = append(packets, packet)
+	}
+	return packets, nil
+}
+
+func (e *libopusEncoder) Flush() ([][]byte, error) {
+	if e.handle == nil {
+		return nil, errors.New("encoder closed")
+	}
+	if len(e.pending) == 0 {
+		return nil, nil
+	}
+	samples := append(e.pending, make([]int16, e.frame-len(e.pending))...)
+	e.pending = nil
+	packet, err := e.encode(samples)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{packet}, nil
+}
+
+// encode encodes one packet of samples.
+func (e *libopusEncoder) encode(samples []int16) ([]byte, error) {
+	written := C.opus_encode(e.handle, (*C.opus_int16)(unsafe.Pointer(&samples[0])), C.int(len(samples)/e.channels), (*C.uchar)(unsafe.Pointer(&e.out[0])), C.opus_int32(len(e.out)))
+	if written < 0 {
+		return nil, fmt.Errorf("encode Opus packet: error %d", int(written))
+	}
+	return append([]byte(nil), e.out[:written]...), nil
+}
+
+func (e *libopusEncoder) Close() error {
+	if e.handle != nil {
+		C.opus_encoder_destroy(e.handle)
+		e.handle = nil
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package media
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewOpusEncoderValidatesFormat(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name                          string
+		sampleRate, channels, bitrate int
+	}{
+		{"rate Opus does not take", 44100, 1, 32000},
+		{"too many channels", 48000, 6, 32000},
+		{"no bitrate", 48000, 1, 0},
+	} {
+		if _, err := NewOpusEncoder(tc.sampleRate, tc.channels, tc.bitrate); err == nil || errors.Is(err, ErrOpusEncodingUnsupported) {
+			t.Fatalf("%s: expected a format error, got %v", tc.name, err)
+		}
+	}
+
+	encoder, err := NewOpusEncoder(48000, 1, 32000)
+	if !opusEncoding {
+		if !errors.Is(err, ErrOpusEncodingUnsupported) {
+			t.Fatalf("expected ErrOpusEncodingUnsupported, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("NewOpusEncoder: %v", err)
+	}
+	defer encoder.Close()
+	// 50ms of speech is two whole packets and a padded one.
+	packets, err := encoder.Encode(make([]byte, 2*2400))
+	if err != nil || len(packets) != 2 {
+		t.Fatalf("expected 2 packets, got %d (%v)", len(packets), err)
+	}
+	packets, err = encoder.Flush()
+	if err != nil || len(packets) != 1 {
+		t.Fatalf("expected 1 flushed packet, got %d (%v)", len(packets), err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !cgo || !opus
+
+package media
+
+// opusEncoding reports whether the build can encode Opus.
+const opusEncoding = false
+
+func newOpusEncoder(int, int, int) (OpusEncoder, error) {
+	return nil, ErrOpusEncodingUnsupported
+}
@@ -0,0 +1,74 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// PitchFrame is the length of the frames Pitches estimates the pitch of.
+const PitchFrame = 40 * time.Millisecond
+
+// The range of pitches Pitches looks for, spanning adult and child voices,
+// and the lowest level and periodicity of a frame that counts as voiced.
+const (
+	minPitch        = 60
+	maxPitch        = 400
+	minVoicedLevel  = 0.01
+	voicedCorrelate = 0.5
+)
+
+// Pitches estimates the fundamental frequency, in Hz, of each PitchFrame of
+// 16-bit little-endian mono PCM at sampleRate, by the strongest
+// autocorrelation within the range of human voices. Frames that are quiet or
+// not periodic enough to be voiced speech report 0, as does a trailing
+// partial frame.
+func Pitches(pcm []byte, sampleRate int) []float64 {
+	frameSize := int(time.Duration(sampleRate) * PitchFrame / time.Second)
+	minLag, maxLag := sampleRate/maxPitch, sampleRate/minPitch
+	if minLag < 1 || maxLag+1 >= frameSize {
+		return nil
+	}
+	samples := make([]float64, len(pcm)/2)
+	for i := range samples {
+		samples[i] = float64(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) / 32768
+	}
+
+	pitches := make([]float64, len(samples)/frameSize)
+	for f := range pitches {
+		frame := samples[f*frameSize : (f+1)*frameSize]
+		var energy float64
+		for _, sample := range frame {
+			energy += sample * sample
+		}
+		if math.Sqrt(energy/float64(len(frame))) < minVoicedLevel {
+			continue
+		}
+		correlations := make([]float64, maxLag+2)
+		best := 0.0
+		for lag := minLag; lag <= maxLag+1; lag++ {
+			var product, head, tail float64
+			for i := 0; i+lag < len(frame); i++ {
+				product += frame[i] * frame[i+lag]
+				head += frame[i] * frame[i]
+				tail += frame[i+lag] * frame[i+lag]
+			}
+			if head > 0 && tail > 0 {
+				correlations[lag] = product / math.Sqrt(head*tail)
+				best = max(best, correlations[lag])
+			}
+		}
+		if best < voicedCorrelate {
+			continue
+		}
+		// Multiples of the period correlate about as well as the period
+		// itself; the first peak close to the best is the period.
+		for lag := minLag; lag <= maxLag; lag++ {
+			if correlations[lag] >= 0.9*best && correlations[lag] >= correlations[lag-1] && correlations[lag] >= correlations[lag+1] {
+				pitches[f] = float64(sampleRate) / float64(lag)
+				break
+			}
+		}
+	}
+	return pitches
+}
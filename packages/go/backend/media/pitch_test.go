@@ -0,0 +1,39 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// tone returns seconds of a sine at frequency Hz as 16-bit PCM at 16kHz.
+func tone(frequency, amplitude float64, seconds float64) []byte {
+	pcm := make([]byte, 2*int(16000*seconds))
+	for i := 0; i < len(pcm)/2; i++ {
+		sample := amplitude * math.Sin(2*math.Pi*frequency*float64(i)/16000)
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(sample*32767)))
+	}
+	return pcm
+}
+
+func TestPitchesEstimatesVoiceFrequency(t *testing.T) {
+	t.Parallel()
+
+	for _, frequency := range []float64{110, 220} {
+		pitches := Pitches(tone(frequency, 0.5, 0.2), 16000)
+		if len(pitches) != 5 {
+			t.Fatalf("expected a pitch per 40ms frame, got %d", len(pitches))
+		}
+		for _, pitch := range pitches {
+			if math.Abs(pitch-frequency) > frequency*0.03 {
+				t.Fatalf("expected %.0f Hz, got %v", frequency, pitches)
+			}
+		}
+	}
+
+	for _, pitch := range Pitches(tone(220, 0.001, 0.2), 16000) {
+		if pitch != 0 {
+			t.Fatalf("expected quiet audio to be unvoiced, got %f", pitch)
+		}
+	}
+}
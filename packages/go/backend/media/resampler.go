@@ -0,0 +1,215 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// DefaultResamplerTaps is the number of zero crossings of the sinc on each
+// side of a Resampler's interpolation kernel.
+const DefaultResamplerTaps = 16
+
+// maxResamplerPhases bounds the kernel table a Resampler precomputes. Rate
+// pairs needing more phases, which no common rates do, evaluate the kernel
+// per sample instead.
+const maxResamplerPhases = 4096
+
+// ResamplerConfig configures a Resampler.
+type ResamplerConfig struct {
+	// InputRate and OutputRate are the sample rates, in Hz, converted
+	// between.
+	InputRate, OutputRate int
+	// Channels is the number of interleaved channels. Defaults to 1.
+	Channels int
+	// Taps is the number of zero crossings of the kernel on each side.
+	// More taps give a sharper cutoff at the cost of more work per sample.
+	// Defaults to DefaultResamplerTaps.
+	Taps int
+}
+
+// Resampler converts 16-bit little-endian interleaved PCM between sample
+// rates by windowed-sinc interpolation, without an external tool such as
+// ffmpeg. When downsampling, the kernel's cutoff is lowered to the output
+// Nyquist frequency so that content above it is filtered out rather than
+// aliased into speech.
+//
+// The resampler keeps the tail of each block as history for the next, so a
+// stream may be fed in blocks of any size, split anywhere, with the same
+// result as feeding it at once. Output lags the input by half the kernel
+// until Flush. A Resampler is not safe for concurrent use.
+type Resampler struct {
+	cfg ResamplerConfig
+	// Output sample n is interpolated at input position n*step/phases.
+	phases, step int64
+	// scale is the kernel's cutoff relative to the input Nyquist
+	// frequency, and half is how many input samples on each side of an
+	// output sample the kernel reaches.
+	scale float64
+	half  int64
+	// kernels holds the kernel of every phase, when precomputed.
+	kernels [][]float64
+
+	// history holds the input samples of every channel from input position
+	// base on, and next is the index of the next output sample.
+	history [][]float64
+	base    int64
+	next    int64
+	// partial holds a trailing odd byte, or incomplete frame, of input.
+	partial []byte
+}
+
+// NewResampler returns a resampler for one stream.
+func NewResampler(cfg ResamplerConfig) (*Resampler, error) {
+	if cfg.InputRate <= 0 || cfg.OutputRate <= 0 {
+		return nil, errors.New("input and output sample rates are required")
+	}
+	if cfg.Channels <= 0 {
+		cfg.Channels = 1
+	}
+	if cfg.Taps <= 0 {
+		cfg.Taps = DefaultResamplerTaps
+	}
+	divisor := int64(gcd(cfg.InputRate, cfg.OutputRate))
+	r := &Resampler{
+		cfg:     cfg,
+		phases:  int64(cfg.OutputRate) / divisor,
+		step:    int64(cfg.InputRate) / divisor,
+		scale:   math.Min(1, float64(cfg.OutputRate)/float64(cfg.InputRate)),
+		history: make([][]float64, cfg.Channels),
+	}
+	r.half = int64(math.Ceil(float64(cfg.Taps) / r.scale))
+	// The stream is preceded by silence, so the first output sample is
+	// centred on the first input sample.
+	r.base = -r.half
+	for channel := range r.history {
+		r.history[channel] = make([]float64, r.half)
+	}
+	if r.phases <= maxResamplerPhases {
+		r.kernels = make([][]float64, r.phases)
+		for phase := range r.kernels {
+			r.kernels[phase] = r.kernel(float64(phase) / float64(r.phases))
+		}
+	}
+	return r, nil
+}
+
+// Process resamples a block of the stream and returns the output it
+// completes.
+func (r *Resampler) Process(pcm []byte) []byte {
+	frameSize := 2 * r.cfg.Channels
+	if len(r.partial) > 0 {
+		pcm = append(r.partial, pcm...)
+		r.partial = nil
+	}
+	frames := len(pcm) / frameSize
+	if rest := pcm[frames*frameSize:]; len(rest) > 0 {
+		r.partial = append([]byte(nil), rest...)
+	}
+	for frame := 0; frame < frames; frame++ {
+		for channel := range r.history {
+			sample := int16(binary.LittleEndian.Uint16(pcm[frame*frameSize+2*channel:]))
+			r.history[channel] = append(r.history[channel], float64(sample)/32768)
+		}
+	}
+	return r.drain()
+}
+
+// Flush returns the output still held back for the end of the stream,
+// after which the resampler starts a new stream.
+func (r *Resampler) Flush() []byte {
+	// Output continues up to the position of the last input sample.
+	end := r.base + int64(len(r.history[0]))
+	for channel := range r.history {
+		r.history[channel] = append(r.history[channel], make([]float64, r.half)...)
+	}
+	out := r.drainUntil(end)
+	fresh, _ := NewResampler(r.cfg)
+	*r = *fresh
+	return out
+}
+
+// drain interpolates every output sample the history covers.
+func (r *Resampler) drain() []byte {
+	return r.drainUntil(math.MaxInt64)
+}
+
+// drainUntil interpolates the output samples the history covers whose
+// position is before end, then forgets the history no later output needs.
+func (r *Resampler) drainUntil(end int64) []byte {
+	available := r.base + int64(len(r.history[0]))
+	var out []byte
+	for {
+		position := r.next * r.step / r.phases
+		if position >= end || position+r.half >= available {
+			break
+		}
+		phase := r.next * r.step % r.phases
+		kernel := r.kernelFor(phase)
+		start := position - r.half + 1 - r.base
+		for channel := range r.history {
+			var sum float64
+			for i, weight := range kernel {
+				sum += weight * r.history[channel][start+int64(i)]
+			}
+			sample := math.Max(math.Min(math.Round(sum*32768), math.MaxInt16), math.MinInt16)
+			out = binary.LittleEndian.AppendUint16(out, uint16(int16(sample)))
+		}
+		r.next++
+	}
+
+	keep := r.next*r.step/r.phases - r.half + 1
+	if drop := keep - r.base; drop > 0 {
+		for channel := range r.history {
+			r.history[channel] = append(r.history[channel][:0], r.history[channel][drop:]...)
+		}
+		r.base = keep
+	}
+	return out
+}
+
+func (r *Resampler) kernelFor(phase int64) []float64 {
+	if r.kernels != nil {
+		return r.kernels[phase]
+	}
+	return r.kernel(float64(phase) / float64(r.phases))
+}
+
+// kernel returns the weights of the 2*half input samples around an output
+// sample that lies fraction of the way past the last of the first half.
+// The sinc is Blackman-windowed and the weights normalized to sum to one,
+// so constant signals pass unchanged.
+func (r *Resampler) kernel(fraction float64) []float64 {
+	weights := make([]float64, 2*r.half)
+	width := float64(r.half)
+	var total float64
+	for i := range weights {
+		x := float64(int64(i)-r.half+1) - fraction
+		weight := r.scale * sinc(r.scale*x)
+		if t := x / width; t > -1 && t < 1 {
+			weight *= 0.42 + 0.5*math.Cos(math.Pi*t) + 0.08*math.Cos(2*math.Pi*t)
+		} else {
+			weight = 0
+		}
+		weights[i] = weight
+		total += weight
+	}
+	for i := range weights {
+		weights[i] /= total
+	}
+	return weights
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
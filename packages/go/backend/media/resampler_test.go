@@ -0,0 +1,94 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// sinePCM returns seconds of a mono sine at frequency with the given peak
+// amplitude, sampled at rate.
+func sinePCM(rate int, frequency, peak, seconds float64) []byte {
+	samples := int(float64(rate) * seconds)
+	pcm := make([]byte, 2*samples)
+	for i := 0; i < samples; i++ {
+		sample := peak * math.Sin(2*math.Pi*frequency*float64(i)/float64(rate))
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(math.Round(sample*32767))))
+	}
+	return pcm
+}
+
+func resampleAll(t *testing.T, cfg ResamplerConfig, pcm []byte) []byte {
+	t.Helper()
+	resampler, err := NewResampler(cfg)
+	if err != nil {
+		t.Fatalf("NewResampler: %v", err)
+	}
+	return append(resampler.Process(pcm), resampler.Flush()...)
+}
+
+func TestResamplerConvertsToSpeechRate(t *testing.T) {
+	for _, rate := range []int{48000, 44100, 22050, 8000} {
+		in := sinePCM(rate, 440, 0.5, 1)
+		out := resampleAll(t, ResamplerConfig{InputRate: rate, OutputRate: 16000}, in)
+		if samples := len(out) / 2; samples != 16000 {
+			t.Fatalf("%dHz: got %d samples, want 16000", rate, samples)
+		}
+		// Away from the edges, the output is the same sine sampled at
+		// 16kHz.
+		want := sinePCM(16000, 440, 0.5, 1)
+		var worst float64
+		for i := 1000; i < 15000; i++ {
+			got := float64(int16(binary.LittleEndian.Uint16(out[2*i:]))) / 32768
+			expected := float64(int16(binary.LittleEndian.Uint16(want[2*i:]))) / 32768
+			worst = math.Max(worst, math.Abs(got-expected))
+		}
+		if worst > 0.005 {
+			t.Fatalf("%dHz: output deviates from the sine by %.4f", rate, worst)
+		}
+	}
+}
+
+func TestResamplerFiltersAliases(t *testing.T) {
+	// A 10kHz tone is above the 8kHz Nyquist frequency of 16kHz audio and
+	// must not fold back into the speech band.
+	out := resampleAll(t, ResamplerConfig{InputRate: 48000, OutputRate: 16000}, sinePCM(48000, 10000, 0.5, 1))
+	if level := decibels(PCMRMS(out[2000 : len(out)-2000])); level > -60 {
+		t.Fatalf("alias at %.1f dBFS", level)
+	}
+}
+
+func TestResamplerStreamsInBlocks(t *testing.T) {
+	cfg := ResamplerConfig{InputRate: 44100, OutputRate: 16000, Channels: 2}
+	in := make([]byte, 0, 4*44100)
+	left, right := sinePCM(44100, 300, 0.4, 1), sinePCM(44100, 1200, 0.2, 1)
+	for i := 0; i < len(left); i += 2 {
+		in = append(in, left[i:i+2]...)
+		in = append(in, right[i:i+2]...)
+	}
+	whole := resampleAll(t, cfg, in)
+
+	resampler, err := NewResampler(cfg)
+	if err != nil {
+		t.Fatalf("NewResampler: %v", err)
+	}
+	var blocks []byte
+	// Block sizes that split frames and samples.
+	for offset, size := 0, 1; offset < len(in); offset, size = offset+size, size%997+7 {
+		blocks = append(blocks, resampler.Process(in[offset:min(offset+size, len(in))])...)
+	}
+	blocks = append(blocks, resampler.Flush()...)
+	if !bytes.Equal(whole, blocks) {
+		t.Fatalf("block-wise output differs: %d bytes vs %d", len(blocks), len(whole))
+	}
+	if len(whole) != 4*16000 {
+		t.Fatalf("got %d bytes of stereo output, want %d", len(whole), 4*16000)
+	}
+}
+
+func TestNewResamplerRequiresRates(t *testing.T) {
+	if _, err := NewResampler(ResamplerConfig{OutputRate: 16000}); err == nil {
+		t.Fatal("expected an error without an input rate")
+	}
+}
@@ -0,0 +1,81 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// The frames TimeStretch overlaps, and how far it searches around the
+// nominal position of each frame for the best continuation.
+const (
+	stretchFrame  = 30 * time.Millisecond
+	stretchSearch = 10 * time.Millisecond
+)
+
+// TimeStretch changes the tempo of 16-bit little-endian mono PCM at
+// sampleRate by rate without changing its pitch: a rate of 1.25 plays the
+// audio in 80% of the time. It overlaps windowed frames of the input at a
+// hop of rate times the output hop, shifting each frame by up to
+// stretchSearch to where it best continues the previous one (WSOLA), so
+// that voiced speech keeps its periods intact.
+func TimeStretch(pcm []byte, sampleRate int, rate float64) []byte {
+	frame := int(time.Duration(sampleRate) * stretchFrame / time.Second &^ 1)
+	search := int(time.Duration(sampleRate) * stretchSearch / time.Second)
+	samples := make([]float64, len(pcm)/2)
+	for i := range samples {
+		samples[i] = float64(int16(binary.LittleEndian.Uint16(pcm[2*i:])))
+	}
+	if rate <= 0 || rate == 1 || frame < 4 || len(samples) < frame {
+		return append([]byte(nil), pcm[:2*len(samples)]...)
+	}
+
+	hop := frame / 2
+	window := make([]float64, frame)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frame))
+	}
+	at := func(i int) float64 {
+		if i < 0 || i >= len(samples) {
+			return 0
+		}
+		return samples[i]
+	}
+
+	length := int(float64(len(samples)) / rate)
+	mixed := make([]float64, length+frame)
+	weights := make([]float64, length+frame)
+	previous := 0
+	for start := 0; start < length; start += hop {
+		position := int(float64(start) * rate)
+		if start > 0 {
+			// The frame that best matches how the previous frame goes on.
+			natural := previous + hop
+			best := math.Inf(-1)
+			for candidate := max(0, position-search); candidate <= position+search; candidate++ {
+				var correlation float64
+				for i := 0; i < hop; i++ {
+					correlation += at(natural+i) * at(candidate+i)
+				}
+				if correlation > best {
+					best, position = correlation, candidate
+				}
+			}
+		}
+		for i := 0; i < frame; i++ {
+			mixed[start+i] += window[i] * at(position+i)
+			weights[start+i] += window[i]
+		}
+		previous = position
+	}
+
+	out := make([]byte, 2*length)
+	for i := 0; i < length; i++ {
+		sample := mixed[i]
+		if weights[i] > 1e-6 {
+			sample /= weights[i]
+		}
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(int16(max(math.MinInt16, min(math.MaxInt16, math.Round(sample))))))
+	}
+	return out
+}
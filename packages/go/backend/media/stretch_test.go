@@ -0,0 +1,30 @@
+package media
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestTimeStretchKeepsPitch(t *testing.T) {
+	t.Parallel()
+
+	source := tone(220, 0.5, 1)
+	for _, rate := range []float64{1.25, 0.8} {
+		stretched := TimeStretch(source, 16000, rate)
+		if want := 2 * int(16000/rate); len(stretched) != want {
+			t.Fatalf("expected %d bytes at rate %v, got %d", want, rate, len(stretched))
+		}
+		// The edges fade in and out; the rest keeps the tone.
+		pitches := Pitches(stretched, 16000)
+		for _, pitch := range pitches[1 : len(pitches)-1] {
+			if math.Abs(pitch-220) > 220*0.03 {
+				t.Fatalf("expected 220 Hz at rate %v, got %v", rate, pitches)
+			}
+		}
+	}
+
+	if unchanged := TimeStretch(source[:101], 16000, 1); !bytes.Equal(unchanged, source[:100]) {
+		t.Fatal("expected a rate of 1 to leave the audio unchanged")
+	}
+}
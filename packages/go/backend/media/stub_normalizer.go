@@ -3,6 +3,7 @@ package media
 import (
 	"context"
 	"io"
+	"sync"
 	"time"
 )
 
@@ -35,6 +36,9 @@ func DefaultStubNormalizerConfig() *StubNormalizerConfig {
 // StubNormalizer is a test implementation that emits deterministic audio chunks.
 type StubNormalizer struct {
 	config *StubNormalizerConfig
+
+	mu      sync.Mutex
+	formats []InputFormat
 }
 
 // NewStubNormalizer creates a new stub normalizer with the given config.
@@ -100,6 +104,22 @@ func (s *StubNormalizer) Normalize(ctx context.Context, source io.Reader) (<-cha
 	return out, nil
 }
 
+// NormalizeFormat records format and emits the same chunks as Normalize.
+func (s *StubNormalizer) NormalizeFormat(ctx context.Context, source io.Reader, format InputFormat) (<-chan AudioChunk, error) {
+	s.mu.Lock()
+	s.formats = append(s.formats, format)
+	s.mu.Unlock()
+	return s.Normalize(ctx, source)
+}
+
+// Formats returns the input formats NormalizeFormat was called with, in
+// order.
+func (s *StubNormalizer) Formats() []InputFormat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]InputFormat(nil), s.formats...)
+}
+
 // Health returns the health status of the stub normalizer.
 func (s *StubNormalizer) Health() HealthStatus {
 	return HealthStatus{
@@ -114,3 +114,26 @@ func TestStubNormalizer_DefaultConfig(t *testing.T) {
 		t.Errorf("expected default sample rate 16000, got %d", normalizer.config.SampleRate)
 	}
 }
+
+func TestStubNormalizer_NormalizeFormat(t *testing.T) {
+	t.Parallel()
+
+	normalizer := NewStubNormalizer(&StubNormalizerConfig{ChunkDuration: 10 * time.Millisecond, TotalChunks: 2, SampleRate: 16000})
+	var _ FormatNormalizer = normalizer
+
+	format := InputFormat{Container: "mpegts", Codecs: []string{"mp4a.40.2"}, Live: true}
+	chunks, err := normalizer.NormalizeFormat(context.Background(), bytes.NewReader(nil), format)
+	if err != nil {
+		t.Fatalf("NormalizeFormat failed: %v", err)
+	}
+	count := 0
+	for range chunks {
+		count++
+	}
+	if count != 2 {
+		t.Errorf("expected 2 chunks, got %d", count)
+	}
+	if formats := normalizer.Formats(); len(formats) != 1 || formats[0].Container != "mpegts" || !formats[0].Live {
+		t.Errorf("expected the format to be recorded, got %+v", formats)
+	}
+}
@@ -0,0 +1,206 @@
+package media
+
+import (
+	"sort"
+	"time"
+)
+
+// Defaults of WindowConfig.
+const (
+	// DefaultWindowSize is the duration of each window.
+	DefaultWindowSize = 2 * time.Second
+	// windowTolerance is how far a chunk may start from where the audio
+	// buffered so far ends and still continue it.
+	windowTolerance = 20 * time.Millisecond
+)
+
+// WindowConfig configures a Windower. Zero values fall back to the
+// defaults.
+type WindowConfig struct {
+	// Size is the duration of every window.
+	Size time.Duration
+	// Overlap is how much audio at the end of a window is repeated at the
+	// start of the next, giving recognition context across window
+	// boundaries. It defaults to none; an overlap of Size or more is cut
+	// to half of Size.
+	Overlap time.Duration
+}
+
+// WindowAlignment describes how a window was cut from the audio stream, so
+// recognizers can line its results up with those of the windows around it.
+type WindowAlignment struct {
+	// Index numbers the windows of a stream from zero.
+	Index int64 `json:"index"`
+	// Overlap is the duration at the start of the window that repeats the
+	// end of the previous window.
+	Overlap time.Duration `json:"overlap,omitempty"`
+	// Padding is the duration of silence added at the end of the window to
+	// fill it, when the stream ended or broke off before it was full.
+	Padding time.Duration `json:"padding,omitempty"`
+	// Discontinuity is set on the first window after a gap in the audio or
+	// a change of format. It repeats nothing of the window before it.
+	Discontinuity bool `json:"discontinuity,omitempty"`
+}
+
+// Windower re-frames audio chunks of any size into windows of a fixed
+// duration, as streaming recognizers expect, each starting cfg.Size minus
+// cfg.Overlap after the one before. Every window carries a WindowAlignment.
+//
+// Audio that does not continue the audio before it, because of a gap in its
+// timestamps or a change of sample rate or channels, ends the window being
+// filled: it is padded with silence and emitted, and the next window starts
+// afresh without overlap. The last window of a stream is padded the same
+// way. A window's Loudness and Gain are those of the last chunk in it, and
+// its Source that of the chunk it starts in.
+//
+// Chunks must carry 16-bit little-endian interleaved PCM. A Windower is not
+// safe for concurrent use.
+type Windower struct {
+	cfg WindowConfig
+
+	sampleRate, channels int
+	// pending holds the audio of the window being filled, starting at
+	// start; its first overlap bytes were emitted in the previous window.
+	pending []byte
+	start   time.Duration
+	overlap int
+	// last is the latest chunk pushed, whose level the next window
+	// reports.
+	last AudioChunk
+	// sources holds where the chunks in pending start and the source
+	// chunks they came from, oldest first.
+	sources []windowSource
+
+	started       bool
+	index         int64
+	discontinuity bool
+}
+
+type windowSource struct {
+	at     time.Duration
+	source *SourceChunk
+}
+
+// NewWindower returns a windower for one stream.
+func NewWindower(cfg WindowConfig) *Windower {
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultWindowSize
+	}
+	if cfg.Overlap < 0 {
+		cfg.Overlap = 0
+	}
+	if cfg.Overlap >= cfg.Size {
+		cfg.Overlap = cfg.Size / 2
+	}
+	return &Windower{cfg: cfg}
+}
+
+// Push adds chunk to the window being filled and returns the windows,
+// possibly none, that it completes.
+func (w *Windower) Push(chunk AudioChunk) []AudioChunk {
+	if chunk.SampleRate <= 0 || chunk.Channels <= 0 {
+		return nil
+	}
+	var out []AudioChunk
+	if w.started && (chunk.SampleRate != w.sampleRate || chunk.Channels != w.channels || abs(chunk.Timestamp-w.end()) > windowTolerance) {
+		out = w.Flush()
+		w.discontinuity = true
+	}
+	if !w.started || len(w.pending) == 0 {
+		w.sampleRate, w.channels = chunk.SampleRate, chunk.Channels
+		w.start, w.started = chunk.Timestamp, true
+	}
+	if chunk.Source != nil {
+		w.sources = append(w.sources, windowSource{at: w.end(), source: chunk.Source})
+	}
+	w.pending = append(w.pending, chunk.PCMData[:len(chunk.PCMData)/w.frameSize()*w.frameSize()]...)
+	w.last = chunk
+
+	size, step := w.bytes(w.cfg.Size), w.bytes(w.cfg.Size-w.cfg.Overlap)
+	for len(w.pending) >= size {
+		out = append(out, w.window(w.pending[:size], 0))
+		// The overlap stays buffered as the start of the next window.
+		w.pending = append(w.pending[:0], w.pending[step:]...)
+		w.start += w.duration(step)
+		w.overlap = size - step
+	}
+	return out
+}
+
+// Flush pads the window being filled with silence and returns it, unless it
+// holds nothing beyond the overlap already emitted. Audio pushed afterwards
+// starts a new window.
+func (w *Windower) Flush() []AudioChunk {
+	defer func() {
+		w.pending, w.overlap, w.sources = w.pending[:0], 0, nil
+	}()
+	if len(w.pending) <= w.overlap {
+		return nil
+	}
+	size := w.bytes(w.cfg.Size)
+	padding := size - len(w.pending)
+	pcm := make([]byte, size)
+	copy(pcm, w.pending)
+	window := w.window(pcm, padding)
+	// The next audio continues from the end of the real audio.
+	w.start += w.duration(len(w.pending))
+	return []AudioChunk{window}
+}
+
+// window returns the next window holding pcm, whose last padding bytes are
+// silence.
+func (w *Windower) window(pcm []byte, padding int) AudioChunk {
+	window := AudioChunk{
+		Timestamp:  w.start,
+		SampleRate: w.sampleRate,
+		Channels:   w.channels,
+		PCMData:    append([]byte(nil), pcm...),
+		RMS:        PCMRMS(pcm),
+		Duration:   w.duration(len(pcm)),
+		Loudness:   w.last.Loudness,
+		Gain:       w.last.Gain,
+		Window: &WindowAlignment{
+			Index:         w.index,
+			Overlap:       w.duration(w.overlap),
+			Padding:       w.duration(padding),
+			Discontinuity: w.discontinuity,
+		},
+		Source: w.source(),
+	}
+	w.index++
+	w.discontinuity = false
+	return window
+}
+
+// source returns the source chunk the window being filled starts in,
+// forgetting the chunks before it.
+func (w *Windower) source() *SourceChunk {
+	index := sort.Search(len(w.sources), func(i int) bool { return w.sources[i].at > w.start }) - 1
+	if index < 0 {
+		return nil
+	}
+	w.sources = w.sources[index:]
+	source := *w.sources[0].source
+	if !source.Time.IsZero() {
+		source.Time = source.Time.Add(w.start - w.sources[0].at)
+	}
+	return &source
+}
+
+// end returns where the audio pushed so far ends.
+func (w *Windower) end() time.Duration {
+	return w.start + w.duration(len(w.pending))
+}
+
+func (w *Windower) frameSize() int {
+	return 2 * w.channels
+}
+
+// bytes returns the size of d of audio, in whole frames.
+func (w *Windower) bytes(d time.Duration) int {
+	return max(int(d*time.Duration(w.sampleRate)/time.Second), 1) * w.frameSize()
+}
+
+func (w *Windower) duration(bytes int) time.Duration {
+	return time.Duration(bytes/w.frameSize()) * time.Second / time.Duration(w.sampleRate)
+}
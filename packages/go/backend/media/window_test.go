@@ -0,0 +1,112 @@
+package media
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// windowChunk returns 100ms of 1kHz mono audio at ms whose samples are all
+// value.
+func windowChunk(ms int, value int16) AudioChunk {
+	pcm := make([]byte, 200)
+	for i := 0; i < len(pcm); i += 2 {
+		binary.LittleEndian.PutUint16(pcm[i:], uint16(value))
+	}
+	return AudioChunk{Timestamp: time.Duration(ms) * time.Millisecond, SampleRate: 1000, Channels: 1, PCMData: pcm, Duration: 100 * time.Millisecond}
+}
+
+func TestWindowerOverlapsWindows(t *testing.T) {
+	t.Parallel()
+
+	windower := NewWindower(WindowConfig{Size: 250 * time.Millisecond, Overlap: 50 * time.Millisecond})
+	var windows []AudioChunk
+	for i := 0; i < 10; i++ {
+		windows = append(windows, windower.Push(windowChunk(100*i, int16(i+1)))...)
+	}
+	windows = append(windows, windower.Flush()...)
+
+	if len(windows) != 5 {
+		t.Fatalf("expected 5 windows, got %d", len(windows))
+	}
+	for i, window := range windows {
+		if window.Timestamp != time.Duration(200*i)*time.Millisecond || window.Duration != 250*time.Millisecond || len(window.PCMData) != 500 {
+			t.Fatalf("window %d: unexpected framing %v+%v, %d bytes", i, window.Timestamp, window.Duration, len(window.PCMData))
+		}
+		alignment := window.Window
+		if alignment == nil || alignment.Index != int64(i) || alignment.Discontinuity {
+			t.Fatalf("window %d: unexpected alignment %+v", i, alignment)
+		}
+		if overlap := time.Duration(min(i, 1)) * 50 * time.Millisecond; alignment.Overlap != overlap {
+			t.Fatalf("window %d: expected %v overlap, got %v", i, overlap, alignment.Overlap)
+		}
+		// The window starts within the chunk pushed at its timestamp.
+		if first := int16(binary.LittleEndian.Uint16(window.PCMData)); first != int16(2*i+1) {
+			t.Fatalf("window %d: expected to start with chunk %d, got %d", i, 2*i+1, first)
+		}
+	}
+	last := windows[4]
+	if last.Window.Padding != 50*time.Millisecond {
+		t.Fatalf("expected the last window padded by 50ms, got %v", last.Window.Padding)
+	}
+	if tail := binary.LittleEndian.Uint16(last.PCMData[len(last.PCMData)-2:]); tail != 0 {
+		t.Fatalf("expected silent padding, got %d", tail)
+	}
+}
+
+func TestWindowerBreaksOnDiscontinuities(t *testing.T) {
+	t.Parallel()
+
+	windower := NewWindower(WindowConfig{Size: 250 * time.Millisecond})
+	var windows []AudioChunk
+	for _, chunk := range []AudioChunk{windowChunk(0, 1), windowChunk(100, 1), windowChunk(500, 2), windowChunk(600, 2)} {
+		windows = append(windows, windower.Push(chunk)...)
+	}
+	resampled := windowChunk(700, 3)
+	resampled.SampleRate = 2000
+	windows = append(windows, windower.Push(resampled)...)
+	windows = append(windows, windower.Flush()...)
+
+	want := []struct {
+		timestamp time.Duration
+		padding   time.Duration
+		rate      int
+		broken    bool
+	}{
+		{timestamp: 0, padding: 50 * time.Millisecond, rate: 1000},
+		{timestamp: 500 * time.Millisecond, padding: 50 * time.Millisecond, rate: 1000, broken: true},
+		{timestamp: 700 * time.Millisecond, padding: 200 * time.Millisecond, rate: 2000, broken: true},
+	}
+	if len(windows) != len(want) {
+		t.Fatalf("expected %d windows, got %d", len(want), len(windows))
+	}
+	for i, expected := range want {
+		window := windows[i]
+		if window.Timestamp != expected.timestamp || window.SampleRate != expected.rate || window.Duration != 250*time.Millisecond {
+			t.Fatalf("window %d: unexpected framing %v+%v at %d Hz", i, window.Timestamp, window.Duration, window.SampleRate)
+		}
+		if window.Window.Index != int64(i) || window.Window.Padding != expected.padding || window.Window.Discontinuity != expected.broken || window.Window.Overlap != 0 {
+			t.Fatalf("window %d: unexpected alignment %+v", i, window.Window)
+		}
+	}
+}
+
+func TestWindowerCarriesSources(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	windower := NewWindower(WindowConfig{Size: 150 * time.Millisecond})
+	var windows []AudioChunk
+	for i := 0; i < 3; i++ {
+		chunk := windowChunk(100*i, 1)
+		chunk.Source = &SourceChunk{Sequence: int64(i), Time: base.Add(time.Duration(i) * 100 * time.Millisecond)}
+		windows = append(windows, windower.Push(chunk)...)
+	}
+	if len(windows) != 2 {
+		t.Fatalf("expected 2 windows, got %d", len(windows))
+	}
+	// The second window starts halfway into the second chunk.
+	if source := windows[1].Source; source == nil || source.Sequence != 1 || !source.Time.Equal(base.Add(150*time.Millisecond)) {
+		t.Fatalf("unexpected source %+v", source)
+	}
+}
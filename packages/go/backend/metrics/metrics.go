@@ -0,0 +1,457 @@
+// Package metrics keeps counters, gauges, and histograms in a Registry that
+// renders them, along with any other Collector, in the Prometheus text
+// exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram upper bounds, in seconds, for request
+// and operation latencies.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collector writes metrics in the Prometheus text exposition format. The
+// instruments of this package are collectors, and so are the metrics of the
+// pipeline and status packages that are built from them.
+type Collector interface {
+	WriteMetrics(w io.Writer) error
+}
+
+// Registry renders the collectors registered with it in the order they
+// were registered. A nil *Registry registers nothing, and the instruments
+// it returns record nothing, so that instrumentation can be left out.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+	named      map[string]Collector
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{named: make(map[string]Collector)}
+}
+
+// Register adds collector to the metrics r writes.
+func (r *Registry) Register(collector Collector) {
+	if r == nil || collector == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collector)
+}
+
+// WriteMetrics writes the metrics of every registered collector.
+func (r *Registry) WriteMetrics(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, collector := range collectors {
+		if err := collector.WriteMetrics(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewCounter returns the counter called name, partitioned by labels,
+// registering it unless an instrument of that name was registered already,
+// which is then returned when it is a counter too.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	if r == nil {
+		return nil
+	}
+	return instrument(r, name, func() *Counter { return NewCounter(name, help, labels...) })
+}
+
+// NewGauge returns the gauge called name, partitioned by labels, the way
+// NewCounter does.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	if r == nil {
+		return nil
+	}
+	return instrument(r, name, func() *Gauge { return NewGauge(name, help, labels...) })
+}
+
+// NewGaugeFunc registers the gauge called name, whose value is sampled from
+// value whenever metrics are written.
+func (r *Registry) NewGaugeFunc(name, help string, value func() float64) {
+	if r == nil {
+		return
+	}
+	instrument(r, name, func() *gaugeFunc { return &gaugeFunc{name: name, help: help, value: value} })
+}
+
+// NewHistogram returns the histogram called name, counting observations
+// into buckets, their upper bounds in ascending order, and partitioned by
+// labels, the way NewCounter does. Nil buckets fall back to
+// DefaultBuckets.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if r == nil {
+		return nil
+	}
+	return instrument(r, name, func() *Histogram { return NewHistogram(name, help, buckets, labels...) })
+}
+
+// NewSummary returns the summary called name, partitioned by labels, the
+// way NewCounter does.
+func (r *Registry) NewSummary(name, help string, labels ...string) *Summary {
+	if r == nil {
+		return nil
+	}
+	return instrument(r, name, func() *Summary { return NewSummary(name, help, labels...) })
+}
+
+// instrument returns the collector registered under name, or registers the
+// one made by create. A collector of another type under the name is kept,
+// and the one made is left unregistered.
+func instrument[T Collector](r *Registry, name string, create func() T) T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.named[name].(T); ok {
+		return existing
+	}
+	created := create()
+	if _, taken := r.named[name]; !taken {
+		r.named[name] = created
+		r.collectors = append(r.collectors, created)
+	}
+	return created
+}
+
+// Handler serves the metrics of collector in the Prometheus text
+// exposition format.
+func Handler(collector Collector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := collector.WriteMetrics(&buf); err != nil {
+			http.Error(w, fmt.Sprintf("write metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = buf.WriteTo(w)
+	}
+}
+
+// family holds the series of an instrument, keyed by their label values.
+// Observations with other than one value per label are dropped.
+type family struct {
+	name, help, kind string
+	labels           []string
+
+	mu     sync.Mutex
+	series map[string]*Sample
+}
+
+// Sample is a copy of one series of an instrument: its label values and
+// value, or the observations of a histogram or summary, whose Counts are
+// cumulative per bucket.
+type Sample struct {
+	Values []string
+	Value  float64
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+func newFamily(name, help, kind string, labels []string) family {
+	return family{name: name, help: help, kind: kind, labels: append([]string(nil), labels...), series: make(map[string]*Sample)}
+}
+
+// update applies change to the series of values, creating it if needed.
+func (f *family) update(values []string, change func(*Sample)) {
+	if len(values) != len(f.labels) {
+		return
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &Sample{Values: append([]string(nil), values...)}
+		f.series[key] = s
+	}
+	change(s)
+}
+
+// Delete removes the series of values, such as that of a session that
+// ended.
+func (f *family) Delete(values ...string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.series, strings.Join(values, "\xff"))
+}
+
+// DeletePrefix removes every series whose leading label values are values,
+// such as all series of a session whatever their other labels.
+func (f *family) DeletePrefix(values ...string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, s := range f.series {
+		if len(s.Values) >= len(values) && slices.Equal(s.Values[:len(values)], values) {
+			delete(f.series, key)
+		}
+	}
+}
+
+// Samples returns copies of the series ordered by label values.
+func (f *family) Samples() []Sample {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	samples := make([]Sample, 0, len(f.series))
+	for _, s := range f.series {
+		copied := *s
+		copied.Values = append([]string(nil), s.Values...)
+		copied.Counts = append([]uint64(nil), s.Counts...)
+		samples = append(samples, copied)
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].Values, "\xff") < strings.Join(samples[j].Values, "\xff")
+	})
+	return samples
+}
+
+// header writes the HELP and TYPE lines of the family.
+func (f *family) header(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	return err
+}
+
+// labelPairs renders the labels of values, with extra pairs appended, as
+// the braces of a sample, or nothing without any.
+func (f *family) labelPairs(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, value := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", f.labels[i], value))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// writeValues writes a sample of every series.
+func (f *family) writeValues(w io.Writer) error {
+	if err := f.header(w); err != nil {
+		return err
+	}
+	for _, s := range f.Samples() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelPairs(s.Values), formatValue(s.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Counter is a value that only goes up, such as requests served. A nil
+// *Counter records nothing.
+type Counter struct {
+	family
+}
+
+// NewCounter returns an unregistered counter called name, partitioned by
+// labels, for collectors that write it themselves.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{family: newFamily(name, help, "counter", labels)}
+}
+
+// Inc adds one to the series of values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta to the series of values. Negative deltas are dropped.
+func (c *Counter) Add(delta float64, values ...string) {
+	if c == nil || delta < 0 {
+		return
+	}
+	c.update(values, func(s *Sample) { s.Value += delta })
+}
+
+// WriteMetrics writes the counter's series.
+func (c *Counter) WriteMetrics(w io.Writer) error {
+	return c.writeValues(w)
+}
+
+// Gauge is a value that goes up and down, such as sessions running. A nil
+// *Gauge records nothing.
+type Gauge struct {
+	family
+}
+
+// NewGauge returns an unregistered gauge the way NewCounter does.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{family: newFamily(name, help, "gauge", labels)}
+}
+
+// Set sets the series of values to value.
+func (g *Gauge) Set(value float64, values ...string) {
+	if g == nil {
+		return
+	}
+	g.update(values, func(s *Sample) { s.Value = value })
+}
+
+// Add adds delta, which may be negative, to the series of values.
+func (g *Gauge) Add(delta float64, values ...string) {
+	if g == nil {
+		return
+	}
+	g.update(values, func(s *Sample) { s.Value += delta })
+}
+
+// WriteMetrics writes the gauge's series.
+func (g *Gauge) WriteMetrics(w io.Writer) error {
+	return g.writeValues(w)
+}
+
+// gaugeFunc is a gauge without labels sampled when metrics are written.
+type gaugeFunc struct {
+	name, help string
+	value      func() float64
+}
+
+func (g *gaugeFunc) WriteMetrics(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatValue(g.value()))
+	return err
+}
+
+// Histogram counts observations, such as latencies, into buckets. A nil
+// *Histogram records nothing.
+type Histogram struct {
+	family
+	buckets []float64
+}
+
+// NewHistogram returns an unregistered histogram the way NewCounter does,
+// its buckets falling back to DefaultBuckets.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &Histogram{family: newFamily(name, help, "histogram", labels), buckets: append([]float64(nil), buckets...)}
+}
+
+// Observe counts value into the series of values.
+func (h *Histogram) Observe(value float64, values ...string) {
+	if h == nil {
+		return
+	}
+	h.update(values, func(s *Sample) {
+		if s.Counts == nil {
+			s.Counts = make([]uint64, len(h.buckets))
+		}
+		for i, upper := range h.buckets {
+			if value <= upper {
+				s.Counts[i]++
+			}
+		}
+		s.Count++
+		s.Sum += value
+	})
+}
+
+// ObserveDuration counts d, in seconds, into the series of values.
+func (h *Histogram) ObserveDuration(d time.Duration, values ...string) {
+	h.Observe(d.Seconds(), values...)
+}
+
+// WriteMetrics writes the histogram's series, their buckets cumulative.
+func (h *Histogram) WriteMetrics(w io.Writer) error {
+	if err := h.header(w); err != nil {
+		return err
+	}
+	for _, s := range h.Samples() {
+		for i, upper := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(s.Values, "le", formatValue(upper)), s.Counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(s.Values, "le", "+Inf"), s.Count); err != nil {
+			return err
+		}
+		if err := writeSumCount(w, &h.family, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Summary sums observations, such as drifts or scores, and counts them,
+// without quantiles. A nil *Summary records nothing.
+type Summary struct {
+	family
+}
+
+// NewSummary returns an unregistered summary the way NewCounter does.
+func NewSummary(name, help string, labels ...string) *Summary {
+	return &Summary{family: newFamily(name, help, "summary", labels)}
+}
+
+// Observe adds value to the series of values.
+func (s *Summary) Observe(value float64, values ...string) {
+	if s == nil {
+		return
+	}
+	s.update(values, func(sample *Sample) {
+		sample.Count++
+		sample.Sum += value
+	})
+}
+
+// WriteMetrics writes the summary's series.
+func (s *Summary) WriteMetrics(w io.Writer) error {
+	if err := s.header(w); err != nil {
+		return err
+	}
+	for _, sample := range s.Samples() {
+		if err := writeSumCount(w, &s.family, sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSumCount writes the sum and count of a histogram or summary series.
+func writeSumCount(w io.Writer, f *family, s Sample) error {
+	labels := f.labelPairs(s.Values)
+	_, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", f.name, labels, formatValue(s.Sum), f.name, labels, s.Count)
+	return err
+}
+
+// formatValue renders value the way the exposition format expects.
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
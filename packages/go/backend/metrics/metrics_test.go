@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryWritesInstruments(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounter("requests_total", "Requests served.", "route", "code")
+	requests.Inc("/sessions", "200")
+	requests.Add(2, "/sessions", "200")
+	requests.Inc("/healthz", "200")
+	requests.Add(-1, "/healthz", "200")
+	requests.Inc("/healthz")
+
+	sessions := registry.NewGauge("sessions_active", "Sessions running.")
+	sessions.Add(2)
+	sessions.Add(-1)
+	registry.NewGaugeFunc("queue_depth", "Jobs queued.", func() float64 { return 4 })
+
+	latency := registry.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.ObserveDuration(50*time.Millisecond, "/sessions")
+	latency.Observe(0.5, "/sessions")
+	latency.Observe(3, "/sessions")
+
+	var b strings.Builder
+	if err := registry.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/healthz",code="200"} 1
+requests_total{route="/sessions",code="200"} 3
+# HELP sessions_active Sessions running.
+# TYPE sessions_active gauge
+sessions_active 1
+# HELP queue_depth Jobs queued.
+# TYPE queue_depth gauge
+queue_depth 4
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/sessions",le="0.1"} 1
+latency_seconds_bucket{route="/sessions",le="1"} 2
+latency_seconds_bucket{route="/sessions",le="+Inf"} 3
+latency_seconds_sum{route="/sessions"} 3.55
+latency_seconds_count{route="/sessions"} 3
+`
+	if b.String() != want {
+		t.Fatalf("unexpected metrics:\n%s", b.String())
+	}
+
+	if again := registry.NewCounter("requests_total", "Requests served.", "route", "code"); again != requests {
+		t.Fatal("expected the counter registered earlier to be returned")
+	}
+	requests.Delete("/healthz", "200")
+	b.Reset()
+	_ = registry.WriteMetrics(&b)
+	if strings.Contains(b.String(), `route="/healthz"`) {
+		t.Fatalf("expected the deleted series to be gone, got:\n%s", b.String())
+	}
+}
+
+func TestSummaryAndSeriesOfSessions(t *testing.T) {
+	drift := NewSummary("drift_seconds", "Drift.", "session", "language")
+	drift.Observe(0.5, "s-1", "es")
+	drift.Observe(0.25, "s-1", "es")
+	drift.Observe(1, "s-1", "fr")
+	drift.Observe(2, "s-2", "es")
+
+	var b strings.Builder
+	if err := drift.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	want := `# HELP drift_seconds Drift.
+# TYPE drift_seconds summary
+drift_seconds_sum{session="s-1",language="es"} 0.75
+drift_seconds_count{session="s-1",language="es"} 2
+drift_seconds_sum{session="s-1",language="fr"} 1
+drift_seconds_count{session="s-1",language="fr"} 1
+drift_seconds_sum{session="s-2",language="es"} 2
+drift_seconds_count{session="s-2",language="es"} 1
+`
+	if b.String() != want {
+		t.Fatalf("unexpected metrics:\n%s", b.String())
+	}
+
+	drift.DeletePrefix("s-1")
+	samples := drift.Samples()
+	if len(samples) != 1 || samples[0].Values[0] != "s-2" || samples[0].Count != 1 || samples[0].Sum != 2 {
+		t.Fatalf("expected only the other session's series, got %+v", samples)
+	}
+}
+
+func TestNilRegistryRecordsNothing(t *testing.T) {
+	var registry *Registry
+	registry.Register(registry.NewCounter("requests_total", "Requests served."))
+	registry.NewCounter("requests_total", "Requests served.").Inc()
+	registry.NewGauge("sessions_active", "Sessions running.").Set(1)
+	registry.NewHistogram("latency_seconds", "Latency.", nil).Observe(1)
+	registry.NewSummary("drift_seconds", "Drift.").Observe(1)
+	if err := registry.WriteMetrics(io.Discard); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+}
+
+type failingCollector struct{}
+
+func (failingCollector) WriteMetrics(io.Writer) error { return errors.New("boom") }
+
+func TestHandler(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("requests_total", "Requests served.").Inc()
+
+	rr := httptest.NewRecorder()
+	Handler(registry).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "requests_total 1\n") {
+		t.Fatalf("unexpected response %d: %s", rr.Code, rr.Body.String())
+	}
+
+	registry.Register(failingCollector{})
+	rr = httptest.NewRecorder()
+	Handler(registry).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusInternalServerError || strings.Contains(rr.Body.String(), "requests_total") {
+		t.Fatalf("expected a failing collector to fail the scrape, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,349 @@
+package nats
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+	defaultPort    = "4222"
+	connectPayload = `{"verbose":false,"pedantic":false,"name":"streamlation","lang":"go"}`
+)
+
+// Client speaks the NATS core text protocol. Publishes share a single
+// connection; each subscription gets its own.
+type Client struct {
+	addr   string
+	dialer net.Dialer
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+func NewClient(addr string) (*Client, error) {
+	resolved, err := resolveAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{addr: resolved}, nil
+}
+
+// Publish sends payload to subject and waits for the server to acknowledge
+// the connection is healthy with a PONG, so write failures surface as errors.
+func (c *Client) Publish(ctx context.Context, subject string, payload []byte) error {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("invalid nats subject %q", subject)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		conn, reader, writer, err := c.connect(ctx)
+		if err != nil {
+			return err
+		}
+		c.conn, c.reader, c.writer = conn, reader, writer
+	}
+
+	if err := c.conn.SetDeadline(deadlineFromContext(ctx)); err != nil {
+		c.reset()
+		return err
+	}
+	if _, err := fmt.Fprintf(c.writer, "PUB %s %d\r\n", subject, len(payload)); err != nil {
+		c.reset()
+		return fmt.Errorf("nats write: %w", err)
+	}
+	if _, err := c.writer.Write(payload); err != nil {
+		c.reset()
+		return fmt.Errorf("nats write: %w", err)
+	}
+	if _, err := c.writer.WriteString("\r\nPING\r\n"); err != nil {
+		c.reset()
+		return fmt.Errorf("nats write: %w", err)
+	}
+	if err := c.writer.Flush(); err != nil {
+		c.reset()
+		return fmt.Errorf("nats write: %w", err)
+	}
+	if err := awaitPong(c.reader, c.writer); err != nil {
+		c.reset()
+		return err
+	}
+	_ = c.conn.SetDeadline(time.Time{})
+	return nil
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reset()
+}
+
+// Subscribe opens a dedicated connection receiving messages on subject.
+func (c *Client) Subscribe(ctx context.Context, subject string) (*Subscription, error) {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return nil, fmt.Errorf("invalid nats subject %q", subject)
+	}
+
+	conn, reader, writer, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(deadlineFromContext(ctx)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(writer, "SUB %s 1\r\nPING\r\n", subject); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("nats write: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("nats write: %w", err)
+	}
+	if err := awaitPong(reader, writer); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	sub := &Subscription{
+		conn:     conn,
+		reader:   reader,
+		writer:   writer,
+		messages: make(chan Message, 8),
+		errors:   make(chan error, 1),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go sub.run(streamCtx)
+	return sub, nil
+}
+
+// connect dials the server and completes the INFO/CONNECT handshake.
+func (c *Client) connect(ctx context.Context) (net.Conn, *bufio.Reader, *bufio.Writer, error) {
+	conn, err := c.dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("nats dial: %w", err)
+	}
+	if err := conn.SetDeadline(deadlineFromContext(ctx)); err != nil {
+		_ = conn.Close()
+		return nil, nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	line, err := readLine(reader)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, nil, err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		_ = conn.Close()
+		return nil, nil, nil, fmt.Errorf("unexpected nats greeting %q", line)
+	}
+	if _, err := fmt.Fprintf(writer, "CONNECT %s\r\n", connectPayload); err != nil {
+		_ = conn.Close()
+		return nil, nil, nil, fmt.Errorf("nats write: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, reader, writer, nil
+}
+
+func (c *Client) reset() error {
+	if c.conn != nil {
+		err := c.conn.Close()
+		c.conn = nil
+		c.reader = nil
+		c.writer = nil
+		return err
+	}
+	return nil
+}
+
+// Message is a payload delivered on a subscribed subject.
+type Message struct {
+	Subject string
+	Payload []byte
+}
+
+type Subscription struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	writer    *bufio.Writer
+	messages  chan Message
+	errors    chan error
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+func (s *Subscription) Errors() <-chan error {
+	return s.errors
+}
+
+func (s *Subscription) Close() error {
+	var closeErr error
+	s.closeOnce.Do(func() {
+		s.cancel()
+		closeErr = s.conn.Close()
+		<-s.done
+	})
+	return closeErr
+}
+
+func (s *Subscription) run(ctx context.Context) {
+	defer close(s.done)
+	defer close(s.messages)
+	defer close(s.errors)
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.conn.SetReadDeadline(time.Now().Add(defaultTimeout)); err != nil {
+			s.reportError(err)
+			return
+		}
+
+		line, err := readLine(s.reader)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return
+			}
+			s.reportError(err)
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			msg, err := readMessage(s.reader, line)
+			if err != nil {
+				s.reportError(err)
+				return
+			}
+			select {
+			case s.messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		case line == "PING":
+			_, _ = s.writer.WriteString("PONG\r\n")
+			_ = s.writer.Flush()
+		case strings.HasPrefix(line, "-ERR"):
+			s.reportError(fmt.Errorf("nats error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR"))))
+		default:
+			continue
+		}
+	}
+}
+
+func (s *Subscription) reportError(err error) {
+	select {
+	case s.errors <- err:
+	default:
+	}
+}
+
+// awaitPong reads until the server answers a PING, replying to any PING the
+// server sends in the meantime.
+func awaitPong(r *bufio.Reader, w *bufio.Writer) error {
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := w.WriteString("PONG\r\n"); err != nil {
+				return fmt.Errorf("nats write: %w", err)
+			}
+			if err := w.Flush(); err != nil {
+				return fmt.Errorf("nats write: %w", err)
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// readMessage parses a "MSG <subject> <sid> [reply-to] <#bytes>" header and
+// its payload.
+func readMessage(r *bufio.Reader, header string) (Message, error) {
+	fields := strings.Fields(header)
+	if len(fields) != 4 && len(fields) != 5 {
+		return Message{}, fmt.Errorf("malformed nats message header %q", header)
+	}
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || size < 0 {
+		return Message{}, fmt.Errorf("malformed nats message size %q", header)
+	}
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return Message{}, fmt.Errorf("nats payload read: %w", err)
+	}
+	return Message{Subject: fields[1], Payload: buf[:size]}, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", io.EOF
+		}
+		return "", fmt.Errorf("nats read: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func deadlineFromContext(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	return time.Now().Add(defaultTimeout)
+}
+
+func resolveAddr(addr string) (string, error) {
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return "", fmt.Errorf("invalid nats url: %w", err)
+		}
+		if u.Scheme != "nats" {
+			return "", fmt.Errorf("unsupported nats url scheme %q", u.Scheme)
+		}
+		if u.Host == "" {
+			return "", fmt.Errorf("nats url missing host")
+		}
+		addr = u.Host
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, defaultPort), nil
+	}
+	return addr, nil
+}
@@ -0,0 +1,248 @@
+package output
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"streamlation/packages/backend/translation"
+)
+
+// ErrArtifactNotFound is returned by ArtifactStore.Get when no object exists
+// under a key.
+var ErrArtifactNotFound = errors.New("object not found")
+
+// ArtifactStore persists generated outputs, such as subtitle files, on local
+// disk or in an object store like S3 or GCS. Keys are slash-separated paths
+// such as "session123/subtitles/es.srt". Put replaces any existing object
+// under the key.
+type ArtifactStore interface {
+	ObjectStore
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// ArtifactKind groups the artifacts of a session.
+type ArtifactKind string
+
+const (
+	ArtifactSubtitles ArtifactKind = "subtitles"
+	ArtifactAudio     ArtifactKind = "audio"
+	// ArtifactPackage bundles the artifacts of every language of a session.
+	ArtifactPackage ArtifactKind = "package"
+	// ArtifactTranscript aligns the source text of a session with its
+	// translations into every language.
+	ArtifactTranscript ArtifactKind = "transcript"
+	// ArtifactCues lists the cues of a language as generated, before edits.
+	ArtifactCues ArtifactKind = "cues"
+)
+
+// PackageLanguage is the language of packages, the ISO 639-2 code for
+// multiple languages.
+const PackageLanguage = "mul"
+
+// Artifact describes a generated output persisted in an ArtifactStore.
+type Artifact struct {
+	SessionID string       `json:"sessionId"`
+	Key       string       `json:"key"`
+	Kind      ArtifactKind `json:"kind"`
+	Language  string       `json:"language"`
+	// Format is the artifact's file format, such as "srt" or "wav".
+	Format      string    `json:"format"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// ArtifactRegistry records the artifacts persisted for each session, so
+// that they can be listed and downloaded. Recording an artifact under the
+// key of an earlier one replaces it.
+type ArtifactRegistry interface {
+	Record(ctx context.Context, artifact Artifact) error
+	Artifacts(ctx context.Context, sessionID string) ([]Artifact, error)
+}
+
+// ArtifactKey returns the deterministic key of the artifact of kind in
+// language and format for sessionID, such as "session123/subtitles/es.srt",
+// so that generating an artifact again replaces it.
+func ArtifactKey(sessionID string, kind ArtifactKind, language, format string) string {
+	return sessionID + "/" + string(kind) + "/" + language + "." + format
+}
+
+// artifactContentTypes maps formats to the content types they are served
+// with.
+var artifactContentTypes = map[string]string{
+	string(FormatSRT):  "application/x-subrip",
+	string(FormatVTT):  "text/vtt; charset=utf-8",
+	string(FormatTTML): "application/ttml+xml",
+	string(FormatSCC):  "text/plain; charset=utf-8",
+	"wav":              "audio/wav",
+	"aac":              "audio/aac",
+	"ogg":              "audio/ogg",
+	"zip":              "application/zip",
+	"jsonl":            "application/x-ndjson",
+	"json":             "application/json",
+}
+
+// ArtifactContentType returns the content type artifacts in format are
+// served with.
+func ArtifactContentType(format string) string {
+	if contentType, ok := artifactContentTypes[strings.ToLower(format)]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// ArtifactWriter persists generated outputs into a store under their
+// deterministic keys and records them in a registry.
+type ArtifactWriter struct {
+	store    ArtifactStore
+	registry ArtifactRegistry
+}
+
+// NewArtifactWriter returns a writer persisting into store. A nil registry
+// records nothing.
+func NewArtifactWriter(store ArtifactStore, registry ArtifactRegistry) (*ArtifactWriter, error) {
+	if store == nil {
+		return nil, errors.New("artifact store required")
+	}
+	return &ArtifactWriter{store: store, registry: registry}, nil
+}
+
+// Store returns the store the writer persists into.
+func (w *ArtifactWriter) Store() ArtifactStore {
+	return w.store
+}
+
+// Persist stores body as artifact, keyed by ArtifactKey, and records it
+// with its size and checksum. It returns the artifact as recorded.
+func (w *ArtifactWriter) Persist(ctx context.Context, artifact Artifact, body io.Reader) (Artifact, error) {
+	if artifact.SessionID == "" {
+		return Artifact{}, errors.New("session id required")
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("read artifact: %w", err)
+	}
+	artifact.Key = ArtifactKey(artifact.SessionID, artifact.Kind, artifact.Language, artifact.Format)
+	if artifact.ContentType == "" {
+		artifact.ContentType = ArtifactContentType(artifact.Format)
+	}
+	sum := sha256.Sum256(data)
+	artifact.Size, artifact.SHA256 = int64(len(data)), hex.EncodeToString(sum[:])
+	artifact.CreatedAt = time.Now().UTC()
+
+	if err := w.store.Put(ctx, artifact.Key, bytes.NewReader(data)); err != nil {
+		return Artifact{}, fmt.Errorf("store artifact %s: %w", artifact.Key, err)
+	}
+	if w.registry != nil {
+		if err := w.registry.Record(ctx, artifact); err != nil {
+			return Artifact{}, fmt.Errorf("record artifact %s: %w", artifact.Key, err)
+		}
+	}
+	return artifact, nil
+}
+
+// PersistSubtitles has generator render translations, the final
+// translations of sessionID into language, as a subtitle file in format,
+// and persists it.
+func (w *ArtifactWriter) PersistSubtitles(ctx context.Context, generator SubtitleGenerator, format SubtitleFormat, sessionID, language string, translations <-chan translation.Translation) (Artifact, error) {
+	var generate func(context.Context, string, <-chan translation.Translation) (io.Reader, error)
+	switch format {
+	case FormatSRT:
+		generate = generator.GenerateSRT
+	case FormatVTT:
+		generate = generator.GenerateVTT
+	case FormatTTML:
+		generate = generator.GenerateTTML
+	case FormatSCC:
+		generate = generator.GenerateSCC
+	default:
+		return Artifact{}, fmt.Errorf("unsupported subtitle format %q", format)
+	}
+	body, err := generate(ctx, sessionID, translations)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("generate %s subtitles: %w", format, err)
+	}
+	return w.Persist(ctx, Artifact{
+		SessionID: sessionID,
+		Kind:      ArtifactSubtitles,
+		Language:  language,
+		Format:    string(format),
+	}, body)
+}
+
+// packageManifest lists the files of a package in its manifest.json.
+type packageManifest struct {
+	SessionID string        `json:"sessionId"`
+	Files     []packageFile `json:"files"`
+}
+
+type packageFile struct {
+	Name        string       `json:"name"`
+	Kind        ArtifactKind `json:"kind"`
+	Language    string       `json:"language"`
+	Format      string       `json:"format"`
+	ContentType string       `json:"contentType"`
+	SHA256      string       `json:"sha256"`
+}
+
+// PersistPackage bundles artifacts of sessionID, persisted earlier, into a
+// zip archive holding each under its key without the session, such as
+// "subtitles/es.srt", in key order, along with a manifest.json listing
+// them, and persists it as the session's package in PackageLanguage.
+func (w *ArtifactWriter) PersistPackage(ctx context.Context, sessionID string, artifacts []Artifact) (Artifact, error) {
+	artifacts = slices.Clone(artifacts)
+	slices.SortFunc(artifacts, func(a, b Artifact) int { return strings.Compare(a.Key, b.Key) })
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	manifest := packageManifest{SessionID: sessionID, Files: make([]packageFile, 0, len(artifacts))}
+	for _, artifact := range artifacts {
+		name := strings.TrimPrefix(artifact.Key, sessionID+"/")
+		body, err := w.store.Get(ctx, artifact.Key)
+		if err != nil {
+			return Artifact{}, fmt.Errorf("load artifact %s: %w", artifact.Key, err)
+		}
+		file, err := archive.Create(name)
+		if err == nil {
+			_, err = io.Copy(file, body)
+		}
+		_ = body.Close()
+		if err != nil {
+			return Artifact{}, fmt.Errorf("package artifact %s: %w", artifact.Key, err)
+		}
+		manifest.Files = append(manifest.Files, packageFile{
+			Name:        name,
+			Kind:        artifact.Kind,
+			Language:    artifact.Language,
+			Format:      artifact.Format,
+			ContentType: artifact.ContentType,
+			SHA256:      artifact.SHA256,
+		})
+	}
+	file, err := archive.Create("manifest.json")
+	if err == nil {
+		err = json.NewEncoder(file).Encode(manifest)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		return Artifact{}, fmt.Errorf("package artifacts: %w", err)
+	}
+	return w.Persist(ctx, Artifact{
+		SessionID: sessionID,
+		Kind:      ArtifactPackage,
+		Language:  PackageLanguage,
+		Format:    "zip",
+	}, &buf)
+}
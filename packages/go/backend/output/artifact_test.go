@@ -0,0 +1,160 @@
+package output
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/translation"
+)
+
+// memoryArtifactStore keeps artifacts in memory.
+type memoryArtifactStore struct {
+	memoryStore
+}
+
+func (s *memoryArtifactStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[key]
+	if !ok {
+		return nil, ErrArtifactNotFound
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+// memoryArtifactRegistry records artifacts in memory.
+type memoryArtifactRegistry struct {
+	artifacts []Artifact
+	err       error
+}
+
+func (r *memoryArtifactRegistry) Record(_ context.Context, artifact Artifact) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.artifacts = append(r.artifacts, artifact)
+	return nil
+}
+
+func (r *memoryArtifactRegistry) Artifacts(_ context.Context, sessionID string) ([]Artifact, error) {
+	var artifacts []Artifact
+	for _, artifact := range r.artifacts {
+		if artifact.SessionID == sessionID {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts, nil
+}
+
+func TestArtifactWriterPersistsSubtitles(t *testing.T) {
+	t.Parallel()
+
+	store := &memoryArtifactStore{}
+	registry := &memoryArtifactRegistry{}
+	writer, err := NewArtifactWriter(store, registry)
+	if err != nil {
+		t.Fatalf("NewArtifactWriter: %v", err)
+	}
+	translations := make(chan translation.Translation, 1)
+	translations <- translation.Translation{TranslatedText: "Hola mundo.", EndTime: 2 * time.Second}
+	close(translations)
+
+	artifact, err := writer.PersistSubtitles(context.Background(), NewStubGenerator(), FormatVTT, "session", "es", translations)
+	if err != nil {
+		t.Fatalf("PersistSubtitles: %v", err)
+	}
+	if artifact.Key != "session/subtitles/es.vtt" || artifact.ContentType != "text/vtt; charset=utf-8" || artifact.Kind != ArtifactSubtitles {
+		t.Fatalf("unexpected artifact %+v", artifact)
+	}
+	body := store.files["session/subtitles/es.vtt"]
+	if !strings.HasPrefix(body, "WEBVTT") || artifact.Size != int64(len(body)) || len(artifact.SHA256) != 64 {
+		t.Fatalf("expected the stored file to match the artifact, got %q for %+v", body, artifact)
+	}
+	if len(registry.artifacts) != 1 || registry.artifacts[0] != artifact {
+		t.Fatalf("expected the artifact to be recorded, got %+v", registry.artifacts)
+	}
+
+	if _, err := writer.PersistSubtitles(context.Background(), NewStubGenerator(), "ass", "session", "es", translations); err == nil {
+		t.Fatal("expected an unsupported format to be rejected")
+	}
+	registry.err = errors.New("database unavailable")
+	if _, err := writer.Persist(context.Background(), Artifact{SessionID: "session", Kind: ArtifactAudio, Language: "es", Format: "wav"}, strings.NewReader("RIFF")); err == nil || !strings.Contains(err.Error(), "database unavailable") {
+		t.Fatalf("expected the registry failure, got %v", err)
+	}
+}
+
+func TestArtifactWriterPersistsPackage(t *testing.T) {
+	t.Parallel()
+
+	store := &memoryArtifactStore{}
+	registry := &memoryArtifactRegistry{}
+	writer, err := NewArtifactWriter(store, registry)
+	if err != nil {
+		t.Fatalf("NewArtifactWriter: %v", err)
+	}
+	var artifacts []Artifact
+	for _, language := range []string{"es", "fr"} {
+		artifact, err := writer.Persist(context.Background(), Artifact{SessionID: "session", Kind: ArtifactSubtitles, Language: language, Format: "srt"}, strings.NewReader("1\n"+language+"\n"))
+		if err != nil {
+			t.Fatalf("Persist: %v", err)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	pkg, err := writer.PersistPackage(context.Background(), "session", artifacts)
+	if err != nil {
+		t.Fatalf("PersistPackage: %v", err)
+	}
+	if pkg.Key != "session/package/mul.zip" || pkg.ContentType != "application/zip" || pkg.Kind != ArtifactPackage {
+		t.Fatalf("unexpected package %+v", pkg)
+	}
+	body := store.files[pkg.Key]
+	archive, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("open package: %v", err)
+	}
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", file.Name, err)
+		}
+		data, _ := io.ReadAll(reader)
+		_ = reader.Close()
+		files[file.Name] = string(data)
+	}
+	if files["subtitles/es.srt"] != "1\nes\n" || files["subtitles/fr.srt"] != "1\nfr\n" {
+		t.Fatalf("expected every language in the package, got %v", files)
+	}
+	var manifest packageManifest
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &manifest); err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	if len(manifest.Files) != 2 || manifest.Files[1].Name != "subtitles/fr.srt" || manifest.Files[1].Language != "fr" || manifest.Files[1].SHA256 != artifacts[1].SHA256 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+
+	if _, err := writer.PersistPackage(context.Background(), "session", []Artifact{{Key: "session/subtitles/de.srt"}}); !errors.Is(err, ErrArtifactNotFound) {
+		t.Fatalf("expected a missing artifact to fail the package, got %v", err)
+	}
+}
+
+func TestArtifactKeyIsDeterministic(t *testing.T) {
+	t.Parallel()
+
+	if key := ArtifactKey("session", ArtifactAudio, "fr", "wav"); key != "session/audio/fr.wav" {
+		t.Fatalf("unexpected key %q", key)
+	}
+	if contentType := ArtifactContentType("SRT"); contentType != "application/x-subrip" {
+		t.Fatalf("unexpected content type %q", contentType)
+	}
+	if contentType := ArtifactContentType("bin"); contentType != "application/octet-stream" {
+		t.Fatalf("unexpected content type %q", contentType)
+	}
+}
@@ -0,0 +1,324 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFFmpegCommand is the ffmpeg binary that burns subtitles in.
+const DefaultFFmpegCommand = "ffmpeg"
+
+// DefaultBurnInEncodeArgs re-encode the video of a burned segment with
+// x264, fast enough to keep up with a live stream, and copy its audio.
+var DefaultBurnInEncodeArgs = []string{"-c:v", "libx264", "-preset", "veryfast", "-c:a", "copy"}
+
+// OpenCaptionConfig configures an OpenCaptionVariant. Zero values fall
+// back to the defaults.
+type OpenCaptionConfig struct {
+	// Store receives the playlist and the segments.
+	Store ObjectStore
+	// Key is the key of the media playlist, such as
+	// "session/hls/burned-es.m3u8". Segments are stored in a directory
+	// named after it without the extension, such as
+	// "session/hls/burned-es/".
+	Key string
+	// Start is the time of the stream the first segment starts at.
+	Start time.Duration
+	// Command runs ffmpeg: the binary, followed by any arguments that
+	// precede ffmpeg's own, such as those of a wrapper that runs it in a
+	// container. Defaults to DefaultFFmpegCommand.
+	Command []string
+	// EncodeArgs are the ffmpeg output options that encode a burned
+	// segment. Defaults to DefaultBurnInEncodeArgs.
+	EncodeArgs []string
+	// Style overrides the look of the subtitles as libass style fields,
+	// such as "FontSize=24,Outline=2". Empty keeps libass's defaults.
+	Style string
+	// TempDir holds the files exchanged with ffmpeg. Defaults to the
+	// system's temporary directory.
+	TempDir string
+}
+
+// OpenCaptionVariant republishes the MPEG-TS segments of a video stream as
+// an HLS variant with its subtitles burned in: every segment is run
+// through ffmpeg's subtitles filter with the cues that overlap it, and
+// listed by an event playlist that is rewritten as segments are added and
+// ended once the variant is closed. Burned segments are stamped with their
+// stream time on the 90kHz clock from zero, the clock the dub and subtitle
+// renditions are stamped on.
+//
+// Cues are kept like an HLSSubtitleRendition keeps them, and a segment is
+// final once published, so cues should be written before the stream time
+// they end at is published, such as by publishing with a delay. Segments
+// are burned one at a time, so a variant whose ffmpeg is slower than the
+// stream falls further behind it.
+//
+// Write and AddSegment may be called while Publish runs; Publish and Close
+// must not be called concurrently with each other.
+type OpenCaptionVariant struct {
+	cfg OpenCaptionConfig
+	dir string
+
+	mu sync.Mutex
+	// cues holds the cues that may still show in a segment, by index.
+	cues map[int]SubtitleEvent
+	// pending holds the segments added but not published yet, and added
+	// the stream time they end at.
+	pending   []openCaptionSegment
+	added     time.Duration
+	published time.Duration
+	segments  []hlsSegment
+	target    time.Duration
+	closed    bool
+}
+
+type openCaptionSegment struct {
+	data            []byte
+	start, duration time.Duration
+}
+
+// NewOpenCaptionVariant returns a variant publishing to cfg.Store.
+func NewOpenCaptionVariant(cfg OpenCaptionConfig) (*OpenCaptionVariant, error) {
+	if cfg.Store == nil {
+		return nil, errors.New("variant store required")
+	}
+	if !strings.HasSuffix(cfg.Key, ".m3u8") {
+		return nil, fmt.Errorf("invalid playlist key %q", cfg.Key)
+	}
+	// The style is quoted in the filter graph.
+	if strings.ContainsAny(cfg.Style, `'\`) {
+		return nil, fmt.Errorf("invalid subtitle style %q", cfg.Style)
+	}
+	if len(cfg.Command) == 0 {
+		cfg.Command = []string{DefaultFFmpegCommand}
+	}
+	if len(cfg.EncodeArgs) == 0 {
+		cfg.EncodeArgs = DefaultBurnInEncodeArgs
+	}
+	return &OpenCaptionVariant{
+		cfg:       cfg,
+		dir:       strings.TrimSuffix(cfg.Key, ".m3u8"),
+		cues:      make(map[int]SubtitleEvent),
+		added:     cfg.Start,
+		published: cfg.Start,
+	}, nil
+}
+
+// Health reports whether ffmpeg can be found.
+func (v *OpenCaptionVariant) Health() HealthStatus {
+	if _, err := exec.LookPath(v.cfg.Command[0]); err != nil {
+		return HealthStatus{Message: fmt.Sprintf("ffmpeg not found: %v", err)}
+	}
+	return HealthStatus{Healthy: true, Message: "ffmpeg ready"}
+}
+
+// Write applies event to the cues of the variant.
+func (v *OpenCaptionVariant) Write(event SubtitleEvent) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return errors.New("variant closed")
+	}
+	switch {
+	case event.Type == "remove":
+		delete(v.cues, event.Index)
+	case event.EndTime > event.StartTime && event.EndTime > v.published:
+		v.cues[event.Index] = event
+	}
+	return nil
+}
+
+// AddSegment adds the next MPEG-TS segment of the stream, which lasts
+// duration. Fragmented MP4 segments are added with their initialization
+// segment prepended.
+func (v *OpenCaptionVariant) AddSegment(data []byte, duration time.Duration) error {
+	if duration <= 0 {
+		return fmt.Errorf("invalid segment duration %s", duration)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return errors.New("variant closed")
+	}
+	v.pending = append(v.pending, openCaptionSegment{data: data, start: v.added, duration: duration})
+	v.added += duration
+	return nil
+}
+
+// Publish burns and publishes the added segments that end by until, the
+// stream time up to which the cues are complete. A segment that fails to
+// burn is kept, to be retried by the next Publish or Close.
+func (v *OpenCaptionVariant) Publish(ctx context.Context, until time.Duration) error {
+	v.mu.Lock()
+	closed := v.closed
+	v.mu.Unlock()
+	if closed {
+		return errors.New("variant closed")
+	}
+	return v.publish(ctx, until)
+}
+
+// Close burns and publishes the rest of the added segments and ends the
+// playlist.
+func (v *OpenCaptionVariant) Close(ctx context.Context) error {
+	v.mu.Lock()
+	closed := v.closed
+	until := v.added
+	v.mu.Unlock()
+	if closed {
+		return nil
+	}
+	if err := v.publish(ctx, until); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	v.closed = true
+	v.mu.Unlock()
+	return v.publishPlaylist(ctx)
+}
+
+// publish burns the pending segments that end by until and publishes the
+// playlist when any was.
+func (v *OpenCaptionVariant) publish(ctx context.Context, until time.Duration) error {
+	count := len(v.segments)
+	for {
+		segment, cues, ok := v.next(until)
+		if !ok {
+			break
+		}
+		if err := v.publishSegment(ctx, segment, cues); err != nil {
+			return err
+		}
+	}
+	if len(v.segments) == count {
+		return nil
+	}
+	return v.publishPlaylist(ctx)
+}
+
+// next returns the first pending segment when it ends by until, with the
+// cues that overlap it.
+func (v *OpenCaptionVariant) next(until time.Duration) (openCaptionSegment, []SubtitleEvent, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.pending) == 0 || v.pending[0].start+v.pending[0].duration > until {
+		return openCaptionSegment{}, nil, false
+	}
+	segment := v.pending[0]
+	end := segment.start + segment.duration
+	cues := make([]SubtitleEvent, 0, len(v.cues))
+	for _, cue := range v.cues {
+		if cue.StartTime < end && cue.EndTime > segment.start {
+			cues = append(cues, cue)
+		}
+	}
+	sort.Slice(cues, func(i, j int) bool {
+		if cues[i].StartTime != cues[j].StartTime {
+			return cues[i].StartTime < cues[j].StartTime
+		}
+		return cues[i].Index < cues[j].Index
+	})
+	return segment, cues, true
+}
+
+// publishSegment burns cues into segment, stores it, and forgets the
+// segment and the cues that end within it.
+func (v *OpenCaptionVariant) publishSegment(ctx context.Context, segment openCaptionSegment, cues []SubtitleEvent) error {
+	burned, err := v.burn(ctx, segment, cues)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%05d.ts", len(v.segments))
+	if err := v.cfg.Store.Put(ctx, v.dir+"/"+name, bytes.NewReader(burned)); err != nil {
+		return fmt.Errorf("publish variant segment: %w", err)
+	}
+
+	end := segment.start + segment.duration
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.pending = v.pending[1:]
+	v.published = end
+	for index, cue := range v.cues {
+		if cue.EndTime <= end {
+			delete(v.cues, index)
+		}
+	}
+	v.segments = append(v.segments, hlsSegment{uri: path.Base(v.dir) + "/" + name, duration: segment.duration})
+	v.target = max(v.target, segment.duration)
+	return nil
+}
+
+// burn runs ffmpeg over segment, with cues as subtitles timed from its
+// start, and returns the burned MPEG-TS segment.
+func (v *OpenCaptionVariant) burn(ctx context.Context, segment openCaptionSegment, cues []SubtitleEvent) ([]byte, error) {
+	dir, err := os.MkdirTemp(v.cfg.TempDir, "burnin-")
+	if err != nil {
+		return nil, fmt.Errorf("create burn-in directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "in"), segment.data, 0o600); err != nil {
+		return nil, fmt.Errorf("write burn-in input: %w", err)
+	}
+
+	args := append([]string{}, v.cfg.Command[1:]...)
+	args = append(args, "-hide_banner", "-loglevel", "error", "-y", "-i", "in")
+	if len(cues) > 0 {
+		var srt strings.Builder
+		for i, cue := range cues {
+			start := max(cue.StartTime-segment.start, 0)
+			end := min(cue.EndTime, segment.start+segment.duration) - segment.start
+			fmt.Fprintf(&srt, "%d\n%s --> %s\n%s\n\n", i+1, formatSRTTime(start), formatSRTTime(end), strings.TrimSpace(cue.Text))
+		}
+		if err := os.WriteFile(filepath.Join(dir, "cues.srt"), []byte(srt.String()), 0o600); err != nil {
+			return nil, fmt.Errorf("write burn-in cues: %w", err)
+		}
+		filter := "subtitles=cues.srt"
+		if v.cfg.Style != "" {
+			filter += ":force_style='" + v.cfg.Style + "'"
+		}
+		args = append(args, "-vf", filter)
+	}
+	// Segments without cues are encoded alike, so that the variant's
+	// video does not change encoding from one segment to the next.
+	args = append(args, v.cfg.EncodeArgs...)
+	args = append(args, "-output_ts_offset", strconv.FormatFloat(segment.start.Seconds(), 'f', 6, 64), "-f", "mpegts", "out.ts")
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, v.cfg.Command[0], args...)
+	// The filter graph names the cues relative to the directory, which
+	// spares escaping its path.
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return nil, fmt.Errorf("run ffmpeg: %w: %s", err, detail[strings.LastIndexByte(detail, '\n')+1:])
+		}
+		return nil, fmt.Errorf("run ffmpeg: %w", err)
+	}
+	burned, err := os.ReadFile(filepath.Join(dir, "out.ts"))
+	if err != nil {
+		return nil, fmt.Errorf("read burned segment: %w", err)
+	}
+	return burned, nil
+}
+
+// publishPlaylist stores the media playlist listing the published
+// segments.
+func (v *OpenCaptionVariant) publishPlaylist(ctx context.Context) error {
+	v.mu.Lock()
+	segments := append([]hlsSegment(nil), v.segments...)
+	target, closed := v.target, v.closed
+	v.mu.Unlock()
+	return publishMediaPlaylist(ctx, v.cfg.Store, v.cfg.Key, target, segments, closed)
+}
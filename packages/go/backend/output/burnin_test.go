@@ -0,0 +1,142 @@
+package output
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFFmpegHelperProcess stands in for ffmpeg when the test binary is run
+// as an OpenCaptionVariant's command. It writes its output as the input,
+// followed by the filter, the timestamp offset, and the cues it was given.
+// Inputs reading "corrupt" fail.
+func TestFFmpegHelperProcess(t *testing.T) {
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return
+	}
+	flags := make(map[string]string)
+	for i := 1; i+1 < len(args); i++ {
+		flags[args[i]] = args[i+1]
+	}
+	input, err := os.ReadFile(flags["-i"])
+	if err != nil || string(input) == "corrupt" {
+		os.Stderr.WriteString("in: Invalid data found when processing input\n")
+		os.Exit(1)
+	}
+	cues, _ := os.ReadFile("cues.srt")
+	output := string(input) + "\nfilter=" + flags["-vf"] + "\noffset=" + flags["-output_ts_offset"] + "\n" + string(cues)
+	if err := os.WriteFile(args[len(args)-1], []byte(output), 0o600); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func newTestOpenCaptionVariant(t *testing.T, store ObjectStore) *OpenCaptionVariant {
+	t.Helper()
+	variant, err := NewOpenCaptionVariant(OpenCaptionConfig{
+		Store:   store,
+		Key:     "session/hls/burned-es.m3u8",
+		Command: []string{os.Args[0], "-test.run=TestFFmpegHelperProcess", "--"},
+		Style:   "FontSize=24,Outline=2",
+		TempDir: t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("NewOpenCaptionVariant: %v", err)
+	}
+	return variant
+}
+
+func TestOpenCaptionVariantBurnsCuesIntoSegments(t *testing.T) {
+	t.Parallel()
+
+	store := &memoryStore{}
+	variant := newTestOpenCaptionVariant(t, store)
+	ctx := context.Background()
+	for i, segment := range []string{"segment-0", "segment-1", "segment-2"} {
+		if err := variant.AddSegment([]byte(segment), []time.Duration{2 * time.Second, 2 * time.Second, 1500 * time.Millisecond}[i]); err != nil {
+			t.Fatalf("AddSegment: %v", err)
+		}
+	}
+	for _, event := range []SubtitleEvent{
+		{Type: "add", Index: 0, StartTime: 500 * time.Millisecond, EndTime: 1500 * time.Millisecond, Text: "hola"},
+		// The second cue spans the first two segments.
+		{Type: "add", Index: 1, StartTime: 1800 * time.Millisecond, EndTime: 2500 * time.Millisecond, Text: "adiós"},
+	} {
+		if err := variant.Write(event); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	if err := variant.Publish(ctx, 3*time.Second); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	want := "segment-0\nfilter=subtitles=cues.srt:force_style='FontSize=24,Outline=2'\noffset=0.000000\n" +
+		"1\n00:00:00,500 --> 00:00:01,500\nhola\n\n" +
+		"2\n00:00:01,800 --> 00:00:02,000\nadiós\n\n"
+	if segment := store.files["session/hls/burned-es/00000.ts"]; segment != want {
+		t.Fatalf("expected segment %q, got %q", want, segment)
+	}
+	if playlist := store.files["session/hls/burned-es.m3u8"]; strings.Contains(playlist, "#EXT-X-ENDLIST") || strings.Count(playlist, "#EXTINF") != 1 {
+		t.Fatalf("expected an open playlist of one segment, got %q", playlist)
+	}
+
+	if err := variant.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	want = "segment-1\nfilter=subtitles=cues.srt:force_style='FontSize=24,Outline=2'\noffset=2.000000\n" +
+		"1\n00:00:00,000 --> 00:00:00,500\nadiós\n\n"
+	if segment := store.files["session/hls/burned-es/00001.ts"]; segment != want {
+		t.Fatalf("expected segment %q, got %q", want, segment)
+	}
+	// Segments without cues are still encoded, without the filter.
+	want = "segment-2\nfilter=\noffset=4.000000\n"
+	if segment := store.files["session/hls/burned-es/00002.ts"]; segment != want {
+		t.Fatalf("expected segment %q, got %q", want, segment)
+	}
+	wantPlaylist := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:EVENT\n" +
+		"#EXTINF:2.000,\nburned-es/00000.ts\n#EXTINF:2.000,\nburned-es/00001.ts\n#EXTINF:1.500,\nburned-es/00002.ts\n#EXT-X-ENDLIST\n"
+	if playlist := store.files["session/hls/burned-es.m3u8"]; playlist != wantPlaylist {
+		t.Fatalf("expected playlist %q, got %q", wantPlaylist, playlist)
+	}
+
+	if err := variant.AddSegment([]byte("late"), time.Second); err == nil {
+		t.Fatal("expected a closed variant to refuse segments")
+	}
+}
+
+func TestOpenCaptionVariantKeepsSegmentsThatFailToBurn(t *testing.T) {
+	t.Parallel()
+
+	store := &memoryStore{}
+	variant := newTestOpenCaptionVariant(t, store)
+	ctx := context.Background()
+	if err := variant.AddSegment([]byte("corrupt"), 2*time.Second); err != nil {
+		t.Fatalf("AddSegment: %v", err)
+	}
+
+	err := variant.Publish(ctx, 2*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "Invalid data found when processing input") {
+		t.Fatalf("expected ffmpeg's error, got %v", err)
+	}
+	if len(store.files) != 0 {
+		t.Fatalf("expected nothing published, got %v", store.files)
+	}
+	if err := variant.Close(ctx); err == nil {
+		t.Fatal("expected Close to retry the failed segment")
+	}
+}
+
+func TestNewOpenCaptionVariantRejectsQuotedStyles(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewOpenCaptionVariant(OpenCaptionConfig{Store: &memoryStore{}, Key: "session/hls/burned-es.m3u8", Style: "FontName='Arial'"})
+	if err == nil {
+		t.Fatal("expected a style with quotes to be rejected")
+	}
+}
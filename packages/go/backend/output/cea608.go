@@ -0,0 +1,434 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Defaults of CEA608Config.
+const (
+	// DefaultCaptionFrameRate is the frame rate of NTSC video, which
+	// CEA-608 captions and SCC files are timed against.
+	DefaultCaptionFrameRate = 30000.0 / 1001
+	// DefaultCEA608Rows is how many rows a caption takes at most.
+	DefaultCEA608Rows = 2
+)
+
+// CEA608Columns is the number of characters a caption row holds.
+const CEA608Columns = 32
+
+// CEA608NullPair is the pair sent in frames that carry no caption data.
+var CEA608NullPair = [2]byte{0x80, 0x80}
+
+// CEA608Config configures a CEA608Encoder. Zero values fall back to the
+// defaults.
+type CEA608Config struct {
+	// FrameRate is the frame rate of the video the captions go with.
+	// Defaults to DefaultCaptionFrameRate.
+	FrameRate float64
+	// Channel is the caption channel of field 1: 1 for CC1, 2 for CC2.
+	// Defaults to 1.
+	Channel int
+	// Rows is how many rows a caption takes at most, from 1 to 4; cues
+	// with more lines are shown as consecutive captions. Defaults to
+	// DefaultCEA608Rows.
+	Rows int
+}
+
+// CaptionPair is a pair of CEA-608 bytes, with their parity bits set, to
+// send with the video frame of index Frame, counted from zero.
+type CaptionPair struct {
+	Frame int64
+	Data  [2]byte
+}
+
+// CEA608Encoder encodes cues into CEA-608 caption data, which broadcast
+// workflows inject into the video stream or carry in SCC sidecar files.
+// Cues are shown as pop-on captions: each is loaded off screen ahead of
+// its start and flipped on at its start, centred on the bottom rows and
+// wrapped at CEA608Columns. Characters outside the CEA-608 character sets,
+// which cover English, Spanish, French, Portuguese and German, are sent as
+// "?".
+type CEA608Encoder struct {
+	cfg CEA608Config
+	// misc is the first byte of the miscellaneous control codes of the
+	// channel, and the other first bytes are offset by channel.
+	misc, channel byte
+}
+
+// NewCEA608Encoder returns an encoder of captions.
+func NewCEA608Encoder(cfg CEA608Config) (*CEA608Encoder, error) {
+	if cfg.FrameRate <= 0 {
+		cfg.FrameRate = DefaultCaptionFrameRate
+	}
+	if cfg.Channel == 0 {
+		cfg.Channel = 1
+	}
+	if cfg.Rows == 0 {
+		cfg.Rows = DefaultCEA608Rows
+	}
+	if cfg.Channel != 1 && cfg.Channel != 2 {
+		return nil, fmt.Errorf("unsupported caption channel CC%d", cfg.Channel)
+	}
+	if cfg.Rows < 1 || cfg.Rows > 4 {
+		return nil, fmt.Errorf("captions of %d rows, want 1 to 4", cfg.Rows)
+	}
+	e := &CEA608Encoder{cfg: cfg, misc: 0x14}
+	if cfg.Channel == 2 {
+		e.misc, e.channel = 0x1c, 0x08
+	}
+	return e, nil
+}
+
+// Control codes of the miscellaneous command set.
+const (
+	cea608ResumeCaptionLoading  = 0x20
+	cea608EraseDisplayed        = 0x2c
+	cea608EraseNonDisplayed     = 0x2e
+	cea608EndOfCaption          = 0x2f
+	cea608TabOffsetFirstByte    = 0x17
+	cea608SpecialFirstByte      = 0x11
+	cea608ExtendedFirstByte     = 0x12
+	cea608ExtendedLastFirstByte = 0x13
+)
+
+// caption is a caption shown from frame start until frame end.
+type caption struct {
+	start, end int64
+	lines      []string
+}
+
+// pairGroup is a run of pairs to send in consecutive frames from frame on.
+type pairGroup struct {
+	frame int64
+	pairs [][2]byte
+}
+
+// Encode returns the pairs that show cues, which should be final cues, as
+// pop-on captions, in frame order with at most one pair per frame. A
+// caption whose loading does not fit between the caption before it and its
+// start shows late.
+func (e *CEA608Encoder) Encode(cues []SubtitleEvent) []CaptionPair {
+	captions := e.captions(cues)
+
+	var groups []pairGroup
+	var erase *pairGroup
+	for i, c := range captions {
+		load := e.load(c.lines)
+		loading := pairGroup{frame: c.start - int64(len(load)), pairs: load}
+		// The caption before it is erased where it ends, unless the
+		// loading of this one is due first.
+		if erase != nil && erase.frame < loading.frame {
+			groups = append(groups, *erase, loading)
+		} else if erase != nil {
+			groups = append(groups, loading, *erase)
+		} else {
+			groups = append(groups, loading)
+		}
+		groups = append(groups, pairGroup{frame: c.start, pairs: e.control(cea608EndOfCaption)})
+		erase = nil
+		// A caption flipped on where this one ends replaces it.
+		if i+1 == len(captions) || captions[i+1].start > c.end {
+			erase = &pairGroup{frame: c.end, pairs: e.control(cea608EraseDisplayed)}
+		}
+	}
+	if erase != nil {
+		groups = append(groups, *erase)
+	}
+
+	var pairs []CaptionPair
+	var next int64
+	for _, group := range groups {
+		frame := max(group.frame, next)
+		for _, pair := range group.pairs {
+			pairs = append(pairs, CaptionPair{Frame: frame, Data: pair})
+			frame++
+		}
+		next = frame
+	}
+	return pairs
+}
+
+// captions returns the captions of cues in time order, splitting cues
+// with more lines than a caption takes into consecutive captions.
+func (e *CEA608Encoder) captions(cues []SubtitleEvent) []caption {
+	cues = append([]SubtitleEvent(nil), cues...)
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].StartTime < cues[j].StartTime })
+
+	var captions []caption
+	for _, cue := range cues {
+		lines := wrapCaption(cue.Text)
+		if len(lines) == 0 || cue.EndTime <= cue.StartTime {
+			continue
+		}
+		parts := (len(lines) + e.cfg.Rows - 1) / e.cfg.Rows
+		length := (cue.EndTime - cue.StartTime) / time.Duration(parts)
+		for part := 0; part < parts; part++ {
+			start := cue.StartTime + time.Duration(part)*length
+			captions = append(captions, caption{
+				start: e.frame(start),
+				end:   max(e.frame(start+length), e.frame(start)+1),
+				lines: lines[part*e.cfg.Rows : min(len(lines), (part+1)*e.cfg.Rows)],
+			})
+		}
+	}
+	return captions
+}
+
+// frame returns the index of the frame showing time t.
+func (e *CEA608Encoder) frame(t time.Duration) int64 {
+	return int64(math.Floor(t.Seconds()*e.cfg.FrameRate + 1e-9))
+}
+
+// load returns the pairs that load lines into the caption off screen,
+// centred on the bottom rows.
+func (e *CEA608Encoder) load(lines []string) [][2]byte {
+	pairs := append(e.control(cea608ResumeCaptionLoading), e.control(cea608EraseNonDisplayed)...)
+	for i, line := range lines {
+		row := 15 - len(lines) + 1 + i
+		column := (CEA608Columns - utf8.RuneCountInString(line)) / 2
+		pairs = append(pairs, e.doubled(e.preamble(row, column/4*4))...)
+		if tab := column % 4; tab > 0 {
+			pairs = append(pairs, e.doubled([2]byte{cea608TabOffsetFirstByte | e.channel, 0x20 + byte(tab)})...)
+		}
+		pairs = append(pairs, e.text(line)...)
+	}
+	return pairs
+}
+
+// cea608Rows maps the rows of the screen, from 1 to 15, to the first byte
+// of their preamble address codes and whether they take the upper range of
+// second bytes.
+var cea608Rows = [16]struct {
+	first byte
+	upper bool
+}{
+	1: {0x11, false}, 2: {0x11, true}, 3: {0x12, false}, 4: {0x12, true},
+	5: {0x15, false}, 6: {0x15, true}, 7: {0x16, false}, 8: {0x16, true},
+	9: {0x17, false}, 10: {0x17, true}, 11: {0x10, false}, 12: {0x13, false},
+	13: {0x13, true}, 14: {0x14, false}, 15: {0x14, true},
+}
+
+// preamble returns the preamble address code that moves the cursor to
+// row in white, indented by indent columns, a multiple of four.
+func (e *CEA608Encoder) preamble(row, indent int) [2]byte {
+	code := cea608Rows[row]
+	second := byte(0x40 | 0x10 | (indent/4)<<1)
+	if code.upper {
+		second |= 0x20
+	}
+	return [2]byte{code.first | e.channel, second}
+}
+
+// control returns the doubled pair of a miscellaneous control code, sent
+// twice so that decoders missing one still act on it.
+func (e *CEA608Encoder) control(code byte) [][2]byte {
+	return e.doubled([2]byte{e.misc, code})
+}
+
+func (e *CEA608Encoder) doubled(pair [2]byte) [][2]byte {
+	pair = [2]byte{withParity(pair[0]), withParity(pair[1])}
+	return [][2]byte{pair, pair}
+}
+
+// text returns the pairs of the characters of line: basic characters two
+// to a pair, and special and extended characters in doubled pairs of their
+// own. Extended characters follow a basic character that decoders without
+// them show instead.
+func (e *CEA608Encoder) text(line string) [][2]byte {
+	var pairs [][2]byte
+	var pending []byte
+	flush := func() {
+		if len(pending) == 1 {
+			pending = append(pending, 0)
+		}
+		if len(pending) == 2 {
+			pairs = append(pairs, [2]byte{withParity(pending[0]), withParity(pending[1])})
+		}
+		pending = pending[:0]
+	}
+	for _, r := range line {
+		if b, ok := cea608Basic(r); ok {
+			pending = append(pending, b)
+			if len(pending) == 2 {
+				flush()
+			}
+			continue
+		}
+		if code, ok := cea608Special[r]; ok {
+			flush()
+			pairs = append(pairs, e.doubled([2]byte{cea608SpecialFirstByte | e.channel, code})...)
+			continue
+		}
+		if code, ok := cea608Extended[r]; ok {
+			// The extended character replaces the basic one before it.
+			pending = append(pending, code.fallback)
+			flush()
+			pairs = append(pairs, e.doubled([2]byte{code.first | e.channel, code.second})...)
+			continue
+		}
+		pending = append(pending, '?')
+		if len(pending) == 2 {
+			flush()
+		}
+	}
+	flush()
+	return pairs
+}
+
+// cea608Basic returns the byte of r in the basic character set, which is
+// ASCII with some accented letters in place of rarely captioned symbols.
+func cea608Basic(r rune) (byte, bool) {
+	switch r {
+	case 'á':
+		return 0x2a, true
+	case 'é':
+		return 0x5c, true
+	case 'í':
+		return 0x5e, true
+	case 'ó':
+		return 0x5f, true
+	case 'ú':
+		return 0x60, true
+	case 'ç':
+		return 0x7b, true
+	case '÷':
+		return 0x7c, true
+	case 'Ñ':
+		return 0x7d, true
+	case 'ñ':
+		return 0x7e, true
+	case '█':
+		return 0x7f, true
+	case '*', '\\', '^', '_', '`', '{', '|', '}', '~':
+		// Their bytes carry the letters above.
+		return 0, false
+	case '’':
+		return '\'', true
+	}
+	if r >= 0x20 && r < 0x7f {
+		return byte(r), true
+	}
+	return 0, false
+}
+
+// cea608Special maps the special characters to the second byte of their
+// codes.
+var cea608Special = map[rune]byte{
+	'®': 0x30, '°': 0x31, '½': 0x32, '¿': 0x33, '™': 0x34, '¢': 0x35, '£': 0x36, '♪': 0x37,
+	'à': 0x38, 'è': 0x3a, 'â': 0x3b, 'ê': 0x3c, 'î': 0x3d, 'ô': 0x3e, 'û': 0x3f,
+}
+
+// cea608ExtendedChar is the code of an extended character and the basic
+// character shown by decoders without it.
+type cea608ExtendedChar struct {
+	first, second, fallback byte
+}
+
+// cea608Extended maps the extended Spanish, French, Portuguese and German
+// characters to their codes.
+var cea608Extended = func() map[rune]cea608ExtendedChar {
+	sets := []struct {
+		first     byte
+		chars     string
+		fallbacks string
+	}{
+		{cea608ExtendedFirstByte, "ÁÉÓÚÜü‘¡*'—©℠•“”ÀÂÇÈÊËëÎÏïÔÙùÛ«»", "AEOUUu'! '-cs.\"\"AACEEEeIIiOUuU\"\""},
+		{cea608ExtendedLastFirstByte, "ÃãÍÌìÒòÕõ{}\\^_|~ÄäÖöß¥¤│ÅåØø┌┐└┘", "AaIIiOoOo()/'-!-AaOosY$!AaOo++++"},
+	}
+	chars := make(map[rune]cea608ExtendedChar)
+	for _, set := range sets {
+		fallbacks := []byte(set.fallbacks)
+		for i, r := range []rune(set.chars) {
+			if _, ok := chars[r]; !ok {
+				chars[r] = cea608ExtendedChar{first: set.first, second: 0x20 + byte(i), fallback: fallbacks[i]}
+			}
+		}
+	}
+	return chars
+}()
+
+// withParity sets the parity bit of b so that it has an odd number of set
+// bits, as CEA-608 bytes do.
+func withParity(b byte) byte {
+	b &= 0x7f
+	ones := 0
+	for v := b; v > 0; v >>= 1 {
+		ones += int(v & 1)
+	}
+	if ones%2 == 0 {
+		b |= 0x80
+	}
+	return b
+}
+
+// wrapCaption wraps text at word boundaries into lines of at most
+// CEA608Columns characters.
+func wrapCaption(text string) []string {
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		for len(runes) > CEA608Columns {
+			if len(line) > 0 {
+				lines, line = append(lines, string(line)), nil
+			}
+			lines = append(lines, string(runes[:CEA608Columns]))
+			runes = runes[CEA608Columns:]
+		}
+		if len(line) > 0 && len(line)+1+len(runes) > CEA608Columns {
+			lines, line = append(lines, string(line)), nil
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, runes...)
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+// WriteSCC writes pairs, timed at DefaultCaptionFrameRate, as a Scenarist
+// SCC sidecar file: each run of pairs in consecutive frames is a line
+// starting at the drop-frame timecode of its first frame.
+func WriteSCC(w io.Writer, pairs []CaptionPair) error {
+	var b strings.Builder
+	b.WriteString("Scenarist_SCC V1.0\n")
+	for i, pair := range pairs {
+		if i > 0 && pair.Frame <= pairs[i-1].Frame {
+			return errors.New("caption pairs out of frame order")
+		}
+		if i == 0 || pair.Frame != pairs[i-1].Frame+1 {
+			fmt.Fprintf(&b, "\n\n%s\t", dropFrameTimecode(pair.Frame))
+		} else {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%02x%02x", pair.Data[0], pair.Data[1])
+	}
+	if len(pairs) > 0 {
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dropFrameTimecode returns the SMPTE drop-frame timecode of frame at
+// 29.97 frames per second, which skips frame numbers 0 and 1 of every
+// minute but each tenth.
+func dropFrameTimecode(frame int64) string {
+	const perTenMinutes, perMinute = 17982, 1798
+	tens, rest := frame/perTenMinutes, frame%perTenMinutes
+	frame += 18 * tens
+	if rest >= 2 {
+		frame += 2 * ((rest - 2) / perMinute)
+	}
+	return fmt.Sprintf("%02d:%02d:%02d;%02d", frame/108000, frame/1800%60, frame/30%60, frame%30)
+}
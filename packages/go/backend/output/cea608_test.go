@@ -0,0 +1,160 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hexPairs returns the pairs as SCC writes them.
+func hexPairs(pairs []CaptionPair) string {
+	words := make([]string, len(pairs))
+	for i, pair := range pairs {
+		words[i] = fmt.Sprintf("%02x%02x", pair.Data[0], pair.Data[1])
+	}
+	return strings.Join(words, " ")
+}
+
+func TestCEA608EncoderEncodesPopOnCaptions(t *testing.T) {
+	t.Parallel()
+
+	encoder, err := NewCEA608Encoder(CEA608Config{})
+	if err != nil {
+		t.Fatalf("NewCEA608Encoder: %v", err)
+	}
+	pairs := encoder.Encode([]SubtitleEvent{{StartTime: 2 * time.Second, EndTime: 4 * time.Second, Text: "Hola"}})
+
+	// Resume caption loading, erase the hidden caption, move to row 15
+	// column 14 and load the text ahead of 2s, flip it on at 2s and erase
+	// it at 4s. Control codes are doubled.
+	want := "9420 9420 94ae 94ae 9476 9476 97a2 97a2 c8ef ec61 942f 942f 942c 942c"
+	if got := hexPairs(pairs); got != want {
+		t.Fatalf("expected pairs %s, got %s", want, got)
+	}
+	if pairs[0].Frame != 49 || pairs[10].Frame != 59 || pairs[12].Frame != 119 {
+		t.Fatalf("expected loading from frame 49, the flip at 59 and the erase at 119, got %+v", pairs)
+	}
+	for i := 1; i < 12; i++ {
+		if pairs[i].Frame != pairs[i-1].Frame+1 {
+			t.Fatalf("expected the loading and flip in consecutive frames, got %+v", pairs)
+		}
+	}
+}
+
+func TestCEA608EncoderEncodesAccentedCharacters(t *testing.T) {
+	t.Parallel()
+
+	encoder, err := NewCEA608Encoder(CEA608Config{})
+	if err != nil {
+		t.Fatalf("NewCEA608Encoder: %v", err)
+	}
+	for _, tc := range []struct {
+		text, want string
+	}{
+		// ¿ is a special character; é is in the basic set.
+		{"¿Qué?", "91b3 91b3 5175 dcbf"},
+		// Ü follows the U decoders without it show.
+		{"Ü", "d580 92a4 92a4"},
+		// ß is in the Portuguese and German set; CC1 has no emoji.
+		{"ß😀", "7380 1334 1334 bf80"},
+	} {
+		pairs := encoder.Encode([]SubtitleEvent{{StartTime: 10 * time.Second, EndTime: 11 * time.Second, Text: tc.text}})
+		text := hexPairs(pairs[6:])
+		text = strings.TrimPrefix(text, "97a1 97a1 ")
+		text = strings.TrimPrefix(text, "97a2 97a2 ")
+		text = strings.TrimPrefix(text, "9723 9723 ")
+		if got := strings.TrimSuffix(text, " 942f 942f 942c 942c"); got != tc.want {
+			t.Errorf("%q: expected %s, got %s", tc.text, tc.want, got)
+		}
+	}
+}
+
+func TestCEA608EncoderSplitsLongCues(t *testing.T) {
+	t.Parallel()
+
+	encoder, err := NewCEA608Encoder(CEA608Config{Channel: 2, Rows: 1})
+	if err != nil {
+		t.Fatalf("NewCEA608Encoder: %v", err)
+	}
+	text := strings.Repeat("palabra ", 6) + "fin"
+	pairs := encoder.Encode([]SubtitleEvent{
+		{StartTime: 10 * time.Second, EndTime: 14 * time.Second, Text: text},
+		{StartTime: 14 * time.Second, EndTime: 15 * time.Second, Text: "sigue"},
+	})
+	encoded := hexPairs(pairs)
+	// Two lines on one row are two captions, each flipped on with the
+	// end-of-caption code of CC2; the next cue replaces the last without
+	// an erase in between.
+	if strings.Count(encoded, "1c2f 1c2f") != 3 || strings.Count(encoded, "1c2c 1c2c") != 1 {
+		t.Fatalf("expected three captions and one erase on CC2, got %s", encoded)
+	}
+	if !strings.HasSuffix(encoded, "1c2c 1c2c") {
+		t.Fatalf("expected the last caption erased, got %s", encoded)
+	}
+	for i := 1; i < len(pairs); i++ {
+		if pairs[i].Frame <= pairs[i-1].Frame {
+			t.Fatalf("expected one pair per frame in order, got %+v", pairs)
+		}
+	}
+
+	if _, err := NewCEA608Encoder(CEA608Config{Channel: 3}); err == nil {
+		t.Fatal("expected CC3 to be rejected")
+	}
+	if _, err := NewCEA608Encoder(CEA608Config{Rows: 5}); err == nil {
+		t.Fatal("expected five rows to be rejected")
+	}
+}
+
+func TestWriteSCCTimesRunsOfPairs(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	err := WriteSCC(&b, []CaptionPair{
+		{Frame: 59, Data: [2]byte{0x94, 0x2f}},
+		{Frame: 60, Data: [2]byte{0x94, 0x2f}},
+		{Frame: 1800, Data: [2]byte{0x94, 0x2c}},
+	})
+	if err != nil {
+		t.Fatalf("WriteSCC: %v", err)
+	}
+	want := "Scenarist_SCC V1.0\n\n\n00:00:01;29\t942f 942f\n\n00:01:00;02\t942c\n"
+	if b.String() != want {
+		t.Fatalf("expected %q, got %q", want, b.String())
+	}
+	if err := WriteSCC(&b, []CaptionPair{{Frame: 2}, {Frame: 1}}); err == nil {
+		t.Fatal("expected pairs out of order to fail")
+	}
+
+	for frame, want := range map[int64]string{0: "00:00:00;00", 1799: "00:00:59;29", 17982: "00:10:00;00", 107892: "01:00:00;00"} {
+		if got := dropFrameTimecode(frame); got != want {
+			t.Errorf("frame %d: expected %s, got %s", frame, want, got)
+		}
+	}
+}
+
+func TestCCDataCarriesCEA608InCaptionSEI(t *testing.T) {
+	t.Parallel()
+
+	data, err := CCData([2]byte{0x94, 0x2f}, DefaultCCCount)
+	if err != nil {
+		t.Fatalf("CCData: %v", err)
+	}
+	if len(data) != 2+3*DefaultCCCount+1 || data[0] != 0xd4 || data[len(data)-1] != 0xff {
+		t.Fatalf("unexpected cc_data framing % x", data)
+	}
+	if !bytes.Equal(data[2:11], []byte{0xfc, 0x94, 0x2f, 0xfd, 0x80, 0x80, 0xfa, 0x00, 0x00}) {
+		t.Fatalf("expected field 1 data, a field 2 null and padding, got % x", data[2:11])
+	}
+	sei, err := CaptionSEI(data)
+	if err != nil {
+		t.Fatalf("CaptionSEI: %v", err)
+	}
+	if !bytes.HasPrefix(sei, []byte("\xb5\x00\x31GA94\x03")) || !bytes.HasSuffix(sei, data) {
+		t.Fatalf("unexpected SEI payload % x", sei)
+	}
+	if _, err := CCData(CEA608NullPair, 1); err == nil {
+		t.Fatal("expected a cc_count without room for both fields to fail")
+	}
+}
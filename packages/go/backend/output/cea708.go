@@ -0,0 +1,60 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultCCCount is the number of cc_data triplets ATSC A/53 sets for each
+// frame of 29.97 fps video.
+const DefaultCCCount = 20
+
+// Types of cc_data triplets.
+const (
+	ccTypeField1  = 0
+	ccTypeField2  = 1
+	ccTypePadding = 2
+)
+
+// CCData returns the ATSC A/53 cc_data() structure of one video frame, the
+// caption data CEA-708 defines, carrying pair as the CEA-608 data of field
+// 1 and padded to count triplets. CEA-708 decoders show the captions of
+// this CEA-608 data, which every ATSC caption stream carries. A frame
+// without caption data carries CEA608NullPair.
+func CCData(pair [2]byte, count int) ([]byte, error) {
+	if count < 2 || count > 31 {
+		return nil, fmt.Errorf("cc_count %d, want 2 to 31", count)
+	}
+	// reserved, process_cc_data_flag, additional_data_flag, cc_count and
+	// em_data.
+	data := []byte{0x80 | 0x40 | byte(count), 0xff}
+	data = append(data, ccTriplet(true, ccTypeField1, pair)...)
+	data = append(data, ccTriplet(true, ccTypeField2, CEA608NullPair)...)
+	for i := 2; i < count; i++ {
+		data = append(data, ccTriplet(false, ccTypePadding, [2]byte{})...)
+	}
+	return append(data, 0xff), nil
+}
+
+// ccTriplet returns a cc_data triplet: marker bits, cc_valid and cc_type,
+// then the two bytes of data.
+func ccTriplet(valid bool, ccType byte, data [2]byte) []byte {
+	head := 0xf8 | ccType
+	if valid {
+		head |= 0x04
+	}
+	return []byte{head, data[0], data[1]}
+}
+
+// CaptionSEI returns the payload of the user_data_registered_itu_t_t35 SEI
+// message, payload type 4, that carries ccData, as CCData returns it, in
+// H.264 and HEVC video: the United States country code, the ATSC provider
+// code, the "GA94" identifier and the cc_data user data type. Muxers wrap
+// it in an SEI NAL unit of the frame it belongs to.
+func CaptionSEI(ccData []byte) ([]byte, error) {
+	if len(ccData) < 3 {
+		return nil, errors.New("cc_data required")
+	}
+	payload := []byte{0xb5, 0x00, 0x31, 'G', 'A', '9', '4', 0x03}
+	return append(payload, ccData...), nil
+}
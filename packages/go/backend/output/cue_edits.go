@@ -0,0 +1,157 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"streamlation/packages/backend/translation"
+)
+
+// CueListFormat is the format of cue lists, a JSON array of cues.
+const CueListFormat = "json"
+
+// Cue is a subtitle cue of a session as listed for post-editing, under the
+// ID its subtitle events carry.
+type Cue struct {
+	ID        string        `json:"id"`
+	Index     int           `json:"index"`
+	StartTime time.Duration `json:"startTime"`
+	EndTime   time.Duration `json:"endTime"`
+	Text      string        `json:"text"`
+	Speaker   string        `json:"speaker,omitempty"`
+	// Edited marks cues whose text or timing a CueEdit overrides.
+	Edited bool `json:"edited,omitempty"`
+}
+
+// CueEdit overrides the text or timing of the cue with CueID; the fields
+// it leaves nil keep their generated values.
+type CueEdit struct {
+	CueID     string         `json:"cueId"`
+	Text      *string        `json:"text,omitempty"`
+	StartTime *time.Duration `json:"startTime,omitempty"`
+	EndTime   *time.Duration `json:"endTime,omitempty"`
+	EditedAt  time.Time      `json:"editedAt"`
+}
+
+// Merge returns the edit with the fields set by later overriding those of
+// e.
+func (e CueEdit) Merge(later CueEdit) CueEdit {
+	if later.Text != nil {
+		e.Text = later.Text
+	}
+	if later.StartTime != nil {
+		e.StartTime = later.StartTime
+	}
+	if later.EndTime != nil {
+		e.EndTime = later.EndTime
+	}
+	e.EditedAt = later.EditedAt
+	return e
+}
+
+// CueEditStore keeps the edits of the cues of each session, one per cue,
+// layered over the cues generated.
+type CueEditStore interface {
+	SaveCueEdit(ctx context.Context, sessionID string, edit CueEdit) error
+	CueEdits(ctx context.Context, sessionID string) ([]CueEdit, error)
+}
+
+// NewCues returns the cues of translations, the final formatted
+// translations of a session into language, numbered from 0 the way its
+// subtitle events are.
+func NewCues(language string, translations []translation.Translation) []Cue {
+	cues := make([]Cue, 0, len(translations))
+	for _, translated := range translations {
+		if translated.Partial {
+			continue
+		}
+		cues = append(cues, Cue{
+			ID:        CueID(language, len(cues)),
+			Index:     len(cues),
+			StartTime: translated.StartTime,
+			EndTime:   translated.EndTime,
+			Text:      translated.TranslatedText,
+			Speaker:   translated.Speaker,
+		})
+	}
+	return cues
+}
+
+// ApplyCueEdits returns a copy of cues with the edits of any of them
+// applied and marked.
+func ApplyCueEdits(cues []Cue, edits []CueEdit) []Cue {
+	byID := make(map[string]CueEdit, len(edits))
+	for _, edit := range edits {
+		byID[edit.CueID] = edit
+	}
+	edited := make([]Cue, len(cues))
+	for i, cue := range cues {
+		if edit, ok := byID[cue.ID]; ok {
+			cue = cue.apply(edit)
+		}
+		edited[i] = cue
+	}
+	return edited
+}
+
+// ValidateCueEdit returns an error unless edit leaves cue with text and
+// with a start before its end.
+func ValidateCueEdit(cue Cue, edit CueEdit) error {
+	cue = cue.apply(edit)
+	if cue.Text == "" {
+		return errors.New("cue text required")
+	}
+	if cue.StartTime < 0 || cue.EndTime <= cue.StartTime {
+		return fmt.Errorf("cue must start before it ends, got %v-%v", cue.StartTime, cue.EndTime)
+	}
+	return nil
+}
+
+func (c Cue) apply(edit CueEdit) Cue {
+	if edit.Text != nil {
+		c.Text = *edit.Text
+	}
+	if edit.StartTime != nil {
+		c.StartTime = *edit.StartTime
+	}
+	if edit.EndTime != nil {
+		c.EndTime = *edit.EndTime
+	}
+	c.Edited = true
+	return c
+}
+
+// CueTranslations returns cues as the final translations into language
+// that render them, for a generator that does not format them again.
+func CueTranslations(language string, cues []Cue) []translation.Translation {
+	translations := make([]translation.Translation, len(cues))
+	for i, cue := range cues {
+		translations[i] = translation.Translation{
+			TranslatedText: cue.Text,
+			TargetLang:     language,
+			StartTime:      cue.StartTime,
+			EndTime:        cue.EndTime,
+			Speaker:        cue.Speaker,
+		}
+	}
+	return translations
+}
+
+// PersistCues persists cues as the cue list of sessionID in language, which
+// edits of its cues are applied to.
+func (w *ArtifactWriter) PersistCues(ctx context.Context, sessionID, language string, cues []Cue) (Artifact, error) {
+	data, err := json.Marshal(cues)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("encode cues: %w", err)
+	}
+	return w.Persist(ctx, Artifact{
+		SessionID: sessionID,
+		Kind:      ArtifactCues,
+		Language:  language,
+		Format:    CueListFormat,
+	}, bytes.NewReader(data))
+}
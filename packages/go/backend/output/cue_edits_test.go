@@ -0,0 +1,74 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/translation"
+)
+
+func TestApplyCueEditsOverridesCues(t *testing.T) {
+	t.Parallel()
+
+	cues := NewCues("es", []translation.Translation{
+		{TranslatedText: "Hola.", StartTime: 0, EndTime: time.Second, Speaker: "A"},
+		{TranslatedText: "Hol", Partial: true},
+		{TranslatedText: "Adiós.", StartTime: 2 * time.Second, EndTime: 3 * time.Second},
+	})
+	if len(cues) != 2 || cues[1].ID != "es-1" || cues[1].Index != 1 {
+		t.Fatalf("expected the final translations numbered from 0, got %+v", cues)
+	}
+
+	text, start, end := "Hasta luego.", 1500*time.Millisecond, 2500*time.Millisecond
+	edit := CueEdit{CueID: "es-1", Text: &text}.Merge(CueEdit{CueID: "es-1", StartTime: &start})
+	edited := ApplyCueEdits(cues, []CueEdit{edit, {CueID: "fr-0", EndTime: &end}})
+
+	if edited[0] != cues[0] {
+		t.Fatalf("expected the cue without edits kept, got %+v", edited[0])
+	}
+	if want := (Cue{ID: "es-1", Index: 1, StartTime: start, EndTime: 3 * time.Second, Text: text, Edited: true}); edited[1] != want {
+		t.Fatalf("expected the merged edit applied, got %+v", edited[1])
+	}
+	if cues[1].Edited {
+		t.Fatal("expected the cues given to be left alone")
+	}
+
+	if err := ValidateCueEdit(cues[0], CueEdit{EndTime: &start}); err != nil {
+		t.Fatalf("expected a valid edit, got %v", err)
+	}
+	if err := ValidateCueEdit(cues[0], CueEdit{StartTime: &end}); err == nil {
+		t.Fatal("expected an edit starting after the cue ends to be rejected")
+	}
+	empty := ""
+	if err := ValidateCueEdit(cues[0], CueEdit{Text: &empty}); err == nil {
+		t.Fatal("expected an edit emptying the cue to be rejected")
+	}
+}
+
+func TestArtifactWriterPersistsCues(t *testing.T) {
+	t.Parallel()
+
+	store := &memoryArtifactStore{}
+	writer, err := NewArtifactWriter(store, nil)
+	if err != nil {
+		t.Fatalf("NewArtifactWriter: %v", err)
+	}
+	cues := []Cue{{ID: "es-0", EndTime: time.Second, Text: "Hola."}}
+
+	artifact, err := writer.PersistCues(context.Background(), "session", "es", cues)
+	if err != nil {
+		t.Fatalf("PersistCues: %v", err)
+	}
+	if artifact.Key != "session/cues/es.json" || artifact.ContentType != "application/json" || artifact.Kind != ArtifactCues {
+		t.Fatalf("unexpected artifact %+v", artifact)
+	}
+	var stored []Cue
+	if err := json.Unmarshal([]byte(store.files[artifact.Key]), &stored); err != nil || len(stored) != 1 || stored[0] != cues[0] {
+		t.Fatalf("expected the cues stored, got %+v (%v)", stored, err)
+	}
+	if translations := CueTranslations("es", stored); translations[0].TranslatedText != "Hola." || translations[0].TargetLang != "es" || translations[0].EndTime != time.Second {
+		t.Fatalf("expected the cue as a translation, got %+v", translations)
+	}
+}
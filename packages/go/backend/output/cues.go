@@ -0,0 +1,449 @@
+package output
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"streamlation/packages/backend/translation"
+)
+
+// Defaults of CueRules, in line with common subtitling guidelines for
+// languages written in the Latin alphabet.
+const (
+	DefaultMaxLineChars      = 42
+	DefaultMaxCueLines       = 2
+	DefaultMinCueDuration    = time.Second
+	DefaultMaxCueDuration    = 7 * time.Second
+	DefaultMaxCharsPerSecond = 17
+)
+
+// DefaultLanguageCueRules are the rules of languages whose characters carry
+// more than a letter does, keyed by primary language subtag. Their zero
+// fields fall back to the rules of every language.
+var DefaultLanguageCueRules = map[string]CueRules{
+	"ja": {MaxLineChars: 13, MaxCharsPerSecond: 4},
+	"ko": {MaxLineChars: 16, MaxCharsPerSecond: 12},
+	"zh": {MaxLineChars: 16, MaxCharsPerSecond: 9},
+}
+
+// CueRules bound the text and the timing of subtitle cues so that viewers
+// can read them. Characters are counted in runes, spaces included.
+type CueRules struct {
+	// MaxLineChars is the most characters on a line. Defaults to
+	// DefaultMaxLineChars.
+	MaxLineChars int
+	// MaxLines is the most lines of a cue. Defaults to DefaultMaxCueLines.
+	MaxLines int
+	// MinDuration is the least time a cue is shown. Defaults to
+	// DefaultMinCueDuration.
+	MinDuration time.Duration
+	// MaxDuration is the most time a cue is shown. Defaults to
+	// DefaultMaxCueDuration.
+	MaxDuration time.Duration
+	// MaxCharsPerSecond is the fastest reading speed a cue asks of viewers.
+	// Defaults to DefaultMaxCharsPerSecond.
+	MaxCharsPerSecond float64
+}
+
+// withDefaults returns r with its zero fields taken from defaults.
+func (r CueRules) withDefaults(defaults CueRules) CueRules {
+	if r.MaxLineChars <= 0 {
+		r.MaxLineChars = defaults.MaxLineChars
+	}
+	if r.MaxLines <= 0 {
+		r.MaxLines = defaults.MaxLines
+	}
+	if r.MinDuration <= 0 {
+		r.MinDuration = defaults.MinDuration
+	}
+	if r.MaxDuration <= 0 {
+		r.MaxDuration = defaults.MaxDuration
+	}
+	if r.MaxCharsPerSecond <= 0 {
+		r.MaxCharsPerSecond = defaults.MaxCharsPerSecond
+	}
+	return r
+}
+
+// readingTime returns how long a cue of width characters is shown: long
+// enough to be read at r.MaxCharsPerSecond, and at least r.MinDuration.
+func (r CueRules) readingTime(width int) time.Duration {
+	return max(r.MinDuration, time.Duration(float64(width)/r.MaxCharsPerSecond*float64(time.Second)))
+}
+
+// CueFormatterConfig configures a CueFormatter. Zero values fall back to the
+// defaults.
+type CueFormatterConfig struct {
+	// Rules are the rules of languages without rules of their own.
+	Rules CueRules
+	// Languages holds the rules of languages, keyed by language tag or
+	// primary subtag such as "ja", and overrides DefaultLanguageCueRules.
+	// Their zero fields fall back to DefaultLanguageCueRules, then to Rules.
+	Languages map[string]CueRules
+}
+
+// CueFormatter reshapes translations into subtitle cues that follow the
+// rules of their target language: text is broken into balanced lines,
+// translations too long for a cue are split into several that share its
+// time, cues too short to be read are merged with their neighbours, and
+// every cue is shown long enough for its reading speed.
+type CueFormatter struct {
+	rules     CueRules
+	languages map[string]CueRules
+}
+
+// NewCueFormatter returns a formatter applying the rules of cfg.
+func NewCueFormatter(cfg CueFormatterConfig) *CueFormatter {
+	rules := cfg.Rules.withDefaults(CueRules{
+		MaxLineChars:      DefaultMaxLineChars,
+		MaxLines:          DefaultMaxCueLines,
+		MinDuration:       DefaultMinCueDuration,
+		MaxDuration:       DefaultMaxCueDuration,
+		MaxCharsPerSecond: DefaultMaxCharsPerSecond,
+	})
+	languages := make(map[string]CueRules)
+	for language, languageRules := range DefaultLanguageCueRules {
+		languages[language] = languageRules.withDefaults(rules)
+	}
+	for language, languageRules := range cfg.Languages {
+		language = strings.ToLower(strings.TrimSpace(language))
+		defaults := DefaultLanguageCueRules[language].withDefaults(rules)
+		languages[language] = languageRules.withDefaults(defaults)
+	}
+	return &CueFormatter{rules: rules, languages: languages}
+}
+
+// Rules returns the rules of cues in language.
+func (f *CueFormatter) Rules(language string) CueRules {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if rules, ok := f.languages[language]; ok {
+		return rules
+	}
+	primary, _, _ := strings.Cut(language, "-")
+	if rules, ok := f.languages[primary]; ok {
+		return rules
+	}
+	return f.rules
+}
+
+// Format returns the cues of a subtitle file holding translations, in
+// order. Partial translations are left out, as files only hold final cues.
+func (f *CueFormatter) Format(translations []translation.Translation) []translation.Translation {
+	var merged []translation.Translation
+	for _, trans := range translations {
+		if trans.Partial {
+			continue
+		}
+		if last := len(merged) - 1; last >= 0 && f.joins(merged[last], trans) {
+			merged[last] = joinCues(merged[last], trans)
+			continue
+		}
+		merged = append(merged, trans)
+	}
+	var cues []translation.Translation
+	for _, trans := range merged {
+		cues = append(cues, f.split(trans)...)
+	}
+	f.retime(cues)
+	return cues
+}
+
+// FormatStream formats translations as they arrive. Final translations are
+// split and retimed like those of files; partial ones only have their lines
+// broken, so that the cue they refine keeps its index. Cues are not merged,
+// which would hold them back until the next arrives.
+func (f *CueFormatter) FormatStream(ctx context.Context, translations <-chan translation.Translation) <-chan translation.Translation {
+	out := make(chan translation.Translation)
+	go func() {
+		defer close(out)
+		for trans := range translations {
+			cues := []translation.Translation{trans}
+			if trans.Partial {
+				rules := f.Rules(trans.TargetLang)
+				cues[0].TranslatedText = strings.Join(breakLines(cueTokens(trans.TranslatedText, rules.MaxLineChars), rules.MaxLineChars), "\n")
+			} else {
+				cues = f.split(trans)
+				f.retime(cues)
+			}
+			for _, cue := range cues {
+				select {
+				case out <- cue:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// joins reports whether next is merged into prev: one of them is shown too
+// briefly to be read, they are attributed to the same speaker, and together
+// they fit one cue.
+func (f *CueFormatter) joins(prev, next translation.Translation) bool {
+	rules := f.Rules(prev.TargetLang)
+	switch {
+	case prev.TargetLang != next.TargetLang, prev.Speaker != next.Speaker:
+		return false
+	case prev.EndTime-prev.StartTime >= rules.MinDuration && next.EndTime-next.StartTime >= rules.MinDuration:
+		return false
+	case next.StartTime-prev.EndTime > rules.MinDuration, next.EndTime-prev.StartTime > rules.MaxDuration:
+		return false
+	}
+	tokens := cueTokens(prev.TranslatedText+" "+next.TranslatedText, rules.MaxLineChars)
+	return len(wrapTokens(tokens, rules.MaxLineChars)) <= rules.MaxLines
+}
+
+// joinCues returns the cue of prev followed by next.
+func joinCues(prev, next translation.Translation) translation.Translation {
+	prev.SourceText = strings.TrimSpace(prev.SourceText + " " + next.SourceText)
+	prev.TranslatedText = strings.TrimSpace(prev.TranslatedText + " " + next.TranslatedText)
+	prev.Confidence = min(prev.Confidence, next.Confidence)
+	prev.EndTime = max(prev.EndTime, next.EndTime)
+	return prev
+}
+
+// split returns the cues of trans: as few as fit its text within the lines
+// of a cue and its time within the longest a cue is shown, of similar
+// length, sharing its time by their length.
+func (f *CueFormatter) split(trans translation.Translation) []translation.Translation {
+	rules := f.Rules(trans.TargetLang)
+	tokens := cueTokens(trans.TranslatedText, rules.MaxLineChars)
+	if len(tokens) == 0 {
+		return []translation.Translation{trans}
+	}
+	span := trans.EndTime - trans.StartTime
+	chunks := splitTokens(tokens, int((span+rules.MaxDuration-1)/rules.MaxDuration), rules)
+
+	total := 0
+	for _, chunk := range chunks {
+		total += tokensWidth(chunk)
+	}
+	if span <= 0 && len(chunks) > 1 {
+		// Without an end, the cues follow each other as they are read.
+		span = rules.readingTime(total)
+	}
+	cues := make([]translation.Translation, len(chunks))
+	offset := 0
+	for i, chunk := range chunks {
+		width := tokensWidth(chunk)
+		cues[i] = trans
+		cues[i].TranslatedText = strings.Join(breakLines(chunk, rules.MaxLineChars), "\n")
+		if len(chunks) > 1 {
+			cues[i].StartTime = trans.StartTime + span*time.Duration(offset)/time.Duration(total)
+			cues[i].EndTime = trans.StartTime + span*time.Duration(offset+width)/time.Duration(total)
+		}
+		offset += width
+	}
+	return cues
+}
+
+// retime shows each of cues for its reading time, without running into the
+// cue after it, and no longer than the most a cue is shown.
+func (f *CueFormatter) retime(cues []translation.Translation) {
+	for i := range cues {
+		cue := &cues[i]
+		rules := f.Rules(cue.TargetLang)
+		width := utf8.RuneCountInString(cue.TranslatedText) - strings.Count(cue.TranslatedText, "\n")
+		end := max(cue.EndTime, cue.StartTime+rules.readingTime(width))
+		if i+1 < len(cues) {
+			end = min(end, max(cue.EndTime, cues[i+1].StartTime))
+		}
+		cue.EndTime = min(end, cue.StartTime+rules.MaxDuration)
+	}
+}
+
+// cueToken is a word of cue text, or a character of a word too long for a
+// line, which is broken anywhere.
+type cueToken struct {
+	text  string
+	width int
+	// glued marks a token that follows the one before it without a space.
+	glued bool
+}
+
+// cueTokens returns the tokens of text, given lines of at most maxLineChars.
+func cueTokens(text string, maxLineChars int) []cueToken {
+	var tokens []cueToken
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		if len(runes) <= maxLineChars {
+			tokens = append(tokens, cueToken{text: word, width: len(runes)})
+			continue
+		}
+		for i, r := range runes {
+			tokens = append(tokens, cueToken{text: string(r), width: 1, glued: i > 0})
+		}
+	}
+	return tokens
+}
+
+// tokensWidth returns the width of tokens on one line.
+func tokensWidth(tokens []cueToken) int {
+	width := 0
+	for i, token := range tokens {
+		if i > 0 && !token.glued {
+			width++
+		}
+		width += token.width
+	}
+	return width
+}
+
+// wrapTokens breaks tokens greedily into lines of at most width characters,
+// or of a single token wider than that.
+func wrapTokens(tokens []cueToken, width int) [][]cueToken {
+	var lines [][]cueToken
+	start, lineWidth := 0, 0
+	for i, token := range tokens {
+		add := token.width
+		if i > start && !token.glued {
+			add++
+		}
+		if i > start && lineWidth+add > width {
+			lines = append(lines, tokens[start:i])
+			start, lineWidth, add = i, 0, token.width
+		}
+		lineWidth += add
+	}
+	if start < len(tokens) {
+		lines = append(lines, tokens[start:])
+	}
+	return lines
+}
+
+// breakLines breaks tokens into as many lines of at most maxLineChars
+// characters as wrapping them does, made as even as they can be.
+func breakLines(tokens []cueToken, maxLineChars int) []string {
+	lines := wrapTokens(tokens, maxLineChars)
+	if len(lines) > 1 {
+		for width := (tokensWidth(tokens) + len(lines) - 1) / len(lines); width < maxLineChars; width++ {
+			if even := wrapTokens(tokens, width); len(even) <= len(lines) {
+				lines = even
+				break
+			}
+		}
+	}
+	text := make([]string, len(lines))
+	for i, line := range lines {
+		var b strings.Builder
+		for j, token := range line {
+			if j > 0 && !token.glued {
+				b.WriteByte(' ')
+			}
+			b.WriteString(token.text)
+		}
+		text[i] = b.String()
+	}
+	return text
+}
+
+// splitTokens splits tokens into at least n chunks of similar width, and
+// into more when that is what fits each within the lines of a cue.
+func splitTokens(tokens []cueToken, n int, rules CueRules) [][]cueToken {
+	for n = min(max(n, 1), len(tokens)); ; n++ {
+		chunks := balanceTokens(tokens, n)
+		fits := true
+		for _, chunk := range chunks {
+			if len(wrapTokens(chunk, rules.MaxLineChars)) > rules.MaxLines {
+				fits = false
+				break
+			}
+		}
+		if fits || n >= len(tokens) {
+			return chunks
+		}
+	}
+}
+
+// balanceTokens splits tokens into n chunks of similar width, n being at
+// most the number of tokens.
+func balanceTokens(tokens []cueToken, n int) [][]cueToken {
+	chunks := make([][]cueToken, 0, n)
+	remaining := tokensWidth(tokens)
+	start := 0
+	for left := n; left > 1; left-- {
+		target := remaining / left
+		end, width := start, 0
+		// Every chunk after this one keeps a token.
+		for end < len(tokens)-(left-1) {
+			add := tokens[end].width
+			if end > start && !tokens[end].glued {
+				add++
+			}
+			if end > start && width+add/2 > target {
+				break
+			}
+			width += add
+			end++
+		}
+		chunks = append(chunks, tokens[start:end])
+		remaining -= width
+		start = end
+	}
+	return append(chunks, tokens[start:])
+}
+
+// FormattingGenerator is a SubtitleGenerator whose cues follow the rules of
+// a CueFormatter. Files are rendered from the formatted translations of
+// the wrapped generator's input, and streams have their translations
+// formatted as they arrive.
+type FormattingGenerator struct {
+	generator SubtitleGenerator
+	formatter *CueFormatter
+}
+
+// NewFormattingGenerator wraps generator so that its cues are formatted by
+// formatter.
+func NewFormattingGenerator(generator SubtitleGenerator, formatter *CueFormatter) *FormattingGenerator {
+	return &FormattingGenerator{generator: generator, formatter: formatter}
+}
+
+// GenerateSRT creates SRT subtitles from the formatted translations.
+func (g *FormattingGenerator) GenerateSRT(ctx context.Context, sessionID string, translations <-chan translation.Translation) (io.Reader, error) {
+	return g.generator.GenerateSRT(ctx, sessionID, g.format(translations))
+}
+
+// GenerateVTT creates WebVTT subtitles from the formatted translations.
+func (g *FormattingGenerator) GenerateVTT(ctx context.Context, sessionID string, translations <-chan translation.Translation) (io.Reader, error) {
+	return g.generator.GenerateVTT(ctx, sessionID, g.format(translations))
+}
+
+// GenerateTTML creates IMSC1 TTML subtitles from the formatted
+// translations.
+func (g *FormattingGenerator) GenerateTTML(ctx context.Context, sessionID string, translations <-chan translation.Translation) (io.Reader, error) {
+	return g.generator.GenerateTTML(ctx, sessionID, g.format(translations))
+}
+
+// GenerateSCC creates CEA-608 captions from the formatted translations.
+func (g *FormattingGenerator) GenerateSCC(ctx context.Context, sessionID string, translations <-chan translation.Translation) (io.Reader, error) {
+	return g.generator.GenerateSCC(ctx, sessionID, g.format(translations))
+}
+
+// StreamSubtitles streams the translations, formatted as they arrive.
+func (g *FormattingGenerator) StreamSubtitles(ctx context.Context, sessionID string, translations <-chan translation.Translation) (<-chan SubtitleEvent, error) {
+	return g.generator.StreamSubtitles(ctx, sessionID, g.formatter.FormatStream(ctx, translations))
+}
+
+// Health returns the health of the wrapped generator.
+func (g *FormattingGenerator) Health() HealthStatus {
+	return g.generator.Health()
+}
+
+// format collects translations and returns their cues.
+func (g *FormattingGenerator) format(translations <-chan translation.Translation) <-chan translation.Translation {
+	var collected []translation.Translation
+	for trans := range translations {
+		collected = append(collected, trans)
+	}
+	cues := g.formatter.Format(collected)
+	out := make(chan translation.Translation, len(cues))
+	for _, cue := range cues {
+		out <- cue
+	}
+	close(out)
+	return out
+}
@@ -0,0 +1,198 @@
+package output
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"streamlation/packages/backend/translation"
+)
+
+func TestCueFormatterBreaksEvenLines(t *testing.T) {
+	t.Parallel()
+
+	formatter := NewCueFormatter(CueFormatterConfig{})
+	cues := formatter.Format([]translation.Translation{{
+		TranslatedText: "El tiempo de mañana será soleado en toda la costa norte",
+		TargetLang:     "es",
+		EndTime:        4 * time.Second,
+	}})
+
+	if len(cues) != 1 {
+		t.Fatalf("expected one cue, got %d: %+v", len(cues), cues)
+	}
+	if want := "El tiempo de mañana será\nsoleado en toda la costa norte"; cues[0].TranslatedText != want {
+		t.Fatalf("expected even lines %q, got %q", want, cues[0].TranslatedText)
+	}
+}
+
+func TestCueFormatterSplitsLongTranslations(t *testing.T) {
+	t.Parallel()
+
+	formatter := NewCueFormatter(CueFormatterConfig{Rules: CueRules{MaxLineChars: 20, MaxCharsPerSecond: 100}})
+	cues := formatter.Format([]translation.Translation{{
+		TranslatedText: "one two three four five six seven eight nine ten eleven twelve",
+		TargetLang:     "en",
+		StartTime:      10 * time.Second,
+		EndTime:        14 * time.Second,
+	}})
+
+	if len(cues) != 2 {
+		t.Fatalf("expected two cues, got %d: %+v", len(cues), cues)
+	}
+	for _, cue := range cues {
+		lines := strings.Split(cue.TranslatedText, "\n")
+		if len(lines) > DefaultMaxCueLines {
+			t.Fatalf("expected at most %d lines, got %q", DefaultMaxCueLines, cue.TranslatedText)
+		}
+		for _, line := range lines {
+			if utf8.RuneCountInString(line) > 20 {
+				t.Fatalf("expected lines of at most 20 characters, got %q", line)
+			}
+		}
+	}
+	if cues[0].StartTime != 10*time.Second || cues[1].EndTime != 14*time.Second {
+		t.Fatalf("expected the cues to span the translation, got %v-%v", cues[0].StartTime, cues[1].EndTime)
+	}
+	if cues[0].EndTime != cues[1].StartTime || cues[0].EndTime <= cues[0].StartTime {
+		t.Fatalf("expected the cues to share the translation's time, got %+v", cues)
+	}
+}
+
+func TestCueFormatterSplitsTranslationsShownTooLong(t *testing.T) {
+	t.Parallel()
+
+	formatter := NewCueFormatter(CueFormatterConfig{})
+	cues := formatter.Format([]translation.Translation{{
+		TranslatedText: "una frase corta que dura demasiado",
+		TargetLang:     "es",
+		EndTime:        12 * time.Second,
+	}})
+
+	if len(cues) != 2 {
+		t.Fatalf("expected two cues, got %d: %+v", len(cues), cues)
+	}
+	for _, cue := range cues {
+		if cue.EndTime-cue.StartTime > DefaultMaxCueDuration {
+			t.Fatalf("expected cues shown at most %v, got %+v", DefaultMaxCueDuration, cue)
+		}
+	}
+}
+
+func TestCueFormatterMergesShortCues(t *testing.T) {
+	t.Parallel()
+
+	formatter := NewCueFormatter(CueFormatterConfig{})
+	cues := formatter.Format([]translation.Translation{
+		{TranslatedText: "Sí.", TargetLang: "es", StartTime: 0, EndTime: 300 * time.Millisecond, Confidence: 0.9},
+		{TranslatedText: "Claro que sí.", TargetLang: "es", StartTime: 400 * time.Millisecond, EndTime: 1500 * time.Millisecond, Confidence: 0.7},
+		{TranslatedText: "Otra persona.", TargetLang: "es", Speaker: "B", StartTime: 1600 * time.Millisecond, EndTime: 1900 * time.Millisecond},
+		{TranslatedText: "Mucho después.", TargetLang: "es", Speaker: "B", StartTime: 10 * time.Second, EndTime: 12 * time.Second},
+	})
+
+	if len(cues) != 3 {
+		t.Fatalf("expected three cues, got %d: %+v", len(cues), cues)
+	}
+	if cues[0].TranslatedText != "Sí. Claro que sí." || cues[0].StartTime != 0 || cues[0].EndTime != 1500*time.Millisecond || cues[0].Confidence != 0.7 {
+		t.Fatalf("expected the short cues merged, got %+v", cues[0])
+	}
+	if cues[1].TranslatedText != "Otra persona." || cues[2].TranslatedText != "Mucho después." {
+		t.Fatalf("expected other speakers and distant cues kept apart, got %+v", cues[1:])
+	}
+}
+
+func TestCueFormatterExtendsCuesToReadingSpeed(t *testing.T) {
+	t.Parallel()
+
+	formatter := NewCueFormatter(CueFormatterConfig{Rules: CueRules{MaxCharsPerSecond: 10}})
+	cues := formatter.Format([]translation.Translation{
+		{TranslatedText: "veinte caracteres ya", TargetLang: "es", StartTime: 0, EndTime: 1500 * time.Millisecond},
+		{TranslatedText: "y veinte caracteres más", TargetLang: "es", StartTime: 5 * time.Second, EndTime: 6500 * time.Millisecond},
+		{TranslatedText: "otra frase de veinte", TargetLang: "es", StartTime: 7 * time.Second, EndTime: 8500 * time.Millisecond},
+	})
+
+	if len(cues) != 3 {
+		t.Fatalf("expected three cues, got %d: %+v", len(cues), cues)
+	}
+	if cues[0].EndTime != 2*time.Second {
+		t.Fatalf("expected the first cue shown for its reading time, got %v", cues[0].EndTime)
+	}
+	if cues[1].EndTime != 7*time.Second {
+		t.Fatalf("expected the second cue to end where the next starts, got %v", cues[1].EndTime)
+	}
+}
+
+func TestCueFormatterAppliesLanguageRules(t *testing.T) {
+	t.Parallel()
+
+	formatter := NewCueFormatter(CueFormatterConfig{Languages: map[string]CueRules{"de": {MaxLineChars: 30}}})
+	if rules := formatter.Rules("ja-JP"); rules.MaxLineChars != 13 || rules.MaxLines != DefaultMaxCueLines {
+		t.Fatalf("expected the default Japanese rules, got %+v", rules)
+	}
+	if rules := formatter.Rules("DE"); rules.MaxLineChars != 30 || rules.MaxCharsPerSecond != DefaultMaxCharsPerSecond {
+		t.Fatalf("expected the configured German rules, got %+v", rules)
+	}
+
+	cues := formatter.Format([]translation.Translation{{
+		TranslatedText: "明日の天気は全国的に晴れるでしょう",
+		TargetLang:     "ja",
+		EndTime:        5 * time.Second,
+	}})
+	if len(cues) != 1 {
+		t.Fatalf("expected one cue, got %d: %+v", len(cues), cues)
+	}
+	if want := "明日の天気は全国的\nに晴れるでしょう"; cues[0].TranslatedText != want {
+		t.Fatalf("expected text broken anywhere, got %q", cues[0].TranslatedText)
+	}
+}
+
+func TestCueFormatterFormatsStreams(t *testing.T) {
+	t.Parallel()
+
+	formatter := NewCueFormatter(CueFormatterConfig{Rules: CueRules{MaxLineChars: 20}})
+	translations := make(chan translation.Translation, 2)
+	translations <- translation.Translation{TranslatedText: "one two three four five six", Partial: true, EndTime: time.Second}
+	translations <- translation.Translation{TranslatedText: "one two three four five six seven eight nine ten eleven twelve", EndTime: 8 * time.Second}
+	close(translations)
+
+	var cues []translation.Translation
+	for cue := range formatter.FormatStream(context.Background(), translations) {
+		cues = append(cues, cue)
+	}
+
+	if len(cues) != 3 {
+		t.Fatalf("expected a partial and two final cues, got %d: %+v", len(cues), cues)
+	}
+	if !cues[0].Partial || cues[0].TranslatedText != "one two three\nfour five six" || cues[0].EndTime != time.Second {
+		t.Fatalf("expected the partial cue's lines broken only, got %+v", cues[0])
+	}
+	if cues[1].Partial || cues[2].Partial || cues[2].EndTime != 8*time.Second {
+		t.Fatalf("expected the final translation split, got %+v", cues[1:])
+	}
+}
+
+func TestFormattingGeneratorFormatsFiles(t *testing.T) {
+	t.Parallel()
+
+	generator := NewFormattingGenerator(NewStubGenerator(), NewCueFormatter(CueFormatterConfig{}))
+	translations := make(chan translation.Translation, 2)
+	translations <- translation.Translation{TranslatedText: "Hola.", TargetLang: "es", EndTime: 200 * time.Millisecond}
+	translations <- translation.Translation{TranslatedText: "¿Qué tal?", TargetLang: "es", StartTime: 300 * time.Millisecond, EndTime: 600 * time.Millisecond}
+	close(translations)
+
+	reader, err := generator.GenerateSRT(context.Background(), "session", translations)
+	if err != nil {
+		t.Fatalf("GenerateSRT failed: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+
+	if want := "1\n00:00:00,000 --> 00:00:01,000\nHola. ¿Qué tal?\n\n"; string(content) != want {
+		t.Fatalf("expected the merged cue shown for a second, got %q", content)
+	}
+}
@@ -3,6 +3,7 @@ package output
 import (
 	"context"
 	"io"
+	"strconv"
 	"time"
 
 	"streamlation/packages/backend/translation"
@@ -10,8 +11,13 @@ import (
 
 // SubtitleEvent represents a real-time subtitle update.
 type SubtitleEvent struct {
-	// Type is the event type: "add", "update", or "remove".
+	// Type is the event type: "add" shows a new cue, "update" replaces the
+	// text and timing of the cue with the same ID, and "remove" withdraws
+	// it.
 	Type string `json:"type"`
+	// ID identifies the cue stably: the events that add, update, and remove
+	// it share the ID, which no other cue of the session has. See CueID.
+	ID string `json:"id"`
 	// Index is the subtitle index.
 	Index int `json:"index"`
 	// StartTime is when the subtitle should appear.
@@ -22,14 +28,34 @@ type SubtitleEvent struct {
 	Text string `json:"text"`
 	// SessionID identifies the translation session.
 	SessionID string `json:"sessionId"`
+	// Language is the target language of the subtitle, when known.
+	Language string `json:"language,omitempty"`
+	// Partial marks a cue whose text may still change. Its refinements are
+	// "update" events with the same ID; the last of them has Partial unset,
+	// unless the cue is withdrawn by a "remove" event because the
+	// hypothesis it showed came to nothing.
+	Partial bool `json:"partial,omitempty"`
+	// Speaker is the speaker the subtitle is attributed to, when known.
+	Speaker string `json:"speaker,omitempty"`
+}
+
+// CueID returns the ID of the cue at index among the cues in language, such
+// as "es-12".
+func CueID(language string, index int) string {
+	if language == "" {
+		return strconv.Itoa(index)
+	}
+	return language + "-" + strconv.Itoa(index)
 }
 
 // SubtitleFormat specifies the output format.
 type SubtitleFormat string
 
 const (
-	FormatSRT SubtitleFormat = "srt"
-	FormatVTT SubtitleFormat = "vtt"
+	FormatSRT  SubtitleFormat = "srt"
+	FormatVTT  SubtitleFormat = "vtt"
+	FormatTTML SubtitleFormat = "ttml"
+	FormatSCC  SubtitleFormat = "scc"
 )
 
 // HealthStatus represents the health of a component.
@@ -46,6 +72,13 @@ type SubtitleGenerator interface {
 	// GenerateVTT creates WebVTT format subtitles from translations.
 	GenerateVTT(ctx context.Context, sessionID string, translations <-chan translation.Translation) (io.Reader, error)
 
+	// GenerateTTML creates IMSC1 TTML subtitles from translations.
+	GenerateTTML(ctx context.Context, sessionID string, translations <-chan translation.Translation) (io.Reader, error)
+
+	// GenerateSCC creates CEA-608 captions in an SCC sidecar file from
+	// translations.
+	GenerateSCC(ctx context.Context, sessionID string, translations <-chan translation.Translation) (io.Reader, error)
+
 	// StreamSubtitles provides real-time subtitle updates.
 	StreamSubtitles(ctx context.Context, sessionID string, translations <-chan translation.Translation) (<-chan SubtitleEvent, error)
 
@@ -0,0 +1,293 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+// Defaults of HLSAudioRenditionConfig.
+const (
+	DefaultHLSSegmentDuration = 6 * time.Second
+	DefaultHLSAudioBitrate    = 64000
+)
+
+// hlsAudioCodecs is the CODECS attribute of AAC-LC renditions.
+const hlsAudioCodecs = "mp4a.40.2"
+
+// ObjectStore stores published files under slash-separated keys, replacing
+// any file under the same key. An archive.Store is one.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body io.Reader) error
+}
+
+// HLSAudioRenditionConfig configures an HLSAudioRendition. Zero values fall
+// back to the defaults.
+type HLSAudioRenditionConfig struct {
+	// Store receives the playlist and the segments.
+	Store ObjectStore
+	// Key is the key of the media playlist, such as
+	// "session/hls/dub-es.m3u8". Segments are stored in a directory named
+	// after it without the extension, such as "session/hls/dub-es/".
+	Key string
+	// SampleRate and Channels are the format of the audio written. Channels
+	// defaults to 1.
+	SampleRate int
+	Channels   int
+	// Bitrate is the bitrate of the encoded audio. Defaults to
+	// DefaultHLSAudioBitrate.
+	Bitrate int
+	// SegmentDuration is how much audio a segment holds, rounded up to
+	// whole AAC frames. Defaults to DefaultHLSSegmentDuration.
+	SegmentDuration time.Duration
+	// Encoder encodes the audio. Defaults to media.NewAACEncoder's, which
+	// only builds with AAC support have.
+	Encoder media.AACEncoder
+}
+
+// HLSAudioRendition publishes a stream of audio as an HLS audio rendition:
+// AAC in packed audio segments, each starting with the ID3 timestamp HLS
+// requires, listed by an event playlist that is rewritten as segments are
+// added and ended once the rendition is closed. An HLSAudioRendition is
+// not safe for concurrent use.
+type HLSAudioRendition struct {
+	cfg HLSAudioRenditionConfig
+	dir string
+
+	started bool
+	// start is the time of the first sample written, and encoded the
+	// samples per channel of the frames encoded since.
+	start   time.Duration
+	encoded int64
+	// frames holds the frames of the segment being filled, which starts
+	// at sample segmentStart.
+	frames       [][]byte
+	segmentStart int64
+	segments     []hlsSegment
+	closed       bool
+}
+
+// hlsSegment is a published segment.
+type hlsSegment struct {
+	uri      string
+	duration time.Duration
+}
+
+// NewHLSAudioRendition returns a rendition publishing to cfg.Store.
+func NewHLSAudioRendition(cfg HLSAudioRenditionConfig) (*HLSAudioRendition, error) {
+	if cfg.Store == nil {
+		return nil, errors.New("rendition store required")
+	}
+	if !strings.HasSuffix(cfg.Key, ".m3u8") {
+		return nil, fmt.Errorf("invalid playlist key %q", cfg.Key)
+	}
+	if cfg.SampleRate <= 0 {
+		return nil, errors.New("rendition sample rate required")
+	}
+	if cfg.Channels <= 0 {
+		cfg.Channels = 1
+	}
+	if cfg.Bitrate <= 0 {
+		cfg.Bitrate = DefaultHLSAudioBitrate
+	}
+	if cfg.SegmentDuration <= 0 {
+		cfg.SegmentDuration = DefaultHLSSegmentDuration
+	}
+	if cfg.Encoder == nil {
+		encoder, err := media.NewAACEncoder(cfg.SampleRate, cfg.Channels, cfg.Bitrate)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Encoder = encoder
+	}
+	return &HLSAudioRendition{cfg: cfg, dir: strings.TrimSuffix(cfg.Key, ".m3u8")}, nil
+}
+
+// Write encodes chunk, which must be in the format of the rendition, and
+// publishes the segments it completes. The first chunk written sets the
+// time the rendition starts at; later chunks follow it without gaps.
+func (h *HLSAudioRendition) Write(ctx context.Context, chunk media.AudioChunk) error {
+	if h.closed {
+		return errors.New("rendition closed")
+	}
+	if chunk.SampleRate != h.cfg.SampleRate || chunk.Channels != h.cfg.Channels {
+		return fmt.Errorf("audio at %d Hz with %d channels, want %d Hz with %d", chunk.SampleRate, chunk.Channels, h.cfg.SampleRate, h.cfg.Channels)
+	}
+	if !h.started {
+		h.started, h.start = true, chunk.Timestamp
+	}
+	frames, err := h.cfg.Encoder.Encode(chunk.PCMData)
+	if err != nil {
+		return fmt.Errorf("encode rendition audio: %w", err)
+	}
+	return h.add(ctx, frames)
+}
+
+// Close publishes the rest of the audio and ends the playlist.
+func (h *HLSAudioRendition) Close(ctx context.Context) error {
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	defer h.cfg.Encoder.Close()
+	frames, err := h.cfg.Encoder.Flush()
+	if err != nil {
+		return fmt.Errorf("encode rendition audio: %w", err)
+	}
+	if err := h.add(ctx, frames); err != nil {
+		return err
+	}
+	if len(h.frames) > 0 {
+		if err := h.publishSegment(ctx); err != nil {
+			return err
+		}
+	}
+	return h.publishPlaylist(ctx)
+}
+
+// add adds encoded frames to the segment being filled, publishing it when
+// it is full.
+func (h *HLSAudioRendition) add(ctx context.Context, frames [][]byte) error {
+	full := h.samples(h.cfg.SegmentDuration)
+	for _, frame := range frames {
+		h.frames = append(h.frames, frame)
+		h.encoded += media.AACFrameSamples
+		if h.encoded-h.segmentStart < full {
+			continue
+		}
+		if err := h.publishSegment(ctx); err != nil {
+			return err
+		}
+		if err := h.publishPlaylist(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishSegment stores the segment being filled and starts the next.
+func (h *HLSAudioRendition) publishSegment(ctx context.Context) error {
+	var body bytes.Buffer
+	// The timestamp of the first sample on the 90kHz MPEG-2 clock.
+	start := h.start + time.Duration(h.segmentStart)*time.Second/time.Duration(h.cfg.SampleRate)
+	body.Write(id3Timestamp(uint64(start) * 9 / 100000 & (1<<33 - 1)))
+	for _, frame := range h.frames {
+		body.Write(frame)
+	}
+	name := fmt.Sprintf("%05d.aac", len(h.segments))
+	if err := h.cfg.Store.Put(ctx, h.dir+"/"+name, &body); err != nil {
+		return fmt.Errorf("publish rendition segment: %w", err)
+	}
+	samples := h.encoded - h.segmentStart
+	h.segments = append(h.segments, hlsSegment{
+		uri:      path.Base(h.dir) + "/" + name,
+		duration: time.Duration(samples) * time.Second / time.Duration(h.cfg.SampleRate),
+	})
+	h.frames, h.segmentStart = nil, h.encoded
+	return nil
+}
+
+// publishPlaylist stores the media playlist listing the published
+// segments.
+func (h *HLSAudioRendition) publishPlaylist(ctx context.Context) error {
+	// Segments are at most a frame longer than SegmentDuration.
+	target := h.cfg.SegmentDuration + time.Duration(media.AACFrameSamples)*time.Second/time.Duration(h.cfg.SampleRate)
+	return publishMediaPlaylist(ctx, h.cfg.Store, h.cfg.Key, target, h.segments, h.closed)
+}
+
+// publishMediaPlaylist stores under key the event playlist listing
+// segments, none longer than target, and ends it when ended is set.
+func publishMediaPlaylist(ctx context.Context, store ObjectStore, key string, target time.Duration, segments []hlsSegment, ended bool) error {
+	var playlist strings.Builder
+	fmt.Fprintf(&playlist, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:EVENT\n", int(math.Ceil(target.Seconds())))
+	for _, segment := range segments {
+		fmt.Fprintf(&playlist, "#EXTINF:%.3f,\n%s\n", segment.duration.Seconds(), segment.uri)
+	}
+	if ended {
+		playlist.WriteString("#EXT-X-ENDLIST\n")
+	}
+	if err := store.Put(ctx, key, strings.NewReader(playlist.String())); err != nil {
+		return fmt.Errorf("publish rendition playlist: %w", err)
+	}
+	return nil
+}
+
+// samples returns the samples per channel of d of audio.
+func (h *HLSAudioRendition) samples(d time.Duration) int64 {
+	return int64(d) * int64(h.cfg.SampleRate) / int64(time.Second)
+}
+
+// id3Timestamp returns the ID3 tag that starts a packed audio segment,
+// whose PRIV frame gives the timestamp of its first sample.
+func id3Timestamp(timestamp uint64) []byte {
+	const owner = "com.apple.streaming.transportStreamTimestamp"
+	frame := make([]byte, 0, 10+len(owner)+9)
+	frame = append(frame, "PRIV"...)
+	frame = append(frame, syncsafe(len(owner)+9)...)
+	frame = append(frame, 0, 0)
+	frame = append(frame, owner...)
+	frame = append(frame, 0)
+	frame = binary.BigEndian.AppendUint64(frame, timestamp)
+
+	tag := append([]byte("ID3\x04\x00\x00"), syncsafe(len(frame))...)
+	return append(tag, frame...)
+}
+
+// syncsafe encodes size as an ID3 syncsafe integer, seven bits per byte.
+func syncsafe(size int) []byte {
+	return []byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+}
+
+// HLSAudioMedia is an audio rendition listed by a master playlist.
+type HLSAudioMedia struct {
+	// Name is the name shown to viewers, such as "Español (dubbed)".
+	Name string
+	// Language is the ISO 639-1 code of the rendition's language.
+	Language string
+	// URI is the rendition's media playlist, relative to the master
+	// playlist.
+	URI string
+	// Default marks the rendition players choose unless told otherwise.
+	Default bool
+}
+
+// HLSMasterPlaylist returns a master playlist offering renditions as the
+// alternatives of one audio group. Its variant stream plays the default
+// rendition, or the first, at bandwidth bits per second; players switch
+// between the renditions by language.
+func HLSMasterPlaylist(renditions []HLSAudioMedia, bandwidth int) ([]byte, error) {
+	if len(renditions) == 0 {
+		return nil, errors.New("no renditions")
+	}
+	variant := renditions[0].URI
+	for _, rendition := range renditions {
+		if rendition.Default {
+			variant = rendition.URI
+			break
+		}
+	}
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, rendition := range renditions {
+		fmt.Fprintf(&playlist, "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=\"%s\",LANGUAGE=\"%s\",DEFAULT=%s,AUTOSELECT=YES,URI=\"%s\"\n",
+			rendition.Name, rendition.Language, yesNo(rendition.URI == variant), rendition.URI)
+	}
+	fmt.Fprintf(&playlist, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=\"%s\",AUDIO=\"audio\"\n%s\n", bandwidth, hlsAudioCodecs, variant)
+	return []byte(playlist.String()), nil
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "YES"
+	}
+	return "NO"
+}
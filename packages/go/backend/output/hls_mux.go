@@ -0,0 +1,169 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Groups of the renditions MuxHLSMasterPlaylist adds to variants that do
+// not reference groups of their own.
+const (
+	HLSSubtitleGroup = "subs"
+	HLSDubGroup      = "dubs"
+)
+
+// HLSSubtitleMedia is a subtitle rendition listed by a master playlist.
+type HLSSubtitleMedia struct {
+	// Name is the name shown to viewers, such as "Español".
+	Name string
+	// Language is the ISO 639-1 code of the rendition's language.
+	Language string
+	// URI is the rendition's media playlist, relative to the master
+	// playlist.
+	URI string
+	// Default marks the rendition players show unless told otherwise.
+	Default bool
+}
+
+// hlsURIAttribute matches the URI attribute of a tag, but not attributes
+// such as SERVER-URI.
+var hlsURIAttribute = regexp.MustCompile(`([:,])URI="([^"]*)"`)
+
+// MuxHLSMasterPlaylist rewrites source, the playlist fetched from
+// sourceURL, into a master playlist that offers the subtitles and dubs
+// alongside the source's own media, so that a single URL plays the source
+// with either.
+//
+// Every URI of the source is resolved against sourceURL, so the result can
+// be served from anywhere. Subtitles join the subtitle groups the variants
+// reference and dubs their audio groups; variants without such a group
+// reference HLSSubtitleGroup or HLSDubGroup instead, in which the audio of
+// the variant itself stays the default. A media playlist becomes the only
+// variant of the result, at bandwidth bits per second.
+func MuxHLSMasterPlaylist(source []byte, sourceURL *url.URL, subtitles []HLSSubtitleMedia, dubs []HLSAudioMedia, bandwidth int) ([]byte, error) {
+	if !bytes.HasPrefix(source, []byte("#EXTM3U")) {
+		return nil, errors.New("invalid playlist: missing #EXTM3U")
+	}
+	if !bytes.Contains(source, []byte("#EXT-X-STREAM-INF:")) {
+		source = fmt.Appendf(nil, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s\n", bandwidth, sourceURL)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(source))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read playlist: %w", err)
+	}
+
+	// Collect the groups the renditions join, and have the variants
+	// without one reference the added group.
+	var subtitleGroups, audioGroups []string
+	addGroup := func(groups []string, group string) []string {
+		if !slices.Contains(groups, group) {
+			groups = append(groups, group)
+		}
+		return groups
+	}
+	var first int
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			continue
+		}
+		if first == 0 {
+			first = i
+		}
+		attributes := hlsAttributes(line)
+		if len(subtitles) > 0 {
+			if group, ok := attributes["SUBTITLES"]; ok && group != "NONE" {
+				subtitleGroups = addGroup(subtitleGroups, group)
+			} else if !ok {
+				subtitleGroups = addGroup(subtitleGroups, HLSSubtitleGroup)
+				lines[i] += `,SUBTITLES="` + HLSSubtitleGroup + `"`
+			}
+		}
+		if len(dubs) > 0 {
+			if group, ok := attributes["AUDIO"]; ok {
+				audioGroups = addGroup(audioGroups, group)
+			} else {
+				audioGroups = addGroup(audioGroups, HLSDubGroup)
+				lines[i] += `,AUDIO="` + HLSDubGroup + `"`
+			}
+		}
+	}
+
+	var playlist strings.Builder
+	for i, line := range lines {
+		if i == first {
+			for _, group := range subtitleGroups {
+				for _, rendition := range subtitles {
+					fmt.Fprintf(&playlist, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"%s\",NAME=\"%s\",LANGUAGE=\"%s\",DEFAULT=%s,AUTOSELECT=YES,URI=\"%s\"\n",
+						group, rendition.Name, rendition.Language, yesNo(rendition.Default), rendition.URI)
+				}
+			}
+			for _, group := range audioGroups {
+				if group == HLSDubGroup {
+					fmt.Fprintf(&playlist, "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"%s\",NAME=\"Original\",DEFAULT=YES,AUTOSELECT=YES\n", group)
+				}
+				for _, rendition := range dubs {
+					fmt.Fprintf(&playlist, "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"%s\",NAME=\"%s\",LANGUAGE=\"%s\",DEFAULT=NO,AUTOSELECT=YES,URI=\"%s\"\n",
+						group, rendition.Name, rendition.Language, rendition.URI)
+				}
+			}
+		}
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			line = hlsURIAttribute.ReplaceAllStringFunc(line, func(attribute string) string {
+				match := hlsURIAttribute.FindStringSubmatch(attribute)
+				return match[1] + `URI="` + resolveHLSURI(sourceURL, match[2]) + `"`
+			})
+		default:
+			line = resolveHLSURI(sourceURL, line)
+		}
+		playlist.WriteString(line)
+		playlist.WriteByte('\n')
+	}
+	return []byte(playlist.String()), nil
+}
+
+// resolveHLSURI returns uri resolved against base, or uri itself when it
+// does not parse.
+func resolveHLSURI(base *url.URL, uri string) string {
+	reference, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	return base.ResolveReference(reference).String()
+}
+
+// hlsAttributes returns the attributes of tag, with quoted values
+// unquoted.
+func hlsAttributes(tag string) map[string]string {
+	_, list, _ := strings.Cut(tag, ":")
+	attributes := make(map[string]string)
+	for list != "" {
+		name, rest, ok := strings.Cut(list, "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attributes[strings.TrimSpace(name)] = value
+		list = rest
+	}
+	return attributes
+}
@@ -0,0 +1,88 @@
+package output
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMuxHLSMasterPlaylistAddsRenditions(t *testing.T) {
+	t.Parallel()
+
+	source := "#EXTM3U\n#EXT-X-VERSION:4\n\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=1280x720\n720p/index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\nhttps://other.example.com/360p.m3u8\n" +
+		"#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100000,URI=\"720p/iframes.m3u8\"\n"
+	sourceURL, _ := url.Parse("https://cdn.example.com/live/master.m3u8?token=abc")
+
+	playlist, err := MuxHLSMasterPlaylist([]byte(source), sourceURL,
+		[]HLSSubtitleMedia{{Name: "es", Language: "es", URI: "https://tracks.example.com/s/hls/subs-es.m3u8"}},
+		[]HLSAudioMedia{{Name: "es (dubbed)", Language: "es", URI: "https://tracks.example.com/s/hls/dub-es.m3u8"}},
+		0)
+	if err != nil {
+		t.Fatalf("MuxHLSMasterPlaylist failed: %v", err)
+	}
+
+	want := "#EXTM3U\n#EXT-X-VERSION:4\n" +
+		"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=\"es\",LANGUAGE=\"es\",DEFAULT=NO,AUTOSELECT=YES,URI=\"https://tracks.example.com/s/hls/subs-es.m3u8\"\n" +
+		"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"dubs\",NAME=\"Original\",DEFAULT=YES,AUTOSELECT=YES\n" +
+		"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"dubs\",NAME=\"es (dubbed)\",LANGUAGE=\"es\",DEFAULT=NO,AUTOSELECT=YES,URI=\"https://tracks.example.com/s/hls/dub-es.m3u8\"\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=1280x720,SUBTITLES=\"subs\",AUDIO=\"dubs\"\nhttps://cdn.example.com/live/720p/index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,SUBTITLES=\"subs\",AUDIO=\"dubs\"\nhttps://other.example.com/360p.m3u8\n" +
+		"#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100000,URI=\"https://cdn.example.com/live/720p/iframes.m3u8\"\n"
+	if string(playlist) != want {
+		t.Fatalf("unexpected playlist:\n%s\nwant:\n%s", playlist, want)
+	}
+}
+
+func TestMuxHLSMasterPlaylistJoinsSourceGroups(t *testing.T) {
+	t.Parallel()
+
+	source := "#EXTM3U\n" +
+		"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"English\",LANGUAGE=\"en\",DEFAULT=YES,URI=\"audio/en.m3u8\"\n" +
+		"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"cc\",NAME=\"English\",LANGUAGE=\"en\",URI=\"subs/en.m3u8\"\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=2000000,AUDIO=\"aac\",SUBTITLES=\"cc\"\nvideo.m3u8\n"
+	sourceURL, _ := url.Parse("https://cdn.example.com/live/master.m3u8")
+
+	playlist, err := MuxHLSMasterPlaylist([]byte(source), sourceURL,
+		[]HLSSubtitleMedia{{Name: "es", Language: "es", URI: "subs-es.m3u8", Default: true}},
+		[]HLSAudioMedia{{Name: "es (dubbed)", Language: "es", URI: "dub-es.m3u8"}},
+		0)
+	if err != nil {
+		t.Fatalf("MuxHLSMasterPlaylist failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"URI=\"https://cdn.example.com/live/audio/en.m3u8\"",
+		"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"cc\",NAME=\"es\",LANGUAGE=\"es\",DEFAULT=YES,AUTOSELECT=YES,URI=\"subs-es.m3u8\"\n",
+		"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"es (dubbed)\",LANGUAGE=\"es\",DEFAULT=NO,AUTOSELECT=YES,URI=\"dub-es.m3u8\"\n",
+		"#EXT-X-STREAM-INF:BANDWIDTH=2000000,AUDIO=\"aac\",SUBTITLES=\"cc\"\nhttps://cdn.example.com/live/video.m3u8\n",
+	} {
+		if !strings.Contains(string(playlist), want) {
+			t.Fatalf("expected playlist to contain %q, got:\n%s", want, playlist)
+		}
+	}
+	if strings.Contains(string(playlist), "Original") || strings.Contains(string(playlist), "\"subs\"") {
+		t.Fatalf("expected no groups added, got:\n%s", playlist)
+	}
+}
+
+func TestMuxHLSMasterPlaylistWrapsMediaPlaylists(t *testing.T) {
+	t.Parallel()
+
+	source := "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6.0,\nsegment0.ts\n"
+	sourceURL, _ := url.Parse("https://cdn.example.com/live/stream.m3u8")
+
+	playlist, err := MuxHLSMasterPlaylist([]byte(source), sourceURL, []HLSSubtitleMedia{{Name: "es", Language: "es", URI: "subs-es.m3u8"}}, nil, 1500000)
+	if err != nil {
+		t.Fatalf("MuxHLSMasterPlaylist failed: %v", err)
+	}
+
+	if want := "#EXT-X-STREAM-INF:BANDWIDTH=1500000,SUBTITLES=\"subs\"\nhttps://cdn.example.com/live/stream.m3u8\n"; !strings.HasSuffix(string(playlist), want) {
+		t.Fatalf("expected the media playlist as the only variant, got:\n%s", playlist)
+	}
+
+	if _, err := MuxHLSMasterPlaylist([]byte("<html>"), sourceURL, nil, nil, 0); err == nil {
+		t.Fatal("expected an error for a document that is not a playlist")
+	}
+}
@@ -0,0 +1,141 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+// memoryStore keeps published files in memory.
+type memoryStore struct {
+	mu    sync.Mutex
+	files map[string]string
+}
+
+func (s *memoryStore) Put(_ context.Context, key string, body io.Reader) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = make(map[string]string)
+	}
+	s.files[key] = string(data)
+	return nil
+}
+
+// frameEncoder encodes every AACFrameSamples mono samples into a frame
+// holding the frame's index.
+type frameEncoder struct {
+	pending int
+	frames  byte
+	closed  bool
+}
+
+func (e *frameEncoder) Encode(pcm []byte) ([][]byte, error) {
+	e.pending += len(pcm) / 2
+	var frames [][]byte
+	for ; e.pending >= media.AACFrameSamples; e.pending -= media.AACFrameSamples {
+		frames = append(frames, []byte{e.frames})
+		e.frames++
+	}
+	return frames, nil
+}
+
+func (e *frameEncoder) Flush() ([][]byte, error) {
+	if e.pending == 0 {
+		return nil, nil
+	}
+	e.pending = 0
+	e.frames++
+	return [][]byte{{e.frames - 1}}, nil
+}
+
+func (e *frameEncoder) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestHLSAudioRenditionPublishesSegments(t *testing.T) {
+	t.Parallel()
+
+	store := &memoryStore{}
+	encoder := &frameEncoder{}
+	rendition, err := NewHLSAudioRendition(HLSAudioRenditionConfig{Store: store, Key: "session/hls/dub-es.m3u8", SampleRate: 1024, SegmentDuration: 2 * time.Second, Encoder: encoder})
+	if err != nil {
+		t.Fatalf("NewHLSAudioRendition: %v", err)
+	}
+	ctx := context.Background()
+	// Five seconds of audio starting at 10s: two full segments and one
+	// short one.
+	for second := 0; second < 5; second++ {
+		chunk := media.AudioChunk{Timestamp: time.Duration(10+second) * time.Second, SampleRate: 1024, Channels: 1, PCMData: make([]byte, 2048)}
+		if err := rendition.Write(ctx, chunk); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if playlist := store.files["session/hls/dub-es.m3u8"]; strings.Contains(playlist, "#EXT-X-ENDLIST") || strings.Count(playlist, "#EXTINF") != 2 {
+		t.Fatalf("expected an open playlist of two segments, got %q", playlist)
+	}
+	if err := rendition.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:3\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:EVENT\n" +
+		"#EXTINF:2.000,\ndub-es/00000.aac\n#EXTINF:2.000,\ndub-es/00001.aac\n#EXTINF:1.000,\ndub-es/00002.aac\n#EXT-X-ENDLIST\n"
+	if playlist := store.files["session/hls/dub-es.m3u8"]; playlist != want {
+		t.Fatalf("expected playlist %q, got %q", want, playlist)
+	}
+	if !encoder.closed {
+		t.Fatal("expected the encoder closed")
+	}
+
+	// Segments start with an ID3 tag giving their time on the 90kHz clock,
+	// followed by their frames.
+	segment := []byte(store.files["session/hls/dub-es/00001.aac"])
+	if !bytes.HasPrefix(segment, []byte("ID3\x04")) || !bytes.Contains(segment, []byte("com.apple.streaming.transportStreamTimestamp\x00")) {
+		t.Fatalf("expected an ID3 timestamp, got %q", segment)
+	}
+	tag := len(segment) - 2
+	if timestamp := binary.BigEndian.Uint64(segment[tag-8 : tag]); timestamp != 12*90000 {
+		t.Fatalf("expected the segment at 12s, got %d", timestamp)
+	}
+	if frames := segment[tag:]; !bytes.Equal(frames, []byte{2, 3}) {
+		t.Fatalf("expected the segment's frames, got %v", frames)
+	}
+
+	if err := rendition.Write(ctx, media.AudioChunk{SampleRate: 1024, Channels: 1}); err == nil {
+		t.Fatal("expected a closed rendition to refuse audio")
+	}
+}
+
+func TestHLSMasterPlaylistGroupsRenditions(t *testing.T) {
+	t.Parallel()
+
+	playlist, err := HLSMasterPlaylist([]HLSAudioMedia{
+		{Name: "Español", Language: "es", URI: "dub-es.m3u8"},
+		{Name: "Français", Language: "fr", URI: "dub-fr.m3u8", Default: true},
+	}, 64000)
+	if err != nil {
+		t.Fatalf("HLSMasterPlaylist: %v", err)
+	}
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n" +
+		"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=\"Español\",LANGUAGE=\"es\",DEFAULT=NO,AUTOSELECT=YES,URI=\"dub-es.m3u8\"\n" +
+		"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=\"Français\",LANGUAGE=\"fr\",DEFAULT=YES,AUTOSELECT=YES,URI=\"dub-fr.m3u8\"\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS=\"mp4a.40.2\",AUDIO=\"audio\"\ndub-fr.m3u8\n"
+	if string(playlist) != want {
+		t.Fatalf("expected playlist %q, got %q", want, playlist)
+	}
+	if _, err := HLSMasterPlaylist(nil, 64000); err == nil {
+		t.Fatal("expected a master playlist without renditions to be rejected")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"streamlation/packages/backend/translation"
@@ -30,6 +31,11 @@ func (s *StubGenerator) GenerateSRT(ctx context.Context, sessionID string, trans
 		default:
 		}
 
+		// Files only hold finalized cues.
+		if trans.Partial {
+			continue
+		}
+
 		// Format: index\nstart --> end\ntext\n\n
 		startTime := formatSRTTime(trans.StartTime)
 		endTime := formatSRTTime(trans.EndTime)
@@ -59,13 +65,22 @@ func (s *StubGenerator) GenerateVTT(ctx context.Context, sessionID string, trans
 		default:
 		}
 
+		if trans.Partial {
+			continue
+		}
+
 		// Format: cue-id\nstart --> end\ntext\n\n
 		startTime := formatVTTTime(trans.StartTime)
 		endTime := formatVTTTime(trans.EndTime)
+		text := trans.TranslatedText
+		if trans.Speaker != "" {
+			// Voice spans attribute the cue to its speaker.
+			text = "<v " + trans.Speaker + ">" + text
+		}
 
 		fmt.Fprintf(&buf, "%d\n", index)
 		fmt.Fprintf(&buf, "%s --> %s\n", startTime, endTime)
-		fmt.Fprintf(&buf, "%s\n\n", trans.TranslatedText)
+		fmt.Fprintf(&buf, "%s\n\n", text)
 
 		index++
 	}
@@ -73,7 +88,83 @@ func (s *StubGenerator) GenerateVTT(ctx context.Context, sessionID string, trans
 	return &buf, nil
 }
 
-// StreamSubtitles provides real-time subtitle updates.
+// GenerateTTML creates IMSC1 TTML subtitles from translations, in the
+// language of the first of them and the default style.
+func (s *StubGenerator) GenerateTTML(ctx context.Context, sessionID string, translations <-chan translation.Translation) (io.Reader, error) {
+	var (
+		buf      bytes.Buffer
+		language string
+		cues     []TTMLCue
+	)
+	for trans := range translations {
+		select {
+		case <-ctx.Done():
+			return &buf, ctx.Err()
+		default:
+		}
+
+		if trans.Partial {
+			continue
+		}
+		if language == "" {
+			language = trans.TargetLang
+		}
+		cues = append(cues, TTMLCue{
+			StartTime: trans.StartTime,
+			EndTime:   trans.EndTime,
+			Text:      trans.TranslatedText,
+			Speaker:   trans.Speaker,
+		})
+	}
+
+	if err := WriteTTML(&buf, language, cues, TTMLStyle{}); err != nil {
+		return &buf, err
+	}
+	return &buf, nil
+}
+
+// GenerateSCC creates CEA-608 captions in an SCC sidecar file from
+// translations, as pop-on captions on CC1.
+func (s *StubGenerator) GenerateSCC(ctx context.Context, sessionID string, translations <-chan translation.Translation) (io.Reader, error) {
+	var (
+		buf  bytes.Buffer
+		cues []SubtitleEvent
+	)
+	for trans := range translations {
+		select {
+		case <-ctx.Done():
+			return &buf, ctx.Err()
+		default:
+		}
+
+		if trans.Partial {
+			continue
+		}
+		cues = append(cues, SubtitleEvent{
+			Type:      "add",
+			Index:     len(cues),
+			StartTime: trans.StartTime,
+			EndTime:   trans.EndTime,
+			Text:      trans.TranslatedText,
+			SessionID: sessionID,
+			Speaker:   trans.Speaker,
+		})
+	}
+
+	encoder, err := NewCEA608Encoder(CEA608Config{})
+	if err != nil {
+		return &buf, err
+	}
+	if err := WriteSCC(&buf, encoder.Encode(cues)); err != nil {
+		return &buf, err
+	}
+	return &buf, nil
+}
+
+// StreamSubtitles provides real-time subtitle updates. A partial translation
+// adds a cue that following translations update as its hypothesis
+// stabilizes, skipping those that change nothing, until the segment is
+// final. A cue whose final translation is empty is removed.
 func (s *StubGenerator) StreamSubtitles(ctx context.Context, sessionID string, translations <-chan translation.Translation) (<-chan SubtitleEvent, error) {
 	out := make(chan SubtitleEvent)
 
@@ -81,6 +172,7 @@ func (s *StubGenerator) StreamSubtitles(ctx context.Context, sessionID string, t
 		defer close(out)
 
 		index := 0
+		var shown *SubtitleEvent // the cue at index while it awaits refinement
 		for trans := range translations {
 			select {
 			case <-ctx.Done():
@@ -90,16 +182,37 @@ func (s *StubGenerator) StreamSubtitles(ctx context.Context, sessionID string, t
 
 			event := SubtitleEvent{
 				Type:      "add",
+				ID:        CueID(trans.TargetLang, index),
 				Index:     index,
 				StartTime: trans.StartTime,
 				EndTime:   trans.EndTime,
 				Text:      trans.TranslatedText,
 				SessionID: sessionID,
+				Partial:   trans.Partial,
+				Speaker:   trans.Speaker,
+			}
+			empty := strings.TrimSpace(trans.TranslatedText) == ""
+			switch {
+			case empty && shown == nil:
+				// There is nothing to show or to withdraw.
+				continue
+			case empty:
+				event.Type, event.Partial = "remove", false
+			case shown != nil:
+				event.Type = "update"
+				if trans.Partial && event.Text == shown.Text && event.StartTime == shown.StartTime && event.EndTime == shown.EndTime && event.Speaker == shown.Speaker {
+					continue
+				}
 			}
 
 			select {
 			case out <- event:
-				index++
+				shown = nil
+				if event.Partial {
+					shown = &event
+				} else {
+					index++
+				}
 			case <-ctx.Done():
 				return
 			}
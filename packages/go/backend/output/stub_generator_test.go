@@ -100,6 +100,26 @@ func TestStubGenerator_GenerateVTT(t *testing.T) {
 	}
 }
 
+func TestStubGenerator_GenerateVTTAttributesSpeakers(t *testing.T) {
+	t.Parallel()
+
+	translations := make(chan translation.Translation, 1)
+	translations <- translation.Translation{TranslatedText: "Hola.", EndTime: time.Second, Speaker: "S2"}
+	close(translations)
+
+	reader, err := NewStubGenerator().GenerateVTT(context.Background(), "test-session", translations)
+	if err != nil {
+		t.Fatalf("GenerateVTT failed: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !strings.Contains(string(content), "<v S2>Hola.\n") {
+		t.Fatalf("expected a voice span for the speaker, got %q", content)
+	}
+}
+
 func TestStubGenerator_StreamSubtitles(t *testing.T) {
 	t.Parallel()
 
@@ -146,12 +166,175 @@ func TestStubGenerator_StreamSubtitles(t *testing.T) {
 		if event.Index != i {
 			t.Errorf("event %d: expected index %d, got %d", i, i, event.Index)
 		}
+		if event.ID != CueID("", i) {
+			t.Errorf("event %d: expected id %q, got %q", i, CueID("", i), event.ID)
+		}
 		if event.SessionID != sessionID {
 			t.Errorf("event %d: expected session ID %s, got %s", i, sessionID, event.SessionID)
 		}
 	}
 }
 
+func TestStubGenerator_StreamSubtitlesRefinesPartials(t *testing.T) {
+	t.Parallel()
+
+	generator := NewStubGenerator()
+
+	translations := make(chan translation.Translation, 4)
+	translations <- translation.Translation{TranslatedText: "Hola", EndTime: 500 * time.Millisecond, Partial: true}
+	translations <- translation.Translation{TranslatedText: "Hola mun", EndTime: 800 * time.Millisecond, Partial: true}
+	translations <- translation.Translation{TranslatedText: "Hola mundo.", EndTime: time.Second}
+	translations <- translation.Translation{TranslatedText: "Adiós.", StartTime: time.Second, EndTime: 2 * time.Second}
+	close(translations)
+
+	events, err := generator.StreamSubtitles(context.Background(), "test-session", translations)
+	if err != nil {
+		t.Fatalf("StreamSubtitles failed: %v", err)
+	}
+
+	var received []SubtitleEvent
+	for event := range events {
+		received = append(received, event)
+	}
+
+	expected := []struct {
+		eventType string
+		index     int
+		partial   bool
+	}{
+		{"add", 0, true},
+		{"update", 0, true},
+		{"update", 0, false},
+		{"add", 1, false},
+	}
+	if len(received) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(received))
+	}
+	for i, want := range expected {
+		event := received[i]
+		if event.Type != want.eventType || event.Index != want.index || event.Partial != want.partial {
+			t.Errorf("event %d: expected %+v, got type %q index %d partial %v", i, want, event.Type, event.Index, event.Partial)
+		}
+	}
+	if received[2].Text != "Hola mundo." {
+		t.Errorf("expected final update to carry the final text, got %q", received[2].Text)
+	}
+}
+
+func TestStubGenerator_StreamSubtitlesRemovesWithdrawnCues(t *testing.T) {
+	t.Parallel()
+
+	generator := NewStubGenerator()
+
+	translations := make(chan translation.Translation, 6)
+	translations <- translation.Translation{TranslatedText: "Eh", TargetLang: "es", EndTime: 300 * time.Millisecond, Partial: true}
+	translations <- translation.Translation{TranslatedText: "Eh", TargetLang: "es", EndTime: 300 * time.Millisecond, Partial: true}
+	translations <- translation.Translation{TranslatedText: " ", TargetLang: "es", EndTime: 400 * time.Millisecond}
+	translations <- translation.Translation{TranslatedText: "", TargetLang: "es", StartTime: time.Second, EndTime: 2 * time.Second}
+	translations <- translation.Translation{TranslatedText: "Buenos", TargetLang: "es", StartTime: time.Second, EndTime: 2 * time.Second, Partial: true}
+	translations <- translation.Translation{TranslatedText: "Buenos días.", TargetLang: "es", StartTime: time.Second, EndTime: 2 * time.Second}
+	close(translations)
+
+	events, err := generator.StreamSubtitles(context.Background(), "test-session", translations)
+	if err != nil {
+		t.Fatalf("StreamSubtitles failed: %v", err)
+	}
+
+	var received []SubtitleEvent
+	for event := range events {
+		received = append(received, event)
+	}
+
+	expected := []struct {
+		eventType string
+		id        string
+		partial   bool
+	}{
+		{"add", "es-0", true},
+		{"remove", "es-0", false},
+		{"add", "es-1", true},
+		{"update", "es-1", false},
+	}
+	if len(received) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %+v", len(expected), len(received), received)
+	}
+	for i, want := range expected {
+		event := received[i]
+		if event.Type != want.eventType || event.ID != want.id || event.Partial != want.partial {
+			t.Errorf("event %d: expected %+v, got type %q id %q partial %v", i, want, event.Type, event.ID, event.Partial)
+		}
+	}
+}
+
+func TestStubGenerator_GenerateSRTSkipsPartials(t *testing.T) {
+	t.Parallel()
+
+	translations := make(chan translation.Translation, 2)
+	translations <- translation.Translation{TranslatedText: "Hola", EndTime: time.Second, Partial: true}
+	translations <- translation.Translation{TranslatedText: "Hola mundo.", EndTime: 2 * time.Second}
+	close(translations)
+
+	reader, err := NewStubGenerator().GenerateSRT(context.Background(), "test-session", translations)
+	if err != nil {
+		t.Fatalf("GenerateSRT failed: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read SRT: %v", err)
+	}
+	if want := "1\n00:00:00,000 --> 00:00:02,000\nHola mundo.\n\n"; string(content) != want {
+		t.Errorf("expected only the final cue, got %q", content)
+	}
+}
+
+func TestStubGenerator_GenerateTTML(t *testing.T) {
+	t.Parallel()
+
+	translations := make(chan translation.Translation, 3)
+	translations <- translation.Translation{TranslatedText: "Hola", TargetLang: "es", EndTime: time.Second, Partial: true}
+	translations <- translation.Translation{TranslatedText: "Hola mundo.", TargetLang: "es", EndTime: 2 * time.Second, Speaker: "S1"}
+	translations <- translation.Translation{TranslatedText: "Adiós.", TargetLang: "es", StartTime: 2 * time.Second, EndTime: 3 * time.Second}
+	close(translations)
+
+	reader, err := NewStubGenerator().GenerateTTML(context.Background(), "test-session", translations)
+	if err != nil {
+		t.Fatalf("GenerateTTML failed: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read TTML: %v", err)
+	}
+	ttml := string(content)
+	if !strings.Contains(ttml, `xml:lang="es"`) || strings.Count(ttml, "<p ") != 2 {
+		t.Fatalf("expected the two final cues in Spanish, got:\n%s", ttml)
+	}
+	if !strings.Contains(ttml, `begin="00:00:00.000" end="00:00:02.000" ttm:agent="speaker1"><span style="text">Hola mundo.</span>`) {
+		t.Errorf("expected the first cue attributed to its speaker, got:\n%s", ttml)
+	}
+}
+
+func TestStubGenerator_GenerateSCC(t *testing.T) {
+	t.Parallel()
+
+	translations := make(chan translation.Translation, 2)
+	translations <- translation.Translation{TranslatedText: "Hola", StartTime: 2 * time.Second, EndTime: 3 * time.Second, Partial: true}
+	translations <- translation.Translation{TranslatedText: "Hola", StartTime: 2 * time.Second, EndTime: 4 * time.Second}
+	close(translations)
+
+	reader, err := NewStubGenerator().GenerateSCC(context.Background(), "test-session", translations)
+	if err != nil {
+		t.Fatalf("GenerateSCC failed: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read SCC: %v", err)
+	}
+	want := "Scenarist_SCC V1.0\n\n\n00:00:01;19\t9420 9420 94ae 94ae 9476 9476 97a2 97a2 c8ef ec61 942f 942f\n\n00:00:03;29\t942c 942c\n"
+	if string(content) != want {
+		t.Errorf("expected the final cue as one pop-on caption, got %q", content)
+	}
+}
+
 func TestStubGenerator_Health(t *testing.T) {
 	t.Parallel()
 
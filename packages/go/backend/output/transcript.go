@@ -0,0 +1,169 @@
+package output
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"streamlation/packages/backend/translation"
+)
+
+// TranscriptFormat is the format of transcripts, a JSON record per line.
+const TranscriptFormat = "jsonl"
+
+// TranscriptRecord is a line of a transcript: a segment of the source with
+// its translations.
+type TranscriptRecord struct {
+	// Index numbers the records of a transcript from 0, in source order.
+	Index int `json:"index"`
+	// StartTime and EndTime are when the segment begins and ends in the
+	// source.
+	StartTime time.Duration `json:"startTime"`
+	EndTime   time.Duration `json:"endTime"`
+	// Speaker is the speaker of the segment, when known.
+	Speaker string `json:"speaker,omitempty"`
+	// SourceLanguage and SourceText are the language and text of the
+	// segment as transcribed.
+	SourceLanguage string `json:"sourceLanguage,omitempty"`
+	SourceText     string `json:"sourceText"`
+	// Translations holds the segment's translations, in the order the
+	// languages were given.
+	Translations []TranscriptTranslation `json:"translations"`
+}
+
+// TranscriptTranslation is the translation of a transcript segment into a
+// language.
+type TranscriptTranslation struct {
+	Language   string  `json:"language"`
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"`
+	Quality    float64 `json:"quality,omitempty"`
+	Variant    string  `json:"variant,omitempty"`
+}
+
+// AlignTranscript returns the records of the final translations of a
+// session, keyed by language, for languages in the order given. The
+// translations of a segment into different languages are aligned by the
+// times and source text they share; records are ordered by start time.
+func AlignTranscript(languages []string, translations map[string][]translation.Translation) []TranscriptRecord {
+	type segment struct {
+		start, end time.Duration
+		source     string
+	}
+	var records []TranscriptRecord
+	positions := make(map[segment]int)
+	for _, language := range languages {
+		for _, translated := range translations[language] {
+			if translated.Partial {
+				continue
+			}
+			key := segment{start: translated.StartTime, end: translated.EndTime, source: translated.SourceText}
+			position, ok := positions[key]
+			if !ok {
+				position = len(records)
+				positions[key] = position
+				records = append(records, TranscriptRecord{
+					StartTime:      translated.StartTime,
+					EndTime:        translated.EndTime,
+					Speaker:        translated.Speaker,
+					SourceLanguage: translated.SourceLang,
+					SourceText:     translated.SourceText,
+				})
+			}
+			records[position].Translations = append(records[position].Translations, TranscriptTranslation{
+				Language:   language,
+				Text:       translated.TranslatedText,
+				Confidence: translated.Confidence,
+				Quality:    translated.Quality,
+				Variant:    translated.Variant,
+			})
+		}
+	}
+	slices.SortStableFunc(records, func(a, b TranscriptRecord) int {
+		return cmp.Or(cmp.Compare(a.StartTime, b.StartTime), cmp.Compare(a.EndTime, b.EndTime))
+	})
+	for i := range records {
+		records[i].Index = i
+	}
+	return records
+}
+
+// EditTranscript returns a copy of records, a transcript, with the cue
+// edits of language applied to its translations into language. cues are
+// the cues of language as generated; each belongs to the record whose
+// segment it starts in. A record holding an edited cue has its
+// translation replaced by the text of its cues, edited or not, joined on
+// single lines. Edits of the cues' timing leave the segments' as they are.
+func EditTranscript(records []TranscriptRecord, language string, cues []Cue, edits []CueEdit) []TranscriptRecord {
+	edited := ApplyCueEdits(cues, edits)
+	texts := make(map[int][]string)
+	changed := make(map[int]bool)
+	for i, cue := range cues {
+		position := slices.IndexFunc(records, func(record TranscriptRecord) bool {
+			return record.StartTime <= cue.StartTime && (cue.StartTime < record.EndTime || record.StartTime == record.EndTime)
+		})
+		if position < 0 {
+			continue
+		}
+		texts[position] = append(texts[position], strings.Join(strings.Fields(edited[i].Text), " "))
+		changed[position] = changed[position] || edited[i].Edited
+	}
+
+	result := slices.Clone(records)
+	for position := range changed {
+		if !changed[position] {
+			continue
+		}
+		record := &result[position]
+		record.Translations = slices.Clone(record.Translations)
+		for i := range record.Translations {
+			if strings.EqualFold(record.Translations[i].Language, language) {
+				record.Translations[i].Text = strings.Join(texts[position], " ")
+			}
+		}
+	}
+	return result
+}
+
+// ReadTranscript decodes the records of a JSONL transcript.
+func ReadTranscript(r io.Reader) ([]TranscriptRecord, error) {
+	var records []TranscriptRecord
+	decoder := json.NewDecoder(r)
+	for {
+		var record TranscriptRecord
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode transcript: %w", err)
+		}
+		records = append(records, record)
+	}
+}
+
+// PersistTranscript writes records as the JSONL transcript of sessionID,
+// in PackageLanguage, and persists it.
+func (w *ArtifactWriter) PersistTranscript(ctx context.Context, sessionID string, records []TranscriptRecord) (Artifact, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return Artifact{}, fmt.Errorf("encode transcript: %w", err)
+		}
+	}
+	return w.Persist(ctx, Artifact{
+		SessionID: sessionID,
+		Kind:      ArtifactTranscript,
+		Language:  PackageLanguage,
+		Format:    TranscriptFormat,
+	}, &buf)
+}
@@ -0,0 +1,133 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/translation"
+)
+
+func TestAlignTranscriptAlignsLanguages(t *testing.T) {
+	t.Parallel()
+
+	records := AlignTranscript([]string{"es", "fr"}, map[string][]translation.Translation{
+		"es": {
+			{SourceText: "Hello.", TranslatedText: "Hola.", SourceLang: "en", Speaker: "A", Confidence: 0.9, StartTime: 0, EndTime: time.Second},
+			{SourceText: "Goodbye.", TranslatedText: "Adiós.", SourceLang: "en", Confidence: 0.8, StartTime: 3 * time.Second, EndTime: 4 * time.Second},
+			{SourceText: "Good", TranslatedText: "Bue", Partial: true, StartTime: 5 * time.Second, EndTime: 6 * time.Second},
+		},
+		"fr": {
+			{SourceText: "Thanks.", TranslatedText: "Merci.", SourceLang: "en", Confidence: 0.7, StartTime: 2 * time.Second, EndTime: 3 * time.Second},
+			{SourceText: "Hello.", TranslatedText: "Bonjour.", SourceLang: "en", Speaker: "A", Confidence: 0.6, Quality: 0.5, StartTime: 0, EndTime: time.Second},
+		},
+	})
+
+	if len(records) != 3 {
+		t.Fatalf("expected three records, got %d: %+v", len(records), records)
+	}
+	for i, want := range []string{"Hello.", "Thanks.", "Goodbye."} {
+		if records[i].Index != i || records[i].SourceText != want {
+			t.Fatalf("expected record %d to be %q, got %+v", i, want, records[i])
+		}
+	}
+	first := records[0]
+	if first.Speaker != "A" || first.SourceLanguage != "en" || len(first.Translations) != 2 {
+		t.Fatalf("expected the first segment in both languages, got %+v", first)
+	}
+	if first.Translations[0] != (TranscriptTranslation{Language: "es", Text: "Hola.", Confidence: 0.9}) ||
+		first.Translations[1] != (TranscriptTranslation{Language: "fr", Text: "Bonjour.", Confidence: 0.6, Quality: 0.5}) {
+		t.Fatalf("expected the translations in language order, got %+v", first.Translations)
+	}
+}
+
+func TestArtifactWriterPersistsTranscript(t *testing.T) {
+	t.Parallel()
+
+	store := &memoryArtifactStore{}
+	writer, err := NewArtifactWriter(store, nil)
+	if err != nil {
+		t.Fatalf("NewArtifactWriter: %v", err)
+	}
+	records := []TranscriptRecord{
+		{Index: 0, EndTime: time.Second, SourceText: "A & B", Translations: []TranscriptTranslation{{Language: "es", Text: "A y B"}}},
+		{Index: 1, StartTime: time.Second, EndTime: 2 * time.Second, SourceText: "C"},
+	}
+
+	artifact, err := writer.PersistTranscript(context.Background(), "session", records)
+	if err != nil {
+		t.Fatalf("PersistTranscript: %v", err)
+	}
+	if artifact.Key != "session/transcript/mul.jsonl" || artifact.ContentType != "application/x-ndjson" || artifact.Kind != ArtifactTranscript {
+		t.Fatalf("unexpected artifact %+v", artifact)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(store.files[artifact.Key], "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"sourceText":"A & B"`) {
+		t.Fatalf("expected a record per line, got %q", lines)
+	}
+	var record TranscriptRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil || record.Index != 1 || record.StartTime != time.Second || record.SourceText != "C" {
+		t.Fatalf("expected the second record, got %+v (%v)", record, err)
+	}
+}
+
+func TestEditTranscriptAppliesCueEdits(t *testing.T) {
+	t.Parallel()
+
+	records := []TranscriptRecord{
+		{Index: 0, EndTime: 4 * time.Second, SourceText: "Hello there. How are you?", Translations: []TranscriptTranslation{
+			{Language: "es", Text: "Hola. ¿Cómo estás?"},
+			{Language: "fr", Text: "Bonjour. Comment ça va ?"},
+		}},
+		{Index: 1, StartTime: 4 * time.Second, EndTime: 6 * time.Second, SourceText: "Bye.", Translations: []TranscriptTranslation{{Language: "es", Text: "Adiós."}}},
+	}
+	cues := []Cue{
+		{ID: "es-0", StartTime: 0, EndTime: 2 * time.Second, Text: "Hola."},
+		{ID: "es-1", Index: 1, StartTime: 2 * time.Second, EndTime: 4 * time.Second, Text: "¿Cómo estás?"},
+		{ID: "es-2", Index: 2, StartTime: 4 * time.Second, EndTime: 6 * time.Second, Text: "Adiós."},
+	}
+	text, start := "¿Qué tal\nestás?", 3*time.Second
+	edited := EditTranscript(records, "es", cues, []CueEdit{{CueID: "es-1", Text: &text, StartTime: &start}, {CueID: "fr-0", Text: &text}})
+
+	if got := edited[0].Translations[0].Text; got != "Hola. ¿Qué tal estás?" {
+		t.Fatalf("expected the edited cue on a line with the rest of its segment, got %q", got)
+	}
+	if edited[0].Translations[1].Text != "Bonjour. Comment ça va ?" || edited[1].Translations[0].Text != "Adiós." {
+		t.Fatalf("expected other languages and segments untouched, got %+v", edited)
+	}
+	if edited[0].EndTime != 4*time.Second || records[0].Translations[0].Text != "Hola. ¿Cómo estás?" {
+		t.Fatalf("expected segment timing kept and records not modified, got %+v and %+v", edited[0], records[0])
+	}
+}
+
+func TestReadTranscriptDecodesRecords(t *testing.T) {
+	t.Parallel()
+
+	store := &memoryArtifactStore{}
+	writer, err := NewArtifactWriter(store, nil)
+	if err != nil {
+		t.Fatalf("NewArtifactWriter: %v", err)
+	}
+	records := []TranscriptRecord{
+		{Index: 0, EndTime: time.Second, SourceText: "A", Translations: []TranscriptTranslation{{Language: "es", Text: "A"}}},
+		{Index: 1, StartTime: time.Second, EndTime: 2 * time.Second, SourceText: "B"},
+	}
+	artifact, err := writer.PersistTranscript(context.Background(), "session", records)
+	if err != nil {
+		t.Fatalf("PersistTranscript: %v", err)
+	}
+
+	read, err := ReadTranscript(strings.NewReader(store.files[artifact.Key]))
+	if err != nil {
+		t.Fatalf("ReadTranscript: %v", err)
+	}
+	if len(read) != 2 || read[1].SourceText != "B" || read[0].Translations[0].Text != "A" {
+		t.Fatalf("expected the records written, got %+v", read)
+	}
+	if _, err := ReadTranscript(strings.NewReader("{")); err == nil {
+		t.Fatal("expected an error for a truncated transcript")
+	}
+}
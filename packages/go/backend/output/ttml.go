@@ -0,0 +1,149 @@
+package output
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Regions of a TTML document cues can show in.
+const (
+	TTMLRegionBottom = "bottom"
+	TTMLRegionTop    = "top"
+)
+
+// Defaults of TTMLStyle.
+const (
+	DefaultTTMLColor           = "white"
+	DefaultTTMLBackgroundColor = "#000000c2"
+	// DefaultTTMLFontFamily is a generic family every IMSC1 processor
+	// maps to a font of its own.
+	DefaultTTMLFontFamily = "proportionalSansSerif"
+	DefaultTTMLFontSize   = "100%"
+)
+
+// TTMLStyle places and styles the cues of a TTML document. Zero values
+// fall back to the defaults.
+type TTMLStyle struct {
+	// Region is where cues show unless they name a region of their own,
+	// TTMLRegionBottom or TTMLRegionTop. Defaults to TTMLRegionBottom.
+	Region string
+	// Color and BackgroundColor are TTML colors such as "white" or
+	// "#000000c2", the background filling behind the text only. They
+	// default to white on translucent black.
+	Color           string
+	BackgroundColor string
+	// FontFamily defaults to DefaultTTMLFontFamily.
+	FontFamily string
+	// FontSize is relative to the height of a line, as a percentage.
+	// Defaults to DefaultTTMLFontSize.
+	FontSize string
+}
+
+// TTMLCue is a cue of a TTML document.
+type TTMLCue struct {
+	StartTime time.Duration
+	EndTime   time.Duration
+	// Text is the cue's text; line breaks in it are kept.
+	Text string
+	// Speaker is the speaker the cue is attributed to, when known.
+	Speaker string
+	// Region overrides the region of the document's style for the cue.
+	Region string
+}
+
+// WriteTTML writes cues as a TTML document in language that conforms to
+// the IMSC1 Text Profile, as broadcast delivery specifications require:
+// times are media times, cues show in a region at the bottom or the top of
+// the picture, styled by style, and speakers are declared as agents that
+// their cues refer to.
+func WriteTTML(w io.Writer, language string, cues []TTMLCue, style TTMLStyle) error {
+	if style.Region == "" {
+		style.Region = TTMLRegionBottom
+	}
+	if style.Color == "" {
+		style.Color = DefaultTTMLColor
+	}
+	if style.BackgroundColor == "" {
+		style.BackgroundColor = DefaultTTMLBackgroundColor
+	}
+	if style.FontFamily == "" {
+		style.FontFamily = DefaultTTMLFontFamily
+	}
+	if style.FontSize == "" {
+		style.FontSize = DefaultTTMLFontSize
+	}
+	if !validTTMLRegion(style.Region) {
+		return fmt.Errorf("unknown TTML region %q", style.Region)
+	}
+
+	// Speakers become agents in the order they first speak.
+	agents := make(map[string]string)
+	var speakers []string
+	for _, cue := range cues {
+		if cue.Region != "" && !validTTMLRegion(cue.Region) {
+			return fmt.Errorf("unknown TTML region %q", cue.Region)
+		}
+		if cue.Speaker != "" && agents[cue.Speaker] == "" {
+			speakers = append(speakers, cue.Speaker)
+			agents[cue.Speaker] = fmt.Sprintf("speaker%d", len(speakers))
+		}
+	}
+
+	var doc bytes.Buffer
+	doc.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&doc, `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" xmlns:tts="http://www.w3.org/ns/ttml#styling" xmlns:ttm="http://www.w3.org/ns/ttml#metadata" ttp:profile="http://www.w3.org/ns/ttml/profile/imsc1/text" ttp:timeBase="media" xml:lang="%s">`+"\n", xmlEscape(language))
+	doc.WriteString("<head>\n")
+	if len(speakers) > 0 {
+		doc.WriteString("<metadata>\n")
+		for _, speaker := range speakers {
+			fmt.Fprintf(&doc, `<ttm:agent xml:id="%s" type="person"><ttm:name type="full">%s</ttm:name></ttm:agent>`+"\n", agents[speaker], xmlEscape(speaker))
+		}
+		doc.WriteString("</metadata>\n")
+	}
+	doc.WriteString("<styling>\n")
+	doc.WriteString(`<style xml:id="paragraph" tts:textAlign="center"/>` + "\n")
+	fmt.Fprintf(&doc, `<style xml:id="text" tts:color="%s" tts:backgroundColor="%s" tts:fontFamily="%s" tts:fontSize="%s"/>`+"\n",
+		xmlEscape(style.Color), xmlEscape(style.BackgroundColor), xmlEscape(style.FontFamily), xmlEscape(style.FontSize))
+	doc.WriteString("</styling>\n<layout>\n")
+	doc.WriteString(`<region xml:id="bottom" tts:origin="10% 80%" tts:extent="80% 15%" tts:displayAlign="after"/>` + "\n")
+	doc.WriteString(`<region xml:id="top" tts:origin="10% 5%" tts:extent="80% 15%" tts:displayAlign="before"/>` + "\n")
+	doc.WriteString("</layout>\n</head>\n")
+
+	fmt.Fprintf(&doc, `<body region="%s" style="paragraph">`+"\n<div>\n", style.Region)
+	for i, cue := range cues {
+		fmt.Fprintf(&doc, `<p xml:id="cue%d" begin="%s" end="%s"`, i+1, formatVTTTime(cue.StartTime), formatVTTTime(cue.EndTime))
+		if cue.Region != "" {
+			fmt.Fprintf(&doc, ` region="%s"`, cue.Region)
+		}
+		if cue.Speaker != "" {
+			fmt.Fprintf(&doc, ` ttm:agent="%s"`, agents[cue.Speaker])
+		}
+		doc.WriteString(`><span style="text">`)
+		for j, line := range strings.Split(strings.TrimSpace(cue.Text), "\n") {
+			if j > 0 {
+				doc.WriteString("<br/>")
+			}
+			doc.WriteString(xmlEscape(strings.TrimSpace(line)))
+		}
+		doc.WriteString("</span></p>\n")
+	}
+	doc.WriteString("</div>\n</body>\n</tt>\n")
+
+	_, err := w.Write(doc.Bytes())
+	return err
+}
+
+func validTTMLRegion(region string) bool {
+	return region == TTMLRegionBottom || region == TTMLRegionTop
+}
+
+// xmlEscape escapes s for XML text and attribute values.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package output
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteTTMLWritesIMSC1Documents(t *testing.T) {
+	t.Parallel()
+
+	var b strings.Builder
+	err := WriteTTML(&b, "es", []TTMLCue{
+		{StartTime: 500 * time.Millisecond, EndTime: 2 * time.Second, Text: "Hola & <adiós>\nsegunda línea", Speaker: "Ana"},
+		{StartTime: time.Hour + 2*time.Second, EndTime: time.Hour + 3*time.Second, Text: "arriba", Region: TTMLRegionTop},
+		{StartTime: 4 * time.Second, EndTime: 5 * time.Second, Text: "otra vez", Speaker: "Ana"},
+	}, TTMLStyle{Color: "yellow", FontSize: "80%"})
+	if err != nil {
+		t.Fatalf("WriteTTML: %v", err)
+	}
+	doc := b.String()
+
+	decoder := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		if _, err := decoder.Token(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatalf("expected well-formed XML, got %v:\n%s", err, doc)
+		}
+	}
+	for _, want := range []string{
+		`ttp:profile="http://www.w3.org/ns/ttml/profile/imsc1/text" ttp:timeBase="media" xml:lang="es"`,
+		`<ttm:agent xml:id="speaker1" type="person"><ttm:name type="full">Ana</ttm:name></ttm:agent>`,
+		`<style xml:id="text" tts:color="yellow" tts:backgroundColor="#000000c2" tts:fontFamily="proportionalSansSerif" tts:fontSize="80%"/>`,
+		`<region xml:id="bottom" tts:origin="10% 80%" tts:extent="80% 15%" tts:displayAlign="after"/>`,
+		`<body region="bottom" style="paragraph">`,
+		`<p xml:id="cue1" begin="00:00:00.500" end="00:00:02.000" ttm:agent="speaker1"><span style="text">Hola &amp; &lt;adiós&gt;<br/>segunda línea</span></p>`,
+		`<p xml:id="cue2" begin="01:00:02.000" end="01:00:03.000" region="top"><span style="text">arriba</span></p>`,
+		`<p xml:id="cue3" begin="00:00:04.000" end="00:00:05.000" ttm:agent="speaker1">`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Fatalf("expected %q in document:\n%s", want, doc)
+		}
+	}
+	if strings.Count(doc, "<ttm:agent ") != 1 {
+		t.Fatalf("expected one agent per speaker:\n%s", doc)
+	}
+
+	if err := WriteTTML(io.Discard, "es", nil, TTMLStyle{Region: "middle"}); err == nil {
+		t.Fatal("expected an unknown region to fail")
+	}
+	if err := WriteTTML(io.Discard, "es", []TTMLCue{{Region: "left"}}, TTMLStyle{}); err == nil {
+		t.Fatal("expected an unknown cue region to fail")
+	}
+}
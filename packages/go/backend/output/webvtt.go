@@ -0,0 +1,188 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HLSSubtitleRenditionConfig configures an HLSSubtitleRendition. Zero
+// values fall back to the defaults.
+type HLSSubtitleRenditionConfig struct {
+	// Store receives the playlist and the segments.
+	Store ObjectStore
+	// Key is the key of the media playlist, such as
+	// "session/hls/subs-es.m3u8". Segments are stored in a directory named
+	// after it without the extension, such as "session/hls/subs-es/".
+	Key string
+	// Start is the time of the stream the first segment starts at.
+	Start time.Duration
+	// SegmentDuration is how much time a segment covers. Defaults to
+	// DefaultHLSSegmentDuration.
+	SegmentDuration time.Duration
+}
+
+// HLSSubtitleRendition publishes a stream of subtitle events as an HLS
+// subtitle rendition: WebVTT segments, each covering SegmentDuration of
+// the stream, listed by an event playlist that is rewritten as segments
+// are added and ended once the rendition is closed. Every segment holds
+// the cues that overlap it, so that a cue spanning segments shows in each,
+// and maps cue times to the 90kHz MPEG-2 clock with X-TIMESTAMP-MAP, the
+// clock the dub renditions are stamped on, so that players keep the cues
+// in sync with the audio of the stream.
+//
+// A cue takes the text of the latest event with its index, partial or
+// not, and leaves the segments published after a "remove" event for it. A
+// segment is final once published, so cues should be written before the
+// stream time they end at is published, such as by publishing with a
+// delay. An HLSSubtitleRendition is not safe for concurrent use.
+type HLSSubtitleRendition struct {
+	cfg HLSSubtitleRenditionConfig
+	dir string
+
+	// cues holds the cues that may still show in a segment, by index.
+	cues     map[int]SubtitleEvent
+	segments []hlsSegment
+	closed   bool
+}
+
+// NewHLSSubtitleRendition returns a rendition publishing to cfg.Store.
+func NewHLSSubtitleRendition(cfg HLSSubtitleRenditionConfig) (*HLSSubtitleRendition, error) {
+	if cfg.Store == nil {
+		return nil, errors.New("rendition store required")
+	}
+	if !strings.HasSuffix(cfg.Key, ".m3u8") {
+		return nil, fmt.Errorf("invalid playlist key %q", cfg.Key)
+	}
+	if cfg.SegmentDuration <= 0 {
+		cfg.SegmentDuration = DefaultHLSSegmentDuration
+	}
+	return &HLSSubtitleRendition{
+		cfg:  cfg,
+		dir:  strings.TrimSuffix(cfg.Key, ".m3u8"),
+		cues: make(map[int]SubtitleEvent),
+	}, nil
+}
+
+// Write applies event to the cues of the rendition.
+func (h *HLSSubtitleRendition) Write(event SubtitleEvent) error {
+	if h.closed {
+		return errors.New("rendition closed")
+	}
+	switch {
+	case event.Type == "remove":
+		delete(h.cues, event.Index)
+	case event.EndTime > event.StartTime && event.EndTime > h.published():
+		h.cues[event.Index] = event
+	}
+	return nil
+}
+
+// Publish publishes the segments that end by until, the stream time up to
+// which the cues are complete.
+func (h *HLSSubtitleRendition) Publish(ctx context.Context, until time.Duration) error {
+	if h.closed {
+		return errors.New("rendition closed")
+	}
+	published := len(h.segments)
+	for h.published()+h.cfg.SegmentDuration <= until {
+		if err := h.publishSegment(ctx, h.cfg.SegmentDuration); err != nil {
+			return err
+		}
+	}
+	if len(h.segments) == published {
+		return nil
+	}
+	return h.publishPlaylist(ctx)
+}
+
+// Close publishes the segments up to the end of the last cue and ends the
+// playlist.
+func (h *HLSSubtitleRendition) Close(ctx context.Context) error {
+	if h.closed {
+		return nil
+	}
+	var end time.Duration
+	for _, cue := range h.cues {
+		end = max(end, cue.EndTime)
+	}
+	for h.published() < end {
+		if err := h.publishSegment(ctx, min(h.cfg.SegmentDuration, end-h.published())); err != nil {
+			return err
+		}
+	}
+	h.closed = true
+	return h.publishPlaylist(ctx)
+}
+
+// published returns the stream time the published segments end at.
+func (h *HLSSubtitleRendition) published() time.Duration {
+	return h.cfg.Start + time.Duration(len(h.segments))*h.cfg.SegmentDuration
+}
+
+// publishSegment stores the segment of duration that starts where the
+// published ones end, and forgets the cues that end within it.
+func (h *HLSSubtitleRendition) publishSegment(ctx context.Context, duration time.Duration) error {
+	start := h.published()
+	end := start + duration
+
+	cues := make([]SubtitleEvent, 0, len(h.cues))
+	for index, cue := range h.cues {
+		if cue.StartTime < end && cue.EndTime > start {
+			cues = append(cues, cue)
+		}
+		if cue.EndTime <= end {
+			delete(h.cues, index)
+		}
+	}
+	sort.Slice(cues, func(i, j int) bool {
+		if cues[i].StartTime != cues[j].StartTime {
+			return cues[i].StartTime < cues[j].StartTime
+		}
+		return cues[i].Index < cues[j].Index
+	})
+
+	var body strings.Builder
+	// Cue times are stream times, which the dub renditions stamp on the
+	// 90kHz clock from zero.
+	body.WriteString("WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:0,LOCAL:00:00:00.000\n")
+	for _, cue := range cues {
+		fmt.Fprintf(&body, "\n%d\n%s --> %s\n%s\n", cue.Index, formatVTTTime(cue.StartTime), formatVTTTime(cue.EndTime), vttCueText(cue))
+	}
+	name := fmt.Sprintf("%05d.vtt", len(h.segments))
+	if err := h.cfg.Store.Put(ctx, h.dir+"/"+name, strings.NewReader(body.String())); err != nil {
+		return fmt.Errorf("publish rendition segment: %w", err)
+	}
+	h.segments = append(h.segments, hlsSegment{uri: path.Base(h.dir) + "/" + name, duration: duration})
+	return nil
+}
+
+// publishPlaylist stores the media playlist listing the published
+// segments.
+func (h *HLSSubtitleRendition) publishPlaylist(ctx context.Context) error {
+	return publishMediaPlaylist(ctx, h.cfg.Store, h.cfg.Key, h.cfg.SegmentDuration, h.segments, h.closed)
+}
+
+// vttEscaper escapes the characters WebVTT reserves in cue text.
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// vttCueText returns the payload of cue: its text escaped, without the
+// blank lines that would end it, in the voice of its speaker when known.
+func vttCueText(cue SubtitleEvent) string {
+	lines := strings.Split(strings.TrimSpace(cue.Text), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, vttEscaper.Replace(line))
+		}
+	}
+	text := strings.Join(kept, "\n")
+	if cue.Speaker != "" {
+		text = "<v " + vttEscaper.Replace(cue.Speaker) + ">" + text
+	}
+	return text
+}
@@ -0,0 +1,65 @@
+package output
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHLSSubtitleRenditionPublishesWebVTTSegments(t *testing.T) {
+	t.Parallel()
+
+	store := &memoryStore{}
+	rendition, err := NewHLSSubtitleRendition(HLSSubtitleRenditionConfig{Store: store, Key: "session/hls/subs-es.m3u8", SegmentDuration: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("NewHLSSubtitleRendition: %v", err)
+	}
+	ctx := context.Background()
+	for _, event := range []SubtitleEvent{
+		{Type: "add", Index: 0, StartTime: 500 * time.Millisecond, EndTime: 1500 * time.Millisecond, Text: "hola", Partial: true},
+		{Type: "update", Index: 0, StartTime: 500 * time.Millisecond, EndTime: 1500 * time.Millisecond, Text: "hola a todos"},
+		// The second cue spans the first two segments.
+		{Type: "add", Index: 1, StartTime: 1800 * time.Millisecond, EndTime: 2500 * time.Millisecond, Text: "<tú> & yo\n\nsí", Speaker: "S1"},
+		{Type: "add", Index: 2, StartTime: 3 * time.Second, EndTime: 3500 * time.Millisecond, Text: "quitado"},
+		{Type: "remove", Index: 2},
+	} {
+		if err := rendition.Write(event); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := rendition.Publish(ctx, 3*time.Second); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if playlist := store.files["session/hls/subs-es.m3u8"]; strings.Contains(playlist, "#EXT-X-ENDLIST") || strings.Count(playlist, "#EXTINF") != 1 {
+		t.Fatalf("expected an open playlist of one segment, got %q", playlist)
+	}
+	want := "WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:0,LOCAL:00:00:00.000\n\n" +
+		"0\n00:00:00.500 --> 00:00:01.500\nhola a todos\n\n" +
+		"1\n00:00:01.800 --> 00:00:02.500\n<v S1>&lt;tú&gt; &amp; yo\nsí\n"
+	if segment := store.files["session/hls/subs-es/00000.vtt"]; segment != want {
+		t.Fatalf("expected segment %q, got %q", want, segment)
+	}
+
+	if err := rendition.Write(SubtitleEvent{Type: "add", Index: 3, StartTime: 4500 * time.Millisecond, EndTime: 5 * time.Second, Text: "adiós"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := rendition.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	wantPlaylist := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:EVENT\n" +
+		"#EXTINF:2.000,\nsubs-es/00000.vtt\n#EXTINF:2.000,\nsubs-es/00001.vtt\n#EXTINF:1.000,\nsubs-es/00002.vtt\n#EXT-X-ENDLIST\n"
+	if playlist := store.files["session/hls/subs-es.m3u8"]; playlist != wantPlaylist {
+		t.Fatalf("expected playlist %q, got %q", wantPlaylist, playlist)
+	}
+	if segment := store.files["session/hls/subs-es/00001.vtt"]; !strings.Contains(segment, "\n1\n00:00:01.800 --> 00:00:02.500\n") || strings.Contains(segment, "quitado") {
+		t.Fatalf("expected the spanning cue and not the removed one, got %q", segment)
+	}
+	if segment := store.files["session/hls/subs-es/00002.vtt"]; !strings.Contains(segment, "adiós") || strings.Contains(segment, "hola") {
+		t.Fatalf("expected only the last cue, got %q", segment)
+	}
+
+	if err := rendition.Write(SubtitleEvent{Type: "add", EndTime: time.Second}); err == nil {
+		t.Fatal("expected a closed rendition to refuse cues")
+	}
+}
@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"streamlation/packages/backend/archive"
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// DefaultArchiveInterval is how often a streaming run writes its archive
+// when ArchiveConfig.Interval is not set.
+const DefaultArchiveInterval = 30 * time.Second
+
+// ArchiveState marks the warning a run emits when writing its archive
+// fails.
+const ArchiveState = "archive"
+
+// archiveWriter records a run into the session's archive and reports
+// failures once until a flush succeeds again. A nil writer records nothing.
+type archiveWriter struct {
+	recorder  *archive.Recorder
+	sessionID string
+	emit      func(statuspkg.SessionStatusEvent) error
+	failing   bool
+}
+
+// startArchive opens the session's archive when archiving is enabled. A
+// failure to open it is reported and the run continues without archiving.
+func (r *StreamingRunner) startArchive(ctx context.Context, sessionID string, emit func(statuspkg.SessionStatusEvent) error) *archiveWriter {
+	if r.config.Archive.Store == nil {
+		return nil
+	}
+	writer := &archiveWriter{sessionID: sessionID, emit: emit}
+	recorder, err := archive.NewRecorder(ctx, r.config.Archive.Store, sessionID)
+	if err != nil {
+		writer.report(fmt.Errorf("archiving disabled: %w", err))
+		return nil
+	}
+	writer.recorder = recorder
+	return writer
+}
+
+func (w *archiveWriter) audio(chunk media.AudioChunk) {
+	if w != nil {
+		w.recorder.AddAudio(chunk)
+	}
+}
+
+func (w *archiveWriter) transcript(transcript asr.Transcript) {
+	if w != nil {
+		w.recorder.AddTranscript(transcript)
+	}
+}
+
+func (w *archiveWriter) subtitle(event output.SubtitleEvent) {
+	if w != nil {
+		w.recorder.AddSubtitle(event)
+	}
+}
+
+// flush writes what was recorded since the last flush. Failures are
+// reported as warnings; they never fail the run.
+func (w *archiveWriter) flush(ctx context.Context) {
+	w.report(w.recorder.Flush(ctx))
+}
+
+// finish writes the rest of a run that ended with err, marking the archive
+// complete when the run completed.
+func (w *archiveWriter) finish(ctx context.Context, err error) {
+	// The run's context is usually cancelled by now.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	w.report(w.recorder.Close(ctx, err == nil))
+}
+
+func (w *archiveWriter) report(err error) {
+	if err == nil {
+		w.failing = false
+		return
+	}
+	if w.failing {
+		return
+	}
+	w.failing = true
+	_ = w.emit(statuspkg.SessionStatusEvent{
+		SessionID: w.sessionID,
+		Stage:     "pipeline",
+		State:     ArchiveState,
+		Detail:    err.Error(),
+		Code:      statuspkg.CodeArchiveFailed,
+		Severity:  statuspkg.SeverityWarning,
+		Timestamp: time.Now().UTC(),
+	})
+}
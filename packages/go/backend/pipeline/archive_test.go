@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/archive"
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// unavailableStore fails every operation.
+type unavailableStore struct{}
+
+func (unavailableStore) Put(context.Context, string, io.Reader) error {
+	return errors.New("bucket unavailable")
+}
+
+func (unavailableStore) Get(context.Context, string) (io.ReadCloser, error) {
+	return nil, archive.ErrNotFound
+}
+
+func newArchivingRunner(t *testing.T, store archive.Store) *StreamingRunner {
+	t.Helper()
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second "), []byte("third")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		Archive: ArchiveConfig{
+			Store:    store,
+			Interval: time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	return runner
+}
+
+func TestStreamingRunnerArchivesRun(t *testing.T) {
+	t.Parallel()
+
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	session := streamingSession()
+	if err := newArchivingRunner(t, store).Run(context.Background(), session, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	manifest, err := archive.LoadManifest(context.Background(), store, session.ID)
+	if err != nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	if !manifest.Complete {
+		t.Fatal("expected the archive of a completed run to be complete")
+	}
+	var audio time.Duration
+	for _, object := range manifest.Audio {
+		audio += object.Duration
+	}
+	if audio != 300*time.Millisecond {
+		t.Fatalf("expected all normalized audio to be archived, got %s in %+v", audio, manifest.Audio)
+	}
+	transcripts, subtitles := 0, 0
+	for _, object := range manifest.Transcripts {
+		transcripts += object.Records
+	}
+	for _, object := range manifest.Subtitles {
+		if object.Language != "es" {
+			t.Fatalf("unexpected subtitle object %+v", object)
+		}
+		subtitles += object.Records
+	}
+	if transcripts != 3 || subtitles != 3 {
+		t.Fatalf("expected 3 transcripts and 3 subtitles, got %d and %d", transcripts, subtitles)
+	}
+}
+
+func TestStreamingRunnerReportsArchiveFailuresOnce(t *testing.T) {
+	t.Parallel()
+
+	var warnings []statuspkg.SessionStatusEvent
+	err := newArchivingRunner(t, unavailableStore{}).Run(context.Background(), streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		if event.State == ArchiveState {
+			warnings = append(warnings, event)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected archive failures not to fail the run, got %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Code != statuspkg.CodeArchiveFailed || warnings[0].Severity != statuspkg.SeverityWarning {
+		t.Fatalf("expected a single archive warning, got %+v", warnings)
+	}
+}
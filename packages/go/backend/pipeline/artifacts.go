@@ -0,0 +1,182 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/output"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// DefaultArtifactFormats are the subtitle files a streaming run persists
+// when ArtifactConfig.Formats is not set.
+var DefaultArtifactFormats = []output.SubtitleFormat{output.FormatSRT, output.FormatVTT}
+
+// ArtifactState marks the warning a run emits when persisting its
+// artifacts fails.
+const ArtifactState = "artifacts"
+
+// artifactFinishTimeout bounds persisting the artifacts of a run that
+// ended.
+const artifactFinishTimeout = 30 * time.Second
+
+// artifactCollector keeps the final translations of every language of a
+// run and, once the run completes, has the run's generator render them as
+// subtitle files that it persists as artifacts, along with a transcript
+// aligning the languages when asked to, bundled in a package when asked to
+// and there are several languages. With cue edits, the files render the
+// formatted cues, persisted as cue lists, with the edits applied, and the
+// transcript carries the edited text. A nil collector keeps nothing.
+type artifactCollector struct {
+	writer     *output.ArtifactWriter
+	generator  output.SubtitleGenerator
+	formatter  *output.CueFormatter
+	renderer   output.SubtitleGenerator
+	edits      output.CueEditStore
+	formats    []output.SubtitleFormat
+	transcript bool
+	bundle     bool
+	sessionID  string
+	emit       func(statuspkg.SessionStatusEvent) error
+
+	// mu guards the translations, which the language branches add.
+	mu           sync.Mutex
+	translations map[string][]translation.Translation
+	languages    []string
+}
+
+// startArtifacts returns the artifact collector of a run of sessionID, or
+// nil when artifacts are not persisted.
+func (r *StreamingRunner) startArtifacts(sessionID string, emit func(statuspkg.SessionStatusEvent) error) *artifactCollector {
+	if r.config.Artifacts.Writer == nil {
+		return nil
+	}
+	return &artifactCollector{
+		writer:       r.config.Artifacts.Writer,
+		generator:    r.config.Generator,
+		formatter:    r.formatter,
+		renderer:     r.renderer,
+		edits:        r.config.Artifacts.CueEdits,
+		formats:      r.config.Artifacts.Formats,
+		transcript:   r.config.Artifacts.Transcript,
+		bundle:       r.config.Artifacts.Package,
+		sessionID:    sessionID,
+		emit:         emit,
+		translations: make(map[string][]translation.Translation),
+	}
+}
+
+// translation keeps translated when it is final.
+func (c *artifactCollector) translation(language string, translated translation.Translation) {
+	if c == nil || translated.Partial {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.translations[language]; !ok {
+		c.languages = append(c.languages, language)
+	}
+	c.translations[language] = append(c.translations[language], translated)
+}
+
+// finish persists the subtitle files of a run that ended with err, when it
+// completed. The first failure is reported as a warning and stops the
+// persisting; it never fails the run.
+func (c *artifactCollector) finish(ctx context.Context, err error) {
+	if c == nil || err != nil {
+		return
+	}
+	// The run's context is usually cancelled by now.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), artifactFinishTimeout)
+	defer cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var edits []output.CueEdit
+	if c.edits != nil {
+		var err error
+		if edits, err = c.edits.CueEdits(ctx, c.sessionID); err != nil {
+			c.warn(fmt.Sprintf("load cue edits: %v", err))
+			return
+		}
+	}
+	var persisted []output.Artifact
+	cues := make(map[string][]output.Cue, len(c.languages))
+	for _, language := range c.languages {
+		generator, final := c.generator, c.translations[language]
+		if c.edits != nil {
+			listed, err := c.persistCues(ctx, language)
+			if err != nil {
+				c.warn(fmt.Sprintf("persist %s cues: %v", language, err))
+				return
+			}
+			cues[language] = listed
+			generator, final = c.renderer, output.CueTranslations(language, output.ApplyCueEdits(listed, edits))
+		}
+		for _, format := range c.formats {
+			translations := make(chan translation.Translation, len(final))
+			for _, translated := range final {
+				translations <- translated
+			}
+			close(translations)
+			artifact, err := c.writer.PersistSubtitles(ctx, generator, format, c.sessionID, language, translations)
+			if err != nil {
+				c.warn(fmt.Sprintf("persist %s %s subtitles: %v", language, format, err))
+				return
+			}
+			persisted = append(persisted, artifact)
+		}
+	}
+	if c.transcript {
+		// The languages arrive in no particular order.
+		languages := slices.Clone(c.languages)
+		slices.Sort(languages)
+		records := output.AlignTranscript(languages, c.translations)
+		if len(edits) > 0 {
+			for _, language := range languages {
+				records = output.EditTranscript(records, language, cues[language], edits)
+			}
+		}
+		artifact, err := c.writer.PersistTranscript(ctx, c.sessionID, records)
+		if err != nil {
+			c.warn(fmt.Sprintf("persist transcript: %v", err))
+			return
+		}
+		persisted = append(persisted, artifact)
+	}
+	if c.bundle && len(c.languages) > 1 {
+		if _, err := c.writer.PersistPackage(ctx, c.sessionID, persisted); err != nil {
+			c.warn(fmt.Sprintf("persist subtitle package: %v", err))
+		}
+	}
+}
+
+// persistCues persists the cue list of language and returns its cues.
+func (c *artifactCollector) persistCues(ctx context.Context, language string) ([]output.Cue, error) {
+	final := c.translations[language]
+	if c.formatter != nil {
+		final = c.formatter.Format(final)
+	}
+	cues := output.NewCues(language, final)
+	if _, err := c.writer.PersistCues(ctx, c.sessionID, language, cues); err != nil {
+		return nil, err
+	}
+	return cues, nil
+}
+
+// warn reports a failure to persist the artifacts.
+func (c *artifactCollector) warn(detail string) {
+	_ = c.emit(statuspkg.SessionStatusEvent{
+		SessionID: c.sessionID,
+		Stage:     "pipeline",
+		State:     ArtifactState,
+		Detail:    detail,
+		Code:      statuspkg.CodeOutputFailed,
+		Severity:  statuspkg.SeverityWarning,
+		Timestamp: time.Now().UTC(),
+	})
+}
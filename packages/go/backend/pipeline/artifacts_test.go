@@ -0,0 +1,264 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"streamlation/packages/backend/archive"
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// artifactLog records the artifacts persisted by a run.
+type artifactLog struct {
+	mu        sync.Mutex
+	artifacts []output.Artifact
+}
+
+func (l *artifactLog) Record(_ context.Context, artifact output.Artifact) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.artifacts = append(l.artifacts, artifact)
+	return nil
+}
+
+func (l *artifactLog) Artifacts(context.Context, string) ([]output.Artifact, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]output.Artifact(nil), l.artifacts...), nil
+}
+
+// refusingArtifactStore fails every write and read.
+type refusingArtifactStore struct {
+	refusingStore
+}
+
+func (refusingArtifactStore) Get(context.Context, string) (io.ReadCloser, error) {
+	return nil, errors.New("disk full")
+}
+
+func runArtifacts(t *testing.T, store output.ArtifactStore, registry output.ArtifactRegistry, configure func(*StreamingConfig), additional ...string) []statuspkg.SessionStatusEvent {
+	t.Helper()
+	writer, err := output.NewArtifactWriter(store, registry)
+	if err != nil {
+		t.Fatalf("new artifact writer: %v", err)
+	}
+	config := StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second "), []byte("third")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		Artifacts: ArtifactConfig{
+			Writer:  writer,
+			Formats: []output.SubtitleFormat{output.FormatSRT, output.FormatTTML},
+			Package: true,
+		},
+	}
+	if configure != nil {
+		configure(&config)
+	}
+	runner, err := NewStreamingRunner(config)
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	session := streamingSession()
+	session.Options.AdditionalLanguages = additional
+	var warnings []statuspkg.SessionStatusEvent
+	err = runner.Run(context.Background(), session, func(event statuspkg.SessionStatusEvent) error {
+		if event.State == ArtifactState {
+			warnings = append(warnings, event)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected artifacts not to fail the run, got %v", err)
+	}
+	return warnings
+}
+
+func TestStreamingRunnerPersistsSubtitleArtifacts(t *testing.T) {
+	t.Parallel()
+
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	registry := &artifactLog{}
+	if warnings := runArtifacts(t, store, registry, nil); len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %+v", warnings)
+	}
+
+	srt := readObject(t, store, "stream-session/subtitles/es.srt")
+	if strings.Count(srt, " --> ") != 3 {
+		t.Fatalf("expected the three subtitles of the run, got %q", srt)
+	}
+	if ttml := readObject(t, store, "stream-session/subtitles/es.ttml"); !strings.Contains(ttml, "<tt ") {
+		t.Fatalf("expected a TTML document, got %q", ttml)
+	}
+	artifacts, _ := registry.Artifacts(context.Background(), "stream-session")
+	if len(artifacts) != 2 || artifacts[0].Key != "stream-session/subtitles/es.srt" || artifacts[0].Size != int64(len(srt)) {
+		t.Fatalf("expected both artifacts, and no package of a single language, to be recorded, got %+v", artifacts)
+	}
+}
+
+func TestStreamingRunnerPackagesArtifactsOfSeveralLanguages(t *testing.T) {
+	t.Parallel()
+
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	registry := &artifactLog{}
+	if warnings := runArtifacts(t, store, registry, nil, "fr"); len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %+v", warnings)
+	}
+
+	artifacts, _ := registry.Artifacts(context.Background(), "stream-session")
+	if len(artifacts) != 5 {
+		t.Fatalf("expected the files of both languages and their package, got %+v", artifacts)
+	}
+	pkg := artifacts[4]
+	if pkg.Key != "stream-session/package/mul.zip" || pkg.Kind != output.ArtifactPackage {
+		t.Fatalf("expected the package to be recorded last, got %+v", pkg)
+	}
+	body := readObject(t, store, pkg.Key)
+	files, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("open package: %v", err)
+	}
+	var names []string
+	for _, file := range files.File {
+		names = append(names, file.Name)
+	}
+	if strings.Join(names, ",") != "subtitles/es.srt,subtitles/es.ttml,subtitles/fr.srt,subtitles/fr.ttml,manifest.json" {
+		t.Fatalf("unexpected package files %v", names)
+	}
+}
+
+func TestStreamingRunnerPersistsTranscripts(t *testing.T) {
+	t.Parallel()
+
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	registry := &artifactLog{}
+	warnings := runArtifacts(t, store, registry, func(config *StreamingConfig) {
+		config.Artifacts.Transcript = true
+		config.Artifacts.Package = false
+	}, "fr")
+	if len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %+v", warnings)
+	}
+
+	artifacts, _ := registry.Artifacts(context.Background(), "stream-session")
+	if len(artifacts) != 5 || artifacts[4].Key != "stream-session/transcript/mul.jsonl" || artifacts[4].Kind != output.ArtifactTranscript {
+		t.Fatalf("expected the transcript to be recorded after the subtitles, got %+v", artifacts)
+	}
+	lines := strings.Split(strings.TrimSuffix(readObject(t, store, artifacts[4].Key), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a record per segment, got %q", lines)
+	}
+	var record output.TranscriptRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("decode record: %v", err)
+	}
+	if record.Index != 0 || record.SourceText == "" || len(record.Translations) != 2 || record.Translations[0].Language != "es" || record.Translations[1].Language != "fr" {
+		t.Fatalf("expected the first segment aligned in both languages, got %+v", record)
+	}
+}
+
+// cueEditLog keeps cue edits in memory.
+type cueEditLog struct {
+	edits []output.CueEdit
+}
+
+func (l *cueEditLog) SaveCueEdit(_ context.Context, _ string, edit output.CueEdit) error {
+	l.edits = append(l.edits, edit)
+	return nil
+}
+
+func (l *cueEditLog) CueEdits(context.Context, string) ([]output.CueEdit, error) {
+	return l.edits, nil
+}
+
+func TestStreamingRunnerAppliesCueEdits(t *testing.T) {
+	t.Parallel()
+
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	registry := &artifactLog{}
+	text := "Editado"
+	edits := &cueEditLog{edits: []output.CueEdit{{CueID: "es-1", Text: &text}}}
+	warnings := runArtifacts(t, store, registry, func(config *StreamingConfig) {
+		config.Artifacts.CueEdits = edits
+		config.Artifacts.Transcript = true
+	})
+	if len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %+v", warnings)
+	}
+
+	srt := readObject(t, store, "stream-session/subtitles/es.srt")
+	if strings.Count(srt, " --> ") != 3 || !strings.Contains(srt, "2\n00:00:00,100 --> 00:00:00,200\nEditado\n") {
+		t.Fatalf("expected the second cue edited, got %q", srt)
+	}
+	var cues []output.Cue
+	if err := json.Unmarshal([]byte(readObject(t, store, "stream-session/cues/es.json")), &cues); err != nil {
+		t.Fatalf("decode cues: %v", err)
+	}
+	if len(cues) != 3 || cues[1].ID != "es-1" || cues[1].Text == text || cues[1].Edited {
+		t.Fatalf("expected the cue list as generated, got %+v", cues)
+	}
+	records, err := output.ReadTranscript(strings.NewReader(readObject(t, store, "stream-session/transcript/mul.jsonl")))
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+	if len(records) != 3 || records[1].Translations[0].Text != text || records[0].Translations[0].Text == text {
+		t.Fatalf("expected the second segment edited in the transcript, got %+v", records)
+	}
+}
+
+func TestStreamingRunnerReportsArtifactFailuresOnce(t *testing.T) {
+	t.Parallel()
+
+	warnings := runArtifacts(t, refusingArtifactStore{}, nil, nil)
+	if len(warnings) != 1 || warnings[0].Code != statuspkg.CodeOutputFailed || warnings[0].Severity != statuspkg.SeverityWarning {
+		t.Fatalf("expected a single artifact warning, got %+v", warnings)
+	}
+	if !strings.Contains(warnings[0].Detail, "disk full") {
+		t.Fatalf("expected the warning to name the failure, got %q", warnings[0].Detail)
+	}
+}
+
+func TestNewStreamingRunnerRejectsUnknownArtifactFormats(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewStreamingRunner(StreamingConfig{
+		Sources:    func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) { return &stubSource{}, nil },
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		Artifacts: ArtifactConfig{
+			Formats: []output.SubtitleFormat{"ass"},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an unknown artifact format to be rejected")
+	}
+}
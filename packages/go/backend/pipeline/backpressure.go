@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// DropPolicy says what a stage's input queue does with new input when it is
+// full.
+type DropPolicy string
+
+const (
+	// DropBlock waits for room, slowing down the stages upstream. It is the
+	// default and never loses data.
+	DropBlock DropPolicy = "block"
+	// DropOldest discards the oldest queued item to make room, keeping the
+	// stage close to live.
+	DropOldest DropPolicy = "drop-oldest"
+	// DropNewest discards the new item, keeping what is already queued.
+	DropNewest DropPolicy = "drop-newest"
+)
+
+// ParseDropPolicy validates a drop policy name. An empty name selects
+// DropBlock.
+func ParseDropPolicy(raw string) (DropPolicy, error) {
+	switch policy := DropPolicy(raw); policy {
+	case "":
+		return DropBlock, nil
+	case DropBlock, DropOldest, DropNewest:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown drop policy %q (want %s, %s, or %s)", raw, DropBlock, DropOldest, DropNewest)
+	}
+}
+
+// dropReportInterval is the least time between two drop reports of one
+// stage, so that a stage that cannot keep up does not flood the status
+// stream.
+const dropReportInterval = time.Second
+
+// dropReporter accumulates the drops of one stage and reports them as
+// status events, at most once per dropReportInterval.
+type dropReporter struct {
+	run      *streamRun
+	counters *Counters
+	stage    string
+	language string
+	detail   string
+
+	pending    int64
+	reportedAt time.Time
+}
+
+func newDropReporter(run *streamRun, counters *Counters, stage, language, detail string) *dropReporter {
+	return &dropReporter{run: run, counters: counters, stage: stage, language: language, detail: detail}
+}
+
+// add counts n dropped items and reports them if the last report is old
+// enough.
+func (d *dropReporter) add(ctx context.Context, n int64) {
+	if n <= 0 {
+		return
+	}
+	d.counters.AddDropped(n)
+	d.pending += n
+	if time.Since(d.reportedAt) >= dropReportInterval {
+		d.flush(ctx)
+	}
+}
+
+// flush reports the drops counted since the last report.
+func (d *dropReporter) flush(ctx context.Context) {
+	if d.pending == 0 {
+		return
+	}
+	d.run.notify(ctx, statuspkg.SessionStatusEvent{
+		Stage:    d.stage,
+		State:    statuspkg.DroppingState,
+		Detail:   fmt.Sprintf("dropped %d items (%s)", d.pending, d.detail),
+		Code:     statuspkg.CodeStageDataDropped,
+		Severity: statuspkg.SeverityWarning,
+		Language: d.language,
+		Dropped:  d.pending,
+	})
+	d.pending = 0
+	d.reportedAt = time.Now()
+}
+
+// queue puts a bounded queue with the stage's drop policy in front of a
+// stage. With the default blocking policy and no capacity override it
+// returns in unchanged, as the channels between stages already block.
+func queue[T any](ctx context.Context, run *streamRun, counters *Counters, stage, language string, in <-chan T) <-chan T {
+	policy := run.policies[stage]
+	drop := policy.Drop
+	if drop == "" {
+		drop = DropBlock
+	}
+	if drop == DropBlock && policy.Capacity <= 0 {
+		return in
+	}
+	capacity := policy.Capacity
+	if capacity <= 0 {
+		capacity = run.bufferSize
+	}
+
+	out := make(chan T, capacity)
+	reporter := newDropReporter(run, counters, stage, language, fmt.Sprintf("%s, capacity %d", drop, capacity))
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		// Drops that were not reported yet are reported when the input
+		// ends; a cancelled run discards them along with everything else.
+		defer reporter.flush(ctx)
+
+		for {
+			var value T
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				value = v
+			}
+
+			switch drop {
+			case DropBlock:
+				select {
+				case out <- value:
+				case <-ctx.Done():
+					return
+				}
+			case DropNewest:
+				select {
+				case out <- value:
+				default:
+					reporter.add(ctx, 1)
+				}
+			case DropOldest:
+				for sent := false; !sent; {
+					select {
+					case out <- value:
+						sent = true
+					default:
+						// The stage may take the oldest item itself in
+						// the meantime, in which case nothing is lost.
+						select {
+						case <-out:
+							reporter.add(ctx, 1)
+						default:
+						}
+					}
+				}
+			}
+		}
+	}()
+	return out
+}
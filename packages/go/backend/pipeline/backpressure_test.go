@@ -0,0 +1,124 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+func TestParseDropPolicy(t *testing.T) {
+	t.Parallel()
+
+	for raw, want := range map[string]DropPolicy{"": DropBlock, "block": DropBlock, "drop-oldest": DropOldest, "drop-newest": DropNewest} {
+		got, err := ParseDropPolicy(raw)
+		if err != nil || got != want {
+			t.Fatalf("%q: expected %s, got %s (%v)", raw, want, got, err)
+		}
+	}
+	if _, err := ParseDropPolicy("drop-all"); err == nil {
+		t.Fatal("expected unknown policy to be rejected")
+	}
+}
+
+func TestQueueAppliesDropPolicy(t *testing.T) {
+	t.Parallel()
+
+	for drop, want := range map[DropPolicy][]int{
+		DropNewest: {0, 1},
+		DropOldest: {3, 4},
+	} {
+		run := &streamRun{
+			sessionID:  "queue-session",
+			bufferSize: DefaultStageBuffer,
+			policies:   map[string]StagePolicy{"asr": {Capacity: 2, Drop: drop}},
+			notices:    make(chan statuspkg.SessionStatusEvent, noticeBuffer),
+		}
+		counters := &Counters{}
+		in := make(chan int)
+		out := queue(context.Background(), run, counters, "asr", "", in)
+
+		// Nothing reads the queue until the input is closed.
+		for i := 0; i < 5; i++ {
+			in <- i
+		}
+		close(in)
+		var got []int
+		for value := range out {
+			got = append(got, value)
+		}
+		run.wg.Wait()
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: expected %v to be kept, got %v", drop, want, got)
+		}
+		if dropped := counters.Snapshot().ItemsDropped; dropped != 3 {
+			t.Fatalf("%s: expected 3 drops to be counted, got %d", drop, dropped)
+		}
+		var reported int64
+		for len(run.notices) > 0 {
+			event := <-run.notices
+			if event.Stage != "asr" || event.State != statuspkg.DroppingState || event.Code != statuspkg.CodeStageDataDropped || event.Severity != statuspkg.SeverityWarning {
+				t.Fatalf("%s: unexpected drop event: %+v", drop, event)
+			}
+			reported += event.Dropped
+		}
+		if reported != 3 {
+			t.Fatalf("%s: expected 3 drops to be reported, got %d", drop, reported)
+		}
+	}
+}
+
+func TestQueueKeepsBlockingChannelsByDefault(t *testing.T) {
+	t.Parallel()
+
+	run := &streamRun{bufferSize: DefaultStageBuffer}
+	in := make(chan int)
+	if out := queue(context.Background(), run, nil, "asr", "", in); out != (<-chan int)(in) {
+		t.Fatal("expected the input channel to be used as is")
+	}
+}
+
+func TestStreamingRunnerReportsSourceDrops(t *testing.T) {
+	t.Parallel()
+
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("media")}, dropped: 4}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	counters := &Counters{}
+	ctx, cancel := context.WithTimeout(WithCounters(context.Background(), counters), 5*time.Second)
+	defer cancel()
+	var dropped int64
+	err = runner.Run(ctx, streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		if event.State == statuspkg.DroppingState {
+			if event.Stage != "ingestion" {
+				t.Errorf("unexpected drop event: %+v", event)
+			}
+			dropped += event.Dropped
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if dropped != 4 || counters.Snapshot().ItemsDropped != 4 {
+		t.Fatalf("expected 4 source drops, reported %d, counted %d", dropped, counters.Snapshot().ItemsDropped)
+	}
+}
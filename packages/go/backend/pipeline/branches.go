@@ -0,0 +1,301 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/output"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/tts"
+)
+
+// languageBranch is the translation and output path for one target language
+// of a session.
+type languageBranch struct {
+	language string
+	// tag is the language attached to the branch's events and failures. It
+	// is empty for sessions with a single target language.
+	tag    string
+	ctx    context.Context
+	cancel context.CancelFunc
+	// indexOffset shifts subtitle indexes so that a resumed run continues
+	// numbering where the previous run stopped.
+	indexOffset int
+
+	// subtitles counts the branch's subtitles. It is written by the
+	// branch's forwarding goroutine and read once the run has stopped.
+	subtitles int
+	// failed is the error that stopped the branch, if any.
+	failed error
+	// removed is set when an options update dropped the branch's language.
+	removed bool
+	// compared measures the candidate translator against the branch's
+	// translator when one is configured.
+	compared *comparison
+
+	// dubbingCtx scopes the branch's dubbing, which is started for
+	// sessions with dubbing enabled or a synthesizer to enable it with.
+	// Dubbing may fail on its own without stopping the branch's subtitles.
+	dubbingCtx    context.Context
+	dubbingCancel context.CancelFunc
+	// segments counts the branch's synthesized audio segments, like
+	// subtitles.
+	segments int
+	// dubbingFailed is the error that stopped the branch's dubbing, if any.
+	dubbingFailed error
+}
+
+// newLanguageBranch returns a branch for language whose context derives from
+// ctx. Tagged branches attach their language to events and failures.
+func newLanguageBranch(ctx context.Context, language string, tagged bool) *languageBranch {
+	branch := &languageBranch{language: language}
+	if tagged {
+		branch.tag = language
+	}
+	branch.ctx, branch.cancel = context.WithCancel(ctx)
+	return branch
+}
+
+// branchSet fans the transcripts of a run out to its language branches and
+// merges their subtitles into a single channel, labelling each with its
+// branch's language. Branches may join while transcripts are still flowing.
+// A branch whose context is cancelled stops receiving copies so that it does
+// not hold back the others; the slowest live branch applies backpressure
+// upstream.
+type branchSet struct {
+	run    *streamRun
+	ctx    context.Context
+	merged chan output.SubtitleEvent
+	audio  chan tts.AudioSegment
+	// forwarders counts the branches whose subtitles may still arrive, plus
+	// one for the fan-out while branches can still join.
+	forwarders sync.WaitGroup
+
+	mu     sync.Mutex
+	feeds  []branchFeed
+	closed bool
+
+	// branches lists every branch that joined, in order. Only Run's
+	// goroutine uses it.
+	branches []*languageBranch
+}
+
+type branchFeed struct {
+	branch *languageBranch
+	in     chan asr.Transcript
+}
+
+// newBranchSet starts fanning in out to branches and returns the input of
+// each of them.
+func newBranchSet(ctx context.Context, run *streamRun, in <-chan asr.Transcript, branches []*languageBranch) (*branchSet, []<-chan asr.Transcript) {
+	s := &branchSet{
+		run:    run,
+		ctx:    ctx,
+		merged: make(chan output.SubtitleEvent, run.bufferSize),
+		audio:  make(chan tts.AudioSegment, run.bufferSize),
+	}
+	s.forwarders.Add(1)
+	inputs := make([]<-chan asr.Transcript, len(branches))
+	for i, branch := range branches {
+		inputs[i], _ = s.join(branch)
+	}
+
+	run.wg.Add(2)
+	go func() {
+		defer run.wg.Done()
+		defer s.forwarders.Done()
+		defer s.close()
+		for {
+			var value asr.Transcript
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				value = v
+			}
+			s.mu.Lock()
+			feeds := append([]branchFeed(nil), s.feeds...)
+			s.mu.Unlock()
+			for _, feed := range feeds {
+				select {
+				case feed.in <- value:
+				case <-feed.branch.ctx.Done():
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	go func() {
+		defer run.wg.Done()
+		s.forwarders.Wait()
+		close(s.merged)
+		close(s.audio)
+	}()
+	return s, inputs
+}
+
+// join adds branch to the set and returns its input. It reports false once
+// the transcripts have ended, in which case the branch has nothing to do.
+// Every joined branch must be passed to merge.
+func (s *branchSet) join(branch *languageBranch) (<-chan asr.Transcript, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, false
+	}
+	in := make(chan asr.Transcript, s.run.bufferSize)
+	s.feeds = append(s.feeds, branchFeed{branch: branch, in: in})
+	s.branches = append(s.branches, branch)
+	s.forwarders.Add(1)
+	return in, true
+}
+
+// close ends the input of every branch and stops further joins.
+func (s *branchSet) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, feed := range s.feeds {
+		close(feed.in)
+	}
+}
+
+// merge forwards the subtitles of a joined branch. Branches that failed to
+// start pass nil events.
+func (s *branchSet) merge(branch *languageBranch, events <-chan output.SubtitleEvent) {
+	if events == nil {
+		s.forwarders.Done()
+		return
+	}
+	s.run.wg.Add(1)
+	go func() {
+		defer s.run.wg.Done()
+		defer s.forwarders.Done()
+		for event := range events {
+			event.Language = branch.language
+			event.Index += branch.indexOffset
+			// IDs follow the shifted indexes, so that they stay unique
+			// across resumed runs.
+			event.ID = output.CueID(branch.language, event.Index)
+			if event.Type == "add" {
+				branch.subtitles++
+			}
+			select {
+			case s.merged <- event:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// subtitles returns the merged subtitles. The channel closes once the
+// transcripts have ended and every branch has finished.
+func (s *branchSet) subtitles() <-chan output.SubtitleEvent {
+	return s.merged
+}
+
+// find returns the joined branch for language that is still running.
+func (s *branchSet) find(language string) *languageBranch {
+	for _, branch := range s.branches {
+		if branch.language == language && branch.failed == nil && !branch.removed {
+			return branch
+		}
+	}
+	return nil
+}
+
+// skipTranslated drops the transcripts ending at or before cursor, which a
+// previous run of the session already translated.
+func skipTranslated(ctx context.Context, run *streamRun, in <-chan asr.Transcript, cursor time.Duration) <-chan asr.Transcript {
+	out := make(chan asr.Transcript, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case transcript, ok := <-in:
+				if !ok {
+					return
+				}
+				if transcript.EndTime <= cursor {
+					continue
+				}
+				select {
+				case out <- transcript:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// emitBranchCompletions reports stage completion for every branch that did
+// not fail. Sessions with a single branch only report the stage as a whole.
+func emitBranchCompletions(emit func(statuspkg.SessionStatusEvent) error, sessionID, stage string, branches []*languageBranch) error {
+	for _, branch := range branches {
+		if branch.tag == "" || branch.failed != nil || branch.removed {
+			continue
+		}
+		detail := "Translated to " + branch.language
+		if stage == "output" {
+			detail = "Generated " + itoa(branch.subtitles) + " subtitles"
+		}
+		err := emit(statuspkg.SessionStatusEvent{
+			SessionID: sessionID,
+			Stage:     stage,
+			State:     "completed",
+			Detail:    detail,
+			Language:  branch.language,
+			Timestamp: time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func totalSubtitles(branches []*languageBranch) int {
+	total := 0
+	for _, branch := range branches {
+		total += branch.subtitles
+	}
+	return total
+}
+
+// translationSummary describes which languages were translated, which
+// branches failed, and which were stopped by an options update.
+func translationSummary(branches []*languageBranch) string {
+	var done, failed, stopped []string
+	for _, branch := range branches {
+		switch {
+		case branch.failed != nil:
+			failed = append(failed, branch.language)
+		case branch.removed:
+			stopped = append(stopped, branch.language)
+		default:
+			done = append(done, branch.language)
+		}
+	}
+	summary := "Translated to " + strings.Join(done, ", ")
+	if len(failed) > 0 {
+		summary += "; failed: " + strings.Join(failed, ", ")
+	}
+	if len(stopped) > 0 {
+		summary += "; stopped: " + strings.Join(stopped, ", ")
+	}
+	return summary
+}
@@ -0,0 +1,166 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// languageFailingTranslator fails mid-stream for the failing target
+// languages and behaves like the stub translator for the others.
+type languageFailingTranslator struct {
+	*translation.StubTranslator
+	failing map[string]bool
+}
+
+func (t *languageFailingTranslator) TranslateStream(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string) (<-chan translation.Translation, error) {
+	if !t.failing[targetLang] {
+		return t.StubTranslator.TranslateStream(ctx, sessionID, transcripts, targetLang)
+	}
+	out := make(chan translation.Translation)
+	go func() {
+		defer close(out)
+		select {
+		case <-transcripts:
+			statuspkg.ReportStageError(ctx, errors.New("unsupported language pair"))
+		case <-ctx.Done():
+		}
+	}()
+	return out, nil
+}
+
+func runMultiLanguage(t *testing.T, translator translation.Translator, additional ...string) (map[string]int, []statuspkg.SessionStatusEvent, error) {
+	t.Helper()
+	var (
+		mu        sync.Mutex
+		subtitles = make(map[string]int)
+	)
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second "), []byte("third")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translator,
+		Generator:  output.NewStubGenerator(),
+		Output: OutputConfig{
+			OnSubtitle: func(_ context.Context, event output.SubtitleEvent) error {
+				mu.Lock()
+				defer mu.Unlock()
+				subtitles[event.Language]++
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	session := streamingSession()
+	session.Options.AdditionalLanguages = additional
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var events []statuspkg.SessionStatusEvent
+	err = runner.Run(ctx, session, func(event statuspkg.SessionStatusEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	return subtitles, events, err
+}
+
+func TestStreamingRunnerTranslatesEveryTargetLanguage(t *testing.T) {
+	t.Parallel()
+
+	subtitles, events, err := runMultiLanguage(t, translation.NewStubTranslator(&translation.StubTranslatorConfig{}), "fr", "es")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(subtitles) != 2 || subtitles["es"] == 0 || subtitles["es"] != subtitles["fr"] {
+		t.Fatalf("expected the same subtitles for es and fr, got %v", subtitles)
+	}
+
+	completed := make(map[string]bool)
+	for _, event := range events {
+		if event.State == "completed" && event.Language != "" {
+			completed[event.Stage+"/"+event.Language] = true
+		}
+		if event.State == "running" && event.Stage == "asr" && event.Language != "" {
+			t.Fatalf("shared stages must not be tagged with a language: %+v", event)
+		}
+	}
+	for _, key := range []string{"translation/es", "translation/fr", "output/es", "output/fr"} {
+		if !completed[key] {
+			t.Fatalf("expected %s to complete, got %+v", key, events)
+		}
+	}
+
+	last := events[len(events)-1]
+	if last.Stage != "output" || last.State != "completed" || last.Language != "" || !strings.Contains(last.Detail, "Generated "+itoa(2*subtitles["es"])) {
+		t.Fatalf("expected an aggregated output completion, got %+v", last)
+	}
+}
+
+func TestStreamingRunnerKeepsOtherLanguagesWhenBranchFails(t *testing.T) {
+	t.Parallel()
+
+	translator := &languageFailingTranslator{StubTranslator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}), failing: map[string]bool{"fr": true}}
+	subtitles, events, err := runMultiLanguage(t, translator, "fr")
+	if err != nil {
+		t.Fatalf("expected the run to survive a failed branch, got %v", err)
+	}
+	if subtitles["es"] == 0 || subtitles["fr"] != 0 {
+		t.Fatalf("expected only es subtitles, got %v", subtitles)
+	}
+
+	var branchFailures int
+	for _, event := range events {
+		if event.State != "failed" {
+			continue
+		}
+		if event.Stage != "translation" || event.Language != "fr" || event.Code != statuspkg.CodeTranslationFailed {
+			t.Fatalf("unexpected failure event: %+v", event)
+		}
+		branchFailures++
+	}
+	if branchFailures != 1 {
+		t.Fatalf("expected one branch failure, got %d in %+v", branchFailures, events)
+	}
+	for _, event := range events {
+		if event.Stage == "translation" && event.State == "completed" && event.Language == "" && event.Detail != "Translated to es; failed: fr" {
+			t.Fatalf("unexpected translation summary: %q", event.Detail)
+		}
+	}
+}
+
+func TestStreamingRunnerFailsWhenEveryBranchFails(t *testing.T) {
+	t.Parallel()
+
+	translator := &languageFailingTranslator{StubTranslator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}), failing: map[string]bool{"es": true, "fr": true}}
+	_, events, err := runMultiLanguage(t, translator, "fr")
+	if err == nil {
+		t.Fatal("expected the run to fail once every branch failed")
+	}
+
+	var failed []string
+	for _, event := range events {
+		if event.State == "failed" {
+			failed = append(failed, event.Stage+"/"+event.Language)
+		}
+		if event.State == "completed" && event.Stage == "translation" {
+			t.Fatalf("unexpected completion: %+v", event)
+		}
+	}
+	if len(failed) != 2 {
+		t.Fatalf("expected a failure per branch, got %v", failed)
+	}
+}
@@ -0,0 +1,258 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	redisclient "streamlation/packages/backend/redis"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// DefaultCheckpointInterval is how often a streaming run persists its
+// position when CheckpointConfig.Interval is not set.
+const DefaultCheckpointInterval = 5 * time.Second
+
+// checkpointTTL bounds how long an abandoned checkpoint is kept in Redis.
+const checkpointTTL = 7 * 24 * time.Hour
+
+// ResumingState marks the event a run emits when it picks up from a
+// checkpoint.
+const ResumingState = "resuming"
+
+// Checkpoint records how far a session's pipeline got, so that a later run
+// of the session can resume instead of starting over.
+type Checkpoint struct {
+	SessionID string `json:"sessionId"`
+	// MediaTime is the media timestamp of the newest audio that left
+	// normalization.
+	MediaTime time.Duration `json:"mediaTime"`
+	// TranslationCursor is the media time up to which transcripts have been
+	// translated into every target language. A resumed run does not
+	// translate transcripts ending at or before it again.
+	TranslationCursor time.Duration `json:"translationCursor"`
+	// SubtitleIndex holds the index of the last subtitle emitted for each
+	// target language. A resumed run continues numbering after it.
+	SubtitleIndex map[string]int `json:"subtitleIndex,omitempty"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+}
+
+// Checkpointer persists checkpoints. Load reports whether a checkpoint
+// exists for the session.
+type Checkpointer interface {
+	Save(ctx context.Context, checkpoint Checkpoint) error
+	Load(ctx context.Context, sessionID string) (Checkpoint, bool, error)
+	Delete(ctx context.Context, sessionID string) error
+}
+
+// RedisCheckpointer stores checkpoints as JSON values in Redis.
+type RedisCheckpointer struct {
+	client *redisclient.Client
+}
+
+// NewRedisCheckpointer connects to the Redis server at addr.
+func NewRedisCheckpointer(addr string) (*RedisCheckpointer, error) {
+	client, err := redisclient.NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisCheckpointer{client: client}, nil
+}
+
+func (c *RedisCheckpointer) Save(ctx context.Context, checkpoint Checkpoint) error {
+	if checkpoint.SessionID == "" {
+		return errors.New("session id required")
+	}
+	payload, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("marshal checkpoint: %w", err)
+	}
+	if _, err := c.client.Do(ctx, "SET", checkpointKey(checkpoint.SessionID), string(payload), "EX", strconv.Itoa(int(checkpointTTL/time.Second))); err != nil {
+		return fmt.Errorf("store checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (c *RedisCheckpointer) Load(ctx context.Context, sessionID string) (Checkpoint, bool, error) {
+	reply, err := c.client.Do(ctx, "GET", checkpointKey(sessionID))
+	if err != nil {
+		return Checkpoint{}, false, fmt.Errorf("load checkpoint: %w", err)
+	}
+	if reply.IsNil {
+		return Checkpoint{}, false, nil
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal([]byte(reply.Text), &checkpoint); err != nil {
+		return Checkpoint{}, false, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	return checkpoint, true, nil
+}
+
+func (c *RedisCheckpointer) Delete(ctx context.Context, sessionID string) error {
+	if _, err := c.client.Do(ctx, "DEL", checkpointKey(sessionID)); err != nil {
+		return fmt.Errorf("delete checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (c *RedisCheckpointer) Close() error {
+	return c.client.Close()
+}
+
+func checkpointKey(sessionID string) string {
+	return "streamlation:session:" + sessionID + ":checkpoint"
+}
+
+// positionTracker follows the position of a streaming run. Stage goroutines
+// update it while Run takes snapshots to persist.
+type positionTracker struct {
+	mu         sync.Mutex
+	checkpoint Checkpoint
+	// translated holds the end of the newest translation per live branch.
+	translated map[string]time.Duration
+}
+
+// newPositionTracker starts tracking from resume, the checkpoint the run
+// resumes from, or from the beginning if it is empty.
+func newPositionTracker(sessionID string, resume Checkpoint, languages []string) *positionTracker {
+	t := &positionTracker{
+		checkpoint: Checkpoint{
+			SessionID:         sessionID,
+			MediaTime:         resume.MediaTime,
+			TranslationCursor: resume.TranslationCursor,
+			SubtitleIndex:     make(map[string]int),
+		},
+		translated: make(map[string]time.Duration, len(languages)),
+	}
+	for language, index := range resume.SubtitleIndex {
+		t.checkpoint.SubtitleIndex[language] = index
+	}
+	for _, language := range languages {
+		t.translated[language] = resume.TranslationCursor
+	}
+	return t
+}
+
+func (t *positionTracker) markMedia(mediaTime time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if mediaTime > t.checkpoint.MediaTime {
+		t.checkpoint.MediaTime = mediaTime
+	}
+}
+
+func (t *positionTracker) markTranslated(language string, end time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if current, ok := t.translated[language]; ok && end > current {
+		t.translated[language] = end
+	}
+}
+
+func (t *positionTracker) markSubtitle(language string, index int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if current, ok := t.checkpoint.SubtitleIndex[language]; !ok || index > current {
+		t.checkpoint.SubtitleIndex[language] = index
+	}
+}
+
+// track starts following a branch that joined the run. It starts at the
+// current translation cursor, since transcripts before it were not sent to
+// the branch.
+func (t *positionTracker) track(language string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	first := true
+	var cursor time.Duration
+	for _, end := range t.translated {
+		if first || end < cursor {
+			cursor, first = end, false
+		}
+	}
+	if first {
+		cursor = t.checkpoint.TranslationCursor
+	}
+	t.translated[language] = cursor
+}
+
+// forget stops waiting on a branch that failed or was removed.
+func (t *positionTracker) forget(language string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.translated, language)
+}
+
+// snapshot returns the current checkpoint. The translation cursor is that
+// of the slowest live branch.
+func (t *positionTracker) snapshot() Checkpoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	checkpoint := t.checkpoint
+	first := true
+	for _, end := range t.translated {
+		if first || end < checkpoint.TranslationCursor {
+			checkpoint.TranslationCursor = end
+			first = false
+		}
+	}
+	checkpoint.SubtitleIndex = make(map[string]int, len(t.checkpoint.SubtitleIndex))
+	for language, index := range t.checkpoint.SubtitleIndex {
+		checkpoint.SubtitleIndex[language] = index
+	}
+	checkpoint.UpdatedAt = time.Now().UTC()
+	return checkpoint
+}
+
+// checkpointWriter persists snapshots of a run's position and reports
+// failures once until a save succeeds again.
+type checkpointWriter struct {
+	store   Checkpointer
+	tracker *positionTracker
+	emit    func(statuspkg.SessionStatusEvent) error
+	failing bool
+}
+
+// save persists the current position. Failures are reported as warnings;
+// they never fail the run.
+func (w *checkpointWriter) save(ctx context.Context) {
+	w.report(w.store.Save(ctx, w.tracker.snapshot()))
+}
+
+// finish persists the final position of a run that ended with err, or
+// removes the checkpoint of a run that completed.
+func (w *checkpointWriter) finish(ctx context.Context, err error) {
+	// The run's context is usually cancelled by now.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err != nil {
+		w.save(ctx)
+		return
+	}
+	w.report(w.store.Delete(ctx, w.tracker.checkpoint.SessionID))
+}
+
+func (w *checkpointWriter) report(err error) {
+	if err == nil {
+		w.failing = false
+		return
+	}
+	if w.failing {
+		return
+	}
+	w.failing = true
+	_ = w.emit(statuspkg.SessionStatusEvent{
+		SessionID: w.tracker.checkpoint.SessionID,
+		Stage:     "pipeline",
+		State:     "checkpoint",
+		Detail:    err.Error(),
+		Code:      statuspkg.CodeCheckpointFailed,
+		Severity:  statuspkg.SeverityWarning,
+		Timestamp: time.Now().UTC(),
+	})
+}
@@ -0,0 +1,294 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// memoryCheckpointer keeps checkpoints in memory.
+type memoryCheckpointer struct {
+	mu          sync.Mutex
+	checkpoints map[string]Checkpoint
+	saves       int
+}
+
+func newMemoryCheckpointer(seed ...Checkpoint) *memoryCheckpointer {
+	c := &memoryCheckpointer{checkpoints: make(map[string]Checkpoint)}
+	for _, checkpoint := range seed {
+		c.checkpoints[checkpoint.SessionID] = checkpoint
+	}
+	return c
+}
+
+func (c *memoryCheckpointer) Save(_ context.Context, checkpoint Checkpoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkpoints[checkpoint.SessionID] = checkpoint
+	c.saves++
+	return nil
+}
+
+func (c *memoryCheckpointer) Load(_ context.Context, sessionID string) (Checkpoint, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	checkpoint, ok := c.checkpoints[sessionID]
+	return checkpoint, ok, nil
+}
+
+func (c *memoryCheckpointer) Delete(_ context.Context, sessionID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.checkpoints, sessionID)
+	return nil
+}
+
+// recordingTranslator remembers the transcripts it was asked to translate.
+type recordingTranslator struct {
+	*translation.StubTranslator
+
+	mu   sync.Mutex
+	seen []time.Duration
+}
+
+func (t *recordingTranslator) TranslateStream(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string) (<-chan translation.Translation, error) {
+	recorded := make(chan asr.Transcript)
+	go func() {
+		defer close(recorded)
+		for transcript := range transcripts {
+			t.mu.Lock()
+			t.seen = append(t.seen, transcript.EndTime)
+			t.mu.Unlock()
+			select {
+			case recorded <- transcript:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return t.StubTranslator.TranslateStream(ctx, sessionID, recorded, targetLang)
+}
+
+func newCheckpointingRunner(t *testing.T, source *stubSource, translator translation.Translator, checkpoints Checkpointer, subtitles *[]output.SubtitleEvent) *StreamingRunner {
+	t.Helper()
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return source, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translator,
+		Generator:  output.NewStubGenerator(),
+		Output: OutputConfig{
+			OnSubtitle: func(_ context.Context, event output.SubtitleEvent) error {
+				*subtitles = append(*subtitles, event)
+				return nil
+			},
+		},
+		Checkpoints: CheckpointConfig{
+			Checkpointer: checkpoints,
+			Interval:     10 * time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	return runner
+}
+
+func TestStreamingRunnerResumesFromCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	session := streamingSession()
+	checkpoints := newMemoryCheckpointer(Checkpoint{
+		SessionID:         session.ID,
+		MediaTime:         100 * time.Millisecond,
+		TranslationCursor: 100 * time.Millisecond,
+		SubtitleIndex:     map[string]int{"es": 4},
+	})
+	translator := &recordingTranslator{StubTranslator: translation.NewStubTranslator(&translation.StubTranslatorConfig{})}
+	var subtitles []output.SubtitleEvent
+	runner := newCheckpointingRunner(t, &stubSource{payloads: [][]byte{[]byte("first "), []byte("second "), []byte("third")}}, translator, checkpoints, &subtitles)
+
+	var events []statuspkg.SessionStatusEvent
+	err := runner.Run(context.Background(), session, func(event statuspkg.SessionStatusEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if events[0].Stage != "pipeline" || events[0].State != ResumingState {
+		t.Fatalf("expected the run to report resuming first, got %+v", events[0])
+	}
+	for _, end := range translator.seen {
+		if end <= 100*time.Millisecond {
+			t.Fatalf("expected transcripts up to the cursor to be skipped, translated one ending at %s", end)
+		}
+	}
+	if len(subtitles) != 2 || subtitles[0].Index != 5 || subtitles[1].Index != 6 {
+		t.Fatalf("expected subtitle numbering to continue at 5, got %+v", subtitles)
+	}
+	if subtitles[0].ID != "es-5" || subtitles[1].ID != "es-6" {
+		t.Fatalf("expected cue ids to follow the numbering, got %q and %q", subtitles[0].ID, subtitles[1].ID)
+	}
+	if _, ok, _ := checkpoints.Load(context.Background(), session.ID); ok {
+		t.Fatal("expected the checkpoint to be removed once the run completed")
+	}
+}
+
+func TestStreamingRunnerSavesCheckpointWhenRunFails(t *testing.T) {
+	t.Parallel()
+
+	session := streamingSession()
+	checkpoints := newMemoryCheckpointer()
+	translator := translation.NewStubTranslator(&translation.StubTranslatorConfig{})
+	var subtitles []output.SubtitleEvent
+	source := &stubSource{payloads: [][]byte{[]byte("first "), []byte("second ")}, hold: true}
+	runner := newCheckpointingRunner(t, source, translator, checkpoints, &subtitles)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := runner.Run(ctx, session, func(event statuspkg.SessionStatusEvent) error {
+		if event.State == "running" && event.Stage == "output" {
+			// Let the subtitles drain before stopping the run.
+			time.AfterFunc(50*time.Millisecond, cancel)
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the run to be cancelled, got %v", err)
+	}
+
+	checkpoint, ok, _ := checkpoints.Load(context.Background(), session.ID)
+	if !ok {
+		t.Fatal("expected a checkpoint to be saved")
+	}
+	if checkpoint.SubtitleIndex["es"] != len(subtitles)-1 || checkpoint.TranslationCursor != 200*time.Millisecond || checkpoint.MediaTime != 100*time.Millisecond {
+		t.Fatalf("unexpected checkpoint after %d subtitles: %+v", len(subtitles), checkpoint)
+	}
+}
+
+func TestRedisCheckpointerRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	checkpoints, err := NewRedisCheckpointer(startCheckpointServer(t))
+	if err != nil {
+		t.Fatalf("new redis checkpointer: %v", err)
+	}
+	t.Cleanup(func() { _ = checkpoints.Close() })
+
+	ctx := context.Background()
+	if _, ok, err := checkpoints.Load(ctx, "abc"); err != nil || ok {
+		t.Fatalf("expected no checkpoint, got ok=%v err=%v", ok, err)
+	}
+	want := Checkpoint{SessionID: "abc", MediaTime: time.Second, TranslationCursor: 900 * time.Millisecond, SubtitleIndex: map[string]int{"es": 3}}
+	if err := checkpoints.Save(ctx, want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	got, ok, err := checkpoints.Load(ctx, "abc")
+	if err != nil || !ok {
+		t.Fatalf("load: ok=%v err=%v", ok, err)
+	}
+	if got.MediaTime != want.MediaTime || got.TranslationCursor != want.TranslationCursor || got.SubtitleIndex["es"] != 3 {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if err := checkpoints.Delete(ctx, "abc"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok, _ := checkpoints.Load(ctx, "abc"); ok {
+		t.Fatal("expected the checkpoint to be deleted")
+	}
+}
+
+// startCheckpointServer runs a minimal Redis server supporting GET, SET, and
+// DEL.
+func startCheckpointServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var mu sync.Mutex
+	values := make(map[string]string)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				writer := bufio.NewWriter(conn)
+				for {
+					args, err := readRESPCommand(reader)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					switch strings.ToUpper(args[0]) {
+					case "GET":
+						if value, ok := values[args[1]]; ok {
+							writer.WriteString("$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n")
+						} else {
+							writer.WriteString("$-1\r\n")
+						}
+					case "SET":
+						values[args[1]] = args[2]
+						writer.WriteString("+OK\r\n")
+					case "DEL":
+						delete(values, args[1])
+						writer.WriteString(":1\r\n")
+					default:
+						writer.WriteString("-ERR unknown command\r\n")
+					}
+					mu.Unlock()
+					if err := writer.Flush(); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		value, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(value, "\r\n")
+	}
+	return args, nil
+}
@@ -0,0 +1,349 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// Variants of a compared stage. Outputs handed to ComparisonConfig.OnVariant
+// carry one of them.
+const (
+	PrimaryVariant   = "primary"
+	CandidateVariant = "candidate"
+)
+
+// DefaultComparisonInterval is how often a run with candidates reports its
+// comparisons when ComparisonConfig.Interval is not set.
+const DefaultComparisonInterval = time.Minute
+
+// comparisonWindow bounds the arrivals and outputs a comparison keeps while
+// waiting for the other variant to catch up.
+const comparisonWindow = 1024
+
+// Candidates are alternative stage implementations evaluated on live
+// traffic. A candidate receives the same input as the primary implementation
+// of its stage, but its output only feeds the comparison and never reaches
+// the later stages.
+type Candidates struct {
+	Recognizer asr.Recognizer
+	Translator translation.Translator
+}
+
+// VariantOutput is an output of a compared stage, tagged with the variant
+// that produced it. Exactly one of Transcript and Translation is set.
+type VariantOutput struct {
+	SessionID string
+	Stage     string
+	Variant   string
+	// Language is the target language of a translation branch. It is empty
+	// for transcripts.
+	Language    string
+	Transcript  *asr.Transcript
+	Translation *translation.Translation
+}
+
+// comparedOutput is the part of a stage output a comparison looks at.
+type comparedOutput struct {
+	text       string
+	start, end time.Duration
+	confidence float64
+}
+
+func transcriptOutput(transcript asr.Transcript) (comparedOutput, bool) {
+	return comparedOutput{text: transcript.Text, start: transcript.StartTime, end: transcript.EndTime, confidence: transcript.Confidence}, !transcript.Partial
+}
+
+func translationOutput(translated translation.Translation) (comparedOutput, bool) {
+	return comparedOutput{text: translated.TranslatedText, start: translated.StartTime, end: translated.EndTime, confidence: translated.Confidence}, !translated.Partial
+}
+
+// arrival records when the input ending at a media time reached a compared
+// stage.
+type arrival struct {
+	end time.Duration
+	at  time.Time
+}
+
+// variantTally accumulates the final outputs of one variant.
+type variantTally struct {
+	outputs    int64
+	latency    time.Duration
+	timed      int64
+	confidence float64
+	dropped    int64
+	err        error
+	// latest is the end of the newest output.
+	latest time.Duration
+	// pending holds outputs not yet compared.
+	pending []comparedOutput
+}
+
+func (t *variantTally) stats() statuspkg.VariantStats {
+	stats := statuspkg.VariantStats{Outputs: t.outputs, Dropped: t.dropped}
+	if t.timed > 0 {
+		stats.MeanLatencyMs = (t.latency / time.Duration(t.timed)).Milliseconds()
+	}
+	if t.outputs > 0 {
+		stats.MeanConfidence = t.confidence / float64(t.outputs)
+	}
+	if t.err != nil {
+		stats.Error = t.err.Error()
+	}
+	return stats
+}
+
+// comparison measures a candidate implementation of one stage against the
+// primary one. A nil *comparison records nothing.
+type comparison struct {
+	stage string
+	// language is set on the comparisons of translation branches.
+	language string
+
+	mu        sync.Mutex
+	arrivals  []arrival
+	primary   variantTally
+	candidate variantTally
+	agreement float64
+	compared  int64
+}
+
+func newComparison(stage, language string) *comparison {
+	return &comparison{stage: stage, language: language}
+}
+
+// arrived records that the input ending at end reached the stage.
+func (c *comparison) arrived(end time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := len(c.arrivals); n > 0 && end <= c.arrivals[n-1].end {
+		return
+	}
+	c.arrivals = append(c.arrivals, arrival{end: end, at: time.Now()})
+	if len(c.arrivals) > comparisonWindow {
+		c.arrivals = c.arrivals[len(c.arrivals)-comparisonWindow:]
+	}
+}
+
+func (c *comparison) tally(variant string) *variantTally {
+	if variant == CandidateVariant {
+		return &c.candidate
+	}
+	return &c.primary
+}
+
+// record counts a final output of variant and compares the outputs both
+// variants have produced up to the same media time.
+func (c *comparison) record(variant string, output comparedOutput) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tally := c.tally(variant)
+	tally.outputs++
+	tally.confidence += output.confidence
+	for _, arrival := range c.arrivals {
+		if arrival.end >= output.end {
+			tally.latency += time.Since(arrival.at)
+			tally.timed++
+			break
+		}
+	}
+	if output.end > tally.latest {
+		tally.latest = output.end
+	}
+	tally.pending = append(tally.pending, output)
+	if len(tally.pending) > comparisonWindow {
+		tally.pending = tally.pending[len(tally.pending)-comparisonWindow:]
+	}
+	c.compare()
+}
+
+// compare scores the candidate outputs that end before both variants'
+// newest output against the primary outputs overlapping them, then forgets
+// what no later output can overlap. The caller must hold c.mu.
+func (c *comparison) compare() {
+	watermark := min(c.primary.latest, c.candidate.latest)
+	remaining := c.candidate.pending[:0]
+	for _, output := range c.candidate.pending {
+		if output.end > watermark {
+			remaining = append(remaining, output)
+			continue
+		}
+		var overlapping []string
+		for _, primary := range c.primary.pending {
+			if primary.start < output.end && primary.end > output.start {
+				overlapping = append(overlapping, primary.text)
+			}
+		}
+		c.agreement += similarity(strings.Join(overlapping, " "), output.text)
+		c.compared++
+	}
+	c.candidate.pending = remaining
+
+	horizon := watermark
+	for _, output := range remaining {
+		horizon = min(horizon, output.start)
+	}
+	kept := c.primary.pending[:0]
+	for _, output := range c.primary.pending {
+		if output.end > horizon {
+			kept = append(kept, output)
+		}
+	}
+	c.primary.pending = kept
+
+	expired := 0
+	for expired < len(c.arrivals) && c.arrivals[expired].end < watermark {
+		expired++
+	}
+	c.arrivals = c.arrivals[expired:]
+}
+
+// dropped counts inputs the candidate missed while it was running.
+func (c *comparison) dropped(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.candidate.err == nil {
+		c.candidate.dropped += n
+	}
+}
+
+// failed records that the candidate stopped with err.
+func (c *comparison) failed(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.candidate.err = err
+}
+
+// event returns a comparison event carrying the results so far.
+func (c *comparison) event(sessionID string) statuspkg.SessionStatusEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := statuspkg.Comparison{
+		Primary:   c.primary.stats(),
+		Candidate: c.candidate.stats(),
+		Compared:  c.compared,
+	}
+	if c.compared > 0 {
+		result.Agreement = c.agreement / float64(c.compared)
+	}
+	detail := fmt.Sprintf("Candidate agreed %.0f%% with primary over %d outputs; mean latency %dms (primary %dms)",
+		100*result.Agreement, result.Compared, result.Candidate.MeanLatencyMs, result.Primary.MeanLatencyMs)
+	if result.Candidate.Error != "" {
+		detail = "Candidate failed: " + result.Candidate.Error
+	}
+	return statuspkg.SessionStatusEvent{
+		SessionID:  sessionID,
+		Stage:      c.stage,
+		State:      statuspkg.ComparisonState,
+		Detail:     detail,
+		Language:   c.language,
+		Timestamp:  time.Now().UTC(),
+		Comparison: &result,
+	}
+}
+
+// similarity scores how closely candidate matches reference word by word,
+// from 0 for nothing in common to 1 for the same words, ignoring case.
+func similarity(reference, candidate string) float64 {
+	a, b := strings.Fields(strings.ToLower(reference)), strings.Fields(strings.ToLower(candidate))
+	longest := max(len(a), len(b))
+	if longest == 0 {
+		return 1
+	}
+	// Word-level edit distance, keeping one row of the table.
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			diagonal, row[j] = row[j], min(row[j]+1, row[j-1]+1, diagonal+cost)
+		}
+	}
+	return 1 - float64(row[len(b)])/float64(longest)
+}
+
+// teeCandidate forwards in to the first returned channel and copies every
+// item to the second without blocking. Copies the candidate is not ready
+// for are dropped and counted, so a slow candidate never holds back the
+// primary. end gives the media time an item ends at.
+func teeCandidate[T any](ctx context.Context, run *streamRun, compared *comparison, in <-chan T, end func(T) time.Duration) (<-chan T, <-chan T) {
+	primary := make(chan T, run.bufferSize)
+	candidate := make(chan T, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(primary)
+		defer close(candidate)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case item, ok := <-in:
+				if !ok {
+					return
+				}
+				compared.arrived(end(item))
+				select {
+				case candidate <- item:
+				default:
+					compared.dropped(1)
+				}
+				select {
+				case primary <- item:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return primary, candidate
+}
+
+// runCandidate starts the candidate implementation on in and records its
+// outputs. A candidate that fails is reported once as a warning and
+// stops; the run carries on.
+func runCandidate[In, Out any](ctx context.Context, run *streamRun, compared *comparison, in <-chan In, start startFunc[In, Out], observe func(Out)) {
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		outputs, err := start(ctx, in)
+		if err != nil {
+			compared.failed(err)
+			event := compared.event(run.sessionID)
+			event.Severity = statuspkg.SeverityWarning
+			event.Code = statuspkg.CodeCandidateFailed
+			run.notify(ctx, event)
+			return
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case output, ok := <-outputs:
+				if !ok {
+					return
+				}
+				observe(output)
+			}
+		}
+	}()
+}
@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// unavailableTranslator fails to start.
+type unavailableTranslator struct {
+	*translation.StubTranslator
+}
+
+func (unavailableTranslator) TranslateStream(context.Context, string, <-chan asr.Transcript, string) (<-chan translation.Translation, error) {
+	return nil, errors.New("model endpoint unreachable")
+}
+
+func TestSimilarity(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		reference, candidate string
+		want                 float64
+	}{
+		{"", "", 1},
+		{"hello world", "Hello  world", 1},
+		{"hello world", "", 0},
+		{"the quick brown fox", "the quick red fox", 0.75},
+		{"one two", "one two three four", 0.5},
+	} {
+		if got := similarity(tc.reference, tc.candidate); math.Abs(got-tc.want) > 1e-9 {
+			t.Fatalf("similarity(%q, %q) = %v, want %v", tc.reference, tc.candidate, got, tc.want)
+		}
+	}
+}
+
+func TestComparisonWaitsForBothVariants(t *testing.T) {
+	t.Parallel()
+
+	compared := newComparison("asr", "")
+	compared.arrived(time.Second)
+	compared.arrived(2 * time.Second)
+	compared.record(CandidateVariant, comparedOutput{text: "hello there", end: time.Second, confidence: 0.5})
+	compared.record(CandidateVariant, comparedOutput{text: "general kenobi", start: time.Second, end: 2 * time.Second, confidence: 0.7})
+	if event := compared.event("session"); event.Comparison.Compared != 0 {
+		t.Fatalf("expected nothing to be compared before the primary caught up, got %+v", event.Comparison)
+	}
+
+	// The primary splits the media differently; the candidate's first output
+	// is scored against both primary outputs overlapping it.
+	compared.record(PrimaryVariant, comparedOutput{text: "hello", end: 500 * time.Millisecond, confidence: 0.9})
+	compared.record(PrimaryVariant, comparedOutput{text: "there", start: 500 * time.Millisecond, end: time.Second, confidence: 0.9})
+	event := compared.event("session")
+	result := event.Comparison
+	if result.Compared != 1 || result.Agreement != 1 {
+		t.Fatalf("expected one matching comparison, got %+v", result)
+	}
+	if result.Primary.Outputs != 2 || result.Candidate.Outputs != 2 || math.Abs(result.Candidate.MeanConfidence-0.6) > 1e-9 {
+		t.Fatalf("unexpected variant stats %+v", result)
+	}
+	if event.Stage != "asr" || event.State != statuspkg.ComparisonState || event.SessionID != "session" {
+		t.Fatalf("unexpected comparison event %+v", event)
+	}
+}
+
+func newComparingRunner(t *testing.T, candidates Candidates, variants *[]VariantOutput, subtitles *int) *StreamingRunner {
+	t.Helper()
+	var mu sync.Mutex
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second "), []byte("third")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		Comparison: ComparisonConfig{
+			Candidates: candidates,
+			OnVariant: func(_ context.Context, output VariantOutput) {
+				mu.Lock()
+				defer mu.Unlock()
+				*variants = append(*variants, output)
+			},
+		},
+		Output: OutputConfig{
+			OnSubtitle: func(context.Context, output.SubtitleEvent) error {
+				*subtitles++
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	return runner
+}
+
+func TestStreamingRunnerComparesCandidates(t *testing.T) {
+	t.Parallel()
+
+	var (
+		variants  []VariantOutput
+		subtitles int
+	)
+	runner := newComparingRunner(t, Candidates{
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{Transcripts: map[int]string{1: "Chunk 1 misheard."}}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+	}, &variants, &subtitles)
+
+	comparisons := make(map[string]*statuspkg.Comparison)
+	err := runner.Run(context.Background(), streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		if event.State == statuspkg.ComparisonState {
+			comparisons[event.Stage] = event.Comparison
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if subtitles != 3 {
+		t.Fatalf("expected the candidates not to affect the subtitles, got %d", subtitles)
+	}
+	counts := make(map[string]int)
+	for _, variant := range variants {
+		if variant.SessionID != "stream-session" {
+			t.Fatalf("unexpected variant output %+v", variant)
+		}
+		counts[variant.Stage+"/"+variant.Variant]++
+	}
+	for _, key := range []string{"asr/primary", "asr/candidate", "translation/primary", "translation/candidate"} {
+		if counts[key] != 3 {
+			t.Fatalf("expected 3 %s outputs, got %v", key, counts)
+		}
+	}
+
+	recognition := comparisons["asr"]
+	if recognition == nil || recognition.Compared != 3 || math.Abs(recognition.Agreement-(1+2.0/3+1)/3) > 1e-9 {
+		t.Fatalf("unexpected asr comparison %+v", recognition)
+	}
+	if translated := comparisons["translation"]; translated == nil || translated.Compared != 3 || translated.Agreement != 1 {
+		t.Fatalf("unexpected translation comparison %+v", translated)
+	}
+}
+
+func TestStreamingRunnerSurvivesFailingCandidate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		variants  []VariantOutput
+		subtitles int
+	)
+	runner := newComparingRunner(t, Candidates{
+		Translator: unavailableTranslator{translation.NewStubTranslator(nil)},
+	}, &variants, &subtitles)
+
+	var warnings []statuspkg.SessionStatusEvent
+	err := runner.Run(context.Background(), streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		if event.Code == statuspkg.CodeCandidateFailed {
+			warnings = append(warnings, event)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected a failing candidate not to fail the run, got %v", err)
+	}
+	if subtitles != 3 {
+		t.Fatalf("expected every subtitle, got %d", subtitles)
+	}
+	if len(warnings) != 1 || warnings[0].Severity != statuspkg.SeverityWarning || warnings[0].Comparison.Candidate.Error == "" {
+		t.Fatalf("expected a single candidate warning, got %+v", warnings)
+	}
+}
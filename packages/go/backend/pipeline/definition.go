@@ -0,0 +1,404 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+// Definition declares the stage graph of streaming runs: the implementation,
+// policy, and options of each configurable stage and the size of the
+// buffers between stages. Operators load it from a JSON document so that
+// pipelines can be tuned without recompiling.
+//
+// Profiles override the definition for sessions whose model profile they
+// name. Only the fields a profile sets are overridden.
+type Definition struct {
+	BufferSize int                        `json:"bufferSize,omitempty"`
+	Stages     map[string]StageDefinition `json:"stages,omitempty"`
+	Profiles   map[string]Definition      `json:"profiles,omitempty"`
+}
+
+// StageDefinition configures one stage. Zero fields inherit the value of
+// the definition being overridden.
+type StageDefinition struct {
+	// Implementation names the registered implementation of the stage.
+	Implementation string
+	Policy         StagePolicy
+	// Options are handed to the implementation's factory.
+	Options map[string]string
+	// Candidate names an implementation to run alongside Implementation on
+	// the same input and compare it with. Only the asr and translation
+	// stages accept one. CandidateOptions are handed to its factory.
+	Candidate        string
+	CandidateOptions map[string]string
+	// Fallback names an implementation that translates again the
+	// translations whose estimated quality falls below FallbackThreshold,
+	// or translation.DefaultQualityThreshold when it is zero. Only the
+	// translation stage accepts one. FallbackOptions are handed to its
+	// factory.
+	Fallback          string
+	FallbackOptions   map[string]string
+	FallbackThreshold float64
+}
+
+// comparableStages lists the stages that accept a candidate implementation.
+var comparableStages = []string{"asr", "translation"}
+
+// stageDefinitionJSON is the document form of a StageDefinition, with
+// durations written as Go duration strings such as "30s".
+type stageDefinitionJSON struct {
+	Implementation    string            `json:"implementation,omitempty"`
+	Timeout           string            `json:"timeout,omitempty"`
+	Retries           int               `json:"retries,omitempty"`
+	FailureRetries    int               `json:"failureRetries,omitempty"`
+	RetryBackoff      string            `json:"retryBackoff,omitempty"`
+	MaxRetryBackoff   string            `json:"maxRetryBackoff,omitempty"`
+	Capacity          int               `json:"capacity,omitempty"`
+	Drop              string            `json:"drop,omitempty"`
+	Options           map[string]string `json:"options,omitempty"`
+	Candidate         string            `json:"candidate,omitempty"`
+	CandidateOptions  map[string]string `json:"candidateOptions,omitempty"`
+	Fallback          string            `json:"fallback,omitempty"`
+	FallbackOptions   map[string]string `json:"fallbackOptions,omitempty"`
+	FallbackThreshold float64           `json:"fallbackThreshold,omitempty"`
+}
+
+func (s *StageDefinition) UnmarshalJSON(data []byte) error {
+	var raw stageDefinitionJSON
+	if err := decodeStrict(data, &raw); err != nil {
+		return err
+	}
+
+	definition := StageDefinition{
+		Implementation: raw.Implementation,
+		Policy: StagePolicy{
+			Retries:  raw.Retries,
+			Retry:    RetryPolicy{Attempts: raw.FailureRetries},
+			Capacity: raw.Capacity,
+		},
+		Options:           raw.Options,
+		Candidate:         raw.Candidate,
+		CandidateOptions:  raw.CandidateOptions,
+		Fallback:          raw.Fallback,
+		FallbackOptions:   raw.FallbackOptions,
+		FallbackThreshold: raw.FallbackThreshold,
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+		into  *time.Duration
+	}{
+		{"timeout", raw.Timeout, &definition.Policy.Timeout},
+		{"retryBackoff", raw.RetryBackoff, &definition.Policy.Retry.Backoff},
+		{"maxRetryBackoff", raw.MaxRetryBackoff, &definition.Policy.Retry.MaxBackoff},
+	} {
+		if field.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(field.value)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", field.name, err)
+		}
+		*field.into = duration
+	}
+	if raw.Drop != "" {
+		drop, err := ParseDropPolicy(raw.Drop)
+		if err != nil {
+			return err
+		}
+		definition.Policy.Drop = drop
+	}
+	*s = definition
+	return nil
+}
+
+func (s StageDefinition) MarshalJSON() ([]byte, error) {
+	raw := stageDefinitionJSON{
+		Implementation:    s.Implementation,
+		Retries:           s.Policy.Retries,
+		FailureRetries:    s.Policy.Retry.Attempts,
+		Capacity:          s.Policy.Capacity,
+		Drop:              string(s.Policy.Drop),
+		Options:           s.Options,
+		Candidate:         s.Candidate,
+		CandidateOptions:  s.CandidateOptions,
+		Fallback:          s.Fallback,
+		FallbackOptions:   s.FallbackOptions,
+		FallbackThreshold: s.FallbackThreshold,
+	}
+	if s.Policy.Timeout > 0 {
+		raw.Timeout = s.Policy.Timeout.String()
+	}
+	if s.Policy.Retry.Backoff > 0 {
+		raw.RetryBackoff = s.Policy.Retry.Backoff.String()
+	}
+	if s.Policy.Retry.MaxBackoff > 0 {
+		raw.MaxRetryBackoff = s.Policy.Retry.MaxBackoff.String()
+	}
+	return json.Marshal(raw)
+}
+
+// LoadDefinition reads the definition document at path.
+func LoadDefinition(path string) (Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Definition{}, fmt.Errorf("read pipeline definition: %w", err)
+	}
+	return ParseDefinition(data)
+}
+
+// ParseDefinition decodes a definition document. Unknown fields are
+// rejected so that misspelt settings do not go unnoticed.
+func ParseDefinition(data []byte) (Definition, error) {
+	var definition Definition
+	if err := decodeStrict(data, &definition); err != nil {
+		return Definition{}, fmt.Errorf("decode pipeline definition: %w", err)
+	}
+	return definition, nil
+}
+
+func decodeStrict(data []byte, into any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(into)
+}
+
+// Override returns d with the buffer size, stages, and profiles that o sets
+// applied on top.
+func (d Definition) Override(o Definition) Definition {
+	merged := Definition{BufferSize: d.BufferSize}
+	if o.BufferSize > 0 {
+		merged.BufferSize = o.BufferSize
+	}
+	if len(d.Stages)+len(o.Stages) > 0 {
+		merged.Stages = make(map[string]StageDefinition, len(d.Stages)+len(o.Stages))
+		for stage, definition := range d.Stages {
+			merged.Stages[stage] = definition
+		}
+		for stage, definition := range o.Stages {
+			merged.Stages[stage] = merged.Stages[stage].override(definition)
+		}
+	}
+	if len(d.Profiles)+len(o.Profiles) > 0 {
+		merged.Profiles = make(map[string]Definition, len(d.Profiles)+len(o.Profiles))
+		for name, profile := range d.Profiles {
+			merged.Profiles[name] = profile
+		}
+		for name, profile := range o.Profiles {
+			merged.Profiles[name] = merged.Profiles[name].Override(profile)
+		}
+	}
+	return merged
+}
+
+func (s StageDefinition) override(o StageDefinition) StageDefinition {
+	if o.Implementation != "" {
+		s.Implementation = o.Implementation
+	}
+	if o.Policy.Timeout > 0 {
+		s.Policy.Timeout = o.Policy.Timeout
+	}
+	if o.Policy.Retries > 0 {
+		s.Policy.Retries = o.Policy.Retries
+	}
+	if o.Policy.Retry.Attempts > 0 {
+		s.Policy.Retry.Attempts = o.Policy.Retry.Attempts
+	}
+	if o.Policy.Retry.Backoff > 0 {
+		s.Policy.Retry.Backoff = o.Policy.Retry.Backoff
+	}
+	if o.Policy.Retry.MaxBackoff > 0 {
+		s.Policy.Retry.MaxBackoff = o.Policy.Retry.MaxBackoff
+	}
+	if o.Policy.Capacity > 0 {
+		s.Policy.Capacity = o.Policy.Capacity
+	}
+	if o.Policy.Drop != "" {
+		s.Policy.Drop = o.Policy.Drop
+	}
+	s.Options = mergeOptions(s.Options, o.Options)
+	if o.Candidate != "" {
+		s.Candidate = o.Candidate
+	}
+	s.CandidateOptions = mergeOptions(s.CandidateOptions, o.CandidateOptions)
+	if o.Fallback != "" {
+		s.Fallback = o.Fallback
+	}
+	s.FallbackOptions = mergeOptions(s.FallbackOptions, o.FallbackOptions)
+	if o.FallbackThreshold > 0 {
+		s.FallbackThreshold = o.FallbackThreshold
+	}
+	return s
+}
+
+// mergeOptions returns base with the options override sets applied on top.
+func mergeOptions(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+	options := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		options[key] = value
+	}
+	for key, value := range override {
+		options[key] = value
+	}
+	return options
+}
+
+// Profile returns the definition that applies to sessions using the named
+// model profile: d with the matching profile, if any, applied on top.
+func (d Definition) Profile(name string) Definition {
+	resolved := Definition{BufferSize: d.BufferSize, Stages: d.Stages}
+	if profile, ok := d.Profiles[name]; ok && name != "" {
+		resolved = resolved.Override(Definition{BufferSize: profile.BufferSize, Stages: profile.Stages})
+	}
+	return resolved
+}
+
+// Selection returns the implementation the definition names for each stage.
+func (d Definition) Selection() map[string]string {
+	selection := make(map[string]string, len(d.Stages))
+	for stage, definition := range d.Stages {
+		if definition.Implementation != "" {
+			selection[stage] = definition.Implementation
+		}
+	}
+	return selection
+}
+
+// sessionSelection returns the implementation chosen for each stage of
+// session: that of the session's model profile, overridden stage by stage
+// by the session's Options.Stages.
+func (d Definition) sessionSelection(session sessionpkg.TranslationSession) map[string]string {
+	selection := d.Profile(session.Options.ModelProfile).Selection()
+	for stage, name := range session.Options.Stages {
+		if name != "" {
+			selection[stage] = name
+		}
+	}
+	return selection
+}
+
+// Policies returns the policy the definition sets for each stage.
+func (d Definition) Policies() map[string]StagePolicy {
+	policies := make(map[string]StagePolicy, len(d.Stages))
+	for stage, definition := range d.Stages {
+		policies[stage] = definition.Policy
+	}
+	return policies
+}
+
+// Options returns the options the definition sets for each stage.
+func (d Definition) Options() map[string]map[string]string {
+	options := make(map[string]map[string]string, len(d.Stages))
+	for stage, definition := range d.Stages {
+		if len(definition.Options) > 0 {
+			options[stage] = definition.Options
+		}
+	}
+	return options
+}
+
+// Candidates returns the candidate implementation the definition names for
+// each stage that has one.
+func (d Definition) Candidates() map[string]string {
+	candidates := make(map[string]string)
+	for stage, definition := range d.Stages {
+		if definition.Candidate != "" {
+			candidates[stage] = definition.Candidate
+		}
+	}
+	return candidates
+}
+
+// CandidateOptions returns the options the definition sets for each stage's
+// candidate.
+func (d Definition) CandidateOptions() map[string]map[string]string {
+	options := make(map[string]map[string]string)
+	for stage, definition := range d.Stages {
+		if len(definition.CandidateOptions) > 0 {
+			options[stage] = definition.CandidateOptions
+		}
+	}
+	return options
+}
+
+// Fallbacks returns the fallback implementation the definition names for
+// each stage that has one.
+func (d Definition) Fallbacks() map[string]string {
+	fallbacks := make(map[string]string)
+	for stage, definition := range d.Stages {
+		if definition.Fallback != "" {
+			fallbacks[stage] = definition.Fallback
+		}
+	}
+	return fallbacks
+}
+
+// Validate reports an error if the definition, or one of its profiles,
+// configures an unknown stage, names an implementation registry does not
+// know, or sets a negative size or count. The definition itself must select
+// an implementation for every configurable stage.
+func (d Definition) Validate(registry *Registry) error {
+	if err := d.validate(registry); err != nil {
+		return err
+	}
+	for _, stage := range ConfigurableStages {
+		if d.Stages[stage].Implementation == "" {
+			return fmt.Errorf("no implementation for %s", stage)
+		}
+	}
+	for name, profile := range d.Profiles {
+		if name == "" {
+			return errors.New("profile name required")
+		}
+		if len(profile.Profiles) > 0 {
+			return fmt.Errorf("profile %q: profiles cannot be nested", name)
+		}
+		if err := profile.validate(registry); err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (d Definition) validate(registry *Registry) error {
+	if d.BufferSize < 0 {
+		return fmt.Errorf("invalid buffer size %d", d.BufferSize)
+	}
+	if err := registry.Validate(d.Selection()); err != nil {
+		return err
+	}
+	if err := registry.Validate(d.Candidates()); err != nil {
+		return fmt.Errorf("candidate: %w", err)
+	}
+	if err := registry.Validate(d.Fallbacks()); err != nil {
+		return fmt.Errorf("fallback: %w", err)
+	}
+	for stage, definition := range d.Stages {
+		if !isConfigurableStage(stage) {
+			return fmt.Errorf("stage %q is not configurable", stage)
+		}
+		if definition.Candidate != "" && !contains(comparableStages, stage) {
+			return fmt.Errorf("stage %s does not accept a candidate", stage)
+		}
+		if (definition.Fallback != "" || definition.FallbackThreshold != 0) && stage != "translation" {
+			return fmt.Errorf("stage %s does not accept a fallback", stage)
+		}
+		if definition.FallbackThreshold < 0 || definition.FallbackThreshold > 1 {
+			return fmt.Errorf("invalid %s fallback threshold %g: want 0 to 1", stage, definition.FallbackThreshold)
+		}
+		policy := definition.Policy
+		if policy.Timeout < 0 || policy.Retries < 0 || policy.Retry.Attempts < 0 || policy.Retry.Backoff < 0 || policy.Retry.MaxBackoff < 0 || policy.Capacity < 0 {
+			return fmt.Errorf("invalid %s policy: negative value", stage)
+		}
+	}
+	return nil
+}
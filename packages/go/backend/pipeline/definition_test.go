@@ -0,0 +1,194 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/media"
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+const testDefinition = `{
+	"bufferSize": 8,
+	"stages": {
+		"normalization": {"implementation": "stub"},
+		"asr": {"implementation": "stub", "timeout": "30s", "retries": 2, "capacity": 64},
+		"translation": {"implementation": "stub", "failureRetries": 3, "retryBackoff": "500ms", "candidate": "stub", "candidateOptions": {"model": "next"}, "fallback": "stub", "fallbackThreshold": 0.7},
+		"output": {"implementation": "stub"},
+		"dubbing": {"implementation": "stub"}
+	},
+	"profiles": {
+		"low-latency": {
+			"bufferSize": 2,
+			"stages": {"asr": {"capacity": 4, "drop": "drop-oldest"}}
+		}
+	}
+}`
+
+func TestParseDefinition(t *testing.T) {
+	t.Parallel()
+
+	definition, err := ParseDefinition([]byte(testDefinition))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := definition.Validate(newStubRegistry(t)); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	want := StagePolicy{Timeout: 30 * time.Second, Retries: 2, Capacity: 64}
+	if got := definition.Stages["asr"].Policy; got != want {
+		t.Fatalf("expected asr policy %+v, got %+v", want, got)
+	}
+	if got := definition.Stages["translation"].Policy.Retry; got != (RetryPolicy{Attempts: 3, Backoff: 500 * time.Millisecond}) {
+		t.Fatalf("unexpected translation retry policy %+v", got)
+	}
+	if got := definition.Candidates(); !reflect.DeepEqual(got, map[string]string{"translation": "stub"}) {
+		t.Fatalf("unexpected candidates %v", got)
+	}
+	if got := definition.Fallbacks(); !reflect.DeepEqual(got, map[string]string{"translation": "stub"}) || definition.Stages["translation"].FallbackThreshold != 0.7 {
+		t.Fatalf("unexpected fallbacks %v", got)
+	}
+
+	encoded, err := json.Marshal(definition)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	decoded, err := ParseDefinition(encoded)
+	if err != nil {
+		t.Fatalf("parse encoded definition: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, definition) {
+		t.Fatalf("expected definition to survive a round trip, got %+v", decoded)
+	}
+}
+
+func TestParseDefinitionRejectsInvalidDocuments(t *testing.T) {
+	t.Parallel()
+
+	for _, document := range []string{
+		`{"stages": {"asr": {"timeout": "soon"}}}`,
+		`{"stages": {"asr": {"drop": "drop-all"}}}`,
+		`{"stages": {"asr": {"implementation": "stub", "timeuot": "1s"}}}`,
+		`{"bufferSize": 4, "workers": 2}`,
+	} {
+		if _, err := ParseDefinition([]byte(document)); err == nil {
+			t.Fatalf("expected %s to be rejected", document)
+		}
+	}
+}
+
+func TestDefinitionValidate(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	for name, tc := range map[string]struct {
+		change func(definition *Definition)
+		want   string
+	}{
+		"unknown implementation": {func(d *Definition) { d.Stages["asr"] = StageDefinition{Implementation: "whisper"} }, "registered: stub"},
+		"unknown stage":          {func(d *Definition) { d.Stages["media"] = StageDefinition{} }, "not configurable"},
+		"negative capacity": {func(d *Definition) {
+			d.Stages["asr"] = StageDefinition{Implementation: "stub", Policy: StagePolicy{Capacity: -1}}
+		}, "negative"},
+		"unknown candidate":    {func(d *Definition) { d.Stages["asr"] = StageDefinition{Implementation: "stub", Candidate: "whisper"} }, "candidate"},
+		"candidate for output": {func(d *Definition) { d.Stages["output"] = StageDefinition{Implementation: "stub", Candidate: "stub"} }, "does not accept a candidate"},
+		"unknown fallback": {func(d *Definition) {
+			d.Stages["translation"] = StageDefinition{Implementation: "stub", Fallback: "deepl"}
+		}, "fallback"},
+		"fallback for asr": {func(d *Definition) { d.Stages["asr"] = StageDefinition{Implementation: "stub", Fallback: "stub"} }, "does not accept a fallback"},
+		"fallback threshold": {func(d *Definition) {
+			d.Stages["translation"] = StageDefinition{Implementation: "stub", Fallback: "stub", FallbackThreshold: 1.5}
+		}, "fallback threshold"},
+		"profile implementation": {func(d *Definition) {
+			d.Profiles["fast"] = Definition{Stages: map[string]StageDefinition{"asr": {Implementation: "whisper"}}}
+		}, `profile "fast"`},
+	} {
+		definition, err := ParseDefinition([]byte(testDefinition))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		tc.change(&definition)
+		err = definition.Validate(registry)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected error containing %q, got %v", name, tc.want, err)
+		}
+	}
+
+	if err := (Definition{Stages: map[string]StageDefinition{"asr": {Implementation: "stub"}}}).Validate(registry); err == nil {
+		t.Fatal("expected a definition without every stage to be rejected")
+	}
+}
+
+func TestDefinitionProfileOverridesStages(t *testing.T) {
+	t.Parallel()
+
+	definition, err := ParseDefinition([]byte(testDefinition))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	profile := definition.Profile("low-latency")
+	if profile.BufferSize != 2 {
+		t.Fatalf("expected profile buffer size, got %d", profile.BufferSize)
+	}
+	want := StagePolicy{Timeout: 30 * time.Second, Retries: 2, Capacity: 4, Drop: DropOldest}
+	if got := profile.Stages["asr"].Policy; got != want {
+		t.Fatalf("expected merged asr policy %+v, got %+v", want, got)
+	}
+	if got := definition.Profile("unknown").Stages["asr"].Policy.Capacity; got != 64 {
+		t.Fatalf("expected unknown profiles to use the definition, got capacity %d", got)
+	}
+	if definition.Stages["asr"].Policy.Capacity != 64 {
+		t.Fatal("expected resolving a profile to leave the definition unchanged")
+	}
+}
+
+func TestDefinedRunnerAppliesProfileOptions(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	normalizer := &readingNormalizer{}
+	var options map[string]string
+	if err := registry.RegisterNormalizer("reading", func(_ sessionpkg.TranslationSession, stageOptions map[string]string) (media.Normalizer, error) {
+		options = stageOptions
+		return normalizer, nil
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	definition, err := ParseDefinition([]byte(testDefinition))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	definition = definition.Override(Definition{Profiles: map[string]Definition{
+		"studio": {Stages: map[string]StageDefinition{"normalization": {Implementation: "reading", Options: map[string]string{"loudness": "-23"}}}},
+	}})
+	runner, err := NewDefinedRunner(registry, definition, StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("media")}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("new defined runner: %v", err)
+	}
+
+	session := streamingSession()
+	if got := runner.Selection(session); got["normalization"] != StubImplementation {
+		t.Fatalf("expected the stub normalizer without a profile, got %v", got)
+	}
+	session.Options.ModelProfile = "studio"
+	if err := runner.Run(context.Background(), session, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if normalizer.bytesRead() != "media" {
+		t.Fatalf("expected the profile's normalizer to be used, read %q", normalizer.bytesRead())
+	}
+	if options["loudness"] != "-23" {
+		t.Fatalf("expected the profile's options to reach the factory, got %v", options)
+	}
+}
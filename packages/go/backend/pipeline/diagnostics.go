@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"streamlation/packages/backend/media"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// SampleRateState marks the warning that normalized audio is not at the
+// rate recognition expects. SilentState marks the warning that the source
+// has gone silent, and AudibleState the event reporting that audio returned.
+const (
+	SampleRateState = "sample-rate"
+	SilentState     = "silent"
+	AudibleState    = "audible"
+)
+
+// MediaDiagnostics configures the checks a streaming run makes of the
+// audio its normalizer emits. The checks only report; the audio passes
+// unchanged.
+type MediaDiagnostics struct {
+	// SampleRate is the rate, in Hz, recognition expects. Audio at another
+	// rate is reported once for each rate it arrives at. Zero disables the
+	// check.
+	SampleRate int
+	// SilenceAfter is how long the audio may stay silent before the source
+	// is reported silent. Zero disables the check.
+	SilenceAfter time.Duration
+	// Threshold is the RMS level below which audio counts as silent.
+	// DefaultSilenceThreshold applies when it is zero.
+	Threshold float64
+}
+
+// diagnoseMedia watches the audio from in for conditions that spoil
+// recognition without failing the run, and reports them as normalization
+// events: audio at a sample rate other than cfg.SampleRate as a
+// "sample-rate" warning with code MEDIA_SAMPLE_RATE_MISMATCH, and audio
+// silent for cfg.SilenceAfter as a "silent" warning with code MEDIA_SILENT,
+// followed by an "audible" event once audio returns.
+func diagnoseMedia(ctx context.Context, run *streamRun, cfg MediaDiagnostics, in <-chan media.AudioChunk) <-chan media.AudioChunk {
+	if cfg.SampleRate <= 0 && cfg.SilenceAfter <= 0 {
+		return in
+	}
+	threshold := cfg.Threshold
+	if threshold <= 0 {
+		threshold = DefaultSilenceThreshold
+	}
+
+	out := make(chan media.AudioChunk, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+
+		var (
+			reportedRate int
+			silence      time.Duration
+			silent       bool
+		)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk, ok := <-in:
+				if !ok {
+					return
+				}
+				if cfg.SampleRate > 0 && chunk.SampleRate > 0 && chunk.SampleRate != cfg.SampleRate && chunk.SampleRate != reportedRate {
+					reportedRate = chunk.SampleRate
+					run.notify(ctx, statuspkg.SessionStatusEvent{
+						Stage:    "normalization",
+						State:    SampleRateState,
+						Detail:   fmt.Sprintf("Normalized audio is %d Hz at %s; recognition expects %d Hz", chunk.SampleRate, chunk.Timestamp.Round(time.Millisecond), cfg.SampleRate),
+						Code:     statuspkg.CodeMediaSampleRateMismatch,
+						Severity: statuspkg.SeverityWarning,
+					})
+				}
+				if cfg.SilenceAfter > 0 {
+					if chunk.Level() >= threshold {
+						silence = 0
+						if silent {
+							silent = false
+							run.notify(ctx, statuspkg.SessionStatusEvent{
+								Stage:    "normalization",
+								State:    AudibleState,
+								Detail:   fmt.Sprintf("Audio returned at %s", chunk.Timestamp.Round(time.Millisecond)),
+								Severity: statuspkg.SeverityInfo,
+							})
+						}
+					} else if silence += chunk.Duration; silence >= cfg.SilenceAfter && !silent {
+						silent = true
+						run.notify(ctx, statuspkg.SessionStatusEvent{
+							Stage:    "normalization",
+							State:    SilentState,
+							Detail:   fmt.Sprintf("No audio above the silence threshold for %s", cfg.SilenceAfter),
+							Code:     statuspkg.CodeMediaSilent,
+							Severity: statuspkg.SeverityWarning,
+						})
+					}
+				}
+				select {
+				case out <- chunk:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
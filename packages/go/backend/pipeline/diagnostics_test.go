@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestDiagnoseMediaReportsSampleRateAndSilence(t *testing.T) {
+	t.Parallel()
+
+	run := &streamRun{
+		sessionID:  "diagnostics-session",
+		bufferSize: DefaultStageBuffer,
+		notices:    make(chan statuspkg.SessionStatusEvent, noticeBuffer),
+	}
+	chunks := []media.AudioChunk{
+		{SampleRate: 16000, RMS: 0.2},
+		{SampleRate: 44100, RMS: 0.001},
+		{SampleRate: 44100, RMS: 0.001},
+		{SampleRate: 44100, RMS: 0.001},
+		{SampleRate: 16000, RMS: 0.3},
+	}
+	in := make(chan media.AudioChunk, len(chunks))
+	for i, chunk := range chunks {
+		chunk.Timestamp, chunk.Duration = time.Duration(i)*time.Second, time.Second
+		in <- chunk
+	}
+	close(in)
+
+	forwarded := 0
+	for range diagnoseMedia(context.Background(), run, MediaDiagnostics{SampleRate: 16000, SilenceAfter: 2 * time.Second}, in) {
+		forwarded++
+	}
+	run.wg.Wait()
+
+	if forwarded != len(chunks) {
+		t.Fatalf("expected every chunk to be forwarded, got %d", forwarded)
+	}
+	var (
+		states []string
+		codes  []statuspkg.ErrorCode
+	)
+	for len(run.notices) > 0 {
+		event := <-run.notices
+		if event.Stage != "normalization" || event.SessionID != "diagnostics-session" {
+			t.Fatalf("unexpected diagnostics event %+v", event)
+		}
+		states = append(states, event.State)
+		codes = append(codes, event.Code)
+	}
+	if want := []string{SampleRateState, SilentState, AudibleState}; !reflect.DeepEqual(states, want) {
+		t.Fatalf("expected %v events, got %v", want, states)
+	}
+	if want := []statuspkg.ErrorCode{statuspkg.CodeMediaSampleRateMismatch, statuspkg.CodeMediaSilent, ""}; !reflect.DeepEqual(codes, want) {
+		t.Fatalf("expected codes %v, got %v", want, codes)
+	}
+}
+
+func TestDiagnoseMediaDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	in := make(chan media.AudioChunk)
+	if out := diagnoseMedia(context.Background(), &streamRun{}, MediaDiagnostics{}, in); out != (<-chan media.AudioChunk)(in) {
+		t.Fatal("expected the audio channel to be used as is")
+	}
+}
@@ -0,0 +1,208 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/media"
+)
+
+// Defaults of Diarization.
+const (
+	DefaultMaxSpeakers      = 4
+	DefaultSpeakerTolerance = 3.0
+)
+
+// pitchHistory is how much audio before the latest the pitch track keeps
+// for transcripts that arrive late.
+const pitchHistory = time.Minute
+
+// Diarization configures the attribution of transcripts to speakers by the
+// pitch of their voices. It tells apart voices of clearly different pitch,
+// such as an interviewer and a guest, but not similar ones. Transcripts that
+// the recognizer already attributed keep their speaker.
+type Diarization struct {
+	// MaxSpeakers bounds the number of speakers told apart; once reached,
+	// segments go to the closest speaker. Defaults to DefaultMaxSpeakers.
+	MaxSpeakers int
+	// Tolerance is how far, in semitones, the median pitch of a segment may
+	// lie from a speaker's before the segment is taken for a new speaker.
+	// Defaults to DefaultSpeakerTolerance.
+	Tolerance float64
+}
+
+// pitchTrack records the pitch of the recent audio of a run.
+type pitchTrack struct {
+	mu     sync.Mutex
+	frames []pitchFrame
+}
+
+type pitchFrame struct {
+	at    time.Duration
+	pitch float64
+}
+
+// record adds the voiced frames of chunk and forgets those older than
+// pitchHistory.
+func (p *pitchTrack) record(chunk media.AudioChunk) {
+	if chunk.Channels != 1 || chunk.SampleRate <= 0 {
+		return
+	}
+	pitches := media.Pitches(chunk.PCMData, chunk.SampleRate)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, pitch := range pitches {
+		if pitch > 0 {
+			p.frames = append(p.frames, pitchFrame{at: chunk.Timestamp + time.Duration(i)*media.PitchFrame, pitch: pitch})
+		}
+	}
+	horizon := chunk.Timestamp - pitchHistory
+	drop := 0
+	for drop < len(p.frames) && p.frames[drop].at < horizon {
+		drop++
+	}
+	p.frames = p.frames[drop:]
+}
+
+// median returns the median pitch of the voiced frames starting between
+// start and end, or 0 when none was voiced.
+func (p *pitchTrack) median(start, end time.Duration) float64 {
+	p.mu.Lock()
+	var pitches []float64
+	for _, frame := range p.frames {
+		if frame.at >= start && frame.at < end {
+			pitches = append(pitches, frame.pitch)
+		}
+	}
+	p.mu.Unlock()
+	if len(pitches) == 0 {
+		return 0
+	}
+	sort.Float64s(pitches)
+	return pitches[len(pitches)/2]
+}
+
+// speakerClusters groups segments into speakers by their pitch, tracked in
+// semitones so that the tolerance means the same for low and high voices.
+type speakerClusters struct {
+	cfg     Diarization
+	centres []float64
+	counts  []int
+	last    string
+}
+
+// maxSpeakerWeight caps how much history a speaker's pitch averages over,
+// so that it follows a voice that changes over the session.
+const maxSpeakerWeight = 20
+
+// attribute returns the label of the speaker of a segment with the given
+// median pitch. Final segments update the speakers; partial ones only look
+// them up. Unvoiced segments are attributed to the previous speaker.
+func (c *speakerClusters) attribute(pitch float64, final bool) string {
+	if pitch <= 0 {
+		return c.last
+	}
+	semitones := 12 * math.Log2(pitch)
+	closest, distance := -1, math.Inf(1)
+	for i, centre := range c.centres {
+		if d := math.Abs(semitones - centre); d < distance {
+			closest, distance = i, d
+		}
+	}
+	if closest < 0 || distance > c.cfg.Tolerance && len(c.centres) < c.cfg.MaxSpeakers {
+		closest = len(c.centres)
+		if !final {
+			return speakerLabel(closest)
+		}
+		c.centres = append(c.centres, semitones)
+		c.counts = append(c.counts, 0)
+	}
+	if final {
+		c.counts[closest] = min(c.counts[closest]+1, maxSpeakerWeight)
+		c.centres[closest] += (semitones - c.centres[closest]) / float64(c.counts[closest])
+		c.last = speakerLabel(closest)
+	}
+	return speakerLabel(closest)
+}
+
+func speakerLabel(i int) string {
+	return fmt.Sprintf("S%d", i+1)
+}
+
+// trackPitch records the pitch of the audio from in on track as it passes
+// to recognition. Without a track, in is returned unchanged.
+func trackPitch(ctx context.Context, run *streamRun, track *pitchTrack, in <-chan media.AudioChunk) <-chan media.AudioChunk {
+	if track == nil {
+		return in
+	}
+	out := make(chan media.AudioChunk, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk, ok := <-in:
+				if !ok {
+					return
+				}
+				track.record(chunk)
+				select {
+				case out <- chunk:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// attributeSpeakers labels the transcripts from in that have no speaker by
+// the pitch track covers them with. Without a track, in is returned
+// unchanged.
+func attributeSpeakers(ctx context.Context, run *streamRun, cfg *Diarization, track *pitchTrack, in <-chan asr.Transcript) <-chan asr.Transcript {
+	if track == nil {
+		return in
+	}
+	speakers := &speakerClusters{cfg: *cfg}
+	if speakers.cfg.MaxSpeakers <= 0 {
+		speakers.cfg.MaxSpeakers = DefaultMaxSpeakers
+	}
+	if speakers.cfg.Tolerance <= 0 {
+		speakers.cfg.Tolerance = DefaultSpeakerTolerance
+	}
+
+	out := make(chan asr.Transcript, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case transcript, ok := <-in:
+				if !ok {
+					return
+				}
+				if transcript.Speaker == "" {
+					transcript.Speaker = speakers.attribute(track.median(transcript.StartTime, transcript.EndTime), !transcript.Partial)
+				}
+				select {
+				case out <- transcript:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/media"
+)
+
+// voiceChunk returns a second of a 16kHz mono tone at frequency Hz.
+func voiceChunk(at time.Duration, frequency float64) media.AudioChunk {
+	pcm := make([]byte, 2*16000)
+	for i := 0; i < 16000; i++ {
+		sample := 0.3 * math.Sin(2*math.Pi*frequency*float64(i)/16000)
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(sample*32767)))
+	}
+	return media.AudioChunk{Timestamp: at, SampleRate: 16000, Channels: 1, PCMData: pcm, Duration: time.Second}
+}
+
+func TestAttributeSpeakersByPitch(t *testing.T) {
+	t.Parallel()
+
+	run := &streamRun{bufferSize: DefaultStageBuffer}
+	track := &pitchTrack{}
+	// A low voice, a high voice, the low voice again, and silence.
+	audio := make(chan media.AudioChunk, 3)
+	for i, frequency := range []float64{110, 220, 115} {
+		audio <- voiceChunk(time.Duration(i)*time.Second, frequency)
+	}
+	close(audio)
+	for range trackPitch(context.Background(), run, track, audio) {
+	}
+
+	transcripts := make(chan asr.Transcript, 6)
+	transcripts <- asr.Transcript{Text: "hello", EndTime: time.Second}
+	transcripts <- asr.Transcript{Text: "hi", StartTime: time.Second, EndTime: 2 * time.Second, Partial: true}
+	transcripts <- asr.Transcript{Text: "hi there", StartTime: time.Second, EndTime: 2 * time.Second}
+	transcripts <- asr.Transcript{Text: "so", StartTime: 2 * time.Second, EndTime: 3 * time.Second}
+	transcripts <- asr.Transcript{Text: "um", StartTime: 3 * time.Second, EndTime: 4 * time.Second}
+	transcripts <- asr.Transcript{Text: "labelled", StartTime: 2 * time.Second, EndTime: 3 * time.Second, Speaker: "guest"}
+	close(transcripts)
+
+	var speakers []string
+	for transcript := range attributeSpeakers(context.Background(), run, &Diarization{}, track, transcripts) {
+		speakers = append(speakers, transcript.Speaker)
+	}
+	run.wg.Wait()
+
+	// The silent segment stays with the previous speaker, and speakers from
+	// the recognizer are kept.
+	if want := []string{"S1", "S2", "S2", "S1", "S1", "guest"}; !reflect.DeepEqual(speakers, want) {
+		t.Fatalf("expected speakers %v, got %v", want, speakers)
+	}
+}
+
+func TestSpeakerClustersBoundSpeakers(t *testing.T) {
+	t.Parallel()
+
+	clusters := &speakerClusters{cfg: Diarization{MaxSpeakers: 2, Tolerance: 2}}
+	var speakers []string
+	for _, pitch := range []float64{100, 200, 400, 190} {
+		speakers = append(speakers, clusters.attribute(pitch, true))
+	}
+	// Once two speakers are known, a third voice goes to the closer one.
+	if want := []string{"S1", "S2", "S2", "S2"}; !reflect.DeepEqual(speakers, want) {
+		t.Fatalf("expected speakers %v, got %v", want, speakers)
+	}
+}
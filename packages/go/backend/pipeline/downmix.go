@@ -0,0 +1,35 @@
+package pipeline
+
+import (
+	"context"
+
+	"streamlation/packages/backend/media"
+)
+
+// downmix mixes the audio from in down to mono before it is gated and
+// recognized, so that multichannel sources reach recognition the same way
+// mono ones do. Mono audio passes through unchanged.
+func downmix(ctx context.Context, run *streamRun, in <-chan media.AudioChunk) <-chan media.AudioChunk {
+	out := make(chan media.AudioChunk, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- media.Downmix(chunk):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,41 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"streamlation/packages/backend/media"
+)
+
+func TestDownmixMixesToMono(t *testing.T) {
+	t.Parallel()
+
+	stereo := make([]byte, 8)
+	for i, sample := range []int16{100, 300, -200, -400} {
+		binary.LittleEndian.PutUint16(stereo[2*i:], uint16(sample))
+	}
+	in := make(chan media.AudioChunk, 2)
+	in <- media.AudioChunk{SampleRate: 16000, Channels: 2, PCMData: stereo}
+	in <- media.AudioChunk{SampleRate: 16000, Channels: 1, PCMData: []byte{1, 0}}
+	close(in)
+
+	run := &streamRun{bufferSize: DefaultStageBuffer}
+	var chunks []media.AudioChunk
+	for chunk := range downmix(context.Background(), run, in) {
+		chunks = append(chunks, chunk)
+	}
+	run.wg.Wait()
+
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(chunks))
+	}
+	mixed := chunks[0]
+	if mixed.Channels != 1 || len(mixed.PCMData) != 4 ||
+		int16(binary.LittleEndian.Uint16(mixed.PCMData)) != 200 || int16(binary.LittleEndian.Uint16(mixed.PCMData[2:])) != -300 {
+		t.Fatalf("unexpected downmix %+v", mixed)
+	}
+	if mono := chunks[1]; mono.Channels != 1 || string(mono.PCMData) != "\x01\x00" {
+		t.Fatalf("mono chunk changed: %+v", mono)
+	}
+}
@@ -0,0 +1,241 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/tts"
+)
+
+// DefaultDubTrackDelay is how far the dub tracks of a streaming run lag its
+// source audio when DubbingConfig.TrackDelay is not set.
+const DefaultDubTrackDelay = 15 * time.Second
+
+// DubTrackState marks the warning a run emits when publishing its dub
+// tracks fails.
+const DubTrackState = "dub_track"
+
+// dubTrackInterval is how often a run mixes the source audio that has
+// aged past the delay into its dub tracks.
+const dubTrackInterval = time.Second
+
+// dubTrack mixes the synthesized speech of a run into its source audio and
+// publishes the mix of every dubbed language as an HLS audio rendition
+// below "<session>/hls/", with a master playlist offering the languages.
+// The languages dubbed from the start of the run get a rendition from its
+// first audio on; languages dubbed later get one from their first speech.
+//
+// A failure to publish is reported once as a warning and stops the
+// publishing; it never fails the run. A nil track publishes nothing.
+type dubTrack struct {
+	store     output.ObjectStore
+	sessionID string
+	delay     time.Duration
+	emit      func(statuspkg.SessionStatusEvent) error
+	// encoder returns the encoder of a rendition; nil uses the default.
+	encoder func(sampleRate int) (media.AACEncoder, error)
+
+	// mu guards the source audio, which the normalization stage adds.
+	mu      sync.Mutex
+	pending []media.AudioChunk
+	latest  time.Duration
+	stopped bool
+
+	// The rest is owned by the run's event loop.
+	wanted     []string
+	queued     []tts.AudioSegment
+	renditions map[string]*dubRendition
+	failed     bool
+}
+
+// dubRendition is the mix of one language.
+type dubRendition struct {
+	mixer     *tts.DubMixer
+	rendition *output.HLSAudioRendition
+}
+
+// startDubTrack returns the dub track of a run of session, or nil when dub
+// tracks are not published.
+func (r *StreamingRunner) startDubTrack(session sessionpkg.TranslationSession, languages []string, emit func(statuspkg.SessionStatusEvent) error) *dubTrack {
+	if r.config.Dubbing.Tracks == nil || r.config.Synthesizer == nil {
+		return nil
+	}
+	track := &dubTrack{
+		store:      r.config.Dubbing.Tracks,
+		sessionID:  session.ID,
+		delay:      r.config.Dubbing.TrackDelay,
+		emit:       emit,
+		renditions: make(map[string]*dubRendition),
+	}
+	if session.Options.EnableDubbing {
+		track.wanted = append(track.wanted, languages...)
+	}
+	return track
+}
+
+func (t *dubTrack) audio(chunk media.AudioChunk) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	t.pending = append(t.pending, chunk)
+	t.latest = max(t.latest, chunk.Timestamp+chunk.Duration)
+}
+
+func (t *dubTrack) speech(segment tts.AudioSegment) {
+	if t == nil || t.failed {
+		return
+	}
+	rendition := t.renditions[segment.Language]
+	if rendition == nil {
+		// The rendition opens with the next mix.
+		if !contains(t.wanted, segment.Language) {
+			t.wanted = append(t.wanted, segment.Language)
+		}
+		t.queued = append(t.queued, segment)
+		return
+	}
+	if err := rendition.mixer.AddSpeech(segment); err != nil {
+		t.fail(fmt.Errorf("mix %s speech: %w", segment.Language, err))
+	}
+}
+
+// publish mixes the source audio older than the delay, or all of it once
+// the run ends, into the renditions.
+func (t *dubTrack) publish(ctx context.Context, final bool) {
+	if t == nil || t.failed {
+		return
+	}
+	t.mu.Lock()
+	ready := len(t.pending)
+	if !final {
+		ready = 0
+		for ready < len(t.pending) && t.pending[ready].Timestamp+t.pending[ready].Duration <= t.latest-t.delay {
+			ready++
+		}
+	}
+	chunks := t.pending[:ready:ready]
+	t.pending = t.pending[ready:]
+	t.mu.Unlock()
+
+	for _, chunk := range chunks {
+		if err := t.open(ctx, chunk.SampleRate); err != nil {
+			t.fail(err)
+			return
+		}
+		for _, language := range t.wanted {
+			rendition := t.renditions[language]
+			mixed, err := rendition.mixer.Mix(chunk)
+			if err == nil {
+				err = rendition.rendition.Write(ctx, mixed)
+			}
+			if err != nil {
+				t.fail(fmt.Errorf("publish %s dub track: %w", language, err))
+				return
+			}
+		}
+	}
+}
+
+// finish publishes the rest of the run's audio and ends the renditions.
+func (t *dubTrack) finish(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	// The run's context is usually cancelled by now.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	t.publish(ctx, true)
+	if t.failed {
+		return
+	}
+	for _, language := range t.wanted {
+		if rendition := t.renditions[language]; rendition != nil {
+			if err := rendition.rendition.Close(ctx); err != nil {
+				t.fail(fmt.Errorf("publish %s dub track: %w", language, err))
+				return
+			}
+		}
+	}
+}
+
+// open opens the renditions of the languages wanted that have none yet,
+// mixing at sampleRate, and republishes the master playlist when it adds
+// any.
+func (t *dubTrack) open(ctx context.Context, sampleRate int) error {
+	if len(t.renditions) == len(t.wanted) {
+		return nil
+	}
+	for _, language := range t.wanted {
+		if t.renditions[language] != nil {
+			continue
+		}
+		mixer, err := tts.NewDubMixer(tts.DubMixConfig{SampleRate: sampleRate})
+		if err != nil {
+			return err
+		}
+		cfg := output.HLSAudioRenditionConfig{
+			Store:      t.store,
+			Key:        t.sessionID + "/hls/dub-" + language + ".m3u8",
+			SampleRate: sampleRate,
+		}
+		if t.encoder != nil {
+			if cfg.Encoder, err = t.encoder(sampleRate); err != nil {
+				return fmt.Errorf("open %s dub track: %w", language, err)
+			}
+		}
+		rendition, err := output.NewHLSAudioRendition(cfg)
+		if err != nil {
+			return fmt.Errorf("open %s dub track: %w", language, err)
+		}
+		t.renditions[language] = &dubRendition{mixer: mixer, rendition: rendition}
+	}
+	queued := t.queued
+	t.queued = nil
+	for _, segment := range queued {
+		if err := t.renditions[segment.Language].mixer.AddSpeech(segment); err != nil {
+			return fmt.Errorf("mix %s speech: %w", segment.Language, err)
+		}
+	}
+
+	alternatives := make([]output.HLSAudioMedia, len(t.wanted))
+	for i, language := range t.wanted {
+		alternatives[i] = output.HLSAudioMedia{Name: language, Language: language, URI: "dub-" + language + ".m3u8", Default: i == 0}
+	}
+	playlist, err := output.HLSMasterPlaylist(alternatives, output.DefaultHLSAudioBitrate)
+	if err == nil {
+		err = t.store.Put(ctx, t.sessionID+"/hls/master.m3u8", bytes.NewReader(playlist))
+	}
+	if err != nil {
+		return fmt.Errorf("publish dub track playlist: %w", err)
+	}
+	return nil
+}
+
+// fail reports err and stops publishing.
+func (t *dubTrack) fail(err error) {
+	t.failed = true
+	t.mu.Lock()
+	t.pending, t.stopped = nil, true
+	t.mu.Unlock()
+	_ = t.emit(statuspkg.SessionStatusEvent{
+		SessionID: t.sessionID,
+		Stage:     "pipeline",
+		State:     DubTrackState,
+		Detail:    err.Error(),
+		Code:      statuspkg.CodeOutputFailed,
+		Severity:  statuspkg.SeverityWarning,
+		Timestamp: time.Now().UTC(),
+	})
+}
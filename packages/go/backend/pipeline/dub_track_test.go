@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/archive"
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+	"streamlation/packages/backend/tts"
+)
+
+// countingEncoder encodes every AACFrameSamples samples into an empty frame.
+type countingEncoder struct {
+	pending int
+}
+
+func (e *countingEncoder) Encode(pcm []byte) ([][]byte, error) {
+	e.pending += len(pcm) / 2
+	frames := make([][]byte, e.pending/media.AACFrameSamples)
+	e.pending %= media.AACFrameSamples
+	return frames, nil
+}
+
+func (e *countingEncoder) Flush() ([][]byte, error) {
+	if e.pending == 0 {
+		return nil, nil
+	}
+	e.pending = 0
+	return [][]byte{nil}, nil
+}
+
+func (e *countingEncoder) Close() error { return nil }
+
+func readObject(t *testing.T, store archive.Store, key string) string {
+	t.Helper()
+	body, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return string(data)
+}
+
+func TestDubTrackPublishesDelayedRenditions(t *testing.T) {
+	t.Parallel()
+
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	var warnings []statuspkg.SessionStatusEvent
+	track := &dubTrack{
+		store:     store,
+		sessionID: "session",
+		delay:     time.Second,
+		emit: func(event statuspkg.SessionStatusEvent) error {
+			warnings = append(warnings, event)
+			return nil
+		},
+		encoder:    func(int) (media.AACEncoder, error) { return &countingEncoder{}, nil },
+		wanted:     []string{"es"},
+		renditions: make(map[string]*dubRendition),
+	}
+	for i := 0; i < 30; i++ {
+		track.audio(media.AudioChunk{Timestamp: time.Duration(i) * 100 * time.Millisecond, Duration: 100 * time.Millisecond, SampleRate: 16000, Channels: 1, PCMData: make([]byte, 3200)})
+	}
+	track.speech(tts.AudioSegment{Language: "fr", Timestamp: time.Second, SampleRate: 16000, PCMData: make([]byte, 3200)})
+
+	// Only the audio older than the delay is mixed.
+	track.publish(context.Background(), false)
+	if len(track.pending) != 10 {
+		t.Fatalf("expected the last second of audio to be held back, got %d chunks", len(track.pending))
+	}
+	master := readObject(t, store, "session/hls/master.m3u8")
+	if !strings.Contains(master, `LANGUAGE="es",DEFAULT=YES`) || !strings.Contains(master, `LANGUAGE="fr",DEFAULT=NO`) {
+		t.Fatalf("expected both languages offered, got:\n%s", master)
+	}
+
+	track.finish(context.Background())
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings %+v", warnings)
+	}
+	for _, language := range []string{"es", "fr"} {
+		playlist := readObject(t, store, "session/hls/dub-"+language+".m3u8")
+		if !strings.Contains(playlist, "dub-"+language+"/00000.aac") || !strings.HasSuffix(playlist, "#EXT-X-ENDLIST\n") {
+			t.Fatalf("expected an ended %s playlist, got:\n%s", language, playlist)
+		}
+	}
+}
+
+func TestStreamingRunnerReportsDubTrackFailuresOnce(t *testing.T) {
+	t.Parallel()
+
+	if encoder, err := media.NewAACEncoder(16000, 1, output.DefaultHLSAudioBitrate); err == nil {
+		encoder.Close()
+		t.Skip("built with AAC encoding")
+	}
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second ")}}, nil
+		},
+		Normalizer:  &readingNormalizer{},
+		Recognizer:  asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator:  translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:   output.NewStubGenerator(),
+		Synthesizer: tts.NewStubSynthesizer(&tts.StubSynthesizerConfig{SampleRate: 16000}),
+		Dubbing: DubbingConfig{
+			Tracks: store,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	session := streamingSession()
+	session.Options.EnableDubbing = true
+
+	var warnings []statuspkg.SessionStatusEvent
+	err = runner.Run(context.Background(), session, func(event statuspkg.SessionStatusEvent) error {
+		if event.State == DubTrackState {
+			warnings = append(warnings, event)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected dub track failures not to fail the run, got %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Code != statuspkg.CodeOutputFailed || warnings[0].Severity != statuspkg.SeverityWarning {
+		t.Fatalf("expected a single dub track warning, got %+v", warnings)
+	}
+	if !strings.Contains(warnings[0].Detail, media.ErrAACEncodingUnsupported.Error()) {
+		t.Fatalf("expected the warning to name the missing encoder, got %q", warnings[0].Detail)
+	}
+	if _, err := store.Get(context.Background(), session.ID+"/hls/master.m3u8"); !errors.Is(err, archive.ErrNotFound) {
+		t.Fatalf("expected nothing published, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package pipeline
+
+import (
+	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+	"streamlation/packages/backend/tts"
+)
+
+// splitDubbing forwards every translation of branch to the subtitles channel
+// and, while the run dubs, the final ones to the speech channel as well.
+// Once the branch's dubbing stops, speech is no longer fed so that subtitles
+// keep flowing.
+func splitDubbing(run *streamRun, branch *languageBranch, in <-chan translation.Translation) (<-chan translation.Translation, <-chan translation.Translation) {
+	subtitles := make(chan translation.Translation, run.bufferSize)
+	speech := make(chan translation.Translation, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(subtitles)
+		defer close(speech)
+		for {
+			var value translation.Translation
+			select {
+			case <-branch.ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				value = v
+			}
+			select {
+			case subtitles <- value:
+			case <-branch.ctx.Done():
+				return
+			}
+			if value.Partial || !run.dubbing.Load() {
+				continue
+			}
+			select {
+			case speech <- value:
+			case <-branch.dubbingCtx.Done():
+			case <-branch.ctx.Done():
+				return
+			}
+		}
+	}()
+	return subtitles, speech
+}
+
+// voiceFor picks the voice synthesizer offers for language that best
+// matches the voice preferences of options, and returns it along with all
+// the voices offered in order of preference.
+func voiceFor(synthesizer tts.Synthesizer, options sessionpkg.TranslationOptions, language string) (tts.VoiceProfile, []tts.VoiceProfile) {
+	voices := tts.PreferVoices(synthesizer.AvailableVoices(language), voicePreference(options))
+	if len(voices) > 0 {
+		return voices[0], voices
+	}
+	return tts.VoiceProfile{Language: language}, nil
+}
+
+func voicePreference(options sessionpkg.TranslationOptions) tts.VoicePreference {
+	return tts.VoicePreference{ID: options.VoiceID, Gender: options.VoiceGender, Style: options.VoiceStyle}
+}
+
+// mergeAudio forwards the speech synthesized for a joined branch. It must be
+// called before the branch's subtitles are passed to merge.
+func (s *branchSet) mergeAudio(branch *languageBranch, segments <-chan tts.AudioSegment) {
+	s.forwarders.Add(1)
+	s.run.wg.Add(1)
+	go func() {
+		defer s.run.wg.Done()
+		defer s.forwarders.Done()
+		for segment := range segments {
+			segment.Language = branch.language
+			if !segment.Partial {
+				branch.segments++
+			}
+			select {
+			case s.audio <- segment:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// speech returns the merged audio of the dubbed branches. The channel closes
+// together with the subtitles channel.
+func (s *branchSet) speech() <-chan tts.AudioSegment {
+	return s.audio
+}
+
+// emitDubbingCompletions reports the completed dubbing of every branch. The
+// events always carry the branch's language.
+func emitDubbingCompletions(emit func(statuspkg.SessionStatusEvent) error, sessionID string, branches []*languageBranch) error {
+	for _, branch := range branches {
+		if branch.dubbingCancel == nil || branch.dubbingFailed != nil || branch.failed != nil || branch.removed {
+			continue
+		}
+		err := emit(statuspkg.SessionStatusEvent{
+			SessionID: sessionID,
+			Stage:     "dubbing",
+			State:     "completed",
+			Detail:    "Synthesized " + itoa(branch.segments) + " audio segments",
+			Language:  branch.language,
+			Timestamp: time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dubEncoders encodes the speech of a run's dubbed languages, each with an
+// encoder of its own, for DubbingConfig.OnAudio. A nil *dubEncoders passes
+// speech on as PCM.
+type dubEncoders struct {
+	cfg      tts.SpeechEncodingConfig
+	encoders map[string]*tts.SpeechEncoder
+}
+
+// startDubEncoders returns the encoders of a run, or nil when speech is
+// not encoded.
+func (r *StreamingRunner) startDubEncoders() *dubEncoders {
+	if r.config.Dubbing.Encoding == nil || r.config.Dubbing.OnAudio == nil {
+		return nil
+	}
+	return &dubEncoders{cfg: *r.config.Dubbing.Encoding, encoders: make(map[string]*tts.SpeechEncoder)}
+}
+
+// encode returns segment with its speech encoded by the encoder of its
+// language.
+func (e *dubEncoders) encode(segment tts.AudioSegment) (tts.AudioSegment, error) {
+	if e == nil {
+		return segment, nil
+	}
+	encoder := e.encoders[segment.Language]
+	if encoder == nil {
+		var err error
+		if encoder, err = tts.NewSpeechEncoder(e.cfg); err != nil {
+			return tts.AudioSegment{}, err
+		}
+		e.encoders[segment.Language] = encoder
+	}
+	return encoder.Encode(segment)
+}
+
+// close releases the encoders.
+func (e *dubEncoders) close() {
+	if e == nil {
+		return
+	}
+	for _, encoder := range e.encoders {
+		_ = encoder.Close()
+	}
+}
@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"io"
+
+	"streamlation/packages/backend/metrics"
+	"streamlation/packages/backend/tts"
+)
+
+// DubbingMetrics counts the speech segments synthesized for every running
+// session by language, how many of them were sped up to fit the source
+// speech they dub, and sums the drift that fitting left, so that how well
+// dubs keep in sync can be followed. A session's series are removed when
+// its run ends. A nil *DubbingMetrics records nothing.
+type DubbingMetrics struct {
+	segments *metrics.Counter
+	sped     *metrics.Counter
+	drift    *metrics.Summary
+}
+
+// NewDubbingMetrics returns an empty set of dubbing metrics.
+func NewDubbingMetrics() *DubbingMetrics {
+	return &DubbingMetrics{
+		segments: metrics.NewCounter("streamlation_dubbing_segments_total", "Synthesized speech segments by language.", "session", "language"),
+		sped:     metrics.NewCounter("streamlation_dubbing_sped_up_segments_total", "Speech segments sped up to fit the source speech they dub.", "session", "language"),
+		drift:    metrics.NewSummary("streamlation_dubbing_drift_seconds", "How much longer fitted speech segments still are than the source speech they dub.", "session", "language"),
+	}
+}
+
+// observe counts a segment synthesized for sessionID in language. Chunks
+// of streamed speech count once, with the last of their utterance, and
+// only fitted segments count towards the drift.
+func (m *DubbingMetrics) observe(sessionID, language string, segment tts.AudioSegment) {
+	if m == nil || segment.Partial {
+		return
+	}
+	m.segments.Inc(sessionID, language)
+	if segment.Rate > 0 {
+		m.drift.Observe(segment.Drift.Seconds(), sessionID, language)
+	}
+	sped := 0.0
+	if segment.Rate > 1 {
+		sped = 1
+	}
+	m.sped.Add(sped, sessionID, language)
+}
+
+// forget removes the series of a session whose run has ended.
+func (m *DubbingMetrics) forget(sessionID string) {
+	if m == nil {
+		return
+	}
+	m.segments.DeletePrefix(sessionID)
+	m.sped.DeletePrefix(sessionID)
+	m.drift.DeletePrefix(sessionID)
+}
+
+// WriteMetrics writes the dubbing metrics in the Prometheus text exposition
+// format.
+func (m *DubbingMetrics) WriteMetrics(w io.Writer) error {
+	for _, collector := range []metrics.Collector{m.segments, m.sped, m.drift} {
+		if err := collector.WriteMetrics(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
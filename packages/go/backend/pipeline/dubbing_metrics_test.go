@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/tts"
+)
+
+func TestDubbingMetricsWritesPrometheusText(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewDubbingMetrics()
+	metrics.observe("s-1", "es", tts.AudioSegment{Rate: 1})
+	metrics.observe("s-1", "es", tts.AudioSegment{Rate: 1.25, Drift: 250 * time.Millisecond})
+	metrics.observe("s-1", "es", tts.AudioSegment{Rate: 1.1, Drift: 250 * time.Millisecond})
+	metrics.observe("s-2", "fr", tts.AudioSegment{})
+
+	var b strings.Builder
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	text := b.String()
+	for _, want := range []string{
+		"# TYPE streamlation_dubbing_segments_total counter\n",
+		`streamlation_dubbing_segments_total{session="s-1",language="es"} 3`,
+		`streamlation_dubbing_segments_total{session="s-2",language="fr"} 1`,
+		`streamlation_dubbing_sped_up_segments_total{session="s-1",language="es"} 2`,
+		`streamlation_dubbing_sped_up_segments_total{session="s-2",language="fr"} 0`,
+		"# TYPE streamlation_dubbing_drift_seconds summary\n",
+		`streamlation_dubbing_drift_seconds_sum{session="s-1",language="es"} 0.5`,
+		`streamlation_dubbing_drift_seconds_count{session="s-1",language="es"} 3`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in metrics:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, `streamlation_dubbing_drift_seconds_count{session="s-2"`) {
+		t.Fatalf("expected no drift for unfitted speech:\n%s", text)
+	}
+
+	metrics.forget("s-1")
+	b.Reset()
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	if strings.Contains(b.String(), "s-1") {
+		t.Fatalf("expected forgotten session to be removed:\n%s", b.String())
+	}
+}
@@ -0,0 +1,381 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+	"streamlation/packages/backend/tts"
+)
+
+// failingSynthesizer fails as soon as it is given a translation.
+type failingSynthesizer struct {
+	*tts.StubSynthesizer
+}
+
+func (s failingSynthesizer) SynthesizeStream(ctx context.Context, sessionID string, translations <-chan translation.Translation, voice tts.VoiceProfile) (<-chan tts.AudioSegment, error) {
+	out := make(chan tts.AudioSegment)
+	go func() {
+		defer close(out)
+		select {
+		case <-translations:
+			statuspkg.ReportStageError(ctx, errors.New("voice unavailable"))
+		case <-ctx.Done():
+		}
+	}()
+	return out, nil
+}
+
+type dubbingResult struct {
+	subtitles int
+	segments  []tts.AudioSegment
+	events    []statuspkg.SessionStatusEvent
+	counters  *Counters
+}
+
+func runDubbing(t *testing.T, synthesizer tts.Synthesizer, enabled bool) (dubbingResult, error) {
+	t.Helper()
+	var (
+		mu     sync.Mutex
+		result = dubbingResult{counters: &Counters{}}
+	)
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second "), []byte("third")}}, nil
+		},
+		Normalizer:  &readingNormalizer{},
+		Recognizer:  asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator:  translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:   output.NewStubGenerator(),
+		Synthesizer: synthesizer,
+		Output: OutputConfig{
+			OnSubtitle: func(context.Context, output.SubtitleEvent) error {
+				mu.Lock()
+				defer mu.Unlock()
+				result.subtitles++
+				return nil
+			},
+		},
+		Dubbing: DubbingConfig{
+			OnAudio: func(_ context.Context, segment tts.AudioSegment) error {
+				mu.Lock()
+				defer mu.Unlock()
+				result.segments = append(result.segments, segment)
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	session := streamingSession()
+	session.Options.EnableDubbing = enabled
+	err = runner.Run(WithCounters(context.Background(), result.counters), session, func(event statuspkg.SessionStatusEvent) error {
+		result.events = append(result.events, event)
+		return nil
+	})
+	return result, err
+}
+
+func findEvent(events []statuspkg.SessionStatusEvent, stage, state string) *statuspkg.SessionStatusEvent {
+	for i := range events {
+		if events[i].Stage == stage && events[i].State == state {
+			return &events[i]
+		}
+	}
+	return nil
+}
+
+func TestStreamingRunnerDubsTranslations(t *testing.T) {
+	t.Parallel()
+
+	result, err := runDubbing(t, tts.NewStubSynthesizer(&tts.StubSynthesizerConfig{SampleRate: 16000}), true)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if len(result.segments) != result.subtitles || result.subtitles == 0 {
+		t.Fatalf("expected one audio segment per subtitle, got %d segments for %d subtitles", len(result.segments), result.subtitles)
+	}
+	for _, segment := range result.segments {
+		if segment.Language != "es" || segment.SessionID != "stream-session" || len(segment.PCMData) == 0 {
+			t.Fatalf("unexpected segment %+v", segment)
+		}
+	}
+	if got := result.counters.Snapshot().AudioSegments; got != int64(len(result.segments)) {
+		t.Fatalf("expected %d audio segments counted, got %d", len(result.segments), got)
+	}
+
+	running := findEvent(result.events, "dubbing", "running")
+	if running == nil || running.Language != "es" || running.Detail != "Synthesizing speech in es" {
+		t.Fatalf("expected dubbing to be announced for es, got %+v", running)
+	}
+	completed := findEvent(result.events, "dubbing", "completed")
+	if completed == nil || completed.Language != "es" || completed.Detail != "Synthesized 3 audio segments" {
+		t.Fatalf("expected dubbing to complete for es, got %+v", completed)
+	}
+	if last := result.events[len(result.events)-1]; last.Stage != "output" || last.State != "completed" {
+		t.Fatalf("expected the run to end with output completion, got %+v", last)
+	}
+}
+
+func TestStreamingRunnerKeepsSubtitlesWhenDubbingFails(t *testing.T) {
+	t.Parallel()
+
+	result, err := runDubbing(t, failingSynthesizer{tts.NewStubSynthesizer(nil)}, true)
+	if err != nil {
+		t.Fatalf("expected the run to survive a dubbing failure: %v", err)
+	}
+
+	if result.subtitles != 3 || len(result.segments) != 0 {
+		t.Fatalf("expected every subtitle and no audio, got %d subtitles and %d segments", result.subtitles, len(result.segments))
+	}
+	failed := findEvent(result.events, "dubbing", "failed")
+	if failed == nil || failed.Language != "es" || failed.Code != statuspkg.CodeDubbingFailed {
+		t.Fatalf("expected a dubbing failure for es, got %+v", failed)
+	}
+	if findEvent(result.events, "dubbing", "completed") != nil {
+		t.Fatal("expected no dubbing completion after a failure")
+	}
+}
+
+func TestStreamingRunnerSkipsDubbingUnlessEnabled(t *testing.T) {
+	t.Parallel()
+
+	result, err := runDubbing(t, nil, false)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(result.segments) != 0 || findEvent(result.events, "dubbing", "running") != nil {
+		t.Fatalf("expected no dubbing, got %d segments", len(result.segments))
+	}
+}
+
+func TestStreamingRunnerFitsDubbedSpeech(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewDubbingMetrics()
+	var (
+		mu       sync.Mutex
+		segments []tts.AudioSegment
+		written  string
+	)
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second "), []byte("third")}}, nil
+		},
+		Normalizer:  &readingNormalizer{},
+		Recognizer:  asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator:  translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:   output.NewStubGenerator(),
+		Synthesizer: tts.NewStubSynthesizer(&tts.StubSynthesizerConfig{SampleRate: 16000}),
+		Dubbing: DubbingConfig{
+			Fit: &tts.DurationFitConfig{},
+			OnAudio: func(_ context.Context, segment tts.AudioSegment) error {
+				mu.Lock()
+				defer mu.Unlock()
+				segments = append(segments, segment)
+				var b strings.Builder
+				if err := metrics.WriteMetrics(&b); err != nil {
+					return err
+				}
+				written = b.String()
+				return nil
+			},
+		},
+		Metrics: MetricsConfig{
+			Dubbing: metrics,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	session := streamingSession()
+	session.Options.EnableDubbing = true
+	if err := runner.Run(context.Background(), session, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	// The stub's speech is longer than the stub transcripts, so it is sped
+	// up as far as allowed and still drifts.
+	if len(segments) != 3 {
+		t.Fatalf("expected 3 segments, got %d", len(segments))
+	}
+	for _, segment := range segments {
+		if segment.Rate < 1.24 || segment.Drift <= 0 {
+			t.Fatalf("expected speech sped up to the maximum rate, got %+v", segment)
+		}
+	}
+	if !strings.Contains(written, `streamlation_dubbing_sped_up_segments_total{session="stream-session",language="es"} `) {
+		t.Fatalf("expected the fitted speech in the metrics:\n%s", written)
+	}
+}
+
+// voiceRecordingSynthesizer records the voices it is asked to speak in.
+type voiceRecordingSynthesizer struct {
+	*tts.StubSynthesizer
+	mu     *sync.Mutex
+	voices map[string]tts.VoiceProfile
+}
+
+func (s voiceRecordingSynthesizer) SynthesizeStream(ctx context.Context, sessionID string, translations <-chan translation.Translation, voice tts.VoiceProfile) (<-chan tts.AudioSegment, error) {
+	s.mu.Lock()
+	s.voices[voice.Language] = voice
+	s.mu.Unlock()
+	return s.StubSynthesizer.SynthesizeStream(ctx, sessionID, translations, voice)
+}
+
+func TestStreamingRunnerDubsInPreferredVoices(t *testing.T) {
+	t.Parallel()
+
+	config := tts.DefaultStubSynthesizerConfig()
+	config.ProcessingDelay = 0
+	synthesizer := voiceRecordingSynthesizer{StubSynthesizer: tts.NewStubSynthesizer(config), mu: &sync.Mutex{}, voices: make(map[string]tts.VoiceProfile)}
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second")}}, nil
+		},
+		Normalizer:  &readingNormalizer{},
+		Recognizer:  asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator:  translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:   output.NewStubGenerator(),
+		Synthesizer: synthesizer,
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	session := streamingSession()
+	session.Options.EnableDubbing = true
+	session.Options.AdditionalLanguages = []string{"fr", "de"}
+	session.Options.VoiceID = "es-es-2"
+	session.Options.VoiceGender = "female"
+	if err := runner.Run(context.Background(), session, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	// The voice asked for where it is offered, a voice of the preferred
+	// gender elsewhere, and the language's default without voices.
+	for language, want := range map[string]string{"es": "es-es-2", "fr": "fr-fr-1", "de": ""} {
+		if voice := synthesizer.voices[language]; voice.ID != want || voice.Language != language {
+			t.Fatalf("expected voice %q for %s, got %+v", want, language, voice)
+		}
+	}
+}
+
+// chunkingSynthesizer streams the stub's speech in three chunks.
+type chunkingSynthesizer struct {
+	*tts.StubSynthesizer
+}
+
+func (s chunkingSynthesizer) SynthesizeChunks(ctx context.Context, text string, voice tts.VoiceProfile, emit func(tts.AudioSegment) error) error {
+	segment, err := s.Synthesize(ctx, text, voice)
+	if err != nil {
+		return err
+	}
+	size := len(segment.PCMData) / 3 &^ 1
+	for i := 0; i < 3; i++ {
+		chunk := segment
+		chunk.PCMData = segment.PCMData[i*size : (i+1)*size]
+		chunk.Duration = time.Duration(size/2) * time.Second / time.Duration(segment.SampleRate)
+		if err := emit(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s chunkingSynthesizer) SynthesizeStream(ctx context.Context, sessionID string, translations <-chan translation.Translation, voice tts.VoiceProfile) (<-chan tts.AudioSegment, error) {
+	return tts.SynthesizeSpeakers(ctx, s, sessionID, translations, tts.NewVoiceCast(nil, voice))
+}
+
+func TestStreamingRunnerForwardsStreamedSpeechChunks(t *testing.T) {
+	t.Parallel()
+
+	result, err := runDubbing(t, chunkingSynthesizer{tts.NewStubSynthesizer(&tts.StubSynthesizerConfig{SampleRate: 16000})}, true)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if len(result.segments) != 9 {
+		t.Fatalf("expected three chunks for each of 3 utterances, got %d", len(result.segments))
+	}
+	for i, segment := range result.segments {
+		if segment.Partial != (i%3 < 2) || segment.Language != "es" {
+			t.Fatalf("unexpected chunk %d %+v", i, segment)
+		}
+		if i%3 > 0 && segment.Timestamp != result.segments[i-1].Timestamp+result.segments[i-1].Duration {
+			t.Fatalf("expected chunk %d to follow the one before it, got %v", i, segment.Timestamp)
+		}
+	}
+	if got := result.counters.Snapshot().AudioSegments; got != 3 {
+		t.Fatalf("expected 3 utterances counted, got %d", got)
+	}
+	if completed := findEvent(result.events, "dubbing", "completed"); completed == nil || completed.Detail != "Synthesized 3 audio segments" {
+		t.Fatalf("expected dubbing to complete with 3 segments, got %+v", completed)
+	}
+}
+
+func TestStreamingRunnerEncodesDubbedSpeech(t *testing.T) {
+	t.Parallel()
+
+	config := StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second "), []byte("third")}}, nil
+		},
+		Normalizer:  &readingNormalizer{},
+		Recognizer:  asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator:  translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:   output.NewStubGenerator(),
+		Synthesizer: tts.NewStubSynthesizer(&tts.StubSynthesizerConfig{SampleRate: 16000}),
+		Dubbing: DubbingConfig{
+			Encoding: &tts.SpeechEncodingConfig{Codec: "mp3"},
+		},
+	}
+	if _, err := NewStreamingRunner(config); err == nil {
+		t.Fatal("expected an unsupported codec to be rejected")
+	}
+
+	var (
+		mu       sync.Mutex
+		segments []tts.AudioSegment
+	)
+	config.Dubbing.Encoding = &tts.SpeechEncodingConfig{Codec: tts.CodecOpus}
+	config.Dubbing.OnAudio = func(_ context.Context, segment tts.AudioSegment) error {
+		mu.Lock()
+		defer mu.Unlock()
+		segments = append(segments, segment)
+		return nil
+	}
+	runner, err := NewStreamingRunner(config)
+	if errors.Is(err, media.ErrOpusEncodingUnsupported) {
+		t.Skip("build does not encode Opus")
+	}
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	session := streamingSession()
+	session.Options.EnableDubbing = true
+	if err := runner.Run(context.Background(), session, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if len(segments) != 3 {
+		t.Fatalf("expected 3 segments, got %d", len(segments))
+	}
+	for _, segment := range segments {
+		if segment.Codec != tts.CodecOpus || len(segment.Frames) == 0 || segment.PCMData != nil || segment.SampleRate != tts.DefaultEncodedSampleRate {
+			t.Fatalf("expected Opus frames, got %+v", segment)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"streamlation/packages/backend/media"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// AudioDumpState marks the warning a run emits when dumping its audio
+// fails.
+const AudioDumpState = "audio-dump"
+
+// dumpAudio writes the audio from in to the run's audio dump, configured by
+// cfg, as it passes on to recognition. A dump that cannot be opened or
+// written is reported once and abandoned; the audio still passes. A nil cfg
+// leaves the audio as it is.
+func dumpAudio(ctx context.Context, run *streamRun, cfg *media.AudioDumpConfig, in <-chan media.AudioChunk) <-chan media.AudioChunk {
+	if cfg == nil {
+		return in
+	}
+	report := func(err error) {
+		run.notify(ctx, statuspkg.SessionStatusEvent{
+			Stage:    "asr",
+			State:    AudioDumpState,
+			Detail:   fmt.Sprintf("audio dump disabled: %v", err),
+			Code:     statuspkg.CodeAudioDumpFailed,
+			Severity: statuspkg.SeverityWarning,
+		})
+	}
+
+	out := make(chan media.AudioChunk, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		dump, err := media.NewAudioDump(*cfg, run.sessionID)
+		if err != nil {
+			report(err)
+		}
+		defer func() {
+			if dump != nil {
+				_ = dump.Close()
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk, ok := <-in:
+				if !ok {
+					return
+				}
+				if dump != nil {
+					if err := dump.Write(chunk); err != nil {
+						_ = dump.Close()
+						dump = nil
+						report(err)
+					}
+				}
+				select {
+				case out <- chunk:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
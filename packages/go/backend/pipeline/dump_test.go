@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"streamlation/packages/backend/media"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestDumpAudioWritesSessionAudio(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	run := &streamRun{
+		sessionID:  "dump-session",
+		bufferSize: DefaultStageBuffer,
+		notices:    make(chan statuspkg.SessionStatusEvent, noticeBuffer),
+	}
+	in := make(chan media.AudioChunk, 2)
+	in <- media.AudioChunk{SampleRate: 16000, Channels: 1, PCMData: make([]byte, 3200)}
+	in <- media.AudioChunk{SampleRate: 16000, Channels: 1, PCMData: make([]byte, 3200)}
+	close(in)
+
+	forwarded := 0
+	for range dumpAudio(context.Background(), run, &media.AudioDumpConfig{Dir: root}, in) {
+		forwarded++
+	}
+	run.wg.Wait()
+
+	if forwarded != 2 {
+		t.Fatalf("expected 2 chunks forwarded, got %d", forwarded)
+	}
+	info, err := os.Stat(filepath.Join(root, "dump-session", "audio-000001.wav"))
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size() != 44+6400 {
+		t.Fatalf("expected a 6444-byte WAV file, got %d bytes", info.Size())
+	}
+	if len(run.notices) != 0 {
+		t.Fatalf("unexpected event %+v", <-run.notices)
+	}
+}
+
+func TestDumpAudioReportsFailures(t *testing.T) {
+	t.Parallel()
+
+	// The dump directory cannot be created below a file.
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	run := &streamRun{
+		sessionID:  "dump-session",
+		bufferSize: DefaultStageBuffer,
+		notices:    make(chan statuspkg.SessionStatusEvent, noticeBuffer),
+	}
+	in := make(chan media.AudioChunk, 1)
+	in <- media.AudioChunk{SampleRate: 16000, Channels: 1, PCMData: make([]byte, 3200)}
+	close(in)
+
+	forwarded := 0
+	for range dumpAudio(context.Background(), run, &media.AudioDumpConfig{Dir: blocker}, in) {
+		forwarded++
+	}
+	run.wg.Wait()
+
+	if forwarded != 1 {
+		t.Fatalf("expected the audio to pass, got %d chunks", forwarded)
+	}
+	if len(run.notices) != 1 {
+		t.Fatalf("expected one warning, got %d", len(run.notices))
+	}
+	event := <-run.notices
+	if event.State != AudioDumpState || event.Code != statuspkg.CodeAudioDumpFailed || event.Severity != statuspkg.SeverityWarning {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
+
+func TestDumpAudioDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	in := make(chan media.AudioChunk)
+	if out := dumpAudio(context.Background(), &streamRun{}, nil, in); out != (<-chan media.AudioChunk)(in) {
+		t.Fatal("expected the audio channel to be used as is")
+	}
+}
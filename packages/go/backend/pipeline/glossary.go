@@ -0,0 +1,32 @@
+package pipeline
+
+import (
+	sessionpkg "streamlation/packages/backend/session"
+	"streamlation/packages/backend/translation"
+)
+
+// sessionGlossary returns the glossary the session enforces in language:
+// its terms for every language, followed by those for language, which take
+// precedence, and its do-not-translate terms. It returns nil when there
+// are none.
+func sessionGlossary(session sessionpkg.TranslationSession, language string) *translation.Glossary {
+	glossary := session.Options.Glossary
+	if glossary == nil {
+		return nil
+	}
+	var terms []translation.GlossaryTerm
+	for _, term := range glossary.Terms {
+		if term.Language == "" {
+			terms = append(terms, translation.GlossaryTerm{Source: term.Source, Target: term.Target})
+		}
+	}
+	for _, term := range glossary.Terms {
+		if term.Language == language {
+			terms = append(terms, translation.GlossaryTerm{Source: term.Source, Target: term.Target})
+		}
+	}
+	for _, term := range glossary.DoNotTranslate {
+		terms = append(terms, translation.GlossaryTerm{Source: term, Target: term})
+	}
+	return translation.NewGlossary(terms)
+}
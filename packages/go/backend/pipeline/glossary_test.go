@@ -0,0 +1,32 @@
+package pipeline
+
+import (
+	"testing"
+
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+func TestSessionGlossaryAppliesTermsOfLanguage(t *testing.T) {
+	t.Parallel()
+
+	session := sessionpkg.TranslationSession{Options: sessionpkg.TranslationOptions{Glossary: &sessionpkg.Glossary{
+		Terms: []sessionpkg.GlossaryTerm{
+			{Source: "live", Target: "en directo", Language: "es"},
+			{Source: "live", Target: "live"},
+			{Source: "stream", Target: "flux", Language: "fr"},
+		},
+		DoNotTranslate: []string{"Streamlation"},
+	}}}
+
+	glossary := sessionGlossary(session, "es")
+	if got := glossary.Restore(glossary.Protect("Streamlation is live, stream it")); got != "Streamlation is en directo, stream it" {
+		t.Fatalf("unexpected glossary for es: %q", got)
+	}
+	glossary = sessionGlossary(session, "de")
+	if got := glossary.Restore(glossary.Protect("Streamlation is live")); got != "Streamlation is live" || len(glossary.Terms()) != 2 {
+		t.Fatalf("unexpected glossary for de: %q, %+v", got, glossary.Terms())
+	}
+	if sessionGlossary(sessionpkg.TranslationSession{}, "es") != nil {
+		t.Fatal("expected no glossary without terms")
+	}
+}
@@ -0,0 +1,187 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// Counters accumulates throughput for a single pipeline run. Runners find it
+// with CountersFromContext; all methods are safe on a nil receiver so stages
+// can count unconditionally.
+type Counters struct {
+	chunks      atomic.Int64
+	transcripts atomic.Int64
+	subtitles   atomic.Int64
+	dropped     atomic.Int64
+	audio       atomic.Int64
+	// origin is the wall clock time, in Unix nanoseconds, at which media
+	// time zero would have arrived. It is fixed by the first chunk.
+	origin  atomic.Int64
+	latency atomic.Int64
+	now     func() time.Time
+}
+
+func (c *Counters) AddChunks(n int) {
+	if c != nil {
+		c.chunks.Add(int64(n))
+	}
+}
+
+func (c *Counters) AddTranscripts(n int) {
+	if c != nil {
+		c.transcripts.Add(int64(n))
+	}
+}
+
+func (c *Counters) AddSubtitles(n int) {
+	if c != nil {
+		c.subtitles.Add(int64(n))
+	}
+}
+
+// AddDropped records items discarded under backpressure.
+func (c *Counters) AddDropped(n int64) {
+	if c != nil {
+		c.dropped.Add(n)
+	}
+}
+
+// AddAudioSegments records synthesized speech segments.
+func (c *Counters) AddAudioSegments(n int) {
+	if c != nil {
+		c.audio.Add(int64(n))
+	}
+}
+
+// MarkChunk records that the chunk at mediaTime entered the pipeline. The
+// first chunk anchors media time to the wall clock for latency tracking.
+func (c *Counters) MarkChunk(mediaTime time.Duration) {
+	if c != nil {
+		c.origin.CompareAndSwap(0, c.clock().Add(-mediaTime).UnixNano())
+	}
+}
+
+// ObserveOutput records that output covering mediaTime was just emitted and
+// updates the end-to-end latency accordingly. It has no effect before the
+// first chunk is marked.
+func (c *Counters) ObserveOutput(mediaTime time.Duration) {
+	if c == nil {
+		return
+	}
+	origin := c.origin.Load()
+	if origin == 0 {
+		return
+	}
+	latency := c.clock().UnixNano() - (origin + int64(mediaTime))
+	if latency < 0 {
+		latency = 0
+	}
+	c.latency.Store(latency)
+}
+
+// Snapshot returns the current counter values.
+func (c *Counters) Snapshot() statuspkg.Throughput {
+	if c == nil {
+		return statuspkg.Throughput{}
+	}
+	return statuspkg.Throughput{
+		ChunksProcessed:     c.chunks.Load(),
+		TranscriptsProduced: c.transcripts.Load(),
+		SubtitlesEmitted:    c.subtitles.Load(),
+		LatencyMs:           time.Duration(c.latency.Load()).Milliseconds(),
+		ItemsDropped:        c.dropped.Load(),
+		AudioSegments:       c.audio.Load(),
+	}
+}
+
+func (c *Counters) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+type countersKey struct{}
+
+// WithCounters returns a context carrying counters for the runner to update.
+func WithCounters(ctx context.Context, counters *Counters) context.Context {
+	return context.WithValue(ctx, countersKey{}, counters)
+}
+
+// CountersFromContext returns the counters attached to ctx, or nil.
+func CountersFromContext(ctx context.Context) *Counters {
+	counters, _ := ctx.Value(countersKey{}).(*Counters)
+	return counters
+}
+
+// HeartbeatRunner wraps a Runner and emits a heartbeat event with the run's
+// throughput counters, and its provider usage so far, every interval while
+// it is running.
+type HeartbeatRunner struct {
+	next     Runner
+	interval time.Duration
+}
+
+// NewHeartbeatRunner wraps next so that it heartbeats every interval.
+func NewHeartbeatRunner(next Runner, interval time.Duration) *HeartbeatRunner {
+	return &HeartbeatRunner{next: next, interval: interval}
+}
+
+// Run executes the wrapped runner. Emits from the runner and the heartbeat
+// loop are serialized, so emit does not need to be safe for concurrent use.
+func (r *HeartbeatRunner) Run(ctx context.Context, session sessionpkg.TranslationSession, emit func(statuspkg.SessionStatusEvent) error) error {
+	if emit == nil || r.interval <= 0 {
+		return r.next.Run(ctx, session, emit)
+	}
+
+	counters := CountersFromContext(ctx)
+	if counters == nil {
+		counters = &Counters{}
+		ctx = WithCounters(ctx, counters)
+	}
+
+	var mu sync.Mutex
+	serialized := func(event statuspkg.SessionStatusEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return emit(event)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				throughput := counters.Snapshot()
+				_ = serialized(statuspkg.SessionStatusEvent{
+					SessionID:  session.ID,
+					Stage:      "pipeline",
+					State:      statuspkg.HeartbeatState,
+					Timestamp:  time.Now().UTC(),
+					Throughput: &throughput,
+					Usage:      statuspkg.UsageMeterFromContext(ctx).Snapshot(),
+				})
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	err := r.next.Run(ctx, session, serialized)
+	close(stop)
+	wg.Wait()
+	return err
+}
@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+func TestHeartbeatRunnerEmitsHeartbeatsWhileRunning(t *testing.T) {
+	inner := NewSequentialStub([]Step{
+		{Stage: "asr", State: "processing", Delay: 60 * time.Millisecond},
+	})
+	runner := NewHeartbeatRunner(inner, 10*time.Millisecond)
+
+	var mu sync.Mutex
+	var events []statuspkg.SessionStatusEvent
+	emit := func(event statuspkg.SessionStatusEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+		return nil
+	}
+
+	if err := runner.Run(context.Background(), sessionpkg.TranslationSession{ID: "beat"}, emit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mu.Lock()
+	emitted := len(events)
+	mu.Unlock()
+	time.Sleep(30 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != emitted {
+		t.Fatalf("expected no heartbeat after the run finished, got %#v", events[emitted:])
+	}
+
+	heartbeats := 0
+	for _, event := range events {
+		if event.State != statuspkg.HeartbeatState {
+			continue
+		}
+		heartbeats++
+		if event.SessionID != "beat" || event.Throughput == nil {
+			t.Fatalf("unexpected heartbeat: %#v", event)
+		}
+	}
+	if heartbeats == 0 {
+		t.Fatalf("expected at least one heartbeat, got %#v", events)
+	}
+	steps := 0
+	for _, event := range events {
+		if event.Stage == "asr" {
+			steps++
+		}
+	}
+	if steps != 1 {
+		t.Fatalf("expected the wrapped runner's step to be emitted once, got %#v", events)
+	}
+}
+
+func TestHeartbeatRunnerPropagatesRunnerError(t *testing.T) {
+	inner := NewSequentialStub([]Step{{Stage: "asr", State: "processing"}})
+	runner := NewHeartbeatRunner(inner, time.Hour)
+
+	wantErr := errors.New("emit failed")
+	err := runner.Run(context.Background(), sessionpkg.TranslationSession{ID: "beat"}, func(statuspkg.SessionStatusEvent) error {
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+}
+
+func TestTestableRunnerReportsThroughput(t *testing.T) {
+	normalizer := media.NewStubNormalizer(&media.StubNormalizerConfig{
+		ChunkDuration: 100 * time.Millisecond,
+		TotalChunks:   4,
+		SampleRate:    16000,
+	})
+	runner := NewTestableRunner(normalizer, asr.NewStubRecognizer(nil), translation.NewStubTranslator(nil), output.NewStubGenerator())
+
+	counters := &Counters{}
+	ctx := WithCounters(context.Background(), counters)
+	session := sessionpkg.TranslationSession{ID: "count-me", TargetLanguage: "es"}
+	if err := runner.Run(ctx, session, nil); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	got := counters.Snapshot()
+	if got.ChunksProcessed != 4 {
+		t.Fatalf("expected 4 chunks, got %#v", got)
+	}
+	if got.TranscriptsProduced == 0 || got.SubtitlesEmitted == 0 {
+		t.Fatalf("expected transcripts and subtitles to be counted, got %#v", got)
+	}
+}
+
+func TestCountersTrackEndToEndLatency(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	counters := &Counters{now: func() time.Time { return now }}
+
+	counters.ObserveOutput(time.Second)
+	if got := counters.Snapshot().LatencyMs; got != 0 {
+		t.Fatalf("expected no latency before the first chunk, got %d", got)
+	}
+
+	// The first chunk starts at media time 2s, so media time 3s is expected
+	// to arrive one second from now.
+	counters.MarkChunk(2 * time.Second)
+	now = now.Add(2500 * time.Millisecond)
+	counters.ObserveOutput(3 * time.Second)
+	if got := counters.Snapshot().LatencyMs; got != 1500 {
+		t.Fatalf("expected 1500ms latency, got %d", got)
+	}
+
+	// Later chunks do not move the anchor.
+	counters.MarkChunk(10 * time.Second)
+	counters.ObserveOutput(10 * time.Second)
+	if got := counters.Snapshot().LatencyMs; got != 0 {
+		t.Fatalf("expected output ahead of the clock to clamp to 0, got %d", got)
+	}
+}
+
+func TestCountersNilReceiver(t *testing.T) {
+	var counters *Counters
+	counters.AddChunks(1)
+	counters.MarkChunk(time.Second)
+	counters.ObserveOutput(time.Second)
+	if got := counters.Snapshot(); got != (statuspkg.Throughput{}) {
+		t.Fatalf("expected zero snapshot, got %#v", got)
+	}
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"context"
+
+	"streamlation/packages/backend/media"
+)
+
+// smoothTimestamps puts the audio from in back in timestamp order through
+// a jitter buffer configured by cfg, so that transcripts and subtitles are
+// timed from timestamps that only move forwards. The audio still held when
+// in closes is emitted before the returned channel closes. A nil cfg leaves
+// the audio as it is.
+func smoothTimestamps(ctx context.Context, run *streamRun, cfg *media.JitterConfig, in <-chan media.AudioChunk) <-chan media.AudioChunk {
+	if cfg == nil {
+		return in
+	}
+	buffer := media.NewJitterBuffer(*cfg)
+
+	out := make(chan media.AudioChunk, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		send := func(chunks []media.AudioChunk) bool {
+			for _, chunk := range chunks {
+				select {
+				case out <- chunk:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk, ok := <-in:
+				if !ok {
+					send(buffer.Flush())
+					return
+				}
+				if !send(buffer.Push(chunk)) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
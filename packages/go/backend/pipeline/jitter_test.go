@@ -0,0 +1,45 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+func TestSmoothTimestampsReordersAndFlushes(t *testing.T) {
+	t.Parallel()
+
+	in := make(chan media.AudioChunk, 4)
+	for _, ms := range []int{0, 200, 100, 305} {
+		in <- media.AudioChunk{Timestamp: time.Duration(ms) * time.Millisecond, Duration: 100 * time.Millisecond}
+	}
+	close(in)
+
+	run := &streamRun{bufferSize: DefaultStageBuffer}
+	var timestamps []time.Duration
+	for chunk := range smoothTimestamps(context.Background(), run, &media.JitterConfig{}, in) {
+		timestamps = append(timestamps, chunk.Timestamp)
+	}
+	run.wg.Wait()
+
+	want := []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	if len(timestamps) != len(want) {
+		t.Fatalf("timestamps = %v, want %v", timestamps, want)
+	}
+	for i := range want {
+		if timestamps[i] != want[i] {
+			t.Fatalf("timestamps = %v, want %v", timestamps, want)
+		}
+	}
+}
+
+func TestSmoothTimestampsDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	in := make(chan media.AudioChunk)
+	if out := smoothTimestamps(context.Background(), &streamRun{}, nil, in); out != (<-chan media.AudioChunk)(in) {
+		t.Fatal("expected the audio channel to be used as is")
+	}
+}
@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"streamlation/packages/backend/asr"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// LanguageDetectedState marks the event reporting the spoken language
+// identified for a session whose source language is "auto".
+const LanguageDetectedState = "language-detected"
+
+// languageVotes is how many consecutive final transcripts must report the
+// same language before a session is locked to it, so that a misjudged
+// first segment, such as music or a short interjection, does not decide.
+const languageVotes = 2
+
+// newLanguageLock returns the language lock of a session with the given
+// source language, or nil when the session leaves the language to the
+// recognizer.
+func newLanguageLock(language string) *asr.LanguageLock {
+	switch language {
+	case "":
+		return nil
+	case sessionpkg.AutoSourceLanguage:
+		return asr.NewLanguageLock("")
+	default:
+		return asr.NewLanguageLock(language)
+	}
+}
+
+// identifyLanguage locks lock to the language of the transcripts from in
+// once languageVotes consecutive final transcripts agree on it, and reports
+// it in an asr "language-detected" event. Transcripts from then on carry
+// the locked language. Without a lock, in is returned unchanged.
+func identifyLanguage(ctx context.Context, run *streamRun, lock *asr.LanguageLock, in <-chan asr.Transcript) <-chan asr.Transcript {
+	if lock == nil {
+		return in
+	}
+
+	out := make(chan asr.Transcript, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+
+		var (
+			candidate string
+			votes     int
+		)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case transcript, ok := <-in:
+				if !ok {
+					return
+				}
+				if locked := lock.Language(); locked != "" {
+					transcript.Language = locked
+				} else if !transcript.Partial && transcript.Language != "" {
+					if transcript.Language != candidate {
+						candidate, votes = transcript.Language, 0
+					}
+					votes++
+					if votes >= languageVotes && lock.Lock(candidate) {
+						run.notify(ctx, statuspkg.SessionStatusEvent{
+							Stage:  "asr",
+							State:  LanguageDetectedState,
+							Detail: fmt.Sprintf("Detected spoken language %s; transcribing in it from now on", candidate),
+						})
+					}
+				}
+				select {
+				case out <- transcript:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,68 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"streamlation/packages/backend/asr"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestIdentifyLanguageLocksAgreedLanguage(t *testing.T) {
+	t.Parallel()
+
+	run := &streamRun{
+		sessionID:  "language-session",
+		bufferSize: DefaultStageBuffer,
+		notices:    make(chan statuspkg.SessionStatusEvent, noticeBuffer),
+	}
+	transcripts := []asr.Transcript{
+		{Text: "♪", Language: "en"},
+		{Text: "hola", Language: "es", Partial: true},
+		{Text: "hola", Language: "es"},
+		{Text: "buenos días", Language: "es"},
+		{Text: "bonjour", Language: "fr"},
+	}
+	in := make(chan asr.Transcript, len(transcripts))
+	for _, transcript := range transcripts {
+		in <- transcript
+	}
+	close(in)
+
+	lock := newLanguageLock("auto")
+	var languages []string
+	for transcript := range identifyLanguage(context.Background(), run, lock, in) {
+		languages = append(languages, transcript.Language)
+	}
+	run.wg.Wait()
+
+	// Two final transcripts in Spanish lock the session; later ones are
+	// labelled with it.
+	if want := []string{"en", "es", "es", "es", "es"}; !reflect.DeepEqual(languages, want) {
+		t.Fatalf("expected languages %v, got %v", want, languages)
+	}
+	if lock.Language() != "es" {
+		t.Fatalf("expected the session to be locked to es, got %q", lock.Language())
+	}
+	if len(run.notices) != 1 {
+		t.Fatalf("expected one event, got %d", len(run.notices))
+	}
+	if event := <-run.notices; event.Stage != "asr" || event.State != LanguageDetectedState {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
+
+func TestNewLanguageLock(t *testing.T) {
+	t.Parallel()
+
+	if newLanguageLock("") != nil {
+		t.Fatal("expected no lock without a source language")
+	}
+	if lock := newLanguageLock("auto"); lock == nil || lock.Language() != "" {
+		t.Fatal("expected an empty lock for auto")
+	}
+	if lock := newLanguageLock("de"); lock == nil || lock.Language() != "de" || lock.Lock("fr") {
+		t.Fatal("expected a lock set to the source language")
+	}
+}
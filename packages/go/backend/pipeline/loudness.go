@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"context"
+
+	"streamlation/packages/backend/media"
+)
+
+// normalizeLoudness brings the audio from in to the loudness of cfg before
+// recognition, recording the measured loudness and applied gain on every
+// chunk. A nil cfg leaves the audio as it is.
+func normalizeLoudness(ctx context.Context, run *streamRun, cfg *media.LoudnessConfig, in <-chan media.AudioChunk) <-chan media.AudioChunk {
+	if cfg == nil {
+		return in
+	}
+	normalizer := media.NewLoudnessNormalizer(*cfg)
+
+	out := make(chan media.AudioChunk, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- normalizer.Process(chunk):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
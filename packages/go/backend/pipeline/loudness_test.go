@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+func TestNormalizeLoudnessAppliesGain(t *testing.T) {
+	t.Parallel()
+
+	// A 1kHz sine peaking at 0.05 measures about -29 LUFS.
+	const rate = 16000
+	in := make(chan media.AudioChunk, 20)
+	for c := 0; c < cap(in); c++ {
+		pcm := make([]byte, rate/5)
+		for i := 0; i < len(pcm)/2; i++ {
+			n := c*len(pcm)/2 + i
+			sample := 0.05 * math.Sin(2*math.Pi*1000*float64(n)/rate)
+			binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(sample*32767)))
+		}
+		in <- media.AudioChunk{Timestamp: time.Duration(c) * 100 * time.Millisecond, SampleRate: rate, Channels: 1, PCMData: pcm, Duration: 100 * time.Millisecond}
+	}
+	close(in)
+
+	run := &streamRun{bufferSize: DefaultStageBuffer}
+	var last media.AudioChunk
+	for chunk := range normalizeLoudness(context.Background(), run, &media.LoudnessConfig{}, in) {
+		last = chunk
+	}
+	run.wg.Wait()
+
+	if math.Abs(last.Loudness+29) > 0.5 || math.Abs(last.Gain-6) > 0.5 {
+		t.Fatalf("expected about -29 LUFS raised by 6 dB, got %.2f LUFS and %.2f dB", last.Loudness, last.Gain)
+	}
+}
+
+func TestNormalizeLoudnessDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	in := make(chan media.AudioChunk)
+	if out := normalizeLoudness(context.Background(), &streamRun{}, nil, in); out != (<-chan media.AudioChunk)(in) {
+		t.Fatal("expected the audio channel to be used as is")
+	}
+}
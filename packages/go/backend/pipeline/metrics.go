@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/metrics"
+)
+
+// StageLatencyBuckets are the histogram upper bounds, in seconds, used for
+// stage latencies.
+var StageLatencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// StageMetrics instruments the stages of streaming runs per session: how
+// many items each stage produced, how many items wait in its input queue,
+// and how long it took to answer its input. The branches of a
+// multi-language session add up. A session's series are removed when its
+// run ends. A nil *StageMetrics records nothing.
+type StageMetrics struct {
+	processed *metrics.Counter
+	latency   *metrics.Histogram
+
+	mu     sync.Mutex
+	queues map[stageSeriesKey][]func() int
+}
+
+type stageSeriesKey struct {
+	sessionID string
+	stage     string
+}
+
+// NewStageMetrics returns an empty set of stage metrics.
+func NewStageMetrics() *StageMetrics {
+	return &StageMetrics{
+		processed: metrics.NewCounter("streamlation_pipeline_stage_items_processed_total", "Items produced by each pipeline stage.", "session", "stage"),
+		latency:   metrics.NewHistogram("streamlation_pipeline_stage_latency_seconds", "Time each pipeline stage held input before producing output.", StageLatencyBuckets, "session", "stage"),
+		queues:    make(map[stageSeriesKey][]func() int),
+	}
+}
+
+// trackQueue samples depth for the stage's queue depth whenever metrics are
+// written.
+func (m *StageMetrics) trackQueue(sessionID, stage string, depth func() int) {
+	if m == nil {
+		return
+	}
+	// The stage is listed, with nothing processed, until its first item.
+	m.processed.Add(0, sessionID, stage)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := stageSeriesKey{sessionID: sessionID, stage: stage}
+	m.queues[key] = append(m.queues[key], depth)
+}
+
+// observe counts an item the stage produced. A positive latency is how long
+// the stage held the input it answered.
+func (m *StageMetrics) observe(sessionID, stage string, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.processed.Inc(sessionID, stage)
+	if latency > 0 {
+		m.latency.ObserveDuration(latency, sessionID, stage)
+	}
+}
+
+// forget removes the series of a session whose run has ended.
+func (m *StageMetrics) forget(sessionID string) {
+	if m == nil {
+		return
+	}
+	m.processed.DeletePrefix(sessionID)
+	m.latency.DeletePrefix(sessionID)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.queues {
+		if key.sessionID == sessionID {
+			delete(m.queues, key)
+		}
+	}
+}
+
+// queueDepths samples the queues of every stage into a gauge.
+func (m *StageMetrics) queueDepths() *metrics.Gauge {
+	depths := metrics.NewGauge("streamlation_pipeline_stage_queue_depth", "Items waiting in each pipeline stage's input queue.", "session", "stage")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, queues := range m.queues {
+		for _, depth := range queues {
+			depths.Add(float64(depth()), key.sessionID, key.stage)
+		}
+	}
+	return depths
+}
+
+// WriteMetrics writes the stage metrics in the Prometheus text exposition
+// format.
+func (m *StageMetrics) WriteMetrics(w io.Writer) error {
+	for _, collector := range []metrics.Collector{m.processed, m.queueDepths(), m.latency} {
+		if err := collector.WriteMetrics(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
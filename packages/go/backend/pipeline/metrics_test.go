@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	"streamlation/packages/backend/translation"
+)
+
+func TestStageMetricsWritesPrometheusText(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewStageMetrics()
+	metrics.trackQueue("s-1", "asr", func() int { return 2 })
+	metrics.trackQueue("s-1", "asr", func() int { return 3 })
+	metrics.observe("s-1", "asr", 200*time.Millisecond)
+	metrics.observe("s-1", "asr", 0)
+
+	var b strings.Builder
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	text := b.String()
+	for _, want := range []string{
+		"# TYPE streamlation_pipeline_stage_items_processed_total counter\n",
+		`streamlation_pipeline_stage_items_processed_total{session="s-1",stage="asr"} 2`,
+		`streamlation_pipeline_stage_queue_depth{session="s-1",stage="asr"} 5`,
+		`streamlation_pipeline_stage_latency_seconds_bucket{session="s-1",stage="asr",le="0.1"} 0`,
+		`streamlation_pipeline_stage_latency_seconds_bucket{session="s-1",stage="asr",le="0.25"} 1`,
+		`streamlation_pipeline_stage_latency_seconds_count{session="s-1",stage="asr"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in metrics:\n%s", want, text)
+		}
+	}
+
+	metrics.forget("s-1")
+	b.Reset()
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	if strings.Contains(b.String(), "s-1") {
+		t.Fatalf("expected forgotten session to be removed:\n%s", b.String())
+	}
+}
+
+func TestStreamingRunnerRecordsStageMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewStageMetrics()
+	var during string
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{DefaultLanguage: "en"}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		BufferSize: 2,
+		Output: OutputConfig{
+			OnSubtitle: func(context.Context, output.SubtitleEvent) error {
+				if during == "" {
+					var b strings.Builder
+					if err := metrics.WriteMetrics(&b); err != nil {
+						return err
+					}
+					during = b.String()
+				}
+				return nil
+			},
+		},
+		Metrics: MetricsConfig{
+			Stages: metrics,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	if err := runner.Run(context.Background(), streamingSession(), nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	for _, stage := range streamingStages {
+		want := `streamlation_pipeline_stage_items_processed_total{session="stream-session",stage="` + stage + `"} `
+		if !strings.Contains(during, want) {
+			t.Fatalf("expected %s to be instrumented while running:\n%s", stage, during)
+		}
+	}
+	if !strings.Contains(during, `streamlation_pipeline_stage_latency_seconds_count{session="stream-session",stage="asr"}`) {
+		t.Fatalf("expected asr latency while running:\n%s", during)
+	}
+
+	var b strings.Builder
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	if strings.Contains(b.String(), "stream-session") {
+		t.Fatalf("expected the session's series to be removed after the run:\n%s", b.String())
+	}
+}
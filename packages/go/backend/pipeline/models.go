@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// acquireModel takes a lease on the model of profile from models and loads
+// it into the recognizer, reporting a warmup the session waits for as asr
+// "model-loading" and "model-loaded" events through emit. Without models or
+// a profile it does nothing and returns a nil lease. A model that does not
+// fit the memory budget fails with a retryable error.
+func acquireModel(ctx context.Context, models *asr.ModelManager, recognizer asr.Recognizer, sessionID, profile string, emit func(statuspkg.SessionStatusEvent) error) (*asr.ModelLease, error) {
+	if models == nil || profile == "" {
+		return nil, nil
+	}
+	var emitErr error
+	lease, err := models.Acquire(ctx, asr.ModelProfile(profile), func(warmup asr.ModelWarmup) {
+		event := statuspkg.SessionStatusEvent{
+			SessionID: sessionID,
+			Stage:     "asr",
+			State:     statuspkg.ModelLoadingState,
+			Detail:    fmt.Sprintf("loading model %s for profile %s", warmup.Model, warmup.Profile),
+			Timestamp: time.Now().UTC(),
+		}
+		if warmup.Loaded {
+			event.State = statuspkg.ModelLoadedState
+			event.Detail = fmt.Sprintf("loaded model %s for profile %s in %s", warmup.Model, warmup.Profile, warmup.Elapsed.Round(time.Millisecond))
+		}
+		if err := emit(event); err != nil && emitErr == nil {
+			emitErr = err
+		}
+	})
+	if err != nil {
+		return nil, &statuspkg.StageError{Code: statuspkg.CodeASRModelLoadFailed, Retryable: errors.Is(err, asr.ErrModelBudget), Err: err}
+	}
+	if emitErr != nil {
+		lease.Release()
+		return nil, emitErr
+	}
+	if err := recognizer.LoadModel(asr.ModelProfile(profile)); err != nil {
+		lease.Release()
+		return nil, &statuspkg.StageError{Code: statuspkg.CodeASRModelLoadFailed, Err: fmt.Errorf("load model profile %s: %w", profile, err)}
+	}
+	return lease, nil
+}
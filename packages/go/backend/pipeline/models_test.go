@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+func TestStreamingRunnerWarmsUpSessionModel(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, size := range map[string]int{"base.bin": 64, "large.bin": 256} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o600); err != nil {
+			t.Fatalf("write model: %v", err)
+		}
+	}
+	models := asr.NewModelManager(asr.ModelManagerConfig{
+		Models: map[asr.ModelProfile]string{
+			asr.ModelCPUBasic: filepath.Join(dir, "base.bin"),
+			asr.ModelGPU:      filepath.Join(dir, "large.bin"),
+		},
+		Budget: 128,
+	})
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("hello")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{DefaultLanguage: "en"}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		Recognition: RecognitionConfig{
+			Models: models,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	run := func(profile string) ([]statuspkg.SessionStatusEvent, error) {
+		session := streamingSession()
+		session.Options.ModelProfile = profile
+		var events []statuspkg.SessionStatusEvent
+		err := runner.Run(context.Background(), session, func(event statuspkg.SessionStatusEvent) error {
+			events = append(events, event)
+			return nil
+		})
+		return events, err
+	}
+
+	events, err := run(string(asr.ModelCPUBasic))
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(events) < 2 || events[0].State != statuspkg.ModelLoadingState || events[1].State != statuspkg.ModelLoadedState || events[1].Stage != "asr" {
+		t.Fatalf("expected the model warmup before the run, got %+v", events)
+	}
+	if loaded := models.Loaded(); loaded[filepath.Join(dir, "base.bin")] != 0 {
+		t.Fatalf("expected the model released but kept loaded, got %v", loaded)
+	}
+
+	// The warm model is reused without events.
+	events, err = run(string(asr.ModelCPUBasic))
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	for _, event := range events {
+		if event.State == statuspkg.ModelLoadingState {
+			t.Fatalf("expected no warmup for a loaded model, got %+v", event)
+		}
+	}
+
+	// A model beyond the budget fails the session, retryably.
+	events, err = run(string(asr.ModelGPU))
+	if !errors.Is(err, asr.ErrModelBudget) {
+		t.Fatalf("expected the budget to be enforced, got %v", err)
+	}
+	last := events[len(events)-1]
+	if last.Stage != "asr" || last.State != "failed" || last.Code != statuspkg.CodeASRModelLoadFailed || !last.Retryable {
+		t.Fatalf("expected a retryable model load failure, got %+v", last)
+	}
+}
@@ -0,0 +1,286 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// DefaultOpenCaptionDelay is how far the open-caption variant of a
+// streaming run lags its source audio when OutputConfig.OpenCaptionDelay is
+// not set.
+const DefaultOpenCaptionDelay = 10 * time.Second
+
+// OpenCaptionState marks the warning a run emits when burning in or
+// publishing its open captions fails.
+const OpenCaptionState = "open_captions"
+
+// openCaptionInterval is how often a run burns the source segments its
+// source audio has aged past.
+const openCaptionInterval = time.Second
+
+// openCaptionFinishTimeout bounds burning the segments still pending when
+// a run ends, which takes a run of ffmpeg each.
+const openCaptionFinishTimeout = 30 * time.Second
+
+// openCaptionTrack republishes the segments of a run's HLS source with the
+// subtitles of its first target language burned in, as the HLS variant
+// "<session>/hls/burned-<language>.m3u8". The variant starts where the
+// run's source audio does, and a segment is burned once the source audio
+// is the delay past its end, so that the translations of the speech in it
+// have arrived. Sources other than HLS have no segments to republish.
+//
+// A failure to burn or publish is reported once as a warning and stops the
+// publishing; it never fails the run. A nil track publishes nothing.
+type openCaptionTrack struct {
+	cfg       output.OpenCaptionConfig
+	sessionID string
+	language  string
+	delay     time.Duration
+	emit      func(statuspkg.SessionStatusEvent) error
+
+	// mu guards the variant, which opens with the run's first source
+	// audio, the segments the source delivers before it does, the time of
+	// the source audio, and how failures are reported: through the run's
+	// notices while it runs, as they come from its stages.
+	mu             sync.Mutex
+	report         func(statuspkg.SessionStatusEvent) error
+	variant        *output.OpenCaptionVariant
+	initialization []byte
+	early          []ingestion.MediaChunk
+	latest         time.Duration
+	failed         bool
+
+	// done is closed once the background publishing has stopped.
+	done chan struct{}
+}
+
+// startOpenCaptions returns the open-caption track of a run of session,
+// or nil when open captions are not published.
+func (r *StreamingRunner) startOpenCaptions(sessionID string, languages []string, emit func(statuspkg.SessionStatusEvent) error) *openCaptionTrack {
+	if r.config.Output.OpenCaptions == nil || len(languages) == 0 {
+		return nil
+	}
+	cfg := *r.config.Output.OpenCaptions
+	cfg.Key = sessionID + "/hls/burned-" + languages[0] + ".m3u8"
+	return &openCaptionTrack{
+		cfg:       cfg,
+		sessionID: sessionID,
+		language:  languages[0],
+		delay:     r.config.Output.OpenCaptionDelay,
+		emit:      emit,
+		report:    emit,
+	}
+}
+
+// attach forwards the source chunks, keeping the segments among them, and
+// burns and publishes the variant in the background until ctx ends.
+func (t *openCaptionTrack) attach(ctx context.Context, run *streamRun, in <-chan ingestion.MediaChunk) <-chan ingestion.MediaChunk {
+	if t == nil {
+		return in
+	}
+	t.mu.Lock()
+	t.report = func(event statuspkg.SessionStatusEvent) error {
+		run.notify(ctx, event)
+		return nil
+	}
+	t.mu.Unlock()
+
+	out := make(chan ingestion.MediaChunk, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		for chunk := range in {
+			t.segment(chunk)
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	t.done = make(chan struct{})
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(t.done)
+		ticker := time.NewTicker(openCaptionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := t.publish(ctx); err != nil {
+					// A run that is stopping kills the ffmpeg in flight; its
+					// segment is burned again when the track finishes.
+					if ctx.Err() != nil {
+						return
+					}
+					t.fail(err)
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// segment keeps chunk when it is a segment of an HLS source.
+func (t *openCaptionTrack) segment(chunk ingestion.MediaChunk) {
+	if chunk.Metadata["mediaSequence"] == "" {
+		return
+	}
+	if err := t.keep(chunk); err != nil {
+		t.fail(err)
+	}
+}
+
+func (t *openCaptionTrack) keep(chunk ingestion.MediaChunk) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if chunk.Metadata["initialization"] == "true" {
+		t.initialization = chunk.Payload
+		return nil
+	}
+	if t.failed || chunk.Duration <= 0 {
+		return nil
+	}
+	if t.variant == nil {
+		t.early = append(t.early, chunk)
+		return nil
+	}
+	return t.add(chunk)
+}
+
+// add adds chunk to the variant, after the initialization segment of a
+// fragmented MP4 source. t.mu must be held.
+func (t *openCaptionTrack) add(chunk ingestion.MediaChunk) error {
+	data := chunk.Payload
+	if len(t.initialization) > 0 {
+		data = append(append([]byte{}, t.initialization...), chunk.Payload...)
+	}
+	if err := t.variant.AddSegment(data, chunk.Duration); err != nil {
+		return fmt.Errorf("add %s open-caption segment: %w", t.language, err)
+	}
+	return nil
+}
+
+// audio marks the time of the source audio, opening the variant with its
+// first chunk.
+func (t *openCaptionTrack) audio(chunk media.AudioChunk) {
+	if t == nil {
+		return
+	}
+	if err := t.open(chunk); err != nil {
+		t.fail(err)
+	}
+}
+
+func (t *openCaptionTrack) open(chunk media.AudioChunk) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.latest = max(t.latest, chunk.Timestamp+chunk.Duration)
+	if t.variant != nil || t.failed {
+		return nil
+	}
+	cfg := t.cfg
+	cfg.Start = chunk.Timestamp
+	variant, err := output.NewOpenCaptionVariant(cfg)
+	if err != nil {
+		return fmt.Errorf("open %s open captions: %w", t.language, err)
+	}
+	t.variant = variant
+	early := t.early
+	t.early = nil
+	for _, chunk := range early {
+		if err := t.add(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subtitle adds event to the variant when it is in the burned language.
+func (t *openCaptionTrack) subtitle(event output.SubtitleEvent) {
+	if t == nil || event.Language != t.language {
+		return
+	}
+	t.mu.Lock()
+	variant, failed := t.variant, t.failed
+	t.mu.Unlock()
+	if variant == nil || failed {
+		return
+	}
+	if err := variant.Write(event); err != nil {
+		t.fail(fmt.Errorf("publish %s open captions: %w", t.language, err))
+	}
+}
+
+// publish burns and publishes the segments the source audio is the delay
+// past.
+func (t *openCaptionTrack) publish(ctx context.Context) error {
+	t.mu.Lock()
+	variant, until, failed := t.variant, t.latest-t.delay, t.failed
+	t.mu.Unlock()
+	if variant == nil || failed {
+		return nil
+	}
+	if err := variant.Publish(ctx, until); err != nil {
+		return fmt.Errorf("publish %s open captions: %w", t.language, err)
+	}
+	return nil
+}
+
+// finish waits for the background publishing to stop, then burns and
+// publishes the rest of the segments and ends the variant.
+func (t *openCaptionTrack) finish(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	if t.done != nil {
+		<-t.done
+	}
+	t.mu.Lock()
+	t.report = t.emit
+	variant, failed := t.variant, t.failed
+	t.mu.Unlock()
+	if variant == nil || failed {
+		return
+	}
+	// The run's context is usually cancelled by now.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), openCaptionFinishTimeout)
+	defer cancel()
+	if err := variant.Close(ctx); err != nil {
+		t.fail(fmt.Errorf("publish %s open captions: %w", t.language, err))
+	}
+}
+
+// fail reports err, unless a failure was reported already, and stops
+// publishing.
+func (t *openCaptionTrack) fail(err error) {
+	t.mu.Lock()
+	failed, report := t.failed, t.report
+	t.failed = true
+	t.mu.Unlock()
+	if failed {
+		return
+	}
+	_ = report(statuspkg.SessionStatusEvent{
+		SessionID: t.sessionID,
+		Stage:     "pipeline",
+		State:     OpenCaptionState,
+		Detail:    err.Error(),
+		Code:      statuspkg.CodeOutputFailed,
+		Severity:  statuspkg.SeverityWarning,
+		Timestamp: time.Now().UTC(),
+	})
+}
@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/archive"
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// TestFFmpegHelperProcess stands in for ffmpeg when the test binary is run
+// as the command of a run's open captions. It writes its input followed by
+// the cues it was given, and fails inputs that hold "corrupt".
+func TestFFmpegHelperProcess(t *testing.T) {
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return
+	}
+	input, err := os.ReadFile("in")
+	if err != nil || strings.Contains(string(input), "corrupt") {
+		os.Stderr.WriteString("in: Invalid data found when processing input\n")
+		os.Exit(1)
+	}
+	cues, _ := os.ReadFile("cues.srt")
+	if err := os.WriteFile(args[len(args)-1], append(input, cues...), 0o600); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func runOpenCaptions(t *testing.T, store output.ObjectStore, payloads ...string) []statuspkg.SessionStatusEvent {
+	t.Helper()
+	source := &stubSource{duration: 100 * time.Millisecond, metadata: make(map[int]map[string]string)}
+	for i, payload := range payloads {
+		source.payloads = append(source.payloads, []byte(payload))
+		source.metadata[i] = map[string]string{"mediaSequence": "1"}
+	}
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return source, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		Output: OutputConfig{
+			OpenCaptions: &output.OpenCaptionConfig{
+				Store:   store,
+				Command: []string{os.Args[0], "-test.run=TestFFmpegHelperProcess", "--"},
+				TempDir: t.TempDir(),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	var warnings []statuspkg.SessionStatusEvent
+	err = runner.Run(context.Background(), streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		if event.State == OpenCaptionState {
+			warnings = append(warnings, event)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected open captions not to fail the run, got %v", err)
+	}
+	return warnings
+}
+
+func TestStreamingRunnerBurnsInOpenCaptions(t *testing.T) {
+	t.Parallel()
+
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	if warnings := runOpenCaptions(t, store, "first ", "second ", "third"); len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %+v", warnings)
+	}
+
+	playlist := readObject(t, store, "stream-session/hls/burned-es.m3u8")
+	if !strings.HasSuffix(playlist, "#EXT-X-ENDLIST\n") || strings.Count(playlist, "#EXTINF:0.100,") != 3 {
+		t.Fatalf("expected an ended playlist of the three source segments, got %q", playlist)
+	}
+	segment := readObject(t, store, "stream-session/hls/burned-es/00000.ts")
+	if !strings.HasPrefix(segment, "first ") || !strings.Contains(segment, " --> ") {
+		t.Fatalf("expected the first segment with its cues burned in, got %q", segment)
+	}
+}
+
+func TestStreamingRunnerReportsOpenCaptionFailuresOnce(t *testing.T) {
+	t.Parallel()
+
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	warnings := runOpenCaptions(t, store, "corrupt ", "second ")
+	if len(warnings) != 1 || warnings[0].Code != statuspkg.CodeOutputFailed || warnings[0].Severity != statuspkg.SeverityWarning {
+		t.Fatalf("expected a single open caption warning, got %+v", warnings)
+	}
+	if !strings.Contains(warnings[0].Detail, "Invalid data found when processing input") {
+		t.Fatalf("expected the warning to name the failure, got %q", warnings[0].Detail)
+	}
+}
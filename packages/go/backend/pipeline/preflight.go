@@ -0,0 +1,195 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	sessionpkg "streamlation/packages/backend/session"
+	"streamlation/packages/backend/tts"
+)
+
+// PreflightReport is the outcome of a dry run of a session's pipeline.
+type PreflightReport struct {
+	// Ready is set when every stage was built and reports itself healthy.
+	Ready  bool         `json:"ready"`
+	Stages []StageCheck `json:"stages"`
+	// EstimatedStartupMs is how long building the stages and loading the
+	// ASR model took, approximating how long a run needs before it can
+	// process the first audio.
+	EstimatedStartupMs int64 `json:"estimatedStartupMs"`
+	// Warnings list limitations that do not prevent the session from
+	// running, such as a target language the translator does not list.
+	Warnings []string `json:"warnings,omitempty"`
+	// Source describes the media of the session's source. It is only set
+	// by PreflightSource, once the source answered its probe.
+	Source *ingestion.SourceProbe `json:"source,omitempty"`
+}
+
+// StageCheck reports on one stage of a dry run.
+type StageCheck struct {
+	Stage          string `json:"stage"`
+	Implementation string `json:"implementation,omitempty"`
+	Healthy        bool   `json:"healthy"`
+	Message        string `json:"message,omitempty"`
+	// ModelLoaded reports whether the ASR model of the session's profile
+	// is available. It is only set for the asr stage.
+	ModelLoaded *bool `json:"modelLoaded,omitempty"`
+	StartupMs   int64 `json:"startupMs"`
+}
+
+// Preflight constructs the pipeline session would run with, as definition
+// declares it, and checks every stage's health and the availability of the
+// session's ASR model. It never opens the session's source; PreflightSource
+// does.
+func Preflight(registry *Registry, definition Definition, session sessionpkg.TranslationSession) PreflightReport {
+	selection := definition.sessionSelection(session)
+	options := definition.Profile(session.Options.ModelProfile).Options()
+
+	report := PreflightReport{Ready: true}
+	var components Components
+	for _, stage := range ConfigurableStages {
+		check := StageCheck{Stage: stage, Implementation: selection[stage]}
+		started := time.Now()
+		var err error
+		if check.Implementation == "" {
+			err = fmt.Errorf("no implementation selected for %s", stage)
+		} else {
+			err = registry.buildStage(&components, stage, check.Implementation, session, options[stage])
+		}
+		if err == nil {
+			err = checkStage(&check, components, session)
+		}
+		check.StartupMs = time.Since(started).Milliseconds()
+		if err != nil {
+			check.Healthy, check.Message = false, err.Error()
+		}
+		report.Ready = report.Ready && check.Healthy
+		report.EstimatedStartupMs += check.StartupMs
+		report.Stages = append(report.Stages, check)
+	}
+	report.Warnings = preflightWarnings(components, session)
+	return report
+}
+
+// PreflightSource runs Preflight and also opens the session's source with
+// sources and probes it. The probe is reported as an ingestion check ahead
+// of the stages, and the media it found in the report's Source. A source
+// whose type cannot be probed passes the check undescribed.
+func PreflightSource(ctx context.Context, registry *Registry, definition Definition, sources SourceFactory, session sessionpkg.TranslationSession) PreflightReport {
+	report := Preflight(registry, definition, session)
+
+	check := StageCheck{Stage: "ingestion", Implementation: session.Source.Type, Healthy: true}
+	started := time.Now()
+	source, err := sources(session)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+		defer cancel()
+		var probe ingestion.SourceProbe
+		probe, err = ingestion.ProbeSource(ctx, source)
+		switch {
+		case err == nil:
+			report.Source = &probe
+		case errors.Is(err, ingestion.ErrProbeUnsupported):
+			check.Message, err = err.Error(), nil
+		}
+	}
+	check.StartupMs = time.Since(started).Milliseconds()
+	if err != nil {
+		check.Healthy, check.Message = false, err.Error()
+	}
+	report.Ready = report.Ready && check.Healthy
+	report.EstimatedStartupMs += check.StartupMs
+	report.Stages = append([]StageCheck{check}, report.Stages...)
+	return report
+}
+
+// checkStage fills check from the health of the stage's component, loading
+// the session's ASR model first.
+func checkStage(check *StageCheck, components Components, session sessionpkg.TranslationSession) error {
+	switch check.Stage {
+	case "normalization":
+		health := components.Normalizer.Health()
+		check.Healthy, check.Message = health.Healthy, health.Message
+	case "asr":
+		if profile := session.Options.ModelProfile; profile != "" {
+			if err := components.Recognizer.LoadModel(asr.ModelProfile(profile)); err != nil {
+				return fmt.Errorf("load model %s: %w", profile, err)
+			}
+		}
+		health := components.Recognizer.Health()
+		check.Healthy, check.Message = health.Healthy, health.Message
+		check.ModelLoaded = &health.ModelLoaded
+		if session.Options.ModelProfile != "" && !health.ModelLoaded {
+			check.Healthy = false
+		}
+	case "translation":
+		health := components.Translator.Health()
+		check.Healthy, check.Message = health.Healthy, health.Message
+	case "output":
+		health := components.Generator.Health()
+		check.Healthy, check.Message = health.Healthy, health.Message
+	case "dubbing":
+		health := components.Synthesizer.Health()
+		check.Healthy, check.Message = health.Healthy, health.Message
+	}
+	return nil
+}
+
+// preflightWarnings lists the session's target languages the translator
+// does not list as targets and, with dubbing enabled, those the
+// synthesizer has no voice for and those it does not offer the session's
+// voice for.
+func preflightWarnings(components Components, session sessionpkg.TranslationSession) []string {
+	var warnings []string
+	if components.Translator != nil {
+		if pairs := components.Translator.SupportedLanguages(); len(pairs) > 0 {
+			var unsupported []string
+			for _, language := range session.TargetLanguages() {
+				supported := false
+				for _, pair := range pairs {
+					supported = supported || pair.Target == language
+				}
+				if !supported {
+					unsupported = append(unsupported, language)
+				}
+			}
+			if len(unsupported) > 0 {
+				warnings = append(warnings, "translator does not list target languages "+strings.Join(unsupported, ", "))
+			}
+		}
+	}
+	if components.Synthesizer != nil && session.Options.EnableDubbing {
+		var voiceless, unvoiced []string
+		for _, language := range session.TargetLanguages() {
+			voices := components.Synthesizer.AvailableVoices(language)
+			if len(voices) == 0 {
+				voiceless = append(voiceless, language)
+			} else if id := session.Options.VoiceID; id != "" && !tts.OffersVoice(voices, id) {
+				unvoiced = append(unvoiced, language)
+			}
+		}
+		if len(voiceless) > 0 {
+			warnings = append(warnings, "no dubbing voice for "+strings.Join(voiceless, ", "))
+		}
+		if len(unvoiced) > 0 {
+			warnings = append(warnings, "voice "+session.Options.VoiceID+" not offered for "+strings.Join(unvoiced, ", ")+", dubbed in another voice")
+		}
+	}
+	return warnings
+}
+
+// Preflight dry-runs the pipeline the runner would build for session.
+func (r *ConfiguredRunner) Preflight(session sessionpkg.TranslationSession) PreflightReport {
+	return Preflight(r.registry, r.definition, session)
+}
+
+// PreflightSource dry-runs the pipeline the runner would build for session
+// and probes the source the runner would open for it.
+func (r *ConfiguredRunner) PreflightSource(ctx context.Context, session sessionpkg.TranslationSession) PreflightReport {
+	return PreflightSource(ctx, r.registry, r.definition, r.base.Sources, session)
+}
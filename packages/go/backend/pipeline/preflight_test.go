@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+// missingModelRecognizer fails to load any model.
+type missingModelRecognizer struct {
+	*asr.StubRecognizer
+}
+
+func (missingModelRecognizer) LoadModel(profile asr.ModelProfile) error {
+	return errors.New("model files not found")
+}
+
+func stubDefinition() Definition {
+	definition := Definition{Stages: make(map[string]StageDefinition)}
+	for _, stage := range ConfigurableStages {
+		definition.Stages[stage] = StageDefinition{Implementation: StubImplementation}
+	}
+	return definition
+}
+
+func TestPreflightReportsHealthyPipeline(t *testing.T) {
+	t.Parallel()
+
+	session := streamingSession()
+	session.Options.ModelProfile = string(asr.ModelCPUBasic)
+	session.Options.EnableDubbing = true
+	session.Options.AdditionalLanguages = []string{"fr", "de"}
+
+	report := Preflight(newStubRegistry(t), stubDefinition(), session)
+	if !report.Ready {
+		t.Fatalf("expected stub pipeline to be ready, got %+v", report)
+	}
+	if len(report.Stages) != len(ConfigurableStages) {
+		t.Fatalf("expected a check per stage, got %+v", report.Stages)
+	}
+	for i, check := range report.Stages {
+		if check.Stage != ConfigurableStages[i] || check.Implementation != StubImplementation || !check.Healthy {
+			t.Fatalf("unexpected check %+v", check)
+		}
+	}
+	if loaded := report.Stages[1].ModelLoaded; loaded == nil || !*loaded {
+		t.Fatalf("expected the asr model to be loaded, got %v", loaded)
+	}
+	if len(report.Warnings) != 2 || !strings.Contains(report.Warnings[0], "de") || !strings.Contains(report.Warnings[1], "de") {
+		t.Fatalf("expected translation and voice warnings for de, got %v", report.Warnings)
+	}
+}
+
+func TestPreflightReportsUnavailableModelAndUnknownImplementation(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	if err := registry.RegisterRecognizer("missing", func(sessionpkg.TranslationSession, map[string]string) (asr.Recognizer, error) {
+		return missingModelRecognizer{asr.NewStubRecognizer(nil)}, nil
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	session := streamingSession()
+	session.Options.ModelProfile = string(asr.ModelGPU)
+	session.Options.Stages = map[string]string{"asr": "missing", "translation": "remote"}
+
+	report := Preflight(registry, stubDefinition(), session)
+	if report.Ready {
+		t.Fatal("expected the pipeline not to be ready")
+	}
+	checks := make(map[string]StageCheck)
+	for _, check := range report.Stages {
+		checks[check.Stage] = check
+	}
+	if check := checks["asr"]; check.Healthy || !strings.Contains(check.Message, "model files not found") {
+		t.Fatalf("expected asr to report the missing model, got %+v", check)
+	}
+	if check := checks["translation"]; check.Healthy || !strings.Contains(check.Message, `unknown translation implementation "remote"`) {
+		t.Fatalf("expected translation to report the unknown implementation, got %+v", check)
+	}
+	if !checks["output"].Healthy {
+		t.Fatalf("expected the other stages to stay healthy, got %+v", checks["output"])
+	}
+}
+
+func TestPreflightSourceReportsProbe(t *testing.T) {
+	t.Parallel()
+
+	source := &probedSource{probe: ingestion.SourceProbe{Container: "fmp4", Codecs: []string{"mp4a.40.2"}, Live: true}}
+	sources := func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) { return source, nil }
+
+	report := PreflightSource(context.Background(), newStubRegistry(t), stubDefinition(), sources, streamingSession())
+	if !report.Ready || len(report.Stages) != len(ConfigurableStages)+1 {
+		t.Fatalf("expected a ready report with an ingestion check, got %+v", report)
+	}
+	if check := report.Stages[0]; check.Stage != "ingestion" || check.Implementation != "hls" || !check.Healthy {
+		t.Fatalf("unexpected ingestion check %+v", check)
+	}
+	if report.Source == nil || report.Source.Container != "fmp4" || !report.Source.Live {
+		t.Fatalf("expected the probe in the report, got %+v", report.Source)
+	}
+
+	source.err = errors.New("playlist returned 404 Not Found")
+	report = PreflightSource(context.Background(), newStubRegistry(t), stubDefinition(), sources, streamingSession())
+	if report.Ready || report.Source != nil {
+		t.Fatalf("expected a failed probe to fail the preflight, got %+v", report)
+	}
+	if check := report.Stages[0]; check.Healthy || !strings.Contains(check.Message, "404 Not Found") {
+		t.Fatalf("expected the ingestion check to report the probe error, got %+v", check)
+	}
+
+	// Sources that cannot be probed pass undescribed.
+	unprobed := func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) { return &stubSource{}, nil }
+	report = PreflightSource(context.Background(), newStubRegistry(t), stubDefinition(), unprobed, streamingSession())
+	if !report.Ready || report.Source != nil || !report.Stages[0].Healthy {
+		t.Fatalf("expected an unprobed source to pass, got %+v", report)
+	}
+}
+
+func TestPreflightWarnsOfUnavailableVoice(t *testing.T) {
+	t.Parallel()
+
+	session := streamingSession()
+	session.Options.EnableDubbing = true
+	session.Options.AdditionalLanguages = []string{"fr"}
+	session.Options.VoiceID = "es-es-2"
+
+	report := Preflight(newStubRegistry(t), stubDefinition(), session)
+	if !report.Ready {
+		t.Fatalf("expected an unavailable voice not to stop the session, got %+v", report)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0] != "voice es-es-2 not offered for fr, dubbed in another voice" {
+		t.Fatalf("expected a voice warning for fr, got %v", report.Warnings)
+	}
+}
@@ -0,0 +1,285 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"streamlation/packages/backend/asr"
+)
+
+// Defaults of Punctuation.
+const (
+	DefaultSentencePause = 600 * time.Millisecond
+	DefaultMaxSentence   = 10 * time.Second
+	DefaultSentenceHold  = 3 * time.Second
+)
+
+// Punctuation configures the restoration of punctuation, casing, and
+// sentence boundaries in the transcripts of recognizers that emit raw text.
+// Text that is already punctuated keeps its punctuation and casing.
+type Punctuation struct {
+	// SentencePause is the pause between words that ends a sentence.
+	// Defaults to DefaultSentencePause.
+	SentencePause time.Duration
+	// MaxSentence bounds the audio one sentence spans; a longer one is
+	// passed on unfinished. Defaults to DefaultMaxSentence.
+	MaxSentence time.Duration
+	// Hold is how long an unfinished sentence waits for the transcript
+	// that continues it before it is passed on as finished. Defaults to
+	// DefaultSentenceHold.
+	Hold time.Duration
+}
+
+// englishQuestionWords start the English sentences that end in a question
+// mark.
+var englishQuestionWords = map[string]bool{
+	"what": true, "who": true, "whom": true, "whose": true, "where": true, "when": true, "why": true, "how": true, "which": true,
+	"is": true, "are": true, "was": true, "were": true, "do": true, "does": true, "did": true, "can": true, "could": true,
+	"will": true, "would": true, "should": true, "shall": true, "may": true, "have": true, "has": true,
+}
+
+// sentence collects the words of the final transcripts that make up one
+// sentence.
+type sentence struct {
+	first      asr.Transcript
+	words      []asr.Word
+	end        time.Duration
+	confidence float64
+	parts      int
+	// continues marks a sentence that carries on from one passed on
+	// unfinished, which does not start with a capital letter.
+	continues bool
+}
+
+func (s *sentence) empty() bool {
+	return len(s.words) == 0
+}
+
+func (s *sentence) add(transcript asr.Transcript, words []asr.Word) {
+	if s.empty() {
+		s.first = transcript
+		s.end = 0
+	}
+	s.words = append(s.words, words...)
+	s.end = max(s.end, words[len(words)-1].EndTime)
+	s.confidence += transcript.Confidence
+	s.parts++
+}
+
+// transcript returns the sentence as one final transcript, ended with
+// punctuation when finished is set.
+func (s *sentence) transcript(finished bool) asr.Transcript {
+	words := append([]asr.Word(nil), s.words...)
+	question := englishSentence(s.first.Language) && englishQuestionWords[strings.ToLower(words[0].Text)]
+	for i := range words {
+		if englishSentence(s.first.Language) {
+			words[i].Text = capitalizeEnglishI(words[i].Text)
+		}
+	}
+	if !s.continues {
+		words[0].Text = capitalize(words[0].Text)
+	}
+	last := &words[len(words)-1]
+	if finished && !endsSentence(last.Text) {
+		if question {
+			last.Text += "?"
+		} else {
+			last.Text += "."
+		}
+	}
+	texts := make([]string, len(words))
+	for i, word := range words {
+		texts[i] = word.Text
+	}
+
+	transcript := s.first
+	transcript.Text = strings.Join(texts, " ")
+	transcript.StartTime = words[0].StartTime
+	transcript.EndTime = s.end
+	transcript.Words = words
+	transcript.Confidence = s.confidence / float64(s.parts)
+	transcript.Partial = false
+	transcript.Stable = 0
+	*s = sentence{continues: !finished}
+	return transcript
+}
+
+// partial returns transcript, a partial hypothesis following the sentence,
+// with the sentence's words in front of it so that it shows the sentence
+// as it grows.
+func (s *sentence) partial(transcript asr.Transcript) asr.Transcript {
+	if s.empty() {
+		if !s.continues {
+			transcript.Text = capitalize(transcript.Text)
+		}
+		return transcript
+	}
+	texts := make([]string, 0, len(s.words)+1)
+	for _, word := range s.words {
+		texts = append(texts, word.Text)
+	}
+	if !s.continues {
+		texts[0] = capitalize(texts[0])
+	}
+	if transcript.Text != "" {
+		texts = append(texts, transcript.Text)
+	}
+	transcript.Stable += len(s.words)
+	transcript.Text = strings.Join(texts, " ")
+	transcript.StartTime = s.words[0].StartTime
+	return transcript
+}
+
+// transcriptWords returns the words of transcript with their timings, from
+// its word timings when they match its text, otherwise spread evenly over
+// the transcript.
+func transcriptWords(transcript asr.Transcript) []asr.Word {
+	texts := strings.Fields(transcript.Text)
+	if len(transcript.Words) == len(texts) {
+		words := append([]asr.Word(nil), transcript.Words...)
+		for i := range words {
+			words[i].Text = texts[i]
+		}
+		return words
+	}
+	words := make([]asr.Word, len(texts))
+	span := transcript.EndTime - transcript.StartTime
+	for i, text := range texts {
+		words[i] = asr.Word{
+			Text:      text,
+			StartTime: transcript.StartTime + span*time.Duration(i)/time.Duration(len(texts)),
+			EndTime:   transcript.StartTime + span*time.Duration(i+1)/time.Duration(len(texts)),
+		}
+	}
+	return words
+}
+
+func englishSentence(language string) bool {
+	return language == "" || language == "en"
+}
+
+func endsSentence(word string) bool {
+	return strings.HasSuffix(word, ".") || strings.HasSuffix(word, "?") || strings.HasSuffix(word, "!") || strings.HasSuffix(word, "…")
+}
+
+func capitalize(text string) string {
+	r, size := utf8.DecodeRuneInString(text)
+	if r == utf8.RuneError || unicode.IsUpper(r) {
+		return text
+	}
+	return string(unicode.ToUpper(r)) + text[size:]
+}
+
+// capitalizeEnglishI capitalizes the English pronoun "I" and its
+// contractions.
+func capitalizeEnglishI(word string) string {
+	if word == "i" || strings.HasPrefix(word, "i'") || strings.HasPrefix(word, "i’") {
+		return "I" + word[1:]
+	}
+	return word
+}
+
+// restorePunctuation re-segments the final transcripts from in into
+// sentences. A sentence ends at punctuation the recognizer emitted, at a
+// pause of cfg.SentencePause between words, and where the speaker changes;
+// it then starts with a capital letter and ends with a full stop, or a
+// question mark for English questions. A sentence still unfinished after
+// cfg.MaxSentence of audio, or cfg.Hold without input, is passed on as it
+// is. Partial transcripts pass with the unfinished sentence in front of
+// them. Without a configuration, in is returned unchanged.
+func restorePunctuation(ctx context.Context, run *streamRun, cfg *Punctuation, in <-chan asr.Transcript) <-chan asr.Transcript {
+	if cfg == nil {
+		return in
+	}
+	config := *cfg
+	if config.SentencePause <= 0 {
+		config.SentencePause = DefaultSentencePause
+	}
+	if config.MaxSentence <= 0 {
+		config.MaxSentence = DefaultMaxSentence
+	}
+	if config.Hold <= 0 {
+		config.Hold = DefaultSentenceHold
+	}
+
+	out := make(chan asr.Transcript, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+
+		send := func(transcript asr.Transcript) bool {
+			select {
+			case out <- transcript:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		var pending sentence
+		hold := time.NewTimer(config.Hold)
+		defer hold.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hold.C:
+				if !pending.empty() && !send(pending.transcript(true)) {
+					return
+				}
+			case transcript, ok := <-in:
+				if !ok {
+					if !pending.empty() {
+						send(pending.transcript(true))
+					}
+					return
+				}
+				if transcript.Partial {
+					if !send(pending.partial(transcript)) {
+						return
+					}
+					continue
+				}
+				words := transcriptWords(transcript)
+				if len(words) == 0 {
+					continue
+				}
+				if !pending.empty() && (words[0].StartTime-pending.end >= config.SentencePause || transcript.Speaker != pending.first.Speaker) {
+					if !send(pending.transcript(true)) {
+						return
+					}
+				}
+				start := 0
+				for i, word := range words {
+					last := i == len(words)-1
+					pause := !last && words[i+1].StartTime-word.EndTime >= config.SentencePause
+					if !endsSentence(word.Text) && !pause {
+						continue
+					}
+					pending.add(transcript, words[start:i+1])
+					start = i + 1
+					if !send(pending.transcript(true)) {
+						return
+					}
+				}
+				if start < len(words) {
+					pending.add(transcript, words[start:])
+					if pending.end-pending.words[0].StartTime >= config.MaxSentence && !send(pending.transcript(false)) {
+						return
+					}
+				}
+				if !hold.Stop() {
+					select {
+					case <-hold.C:
+					default:
+					}
+				}
+				hold.Reset(config.Hold)
+			}
+		}
+	}()
+	return out
+}
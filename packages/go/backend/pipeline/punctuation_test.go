@@ -0,0 +1,135 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+)
+
+// punctuate passes transcripts through restorePunctuation and returns the
+// transcripts it emits.
+func punctuate(t *testing.T, cfg *Punctuation, transcripts ...asr.Transcript) []asr.Transcript {
+	t.Helper()
+	run := &streamRun{bufferSize: DefaultStageBuffer}
+	in := make(chan asr.Transcript, len(transcripts))
+	for _, transcript := range transcripts {
+		in <- transcript
+	}
+	close(in)
+	var out []asr.Transcript
+	for transcript := range restorePunctuation(context.Background(), run, cfg, in) {
+		out = append(out, transcript)
+	}
+	run.wg.Wait()
+	return out
+}
+
+func texts(transcripts []asr.Transcript) []string {
+	out := make([]string, len(transcripts))
+	for i, transcript := range transcripts {
+		out[i] = transcript.Text
+	}
+	return out
+}
+
+func TestRestorePunctuationJoinsRawTranscriptsIntoSentences(t *testing.T) {
+	t.Parallel()
+
+	out := punctuate(t, &Punctuation{},
+		asr.Transcript{Text: "so i think", EndTime: 900 * time.Millisecond, Confidence: 0.8},
+		asr.Transcript{Text: "we should start", StartTime: time.Second, EndTime: 2 * time.Second, Confidence: 0.6},
+		asr.Transcript{Text: "where is the hall", StartTime: 3 * time.Second, EndTime: 4 * time.Second},
+	)
+
+	// The pause before the last transcript ends the first sentence.
+	if want := []string{"So I think we should start.", "Where is the hall?"}; !reflect.DeepEqual(texts(out), want) {
+		t.Fatalf("expected %q, got %q", want, texts(out))
+	}
+	if out[0].StartTime != 0 || out[0].EndTime != 2*time.Second {
+		t.Fatalf("expected the sentence to span 0s-2s, got %v-%v", out[0].StartTime, out[0].EndTime)
+	}
+	if out[0].Confidence != 0.7 {
+		t.Fatalf("expected the mean confidence 0.7, got %v", out[0].Confidence)
+	}
+}
+
+func TestRestorePunctuationSplitsAtPunctuationAndSpeakers(t *testing.T) {
+	t.Parallel()
+
+	out := punctuate(t, &Punctuation{},
+		asr.Transcript{Text: "Hello there. How are you", EndTime: 2 * time.Second, Speaker: "S1"},
+		asr.Transcript{Text: "fine thanks", StartTime: 2100 * time.Millisecond, EndTime: 3 * time.Second, Speaker: "S2"},
+	)
+
+	want := []string{"Hello there.", "How are you?", "Fine thanks."}
+	if !reflect.DeepEqual(texts(out), want) {
+		t.Fatalf("expected %q, got %q", want, texts(out))
+	}
+	if out[2].Speaker != "S2" {
+		t.Fatalf("expected the last sentence from S2, got %q", out[2].Speaker)
+	}
+}
+
+func TestRestorePunctuationBoundsSentences(t *testing.T) {
+	t.Parallel()
+
+	out := punctuate(t, &Punctuation{MaxSentence: 2 * time.Second},
+		asr.Transcript{Text: "one two", EndTime: time.Second, Language: "de"},
+		asr.Transcript{Text: "drei vier", StartTime: time.Second, EndTime: 2 * time.Second, Language: "de"},
+		asr.Transcript{Text: "fünf", StartTime: 2 * time.Second, EndTime: 3 * time.Second, Language: "de"},
+	)
+
+	// The sentence passed on unfinished is continued without a capital.
+	if want := []string{"One two drei vier", "fünf."}; !reflect.DeepEqual(texts(out), want) {
+		t.Fatalf("expected %q, got %q", want, texts(out))
+	}
+}
+
+func TestRestorePunctuationPrefixesPartials(t *testing.T) {
+	t.Parallel()
+
+	out := punctuate(t, &Punctuation{},
+		asr.Transcript{Text: "good morning", EndTime: time.Second},
+		asr.Transcript{Text: "every", StartTime: time.Second, EndTime: 1500 * time.Millisecond, Partial: true, Stable: 1},
+		asr.Transcript{Text: "everyone", StartTime: time.Second, EndTime: 2 * time.Second},
+	)
+
+	if want := []string{"Good morning every", "Good morning everyone."}; !reflect.DeepEqual(texts(out), want) {
+		t.Fatalf("expected %q, got %q", want, texts(out))
+	}
+	if !out[0].Partial || out[0].Stable != 3 || out[0].StartTime != 0 {
+		t.Fatalf("expected a partial from 0s with 3 stable words, got %+v", out[0])
+	}
+}
+
+func TestRestorePunctuationHoldsUnfinishedSentences(t *testing.T) {
+	t.Parallel()
+
+	run := &streamRun{bufferSize: DefaultStageBuffer}
+	in := make(chan asr.Transcript, 1)
+	in <- asr.Transcript{Text: "still talking", EndTime: time.Second}
+	out := restorePunctuation(context.Background(), run, &Punctuation{Hold: 20 * time.Millisecond}, in)
+
+	select {
+	case transcript := <-out:
+		if transcript.Text != "Still talking." {
+			t.Fatalf("expected the held sentence to be ended, got %q", transcript.Text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the unfinished sentence once the hold elapsed")
+	}
+	close(in)
+	run.wg.Wait()
+}
+
+func TestRestorePunctuationDisabled(t *testing.T) {
+	t.Parallel()
+
+	in := make(chan asr.Transcript)
+	if out := restorePunctuation(context.Background(), &streamRun{}, nil, in); out != (<-chan asr.Transcript)(in) {
+		t.Fatal("expected the transcripts unchanged without a configuration")
+	}
+}
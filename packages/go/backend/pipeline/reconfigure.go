@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+// ReconfiguredState marks the event a run emits after applying an options
+// update.
+const ReconfiguredState = "reconfigured"
+
+// ReconfigureRejectedState marks the warning a run emits when it cannot
+// apply an options update. The run keeps its options.
+const ReconfigureRejectedState = "reconfigure_rejected"
+
+type optionUpdatesKey struct{}
+
+// WithOptionUpdates returns a context carrying updates, a channel delivering
+// new options for the session that is run with the context. StreamingRunner
+// applies every update to the running pipeline.
+func WithOptionUpdates(ctx context.Context, updates <-chan sessionpkg.TranslationOptions) context.Context {
+	return context.WithValue(ctx, optionUpdatesKey{}, updates)
+}
+
+// OptionUpdatesFromContext returns the updates carried by ctx, or nil if
+// there are none.
+func OptionUpdatesFromContext(ctx context.Context) <-chan sessionpkg.TranslationOptions {
+	updates, _ := ctx.Value(optionUpdatesKey{}).(<-chan sessionpkg.TranslationOptions)
+	return updates
+}
+
+// reconfiguration is the part of an options update that affects a running
+// pipeline. Only the affected stages are rebuilt: ingestion and the other
+// branches keep running.
+type reconfiguration struct {
+	// added and removed are target languages whose branch is started or
+	// stopped.
+	added   []string
+	removed []string
+	// modelProfile is the recognizer's new model profile, empty when it is
+	// unchanged. The asr stage is restarted to load it.
+	modelProfile string
+	// stagesChanged is set when the stage selection changed, which a
+	// running pipeline cannot apply.
+	stagesChanged bool
+	// dubbingChanged is set when dubbing was switched on or off, to
+	// dubbing. Every branch starts or stops feeding its dubbing stage.
+	dubbingChanged bool
+	dubbing        bool
+	// voiceChanged is set when the voice preferences changed. Running
+	// dubbing keeps the voices it started with.
+	voiceChanged bool
+}
+
+// planReconfiguration compares the options of the running session with
+// options.
+func planReconfiguration(session sessionpkg.TranslationSession, options sessionpkg.TranslationOptions) reconfiguration {
+	var change reconfiguration
+
+	updated := session
+	updated.Options = options
+	before, after := session.TargetLanguages(), updated.TargetLanguages()
+	for _, language := range after {
+		if !containsLanguage(before, language) {
+			change.added = append(change.added, language)
+		}
+	}
+	for _, language := range before {
+		if !containsLanguage(after, language) {
+			change.removed = append(change.removed, language)
+		}
+	}
+
+	if options.ModelProfile != session.Options.ModelProfile {
+		change.modelProfile = options.ModelProfile
+	}
+	change.dubbingChanged = options.EnableDubbing != session.Options.EnableDubbing
+	change.dubbing = options.EnableDubbing
+	change.voiceChanged = voicePreference(options) != voicePreference(session.Options)
+	change.stagesChanged = !reflect.DeepEqual(options.Stages, session.Options.Stages) && (len(options.Stages) > 0 || len(session.Options.Stages) > 0)
+	return change
+}
+
+// rejection returns why a run, which has synthesizer to dub with, cannot
+// apply the change, or nil when it can.
+func (c reconfiguration) rejection(synthesizer bool) error {
+	switch {
+	case c.stagesChanged:
+		return errors.New("stage selection cannot change while the session runs")
+	case c.dubbingChanged && c.dubbing && !synthesizer:
+		return errors.New("dubbing cannot start: no speech synthesizer configured")
+	}
+	return nil
+}
+
+// summary describes the change for the reconfigured event.
+func (c reconfiguration) summary() string {
+	var parts []string
+	if len(c.added) > 0 {
+		parts = append(parts, "added "+strings.Join(c.added, ", "))
+	}
+	if len(c.removed) > 0 {
+		parts = append(parts, "removed "+strings.Join(c.removed, ", "))
+	}
+	if c.modelProfile != "" {
+		parts = append(parts, "restarted asr with model profile "+c.modelProfile)
+	}
+	if c.dubbingChanged && c.dubbing {
+		parts = append(parts, "started dubbing")
+	} else if c.dubbingChanged {
+		parts = append(parts, "stopped dubbing")
+	}
+	if c.voiceChanged {
+		parts = append(parts, "voice applies from the next run")
+	}
+	if len(parts) == 0 {
+		return "No running stage affected"
+	}
+	summary := strings.Join(parts, "; ")
+	return strings.ToUpper(summary[:1]) + summary[1:]
+}
+
+func containsLanguage(languages []string, language string) bool {
+	for _, candidate := range languages {
+		if candidate == language {
+			return true
+		}
+	}
+	return false
+}
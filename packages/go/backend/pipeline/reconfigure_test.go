@@ -0,0 +1,413 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+	"streamlation/packages/backend/tts"
+)
+
+// feedSource streams the payloads sent on feed until it is closed.
+type feedSource struct {
+	feed chan []byte
+}
+
+func (s *feedSource) Stream(ctx context.Context) (<-chan ingestion.MediaChunk, <-chan error) {
+	chunks := make(chan ingestion.MediaChunk)
+	errs := make(chan error)
+	go func() {
+		defer close(chunks)
+		defer close(errs)
+		for sequence := int64(0); ; sequence++ {
+			select {
+			case payload, ok := <-s.feed:
+				if !ok {
+					return
+				}
+				select {
+				case chunks <- ingestion.MediaChunk{Sequence: sequence, Timestamp: time.Now(), Payload: payload}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return chunks, errs
+}
+
+func (s *feedSource) Metrics() ingestion.StreamMetrics {
+	return ingestion.StreamMetrics{}
+}
+
+// profileRecognizer records the model profiles it loads and how often it is
+// started.
+type profileRecognizer struct {
+	*asr.StubRecognizer
+
+	mu       sync.Mutex
+	profiles []asr.ModelProfile
+	starts   int
+}
+
+func (r *profileRecognizer) LoadModel(profile asr.ModelProfile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.profiles = append(r.profiles, profile)
+	return nil
+}
+
+func (r *profileRecognizer) Recognize(ctx context.Context, sessionID string, chunks <-chan media.AudioChunk) (<-chan asr.Transcript, error) {
+	r.mu.Lock()
+	r.starts++
+	r.mu.Unlock()
+	return r.StubRecognizer.Recognize(ctx, sessionID, chunks)
+}
+
+// reconfigurableRun is a streaming run whose input and option updates are
+// driven by the test.
+type reconfigurableRun struct {
+	feed      chan []byte
+	updates   chan sessionpkg.TranslationOptions
+	subtitles chan output.SubtitleEvent
+	states    chan statuspkg.SessionStatusEvent
+	done      chan error
+
+	mu       sync.Mutex
+	events   []statuspkg.SessionStatusEvent
+	counts   map[string]int
+	segments int
+}
+
+// startReconfigurableRun runs session, dubbing with synthesizer when it is
+// not nil.
+func startReconfigurableRun(t *testing.T, session sessionpkg.TranslationSession, recognizer asr.Recognizer, synthesizer tts.Synthesizer) *reconfigurableRun {
+	t.Helper()
+	r := &reconfigurableRun{
+		feed:      make(chan []byte),
+		updates:   make(chan sessionpkg.TranslationOptions, 1),
+		subtitles: make(chan output.SubtitleEvent, 64),
+		states:    make(chan statuspkg.SessionStatusEvent, 64),
+		done:      make(chan error, 1),
+		counts:    make(map[string]int),
+	}
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &feedSource{feed: r.feed}, nil
+		},
+		Normalizer:  &readingNormalizer{},
+		Recognizer:  recognizer,
+		Translator:  translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:   output.NewStubGenerator(),
+		Synthesizer: synthesizer,
+		Output: OutputConfig{
+			OnSubtitle: func(_ context.Context, event output.SubtitleEvent) error {
+				r.mu.Lock()
+				r.counts[event.Language]++
+				r.mu.Unlock()
+				r.subtitles <- event
+				return nil
+			},
+		},
+		Dubbing: DubbingConfig{
+			OnAudio: func(context.Context, tts.AudioSegment) error {
+				r.mu.Lock()
+				r.segments++
+				r.mu.Unlock()
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	ctx = WithOptionUpdates(ctx, r.updates)
+	go func() {
+		r.done <- runner.Run(ctx, session, func(event statuspkg.SessionStatusEvent) error {
+			r.mu.Lock()
+			r.events = append(r.events, event)
+			r.mu.Unlock()
+			r.states <- event
+			return nil
+		})
+	}()
+	return r
+}
+
+// send feeds payload and waits for a subtitle in language.
+func (r *reconfigurableRun) send(t *testing.T, payload, language string) {
+	t.Helper()
+	r.feed <- []byte(payload)
+	for {
+		select {
+		case event := <-r.subtitles:
+			if event.Language == language {
+				return
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %s subtitle for %q", language, payload)
+		}
+	}
+}
+
+// update applies options and returns the detail of the reconfigured event.
+func (r *reconfigurableRun) update(t *testing.T, options sessionpkg.TranslationOptions) string {
+	t.Helper()
+	r.updates <- options
+	for {
+		select {
+		case event := <-r.states:
+			if event.State == ReconfiguredState {
+				return event.Detail
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("options update was not applied")
+		}
+	}
+}
+
+// reject applies options and returns the detail of the rejection it
+// expects.
+func (r *reconfigurableRun) reject(t *testing.T, options sessionpkg.TranslationOptions) string {
+	t.Helper()
+	r.updates <- options
+	for {
+		select {
+		case event := <-r.states:
+			if event.State == ReconfiguredState {
+				t.Fatalf("expected the update to be rejected, got %q", event.Detail)
+			}
+			if event.State == ReconfigureRejectedState {
+				return event.Detail
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("options update was not rejected")
+		}
+	}
+}
+
+// finish ends the input and returns the run's result.
+func (r *reconfigurableRun) finish(t *testing.T) error {
+	t.Helper()
+	close(r.feed)
+	go func() {
+		for range r.subtitles {
+		}
+	}()
+	go func() {
+		for range r.states {
+		}
+	}()
+	select {
+	case err := <-r.done:
+		return err
+	case <-time.After(3 * time.Second):
+		t.Fatal("run did not finish")
+		return nil
+	}
+}
+
+func (r *reconfigurableRun) count(language string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[language]
+}
+
+func (r *reconfigurableRun) dubbedSegments() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.segments
+}
+
+func (r *reconfigurableRun) find(stage, state, language string) *statuspkg.SessionStatusEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.events {
+		event := r.events[i]
+		if event.Stage == stage && event.State == state && event.Language == language {
+			return &event
+		}
+	}
+	return nil
+}
+
+func TestPlanReconfiguration(t *testing.T) {
+	t.Parallel()
+
+	session := streamingSession()
+	session.Options = sessionpkg.TranslationOptions{ModelProfile: "cpu-basic", AdditionalLanguages: []string{"de", "fr"}}
+	change := planReconfiguration(session, sessionpkg.TranslationOptions{
+		ModelProfile:        "gpu-accelerated",
+		AdditionalLanguages: []string{"fr", "it", "es"},
+		EnableDubbing:       true,
+	})
+	if strings.Join(change.added, ",") != "it" || strings.Join(change.removed, ",") != "de" {
+		t.Fatalf("unexpected language changes: %+v", change)
+	}
+	want := "Added it; removed de; restarted asr with model profile gpu-accelerated; started dubbing"
+	if got := change.summary(); got != want {
+		t.Fatalf("expected summary %q, got %q", want, got)
+	}
+
+	if got := planReconfiguration(session, session.Options).summary(); got != "No running stage affected" {
+		t.Fatalf("expected unchanged options to affect nothing, got %q", got)
+	}
+	voiced := session.Options
+	voiced.VoiceGender = sessionpkg.VoiceGenderMale
+	if got := planReconfiguration(session, voiced).summary(); got != "Voice applies from the next run" {
+		t.Fatalf("expected a voice change to wait for the next run, got %q", got)
+	}
+
+	staged := session.Options
+	staged.Stages = map[string]string{"asr": "stub"}
+	if err := planReconfiguration(session, staged).rejection(true); err == nil {
+		t.Fatal("expected a stage selection change to be rejected")
+	}
+	dubbed := session.Options
+	dubbed.EnableDubbing = true
+	if err := planReconfiguration(session, dubbed).rejection(false); err == nil {
+		t.Fatal("expected dubbing without a synthesizer to be rejected")
+	}
+	if err := planReconfiguration(session, dubbed).rejection(true); err != nil {
+		t.Fatalf("expected dubbing to be switched on, got %v", err)
+	}
+}
+
+func TestStreamingRunnerAddsLanguageMidSession(t *testing.T) {
+	t.Parallel()
+
+	run := startReconfigurableRun(t, streamingSession(), asr.NewStubRecognizer(&asr.StubRecognizerConfig{}), nil)
+	run.send(t, "first ", "es")
+	if detail := run.update(t, sessionpkg.TranslationOptions{AdditionalLanguages: []string{"fr"}}); detail != "Added fr" {
+		t.Fatalf("unexpected reconfiguration: %q", detail)
+	}
+	run.send(t, "second", "fr")
+	if err := run.finish(t); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if run.count("es") != 2 || run.count("fr") != 1 {
+		t.Fatalf("expected the new branch to translate only later input, got %d/%d", run.count("es"), run.count("fr"))
+	}
+	if run.find("output", "completed", "fr") == nil {
+		t.Fatal("expected the added branch to complete")
+	}
+	if run.find("ingestion", "running", "") == nil || run.find("translation", "failed", "fr") != nil {
+		t.Fatal("expected ingestion to keep running without failures")
+	}
+}
+
+func TestStreamingRunnerRemovesLanguageMidSession(t *testing.T) {
+	t.Parallel()
+
+	session := streamingSession()
+	session.Options.AdditionalLanguages = []string{"de"}
+	run := startReconfigurableRun(t, session, asr.NewStubRecognizer(&asr.StubRecognizerConfig{}), nil)
+	run.send(t, "first ", "de")
+	if detail := run.update(t, sessionpkg.TranslationOptions{}); detail != "Removed de" {
+		t.Fatalf("unexpected reconfiguration: %q", detail)
+	}
+	run.send(t, "second", "es")
+	if err := run.finish(t); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if run.count("es") != 2 || run.count("de") != 1 {
+		t.Fatalf("expected the removed branch to stop, got es=%d de=%d", run.count("es"), run.count("de"))
+	}
+	completed := run.find("translation", "completed", "")
+	if completed == nil || completed.Detail != "Translated to es; stopped: de" {
+		t.Fatalf("unexpected translation summary: %+v", completed)
+	}
+	if run.find("translation", "completed", "de") != nil {
+		t.Fatal("expected no completion for the removed branch")
+	}
+}
+
+func TestStreamingRunnerRestartsASRForNewModelProfile(t *testing.T) {
+	t.Parallel()
+
+	recognizer := &profileRecognizer{StubRecognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{})}
+	run := startReconfigurableRun(t, streamingSession(), recognizer, nil)
+	run.send(t, "first ", "es")
+	run.update(t, sessionpkg.TranslationOptions{ModelProfile: string(asr.ModelGPU)})
+	run.send(t, "second", "es")
+	if err := run.finish(t); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	recognizer.mu.Lock()
+	defer recognizer.mu.Unlock()
+	if len(recognizer.profiles) != 1 || recognizer.profiles[0] != asr.ModelGPU {
+		t.Fatalf("expected the new profile to be loaded, got %v", recognizer.profiles)
+	}
+	if recognizer.starts != 2 {
+		t.Fatalf("expected asr to be restarted once, got %d starts", recognizer.starts)
+	}
+	if run.count("es") != 2 {
+		t.Fatalf("expected input after the restart to be transcribed, got %d subtitles", run.count("es"))
+	}
+}
+
+func TestStreamingRunnerTogglesDubbingMidSession(t *testing.T) {
+	t.Parallel()
+
+	synthesizer := tts.NewStubSynthesizer(&tts.StubSynthesizerConfig{SampleRate: 16000})
+	run := startReconfigurableRun(t, streamingSession(), asr.NewStubRecognizer(&asr.StubRecognizerConfig{}), synthesizer)
+	run.send(t, "first ", "es")
+	if detail := run.update(t, sessionpkg.TranslationOptions{EnableDubbing: true}); detail != "Started dubbing" {
+		t.Fatalf("unexpected reconfiguration: %q", detail)
+	}
+	run.send(t, "second ", "es")
+	if detail := run.update(t, sessionpkg.TranslationOptions{}); detail != "Stopped dubbing" {
+		t.Fatalf("unexpected reconfiguration: %q", detail)
+	}
+	run.send(t, "third", "es")
+	if err := run.finish(t); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if got := run.dubbedSegments(); got != 1 {
+		t.Fatalf("expected only the input while dubbing was on to be dubbed, got %d segments", got)
+	}
+	if completed := run.find("dubbing", "completed", "es"); completed == nil || completed.Detail != "Synthesized 1 audio segments" {
+		t.Fatalf("expected dubbing to complete for es, got %+v", completed)
+	}
+}
+
+func TestStreamingRunnerRejectsStageSelectionMidSession(t *testing.T) {
+	t.Parallel()
+
+	run := startReconfigurableRun(t, streamingSession(), asr.NewStubRecognizer(&asr.StubRecognizerConfig{}), nil)
+	run.send(t, "first ", "es")
+	if detail := run.reject(t, sessionpkg.TranslationOptions{Stages: map[string]string{"asr": "whisper"}, AdditionalLanguages: []string{"fr"}}); !strings.Contains(detail, "stage selection") {
+		t.Fatalf("unexpected rejection: %q", detail)
+	}
+	if detail := run.reject(t, sessionpkg.TranslationOptions{EnableDubbing: true}); !strings.Contains(detail, "synthesizer") {
+		t.Fatalf("unexpected rejection: %q", detail)
+	}
+	run.send(t, "second", "es")
+	if err := run.finish(t); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if run.count("fr") != 0 {
+		t.Fatal("expected a rejected update to leave the languages unchanged")
+	}
+	if run.find("dubbing", "completed", "es") != nil {
+		t.Fatal("expected no dubbing after a rejected update")
+	}
+}
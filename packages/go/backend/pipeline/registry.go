@@ -0,0 +1,858 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	"streamlation/packages/backend/provider"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+	"streamlation/packages/backend/tts"
+)
+
+// ConfigurableStages lists the stages whose implementation can be selected
+// by name, in pipeline order.
+var ConfigurableStages = []string{"normalization", "asr", "translation", "output", "dubbing"}
+
+// StubImplementation is the name under which RegisterStubs registers the
+// stub implementation of every stage.
+const StubImplementation = "stub"
+
+// Factories build a stage implementation for a session from the options the
+// pipeline definition sets for the stage, which may be nil. They are called
+// once per run so implementations may hold per-session state.
+type (
+	NormalizerFactory  func(session sessionpkg.TranslationSession, options map[string]string) (media.Normalizer, error)
+	RecognizerFactory  func(session sessionpkg.TranslationSession, options map[string]string) (asr.Recognizer, error)
+	TranslatorFactory  func(session sessionpkg.TranslationSession, options map[string]string) (translation.Translator, error)
+	GeneratorFactory   func(session sessionpkg.TranslationSession, options map[string]string) (output.SubtitleGenerator, error)
+	SynthesizerFactory func(session sessionpkg.TranslationSession, options map[string]string) (tts.Synthesizer, error)
+)
+
+// Registry maps implementation names to factories for each configurable
+// stage, so the runner can be assembled from configuration rather than code.
+// It is safe for concurrent use.
+type Registry struct {
+	mu           sync.RWMutex
+	normalizers  map[string]NormalizerFactory
+	recognizers  map[string]RecognizerFactory
+	translators  map[string]TranslatorFactory
+	generators   map[string]GeneratorFactory
+	synthesizers map[string]SynthesizerFactory
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		normalizers:  make(map[string]NormalizerFactory),
+		recognizers:  make(map[string]RecognizerFactory),
+		translators:  make(map[string]TranslatorFactory),
+		generators:   make(map[string]GeneratorFactory),
+		synthesizers: make(map[string]SynthesizerFactory),
+	}
+}
+
+// RegisterNormalizer adds a normalization implementation under name.
+func (r *Registry) RegisterNormalizer(name string, factory NormalizerFactory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return register(r.normalizers, "normalization", name, factory)
+}
+
+// RegisterRecognizer adds an ASR implementation under name.
+func (r *Registry) RegisterRecognizer(name string, factory RecognizerFactory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return register(r.recognizers, "asr", name, factory)
+}
+
+// RegisterTranslator adds a translation implementation under name.
+func (r *Registry) RegisterTranslator(name string, factory TranslatorFactory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return register(r.translators, "translation", name, factory)
+}
+
+// RegisterGenerator adds an output implementation under name.
+func (r *Registry) RegisterGenerator(name string, factory GeneratorFactory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return register(r.generators, "output", name, factory)
+}
+
+// RegisterSynthesizer adds a dubbing implementation under name.
+func (r *Registry) RegisterSynthesizer(name string, factory SynthesizerFactory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return register(r.synthesizers, "dubbing", name, factory)
+}
+
+func register[F any](factories map[string]F, stage, name string, factory F) error {
+	if name == "" {
+		return fmt.Errorf("%s implementation name required", stage)
+	}
+	if _, exists := factories[name]; exists {
+		return fmt.Errorf("%s implementation %q already registered", stage, name)
+	}
+	factories[name] = factory
+	return nil
+}
+
+// Names returns the registered implementation names for stage, sorted.
+func (r *Registry) Names(stage string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var names []string
+	switch stage {
+	case "normalization":
+		names = keys(r.normalizers)
+	case "asr":
+		names = keys(r.recognizers)
+	case "translation":
+		names = keys(r.translators)
+	case "output":
+		names = keys(r.generators)
+	case "dubbing":
+		names = keys(r.synthesizers)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func keys[F any](factories map[string]F) []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Validate reports an error if selection names a stage that cannot be
+// configured or an implementation that is not registered.
+func (r *Registry) Validate(selection map[string]string) error {
+	for stage, name := range selection {
+		if !isConfigurableStage(stage) {
+			return fmt.Errorf("stage %q is not configurable", stage)
+		}
+		known := r.Names(stage)
+		if !contains(known, name) {
+			return fmt.Errorf("unknown %s implementation %q (registered: %s)", stage, name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// Components are the stage implementations chosen for one run.
+type Components struct {
+	Normalizer  media.Normalizer
+	Recognizer  asr.Recognizer
+	Translator  translation.Translator
+	Generator   output.SubtitleGenerator
+	Synthesizer tts.Synthesizer
+}
+
+// Build constructs the implementation named in selection for every
+// configurable stage, handing each factory the stage's options.
+func (r *Registry) Build(session sessionpkg.TranslationSession, selection map[string]string, options map[string]map[string]string) (Components, error) {
+	if err := r.Validate(selection); err != nil {
+		return Components{}, err
+	}
+	for _, stage := range ConfigurableStages {
+		if selection[stage] == "" {
+			return Components{}, fmt.Errorf("no implementation selected for %s", stage)
+		}
+	}
+
+	var components Components
+	for _, stage := range ConfigurableStages {
+		if err := r.buildStage(&components, stage, selection[stage], session, options[stage]); err != nil {
+			return Components{}, err
+		}
+	}
+	return components, nil
+}
+
+// SessionGenerator constructs the output implementation definition selects
+// for session, the generator its runs render subtitle files with.
+func SessionGenerator(registry *Registry, definition Definition, session sessionpkg.TranslationSession) (output.SubtitleGenerator, error) {
+	name := definition.sessionSelection(session)["output"]
+	if name == "" {
+		return nil, errors.New("no implementation selected for output")
+	}
+	var components Components
+	options := definition.Profile(session.Options.ModelProfile).Options()
+	if err := registry.buildStage(&components, "output", name, session, options["output"]); err != nil {
+		return nil, err
+	}
+	return components.Generator, nil
+}
+
+// BuildCandidates constructs the candidate implementation named in
+// candidates for each stage that has one.
+func (r *Registry) BuildCandidates(session sessionpkg.TranslationSession, candidates map[string]string, options map[string]map[string]string) (Candidates, error) {
+	if err := r.Validate(candidates); err != nil {
+		return Candidates{}, err
+	}
+	var components Components
+	for stage, name := range candidates {
+		if !contains(comparableStages, stage) {
+			return Candidates{}, fmt.Errorf("stage %s does not accept a candidate", stage)
+		}
+		if err := r.buildStage(&components, stage, name, session, options[stage]); err != nil {
+			return Candidates{}, fmt.Errorf("candidate: %w", err)
+		}
+	}
+	return Candidates{Recognizer: components.Recognizer, Translator: components.Translator}, nil
+}
+
+// buildStage constructs the implementation name of stage into components.
+func (r *Registry) buildStage(components *Components, stage, name string, session sessionpkg.TranslationSession, options map[string]string) error {
+	r.mu.RLock()
+	normalizer, recognizer := r.normalizers[name], r.recognizers[name]
+	translator, generator := r.translators[name], r.generators[name]
+	synthesizer := r.synthesizers[name]
+	r.mu.RUnlock()
+
+	var (
+		component string
+		missing   bool
+		err       error
+	)
+	switch stage {
+	case "normalization":
+		component, missing = "normalizer", normalizer == nil
+		if !missing {
+			components.Normalizer, err = normalizer(session, options)
+		}
+	case "asr":
+		component, missing = "recognizer", recognizer == nil
+		if !missing {
+			components.Recognizer, err = recognizer(session, options)
+		}
+	case "translation":
+		component, missing = "translator", translator == nil
+		if !missing {
+			components.Translator, err = translator(session, options)
+		}
+	case "output":
+		component, missing = "generator", generator == nil
+		if !missing {
+			components.Generator, err = generator(session, options)
+		}
+	case "dubbing":
+		component, missing = "synthesizer", synthesizer == nil
+		if !missing {
+			components.Synthesizer, err = synthesizer(session, options)
+		}
+	default:
+		return fmt.Errorf("stage %q is not configurable", stage)
+	}
+	if missing {
+		return fmt.Errorf("unknown %s implementation %q (registered: %s)", stage, name, strings.Join(r.Names(stage), ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("build %s %s: %w", name, component, err)
+	}
+	return nil
+}
+
+func isConfigurableStage(stage string) bool {
+	return contains(ConfigurableStages, stage)
+}
+
+func contains(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterStubs registers the stub implementation of every stage under
+// StubImplementation.
+func RegisterStubs(r *Registry) error {
+	return errors.Join(
+		r.RegisterNormalizer(StubImplementation, func(sessionpkg.TranslationSession, map[string]string) (media.Normalizer, error) {
+			return media.NewStubNormalizer(nil), nil
+		}),
+		r.RegisterRecognizer(StubImplementation, func(sessionpkg.TranslationSession, map[string]string) (asr.Recognizer, error) {
+			return asr.NewStubRecognizer(nil), nil
+		}),
+		r.RegisterTranslator(StubImplementation, func(sessionpkg.TranslationSession, map[string]string) (translation.Translator, error) {
+			return translation.NewStubTranslator(nil), nil
+		}),
+		r.RegisterGenerator(StubImplementation, func(sessionpkg.TranslationSession, map[string]string) (output.SubtitleGenerator, error) {
+			return output.NewStubGenerator(), nil
+		}),
+		r.RegisterSynthesizer(StubImplementation, func(sessionpkg.TranslationSession, map[string]string) (tts.Synthesizer, error) {
+			return tts.NewStubSynthesizer(nil), nil
+		}),
+	)
+}
+
+// NativeImplementation is the name under which RegisterNative registers
+// the stage implementations that run in Go without external tools.
+const NativeImplementation = "native"
+
+// RegisterNative registers the native implementations under
+// NativeImplementation: a normalizer that resamples raw PCM to 16kHz
+// without ffmpeg, and decodes ADTS and fMP4 AAC in builds with an AAC
+// decoder. Its options are "inputRate" and "channels", describing the
+// 16-bit little-endian PCM it reads, and "outputRate", "chunkDuration", and
+// "taps", shaping what it emits.
+func RegisterNative(r *Registry) error {
+	return r.RegisterNormalizer(NativeImplementation, func(_ sessionpkg.TranslationSession, options map[string]string) (media.Normalizer, error) {
+		var (
+			cfg media.NativeNormalizerConfig
+			err error
+		)
+		for key, value := range options {
+			switch key {
+			case "inputRate":
+				cfg.InputRate, err = strconv.Atoi(value)
+			case "channels":
+				cfg.Channels, err = strconv.Atoi(value)
+			case "outputRate":
+				cfg.OutputRate, err = strconv.Atoi(value)
+			case "taps":
+				cfg.Taps, err = strconv.Atoi(value)
+			case "chunkDuration":
+				cfg.ChunkDuration, err = time.ParseDuration(value)
+			default:
+				err = errors.New("unknown option")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("option %s: %w", key, err)
+			}
+		}
+		return media.NewNativeNormalizer(cfg)
+	})
+}
+
+// WhisperImplementation is the name under which RegisterWhisper registers
+// the recognizer that runs whisper.cpp on the host.
+const WhisperImplementation = "whisper"
+
+// RegisterWhisper registers an asr.WhisperRecognizer under
+// WhisperImplementation. Its options are "command", the whisper.cpp tool
+// and any arguments before its own separated by spaces; "model", the ggml
+// model file, and "model.<profile>" the file for one model profile;
+// "language", "threads", "segment", and "tempDir". With "batch", the most
+// segments one run of whisper.cpp transcribes, the segments of concurrent
+// sessions are batched, each waiting at most "batchWait" for others;
+// recognizers with the same command, threads, and batch options share one
+// asr.Batcher.
+func RegisterWhisper(r *Registry) error {
+	var (
+		mu       sync.Mutex
+		batchers = make(map[string]*asr.Batcher)
+	)
+	return r.RegisterRecognizer(WhisperImplementation, func(_ sessionpkg.TranslationSession, options map[string]string) (asr.Recognizer, error) {
+		var (
+			cfg       asr.WhisperConfig
+			batch     int
+			batchWait time.Duration
+			err       error
+		)
+		for key, value := range options {
+			switch key {
+			case "command":
+				cfg.Command = strings.Fields(value)
+			case "model":
+				cfg.Model = value
+			case "language":
+				cfg.Language = value
+			case "threads":
+				cfg.Threads, err = strconv.Atoi(value)
+			case "segment":
+				cfg.Segment, err = time.ParseDuration(value)
+			case "tempDir":
+				cfg.TempDir = value
+			case "batch":
+				batch, err = strconv.Atoi(value)
+			case "batchWait":
+				batchWait, err = time.ParseDuration(value)
+			default:
+				profile, ok := strings.CutPrefix(key, "model.")
+				if !ok || profile == "" {
+					err = errors.New("unknown option")
+					break
+				}
+				if cfg.Models == nil {
+					cfg.Models = make(map[asr.ModelProfile]string)
+				}
+				cfg.Models[asr.ModelProfile(profile)] = value
+			}
+			if err != nil {
+				return nil, fmt.Errorf("option %s: %w", key, err)
+			}
+		}
+		if batch > 0 {
+			key := strings.Join(cfg.Command, " ") + "\x00" + strconv.Itoa(cfg.Threads) + "\x00" + cfg.TempDir + "\x00" + strconv.Itoa(batch) + "\x00" + batchWait.String()
+			mu.Lock()
+			if batchers[key] == nil {
+				batchers[key] = asr.NewBatcher(asr.BatcherConfig{Backend: asr.NewWhisperRecognizer(cfg), MaxBatch: batch, MaxWait: batchWait})
+			}
+			cfg.Batcher = batchers[key]
+			mu.Unlock()
+		}
+		return asr.NewWhisperRecognizer(cfg), nil
+	})
+}
+
+// GRPCImplementation is the name under which RegisterGRPC registers the
+// recognizer that streams to an external recognition service.
+const GRPCImplementation = "grpc"
+
+// RegisterGRPC registers an asr.GRPCRecognizer under GRPCImplementation.
+// Its options are "endpoint", the service's URL, which is required;
+// "language"; and "header.<name>", metadata sent with every stream. All
+// recognizers it builds share one client, so the sessions streaming to an
+// endpoint share its connection.
+func RegisterGRPC(r *Registry) error {
+	client := asr.NewGRPCClient(nil, 0)
+	return r.RegisterRecognizer(GRPCImplementation, func(_ sessionpkg.TranslationSession, options map[string]string) (asr.Recognizer, error) {
+		cfg := asr.GRPCConfig{Client: client}
+		for key, value := range options {
+			switch key {
+			case "endpoint":
+				cfg.Endpoint = value
+			case "language":
+				cfg.Language = value
+			default:
+				name, ok := strings.CutPrefix(key, "header.")
+				if !ok || name == "" {
+					return nil, fmt.Errorf("option %s: unknown option", key)
+				}
+				if cfg.Metadata == nil {
+					cfg.Metadata = make(map[string]string)
+				}
+				cfg.Metadata[name] = value
+			}
+		}
+		return asr.NewGRPCRecognizer(cfg)
+	})
+}
+
+// OpenAIImplementation is the name under which RegisterOpenAI registers
+// the recognizer that posts audio to an OpenAI-compatible transcription
+// API.
+const OpenAIImplementation = "openai"
+
+// RegisterOpenAI registers an asr.OpenAIRecognizer under
+// OpenAIImplementation. Its options are "endpoint", the API's base URL,
+// which is required; "apiKey"; "model", and "model.<profile>" for the
+// model that serves one model profile; "language"; "batch", the audio sent
+// per request; and the limiter options of RegisterMT. Recognizers with the
+// same endpoint, key, and limits share one limiter, so that sessions
+// together stay within the key's rate limit.
+func RegisterOpenAI(r *Registry) error {
+	limiters := newProviderLimiters(statuspkg.CodeASRFailed)
+	return r.RegisterRecognizer(OpenAIImplementation, func(_ sessionpkg.TranslationSession, options map[string]string) (asr.Recognizer, error) {
+		var (
+			cfg    asr.OpenAIConfig
+			limits provider.LimiterConfig
+			err    error
+		)
+		for key, value := range options {
+			switch key {
+			case "endpoint":
+				cfg.Endpoint = value
+			case "apiKey":
+				cfg.APIKey = value
+			case "model":
+				cfg.Model = value
+			case "language":
+				cfg.Language = value
+			case "batch":
+				cfg.Batch, err = time.ParseDuration(value)
+			case "requestsPerMinute", "burst", "concurrency", "breakerFailures", "breakerCooldown", "retries":
+				err = parseLimiterOption(&limits, key, value)
+			default:
+				profile, ok := strings.CutPrefix(key, "model.")
+				if !ok || profile == "" {
+					err = errors.New("unknown option")
+					break
+				}
+				if cfg.Models == nil {
+					cfg.Models = make(map[asr.ModelProfile]string)
+				}
+				cfg.Models[asr.ModelProfile(profile)] = value
+			}
+			if err != nil {
+				return nil, fmt.Errorf("option %s: %w", key, err)
+			}
+		}
+		cfg.Limiter = limiters.get(limits, cfg.Endpoint, cfg.APIKey)
+		return asr.NewOpenAIRecognizer(cfg)
+	})
+}
+
+// parseLimiterOption sets the option of a provider's limiter named key:
+// "requestsPerMinute"; "burst"; "concurrency", the most requests in flight;
+// "breakerFailures", the failures in a row that open the circuit;
+// "breakerCooldown", how long it stays open; or "retries", how often a
+// failed request is retried.
+func parseLimiterOption(limits *provider.LimiterConfig, key, value string) error {
+	var err error
+	switch key {
+	case "requestsPerMinute":
+		limits.RequestsPerMinute, err = strconv.Atoi(value)
+	case "burst":
+		limits.Burst, err = strconv.Atoi(value)
+	case "concurrency":
+		limits.Concurrency, err = strconv.Atoi(value)
+	case "breakerFailures":
+		limits.BreakerFailures, err = strconv.Atoi(value)
+	case "breakerCooldown":
+		limits.BreakerCooldown, err = time.ParseDuration(value)
+	case "retries":
+		limits.Retries, err = strconv.Atoi(value)
+	default:
+		err = errors.New("unknown option")
+	}
+	return err
+}
+
+// providerLimiters shares one provider.Limiter among the stages calling
+// each provider account, refusing requests with code while its circuit is
+// open.
+type providerLimiters struct {
+	code statuspkg.ErrorCode
+
+	mu       sync.Mutex
+	limiters map[string]*provider.Limiter
+}
+
+func newProviderLimiters(code statuspkg.ErrorCode) *providerLimiters {
+	return &providerLimiters{code: code, limiters: make(map[string]*provider.Limiter)}
+}
+
+// get returns the limiter of the account with limits, creating it for the
+// first stage.
+func (p *providerLimiters) get(limits provider.LimiterConfig, account ...string) *provider.Limiter {
+	limits.Code = p.code
+	key := strings.Join(append(account, fmt.Sprintf("%+v", limits)), "\x00")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.limiters[key] == nil {
+		p.limiters[key] = provider.NewLimiter(limits)
+	}
+	return p.limiters[key]
+}
+
+// MTImplementation is the name under which RegisterMT registers the
+// translator that calls an external machine translation API.
+const MTImplementation = "mt"
+
+// RegisterMT registers a translation.MTTranslator under MTImplementation.
+// Its options are "provider", one of deepl, libretranslate, or google,
+// which is required; "endpoint"; "apiKey"; "language.<code>", the
+// provider's code for a target language; "batch", the most segments per
+// request; "batchWait"; and "requestsPerMinute", "burst", "concurrency",
+// "breakerFailures", "breakerCooldown", and "retries", which configure its
+// provider.Limiter. Translators with the same provider,
+// endpoint, key, and limits share one limiter. The session's formality is passed on to
+// the provider.
+func RegisterMT(r *Registry) error {
+	limiters := newProviderLimiters(statuspkg.CodeTranslationFailed)
+	return r.RegisterTranslator(MTImplementation, func(session sessionpkg.TranslationSession, options map[string]string) (translation.Translator, error) {
+		var (
+			cfg    = translation.MTConfig{Formality: session.Options.Formality}
+			limits provider.LimiterConfig
+			err    error
+		)
+		for key, value := range options {
+			switch key {
+			case "provider":
+				cfg.Provider = value
+			case "endpoint":
+				cfg.Endpoint = value
+			case "apiKey":
+				cfg.APIKey = value
+			case "batch":
+				cfg.Batch, err = strconv.Atoi(value)
+			case "batchWait":
+				cfg.BatchWait, err = time.ParseDuration(value)
+			case "requestsPerMinute", "burst", "concurrency", "breakerFailures", "breakerCooldown", "retries":
+				err = parseLimiterOption(&limits, key, value)
+			default:
+				language, ok := strings.CutPrefix(key, "language.")
+				if !ok || language == "" {
+					err = errors.New("unknown option")
+					break
+				}
+				if cfg.Languages == nil {
+					cfg.Languages = make(map[string]string)
+				}
+				cfg.Languages[language] = value
+			}
+			if err != nil {
+				return nil, fmt.Errorf("option %s: %w", key, err)
+			}
+		}
+		cfg.Limiter = limiters.get(limits, cfg.Provider, cfg.Endpoint, cfg.APIKey)
+		return translation.NewMTTranslator(cfg)
+	})
+}
+
+// LLMImplementation is the name under which RegisterLLM registers the
+// translator that prompts a large language model with the context of the
+// stream.
+const LLMImplementation = "llm"
+
+// RegisterLLM registers a translation.LLMTranslator under
+// LLMImplementation. Its options are "api", openai or anthropic; "endpoint";
+// "apiKey"; "model", which is required; "context", the number of prior
+// segments each request carries; "instructions"; "maxTokens"; "batch",
+// the most segments per request; "batchWait"; and the limiter options of
+// RegisterMT. Translators with the
+// same API, endpoint, key, and limits share one limiter. The
+// session's formality is added to the instructions.
+func RegisterLLM(r *Registry) error {
+	limiters := newProviderLimiters(statuspkg.CodeTranslationFailed)
+	return r.RegisterTranslator(LLMImplementation, func(session sessionpkg.TranslationSession, options map[string]string) (translation.Translator, error) {
+		var (
+			cfg    = translation.LLMConfig{Formality: session.Options.Formality}
+			limits provider.LimiterConfig
+			err    error
+		)
+		for key, value := range options {
+			switch key {
+			case "api":
+				cfg.API = value
+			case "endpoint":
+				cfg.Endpoint = value
+			case "apiKey":
+				cfg.APIKey = value
+			case "model":
+				cfg.Model = value
+			case "context":
+				cfg.Context, err = strconv.Atoi(value)
+			case "instructions":
+				cfg.Instructions = value
+			case "maxTokens":
+				cfg.MaxTokens, err = strconv.Atoi(value)
+			case "batch":
+				cfg.Batch, err = strconv.Atoi(value)
+			case "batchWait":
+				cfg.BatchWait, err = time.ParseDuration(value)
+			case "requestsPerMinute", "burst", "concurrency", "breakerFailures", "breakerCooldown", "retries":
+				err = parseLimiterOption(&limits, key, value)
+			default:
+				err = errors.New("unknown option")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("option %s: %w", key, err)
+			}
+		}
+		cfg.Limiter = limiters.get(limits, cfg.API, cfg.Endpoint, cfg.APIKey)
+		return translation.NewLLMTranslator(cfg)
+	})
+}
+
+// ElevenLabsImplementation is the name under which RegisterElevenLabs
+// registers the synthesizer that calls an ElevenLabs-compatible
+// text-to-speech API.
+const ElevenLabsImplementation = "elevenlabs"
+
+// RegisterElevenLabs registers a tts.ElevenLabsSynthesizer under
+// ElevenLabsImplementation. Its options are "endpoint"; "apiKey"; "model";
+// "voice", the voice ID of languages without voices of their own;
+// "voice.<language>", a comma-separated list of the voices of a language,
+// the first its default, each a voice ID optionally followed by the
+// voice's gender and style, as in "id:female:narration"; "sampleRate";
+// "streamChunk", how much speech each chunk of streamed speech holds; and
+// the limiter options of RegisterMT. Synthesizers with the same endpoint,
+// key, and limits share one limiter.
+func RegisterElevenLabs(r *Registry) error {
+	limiters := newProviderLimiters(statuspkg.CodeDubbingFailed)
+	return r.RegisterSynthesizer(ElevenLabsImplementation, func(_ sessionpkg.TranslationSession, options map[string]string) (tts.Synthesizer, error) {
+		var (
+			cfg    tts.ElevenLabsConfig
+			limits provider.LimiterConfig
+			err    error
+		)
+		for key, value := range options {
+			switch key {
+			case "endpoint":
+				cfg.Endpoint = value
+			case "apiKey":
+				cfg.APIKey = value
+			case "model":
+				cfg.Model = value
+			case "voice":
+				cfg.DefaultVoice = value
+			case "sampleRate":
+				cfg.SampleRate, err = strconv.Atoi(value)
+			case "requestsPerMinute", "burst", "concurrency", "breakerFailures", "breakerCooldown", "retries":
+				err = parseLimiterOption(&limits, key, value)
+			case "streamChunk":
+				cfg.StreamChunk, err = time.ParseDuration(value)
+			default:
+				language, ok := strings.CutPrefix(key, "voice.")
+				if !ok || language == "" {
+					err = errors.New("unknown option")
+					break
+				}
+				if cfg.Voices == nil {
+					cfg.Voices = make(map[string][]tts.VoiceProfile)
+				}
+				for _, entry := range strings.Split(value, ",") {
+					if entry = strings.TrimSpace(entry); entry == "" {
+						continue
+					}
+					voice := tts.VoiceProfile{Language: language}
+					voice.ID, entry, _ = strings.Cut(entry, ":")
+					voice.Gender, voice.Style, _ = strings.Cut(entry, ":")
+					cfg.Voices[language] = append(cfg.Voices[language], voice)
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("option %s: %w", key, err)
+			}
+		}
+		cfg.Limiter = limiters.get(limits, cfg.Endpoint, cfg.APIKey)
+		return tts.NewElevenLabsSynthesizer(cfg)
+	})
+}
+
+// ParseStageSelection parses a comma-separated list of stage=implementation
+// pairs, such as "asr=whisper,translation=stub".
+func ParseStageSelection(value string) (map[string]string, error) {
+	selection := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		stage, name, ok := strings.Cut(pair, "=")
+		stage, name = strings.TrimSpace(stage), strings.TrimSpace(name)
+		if !ok || stage == "" || name == "" {
+			return nil, fmt.Errorf("invalid stage selection %q: want stage=implementation", pair)
+		}
+		if !isConfigurableStage(stage) {
+			return nil, fmt.Errorf("stage %q is not configurable", stage)
+		}
+		selection[stage] = name
+	}
+	return selection, nil
+}
+
+// ConfiguredRunner builds the pipeline for each run from a Registry and a
+// Definition. The definition's profile for the session's model profile
+// applies on top of it, and the session's Options.Stages override the
+// resulting selection stage by stage, so components can be swapped without
+// code changes.
+type ConfiguredRunner struct {
+	registry   *Registry
+	definition Definition
+	base       StreamingConfig
+}
+
+// NewConfiguredRunner returns a runner that resolves components from
+// registry. defaults must select an implementation for every configurable
+// stage. base supplies the source factory and the remaining streaming
+// settings; any components set on it are ignored.
+func NewConfiguredRunner(registry *Registry, defaults map[string]string, base StreamingConfig) (*ConfiguredRunner, error) {
+	definition := Definition{Stages: make(map[string]StageDefinition, len(defaults))}
+	for stage, name := range defaults {
+		definition.Stages[stage] = StageDefinition{Implementation: name, Policy: base.Policies[stage]}
+	}
+	return NewDefinedRunner(registry, definition, base)
+}
+
+// NewDefinedRunner returns a runner that assembles each run as definition
+// declares, resolving components from registry. The definition's buffer
+// size and stage policies replace those of base, which otherwise supplies
+// the source factory and the remaining streaming settings.
+func NewDefinedRunner(registry *Registry, definition Definition, base StreamingConfig) (*ConfiguredRunner, error) {
+	if registry == nil {
+		return nil, errors.New("stage registry required")
+	}
+	if base.Sources == nil {
+		return nil, errors.New("source factory required")
+	}
+	if err := definition.Validate(registry); err != nil {
+		return nil, err
+	}
+	return &ConfiguredRunner{registry: registry, definition: definition, base: base}, nil
+}
+
+// Selection returns the implementation chosen for each stage of session.
+func (r *ConfiguredRunner) Selection(session sessionpkg.TranslationSession) map[string]string {
+	return r.definition.sessionSelection(session)
+}
+
+// Run builds the session's components and streams it through them.
+func (r *ConfiguredRunner) Run(ctx context.Context, session sessionpkg.TranslationSession, emit func(statuspkg.SessionStatusEvent) error) error {
+	if emit == nil {
+		emit = func(statuspkg.SessionStatusEvent) error { return nil }
+	}
+
+	definition := r.definition.Profile(session.Options.ModelProfile)
+	components, err := r.registry.Build(session, r.Selection(session), definition.Options())
+	if err != nil {
+		return failStage(emit, session.ID, stageFailure{stage: "pipeline", code: statuspkg.CodePipelineFailed, err: err})
+	}
+	// A candidate that cannot be built is left out rather than failing the
+	// session it was meant to be evaluated on.
+	candidates, err := r.registry.BuildCandidates(session, definition.Candidates(), definition.CandidateOptions())
+	if err != nil {
+		candidates = Candidates{}
+		if err := emit(statuspkg.SessionStatusEvent{
+			SessionID: session.ID,
+			Stage:     "pipeline",
+			State:     statuspkg.ComparisonState,
+			Detail:    err.Error(),
+			Code:      statuspkg.CodeCandidateFailed,
+			Severity:  statuspkg.SeverityWarning,
+			Timestamp: time.Now().UTC(),
+		}); err != nil {
+			return err
+		}
+	}
+
+	// A translator with a fallback has its translations of poor estimated
+	// quality translated again by the fallback.
+	if stage := definition.Stages["translation"]; stage.Fallback != "" {
+		var fallback Components
+		if err := r.registry.buildStage(&fallback, "translation", stage.Fallback, session, stage.FallbackOptions); err != nil {
+			return failStage(emit, session.ID, stageFailure{stage: "pipeline", code: statuspkg.CodePipelineFailed, err: fmt.Errorf("fallback: %w", err)})
+		}
+		components.Translator = translation.NewFallbackTranslator(translation.FallbackConfig{
+			Primary:   components.Translator,
+			Secondary: fallback.Translator,
+			Threshold: stage.FallbackThreshold,
+		})
+	}
+
+	config := r.base
+	if definition.BufferSize > 0 {
+		config.BufferSize = definition.BufferSize
+	}
+	config.Policies = definition.Policies()
+	config.Normalizer = components.Normalizer
+	config.Recognizer = components.Recognizer
+	config.Translator = components.Translator
+	config.Generator = components.Generator
+	config.Synthesizer = components.Synthesizer
+	config.Comparison.Candidates = candidates
+	runner, err := NewStreamingRunner(config)
+	if err != nil {
+		return err
+	}
+	return runner.Run(ctx, session, emit)
+}
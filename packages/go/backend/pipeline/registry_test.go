@@ -0,0 +1,477 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+	"streamlation/packages/backend/tts"
+)
+
+func newStubRegistry(t *testing.T) *Registry {
+	t.Helper()
+	registry := NewRegistry()
+	if err := RegisterStubs(registry); err != nil {
+		t.Fatalf("register stubs: %v", err)
+	}
+	return registry
+}
+
+func TestRegistryRejectsDuplicateNames(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	err := registry.RegisterNormalizer(StubImplementation, func(sessionpkg.TranslationSession, map[string]string) (media.Normalizer, error) {
+		return media.NewStubNormalizer(nil), nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Fatalf("expected duplicate registration error, got %v", err)
+	}
+}
+
+func TestRegistryValidateReportsRegisteredNames(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	if err := registry.Validate(map[string]string{"asr": StubImplementation}); err != nil {
+		t.Fatalf("expected stub selection to be valid: %v", err)
+	}
+	err := registry.Validate(map[string]string{"asr": "whisper"})
+	if err == nil || !strings.Contains(err.Error(), "registered: stub") {
+		t.Fatalf("expected unknown implementation error listing choices, got %v", err)
+	}
+	if err := registry.Validate(map[string]string{"ingestion": StubImplementation}); err == nil {
+		t.Fatal("expected ingestion to be rejected as not configurable")
+	}
+}
+
+func TestRegisterNativeBuildsNormalizerFromOptions(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	if err := RegisterNative(registry); err != nil {
+		t.Fatalf("register native: %v", err)
+	}
+	if names := registry.Names("normalization"); !reflect.DeepEqual(names, []string{NativeImplementation, StubImplementation}) {
+		t.Fatalf("unexpected normalizers %v", names)
+	}
+
+	selection := map[string]string{"normalization": NativeImplementation, "asr": StubImplementation, "translation": StubImplementation, "output": StubImplementation, "dubbing": StubImplementation}
+	components, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{
+		"normalization": {"inputRate": "44100", "channels": "2", "chunkDuration": "200ms"},
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if _, ok := components.Normalizer.(*media.NativeNormalizer); !ok {
+		t.Fatalf("expected a native normalizer, got %T", components.Normalizer)
+	}
+
+	for _, options := range []map[string]string{{"inputRate": "fast"}, {"channels": "-1"}, {"bitrate": "128000"}} {
+		if _, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{"normalization": options}); err == nil {
+			t.Fatalf("expected options %v to be rejected", options)
+		}
+	}
+}
+
+func TestRegisterWhisperBuildsRecognizerFromOptions(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	if err := RegisterWhisper(registry); err != nil {
+		t.Fatalf("register whisper: %v", err)
+	}
+
+	selection := map[string]string{"normalization": StubImplementation, "asr": WhisperImplementation, "translation": StubImplementation, "output": StubImplementation, "dubbing": StubImplementation}
+	components, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{
+		"asr": {"model": "/models/ggml-base.bin", "model.gpu-accelerated": "/models/ggml-large-v3.bin", "threads": "4", "segment": "8s", "batch": "8", "batchWait": "40ms"},
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if _, ok := components.Recognizer.(*asr.WhisperRecognizer); !ok {
+		t.Fatalf("expected a whisper recognizer, got %T", components.Recognizer)
+	}
+
+	for _, options := range []map[string]string{{"threads": "many"}, {"segment": "long"}, {"batch": "many"}, {"batchWait": "soon"}, {"beam": "5"}, {"model.": "/models/ggml-base.bin"}} {
+		if _, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{"asr": options}); err == nil {
+			t.Fatalf("expected options %v to be rejected", options)
+		}
+	}
+}
+
+func TestRegisterGRPCBuildsRecognizerFromOptions(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	if err := RegisterGRPC(registry); err != nil {
+		t.Fatalf("register grpc: %v", err)
+	}
+
+	selection := map[string]string{"normalization": StubImplementation, "asr": GRPCImplementation, "translation": StubImplementation, "output": StubImplementation, "dubbing": StubImplementation}
+	components, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{
+		"asr": {"endpoint": "https://asr.internal:50051", "language": "en", "header.authorization": "Bearer token"},
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if _, ok := components.Recognizer.(*asr.GRPCRecognizer); !ok {
+		t.Fatalf("expected a gRPC recognizer, got %T", components.Recognizer)
+	}
+
+	for _, options := range []map[string]string{nil, {"endpoint": "asr.internal:50051"}, {"endpoint": "https://asr.internal", "beam": "5"}} {
+		if _, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{"asr": options}); err == nil {
+			t.Fatalf("expected options %v to be rejected", options)
+		}
+	}
+}
+
+func TestRegisterOpenAIBuildsRecognizerFromOptions(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	if err := RegisterOpenAI(registry); err != nil {
+		t.Fatalf("register openai: %v", err)
+	}
+
+	selection := map[string]string{"normalization": StubImplementation, "asr": OpenAIImplementation, "translation": StubImplementation, "output": StubImplementation, "dubbing": StubImplementation}
+	components, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{
+		"asr": {"endpoint": "https://api.openai.com/v1", "apiKey": "secret", "model.gpu-accelerated": "whisper-large", "batch": "15s", "requestsPerMinute": "50", "retries": "2"},
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if _, ok := components.Recognizer.(*asr.OpenAIRecognizer); !ok {
+		t.Fatalf("expected an OpenAI recognizer, got %T", components.Recognizer)
+	}
+
+	for _, options := range []map[string]string{nil, {"endpoint": "https://api.openai.com/v1", "batch": "long"}, {"endpoint": "https://api.openai.com/v1", "requestsPerMinute": "many"}, {"endpoint": "https://api.openai.com/v1", "prompt": "hello"}} {
+		if _, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{"asr": options}); err == nil {
+			t.Fatalf("expected options %v to be rejected", options)
+		}
+	}
+}
+
+func TestRegisterMTBuildsTranslatorFromOptions(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	if err := RegisterMT(registry); err != nil {
+		t.Fatalf("register mt: %v", err)
+	}
+
+	selection := map[string]string{"normalization": StubImplementation, "asr": StubImplementation, "translation": MTImplementation, "output": StubImplementation, "dubbing": StubImplementation}
+	components, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{
+		"translation": {"provider": "deepl", "apiKey": "secret:fx", "language.pt": "PT-PT", "batch": "8", "batchWait": "200ms", "requestsPerMinute": "60", "burst": "4", "concurrency": "2", "breakerFailures": "3", "breakerCooldown": "10s", "retries": "2"},
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if _, ok := components.Translator.(*translation.MTTranslator); !ok {
+		t.Fatalf("expected an MT translator, got %T", components.Translator)
+	}
+
+	for _, options := range []map[string]string{nil, {"provider": "babelfish"}, {"provider": "google", "batch": "many"}, {"provider": "google", "batchWait": "soon"}, {"provider": "google", "model": "nmt"}, {"provider": "google", "language.": "de"}, {"provider": "google", "breakerCooldown": "later"}} {
+		if _, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{"translation": options}); err == nil {
+			t.Fatalf("expected options %v to be rejected", options)
+		}
+	}
+}
+
+func TestRegisterLLMBuildsTranslatorFromOptions(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	if err := RegisterLLM(registry); err != nil {
+		t.Fatalf("register llm: %v", err)
+	}
+
+	selection := map[string]string{"normalization": StubImplementation, "asr": StubImplementation, "translation": LLMImplementation, "output": StubImplementation, "dubbing": StubImplementation}
+	components, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{
+		"translation": {"api": "anthropic", "apiKey": "secret", "model": "claude-test", "context": "12", "instructions": "Keep it short.", "maxTokens": "512", "batch": "8", "batchWait": "200ms", "requestsPerMinute": "60", "retries": "2"},
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if _, ok := components.Translator.(*translation.LLMTranslator); !ok {
+		t.Fatalf("expected an LLM translator, got %T", components.Translator)
+	}
+
+	for _, options := range []map[string]string{nil, {"model": "gpt-test", "api": "bard"}, {"model": "gpt-test", "context": "all"}, {"model": "gpt-test", "batchWait": "soon"}, {"model": "gpt-test", "temperature": "0"}} {
+		if _, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{"translation": options}); err == nil {
+			t.Fatalf("expected options %v to be rejected", options)
+		}
+	}
+}
+
+func TestRegisterElevenLabsBuildsSynthesizerFromOptions(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	if err := RegisterElevenLabs(registry); err != nil {
+		t.Fatalf("register elevenlabs: %v", err)
+	}
+
+	selection := map[string]string{"normalization": StubImplementation, "asr": StubImplementation, "translation": StubImplementation, "output": StubImplementation, "dubbing": ElevenLabsImplementation}
+	components, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{
+		"dubbing": {"apiKey": "secret", "model": "eleven_test", "voice": "any", "voice.es": "es-1, es-2:male:narration", "sampleRate": "24000", "retries": "2", "streamChunk": "100ms"},
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	synthesizer, ok := components.Synthesizer.(*tts.ElevenLabsSynthesizer)
+	if !ok {
+		t.Fatalf("expected an ElevenLabs synthesizer, got %T", components.Synthesizer)
+	}
+	if voices := synthesizer.AvailableVoices("es"); len(voices) != 2 || voices[0].ID != "es-1" || voices[1] != (tts.VoiceProfile{ID: "es-2", Language: "es", Gender: "male", Style: "narration"}) {
+		t.Fatalf("unexpected Spanish voices %+v", voices)
+	}
+	if voices := synthesizer.AvailableVoices("fr"); len(voices) != 1 || voices[0].ID != "any" {
+		t.Fatalf("expected the default voice for French, got %+v", voices)
+	}
+
+	for _, options := range []map[string]string{{"sampleRate": "8000"}, {"sampleRate": "fast"}, {"streamChunk": "soon"}, {"endpoint": "ftp://example.com"}, {"stability": "0.5"}} {
+		if _, err := registry.Build(sessionpkg.TranslationSession{ID: "session"}, selection, map[string]map[string]string{"dubbing": options}); err == nil {
+			t.Fatalf("expected options %v to be rejected", options)
+		}
+	}
+}
+
+func TestParseStageSelection(t *testing.T) {
+	t.Parallel()
+
+	selection, err := ParseStageSelection(" asr=whisper, translation=stub ,")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := map[string]string{"asr": "whisper", "translation": "stub"}
+	if !reflect.DeepEqual(selection, want) {
+		t.Fatalf("expected %v, got %v", want, selection)
+	}
+
+	for _, raw := range []string{"asr", "asr=", "=stub", "media=stub"} {
+		if _, err := ParseStageSelection(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestConfiguredRunnerAppliesSessionOverrides(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	normalizer := &readingNormalizer{}
+	if err := registry.RegisterNormalizer("reading", func(sessionpkg.TranslationSession, map[string]string) (media.Normalizer, error) {
+		return normalizer, nil
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	defaults := map[string]string{"normalization": "stub", "asr": "stub", "translation": "stub", "output": "stub", "dubbing": "stub"}
+	runner, err := NewConfiguredRunner(registry, defaults, StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("media")}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("new configured runner: %v", err)
+	}
+
+	session := streamingSession()
+	session.Options.Stages = map[string]string{"normalization": "reading"}
+	if got := runner.Selection(session); got["normalization"] != "reading" || got["asr"] != "stub" {
+		t.Fatalf("unexpected selection: %v", got)
+	}
+	if err := runner.Run(context.Background(), session, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if normalizer.bytesRead() != "media" {
+		t.Fatalf("expected the session's normalizer to be used, read %q", normalizer.bytesRead())
+	}
+}
+
+func TestSessionGeneratorBuildsSessionOutput(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	var built map[string]string
+	if err := registry.RegisterGenerator("styled", func(_ sessionpkg.TranslationSession, options map[string]string) (output.SubtitleGenerator, error) {
+		built = options
+		return output.NewStubGenerator(), nil
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	definition := Definition{
+		Stages: map[string]StageDefinition{"output": {Implementation: StubImplementation}},
+		Profiles: map[string]Definition{
+			"broadcast": {Stages: map[string]StageDefinition{"output": {Options: map[string]string{"style": "bold"}}}},
+		},
+	}
+
+	session := streamingSession()
+	session.Options.ModelProfile = "broadcast"
+	session.Options.Stages = map[string]string{"output": "styled"}
+	generator, err := SessionGenerator(registry, definition, session)
+	if err != nil || generator == nil {
+		t.Fatalf("SessionGenerator: %v", err)
+	}
+	if built["style"] != "bold" {
+		t.Fatalf("expected the profile's output options, got %v", built)
+	}
+
+	if _, err := SessionGenerator(registry, Definition{}, streamingSession()); err == nil {
+		t.Fatal("expected an error without an output implementation")
+	}
+}
+
+func TestConfiguredRunnerFailsForUnknownImplementation(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	defaults := map[string]string{"normalization": "stub", "asr": "stub", "translation": "stub", "output": "stub", "dubbing": "stub"}
+	runner, err := NewConfiguredRunner(registry, defaults, StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			t.Fatal("source should not be opened when the pipeline cannot be built")
+			return nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("new configured runner: %v", err)
+	}
+
+	session := streamingSession()
+	session.Options.Stages = map[string]string{"asr": "whisper"}
+	var events []statuspkg.SessionStatusEvent
+	err = runner.Run(context.Background(), session, func(event statuspkg.SessionStatusEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected unknown implementation to fail the run")
+	}
+	if len(events) != 1 || events[0].Stage != "pipeline" || events[0].State != "failed" || events[0].Code != statuspkg.CodePipelineFailed {
+		t.Fatalf("expected a single pipeline failure, got %+v", events)
+	}
+}
+
+func TestDefinedRunnerRunsWithoutUnbuildableCandidate(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	if err := registry.RegisterRecognizer("next", func(sessionpkg.TranslationSession, map[string]string) (asr.Recognizer, error) {
+		return nil, errors.New("no GPU available")
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	definition := stubDefinition()
+	definition.Stages["asr"] = StageDefinition{Implementation: StubImplementation, Candidate: "next"}
+	runner, err := NewDefinedRunner(registry, definition, StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first")}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("new defined runner: %v", err)
+	}
+
+	var warnings []statuspkg.SessionStatusEvent
+	err = runner.Run(context.Background(), streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		if event.State == statuspkg.ComparisonState {
+			warnings = append(warnings, event)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected the run to go on without the candidate, got %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Code != statuspkg.CodeCandidateFailed || !strings.Contains(warnings[0].Detail, "no GPU available") {
+		t.Fatalf("expected a single candidate warning, got %+v", warnings)
+	}
+}
+
+// echoTranslator leaves every transcript untranslated.
+type echoTranslator struct {
+	*translation.StubTranslator
+}
+
+func (e echoTranslator) TranslateStream(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string) (<-chan translation.Translation, error) {
+	translations, err := e.StubTranslator.TranslateStream(ctx, sessionID, transcripts, targetLang)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan translation.Translation)
+	go func() {
+		defer close(out)
+		for translated := range translations {
+			translated.TranslatedText = translated.SourceText
+			out <- translated
+		}
+	}()
+	return out, nil
+}
+
+func TestDefinedRunnerFallsBackOnPoorTranslations(t *testing.T) {
+	t.Parallel()
+
+	registry := newStubRegistry(t)
+	if err := registry.RegisterTranslator("echo", func(sessionpkg.TranslationSession, map[string]string) (translation.Translator, error) {
+		return echoTranslator{translation.NewStubTranslator(nil)}, nil
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	definition := stubDefinition()
+	definition.Stages["translation"] = StageDefinition{Implementation: "echo", Fallback: StubImplementation}
+	metrics := NewTranslationMetrics()
+	var written string
+	runner, err := NewDefinedRunner(registry, definition, StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first words"), []byte("second words")}}, nil
+		},
+		Output: OutputConfig{
+			OnSubtitle: func(context.Context, output.SubtitleEvent) error {
+				var b strings.Builder
+				if err := metrics.WriteMetrics(&b); err != nil {
+					return err
+				}
+				written = b.String()
+				return nil
+			},
+		},
+		Metrics: MetricsConfig{
+			Translations: metrics,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new defined runner: %v", err)
+	}
+
+	if err := runner.Run(context.Background(), streamingSession(), nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !strings.Contains(written, `streamlation_translation_translations_total{session="stream-session",language="es",variant="fallback"}`) {
+		t.Fatalf("expected fallback translations in the metrics:\n%s", written)
+	}
+	if strings.Contains(written, `variant="primary"`) {
+		t.Fatalf("expected no untranslated primary translations:\n%s", written)
+	}
+}
+
+func TestNewConfiguredRunnerRequiresDefaultForEveryStage(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewConfiguredRunner(newStubRegistry(t), map[string]string{"asr": "stub"}, StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) { return nil, nil },
+	})
+	if err == nil {
+		t.Fatal("expected missing defaults to be rejected")
+	}
+}
@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"streamlation/packages/backend/media"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// IdleState marks the event reporting that transcription paused because the
+// source went quiet, and ResumedState the event reporting that it resumed.
+const (
+	IdleState    = "idle"
+	ResumedState = "resumed"
+)
+
+// DefaultSilenceThreshold is the RMS level, relative to full scale, below
+// which audio counts as silence when SilenceGate.Threshold is not set. It is
+// about -40 dBFS.
+const DefaultSilenceThreshold = 0.01
+
+// SilenceGate pauses recognition while a stream is silent, saving ASR
+// compute on quiet streams.
+type SilenceGate struct {
+	// After is how much consecutive silent audio passes before the gate
+	// closes. Zero disables the gate.
+	After time.Duration
+	// Threshold is the RMS level below which audio counts as silent.
+	Threshold float64
+}
+
+// gateSilence forwards audio from in until it has been silent for
+// gate.After, then holds back silent audio until a chunk above the
+// threshold arrives. The audio leading up to the pause is still forwarded,
+// so the end of an utterance is not cut off. Pausing and resuming are
+// reported as asr "idle" and "resumed" events.
+func gateSilence(ctx context.Context, run *streamRun, gate SilenceGate, in <-chan media.AudioChunk) <-chan media.AudioChunk {
+	if gate.After <= 0 {
+		return in
+	}
+	threshold := gate.Threshold
+	if threshold <= 0 {
+		threshold = DefaultSilenceThreshold
+	}
+
+	out := make(chan media.AudioChunk, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+
+		var (
+			silence time.Duration
+			idle    bool
+		)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk, ok := <-in:
+				if !ok {
+					return
+				}
+				if chunk.Level() >= threshold {
+					silence = 0
+					if idle {
+						idle = false
+						run.notify(ctx, statuspkg.SessionStatusEvent{
+							Stage:  "asr",
+							State:  ResumedState,
+							Detail: fmt.Sprintf("Audio returned at %s; transcription resumed", chunk.Timestamp.Round(time.Millisecond)),
+						})
+					}
+				} else {
+					silence += chunk.Duration
+					if idle {
+						continue
+					}
+					if silence > gate.After {
+						idle = true
+						run.notify(ctx, statuspkg.SessionStatusEvent{
+							Stage:  "asr",
+							State:  IdleState,
+							Detail: fmt.Sprintf("Silent for %s; transcription paused", gate.After),
+						})
+						continue
+					}
+				}
+				select {
+				case out <- chunk:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestGateSilencePausesAndResumesRecognition(t *testing.T) {
+	t.Parallel()
+
+	run := &streamRun{
+		sessionID:  "silence-session",
+		bufferSize: DefaultStageBuffer,
+		notices:    make(chan statuspkg.SessionStatusEvent, noticeBuffer),
+	}
+	levels := []float64{0.2, 0.001, 0.001, 0.001, 0.001, 0.001, 0.3, 0.001}
+	in := make(chan media.AudioChunk, len(levels))
+	for i, level := range levels {
+		in <- media.AudioChunk{Timestamp: time.Duration(i) * time.Second, Duration: time.Second, RMS: level}
+	}
+	close(in)
+
+	var forwarded []time.Duration
+	for chunk := range gateSilence(context.Background(), run, SilenceGate{After: 2 * time.Second}, in) {
+		forwarded = append(forwarded, chunk.Timestamp/time.Second)
+	}
+	run.wg.Wait()
+
+	// The first two seconds of silence pass; the rest is held back until
+	// audio returns at six seconds.
+	if want := []time.Duration{0, 1, 2, 6, 7}; !reflect.DeepEqual(forwarded, want) {
+		t.Fatalf("expected chunks %v to be forwarded, got %v", want, forwarded)
+	}
+	var states []string
+	for len(run.notices) > 0 {
+		event := <-run.notices
+		if event.Stage != "asr" || event.SessionID != "silence-session" {
+			t.Fatalf("unexpected gate event %+v", event)
+		}
+		states = append(states, event.State)
+	}
+	if want := []string{IdleState, ResumedState}; !reflect.DeepEqual(states, want) {
+		t.Fatalf("expected %v events, got %v", want, states)
+	}
+}
+
+func TestGateSilenceDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	in := make(chan media.AudioChunk)
+	if out := gateSilence(context.Background(), &streamRun{}, SilenceGate{}, in); out != (<-chan media.AudioChunk)(in) {
+		t.Fatal("expected the audio channel to be used as is")
+	}
+}
@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/metrics"
+)
+
+// SourceMetrics exposes the counters of the stream source of every running
+// session, sampled from ingestion.StreamSource.Metrics whenever metrics are
+// written. A session's series are removed when its run ends. A nil
+// *SourceMetrics records nothing.
+type SourceMetrics struct {
+	mu      sync.Mutex
+	sources map[string]trackedSource
+	now     func() time.Time
+}
+
+type trackedSource struct {
+	kind   string
+	source ingestion.StreamSource
+}
+
+// NewSourceMetrics returns an empty set of source metrics.
+func NewSourceMetrics() *SourceMetrics {
+	return &SourceMetrics{sources: make(map[string]trackedSource), now: time.Now}
+}
+
+// track samples source, of the given source type, for sessionID.
+func (m *SourceMetrics) track(sessionID, kind string, source ingestion.StreamSource) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sources[sessionID] = trackedSource{kind: kind, source: source}
+}
+
+// forget removes the series of a session whose run has ended.
+func (m *SourceMetrics) forget(sessionID string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sources, sessionID)
+}
+
+// sourceSample is a point-in-time copy of a source's counters.
+type sourceSample struct {
+	sessionID, kind string
+	metrics         ingestion.StreamMetrics
+}
+
+// samples returns the current counters ordered by session.
+func (m *SourceMetrics) samples() []sourceSample {
+	m.mu.Lock()
+	tracked := make([]sourceSample, 0, len(m.sources))
+	sources := make([]ingestion.StreamSource, 0, len(m.sources))
+	for sessionID, source := range m.sources {
+		tracked = append(tracked, sourceSample{sessionID: sessionID, kind: source.kind})
+		sources = append(sources, source.source)
+	}
+	m.mu.Unlock()
+
+	// Sources take their own locks, so they are sampled outside m.mu.
+	for i, source := range sources {
+		tracked[i].metrics = source.Metrics()
+	}
+	sort.Slice(tracked, func(i, j int) bool { return tracked[i].sessionID < tracked[j].sessionID })
+	return tracked
+}
+
+// WriteMetrics writes the source metrics in the Prometheus text exposition
+// format.
+func (m *SourceMetrics) WriteMetrics(w io.Writer) error {
+	samples := m.samples()
+
+	counters := []struct {
+		counter *metrics.Counter
+		value   func(ingestion.StreamMetrics) int64
+	}{
+		{metrics.NewCounter("streamlation_ingestion_chunks_received_total", "Segments and chunks each session's source fetched.", "session", "source"), func(m ingestion.StreamMetrics) int64 { return m.ReceivedChunks }},
+		{metrics.NewCounter("streamlation_ingestion_bytes_received_total", "Media bytes each session's source fetched.", "session", "source"), func(m ingestion.StreamMetrics) int64 { return m.ReceivedBytes }},
+		{metrics.NewCounter("streamlation_ingestion_errors_total", "Errors each session's source ran into.", "session", "source"), func(m ingestion.StreamMetrics) int64 { return m.ErrorCount }},
+		{metrics.NewCounter("streamlation_ingestion_reconnects_total", "Times each session's source reconnected or failed over.", "session", "source"), func(m ingestion.StreamMetrics) int64 { return m.ReconnectCount }},
+		{metrics.NewCounter("streamlation_ingestion_chunks_dropped_total", "Chunks each session's source discarded.", "session", "source"), func(m ingestion.StreamMetrics) int64 { return m.DroppedChunks }},
+		{metrics.NewCounter("streamlation_ingestion_variant_switches_total", "Times each session's source switched variants.", "session", "source"), func(m ingestion.StreamMetrics) int64 { return m.VariantSwitches }},
+	}
+	for _, counter := range counters {
+		for _, sample := range samples {
+			counter.counter.Add(float64(counter.value(sample.metrics)), sample.sessionID, sample.kind)
+		}
+		if err := counter.counter.WriteMetrics(w); err != nil {
+			return err
+		}
+	}
+
+	// Only playlist sources have a playlist to go stale.
+	staleness := metrics.NewGauge("streamlation_ingestion_playlist_staleness_seconds", "Time since each session's playlist or manifest last listed new media.", "session", "source")
+	now := m.now()
+	for _, sample := range samples {
+		if !sample.metrics.PlaylistUpdated.IsZero() {
+			staleness.Set(now.Sub(sample.metrics.PlaylistUpdated).Seconds(), sample.sessionID, sample.kind)
+		}
+	}
+	return staleness.WriteMetrics(w)
+}
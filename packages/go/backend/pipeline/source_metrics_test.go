@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	"streamlation/packages/backend/translation"
+)
+
+// meteredSource reports fixed counters.
+type meteredSource struct {
+	stubSource
+	metrics ingestion.StreamMetrics
+}
+
+func (s *meteredSource) Metrics() ingestion.StreamMetrics {
+	return s.metrics
+}
+
+func TestSourceMetricsWritesPrometheusText(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	metrics := NewSourceMetrics()
+	metrics.now = func() time.Time { return now }
+	metrics.track("s-1", "hls", &meteredSource{metrics: ingestion.StreamMetrics{
+		ReceivedChunks:  12,
+		ReceivedBytes:   4096,
+		ErrorCount:      2,
+		ReconnectCount:  1,
+		DroppedChunks:   3,
+		VariantSwitches: 1,
+		PlaylistUpdated: now.Add(-1500 * time.Millisecond),
+	}})
+	metrics.track("s-2", "rtmp", &meteredSource{metrics: ingestion.StreamMetrics{ReceivedChunks: 5}})
+
+	var b strings.Builder
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	text := b.String()
+	for _, want := range []string{
+		"# TYPE streamlation_ingestion_chunks_received_total counter\n",
+		`streamlation_ingestion_chunks_received_total{session="s-1",source="hls"} 12`,
+		`streamlation_ingestion_chunks_received_total{session="s-2",source="rtmp"} 5`,
+		`streamlation_ingestion_bytes_received_total{session="s-1",source="hls"} 4096`,
+		`streamlation_ingestion_errors_total{session="s-1",source="hls"} 2`,
+		`streamlation_ingestion_reconnects_total{session="s-1",source="hls"} 1`,
+		`streamlation_ingestion_chunks_dropped_total{session="s-1",source="hls"} 3`,
+		`streamlation_ingestion_variant_switches_total{session="s-1",source="hls"} 1`,
+		"# TYPE streamlation_ingestion_playlist_staleness_seconds gauge\n",
+		`streamlation_ingestion_playlist_staleness_seconds{session="s-1",source="hls"} 1.5`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in metrics:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, `streamlation_ingestion_playlist_staleness_seconds{session="s-2"`) {
+		t.Fatalf("expected no staleness for a source without a playlist:\n%s", text)
+	}
+
+	metrics.forget("s-1")
+	b.Reset()
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	if strings.Contains(b.String(), "s-1") {
+		t.Fatalf("expected forgotten session to be removed:\n%s", b.String())
+	}
+}
+
+func TestStreamingRunnerTracksSourceMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewSourceMetrics()
+	var during string
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{DefaultLanguage: "en"}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		Output: OutputConfig{
+			OnSubtitle: func(context.Context, output.SubtitleEvent) error {
+				if during == "" {
+					var b strings.Builder
+					if err := metrics.WriteMetrics(&b); err != nil {
+						return err
+					}
+					during = b.String()
+				}
+				return nil
+			},
+		},
+		Metrics: MetricsConfig{
+			Sources: metrics,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	session := streamingSession()
+	if err := runner.Run(context.Background(), session, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := `streamlation_ingestion_chunks_received_total{session="stream-session",source="` + session.Source.Type + `"} 2`
+	if !strings.Contains(during, want) {
+		t.Fatalf("expected %q while running:\n%s", want, during)
+	}
+
+	var b strings.Builder
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	if strings.Contains(b.String(), "stream-session") {
+		t.Fatalf("expected the session's series to be removed after the run:\n%s", b.String())
+	}
+}
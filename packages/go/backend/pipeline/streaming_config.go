@@ -0,0 +1,202 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"streamlation/packages/backend/archive"
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	"streamlation/packages/backend/translation"
+	"streamlation/packages/backend/tts"
+)
+
+// StreamingConfig wires the components of a StreamingRunner. The options
+// of each stage, and of the recordings a run leaves, are grouped in
+// sub-configs whose zero values turn them off.
+type StreamingConfig struct {
+	Sources    SourceFactory
+	Normalizer media.Normalizer
+	Recognizer asr.Recognizer
+	Translator translation.Translator
+	Generator  output.SubtitleGenerator
+	// Synthesizer dubs the translations of sessions with EnableDubbing set.
+	Synthesizer tts.Synthesizer
+	// BufferSize bounds every channel between stages so that a slow stage
+	// applies backpressure upstream instead of accumulating work in memory.
+	BufferSize int
+	// Policies bounds the processing latency and the queue of individual
+	// stages, keyed by stage. A stage that exceeds its timeout reports
+	// "timeout", and one that drops input reports "dropping". Stages
+	// without a policy may take as long as they need.
+	Policies map[string]StagePolicy
+
+	Normalization NormalizationConfig
+	Recognition   RecognitionConfig
+	Comparison    ComparisonConfig
+	Output        OutputConfig
+	Dubbing       DubbingConfig
+	Artifacts     ArtifactConfig
+	Archive       ArchiveConfig
+	Checkpoints   CheckpointConfig
+	Metrics       MetricsConfig
+}
+
+// NormalizationConfig configures what happens to normalized audio before
+// anything else judges it.
+type NormalizationConfig struct {
+	// Jitter, when set, reorders the normalized audio and smooths its
+	// timestamps.
+	Jitter *media.JitterConfig
+	// Diagnostics reports normalized audio that recognition will struggle
+	// with, such as audio at the wrong sample rate or a silent source.
+	Diagnostics MediaDiagnostics
+}
+
+// RecognitionConfig configures the audio passed to recognition and the
+// transcripts it produces.
+type RecognitionConfig struct {
+	// Silence pauses recognition while the normalized audio is silent,
+	// reported as asr "idle" and "resumed" events.
+	Silence SilenceGate
+	// Loudness, when set, normalizes the loudness of the audio.
+	Loudness *media.LoudnessConfig
+	// Window, when set, re-frames the audio into fixed windows with
+	// overlap.
+	Window *media.WindowConfig
+	// AudioDump, when set, writes the audio to WAV files on disk for
+	// operators to listen to.
+	AudioDump *media.AudioDumpConfig
+	// Models, when set, loads the model of each session's ModelProfile
+	// before the session starts, sharing loaded models between sessions
+	// within a memory budget. Waiting for a model is reported as asr
+	// "model-loading" and "model-loaded" events.
+	Models *asr.ModelManager
+	// Stabilization, when set, has recognizers that implement
+	// asr.PartialRecognizer emit stabilized partial transcripts, so that
+	// subtitles appear while a segment is still being spoken.
+	Stabilization *asr.StabilizationPolicy
+	// Diarization, when set, attributes transcripts to speakers by the
+	// pitch of their voices, and has dubbing give every speaker a voice.
+	Diarization *Diarization
+	// Punctuation, when set, restores punctuation, casing, and sentence
+	// boundaries in transcripts before they are translated, for
+	// recognizers that emit raw lowercase text.
+	Punctuation *Punctuation
+}
+
+// ComparisonConfig configures the candidates evaluated on live traffic.
+type ComparisonConfig struct {
+	// Candidates run alongside the recognizer and translator on a copy of
+	// their input, which is dropped when a candidate falls behind. Their
+	// results are scored against the primary's and reported in
+	// "comparison" events every Interval.
+	Candidates Candidates
+	Interval   time.Duration
+	// OnVariant receives the final transcripts and translations of both
+	// variants of every compared stage. It may be called concurrently.
+	OnVariant func(ctx context.Context, output VariantOutput)
+}
+
+// OutputConfig configures the subtitles of a run and where they are
+// published while it goes on.
+type OutputConfig struct {
+	// CueRules, when set, reshapes the cues Generator streams and renders as
+	// files so that they follow the readability rules of their language.
+	CueRules *output.CueFormatterConfig
+	// OnSubtitle receives each subtitle event as it is produced. A returned
+	// error fails the output stage.
+	OnSubtitle func(ctx context.Context, event output.SubtitleEvent) error
+	// SubtitleTracks, when set, receives the subtitles of every run in
+	// each of its languages as an HLS WebVTT rendition, which players can
+	// attach to the source stream. Segments are published SubtitleTrackDelay
+	// behind the source audio, so that the translations of their speech
+	// have arrived.
+	SubtitleTracks     output.ObjectStore
+	SubtitleTrackDelay time.Duration
+	// OpenCaptions, when set, republishes the segments of every run with
+	// an HLS source as an HLS variant with the subtitles of its first
+	// target language burned in by ffmpeg, keyed by the run's session and
+	// language. Segments are burned OpenCaptionDelay behind the source
+	// audio, for the same reason.
+	OpenCaptions     *output.OpenCaptionConfig
+	OpenCaptionDelay time.Duration
+}
+
+// DubbingConfig configures the speech synthesized for sessions with
+// dubbing enabled.
+type DubbingConfig struct {
+	// Fit, when set, fits the speech of every translation into the time of
+	// the source speech it translates, so that the dub keeps in sync with
+	// the source.
+	Fit *tts.DurationFitConfig
+	// OnAudio receives each synthesized audio segment. A returned error
+	// stops the dubbing of the segment's language.
+	OnAudio func(ctx context.Context, segment tts.AudioSegment) error
+	// Encoding, when set, has OnAudio receive the speech of every language
+	// encoded into AAC or Opus frames, ready to package for HLS, DASH or
+	// WebRTC, instead of raw PCM.
+	Encoding *tts.SpeechEncodingConfig
+	// Tracks, when set, receives the source audio ducked under the
+	// synthesized speech of each dubbed language, as HLS audio renditions
+	// below "<session>/hls/" offered by a master playlist. The mix lags
+	// the source by TrackDelay, so that speech is synthesized by the time
+	// its audio is mixed. Publishing requires a build that encodes AAC.
+	Tracks     output.ObjectStore
+	TrackDelay time.Duration
+}
+
+// ArtifactConfig configures the files persisted for every run that
+// completes.
+type ArtifactConfig struct {
+	// Writer, when set, persists the subtitles of the run as files in each
+	// of Formats, rendered by Generator from the run's final translations
+	// and keyed by session and language. A run resumed from a checkpoint
+	// persists what it translated itself. With Transcript, the run's
+	// source text aligned with its translations is also persisted as a
+	// JSONL transcript. With Package, the files of a run with several
+	// languages are also bundled in a zip package.
+	Writer     *output.ArtifactWriter
+	Formats    []output.SubtitleFormat
+	Transcript bool
+	Package    bool
+	// CueEdits, when set, has the formatted cues of every language
+	// persisted as its cue list, and its files render them with the edits
+	// of CueEdits applied, so that edits made while the run goes on are
+	// kept.
+	CueEdits output.CueEditStore
+}
+
+// ArchiveConfig configures the recording of every run.
+type ArchiveConfig struct {
+	// Store, when set, receives the normalized audio, the final
+	// source-language transcripts, and the final subtitles, written every
+	// Interval alongside a per-session manifest.
+	Store    archive.Store
+	Interval time.Duration
+}
+
+// CheckpointConfig configures how runs resume.
+type CheckpointConfig struct {
+	// Checkpointer, when set, persists the run's position every Interval
+	// and when it stops, and lets a later run of the session resume from
+	// it, reported as a "resuming" event.
+	Checkpointer Checkpointer
+	Interval     time.Duration
+}
+
+// MetricsConfig configures the instrumentation of every run. Each set of
+// metrics is recorded when set.
+type MetricsConfig struct {
+	// Stages records per-stage instrumentation.
+	Stages *StageMetrics
+	// Sources exposes the counters of the stream source.
+	Sources *SourceMetrics
+	// Translations counts the final translations by the variant that
+	// produced them.
+	Translations *TranslationMetrics
+	// Dubbing counts the synthesized segments and the drift left after
+	// fitting them.
+	Dubbing *DubbingMetrics
+}
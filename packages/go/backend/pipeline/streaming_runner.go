@@ -0,0 +1,942 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+	"streamlation/packages/backend/tts"
+)
+
+// DefaultStageBuffer is the capacity of each channel between streaming stages
+// when StreamingConfig.BufferSize is not set.
+const DefaultStageBuffer = 16
+
+// streamingStages lists the stages of a streaming run in pipeline order.
+var streamingStages = []string{"ingestion", "normalization", "asr", "translation", "output"}
+
+// SourceFactory opens the ingestion source for a session.
+type SourceFactory func(session sessionpkg.TranslationSession) (ingestion.StreamSource, error)
+
+// StreamingRunner runs every pipeline stage concurrently. Media chunks from
+// the session's source flow through normalization, recognition,
+// translation, and subtitle generation over bounded channels, so the first
+// subtitles are produced while the source is still being ingested. Sessions
+// with several target languages share one transcription, which is copied
+// into a translation and output branch per language.
+//
+// Each stage reports "running" when its first input arrives and, once the
+// source ends and every stage has drained, "completed" in pipeline order. A
+// failing stage reports "failed" with a structured code and stops the run,
+// or only its branch while other branches keep running. The sub-configs of
+// StreamingConfig add to the run; failing to write what they record or
+// publish is reported as a warning and does not stop it.
+type StreamingRunner struct {
+	config StreamingConfig
+	// formatter is the cue formatter Generator applies, if any, and
+	// renderer the generator it wraps, which renders formatted cues.
+	formatter *output.CueFormatter
+	renderer  output.SubtitleGenerator
+}
+
+// NewStreamingRunner validates config and returns a runner.
+func NewStreamingRunner(config StreamingConfig) (*StreamingRunner, error) {
+	switch {
+	case config.Sources == nil:
+		return nil, errors.New("source factory required")
+	case config.Normalizer == nil:
+		return nil, errors.New("normalizer required")
+	case config.Recognizer == nil:
+		return nil, errors.New("recognizer required")
+	case config.Translator == nil:
+		return nil, errors.New("translator required")
+	case config.Generator == nil:
+		return nil, errors.New("subtitle generator required")
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultStageBuffer
+	}
+	if config.Checkpoints.Interval <= 0 {
+		config.Checkpoints.Interval = DefaultCheckpointInterval
+	}
+	if config.Comparison.Interval <= 0 {
+		config.Comparison.Interval = DefaultComparisonInterval
+	}
+	if config.Archive.Interval <= 0 {
+		config.Archive.Interval = DefaultArchiveInterval
+	}
+	if config.Dubbing.TrackDelay <= 0 {
+		config.Dubbing.TrackDelay = DefaultDubTrackDelay
+	}
+	if config.Output.SubtitleTrackDelay <= 0 {
+		config.Output.SubtitleTrackDelay = DefaultSubtitleTrackDelay
+	}
+	if config.Output.OpenCaptionDelay <= 0 {
+		config.Output.OpenCaptionDelay = DefaultOpenCaptionDelay
+	}
+	renderer := config.Generator
+	var formatter *output.CueFormatter
+	if config.Output.CueRules != nil {
+		formatter = output.NewCueFormatter(*config.Output.CueRules)
+		config.Generator = output.NewFormattingGenerator(config.Generator, formatter)
+	}
+	if len(config.Artifacts.Formats) == 0 {
+		config.Artifacts.Formats = DefaultArtifactFormats
+	}
+	for _, format := range config.Artifacts.Formats {
+		switch format {
+		case output.FormatSRT, output.FormatVTT, output.FormatTTML, output.FormatSCC:
+		default:
+			return nil, fmt.Errorf("unsupported artifact format %q", format)
+		}
+	}
+	if config.Dubbing.Encoding != nil {
+		encoder, err := tts.NewSpeechEncoder(*config.Dubbing.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("dubbing encoding: %w", err)
+		}
+		_ = encoder.Close()
+	}
+	return &StreamingRunner{config: config, formatter: formatter, renderer: renderer}, nil
+}
+
+// stageFailure records which stage stopped the run and why.
+type stageFailure struct {
+	stage string
+	// language is set when the failure is confined to one branch of a
+	// multi-language session.
+	language string
+	code     statuspkg.ErrorCode
+	err      error
+}
+
+// Run streams the session through the pipeline until the source is exhausted,
+// a stage fails, or ctx is cancelled.
+//
+// Shutdown is ordered: the source is stopped first so no new media enters the
+// pipeline, then the remaining stages are cancelled, and Run waits for the
+// goroutines it started before returning.
+func (r *StreamingRunner) Run(ctx context.Context, session sessionpkg.TranslationSession, emit func(statuspkg.SessionStatusEvent) error) (err error) {
+	if emit == nil {
+		emit = func(statuspkg.SessionStatusEvent) error { return nil }
+	}
+	languages := session.TargetLanguages()
+	run := &streamRun{
+		sessionID:      session.ID,
+		targetLanguage: strings.Join(languages, ", "),
+		sourceType:     session.Source.Type,
+		bufferSize:     r.config.BufferSize,
+		policies:       r.config.Policies,
+		metrics:        r.config.Metrics.Stages,
+		notices:        make(chan statuspkg.SessionStatusEvent, noticeBuffer),
+		failures:       make(chan stageFailure, 1),
+		// Each branch fails at most once per stage. Options updates may add
+		// branches, up to the limit on additional languages.
+		branchFailures: make(chan stageFailure, 2*(len(languages)+sessionpkg.MaxAdditionalLanguages)),
+		restarts:       map[string]chan struct{}{"asr": make(chan struct{}, 1)},
+		runner:         r,
+		session:        session,
+		emit:           emit,
+		counters:       CountersFromContext(ctx),
+		everDubbed:     session.Options.EnableDubbing,
+		announced:      map[string]bool{"ingestion": true},
+	}
+	run.dubbing.Store(session.Options.EnableDubbing)
+
+	defer r.config.Metrics.Stages.forget(session.ID)
+	defer r.config.Metrics.Translations.forget(session.ID)
+	defer r.config.Metrics.Dubbing.forget(session.ID)
+
+	resume := run.startOutputs(ctx, languages)
+	defer func() { run.finishOutputs(ctx, err) }()
+	ticks := run.startTicks()
+	defer ticks.stop()
+
+	run.lease, err = acquireModel(ctx, r.config.Recognition.Models, r.config.Recognizer, session.ID, session.Options.ModelProfile, emit)
+	if err != nil {
+		var stageErr *statuspkg.StageError
+		if !errors.As(err, &stageErr) {
+			return err
+		}
+		return failStage(emit, session.ID, stageFailure{stage: "asr", code: statuspkg.CodeASRModelLoadFailed, err: err})
+	}
+	defer func() { run.lease.Release() }()
+
+	if err := emitStage(emit, session.ID, "ingestion", "running", run.runningDetail("ingestion", "")); err != nil {
+		return err
+	}
+	source, err := r.config.Sources(session)
+	if err != nil {
+		return failStage(emit, session.ID, stageFailure{
+			stage: "ingestion",
+			code:  statuspkg.CodeIngestionFailed,
+			err:   &statuspkg.StageError{Code: statuspkg.CodeSourceInvalid, Err: err},
+		})
+	}
+	r.config.Metrics.Sources.track(session.ID, session.Source.Type, source)
+	defer r.config.Metrics.Sources.forget(session.ID)
+	format := r.probeInput(ctx, source, session.Options.AudioTrack)
+
+	run.stageCtx, run.cancelStages = context.WithCancel(ctx)
+	defer run.cancelStages()
+	var sourceCtx context.Context
+	sourceCtx, run.cancelSource = context.WithCancel(run.stageCtx)
+	defer run.cancelSource()
+
+	transcripts, err := run.transcribe(sourceCtx, source, format)
+	if err != nil {
+		return err
+	}
+	defer run.cancelBranches()
+	if err := run.startBranches(transcripts, languages, resume); err != nil {
+		return err
+	}
+	if err := run.drive(ctx, ticks); err != nil {
+		return err
+	}
+	return run.complete(ctx, source)
+}
+
+// startOutputs starts what the run records and publishes besides its
+// subtitle events, and returns the checkpoint to resume from.
+func (run *streamRun) startOutputs(ctx context.Context, languages []string) Checkpoint {
+	r := run.runner
+	resume := run.startCheckpoints(ctx, languages)
+	run.recording = r.startArchive(ctx, run.sessionID, run.emit)
+	run.encoders = r.startDubEncoders()
+	run.dubs = r.startDubTrack(run.session, languages, run.emit)
+	run.captions = r.startSubtitleTrack(run.sessionID, run.emit)
+	run.burned = r.startOpenCaptions(run.sessionID, languages, run.emit)
+	run.artifacts = r.startArtifacts(run.sessionID, run.emit)
+	return resume
+}
+
+// finishOutputs finishes the outputs in the reverse order they started.
+// err is the result of the run.
+func (run *streamRun) finishOutputs(ctx context.Context, err error) {
+	run.artifacts.finish(ctx, err)
+	run.burned.finish(ctx)
+	if run.captions != nil {
+		run.captions.finish(ctx)
+	}
+	if run.dubs != nil {
+		run.dubs.finish(ctx)
+	}
+	run.encoders.close()
+	if run.recording != nil {
+		run.recording.finish(ctx, err)
+	}
+	if run.checkpoints != nil {
+		run.checkpoints.finish(ctx, err)
+	}
+}
+
+// startCheckpoints loads the session's checkpoint when checkpointing is
+// enabled and reports that the run resumes from it. It sets the tracker for
+// the run's position and the writer persisting it, which stays nil when
+// checkpointing is disabled, and returns the checkpoint to resume from,
+// which is empty when there is none.
+func (run *streamRun) startCheckpoints(ctx context.Context, languages []string) Checkpoint {
+	checkpointer := run.runner.config.Checkpoints.Checkpointer
+	if checkpointer == nil {
+		run.positions = newPositionTracker(run.sessionID, Checkpoint{}, languages)
+		return Checkpoint{}
+	}
+
+	resume, ok, err := checkpointer.Load(ctx, run.sessionID)
+	if err != nil || !ok {
+		resume = Checkpoint{}
+	}
+	run.positions = newPositionTracker(run.sessionID, resume, languages)
+	run.checkpoints = &checkpointWriter{store: checkpointer, tracker: run.positions, emit: run.emit}
+	switch {
+	case err != nil:
+		run.checkpoints.report(fmt.Errorf("starting over: %w", err))
+	case ok:
+		_ = emitStage(run.emit, run.sessionID, "pipeline", ResumingState, fmt.Sprintf("Resuming from %s of media", resume.MediaTime))
+	}
+	return resume
+}
+
+// runTicks carries the periodic work of a run. The channels of work the
+// run does not do are nil and never fire.
+type runTicks struct {
+	checkpoint <-chan time.Time
+	archive    <-chan time.Time
+	dubs       <-chan time.Time
+	captions   <-chan time.Time
+	comparison <-chan time.Time
+	tickers    []*time.Ticker
+}
+
+// startTicks starts a ticker for each kind of periodic work the run does.
+// It is called once the outputs have started.
+func (run *streamRun) startTicks() *runTicks {
+	config := &run.runner.config
+	ticks := &runTicks{}
+	every := func(interval time.Duration) <-chan time.Time {
+		ticker := time.NewTicker(interval)
+		ticks.tickers = append(ticks.tickers, ticker)
+		return ticker.C
+	}
+	if run.checkpoints != nil {
+		ticks.checkpoint = every(config.Checkpoints.Interval)
+	}
+	if run.recording != nil {
+		ticks.archive = every(config.Archive.Interval)
+	}
+	if run.dubs != nil {
+		ticks.dubs = every(dubTrackInterval)
+	}
+	if run.captions != nil {
+		ticks.captions = every(subtitleTrackInterval)
+	}
+	if config.Comparison.Candidates.Recognizer != nil || config.Comparison.Candidates.Translator != nil {
+		ticks.comparison = every(config.Comparison.Interval)
+	}
+	return ticks
+}
+
+// stop stops the tickers.
+func (ticks *runTicks) stop() {
+	for _, ticker := range ticks.tickers {
+		ticker.Stop()
+	}
+}
+
+// transcribe starts the stages from the source to the transcripts the
+// branches translate: ingestion, normalization, and recognition, with the
+// stages that prepare their input and refine their output. The source is
+// read until ctx is cancelled. When a stage fails to start it shuts the
+// run down and returns the failure.
+func (run *streamRun) transcribe(ctx context.Context, source ingestion.StreamSource, format *media.InputFormat) (<-chan asr.Transcript, error) {
+	config := &run.runner.config
+	stageCtx, session := run.stageCtx, run.session
+
+	chunks := queue(stageCtx, run, run.counters, "normalization", "", run.burned.attach(ctx, run, run.pumpSource(ctx, source, run.counters)))
+
+	audio, err := supervise(stageCtx, run, "normalization", "", chunks, func(ctx context.Context, in <-chan ingestion.MediaChunk) (<-chan media.AudioChunk, error) {
+		return media.NormalizeChunks(ctx, config.Normalizer, in, format)
+	}, func(chunk media.AudioChunk) {
+		run.counters.AddChunks(1)
+		run.counters.MarkChunk(chunk.Timestamp)
+		run.positions.markMedia(chunk.Timestamp)
+		run.recording.audio(chunk)
+		run.dubs.audio(chunk)
+		run.captions.audio(chunk)
+		run.burned.audio(chunk)
+	})
+	if err != nil {
+		return nil, run.abort(stageFailure{stage: "normalization", code: statuspkg.CodeNormalizationFailed, err: err})
+	}
+
+	audio = diagnoseMedia(stageCtx, run, config.Normalization.Diagnostics, audio)
+	audio = smoothTimestamps(stageCtx, run, config.Normalization.Jitter, audio)
+	audio = downmix(stageCtx, run, audio)
+	audio = gateSilence(stageCtx, run, config.Recognition.Silence, audio)
+	audio = normalizeLoudness(stageCtx, run, config.Recognition.Loudness, audio)
+	audio = frameWindows(stageCtx, run, config.Recognition.Window, audio)
+	audio = dumpAudio(stageCtx, run, config.Recognition.AudioDump, audio)
+	var pitch *pitchTrack
+	if config.Recognition.Diarization != nil {
+		pitch = &pitchTrack{}
+	}
+	audio = trackPitch(stageCtx, run, pitch, audio)
+
+	recognition := queue(stageCtx, run, run.counters, "asr", "", audio)
+	var recognitionCompared *comparison
+	if config.Comparison.Candidates.Recognizer != nil {
+		recognitionCompared = newComparison("asr", "")
+		run.comparisons = append(run.comparisons, recognitionCompared)
+		var candidate <-chan media.AudioChunk
+		recognition, candidate = teeCandidate(stageCtx, run, recognitionCompared, recognition, func(chunk media.AudioChunk) time.Duration {
+			return chunk.Timestamp + chunk.Duration
+		})
+		runCandidate(stageCtx, run, recognitionCompared, candidate, func(ctx context.Context, in <-chan media.AudioChunk) (<-chan asr.Transcript, error) {
+			ctx = asr.WithVocabulary(ctx, session.Options.Vocabulary)
+			return config.Comparison.Candidates.Recognizer.Recognize(ctx, session.ID, in)
+		}, func(transcript asr.Transcript) {
+			if output, final := transcriptOutput(transcript); final {
+				recognitionCompared.record(CandidateVariant, output)
+				run.publishVariant(stageCtx, VariantOutput{Stage: "asr", Variant: CandidateVariant, Transcript: &transcript})
+			}
+		})
+	}
+
+	languageLock := newLanguageLock(session.Options.SourceLanguage)
+	transcripts, err := supervise(stageCtx, run, "asr", "", recognition, func(ctx context.Context, in <-chan media.AudioChunk) (<-chan asr.Transcript, error) {
+		if languageLock != nil {
+			ctx = asr.WithLanguageLock(ctx, languageLock)
+		}
+		ctx = asr.WithVocabulary(ctx, session.Options.Vocabulary)
+		if policy := config.Recognition.Stabilization; policy != nil {
+			if partial, ok := config.Recognizer.(asr.PartialRecognizer); ok {
+				return partial.RecognizePartial(ctx, session.ID, in, *policy)
+			}
+		}
+		return config.Recognizer.Recognize(ctx, session.ID, in)
+	}, func(transcript asr.Transcript) {
+		if !transcript.Partial {
+			run.counters.AddTranscripts(1)
+		}
+		run.recording.transcript(transcript)
+		if output, final := transcriptOutput(transcript); final && recognitionCompared != nil {
+			recognitionCompared.record(PrimaryVariant, output)
+			run.publishVariant(stageCtx, VariantOutput{Stage: "asr", Variant: PrimaryVariant, Transcript: &transcript})
+		}
+	})
+	if err != nil {
+		return nil, run.abort(stageFailure{stage: "asr", code: statuspkg.CodeASRFailed, err: err})
+	}
+	transcripts = identifyLanguage(stageCtx, run, languageLock, transcripts)
+	transcripts = attributeSpeakers(stageCtx, run, config.Recognition.Diarization, pitch, transcripts)
+	return restorePunctuation(stageCtx, run, config.Recognition.Punctuation, transcripts), nil
+}
+
+// publishVariant hands a final output of a compared stage to OnVariant.
+func (run *streamRun) publishVariant(ctx context.Context, output VariantOutput) {
+	if onVariant := run.runner.config.Comparison.OnVariant; onVariant != nil {
+		output.SessionID = run.sessionID
+		onVariant(ctx, output)
+	}
+}
+
+// forgetComparison stops reporting the comparison of a branch that
+// stopped.
+func (run *streamRun) forgetComparison(branch *languageBranch) {
+	for i, compared := range run.comparisons {
+		if compared == branch.compared {
+			run.comparisons = append(run.comparisons[:i], run.comparisons[i+1:]...)
+			return
+		}
+	}
+}
+
+// reportComparisons emits the results of every compared stage so far.
+func (run *streamRun) reportComparisons() error {
+	for _, compared := range run.comparisons {
+		if err := run.emit(compared.event(run.sessionID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startBranches starts a translation and output branch per language on
+// transcripts, skipping what resume records as translated and continuing
+// its subtitle numbering. When a branch fails to start it shuts the run
+// down and returns the failure.
+func (run *streamRun) startBranches(transcripts <-chan asr.Transcript, languages []string, resume Checkpoint) error {
+	if resume.TranslationCursor > 0 {
+		transcripts = skipTranslated(run.stageCtx, run, transcripts, resume.TranslationCursor)
+	}
+
+	// Branch events are only tagged with their language when there is more
+	// than one branch. Branches added by an options update are always
+	// tagged.
+	initial := make([]*languageBranch, len(languages))
+	for i, language := range languages {
+		initial[i] = newLanguageBranch(run.stageCtx, language, len(languages) > 1)
+		if index, ok := resume.SubtitleIndex[language]; ok {
+			initial[i].indexOffset = index + 1
+		}
+	}
+	var inputs []<-chan asr.Transcript
+	run.set, inputs = newBranchSet(run.stageCtx, run, transcripts, initial)
+	run.live = len(initial)
+	for i, branch := range initial {
+		if failure, ok := run.startBranch(branch, inputs[i]); !ok {
+			return run.abort(failure)
+		}
+	}
+	return nil
+}
+
+// cancelBranches cancels the context of every branch started so far.
+func (run *streamRun) cancelBranches() {
+	if run.set == nil {
+		return
+	}
+	for _, branch := range run.set.branches {
+		branch.cancel()
+	}
+}
+
+// startBranch starts the translation and output stages of a joined
+// branch. When they fail to start it returns the failure and whether any
+// branch is left.
+func (run *streamRun) startBranch(branch *languageBranch, in <-chan asr.Transcript) (stageFailure, bool) {
+	config := &run.runner.config
+	session := run.session
+	in = queue(branch.ctx, run, run.counters, "translation", branch.tag, in)
+	glossary := sessionGlossary(session, branch.language)
+	if config.Comparison.Candidates.Translator != nil {
+		branch.compared = newComparison("translation", branch.tag)
+		run.comparisons = append(run.comparisons, branch.compared)
+		var candidate <-chan asr.Transcript
+		in, candidate = teeCandidate(branch.ctx, run, branch.compared, in, func(transcript asr.Transcript) time.Duration {
+			return transcript.EndTime
+		})
+		runCandidate(branch.ctx, run, branch.compared, candidate, func(ctx context.Context, in <-chan asr.Transcript) (<-chan translation.Translation, error) {
+			return translation.TranslateWithGlossary(ctx, config.Comparison.Candidates.Translator, session.ID, in, branch.language, glossary)
+		}, func(translated translation.Translation) {
+			if output, final := translationOutput(translated); final {
+				branch.compared.record(CandidateVariant, output)
+				run.publishVariant(branch.ctx, VariantOutput{Stage: "translation", Variant: CandidateVariant, Language: branch.language, Translation: &translated})
+			}
+		})
+	}
+
+	translations, err := supervise(branch.ctx, run, "translation", branch.tag, in, func(ctx context.Context, in <-chan asr.Transcript) (<-chan translation.Translation, error) {
+		return translation.TranslateWithGlossary(ctx, config.Translator, session.ID, in, branch.language, glossary)
+	}, func(translated translation.Translation) {
+		if !translated.Partial {
+			run.positions.markTranslated(branch.language, translated.EndTime)
+			config.Metrics.Translations.observe(session.ID, translated)
+		}
+		run.artifacts.translation(branch.language, translated)
+		if output, final := translationOutput(translated); final && branch.compared != nil {
+			branch.compared.record(PrimaryVariant, output)
+			run.publishVariant(branch.ctx, VariantOutput{Stage: "translation", Variant: PrimaryVariant, Language: branch.language, Translation: &translated})
+		}
+	})
+	if err != nil {
+		run.set.merge(branch, nil)
+		failure := stageFailure{stage: "translation", language: branch.tag, code: statuspkg.CodeTranslationFailed, err: err}
+		return failure, run.branchFailed(failure)
+	}
+
+	// With a synthesizer, the dubbing stage is started even while the
+	// session is not dubbed, so that an options update can switch it on.
+	if session.Options.EnableDubbing || config.Synthesizer != nil {
+		var speech <-chan translation.Translation
+		branch.dubbingCtx, branch.dubbingCancel = context.WithCancel(branch.ctx)
+		translations, speech = splitDubbing(run, branch, translations)
+		run.startDubbing(branch, speech)
+	}
+
+	events, err := supervise(branch.ctx, run, "output", branch.tag, queue(branch.ctx, run, run.counters, "output", branch.tag, translations), func(ctx context.Context, in <-chan translation.Translation) (<-chan output.SubtitleEvent, error) {
+		return config.Generator.StreamSubtitles(ctx, session.ID, in)
+	}, func(output.SubtitleEvent) {})
+	if err != nil {
+		run.set.merge(branch, nil)
+		failure := stageFailure{stage: "output", language: branch.tag, code: statuspkg.CodeOutputFailed, err: err}
+		return failure, run.branchFailed(failure)
+	}
+	run.set.merge(branch, events)
+	return stageFailure{}, true
+}
+
+// startDubbing starts the dubbing stage of a branch on the final
+// translations in speech. Dubbing events always carry the branch's
+// language, and a failure only stops the dubbing.
+func (run *streamRun) startDubbing(branch *languageBranch, speech <-chan translation.Translation) {
+	config := &run.runner.config
+	session := run.session
+	err := errors.New("no speech synthesizer configured")
+	var segments <-chan tts.AudioSegment
+	if synthesizer := config.Synthesizer; synthesizer != nil {
+		if config.Dubbing.Fit != nil {
+			synthesizer = tts.NewDurationFitter(synthesizer, *config.Dubbing.Fit)
+		}
+		voice, voices := voiceFor(synthesizer, session.Options, branch.language)
+		// The cast outlives restarts of the stage, so speakers keep their
+		// voices.
+		var cast *tts.VoiceCast
+		if config.Recognition.Diarization != nil {
+			cast = tts.NewVoiceCast(voices, voice)
+		}
+		segments, err = supervise(branch.dubbingCtx, run, "dubbing", branch.language, queue(branch.dubbingCtx, run, run.counters, "dubbing", branch.language, speech), func(ctx context.Context, in <-chan translation.Translation) (<-chan tts.AudioSegment, error) {
+			if cast != nil {
+				return tts.SynthesizeSpeakers(ctx, synthesizer, session.ID, in, cast)
+			}
+			return synthesizer.SynthesizeStream(ctx, session.ID, in, voice)
+		}, func(segment tts.AudioSegment) {
+			config.Metrics.Dubbing.observe(session.ID, branch.language, segment)
+		})
+	}
+	if err != nil {
+		run.dubbingFailed(stageFailure{stage: "dubbing", language: branch.language, code: statuspkg.CodeDubbingFailed, err: err})
+		return
+	}
+	run.set.mergeAudio(branch, segments)
+}
+
+// dubbingFailed stops the dubbing of the branch a failure names. The
+// branch keeps producing subtitles.
+func (run *streamRun) dubbingFailed(failure stageFailure) {
+	for _, branch := range run.set.branches {
+		if branch.language != failure.language || branch.dubbingCancel == nil || branch.dubbingFailed != nil || branch.failed != nil || branch.removed {
+			continue
+		}
+		branch.dubbingCancel()
+		branch.dubbingFailed = failStage(run.emit, run.sessionID, failure)
+	}
+}
+
+// branchFailed stops the branch a failure is confined to and reports
+// whether any branch is left.
+func (run *streamRun) branchFailed(failure stageFailure) bool {
+	if failure.stage == "dubbing" {
+		run.dubbingFailed(failure)
+		return true
+	}
+	for _, branch := range run.set.branches {
+		if branch.tag != failure.language || branch.failed != nil || branch.removed {
+			continue
+		}
+		if run.live--; run.live == 0 {
+			return false
+		}
+		branch.cancel()
+		branch.failed = failStage(run.emit, run.sessionID, failure)
+		run.positions.forget(branch.language)
+		run.forgetComparison(branch)
+	}
+	return true
+}
+
+// drive handles the events of the run until every branch has closed its
+// outputs. When it returns an error, the run has been shut down.
+func (run *streamRun) drive(ctx context.Context, ticks *runTicks) error {
+	updates := OptionUpdatesFromContext(ctx)
+	events, dubbed := run.set.subtitles(), run.set.speech()
+
+	for events != nil || dubbed != nil {
+		select {
+		case <-ctx.Done():
+			_ = run.stop()
+			return ctx.Err()
+		case failure := <-run.failures:
+			return run.abort(failure)
+		case failure := <-run.branchFailures:
+			if !run.branchFailed(failure) {
+				return run.abort(failure)
+			}
+		case event := <-run.notices:
+			if event.State == "running" {
+				run.announced[event.Stage] = true
+			}
+			if err := run.emit(event); err != nil {
+				_ = run.stop()
+				return err
+			}
+		case <-ticks.checkpoint:
+			run.checkpoints.save(ctx)
+		case <-ticks.archive:
+			run.recording.flush(ctx)
+		case <-ticks.dubs:
+			run.dubs.publish(ctx, false)
+		case <-ticks.captions:
+			run.captions.publish(ctx)
+		case <-ticks.comparison:
+			if err := run.reportComparisons(); err != nil {
+				_ = run.stop()
+				return err
+			}
+		case options := <-updates:
+			if err := run.update(options); err != nil {
+				return err
+			}
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if err := run.subtitle(ctx, event); err != nil {
+				return err
+			}
+		case segment, ok := <-dubbed:
+			if !ok {
+				dubbed = nil
+				continue
+			}
+			run.speech(ctx, segment)
+		}
+	}
+	return nil
+}
+
+// subtitle hands a subtitle event of any branch to the outputs. When it
+// returns an error, the run has been shut down.
+func (run *streamRun) subtitle(ctx context.Context, event output.SubtitleEvent) error {
+	run.positions.markSubtitle(event.Language, event.Index)
+	if event.Type == "add" {
+		run.counters.AddSubtitles(1)
+	}
+	// Partial cues count towards latency: showing them early is their
+	// point.
+	run.counters.ObserveOutput(event.EndTime)
+	run.recording.subtitle(event)
+	run.captions.subtitle(event)
+	run.burned.subtitle(event)
+	onSubtitle := run.runner.config.Output.OnSubtitle
+	if onSubtitle == nil {
+		return nil
+	}
+	if err := onSubtitle(ctx, event); err != nil {
+		return run.abort(stageFailure{stage: "output", code: statuspkg.CodeOutputFailed, err: err})
+	}
+	return nil
+}
+
+// speech hands a dubbed segment of any branch to the outputs. Failing to
+// deliver it only stops the dubbing of its branch.
+func (run *streamRun) speech(ctx context.Context, segment tts.AudioSegment) {
+	// Chunks of streamed speech count once per utterance.
+	if !segment.Partial {
+		run.counters.AddAudioSegments(1)
+	}
+	run.dubs.speech(segment)
+	onAudio := run.runner.config.Dubbing.OnAudio
+	if onAudio == nil {
+		return
+	}
+	segment, err := run.encoders.encode(segment)
+	if err == nil {
+		err = onAudio(ctx, segment)
+	}
+	if err != nil {
+		run.dubbingFailed(stageFailure{stage: "dubbing", language: segment.Language, code: statuspkg.CodeDubbingFailed, err: err})
+	}
+}
+
+// update applies an options update, or reports why it is rejected. When it
+// returns an error, the run has been shut down.
+func (run *streamRun) update(options sessionpkg.TranslationOptions) error {
+	change := planReconfiguration(run.session, options)
+	if err := change.rejection(run.runner.config.Synthesizer != nil); err != nil {
+		if err := run.emit(statuspkg.SessionStatusEvent{
+			SessionID: run.sessionID,
+			Stage:     "pipeline",
+			State:     ReconfigureRejectedState,
+			Detail:    err.Error(),
+			Severity:  statuspkg.SeverityWarning,
+			Timestamp: time.Now().UTC(),
+		}); err != nil {
+			_ = run.stop()
+			return err
+		}
+		return nil
+	}
+	if failure, ok := run.reconfigure(change, options); !ok {
+		return run.abort(failure)
+	}
+	if err := emitStage(run.emit, run.sessionID, "pipeline", ReconfiguredState, change.summary()); err != nil {
+		_ = run.stop()
+		return err
+	}
+	return nil
+}
+
+// reconfigure applies an options update, rebuilding only the stages change
+// affects. When that fails it returns the failure and whether the run can
+// go on.
+func (run *streamRun) reconfigure(change reconfiguration, options sessionpkg.TranslationOptions) (stageFailure, bool) {
+	config := &run.runner.config
+	run.session.Options = options
+	if change.dubbingChanged {
+		run.dubbing.Store(change.dubbing)
+		run.everDubbed = run.everDubbed || change.dubbing
+	}
+	for _, language := range change.removed {
+		branch := run.set.find(language)
+		if branch == nil {
+			continue
+		}
+		branch.removed = true
+		branch.cancel()
+		run.live--
+		run.positions.forget(language)
+		run.forgetComparison(branch)
+	}
+	for _, language := range change.added {
+		branch := newLanguageBranch(run.stageCtx, language, true)
+		in, ok := run.set.join(branch)
+		if !ok {
+			branch.cancel()
+			continue
+		}
+		run.live++
+		run.positions.track(language)
+		if failure, ok := run.startBranch(branch, in); !ok {
+			return failure, false
+		}
+	}
+	if change.modelProfile != "" {
+		if config.Recognition.Models != nil {
+			next, err := acquireModel(run.stageCtx, config.Recognition.Models, config.Recognizer, run.sessionID, change.modelProfile, run.emit)
+			if err != nil {
+				return stageFailure{stage: "asr", code: statuspkg.CodeASRModelLoadFailed, err: err}, false
+			}
+			run.lease.Release()
+			run.lease = next
+		} else if err := config.Recognizer.LoadModel(asr.ModelProfile(change.modelProfile)); err != nil {
+			return stageFailure{stage: "asr", code: statuspkg.CodeASRFailed, err: fmt.Errorf("load model profile %s: %w", change.modelProfile, err)}, false
+		}
+		run.restart("asr")
+	}
+	return stageFailure{}, true
+}
+
+// stop shuts the run down in order: the source first, then the remaining
+// stages, waiting for their goroutines. It then emits the notices that
+// were still queued, such as a timeout preceding a failure.
+func (run *streamRun) stop() error {
+	run.cancelSource()
+	run.cancelStages()
+	run.wg.Wait()
+	for {
+		select {
+		case event := <-run.notices:
+			if event.State == "running" {
+				continue
+			}
+			if err := run.emit(event); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// abort shuts the run down and reports failure as its result.
+func (run *streamRun) abort(failure stageFailure) error {
+	_ = run.stop()
+	return failStage(run.emit, run.sessionID, failure)
+}
+
+// complete shuts down a run whose branches have closed their outputs and,
+// unless it was cancelled or a stage failed, reports every stage
+// completed.
+func (run *streamRun) complete(ctx context.Context, source ingestion.StreamSource) error {
+	// The stages close their outputs when cancelled as well as when they run
+	// out of input, so check why the run ended before reporting success.
+	if err := run.stop(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case failure := <-run.failures:
+		return failStage(run.emit, run.sessionID, failure)
+	default:
+	}
+	for drained := false; !drained; {
+		select {
+		case failure := <-run.branchFailures:
+			if !run.branchFailed(failure) {
+				return failStage(run.emit, run.sessionID, failure)
+			}
+		default:
+			drained = true
+		}
+	}
+
+	if err := run.reportComparisons(); err != nil {
+		return err
+	}
+
+	// Announce, in order, the stages whose first input arrived after the
+	// last subtitle and those that never received any input.
+	for _, stage := range streamingStages {
+		if !run.announced[stage] {
+			if err := emitStage(run.emit, run.sessionID, stage, "running", run.runningDetail(stage, "")); err != nil {
+				return err
+			}
+		}
+	}
+
+	branches := run.set.branches
+	metrics := source.Metrics()
+	details := map[string]string{
+		"ingestion":     fmt.Sprintf("Ingested %d media chunks", metrics.ReceivedChunks),
+		"normalization": "Audio normalized",
+		"asr":           "Audio transcribed",
+		"translation":   "Translation complete",
+		"output":        "Generated " + itoa(totalSubtitles(branches)) + " subtitles",
+	}
+	if len(branches) > 1 {
+		details["translation"] = translationSummary(branches)
+	}
+	for _, stage := range streamingStages {
+		if stage == "translation" || stage == "output" {
+			if err := emitBranchCompletions(run.emit, run.sessionID, stage, branches); err != nil {
+				return err
+			}
+		}
+		if stage == "output" && run.everDubbed {
+			if err := emitDubbingCompletions(run.emit, run.sessionID, branches); err != nil {
+				return err
+			}
+		}
+		if err := emitStage(run.emit, run.sessionID, stage, "completed", details[stage]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probeTimeout bounds how long a run waits for its source to be probed.
+const probeTimeout = 10 * time.Second
+
+// probeInput probes source for the input format of a normalizer that
+// configures itself from one, carrying the session's audio track selection.
+// It returns nil when the normalizer does not, or when the source cannot be
+// probed and no track is selected, leaving the normalizer to detect the
+// format in the stream.
+func (r *StreamingRunner) probeInput(ctx context.Context, source ingestion.StreamSource, track *sessionpkg.AudioTrackSelection) *media.InputFormat {
+	if _, ok := r.config.Normalizer.(media.FormatNormalizer); !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	probe, err := ingestion.ProbeSource(ctx, source)
+	if err != nil {
+		if track == nil {
+			return nil
+		}
+		return &media.InputFormat{AudioTrack: track}
+	}
+	return &media.InputFormat{Container: probe.Container, Codecs: probe.Codecs, Bitrate: probe.Bitrate, Live: probe.Live, AudioTrack: track}
+}
+
+// emitStage sends a stage transition through emit.
+func emitStage(emit func(statuspkg.SessionStatusEvent) error, sessionID, stage, state, detail string) error {
+	return emit(statuspkg.SessionStatusEvent{
+		SessionID: sessionID,
+		Stage:     stage,
+		State:     state,
+		Detail:    detail,
+		Timestamp: time.Now().UTC(),
+	})
+}
+
+// failStage reports the failed stage and returns its error so the caller
+// can fail the run.
+func failStage(emit func(statuspkg.SessionStatusEvent) error, sessionID string, failure stageFailure) error {
+	event := statuspkg.SessionStatusEvent{
+		SessionID: sessionID,
+		Stage:     failure.stage,
+		State:     "failed",
+		Timestamp: time.Now().UTC(),
+	}
+	event = event.WithError(failure.err, failure.code)
+	event.Language = failure.language
+	_ = emit(event)
+	if failure.language != "" {
+		return fmt.Errorf("%s stage (%s): %w", failure.stage, failure.language, failure.err)
+	}
+	return fmt.Errorf("%s stage: %w", failure.stage, failure.err)
+}
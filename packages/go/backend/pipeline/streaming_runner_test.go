@@ -0,0 +1,539 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// stubSource emits fixed payloads and then, optionally, an error.
+type stubSource struct {
+	payloads [][]byte
+	err      error
+	// hold keeps the stream open after the payloads until ctx is cancelled.
+	hold bool
+	// dropped is reported as the number of chunks the source discarded.
+	dropped int64
+	// metadata holds the metadata of the chunks, by index.
+	metadata map[int]map[string]string
+	// duration is the duration of every chunk.
+	duration time.Duration
+}
+
+func (s *stubSource) Stream(ctx context.Context) (<-chan ingestion.MediaChunk, <-chan error) {
+	chunks := make(chan ingestion.MediaChunk)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		defer close(errs)
+		for i, payload := range s.payloads {
+			select {
+			case chunks <- ingestion.MediaChunk{Sequence: int64(i), Timestamp: time.Now(), Duration: s.duration, Payload: payload, Metadata: s.metadata[i]}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if s.err != nil {
+			errs <- s.err
+			return
+		}
+		if s.hold {
+			<-ctx.Done()
+		}
+	}()
+	return chunks, errs
+}
+
+func (s *stubSource) Metrics() ingestion.StreamMetrics {
+	return ingestion.StreamMetrics{ReceivedChunks: int64(len(s.payloads)), DroppedChunks: s.dropped}
+}
+
+// readingNormalizer emits one audio chunk for each read from the source so
+// tests can observe the bytes delivered by the runner.
+type readingNormalizer struct {
+	mu   sync.Mutex
+	read []byte
+}
+
+func (n *readingNormalizer) Normalize(ctx context.Context, source io.Reader) (<-chan media.AudioChunk, error) {
+	out := make(chan media.AudioChunk)
+	go func() {
+		defer close(out)
+		buf := make([]byte, 64)
+		var timestamp time.Duration
+		for {
+			count, err := source.Read(buf)
+			if count > 0 {
+				n.mu.Lock()
+				n.read = append(n.read, buf[:count]...)
+				n.mu.Unlock()
+				chunk := media.AudioChunk{Timestamp: timestamp, SampleRate: 16000, Channels: 1, PCMData: append([]byte(nil), buf[:count]...), Duration: 100 * time.Millisecond}
+				select {
+				case out <- chunk:
+					timestamp += chunk.Duration
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (n *readingNormalizer) Health() media.HealthStatus {
+	return media.HealthStatus{Healthy: true}
+}
+
+func (n *readingNormalizer) bytesRead() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return string(n.read)
+}
+
+func newStreamingTestRunner(t *testing.T, source ingestion.StreamSource, normalizer media.Normalizer, onSubtitle func(context.Context, output.SubtitleEvent) error) *StreamingRunner {
+	t.Helper()
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return source, nil
+		},
+		Normalizer: normalizer,
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{DefaultLanguage: "en"}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		BufferSize: 2,
+		Output: OutputConfig{
+			OnSubtitle: onSubtitle,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	return runner
+}
+
+func streamingSession() sessionpkg.TranslationSession {
+	return sessionpkg.TranslationSession{
+		ID:             "stream-session",
+		TargetLanguage: "es",
+		Source:         sessionpkg.TranslationSource{Type: "hls", URI: "https://example.com/live.m3u8"},
+	}
+}
+
+func TestStreamingRunnerFlowsSourceDataThroughEveryStage(t *testing.T) {
+	t.Parallel()
+
+	source := &stubSource{payloads: [][]byte{[]byte("first "), []byte("second "), []byte("third")}}
+	normalizer := &readingNormalizer{}
+	var subtitles []output.SubtitleEvent
+	runner := newStreamingTestRunner(t, source, normalizer, func(_ context.Context, event output.SubtitleEvent) error {
+		subtitles = append(subtitles, event)
+		return nil
+	})
+
+	counters := &Counters{}
+	var events []statuspkg.SessionStatusEvent
+	err := runner.Run(WithCounters(context.Background(), counters), streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if got := normalizer.bytesRead(); got != "first second third" {
+		t.Fatalf("expected source payloads to reach the normalizer, got %q", got)
+	}
+	if len(subtitles) == 0 {
+		t.Fatal("expected subtitles to be delivered")
+	}
+	snapshot := counters.Snapshot()
+	if snapshot.ChunksProcessed == 0 || snapshot.TranscriptsProduced == 0 || snapshot.SubtitlesEmitted != int64(len(subtitles)) {
+		t.Fatalf("unexpected throughput: %+v", snapshot)
+	}
+
+	running := map[string]bool{}
+	var completed []string
+	for _, event := range events {
+		switch event.State {
+		case "running":
+			if running[event.Stage] {
+				t.Fatalf("stage %s announced twice", event.Stage)
+			}
+			running[event.Stage] = true
+		case "completed":
+			if !running[event.Stage] {
+				t.Fatalf("stage %s completed before running", event.Stage)
+			}
+			completed = append(completed, event.Stage)
+		default:
+			t.Fatalf("unexpected event %+v", event)
+		}
+	}
+	if len(completed) != len(streamingStages) {
+		t.Fatalf("expected every stage to complete, got %v", completed)
+	}
+	for i, stage := range streamingStages {
+		if completed[i] != stage {
+			t.Fatalf("expected completions in pipeline order, got %v", completed)
+		}
+	}
+}
+
+func TestStreamingRunnerFormatsCues(t *testing.T) {
+	t.Parallel()
+
+	var subtitles []output.SubtitleEvent
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first second third")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{DefaultLanguage: "en"}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		Output: OutputConfig{
+			CueRules: &output.CueFormatterConfig{Rules: output.CueRules{MaxLineChars: 8}},
+			OnSubtitle: func(_ context.Context, event output.SubtitleEvent) error {
+				subtitles = append(subtitles, event)
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	if err := runner.Run(context.Background(), streamingSession(), nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if len(subtitles) == 0 {
+		t.Fatal("expected subtitles to be delivered")
+	}
+	for _, event := range subtitles {
+		for _, line := range strings.Split(event.Text, "\n") {
+			if len([]rune(line)) > 8 {
+				t.Fatalf("expected lines of at most 8 characters, got %q", event.Text)
+			}
+		}
+	}
+}
+
+func TestStreamingRunnerRefinesCuesFromPartialTranscripts(t *testing.T) {
+	t.Parallel()
+
+	var subtitles []output.SubtitleEvent
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{DefaultLanguage: "en", Partials: true}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		BufferSize: 2,
+		Output: OutputConfig{
+			OnSubtitle: func(_ context.Context, event output.SubtitleEvent) error {
+				subtitles = append(subtitles, event)
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	counters := &Counters{}
+	if err := runner.Run(WithCounters(context.Background(), counters), streamingSession(), nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	cues := 0
+	for i, event := range subtitles {
+		switch event.Type {
+		case "add":
+			if !event.Partial || event.Index != cues {
+				t.Fatalf("expected cue %d to start as a partial, got %+v", cues, event)
+			}
+			cues++
+		case "update":
+			if previous := subtitles[i-1]; event.Index != previous.Index || !previous.Partial {
+				t.Fatalf("expected update to refine the open cue, got %+v after %+v", event, previous)
+			}
+		default:
+			t.Fatalf("unexpected subtitle event %+v", event)
+		}
+	}
+	if last := subtitles[len(subtitles)-1]; last.Partial {
+		t.Fatalf("expected the last cue to be final, got %+v", last)
+	}
+	snapshot := counters.Snapshot()
+	if cues == 0 || snapshot.SubtitlesEmitted != int64(cues) || snapshot.TranscriptsProduced != int64(cues) {
+		t.Fatalf("expected only final transcripts and new cues to be counted, got %+v for %d cues", snapshot, cues)
+	}
+}
+
+func TestStreamingRunnerRequestsStabilizedPartials(t *testing.T) {
+	t.Parallel()
+
+	var subtitles []output.SubtitleEvent
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{DefaultLanguage: "en"}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		Recognition: RecognitionConfig{
+			Stabilization: &asr.StabilizationPolicy{},
+		},
+		Output: OutputConfig{
+			OnSubtitle: func(_ context.Context, event output.SubtitleEvent) error {
+				subtitles = append(subtitles, event)
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	if err := runner.Run(context.Background(), streamingSession(), nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	partials := 0
+	for _, event := range subtitles {
+		if event.Partial {
+			partials++
+		}
+	}
+	if partials == 0 || subtitles[len(subtitles)-1].Partial {
+		t.Fatalf("expected partial cues refined into final ones, got %+v", subtitles)
+	}
+}
+
+func TestStreamingRunnerFailsWhenSourceErrors(t *testing.T) {
+	t.Parallel()
+
+	source := &stubSource{payloads: [][]byte{[]byte("partial")}, err: errors.New("connection reset")}
+	runner := newStreamingTestRunner(t, source, &readingNormalizer{}, nil)
+
+	var events []statuspkg.SessionStatusEvent
+	err := runner.Run(context.Background(), streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	var stageErr *statuspkg.StageError
+	if !errors.As(err, &stageErr) || stageErr.Code != statuspkg.CodeSourceUnreachable {
+		t.Fatalf("expected source unreachable error, got %v", err)
+	}
+
+	last := events[len(events)-1]
+	if last.Stage != "ingestion" || last.State != "failed" || last.Code != statuspkg.CodeSourceUnreachable || !last.Retryable {
+		t.Fatalf("expected retryable ingestion failure, got %+v", last)
+	}
+	for _, event := range events {
+		if event.State == "completed" {
+			t.Fatalf("no stage should complete after a source failure, got %+v", event)
+		}
+	}
+}
+
+func TestStreamingRunnerClassifiesSourceErrors(t *testing.T) {
+	t.Parallel()
+
+	source := &stubSource{payloads: [][]byte{[]byte("partial")}, err: statuspkg.Fatal(errors.New("playlist returned 404 Not Found"))}
+	var events []statuspkg.SessionStatusEvent
+	err := newStreamingTestRunner(t, source, &readingNormalizer{}, nil).Run(context.Background(), streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if !errors.Is(err, statuspkg.ErrFatal) {
+		t.Fatalf("expected the fatal source error, got %v", err)
+	}
+	if last := events[len(events)-1]; last.Stage != "ingestion" || last.State != "failed" || last.Retryable {
+		t.Fatalf("expected a permanent ingestion failure, got %+v", last)
+	}
+
+	source = &stubSource{payloads: [][]byte{[]byte("whole")}, err: statuspkg.ErrSourceEnded}
+	normalizer := &readingNormalizer{}
+	if err := newStreamingTestRunner(t, source, normalizer, nil).Run(context.Background(), streamingSession(), nil); err != nil {
+		t.Fatalf("expected an ended source to complete the run, got %v", err)
+	}
+	if normalizer.bytesRead() != "whole" {
+		t.Fatalf("expected the source's data to be processed, read %q", normalizer.bytesRead())
+	}
+}
+
+func TestStreamingRunnerReportsInvalidSource(t *testing.T) {
+	t.Parallel()
+
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return nil, errors.New("unsupported source type")
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(nil),
+		Translator: translation.NewStubTranslator(nil),
+		Generator:  output.NewStubGenerator(),
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	var last statuspkg.SessionStatusEvent
+	err = runner.Run(context.Background(), streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		last = event
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error for invalid source")
+	}
+	if last.State != "failed" || last.Code != statuspkg.CodeSourceInvalid || last.Retryable {
+		t.Fatalf("expected non-retryable invalid source event, got %+v", last)
+	}
+}
+
+func TestStreamingRunnerFailsOutputStageWhenSinkErrors(t *testing.T) {
+	t.Parallel()
+
+	source := &stubSource{payloads: [][]byte{[]byte("audio")}, hold: true}
+	runner := newStreamingTestRunner(t, source, &readingNormalizer{}, func(context.Context, output.SubtitleEvent) error {
+		return errors.New("disk full")
+	})
+
+	var last statuspkg.SessionStatusEvent
+	err := runner.Run(context.Background(), streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		last = event
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected sink error to fail the run")
+	}
+	if last.Stage != "output" || last.State != "failed" || last.Code != statuspkg.CodeOutputFailed {
+		t.Fatalf("expected output failure, got %+v", last)
+	}
+}
+
+func TestStreamingRunnerStopsWhenCancelled(t *testing.T) {
+	t.Parallel()
+
+	source := &stubSource{payloads: [][]byte{[]byte("audio")}, hold: true}
+	runner := newStreamingTestRunner(t, source, &readingNormalizer{}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runner.Run(ctx, streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+			if event.Stage == "output" && event.State == "running" {
+				cancel()
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context cancellation, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runner did not stop after cancellation")
+	}
+}
+
+func TestNewStreamingRunnerRequiresComponents(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewStreamingRunner(StreamingConfig{}); err == nil {
+		t.Fatal("expected missing components to be rejected")
+	}
+}
+
+// probedSource is a stubSource that describes its media when probed.
+type probedSource struct {
+	stubSource
+	probe ingestion.SourceProbe
+	err   error
+}
+
+func (s *probedSource) Probe(context.Context) (ingestion.SourceProbe, error) {
+	return s.probe, s.err
+}
+
+// formatNormalizer is a readingNormalizer that records the input formats
+// it is configured with.
+type formatNormalizer struct {
+	readingNormalizer
+	formats []media.InputFormat
+}
+
+func (n *formatNormalizer) NormalizeFormat(ctx context.Context, source io.Reader, format media.InputFormat) (<-chan media.AudioChunk, error) {
+	n.mu.Lock()
+	n.formats = append(n.formats, format)
+	n.mu.Unlock()
+	return n.Normalize(ctx, source)
+}
+
+func TestStreamingRunnerConfiguresNormalizerFromProbe(t *testing.T) {
+	t.Parallel()
+
+	source := &probedSource{
+		stubSource: stubSource{payloads: [][]byte{[]byte("first "), []byte("second")}},
+		probe:      ingestion.SourceProbe{Container: "mpegts", Codecs: []string{"mp4a.40.2"}, Bitrate: 128000, SegmentDuration: 4 * time.Second, Live: true},
+	}
+	normalizer := &formatNormalizer{}
+	runner := newStreamingTestRunner(t, source, normalizer, nil)
+	if err := runner.Run(context.Background(), streamingSession(), nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(normalizer.formats) != 1 {
+		t.Fatalf("expected the normalizer to be configured once, got %+v", normalizer.formats)
+	}
+	if got := normalizer.formats[0]; got.Container != "mpegts" || got.Bitrate != 128000 || !got.Live || len(got.Codecs) != 1 {
+		t.Fatalf("unexpected input format %+v", got)
+	}
+	if got := normalizer.bytesRead(); got != "first second" {
+		t.Fatalf("expected source payloads to reach the normalizer, got %q", got)
+	}
+
+	// A source that cannot be probed leaves the normalizer to detect the
+	// format itself.
+	source.err = errors.New("playlist returned 404 Not Found")
+	normalizer = &formatNormalizer{}
+	runner = newStreamingTestRunner(t, source, normalizer, nil)
+	if err := runner.Run(context.Background(), streamingSession(), nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(normalizer.formats) != 0 || normalizer.bytesRead() != "first second" {
+		t.Fatalf("expected an unconfigured run, got %+v", normalizer.formats)
+	}
+
+	// The session's audio track selection still reaches the normalizer.
+	session := streamingSession()
+	session.Options.AudioTrack = &sessionpkg.AudioTrackSelection{Language: "en"}
+	normalizer = &formatNormalizer{}
+	runner = newStreamingTestRunner(t, source, normalizer, nil)
+	if err := runner.Run(context.Background(), session, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(normalizer.formats) != 1 || normalizer.formats[0].AudioTrack == nil || normalizer.formats[0].AudioTrack.Language != "en" {
+		t.Fatalf("expected the audio track to be passed on, got %+v", normalizer.formats)
+	}
+}
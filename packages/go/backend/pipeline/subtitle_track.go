@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// DefaultSubtitleTrackDelay is how far the subtitle tracks of a streaming
+// run lag its source audio when OutputConfig.SubtitleTrackDelay is not set.
+const DefaultSubtitleTrackDelay = 10 * time.Second
+
+// SubtitleTrackState marks the warning a run emits when publishing its
+// subtitle tracks fails.
+const SubtitleTrackState = "subtitle_track"
+
+// subtitleTrackInterval is how often a run publishes the subtitle segments
+// its source audio has aged past.
+const subtitleTrackInterval = time.Second
+
+// subtitleTrack publishes the subtitles of every language of a run as an
+// HLS WebVTT rendition, "<session>/hls/subs-<language>.m3u8", whose
+// segments cover the run's source audio from its first chunk on. A segment
+// is published once the source audio is the delay past its end, so that
+// the translations of the speech in it have arrived.
+//
+// A failure to publish is reported once as a warning and stops the
+// publishing; it never fails the run. A nil track publishes nothing.
+type subtitleTrack struct {
+	store     output.ObjectStore
+	sessionID string
+	delay     time.Duration
+	emit      func(statuspkg.SessionStatusEvent) error
+
+	// mu guards the time of the source audio, which the normalization
+	// stage marks.
+	mu      sync.Mutex
+	started bool
+	start   time.Duration
+	latest  time.Duration
+
+	// The rest is owned by the run's event loop.
+	renditions map[string]*output.HLSSubtitleRendition
+	languages  []string
+	failed     bool
+}
+
+// startSubtitleTrack returns the subtitle track of a run of sessionID, or
+// nil when subtitle tracks are not published.
+func (r *StreamingRunner) startSubtitleTrack(sessionID string, emit func(statuspkg.SessionStatusEvent) error) *subtitleTrack {
+	if r.config.Output.SubtitleTracks == nil {
+		return nil
+	}
+	return &subtitleTrack{
+		store:      r.config.Output.SubtitleTracks,
+		sessionID:  sessionID,
+		delay:      r.config.Output.SubtitleTrackDelay,
+		emit:       emit,
+		renditions: make(map[string]*output.HLSSubtitleRendition),
+	}
+}
+
+func (t *subtitleTrack) audio(chunk media.AudioChunk) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.started {
+		t.started, t.start = true, chunk.Timestamp
+	}
+	t.latest = max(t.latest, chunk.Timestamp+chunk.Duration)
+}
+
+// subtitle adds event to the rendition of its language, opening it with
+// the language's first event.
+func (t *subtitleTrack) subtitle(event output.SubtitleEvent) {
+	if t == nil || t.failed {
+		return
+	}
+	rendition := t.renditions[event.Language]
+	if rendition == nil {
+		t.mu.Lock()
+		start := t.start
+		t.mu.Unlock()
+		var err error
+		rendition, err = output.NewHLSSubtitleRendition(output.HLSSubtitleRenditionConfig{
+			Store: t.store,
+			Key:   t.sessionID + "/hls/subs-" + event.Language + ".m3u8",
+			Start: start,
+		})
+		if err != nil {
+			t.fail(fmt.Errorf("open %s subtitle track: %w", event.Language, err))
+			return
+		}
+		t.renditions[event.Language] = rendition
+		t.languages = append(t.languages, event.Language)
+	}
+	if err := rendition.Write(event); err != nil {
+		t.fail(fmt.Errorf("publish %s subtitle track: %w", event.Language, err))
+	}
+}
+
+// publish publishes the segments the source audio is the delay past.
+func (t *subtitleTrack) publish(ctx context.Context) {
+	if t == nil || t.failed {
+		return
+	}
+	t.mu.Lock()
+	until := t.latest - t.delay
+	t.mu.Unlock()
+	for _, language := range t.languages {
+		if err := t.renditions[language].Publish(ctx, until); err != nil {
+			t.fail(fmt.Errorf("publish %s subtitle track: %w", language, err))
+			return
+		}
+	}
+}
+
+// finish publishes the rest of the subtitles and ends the renditions.
+func (t *subtitleTrack) finish(ctx context.Context) {
+	if t == nil || t.failed {
+		return
+	}
+	// The run's context is usually cancelled by now.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	for _, language := range t.languages {
+		if err := t.renditions[language].Close(ctx); err != nil {
+			t.fail(fmt.Errorf("publish %s subtitle track: %w", language, err))
+			return
+		}
+	}
+}
+
+// fail reports err and stops publishing.
+func (t *subtitleTrack) fail(err error) {
+	t.failed = true
+	_ = t.emit(statuspkg.SessionStatusEvent{
+		SessionID: t.sessionID,
+		Stage:     "pipeline",
+		State:     SubtitleTrackState,
+		Detail:    err.Error(),
+		Code:      statuspkg.CodeOutputFailed,
+		Severity:  statuspkg.SeverityWarning,
+		Timestamp: time.Now().UTC(),
+	})
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"streamlation/packages/backend/archive"
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// refusingStore fails every write.
+type refusingStore struct{}
+
+func (refusingStore) Put(context.Context, string, io.Reader) error {
+	return errors.New("disk full")
+}
+
+func runSubtitleTrack(t *testing.T, store output.ObjectStore) []statuspkg.SessionStatusEvent {
+	t.Helper()
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first "), []byte("second "), []byte("third")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		Output: OutputConfig{
+			SubtitleTracks: store,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+	var warnings []statuspkg.SessionStatusEvent
+	err = runner.Run(context.Background(), streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		if event.State == SubtitleTrackState {
+			warnings = append(warnings, event)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected subtitle tracks not to fail the run, got %v", err)
+	}
+	return warnings
+}
+
+func TestStreamingRunnerPublishesSubtitleTracks(t *testing.T) {
+	t.Parallel()
+
+	store, err := archive.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new file store: %v", err)
+	}
+	if warnings := runSubtitleTrack(t, store); len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %+v", warnings)
+	}
+
+	playlist := readObject(t, store, "stream-session/hls/subs-es.m3u8")
+	if !strings.HasSuffix(playlist, "#EXT-X-ENDLIST\n") || !strings.Contains(playlist, "subs-es/00000.vtt") {
+		t.Fatalf("expected an ended subtitle playlist, got %q", playlist)
+	}
+	segment := readObject(t, store, "stream-session/hls/subs-es/00000.vtt")
+	if !strings.HasPrefix(segment, "WEBVTT\nX-TIMESTAMP-MAP=") || strings.Count(segment, " --> ") != 3 {
+		t.Fatalf("expected the three cues of the run, got %q", segment)
+	}
+}
+
+func TestStreamingRunnerReportsSubtitleTrackFailuresOnce(t *testing.T) {
+	t.Parallel()
+
+	warnings := runSubtitleTrack(t, refusingStore{})
+	if len(warnings) != 1 || warnings[0].Code != statuspkg.CodeOutputFailed || warnings[0].Severity != statuspkg.SeverityWarning {
+		t.Fatalf("expected a single subtitle track warning, got %+v", warnings)
+	}
+	if !strings.Contains(warnings[0].Detail, "disk full") {
+		t.Fatalf("expected the warning to name the failure, got %q", warnings[0].Detail)
+	}
+}
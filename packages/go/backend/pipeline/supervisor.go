@@ -0,0 +1,563 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// TimeoutState marks a status event reporting that a stage exceeded its
+// processing deadline.
+const TimeoutState = "timeout"
+
+// Default backoff bounds for RetryPolicy.
+const (
+	DefaultRetryBackoff    = 200 * time.Millisecond
+	DefaultMaxRetryBackoff = 5 * time.Second
+)
+
+// StagePolicy bounds the processing latency of one stage and says how it
+// recovers from failures.
+type StagePolicy struct {
+	// Timeout is the longest the stage may hold input without producing
+	// output. Zero disables the check.
+	Timeout time.Duration
+	// Retries is how many times the stage is restarted after timing out
+	// before the pipeline fails. Input the stage was working on when it
+	// timed out is lost.
+	Retries int
+	// Retry governs restarts after transient failures.
+	Retry RetryPolicy
+	// Capacity bounds the stage's input queue. Zero uses the runner's
+	// buffer size.
+	Capacity int
+	// Drop says what happens to input arriving while the queue is full.
+	// Dropped items are counted and reported. Empty means DropBlock.
+	Drop DropPolicy
+}
+
+// RetryPolicy restarts a stage that fails transiently, waiting with
+// exponential backoff between attempts, instead of failing the pipeline. A
+// failure is transient when statuspkg.IsTransient says so: it is marked
+// statuspkg.ErrTransient, directly or as a Retryable StageError, or reports
+// itself as Temporary, and is not marked statuspkg.ErrFatal. Only the failed
+// stage is restarted; the rest of the pipeline keeps running.
+type RetryPolicy struct {
+	// Attempts is the number of consecutive retries allowed. The count is
+	// reset whenever the stage produces output. Zero disables retries.
+	Attempts int
+	// Backoff is the wait before the first retry, doubling for each further
+	// consecutive retry up to MaxBackoff. Zero values use
+	// DefaultRetryBackoff and DefaultMaxRetryBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// delay returns the wait before the given zero-based consecutive retry.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	backoff, limit := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	if limit <= 0 {
+		limit = DefaultMaxRetryBackoff
+	}
+	for i := 0; i < retry && backoff < limit; i++ {
+		backoff *= 2
+	}
+	if backoff > limit {
+		backoff = limit
+	}
+	return backoff
+}
+
+// stageFailureCodes are the fallback codes reported when a stage fails.
+var stageFailureCodes = map[string]statuspkg.ErrorCode{
+	"ingestion":     statuspkg.CodeIngestionFailed,
+	"normalization": statuspkg.CodeNormalizationFailed,
+	"asr":           statuspkg.CodeASRFailed,
+	"translation":   statuspkg.CodeTranslationFailed,
+	"output":        statuspkg.CodeOutputFailed,
+	"dubbing":       statuspkg.CodeDubbingFailed,
+}
+
+// noticeBuffer is the capacity of the channel carrying status events from
+// stage goroutines to the goroutine that emits them.
+const noticeBuffer = 32
+
+// streamRun holds the state shared by the goroutines of one streaming run.
+// Stage goroutines never call emit themselves; they queue notices and
+// failures for Run, which emits them from a single goroutine.
+type streamRun struct {
+	sessionID      string
+	targetLanguage string
+	sourceType     string
+	bufferSize     int
+	policies       map[string]StagePolicy
+	metrics        *StageMetrics
+
+	wg       sync.WaitGroup
+	notices  chan statuspkg.SessionStatusEvent
+	failures chan stageFailure
+	// branchFailures carries failures of single branches of a
+	// multi-language session, which do not end the run on their own.
+	branchFailures chan stageFailure
+	// restarts signals stages to replace their attempt, keyed by stage. It
+	// is not modified once the run has started.
+	restarts map[string]chan struct{}
+	// dubbing gates the dubbing stage of every branch. Options updates
+	// switch it while the run goes on.
+	dubbing atomic.Bool
+
+	// The fields below are only used by the goroutine running Run, which
+	// builds the stages, handles their events, and shuts them down.
+	runner   *StreamingRunner
+	session  sessionpkg.TranslationSession
+	emit     func(statuspkg.SessionStatusEvent) error
+	counters *Counters
+	lease    *asr.ModelLease
+	// stageCtx is cancelled to stop every stage, after the context the
+	// source is read with, which cancelSource cancels.
+	stageCtx     context.Context
+	cancelStages context.CancelFunc
+	cancelSource context.CancelFunc
+
+	positions   *positionTracker
+	checkpoints *checkpointWriter
+	recording   *archiveWriter
+	encoders    *dubEncoders
+	dubs        *dubTrack
+	captions    *subtitleTrack
+	burned      *openCaptionTrack
+	artifacts   *artifactCollector
+
+	set *branchSet
+	// live counts the branches that have neither failed nor been removed.
+	live int
+	// everDubbed is set once the run has dubbed, so that dubbing reports
+	// its completion.
+	everDubbed bool
+	// announced records the stages that reported running.
+	announced map[string]bool
+	// comparisons lists the compared stages in the order they started.
+	comparisons []*comparison
+}
+
+// restart asks stage to replace its current attempt with a new one that
+// continues from the remaining input. Input the attempt was working on is
+// lost.
+func (run *streamRun) restart(stage string) {
+	select {
+	case run.restarts[stage] <- struct{}{}:
+	default:
+	}
+}
+
+// notify queues event for emission, giving up if ctx is cancelled.
+func (run *streamRun) notify(ctx context.Context, event statuspkg.SessionStatusEvent) {
+	event.SessionID = run.sessionID
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	select {
+	case run.notices <- event:
+	case <-ctx.Done():
+	}
+}
+
+// fail records the first failure of the run; later failures are dropped.
+// Failures of a branch are queued separately for Run to handle.
+func (run *streamRun) fail(failure stageFailure) {
+	if failure.language != "" {
+		select {
+		case run.branchFailures <- failure:
+		default:
+		}
+		return
+	}
+	select {
+	case run.failures <- failure:
+	default:
+	}
+}
+
+// pumpSource forwards chunks from source until it closes both of its
+// channels, reports an error, or ctx is cancelled. Chunks the source itself
+// drops are reported as drops of the ingestion stage, switches to a backup
+// source as "failover" events, and switches between the variants of an
+// adaptive stream as "variant-switch" events.
+func (run *streamRun) pumpSource(ctx context.Context, source ingestion.StreamSource, counters *Counters) <-chan ingestion.MediaChunk {
+	chunks, errs := source.Stream(ctx)
+	out := make(chan ingestion.MediaChunk, run.bufferSize)
+	reporter := newDropReporter(run, counters, "ingestion", "", "source buffer full")
+	var dropped int64
+	checkDrops := func() {
+		total := source.Metrics().DroppedChunks
+		reporter.add(ctx, total-dropped)
+		dropped = total
+	}
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		defer reporter.flush(ctx)
+		defer checkDrops()
+		// An error may still be pending after chunks closes, so the source
+		// is only finished once both channels are closed.
+		for chunks != nil || errs != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				if err == nil || errors.Is(err, statuspkg.ErrSourceEnded) {
+					continue
+				}
+				// Sources retry internally, so anything not known to be
+				// fatal is worth retrying the session for.
+				run.fail(stageFailure{
+					stage: "ingestion",
+					code:  statuspkg.CodeIngestionFailed,
+					err:   &statuspkg.StageError{Code: statuspkg.CodeSourceUnreachable, Retryable: !errors.Is(err, statuspkg.ErrFatal), Err: err},
+				})
+				return
+			case chunk, ok := <-chunks:
+				if !ok {
+					chunks = nil
+					continue
+				}
+				checkDrops()
+				run.metrics.observe(run.sessionID, "ingestion", 0)
+				if chunk.Metadata["failover"] == "true" {
+					run.notify(ctx, statuspkg.SessionStatusEvent{
+						Stage:    "ingestion",
+						State:    statuspkg.FailoverState,
+						Detail:   fmt.Sprintf("switched to backup source %s", chunk.Metadata["sourceIndex"]),
+						Code:     statuspkg.CodeSourceFailover,
+						Severity: statuspkg.SeverityWarning,
+					})
+				}
+				if direction := chunk.Metadata["variantSwitch"]; direction != "" {
+					// Stepping down trades quality for keeping up, which is
+					// worth a warning; stepping back up is not.
+					severity := statuspkg.SeverityInfo
+					if direction == "down" {
+						severity = statuspkg.SeverityWarning
+					}
+					run.notify(ctx, statuspkg.SessionStatusEvent{
+						Stage:    "ingestion",
+						State:    statuspkg.VariantSwitchState,
+						Detail:   fmt.Sprintf("switched %s to the %s bps variant", direction, chunk.Metadata["bandwidth"]),
+						Code:     statuspkg.CodeSourceVariantSwitch,
+						Severity: severity,
+					})
+				}
+				select {
+				case out <- chunk:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// startFunc starts one attempt of a stage reading from in. The attempt must
+// stop and close its output when ctx is cancelled. An attempt that closes its
+// output because of a failure reports it with statuspkg.ReportStageError.
+type startFunc[In, Out any] func(ctx context.Context, in <-chan In) (<-chan Out, error)
+
+// reportedError keeps the first error reported by a stage attempt.
+type reportedError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (r *reportedError) set(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *reportedError) get() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// supervise runs a stage between upstream and a bounded output channel,
+// calling observe for every output. It announces the stage as running when
+// the stage accepts its first input and enforces the stage's policy:
+//
+//   - When the stage holds input for longer than the timeout without
+//     producing output, the attempt is cancelled, a timeout event is emitted,
+//     and the stage is either restarted on the remaining input or the run
+//     fails.
+//   - When the stage fails to start, or reports a failure and closes its
+//     output, a transient failure is retried with backoff after emitting a
+//     retrying event. Other failures fail the run.
+//
+// Stages serving one branch of a multi-language session pass its language,
+// which is attached to their events and failures.
+//
+// The first attempt is started before supervise returns so that
+// construction errors are reported to the caller.
+func supervise[In, Out any](ctx context.Context, run *streamRun, stage, language string, upstream <-chan In, start startFunc[In, Out], observe func(Out)) (<-chan Out, error) {
+	policy := run.policies[stage]
+
+	var (
+		attempt       int
+		retries       int
+		cancelAttempt context.CancelFunc = func() {}
+		attemptIn     chan In
+		attemptOut    <-chan Out
+		attemptErr    *reportedError
+	)
+	// launch starts a new attempt, retrying transient start failures.
+	launch := func() error {
+		for {
+			attempt++
+			var attemptCtx context.Context
+			attemptCtx, cancelAttempt = context.WithCancel(ctx)
+			reported := &reportedError{}
+			attemptCtx = statuspkg.WithStageErrorReporter(attemptCtx, reported.set)
+			attemptIn = make(chan In)
+
+			out, err := start(attemptCtx, attemptIn)
+			if err == nil {
+				attemptOut, attemptErr = out, reported
+				return nil
+			}
+			cancelAttempt()
+			if !run.backoff(ctx, stage, language, policy.Retry, &retries, attempt+1, err) {
+				return err
+			}
+		}
+	}
+	if err := launch(); err != nil {
+		return nil, err
+	}
+	var restart <-chan struct{}
+	if language == "" {
+		restart = run.restarts[stage]
+	}
+	queued := upstream
+	run.metrics.trackQueue(run.sessionID, stage, func() int { return len(queued) })
+
+	out := make(chan Out, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		defer func() { cancelAttempt() }()
+
+		var tick <-chan time.Time
+		if policy.Timeout > 0 {
+			ticker := time.NewTicker(watchInterval(policy.Timeout))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		var (
+			held      In
+			holding   bool
+			started   bool
+			inputDone bool
+			timeouts  int
+			// pendingSince is when the stage was handed input it has
+			// not yet answered with output; zero while it is idle.
+			pendingSince time.Time
+		)
+		// relaunch replaces the current attempt with a new one that
+		// continues from the remaining input.
+		relaunch := func() bool {
+			cancelAttempt()
+			if err := launch(); err != nil {
+				run.fail(stageFailure{stage: stage, language: language, code: stageFailureCodes[stage], err: err})
+				return false
+			}
+			pendingSince = time.Time{}
+			if inputDone {
+				close(attemptIn)
+				pendingSince = time.Now()
+			}
+			return true
+		}
+
+		for {
+			receive, send := upstream, chan<- In(nil)
+			if holding {
+				receive, send = nil, attemptIn
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case value, ok := <-receive:
+				if !ok {
+					upstream, inputDone = nil, true
+					close(attemptIn)
+					// The stage may still be flushing buffered work.
+					if pendingSince.IsZero() {
+						pendingSince = time.Now()
+					}
+					continue
+				}
+				held, holding = value, true
+			case send <- held:
+				var zero In
+				held, holding = zero, false
+				if !started {
+					started = true
+					run.notify(ctx, statuspkg.SessionStatusEvent{Stage: stage, State: "running", Detail: run.runningDetail(stage, language), Language: language})
+				}
+				if pendingSince.IsZero() {
+					pendingSince = time.Now()
+				}
+			case value, ok := <-attemptOut:
+				if !ok {
+					err := attemptErr.get()
+					if err == nil || ctx.Err() != nil {
+						return
+					}
+					if inputDone || !run.backoff(ctx, stage, language, policy.Retry, &retries, attempt+1, err) {
+						run.fail(stageFailure{stage: stage, language: language, code: stageFailureCodes[stage], err: err})
+						return
+					}
+					if !relaunch() {
+						return
+					}
+					continue
+				}
+				var latency time.Duration
+				if !pendingSince.IsZero() {
+					latency = time.Since(pendingSince)
+				}
+				run.metrics.observe(run.sessionID, stage, latency)
+				pendingSince = time.Time{}
+				retries = 0
+				observe(value)
+				select {
+				case out <- value:
+				case <-ctx.Done():
+					return
+				}
+			case <-restart:
+				if !relaunch() {
+					return
+				}
+			case now := <-tick:
+				if pendingSince.IsZero() || now.Sub(pendingSince) < policy.Timeout {
+					continue
+				}
+				cancelAttempt()
+
+				retry := timeouts < policy.Retries
+				event := statuspkg.SessionStatusEvent{
+					Stage:     stage,
+					State:     TimeoutState,
+					Code:      statuspkg.CodeStageTimeout,
+					Severity:  statuspkg.SeverityWarning,
+					Retryable: retry,
+					Attempt:   attempt,
+					Language:  language,
+				}
+				if retry {
+					event.Detail = fmt.Sprintf("no output for %s; restarting (retry %d of %d)", policy.Timeout, timeouts+1, policy.Retries)
+				} else {
+					event.Detail = fmt.Sprintf("no output for %s; giving up", policy.Timeout)
+				}
+				run.notify(ctx, event)
+				if !retry {
+					run.fail(stageFailure{
+						stage:    stage,
+						language: language,
+						code:     statuspkg.CodeStageTimeout,
+						err:      &statuspkg.StageError{Code: statuspkg.CodeStageTimeout, Err: fmt.Errorf("%s produced no output for %s", stage, policy.Timeout)},
+					})
+					return
+				}
+				timeouts++
+				if !relaunch() {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// backoff decides whether a failed stage attempt should be retried. When it
+// should, it emits a retrying event for the next attempt, waits out the
+// backoff, and returns true.
+func (run *streamRun) backoff(ctx context.Context, stage, language string, policy RetryPolicy, retries *int, nextAttempt int, err error) bool {
+	if *retries >= policy.Attempts || !statuspkg.IsTransient(err) {
+		return false
+	}
+	delay := policy.delay(*retries)
+	*retries++
+
+	event := statuspkg.SessionStatusEvent{
+		Stage:    stage,
+		State:    statuspkg.RetryingState,
+		Detail:   fmt.Sprintf("%v; retrying in %s", err, delay),
+		Language: language,
+	}.WithError(err, stageFailureCodes[stage])
+	event.Severity = statuspkg.SeverityWarning
+	event.Retryable = true
+	event.Attempt = nextAttempt
+	run.notify(ctx, event)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// watchInterval returns how often a stage with the given timeout is checked,
+// so a timeout is detected within a quarter of its length.
+func watchInterval(timeout time.Duration) time.Duration {
+	interval := timeout / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	return interval
+}
+
+func (run *streamRun) runningDetail(stage, language string) string {
+	if language == "" {
+		language = run.targetLanguage
+	}
+	switch stage {
+	case "ingestion":
+		return "Connecting to " + run.sourceType + " source"
+	case "normalization":
+		return "Normalizing audio"
+	case "asr":
+		return "Transcribing audio"
+	case "translation":
+		return "Translating to " + language
+	case "dubbing":
+		return "Synthesizing speech in " + language
+	default:
+		return "Generating subtitles"
+	}
+}
@@ -0,0 +1,376 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/ingestion"
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/output"
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// stallingRecognizer swallows its input without producing transcripts for
+// the first stalls attempts and behaves like the stub recognizer afterwards.
+type stallingRecognizer struct {
+	*asr.StubRecognizer
+	stalls int
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (r *stallingRecognizer) Recognize(ctx context.Context, sessionID string, chunks <-chan media.AudioChunk) (<-chan asr.Transcript, error) {
+	r.mu.Lock()
+	r.attempts++
+	stall := r.attempts <= r.stalls
+	r.mu.Unlock()
+	if !stall {
+		return r.StubRecognizer.Recognize(ctx, sessionID, chunks)
+	}
+
+	out := make(chan asr.Transcript)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-chunks:
+				if !ok {
+					<-ctx.Done()
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (r *stallingRecognizer) attemptCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempts
+}
+
+func runWithStallingRecognizer(t *testing.T, recognizer *stallingRecognizer, policy StagePolicy) ([]statuspkg.SessionStatusEvent, error) {
+	t.Helper()
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first"), []byte("second")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: recognizer,
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+		Policies:   map[string]StagePolicy{"asr": policy},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var events []statuspkg.SessionStatusEvent
+	err = runner.Run(ctx, streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+func TestStreamingRunnerFailsStageAfterTimeout(t *testing.T) {
+	t.Parallel()
+
+	recognizer := &stallingRecognizer{StubRecognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}), stalls: 1}
+	events, err := runWithStallingRecognizer(t, recognizer, StagePolicy{Timeout: 50 * time.Millisecond})
+
+	var stageErr *statuspkg.StageError
+	if !errors.As(err, &stageErr) || stageErr.Code != statuspkg.CodeStageTimeout {
+		t.Fatalf("expected stage timeout error, got %v", err)
+	}
+	if recognizer.attemptCount() != 1 {
+		t.Fatalf("expected no retries, got %d attempts", recognizer.attemptCount())
+	}
+
+	n := len(events)
+	if n < 2 {
+		t.Fatalf("expected timeout and failure events, got %+v", events)
+	}
+	timeout, failed := events[n-2], events[n-1]
+	if timeout.Stage != "asr" || timeout.State != TimeoutState || timeout.Code != statuspkg.CodeStageTimeout || timeout.Retryable {
+		t.Fatalf("unexpected timeout event: %+v", timeout)
+	}
+	if failed.Stage != "asr" || failed.State != "failed" || failed.Code != statuspkg.CodeStageTimeout {
+		t.Fatalf("unexpected failure event: %+v", failed)
+	}
+}
+
+func TestStreamingRunnerRetriesStageAfterTimeout(t *testing.T) {
+	t.Parallel()
+
+	recognizer := &stallingRecognizer{StubRecognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}), stalls: 1}
+	events, err := runWithStallingRecognizer(t, recognizer, StagePolicy{Timeout: 50 * time.Millisecond, Retries: 1})
+	if err != nil {
+		t.Fatalf("expected the retried stage to recover, got %v", err)
+	}
+	if recognizer.attemptCount() != 2 {
+		t.Fatalf("expected one retry, got %d attempts", recognizer.attemptCount())
+	}
+
+	var timeouts int
+	for _, event := range events {
+		if event.State == TimeoutState {
+			timeouts++
+			if event.Stage != "asr" || !event.Retryable || event.Severity != statuspkg.SeverityWarning {
+				t.Fatalf("unexpected timeout event: %+v", event)
+			}
+		}
+	}
+	if timeouts != 1 {
+		t.Fatalf("expected one timeout event, got %d in %+v", timeouts, events)
+	}
+	if last := events[len(events)-1]; last.Stage != "output" || last.State != "completed" {
+		t.Fatalf("expected the run to complete, got %+v", last)
+	}
+}
+
+// flakyTranslator fails its first failures attempts with err, either when
+// starting or, if midStream is set, after consuming one transcript.
+type flakyTranslator struct {
+	*translation.StubTranslator
+	failures  int
+	midStream bool
+	err       error
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (t *flakyTranslator) TranslateStream(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string) (<-chan translation.Translation, error) {
+	t.mu.Lock()
+	t.attempts++
+	fail := t.attempts <= t.failures
+	t.mu.Unlock()
+	if !fail {
+		return t.StubTranslator.TranslateStream(ctx, sessionID, transcripts, targetLang)
+	}
+	if !t.midStream {
+		return nil, t.err
+	}
+
+	out := make(chan translation.Translation)
+	go func() {
+		defer close(out)
+		select {
+		case <-transcripts:
+			statuspkg.ReportStageError(ctx, t.err)
+		case <-ctx.Done():
+		}
+	}()
+	return out, nil
+}
+
+func runWithFlakyTranslator(t *testing.T, translator *flakyTranslator, policy StagePolicy) ([]statuspkg.SessionStatusEvent, error) {
+	t.Helper()
+	translator.StubTranslator = translation.NewStubTranslator(&translation.StubTranslatorConfig{})
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return &stubSource{payloads: [][]byte{[]byte("first"), []byte("second"), []byte("third")}}, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translator,
+		Generator:  output.NewStubGenerator(),
+		Policies:   map[string]StagePolicy{"translation": policy},
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var events []statuspkg.SessionStatusEvent
+	err = runner.Run(ctx, streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+func TestStreamingRunnerRetriesTransientStageFailures(t *testing.T) {
+	t.Parallel()
+
+	unavailable := &statuspkg.StageError{Code: statuspkg.CodeTranslationFailed, Retryable: true, Err: errors.New("provider returned 503")}
+	for _, midStream := range []bool{false, true} {
+		translator := &flakyTranslator{failures: 2, midStream: midStream, err: unavailable}
+		events, err := runWithFlakyTranslator(t, translator, StagePolicy{Retry: RetryPolicy{Attempts: 2, Backoff: time.Millisecond}})
+		if err != nil {
+			t.Fatalf("midStream=%v: expected the retried stage to recover, got %v", midStream, err)
+		}
+		if translator.attempts != 3 {
+			t.Fatalf("midStream=%v: expected two retries, got %d attempts", midStream, translator.attempts)
+		}
+
+		var attempts []int
+		for _, event := range events {
+			if event.State != statuspkg.RetryingState {
+				continue
+			}
+			if event.Stage != "translation" || !event.Retryable || event.Code != statuspkg.CodeTranslationFailed || event.Severity != statuspkg.SeverityWarning {
+				t.Fatalf("midStream=%v: unexpected retrying event: %+v", midStream, event)
+			}
+			attempts = append(attempts, event.Attempt)
+		}
+		if len(attempts) != 2 || attempts[0] != 2 || attempts[1] != 3 {
+			t.Fatalf("midStream=%v: expected retries announcing attempts 2 and 3, got %v", midStream, attempts)
+		}
+		if last := events[len(events)-1]; last.Stage != "output" || last.State != "completed" {
+			t.Fatalf("midStream=%v: expected the run to complete, got %+v", midStream, last)
+		}
+	}
+}
+
+func TestStreamingRunnerFailsAfterRetryBudget(t *testing.T) {
+	t.Parallel()
+
+	unavailable := &statuspkg.StageError{Code: statuspkg.CodeTranslationFailed, Retryable: true, Err: errors.New("provider returned 503")}
+	translator := &flakyTranslator{failures: 3, err: unavailable}
+	events, err := runWithFlakyTranslator(t, translator, StagePolicy{Retry: RetryPolicy{Attempts: 2, Backoff: time.Millisecond}})
+	if !errors.Is(err, unavailable) {
+		t.Fatalf("expected the transient error once retries are exhausted, got %v", err)
+	}
+	if translator.attempts != 3 {
+		t.Fatalf("expected two retries, got %d attempts", translator.attempts)
+	}
+	if last := events[len(events)-1]; last.Stage != "translation" || last.State != "failed" {
+		t.Fatalf("expected a translation failure, got %+v", last)
+	}
+}
+
+func TestStreamingRunnerDoesNotRetryPermanentFailures(t *testing.T) {
+	t.Parallel()
+
+	translator := &flakyTranslator{failures: 1, midStream: true, err: errors.New("invalid credentials")}
+	events, err := runWithFlakyTranslator(t, translator, StagePolicy{Retry: RetryPolicy{Attempts: 3, Backoff: time.Millisecond}})
+	if err == nil {
+		t.Fatal("expected a permanent failure to fail the run")
+	}
+	if translator.attempts != 1 {
+		t.Fatalf("expected no retries, got %d attempts", translator.attempts)
+	}
+	for _, event := range events {
+		if event.State == statuspkg.RetryingState {
+			t.Fatalf("unexpected retrying event: %+v", event)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for retry, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if got := policy.delay(retry); got != want {
+			t.Fatalf("retry %d: expected %s, got %s", retry, want, got)
+		}
+	}
+	if got := (RetryPolicy{}).delay(0); got != DefaultRetryBackoff {
+		t.Fatalf("expected default backoff, got %s", got)
+	}
+}
+
+func TestStreamingRunnerReportsSourceFailover(t *testing.T) {
+	t.Parallel()
+
+	sources := map[string]*stubSource{
+		"https://a.example.com/live.m3u8": {payloads: [][]byte{[]byte("primary ")}, err: statuspkg.Fatal(errors.New("playlist returned 404 Not Found"))},
+		"https://b.example.com/live.m3u8": {payloads: [][]byte{[]byte("backup")}},
+	}
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(session sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return ingestion.NewFailoverSource(ingestion.FailoverConfig{
+				URIs: append([]string{session.Source.URI}, session.Source.BackupURIs...),
+				Open: func(uri string) (ingestion.StreamSource, error) { return sources[uri], nil },
+			})
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	session := streamingSession()
+	session.Source.URI = "https://a.example.com/live.m3u8"
+	session.Source.BackupURIs = []string{"https://b.example.com/live.m3u8"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var failovers []statuspkg.SessionStatusEvent
+	err = runner.Run(ctx, session, func(event statuspkg.SessionStatusEvent) error {
+		if event.State == statuspkg.FailoverState {
+			failovers = append(failovers, event)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(failovers) != 1 || failovers[0].Stage != "ingestion" || failovers[0].Code != statuspkg.CodeSourceFailover {
+		t.Fatalf("expected one failover event, got %+v", failovers)
+	}
+}
+
+func TestStreamingRunnerReportsVariantSwitches(t *testing.T) {
+	t.Parallel()
+
+	source := &stubSource{
+		payloads: [][]byte{[]byte("high "), []byte("low "), []byte("high")},
+		metadata: map[int]map[string]string{
+			1: {"variantSwitch": "down", "bandwidth": "64000"},
+			2: {"variantSwitch": "up", "bandwidth": "128000"},
+		},
+	}
+	runner, err := NewStreamingRunner(StreamingConfig{
+		Sources: func(sessionpkg.TranslationSession) (ingestion.StreamSource, error) {
+			return source, nil
+		},
+		Normalizer: &readingNormalizer{},
+		Recognizer: asr.NewStubRecognizer(&asr.StubRecognizerConfig{}),
+		Translator: translation.NewStubTranslator(&translation.StubTranslatorConfig{}),
+		Generator:  output.NewStubGenerator(),
+	})
+	if err != nil {
+		t.Fatalf("new streaming runner: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var switches []statuspkg.SessionStatusEvent
+	err = runner.Run(ctx, streamingSession(), func(event statuspkg.SessionStatusEvent) error {
+		if event.State == statuspkg.VariantSwitchState {
+			switches = append(switches, event)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(switches) != 2 || switches[0].Code != statuspkg.CodeSourceVariantSwitch {
+		t.Fatalf("expected two variant switch events, got %+v", switches)
+	}
+	if switches[0].Severity != statuspkg.SeverityWarning || switches[0].Detail != "switched down to the 64000 bps variant" {
+		t.Fatalf("unexpected step down event %+v", switches[0])
+	}
+	if switches[1].Severity != statuspkg.SeverityInfo {
+		t.Fatalf("unexpected step up event %+v", switches[1])
+	}
+}
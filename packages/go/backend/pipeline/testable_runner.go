@@ -64,8 +64,13 @@ func (r *TestableRunner) Run(ctx context.Context, session sessionpkg.Translation
 
 	chunks, err := r.normalizer.Normalize(ctx, source)
 	if err != nil {
-		return r.emitStatus(emit, session.ID, "normalization", "failed", err.Error())
+		return r.emitFailure(emit, session.ID, "normalization", err, statuspkg.CodeNormalizationFailed)
 	}
+	counters := CountersFromContext(ctx)
+	chunks = countThrough(ctx, chunks, func(chunk media.AudioChunk) {
+		counters.AddChunks(1)
+		counters.MarkChunk(chunk.Timestamp)
+	})
 
 	if err := r.emitStatus(emit, session.ID, "normalization", "completed", "Audio normalized"); err != nil {
 		return err
@@ -78,8 +83,13 @@ func (r *TestableRunner) Run(ctx context.Context, session sessionpkg.Translation
 
 	transcripts, err := r.recognizer.Recognize(ctx, session.ID, chunks)
 	if err != nil {
-		return r.emitStatus(emit, session.ID, "asr", "failed", err.Error())
+		return r.emitFailure(emit, session.ID, "asr", err, statuspkg.CodeASRFailed)
 	}
+	transcripts = countThrough(ctx, transcripts, func(transcript asr.Transcript) {
+		if !transcript.Partial {
+			counters.AddTranscripts(1)
+		}
+	})
 
 	if err := r.emitStatus(emit, session.ID, "asr", "completed", "Audio transcribed"); err != nil {
 		return err
@@ -92,7 +102,7 @@ func (r *TestableRunner) Run(ctx context.Context, session sessionpkg.Translation
 
 	translations, err := r.translator.TranslateStream(ctx, session.ID, transcripts, session.TargetLanguage)
 	if err != nil {
-		return r.emitStatus(emit, session.ID, "translation", "failed", err.Error())
+		return r.emitFailure(emit, session.ID, "translation", err, statuspkg.CodeTranslationFailed)
 	}
 
 	if err := r.emitStatus(emit, session.ID, "translation", "completed", "Translation complete"); err != nil {
@@ -107,13 +117,17 @@ func (r *TestableRunner) Run(ctx context.Context, session sessionpkg.Translation
 	// Stream subtitle events
 	events, err := r.generator.StreamSubtitles(ctx, session.ID, translations)
 	if err != nil {
-		return r.emitStatus(emit, session.ID, "output", "failed", err.Error())
+		return r.emitFailure(emit, session.ID, "output", err, statuspkg.CodeOutputFailed)
 	}
 
 	// Consume all subtitle events
 	subtitleCount := 0
-	for range events {
-		subtitleCount++
+	for event := range events {
+		if event.Type == "add" {
+			subtitleCount++
+			counters.AddSubtitles(1)
+		}
+		counters.ObserveOutput(event.EndTime)
 	}
 
 	if err := r.emitStatus(emit, session.ID, "output", "completed",
@@ -135,6 +149,35 @@ func (r *TestableRunner) emitStatus(emit func(statuspkg.SessionStatusEvent) erro
 	})
 }
 
+// emitFailure reports a failed stage with a structured error code.
+func (r *TestableRunner) emitFailure(emit func(statuspkg.SessionStatusEvent) error, sessionID, stage string, err error, code statuspkg.ErrorCode) error {
+	event := statuspkg.SessionStatusEvent{
+		SessionID: sessionID,
+		Stage:     stage,
+		State:     "failed",
+		Timestamp: time.Now().UTC(),
+	}
+	return emit(event.WithError(err, code))
+}
+
+// countThrough forwards values from in, calling observe for each one. It
+// lets the runner count items flowing between stages without buffering them.
+func countThrough[T any](ctx context.Context, in <-chan T, observe func(T)) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for value := range in {
+			observe(value)
+			select {
+			case out <- value:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
 // itoa converts an int to a string without importing strconv.
 func itoa(n int) string {
 	if n == 0 {
@@ -174,8 +217,13 @@ func (r *TestableRunner) RunWithReader(ctx context.Context, session sessionpkg.T
 
 	chunks, err := r.normalizer.Normalize(ctx, source)
 	if err != nil {
-		return r.emitStatus(emit, session.ID, "normalization", "failed", err.Error())
+		return r.emitFailure(emit, session.ID, "normalization", err, statuspkg.CodeNormalizationFailed)
 	}
+	counters := CountersFromContext(ctx)
+	chunks = countThrough(ctx, chunks, func(chunk media.AudioChunk) {
+		counters.AddChunks(1)
+		counters.MarkChunk(chunk.Timestamp)
+	})
 
 	if err := r.emitStatus(emit, session.ID, "normalization", "completed", "Audio normalized"); err != nil {
 		return err
@@ -188,8 +236,13 @@ func (r *TestableRunner) RunWithReader(ctx context.Context, session sessionpkg.T
 
 	transcripts, err := r.recognizer.Recognize(ctx, session.ID, chunks)
 	if err != nil {
-		return r.emitStatus(emit, session.ID, "asr", "failed", err.Error())
+		return r.emitFailure(emit, session.ID, "asr", err, statuspkg.CodeASRFailed)
 	}
+	transcripts = countThrough(ctx, transcripts, func(transcript asr.Transcript) {
+		if !transcript.Partial {
+			counters.AddTranscripts(1)
+		}
+	})
 
 	if err := r.emitStatus(emit, session.ID, "asr", "completed", "Audio transcribed"); err != nil {
 		return err
@@ -202,7 +255,7 @@ func (r *TestableRunner) RunWithReader(ctx context.Context, session sessionpkg.T
 
 	translations, err := r.translator.TranslateStream(ctx, session.ID, transcripts, session.TargetLanguage)
 	if err != nil {
-		return r.emitStatus(emit, session.ID, "translation", "failed", err.Error())
+		return r.emitFailure(emit, session.ID, "translation", err, statuspkg.CodeTranslationFailed)
 	}
 
 	if err := r.emitStatus(emit, session.ID, "translation", "completed", "Translation complete"); err != nil {
@@ -216,12 +269,16 @@ func (r *TestableRunner) RunWithReader(ctx context.Context, session sessionpkg.T
 
 	events, err := r.generator.StreamSubtitles(ctx, session.ID, translations)
 	if err != nil {
-		return r.emitStatus(emit, session.ID, "output", "failed", err.Error())
+		return r.emitFailure(emit, session.ID, "output", err, statuspkg.CodeOutputFailed)
 	}
 
 	subtitleCount := 0
-	for range events {
-		subtitleCount++
+	for event := range events {
+		if event.Type == "add" {
+			subtitleCount++
+			counters.AddSubtitles(1)
+		}
+		counters.ObserveOutput(event.EndTime)
 	}
 
 	if err := r.emitStatus(emit, session.ID, "output", "completed",
@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"io"
+
+	"streamlation/packages/backend/metrics"
+	"streamlation/packages/backend/translation"
+)
+
+// TranslationMetrics counts the final translations of every running
+// session by language and by the variant that produced them, and sums
+// their estimated quality, so that the share of translations a fallback
+// rescued and the average quality can be followed. A session's series are
+// removed when its run ends. A nil *TranslationMetrics records nothing.
+type TranslationMetrics struct {
+	translations *metrics.Counter
+	quality      *metrics.Summary
+}
+
+// NewTranslationMetrics returns an empty set of translation metrics.
+func NewTranslationMetrics() *TranslationMetrics {
+	return &TranslationMetrics{
+		translations: metrics.NewCounter("streamlation_translation_translations_total", "Final translations by language and the variant that produced them.", "session", "language", "variant"),
+		quality:      metrics.NewSummary("streamlation_translation_quality", "Estimated quality of final translations, from 0 to 1.", "session", "language", "variant"),
+	}
+}
+
+// observe counts a final translation of sessionID. Translations without a
+// variant count as the primary one.
+func (m *TranslationMetrics) observe(sessionID string, translated translation.Translation) {
+	if m == nil {
+		return
+	}
+	variant := translated.Variant
+	if variant == "" {
+		variant = translation.PrimaryVariant
+	}
+	m.translations.Inc(sessionID, translated.TargetLang, variant)
+	if translated.Quality > 0 {
+		m.quality.Observe(translated.Quality, sessionID, translated.TargetLang, variant)
+	}
+}
+
+// forget removes the series of a session whose run has ended.
+func (m *TranslationMetrics) forget(sessionID string) {
+	if m == nil {
+		return
+	}
+	m.translations.DeletePrefix(sessionID)
+	m.quality.DeletePrefix(sessionID)
+}
+
+// WriteMetrics writes the translation metrics in the Prometheus text
+// exposition format.
+func (m *TranslationMetrics) WriteMetrics(w io.Writer) error {
+	if err := m.translations.WriteMetrics(w); err != nil {
+		return err
+	}
+	return m.quality.WriteMetrics(w)
+}
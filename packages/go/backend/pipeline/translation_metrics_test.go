@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"streamlation/packages/backend/translation"
+)
+
+func TestTranslationMetricsWritesPrometheusText(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewTranslationMetrics()
+	metrics.observe("s-1", translation.Translation{TargetLang: "es", Variant: translation.PrimaryVariant, Quality: 0.75})
+	metrics.observe("s-1", translation.Translation{TargetLang: "es", Variant: translation.PrimaryVariant, Quality: 0.25})
+	metrics.observe("s-1", translation.Translation{TargetLang: "es", Variant: translation.FallbackVariant, Quality: 0.5})
+	metrics.observe("s-2", translation.Translation{TargetLang: "fr"})
+
+	var b strings.Builder
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	text := b.String()
+	for _, want := range []string{
+		"# TYPE streamlation_translation_translations_total counter\n",
+		`streamlation_translation_translations_total{session="s-1",language="es",variant="primary"} 2`,
+		`streamlation_translation_translations_total{session="s-1",language="es",variant="fallback"} 1`,
+		`streamlation_translation_translations_total{session="s-2",language="fr",variant="primary"} 1`,
+		"# TYPE streamlation_translation_quality summary\n",
+		`streamlation_translation_quality_sum{session="s-1",language="es",variant="primary"} 1`,
+		`streamlation_translation_quality_count{session="s-1",language="es",variant="primary"} 2`,
+		`streamlation_translation_quality_count{session="s-1",language="es",variant="fallback"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in metrics:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, `streamlation_translation_quality_count{session="s-2"`) {
+		t.Fatalf("expected no quality for unscored translations:\n%s", text)
+	}
+
+	metrics.forget("s-1")
+	b.Reset()
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	if strings.Contains(b.String(), "s-1") {
+		t.Fatalf("expected forgotten session to be removed:\n%s", b.String())
+	}
+}
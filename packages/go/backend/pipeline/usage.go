@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// UsageRunner wraps a Runner and totals what each run sends to external
+// providers, which stages record with statuspkg.RecordUsage. Once a run
+// ends, whatever its outcome, the totals are emitted in a
+// pipeline/usage event. Runs that used no provider emit none.
+type UsageRunner struct {
+	next Runner
+}
+
+// NewUsageRunner wraps next so that its provider usage is reported.
+func NewUsageRunner(next Runner) *UsageRunner {
+	return &UsageRunner{next: next}
+}
+
+// Run executes the wrapped runner and reports its usage.
+func (r *UsageRunner) Run(ctx context.Context, session sessionpkg.TranslationSession, emit func(statuspkg.SessionStatusEvent) error) error {
+	meter := statuspkg.UsageMeterFromContext(ctx)
+	if meter == nil {
+		meter = statuspkg.NewUsageMeter()
+		ctx = statuspkg.WithUsageMeter(ctx, meter)
+	}
+	err := r.next.Run(ctx, session, emit)
+	if usage := meter.Snapshot(); usage != nil && emit != nil {
+		_ = emit(statuspkg.SessionStatusEvent{
+			SessionID: session.ID,
+			Stage:     "pipeline",
+			State:     statuspkg.UsageState,
+			Timestamp: time.Now().UTC(),
+			Usage:     usage,
+		})
+	}
+	return err
+}
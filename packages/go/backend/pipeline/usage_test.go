@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sessionpkg "streamlation/packages/backend/session"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// usingRunner records usage and fails with err.
+type usingRunner struct {
+	usage []statuspkg.ProviderUsage
+	err   error
+}
+
+func (r usingRunner) Run(ctx context.Context, _ sessionpkg.TranslationSession, _ func(statuspkg.SessionStatusEvent) error) error {
+	for _, usage := range r.usage {
+		statuspkg.RecordUsage(ctx, usage)
+	}
+	return r.err
+}
+
+func TestUsageRunnerReportsUsageWhenTheRunEnds(t *testing.T) {
+	t.Parallel()
+
+	wantErr := errors.New("translation stage: quota exhausted")
+	runner := NewUsageRunner(usingRunner{
+		usage: []statuspkg.ProviderUsage{
+			{Stage: "translation", Provider: "deepl", Requests: 1, Characters: 12},
+			{Stage: "translation", Provider: "deepl", Requests: 1, Characters: 30},
+		},
+		err: wantErr,
+	})
+	var events []statuspkg.SessionStatusEvent
+	err := runner.Run(context.Background(), sessionpkg.TranslationSession{ID: "costly"}, func(event statuspkg.SessionStatusEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one usage event, got %#v", events)
+	}
+	event := events[0]
+	if event.SessionID != "costly" || event.Stage != "pipeline" || event.State != statuspkg.UsageState {
+		t.Fatalf("unexpected usage event %#v", event)
+	}
+	if len(event.Usage) != 1 || event.Usage[0].Requests != 2 || event.Usage[0].Characters != 42 {
+		t.Fatalf("unexpected usage %+v", event.Usage)
+	}
+
+	events = nil
+	if err := NewUsageRunner(usingRunner{}).Run(context.Background(), sessionpkg.TranslationSession{ID: "free"}, func(event statuspkg.SessionStatusEvent) error {
+		events = append(events, event)
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no usage event without usage, got %#v", events)
+	}
+}
@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"context"
+
+	"streamlation/packages/backend/media"
+)
+
+// frameWindows re-frames the audio from in into the fixed, overlapping
+// windows cfg describes before recognition. The window being filled when in
+// closes is padded and emitted before the returned channel closes. A nil
+// cfg leaves the audio as it is.
+func frameWindows(ctx context.Context, run *streamRun, cfg *media.WindowConfig, in <-chan media.AudioChunk) <-chan media.AudioChunk {
+	if cfg == nil {
+		return in
+	}
+	windower := media.NewWindower(*cfg)
+
+	out := make(chan media.AudioChunk, run.bufferSize)
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		defer close(out)
+		send := func(windows []media.AudioChunk) bool {
+			for _, window := range windows {
+				select {
+				case out <- window:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk, ok := <-in:
+				if !ok {
+					send(windower.Flush())
+					return
+				}
+				if !send(windower.Push(chunk)) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+func TestFrameWindowsOverlapsAndFlushes(t *testing.T) {
+	t.Parallel()
+
+	// 600ms of 1kHz mono audio in 100ms chunks.
+	in := make(chan media.AudioChunk, 6)
+	for i := 0; i < 6; i++ {
+		in <- media.AudioChunk{Timestamp: time.Duration(i) * 100 * time.Millisecond, SampleRate: 1000, Channels: 1, PCMData: make([]byte, 200), Duration: 100 * time.Millisecond}
+	}
+	close(in)
+
+	run := &streamRun{bufferSize: DefaultStageBuffer}
+	var windows []media.AudioChunk
+	for window := range frameWindows(context.Background(), run, &media.WindowConfig{Size: 300 * time.Millisecond, Overlap: 100 * time.Millisecond}, in) {
+		windows = append(windows, window)
+	}
+	run.wg.Wait()
+
+	// Windows start every 200ms; the last holds the final 200ms and
+	// 100ms of padding.
+	want := []time.Duration{0, 200 * time.Millisecond, 400 * time.Millisecond}
+	if len(windows) != len(want) {
+		t.Fatalf("expected %d windows, got %d", len(want), len(windows))
+	}
+	for i, window := range windows {
+		if window.Timestamp != want[i] || window.Duration != 300*time.Millisecond || window.Window == nil || window.Window.Index != int64(i) {
+			t.Fatalf("window %d: unexpected window %v+%v %+v", i, window.Timestamp, window.Duration, window.Window)
+		}
+	}
+	if padding := windows[2].Window.Padding; padding != 100*time.Millisecond {
+		t.Fatalf("expected 100ms of padding, got %v", padding)
+	}
+}
+
+func TestFrameWindowsDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	in := make(chan media.AudioChunk)
+	if out := frameWindows(context.Background(), &streamRun{}, nil, in); out != (<-chan media.AudioChunk)(in) {
+		t.Fatal("expected the audio channel to be used as is")
+	}
+}
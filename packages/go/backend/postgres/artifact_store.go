@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+
+	"streamlation/packages/backend/output"
+)
+
+const (
+	upsertArtifactSQL = `INSERT INTO session_artifacts (
+        session_id,
+        key,
+        kind,
+        language,
+        format,
+        content_type,
+        size_bytes,
+        sha256,
+        created_at
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT (key) DO UPDATE SET
+        session_id = EXCLUDED.session_id,
+        kind = EXCLUDED.kind,
+        language = EXCLUDED.language,
+        format = EXCLUDED.format,
+        content_type = EXCLUDED.content_type,
+        size_bytes = EXCLUDED.size_bytes,
+        sha256 = EXCLUDED.sha256,
+        created_at = EXCLUDED.created_at`
+	listArtifactsSQL = `SELECT session_id, key, kind, language, format, content_type, size_bytes, sha256, created_at FROM session_artifacts WHERE session_id = $1 ORDER BY key ASC`
+)
+
+func NewArtifactRegistry(client executor) *ArtifactRegistry {
+	return &ArtifactRegistry{client: client}
+}
+
+// ArtifactRegistry records the artifacts persisted for each session in the
+// session_artifacts table.
+type ArtifactRegistry struct {
+	client executor
+}
+
+// Record stores artifact, replacing the artifact recorded under its key.
+func (s *ArtifactRegistry) Record(ctx context.Context, artifact output.Artifact) error {
+	return s.client.Exec(ctx, upsertArtifactSQL,
+		artifact.SessionID,
+		artifact.Key,
+		string(artifact.Kind),
+		artifact.Language,
+		artifact.Format,
+		artifact.ContentType,
+		artifact.Size,
+		artifact.SHA256,
+		artifact.CreatedAt,
+	)
+}
+
+// Artifacts returns the artifacts recorded for sessionID, ordered by key.
+func (s *ArtifactRegistry) Artifacts(ctx context.Context, sessionID string) ([]output.Artifact, error) {
+	rs, err := s.client.Query(ctx, listArtifactsSQL, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	artifacts := make([]output.Artifact, 0)
+	for rs.Next() {
+		var artifact output.Artifact
+		var kind string
+		if err := rs.Scan(&artifact.SessionID, &artifact.Key, &kind, &artifact.Language, &artifact.Format, &artifact.ContentType, &artifact.Size, &artifact.SHA256, &artifact.CreatedAt); err != nil {
+			return nil, err
+		}
+		artifact.Kind = output.ArtifactKind(kind)
+		artifacts = append(artifacts, artifact)
+	}
+
+	if err := rs.Err(); err != nil {
+		return nil, err
+	}
+
+	return artifacts, nil
+}
+
+func EnsureArtifactSchema(ctx context.Context, client executor) error {
+	const ddl = `CREATE TABLE IF NOT EXISTS session_artifacts (
+key TEXT PRIMARY KEY,
+session_id TEXT NOT NULL,
+kind TEXT NOT NULL,
+language TEXT NOT NULL DEFAULT '',
+format TEXT NOT NULL,
+content_type TEXT NOT NULL,
+size_bytes BIGINT NOT NULL,
+sha256 TEXT NOT NULL,
+created_at TIMESTAMPTZ NOT NULL
+)`
+	if err := client.Exec(ctx, ddl); err != nil {
+		return err
+	}
+	return client.Exec(ctx, `CREATE INDEX IF NOT EXISTS session_artifacts_session_idx ON session_artifacts (session_id)`)
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/output"
+)
+
+func TestArtifactRegistry_Record(t *testing.T) {
+	var executedQuery string
+	var executedArgs []any
+	client := &stubExecutor{execFunc: func(_ context.Context, query string, args ...any) error {
+		executedQuery = query
+		executedArgs = append([]any(nil), args...)
+		return nil
+	}}
+
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	artifact := output.Artifact{
+		SessionID:   "abc",
+		Key:         "abc/subtitles/es.srt",
+		Kind:        output.ArtifactSubtitles,
+		Language:    "es",
+		Format:      "srt",
+		ContentType: "application/x-subrip",
+		Size:        42,
+		SHA256:      "deadbeef",
+		CreatedAt:   ts,
+	}
+	if err := NewArtifactRegistry(client).Record(context.Background(), artifact); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(executedQuery, "INSERT INTO session_artifacts") || !strings.Contains(executedQuery, "ON CONFLICT (key) DO UPDATE") {
+		t.Fatalf("unexpected upsert query: %s", executedQuery)
+	}
+	if len(executedArgs) != 9 || executedArgs[1] != "abc/subtitles/es.srt" || executedArgs[2] != "subtitles" || executedArgs[6] != int64(42) || executedArgs[8] != ts {
+		t.Fatalf("unexpected args: %v", executedArgs)
+	}
+}
+
+func TestArtifactRegistry_Artifacts(t *testing.T) {
+	var executedArgs []any
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	client := &stubExecutor{
+		queryFunc: func(_ context.Context, _ string, args ...any) (rows, error) {
+			executedArgs = append([]any(nil), args...)
+			return &stubRows{scanFuncs: []func(...any) error{
+				func(dest ...any) error {
+					*(dest[0].(*string)) = "abc"
+					*(dest[1].(*string)) = "abc/subtitles/es.vtt"
+					*(dest[2].(*string)) = "subtitles"
+					*(dest[3].(*string)) = "es"
+					*(dest[4].(*string)) = "vtt"
+					*(dest[5].(*string)) = "text/vtt; charset=utf-8"
+					*(dest[6].(*int64)) = 7
+					*(dest[7].(*string)) = "deadbeef"
+					*(dest[8].(*time.Time)) = ts
+					return nil
+				},
+			}}, nil
+		},
+	}
+
+	artifacts, err := NewArtifactRegistry(client).Artifacts(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(artifacts) != 1 || artifacts[0].Kind != output.ArtifactSubtitles || artifacts[0].Size != 7 || !artifacts[0].CreatedAt.Equal(ts) {
+		t.Fatalf("unexpected artifacts: %#v", artifacts)
+	}
+	if len(executedArgs) != 1 || executedArgs[0] != "abc" {
+		t.Fatalf("unexpected args: %v", executedArgs)
+	}
+}
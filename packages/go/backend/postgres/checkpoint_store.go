@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	pipelinepkg "streamlation/packages/backend/pipeline"
+)
+
+const (
+	upsertCheckpointSQL = `INSERT INTO session_checkpoints (session_id, position, updated_at) VALUES ($1, $2, $3)
+ON CONFLICT (session_id) DO UPDATE SET position = EXCLUDED.position, updated_at = EXCLUDED.updated_at`
+	getCheckpointSQL    = `SELECT position FROM session_checkpoints WHERE session_id = $1`
+	deleteCheckpointSQL = `DELETE FROM session_checkpoints WHERE session_id = $1`
+)
+
+func NewCheckpointStore(client executor) *CheckpointStore {
+	return &CheckpointStore{client: client}
+}
+
+// CheckpointStore persists pipeline checkpoints, one per session.
+type CheckpointStore struct {
+	client executor
+}
+
+func (s *CheckpointStore) Save(ctx context.Context, checkpoint pipelinepkg.Checkpoint) error {
+	if checkpoint.SessionID == "" {
+		return errors.New("session id required")
+	}
+	updatedAt := checkpoint.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now().UTC()
+	}
+	position, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+	return s.client.Exec(ctx, upsertCheckpointSQL, checkpoint.SessionID, string(position), updatedAt)
+}
+
+func (s *CheckpointStore) Load(ctx context.Context, sessionID string) (pipelinepkg.Checkpoint, bool, error) {
+	var position string
+	if err := s.client.QueryRow(ctx, getCheckpointSQL, sessionID).Scan(&position); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return pipelinepkg.Checkpoint{}, false, nil
+		}
+		return pipelinepkg.Checkpoint{}, false, err
+	}
+	var checkpoint pipelinepkg.Checkpoint
+	if err := json.Unmarshal([]byte(position), &checkpoint); err != nil {
+		return pipelinepkg.Checkpoint{}, false, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	return checkpoint, true, nil
+}
+
+func (s *CheckpointStore) Delete(ctx context.Context, sessionID string) error {
+	return s.client.Exec(ctx, deleteCheckpointSQL, sessionID)
+}
+
+func EnsureCheckpointSchema(ctx context.Context, client executor) error {
+	const ddl = `CREATE TABLE IF NOT EXISTS session_checkpoints (
+session_id TEXT PRIMARY KEY,
+position TEXT NOT NULL,
+updated_at TIMESTAMPTZ NOT NULL
+)`
+	return client.Exec(ctx, ddl)
+}
@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	pipelinepkg "streamlation/packages/backend/pipeline"
+)
+
+func TestCheckpointStore_SaveAndLoad(t *testing.T) {
+	var executedQuery string
+	var stored string
+	client := &stubExecutor{
+		execFunc: func(_ context.Context, query string, args ...any) error {
+			executedQuery = query
+			if len(args) != 3 || args[0] != "abc" {
+				t.Fatalf("unexpected args: %v", args)
+			}
+			stored = args[1].(string)
+			return nil
+		},
+		queryRowFunc: func(_ context.Context, query string, args ...any) row {
+			if !strings.Contains(query, "FROM session_checkpoints") || len(args) != 1 || args[0] != "abc" {
+				t.Fatalf("unexpected query %s with %v", query, args)
+			}
+			return stubRow{scanFunc: func(dest ...any) error {
+				*(dest[0].(*string)) = stored
+				return nil
+			}}
+		},
+	}
+
+	store := NewCheckpointStore(client)
+	checkpoint := pipelinepkg.Checkpoint{SessionID: "abc", MediaTime: 2 * time.Second, TranslationCursor: time.Second, SubtitleIndex: map[string]int{"es": 7}}
+	if err := store.Save(context.Background(), checkpoint); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if !strings.Contains(executedQuery, "ON CONFLICT (session_id) DO UPDATE") {
+		t.Fatalf("expected an upsert, got %s", executedQuery)
+	}
+
+	loaded, ok, err := store.Load(context.Background(), "abc")
+	if err != nil || !ok {
+		t.Fatalf("load: ok=%v err=%v", ok, err)
+	}
+	if loaded.MediaTime != checkpoint.MediaTime || loaded.TranslationCursor != checkpoint.TranslationCursor || loaded.SubtitleIndex["es"] != 7 {
+		t.Fatalf("expected %+v, got %+v", checkpoint, loaded)
+	}
+}
+
+func TestCheckpointStore_LoadMissing(t *testing.T) {
+	client := &stubExecutor{
+		queryRowFunc: func(context.Context, string, ...any) row {
+			return stubRow{scanFunc: func(...any) error { return sql.ErrNoRows }}
+		},
+	}
+	_, ok, err := NewCheckpointStore(client).Load(context.Background(), "missing")
+	if err != nil || ok {
+		t.Fatalf("expected no checkpoint, got ok=%v err=%v", ok, err)
+	}
+}
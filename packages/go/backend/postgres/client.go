@@ -487,6 +487,8 @@ func encodeParam(arg any) (string, error) {
 		return strconv.FormatInt(int64(v), 10), nil
 	case int64:
 		return strconv.FormatInt(v, 10), nil
+	case time.Time:
+		return "'" + v.UTC().Format(time.RFC3339Nano) + "'", nil
 	default:
 		return "", fmt.Errorf("unsupported parameter type %T", arg)
 	}
@@ -515,6 +517,18 @@ func assignValues(values []string, dest ...any) error {
 				return fmt.Errorf("invalid integer value: %w", err)
 			}
 			*ptr = n
+		case *int64:
+			n, err := strconv.ParseInt(values[i], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid integer value: %w", err)
+			}
+			*ptr = n
+		case *time.Time:
+			t, err := parseTimestamp(values[i])
+			if err != nil {
+				return err
+			}
+			*ptr = t
 		default:
 			return fmt.Errorf("unsupported scan destination %T", d)
 		}
@@ -523,6 +537,24 @@ func assignValues(values []string, dest ...any) error {
 	return nil
 }
 
+// timestampLayouts covers the text encodings Postgres uses for timestamptz
+// values with the default DateStyle, with and without fractional seconds.
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339Nano,
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp value %q", value)
+}
+
 func parseBoolLiteral(value string) bool {
 	switch strings.ToLower(strings.TrimSpace(value)) {
 	case "t", "true", "1", "y", "yes":
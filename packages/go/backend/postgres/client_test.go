@@ -3,6 +3,7 @@ package postgres
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestPrepareQuery(t *testing.T) {
@@ -55,3 +56,41 @@ func TestPrepareQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestAssignValuesTimestamps(t *testing.T) {
+	tests := map[string]string{
+		"utc offset":      "2025-03-04 05:06:07.123456+00",
+		"minute offset":   "2025-03-04 10:36:07.123456+05:30",
+		"rfc3339 literal": "2025-03-04T05:06:07.123456Z",
+	}
+	want := time.Date(2025, 3, 4, 5, 6, 7, 123456000, time.UTC)
+
+	for name, value := range tests {
+		value := value
+		t.Run(name, func(t *testing.T) {
+			var got time.Time
+			if err := assignValues([]string{value}, &got); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+
+	var bad time.Time
+	if err := assignValues([]string{"yesterday"}, &bad); err == nil {
+		t.Fatal("expected error for malformed timestamp")
+	}
+}
+
+func TestEncodeParamTime(t *testing.T) {
+	ts := time.Date(2025, 3, 4, 5, 6, 7, 0, time.FixedZone("CET", 3600))
+	got, err := encodeParam(ts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "'2025-03-04T04:06:07Z'" {
+		t.Fatalf("unexpected encoding %s", got)
+	}
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"streamlation/packages/backend/output"
+)
+
+const (
+	upsertCueEditSQL = `INSERT INTO session_cue_edits (session_id, cue_id, edit, edited_at) VALUES ($1, $2, $3, $4)
+ON CONFLICT (session_id, cue_id) DO UPDATE SET edit = EXCLUDED.edit, edited_at = EXCLUDED.edited_at`
+	listCueEditsSQL = `SELECT edit FROM session_cue_edits WHERE session_id = $1 ORDER BY cue_id ASC`
+)
+
+func NewCueEditStore(client executor) *CueEditStore {
+	return &CueEditStore{client: client}
+}
+
+// CueEditStore keeps the edits of the cues of each session in the
+// session_cue_edits table, one per cue.
+type CueEditStore struct {
+	client executor
+}
+
+// SaveCueEdit stores edit, replacing the edit of the same cue.
+func (s *CueEditStore) SaveCueEdit(ctx context.Context, sessionID string, edit output.CueEdit) error {
+	if sessionID == "" || edit.CueID == "" {
+		return errors.New("session and cue id required")
+	}
+	if edit.EditedAt.IsZero() {
+		edit.EditedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(edit)
+	if err != nil {
+		return fmt.Errorf("encode cue edit: %w", err)
+	}
+	return s.client.Exec(ctx, upsertCueEditSQL, sessionID, edit.CueID, string(data), edit.EditedAt)
+}
+
+// CueEdits returns the edits of the cues of sessionID, ordered by cue id.
+func (s *CueEditStore) CueEdits(ctx context.Context, sessionID string) ([]output.CueEdit, error) {
+	rs, err := s.client.Query(ctx, listCueEditsSQL, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	edits := make([]output.CueEdit, 0)
+	for rs.Next() {
+		var data string
+		if err := rs.Scan(&data); err != nil {
+			return nil, err
+		}
+		var edit output.CueEdit
+		if err := json.Unmarshal([]byte(data), &edit); err != nil {
+			return nil, fmt.Errorf("decode cue edit: %w", err)
+		}
+		edits = append(edits, edit)
+	}
+
+	if err := rs.Err(); err != nil {
+		return nil, err
+	}
+
+	return edits, nil
+}
+
+func EnsureCueEditSchema(ctx context.Context, client executor) error {
+	const ddl = `CREATE TABLE IF NOT EXISTS session_cue_edits (
+session_id TEXT NOT NULL,
+cue_id TEXT NOT NULL,
+edit TEXT NOT NULL,
+edited_at TIMESTAMPTZ NOT NULL,
+PRIMARY KEY (session_id, cue_id)
+)`
+	return client.Exec(ctx, ddl)
+}
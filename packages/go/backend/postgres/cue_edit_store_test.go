@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/output"
+)
+
+func TestCueEditStore_SaveAndList(t *testing.T) {
+	var executedQuery string
+	var stored string
+	client := &stubExecutor{
+		execFunc: func(_ context.Context, query string, args ...any) error {
+			executedQuery = query
+			if len(args) != 4 || args[0] != "abc" || args[1] != "es-3" {
+				t.Fatalf("unexpected args: %v", args)
+			}
+			stored = args[2].(string)
+			return nil
+		},
+		queryFunc: func(_ context.Context, query string, args ...any) (rows, error) {
+			if !strings.Contains(query, "FROM session_cue_edits") || len(args) != 1 || args[0] != "abc" {
+				t.Fatalf("unexpected query %s with %v", query, args)
+			}
+			return &stubRows{scanFuncs: []func(...any) error{
+				func(dest ...any) error {
+					*(dest[0].(*string)) = stored
+					return nil
+				},
+			}}, nil
+		},
+	}
+
+	store := NewCueEditStore(client)
+	text, start := "Hola.", 2*time.Second
+	if err := store.SaveCueEdit(context.Background(), "abc", output.CueEdit{CueID: "es-3", Text: &text, StartTime: &start}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if !strings.Contains(executedQuery, "ON CONFLICT (session_id, cue_id) DO UPDATE") {
+		t.Fatalf("expected an upsert, got %s", executedQuery)
+	}
+
+	edits, err := store.CueEdits(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(edits) != 1 || edits[0].CueID != "es-3" || *edits[0].Text != text || *edits[0].StartTime != start || edits[0].EndTime != nil || edits[0].EditedAt.IsZero() {
+		t.Fatalf("unexpected edits: %+v", edits)
+	}
+
+	if err := store.SaveCueEdit(context.Background(), "abc", output.CueEdit{}); err == nil {
+		t.Fatal("expected an edit without a cue id to be rejected")
+	}
+}
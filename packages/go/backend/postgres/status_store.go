@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+const (
+	insertStatusEventSQL = `INSERT INTO session_status_events (
+        session_id,
+        stage,
+        state,
+        detail,
+        occurred_at,
+        code,
+        severity,
+        retryable
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	listStatusEventsSQL = `SELECT id, session_id, stage, state, detail, occurred_at, code, severity, retryable FROM session_status_events WHERE session_id = $1 AND id > $2 ORDER BY id ASC LIMIT $3`
+)
+
+func NewStatusEventStore(client executor) *StatusEventStore {
+	return &StatusEventStore{client: client}
+}
+
+// StatusEventStore persists the status timeline of each session.
+type StatusEventStore struct {
+	client executor
+}
+
+// Append stores a status event. Events without a timestamp are stamped with
+// the current time.
+func (s *StatusEventStore) Append(ctx context.Context, event statuspkg.SessionStatusEvent) error {
+	occurredAt := event.Timestamp
+	if occurredAt.IsZero() {
+		occurredAt = time.Now().UTC()
+	}
+	return s.client.Exec(ctx, insertStatusEventSQL,
+		event.SessionID,
+		event.Stage,
+		event.State,
+		event.Detail,
+		occurredAt,
+		string(event.Code),
+		string(event.Severity),
+		event.Retryable,
+	)
+}
+
+// History returns up to limit events for sessionID with an ID greater than
+// after, oldest first.
+func (s *StatusEventStore) History(ctx context.Context, sessionID string, after int64, limit int) ([]statuspkg.HistoryEntry, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rs, err := s.client.Query(ctx, listStatusEventsSQL, sessionID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	entries := make([]statuspkg.HistoryEntry, 0)
+	for rs.Next() {
+		var entry statuspkg.HistoryEntry
+		var code, severity string
+		if err := rs.Scan(&entry.ID, &entry.SessionID, &entry.Stage, &entry.State, &entry.Detail, &entry.Timestamp, &code, &severity, &entry.Retryable); err != nil {
+			return nil, err
+		}
+		entry.Code = statuspkg.ErrorCode(code)
+		entry.Severity = statuspkg.Severity(severity)
+		entries = append(entries, entry)
+	}
+
+	if err := rs.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func EnsureStatusEventSchema(ctx context.Context, client executor) error {
+	const ddl = `CREATE TABLE IF NOT EXISTS session_status_events (
+id BIGSERIAL PRIMARY KEY,
+session_id TEXT NOT NULL,
+stage TEXT NOT NULL,
+state TEXT NOT NULL,
+detail TEXT NOT NULL DEFAULT '',
+occurred_at TIMESTAMPTZ NOT NULL,
+created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+)`
+	if err := client.Exec(ctx, ddl); err != nil {
+		return err
+	}
+	const errorColumns = `ALTER TABLE session_status_events
+ADD COLUMN IF NOT EXISTS code TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS severity TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS retryable BOOLEAN NOT NULL DEFAULT FALSE`
+	if err := client.Exec(ctx, errorColumns); err != nil {
+		return err
+	}
+	return client.Exec(ctx, `CREATE INDEX IF NOT EXISTS session_status_events_session_idx ON session_status_events (session_id, id)`)
+}
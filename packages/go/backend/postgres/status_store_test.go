@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestStatusEventStore_Append(t *testing.T) {
+	var executedQuery string
+	var executedArgs []any
+	client := &stubExecutor{execFunc: func(_ context.Context, query string, args ...any) error {
+		executedQuery = query
+		executedArgs = append([]any(nil), args...)
+		return nil
+	}}
+
+	store := NewStatusEventStore(client)
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := statuspkg.SessionStatusEvent{
+		SessionID: "abc",
+		Stage:     "asr",
+		State:     "failed",
+		Detail:    "model missing",
+		Timestamp: ts,
+		Code:      statuspkg.CodeASRModelLoadFailed,
+		Severity:  statuspkg.SeverityError,
+	}
+	if err := store.Append(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(executedQuery, "INSERT INTO session_status_events") {
+		t.Fatalf("unexpected insert query: %s", executedQuery)
+	}
+	if len(executedArgs) != 8 || executedArgs[0] != "abc" || executedArgs[4] != ts || executedArgs[5] != "ASR_MODEL_LOAD_FAILED" || executedArgs[7] != false {
+		t.Fatalf("unexpected args: %v", executedArgs)
+	}
+}
+
+func TestStatusEventStore_AppendStampsMissingTimestamp(t *testing.T) {
+	var occurredAt time.Time
+	client := &stubExecutor{execFunc: func(_ context.Context, _ string, args ...any) error {
+		occurredAt = args[4].(time.Time)
+		return nil
+	}}
+
+	if err := NewStatusEventStore(client).Append(context.Background(), statuspkg.SessionStatusEvent{SessionID: "abc"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if occurredAt.IsZero() {
+		t.Fatal("expected a timestamp to be assigned")
+	}
+}
+
+func TestStatusEventStore_History(t *testing.T) {
+	var executedQuery string
+	var executedArgs []any
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	client := &stubExecutor{
+		queryFunc: func(_ context.Context, query string, args ...any) (rows, error) {
+			executedQuery = query
+			executedArgs = append([]any(nil), args...)
+			return &stubRows{scanFuncs: []func(...any) error{
+				func(dest ...any) error {
+					*(dest[0].(*int64)) = 42
+					*(dest[1].(*string)) = "abc"
+					*(dest[2].(*string)) = "asr"
+					*(dest[3].(*string)) = "completed"
+					*(dest[4].(*string)) = ""
+					*(dest[5].(*time.Time)) = ts
+					*(dest[6].(*string)) = "ASR_RECOGNITION_FAILED"
+					*(dest[7].(*string)) = "error"
+					*(dest[8].(*bool)) = true
+					return nil
+				},
+			}}, nil
+		},
+	}
+
+	entries, err := NewStatusEventStore(client).History(context.Background(), "abc", 41, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != 42 || entries[0].State != "completed" || !entries[0].Timestamp.Equal(ts) {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+	if entries[0].Code != statuspkg.CodeASRFailed || entries[0].Severity != statuspkg.SeverityError || !entries[0].Retryable {
+		t.Fatalf("unexpected error fields: %#v", entries[0])
+	}
+	if !strings.Contains(executedQuery, "ORDER BY id ASC") {
+		t.Fatalf("unexpected history query: %s", executedQuery)
+	}
+	if len(executedArgs) != 3 || executedArgs[0] != "abc" || executedArgs[1] != int64(41) || executedArgs[2] != 100 {
+		t.Fatalf("unexpected args: %v", executedArgs)
+	}
+}
@@ -3,7 +3,10 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 
 	sessionpkg "streamlation/packages/backend/session"
 )
@@ -33,11 +36,38 @@ const (
         target_language,
         enable_dubbing,
         latency_tolerance_ms,
-        model_profile
-) VALUES ($1, $2, $3, $4, $5, $6, $7)`
-	getSessionSQL    = `SELECT id, source_type, source_uri, target_language, enable_dubbing, latency_tolerance_ms, model_profile FROM translation_sessions WHERE id = $1`
+        model_profile,
+        stages,
+        additional_languages,
+        source_credentials,
+        source_backup_uris,
+        audio_track,
+        source_language,
+        vocabulary,
+        glossary,
+        formality,
+        voice_id,
+        voice_gender,
+        voice_style
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`
+	getSessionSQL    = `SELECT id, source_type, source_uri, target_language, enable_dubbing, latency_tolerance_ms, model_profile, stages, additional_languages, source_credentials, source_backup_uris, audio_track, source_language, vocabulary, glossary, formality, voice_id, voice_gender, voice_style FROM translation_sessions WHERE id = $1`
+	updateOptionsSQL = `UPDATE translation_sessions SET
+        enable_dubbing = $2,
+        latency_tolerance_ms = $3,
+        model_profile = $4,
+        stages = $5,
+        additional_languages = $6,
+        audio_track = $7,
+        source_language = $8,
+        vocabulary = $9,
+        glossary = $10,
+        formality = $11,
+        voice_id = $12,
+        voice_gender = $13,
+        voice_style = $14
+WHERE id = $1 RETURNING id`
 	deleteSessionSQL = `DELETE FROM translation_sessions WHERE id = $1`
-	listSessionsSQL  = `SELECT id, source_type, source_uri, target_language, enable_dubbing, latency_tolerance_ms, model_profile FROM translation_sessions ORDER BY created_at DESC LIMIT $1`
+	listSessionsSQL  = `SELECT id, source_type, source_uri, target_language, enable_dubbing, latency_tolerance_ms, model_profile, stages, additional_languages, source_credentials, source_backup_uris, audio_track, source_language, vocabulary, glossary, formality, voice_id, voice_gender, voice_style FROM translation_sessions ORDER BY created_at DESC LIMIT $1`
 )
 
 func NewSessionStore(client executor) *SessionStore {
@@ -49,7 +79,19 @@ type SessionStore struct {
 }
 
 func (s *SessionStore) Create(ctx context.Context, session sessionpkg.TranslationSession) error {
-	err := s.client.Exec(ctx, insertSessionSQL,
+	stages, err := encodeStages(session.Options.Stages)
+	if err != nil {
+		return err
+	}
+	audioTrack, err := encodeAudioTrack(session.Options.AudioTrack)
+	if err != nil {
+		return err
+	}
+	glossary, err := encodeGlossary(session.Options.Glossary)
+	if err != nil {
+		return err
+	}
+	err = s.client.Exec(ctx, insertSessionSQL,
 		session.ID,
 		session.Source.Type,
 		session.Source.URI,
@@ -57,6 +99,18 @@ func (s *SessionStore) Create(ctx context.Context, session sessionpkg.Translatio
 		session.Options.EnableDubbing,
 		session.Options.LatencyToleranceMs,
 		session.Options.ModelProfile,
+		stages,
+		strings.Join(session.Options.AdditionalLanguages, ","),
+		session.Source.Credentials,
+		strings.Join(session.Source.BackupURIs, "\n"),
+		audioTrack,
+		session.Options.SourceLanguage,
+		strings.Join(session.Options.Vocabulary, "\n"),
+		glossary,
+		session.Options.Formality,
+		session.Options.VoiceID,
+		session.Options.VoiceGender,
+		session.Options.VoiceStyle,
 	)
 	if err != nil {
 		var pgErr *Error
@@ -79,6 +133,44 @@ func (s *SessionStore) Get(ctx context.Context, id string) (sessionpkg.Translati
 	return result, nil
 }
 
+// UpdateOptions replaces the options of a stored session. It returns
+// ErrSessionNotFound when there is no session with the ID.
+func (s *SessionStore) UpdateOptions(ctx context.Context, id string, options sessionpkg.TranslationOptions) error {
+	stages, err := encodeStages(options.Stages)
+	if err != nil {
+		return err
+	}
+	audioTrack, err := encodeAudioTrack(options.AudioTrack)
+	if err != nil {
+		return err
+	}
+	glossary, err := encodeGlossary(options.Glossary)
+	if err != nil {
+		return err
+	}
+	var updated string
+	err = s.client.QueryRow(ctx, updateOptionsSQL,
+		id,
+		options.EnableDubbing,
+		options.LatencyToleranceMs,
+		options.ModelProfile,
+		stages,
+		strings.Join(options.AdditionalLanguages, ","),
+		audioTrack,
+		options.SourceLanguage,
+		strings.Join(options.Vocabulary, "\n"),
+		glossary,
+		options.Formality,
+		options.VoiceID,
+		options.VoiceGender,
+		options.VoiceStyle,
+	).Scan(&updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSessionNotFound
+	}
+	return err
+}
+
 func (s *SessionStore) Delete(ctx context.Context, id string) error {
 	return s.client.Exec(ctx, deleteSessionSQL, id)
 }
@@ -119,23 +211,71 @@ func scanSession(scanner interface{ Scan(dest ...any) error }) (sessionpkg.Trans
 		enableDubbing  bool
 		latency        int32
 		modelProfile   string
+		rawStages      string
+		rawLanguages   string
+		credentials    string
+		rawBackups     string
+		rawAudioTrack  string
+		sourceLanguage string
+		rawVocabulary  string
+		rawGlossary    string
+		formality      string
+		voiceID        string
+		voiceGender    string
+		voiceStyle     string
 	)
 
-	if err := scanner.Scan(&id, &sourceType, &sourceURI, &targetLanguage, &enableDubbing, &latency, &modelProfile); err != nil {
+	if err := scanner.Scan(&id, &sourceType, &sourceURI, &targetLanguage, &enableDubbing, &latency, &modelProfile, &rawStages, &rawLanguages, &credentials, &rawBackups, &rawAudioTrack, &sourceLanguage, &rawVocabulary, &rawGlossary, &formality, &voiceID, &voiceGender, &voiceStyle); err != nil {
 		return sessionpkg.TranslationSession{}, err
 	}
+	stages, err := decodeStages(rawStages)
+	if err != nil {
+		return sessionpkg.TranslationSession{}, err
+	}
+	audioTrack, err := decodeAudioTrack(rawAudioTrack)
+	if err != nil {
+		return sessionpkg.TranslationSession{}, err
+	}
+	glossary, err := decodeGlossary(rawGlossary)
+	if err != nil {
+		return sessionpkg.TranslationSession{}, err
+	}
+	var additionalLanguages []string
+	if rawLanguages != "" {
+		additionalLanguages = strings.Split(rawLanguages, ",")
+	}
+	var backupURIs []string
+	if rawBackups != "" {
+		backupURIs = strings.Split(rawBackups, "\n")
+	}
+	var vocabulary []string
+	if rawVocabulary != "" {
+		vocabulary = strings.Split(rawVocabulary, "\n")
+	}
 
 	return sessionpkg.TranslationSession{
 		ID: id,
 		Source: sessionpkg.TranslationSource{
-			Type: sourceType,
-			URI:  sourceURI,
+			Type:        sourceType,
+			URI:         sourceURI,
+			Credentials: credentials,
+			BackupURIs:  backupURIs,
 		},
 		TargetLanguage: targetLanguage,
 		Options: sessionpkg.TranslationOptions{
-			EnableDubbing:      enableDubbing,
-			LatencyToleranceMs: int(latency),
-			ModelProfile:       modelProfile,
+			EnableDubbing:       enableDubbing,
+			LatencyToleranceMs:  int(latency),
+			ModelProfile:        modelProfile,
+			Stages:              stages,
+			AdditionalLanguages: additionalLanguages,
+			AudioTrack:          audioTrack,
+			SourceLanguage:      sourceLanguage,
+			Vocabulary:          vocabulary,
+			Glossary:            glossary,
+			Formality:           formality,
+			VoiceID:             voiceID,
+			VoiceGender:         voiceGender,
+			VoiceStyle:          voiceStyle,
 		},
 	}, nil
 }
@@ -151,7 +291,118 @@ latency_tolerance_ms INTEGER NOT NULL,
 model_profile TEXT NOT NULL,
 created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 )`
-	return client.Exec(ctx, ddl)
+	if err := client.Exec(ctx, ddl); err != nil {
+		return err
+	}
+	if err := client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS stages TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS additional_languages TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	// Source credentials are stored sealed; see session.SealSourceAuth.
+	if err := client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS source_credentials TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	// Backup source URIs are stored one per line.
+	if err := client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS source_backup_uris TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS audio_track TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS source_language TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	// Vocabulary terms are stored one per line.
+	if err := client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS vocabulary TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS glossary TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS formality TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS voice_id TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS voice_gender TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	return client.Exec(ctx, `ALTER TABLE translation_sessions ADD COLUMN IF NOT EXISTS voice_style TEXT NOT NULL DEFAULT ''`)
+}
+
+// encodeStages stores the per-session stage selection as JSON, or as an
+// empty string when the session uses the worker's defaults.
+func encodeStages(stages map[string]string) (string, error) {
+	if len(stages) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(stages)
+	if err != nil {
+		return "", fmt.Errorf("encode session stages: %w", err)
+	}
+	return string(data), nil
+}
+
+func decodeStages(raw string) (map[string]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var stages map[string]string
+	if err := json.Unmarshal([]byte(raw), &stages); err != nil {
+		return nil, fmt.Errorf("decode session stages: %w", err)
+	}
+	return stages, nil
+}
+
+// encodeAudioTrack stores the session's audio track selection as JSON, or
+// as an empty string when the session uses the source's default track.
+func encodeAudioTrack(track *sessionpkg.AudioTrackSelection) (string, error) {
+	if track == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(track)
+	if err != nil {
+		return "", fmt.Errorf("encode session audio track: %w", err)
+	}
+	return string(data), nil
+}
+
+func decodeAudioTrack(raw string) (*sessionpkg.AudioTrackSelection, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var track sessionpkg.AudioTrackSelection
+	if err := json.Unmarshal([]byte(raw), &track); err != nil {
+		return nil, fmt.Errorf("decode session audio track: %w", err)
+	}
+	return &track, nil
+}
+
+// encodeGlossary stores the session's glossary as JSON, or as an empty
+// string when the session has none.
+func encodeGlossary(glossary *sessionpkg.Glossary) (string, error) {
+	if glossary == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(glossary)
+	if err != nil {
+		return "", fmt.Errorf("encode session glossary: %w", err)
+	}
+	return string(data), nil
+}
+
+func decodeGlossary(raw string) (*sessionpkg.Glossary, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var glossary sessionpkg.Glossary
+	if err := json.Unmarshal([]byte(raw), &glossary); err != nil {
+		return nil, fmt.Errorf("decode session glossary: %w", err)
+	}
+	return &glossary, nil
 }
 
 var (
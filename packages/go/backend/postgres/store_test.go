@@ -24,9 +24,9 @@ func TestSessionStore_CreateDuplicate(t *testing.T) {
 	store := NewSessionStore(client)
 	session := sessionpkg.TranslationSession{
 		ID:             "dup",
-		Source:         sessionpkg.TranslationSource{Type: "hls", URI: "https://example.com"},
+		Source:         sessionpkg.TranslationSource{Type: "hls", URI: "https://example.com", Credentials: "sealed", BackupURIs: []string{"https://a.example", "https://b.example"}},
 		TargetLanguage: "fr",
-		Options:        sessionpkg.TranslationOptions{EnableDubbing: true, LatencyToleranceMs: 1200, ModelProfile: "cpu-basic"},
+		Options:        sessionpkg.TranslationOptions{EnableDubbing: true, LatencyToleranceMs: 1200, ModelProfile: "cpu-basic", Stages: map[string]string{"asr": "whisper"}, AdditionalLanguages: []string{"de", "it"}, AudioTrack: &sessionpkg.AudioTrackSelection{Language: "en"}, SourceLanguage: "auto", Vocabulary: []string{"Streamlation", "Jobaben"}, Glossary: &sessionpkg.Glossary{DoNotTranslate: []string{"Streamlation"}}, Formality: "formal", VoiceID: "voice-1", VoiceGender: "female", VoiceStyle: "narration"},
 	}
 
 	err := store.Create(context.Background(), session)
@@ -37,10 +37,10 @@ func TestSessionStore_CreateDuplicate(t *testing.T) {
 	if !strings.Contains(executedQuery, "INSERT INTO translation_sessions") {
 		t.Fatalf("unexpected insert query: %s", executedQuery)
 	}
-	if len(executedArgs) != 7 {
-		t.Fatalf("expected 7 args, got %d", len(executedArgs))
+	if len(executedArgs) != 19 {
+		t.Fatalf("expected 19 args, got %d", len(executedArgs))
 	}
-	if executedArgs[0] != session.ID || executedArgs[1] != session.Source.Type {
+	if executedArgs[0] != session.ID || executedArgs[1] != session.Source.Type || executedArgs[7] != `{"asr":"whisper"}` || executedArgs[8] != "de,it" || executedArgs[9] != "sealed" || executedArgs[10] != "https://a.example\nhttps://b.example" || executedArgs[11] != `{"language":"en"}` || executedArgs[12] != "auto" || executedArgs[13] != "Streamlation\nJobaben" || executedArgs[14] != `{"doNotTranslate":["Streamlation"]}` || executedArgs[15] != "formal" || executedArgs[16] != "voice-1" || executedArgs[17] != "female" || executedArgs[18] != "narration" {
 		t.Fatalf("unexpected args: %v", executedArgs)
 	}
 }
@@ -62,6 +62,17 @@ func TestSessionStore_Get(t *testing.T) {
 				*(dest[4].(*bool)) = true
 				*(dest[5].(*int32)) = 3000
 				*(dest[6].(*string)) = "gpu-accelerated"
+				*(dest[7].(*string)) = `{"asr":"whisper"}`
+				*(dest[8].(*string)) = "de,it"
+				*(dest[9].(*string)) = "sealed"
+				*(dest[10].(*string)) = "https://backup.example"
+				*(dest[11].(*string)) = `{"index":1}`
+				*(dest[12].(*string)) = "en"
+				*(dest[13].(*string)) = "Streamlation\nJobaben"
+				*(dest[14].(*string)) = `{"terms":[{"source":"live","target":"en directo","language":"es"}]}`
+				*(dest[15].(*string)) = "informal"
+				*(dest[16].(*string)) = "voice-2"
+				*(dest[17].(*string)) = "male"
 				return nil
 			}}
 		},
@@ -82,6 +93,36 @@ func TestSessionStore_Get(t *testing.T) {
 	if session.Options.LatencyToleranceMs != 3000 {
 		t.Fatalf("unexpected latency: %d", session.Options.LatencyToleranceMs)
 	}
+	if session.Options.Stages["asr"] != "whisper" {
+		t.Fatalf("unexpected stages: %v", session.Options.Stages)
+	}
+	if languages := session.Options.AdditionalLanguages; len(languages) != 2 || languages[0] != "de" || languages[1] != "it" {
+		t.Fatalf("unexpected additional languages: %v", languages)
+	}
+	if session.Source.Credentials != "sealed" {
+		t.Fatalf("unexpected source credentials: %q", session.Source.Credentials)
+	}
+	if backups := session.Source.BackupURIs; len(backups) != 1 || backups[0] != "https://backup.example" {
+		t.Fatalf("unexpected backup URIs: %v", backups)
+	}
+	if track := session.Options.AudioTrack; track == nil || track.Index != 1 || track.Language != "" {
+		t.Fatalf("unexpected audio track: %+v", track)
+	}
+	if session.Options.SourceLanguage != "en" {
+		t.Fatalf("unexpected source language: %q", session.Options.SourceLanguage)
+	}
+	if glossary := session.Options.Glossary; glossary == nil || len(glossary.Terms) != 1 || glossary.Terms[0] != (sessionpkg.GlossaryTerm{Source: "live", Target: "en directo", Language: "es"}) {
+		t.Fatalf("unexpected glossary: %+v", glossary)
+	}
+	if vocabulary := session.Options.Vocabulary; len(vocabulary) != 2 || vocabulary[1] != "Jobaben" {
+		t.Fatalf("unexpected vocabulary: %v", vocabulary)
+	}
+	if session.Options.Formality != "informal" {
+		t.Fatalf("unexpected formality: %q", session.Options.Formality)
+	}
+	if session.Options.VoiceID != "voice-2" || session.Options.VoiceGender != "male" || session.Options.VoiceStyle != "" {
+		t.Fatalf("unexpected voice: %q %q %q", session.Options.VoiceID, session.Options.VoiceGender, session.Options.VoiceStyle)
+	}
 }
 
 func TestSessionStore_GetNotFound(t *testing.T) {
@@ -97,6 +138,45 @@ func TestSessionStore_GetNotFound(t *testing.T) {
 	}
 }
 
+func TestSessionStore_UpdateOptions(t *testing.T) {
+	var executedQuery string
+	var executedArgs []any
+	found := true
+	client := &stubExecutor{
+		queryRowFunc: func(_ context.Context, query string, args ...any) row {
+			executedQuery = query
+			executedArgs = append([]any(nil), args...)
+			return stubRow{scanFunc: func(dest ...any) error {
+				if !found {
+					return sql.ErrNoRows
+				}
+				*(dest[0].(*string)) = args[0].(string)
+				return nil
+			}}
+		},
+	}
+
+	store := NewSessionStore(client)
+	options := sessionpkg.TranslationOptions{LatencyToleranceMs: 800, ModelProfile: "cpu-basic", AdditionalLanguages: []string{"de", "it"}, Vocabulary: []string{"Streamlation", "Jobaben"}, Glossary: &sessionpkg.Glossary{DoNotTranslate: []string{"Streamlation"}}, VoiceID: "voice-1"}
+	if err := store.UpdateOptions(context.Background(), "known", options); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(executedQuery, "UPDATE translation_sessions") || !strings.Contains(executedQuery, "WHERE id = $1") {
+		t.Fatalf("unexpected update query: %s", executedQuery)
+	}
+	if len(executedArgs) != 14 {
+		t.Fatalf("expected 14 args, got %d", len(executedArgs))
+	}
+	if executedArgs[0] != "known" || executedArgs[2] != 800 || executedArgs[5] != "de,it" || executedArgs[8] != "Streamlation\nJobaben" || executedArgs[9] != `{"doNotTranslate":["Streamlation"]}` || executedArgs[11] != "voice-1" {
+		t.Fatalf("unexpected args: %v", executedArgs)
+	}
+
+	found = false
+	if err := store.UpdateOptions(context.Background(), "missing", options); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
 func TestSessionStore_Delete(t *testing.T) {
 	var executedQuery string
 	var executedArgs []any
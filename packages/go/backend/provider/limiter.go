@@ -0,0 +1,324 @@
+// Package provider guards the requests that stages send to external
+// services, such as transcription, translation, and speech APIs.
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// Defaults of LimiterConfig.
+const (
+	DefaultBreakerFailures = 5
+	DefaultBreakerCooldown = 30 * time.Second
+	DefaultRetries         = 3
+	DefaultRetryBackoff    = time.Second
+	DefaultMaxRetryBackoff = 30 * time.Second
+)
+
+// ErrCircuitOpen is the cause of the failures of requests refused because
+// their provider kept failing.
+var ErrCircuitOpen = errors.New("provider circuit open")
+
+// LimiterConfig configures a Limiter. Zero values fall back to the
+// defaults.
+type LimiterConfig struct {
+	// Code is the error code of the requests refused while the circuit is
+	// open, that of the stage calling the provider.
+	Code statuspkg.ErrorCode
+	// RequestsPerMinute is the rate requests are let through at, and Burst
+	// how many may go at once after a quiet period. A RequestsPerMinute
+	// that is not positive does not limit the rate; Burst defaults to 1.
+	RequestsPerMinute int
+	Burst             int
+	// Concurrency bounds the requests in flight. Zero does not bound them.
+	Concurrency int
+	// BreakerFailures is how many transient failures in a row open the
+	// circuit, refusing requests for BreakerCooldown before one is let
+	// through to probe the provider. Default to DefaultBreakerFailures and
+	// DefaultBreakerCooldown; a negative BreakerFailures never opens it.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+	// Retries is how often a request that failed for a reason that may
+	// pass, such as a rate limit or a server error, is retried. Defaults to
+	// DefaultRetries; a negative value disables retries.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubling up to
+	// MaxRetryBackoff for each one after it. A Retry-After header the
+	// provider sends takes precedence. Default to DefaultRetryBackoff and
+	// DefaultMaxRetryBackoff.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+}
+
+// Limiter guards one provider for every stage using it: it paces their
+// requests with a token bucket, bounds how many are in flight, holds them
+// all back while the provider asks to be left alone, breaks the circuit
+// after a run of failures, so that sessions fail fast rather than queueing
+// on a provider that does not answer, and retries the requests that fail
+// for a reason that may pass.
+//
+// Only transient failures, such as rate limits, server errors, and network
+// errors, count towards the breaker and are retried. A nil *Limiter lets
+// every request through, retrying them with the defaults.
+type Limiter struct {
+	cfg   LimiterConfig
+	rate  float64 // tokens a second
+	slots chan struct{}
+	now   func() time.Time
+
+	mu        sync.Mutex
+	tokens    float64
+	refilled  time.Time
+	paused    time.Time
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// NewLimiter returns a limiter configured by cfg.
+func NewLimiter(cfg LimiterConfig) *Limiter {
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+	switch {
+	case cfg.BreakerFailures < 0:
+		cfg.BreakerFailures = 0
+	case cfg.BreakerFailures == 0:
+		cfg.BreakerFailures = DefaultBreakerFailures
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = DefaultBreakerCooldown
+	}
+	cfg = cfg.withRetryDefaults()
+	l := &Limiter{cfg: cfg, now: time.Now, tokens: float64(cfg.Burst)}
+	if cfg.RequestsPerMinute > 0 {
+		l.rate = float64(cfg.RequestsPerMinute) / 60
+	}
+	if cfg.Concurrency > 0 {
+		l.slots = make(chan struct{}, cfg.Concurrency)
+	}
+	return l
+}
+
+// withRetryDefaults fills in the retry settings left zero.
+func (cfg LimiterConfig) withRetryDefaults() LimiterConfig {
+	switch {
+	case cfg.Retries < 0:
+		cfg.Retries = 0
+	case cfg.Retries == 0:
+		cfg.Retries = DefaultRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	if cfg.MaxRetryBackoff <= 0 {
+		cfg.MaxRetryBackoff = DefaultMaxRetryBackoff
+	}
+	return cfg
+}
+
+// Do sends a request with send, acquiring the limiter for each attempt,
+// and retries it as configured while it fails with a transient error. send
+// returns, along with a failure, how long the provider asked to wait before
+// retrying, if it did, which holds back every request. A failure wrapped
+// with Final is returned without retrying.
+func (l *Limiter) Do(ctx context.Context, send func(ctx context.Context) (time.Duration, error)) error {
+	cfg := LimiterConfig{}.withRetryDefaults()
+	if l != nil {
+		cfg = l.cfg
+	}
+	backoff := cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		done, err := l.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		retryAfter, err := send(ctx)
+		done(err)
+		l.Pause(retryAfter)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var final *finalError
+		if errors.As(err, &final) {
+			return final.err
+		}
+		if !errors.Is(err, statuspkg.ErrTransient) || attempt >= cfg.Retries {
+			return err
+		}
+		delay := backoff
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, cfg.MaxRetryBackoff)
+	}
+}
+
+// Final marks err as a failure that Do returns without retrying, such as
+// one after part of the response was already passed on.
+func Final(err error) error {
+	return &finalError{err: err}
+}
+
+type finalError struct {
+	err error
+}
+
+func (e *finalError) Error() string { return e.err.Error() }
+
+func (e *finalError) Unwrap() error { return e.err }
+
+// Acquire waits until a request may be sent to the provider and returns a
+// function to call with the request's outcome once it completes. While the
+// circuit is open it fails at once with a retryable error of cfg.Code
+// caused by ErrCircuitOpen.
+func (l *Limiter) Acquire(ctx context.Context) (func(err error), error) {
+	if l == nil {
+		return func(error) {}, nil
+	}
+	probe, err := l.admit()
+	if err != nil {
+		return nil, err
+	}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			l.settle(probe, ctx.Err())
+			return nil, ctx.Err()
+		}
+	}
+	if err := l.wait(ctx); err != nil {
+		l.release()
+		l.settle(probe, err)
+		return nil, err
+	}
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			l.release()
+			l.settle(probe, err)
+		})
+	}, nil
+}
+
+// Pause holds back every request for d, such as when the provider answered
+// with a Retry-After header.
+func (l *Limiter) Pause(d time.Duration) {
+	if l == nil || d <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.now().Add(d); until.After(l.paused) {
+		l.paused = until
+	}
+}
+
+// Open reports whether the circuit is open.
+func (l *Limiter) Open() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.openUntil.IsZero()
+}
+
+// admit checks the circuit, and reports whether the request is the probe
+// of a circuit whose cooldown has passed.
+func (l *Limiter) admit() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.openUntil.IsZero() {
+		return false, nil
+	}
+	if l.probing || l.now().Before(l.openUntil) {
+		return false, &statuspkg.StageError{Code: l.cfg.Code, Retryable: true, Err: ErrCircuitOpen}
+	}
+	l.probing = true
+	return true, nil
+}
+
+// settle records the outcome of a request in the breaker.
+func (l *Limiter) settle(probe bool, err error) {
+	if l.cfg.BreakerFailures == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if probe {
+		l.probing = false
+	}
+	switch {
+	case err == nil:
+		l.failures, l.openUntil = 0, time.Time{}
+	case errors.Is(err, statuspkg.ErrTransient):
+		l.failures++
+		if probe || l.failures >= l.cfg.BreakerFailures {
+			l.openUntil = l.now().Add(l.cfg.BreakerCooldown)
+		}
+	}
+}
+
+// wait takes a token from the bucket, waiting for one, and for a pause to
+// end, as needed.
+func (l *Limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := l.now()
+	at := now
+	if l.paused.After(at) {
+		at = l.paused
+	}
+	if l.rate > 0 {
+		if !l.refilled.IsZero() {
+			l.tokens = min(l.tokens+now.Sub(l.refilled).Seconds()*l.rate, float64(l.cfg.Burst))
+		}
+		l.refilled = now
+		// Tokens go negative to queue the requests waiting for them.
+		l.tokens--
+		if l.tokens < 0 {
+			if refill := now.Add(time.Duration(-l.tokens / l.rate * float64(time.Second))); refill.After(at) {
+				at = refill
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		if l.rate > 0 {
+			l.mu.Lock()
+			l.tokens++
+			l.mu.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestLimiterBreaksAfterRepeatedFailures(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(LimiterConfig{BreakerFailures: 2, BreakerCooldown: time.Minute})
+	limiter.now = func() time.Time { return now }
+	transient := &statuspkg.StageError{Code: statuspkg.CodeTranslationFailed, Retryable: true, Err: errors.New("503")}
+
+	for i := 0; i < 2; i++ {
+		done, err := limiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+		done(transient)
+	}
+	if !limiter.Open() {
+		t.Fatal("expected the circuit to open")
+	}
+	_, err := limiter.Acquire(context.Background())
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, statuspkg.ErrTransient) {
+		t.Fatalf("expected a retryable circuit open error, got %v", err)
+	}
+
+	// After the cooldown one request probes the provider.
+	now = now.Add(time.Minute)
+	probe, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if _, err := limiter.Acquire(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected requests to wait for the probe, got %v", err)
+	}
+	probe(nil)
+	if limiter.Open() {
+		t.Fatal("expected a successful probe to close the circuit")
+	}
+
+	// Failures that retrying cannot fix do not count.
+	for i := 0; i < 3; i++ {
+		done, err := limiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		done(&statuspkg.StageError{Code: statuspkg.CodeTranslationFailed, Err: errors.New("403")})
+	}
+	if limiter.Open() {
+		t.Fatal("expected rejected requests to leave the circuit closed")
+	}
+}
+
+func TestLimiterBoundsConcurrencyAndRate(t *testing.T) {
+	t.Parallel()
+
+	limiter := NewLimiter(LimiterConfig{Concurrency: 1})
+	done, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a second request to wait for the first, got %v", err)
+	}
+	done(nil)
+	if done, err = limiter.Acquire(context.Background()); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	done(nil)
+
+	// 600 a minute is one every 100ms after a burst of two.
+	limiter = NewLimiter(LimiterConfig{RequestsPerMinute: 600, Burst: 2})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		done, err := limiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+		done(nil)
+		if elapsed := time.Since(start); i < 2 && elapsed > 50*time.Millisecond {
+			t.Fatalf("expected request %d to go with the burst, waited %v", i, elapsed)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("expected the third request to wait for a token, waited %v", elapsed)
+	}
+
+	limiter = NewLimiter(LimiterConfig{})
+	limiter.Pause(50 * time.Millisecond)
+	start = time.Now()
+	if done, err = limiter.Acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	done(nil)
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("expected requests to wait out the pause, waited %v", elapsed)
+	}
+}
+
+func TestLimiterRetriesTransientFailures(t *testing.T) {
+	t.Parallel()
+
+	limiter := NewLimiter(LimiterConfig{Retries: 2, RetryBackoff: time.Millisecond})
+	transient := &statuspkg.StageError{Code: statuspkg.CodeASRFailed, Retryable: true, Err: errors.New("503")}
+
+	attempts := 0
+	err := limiter.Do(context.Background(), func(context.Context) (time.Duration, error) {
+		attempts++
+		return 0, transient
+	})
+	if !errors.Is(err, transient) || attempts != 3 {
+		t.Fatalf("expected 3 attempts ending with the last failure, got %d and %v", attempts, err)
+	}
+
+	attempts = 0
+	err = limiter.Do(context.Background(), func(context.Context) (time.Duration, error) {
+		attempts++
+		if attempts == 1 {
+			return time.Millisecond, transient
+		}
+		return 0, nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("expected a retry to succeed, got %d attempts and %v", attempts, err)
+	}
+
+	// Rejected and final failures are not retried.
+	for _, failure := range []error{
+		&statuspkg.StageError{Code: statuspkg.CodeASRFailed, Err: errors.New("403")},
+		Final(transient),
+	} {
+		attempts = 0
+		err = limiter.Do(context.Background(), func(context.Context) (time.Duration, error) {
+			attempts++
+			return 0, failure
+		})
+		if err == nil || attempts != 1 {
+			t.Fatalf("expected a single attempt, got %d and %v", attempts, err)
+		}
+	}
+	if err != transient {
+		t.Fatalf("expected the final failure to be unwrapped, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	redisclient "streamlation/packages/backend/redis"
+)
+
+// Auxiliary ingestion queues. Workers move the jobs they take to the
+// processing queue until they are handled, so that the jobs of a worker that
+// died can be requeued, and move the jobs that fail to the dead-letter queue
+// for inspection.
+const (
+	IngestionProcessingQueueName = "streamlation:ingestion:processing"
+	IngestionDeadLetterQueueName = "streamlation:ingestion:dead-letter"
+)
+
+// RedisQueueAdmin exposes inspection and maintenance operations over the
+// Redis lists backing the job queues. Jobs are pushed with LPUSH and popped
+// from the right, so index 0 of Peek is the newest job and the oldest job is
+// the next one to be consumed.
+type RedisQueueAdmin struct {
+	client *redisclient.Client
+}
+
+func NewRedisQueueAdmin(addr string) (*RedisQueueAdmin, error) {
+	client, err := redisclient.NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisQueueAdmin{client: client}, nil
+}
+
+// Count returns the number of jobs waiting in queueName.
+func (a *RedisQueueAdmin) Count(ctx context.Context, queueName string) (int, error) {
+	reply, err := a.client.Do(ctx, "LLEN", queueName)
+	if err != nil {
+		return 0, fmt.Errorf("count %s: %w", queueName, err)
+	}
+	n, err := strconv.Atoi(reply.Text)
+	if err != nil {
+		return 0, fmt.Errorf("count %s: unexpected reply %q", queueName, reply.Text)
+	}
+	return n, nil
+}
+
+// Peek returns up to limit raw payloads from queueName, oldest first,
+// without removing them.
+func (a *RedisQueueAdmin) Peek(ctx context.Context, queueName string, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	reply, err := a.client.Do(ctx, "LRANGE", queueName, strconv.Itoa(-limit), "-1")
+	if err != nil {
+		return nil, fmt.Errorf("peek %s: %w", queueName, err)
+	}
+	if reply.Type != '*' {
+		return nil, fmt.Errorf("peek %s: unexpected reply %#v", queueName, reply)
+	}
+	payloads := make([]string, 0, len(reply.Array))
+	for i := len(reply.Array) - 1; i >= 0; i-- {
+		payloads = append(payloads, reply.Array[i].Text)
+	}
+	return payloads, nil
+}
+
+// Purge removes every job from queueName and returns how many were dropped.
+func (a *RedisQueueAdmin) Purge(ctx context.Context, queueName string) (int, error) {
+	count, err := a.Count(ctx, queueName)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := a.client.Do(ctx, "DEL", queueName); err != nil {
+		return 0, fmt.Errorf("purge %s: %w", queueName, err)
+	}
+	return count, nil
+}
+
+// Move transfers up to limit of the oldest jobs from one queue to another,
+// preserving their relative order. A limit of zero or less moves every job.
+// It returns how many jobs were moved.
+func (a *RedisQueueAdmin) Move(ctx context.Context, from, to string, limit int) (int, error) {
+	if from == to {
+		return 0, errors.New("source and destination queues must differ")
+	}
+	moved := 0
+	for limit <= 0 || moved < limit {
+		reply, err := a.client.Do(ctx, "RPOPLPUSH", from, to)
+		if err != nil {
+			return moved, fmt.Errorf("move %s to %s: %w", from, to, err)
+		}
+		if reply.IsNil {
+			break
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+func (a *RedisQueueAdmin) Close() error {
+	return a.client.Close()
+}
@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRedisQueueAdmin(t *testing.T) {
+	addr := startListServer(t)
+	ctx := context.Background()
+
+	enqueuer, err := NewRedisIngestionEnqueuer(addr)
+	if err != nil {
+		t.Fatalf("failed to create enqueuer: %v", err)
+	}
+	t.Cleanup(func() { _ = enqueuer.Close() })
+	for _, id := range []string{"job-1", "job-2", "job-3"} {
+		if err := enqueuer.EnqueueIngestion(ctx, id); err != nil {
+			t.Fatalf("enqueue %s: %v", id, err)
+		}
+	}
+
+	admin, err := NewRedisQueueAdmin(addr)
+	if err != nil {
+		t.Fatalf("failed to create admin: %v", err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+
+	count, err := admin.Count(ctx, IngestionQueueName)
+	if err != nil || count != 3 {
+		t.Fatalf("Count = %d, %v; want 3", count, err)
+	}
+
+	peeked, err := admin.Peek(ctx, IngestionQueueName, 2)
+	if err != nil {
+		t.Fatalf("Peek error: %v", err)
+	}
+	if len(peeked) != 2 || peeked[0] != `{"session_id":"job-1"}` || peeked[1] != `{"session_id":"job-2"}` {
+		t.Fatalf("unexpected peek result (want oldest first): %v", peeked)
+	}
+
+	moved, err := admin.Move(ctx, IngestionQueueName, IngestionDeadLetterQueueName, 2)
+	if err != nil || moved != 2 {
+		t.Fatalf("Move = %d, %v; want 2", moved, err)
+	}
+	dead, err := admin.Peek(ctx, IngestionDeadLetterQueueName, 10)
+	if err != nil {
+		t.Fatalf("Peek dead-letter error: %v", err)
+	}
+	if len(dead) != 2 || dead[0] != `{"session_id":"job-1"}` {
+		t.Fatalf("expected order to be preserved in dead-letter queue: %v", dead)
+	}
+
+	moved, err = admin.Move(ctx, IngestionDeadLetterQueueName, IngestionQueueName, 0)
+	if err != nil || moved != 2 {
+		t.Fatalf("Move all = %d, %v; want 2", moved, err)
+	}
+
+	purged, err := admin.Purge(ctx, IngestionQueueName)
+	if err != nil || purged != 3 {
+		t.Fatalf("Purge = %d, %v; want 3", purged, err)
+	}
+	count, err = admin.Count(ctx, IngestionQueueName)
+	if err != nil || count != 0 {
+		t.Fatalf("Count after purge = %d, %v; want 0", count, err)
+	}
+
+	if _, err := admin.Move(ctx, IngestionQueueName, IngestionQueueName, 1); err == nil {
+		t.Fatal("expected error moving a queue onto itself")
+	}
+	if _, err := admin.Peek(ctx, IngestionQueueName, 0); err == nil {
+		t.Fatal("expected error for non-positive peek limit")
+	}
+}
@@ -0,0 +1,262 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	redisclient "streamlation/packages/backend/redis"
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+// ControlChannelName is the pub/sub channel carrying control messages to workers.
+// Every worker subscribes to it; messages addressed to a specific worker carry
+// its WorkerID and are ignored by the others.
+const ControlChannelName = "streamlation:control"
+
+// ControlKind identifies the action requested by a control message.
+type ControlKind string
+
+const (
+	// ControlCancelSession stops any in-flight pipeline for SessionID.
+	ControlCancelSession ControlKind = "cancel_session"
+	// ControlUpdateOptions replaces the options used for SessionID.
+	ControlUpdateOptions ControlKind = "update_options"
+	// ControlDrainWorker stops the worker from accepting new jobs and lets
+	// in-flight sessions finish.
+	ControlDrainWorker ControlKind = "drain_worker"
+)
+
+// ControlMessage is a typed instruction delivered to workers alongside
+// ingestion jobs.
+type ControlMessage struct {
+	Kind      ControlKind                    `json:"kind"`
+	SessionID string                         `json:"session_id,omitempty"`
+	WorkerID  string                         `json:"worker_id,omitempty"`
+	Options   *sessionpkg.TranslationOptions `json:"options,omitempty"`
+	IssuedAt  time.Time                      `json:"issued_at"`
+}
+
+// Validate reports whether the message carries the fields its kind requires.
+func (m ControlMessage) Validate() error {
+	switch m.Kind {
+	case ControlCancelSession:
+		if m.SessionID == "" {
+			return errors.New("cancel_session requires session_id")
+		}
+	case ControlUpdateOptions:
+		if m.SessionID == "" {
+			return errors.New("update_options requires session_id")
+		}
+		if m.Options == nil {
+			return errors.New("update_options requires options")
+		}
+	case ControlDrainWorker:
+	default:
+		return fmt.Errorf("unknown control kind %q", m.Kind)
+	}
+	return nil
+}
+
+// AppliesTo reports whether a worker with the given ID should act on the message.
+func (m ControlMessage) AppliesTo(workerID string) bool {
+	return m.WorkerID == "" || m.WorkerID == workerID
+}
+
+type RedisControlPublisher struct {
+	client *redisclient.Client
+}
+
+func NewRedisControlPublisher(addr string) (*RedisControlPublisher, error) {
+	client, err := redisclient.NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisControlPublisher{client: client}, nil
+}
+
+func (p *RedisControlPublisher) SendControl(ctx context.Context, msg ControlMessage) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	if msg.IssuedAt.IsZero() {
+		msg.IssuedAt = time.Now().UTC()
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal control message: %w", err)
+	}
+	if _, err := p.client.Do(ctx, "PUBLISH", ControlChannelName, string(payload)); err != nil {
+		return fmt.Errorf("publish control message: %w", err)
+	}
+	return nil
+}
+
+func (p *RedisControlPublisher) Close() error {
+	return p.client.Close()
+}
+
+type RedisControlSubscriber struct {
+	client *redisclient.Client
+}
+
+func NewRedisControlSubscriber(addr string) (*RedisControlSubscriber, error) {
+	client, err := redisclient.NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisControlSubscriber{client: client}, nil
+}
+
+// SubscribeControl subscribes to the control channel. The subscription is
+// re-established, with backoff, whenever the connection to Redis is lost;
+// each loss is reported on the stream's Errors.
+func (s *RedisControlSubscriber) SubscribeControl(ctx context.Context) (ControlStream, error) {
+	subscribe := func(ctx context.Context) (*redisclient.PubSub, error) {
+		return s.client.Subscribe(ctx, ControlChannelName)
+	}
+	pubsub, err := subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream := &redisControlStream{
+		subscribe:  subscribe,
+		ctx:        streamCtx,
+		cancel:     cancel,
+		minBackoff: controlResubscribeMinBackoff,
+		maxBackoff: controlResubscribeMaxBackoff,
+		messages:   make(chan ControlMessage, 8),
+		errors:     make(chan error, 1),
+		done:       make(chan struct{}),
+	}
+	go stream.run(pubsub)
+	return stream, nil
+}
+
+func (s *RedisControlSubscriber) Close() error {
+	return s.client.Close()
+}
+
+type ControlStream interface {
+	Messages() <-chan ControlMessage
+	Errors() <-chan error
+	Close() error
+}
+
+// Backoff between attempts to re-establish a lost control subscription.
+const (
+	controlResubscribeMinBackoff = 100 * time.Millisecond
+	controlResubscribeMaxBackoff = 10 * time.Second
+)
+
+type redisControlStream struct {
+	subscribe              func(context.Context) (*redisclient.PubSub, error)
+	ctx                    context.Context
+	cancel                 context.CancelFunc
+	minBackoff, maxBackoff time.Duration
+
+	messages  chan ControlMessage
+	errors    chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *redisControlStream) Messages() <-chan ControlMessage {
+	return s.messages
+}
+
+func (s *redisControlStream) Errors() <-chan error {
+	return s.errors
+}
+
+// Close ends the subscription. It does not wait for pending messages to be
+// consumed.
+func (s *redisControlStream) Close() error {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		<-s.done
+	})
+	return nil
+}
+
+func (s *redisControlStream) run(pubsub *redisclient.PubSub) {
+	defer close(s.done)
+	defer close(s.messages)
+	defer close(s.errors)
+
+	backoff := s.minBackoff
+	for {
+		if !s.consume(pubsub) {
+			return
+		}
+		s.reportError(errors.New("control subscription lost; resubscribing"))
+		for pubsub = nil; pubsub == nil; {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			var err error
+			if pubsub, err = s.subscribe(s.ctx); err != nil {
+				s.reportError(fmt.Errorf("resubscribe to control channel: %w", err))
+				backoff = min(2*backoff, s.maxBackoff)
+			}
+		}
+		backoff = s.minBackoff
+	}
+}
+
+// consume forwards the messages of pubsub until it ends. It returns false
+// once the stream is closed, and true when the subscription was lost.
+func (s *redisControlStream) consume(pubsub *redisclient.PubSub) bool {
+	defer func() { _ = pubsub.Close() }()
+
+	messages, errs := pubsub.Messages(), pubsub.Errors()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return false
+		case msg, ok := <-messages:
+			if !ok {
+				return s.ctx.Err() == nil
+			}
+			if msg.Kind != "message" && msg.Kind != "pmessage" {
+				continue
+			}
+			var control ControlMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &control); err != nil {
+				s.reportError(fmt.Errorf("decode control message: %w", err))
+				continue
+			}
+			if err := control.Validate(); err != nil {
+				s.reportError(fmt.Errorf("invalid control message: %w", err))
+				continue
+			}
+			select {
+			case s.messages <- control:
+			case <-s.ctx.Done():
+				return false
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				s.reportError(err)
+			}
+		}
+	}
+}
+
+func (s *redisControlStream) reportError(err error) {
+	select {
+	case s.errors <- err:
+	default:
+	}
+}
@@ -0,0 +1,293 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	sessionpkg "streamlation/packages/backend/session"
+)
+
+func TestControlMessageValidate(t *testing.T) {
+	options := sessionpkg.TranslationOptions{ModelProfile: "cpu-basic"}
+	tests := map[string]struct {
+		msg     ControlMessage
+		wantErr bool
+	}{
+		"cancel":                 {msg: ControlMessage{Kind: ControlCancelSession, SessionID: "abc"}},
+		"cancel missing session": {msg: ControlMessage{Kind: ControlCancelSession}, wantErr: true},
+		"update":                 {msg: ControlMessage{Kind: ControlUpdateOptions, SessionID: "abc", Options: &options}},
+		"update missing options": {msg: ControlMessage{Kind: ControlUpdateOptions, SessionID: "abc"}, wantErr: true},
+		"drain":                  {msg: ControlMessage{Kind: ControlDrainWorker}},
+		"unknown kind":           {msg: ControlMessage{Kind: "reboot"}, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			err := tt.msg.Validate()
+			if tt.wantErr && err == nil {
+				t.Fatal("expected validation error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestControlMessageAppliesTo(t *testing.T) {
+	broadcast := ControlMessage{Kind: ControlDrainWorker}
+	if !broadcast.AppliesTo("worker-1") {
+		t.Fatal("expected broadcast message to apply to every worker")
+	}
+	targeted := ControlMessage{Kind: ControlDrainWorker, WorkerID: "worker-2"}
+	if targeted.AppliesTo("worker-1") {
+		t.Fatal("expected targeted message to skip other workers")
+	}
+	if !targeted.AppliesTo("worker-2") {
+		t.Fatal("expected targeted message to apply to its worker")
+	}
+}
+
+func TestRedisControlPublisherAndSubscriber(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	ready := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		subConn, err := ln.Accept()
+		if err != nil {
+			t.Errorf("failed to accept subscriber: %v", err)
+			return
+		}
+		defer subConn.Close()
+		subReader := bufio.NewReader(subConn)
+		subWriter := bufio.NewWriter(subConn)
+
+		args, err := readCommand(subReader)
+		if err != nil || len(args) != 2 || strings.ToUpper(args[0]) != "SUBSCRIBE" || args[1] != ControlChannelName {
+			t.Errorf("unexpected subscribe command: %v (%v)", args, err)
+			return
+		}
+		fmt.Fprintf(subWriter, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(ControlChannelName), ControlChannelName)
+		if err := subWriter.Flush(); err != nil {
+			t.Errorf("failed to flush subscribe ack: %v", err)
+			return
+		}
+		close(ready)
+
+		pubConn, err := ln.Accept()
+		if err != nil {
+			t.Errorf("failed to accept publisher: %v", err)
+			return
+		}
+		defer pubConn.Close()
+		pubReader := bufio.NewReader(pubConn)
+
+		pubArgs, err := readCommand(pubReader)
+		if err != nil || len(pubArgs) != 3 || strings.ToUpper(pubArgs[0]) != "PUBLISH" {
+			t.Errorf("unexpected publish command: %v (%v)", pubArgs, err)
+			return
+		}
+		if _, err := pubConn.Write([]byte(":1\r\n")); err != nil {
+			t.Errorf("failed to write publish reply: %v", err)
+			return
+		}
+
+		payload := pubArgs[2]
+		fmt.Fprintf(subWriter, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(ControlChannelName), ControlChannelName, len(payload), payload)
+		if err := subWriter.Flush(); err != nil {
+			t.Errorf("failed to flush message: %v", err)
+		}
+	}()
+
+	subscriber, err := NewRedisControlSubscriber(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	t.Cleanup(func() { _ = subscriber.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream, err := subscriber.SubscribeControl(ctx)
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	t.Cleanup(func() { _ = stream.Close() })
+
+	<-ready
+
+	publisher, err := NewRedisControlPublisher(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	t.Cleanup(func() { _ = publisher.Close() })
+
+	if err := publisher.SendControl(context.Background(), ControlMessage{Kind: ControlCancelSession, SessionID: "abc"}); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	select {
+	case msg := <-stream.Messages():
+		if msg.Kind != ControlCancelSession || msg.SessionID != "abc" {
+			t.Fatalf("unexpected control message: %#v", msg)
+		}
+		if msg.IssuedAt.IsZero() {
+			t.Fatal("expected issued_at to be populated")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for control message")
+	}
+
+	<-done
+}
+
+// serveControlSubscription accepts a subscriber connection, acknowledges
+// its SUBSCRIBE and writes payloads as control channel messages. It runs on
+// its own goroutine, so failures are reported with t.Errorf.
+func serveControlSubscription(t *testing.T, ln net.Listener, payloads ...string) net.Conn {
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Errorf("failed to accept subscriber: %v", err)
+		return nil
+	}
+	if _, err := readCommand(bufio.NewReader(conn)); err != nil {
+		t.Errorf("failed to read subscribe command: %v", err)
+		return conn
+	}
+	fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(ControlChannelName), ControlChannelName)
+	for _, payload := range payloads {
+		fmt.Fprintf(conn, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(ControlChannelName), ControlChannelName, len(payload), payload)
+	}
+	return conn
+}
+
+func TestRedisControlStreamResubscribesAfterDisconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	subscriber, err := NewRedisControlSubscriber(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	t.Cleanup(func() { _ = subscriber.Close() })
+
+	accepted := make(chan net.Conn, 1)
+	go func() { accepted <- serveControlSubscription(t, ln) }()
+	stream, err := subscriber.SubscribeControl(context.Background())
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	t.Cleanup(func() { _ = stream.Close() })
+
+	// Dropping the connection makes the stream subscribe again.
+	first := <-accepted
+	go func() {
+		if conn := serveControlSubscription(t, ln, `{"kind":"cancel_session","session_id":"abc"}`); conn != nil {
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+	if first == nil {
+		t.FailNow()
+	}
+	_ = first.Close()
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case msg := <-stream.Messages():
+			if msg.Kind != ControlCancelSession || msg.SessionID != "abc" {
+				t.Fatalf("unexpected control message: %#v", msg)
+			}
+			return
+		case <-stream.Errors():
+		case <-deadline:
+			t.Fatal("timed out waiting for a message after resubscribing")
+		}
+	}
+}
+
+func TestRedisControlStreamCloseWithUnconsumedMessages(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	subscriber, err := NewRedisControlSubscriber(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	t.Cleanup(func() { _ = subscriber.Close() })
+
+	// More messages than the stream buffers, none of which are consumed.
+	payloads := make([]string, 32)
+	for i := range payloads {
+		payloads[i] = fmt.Sprintf(`{"kind":"cancel_session","session_id":"session-%d"}`, i)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() { accepted <- serveControlSubscription(t, ln, payloads...) }()
+	stream, err := subscriber.SubscribeControl(context.Background())
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	conn := <-accepted
+	if conn == nil {
+		t.FailNow()
+	}
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		_ = stream.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked on unconsumed messages")
+	}
+}
+
+func TestRedisControlPublisherRejectsInvalidMessage(t *testing.T) {
+	publisher, err := NewRedisControlPublisher("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error constructing publisher: %v", err)
+	}
+	t.Cleanup(func() { _ = publisher.Close() })
+
+	if err := publisher.SendControl(context.Background(), ControlMessage{Kind: ControlCancelSession}); err == nil {
+		t.Fatal("expected error for cancel without session id")
+	}
+}
+
+func TestControlMessageJSON(t *testing.T) {
+	raw := `{"kind":"update_options","session_id":"abc","options":{"enableDubbing":true,"latencyToleranceMs":100,"modelProfile":"cpu-basic"}}`
+	var msg ControlMessage
+	if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if err := msg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if !msg.Options.EnableDubbing || msg.Options.LatencyToleranceMs != 100 {
+		t.Fatalf("unexpected options: %#v", msg.Options)
+	}
+}
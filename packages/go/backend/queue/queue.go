@@ -9,13 +9,21 @@ import (
 	"strconv"
 	"time"
 
+	"streamlation/packages/backend/metrics"
 	redisclient "streamlation/packages/backend/redis"
+	sessionpkg "streamlation/packages/backend/session"
 )
 
 const IngestionQueueName = "streamlation:ingestion:sessions"
 
+// SessionSnapshotVersion is the current layout of the session snapshot
+// embedded in ingestion jobs. Workers treat snapshots carrying any other
+// version as stale and reload the session from the store.
+const SessionSnapshotVersion = 1
+
 type RedisIngestionEnqueuer struct {
-	client *redisclient.Client
+	client   *redisclient.Client
+	enqueued *metrics.Counter
 }
 
 func NewRedisIngestionEnqueuer(addr string) (*RedisIngestionEnqueuer, error) {
@@ -26,14 +34,42 @@ func NewRedisIngestionEnqueuer(addr string) (*RedisIngestionEnqueuer, error) {
 	return &RedisIngestionEnqueuer{client: client}, nil
 }
 
+// Instrument counts the jobs e enqueues, and fails to, in registry.
+func (e *RedisIngestionEnqueuer) Instrument(registry *metrics.Registry) {
+	e.enqueued = registry.NewCounter("streamlation_queue_enqueued_total", "Ingestion jobs enqueued, by outcome.", "outcome")
+}
+
 func (e *RedisIngestionEnqueuer) EnqueueIngestion(ctx context.Context, sessionID string) error {
 	payload, err := json.Marshal(map[string]string{"session_id": sessionID})
 	if err != nil {
 		return fmt.Errorf("marshal ingestion payload: %w", err)
 	}
+	return e.push(ctx, payload)
+}
+
+// EnqueueSession enqueues an ingestion job that embeds a snapshot of the
+// session so workers can start without a database round trip.
+func (e *RedisIngestionEnqueuer) EnqueueSession(ctx context.Context, session sessionpkg.TranslationSession) error {
+	if session.ID == "" {
+		return errors.New("session id required")
+	}
+	payload, err := json.Marshal(IngestionJob{
+		SessionID:       session.ID,
+		SnapshotVersion: SessionSnapshotVersion,
+		Session:         &session,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal ingestion payload: %w", err)
+	}
+	return e.push(ctx, payload)
+}
+
+func (e *RedisIngestionEnqueuer) push(ctx context.Context, payload []byte) error {
 	if _, err := e.client.Do(ctx, "LPUSH", IngestionQueueName, string(payload)); err != nil {
+		e.enqueued.Inc("error")
 		return fmt.Errorf("enqueue ingestion: %w", err)
 	}
+	e.enqueued.Inc("ok")
 	return nil
 }
 
@@ -42,11 +78,27 @@ func (e *RedisIngestionEnqueuer) Close() error {
 }
 
 type IngestionJob struct {
-	SessionID string `json:"session_id"`
+	SessionID       string                         `json:"session_id"`
+	SnapshotVersion int                            `json:"snapshot_version,omitempty"`
+	Session         *sessionpkg.TranslationSession `json:"session,omitempty"`
+
+	// payload is the job as it sits in the processing queue, which Ack and
+	// DeadLetter remove.
+	payload string
+}
+
+// Snapshot returns the embedded session when it is present, matches the
+// job's session ID, and was written with the current snapshot version.
+func (j IngestionJob) Snapshot() (sessionpkg.TranslationSession, bool) {
+	if j.Session == nil || j.Session.ID != j.SessionID || j.SnapshotVersion != SessionSnapshotVersion {
+		return sessionpkg.TranslationSession{}, false
+	}
+	return *j.Session, true
 }
 
 type RedisIngestionConsumer struct {
-	client *redisclient.Client
+	client   *redisclient.Client
+	dequeued *metrics.Counter
 }
 
 func NewRedisIngestionConsumer(addr string) (*RedisIngestionConsumer, error) {
@@ -57,7 +109,87 @@ func NewRedisIngestionConsumer(addr string) (*RedisIngestionConsumer, error) {
 	return &RedisIngestionConsumer{client: client}, nil
 }
 
+// Instrument counts the jobs c dequeues, the payloads it cannot decode, and
+// its failures to reach the queue in registry. Waits that time out are not
+// counted.
+func (c *RedisIngestionConsumer) Instrument(registry *metrics.Registry) {
+	c.dequeued = registry.NewCounter("streamlation_queue_dequeued_total", "Ingestion jobs dequeued, by outcome.", "outcome")
+}
+
+// Pop waits up to timeout for the next job and moves it to the processing
+// queue, where it stays until it is acknowledged or dead-lettered. Jobs of a
+// worker that stops before either are left there for operators to requeue.
+// Payloads that cannot be decoded are dead-lettered at once.
 func (c *RedisIngestionConsumer) Pop(ctx context.Context, timeout time.Duration) (*IngestionJob, error) {
+	payload, ok, err := blockingMove(ctx, c.client, IngestionQueueName, IngestionProcessingQueueName, timeout)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			c.dequeued.Inc("error")
+		}
+		return nil, fmt.Errorf("dequeue ingestion: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	var job IngestionJob
+	if err := json.Unmarshal([]byte(payload), &job); err != nil {
+		c.dequeued.Inc("invalid")
+		return nil, errors.Join(fmt.Errorf("decode ingestion payload: %w", err), c.deadLetter(ctx, payload))
+	}
+	if job.SessionID == "" {
+		c.dequeued.Inc("invalid")
+		return nil, errors.Join(errors.New("ingestion payload missing session_id"), c.deadLetter(ctx, payload))
+	}
+	job.payload = payload
+	c.dequeued.Inc("ok")
+	return &job, nil
+}
+
+// Ack removes a job that has been handled from the processing queue.
+func (c *RedisIngestionConsumer) Ack(ctx context.Context, job *IngestionJob) error {
+	if _, err := c.client.Do(ctx, "LREM", IngestionProcessingQueueName, "1", job.payload); err != nil {
+		return fmt.Errorf("ack ingestion job: %w", err)
+	}
+	return nil
+}
+
+// DeadLetter moves a job that failed from the processing queue to the
+// dead-letter queue.
+func (c *RedisIngestionConsumer) DeadLetter(ctx context.Context, job *IngestionJob) error {
+	return c.deadLetter(ctx, job.payload)
+}
+
+// deadLetter pushes payload to the dead-letter queue before removing it
+// from the processing queue, so that a failure in between leaves it in
+// both rather than in neither.
+func (c *RedisIngestionConsumer) deadLetter(ctx context.Context, payload string) error {
+	if _, err := c.client.Do(ctx, "LPUSH", IngestionDeadLetterQueueName, payload); err != nil {
+		return fmt.Errorf("dead-letter ingestion job: %w", err)
+	}
+	if _, err := c.client.Do(ctx, "LREM", IngestionProcessingQueueName, "1", payload); err != nil {
+		return fmt.Errorf("dead-letter ingestion job: %w", err)
+	}
+	return nil
+}
+
+// blockingMove waits up to timeout for a payload on from and moves it to
+// to, where it is the newest. It reports ok=false when the wait elapsed
+// without a payload.
+func blockingMove(ctx context.Context, client *redisclient.Client, from, to string, timeout time.Duration) (string, bool, error) {
+	reply, ok, err := blockingDo(ctx, client, timeout, "BLMOVE", from, to, "RIGHT", "LEFT")
+	if err != nil || !ok {
+		return "", false, err
+	}
+	if reply.Type != '$' {
+		return "", false, fmt.Errorf("unexpected BLMOVE reply: %#v", reply)
+	}
+	return reply.Text, true, nil
+}
+
+// blockingDo runs a blocking command with args followed by its timeout in
+// seconds. It reports ok=false when the wait elapsed without a reply.
+func blockingDo(ctx context.Context, client *redisclient.Client, timeout time.Duration, args ...string) (redisclient.Reply, bool, error) {
 	ctxWithDeadline, cancel := ensureTimeout(ctx, timeout)
 	defer cancel()
 
@@ -71,50 +203,34 @@ func (c *RedisIngestionConsumer) Pop(ctx context.Context, timeout time.Duration)
 
 	waitIndefinitely := timeout <= 0
 
-	reply, err := c.client.Do(ctxWithDeadline, "BRPOP", IngestionQueueName, strconv.Itoa(seconds))
+	reply, err := client.Do(ctxWithDeadline, append(args, strconv.Itoa(seconds))...)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
 			if ctx.Err() != nil {
-				return nil, ctx.Err()
+				return redisclient.Reply{}, false, ctx.Err()
 			}
 			if waitIndefinitely {
-				return nil, nil
+				return redisclient.Reply{}, false, nil
 			}
-			return nil, fmt.Errorf("dequeue ingestion: %w", err)
+			return redisclient.Reply{}, false, err
 		}
 		var netErr net.Error
 		if errors.As(err, &netErr) && netErr.Timeout() {
 			if ctx.Err() != nil {
-				return nil, ctx.Err()
+				return redisclient.Reply{}, false, ctx.Err()
 			}
 			if waitIndefinitely {
-				return nil, nil
+				return redisclient.Reply{}, false, nil
 			}
-			return nil, fmt.Errorf("dequeue ingestion: %w", err)
+			return redisclient.Reply{}, false, err
 		}
-		return nil, fmt.Errorf("dequeue ingestion: %w", err)
+		return redisclient.Reply{}, false, err
 	}
 
 	if reply.IsNil {
-		return nil, nil
-	}
-	if reply.Type != '*' || len(reply.Array) != 2 {
-		return nil, fmt.Errorf("unexpected BRPOP reply: %#v", reply)
-	}
-
-	payload := reply.Array[1]
-	if payload.IsNil {
-		return nil, nil
-	}
-
-	var job IngestionJob
-	if err := json.Unmarshal([]byte(payload.Text), &job); err != nil {
-		return nil, fmt.Errorf("decode ingestion payload: %w", err)
+		return redisclient.Reply{}, false, nil
 	}
-	if job.SessionID == "" {
-		return nil, fmt.Errorf("ingestion payload missing session_id")
-	}
-	return &job, nil
+	return reply, true, nil
 }
 
 func (c *RedisIngestionConsumer) Close() error {
@@ -6,10 +6,16 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"streamlation/packages/backend/metrics"
+	sessionpkg "streamlation/packages/backend/session"
 )
 
 func TestRedisIngestionEnqueuer_ReusesConnection(t *testing.T) {
@@ -102,17 +108,17 @@ func TestRedisIngestionConsumer_Pop(t *testing.T) {
 		reader := bufio.NewReader(conn)
 		writer := bufio.NewWriter(conn)
 
-		// First BRPOP returns payload.
+		// First BLMOVE returns payload.
 		args, err := readCommand(reader)
 		if err != nil {
 			t.Errorf("failed to read command: %v", err)
 			return
 		}
-		if len(args) == 0 || args[0] != "BRPOP" {
+		if len(args) < 5 || args[0] != "BLMOVE" || args[1] != IngestionQueueName || args[2] != IngestionProcessingQueueName {
 			t.Errorf("unexpected first command: %v", args)
 			return
 		}
-		response := fmt.Sprintf("*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(IngestionQueueName), IngestionQueueName, len(payload), payload)
+		response := fmt.Sprintf("$%d\r\n%s\r\n", len(payload), payload)
 		if _, err := writer.WriteString(response); err != nil {
 			t.Errorf("failed to write response: %v", err)
 			return
@@ -122,17 +128,17 @@ func TestRedisIngestionConsumer_Pop(t *testing.T) {
 			return
 		}
 
-		// Second BRPOP returns nil (timeout).
+		// Second BLMOVE returns nil (timeout).
 		args, err = readCommand(reader)
 		if err != nil {
 			t.Errorf("failed to read second command: %v", err)
 			return
 		}
-		if len(args) == 0 || args[0] != "BRPOP" {
+		if len(args) == 0 || args[0] != "BLMOVE" {
 			t.Errorf("unexpected second command: %v", args)
 			return
 		}
-		if _, err := writer.WriteString("*-1\r\n"); err != nil {
+		if _, err := writer.WriteString("$-1\r\n"); err != nil {
 			t.Errorf("failed to write nil response: %v", err)
 			return
 		}
@@ -174,6 +180,169 @@ func TestRedisIngestionConsumer_Pop(t *testing.T) {
 	<-done
 }
 
+func TestRedisIngestionEnqueuer_EnqueueSessionEmbedsSnapshot(t *testing.T) {
+	addr := startListServer(t)
+
+	enqueuer, err := NewRedisIngestionEnqueuer(addr)
+	if err != nil {
+		t.Fatalf("failed to create enqueuer: %v", err)
+	}
+	t.Cleanup(func() { _ = enqueuer.Close() })
+
+	consumer, err := NewRedisIngestionConsumer(addr)
+	if err != nil {
+		t.Fatalf("failed to create consumer: %v", err)
+	}
+	t.Cleanup(func() { _ = consumer.Close() })
+
+	session := sessionpkg.TranslationSession{
+		ID:             "snap-1",
+		Source:         sessionpkg.TranslationSource{Type: "hls", URI: "https://example.com/live.m3u8"},
+		TargetLanguage: "fr",
+		Options:        sessionpkg.TranslationOptions{ModelProfile: "cpu-basic"},
+	}
+	if err := enqueuer.EnqueueSession(context.Background(), session); err != nil {
+		t.Fatalf("enqueue returned error: %v", err)
+	}
+
+	job, err := consumer.Pop(context.Background(), time.Second)
+	if err != nil || job == nil {
+		t.Fatalf("pop: %v %v", job, err)
+	}
+	snapshot, ok := job.Snapshot()
+	if !ok {
+		t.Fatalf("expected fresh snapshot in job %#v", job)
+	}
+	if !reflect.DeepEqual(snapshot, session) {
+		t.Fatalf("snapshot mismatch: got %#v want %#v", snapshot, session)
+	}
+}
+
+func TestRedisIngestionQueueInstrumented(t *testing.T) {
+	addr := startListServer(t)
+	registry := metrics.NewRegistry()
+
+	enqueuer, err := NewRedisIngestionEnqueuer(addr)
+	if err != nil {
+		t.Fatalf("failed to create enqueuer: %v", err)
+	}
+	t.Cleanup(func() { _ = enqueuer.Close() })
+	enqueuer.Instrument(registry)
+
+	consumer, err := NewRedisIngestionConsumer(addr)
+	if err != nil {
+		t.Fatalf("failed to create consumer: %v", err)
+	}
+	t.Cleanup(func() { _ = consumer.Close() })
+	consumer.Instrument(registry)
+
+	if err := enqueuer.EnqueueIngestion(context.Background(), "abc"); err != nil {
+		t.Fatalf("enqueue returned error: %v", err)
+	}
+	if job, err := consumer.Pop(context.Background(), time.Second); err != nil || job == nil {
+		t.Fatalf("pop: %v %v", job, err)
+	}
+
+	var b strings.Builder
+	if err := registry.WriteMetrics(&b); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	if !strings.Contains(b.String(), `streamlation_queue_enqueued_total{outcome="ok"} 1`) ||
+		!strings.Contains(b.String(), `streamlation_queue_dequeued_total{outcome="ok"} 1`) {
+		t.Fatalf("unexpected metrics:\n%s", b.String())
+	}
+}
+
+func TestRedisIngestionConsumerSettlesJobs(t *testing.T) {
+	addr := startListServer(t)
+	ctx := context.Background()
+
+	enqueuer, err := NewRedisIngestionEnqueuer(addr)
+	if err != nil {
+		t.Fatalf("failed to create enqueuer: %v", err)
+	}
+	t.Cleanup(func() { _ = enqueuer.Close() })
+	consumer, err := NewRedisIngestionConsumer(addr)
+	if err != nil {
+		t.Fatalf("failed to create consumer: %v", err)
+	}
+	t.Cleanup(func() { _ = consumer.Close() })
+	admin, err := NewRedisQueueAdmin(addr)
+	if err != nil {
+		t.Fatalf("failed to create admin: %v", err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+	counts := func() [3]int {
+		t.Helper()
+		var counts [3]int
+		for i, queueName := range []string{IngestionQueueName, IngestionProcessingQueueName, IngestionDeadLetterQueueName} {
+			if counts[i], err = admin.Count(ctx, queueName); err != nil {
+				t.Fatalf("count %s: %v", queueName, err)
+			}
+		}
+		return counts
+	}
+
+	for _, id := range []string{"done", "failed"} {
+		if err := enqueuer.EnqueueIngestion(ctx, id); err != nil {
+			t.Fatalf("enqueue %s: %v", id, err)
+		}
+	}
+	if _, err := enqueuer.client.Do(ctx, "LPUSH", IngestionQueueName, "not json"); err != nil {
+		t.Fatalf("push invalid payload: %v", err)
+	}
+
+	done, err := consumer.Pop(ctx, time.Second)
+	if err != nil || done == nil || done.SessionID != "done" {
+		t.Fatalf("pop: %v %v", done, err)
+	}
+	failed, err := consumer.Pop(ctx, time.Second)
+	if err != nil || failed == nil || failed.SessionID != "failed" {
+		t.Fatalf("pop: %v %v", failed, err)
+	}
+	if got := counts(); got != [3]int{1, 2, 0} {
+		t.Fatalf("expected popped jobs in the processing queue, got %v", got)
+	}
+
+	if err := consumer.Ack(ctx, done); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if err := consumer.DeadLetter(ctx, failed); err != nil {
+		t.Fatalf("dead-letter: %v", err)
+	}
+	if _, err := consumer.Pop(ctx, time.Second); err == nil {
+		t.Fatal("expected an invalid payload to be rejected")
+	}
+	if got := counts(); got != [3]int{0, 0, 2} {
+		t.Fatalf("expected the failed job and the invalid payload dead-lettered, got %v", got)
+	}
+	dead, err := admin.Peek(ctx, IngestionDeadLetterQueueName, 10)
+	if err != nil || len(dead) != 2 || dead[0] != `{"session_id":"failed"}` || dead[1] != "not json" {
+		t.Fatalf("unexpected dead-letter queue: %v (%v)", dead, err)
+	}
+}
+
+func TestIngestionJobSnapshotStaleness(t *testing.T) {
+	session := &sessionpkg.TranslationSession{ID: "abc"}
+	tests := map[string]struct {
+		job  IngestionJob
+		want bool
+	}{
+		"legacy id-only payload": {job: IngestionJob{SessionID: "abc"}},
+		"older snapshot version": {job: IngestionJob{SessionID: "abc", SnapshotVersion: SessionSnapshotVersion - 1, Session: session}},
+		"mismatched session id":  {job: IngestionJob{SessionID: "other", SnapshotVersion: SessionSnapshotVersion, Session: session}},
+		"current snapshot":       {job: IngestionJob{SessionID: "abc", SnapshotVersion: SessionSnapshotVersion, Session: session}, want: true},
+	}
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			if _, ok := tt.job.Snapshot(); ok != tt.want {
+				t.Fatalf("Snapshot() ok = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
 func readCommand(r *bufio.Reader) ([]string, error) {
 	prefix, err := r.ReadByte()
 	if err != nil {
@@ -215,3 +384,114 @@ func readCommand(r *bufio.Reader) ([]string, error) {
 	}
 	return args, nil
 }
+
+// startListServer runs a minimal Redis stand-in supporting the list commands
+// used by this package against in-memory lists. BLMOVE never blocks.
+func startListServer(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var mu sync.Mutex
+	lists := make(map[string][]string)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				writer := bufio.NewWriter(conn)
+				for {
+					args, err := readCommand(reader)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					switch strings.ToUpper(args[0]) {
+					case "LPUSH":
+						lists[args[1]] = append([]string{args[2]}, lists[args[1]]...)
+						fmt.Fprintf(writer, ":%d\r\n", len(lists[args[1]]))
+					case "BLMOVE":
+						items := lists[args[1]]
+						if len(items) == 0 {
+							writer.WriteString("$-1\r\n")
+							break
+						}
+						value := items[len(items)-1]
+						lists[args[1]] = items[:len(items)-1]
+						lists[args[2]] = append([]string{value}, lists[args[2]]...)
+						fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(value), value)
+					case "LREM":
+						items := lists[args[1]]
+						removed := 0
+						if index := slices.Index(items, args[3]); index >= 0 {
+							lists[args[1]] = slices.Delete(items, index, index+1)
+							removed = 1
+						}
+						fmt.Fprintf(writer, ":%d\r\n", removed)
+					case "LLEN":
+						fmt.Fprintf(writer, ":%d\r\n", len(lists[args[1]]))
+					case "LRANGE":
+						items := lists[args[1]]
+						start, _ := strconv.Atoi(args[2])
+						stop, _ := strconv.Atoi(args[3])
+						if start < 0 {
+							start += len(items)
+						}
+						if stop < 0 {
+							stop += len(items)
+						}
+						if start < 0 {
+							start = 0
+						}
+						if stop >= len(items) {
+							stop = len(items) - 1
+						}
+						if start > stop {
+							writer.WriteString("*0\r\n")
+							break
+						}
+						fmt.Fprintf(writer, "*%d\r\n", stop-start+1)
+						for _, item := range items[start : stop+1] {
+							fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(item), item)
+						}
+					case "DEL":
+						_, existed := lists[args[1]]
+						delete(lists, args[1])
+						if existed {
+							writer.WriteString(":1\r\n")
+						} else {
+							writer.WriteString(":0\r\n")
+						}
+					case "RPOPLPUSH":
+						items := lists[args[1]]
+						if len(items) == 0 {
+							writer.WriteString("$-1\r\n")
+							break
+						}
+						value := items[len(items)-1]
+						lists[args[1]] = items[:len(items)-1]
+						lists[args[2]] = append([]string{value}, lists[args[2]]...)
+						fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(value), value)
+					default:
+						writer.WriteString("-ERR unknown command\r\n")
+					}
+					mu.Unlock()
+					if err := writer.Flush(); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return ln.Addr().String()
+}
@@ -86,6 +86,16 @@ func (c *Client) Close() error {
 }
 
 func (c *Client) Subscribe(ctx context.Context, channel string) (*PubSub, error) {
+	return c.subscribe(ctx, "SUBSCRIBE", channel)
+}
+
+// PSubscribe subscribes to every channel matching a glob-style pattern.
+// Messages carry the concrete channel they were published on.
+func (c *Client) PSubscribe(ctx context.Context, pattern string) (*PubSub, error) {
+	return c.subscribe(ctx, "PSUBSCRIBE", pattern)
+}
+
+func (c *Client) subscribe(ctx context.Context, command, channel string) (*PubSub, error) {
 	resolved, err := resolveAddr(c.addr)
 	if err != nil {
 		return nil, err
@@ -105,7 +115,7 @@ func (c *Client) Subscribe(ctx context.Context, channel string) (*PubSub, error)
 		return nil, err
 	}
 
-	if err := writeCommand(writer, []string{"SUBSCRIBE", channel}); err != nil {
+	if err := writeCommand(writer, []string{command, channel}); err != nil {
 		_ = conn.Close()
 		return nil, err
 	}
@@ -123,7 +133,7 @@ func (c *Client) Subscribe(ctx context.Context, channel string) (*PubSub, error)
 		_ = conn.Close()
 		return nil, fmt.Errorf("redis error: %s", reply.Text)
 	}
-	if reply.Type != '*' || len(reply.Array) < 3 || !strings.EqualFold(reply.Array[0].Text, "subscribe") {
+	if reply.Type != '*' || len(reply.Array) < 3 || !strings.EqualFold(reply.Array[0].Text, command) {
 		_ = conn.Close()
 		return nil, fmt.Errorf("unexpected subscribe reply: %#v", reply)
 	}
@@ -249,6 +259,14 @@ func (ps *PubSub) run(ctx context.Context) {
 		switch kind {
 		case "message", "pmessage":
 			payload := reply.Array[2].Text
+			if kind == "pmessage" {
+				// pmessage replies are [pmessage, pattern, channel, payload].
+				if len(reply.Array) < 4 {
+					continue
+				}
+				channel = reply.Array[2].Text
+				payload = reply.Array[3].Text
+			}
 			msg := Message{Kind: kind, Channel: channel, Payload: payload}
 			select {
 			case ps.messages <- msg:
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AudioTrackSelection picks the audio track to transcribe from sources that
+// carry several, such as HLS renditions or DASH adaptation sets in
+// different languages, or media files with several audio streams.
+type AudioTrackSelection struct {
+	// Language selects the first track in this ISO 639-1 language.
+	Language string `json:"language,omitempty"`
+	// Index selects the track at this zero-based position among the
+	// source's audio tracks when Language is not set.
+	Index int `json:"index,omitempty"`
+}
+
+// Select returns the position of the selected track among tracks whose
+// language tags are given in order, with an empty tag for a track of
+// unknown language. It fails when no track matches, rather than letting a
+// session transcribe a language it did not ask for.
+func (s AudioTrackSelection) Select(languages []string) (int, error) {
+	if s.Language == "" {
+		if s.Index < 0 || s.Index >= len(languages) {
+			return 0, fmt.Errorf("audio track %d selected but the source has %d", s.Index, len(languages))
+		}
+		return s.Index, nil
+	}
+	for i, tag := range languages {
+		if languageMatches(tag, s.Language) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no audio track in language %q among %q", s.Language, languages)
+}
+
+// languageMatches reports whether tag, the language of a track as a BCP 47
+// tag such as "en-US" or an ISO 639-2 code such as "eng", names the ISO
+// 639-1 language.
+func languageMatches(tag, language string) bool {
+	primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	primary, _, _ = strings.Cut(primary, "_")
+	if primary == language {
+		return true
+	}
+	return iso6392[primary] == language
+}
+
+// iso6392 maps the ISO 639-2 codes of common languages, in both their
+// terminology and bibliographic forms, to ISO 639-1.
+var iso6392 = map[string]string{
+	"ara": "ar", "ben": "bn", "bul": "bg", "ces": "cs", "cze": "cs",
+	"chi": "zh", "zho": "zh", "dan": "da", "deu": "de", "ger": "de",
+	"ell": "el", "gre": "el", "eng": "en", "est": "et", "fas": "fa",
+	"per": "fa", "fin": "fi", "fra": "fr", "fre": "fr", "heb": "he",
+	"hin": "hi", "hrv": "hr", "hun": "hu", "ind": "id", "ita": "it",
+	"jpn": "ja", "kor": "ko", "lav": "lv", "lit": "lt", "msa": "ms",
+	"may": "ms", "nld": "nl", "dut": "nl", "nor": "no", "pol": "pl",
+	"por": "pt", "ron": "ro", "rum": "ro", "rus": "ru", "slk": "sk",
+	"slo": "sk", "slv": "sl", "spa": "es", "srp": "sr", "swe": "sv",
+	"tha": "th", "tur": "tr", "ukr": "uk", "urd": "ur", "vie": "vi",
+}
@@ -0,0 +1,32 @@
+package session
+
+import "testing"
+
+func TestAudioTrackSelectionSelect(t *testing.T) {
+	tracks := []string{"", "en-US", "fre", "de"}
+	for _, tc := range []struct {
+		selection AudioTrackSelection
+		want      int
+	}{
+		{selection: AudioTrackSelection{}, want: 0},
+		{selection: AudioTrackSelection{Index: 3}, want: 3},
+		{selection: AudioTrackSelection{Language: "en"}, want: 1},
+		{selection: AudioTrackSelection{Language: "fr"}, want: 2},
+		// Language takes precedence over Index.
+		{selection: AudioTrackSelection{Language: "de", Index: 1}, want: 3},
+	} {
+		got, err := tc.selection.Select(tracks)
+		if err != nil {
+			t.Fatalf("select %+v: %v", tc.selection, err)
+		}
+		if got != tc.want {
+			t.Fatalf("select %+v = %d, want %d", tc.selection, got, tc.want)
+		}
+	}
+
+	for _, selection := range []AudioTrackSelection{{Index: 4}, {Index: -1}, {Language: "es"}} {
+		if _, err := selection.Select(tracks); err == nil {
+			t.Fatalf("expected %+v to match no track", selection)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CredentialsKeySize is the size of the AES-256 key that seals source
+// credentials.
+const CredentialsKeySize = 32
+
+// SourceAuth holds the credentials that requests for a protected source
+// carry.
+type SourceAuth struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Cookies map[string]string `json:"cookies,omitempty"`
+	// Query holds signed query parameters, such as CDN tokens, added to
+	// every request.
+	Query map[string]string `json:"query,omitempty"`
+	// ExpiresAt is when the credentials stop being accepted, if known.
+	ExpiresAt time.Time `json:"expiresAt"`
+	// RefreshURL, when set, is called for fresh credentials before they
+	// expire or once the source rejects them. It must answer with a
+	// SourceAuth document.
+	RefreshURL string `json:"refreshUrl,omitempty"`
+	// Hosts lists further hosts, such as the CDN serving a playlist's
+	// segments, whose requests also carry the credentials. Requests for
+	// any other host than the source's carry none.
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// ParseCredentialsKey decodes a base64 encoded credentials key.
+func ParseCredentialsKey(raw string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode credentials key: %w", err)
+	}
+	if len(key) != CredentialsKeySize {
+		return nil, fmt.Errorf("credentials key is %d bytes, want %d", len(key), CredentialsKeySize)
+	}
+	return key, nil
+}
+
+// SealSourceAuth encrypts auth under key so it can be stored with a session
+// as TranslationSource.Credentials.
+func SealSourceAuth(key []byte, auth SourceAuth) (string, error) {
+	aead, err := newCredentialsAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := json.Marshal(auth)
+	if err != nil {
+		return "", fmt.Errorf("encode source credentials: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// OpenSourceAuth decrypts credentials sealed by SealSourceAuth.
+func OpenSourceAuth(key []byte, sealed string) (SourceAuth, error) {
+	aead, err := newCredentialsAEAD(key)
+	if err != nil {
+		return SourceAuth{}, err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return SourceAuth{}, fmt.Errorf("decode source credentials: %w", err)
+	}
+	if len(data) < aead.NonceSize() {
+		return SourceAuth{}, errors.New("source credentials are truncated")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return SourceAuth{}, fmt.Errorf("decrypt source credentials: %w", err)
+	}
+	var auth SourceAuth
+	if err := json.Unmarshal(plaintext, &auth); err != nil {
+		return SourceAuth{}, fmt.Errorf("decode source credentials: %w", err)
+	}
+	return auth, nil
+}
+
+func newCredentialsAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != CredentialsKeySize {
+		return nil, fmt.Errorf("credentials key is %d bytes, want %d", len(key), CredentialsKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("new cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,49 @@
+package session
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestSealSourceAuthRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, CredentialsKeySize)
+	auth := SourceAuth{
+		Headers:    map[string]string{"Authorization": "Bearer secret"},
+		Cookies:    map[string]string{"CloudFront-Policy": "policy"},
+		Query:      map[string]string{"token": "signed"},
+		RefreshURL: "https://auth.example.com/refresh",
+	}
+
+	sealed, err := SealSourceAuth(key, auth)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if strings.Contains(sealed, "secret") {
+		t.Fatal("sealed credentials contain the plaintext")
+	}
+	opened, err := OpenSourceAuth(key, sealed)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if opened.Headers["Authorization"] != "Bearer secret" || opened.Cookies["CloudFront-Policy"] != "policy" || opened.Query["token"] != "signed" || opened.RefreshURL != auth.RefreshURL {
+		t.Fatalf("unexpected credentials %+v", opened)
+	}
+
+	if _, err := OpenSourceAuth(bytes.Repeat([]byte{8}, CredentialsKeySize), sealed); err == nil {
+		t.Fatal("expected a different key to be rejected")
+	}
+}
+
+func TestParseCredentialsKey(t *testing.T) {
+	raw := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, CredentialsKeySize))
+	if key, err := ParseCredentialsKey(raw); err != nil || len(key) != CredentialsKeySize {
+		t.Fatalf("ParseCredentialsKey = %v, %v", key, err)
+	}
+	for _, raw := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := ParseCredentialsKey(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
@@ -12,6 +12,58 @@ type TranslationSession struct {
 type TranslationSource struct {
 	Type string `json:"type"`
 	URI  string `json:"uri"`
+	// Credentials holds the sealed SourceAuth of a protected source; see
+	// SealSourceAuth.
+	Credentials string `json:"credentials,omitempty"`
+	// BackupURIs name redundant copies of the source, of the same type, that
+	// ingestion fails over to in order when the current one stops working.
+	BackupURIs []string `json:"backupUris,omitempty"`
+}
+
+// MaxBackupURIs bounds the backup URIs of one session's source.
+const MaxBackupURIs = 4
+
+// MaxAdditionalLanguages bounds the translation branches of one session.
+const MaxAdditionalLanguages = 8
+
+// MaxVocabularyTerms bounds the vocabulary of one session, and
+// MaxVocabularyTermLength the length of each of its terms in characters.
+const (
+	MaxVocabularyTerms      = 100
+	MaxVocabularyTermLength = 100
+)
+
+// MaxGlossaryTerms bounds the term translations of one session's glossary,
+// and its do-not-translate terms, and MaxGlossaryTermLength the length of
+// each term in characters.
+const (
+	MaxGlossaryTerms      = 200
+	MaxGlossaryTermLength = 100
+)
+
+// MaxVoiceIDLength bounds TranslationOptions.VoiceID and
+// MaxVoiceStyleLength TranslationOptions.VoiceStyle, in characters.
+const (
+	MaxVoiceIDLength    = 128
+	MaxVoiceStyleLength = 64
+)
+
+// Glossary fixes how a session translates terms, such as brand and product
+// names.
+type Glossary struct {
+	// Terms lists source terms with the translation each must get.
+	Terms []GlossaryTerm `json:"terms,omitempty"`
+	// DoNotTranslate lists terms kept as they are in every target language.
+	DoNotTranslate []string `json:"doNotTranslate,omitempty"`
+}
+
+// GlossaryTerm is the translation a source term must get.
+type GlossaryTerm struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Language restricts the term to one target language, as an ISO 639-1
+	// code. Empty applies it to every target language.
+	Language string `json:"language,omitempty"`
 }
 
 // TranslationOptions contains tuning values for a session.
@@ -19,4 +71,71 @@ type TranslationOptions struct {
 	EnableDubbing      bool   `json:"enableDubbing"`
 	LatencyToleranceMs int    `json:"latencyToleranceMs"`
 	ModelProfile       string `json:"modelProfile"`
+	// Stages names the implementation to use for individual pipeline
+	// stages, keyed by stage. Stages that are not listed use the worker's
+	// defaults.
+	Stages map[string]string `json:"stages,omitempty"`
+	// AdditionalLanguages lists further target languages to translate the
+	// session into alongside TargetLanguage, sharing a single transcription.
+	AdditionalLanguages []string `json:"additionalLanguages,omitempty"`
+	// AudioTrack selects the audio track to transcribe from sources that
+	// carry several. Without it, sources use their default track.
+	AudioTrack *AudioTrackSelection `json:"audioTrack,omitempty"`
+	// SourceLanguage is the spoken language as an ISO 639-1 code, or
+	// AutoSourceLanguage to have it identified from the first transcripts.
+	// Empty leaves the language to the recognizer's configuration.
+	SourceLanguage string `json:"sourceLanguage,omitempty"`
+	// Vocabulary lists names and terms the stream is likely to contain,
+	// which recognizers that support biasing favour.
+	Vocabulary []string `json:"vocabulary,omitempty"`
+	// Glossary fixes the translations of terms in the translation stage.
+	Glossary *Glossary `json:"glossary,omitempty"`
+	// Formality is the register translations address the audience in:
+	// FormalityFormal, FormalityInformal, or empty for the translator's
+	// default.
+	Formality string `json:"formality,omitempty"`
+	// VoiceID is the synthesizer voice dubbing speaks in, in every language
+	// the synthesizer offers it for. Other languages, and sessions without
+	// it, speak in the voice of each language that best matches VoiceGender
+	// and VoiceStyle, or in the language's default voice.
+	VoiceID string `json:"voiceId,omitempty"`
+	// VoiceGender prefers voices of a gender: VoiceGenderFemale,
+	// VoiceGenderMale, or VoiceGenderNeutral.
+	VoiceGender string `json:"voiceGender,omitempty"`
+	// VoiceStyle prefers voices whose style or name mentions it, such as
+	// "narration".
+	VoiceStyle string `json:"voiceStyle,omitempty"`
+}
+
+// Genders of TranslationOptions.VoiceGender.
+const (
+	VoiceGenderFemale  = "female"
+	VoiceGenderMale    = "male"
+	VoiceGenderNeutral = "neutral"
+)
+
+// Registers of TranslationOptions.Formality.
+const (
+	FormalityDefault  = "default"
+	FormalityFormal   = "formal"
+	FormalityInformal = "informal"
+)
+
+// AutoSourceLanguage asks for the spoken language of a session to be
+// identified while it runs.
+const AutoSourceLanguage = "auto"
+
+// TargetLanguages returns the session's target language followed by its
+// additional languages, without duplicates.
+func (s TranslationSession) TargetLanguages() []string {
+	languages := make([]string, 0, 1+len(s.Options.AdditionalLanguages))
+	seen := make(map[string]bool, cap(languages))
+	for _, language := range append([]string{s.TargetLanguage}, s.Options.AdditionalLanguages...) {
+		if language == "" || seen[language] {
+			continue
+		}
+		seen[language] = true
+		languages = append(languages, language)
+	}
+	return languages
 }
@@ -0,0 +1,95 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Status transport backends selectable through BackendConfig.
+const (
+	BackendRedis = "redis"
+	BackendNATS  = "nats"
+	BackendKafka = "kafka"
+)
+
+// BackendConfig selects and addresses the status event transport.
+type BackendConfig struct {
+	// Backend is one of BackendRedis, BackendNATS, or BackendKafka. Empty
+	// selects Redis.
+	Backend   string
+	RedisAddr string
+	NATSURL   string
+}
+
+// PublisherBackend is a Publisher that owns a connection.
+type PublisherBackend interface {
+	Publisher
+	Close() error
+}
+
+// SubscriberBackend delivers status streams for individual sessions.
+type SubscriberBackend interface {
+	Subscribe(ctx context.Context, sessionID string) (StatusStream, error)
+	SubscribeFrom(ctx context.Context, sessionID string, replay Replay, filter Filter) (StatusStream, error)
+	SubscribeAll(ctx context.Context, filter Filter) (StatusStream, error)
+	Close() error
+}
+
+// NewPublisher constructs the publisher for the configured backend.
+func NewPublisher(cfg BackendConfig) (PublisherBackend, error) {
+	switch backend, err := cfg.backend(); {
+	case err != nil:
+		return nil, err
+	case backend == BackendNATS:
+		publisher, err := NewNATSStatusPublisher(cfg.NATSURL)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.RedisAddr != "" {
+			// NATS has no shared counter, so sequence numbers come from Redis
+			// to stay monotonic across every publishing process.
+			sequencer, err := NewRedisSequencer(cfg.RedisAddr)
+			if err != nil {
+				_ = publisher.Close()
+				return nil, err
+			}
+			publisher.sequencer = sequencer
+		}
+		return publisher, nil
+	default:
+		return NewRedisStatusPublisher(cfg.RedisAddr)
+	}
+}
+
+// NewSubscriber constructs the subscriber for the configured backend.
+func NewSubscriber(cfg BackendConfig) (SubscriberBackend, error) {
+	switch backend, err := cfg.backend(); {
+	case err != nil:
+		return nil, err
+	case backend == BackendNATS:
+		return NewNATSStatusSubscriber(cfg.NATSURL)
+	default:
+		return NewRedisStatusSubscriber(cfg.RedisAddr)
+	}
+}
+
+func (c BackendConfig) backend() (string, error) {
+	backend := strings.ToLower(strings.TrimSpace(c.Backend))
+	switch backend {
+	case "", BackendRedis:
+		if c.RedisAddr == "" {
+			return "", fmt.Errorf("redis status backend requires an address")
+		}
+		return BackendRedis, nil
+	case BackendNATS:
+		if c.NATSURL == "" {
+			return "", fmt.Errorf("nats status backend requires a url")
+		}
+		return BackendNATS, nil
+	case BackendKafka:
+		return "", fmt.Errorf("kafka status backend is not available in this build")
+	default:
+		return "", fmt.Errorf("unknown status backend %q", c.Backend)
+	}
+}
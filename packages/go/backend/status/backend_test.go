@@ -0,0 +1,47 @@
+package status
+
+import "testing"
+
+func TestNewPublisherSelectsBackend(t *testing.T) {
+	publisher, err := NewPublisher(BackendConfig{RedisAddr: "127.0.0.1:6379"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := publisher.(*RedisStatusPublisher); !ok {
+		t.Fatalf("expected redis publisher by default, got %T", publisher)
+	}
+
+	publisher, err = NewPublisher(BackendConfig{Backend: "NATS", NATSURL: "nats://127.0.0.1:4222"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := publisher.(*NATSStatusPublisher); !ok {
+		t.Fatalf("expected nats publisher, got %T", publisher)
+	}
+}
+
+func TestNewSubscriberSelectsBackend(t *testing.T) {
+	subscriber, err := NewSubscriber(BackendConfig{Backend: "nats", NATSURL: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := subscriber.(*NATSStatusSubscriber); !ok {
+		t.Fatalf("expected nats subscriber, got %T", subscriber)
+	}
+}
+
+func TestBackendConfigRejectsInvalidSelections(t *testing.T) {
+	for name, cfg := range map[string]BackendConfig{
+		"unknown":       {Backend: "carrier-pigeon", RedisAddr: "127.0.0.1:6379"},
+		"kafka":         {Backend: "kafka"},
+		"missing redis": {Backend: "redis"},
+		"missing nats":  {Backend: "nats", RedisAddr: "127.0.0.1:6379"},
+	} {
+		if _, err := NewPublisher(cfg); err == nil {
+			t.Errorf("%s: expected publisher error", name)
+		}
+		if _, err := NewSubscriber(cfg); err == nil {
+			t.Errorf("%s: expected subscriber error", name)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package status
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrorCode classifies a failure reported on a status event so consumers can
+// alert on it without parsing Detail.
+type ErrorCode string
+
+const (
+	CodeSourceUnreachable       ErrorCode = "SOURCE_UNREACHABLE"
+	CodeSourceInvalid           ErrorCode = "SOURCE_INVALID"
+	CodeSourceFailover          ErrorCode = "SOURCE_FAILOVER"
+	CodeSourceVariantSwitch     ErrorCode = "SOURCE_VARIANT_SWITCHED"
+	CodeSessionNotFound         ErrorCode = "SESSION_NOT_FOUND"
+	CodeSessionLoadFailed       ErrorCode = "SESSION_LOAD_FAILED"
+	CodeEnqueueFailed           ErrorCode = "ENQUEUE_FAILED"
+	CodeNormalizationFailed     ErrorCode = "MEDIA_NORMALIZATION_FAILED"
+	CodeASRModelLoadFailed      ErrorCode = "ASR_MODEL_LOAD_FAILED"
+	CodeASRFailed               ErrorCode = "ASR_RECOGNITION_FAILED"
+	CodeTranslationFailed       ErrorCode = "TRANSLATION_FAILED"
+	CodeOutputFailed            ErrorCode = "OUTPUT_GENERATION_FAILED"
+	CodeDubbingFailed           ErrorCode = "DUBBING_FAILED"
+	CodePipelineFailed          ErrorCode = "PIPELINE_FAILED"
+	CodePipelineStalled         ErrorCode = "PIPELINE_STALLED"
+	CodeSessionCancelled        ErrorCode = "SESSION_CANCELLED"
+	CodeIngestionFailed         ErrorCode = "INGESTION_FAILED"
+	CodeStatusEventsDropped     ErrorCode = "STATUS_EVENTS_DROPPED"
+	CodeStageTimeout            ErrorCode = "STAGE_TIMEOUT"
+	CodeStageDataDropped        ErrorCode = "STAGE_DATA_DROPPED"
+	CodeCheckpointFailed        ErrorCode = "CHECKPOINT_FAILED"
+	CodeArchiveFailed           ErrorCode = "ARCHIVE_FAILED"
+	CodeCandidateFailed         ErrorCode = "CANDIDATE_FAILED"
+	CodeAudioDumpFailed         ErrorCode = "AUDIO_DUMP_FAILED"
+	CodeMediaUnsupportedCodec   ErrorCode = "MEDIA_UNSUPPORTED_CODEC"
+	CodeMediaNoAudio            ErrorCode = "MEDIA_NO_AUDIO_TRACK"
+	CodeMediaSampleRateMismatch ErrorCode = "MEDIA_SAMPLE_RATE_MISMATCH"
+	CodeMediaSilent             ErrorCode = "MEDIA_SILENT"
+)
+
+// Severity ranks how urgently an event needs attention.
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityError    Severity = "error"
+	SeverityCritical Severity = "critical"
+)
+
+// StageError lets a stage attach an error code and retry hint to the error it
+// returns, so whoever reports the failure can populate the status event. A
+// StageError marked Retryable matches ErrTransient.
+type StageError struct {
+	Code      ErrorCode
+	Retryable bool
+	Err       error
+}
+
+func (e *StageError) Error() string {
+	if e.Err == nil {
+		return string(e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StageError) Is(target error) bool {
+	return target == ErrTransient && e.Retryable
+}
+
+type stageErrorReporterKey struct{}
+
+// WithStageErrorReporter returns a context through which a streaming stage
+// started with it can report why its output ended early.
+func WithStageErrorReporter(ctx context.Context, report func(error)) context.Context {
+	return context.WithValue(ctx, stageErrorReporterKey{}, report)
+}
+
+// ReportStageError tells whoever started a streaming stage that the stage is
+// about to close its output because of err. Wrap err in a StageError with
+// Retryable set when restarting the stage may succeed. It does nothing when
+// ctx carries no reporter.
+func ReportStageError(ctx context.Context, err error) {
+	if report, ok := ctx.Value(stageErrorReporterKey{}).(func(error)); ok && err != nil {
+		report(err)
+	}
+}
+
+// WithError returns a copy of the event describing err. The code comes from
+// a StageError in err's chain when present, otherwise code is used. The
+// failure is reported as retryable when IsTransient(err). Detail defaults to
+// the error text.
+func (e SessionStatusEvent) WithError(err error, code ErrorCode) SessionStatusEvent {
+	e.Code = code
+	e.Severity = SeverityError
+	e.Retryable = IsTransient(err)
+
+	var stageErr *StageError
+	if errors.As(err, &stageErr) && stageErr.Code != "" {
+		e.Code = stageErr.Code
+	}
+	if e.Detail == "" && err != nil {
+		e.Detail = err.Error()
+	}
+	return e
+}
@@ -0,0 +1,45 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWithErrorUsesFallbackCode(t *testing.T) {
+	event := SessionStatusEvent{SessionID: "abc", Stage: "pipeline", State: "error"}.
+		WithError(errors.New("boom"), CodePipelineFailed)
+
+	if event.Code != CodePipelineFailed || event.Severity != SeverityError || event.Retryable {
+		t.Fatalf("unexpected error fields: %#v", event)
+	}
+	if event.Detail != "boom" {
+		t.Fatalf("expected detail to default to the error text, got %q", event.Detail)
+	}
+}
+
+func TestWithErrorPrefersStageError(t *testing.T) {
+	cause := &StageError{Code: CodeSourceUnreachable, Retryable: true, Err: errors.New("dial tcp: refused")}
+	event := SessionStatusEvent{Detail: "ingestion pipeline failed"}.
+		WithError(fmt.Errorf("ingest: %w", cause), CodeIngestionFailed)
+
+	if event.Code != CodeSourceUnreachable || !event.Retryable {
+		t.Fatalf("expected stage error classification, got %#v", event)
+	}
+	if event.Detail != "ingestion pipeline failed" {
+		t.Fatalf("expected existing detail to be kept, got %q", event.Detail)
+	}
+}
+
+func TestReportStageErrorReachesReporter(t *testing.T) {
+	ReportStageError(context.Background(), errors.New("ignored without a reporter"))
+
+	var reported error
+	ctx := WithStageErrorReporter(context.Background(), func(err error) { reported = err })
+	cause := errors.New("provider returned 503")
+	ReportStageError(ctx, cause)
+	if reported != cause {
+		t.Fatalf("expected %v to be reported, got %v", cause, reported)
+	}
+}
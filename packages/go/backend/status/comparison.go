@@ -0,0 +1,32 @@
+package status
+
+// ComparisonState marks periodic events comparing a candidate implementation
+// of a stage with the primary one running on the same input.
+const ComparisonState = "comparison"
+
+// Comparison carries the cumulative results of running a candidate
+// implementation of a stage alongside the primary one. Only the primary's
+// output reaches the later stages.
+type Comparison struct {
+	Primary   VariantStats `json:"primary"`
+	Candidate VariantStats `json:"candidate"`
+	// Agreement is the mean word-level similarity, between 0 and 1, of the
+	// candidate's final outputs to the primary outputs covering the same
+	// media time.
+	Agreement float64 `json:"agreement"`
+	// Compared counts the candidate outputs Agreement averages over.
+	Compared int64 `json:"compared"`
+}
+
+// VariantStats describes the final outputs of one variant of a compared
+// stage. MeanLatencyMs is how long, on average, an output took to appear
+// after the input it covers arrived.
+type VariantStats struct {
+	Outputs        int64   `json:"outputs"`
+	MeanLatencyMs  int64   `json:"meanLatencyMs"`
+	MeanConfidence float64 `json:"meanConfidence"`
+	// Dropped counts the inputs the variant missed because it fell behind.
+	Dropped int64 `json:"dropped,omitempty"`
+	// Error is set once the variant failed and stopped.
+	Error string `json:"error,omitempty"`
+}
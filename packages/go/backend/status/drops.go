@@ -0,0 +1,48 @@
+package status
+
+import (
+	"context"
+	"io"
+
+	"streamlation/packages/backend/metrics"
+)
+
+// DroppingState marks an event reporting that a stage discarded data because
+// it could not keep up. The event's Dropped field holds the count.
+const DroppingState = "dropping"
+
+// DropMetricsPublisher totals the data dropped by each stage from the status
+// events it forwards.
+type DropMetricsPublisher struct {
+	next    Publisher
+	dropped *metrics.Counter
+}
+
+// NewDropMetricsPublisher wraps next so that drop reports are totalled.
+func NewDropMetricsPublisher(next Publisher) *DropMetricsPublisher {
+	return &DropMetricsPublisher{next: next, dropped: metrics.NewCounter("streamlation_stage_dropped_total", "Items discarded by stages under backpressure.", "stage")}
+}
+
+// Publish adds the event's drops to its stage's total and forwards it.
+func (p *DropMetricsPublisher) Publish(ctx context.Context, event SessionStatusEvent) error {
+	if event.State == DroppingState && event.Dropped > 0 {
+		p.dropped.Add(float64(event.Dropped), canonicalStage(event.Stage))
+	}
+	return p.next.Publish(ctx, event)
+}
+
+// Dropped returns the number of items dropped by each stage.
+func (p *DropMetricsPublisher) Dropped() map[string]uint64 {
+	samples := p.dropped.Samples()
+	dropped := make(map[string]uint64, len(samples))
+	for _, sample := range samples {
+		dropped[sample.Values[0]] = uint64(sample.Value)
+	}
+	return dropped
+}
+
+// WriteMetrics writes the drop counters in the Prometheus text exposition
+// format.
+func (p *DropMetricsPublisher) WriteMetrics(w io.Writer) error {
+	return p.dropped.WriteMetrics(w)
+}
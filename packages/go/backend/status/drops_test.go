@@ -0,0 +1,51 @@
+package status
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDropMetricsPublisherTotalsDropsPerStage(t *testing.T) {
+	var published int
+	next := publisherFunc(func(context.Context, SessionStatusEvent) error {
+		published++
+		return nil
+	})
+	publisher := NewDropMetricsPublisher(next)
+
+	ctx := context.Background()
+	for _, event := range []SessionStatusEvent{
+		{Stage: "asr", State: "running"},
+		{Stage: "asr", State: DroppingState, Dropped: 3},
+		{Stage: "asr", State: DroppingState, Dropped: 2},
+		{Stage: "ingestion", State: DroppingState, Dropped: 7},
+	} {
+		event.SessionID = "abc"
+		if err := publisher.Publish(ctx, event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if published != 4 {
+		t.Fatalf("expected every event to be forwarded, got %d", published)
+	}
+
+	dropped := publisher.Dropped()
+	if len(dropped) != 2 || dropped["asr"] != 5 || dropped["ingestion"] != 7 {
+		t.Fatalf("unexpected drop totals: %#v", dropped)
+	}
+
+	var metrics strings.Builder
+	if err := publisher.WriteMetrics(&metrics); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	for _, line := range []string{
+		"# TYPE streamlation_stage_dropped_total counter",
+		`streamlation_stage_dropped_total{stage="asr"} 5`,
+		`streamlation_stage_dropped_total{stage="ingestion"} 7`,
+	} {
+		if !strings.Contains(metrics.String(), line) {
+			t.Fatalf("expected %q in metrics:\n%s", line, metrics.String())
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/metrics"
+)
+
+// durationIdleTTL is how long a session's stage timings are kept after its
+// last event when it never reaches a terminal state.
+const durationIdleTTL = time.Hour
+
+// StageDurationBuckets are the histogram upper bounds, in seconds, used for
+// stage durations.
+var StageDurationBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600}
+
+// StageDurationPublisher measures how long each session spends in every
+// pipeline stage. A stage ends when it reports a terminal state or when a
+// later stage starts. Each finished stage is recorded in a per-stage
+// histogram, and the final output "completed" event is published with the
+// cumulative durations of the whole run attached.
+type StageDurationPublisher struct {
+	next      Publisher
+	now       func() time.Time
+	durations *metrics.Histogram
+
+	mu       sync.Mutex
+	sessions map[string]*stageClock
+	sweptAt  time.Time
+}
+
+type stageClock struct {
+	stage     string
+	startedAt time.Time
+	seenAt    time.Time
+	durations map[string]int64
+}
+
+// NewStageDurationPublisher wraps next so that stage transitions are timed.
+func NewStageDurationPublisher(next Publisher) *StageDurationPublisher {
+	return &StageDurationPublisher{
+		next:      next,
+		now:       time.Now,
+		durations: metrics.NewHistogram("streamlation_stage_duration_seconds", "Time spent in each pipeline stage.", StageDurationBuckets, "stage"),
+		sessions:  make(map[string]*stageClock),
+	}
+}
+
+// Publish times the event and forwards it.
+func (p *StageDurationPublisher) Publish(ctx context.Context, event SessionStatusEvent) error {
+	if event.SessionID == "" {
+		return fmt.Errorf("session id required")
+	}
+	if durations := p.observe(event); durations != nil {
+		event.StageDurations = durations
+	}
+	return p.next.Publish(ctx, event)
+}
+
+// Histograms returns the duration histogram of every stage that has
+// finished at least once.
+func (p *StageDurationPublisher) Histograms() map[string]metrics.Sample {
+	samples := p.durations.Samples()
+	histograms := make(map[string]metrics.Sample, len(samples))
+	for _, sample := range samples {
+		histograms[sample.Values[0]] = sample
+	}
+	return histograms
+}
+
+// WriteMetrics writes the stage duration histograms in the Prometheus text
+// exposition format.
+func (p *StageDurationPublisher) WriteMetrics(w io.Writer) error {
+	return p.durations.WriteMetrics(w)
+}
+
+// observe updates the session's stage clock and returns the cumulative
+// durations when event completes the run.
+func (p *StageDurationPublisher) observe(event SessionStatusEvent) map[string]int64 {
+	// Stages are timed from their stage-level events; the branches of a
+	// multi-language session overlap within them.
+	if event.State == HeartbeatState || event.Language != "" {
+		return nil
+	}
+	at := event.Timestamp
+	if at.IsZero() {
+		at = p.now().UTC()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sweep(at)
+
+	stage := canonicalStage(event.Stage)
+	index := stageIndex(stage)
+	clock, ok := p.sessions[event.SessionID]
+	if index < 0 {
+		// Session and pipeline level terminal events end the run without
+		// attributing time to a stage.
+		if ok && isTerminalState(event.State) {
+			delete(p.sessions, event.SessionID)
+		}
+		return nil
+	}
+	if !ok {
+		clock = &stageClock{durations: make(map[string]int64)}
+		p.sessions[event.SessionID] = clock
+	}
+	clock.seenAt = at
+
+	if clock.stage != stage {
+		if clock.stage != "" && stageIndex(clock.stage) > index {
+			// A late update from a stage that has already been left.
+			return nil
+		}
+		if clock.stage != "" {
+			p.finish(clock, at)
+		}
+		if _, done := clock.durations[stage]; !done {
+			clock.stage = stage
+			clock.startedAt = at
+		}
+	}
+	if clock.stage == stage && isTerminalState(event.State) {
+		p.finish(clock, at)
+	}
+
+	if stage != progressStages[len(progressStages)-1] || !isTerminalState(event.State) {
+		return nil
+	}
+	delete(p.sessions, event.SessionID)
+	if event.State != "completed" {
+		return nil
+	}
+	return clock.durations
+}
+
+// finish records the running stage of clock as ending at at.
+func (p *StageDurationPublisher) finish(clock *stageClock, at time.Time) {
+	elapsed := at.Sub(clock.startedAt)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	clock.durations[clock.stage] += elapsed.Milliseconds()
+	p.durations.ObserveDuration(elapsed, clock.stage)
+	clock.stage = ""
+}
+
+// sweep forgets sessions that have been quiet for durationIdleTTL. It runs at
+// most once per TTL to keep Publish cheap.
+func (p *StageDurationPublisher) sweep(now time.Time) {
+	if now.Sub(p.sweptAt) < durationIdleTTL {
+		return
+	}
+	p.sweptAt = now
+	for id, clock := range p.sessions {
+		if now.Sub(clock.seenAt) >= durationIdleTTL {
+			delete(p.sessions, id)
+		}
+	}
+}
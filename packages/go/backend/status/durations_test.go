@@ -0,0 +1,122 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStageDurationPublisherAttachesDurationsToCompletion(t *testing.T) {
+	var published []SessionStatusEvent
+	next := publisherFunc(func(_ context.Context, event SessionStatusEvent) error {
+		published = append(published, event)
+		return nil
+	})
+	publisher := NewStageDurationPublisher(next)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	for _, event := range []SessionStatusEvent{
+		{Stage: "ingestion", State: "running", Timestamp: start},
+		{Stage: "ingestion", State: "completed", Timestamp: start.Add(2 * time.Second)},
+		{Stage: "media", State: "normalizing", Timestamp: start.Add(2 * time.Second)},
+		{Stage: "asr", State: "processing", Timestamp: start.Add(3 * time.Second)},
+		{Stage: "pipeline", State: HeartbeatState, Timestamp: start.Add(4 * time.Second)},
+		{Stage: "translation", State: "generating", Timestamp: start.Add(8 * time.Second)},
+		{Stage: "output", State: "rendering", Timestamp: start.Add(9 * time.Second)},
+		{Stage: "output", State: "completed", Timestamp: start.Add(9500 * time.Millisecond)},
+	} {
+		event.SessionID = "abc"
+		if err := publisher.Publish(ctx, event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for _, event := range published[:len(published)-1] {
+		if event.StageDurations != nil {
+			t.Fatalf("expected durations only on the final event, got %#v", event)
+		}
+	}
+	final := published[len(published)-1]
+	want := map[string]int64{
+		"ingestion":     2000,
+		"normalization": 1000,
+		"asr":           5000,
+		"translation":   1000,
+		"output":        500,
+	}
+	if len(final.StageDurations) != len(want) {
+		t.Fatalf("unexpected durations: %#v", final.StageDurations)
+	}
+	for stage, ms := range want {
+		if final.StageDurations[stage] != ms {
+			t.Fatalf("expected %s to take %dms, got %#v", stage, ms, final.StageDurations)
+		}
+	}
+
+	histograms := publisher.Histograms()
+	asr, ok := histograms["asr"]
+	if !ok || asr.Count != 1 || asr.Sum != 5 {
+		t.Fatalf("unexpected asr histogram: %#v", asr)
+	}
+	if len(publisher.sessions) != 0 {
+		t.Fatalf("expected completed session to be forgotten, got %d", len(publisher.sessions))
+	}
+}
+
+func TestStageDurationPublisherForgetsFailedSessions(t *testing.T) {
+	var published []SessionStatusEvent
+	next := publisherFunc(func(_ context.Context, event SessionStatusEvent) error {
+		published = append(published, event)
+		return nil
+	})
+	publisher := NewStageDurationPublisher(next)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	for _, event := range []SessionStatusEvent{
+		{Stage: "asr", State: "processing", Timestamp: start},
+		{Stage: "pipeline", State: "error", Timestamp: start.Add(time.Second)},
+	} {
+		event.SessionID = "abc"
+		if err := publisher.Publish(ctx, event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if published[1].StageDurations != nil {
+		t.Fatalf("expected no durations on failure, got %#v", published[1])
+	}
+	if len(publisher.sessions) != 0 {
+		t.Fatalf("expected failed session to be forgotten, got %d", len(publisher.sessions))
+	}
+}
+
+func TestStageDurationPublisherWritesPrometheusHistograms(t *testing.T) {
+	publisher := NewStageDurationPublisher(publisherFunc(func(context.Context, SessionStatusEvent) error { return nil }))
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	_ = publisher.Publish(ctx, SessionStatusEvent{SessionID: "abc", Stage: "asr", State: "processing", Timestamp: start})
+	_ = publisher.Publish(ctx, SessionStatusEvent{SessionID: "abc", Stage: "asr", State: "completed", Timestamp: start.Add(2 * time.Second)})
+
+	var buf bytes.Buffer
+	if err := publisher.WriteMetrics(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE streamlation_stage_duration_seconds histogram",
+		`streamlation_stage_duration_seconds_bucket{stage="asr",le="1"} 0`,
+		`streamlation_stage_duration_seconds_bucket{stage="asr",le="2.5"} 1`,
+		`streamlation_stage_duration_seconds_bucket{stage="asr",le="+Inf"} 1`,
+		`streamlation_stage_duration_seconds_sum{stage="asr"} 2`,
+		`streamlation_stage_duration_seconds_count{stage="asr"} 1`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Fatalf("expected %q in metrics output:\n%s", line, out)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package status
+
+import "errors"
+
+// Error classes that stages wrap their failures in, so that the pipeline
+// runner and the workers decide between retrying and giving up from the
+// error itself rather than from its message.
+var (
+	// ErrTransient marks a failure that may go away if the stage is
+	// restarted, such as a provider answering 503 or a dropped connection.
+	ErrTransient = errors.New("transient failure")
+	// ErrFatal marks a failure that retrying cannot fix, such as a missing
+	// file or a rejected request. It takes precedence over ErrTransient.
+	ErrFatal = errors.New("fatal failure")
+	// ErrSourceEnded marks the end of a session's source. A run whose source
+	// ends completes normally.
+	ErrSourceEnded = errors.New("source ended")
+)
+
+// classifiedError attaches an error class to an error without changing its
+// message.
+type classifiedError struct {
+	err   error
+	class error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.err, e.class}
+}
+
+// Transient marks err as ErrTransient. It returns nil for a nil err.
+func Transient(err error) error {
+	return classify(err, ErrTransient)
+}
+
+// Fatal marks err as ErrFatal. It returns nil for a nil err.
+func Fatal(err error) error {
+	return classify(err, ErrFatal)
+}
+
+func classify(err, class error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{err: err, class: class}
+}
+
+// IsTransient reports whether restarting whatever failed with err may
+// succeed: err is not ErrFatal and is ErrTransient, a StageError marked
+// Retryable, or an error reporting itself as Temporary.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, ErrFatal) {
+		return false
+	}
+	if errors.Is(err, ErrTransient) {
+		return true
+	}
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
@@ -0,0 +1,59 @@
+package status
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "try again" }
+func (temporaryError) Temporary() bool { return true }
+
+func TestIsTransient(t *testing.T) {
+	cause := errors.New("provider returned 503")
+	for name, tc := range map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":                {nil, false},
+		"unclassified":       {cause, false},
+		"transient":          {fmt.Errorf("translate: %w", Transient(cause)), true},
+		"fatal":              {Fatal(cause), false},
+		"fatal wins":         {Transient(Fatal(cause)), false},
+		"retryable stage":    {&StageError{Code: CodeTranslationFailed, Retryable: true, Err: cause}, true},
+		"permanent stage":    {&StageError{Code: CodeTranslationFailed, Err: cause}, false},
+		"fatal in stage":     {&StageError{Retryable: true, Err: Fatal(cause)}, false},
+		"temporary":          {fmt.Errorf("dial: %w", temporaryError{}), true},
+		"fatal temporary":    {Fatal(temporaryError{}), false},
+		"source ended":       {ErrSourceEnded, false},
+		"transient sentinel": {ErrTransient, true},
+	} {
+		if got := IsTransient(tc.err); got != tc.want {
+			t.Fatalf("%s: expected IsTransient %v, got %v", name, tc.want, got)
+		}
+	}
+}
+
+func TestClassifiedErrorsKeepMessageAndCause(t *testing.T) {
+	cause := errors.New("playlist returned 404 Not Found")
+	err := Fatal(cause)
+	if err.Error() != cause.Error() || !errors.Is(err, cause) || !errors.Is(err, ErrFatal) {
+		t.Fatalf("expected the classified error to wrap %v, got %v", cause, err)
+	}
+	if Transient(nil) != nil || Fatal(nil) != nil {
+		t.Fatal("expected nil errors to stay nil")
+	}
+}
+
+func TestWithErrorMarksTransientErrorsRetryable(t *testing.T) {
+	event := SessionStatusEvent{}.WithError(Transient(errors.New("connection reset")), CodeASRFailed)
+	if event.Code != CodeASRFailed || !event.Retryable {
+		t.Fatalf("expected a retryable ASR failure, got %#v", event)
+	}
+	event = SessionStatusEvent{}.WithError(&StageError{Code: CodeSourceUnreachable, Retryable: true, Err: Fatal(errors.New("gone"))}, CodeIngestionFailed)
+	if event.Code != CodeSourceUnreachable || event.Retryable {
+		t.Fatalf("expected a fatal cause to make the failure permanent, got %#v", event)
+	}
+}
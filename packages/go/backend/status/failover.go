@@ -0,0 +1,5 @@
+package status
+
+// FailoverState marks an event reporting that ingestion gave up on the
+// current source URI and switched to one of the session's backup URIs.
+const FailoverState = "failover"
@@ -0,0 +1,94 @@
+package status
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Filter selects which events a subscription delivers. Each non-empty
+// criterion must match; the zero Filter delivers everything. Stage names are
+// compared after resolving aliases, so "media" and "normalization" are
+// interchangeable.
+type Filter struct {
+	Stages      []string
+	States      []string
+	MinSeverity Severity
+	// Languages selects the target-language branches whose events are
+	// delivered. Events without a language describe the whole session and
+	// are always delivered.
+	Languages []string
+}
+
+var severityRank = map[Severity]int{
+	SeverityInfo:     0,
+	SeverityWarning:  1,
+	SeverityError:    2,
+	SeverityCritical: 3,
+}
+
+// ParseSeverity validates a severity name.
+func ParseSeverity(value string) (Severity, error) {
+	severity := Severity(value)
+	if _, ok := severityRank[severity]; !ok {
+		return "", fmt.Errorf("unknown severity %q", value)
+	}
+	return severity, nil
+}
+
+// Match reports whether event passes the filter.
+func (f Filter) Match(event SessionStatusEvent) bool {
+	if len(f.Stages) > 0 {
+		stage := canonicalStage(event.Stage)
+		matched := false
+		for _, want := range f.Stages {
+			if canonicalStage(want) == stage {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.States) > 0 {
+		matched := false
+		for _, want := range f.States {
+			if want == event.State {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.Languages) > 0 && event.Language != "" {
+		matched := false
+		for _, want := range f.Languages {
+			if strings.EqualFold(want, event.Language) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if f.MinSeverity != "" && severityRank[effectiveSeverity(event)] < severityRank[f.MinSeverity] {
+		return false
+	}
+	return true
+}
+
+// effectiveSeverity returns the event's severity, treating failures from
+// emitters that predate the severity field as errors and everything else as
+// informational.
+func effectiveSeverity(event SessionStatusEvent) Severity {
+	if event.Severity != "" {
+		return event.Severity
+	}
+	if isFailureState(event.State) {
+		return SeverityError
+	}
+	return SeverityInfo
+}
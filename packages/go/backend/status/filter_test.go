@@ -0,0 +1,86 @@
+package status
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		event  SessionStatusEvent
+		want   bool
+	}{
+		{"zero filter", Filter{}, SessionStatusEvent{Stage: "asr", State: "running"}, true},
+		{"stage match", Filter{Stages: []string{"asr"}}, SessionStatusEvent{Stage: "asr", State: "running"}, true},
+		{"stage mismatch", Filter{Stages: []string{"asr"}}, SessionStatusEvent{Stage: "translation", State: "running"}, false},
+		{"stage alias", Filter{Stages: []string{"normalization"}}, SessionStatusEvent{Stage: "media", State: "running"}, true},
+		{"state match", Filter{States: []string{"completed", "failed"}}, SessionStatusEvent{Stage: "asr", State: "failed"}, true},
+		{"state mismatch", Filter{States: []string{"completed"}}, SessionStatusEvent{Stage: "asr", State: "running"}, false},
+		{"severity below minimum", Filter{MinSeverity: SeverityWarning}, SessionStatusEvent{Stage: "asr", State: "running"}, false},
+		{"severity at minimum", Filter{MinSeverity: SeverityWarning}, SessionStatusEvent{Stage: "pipeline", State: StalledState, Severity: SeverityWarning}, true},
+		{"legacy failure counts as error", Filter{MinSeverity: SeverityError}, SessionStatusEvent{Stage: "asr", State: "error"}, true},
+		{"language match", Filter{Languages: []string{"es", "fr"}}, SessionStatusEvent{Stage: "translation", State: "running", Language: "ES"}, true},
+		{"language mismatch", Filter{Languages: []string{"es"}}, SessionStatusEvent{Stage: "translation", State: "running", Language: "fr"}, false},
+		{"session-wide event passes language filter", Filter{Languages: []string{"es"}}, SessionStatusEvent{Stage: "asr", State: "running"}, true},
+		{"all criteria", Filter{Stages: []string{"asr"}, States: []string{"failed"}, MinSeverity: SeverityError}, SessionStatusEvent{Stage: "translation", State: "failed", Severity: SeverityError}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.event); got != tt.want {
+				t.Fatalf("Match(%#v) = %v, want %v", tt.event, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	if got, err := ParseSeverity("warning"); err != nil || got != SeverityWarning {
+		t.Fatalf("expected warning, got %q (%v)", got, err)
+	}
+	if _, err := ParseSeverity("loud"); err == nil {
+		t.Fatal("expected error for unknown severity")
+	}
+}
+
+func TestNATSStatusSubscriberAppliesFilter(t *testing.T) {
+	addr := startNATSServer(t)
+
+	subscriber, err := NewNATSStatusSubscriber(addr)
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	t.Cleanup(func() { _ = subscriber.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	stream, err := subscriber.SubscribeFrom(ctx, "session123", Replay{}, Filter{States: []string{"completed"}})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	t.Cleanup(func() { _ = stream.Close() })
+
+	publisher, err := NewNATSStatusPublisher(addr)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	t.Cleanup(func() { _ = publisher.Close() })
+
+	for _, state := range []string{"running", "running", "completed"} {
+		if err := publisher.Publish(ctx, SessionStatusEvent{SessionID: "session123", Stage: "asr", State: state}); err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+	}
+
+	select {
+	case got := <-stream.Events():
+		if got.State != "completed" {
+			t.Fatalf("expected only the completed event, got %#v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for filtered event")
+	}
+}
@@ -0,0 +1,76 @@
+package status
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// HeartbeatState marks periodic liveness events emitted by running
+	// pipelines.
+	HeartbeatState = "heartbeat"
+	// StalledState marks a session whose pipeline stopped heartbeating.
+	StalledState = "stalled"
+)
+
+// Throughput carries cumulative work counters for a running pipeline.
+// LatencyMs is how far the most recent subtitle lagged behind the source
+// audio it was produced from.
+type Throughput struct {
+	ChunksProcessed     int64 `json:"chunksProcessed"`
+	TranscriptsProduced int64 `json:"transcriptsProduced"`
+	SubtitlesEmitted    int64 `json:"subtitlesEmitted"`
+	LatencyMs           int64 `json:"latencyMs"`
+	// ItemsDropped counts the items discarded under backpressure across all
+	// stages.
+	ItemsDropped int64 `json:"itemsDropped,omitempty"`
+	// AudioSegments counts the speech segments synthesized for dubbing.
+	AudioSegments int64 `json:"audioSegments,omitempty"`
+}
+
+// Stall describes a session that has gone quiet for longer than the
+// watchdog window.
+type Stall struct {
+	SessionID string
+	LastSeen  time.Time
+	Silence   time.Duration
+}
+
+// HeartbeatSource finds the sessions whose last heartbeat is older than a
+// cutoff, as RedisProgressStore does.
+type HeartbeatSource interface {
+	// SilentSince returns the sessions that last heartbeated before cutoff,
+	// with LastSeen set to that heartbeat. Each session is returned once
+	// until it heartbeats again.
+	SilentSince(ctx context.Context, cutoff time.Time) ([]Stall, error)
+}
+
+// Watchdog reports sessions whose pipeline stopped heartbeating for longer
+// than the configured window. It checks the last heartbeats kept by the
+// progress store rather than watching the events of a worker, so that it
+// runs apart from the workers it watches and notices one that hangs or
+// dies. Each stall is reported once; the next heartbeat re-arms it.
+type Watchdog struct {
+	source HeartbeatSource
+	window time.Duration
+	now    func() time.Time
+}
+
+// NewWatchdog returns a watchdog reporting the sessions of source that have
+// not heartbeated for window.
+func NewWatchdog(source HeartbeatSource, window time.Duration) *Watchdog {
+	return &Watchdog{source: source, window: window, now: time.Now}
+}
+
+// Check returns the sessions that have newly exceeded the silence window.
+func (w *Watchdog) Check(ctx context.Context) ([]Stall, error) {
+	now := w.now()
+	stalls, err := w.source.SilentSince(ctx, now.Add(-w.window))
+	if err != nil {
+		return nil, err
+	}
+	for i := range stalls {
+		stalls[i].Silence = now.Sub(stalls[i].LastSeen)
+	}
+	return stalls, nil
+}
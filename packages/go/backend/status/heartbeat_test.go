@@ -0,0 +1,57 @@
+package status
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchdogReportsSilentSessionsOnce(t *testing.T) {
+	store, err := NewRedisProgressStore(startKVServer(t))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	watchdog := NewWatchdog(store, 30*time.Second)
+	watchdog.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	heartbeat := func(sessionID string) {
+		t.Helper()
+		if err := store.Append(ctx, SessionStatusEvent{SessionID: sessionID, Stage: "pipeline", State: HeartbeatState, Timestamp: now}); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if err := store.Append(ctx, SessionStatusEvent{SessionID: "untracked", Stage: "asr", State: "running", Timestamp: now}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	heartbeat("abc")
+	heartbeat("done")
+	if err := store.Append(ctx, SessionStatusEvent{SessionID: "done", Stage: "output", State: "completed", Timestamp: now}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	// A heartbeat racing the end of the run leaves it unwatched.
+	heartbeat("done")
+
+	now = now.Add(20 * time.Second)
+	if stalls, err := watchdog.Check(ctx); err != nil || len(stalls) != 0 {
+		t.Fatalf("expected no stalls inside the window, got %#v, %v", stalls, err)
+	}
+
+	now = now.Add(15 * time.Second)
+	stalls, err := watchdog.Check(ctx)
+	if err != nil || len(stalls) != 1 || stalls[0].SessionID != "abc" || stalls[0].Silence != 35*time.Second {
+		t.Fatalf("unexpected stalls: %#v, %v", stalls, err)
+	}
+	if again, err := watchdog.Check(ctx); err != nil || len(again) != 0 {
+		t.Fatalf("expected stall to be reported once, got %#v, %v", again, err)
+	}
+
+	heartbeat("abc")
+	now = now.Add(time.Minute)
+	if rearmed, err := watchdog.Check(ctx); err != nil || len(rearmed) != 1 {
+		t.Fatalf("expected recovered session to be watched again, got %#v, %v", rearmed, err)
+	}
+}
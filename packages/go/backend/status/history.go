@@ -0,0 +1,53 @@
+package status
+
+import (
+	"context"
+	"fmt"
+)
+
+// Publisher emits status events to subscribers.
+type Publisher interface {
+	Publish(ctx context.Context, event SessionStatusEvent) error
+}
+
+// HistoryEntry is a persisted status event together with its position in
+// the session timeline. IDs increase monotonically and act as the cursor
+// for paginating history.
+type HistoryEntry struct {
+	ID int64 `json:"id"`
+	SessionStatusEvent
+}
+
+// HistoryRecorder durably stores status events.
+type HistoryRecorder interface {
+	Append(ctx context.Context, event SessionStatusEvent) error
+}
+
+// RecordingPublisher writes every event to a HistoryRecorder before handing
+// it to the wrapped Publisher, so the history acts as an outbox for live
+// delivery. A recording failure does not prevent publication.
+type RecordingPublisher struct {
+	next     Publisher
+	recorder HistoryRecorder
+}
+
+// NewRecordingPublisher wraps next so that published events are also
+// appended to recorder.
+func NewRecordingPublisher(next Publisher, recorder HistoryRecorder) *RecordingPublisher {
+	return &RecordingPublisher{next: next, recorder: recorder}
+}
+
+// Publish records the event and then publishes it.
+func (p *RecordingPublisher) Publish(ctx context.Context, event SessionStatusEvent) error {
+	if event.SessionID == "" {
+		return fmt.Errorf("session id required")
+	}
+	recordErr := p.recorder.Append(ctx, event)
+	if err := p.next.Publish(ctx, event); err != nil {
+		return err
+	}
+	if recordErr != nil {
+		return fmt.Errorf("record status event: %w", recordErr)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRecordingPublisherRecordsThenPublishes(t *testing.T) {
+	var order []string
+	recorder := recorderFunc(func(context.Context, SessionStatusEvent) error {
+		order = append(order, "record")
+		return nil
+	})
+	next := publisherFunc(func(context.Context, SessionStatusEvent) error {
+		order = append(order, "publish")
+		return nil
+	})
+
+	publisher := NewRecordingPublisher(next, recorder)
+	if err := publisher.Publish(context.Background(), SessionStatusEvent{SessionID: "abc"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(order) != 2 || order[0] != "record" || order[1] != "publish" {
+		t.Fatalf("unexpected call order: %v", order)
+	}
+}
+
+func TestRecordingPublisherPublishesWhenRecordingFails(t *testing.T) {
+	published := false
+	recorder := recorderFunc(func(context.Context, SessionStatusEvent) error {
+		return errors.New("db down")
+	})
+	next := publisherFunc(func(context.Context, SessionStatusEvent) error {
+		published = true
+		return nil
+	})
+
+	err := NewRecordingPublisher(next, recorder).Publish(context.Background(), SessionStatusEvent{SessionID: "abc"})
+	if err == nil {
+		t.Fatal("expected recording error to be reported")
+	}
+	if !published {
+		t.Fatal("expected event to be published despite recording failure")
+	}
+}
+
+func TestRecordingPublisherRequiresSessionID(t *testing.T) {
+	publisher := NewRecordingPublisher(publisherFunc(nil), recorderFunc(nil))
+	if err := publisher.Publish(context.Background(), SessionStatusEvent{}); err == nil {
+		t.Fatal("expected error when publishing without session id")
+	}
+}
+
+type publisherFunc func(context.Context, SessionStatusEvent) error
+
+func (f publisherFunc) Publish(ctx context.Context, event SessionStatusEvent) error {
+	return f(ctx, event)
+}
+
+type recorderFunc func(context.Context, SessionStatusEvent) error
+
+func (f recorderFunc) Append(ctx context.Context, event SessionStatusEvent) error {
+	return f(ctx, event)
+}
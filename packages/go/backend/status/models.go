@@ -0,0 +1,9 @@
+package status
+
+// Model states mark events reporting the warmup of an ASR model a session
+// needs: ModelLoadingState when loading starts or the session starts
+// waiting for a load in progress, ModelLoadedState once the model is ready.
+const (
+	ModelLoadingState = "model-loading"
+	ModelLoadedState  = "model-loaded"
+)
@@ -0,0 +1,198 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	natsclient "streamlation/packages/backend/nats"
+)
+
+// NATSStatusPublisher publishes status events on a per-session NATS subject.
+// When a sequencer is attached, events are numbered before publication.
+type NATSStatusPublisher struct {
+	client    *natsclient.Client
+	sequencer *RedisSequencer
+}
+
+func NewNATSStatusPublisher(addr string) (*NATSStatusPublisher, error) {
+	client, err := natsclient.NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSStatusPublisher{client: client}, nil
+}
+
+func (p *NATSStatusPublisher) Publish(ctx context.Context, event SessionStatusEvent) error {
+	if event.SessionID == "" {
+		return fmt.Errorf("session id required")
+	}
+	if event.SchemaVersion == 0 {
+		event.SchemaVersion = SchemaVersion
+	}
+	if p.sequencer != nil {
+		seq, err := p.sequencer.Next(ctx, event.SessionID)
+		if err != nil {
+			return err
+		}
+		event.Sequence = seq
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal status event: %w", err)
+	}
+	if err := p.client.Publish(ctx, subjectName(event.SessionID), payload); err != nil {
+		return fmt.Errorf("publish status event: %w", err)
+	}
+	return nil
+}
+
+func (p *NATSStatusPublisher) Close() error {
+	if p.sequencer != nil {
+		_ = p.sequencer.Close()
+	}
+	return p.client.Close()
+}
+
+// NATSStatusSubscriber delivers live status events from NATS. Core NATS
+// keeps no history, so replay requests are ignored.
+type NATSStatusSubscriber struct {
+	client *natsclient.Client
+}
+
+func NewNATSStatusSubscriber(addr string) (*NATSStatusSubscriber, error) {
+	client, err := natsclient.NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSStatusSubscriber{client: client}, nil
+}
+
+func (s *NATSStatusSubscriber) Subscribe(ctx context.Context, sessionID string) (StatusStream, error) {
+	return s.SubscribeFrom(ctx, sessionID, Replay{}, Filter{})
+}
+
+// SubscribeFrom delivers live events matching filter. NATS keeps no replay
+// buffer, so replay is ignored.
+func (s *NATSStatusSubscriber) SubscribeFrom(ctx context.Context, sessionID string, _ Replay, filter Filter) (StatusStream, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("session id required")
+	}
+	sub, err := s.client.Subscribe(ctx, subjectName(sessionID))
+	if err != nil {
+		return nil, err
+	}
+	stream := &natsStatusStream{
+		sub:       sub,
+		sessionID: sessionID,
+		filter:    filter,
+		events:    make(chan SessionStatusEvent, 8),
+		errors:    make(chan error, 1),
+		done:      make(chan struct{}),
+	}
+	go stream.run()
+	return stream, nil
+}
+
+// SubscribeAll delivers live events matching filter from every session.
+func (s *NATSStatusSubscriber) SubscribeAll(ctx context.Context, filter Filter) (StatusStream, error) {
+	sub, err := s.client.Subscribe(ctx, firehoseSubject)
+	if err != nil {
+		return nil, err
+	}
+	stream := &natsStatusStream{
+		sub:    sub,
+		filter: filter,
+		events: make(chan SessionStatusEvent, 8),
+		errors: make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+	go stream.run()
+	return stream, nil
+}
+
+func (s *NATSStatusSubscriber) Close() error {
+	return s.client.Close()
+}
+
+type natsStatusStream struct {
+	sub       *natsclient.Subscription
+	sessionID string
+	filter    Filter
+	events    chan SessionStatusEvent
+	errors    chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *natsStatusStream) Events() <-chan SessionStatusEvent {
+	return s.events
+}
+
+func (s *natsStatusStream) Errors() <-chan error {
+	return s.errors
+}
+
+func (s *natsStatusStream) Close() error {
+	var closeErr error
+	s.closeOnce.Do(func() {
+		closeErr = s.sub.Close()
+		<-s.done
+	})
+	return closeErr
+}
+
+func (s *natsStatusStream) run() {
+	defer close(s.done)
+	defer close(s.events)
+	defer close(s.errors)
+
+	for {
+		select {
+		case msg, ok := <-s.sub.Messages():
+			if !ok {
+				return
+			}
+			event, err := DecodeEvent(msg.Payload)
+			if err != nil {
+				s.reportError(err)
+				continue
+			}
+			if event.SessionID == "" {
+				event.SessionID = s.sessionID
+			}
+			if !s.filter.Match(event) {
+				continue
+			}
+			s.events <- event
+		case err, ok := <-s.sub.Errors():
+			if !ok {
+				return
+			}
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			s.reportError(err)
+		}
+	}
+}
+
+func (s *natsStatusStream) reportError(err error) {
+	select {
+	case s.errors <- err:
+	default:
+	}
+}
+
+func subjectName(sessionID string) string {
+	return "streamlation.session." + sessionID + ".status"
+}
+
+// firehoseSubject matches the status subject of every session.
+const firehoseSubject = "streamlation.session.*.status"
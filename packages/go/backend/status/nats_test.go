@@ -0,0 +1,209 @@
+package status
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNATSStatusPublisherAndSubscriber(t *testing.T) {
+	addr := startNATSServer(t)
+
+	subscriber, err := NewNATSStatusSubscriber("nats://" + addr)
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	t.Cleanup(func() { _ = subscriber.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	stream, err := subscriber.SubscribeFrom(ctx, "session123", Replay{Last: 10}, Filter{})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	t.Cleanup(func() { _ = stream.Close() })
+
+	publisher, err := NewNATSStatusPublisher(addr)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	t.Cleanup(func() { _ = publisher.Close() })
+
+	for _, state := range []string{"running", "completed"} {
+		if err := publisher.Publish(ctx, SessionStatusEvent{SessionID: "session123", Stage: "asr", State: state}); err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+	}
+	if err := publisher.Publish(ctx, SessionStatusEvent{SessionID: "other", Stage: "asr", State: "running"}); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	for _, want := range []string{"running", "completed"} {
+		select {
+		case got, ok := <-stream.Events():
+			if !ok {
+				t.Fatal("events channel closed unexpectedly")
+			}
+			if got.SessionID != "session123" || got.State != want || got.SchemaVersion != SchemaVersion {
+				t.Fatalf("unexpected event: %#v", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s event", want)
+		}
+	}
+}
+
+func TestNATSStatusSubscriberSubscribeAll(t *testing.T) {
+	addr := startNATSServer(t)
+
+	subscriber, err := NewNATSStatusSubscriber(addr)
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	t.Cleanup(func() { _ = subscriber.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	stream, err := subscriber.SubscribeAll(ctx, Filter{})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	t.Cleanup(func() { _ = stream.Close() })
+
+	publisher, err := NewNATSStatusPublisher(addr)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+	t.Cleanup(func() { _ = publisher.Close() })
+
+	for _, id := range []string{"first", "second"} {
+		if err := publisher.Publish(ctx, SessionStatusEvent{SessionID: id, Stage: "asr", State: "running"}); err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+	}
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-stream.Events():
+			if got.SessionID != want {
+				t.Fatalf("expected event for %s, got %#v", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+}
+
+func TestNATSStatusPublisherRequiresSessionID(t *testing.T) {
+	publisher, err := NewNATSStatusPublisher("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error constructing publisher: %v", err)
+	}
+	if err := publisher.Publish(context.Background(), SessionStatusEvent{}); err == nil {
+		t.Fatal("expected error when publishing without session id")
+	}
+}
+
+// startNATSServer runs a minimal NATS server that routes PUB to matching
+// SUB subjects and answers PING.
+func startNATSServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	type subscriber struct {
+		subject string
+		sid     string
+		mu      *sync.Mutex
+		writer  *bufio.Writer
+	}
+	var mu sync.Mutex
+	var subscribers []subscriber
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				writer := bufio.NewWriter(conn)
+				var writeMu sync.Mutex
+				write := func(s string) {
+					writeMu.Lock()
+					defer writeMu.Unlock()
+					_, _ = writer.WriteString(s)
+					_ = writer.Flush()
+				}
+
+				write("INFO {\"server_id\":\"test\"}\r\n")
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					if len(fields) == 0 {
+						continue
+					}
+					switch fields[0] {
+					case "CONNECT":
+					case "PING":
+						write("PONG\r\n")
+					case "SUB":
+						mu.Lock()
+						subscribers = append(subscribers, subscriber{subject: fields[1], sid: fields[2], mu: &writeMu, writer: writer})
+						mu.Unlock()
+					case "PUB":
+						size, _ := strconv.Atoi(fields[len(fields)-1])
+						payload := make([]byte, size+2)
+						if _, err := io.ReadFull(reader, payload); err != nil {
+							return
+						}
+						mu.Lock()
+						for _, sub := range subscribers {
+							if !natsSubjectMatches(sub.subject, fields[1]) {
+								continue
+							}
+							sub.mu.Lock()
+							fmt.Fprintf(sub.writer, "MSG %s %s %d\r\n%s\r\n", fields[1], sub.sid, size, payload[:size])
+							_ = sub.writer.Flush()
+							sub.mu.Unlock()
+						}
+						mu.Unlock()
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// natsSubjectMatches reports whether subject matches pattern, where "*"
+// matches exactly one token.
+func natsSubjectMatches(pattern, subject string) bool {
+	want := strings.Split(pattern, ".")
+	got := strings.Split(subject, ".")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if want[i] != "*" && want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
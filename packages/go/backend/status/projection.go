@@ -0,0 +1,305 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	redisclient "streamlation/packages/backend/redis"
+)
+
+// progressStages lists the pipeline stages that count towards completion, in
+// execution order.
+var progressStages = []string{"ingestion", "normalization", "asr", "translation", "output"}
+
+// stageAliases maps alternative stage names used by some emitters onto the
+// canonical names in progressStages.
+var stageAliases = map[string]string{
+	"media": "normalization",
+}
+
+const progressTTL = 7 * 24 * time.Hour
+
+// Progress is a compact projection of a session's status timeline, suitable
+// for list views and status polling without replaying every event. Usage
+// keeps the provider usage of the session's latest run, so that spend can
+// be attributed once the run ended.
+type Progress struct {
+	SessionID       string          `json:"sessionId"`
+	CurrentStage    string          `json:"currentStage"`
+	CurrentState    string          `json:"currentState"`
+	PercentComplete int             `json:"percentComplete"`
+	LastError       string          `json:"lastError,omitempty"`
+	LastErrorCode   ErrorCode       `json:"lastErrorCode,omitempty"`
+	Stages          []StageTiming   `json:"stages,omitempty"`
+	Throughput      *Throughput     `json:"throughput,omitempty"`
+	Usage           []ProviderUsage `json:"usage,omitempty"`
+	UpdatedAt       time.Time       `json:"updatedAt"`
+}
+
+// StageTiming records when a pipeline stage started and, once it has
+// finished, how long it took.
+type StageTiming struct {
+	Stage       string     `json:"stage"`
+	State       string     `json:"state"`
+	StartedAt   time.Time  `json:"startedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	DurationMs  int64      `json:"durationMs,omitempty"`
+}
+
+// Apply folds event into the projection. Events without a timestamp are
+// treated as happening now. A pipeline stage is considered finished when it
+// reports a terminal state or when a later stage starts. Heartbeats only
+// refresh the throughput counters and, like comparisons and usage reports,
+// leave the current stage untouched, and events about a single target
+// language only record failures.
+func (p *Progress) Apply(event SessionStatusEvent) {
+	at := event.Timestamp
+	if at.IsZero() {
+		at = time.Now().UTC()
+	}
+	if p.SessionID == "" {
+		p.SessionID = event.SessionID
+	}
+	if event.Throughput != nil {
+		throughput := *event.Throughput
+		p.Throughput = &throughput
+	}
+	if event.Usage != nil {
+		p.Usage = append([]ProviderUsage(nil), event.Usage...)
+	}
+	if event.State == HeartbeatState || event.State == ComparisonState || event.State == UsageState {
+		p.UpdatedAt = at
+		return
+	}
+	// Branch events of multi-language sessions only surface failures; the
+	// stage-level events drive the timeline.
+	branch := event.Language != ""
+	if !branch {
+		p.CurrentStage = event.Stage
+		p.CurrentState = event.State
+	}
+	p.UpdatedAt = at
+
+	if isFailureState(event.State) || event.Severity == SeverityError || event.Severity == SeverityCritical {
+		p.LastError = event.Detail
+		if p.LastError == "" {
+			p.LastError = event.Stage + " " + event.State
+		}
+		p.LastErrorCode = event.Code
+	}
+
+	stage := canonicalStage(event.Stage)
+	index := stageIndex(stage)
+	if index < 0 || branch {
+		return
+	}
+
+	timing := p.timing(stage)
+	if timing == nil {
+		for i := range p.Stages {
+			if p.Stages[i].CompletedAt == nil && stageIndex(p.Stages[i].Stage) < index {
+				p.Stages[i].finish(at)
+			}
+		}
+		p.Stages = append(p.Stages, StageTiming{Stage: stage, StartedAt: at})
+		timing = &p.Stages[len(p.Stages)-1]
+	}
+	timing.State = event.State
+	if isTerminalState(event.State) && timing.CompletedAt == nil {
+		timing.finish(at)
+	}
+
+	reached := index
+	if event.State == "completed" {
+		reached++
+	}
+	if percent := reached * 100 / len(progressStages); percent > p.PercentComplete {
+		p.PercentComplete = percent
+	}
+}
+
+func (p *Progress) timing(stage string) *StageTiming {
+	for i := range p.Stages {
+		if p.Stages[i].Stage == stage {
+			return &p.Stages[i]
+		}
+	}
+	return nil
+}
+
+func (t *StageTiming) finish(at time.Time) {
+	completed := at
+	t.CompletedAt = &completed
+	t.DurationMs = at.Sub(t.StartedAt).Milliseconds()
+}
+
+func canonicalStage(stage string) string {
+	if alias, ok := stageAliases[stage]; ok {
+		return alias
+	}
+	return stage
+}
+
+func stageIndex(stage string) int {
+	for i, name := range progressStages {
+		if name == stage {
+			return i
+		}
+	}
+	return -1
+}
+
+func isFailureState(state string) bool {
+	return state == "error" || state == "failed"
+}
+
+func isTerminalState(state string) bool {
+	return state == "completed" || state == "cancelled" || isFailureState(state)
+}
+
+// ended reports whether the session's latest run finished: its pipeline
+// stopped, or its output stage completed.
+func (p *Progress) ended() bool {
+	return isTerminalState(p.CurrentState) && (p.CurrentStage == "pipeline" || p.CurrentStage == "output")
+}
+
+// RedisProgressStore keeps the projection for each session in Redis. It
+// implements HistoryRecorder so it can be attached to a publisher with
+// NewRecordingPublisher. Updates are read-modify-write, which is safe as long
+// as a single process emits a session's events at a time.
+//
+// It also keeps the last heartbeat of each running session in a sorted set,
+// which a Watchdog checks through SilentSince.
+type RedisProgressStore struct {
+	client *redisclient.Client
+}
+
+func NewRedisProgressStore(addr string) (*RedisProgressStore, error) {
+	client, err := redisclient.NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisProgressStore{client: client}, nil
+}
+
+// Append folds event into the stored projection for its session.
+func (s *RedisProgressStore) Append(ctx context.Context, event SessionStatusEvent) error {
+	if event.SessionID == "" {
+		return fmt.Errorf("session id required")
+	}
+	key := progressKey(event.SessionID)
+
+	var progress Progress
+	reply, err := s.client.Do(ctx, "GET", key)
+	if err != nil {
+		return fmt.Errorf("load progress: %w", err)
+	}
+	if !reply.IsNil {
+		if err := json.Unmarshal([]byte(reply.Text), &progress); err != nil {
+			return fmt.Errorf("decode progress: %w", err)
+		}
+	}
+
+	progress.Apply(event)
+
+	payload, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("marshal progress: %w", err)
+	}
+	if _, err := s.client.Do(ctx, "SET", key, string(payload), "EX", strconv.Itoa(int(progressTTL/time.Second))); err != nil {
+		return fmt.Errorf("store progress: %w", err)
+	}
+
+	// A heartbeat racing the end of its run must not leave the session
+	// watched.
+	switch {
+	case progress.ended():
+		_, err = s.client.Do(ctx, "ZREM", heartbeatsKey, event.SessionID)
+	case event.State == HeartbeatState:
+		_, err = s.client.Do(ctx, "ZADD", heartbeatsKey, strconv.FormatInt(progress.UpdatedAt.UnixMilli(), 10), event.SessionID)
+	}
+	if err != nil {
+		return fmt.Errorf("store heartbeat: %w", err)
+	}
+	return nil
+}
+
+// SilentSince returns the running sessions that last heartbeated before
+// cutoff and stops watching them until they heartbeat again. A session is
+// returned by a single caller, even when several check at once.
+func (s *RedisProgressStore) SilentSince(ctx context.Context, cutoff time.Time) ([]Stall, error) {
+	reply, err := s.client.Do(ctx, "ZRANGEBYSCORE", heartbeatsKey, "-inf", strconv.FormatInt(cutoff.UnixMilli(), 10), "WITHSCORES")
+	if err != nil {
+		return nil, fmt.Errorf("load heartbeats: %w", err)
+	}
+	if reply.Type != '*' || len(reply.Array)%2 != 0 {
+		return nil, fmt.Errorf("load heartbeats: unexpected reply %#v", reply)
+	}
+
+	var stalls []Stall
+	for i := 0; i < len(reply.Array); i += 2 {
+		sessionID := reply.Array[i].Text
+		millis, err := strconv.ParseFloat(reply.Array[i+1].Text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("decode heartbeat of %s: %w", sessionID, err)
+		}
+		removed, err := s.client.Do(ctx, "ZREM", heartbeatsKey, sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("claim heartbeat of %s: %w", sessionID, err)
+		}
+		if removed.Text != "1" {
+			continue
+		}
+		stalls = append(stalls, Stall{SessionID: sessionID, LastSeen: time.UnixMilli(int64(millis)).UTC()})
+	}
+	return stalls, nil
+}
+
+// Progress returns the stored projections for the given sessions. Sessions
+// without a projection are omitted from the result.
+func (s *RedisProgressStore) Progress(ctx context.Context, sessionIDs ...string) (map[string]Progress, error) {
+	result := make(map[string]Progress, len(sessionIDs))
+	if len(sessionIDs) == 0 {
+		return result, nil
+	}
+
+	args := make([]string, 0, len(sessionIDs)+1)
+	args = append(args, "MGET")
+	for _, id := range sessionIDs {
+		args = append(args, progressKey(id))
+	}
+	reply, err := s.client.Do(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("load progress: %w", err)
+	}
+	if reply.Type != '*' || len(reply.Array) != len(sessionIDs) {
+		return nil, fmt.Errorf("load progress: unexpected reply %#v", reply)
+	}
+
+	for i, value := range reply.Array {
+		if value.IsNil {
+			continue
+		}
+		var progress Progress
+		if err := json.Unmarshal([]byte(value.Text), &progress); err != nil {
+			return nil, fmt.Errorf("decode progress for %s: %w", sessionIDs[i], err)
+		}
+		result[sessionIDs[i]] = progress
+	}
+	return result, nil
+}
+
+func (s *RedisProgressStore) Close() error {
+	return s.client.Close()
+}
+
+// heartbeatsKey holds the sorted set of the last heartbeat of each running
+// session, scored in Unix milliseconds.
+const heartbeatsKey = "streamlation:sessions:heartbeats"
+
+func progressKey(sessionID string) string {
+	return "streamlation:session:" + sessionID + ":progress"
+}
@@ -0,0 +1,259 @@
+package status
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressApplyTracksStagesAndPercent(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	events := []SessionStatusEvent{
+		{SessionID: "abc", Stage: "session", State: "registered", Timestamp: start},
+		{SessionID: "abc", Stage: "ingestion", State: "running", Timestamp: start.Add(time.Second)},
+		{SessionID: "abc", Stage: "ingestion", State: "completed", Timestamp: start.Add(3 * time.Second)},
+		{SessionID: "abc", Stage: "media", State: "normalizing", Timestamp: start.Add(4 * time.Second)},
+		{SessionID: "abc", Stage: "asr", State: "processing", Timestamp: start.Add(6 * time.Second)},
+	}
+
+	var progress Progress
+	for _, event := range events {
+		progress.Apply(event)
+	}
+
+	if progress.SessionID != "abc" || progress.CurrentStage != "asr" || progress.CurrentState != "processing" {
+		t.Fatalf("unexpected current position: %#v", progress)
+	}
+	if progress.PercentComplete != 40 {
+		t.Fatalf("expected 40%% complete, got %d", progress.PercentComplete)
+	}
+	if len(progress.Stages) != 3 {
+		t.Fatalf("expected 3 stage timings, got %#v", progress.Stages)
+	}
+	if progress.Stages[0].Stage != "ingestion" || progress.Stages[0].DurationMs != 2000 {
+		t.Fatalf("unexpected ingestion timing: %#v", progress.Stages[0])
+	}
+	if progress.Stages[1].Stage != "normalization" || progress.Stages[1].DurationMs != 2000 {
+		t.Fatalf("expected normalization to finish when asr started: %#v", progress.Stages[1])
+	}
+	if progress.Stages[2].CompletedAt != nil {
+		t.Fatalf("expected asr to still be running: %#v", progress.Stages[2])
+	}
+	if !progress.UpdatedAt.Equal(start.Add(6 * time.Second)) {
+		t.Fatalf("unexpected updatedAt: %v", progress.UpdatedAt)
+	}
+}
+
+func TestProgressApplyRecordsLastError(t *testing.T) {
+	var progress Progress
+	progress.Apply(SessionStatusEvent{SessionID: "abc", Stage: "translation", State: "running"})
+	progress.Apply(SessionStatusEvent{SessionID: "abc", Stage: "translation", State: "failed", Detail: "model unavailable"})
+	progress.Apply(SessionStatusEvent{SessionID: "abc", Stage: "pipeline", State: "error"})
+
+	if progress.LastError != "pipeline error" {
+		t.Fatalf("expected fallback error detail, got %q", progress.LastError)
+	}
+	if progress.Stages[0].State != "failed" || progress.Stages[0].CompletedAt == nil {
+		t.Fatalf("expected failed stage to be closed: %#v", progress.Stages[0])
+	}
+	if progress.PercentComplete != 60 {
+		t.Fatalf("expected percent to stay at 60, got %d", progress.PercentComplete)
+	}
+}
+
+func TestProgressApplyCompletesAtOutput(t *testing.T) {
+	var progress Progress
+	progress.Apply(SessionStatusEvent{SessionID: "abc", Stage: "output", State: "completed"})
+	if progress.PercentComplete != 100 {
+		t.Fatalf("expected 100%% complete, got %d", progress.PercentComplete)
+	}
+}
+
+func TestRedisProgressStoreAppendAndLoad(t *testing.T) {
+	addr := startKVServer(t)
+	store, err := NewRedisProgressStore(addr)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	ctx := context.Background()
+	for _, state := range []string{"running", "completed"} {
+		if err := store.Append(ctx, SessionStatusEvent{SessionID: "abc", Stage: "ingestion", State: state}); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+
+	got, err := store.Progress(ctx, "abc", "missing")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if _, ok := got["missing"]; ok {
+		t.Fatal("expected sessions without progress to be omitted")
+	}
+	progress, ok := got["abc"]
+	if !ok {
+		t.Fatalf("expected progress for abc, got %#v", got)
+	}
+	if progress.CurrentState != "completed" || progress.PercentComplete != 20 || len(progress.Stages) != 1 {
+		t.Fatalf("unexpected progress: %#v", progress)
+	}
+}
+
+// startKVServer runs a minimal Redis server supporting GET, SET, MGET, and
+// the ZADD, ZREM, and ZRANGEBYSCORE of sorted sets scored in integers.
+func startKVServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var mu sync.Mutex
+	values := make(map[string]string)
+	sets := make(map[string]map[string]int64)
+
+	writeBulk := func(w *bufio.Writer, key string) {
+		value, ok := values[key]
+		if !ok {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		w.WriteString("$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n")
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				writer := bufio.NewWriter(conn)
+				for {
+					args, err := readCommand(reader)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					switch strings.ToUpper(args[0]) {
+					case "GET":
+						writeBulk(writer, args[1])
+					case "SET":
+						values[args[1]] = args[2]
+						writer.WriteString("+OK\r\n")
+					case "MGET":
+						writer.WriteString("*" + strconv.Itoa(len(args)-1) + "\r\n")
+						for _, key := range args[1:] {
+							writeBulk(writer, key)
+						}
+					case "ZADD":
+						if sets[args[1]] == nil {
+							sets[args[1]] = make(map[string]int64)
+						}
+						sets[args[1]][args[3]], _ = strconv.ParseInt(args[2], 10, 64)
+						writer.WriteString(":1\r\n")
+					case "ZREM":
+						_, ok := sets[args[1]][args[2]]
+						delete(sets[args[1]], args[2])
+						if ok {
+							writer.WriteString(":1\r\n")
+						} else {
+							writer.WriteString(":0\r\n")
+						}
+					case "ZRANGEBYSCORE":
+						limit, _ := strconv.ParseInt(args[3], 10, 64)
+						var members []string
+						for member, score := range sets[args[1]] {
+							if score <= limit {
+								members = append(members, member)
+							}
+						}
+						sort.Strings(members)
+						writer.WriteString("*" + strconv.Itoa(2*len(members)) + "\r\n")
+						for _, member := range members {
+							score := strconv.FormatInt(sets[args[1]][member], 10)
+							writer.WriteString("$" + strconv.Itoa(len(member)) + "\r\n" + member + "\r\n")
+							writer.WriteString("$" + strconv.Itoa(len(score)) + "\r\n" + score + "\r\n")
+						}
+					default:
+						writer.WriteString("-ERR unknown command\r\n")
+					}
+					mu.Unlock()
+					if err := writer.Flush(); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestProgressApplyHeartbeatKeepsCurrentStage(t *testing.T) {
+	var progress Progress
+	progress.Apply(SessionStatusEvent{SessionID: "abc", Stage: "asr", State: "running"})
+	progress.Apply(SessionStatusEvent{
+		SessionID:  "abc",
+		Stage:      "pipeline",
+		State:      HeartbeatState,
+		Throughput: &Throughput{ChunksProcessed: 12},
+	})
+
+	if progress.CurrentStage != "asr" || progress.CurrentState != "running" {
+		t.Fatalf("heartbeat should not change the current stage: %#v", progress)
+	}
+	if progress.Throughput == nil || progress.Throughput.ChunksProcessed != 12 {
+		t.Fatalf("expected throughput to be recorded, got %#v", progress.Throughput)
+	}
+
+	progress.Apply(SessionStatusEvent{SessionID: "abc", Stage: "translation", State: ComparisonState, Comparison: &Comparison{Compared: 3}})
+	if progress.CurrentStage != "asr" || progress.CurrentState != "running" {
+		t.Fatalf("comparison should not change the current stage: %#v", progress)
+	}
+}
+
+func TestProgressApplyKeepsUsageOfTheRun(t *testing.T) {
+	var progress Progress
+	progress.Apply(SessionStatusEvent{SessionID: "abc", Stage: "output", State: "completed"})
+	progress.Apply(SessionStatusEvent{
+		SessionID: "abc",
+		Stage:     "pipeline",
+		State:     UsageState,
+		Usage:     []ProviderUsage{{Stage: "translation", Provider: "deepl", Requests: 4, Characters: 1200}},
+	})
+
+	if progress.CurrentStage != "output" || progress.CurrentState != "completed" || progress.PercentComplete != 100 {
+		t.Fatalf("usage should not change the outcome: %#v", progress)
+	}
+	if len(progress.Usage) != 1 || progress.Usage[0].Characters != 1200 {
+		t.Fatalf("expected usage to be recorded, got %#v", progress.Usage)
+	}
+}
+
+func TestProgressApplyBranchEventsOnlyRecordFailures(t *testing.T) {
+	var progress Progress
+	progress.Apply(SessionStatusEvent{SessionID: "abc", Stage: "translation", State: "running"})
+	progress.Apply(SessionStatusEvent{SessionID: "abc", Stage: "output", State: "completed", Language: "fr"})
+	progress.Apply(SessionStatusEvent{SessionID: "abc", Stage: "translation", State: "failed", Detail: "unsupported language pair", Language: "de"})
+
+	if progress.CurrentStage != "translation" || progress.CurrentState != "running" {
+		t.Fatalf("expected branch events to leave the current stage alone, got %s/%s", progress.CurrentStage, progress.CurrentState)
+	}
+	if len(progress.Stages) != 1 || progress.Stages[0].CompletedAt != nil || progress.PercentComplete != 60 {
+		t.Fatalf("expected branch events to leave the timeline alone: %#v", progress)
+	}
+	if progress.LastError != "unsupported language pair" {
+		t.Fatalf("expected the branch failure to be recorded, got %q", progress.LastError)
+	}
+}
@@ -6,13 +6,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"sync"
+	"time"
 
 	redisclient "streamlation/packages/backend/redis"
 )
 
+// RedisStatusPublisher numbers each event, appends it to a capped
+// per-session Redis stream, and then publishes it, so subscribers that
+// connect late can replay what they missed.
 type RedisStatusPublisher struct {
-	client *redisclient.Client
+	client       *redisclient.Client
+	replayLength int
 }
 
 func NewRedisStatusPublisher(addr string) (*RedisStatusPublisher, error) {
@@ -20,13 +26,37 @@ func NewRedisStatusPublisher(addr string) (*RedisStatusPublisher, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &RedisStatusPublisher{client: client}, nil
+	return &RedisStatusPublisher{client: client, replayLength: DefaultReplayLength}, nil
 }
 
 func (p *RedisStatusPublisher) Publish(ctx context.Context, event SessionStatusEvent) error {
 	if event.SessionID == "" {
 		return fmt.Errorf("session id required")
 	}
+	if event.SchemaVersion == 0 {
+		event.SchemaVersion = SchemaVersion
+	}
+	event.StreamID = ""
+	seq, err := nextSequence(ctx, p.client, event.SessionID)
+	if err != nil {
+		return err
+	}
+	event.Sequence = seq
+	buffered, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal status event: %w", err)
+	}
+
+	key := replayKey(event.SessionID)
+	reply, err := p.client.Do(ctx, "XADD", key, "MAXLEN", "~", strconv.Itoa(p.replayLength), "*", replayEventField, string(buffered))
+	if err != nil {
+		return fmt.Errorf("buffer status event: %w", err)
+	}
+	event.StreamID = reply.Text
+	if _, err := p.client.Do(ctx, "EXPIRE", key, strconv.Itoa(int(replayTTL/time.Second))); err != nil {
+		return fmt.Errorf("expire status buffer: %w", err)
+	}
+
 	payload, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("marshal status event: %w", err)
@@ -53,26 +83,103 @@ func NewRedisStatusSubscriber(addr string) (*RedisStatusSubscriber, error) {
 	return &RedisStatusSubscriber{client: client}, nil
 }
 
+// Subscribe delivers live events for sessionID without replaying history.
 func (s *RedisStatusSubscriber) Subscribe(ctx context.Context, sessionID string) (StatusStream, error) {
+	return s.SubscribeFrom(ctx, sessionID, Replay{}, Filter{})
+}
+
+// SubscribeFrom delivers the buffered events selected by replay followed by
+// live events. The live subscription is established before the buffer is
+// read, so no event published in between is lost; events seen in both are
+// delivered once. Only events matching filter are delivered.
+func (s *RedisStatusSubscriber) SubscribeFrom(ctx context.Context, sessionID string, replay Replay, filter Filter) (StatusStream, error) {
 	if sessionID == "" {
 		return nil, fmt.Errorf("session id required")
 	}
+	if replay.After != "" && !ValidStreamID(replay.After) {
+		return nil, fmt.Errorf("invalid replay stream id %q", replay.After)
+	}
 	pubsub, err := s.client.Subscribe(ctx, channelName(sessionID))
 	if err != nil {
 		return nil, err
 	}
 
+	var backlog []SessionStatusEvent
+	if replay.enabled() {
+		backlog, err = s.readBacklog(ctx, sessionID, replay)
+		if err != nil {
+			_ = pubsub.Close()
+			return nil, err
+		}
+	}
+
 	stream := &redisStatusStream{
 		pubsub:    pubsub,
 		sessionID: sessionID,
+		backlog:   backlog,
+		filter:    filter,
+		afterSeq:  replay.AfterSequence,
 		events:    make(chan SessionStatusEvent, 8),
 		errors:    make(chan error, 1),
+		quit:      make(chan struct{}),
 		done:      make(chan struct{}),
 	}
 	go stream.run()
 	return stream, nil
 }
 
+// SubscribeAll delivers live events matching filter from every session.
+// Nothing is replayed.
+func (s *RedisStatusSubscriber) SubscribeAll(ctx context.Context, filter Filter) (StatusStream, error) {
+	pubsub, err := s.client.PSubscribe(ctx, firehosePattern)
+	if err != nil {
+		return nil, err
+	}
+	stream := &redisStatusStream{
+		pubsub: pubsub,
+		filter: filter,
+		events: make(chan SessionStatusEvent, 8),
+		errors: make(chan error, 1),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go stream.run()
+	return stream, nil
+}
+
+func (s *RedisStatusSubscriber) readBacklog(ctx context.Context, sessionID string, replay Replay) ([]SessionStatusEvent, error) {
+	key := replayKey(sessionID)
+	if replay.After == "" && replay.AfterSequence > 0 {
+		// Sequence numbers are not stream IDs, so read the whole buffer and
+		// let the stream skip what the subscriber already has.
+		reply, err := s.client.Do(ctx, "XRANGE", key, "-", "+")
+		if err != nil {
+			return nil, fmt.Errorf("replay status events: %w", err)
+		}
+		return decodeStreamEntries(reply)
+	}
+	if replay.After != "" {
+		reply, err := s.client.Do(ctx, "XRANGE", key, "("+replay.After, "+")
+		if err != nil {
+			return nil, fmt.Errorf("replay status events: %w", err)
+		}
+		return decodeStreamEntries(reply)
+	}
+
+	reply, err := s.client.Do(ctx, "XREVRANGE", key, "+", "-", "COUNT", strconv.Itoa(replay.Last))
+	if err != nil {
+		return nil, fmt.Errorf("replay status events: %w", err)
+	}
+	events, err := decodeStreamEntries(reply)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
+
 func (s *RedisStatusSubscriber) Close() error {
 	return s.client.Close()
 }
@@ -86,8 +193,12 @@ type StatusStream interface {
 type redisStatusStream struct {
 	pubsub    *redisclient.PubSub
 	sessionID string
+	backlog   []SessionStatusEvent
+	filter    Filter
+	afterSeq  int64
 	events    chan SessionStatusEvent
 	errors    chan error
+	quit      chan struct{}
 	done      chan struct{}
 	closeOnce sync.Once
 }
@@ -103,6 +214,7 @@ func (s *redisStatusStream) Errors() <-chan error {
 func (s *redisStatusStream) Close() error {
 	var closeErr error
 	s.closeOnce.Do(func() {
+		close(s.quit)
 		closeErr = s.pubsub.Close()
 		<-s.done
 	})
@@ -114,6 +226,20 @@ func (s *redisStatusStream) run() {
 	defer close(s.events)
 	defer close(s.errors)
 
+	var lastReplayed string
+	for _, event := range s.backlog {
+		lastReplayed = event.StreamID
+		if s.seen(event) || !s.filter.Match(event) {
+			continue
+		}
+		select {
+		case s.events <- event:
+		case <-s.quit:
+			return
+		}
+	}
+	s.backlog = nil
+
 	for {
 		select {
 		case msg, ok := <-s.pubsub.Messages():
@@ -123,14 +249,20 @@ func (s *redisStatusStream) run() {
 			if msg.Kind != "message" && msg.Kind != "pmessage" {
 				continue
 			}
-			var event SessionStatusEvent
-			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
-				s.reportError(fmt.Errorf("decode status event: %w", err))
+			event, err := DecodeEvent([]byte(msg.Payload))
+			if err != nil {
+				s.reportError(err)
 				continue
 			}
 			if event.SessionID == "" {
 				event.SessionID = s.sessionID
 			}
+			if lastReplayed != "" && event.StreamID != "" && compareStreamIDs(event.StreamID, lastReplayed) <= 0 {
+				continue
+			}
+			if s.seen(event) || !s.filter.Match(event) {
+				continue
+			}
 			s.events <- event
 		case err, ok := <-s.pubsub.Errors():
 			if !ok {
@@ -147,6 +279,12 @@ func (s *redisStatusStream) run() {
 	}
 }
 
+// seen reports whether the subscriber already has event, according to the
+// sequence number it resumed from.
+func (s *redisStatusStream) seen(event SessionStatusEvent) bool {
+	return s.afterSeq > 0 && event.Sequence > 0 && event.Sequence <= s.afterSeq
+}
+
 func (s *redisStatusStream) reportError(err error) {
 	select {
 	case s.errors <- err:
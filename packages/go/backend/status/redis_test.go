@@ -72,6 +72,65 @@ func TestRedisStatusPublisherAndSubscriber(t *testing.T) {
 		pubReader := bufio.NewReader(pubConn)
 		pubWriter := bufio.NewWriter(pubConn)
 
+		for _, step := range []struct{ command, reply string }{
+			{"INCR", ":7\r\n"},
+			{"EXPIRE", ":1\r\n"},
+		} {
+			args, err := readCommand(pubReader)
+			if err != nil {
+				t.Errorf("failed to read %s command: %v", step.command, err)
+				return
+			}
+			if len(args) < 2 || strings.ToUpper(args[0]) != step.command || args[1] != sequenceKey("session123") {
+				t.Errorf("unexpected %s command: %v", step.command, args)
+				return
+			}
+			if _, err := pubWriter.WriteString(step.reply); err != nil {
+				t.Errorf("failed to write %s response: %v", step.command, err)
+				return
+			}
+			if err := pubWriter.Flush(); err != nil {
+				t.Errorf("failed to flush %s response: %v", step.command, err)
+				return
+			}
+		}
+
+		xaddArgs, err := readCommand(pubReader)
+		if err != nil {
+			t.Errorf("failed to read xadd command: %v", err)
+			return
+		}
+		if len(xaddArgs) < 2 || strings.ToUpper(xaddArgs[0]) != "XADD" || xaddArgs[1] != replayKey("session123") {
+			t.Errorf("unexpected xadd command: %v", xaddArgs)
+			return
+		}
+		if _, err := pubWriter.WriteString("$3\r\n1-0\r\n"); err != nil {
+			t.Errorf("failed to write xadd response: %v", err)
+			return
+		}
+		if err := pubWriter.Flush(); err != nil {
+			t.Errorf("failed to flush xadd response: %v", err)
+			return
+		}
+
+		expireArgs, err := readCommand(pubReader)
+		if err != nil {
+			t.Errorf("failed to read expire command: %v", err)
+			return
+		}
+		if len(expireArgs) < 3 || strings.ToUpper(expireArgs[0]) != "EXPIRE" {
+			t.Errorf("unexpected expire command: %v", expireArgs)
+			return
+		}
+		if _, err := pubWriter.WriteString(":1\r\n"); err != nil {
+			t.Errorf("failed to write expire response: %v", err)
+			return
+		}
+		if err := pubWriter.Flush(); err != nil {
+			t.Errorf("failed to flush expire response: %v", err)
+			return
+		}
+
 		pubArgs, err := readCommand(pubReader)
 		if err != nil {
 			t.Errorf("failed to read publish command: %v", err)
@@ -137,6 +196,15 @@ func TestRedisStatusPublisherAndSubscriber(t *testing.T) {
 		if got.SessionID != event.SessionID || got.Stage != event.Stage || got.State != event.State {
 			t.Fatalf("unexpected event payload: %#v", got)
 		}
+		if got.StreamID != "1-0" {
+			t.Fatalf("expected stream id 1-0, got %q", got.StreamID)
+		}
+		if got.Sequence != 7 {
+			t.Fatalf("expected sequence 7, got %d", got.Sequence)
+		}
+		if got.SchemaVersion != SchemaVersion {
+			t.Fatalf("expected schema version %d, got %d", SchemaVersion, got.SchemaVersion)
+		}
 	case <-time.After(time.Second):
 		t.Fatal("timed out waiting for status event")
 	}
@@ -205,3 +273,71 @@ func readCommand(r *bufio.Reader) ([]string, error) {
 	}
 	return args, nil
 }
+
+func TestRedisStatusSubscriberSubscribeAll(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Errorf("failed to accept subscriber: %v", err)
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		writer := bufio.NewWriter(conn)
+
+		args, err := readCommand(reader)
+		if err != nil {
+			t.Errorf("failed to read psubscribe command: %v", err)
+			return
+		}
+		if len(args) != 2 || strings.ToUpper(args[0]) != "PSUBSCRIBE" || args[1] != firehosePattern {
+			t.Errorf("unexpected psubscribe command: %v", args)
+			return
+		}
+		fmt.Fprintf(writer, "*3\r\n$10\r\npsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(firehosePattern), firehosePattern)
+
+		for _, id := range []string{"first", "second"} {
+			channel := channelName(id)
+			payload := fmt.Sprintf(`{"sessionId":%q,"stage":"asr","state":"running"}`, id)
+			fmt.Fprintf(writer, "*4\r\n$8\r\npmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
+				len(firehosePattern), firehosePattern, len(channel), channel, len(payload), payload)
+		}
+		_ = writer.Flush()
+		_, _ = reader.ReadByte()
+	}()
+
+	subscriber, err := NewRedisStatusSubscriber(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	t.Cleanup(func() { _ = subscriber.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream, err := subscriber.SubscribeAll(ctx, Filter{})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-stream.Events():
+			if got.SessionID != want || got.Stage != "asr" {
+				t.Fatalf("unexpected event: %#v", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+	_ = stream.Close()
+	<-done
+}
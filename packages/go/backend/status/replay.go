@@ -0,0 +1,121 @@
+package status
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	redisclient "streamlation/packages/backend/redis"
+)
+
+const (
+	// DefaultReplayLength caps how many recent events are retained per session
+	// for replay to late subscribers.
+	DefaultReplayLength = 100
+
+	// replayTTL bounds how long an idle session's replay buffer is kept.
+	replayTTL = 24 * time.Hour
+
+	replayEventField = "event"
+)
+
+// Replay selects the buffered events a subscriber receives before live
+// delivery starts. The zero value replays nothing.
+type Replay struct {
+	// Last replays up to this many of the most recent events.
+	Last int
+	// After replays every buffered event published after the given stream
+	// ID. It takes precedence over Last.
+	After string
+	// AfterSequence replays every buffered event whose sequence number is
+	// greater than this one. It takes precedence over Last but not After.
+	AfterSequence int64
+}
+
+func (r Replay) enabled() bool {
+	return r.After != "" || r.AfterSequence > 0 || r.Last > 0
+}
+
+func replayKey(sessionID string) string {
+	return channelName(sessionID) + ":log"
+}
+
+// ValidStreamID reports whether id is a Redis stream entry ID of the form
+// "<milliseconds>-<sequence>".
+func ValidStreamID(id string) bool {
+	_, _, ok := parseStreamID(id)
+	return ok
+}
+
+func parseStreamID(id string) (uint64, uint64, bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
+
+// compareStreamIDs orders two stream IDs, returning -1, 0, or 1. IDs that
+// cannot be parsed sort before every valid ID.
+func compareStreamIDs(a, b string) int {
+	aMs, aSeq, aOK := parseStreamID(a)
+	bMs, bSeq, bOK := parseStreamID(b)
+	switch {
+	case !aOK && !bOK:
+		return 0
+	case !aOK:
+		return -1
+	case !bOK:
+		return 1
+	case aMs != bMs:
+		if aMs < bMs {
+			return -1
+		}
+		return 1
+	case aSeq != bSeq:
+		if aSeq < bSeq {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// decodeStreamEntries converts an XRANGE/XREVRANGE reply into events tagged
+// with their stream IDs, preserving reply order.
+func decodeStreamEntries(reply redisclient.Reply) ([]SessionStatusEvent, error) {
+	if reply.IsNil {
+		return nil, nil
+	}
+	if reply.Type != '*' {
+		return nil, fmt.Errorf("unexpected stream reply %#v", reply)
+	}
+	events := make([]SessionStatusEvent, 0, len(reply.Array))
+	for _, entry := range reply.Array {
+		if len(entry.Array) != 2 {
+			return nil, fmt.Errorf("unexpected stream entry %#v", entry)
+		}
+		fields := entry.Array[1].Array
+		for i := 0; i+1 < len(fields); i += 2 {
+			if fields[i].Text != replayEventField {
+				continue
+			}
+			event, err := DecodeEvent([]byte(fields[i+1].Text))
+			if err != nil {
+				return nil, fmt.Errorf("replay: %w", err)
+			}
+			event.StreamID = entry.Array[0].Text
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,180 @@
+package status
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareStreamIDs(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1-0", "1-0", 0},
+		{"1-0", "1-1", -1},
+		{"2-0", "1-9", 1},
+		{"10-0", "9-0", 1},
+		{"bogus", "1-0", -1},
+	}
+	for _, tc := range cases {
+		if got := compareStreamIDs(tc.a, tc.b); got != tc.want {
+			t.Errorf("compareStreamIDs(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestValidStreamID(t *testing.T) {
+	if !ValidStreamID("1700000000000-3") {
+		t.Fatal("expected stream id to be valid")
+	}
+	for _, id := range []string{"", "123", "a-1", "1-b", "-1"} {
+		if ValidStreamID(id) {
+			t.Errorf("expected %q to be invalid", id)
+		}
+	}
+}
+
+func TestRedisStatusSubscriberReplaysBeforeLiveEvents(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	channel := channelName("session123")
+	received := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		subConn, err := ln.Accept()
+		if err != nil {
+			t.Errorf("failed to accept subscriber: %v", err)
+			return
+		}
+		defer subConn.Close()
+		subReader := bufio.NewReader(subConn)
+		subWriter := bufio.NewWriter(subConn)
+		if _, err := readCommand(subReader); err != nil {
+			t.Errorf("failed to read subscribe command: %v", err)
+			return
+		}
+		fmt.Fprintf(subWriter, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(channel), channel)
+		_ = subWriter.Flush()
+
+		cmdConn, err := ln.Accept()
+		if err != nil {
+			t.Errorf("failed to accept command connection: %v", err)
+			return
+		}
+		defer cmdConn.Close()
+		cmdReader := bufio.NewReader(cmdConn)
+		cmdWriter := bufio.NewWriter(cmdConn)
+		args, err := readCommand(cmdReader)
+		if err != nil {
+			t.Errorf("failed to read replay command: %v", err)
+			return
+		}
+		if len(args) != 6 || strings.ToUpper(args[0]) != "XREVRANGE" || args[1] != replayKey("session123") || args[5] != "2" {
+			t.Errorf("unexpected replay command: %v", args)
+			return
+		}
+		cmdWriter.WriteString(encodeStreamEntries(t,
+			streamEntry{"2-0", SessionStatusEvent{SessionID: "session123", Stage: "asr", State: "running"}},
+			streamEntry{"1-0", SessionStatusEvent{SessionID: "session123", Stage: "ingestion", State: "queued"}},
+		))
+		_ = cmdWriter.Flush()
+
+		for _, live := range []streamEntry{
+			{"2-0", SessionStatusEvent{SessionID: "session123", Stage: "asr", State: "running"}},
+			{"3-0", SessionStatusEvent{SessionID: "session123", Stage: "translation", State: "running"}},
+		} {
+			live.event.StreamID = live.id
+			payload, err := json.Marshal(live.event)
+			if err != nil {
+				t.Errorf("failed to marshal live event: %v", err)
+				return
+			}
+			fmt.Fprintf(subWriter, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(channel), channel, len(payload), payload)
+		}
+		_ = subWriter.Flush()
+
+		<-received
+	}()
+
+	subscriber, err := NewRedisStatusSubscriber(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	t.Cleanup(func() { _ = subscriber.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream, err := subscriber.SubscribeFrom(ctx, "session123", Replay{Last: 2}, Filter{})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	t.Cleanup(func() { _ = stream.Close() })
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case event, ok := <-stream.Events():
+			if !ok {
+				t.Fatalf("events channel closed after %v", got)
+			}
+			got = append(got, event.StreamID+":"+event.Stage)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events, got %v", got)
+		}
+	}
+	close(received)
+
+	want := []string{"1-0:ingestion", "2-0:asr", "3-0:translation"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected event order: got %v, want %v", got, want)
+		}
+	}
+
+	<-done
+}
+
+func TestRedisStatusSubscriberRejectsInvalidReplayID(t *testing.T) {
+	subscriber, err := NewRedisStatusSubscriber("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error constructing subscriber: %v", err)
+	}
+	t.Cleanup(func() { _ = subscriber.Close() })
+
+	if _, err := subscriber.SubscribeFrom(context.Background(), "session123", Replay{After: "latest"}, Filter{}); err == nil {
+		t.Fatal("expected error for invalid replay id")
+	}
+}
+
+type streamEntry struct {
+	id    string
+	event SessionStatusEvent
+}
+
+func encodeStreamEntries(t *testing.T, entries ...streamEntry) string {
+	t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(entries))
+	for _, entry := range entries {
+		payload, err := json.Marshal(entry.event)
+		if err != nil {
+			t.Fatalf("failed to marshal entry: %v", err)
+		}
+		fmt.Fprintf(&b, "*2\r\n$%d\r\n%s\r\n*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
+			len(entry.id), entry.id, len(replayEventField), replayEventField, len(payload), payload)
+	}
+	return b.String()
+}
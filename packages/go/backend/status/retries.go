@@ -0,0 +1,48 @@
+package status
+
+import (
+	"context"
+	"io"
+
+	"streamlation/packages/backend/metrics"
+)
+
+// RetryingState marks an event reporting that a stage failed transiently and
+// is being retried.
+const RetryingState = "retrying"
+
+// RetryMetricsPublisher counts stage retries per stage from the status
+// events it forwards.
+type RetryMetricsPublisher struct {
+	next    Publisher
+	retries *metrics.Counter
+}
+
+// NewRetryMetricsPublisher wraps next so that retry events are counted.
+func NewRetryMetricsPublisher(next Publisher) *RetryMetricsPublisher {
+	return &RetryMetricsPublisher{next: next, retries: metrics.NewCounter("streamlation_stage_retries_total", "Stage retries after transient failures.", "stage")}
+}
+
+// Publish counts the event if it reports a retry and forwards it.
+func (p *RetryMetricsPublisher) Publish(ctx context.Context, event SessionStatusEvent) error {
+	if event.State == RetryingState {
+		p.retries.Inc(canonicalStage(event.Stage))
+	}
+	return p.next.Publish(ctx, event)
+}
+
+// Retries returns the number of retries seen for each stage.
+func (p *RetryMetricsPublisher) Retries() map[string]uint64 {
+	samples := p.retries.Samples()
+	retries := make(map[string]uint64, len(samples))
+	for _, sample := range samples {
+		retries[sample.Values[0]] = uint64(sample.Value)
+	}
+	return retries
+}
+
+// WriteMetrics writes the retry counters in the Prometheus text exposition
+// format.
+func (p *RetryMetricsPublisher) WriteMetrics(w io.Writer) error {
+	return p.retries.WriteMetrics(w)
+}
@@ -0,0 +1,52 @@
+package status
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRetryMetricsPublisherCountsRetriesPerStage(t *testing.T) {
+	var published int
+	next := publisherFunc(func(context.Context, SessionStatusEvent) error {
+		published++
+		return nil
+	})
+	publisher := NewRetryMetricsPublisher(next)
+
+	ctx := context.Background()
+	for _, event := range []SessionStatusEvent{
+		{Stage: "translation", State: "running"},
+		{Stage: "translation", State: RetryingState, Attempt: 2},
+		{Stage: "translation", State: RetryingState, Attempt: 3},
+		{Stage: "media", State: RetryingState, Attempt: 2},
+		{Stage: "output", State: "completed"},
+	} {
+		event.SessionID = "abc"
+		if err := publisher.Publish(ctx, event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if published != 5 {
+		t.Fatalf("expected every event to be forwarded, got %d", published)
+	}
+
+	retries := publisher.Retries()
+	if len(retries) != 2 || retries["translation"] != 2 || retries["normalization"] != 1 {
+		t.Fatalf("unexpected retry counts: %#v", retries)
+	}
+
+	var metrics strings.Builder
+	if err := publisher.WriteMetrics(&metrics); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	for _, line := range []string{
+		"# TYPE streamlation_stage_retries_total counter",
+		`streamlation_stage_retries_total{stage="normalization"} 1`,
+		`streamlation_stage_retries_total{stage="translation"} 2`,
+	} {
+		if !strings.Contains(metrics.String(), line) {
+			t.Fatalf("expected %q in metrics:\n%s", line, metrics.String())
+		}
+	}
+}
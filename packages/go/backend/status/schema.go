@@ -0,0 +1,100 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Status event schema versions. Version 1 events predate the schemaVersion
+// field and are recognised by its absence.
+const (
+	legacySchemaVersion = 1
+	// SchemaVersion is the version written by this build's publishers.
+	SchemaVersion = 2
+)
+
+// DecodeEvent parses a status event published by any version of the
+// service. Unknown fields are ignored, events without a schemaVersion are
+// treated as version 1, and a known field whose type changed in a newer
+// version is dropped rather than failing the whole event.
+func DecodeEvent(data []byte) (SessionStatusEvent, error) {
+	var event SessionStatusEvent
+	err := json.Unmarshal(data, &event)
+	if err != nil {
+		if !json.Valid(data) {
+			return SessionStatusEvent{}, fmt.Errorf("decode status event: %w", err)
+		}
+		event, err = decodeEventFields(data)
+		if err != nil {
+			return SessionStatusEvent{}, err
+		}
+	}
+	if event.SchemaVersion == 0 {
+		event.SchemaVersion = legacySchemaVersion
+	}
+	return event, nil
+}
+
+// decodeEventFields decodes each top-level field on its own so that one
+// incompatible field does not discard the rest of the event.
+func decodeEventFields(data []byte) (SessionStatusEvent, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return SessionStatusEvent{}, fmt.Errorf("decode status event: %w", err)
+	}
+
+	var event SessionStatusEvent
+	for name, raw := range fields {
+		single, err := json.Marshal(map[string]json.RawMessage{name: raw})
+		if err != nil {
+			continue
+		}
+		var partial SessionStatusEvent
+		if err := json.Unmarshal(single, &partial); err != nil {
+			continue
+		}
+		mergeEventField(&event, partial, name)
+	}
+	return event, nil
+}
+
+func mergeEventField(dst *SessionStatusEvent, src SessionStatusEvent, name string) {
+	switch name {
+	case "schemaVersion":
+		dst.SchemaVersion = src.SchemaVersion
+	case "sessionId":
+		dst.SessionID = src.SessionID
+	case "stage":
+		dst.Stage = src.Stage
+	case "state":
+		dst.State = src.State
+	case "detail":
+		dst.Detail = src.Detail
+	case "timestamp":
+		dst.Timestamp = src.Timestamp
+	case "code":
+		dst.Code = src.Code
+	case "severity":
+		dst.Severity = src.Severity
+	case "retryable":
+		dst.Retryable = src.Retryable
+	case "attempt":
+		dst.Attempt = src.Attempt
+	case "language":
+		dst.Language = src.Language
+	case "dropped":
+		dst.Dropped = src.Dropped
+	case "streamId":
+		dst.StreamID = src.StreamID
+	case "sequence":
+		dst.Sequence = src.Sequence
+	case "throughput":
+		dst.Throughput = src.Throughput
+	case "stageDurations":
+		dst.StageDurations = src.StageDurations
+	case "comparison":
+		dst.Comparison = src.Comparison
+	case "usage":
+		dst.Usage = src.Usage
+	}
+}
@@ -0,0 +1,49 @@
+package status
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecodeEventDefaultsLegacyVersion(t *testing.T) {
+	event, err := DecodeEvent([]byte(`{"sessionId":"abc","stage":"asr","state":"running","timestamp":"2024-01-01T00:00:00Z"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.SchemaVersion != 1 {
+		t.Fatalf("expected legacy events to decode as version 1, got %d", event.SchemaVersion)
+	}
+	if event.SessionID != "abc" || event.Stage != "asr" || !event.Timestamp.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+}
+
+func TestDecodeEventIgnoresUnknownFields(t *testing.T) {
+	event, err := DecodeEvent([]byte(`{"schemaVersion":7,"sessionId":"abc","stage":"asr","state":"running","hologram":{"x":1}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.SchemaVersion != 7 || event.State != "running" {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+}
+
+func TestDecodeEventDropsIncompatibleFields(t *testing.T) {
+	payload := `{"schemaVersion":9,"sessionId":"abc","stage":"asr","state":"failed","retryable":"maybe","timestamp":"yesterday","throughput":[1,2]}`
+	event, err := DecodeEvent([]byte(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.SessionID != "abc" || event.Stage != "asr" || event.State != "failed" || event.SchemaVersion != 9 {
+		t.Fatalf("expected compatible fields to survive, got %#v", event)
+	}
+	if event.Retryable || !event.Timestamp.IsZero() || event.Throughput != nil {
+		t.Fatalf("expected incompatible fields to be dropped, got %#v", event)
+	}
+}
+
+func TestDecodeEventRejectsMalformedJSON(t *testing.T) {
+	if _, err := DecodeEvent([]byte(`{"sessionId":`)); err == nil {
+		t.Fatal("expected error for malformed payload")
+	}
+}
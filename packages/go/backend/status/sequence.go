@@ -0,0 +1,66 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	redisclient "streamlation/packages/backend/redis"
+)
+
+func sequenceKey(sessionID string) string {
+	return channelName(sessionID) + ":seq"
+}
+
+// nextSequence atomically allocates the next sequence number for sessionID.
+// Numbers start at 1 and are shared by every process publishing for the
+// session. The counter expires together with the replay buffer.
+func nextSequence(ctx context.Context, client *redisclient.Client, sessionID string) (int64, error) {
+	key := sequenceKey(sessionID)
+	reply, err := client.Do(ctx, "INCR", key)
+	if err != nil {
+		return 0, fmt.Errorf("allocate status sequence: %w", err)
+	}
+	seq, err := strconv.ParseInt(reply.Text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("allocate status sequence: unexpected reply %q", reply.Text)
+	}
+	if _, err := client.Do(ctx, "EXPIRE", key, strconv.Itoa(int(replayTTL/time.Second))); err != nil {
+		return 0, fmt.Errorf("expire status sequence: %w", err)
+	}
+	return seq, nil
+}
+
+// RedisSequencer allocates per-session sequence numbers for transports that
+// cannot do so themselves.
+type RedisSequencer struct {
+	client *redisclient.Client
+}
+
+func NewRedisSequencer(addr string) (*RedisSequencer, error) {
+	client, err := redisclient.NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisSequencer{client: client}, nil
+}
+
+// Next returns the next sequence number for sessionID.
+func (s *RedisSequencer) Next(ctx context.Context, sessionID string) (int64, error) {
+	return nextSequence(ctx, s.client, sessionID)
+}
+
+func (s *RedisSequencer) Close() error {
+	return s.client.Close()
+}
+
+// Missed reports how many events were skipped between the last sequence a
+// subscriber saw and event. It is zero when nothing was missed or when
+// either side predates sequence numbers.
+func Missed(lastSeen int64, event SessionStatusEvent) int64 {
+	if lastSeen <= 0 || event.Sequence <= lastSeen+1 {
+		return 0
+	}
+	return event.Sequence - lastSeen - 1
+}
@@ -0,0 +1,137 @@
+package status
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMissed(t *testing.T) {
+	cases := []struct {
+		lastSeen int64
+		sequence int64
+		want     int64
+	}{
+		{0, 5, 0},
+		{4, 5, 0},
+		{4, 4, 0},
+		{4, 0, 0},
+		{4, 8, 3},
+	}
+	for _, tc := range cases {
+		if got := Missed(tc.lastSeen, SessionStatusEvent{Sequence: tc.sequence}); got != tc.want {
+			t.Errorf("Missed(%d, %d) = %d, want %d", tc.lastSeen, tc.sequence, got, tc.want)
+		}
+	}
+}
+
+func TestRedisStatusSubscriberReplaysAfterSequence(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	channel := channelName("session123")
+	received := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		subConn, err := ln.Accept()
+		if err != nil {
+			t.Errorf("failed to accept subscriber: %v", err)
+			return
+		}
+		defer subConn.Close()
+		subReader := bufio.NewReader(subConn)
+		subWriter := bufio.NewWriter(subConn)
+		if _, err := readCommand(subReader); err != nil {
+			t.Errorf("failed to read subscribe command: %v", err)
+			return
+		}
+		fmt.Fprintf(subWriter, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(channel), channel)
+		_ = subWriter.Flush()
+
+		cmdConn, err := ln.Accept()
+		if err != nil {
+			t.Errorf("failed to accept command connection: %v", err)
+			return
+		}
+		defer cmdConn.Close()
+		cmdReader := bufio.NewReader(cmdConn)
+		cmdWriter := bufio.NewWriter(cmdConn)
+		args, err := readCommand(cmdReader)
+		if err != nil {
+			t.Errorf("failed to read replay command: %v", err)
+			return
+		}
+		if len(args) != 4 || strings.ToUpper(args[0]) != "XRANGE" || args[2] != "-" || args[3] != "+" {
+			t.Errorf("unexpected replay command: %v", args)
+			return
+		}
+		cmdWriter.WriteString(encodeStreamEntries(t,
+			streamEntry{"1-0", SessionStatusEvent{SessionID: "session123", Stage: "ingestion", State: "queued", Sequence: 1}},
+			streamEntry{"2-0", SessionStatusEvent{SessionID: "session123", Stage: "asr", State: "running", Sequence: 2}},
+			streamEntry{"3-0", SessionStatusEvent{SessionID: "session123", Stage: "asr", State: "completed", Sequence: 3}},
+		))
+		_ = cmdWriter.Flush()
+
+		// The third event was also delivered live before the buffer was read.
+		for _, live := range []streamEntry{
+			{"3-0", SessionStatusEvent{SessionID: "session123", Stage: "asr", State: "completed", Sequence: 3}},
+			{"4-0", SessionStatusEvent{SessionID: "session123", Stage: "translation", State: "running", Sequence: 4}},
+		} {
+			live.event.StreamID = live.id
+			payload, err := json.Marshal(live.event)
+			if err != nil {
+				t.Errorf("failed to marshal live event: %v", err)
+				return
+			}
+			fmt.Fprintf(subWriter, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(channel), channel, len(payload), payload)
+		}
+		_ = subWriter.Flush()
+
+		<-received
+	}()
+
+	subscriber, err := NewRedisStatusSubscriber(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to create subscriber: %v", err)
+	}
+	t.Cleanup(func() { _ = subscriber.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream, err := subscriber.SubscribeFrom(ctx, "session123", Replay{AfterSequence: 1, Last: 10}, Filter{})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	t.Cleanup(func() { _ = stream.Close() })
+
+	var got []int64
+	for len(got) < 3 {
+		select {
+		case event, ok := <-stream.Events():
+			if !ok {
+				t.Fatalf("events channel closed after %v", got)
+			}
+			got = append(got, event.Sequence)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events, got %v", got)
+		}
+	}
+	close(received)
+
+	if got[0] != 2 || got[1] != 3 || got[2] != 4 {
+		t.Fatalf("expected sequences 2, 3, 4, got %v", got)
+	}
+
+	<-done
+}
@@ -0,0 +1,384 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSpoolCapacity is the number of undelivered events kept per
+	// SpoolingPublisher when no capacity is configured.
+	DefaultSpoolCapacity = 1000
+	// GapState marks an event standing in for status events that were lost
+	// because the spool overflowed.
+	GapState = "gap"
+)
+
+// SpoolingPublisher keeps status events that could not be delivered and
+// retries them, in order, once the wrapped publisher recovers. While events
+// are spooled, new events queue behind them so subscribers never see them out
+// of order. When the spool is full the oldest events are discarded and a gap
+// event carrying the number of lost events is published for each affected
+// session ahead of its remaining events.
+//
+// With a path, changes to the spool are appended to a file so that
+// undelivered events survive a restart.
+type SpoolingPublisher struct {
+	next     Publisher
+	capacity int
+	path     string
+	now      func() time.Time
+
+	mu     sync.Mutex
+	events []SessionStatusEvent
+	gaps   map[string]int
+	// removed counts the events taken off the front of events, delivered or
+	// discarded, so that a flush can tell which of the events it sent are
+	// still spooled.
+	removed  int
+	flushing bool
+	// records counts the records in the spool file.
+	records int
+}
+
+// spoolRecord is one line of the spool file. Replaying the records in order
+// rebuilds the spool.
+type spoolRecord struct {
+	// Event was spooled.
+	Event *SessionStatusEvent `json:"event,omitempty"`
+	// Delivered events were taken off the front of the spool.
+	Delivered int `json:"delivered,omitempty"`
+	// Gaps changes the number of lost events per session.
+	Gaps map[string]int `json:"gaps,omitempty"`
+}
+
+// NewSpoolingPublisher wraps next with a spool holding up to capacity
+// events. A non-positive capacity uses DefaultSpoolCapacity. When path is not
+// empty, events left over from a previous run are loaded from it.
+func NewSpoolingPublisher(next Publisher, capacity int, path string) (*SpoolingPublisher, error) {
+	if capacity <= 0 {
+		capacity = DefaultSpoolCapacity
+	}
+	p := &SpoolingPublisher{
+		next:     next,
+		capacity: capacity,
+		path:     path,
+		now:      time.Now,
+		gaps:     make(map[string]int),
+	}
+	if path == "" {
+		return p, nil
+	}
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Publish delivers the event or, while earlier events are still spooled,
+// spools it behind them and flushes. If delivery fails the event is spooled
+// and no error is returned. The wrapped publisher is called without holding
+// the spool's lock, so a slow backend does not stall other callers.
+func (p *SpoolingPublisher) Publish(ctx context.Context, event SessionStatusEvent) error {
+	if event.SessionID == "" {
+		return fmt.Errorf("session id required")
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = p.now().UTC()
+	}
+
+	p.mu.Lock()
+	spooled := p.flushing || len(p.events) > 0 || len(p.gaps) > 0
+	p.mu.Unlock()
+	if !spooled {
+		if err := p.next.Publish(ctx, event); err == nil {
+			return nil
+		}
+	}
+
+	p.mu.Lock()
+	p.enqueue(event)
+	err := p.append(spoolRecord{Event: &event})
+	p.mu.Unlock()
+	if spooled {
+		_ = p.flush(ctx)
+	}
+	return err
+}
+
+// Flush retries spooled events in order and stops at the first failure. It
+// returns at once when another flush is already running.
+func (p *SpoolingPublisher) Flush(ctx context.Context) error {
+	return p.flush(ctx)
+}
+
+// Pending reports how many events are waiting to be delivered.
+func (p *SpoolingPublisher) Pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.events)
+}
+
+// Run flushes the spool every interval until ctx is cancelled, so that
+// buffered events are delivered after a reconnection even if no new events
+// are published.
+func (p *SpoolingPublisher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = p.Flush(ctx)
+		}
+	}
+}
+
+// flush sends snapshots of the spool until it is empty. The lock is released
+// while sending, so events spooled meanwhile are sent by the next round.
+func (p *SpoolingPublisher) flush(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.flushing {
+		return nil
+	}
+	p.flushing = true
+	defer func() { p.flushing = false }()
+
+	for len(p.events) > 0 || len(p.gaps) > 0 {
+		events, gaps, start := slices.Clone(p.events), maps.Clone(p.gaps), p.removed
+		p.mu.Unlock()
+		delivered, deliveredGaps, sendErr := p.send(ctx, events, gaps)
+		p.mu.Lock()
+
+		err := p.settle(start, delivered, deliveredGaps)
+		if sendErr != nil {
+			return sendErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send publishes events in order, each session's gap ahead of its first
+// event, followed by the remaining gaps. It reports how many events and
+// which gaps were delivered before the first failure.
+func (p *SpoolingPublisher) send(ctx context.Context, events []SessionStatusEvent, gaps map[string]int) (int, map[string]int, error) {
+	delivered := make(map[string]int)
+	for i, event := range events {
+		if err := p.sendGap(ctx, event.SessionID, gaps, delivered); err != nil {
+			return i, delivered, err
+		}
+		if err := p.next.Publish(ctx, event); err != nil {
+			return i, delivered, err
+		}
+	}
+	for sessionID := range gaps {
+		if err := p.sendGap(ctx, sessionID, gaps, delivered); err != nil {
+			return len(events), delivered, err
+		}
+	}
+	return len(events), delivered, nil
+}
+
+// sendGap reports lost events for sessionID, if any, moving its count from
+// gaps to delivered.
+func (p *SpoolingPublisher) sendGap(ctx context.Context, sessionID string, gaps, delivered map[string]int) error {
+	dropped, ok := gaps[sessionID]
+	if !ok {
+		return nil
+	}
+	gap := SessionStatusEvent{
+		SessionID: sessionID,
+		Stage:     "status",
+		State:     GapState,
+		Detail:    strconv.Itoa(dropped) + " status events were lost while the status backend was unavailable",
+		Timestamp: p.now().UTC(),
+		Code:      CodeStatusEventsDropped,
+		Severity:  SeverityWarning,
+	}
+	if err := p.next.Publish(ctx, gap); err != nil {
+		return err
+	}
+	delete(gaps, sessionID)
+	delivered[sessionID] = dropped
+	return nil
+}
+
+// settle removes what a flush delivered from the spool: the events sent
+// from start, as counted by removed, and the lost event counts in gaps.
+// Events discarded while the flush ran are already gone.
+func (p *SpoolingPublisher) settle(start, delivered int, gaps map[string]int) error {
+	record := spoolRecord{}
+	if n := start + delivered - p.removed; n > 0 {
+		p.events = p.events[n:]
+		p.removed += n
+		record.Delivered = n
+	}
+	if len(gaps) > 0 {
+		record.Gaps = make(map[string]int, len(gaps))
+		for sessionID, dropped := range gaps {
+			p.addGap(sessionID, -dropped)
+			record.Gaps[sessionID] = -dropped
+		}
+	}
+
+	if len(p.events) == 0 && len(p.gaps) == 0 {
+		return p.clear()
+	}
+	if record.Delivered == 0 && record.Gaps == nil {
+		return nil
+	}
+	return p.append(record)
+}
+
+// enqueue appends event, discarding the oldest spooled event when full.
+func (p *SpoolingPublisher) enqueue(event SessionStatusEvent) {
+	if len(p.events) >= p.capacity {
+		p.gaps[p.events[0].SessionID]++
+		p.events = p.events[1:]
+		p.removed++
+	}
+	p.events = append(p.events, event)
+}
+
+// addGap changes the number of lost events for sessionID by n.
+func (p *SpoolingPublisher) addGap(sessionID string, n int) {
+	p.gaps[sessionID] += n
+	if p.gaps[sessionID] <= 0 {
+		delete(p.gaps, sessionID)
+	}
+}
+
+// load replays the spool file left by a previous run and rewrites it in
+// compact form.
+func (p *SpoolingPublisher) load() error {
+	if err := p.replay(); err != nil {
+		return err
+	}
+	if len(p.events) == 0 && len(p.gaps) == 0 {
+		return p.clear()
+	}
+	return p.rewrite()
+}
+
+func (p *SpoolingPublisher) replay() error {
+	file, err := os.Open(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read status spool: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	for {
+		var record spoolRecord
+		err := decoder.Decode(&record)
+		// A crash while appending can leave the last record cut short.
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decode status spool: %w", err)
+		}
+
+		if record.Event != nil {
+			p.enqueue(*record.Event)
+		}
+		if n := min(record.Delivered, len(p.events)); n > 0 {
+			p.events = p.events[n:]
+		}
+		for sessionID, n := range record.Gaps {
+			p.addGap(sessionID, n)
+		}
+	}
+}
+
+// append adds record to the spool file. Once the file holds twice the
+// capacity in records it is rewritten instead, so that it stays bounded
+// during a long outage.
+func (p *SpoolingPublisher) append(record spoolRecord) error {
+	if p.path == "" {
+		return nil
+	}
+	if p.records >= 2*p.capacity {
+		return p.rewrite()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal status spool: %w", err)
+	}
+	file, err := os.OpenFile(p.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("write status spool: %w", err)
+	}
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write status spool: %w", err)
+	}
+	p.records++
+	return nil
+}
+
+// rewrite replaces the spool file with the current spool. The file is
+// replaced atomically so a crash never leaves a partially written spool
+// behind.
+func (p *SpoolingPublisher) rewrite() error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	records := 0
+	if len(p.gaps) > 0 {
+		if err := encoder.Encode(spoolRecord{Gaps: p.gaps}); err != nil {
+			return fmt.Errorf("marshal status spool: %w", err)
+		}
+		records++
+	}
+	for i := range p.events {
+		if err := encoder.Encode(spoolRecord{Event: &p.events[i]}); err != nil {
+			return fmt.Errorf("marshal status spool: %w", err)
+		}
+		records++
+	}
+
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("write status spool: %w", err)
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		return fmt.Errorf("write status spool: %w", err)
+	}
+	p.records = records
+	return nil
+}
+
+// clear removes the spool file once everything has been delivered.
+func (p *SpoolingPublisher) clear() error {
+	p.records = 0
+	if p.path == "" {
+		return nil
+	}
+	if err := os.Remove(p.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove status spool: %w", err)
+	}
+	return nil
+}
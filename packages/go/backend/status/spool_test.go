@@ -0,0 +1,200 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type flakyPublisher struct {
+	down      bool
+	published []SessionStatusEvent
+}
+
+func (p *flakyPublisher) Publish(_ context.Context, event SessionStatusEvent) error {
+	if p.down {
+		return errors.New("connection refused")
+	}
+	p.published = append(p.published, event)
+	return nil
+}
+
+func TestSpoolingPublisherFlushesInOrderAfterRecovery(t *testing.T) {
+	next := &flakyPublisher{down: true}
+	publisher, err := NewSpoolingPublisher(next, 10, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, state := range []string{"one", "two"} {
+		if err := publisher.Publish(ctx, SessionStatusEvent{SessionID: "abc", Stage: "asr", State: state}); err != nil {
+			t.Fatalf("expected spooled publish to succeed, got %v", err)
+		}
+	}
+	if publisher.Pending() != 2 {
+		t.Fatalf("expected 2 pending events, got %d", publisher.Pending())
+	}
+
+	next.down = false
+	if err := publisher.Publish(ctx, SessionStatusEvent{SessionID: "abc", Stage: "asr", State: "three"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if publisher.Pending() != 0 {
+		t.Fatalf("expected spool to drain, got %d pending", publisher.Pending())
+	}
+	if len(next.published) != 3 {
+		t.Fatalf("expected 3 events, got %#v", next.published)
+	}
+	for i, state := range []string{"one", "two", "three"} {
+		if next.published[i].State != state {
+			t.Fatalf("expected %s at %d, got %#v", state, i, next.published)
+		}
+		if next.published[i].Timestamp.IsZero() {
+			t.Fatalf("expected spooled events to keep their original timestamp")
+		}
+	}
+}
+
+func TestSpoolingPublisherReportsGapOnOverflow(t *testing.T) {
+	next := &flakyPublisher{down: true}
+	publisher, err := NewSpoolingPublisher(next, 2, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, event := range []SessionStatusEvent{
+		{SessionID: "abc", Stage: "asr", State: "one"},
+		{SessionID: "other", Stage: "asr", State: "one"},
+		{SessionID: "abc", Stage: "asr", State: "two"},
+	} {
+		if err := publisher.Publish(ctx, event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	next.down = false
+	if err := publisher.Flush(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(next.published) != 3 {
+		t.Fatalf("expected gap plus 2 events, got %#v", next.published)
+	}
+	// The gap is reported just ahead of the session's remaining events.
+	if next.published[0].SessionID != "other" || next.published[2].State != "two" {
+		t.Fatalf("unexpected flush order: %#v", next.published)
+	}
+	gap := next.published[1]
+	if gap.SessionID != "abc" || gap.State != GapState || gap.Code != CodeStatusEventsDropped || gap.Severity != SeverityWarning {
+		t.Fatalf("unexpected gap event: %#v", gap)
+	}
+}
+
+func TestSpoolingPublisherPersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.spool")
+	next := &flakyPublisher{down: true}
+	publisher, err := NewSpoolingPublisher(next, 10, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := publisher.Publish(context.Background(), SessionStatusEvent{SessionID: "abc", Stage: "asr", State: "one"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	next.down = false
+	restarted, err := NewSpoolingPublisher(next, 10, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restarted.Pending() != 1 {
+		t.Fatalf("expected spooled event to be reloaded, got %d", restarted.Pending())
+	}
+	if err := restarted.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(next.published) != 1 || next.published[0].State != "one" {
+		t.Fatalf("unexpected published events: %#v", next.published)
+	}
+
+	again, err := NewSpoolingPublisher(next, 10, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again.Pending() != 0 {
+		t.Fatalf("expected spool file to be cleared after flush, got %d", again.Pending())
+	}
+}
+
+// blockingPublisher holds events for the "slow" session until released.
+type blockingPublisher struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingPublisher) Publish(_ context.Context, event SessionStatusEvent) error {
+	if event.SessionID == "slow" {
+		close(p.entered)
+		<-p.release
+	}
+	return nil
+}
+
+func TestSpoolingPublisherDoesNotHoldLockWhileSending(t *testing.T) {
+	next := &blockingPublisher{entered: make(chan struct{}), release: make(chan struct{})}
+	publisher, err := NewSpoolingPublisher(next, 10, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer close(next.release)
+
+	ctx := context.Background()
+	go func() {
+		_ = publisher.Publish(ctx, SessionStatusEvent{SessionID: "slow", Stage: "asr", State: "one"})
+	}()
+	<-next.entered
+
+	done := make(chan error, 1)
+	go func() {
+		done <- publisher.Publish(ctx, SessionStatusEvent{SessionID: "fast", Stage: "asr", State: "one"})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked behind a slow delivery")
+	}
+}
+
+func TestSpoolingPublisherAppendsToSpoolFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.spool")
+	next := &flakyPublisher{down: true}
+	publisher, err := NewSpoolingPublisher(next, 10, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	var previous []byte
+	for _, state := range []string{"one", "two"} {
+		if err := publisher.Publish(ctx, SessionStatusEvent{SessionID: "abc", Stage: "asr", State: state}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read spool file: %v", err)
+		}
+		if !bytes.HasPrefix(data, previous) || bytes.Count(data, []byte("\n")) != bytes.Count(previous, []byte("\n"))+1 {
+			t.Fatalf("expected one record appended per spooled event, got %q after %q", data, previous)
+		}
+		previous = data
+	}
+}
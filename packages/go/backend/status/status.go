@@ -4,13 +4,50 @@ import "time"
 
 // SessionStatusEvent represents a progress update for a translation session.
 type SessionStatusEvent struct {
-	SessionID string    `json:"sessionId"`
-	Stage     string    `json:"stage"`
-	State     string    `json:"state"`
-	Detail    string    `json:"detail,omitempty"`
-	Timestamp time.Time `json:"timestamp"`
+	// SchemaVersion is the event schema the publisher wrote. Decode events
+	// with DecodeEvent so that older and newer versions are accepted.
+	SchemaVersion int       `json:"schemaVersion,omitempty"`
+	SessionID     string    `json:"sessionId"`
+	Stage         string    `json:"stage"`
+	State         string    `json:"state"`
+	Detail        string    `json:"detail,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+	// Code, Severity, and Retryable describe failures in machine-readable
+	// form. They are empty for ordinary progress events.
+	Code      ErrorCode `json:"code,omitempty"`
+	Severity  Severity  `json:"severity,omitempty"`
+	Retryable bool      `json:"retryable,omitempty"`
+	// Attempt numbers the attempt of the stage the event refers to when the
+	// stage has been retried, starting from 1.
+	Attempt int `json:"attempt,omitempty"`
+	// Language identifies the target-language branch of a multi-language
+	// session the event refers to. Events without it describe the stage as
+	// a whole.
+	Language string `json:"language,omitempty"`
+	// Dropped is the number of items a stage discarded under backpressure
+	// since its previous report.
+	Dropped int64 `json:"dropped,omitempty"`
+	// StreamID is the position of the event in the session's replay buffer.
+	// Clients can pass it back to resume without missing events.
+	StreamID string `json:"streamId,omitempty"`
+	// Sequence numbers a session's events from 1 in publish order. A jump
+	// between consecutive events means the subscriber missed some.
+	Sequence int64 `json:"sequence,omitempty"`
+	// Throughput is attached to heartbeat events.
+	Throughput *Throughput `json:"throughput,omitempty"`
+	// StageDurations holds the milliseconds spent in each pipeline stage. It
+	// is attached to the event that completes the run.
+	StageDurations map[string]int64 `json:"stageDurations,omitempty"`
+	// Comparison is attached to comparison events.
+	Comparison *Comparison `json:"comparison,omitempty"`
+	// Usage holds what the run sent to external providers so far. It is
+	// attached to heartbeat events and to the usage event ending the run.
+	Usage []ProviderUsage `json:"usage,omitempty"`
 }
 
 func channelName(sessionID string) string {
 	return "streamlation:session:" + sessionID + ":status"
 }
+
+// firehosePattern matches the status channel of every session.
+const firehosePattern = "streamlation:session:*:status"
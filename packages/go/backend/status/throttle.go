@@ -0,0 +1,132 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// throttleIdleTTL is how long a session's throttle state is kept after its
+// last event.
+const throttleIdleTTL = time.Minute
+
+// ThrottlingPublisher protects downstream subscribers from chatty pipelines.
+// Per session it drops updates that repeat the previous stage and state and
+// caps the remaining events to a fixed rate using a token bucket. Terminal
+// states and events carrying an error code or a warning-or-worse severity
+// always pass through.
+type ThrottlingPublisher struct {
+	next         Publisher
+	maxPerSecond float64
+	burst        float64
+	now          func() time.Time
+	dropped      atomic.Int64
+
+	mu       sync.Mutex
+	sessions map[string]*throttleState
+	sweptAt  time.Time
+}
+
+type throttleState struct {
+	stage    string
+	state    string
+	language string
+	tokens   float64
+	refillAt time.Time
+}
+
+// NewThrottlingPublisher wraps next, allowing at most maxPerSecond events
+// per session with bursts of the same size. A non-positive limit disables
+// rate limiting but keeps coalescing.
+func NewThrottlingPublisher(next Publisher, maxPerSecond int) *ThrottlingPublisher {
+	return &ThrottlingPublisher{
+		next:         next,
+		maxPerSecond: float64(maxPerSecond),
+		burst:        float64(maxPerSecond),
+		now:          time.Now,
+		sessions:     make(map[string]*throttleState),
+	}
+}
+
+// Publish forwards the event unless it is coalesced or rate limited. Dropped
+// events are not an error.
+func (p *ThrottlingPublisher) Publish(ctx context.Context, event SessionStatusEvent) error {
+	if event.SessionID == "" {
+		return fmt.Errorf("session id required")
+	}
+	if !p.admit(event) {
+		p.dropped.Add(1)
+		return nil
+	}
+	return p.next.Publish(ctx, event)
+}
+
+// Dropped reports how many events have been suppressed so far.
+func (p *ThrottlingPublisher) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+func (p *ThrottlingPublisher) admit(event SessionStatusEvent) bool {
+	now := p.now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sweep(now)
+
+	state, ok := p.sessions[event.SessionID]
+	if !ok {
+		state = &throttleState{tokens: p.burst, refillAt: now}
+		p.sessions[event.SessionID] = state
+	}
+	state.refill(now, p.maxPerSecond, p.burst)
+
+	// Usage reports carry the totals a session is billed for.
+	priority := isTerminalState(event.State) || event.State == UsageState || event.Code != "" ||
+		event.Severity == SeverityWarning || event.Severity == SeverityError || event.Severity == SeverityCritical
+	repeated := ok && event.State != HeartbeatState && event.Stage == state.stage && event.State == state.state && event.Language == state.language
+
+	switch {
+	case priority:
+	case repeated:
+		return false
+	case p.maxPerSecond > 0 && state.tokens < 1:
+		return false
+	}
+
+	if p.maxPerSecond > 0 && state.tokens >= 1 {
+		state.tokens--
+	}
+	state.stage = event.Stage
+	state.state = event.State
+	state.language = event.Language
+	return true
+}
+
+// sweep forgets sessions that have been quiet for throttleIdleTTL. It runs
+// at most once per TTL to keep Publish cheap.
+func (p *ThrottlingPublisher) sweep(now time.Time) {
+	if now.Sub(p.sweptAt) < throttleIdleTTL {
+		return
+	}
+	p.sweptAt = now
+	for id, state := range p.sessions {
+		if now.Sub(state.refillAt) >= throttleIdleTTL {
+			delete(p.sessions, id)
+		}
+	}
+}
+
+func (s *throttleState) refill(now time.Time, perSecond, burst float64) {
+	elapsed := now.Sub(s.refillAt).Seconds()
+	s.refillAt = now
+	if elapsed <= 0 || perSecond <= 0 {
+		return
+	}
+	s.tokens += elapsed * perSecond
+	if s.tokens > burst {
+		s.tokens = burst
+	}
+}
@@ -0,0 +1,91 @@
+package status
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThrottlingPublisherCoalescesRepeatedUpdates(t *testing.T) {
+	var published []SessionStatusEvent
+	next := publisherFunc(func(_ context.Context, event SessionStatusEvent) error {
+		published = append(published, event)
+		return nil
+	})
+	publisher := NewThrottlingPublisher(next, 0)
+
+	ctx := context.Background()
+	for _, event := range []SessionStatusEvent{
+		{SessionID: "abc", Stage: "asr", State: "running", Detail: "chunk 1"},
+		{SessionID: "abc", Stage: "asr", State: "running", Detail: "chunk 2"},
+		{SessionID: "other", Stage: "asr", State: "running"},
+		{SessionID: "abc", Stage: "asr", State: "completed"},
+		{SessionID: "abc", Stage: "pipeline", State: HeartbeatState},
+		{SessionID: "abc", Stage: "pipeline", State: HeartbeatState},
+	} {
+		if err := publisher.Publish(ctx, event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(published) != 5 {
+		t.Fatalf("expected 5 events to pass, got %#v", published)
+	}
+	if publisher.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped event, got %d", publisher.Dropped())
+	}
+}
+
+func TestThrottlingPublisherCapsRateButPassesPriorityEvents(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	count := 0
+	next := publisherFunc(func(context.Context, SessionStatusEvent) error {
+		count++
+		return nil
+	})
+	publisher := NewThrottlingPublisher(next, 2)
+	publisher.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	publish := func(event SessionStatusEvent) {
+		t.Helper()
+		event.SessionID = "abc"
+		if err := publisher.Publish(ctx, event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	publish(SessionStatusEvent{Stage: "asr", State: "chunk-1"})
+	publish(SessionStatusEvent{Stage: "asr", State: "chunk-2"})
+	publish(SessionStatusEvent{Stage: "asr", State: "chunk-3"})
+	if count != 2 {
+		t.Fatalf("expected burst of 2, got %d", count)
+	}
+
+	publish(SessionStatusEvent{Stage: "asr", State: "failed"})
+	publish(SessionStatusEvent{Stage: "pipeline", State: StalledState, Severity: SeverityWarning})
+	publish(SessionStatusEvent{Stage: "pipeline", State: UsageState, Usage: []ProviderUsage{{Stage: "asr", Provider: "grpc", Requests: 1}}})
+	if count != 5 {
+		t.Fatalf("expected terminal, warning, and usage events to bypass the limit, got %d", count)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	publish(SessionStatusEvent{Stage: "translation", State: "running"})
+	if count != 6 {
+		t.Fatalf("expected a token to refill after 500ms, got %d", count)
+	}
+}
+
+func TestThrottlingPublisherForgetsIdleSessions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	publisher := NewThrottlingPublisher(publisherFunc(func(context.Context, SessionStatusEvent) error { return nil }), 1)
+	publisher.now = func() time.Time { return now }
+
+	_ = publisher.Publish(context.Background(), SessionStatusEvent{SessionID: "abc", Stage: "asr", State: "running"})
+	now = now.Add(2 * throttleIdleTTL)
+	_ = publisher.Publish(context.Background(), SessionStatusEvent{SessionID: "other", Stage: "asr", State: "running"})
+
+	if _, ok := publisher.sessions["abc"]; ok {
+		t.Fatal("expected idle session to be swept")
+	}
+}
@@ -0,0 +1,106 @@
+package status
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// UsageState marks the event that reports what a run sent to external
+// providers once it ended, whatever its outcome.
+const UsageState = "usage"
+
+// ProviderUsage is what a session sent to one external provider of a stage,
+// the basis of what the provider bills for it. Which of the measures are
+// set depends on how the provider bills.
+type ProviderUsage struct {
+	Stage    string `json:"stage"`
+	Provider string `json:"provider"`
+	Requests int64  `json:"requests"`
+	// Characters counts the characters of the texts sent for translation.
+	Characters int64 `json:"characters,omitempty"`
+	// InputTokens and OutputTokens are the tokens a language model
+	// reported reading and writing.
+	InputTokens  int64 `json:"inputTokens,omitempty"`
+	OutputTokens int64 `json:"outputTokens,omitempty"`
+	// AudioMs is the length of the audio sent for transcription.
+	AudioMs int64 `json:"audioMs,omitempty"`
+}
+
+// UsageMeter totals the usage of one pipeline run by stage and provider.
+// Providers record into the meter of their run with RecordUsage. All
+// methods are safe on a nil receiver.
+type UsageMeter struct {
+	mu    sync.Mutex
+	usage map[[2]string]*ProviderUsage
+}
+
+// NewUsageMeter returns an empty meter.
+func NewUsageMeter() *UsageMeter {
+	return &UsageMeter{usage: make(map[[2]string]*ProviderUsage)}
+}
+
+// Add adds usage to the totals of its stage and provider.
+func (m *UsageMeter) Add(usage ProviderUsage) {
+	if m == nil {
+		return
+	}
+	key := [2]string{usage.Stage, usage.Provider}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	total, ok := m.usage[key]
+	if !ok {
+		total = &ProviderUsage{Stage: usage.Stage, Provider: usage.Provider}
+		m.usage[key] = total
+	}
+	total.Requests += usage.Requests
+	total.Characters += usage.Characters
+	total.InputTokens += usage.InputTokens
+	total.OutputTokens += usage.OutputTokens
+	total.AudioMs += usage.AudioMs
+}
+
+// Snapshot returns the totals ordered by stage and provider, or nil when
+// nothing was recorded.
+func (m *UsageMeter) Snapshot() []ProviderUsage {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.usage) == 0 {
+		return nil
+	}
+	snapshot := make([]ProviderUsage, 0, len(m.usage))
+	for _, usage := range m.usage {
+		snapshot = append(snapshot, *usage)
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Stage != snapshot[j].Stage {
+			return snapshot[i].Stage < snapshot[j].Stage
+		}
+		return snapshot[i].Provider < snapshot[j].Provider
+	})
+	return snapshot
+}
+
+type usageMeterKey struct{}
+
+// WithUsageMeter returns a context through which the stages of a run
+// started with it record their usage into meter.
+func WithUsageMeter(ctx context.Context, meter *UsageMeter) context.Context {
+	return context.WithValue(ctx, usageMeterKey{}, meter)
+}
+
+// UsageMeterFromContext returns the meter ctx carries, or nil.
+func UsageMeterFromContext(ctx context.Context) *UsageMeter {
+	meter, _ := ctx.Value(usageMeterKey{}).(*UsageMeter)
+	return meter
+}
+
+// RecordUsage adds usage to the meter of the run ctx belongs to, if any.
+func RecordUsage(ctx context.Context, usage ProviderUsage) {
+	UsageMeterFromContext(ctx).Add(usage)
+}
@@ -0,0 +1,32 @@
+package status
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestUsageMeterTotalsByStageAndProvider(t *testing.T) {
+	t.Parallel()
+
+	meter := NewUsageMeter()
+	ctx := WithUsageMeter(context.Background(), meter)
+	RecordUsage(ctx, ProviderUsage{Stage: "translation", Provider: "deepl", Requests: 1, Characters: 40})
+	RecordUsage(ctx, ProviderUsage{Stage: "asr", Provider: "grpc", Requests: 1})
+	RecordUsage(ctx, ProviderUsage{Stage: "asr", Provider: "grpc", AudioMs: 2500})
+	RecordUsage(ctx, ProviderUsage{Stage: "translation", Provider: "deepl", Requests: 1, Characters: 60})
+
+	want := []ProviderUsage{
+		{Stage: "asr", Provider: "grpc", Requests: 1, AudioMs: 2500},
+		{Stage: "translation", Provider: "deepl", Requests: 2, Characters: 100},
+	}
+	if got := meter.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected usage %+v, got %+v", want, got)
+	}
+
+	// Without a meter, usage is dropped.
+	RecordUsage(context.Background(), ProviderUsage{Stage: "asr", Provider: "grpc", Requests: 1})
+	if got := NewUsageMeter().Snapshot(); got != nil {
+		t.Fatalf("expected no usage, got %+v", got)
+	}
+}
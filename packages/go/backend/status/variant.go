@@ -0,0 +1,5 @@
+package status
+
+// VariantSwitchState marks an event reporting that ingestion switched to a
+// lower- or higher-bandwidth variant of an adaptive stream.
+const VariantSwitchState = "variant-switch"
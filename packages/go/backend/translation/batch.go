@@ -0,0 +1,167 @@
+package translation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// batchFunc translates the texts of batch, which share a source language,
+// into targetLang with one provider request, returning the translations in
+// order with the source language the provider detected, if any.
+type batchFunc func(ctx context.Context, batch []asr.Transcript, targetLang string) ([]string, string, error)
+
+// batchStreams translates transcripts into every language of targetLangs
+// in batches: a batch holds up to size transcripts that arrived within wait
+// of the first and share its source language, and each language gets one
+// translate call per batch, concurrently with the others. The translations
+// keep the order of the transcripts. With supersede, a partial transcript
+// still pending when the next transcript arrives is dropped for it. A call
+// that fails ends every language's stream, reported through
+// statuspkg.ReportStageError.
+func batchStreams(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLangs []string, size int, wait time.Duration, supersede bool, translate batchFunc) (map[string]<-chan Translation, error) {
+	targetLangs = uniqueLanguages(targetLangs)
+	if len(targetLangs) == 0 {
+		return nil, errors.New("no target languages")
+	}
+	outs := make(map[string]chan Translation, len(targetLangs))
+	results := make(map[string]<-chan Translation, len(targetLangs))
+	for _, language := range targetLangs {
+		outs[language] = make(chan Translation)
+		results[language] = outs[language]
+	}
+
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+
+		var (
+			pending []asr.Transcript
+			ready   <-chan time.Time
+			timer   *time.Timer
+		)
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		flush := func() bool {
+			if len(pending) == 0 {
+				return true
+			}
+			batch := pending
+			pending, ready = nil, nil
+
+			var (
+				wg       sync.WaitGroup
+				failOnce sync.Once
+				failure  error
+			)
+			for language, out := range outs {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := emitBatch(ctx, sessionID, batch, language, translate, out); err != nil {
+						failOnce.Do(func() { failure = err })
+					}
+				}()
+			}
+			wg.Wait()
+			if failure != nil {
+				if ctx.Err() == nil {
+					statuspkg.ReportStageError(ctx, failure)
+				}
+				return false
+			}
+			return ctx.Err() == nil
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ready:
+				if !flush() {
+					return
+				}
+			case transcript, ok := <-transcripts:
+				if !ok {
+					flush()
+					return
+				}
+				if strings.TrimSpace(transcript.Text) == "" {
+					continue
+				}
+				if supersede && len(pending) > 0 && pending[len(pending)-1].Partial {
+					pending = pending[:len(pending)-1]
+				}
+				if len(pending) > 0 && pending[0].Language != transcript.Language && !flush() {
+					return
+				}
+				pending = append(pending, transcript)
+				if len(pending) >= size {
+					if !flush() {
+						return
+					}
+					continue
+				}
+				// The wait runs from the first transcript of the batch, even
+				// if it was superseded since.
+				if ready == nil {
+					if timer == nil {
+						timer = time.NewTimer(wait)
+					} else {
+						if !timer.Stop() {
+							select {
+							case <-timer.C:
+							default:
+							}
+						}
+						timer.Reset(wait)
+					}
+					ready = timer.C
+				}
+			}
+		}
+	}()
+	return results, nil
+}
+
+// emitBatch translates batch into targetLang and sends the translations to
+// out, in order.
+func emitBatch(ctx context.Context, sessionID string, batch []asr.Transcript, targetLang string, translate batchFunc, out chan<- Translation) error {
+	translated, detected, err := translate(ctx, batch, targetLang)
+	if err != nil {
+		return err
+	}
+	for i, transcript := range batch {
+		sourceLang := transcript.Language
+		if sourceLang == "" {
+			sourceLang = detected
+		}
+		select {
+		case out <- Translation{
+			SourceText:     transcript.Text,
+			TranslatedText: translated[i],
+			SourceLang:     sourceLang,
+			TargetLang:     targetLang,
+			StartTime:      transcript.StartTime,
+			EndTime:        transcript.EndTime,
+			SessionID:      sessionID,
+			Partial:        transcript.Partial,
+			Speaker:        transcript.Speaker,
+		}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
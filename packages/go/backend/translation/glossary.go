@@ -0,0 +1,212 @@
+package translation
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"streamlation/packages/backend/asr"
+)
+
+// GlossaryTerm is the translation a source term must get. A term whose
+// Target equals its Source is kept as it is.
+type GlossaryTerm struct {
+	Source string
+	Target string
+}
+
+// Glossary enforces the translations of terms in one target language.
+// Terms match whole words, regardless of case, longer terms first.
+type Glossary struct {
+	terms   []GlossaryTerm
+	index   map[string]int
+	pattern *regexp.Regexp
+}
+
+// placeholderPattern matches the placeholders Protect puts in place of
+// terms, allowing for the spaces translators tend to add inside them.
+var placeholderPattern = regexp.MustCompile(`⟦\s*(\d+)\s*⟧`)
+
+// NewGlossary returns a glossary of terms, or nil when there are none.
+// Of terms with the same source, the last one wins.
+func NewGlossary(terms []GlossaryTerm) *Glossary {
+	g := &Glossary{index: make(map[string]int)}
+	for _, term := range terms {
+		if strings.TrimSpace(term.Source) == "" {
+			continue
+		}
+		key := strings.ToLower(term.Source)
+		if i, ok := g.index[key]; ok {
+			g.terms[i] = term
+			continue
+		}
+		g.index[key] = len(g.terms)
+		g.terms = append(g.terms, term)
+	}
+	if len(g.terms) == 0 {
+		return nil
+	}
+	alternatives := make([]string, len(g.terms))
+	for i, term := range g.terms {
+		alternatives[i] = regexp.QuoteMeta(term.Source)
+	}
+	// Alternatives match leftmost-first, so longer terms go first.
+	sort.SliceStable(alternatives, func(i, j int) bool { return len(alternatives[i]) > len(alternatives[j]) })
+	g.pattern = regexp.MustCompile(`(?i)` + strings.Join(alternatives, "|"))
+	return g
+}
+
+// Terms returns the terms of the glossary.
+func (g *Glossary) Terms() []GlossaryTerm {
+	if g == nil {
+		return nil
+	}
+	return g.terms
+}
+
+// Protect replaces the terms in text with placeholders that translators
+// carry through unchanged, so that Restore can put the translations of the
+// terms in their place.
+func (g *Glossary) Protect(text string) string {
+	if g == nil {
+		return text
+	}
+	var protected strings.Builder
+	last := 0
+	for _, match := range g.pattern.FindAllStringIndex(text, -1) {
+		start, end := match[0], match[1]
+		if !wordBoundary(text, start, end) {
+			continue
+		}
+		i, ok := g.index[strings.ToLower(text[start:end])]
+		if !ok {
+			continue
+		}
+		protected.WriteString(text[last:start])
+		protected.WriteString("⟦" + strconv.Itoa(i) + "⟧")
+		last = end
+	}
+	if last == 0 {
+		return text
+	}
+	protected.WriteString(text[last:])
+	return protected.String()
+}
+
+// Restore replaces the placeholders of Protect in a translation with the
+// translations of their terms.
+func (g *Glossary) Restore(text string) string {
+	return g.restore(text, func(term GlossaryTerm) string { return term.Target })
+}
+
+// RestoreSource replaces the placeholders of Protect with their source
+// terms.
+func (g *Glossary) RestoreSource(text string) string {
+	return g.restore(text, func(term GlossaryTerm) string { return term.Source })
+}
+
+func (g *Glossary) restore(text string, replacement func(GlossaryTerm) string) string {
+	if g == nil || !strings.Contains(text, "⟦") {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		i, err := strconv.Atoi(placeholderPattern.FindStringSubmatch(placeholder)[1])
+		if err != nil || i >= len(g.terms) {
+			return placeholder
+		}
+		return replacement(g.terms[i])
+	})
+}
+
+// wordBoundary reports whether text[start:end] is a whole word or phrase:
+// neither of its ends continues a word of text.
+func wordBoundary(text string, start, end int) bool {
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isWord(before) {
+		return false
+	}
+	if after, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWord(after) {
+		return false
+	}
+	return true
+}
+
+// GlossaryTranslator is implemented by translators that apply a glossary
+// themselves, such as by instructing a language model, rather than having
+// its terms protected around them.
+type GlossaryTranslator interface {
+	Translator
+	// TranslateStreamGlossary is TranslateStream with the translations of
+	// glossary's terms enforced.
+	TranslateStreamGlossary(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string, glossary *Glossary) (<-chan Translation, error)
+}
+
+// TranslateWithGlossary streams the translations of transcripts by
+// translator with the terms of glossary, which may be nil, enforced. A
+// GlossaryTranslator applies the glossary itself. Around other
+// translators, the terms of transcripts are replaced with placeholders
+// before translation, and the placeholders of translations with the
+// translations of the terms.
+func TranslateWithGlossary(ctx context.Context, translator Translator, sessionID string, transcripts <-chan asr.Transcript, targetLang string, glossary *Glossary) (<-chan Translation, error) {
+	if glossary == nil {
+		return translator.TranslateStream(ctx, sessionID, transcripts, targetLang)
+	}
+	if native, ok := translator.(GlossaryTranslator); ok {
+		return native.TranslateStreamGlossary(ctx, sessionID, transcripts, targetLang, glossary)
+	}
+
+	protected := make(chan asr.Transcript)
+	translations, err := translator.TranslateStream(ctx, sessionID, protected, targetLang)
+	if err != nil {
+		return nil, err
+	}
+	// done is closed once the translator stopped, so that transcripts are
+	// no longer offered to it.
+	done := make(chan struct{})
+	go func() {
+		defer close(protected)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case transcript, ok := <-transcripts:
+				if !ok {
+					return
+				}
+				transcript.Text = glossary.Protect(transcript.Text)
+				select {
+				case protected <- transcript:
+				case <-ctx.Done():
+					return
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	out := make(chan Translation)
+	go func() {
+		defer close(out)
+		defer close(done)
+		for translated := range translations {
+			translated.SourceText = glossary.RestoreSource(translated.SourceText)
+			translated.TranslatedText = glossary.Restore(translated.TranslatedText)
+			select {
+			case out <- translated:
+			case <-ctx.Done():
+				// Drain so that the translator can finish.
+				for range translations {
+				}
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,104 @@
+package translation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"streamlation/packages/backend/asr"
+)
+
+func TestGlossaryProtectsWholeTerms(t *testing.T) {
+	t.Parallel()
+
+	glossary := NewGlossary([]GlossaryTerm{
+		{Source: "live", Target: "en directo"},
+		{Source: "live stream", Target: "directo"},
+		{Source: "Streamlation", Target: "Streamlation"},
+	})
+
+	protected := glossary.Protect("Watch the LIVE STREAM of streamlation, delivered live. Deliverable.")
+	if want := "Watch the ⟦1⟧ of ⟦2⟧, delivered ⟦0⟧. Deliverable."; protected != want {
+		t.Fatalf("expected %q, got %q", want, protected)
+	}
+	if restored := glossary.Restore("Mira el ⟦ 1 ⟧ de ⟦2⟧, entregado ⟦0⟧. ⟦9⟧"); restored != "Mira el directo de Streamlation, entregado en directo. ⟦9⟧" {
+		t.Fatalf("unexpected restored translation %q", restored)
+	}
+	if source := glossary.RestoreSource(protected); source != "Watch the live stream of Streamlation, delivered live. Deliverable." {
+		t.Fatalf("unexpected restored source %q", source)
+	}
+
+	if NewGlossary([]GlossaryTerm{{Source: " ", Target: "x"}}) != nil {
+		t.Fatal("expected a glossary without terms to be nil")
+	}
+	var none *Glossary
+	if none.Protect("live") != "live" || none.Restore("⟦0⟧") != "⟦0⟧" {
+		t.Fatal("expected a nil glossary to leave text as it is")
+	}
+}
+
+func TestTranslateWithGlossaryProtectsTermsAroundTranslators(t *testing.T) {
+	t.Parallel()
+
+	translator := NewStubTranslator(&StubTranslatorConfig{Dictionary: map[string]map[string]string{
+		"es": {"Welcome to ⟦0⟧ on ⟦1⟧.": "Bienvenidos a ⟦0⟧ en ⟦1⟧."},
+	}})
+	glossary := NewGlossary([]GlossaryTerm{{Source: "Streamlation", Target: "Streamlation"}, {Source: "live TV", Target: "la tele en directo"}})
+
+	transcripts := make(chan asr.Transcript, 2)
+	transcripts <- asr.Transcript{Text: "Welcome to Streamlation on live TV."}
+	transcripts <- asr.Transcript{Text: "Goodbye."}
+	close(transcripts)
+	out, err := TranslateWithGlossary(context.Background(), translator, "session", transcripts, "es", glossary)
+	if err != nil {
+		t.Fatalf("TranslateWithGlossary: %v", err)
+	}
+	var translated []Translation
+	for translation := range out {
+		translated = append(translated, translation)
+	}
+
+	if len(translated) != 2 {
+		t.Fatalf("expected 2 translations, got %+v", translated)
+	}
+	if translated[0].TranslatedText != "Bienvenidos a Streamlation en la tele en directo." || translated[0].SourceText != "Welcome to Streamlation on live TV." {
+		t.Fatalf("unexpected translation %+v", translated[0])
+	}
+	if translated[1].TranslatedText != "[es] Goodbye." {
+		t.Fatalf("unexpected translation %+v", translated[1])
+	}
+}
+
+// glossaryRecorder is a GlossaryTranslator recording the glossary it got.
+type glossaryRecorder struct {
+	*StubTranslator
+	glossary *Glossary
+}
+
+func (r *glossaryRecorder) TranslateStreamGlossary(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string, glossary *Glossary) (<-chan Translation, error) {
+	r.glossary = glossary
+	return r.TranslateStream(ctx, sessionID, transcripts, targetLang)
+}
+
+func TestTranslateWithGlossaryLeavesGlossaryTranslatorsToApplyIt(t *testing.T) {
+	t.Parallel()
+
+	translator := &glossaryRecorder{StubTranslator: NewStubTranslator(nil)}
+	glossary := NewGlossary([]GlossaryTerm{{Source: "live", Target: "en directo"}})
+
+	transcripts := make(chan asr.Transcript, 1)
+	transcripts <- asr.Transcript{Text: "We are live."}
+	close(transcripts)
+	out, err := TranslateWithGlossary(context.Background(), translator, "session", transcripts, "es", glossary)
+	if err != nil {
+		t.Fatalf("TranslateWithGlossary: %v", err)
+	}
+	for translation := range out {
+		if strings.Contains(translation.TranslatedText, "⟦") {
+			t.Fatalf("expected no placeholders, got %q", translation.TranslatedText)
+		}
+	}
+	if translator.glossary != glossary {
+		t.Fatal("expected the translator to get the glossary")
+	}
+}
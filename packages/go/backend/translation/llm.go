@@ -0,0 +1,571 @@
+package translation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/provider"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// Chat APIs an LLMTranslator can call.
+const (
+	LLMAPIOpenAI    = "openai"
+	LLMAPIAnthropic = "anthropic"
+)
+
+// Defaults of LLMConfig.
+const (
+	// DefaultLLMContext is how many prior segments a request carries.
+	DefaultLLMContext = 8
+	// DefaultLLMMaxTokens bounds the length of a translation.
+	DefaultLLMMaxTokens = 1024
+	// DefaultLLMBatchWait is how long a batched segment waits for others.
+	DefaultLLMBatchWait = 250 * time.Millisecond
+)
+
+// anthropicVersion is the version of the Anthropic Messages API the
+// requests use.
+const anthropicVersion = "2023-06-01"
+
+// LLMConfig configures an LLMTranslator. Zero values fall back to the
+// defaults.
+type LLMConfig struct {
+	// API is the chat API the endpoint implements: LLMAPIOpenAI, for
+	// /chat/completions, or LLMAPIAnthropic, for /messages. Defaults to
+	// LLMAPIOpenAI.
+	API string
+	// Endpoint is the base URL of the API, such as
+	// "https://api.openai.com/v1". Defaults to the public API of the
+	// provider.
+	Endpoint string
+	// APIKey authenticates the requests.
+	APIKey string
+	// Model is the model requested. It is required.
+	Model string
+	// Context is how many prior segments of the stream, with their
+	// translations, each request carries. Defaults to DefaultLLMContext; a
+	// negative value translates every segment on its own.
+	Context int
+	// Instructions are added to the system prompt, such as a style guide
+	// for the translations.
+	Instructions string
+	// Formality is the register to translate into, FormalityFormal or
+	// FormalityInformal. Empty leaves it to the model.
+	Formality string
+	// MaxTokens bounds the length of a translation. Defaults to
+	// DefaultLLMMaxTokens.
+	MaxTokens int
+	// Pairs lists the language pairs SupportedLanguages reports. The
+	// models translate between most languages, so it may be left empty.
+	Pairs []LanguagePair
+	// Client sends the requests. Defaults to a client with a one minute
+	// timeout.
+	Client *http.Client
+	// Batch bounds the segments of a stream translated by one request, and
+	// BatchWait how long the first segment of a request waits for others to
+	// join it. Batch defaults to 1, a request per segment; BatchWait
+	// defaults to DefaultLLMBatchWait.
+	Batch     int
+	BatchWait time.Duration
+	// Limiter paces, bounds, and retries the requests, and stops sending
+	// them while the provider keeps failing. Translators using one API key
+	// should share one. Nil sends requests as soon as segments are ready.
+	Limiter *provider.Limiter
+}
+
+// LLMTranslator translates with a large language model behind an
+// OpenAI-compatible or Anthropic-compatible chat API.
+//
+// Unlike sentence-by-sentence machine translation, each request of a
+// stream carries the last cfg.Context final segments and their
+// translations as prior turns of the conversation, so that the model
+// resolves pronouns and ellipsis from what was said before and keeps
+// names, terms, and register consistent across the stream. A glossary
+// given to TranslateStreamGlossary is added to the instructions. Partial
+// transcripts are translated without joining the context, and a partial
+// that a newer transcript superseded before its request started is
+// dropped, so that a slow model does not fall behind on partials.
+//
+// With cfg.Batch above 1, a request carries up to cfg.Batch segments that
+// arrived within cfg.BatchWait of the first as a JSON array, and the model
+// answers with an array of their translations, cutting the overhead of a
+// request per segment on busy streams. An answer that does not hold one
+// translation per segment is discarded, and its segments are translated one
+// by one instead.
+//
+// Requests that fail with a rate limit, a server error, or a network error
+// are retried. A request that keeps failing, or fails otherwise, such as
+// for a rejected API key, ends the stream with TRANSLATION_FAILED,
+// reported through statuspkg.ReportStageError and marked retryable when
+// the failure may pass.
+type LLMTranslator struct {
+	cfg LLMConfig
+	url string
+
+	mu      sync.RWMutex
+	lastErr error
+}
+
+// llmTurn is a prior segment of the stream with its translation.
+type llmTurn struct {
+	source, translated string
+}
+
+// NewLLMTranslator returns a translator calling the chat API cfg names.
+func NewLLMTranslator(cfg LLMConfig) (*LLMTranslator, error) {
+	var path string
+	switch cfg.API {
+	case "", LLMAPIOpenAI:
+		cfg.API = LLMAPIOpenAI
+		path = "/chat/completions"
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = "https://api.openai.com/v1"
+		}
+	case LLMAPIAnthropic:
+		path = "/messages"
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = "https://api.anthropic.com/v1"
+		}
+	default:
+		return nil, fmt.Errorf("unknown chat API %q", cfg.API)
+	}
+	if cfg.Model == "" {
+		return nil, errors.New("translation model is required")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "https" && endpoint.Scheme != "http") {
+		return nil, fmt.Errorf("invalid translation endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: time.Minute}
+	}
+	switch {
+	case cfg.Context < 0:
+		cfg.Context = 0
+	case cfg.Context == 0:
+		cfg.Context = DefaultLLMContext
+	}
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = DefaultLLMMaxTokens
+	}
+	if cfg.Batch <= 0 {
+		cfg.Batch = 1
+	}
+	if cfg.BatchWait <= 0 {
+		cfg.BatchWait = DefaultLLMBatchWait
+	}
+	return &LLMTranslator{cfg: cfg, url: strings.TrimSuffix(endpoint.String(), "/") + path}, nil
+}
+
+// Translate translates a single text without context.
+func (l *LLMTranslator) Translate(ctx context.Context, text string, sourceLang, targetLang string) (Translation, error) {
+	translated, err := l.translate(ctx, nil, nil, text, sourceLang, targetLang)
+	if err != nil {
+		return Translation{}, err
+	}
+	return Translation{SourceText: text, TranslatedText: translated, SourceLang: sourceLang, TargetLang: targetLang}, nil
+}
+
+// TranslateStream translates the transcripts one after another, each with
+// the segments before it as context.
+func (l *LLMTranslator) TranslateStream(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string) (<-chan Translation, error) {
+	return l.TranslateStreamGlossary(ctx, sessionID, transcripts, targetLang, nil)
+}
+
+// TranslateStreamGlossary is TranslateStream instructing the model to
+// translate the terms of glossary, which may be nil, as it lists them.
+func (l *LLMTranslator) TranslateStreamGlossary(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string, glossary *Glossary) (<-chan Translation, error) {
+	if l.cfg.Batch > 1 {
+		return l.translateStreamBatched(ctx, sessionID, transcripts, targetLang, glossary)
+	}
+	out := make(chan Translation)
+	go func() {
+		defer close(out)
+
+		var history []llmTurn
+		for {
+			var (
+				transcript asr.Transcript
+				ok         bool
+			)
+			select {
+			case <-ctx.Done():
+				return
+			case transcript, ok = <-transcripts:
+				if !ok {
+					return
+				}
+			}
+			closed := false
+		supersede:
+			for transcript.Partial {
+				select {
+				case next, ok := <-transcripts:
+					if !ok {
+						closed = true
+						break supersede
+					}
+					transcript = next
+				default:
+					break supersede
+				}
+			}
+			if strings.TrimSpace(transcript.Text) == "" {
+				if closed {
+					return
+				}
+				continue
+			}
+
+			translated, err := l.translate(ctx, glossary, history, transcript.Text, transcript.Language, targetLang)
+			if err != nil {
+				if ctx.Err() == nil {
+					statuspkg.ReportStageError(ctx, err)
+				}
+				return
+			}
+			if !transcript.Partial {
+				history = l.remember(history, llmTurn{source: transcript.Text, translated: translated})
+			}
+			select {
+			case out <- Translation{
+				SourceText:     transcript.Text,
+				TranslatedText: translated,
+				SourceLang:     transcript.Language,
+				TargetLang:     targetLang,
+				StartTime:      transcript.StartTime,
+				EndTime:        transcript.EndTime,
+				SessionID:      sessionID,
+				Partial:        transcript.Partial,
+				Speaker:        transcript.Speaker,
+			}:
+			case <-ctx.Done():
+				return
+			}
+			if closed {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// translateStreamBatched is TranslateStreamGlossary translating the
+// transcripts in batches.
+func (l *LLMTranslator) translateStreamBatched(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string, glossary *Glossary) (<-chan Translation, error) {
+	// The batches of the one language are translated one after another.
+	var history []llmTurn
+	outs, err := batchStreams(ctx, sessionID, transcripts, []string{targetLang}, l.cfg.Batch, l.cfg.BatchWait, true, func(ctx context.Context, batch []asr.Transcript, targetLang string) ([]string, string, error) {
+		texts := make([]string, len(batch))
+		for i, transcript := range batch {
+			texts[i] = transcript.Text
+		}
+		translated, err := l.translateBatch(ctx, glossary, history, texts, batch[0].Language, targetLang)
+		if err != nil {
+			return nil, "", err
+		}
+		for i, transcript := range batch {
+			if !transcript.Partial {
+				history = l.remember(history, llmTurn{source: transcript.Text, translated: translated[i]})
+			}
+		}
+		return translated, "", nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return outs[targetLang], nil
+}
+
+// remember returns history with turn appended, keeping the last
+// cfg.Context turns.
+func (l *LLMTranslator) remember(history []llmTurn, turn llmTurn) []llmTurn {
+	if l.cfg.Context == 0 {
+		return nil
+	}
+	history = append(history, turn)
+	if len(history) > l.cfg.Context {
+		history = history[len(history)-l.cfg.Context:]
+	}
+	return history
+}
+
+// SupportedLanguages returns the configured language pairs.
+func (l *LLMTranslator) SupportedLanguages() []LanguagePair {
+	return l.cfg.Pairs
+}
+
+// Health reports the outcome of the most recent request.
+func (l *LLMTranslator) Health() HealthStatus {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.lastErr != nil {
+		return HealthStatus{Message: l.lastErr.Error()}
+	}
+	return HealthStatus{Healthy: true, Message: "translating with " + l.cfg.Model + " at " + l.cfg.Endpoint}
+}
+
+// translate translates text following history through the limiter.
+func (l *LLMTranslator) translate(ctx context.Context, glossary *Glossary, history []llmTurn, text, sourceLang, targetLang string) (string, error) {
+	body, err := l.encode(glossary, history, []string{text}, sourceLang, targetLang)
+	if err != nil {
+		return "", &statuspkg.StageError{Code: statuspkg.CodeTranslationFailed, Err: fmt.Errorf("encode translation request: %w", err)}
+	}
+	return l.send(ctx, body)
+}
+
+// translateBatch translates texts following history with one request,
+// falling back to a request per text when the answer does not split into
+// their translations.
+func (l *LLMTranslator) translateBatch(ctx context.Context, glossary *Glossary, history []llmTurn, texts []string, sourceLang, targetLang string) ([]string, error) {
+	if len(texts) > 1 {
+		body, err := l.encode(glossary, history, texts, sourceLang, targetLang)
+		if err != nil {
+			return nil, &statuspkg.StageError{Code: statuspkg.CodeTranslationFailed, Err: fmt.Errorf("encode translation request: %w", err)}
+		}
+		answer, err := l.send(ctx, body)
+		if err != nil {
+			return nil, err
+		}
+		if translated, ok := splitBatch(answer, len(texts)); ok {
+			return translated, nil
+		}
+	}
+	translated := make([]string, len(texts))
+	for i, text := range texts {
+		var err error
+		if translated[i], err = l.translate(ctx, glossary, history, text, sourceLang, targetLang); err != nil {
+			return nil, err
+		}
+	}
+	return translated, nil
+}
+
+// splitBatch returns the translations of count segments the answer to a
+// batched request holds, and whether it holds exactly one for each.
+func splitBatch(answer string, count int) ([]string, bool) {
+	// Models tend to fence JSON even when asked not to.
+	answer = strings.TrimSpace(answer)
+	if fenced, ok := strings.CutPrefix(answer, "```"); ok {
+		fenced = strings.TrimPrefix(fenced, "json")
+		answer = strings.TrimSpace(strings.TrimSuffix(fenced, "```"))
+	}
+	var translated []string
+	if err := json.Unmarshal([]byte(answer), &translated); err != nil || len(translated) != count {
+		return nil, false
+	}
+	for i, text := range translated {
+		if translated[i] = strings.TrimSpace(text); translated[i] == "" {
+			return nil, false
+		}
+	}
+	return translated, true
+}
+
+// send sends the request body through the limiter and returns the model's
+// answer.
+func (l *LLMTranslator) send(ctx context.Context, body []byte) (string, error) {
+	var translated string
+	err := l.cfg.Limiter.Do(ctx, func(ctx context.Context) (time.Duration, error) {
+		var (
+			retryAfter time.Duration
+			err        error
+		)
+		translated, retryAfter, err = l.post(ctx, body)
+		l.mu.Lock()
+		l.lastErr = err
+		l.mu.Unlock()
+		return retryAfter, err
+	})
+	if err != nil {
+		return "", err
+	}
+	return translated, nil
+}
+
+// systemPrompt returns the instructions of a request translating from
+// sourceLang, which may be unknown, into targetLang with glossary, with
+// batched messages when batch is set.
+func (l *LLMTranslator) systemPrompt(glossary *Glossary, sourceLang, targetLang string, batch bool) string {
+	source := "the language it is in"
+	if sourceLang != "" {
+		source = fmt.Sprintf("ISO 639-1 language %q", sourceLang)
+	}
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "You translate the transcript of live speech from %s into ISO 639-1 language %q. ", source, targetLang)
+	if batch {
+		prompt.WriteString("Each message is a JSON array of the next segments of the transcript; earlier segments and their translations are context. ")
+		prompt.WriteString("Keep names, terms, and register consistent with the earlier translations, and resolve references from them. ")
+		prompt.WriteString("Reply with a JSON array of the translations of the segments only, one string for each segment in their order, without notes or explanations.")
+	} else {
+		prompt.WriteString("Each message is the next segment of the transcript; earlier segments and their translations are context. ")
+		prompt.WriteString("Keep names, terms, and register consistent with the earlier translations, and resolve references from them. ")
+		prompt.WriteString("Reply with the translation of the message only, without quotes, notes, or explanations.")
+	}
+	switch l.cfg.Formality {
+	case FormalityFormal:
+		prompt.WriteString("\n\nAddress the audience formally, using the polite forms of address of the target language, such as \"Sie\" or \"vous\", where it has them.")
+	case FormalityInformal:
+		prompt.WriteString("\n\nAddress the audience informally, using the familiar forms of address of the target language, such as \"du\" or \"tu\", where it has them.")
+	}
+	if terms := glossary.Terms(); len(terms) > 0 {
+		prompt.WriteString("\n\nTranslate these terms exactly as given, whatever their case, and keep terms given unchanged as they are:")
+		for _, term := range terms {
+			fmt.Fprintf(&prompt, "\n%s => %s", term.Source, term.Target)
+		}
+	}
+	if l.cfg.Instructions != "" {
+		prompt.WriteString("\n\n")
+		prompt.WriteString(l.cfg.Instructions)
+	}
+	return prompt.String()
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// encode returns the body of a request translating texts in the format of
+// the API, with history as the prior turns of the conversation. Several
+// texts are batched as a JSON array, and so are the turns of history then.
+func (l *LLMTranslator) encode(glossary *Glossary, history []llmTurn, texts []string, sourceLang, targetLang string) ([]byte, error) {
+	batch := len(texts) > 1
+	content := func(texts ...string) (string, error) {
+		if !batch {
+			return texts[0], nil
+		}
+		encoded, err := json.Marshal(texts)
+		return string(encoded), err
+	}
+
+	system := l.systemPrompt(glossary, sourceLang, targetLang, batch)
+	messages := make([]chatMessage, 0, 2*len(history)+2)
+	if l.cfg.API == LLMAPIOpenAI {
+		messages = append(messages, chatMessage{Role: "system", Content: system})
+	}
+	for _, turn := range history {
+		source, err := content(turn.source)
+		if err != nil {
+			return nil, err
+		}
+		translated, err := content(turn.translated)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, chatMessage{Role: "user", Content: source}, chatMessage{Role: "assistant", Content: translated})
+	}
+	text, err := content(texts...)
+	if err != nil {
+		return nil, err
+	}
+	messages = append(messages, chatMessage{Role: "user", Content: text})
+
+	if l.cfg.API == LLMAPIAnthropic {
+		return json.Marshal(map[string]any{"model": l.cfg.Model, "system": system, "messages": messages, "max_tokens": l.cfg.MaxTokens})
+	}
+	return json.Marshal(map[string]any{"model": l.cfg.Model, "messages": messages, "max_tokens": l.cfg.MaxTokens})
+}
+
+// post sends one translation request. Along with a failure it returns how
+// long the provider asked to wait before retrying, if it did.
+func (l *LLMTranslator) post(ctx context.Context, body []byte) (string, time.Duration, error) {
+	fail := func(retryable bool, err error) (string, time.Duration, error) {
+		return "", 0, &statuspkg.StageError{Code: statuspkg.CodeTranslationFailed, Retryable: retryable, Err: err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, bytes.NewReader(body))
+	if err != nil {
+		return fail(false, fmt.Errorf("create translation request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.cfg.API == LLMAPIAnthropic {
+		req.Header.Set("anthropic-version", anthropicVersion)
+		if l.cfg.APIKey != "" {
+			req.Header.Set("x-api-key", l.cfg.APIKey)
+		}
+	} else if l.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+l.cfg.APIKey)
+	}
+	resp, err := l.cfg.Client.Do(req)
+	if err != nil {
+		return fail(true, fmt.Errorf("send translation request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		// Anthropic reports an overloaded API with 529.
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return "", retryAfter, &statuspkg.StageError{
+			Code:      statuspkg.CodeTranslationFailed,
+			Retryable: retryable,
+			Err:       fmt.Errorf("translation request: %s: %s", resp.Status, strings.TrimSpace(string(detail))),
+		}
+	}
+
+	var (
+		translated string
+		usage      = statuspkg.ProviderUsage{Stage: "translation", Provider: l.cfg.API + "/" + l.cfg.Model, Requests: 1}
+	)
+	if l.cfg.API == LLMAPIAnthropic {
+		var result struct {
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+			Usage struct {
+				InputTokens  int64 `json:"input_tokens"`
+				OutputTokens int64 `json:"output_tokens"`
+			} `json:"usage"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		for _, block := range result.Content {
+			if block.Type == "text" {
+				translated += block.Text
+			}
+		}
+		usage.InputTokens, usage.OutputTokens = result.Usage.InputTokens, result.Usage.OutputTokens
+	} else {
+		var result struct {
+			Choices []struct {
+				Message chatMessage `json:"message"`
+			} `json:"choices"`
+			Usage struct {
+				PromptTokens     int64 `json:"prompt_tokens"`
+				CompletionTokens int64 `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		if len(result.Choices) > 0 {
+			translated = result.Choices[0].Message.Content
+		}
+		usage.InputTokens, usage.OutputTokens = result.Usage.PromptTokens, result.Usage.CompletionTokens
+	}
+	if err != nil {
+		return fail(true, fmt.Errorf("decode translation response: %w", err))
+	}
+	// The model was billed for the request even if its answer is unusable.
+	statuspkg.RecordUsage(ctx, usage)
+	translated = strings.TrimSpace(translated)
+	if translated == "" {
+		return fail(true, errors.New("translation response: empty translation"))
+	}
+	return translated, 0, nil
+}
@@ -0,0 +1,336 @@
+package translation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/provider"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// chatRequest is the part of a chat request the tests inspect.
+type chatRequest struct {
+	Model     string        `json:"model"`
+	System    string        `json:"system"`
+	Messages  []chatMessage `json:"messages"`
+	MaxTokens int           `json:"max_tokens"`
+}
+
+func TestLLMTranslatorCarriesPriorSegmentsAsContext(t *testing.T) {
+	t.Parallel()
+
+	var requests []chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request chatRequest
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer secret" || json.NewDecoder(r.Body).Decode(&request) != nil {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, request)
+		last := request.Messages[len(request.Messages)-1].Content
+		_ = json.NewEncoder(w).Encode(map[string]any{"choices": []any{map[string]any{"message": chatMessage{Role: "assistant", Content: " " + strings.ToUpper(last) + "\n"}}}})
+	}))
+	defer server.Close()
+
+	translator, err := NewLLMTranslator(LLMConfig{Endpoint: server.URL + "/v1/", APIKey: "secret", Model: "gpt-test", Context: 2, Instructions: "Use informal address."})
+	if err != nil {
+		t.Fatalf("NewLLMTranslator: %v", err)
+	}
+
+	transcripts := make(chan asr.Transcript)
+	out, err := translator.TranslateStream(context.Background(), "session", transcripts, "de")
+	if err != nil {
+		t.Fatalf("TranslateStream: %v", err)
+	}
+	var translated []string
+	for _, transcript := range []asr.Transcript{
+		{Text: "one", Language: "en"},
+		{Text: "tw", Language: "en", Partial: true},
+		{Text: "two", Language: "en"},
+		{Text: "three", Language: "en"},
+		{Text: "four", Language: "en", Speaker: "S1"},
+	} {
+		transcripts <- transcript
+		translation := <-out
+		if translation.SessionID != "session" || translation.SourceLang != "en" || translation.TargetLang != "de" || translation.Partial != transcript.Partial || translation.Speaker != transcript.Speaker {
+			t.Fatalf("unexpected translation %+v", translation)
+		}
+		translated = append(translated, translation.TranslatedText)
+	}
+	close(transcripts)
+	if _, ok := <-out; ok {
+		t.Fatal("expected the stream to end")
+	}
+
+	if want := []string{"ONE", "TW", "TWO", "THREE", "FOUR"}; !reflect.DeepEqual(translated, want) {
+		t.Fatalf("expected translations %v, got %v", want, translated)
+	}
+	system := requests[0].Messages[0]
+	if system.Role != "system" || !strings.Contains(system.Content, `"en"`) || !strings.Contains(system.Content, `"de"`) || !strings.HasSuffix(system.Content, "Use informal address.") {
+		t.Fatalf("unexpected system prompt %+v", system)
+	}
+	// The partial does not join the context, and only the last two final
+	// segments do.
+	last := requests[4].Messages[1:]
+	want := []chatMessage{{"user", "two"}, {"assistant", "TWO"}, {"user", "three"}, {"assistant", "THREE"}, {"user", "four"}}
+	if !reflect.DeepEqual(last, want) {
+		t.Fatalf("expected messages %v, got %v", want, last)
+	}
+	if requests[4].Model != "gpt-test" || requests[4].MaxTokens != DefaultLLMMaxTokens {
+		t.Fatalf("unexpected request %+v", requests[4])
+	}
+}
+
+func TestLLMTranslatorBatchesSegments(t *testing.T) {
+	t.Parallel()
+
+	var requests []chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		requests = append(requests, request)
+		answer := strings.ToUpper(request.Messages[len(request.Messages)-1].Content)
+		switch {
+		case strings.HasPrefix(answer, "[") && strings.Contains(answer, "BAD"):
+			// One translation short: the segments are sent one by one.
+			answer = `["FOUR"]`
+		case strings.HasPrefix(answer, "["):
+			answer = "```json\n" + answer + "\n```"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"choices": []any{map[string]any{"message": chatMessage{Role: "assistant", Content: answer}}}})
+	}))
+	defer server.Close()
+
+	translator, err := NewLLMTranslator(LLMConfig{Endpoint: server.URL, Model: "gpt-test", Context: 2, Batch: 3, BatchWait: time.Minute})
+	if err != nil {
+		t.Fatalf("NewLLMTranslator: %v", err)
+	}
+	transcripts := make(chan asr.Transcript, 6)
+	for _, transcript := range []asr.Transcript{
+		{Text: "one", Language: "en"},
+		{Text: "tw", Language: "en", Partial: true},
+		{Text: "two", Language: "en"},
+		{Text: "three", Language: "en"},
+		{Text: "four", Language: "en"},
+		{Text: "bad", Language: "en"},
+	} {
+		transcripts <- transcript
+	}
+	close(transcripts)
+	out, err := translator.TranslateStream(context.Background(), "session", transcripts, "de")
+	if err != nil {
+		t.Fatalf("TranslateStream: %v", err)
+	}
+	var translated []string
+	for translation := range out {
+		translated = append(translated, translation.TranslatedText)
+	}
+
+	// The superseded partial is not translated.
+	if want := []string{"ONE", "TWO", "THREE", "FOUR", "BAD"}; !reflect.DeepEqual(translated, want) {
+		t.Fatalf("expected translations %v, got %v", want, translated)
+	}
+	if len(requests) != 4 {
+		t.Fatalf("expected a request per batch and one per segment of the unsplit batch, got %d", len(requests))
+	}
+	if !strings.Contains(requests[0].Messages[0].Content, "JSON array") {
+		t.Fatalf("expected batched instructions, got %q", requests[0].Messages[0].Content)
+	}
+	want := []chatMessage{{"user", `["two"]`}, {"assistant", `["TWO"]`}, {"user", `["three"]`}, {"assistant", `["THREE"]`}, {"user", `["four","bad"]`}}
+	if last := requests[1].Messages[1:]; !reflect.DeepEqual(last, want) {
+		t.Fatalf("expected messages %v, got %v", want, last)
+	}
+	if last := requests[3].Messages[len(requests[3].Messages)-1]; last.Content != "bad" || strings.Contains(requests[3].Messages[0].Content, "JSON array") {
+		t.Fatalf("expected the segment translated on its own, got %+v", requests[3].Messages)
+	}
+}
+
+func TestLLMTranslatorInstructsGlossaryTerms(t *testing.T) {
+	t.Parallel()
+
+	var system string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		system = request.Messages[0].Content
+		_ = json.NewEncoder(w).Encode(map[string]any{"choices": []any{map[string]any{"message": chatMessage{Role: "assistant", Content: "Bienvenidos a Streamlation."}}}})
+	}))
+	defer server.Close()
+
+	translator, err := NewLLMTranslator(LLMConfig{Endpoint: server.URL, Model: "gpt-test"})
+	if err != nil {
+		t.Fatalf("NewLLMTranslator: %v", err)
+	}
+	transcripts := make(chan asr.Transcript, 1)
+	transcripts <- asr.Transcript{Text: "Welcome to Streamlation."}
+	close(transcripts)
+	glossary := NewGlossary([]GlossaryTerm{{Source: "Streamlation", Target: "Streamlation"}, {Source: "live", Target: "en directo"}})
+	out, err := TranslateWithGlossary(context.Background(), translator, "session", transcripts, "es", glossary)
+	if err != nil {
+		t.Fatalf("TranslateWithGlossary: %v", err)
+	}
+	for translation := range out {
+		if translation.SourceText != "Welcome to Streamlation." {
+			t.Fatalf("expected the source to reach the model as it is, got %q", translation.SourceText)
+		}
+	}
+	if !strings.Contains(system, "\nStreamlation => Streamlation\nlive => en directo") {
+		t.Fatalf("expected the glossary in the system prompt, got %q", system)
+	}
+}
+
+func TestLLMTranslatorInstructsFormality(t *testing.T) {
+	t.Parallel()
+
+	var system string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		system = request.Messages[0].Content
+		_ = json.NewEncoder(w).Encode(map[string]any{"choices": []any{map[string]any{"message": chatMessage{Role: "assistant", Content: "Können Sie mich hören?"}}}})
+	}))
+	defer server.Close()
+
+	translator, err := NewLLMTranslator(LLMConfig{Endpoint: server.URL, Model: "gpt-test", Formality: FormalityFormal})
+	if err != nil {
+		t.Fatalf("NewLLMTranslator: %v", err)
+	}
+	if _, err := translator.Translate(context.Background(), "Can you hear me?", "en", "de"); err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if !strings.Contains(system, "Address the audience formally") {
+		t.Fatalf("expected the formality in the system prompt, got %q", system)
+	}
+}
+
+func TestLLMTranslatorDropsSupersededPartials(t *testing.T) {
+	t.Parallel()
+
+	var sources []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		last := request.Messages[len(request.Messages)-1].Content
+		sources = append(sources, last)
+		_ = json.NewEncoder(w).Encode(map[string]any{"choices": []any{map[string]any{"message": chatMessage{Role: "assistant", Content: last}}}})
+	}))
+	defer server.Close()
+
+	translator, err := NewLLMTranslator(LLMConfig{Endpoint: server.URL, Model: "gpt-test"})
+	if err != nil {
+		t.Fatalf("NewLLMTranslator: %v", err)
+	}
+
+	transcripts := make(chan asr.Transcript, 4)
+	transcripts <- asr.Transcript{Text: "hel", Partial: true}
+	transcripts <- asr.Transcript{Text: "hello wor", Partial: true}
+	transcripts <- asr.Transcript{Text: "hello world"}
+	transcripts <- asr.Transcript{Text: "bye", Partial: true}
+	close(transcripts)
+	out, err := translator.TranslateStream(context.Background(), "session", transcripts, "fr")
+	if err != nil {
+		t.Fatalf("TranslateStream: %v", err)
+	}
+	for range out {
+	}
+
+	if want := []string{"hello world", "bye"}; !reflect.DeepEqual(sources, want) {
+		t.Fatalf("expected requests for %v, got %v", want, sources)
+	}
+}
+
+func TestLLMTranslatorSpeaksAnthropicMessages(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			http.Error(w, "overloaded", 529)
+			return
+		}
+		var request chatRequest
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "secret" || r.Header.Get("anthropic-version") != anthropicVersion || json.NewDecoder(r.Body).Decode(&request) != nil {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if request.System == "" || request.MaxTokens != 256 || len(request.Messages) != 1 || request.Messages[0].Role != "user" {
+			http.Error(w, "unexpected body", http.StatusBadRequest)
+			return
+		}
+		_, _ = io.WriteString(w, `{"content": [{"type": "text", "text": "Hola "}, {"type": "text", "text": "mundo."}], "usage": {"input_tokens": 42, "output_tokens": 5}}`)
+	}))
+	defer server.Close()
+
+	translator, err := NewLLMTranslator(LLMConfig{API: LLMAPIAnthropic, Endpoint: server.URL + "/v1", APIKey: "secret", Model: "claude-test", MaxTokens: 256, Limiter: provider.NewLimiter(provider.LimiterConfig{RetryBackoff: 1})})
+	if err != nil {
+		t.Fatalf("NewLLMTranslator: %v", err)
+	}
+	meter := statuspkg.NewUsageMeter()
+	result, err := translator.Translate(statuspkg.WithUsageMeter(context.Background(), meter), "Hello world.", "en", "es")
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.TranslatedText != "Hola mundo." || attempts.Load() != 2 {
+		t.Fatalf("unexpected translation %+v after %d attempts", result, attempts.Load())
+	}
+	want := []statuspkg.ProviderUsage{{Stage: "translation", Provider: "anthropic/claude-test", Requests: 1, InputTokens: 42, OutputTokens: 5}}
+	if got := meter.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected usage %+v, got %+v", want, got)
+	}
+}
+
+func TestLLMTranslatorReportsRejectedKeys(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	translator, err := NewLLMTranslator(LLMConfig{Endpoint: server.URL, APIKey: "wrong", Model: "gpt-test"})
+	if err != nil {
+		t.Fatalf("NewLLMTranslator: %v", err)
+	}
+
+	var reported error
+	ctx := statuspkg.WithStageErrorReporter(context.Background(), func(err error) { reported = err })
+	transcripts := make(chan asr.Transcript, 1)
+	transcripts <- asr.Transcript{Text: "hello", Language: "en"}
+	out, err := translator.TranslateStream(ctx, "session", transcripts, "de")
+	if err != nil {
+		t.Fatalf("TranslateStream: %v", err)
+	}
+	for translation := range out {
+		t.Fatalf("unexpected translation %+v", translation)
+	}
+
+	var stageErr *statuspkg.StageError
+	if !errors.As(reported, &stageErr) || stageErr.Code != statuspkg.CodeTranslationFailed || stageErr.Retryable {
+		t.Fatalf("expected non-retryable translation failure, got %v", reported)
+	}
+	if attempts.Load() != 1 || translator.Health().Healthy {
+		t.Fatalf("expected one attempt and an unhealthy translator, got %d attempts and %+v", attempts.Load(), translator.Health())
+	}
+}
+
+func TestNewLLMTranslatorValidatesConfig(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []LLMConfig{{}, {Model: "gpt-test", API: "bard"}, {Model: "gpt-test", Endpoint: "api.example.com"}} {
+		if _, err := NewLLMTranslator(cfg); err == nil {
+			t.Fatalf("expected %+v to be rejected", cfg)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package translation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/provider"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+// Machine translation providers an MTTranslator can call.
+const (
+	ProviderDeepL          = "deepl"
+	ProviderLibreTranslate = "libretranslate"
+	ProviderGoogle         = "google"
+)
+
+// Defaults of MTConfig.
+const (
+	DefaultMTBatch     = 16
+	DefaultMTBatchWait = 100 * time.Millisecond
+)
+
+// MTConfig configures an MTTranslator. Zero values fall back to the
+// defaults.
+type MTConfig struct {
+	// Provider is the API the endpoint implements: ProviderDeepL,
+	// ProviderLibreTranslate, or ProviderGoogle.
+	Provider string
+	// Endpoint is the base URL of the API. Defaults to the provider's
+	// public API; for DeepL, its free API for keys ending in ":fx".
+	Endpoint string
+	// APIKey authenticates the requests as the provider expects.
+	APIKey string
+	// Languages maps the ISO 639-1 codes of target languages to the codes
+	// the provider expects, such as "pt" to "PT-PT" for DeepL, overriding
+	// the built-in mapping.
+	Languages map[string]string
+	// Pairs lists the language pairs SupportedLanguages reports. The
+	// providers translate between most languages, so it may be left empty.
+	Pairs []LanguagePair
+	// Formality is the register to translate into, FormalityFormal or
+	// FormalityInformal. Only DeepL honours it, and only for German,
+	// Dutch, French, Italian, Japanese, Polish, Portuguese, Russian, and
+	// Spanish; it translates into other languages in its default register.
+	Formality string
+	// Client sends the requests. Defaults to a client with a 30 second
+	// timeout.
+	Client *http.Client
+	// Batch bounds the segments translated by one request, and BatchWait
+	// how long the first segment of a request waits for others to join it.
+	// Default to DefaultMTBatch and DefaultMTBatchWait.
+	Batch     int
+	BatchWait time.Duration
+	// Limiter paces, bounds, and retries the requests, and stops sending
+	// them while the provider keeps failing. Translators using one API key
+	// should share one. Nil sends requests as soon as segments are ready.
+	Limiter *provider.Limiter
+}
+
+// MTTranslator translates with an external machine translation API: DeepL,
+// LibreTranslate, or Google Cloud Translation (v2).
+//
+// Streamed transcripts are translated in batches: a request carries up to
+// cfg.Batch segments that arrived within cfg.BatchWait of the first and
+// share its source language, and the translations keep the order of the
+// transcripts. Transcripts without a language leave the provider to detect
+// it. Translated into several languages by TranslateStreamMulti, the
+// languages share the batches.
+//
+// Requests that fail with a rate limit, a server error, or a network error
+// are retried. A request that keeps failing, or fails otherwise, such as
+// for a rejected API key or an exhausted quota, ends the stream with
+// TRANSLATION_FAILED, reported through statuspkg.ReportStageError and
+// marked retryable when the failure may pass.
+type MTTranslator struct {
+	cfg MTConfig
+	url string
+
+	mu      sync.RWMutex
+	lastErr error
+}
+
+// NewMTTranslator returns a translator calling the provider cfg names.
+func NewMTTranslator(cfg MTConfig) (*MTTranslator, error) {
+	var path string
+	switch cfg.Provider {
+	case ProviderDeepL:
+		path = "/v2/translate"
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = "https://api.deepl.com"
+			if strings.HasSuffix(cfg.APIKey, ":fx") {
+				cfg.Endpoint = "https://api-free.deepl.com"
+			}
+		}
+	case ProviderLibreTranslate:
+		path = "/translate"
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = "https://libretranslate.com"
+		}
+	case ProviderGoogle:
+		path = "/language/translate/v2"
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = "https://translation.googleapis.com"
+		}
+	default:
+		return nil, fmt.Errorf("unknown translation provider %q", cfg.Provider)
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "https" && endpoint.Scheme != "http") {
+		return nil, fmt.Errorf("invalid translation endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if cfg.Batch <= 0 {
+		cfg.Batch = DefaultMTBatch
+	}
+	if cfg.BatchWait <= 0 {
+		cfg.BatchWait = DefaultMTBatchWait
+	}
+	return &MTTranslator{cfg: cfg, url: strings.TrimSuffix(endpoint.String(), "/") + path}, nil
+}
+
+// Translate translates a single text.
+func (m *MTTranslator) Translate(ctx context.Context, text string, sourceLang, targetLang string) (Translation, error) {
+	translated, detected, err := m.translate(ctx, []string{text}, sourceLang, targetLang)
+	if err != nil {
+		return Translation{}, err
+	}
+	if sourceLang == "" {
+		sourceLang = detected
+	}
+	return Translation{SourceText: text, TranslatedText: translated[0], SourceLang: sourceLang, TargetLang: targetLang}, nil
+}
+
+// TranslateStream translates the transcripts in batches.
+func (m *MTTranslator) TranslateStream(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string) (<-chan Translation, error) {
+	outs, err := m.TranslateStreamMulti(ctx, sessionID, transcripts, []string{targetLang})
+	if err != nil {
+		return nil, err
+	}
+	return outs[targetLang], nil
+}
+
+// TranslateStreamMulti translates the transcripts into every language of
+// targetLangs. The languages share the batches, and the requests for a
+// batch are sent concurrently, one per language. A request that fails ends
+// every language's stream.
+func (m *MTTranslator) TranslateStreamMulti(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLangs []string) (map[string]<-chan Translation, error) {
+	return batchStreams(ctx, sessionID, transcripts, targetLangs, m.cfg.Batch, m.cfg.BatchWait, false, func(ctx context.Context, batch []asr.Transcript, targetLang string) ([]string, string, error) {
+		texts := make([]string, len(batch))
+		for i, transcript := range batch {
+			texts[i] = transcript.Text
+		}
+		return m.translate(ctx, texts, batch[0].Language, targetLang)
+	})
+}
+
+// SupportedLanguages returns the configured language pairs.
+func (m *MTTranslator) SupportedLanguages() []LanguagePair {
+	return m.cfg.Pairs
+}
+
+// Health reports the outcome of the most recent request.
+func (m *MTTranslator) Health() HealthStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.lastErr != nil {
+		return HealthStatus{Message: m.lastErr.Error()}
+	}
+	return HealthStatus{Healthy: true, Message: "translating with " + m.cfg.Provider + " at " + m.cfg.Endpoint}
+}
+
+// translate translates texts through the limiter and returns their
+// translations with the source language the provider detected, if any.
+func (m *MTTranslator) translate(ctx context.Context, texts []string, sourceLang, targetLang string) ([]string, string, error) {
+	body, err := m.encode(texts, sourceLang, targetLang)
+	if err != nil {
+		return nil, "", &statuspkg.StageError{Code: statuspkg.CodeTranslationFailed, Err: fmt.Errorf("encode translation request: %w", err)}
+	}
+
+	var (
+		translated []string
+		detected   string
+	)
+	err = m.cfg.Limiter.Do(ctx, func(ctx context.Context) (time.Duration, error) {
+		var (
+			retryAfter time.Duration
+			err        error
+		)
+		translated, detected, retryAfter, err = m.post(ctx, body, len(texts))
+		m.mu.Lock()
+		m.lastErr = err
+		m.mu.Unlock()
+		return retryAfter, err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	usage := statuspkg.ProviderUsage{Stage: "translation", Provider: m.cfg.Provider, Requests: 1}
+	for _, text := range texts {
+		usage.Characters += int64(utf8.RuneCountInString(text))
+	}
+	statuspkg.RecordUsage(ctx, usage)
+	return translated, detected, nil
+}
+
+// encode returns the body of a request translating texts in the format of
+// the provider.
+func (m *MTTranslator) encode(texts []string, sourceLang, targetLang string) ([]byte, error) {
+	target := m.targetCode(targetLang)
+	var request map[string]any
+	switch m.cfg.Provider {
+	case ProviderDeepL:
+		request = map[string]any{"text": texts, "target_lang": target}
+		if sourceLang != "" {
+			// DeepL names source languages without a regional variant.
+			request["source_lang"] = strings.ToUpper(sourceLang)
+		}
+		// The prefer_ values fall back to the default register for target
+		// languages without one, where the others fail the request.
+		switch m.cfg.Formality {
+		case FormalityFormal:
+			request["formality"] = "prefer_more"
+		case FormalityInformal:
+			request["formality"] = "prefer_less"
+		}
+	case ProviderLibreTranslate:
+		source := sourceLang
+		if source == "" {
+			source = "auto"
+		}
+		request = map[string]any{"q": texts, "source": source, "target": target, "format": "text"}
+		if m.cfg.APIKey != "" {
+			request["api_key"] = m.cfg.APIKey
+		}
+	case ProviderGoogle:
+		request = map[string]any{"q": texts, "target": target, "format": "text"}
+		if sourceLang != "" {
+			request["source"] = sourceLang
+		}
+	}
+	return json.Marshal(request)
+}
+
+// deeplTargets and googleTargets map target languages the providers only
+// accept with a regional variant.
+var (
+	deeplTargets  = map[string]string{"en": "EN-US", "pt": "PT-BR", "zh": "ZH-HANS"}
+	googleTargets = map[string]string{"zh": "zh-CN"}
+)
+
+// targetCode returns the provider's code for the target language.
+func (m *MTTranslator) targetCode(language string) string {
+	if code, ok := m.cfg.Languages[language]; ok {
+		return code
+	}
+	switch m.cfg.Provider {
+	case ProviderDeepL:
+		if code, ok := deeplTargets[language]; ok {
+			return code
+		}
+		return strings.ToUpper(language)
+	case ProviderGoogle:
+		if code, ok := googleTargets[language]; ok {
+			return code
+		}
+	}
+	return language
+}
+
+// post sends one translation request for count texts. Along with a failure
+// it returns how long the provider asked to wait before retrying, if it
+// did.
+func (m *MTTranslator) post(ctx context.Context, body []byte, count int) ([]string, string, time.Duration, error) {
+	fail := func(retryable bool, err error) ([]string, string, time.Duration, error) {
+		return nil, "", 0, &statuspkg.StageError{Code: statuspkg.CodeTranslationFailed, Retryable: retryable, Err: err}
+	}
+
+	target := m.url
+	if m.cfg.Provider == ProviderGoogle && m.cfg.APIKey != "" {
+		target += "?key=" + url.QueryEscape(m.cfg.APIKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fail(false, fmt.Errorf("create translation request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.cfg.Provider == ProviderDeepL && m.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "DeepL-Auth-Key "+m.cfg.APIKey)
+	}
+	resp, err := m.cfg.Client.Do(req)
+	if err != nil {
+		return fail(true, fmt.Errorf("send translation request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		// Rejected keys and DeepL's exhausted quota (456) do not pass by
+		// retrying.
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, "", retryAfter, &statuspkg.StageError{
+			Code:      statuspkg.CodeTranslationFailed,
+			Retryable: retryable,
+			Err:       fmt.Errorf("translation request: %s: %s", resp.Status, strings.TrimSpace(string(detail))),
+		}
+	}
+
+	var (
+		translated []string
+		detected   string
+	)
+	switch m.cfg.Provider {
+	case ProviderDeepL:
+		var result struct {
+			Translations []struct {
+				DetectedSourceLanguage string `json:"detected_source_language"`
+				Text                   string `json:"text"`
+			} `json:"translations"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		for _, translation := range result.Translations {
+			translated = append(translated, translation.Text)
+			detected = strings.ToLower(translation.DetectedSourceLanguage)
+		}
+	case ProviderLibreTranslate:
+		var result struct {
+			TranslatedText   []string `json:"translatedText"`
+			DetectedLanguage []struct {
+				Language string `json:"language"`
+			} `json:"detectedLanguage"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		translated = result.TranslatedText
+		if len(result.DetectedLanguage) > 0 {
+			detected = result.DetectedLanguage[0].Language
+		}
+	case ProviderGoogle:
+		var result struct {
+			Data struct {
+				Translations []struct {
+					TranslatedText         string `json:"translatedText"`
+					DetectedSourceLanguage string `json:"detectedSourceLanguage"`
+				} `json:"translations"`
+			} `json:"data"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		for _, translation := range result.Data.Translations {
+			translated = append(translated, translation.TranslatedText)
+			detected = translation.DetectedSourceLanguage
+		}
+	}
+	if err != nil {
+		return fail(true, fmt.Errorf("decode translation response: %w", err))
+	}
+	if len(translated) != count {
+		return fail(false, fmt.Errorf("translation response: %d translations for %d texts", len(translated), count))
+	}
+	return translated, detected, 0, nil
+}
@@ -0,0 +1,369 @@
+package translation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/asr"
+	"streamlation/packages/backend/provider"
+	statuspkg "streamlation/packages/backend/status"
+)
+
+func TestMTTranslatorSpeaksEachProvider(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		provider string
+		path     string
+		check    func(r *http.Request, body map[string]any) bool
+		response string
+	}{
+		"deepl": {
+			provider: ProviderDeepL,
+			path:     "/v2/translate",
+			check: func(r *http.Request, body map[string]any) bool {
+				return r.Header.Get("Authorization") == "DeepL-Auth-Key secret" && body["target_lang"] == "PT-BR" && body["source_lang"] == "EN"
+			},
+			response: `{"translations": [{"detected_source_language": "EN", "text": "Olá mundo."}]}`,
+		},
+		"libretranslate": {
+			provider: ProviderLibreTranslate,
+			path:     "/translate",
+			check: func(r *http.Request, body map[string]any) bool {
+				return body["api_key"] == "secret" && body["source"] == "en" && body["target"] == "pt"
+			},
+			response: `{"translatedText": ["Olá mundo."]}`,
+		},
+		"google": {
+			provider: ProviderGoogle,
+			path:     "/language/translate/v2",
+			check: func(r *http.Request, body map[string]any) bool {
+				return r.URL.Query().Get("key") == "secret" && body["source"] == "en" && body["target"] == "pt"
+			},
+			response: `{"data": {"translations": [{"translatedText": "Olá mundo."}]}}`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]any
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil || r.URL.Path != tc.path || !tc.check(r, body) {
+					http.Error(w, "unexpected request", http.StatusBadRequest)
+					return
+				}
+				_, _ = io.WriteString(w, tc.response)
+			}))
+			defer server.Close()
+
+			translator, err := NewMTTranslator(MTConfig{Provider: tc.provider, Endpoint: server.URL, APIKey: "secret"})
+			if err != nil {
+				t.Fatalf("NewMTTranslator: %v", err)
+			}
+			result, err := translator.Translate(context.Background(), "Hello world.", "en", "pt")
+			if err != nil {
+				t.Fatalf("Translate: %v", err)
+			}
+			if result.TranslatedText != "Olá mundo." || result.SourceLang != "en" || result.TargetLang != "pt" {
+				t.Fatalf("unexpected translation %+v", result)
+			}
+			if !translator.Health().Healthy {
+				t.Fatalf("expected healthy translator, got %+v", translator.Health())
+			}
+		})
+	}
+}
+
+func TestMTTranslatorBatchesStreamedTranscripts(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		requests [][]string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Q      []string `json:"q"`
+			Source string   `json:"source"`
+			Target string   `json:"target"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Target != "zh-TW" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, body.Q)
+		mu.Unlock()
+		translations := make([]map[string]string, len(body.Q))
+		for i, text := range body.Q {
+			translations[i] = map[string]string{"translatedText": strings.ToUpper(text), "detectedSourceLanguage": "fr"}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"translations": translations}})
+	}))
+	defer server.Close()
+
+	translator, err := NewMTTranslator(MTConfig{
+		Provider:  ProviderGoogle,
+		Endpoint:  server.URL,
+		Languages: map[string]string{"zh": "zh-TW"},
+		Batch:     3,
+		BatchWait: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewMTTranslator: %v", err)
+	}
+
+	transcripts := make(chan asr.Transcript, 5)
+	transcripts <- asr.Transcript{Text: "un", Language: "fr", StartTime: 0}
+	transcripts <- asr.Transcript{Text: "deux", Language: "fr", StartTime: time.Second}
+	transcripts <- asr.Transcript{Text: "trois", Language: "fr", StartTime: 2 * time.Second}
+	transcripts <- asr.Transcript{Text: "four", Language: "en", StartTime: 3 * time.Second}
+	transcripts <- asr.Transcript{Text: "five"}
+	close(transcripts)
+
+	meter := statuspkg.NewUsageMeter()
+	out, err := translator.TranslateStream(statuspkg.WithUsageMeter(context.Background(), meter), "session", transcripts, "zh")
+	if err != nil {
+		t.Fatalf("TranslateStream: %v", err)
+	}
+	var translated, sources []string
+	for translation := range out {
+		if translation.SessionID != "session" || translation.TargetLang != "zh" {
+			t.Fatalf("unexpected translation %+v", translation)
+		}
+		translated = append(translated, translation.TranslatedText)
+		sources = append(sources, translation.SourceLang)
+	}
+
+	if want := []string{"UN", "DEUX", "TROIS", "FOUR", "FIVE"}; !reflect.DeepEqual(translated, want) {
+		t.Fatalf("expected translations %v, got %v", want, translated)
+	}
+	if want := []string{"fr", "fr", "fr", "en", "fr"}; !reflect.DeepEqual(sources, want) {
+		t.Fatalf("expected source languages %v, got %v", want, sources)
+	}
+	// A full batch goes out at once; a change of language starts a new one.
+	if want := [][]string{{"un", "deux", "trois"}, {"four"}, {"five"}}; !reflect.DeepEqual(requests, want) {
+		t.Fatalf("expected requests %v, got %v", want, requests)
+	}
+	if want := []statuspkg.ProviderUsage{{Stage: "translation", Provider: ProviderGoogle, Requests: 3, Characters: 19}}; !reflect.DeepEqual(meter.Snapshot(), want) {
+		t.Fatalf("expected usage %+v, got %+v", want, meter.Snapshot())
+	}
+}
+
+func TestMTTranslatorSharesBatchesAcrossLanguages(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		requests = make(map[string][][]string)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Q      []string `json:"q"`
+			Target string   `json:"target"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests[body.Target] = append(requests[body.Target], body.Q)
+		mu.Unlock()
+		translations := make([]map[string]string, len(body.Q))
+		for i, text := range body.Q {
+			translations[i] = map[string]string{"translatedText": body.Target + ":" + text}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"translations": translations}})
+	}))
+	defer server.Close()
+
+	translator, err := NewMTTranslator(MTConfig{Provider: ProviderGoogle, Endpoint: server.URL, Batch: 2, BatchWait: time.Minute})
+	if err != nil {
+		t.Fatalf("NewMTTranslator: %v", err)
+	}
+
+	transcripts := make(chan asr.Transcript, 3)
+	transcripts <- asr.Transcript{Text: "one", Language: "en"}
+	transcripts <- asr.Transcript{Text: "two", Language: "en"}
+	transcripts <- asr.Transcript{Text: "three", Language: "en"}
+	close(transcripts)
+
+	outs, err := TranslateMulti(context.Background(), translator, "session", transcripts, []string{"es", "fr"})
+	if err != nil {
+		t.Fatalf("TranslateMulti: %v", err)
+	}
+	got := collectMulti(outs)
+
+	want := map[string][]string{
+		"es": {"es:one", "es:two", "es:three"},
+		"fr": {"fr:one", "fr:two", "fr:three"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected translations %v, got %v", want, got)
+	}
+	batches := [][]string{{"one", "two"}, {"three"}}
+	if want := map[string][][]string{"es": batches, "fr": batches}; !reflect.DeepEqual(requests, want) {
+		t.Fatalf("expected requests %v, got %v", want, requests)
+	}
+}
+
+func TestMTTranslatorRetriesRateLimits(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		_, _ = io.WriteString(w, `{"translatedText": ["hola"], "detectedLanguage": [{"language": "en", "confidence": 90}]}`)
+	}))
+	defer server.Close()
+
+	translator, err := NewMTTranslator(MTConfig{Provider: ProviderLibreTranslate, Endpoint: server.URL, Limiter: provider.NewLimiter(provider.LimiterConfig{RetryBackoff: time.Millisecond})})
+	if err != nil {
+		t.Fatalf("NewMTTranslator: %v", err)
+	}
+	result, err := translator.Translate(context.Background(), "hello", "", "es")
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if result.TranslatedText != "hola" || result.SourceLang != "en" {
+		t.Fatalf("unexpected translation %+v", result)
+	}
+	if attempts.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestMTTranslatorStopsCallingAFailingProvider(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	limiter := provider.NewLimiter(provider.LimiterConfig{Code: statuspkg.CodeTranslationFailed, BreakerFailures: 2, BreakerCooldown: time.Minute, Retries: 5, RetryBackoff: time.Millisecond})
+	translators := make([]*MTTranslator, 2)
+	for i := range translators {
+		translator, err := NewMTTranslator(MTConfig{Provider: ProviderLibreTranslate, Endpoint: server.URL, Limiter: limiter})
+		if err != nil {
+			t.Fatalf("NewMTTranslator: %v", err)
+		}
+		translators[i] = translator
+	}
+
+	if _, err := translators[0].Translate(context.Background(), "hello", "en", "es"); !errors.Is(err, provider.ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to open, got %v", err)
+	}
+	// The other session fails fast without calling the provider.
+	if _, err := translators[1].Translate(context.Background(), "hello", "en", "es"); !errors.Is(err, provider.ErrCircuitOpen) || !errors.Is(err, statuspkg.ErrTransient) {
+		t.Fatalf("expected a retryable circuit open error, got %v", err)
+	}
+	if attempts.Load() != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestMTTranslatorReportsRejectedRequests(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		http.Error(w, "quota exceeded", 456)
+	}))
+	defer server.Close()
+
+	translator, err := NewMTTranslator(MTConfig{Provider: ProviderDeepL, Endpoint: server.URL, APIKey: "secret", BatchWait: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewMTTranslator: %v", err)
+	}
+
+	var reported error
+	ctx := statuspkg.WithStageErrorReporter(context.Background(), func(err error) { reported = err })
+	transcripts := make(chan asr.Transcript, 1)
+	transcripts <- asr.Transcript{Text: "hello", Language: "en"}
+	out, err := translator.TranslateStream(ctx, "session", transcripts, "de")
+	if err != nil {
+		t.Fatalf("TranslateStream: %v", err)
+	}
+	for translation := range out {
+		t.Fatalf("unexpected translation %+v", translation)
+	}
+
+	var stageErr *statuspkg.StageError
+	if !errors.As(reported, &stageErr) || stageErr.Code != statuspkg.CodeTranslationFailed || stageErr.Retryable {
+		t.Fatalf("expected non-retryable translation failure, got %v", reported)
+	}
+	if attempts.Load() != 1 {
+		t.Fatalf("expected no retries, got %d attempts", attempts.Load())
+	}
+	if translator.Health().Healthy {
+		t.Fatal("expected unhealthy translator")
+	}
+}
+
+func TestMTTranslatorPassesFormalityToDeepL(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu        sync.Mutex
+		formality any
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		formality = body["formality"]
+		mu.Unlock()
+		_, _ = io.WriteString(w, `{"translations": [{"text": "Hallo zusammen."}]}`)
+	}))
+	defer server.Close()
+
+	for register, want := range map[string]any{FormalityFormal: "prefer_more", FormalityInformal: "prefer_less", "": nil} {
+		translator, err := NewMTTranslator(MTConfig{Provider: ProviderDeepL, Endpoint: server.URL, Formality: register})
+		if err != nil {
+			t.Fatalf("NewMTTranslator: %v", err)
+		}
+		if _, err := translator.Translate(context.Background(), "Hello everyone.", "en", "de"); err != nil {
+			t.Fatalf("Translate: %v", err)
+		}
+		mu.Lock()
+		got := formality
+		mu.Unlock()
+		if got != want {
+			t.Fatalf("%q: expected formality %v, got %v", register, want, got)
+		}
+	}
+}
+
+func TestNewMTTranslatorPicksDeepLFreeAPI(t *testing.T) {
+	t.Parallel()
+
+	translator, err := NewMTTranslator(MTConfig{Provider: ProviderDeepL, APIKey: "key:fx"})
+	if err != nil {
+		t.Fatalf("NewMTTranslator: %v", err)
+	}
+	if translator.url != "https://api-free.deepl.com/v2/translate" {
+		t.Fatalf("unexpected url %q", translator.url)
+	}
+	if _, err := NewMTTranslator(MTConfig{Provider: "babelfish"}); err == nil {
+		t.Fatal("expected unknown provider to fail")
+	}
+}
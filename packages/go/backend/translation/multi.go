@@ -0,0 +1,114 @@
+package translation
+
+import (
+	"context"
+	"errors"
+
+	"streamlation/packages/backend/asr"
+)
+
+// MultiTranslator is implemented by translators that translate one stream
+// of transcripts into several target languages at once, sharing the work
+// the languages have in common, such as batching.
+type MultiTranslator interface {
+	Translator
+	// TranslateStreamMulti is TranslateStream into every language of
+	// targetLangs, returning the translations of each by language.
+	TranslateStreamMulti(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLangs []string) (map[string]<-chan Translation, error)
+}
+
+// TranslateMulti streams the translations of transcripts by translator into
+// every language of targetLangs, reading transcripts once. A
+// MultiTranslator translates into the languages itself. Other translators
+// get one stream per language, each fed a copy of every transcript; a
+// language whose stream ends stops receiving copies, and the others go on.
+func TranslateMulti(ctx context.Context, translator Translator, sessionID string, transcripts <-chan asr.Transcript, targetLangs []string) (map[string]<-chan Translation, error) {
+	targetLangs = uniqueLanguages(targetLangs)
+	if len(targetLangs) == 0 {
+		return nil, errors.New("no target languages")
+	}
+	if multi, ok := translator.(MultiTranslator); ok {
+		return multi.TranslateStreamMulti(ctx, sessionID, transcripts, targetLangs)
+	}
+
+	type target struct {
+		in   chan asr.Transcript
+		done chan struct{}
+	}
+	targets := make([]target, len(targetLangs))
+	outs := make(map[string]<-chan Translation, len(targetLangs))
+	for i, language := range targetLangs {
+		in := make(chan asr.Transcript)
+		translations, err := translator.TranslateStream(ctx, sessionID, in, language)
+		if err != nil {
+			for _, started := range targets[:i] {
+				close(started.in)
+			}
+			return nil, err
+		}
+		// done is closed once the language's stream ended, so that
+		// transcripts are no longer offered to it.
+		done := make(chan struct{})
+		out := make(chan Translation)
+		go func() {
+			defer close(out)
+			defer close(done)
+			for translated := range translations {
+				select {
+				case out <- translated:
+				case <-ctx.Done():
+					// Drain so that the translator can finish.
+					for range translations {
+					}
+					return
+				}
+			}
+		}()
+		targets[i] = target{in: in, done: done}
+		outs[language] = out
+	}
+
+	go func() {
+		defer func() {
+			for _, target := range targets {
+				close(target.in)
+			}
+		}()
+		for {
+			var transcript asr.Transcript
+			select {
+			case <-ctx.Done():
+				return
+			case next, ok := <-transcripts:
+				if !ok {
+					return
+				}
+				transcript = next
+			}
+			for _, target := range targets {
+				select {
+				case target.in <- transcript:
+				case <-target.done:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return outs, nil
+}
+
+// uniqueLanguages returns languages without empty and repeated entries, in
+// their order.
+func uniqueLanguages(languages []string) []string {
+	unique := make([]string, 0, len(languages))
+	seen := make(map[string]bool, len(languages))
+	for _, language := range languages {
+		if language == "" || seen[language] {
+			continue
+		}
+		seen[language] = true
+		unique = append(unique, language)
+	}
+	return unique
+}
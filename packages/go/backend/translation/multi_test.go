@@ -0,0 +1,91 @@
+package translation
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"streamlation/packages/backend/asr"
+)
+
+// stoppingTranslator ends its streams into one language at once.
+type stoppingTranslator struct {
+	*StubTranslator
+	stop string
+}
+
+func (s stoppingTranslator) TranslateStream(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string) (<-chan Translation, error) {
+	if targetLang != s.stop {
+		return s.StubTranslator.TranslateStream(ctx, sessionID, transcripts, targetLang)
+	}
+	out := make(chan Translation)
+	close(out)
+	return out, nil
+}
+
+// collectMulti reads every language's translations concurrently.
+func collectMulti(outs map[string]<-chan Translation) map[string][]string {
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		collected = make(map[string][]string)
+	)
+	for language, out := range outs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var texts []string
+			for translated := range out {
+				texts = append(texts, translated.TranslatedText)
+			}
+			mu.Lock()
+			collected[language] = texts
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return collected
+}
+
+func TestTranslateMultiFansOutToEachLanguage(t *testing.T) {
+	t.Parallel()
+
+	transcripts := make(chan asr.Transcript, 2)
+	transcripts <- asr.Transcript{Text: "one", Language: "en"}
+	transcripts <- asr.Transcript{Text: "two", Language: "en"}
+	close(transcripts)
+
+	translator := stoppingTranslator{StubTranslator: NewStubTranslator(nil), stop: "de"}
+	outs, err := TranslateMulti(context.Background(), translator, "session", transcripts, []string{"es", "fr", "es", "de"})
+	if err != nil {
+		t.Fatalf("TranslateMulti: %v", err)
+	}
+	languages := make([]string, 0, len(outs))
+	for language := range outs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	if want := []string{"de", "es", "fr"}; !reflect.DeepEqual(languages, want) {
+		t.Fatalf("expected streams for %v, got %v", want, languages)
+	}
+
+	got := collectMulti(outs)
+	want := map[string][]string{
+		"es": {"[es] one", "[es] two"},
+		"fr": {"[fr] one", "[fr] two"},
+		"de": nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected translations %v, got %v", want, got)
+	}
+}
+
+func TestTranslateMultiRequiresALanguage(t *testing.T) {
+	t.Parallel()
+
+	if _, err := TranslateMulti(context.Background(), NewStubTranslator(nil), "session", make(chan asr.Transcript), []string{""}); err == nil {
+		t.Fatal("expected an error without target languages")
+	}
+}
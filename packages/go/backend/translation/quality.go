@@ -0,0 +1,193 @@
+package translation
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"streamlation/packages/backend/asr"
+)
+
+// Variants of a translation produced by a FallbackTranslator.
+const (
+	PrimaryVariant  = "primary"
+	FallbackVariant = "fallback"
+)
+
+// DefaultQualityThreshold is the estimated quality below which a
+// FallbackTranslator retries a translation.
+const DefaultQualityThreshold = 0.5
+
+// QualityEstimator scores translations from 0, unusable, to 1.
+type QualityEstimator interface {
+	Estimate(translated Translation) float64
+}
+
+// HeuristicEstimator estimates quality without a model, starting from the
+// translator's Confidence, if it reported one, and lowering it for the
+// failures translators are prone to: an empty translation, a source left
+// untranslated, a translation far shorter or longer than its source, and a
+// word repeated over and over.
+type HeuristicEstimator struct{}
+
+// Estimate scores translated.
+func (HeuristicEstimator) Estimate(translated Translation) float64 {
+	source, target := strings.TrimSpace(translated.SourceText), strings.TrimSpace(translated.TranslatedText)
+	if target == "" {
+		return 0
+	}
+	score := 1.0
+	if translated.Confidence > 0 {
+		score = min(translated.Confidence, 1)
+	}
+	sourceLength, targetLength := utf8.RuneCountInString(source), utf8.RuneCountInString(target)
+	if translated.SourceLang != translated.TargetLang && sourceLength > 3 && strings.EqualFold(source, target) {
+		score *= 0.2
+	}
+	// Short segments, and languages written with fewer characters, vary too
+	// much in length to judge.
+	if sourceLength >= 12 {
+		ratio := float64(targetLength) / float64(sourceLength)
+		if ratio < 0.25 || ratio > 4 {
+			score *= 0.5
+		}
+	}
+	if repeatsWord(target, 4) {
+		score *= 0.3
+	}
+	return score
+}
+
+// repeatsWord reports whether text repeats a word more than times in a row,
+// the loop that degenerate neural translations fall into.
+func repeatsWord(text string, times int) bool {
+	run, previous := 0, ""
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		if word == previous {
+			run++
+			if run > times {
+				return true
+			}
+			continue
+		}
+		run, previous = 1, word
+	}
+	return false
+}
+
+// FallbackConfig configures a FallbackTranslator. Zero values fall back to
+// the defaults.
+type FallbackConfig struct {
+	// Primary translates every transcript, and Secondary those whose
+	// translation by Primary scores below Threshold.
+	Primary   Translator
+	Secondary Translator
+	// Threshold defaults to DefaultQualityThreshold.
+	Threshold float64
+	// Estimator scores the translations. Defaults to HeuristicEstimator.
+	Estimator QualityEstimator
+}
+
+// FallbackTranslator estimates the quality of every final translation of
+// its primary translator and translates those that fall below the
+// threshold again with its secondary translator, keeping whichever
+// translation scores higher. Translations carry their estimated Quality
+// and the Variant that produced them. Partial translations are scored but
+// not retried, and a secondary that fails leaves the primary translation
+// in place.
+type FallbackTranslator struct {
+	cfg FallbackConfig
+}
+
+// NewFallbackTranslator returns a translator falling back from
+// cfg.Primary to cfg.Secondary.
+func NewFallbackTranslator(cfg FallbackConfig) *FallbackTranslator {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultQualityThreshold
+	}
+	if cfg.Estimator == nil {
+		cfg.Estimator = HeuristicEstimator{}
+	}
+	return &FallbackTranslator{cfg: cfg}
+}
+
+// Translate translates text with the primary translator, falling back to
+// the secondary one as configured.
+func (f *FallbackTranslator) Translate(ctx context.Context, text string, sourceLang, targetLang string) (Translation, error) {
+	translated, err := f.cfg.Primary.Translate(ctx, text, sourceLang, targetLang)
+	if err != nil {
+		return Translation{}, err
+	}
+	return f.choose(ctx, translated, targetLang, nil), nil
+}
+
+// TranslateStream streams the translations of the primary translator,
+// falling back to the secondary one as configured.
+func (f *FallbackTranslator) TranslateStream(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string) (<-chan Translation, error) {
+	return f.TranslateStreamGlossary(ctx, sessionID, transcripts, targetLang, nil)
+}
+
+// TranslateStreamGlossary is TranslateStream with the terms of glossary,
+// which may be nil, enforced in the translations of both translators.
+func (f *FallbackTranslator) TranslateStreamGlossary(ctx context.Context, sessionID string, transcripts <-chan asr.Transcript, targetLang string, glossary *Glossary) (<-chan Translation, error) {
+	translations, err := TranslateWithGlossary(ctx, f.cfg.Primary, sessionID, transcripts, targetLang, glossary)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan Translation)
+	go func() {
+		defer close(out)
+		for translated := range translations {
+			select {
+			case out <- f.choose(ctx, translated, targetLang, glossary):
+			case <-ctx.Done():
+				for range translations {
+				}
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// choose scores the primary translation and returns it, or the secondary
+// translation of its source when that scores higher.
+func (f *FallbackTranslator) choose(ctx context.Context, primary Translation, targetLang string, glossary *Glossary) Translation {
+	primary.Quality = f.cfg.Estimator.Estimate(primary)
+	primary.Variant = PrimaryVariant
+	if primary.Partial || primary.Quality >= f.cfg.Threshold {
+		return primary
+	}
+	secondary, err := f.cfg.Secondary.Translate(ctx, glossary.Protect(primary.SourceText), primary.SourceLang, targetLang)
+	if err != nil {
+		return primary
+	}
+	fallback := primary
+	fallback.TranslatedText = glossary.Restore(secondary.TranslatedText)
+	fallback.Confidence = secondary.Confidence
+	fallback.Quality = f.cfg.Estimator.Estimate(fallback)
+	fallback.Variant = FallbackVariant
+	if fallback.Quality <= primary.Quality {
+		return primary
+	}
+	return fallback
+}
+
+// SupportedLanguages returns the language pairs of the primary translator.
+func (f *FallbackTranslator) SupportedLanguages() []LanguagePair {
+	return f.cfg.Primary.SupportedLanguages()
+}
+
+// Health reports the health of the primary translator, noting an unhealthy
+// secondary one.
+func (f *FallbackTranslator) Health() HealthStatus {
+	health := f.cfg.Primary.Health()
+	if secondary := f.cfg.Secondary.Health(); !secondary.Healthy {
+		note := "fallback: " + secondary.Message
+		if health.Message != "" {
+			note = health.Message + "; " + note
+		}
+		health.Message = note
+	}
+	return health
+}
@@ -0,0 +1,96 @@
+package translation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"streamlation/packages/backend/asr"
+)
+
+func TestHeuristicEstimatorPenalizesTypicalFailures(t *testing.T) {
+	t.Parallel()
+
+	good := Translation{SourceText: "The weather is nice today.", TranslatedText: "Hoy hace buen tiempo.", SourceLang: "en", TargetLang: "es"}
+	cases := map[string]struct {
+		translated Translation
+		below      float64
+	}{
+		"empty":          {Translation{SourceText: "Hello there.", TranslatedText: " "}, 0.01},
+		"untranslated":   {Translation{SourceText: "The weather is nice today.", TranslatedText: "The weather is nice today.", SourceLang: "en", TargetLang: "es"}, 0.5},
+		"truncated":      {Translation{SourceText: "The weather is nice today, and tomorrow it will rain.", TranslatedText: "Hoy", SourceLang: "en", TargetLang: "es"}, 0.6},
+		"repeating":      {Translation{SourceText: "Thank you very much.", TranslatedText: "Gracias gracias gracias gracias gracias gracias", SourceLang: "en", TargetLang: "es"}, 0.5},
+		"low confidence": {Translation{SourceText: "The weather is nice today.", TranslatedText: "Hoy hace buen tiempo.", SourceLang: "en", TargetLang: "es", Confidence: 0.3}, 0.31},
+	}
+	if score := (HeuristicEstimator{}).Estimate(good); score != 1 {
+		t.Fatalf("expected a good translation to score 1, got %v", score)
+	}
+	for name, tc := range cases {
+		if score := (HeuristicEstimator{}).Estimate(tc.translated); score >= tc.below {
+			t.Errorf("%s: expected a score below %v, got %v", name, tc.below, score)
+		}
+	}
+}
+
+// failingTranslator is a translator whose single translations fail.
+type failingTranslator struct {
+	*StubTranslator
+}
+
+func (failingTranslator) Translate(context.Context, string, string, string) (Translation, error) {
+	return Translation{}, errors.New("unavailable")
+}
+
+func TestFallbackTranslatorRetriesLowQualityTranslations(t *testing.T) {
+	t.Parallel()
+
+	primary := NewStubTranslator(&StubTranslatorConfig{Dictionary: map[string]map[string]string{
+		"es": {"Good morning everyone.": "Buenos días a todos.", "See you tomorrow, my friends.": "See you tomorrow, my friends."},
+	}})
+	secondary := NewStubTranslator(&StubTranslatorConfig{Dictionary: map[string]map[string]string{
+		"es": {"See you tomorrow, my friends.": "Hasta mañana, amigos."},
+	}})
+	translator := NewFallbackTranslator(FallbackConfig{Primary: primary, Secondary: secondary})
+
+	transcripts := make(chan asr.Transcript, 3)
+	transcripts <- asr.Transcript{Text: "Good morning everyone.", Language: "en"}
+	transcripts <- asr.Transcript{Text: "See you tomorrow, my friends.", Language: "en"}
+	transcripts <- asr.Transcript{Text: "See you tomorrow, my friends.", Language: "en", Partial: true}
+	close(transcripts)
+	out, err := translator.TranslateStream(context.Background(), "session", transcripts, "es")
+	if err != nil {
+		t.Fatalf("TranslateStream: %v", err)
+	}
+	var translated []Translation
+	for translation := range out {
+		translated = append(translated, translation)
+	}
+
+	if len(translated) != 3 {
+		t.Fatalf("expected 3 translations, got %+v", translated)
+	}
+	if translated[0].Variant != PrimaryVariant || translated[0].TranslatedText != "Buenos días a todos." || translated[0].Quality < DefaultQualityThreshold {
+		t.Fatalf("expected the primary translation to be kept, got %+v", translated[0])
+	}
+	if translated[1].Variant != FallbackVariant || translated[1].TranslatedText != "Hasta mañana, amigos." || translated[1].Quality < DefaultQualityThreshold {
+		t.Fatalf("expected the fallback translation, got %+v", translated[1])
+	}
+	if translated[2].Variant != PrimaryVariant || translated[2].Quality >= DefaultQualityThreshold {
+		t.Fatalf("expected the partial to keep its primary translation, got %+v", translated[2])
+	}
+}
+
+func TestFallbackTranslatorKeepsPrimaryWhenSecondaryFails(t *testing.T) {
+	t.Parallel()
+
+	primary := NewStubTranslator(&StubTranslatorConfig{Dictionary: map[string]map[string]string{"es": {"Hello, my friends.": "Hello, my friends."}}})
+	translator := NewFallbackTranslator(FallbackConfig{Primary: primary, Secondary: failingTranslator{NewStubTranslator(nil)}, Threshold: 0.9})
+
+	translated, err := translator.Translate(context.Background(), "Hello, my friends.", "en", "es")
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if translated.Variant != PrimaryVariant || translated.TranslatedText != "Hello, my friends." {
+		t.Fatalf("expected the primary translation, got %+v", translated)
+	}
+}
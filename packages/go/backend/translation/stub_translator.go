@@ -116,6 +116,8 @@ func (s *StubTranslator) TranslateStream(ctx context.Context, sessionID string,
 				StartTime:      transcript.StartTime,
 				EndTime:        transcript.EndTime,
 				SessionID:      sessionID,
+				Partial:        transcript.Partial,
+				Speaker:        transcript.Speaker,
 			}
 
 			select {
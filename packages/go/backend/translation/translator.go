@@ -25,8 +25,25 @@ type Translation struct {
 	EndTime time.Duration `json:"endTime"`
 	// SessionID identifies the translation session.
 	SessionID string `json:"sessionId"`
+	// Partial marks the translation of a partial transcript.
+	Partial bool `json:"partial,omitempty"`
+	// Speaker is the speaker of the translated transcript, when known.
+	Speaker string `json:"speaker,omitempty"`
+	// Quality is the estimated quality of the translation (0.0 - 1.0), when
+	// it was estimated.
+	Quality float64 `json:"quality,omitempty"`
+	// Variant names the translator that produced the translation when
+	// several could have, such as FallbackVariant.
+	Variant string `json:"variant,omitempty"`
 }
 
+// Registers a translation can address its audience in. The empty register
+// leaves it to the translator.
+const (
+	FormalityFormal   = "formal"
+	FormalityInformal = "informal"
+)
+
 // LanguagePair represents a supported source-target language combination.
 type LanguagePair struct {
 	Source string `json:"source"`
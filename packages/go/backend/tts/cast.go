@@ -0,0 +1,136 @@
+package tts
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// VoiceCast gives each speaker of a session a voice of its own. Voices are
+// assigned in the order speakers are first heard and reused once every voice
+// is taken; speech without a speaker gets the default voice. A VoiceCast is
+// safe for concurrent use.
+type VoiceCast struct {
+	fallback VoiceProfile
+	voices   []VoiceProfile
+
+	mu       sync.Mutex
+	assigned map[string]VoiceProfile
+}
+
+// NewVoiceCast returns a cast drawing on voices, with fallback as the
+// default voice.
+func NewVoiceCast(voices []VoiceProfile, fallback VoiceProfile) *VoiceCast {
+	return &VoiceCast{fallback: fallback, voices: voices, assigned: make(map[string]VoiceProfile)}
+}
+
+// Voice returns the voice of speaker.
+func (c *VoiceCast) Voice(speaker string) VoiceProfile {
+	if speaker == "" || len(c.voices) == 0 {
+		return c.fallback
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	voice, ok := c.assigned[speaker]
+	if !ok {
+		voice = c.voices[len(c.assigned)%len(c.voices)]
+		c.assigned[speaker] = voice
+	}
+	return voice
+}
+
+// SynthesizeSpeakers synthesizes each translation from translations with
+// synthesizer, in the voice cast gives its speaker, so that the speakers of
+// a multi-speaker stream keep distinct voices. A DurationFitter fits each
+// translation's speech into its source speech, and a StreamingSynthesizer
+// passes the speech on in chunks as it is generated. A failing synthesis
+// ends the output, reported through statuspkg.ReportStageError.
+func SynthesizeSpeakers(ctx context.Context, synthesizer Synthesizer, sessionID string, translations <-chan translation.Translation, cast *VoiceCast) (<-chan AudioSegment, error) {
+	out := make(chan AudioSegment)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case trans, ok := <-translations:
+				if !ok {
+					return
+				}
+				if err := synthesizeTranslation(ctx, synthesizer, sessionID, trans, cast.Voice(trans.Speaker), out); err != nil {
+					if ctx.Err() == nil {
+						statuspkg.ReportStageError(ctx, &statuspkg.StageError{Code: statuspkg.CodeDubbingFailed, Err: err})
+					}
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// synthesizeTranslation synthesizes trans in voice and sends the speech to
+// out: fitted when synthesizer is a DurationFitter, in chunks as it is
+// generated when it is a StreamingSynthesizer, and whole otherwise.
+func synthesizeTranslation(ctx context.Context, synthesizer Synthesizer, sessionID string, trans translation.Translation, voice VoiceProfile, out chan<- AudioSegment) error {
+	send := func(segment AudioSegment) error {
+		segment.SessionID, segment.Speaker = sessionID, trans.Speaker
+		select {
+		case out <- segment:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	streaming, ok := synthesizer.(StreamingSynthesizer)
+	if !ok {
+		var (
+			segment AudioSegment
+			err     error
+		)
+		if fitter, ok := synthesizer.(*DurationFitter); ok {
+			segment, err = fitter.Fit(ctx, trans, voice)
+		} else {
+			segment, err = synthesizer.Synthesize(ctx, trans.TranslatedText, voice)
+		}
+		if err != nil {
+			return err
+		}
+		segment.Timestamp = trans.StartTime
+		return send(segment)
+	}
+
+	// Each chunk is held back until the next arrives, so that the last can
+	// be told apart.
+	var (
+		held    *AudioSegment
+		elapsed time.Duration
+	)
+	err := streaming.SynthesizeChunks(ctx, trans.TranslatedText, voice, func(chunk AudioSegment) error {
+		if len(chunk.PCMData) == 0 {
+			return nil
+		}
+		chunk.Timestamp = trans.StartTime + elapsed
+		elapsed += chunk.Duration
+		if held != nil {
+			held.Partial = true
+			if err := send(*held); err != nil {
+				return err
+			}
+		}
+		held = &chunk
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if held == nil {
+		return nil
+	}
+	held.Partial = false
+	return send(*held)
+}
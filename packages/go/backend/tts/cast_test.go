@@ -0,0 +1,54 @@
+package tts
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"streamlation/packages/backend/translation"
+)
+
+func TestSynthesizeSpeakersCastsVoices(t *testing.T) {
+	t.Parallel()
+
+	var voices []string
+	synthesizer := &recordingSynthesizer{StubSynthesizer: NewStubSynthesizer(&StubSynthesizerConfig{SampleRate: 16000}), voices: &voices}
+	cast := NewVoiceCast([]VoiceProfile{{ID: "a"}, {ID: "b"}}, VoiceProfile{ID: "default"})
+
+	translations := make(chan translation.Translation, 5)
+	for _, speaker := range []string{"S2", "S1", "S2", "", "S3"} {
+		translations <- translation.Translation{TranslatedText: "hola", Speaker: speaker}
+	}
+	close(translations)
+	out, err := SynthesizeSpeakers(context.Background(), synthesizer, "cast-session", translations, cast)
+	if err != nil {
+		t.Fatalf("SynthesizeSpeakers: %v", err)
+	}
+	var speakers []string
+	for segment := range out {
+		if segment.SessionID != "cast-session" {
+			t.Fatalf("unexpected segment %+v", segment)
+		}
+		speakers = append(speakers, segment.Speaker)
+	}
+
+	if want := []string{"S2", "S1", "S2", "", "S3"}; !reflect.DeepEqual(speakers, want) {
+		t.Fatalf("expected segments of speakers %v, got %v", want, speakers)
+	}
+	// Voices go to speakers in the order they are first heard, and are
+	// reused once every voice is taken.
+	if want := []string{"a", "b", "a", "default", "a"}; !reflect.DeepEqual(voices, want) {
+		t.Fatalf("expected voices %v, got %v", want, voices)
+	}
+}
+
+// recordingSynthesizer records the voice of every synthesis.
+type recordingSynthesizer struct {
+	*StubSynthesizer
+	voices *[]string
+}
+
+func (r *recordingSynthesizer) Synthesize(ctx context.Context, text string, voice VoiceProfile) (AudioSegment, error) {
+	*r.voices = append(*r.voices, voice.ID)
+	return r.StubSynthesizer.Synthesize(ctx, text, voice)
+}
@@ -0,0 +1,412 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/provider"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+// Defaults of ElevenLabsConfig.
+const (
+	// DefaultElevenLabsModel is the model requested when no other is set.
+	DefaultElevenLabsModel = "eleven_multilingual_v2"
+	// DefaultElevenLabsSampleRate is the sample rate of the speech.
+	DefaultElevenLabsSampleRate = 22050
+	// DefaultElevenLabsStreamChunk is how much speech each chunk of
+	// streamed speech holds.
+	DefaultElevenLabsStreamChunk = 200 * time.Millisecond
+)
+
+// elevenLabsSampleRates are the sample rates the API synthesizes raw PCM
+// at.
+var elevenLabsSampleRates = []int{16000, 22050, 24000, 44100}
+
+// The range of speaking speeds the API supports.
+const (
+	elevenLabsMinSpeed = 0.7
+	elevenLabsMaxSpeed = 1.2
+)
+
+// ElevenLabsConfig configures an ElevenLabsSynthesizer. Zero values fall
+// back to the defaults.
+type ElevenLabsConfig struct {
+	// Endpoint is the base URL of the API. Defaults to
+	// https://api.elevenlabs.io.
+	Endpoint string
+	// APIKey is sent in the xi-api-key header when set.
+	APIKey string
+	// Model is the model requested. Defaults to DefaultElevenLabsModel.
+	Model string
+	// Voices maps ISO 639-1 language codes to the voices that speak them,
+	// whose IDs are the API's voice IDs. The first voice of a language is
+	// its default, and the others go to further speakers.
+	Voices map[string][]VoiceProfile
+	// DefaultVoice is the voice ID of languages without Voices, for
+	// multilingual models that speak any language in any voice. Empty
+	// fails the synthesis of such languages.
+	DefaultVoice string
+	// SampleRate is the sample rate of the speech, one of 16000, 22050,
+	// 24000, and 44100. Defaults to DefaultElevenLabsSampleRate.
+	SampleRate int
+	// Client sends the requests. Defaults to a client with a one minute
+	// timeout.
+	Client *http.Client
+	// Limiter paces, bounds, and retries the requests. Synthesizers using
+	// one API key should share one. Nil sends requests as soon as
+	// translations are ready.
+	Limiter *provider.Limiter
+	// StreamChunk is how much speech each chunk passed on by
+	// SynthesizeChunks holds. Defaults to DefaultElevenLabsStreamChunk.
+	StreamChunk time.Duration
+}
+
+// ElevenLabsSynthesizer synthesizes speech with a service that implements
+// the ElevenLabs text-to-speech API, replacing the silence of the stub
+// synthesizer with real voices.
+//
+// Speech is requested as 16-bit mono PCM at cfg.SampleRate. Services that
+// answer with a WAV file instead have it mixed down to mono and resampled
+// to cfg.SampleRate, so segments always have the configured format.
+//
+// Requests that fail with a rate limit, a server error, or a network error
+// are retried. A request that keeps failing, or fails otherwise, such as
+// for a rejected API key, an exhausted quota, or an unknown voice, ends the
+// stream with DUBBING_FAILED, reported through statuspkg.ReportStageError
+// and marked retryable when the failure may pass.
+type ElevenLabsSynthesizer struct {
+	cfg ElevenLabsConfig
+	url string
+
+	mu      sync.RWMutex
+	lastErr error
+}
+
+// NewElevenLabsSynthesizer returns a synthesizer calling cfg.Endpoint.
+func NewElevenLabsSynthesizer(cfg ElevenLabsConfig) (*ElevenLabsSynthesizer, error) {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://api.elevenlabs.io"
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "https" && endpoint.Scheme != "http") {
+		return nil, fmt.Errorf("invalid speech endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Model == "" {
+		cfg.Model = DefaultElevenLabsModel
+	}
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = DefaultElevenLabsSampleRate
+	}
+	supported := false
+	for _, rate := range elevenLabsSampleRates {
+		supported = supported || rate == cfg.SampleRate
+	}
+	if !supported {
+		return nil, fmt.Errorf("unsupported speech sample rate %d", cfg.SampleRate)
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: time.Minute}
+	}
+	if cfg.StreamChunk <= 0 {
+		cfg.StreamChunk = DefaultElevenLabsStreamChunk
+	}
+	return &ElevenLabsSynthesizer{cfg: cfg, url: strings.TrimSuffix(endpoint.String(), "/") + "/v1/text-to-speech/"}, nil
+}
+
+// Synthesize synthesizes text in voice. A voice without an ID speaks in
+// the default voice of its language.
+func (e *ElevenLabsSynthesizer) Synthesize(ctx context.Context, text string, voice VoiceProfile) (AudioSegment, error) {
+	var segment AudioSegment
+	err := e.synthesize(ctx, text, voice, 0, false, func(pcm []byte) error {
+		segment = e.segment(pcm, voice)
+		return nil
+	})
+	return segment, err
+}
+
+// SynthesizeAtRate synthesizes text like Synthesize, at rate times the
+// voice's natural speed, which the API supports from 0.7 to 1.2.
+func (e *ElevenLabsSynthesizer) SynthesizeAtRate(ctx context.Context, text string, voice VoiceProfile, rate float64) (AudioSegment, error) {
+	rate = max(elevenLabsMinSpeed, min(elevenLabsMaxSpeed, rate))
+	var segment AudioSegment
+	err := e.synthesize(ctx, text, voice, rate, false, func(pcm []byte) error {
+		segment = e.segment(pcm, voice)
+		return nil
+	})
+	segment.Rate = rate
+	return segment, err
+}
+
+// SynthesizeChunks synthesizes text like Synthesize through the API's
+// streaming endpoint, passing the speech on in chunks of cfg.StreamChunk as
+// it arrives. Only a request that failed before any speech arrived is
+// retried.
+func (e *ElevenLabsSynthesizer) SynthesizeChunks(ctx context.Context, text string, voice VoiceProfile, emit func(AudioSegment) error) error {
+	return e.synthesize(ctx, text, voice, 0, true, func(pcm []byte) error {
+		return emit(e.segment(pcm, voice))
+	})
+}
+
+// segment returns speech in voice as a segment.
+func (e *ElevenLabsSynthesizer) segment(pcm []byte, voice VoiceProfile) AudioSegment {
+	return AudioSegment{
+		PCMData:    pcm,
+		SampleRate: e.cfg.SampleRate,
+		Duration:   time.Duration(len(pcm)/2) * time.Second / time.Duration(e.cfg.SampleRate),
+		Language:   voice.Language,
+	}
+}
+
+// synthesize synthesizes text in voice at speed, or at the voice's own
+// speed when speed is 0, and passes the speech to emit: in chunks as it
+// arrives when stream is set, and whole otherwise.
+func (e *ElevenLabsSynthesizer) synthesize(ctx context.Context, text string, voice VoiceProfile, speed float64, stream bool, emit func([]byte) error) error {
+	voiceID := voice.ID
+	if voiceID == "" {
+		if voices := e.AvailableVoices(voice.Language); len(voices) > 0 {
+			voiceID = voices[0].ID
+		}
+	}
+	if voiceID == "" {
+		return &statuspkg.StageError{Code: statuspkg.CodeDubbingFailed, Err: fmt.Errorf("no voice for language %q", voice.Language)}
+	}
+	request := map[string]any{"text": text, "model_id": e.cfg.Model}
+	if speed != 0 {
+		request["voice_settings"] = map[string]any{"speed": speed}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return &statuspkg.StageError{Code: statuspkg.CodeDubbingFailed, Err: fmt.Errorf("encode speech request: %w", err)}
+	}
+	target, chunk := e.url+url.PathEscape(voiceID), 0
+	if stream {
+		target += "/stream"
+		chunk = 2 * int(e.cfg.StreamChunk*time.Duration(e.cfg.SampleRate)/time.Second)
+	}
+	target += "?output_format=pcm_" + strconv.Itoa(e.cfg.SampleRate)
+
+	err = e.cfg.Limiter.Do(ctx, func(ctx context.Context) (time.Duration, error) {
+		emitted := false
+		retryAfter, err := e.post(ctx, target, body, chunk, func(pcm []byte) error {
+			emitted = true
+			return emit(pcm)
+		})
+		e.mu.Lock()
+		e.lastErr = err
+		e.mu.Unlock()
+		// Speech passed on cannot be taken back, so it is not requested
+		// again.
+		if err != nil && emitted {
+			err = provider.Final(err)
+		}
+		return retryAfter, err
+	})
+	if err != nil {
+		return err
+	}
+	statuspkg.RecordUsage(ctx, statuspkg.ProviderUsage{Stage: "dubbing", Provider: "elevenlabs/" + e.cfg.Model, Requests: 1, Characters: int64(utf8.RuneCountInString(text))})
+	return nil
+}
+
+// SynthesizeStream synthesizes the translations one after another in
+// voice, skipping those without text, and passes their speech on in chunks
+// as it arrives.
+func (e *ElevenLabsSynthesizer) SynthesizeStream(ctx context.Context, sessionID string, translations <-chan translation.Translation, voice VoiceProfile) (<-chan AudioSegment, error) {
+	out := make(chan AudioSegment)
+	go func() {
+		defer close(out)
+		for {
+			var trans translation.Translation
+			select {
+			case <-ctx.Done():
+				return
+			case next, ok := <-translations:
+				if !ok {
+					return
+				}
+				trans = next
+			}
+			if strings.TrimSpace(trans.TranslatedText) == "" {
+				continue
+			}
+			if err := synthesizeTranslation(ctx, e, sessionID, trans, voice, out); err != nil {
+				if ctx.Err() == nil {
+					statuspkg.ReportStageError(ctx, err)
+				}
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// AvailableVoices returns the voices configured for lang, or the default
+// voice when there are none.
+func (e *ElevenLabsSynthesizer) AvailableVoices(lang string) []VoiceProfile {
+	if voices := e.cfg.Voices[lang]; len(voices) > 0 {
+		return voices
+	}
+	if e.cfg.DefaultVoice != "" {
+		return []VoiceProfile{{ID: e.cfg.DefaultVoice, Language: lang}}
+	}
+	return nil
+}
+
+// Health reports the outcome of the most recent request.
+func (e *ElevenLabsSynthesizer) Health() HealthStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.lastErr != nil {
+		return HealthStatus{Message: e.lastErr.Error()}
+	}
+	return HealthStatus{Healthy: true, Message: "synthesizing with " + e.cfg.Model + " at " + e.cfg.Endpoint}
+}
+
+// post sends one speech request to target and passes the speech, as
+// 16-bit mono PCM at cfg.SampleRate, to emit: in chunks of chunk bytes as
+// it arrives, or whole when chunk is 0. Speech answered as WAV is passed on
+// whole. Along with a failure it returns how long the service asked to
+// wait before retrying, if it did.
+func (e *ElevenLabsSynthesizer) post(ctx context.Context, target string, body []byte, chunk int, emit func([]byte) error) (time.Duration, error) {
+	fail := func(retryable bool, err error) (time.Duration, error) {
+		return 0, &statuspkg.StageError{Code: statuspkg.CodeDubbingFailed, Retryable: retryable, Err: err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fail(false, fmt.Errorf("create speech request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.cfg.APIKey != "" {
+		req.Header.Set("xi-api-key", e.cfg.APIKey)
+	}
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return fail(true, fmt.Errorf("send speech request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return retryAfter, &statuspkg.StageError{
+			Code:      statuspkg.CodeDubbingFailed,
+			Retryable: retryable,
+			Err:       fmt.Errorf("speech request: %s: %s", resp.Status, strings.TrimSpace(string(detail))),
+		}
+	}
+
+	var (
+		audio    []byte
+		raw, wav bool
+		buf      = make([]byte, 32*1024)
+	)
+	for {
+		n, err := resp.Body.Read(buf)
+		audio = append(audio, buf[:n]...)
+		if !raw && !wav && len(audio) >= 4 {
+			wav = bytes.HasPrefix(audio, []byte("RIFF"))
+			raw = !wav
+		}
+		// Raw PCM is at the requested rate, and passed on a chunk at a
+		// time.
+		if chunk > 0 && raw {
+			for len(audio) >= chunk {
+				if err := emit(audio[:chunk:chunk]); err != nil {
+					return 0, err
+				}
+				audio = audio[chunk:]
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(true, fmt.Errorf("read speech response: %w", err))
+		}
+	}
+	if !wav {
+		// A trailing odd byte is not a sample.
+		if audio = audio[:len(audio)&^1]; len(audio) == 0 && chunk > 0 {
+			return 0, nil
+		}
+		return 0, emit(audio)
+	}
+	pcm, err := e.decodeWAV(audio)
+	if err != nil {
+		return fail(false, fmt.Errorf("decode speech response: %w", err))
+	}
+	return 0, emit(pcm)
+}
+
+// decodeWAV returns the 16-bit PCM of a WAV file mixed down to mono and
+// resampled to cfg.SampleRate.
+func (e *ElevenLabsSynthesizer) decodeWAV(audio []byte) ([]byte, error) {
+	if len(audio) < 12 || string(audio[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+	var (
+		rate, channels int
+		data           []byte
+	)
+	for rest := audio[12:]; len(rest) >= 8 && data == nil; {
+		id, size := string(rest[:4]), int(binary.LittleEndian.Uint32(rest[4:8]))
+		rest = rest[8:]
+		size = min(size, len(rest))
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("short fmt chunk")
+			}
+			if format, bits := binary.LittleEndian.Uint16(rest[0:2]), binary.LittleEndian.Uint16(rest[14:16]); format != 1 || bits != 16 {
+				return nil, fmt.Errorf("unsupported WAV format %d with %d bits per sample", format, bits)
+			}
+			channels = int(binary.LittleEndian.Uint16(rest[2:4]))
+			rate = int(binary.LittleEndian.Uint32(rest[4:8]))
+		case "data":
+			data = rest[:size]
+		}
+		// Chunks are padded to an even size.
+		rest = rest[min(size+size&1, len(rest)):]
+	}
+	if rate <= 0 || channels <= 0 || data == nil {
+		return nil, errors.New("WAV file without format or data")
+	}
+
+	frameSize := 2 * channels
+	pcm := make([]byte, 0, len(data)/channels)
+	for frame := 0; frame+frameSize <= len(data); frame += frameSize {
+		var sum int
+		for channel := 0; channel < channels; channel++ {
+			sum += int(int16(binary.LittleEndian.Uint16(data[frame+2*channel:])))
+		}
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(int16(sum/channels)))
+	}
+	if rate == e.cfg.SampleRate {
+		return pcm, nil
+	}
+	resampler, err := media.NewResampler(media.ResamplerConfig{InputRate: rate, OutputRate: e.cfg.SampleRate})
+	if err != nil {
+		return nil, err
+	}
+	return append(resampler.Process(pcm), resampler.Flush()...), nil
+}
@@ -0,0 +1,207 @@
+package tts
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/provider"
+	statuspkg "streamlation/packages/backend/status"
+	"streamlation/packages/backend/translation"
+)
+
+func TestElevenLabsSynthesizerStreamsSpeechInMappedVoices(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Text  string `json:"text"`
+			Model string `json:"model_id"`
+		}
+		if r.URL.Path != "/v1/text-to-speech/voice-es/stream" || r.URL.Query().Get("output_format") != "pcm_16000" || r.Header.Get("xi-api-key") != "secret" || json.NewDecoder(r.Body).Decode(&request) != nil || request.Model != "eleven_test" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		// The first request hits a server error and is retried.
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		// 100ms of speech, with a stray byte.
+		_, _ = w.Write(make([]byte, 3201))
+	}))
+	defer server.Close()
+
+	synthesizer, err := NewElevenLabsSynthesizer(ElevenLabsConfig{
+		Endpoint:   server.URL,
+		APIKey:     "secret",
+		Model:      "eleven_test",
+		Voices:     map[string][]VoiceProfile{"es": {{ID: "voice-es", Language: "es"}}},
+		SampleRate: 16000,
+		Limiter:    provider.NewLimiter(provider.LimiterConfig{Code: statuspkg.CodeDubbingFailed, RetryBackoff: time.Millisecond}),
+	})
+	if err != nil {
+		t.Fatalf("NewElevenLabsSynthesizer: %v", err)
+	}
+
+	meter := statuspkg.NewUsageMeter()
+	ctx := statuspkg.WithUsageMeter(context.Background(), meter)
+	translations := make(chan translation.Translation, 2)
+	translations <- translation.Translation{TranslatedText: " ", StartTime: time.Second}
+	translations <- translation.Translation{TranslatedText: "hola", StartTime: 2 * time.Second, Speaker: "S1"}
+	close(translations)
+	out, err := synthesizer.SynthesizeStream(ctx, "session", translations, VoiceProfile{Language: "es"})
+	if err != nil {
+		t.Fatalf("SynthesizeStream: %v", err)
+	}
+	var segments []AudioSegment
+	for segment := range out {
+		segments = append(segments, segment)
+	}
+
+	// The translation without text is skipped.
+	if len(segments) != 1 {
+		t.Fatalf("expected one segment, got %d", len(segments))
+	}
+	segment := segments[0]
+	if len(segment.PCMData) != 3200 || segment.SampleRate != 16000 || segment.Duration != 100*time.Millisecond || segment.Timestamp != 2*time.Second || segment.SessionID != "session" || segment.Speaker != "S1" {
+		t.Fatalf("unexpected segment %+v", segment)
+	}
+	usage := meter.Snapshot()
+	if len(usage) != 1 || usage[0] != (statuspkg.ProviderUsage{Stage: "dubbing", Provider: "elevenlabs/eleven_test", Requests: 1, Characters: 4}) {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+	if health := synthesizer.Health(); !health.Healthy {
+		t.Fatalf("expected a healthy synthesizer, got %+v", health)
+	}
+}
+
+func TestElevenLabsSynthesizerPassesOnSpeechAsItArrives(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 250ms of speech, the rest only once the first chunk arrived.
+		_, _ = w.Write(make([]byte, 8000))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write(make([]byte, 4001))
+	}))
+	defer server.Close()
+
+	synthesizer, err := NewElevenLabsSynthesizer(ElevenLabsConfig{Endpoint: server.URL, DefaultVoice: "voice", SampleRate: 16000, StreamChunk: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewElevenLabsSynthesizer: %v", err)
+	}
+	translations := make(chan translation.Translation, 1)
+	translations <- translation.Translation{TranslatedText: "hola", StartTime: time.Second}
+	close(translations)
+	out, err := synthesizer.SynthesizeStream(context.Background(), "session", translations, VoiceProfile{Language: "es"})
+	if err != nil {
+		t.Fatalf("SynthesizeStream: %v", err)
+	}
+
+	first := <-out
+	close(release)
+	if len(first.PCMData) != 3200 || first.Timestamp != time.Second || !first.Partial {
+		t.Fatalf("expected the first 100ms before the rest was synthesized, got %d bytes at %v", len(first.PCMData), first.Timestamp)
+	}
+	var rest []AudioSegment
+	for segment := range out {
+		rest = append(rest, segment)
+	}
+	if len(rest) != 3 {
+		t.Fatalf("expected 3 more chunks, got %d", len(rest))
+	}
+	for i, segment := range rest {
+		if want := time.Second + time.Duration(i+1)*100*time.Millisecond; segment.Timestamp != want || segment.Partial != (i < 2) {
+			t.Fatalf("unexpected chunk %d at %v, partial %v", i+1, segment.Timestamp, segment.Partial)
+		}
+	}
+	// The stray byte is dropped.
+	if last := rest[2]; len(last.PCMData) != 2400 || last.Duration != 75*time.Millisecond {
+		t.Fatalf("expected the last chunk to hold the last 75ms, got %d bytes", len(last.PCMData))
+	}
+}
+
+func TestElevenLabsSynthesizerResamplesWAVSpeech(t *testing.T) {
+	t.Parallel()
+
+	// One second of stereo speech at 32kHz, with a chunk to skip before
+	// the data.
+	data := make([]byte, 32000*4)
+	for frame := 0; frame < 32000; frame++ {
+		binary.LittleEndian.PutUint16(data[4*frame:], uint16(int16(1000)))
+		binary.LittleEndian.PutUint16(data[4*frame+2:], uint16(int16(3000)))
+	}
+	header := media.WAVHeader(32000, 2, int64(len(data)))
+	wav := append(append(append([]byte(nil), header[:36]...), []byte("LIST\x03\x00\x00\x00abc\x00")...), header[36:]...)
+	wav = append(wav, data...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/wav")
+		_, _ = w.Write(wav)
+	}))
+	defer server.Close()
+
+	synthesizer, err := NewElevenLabsSynthesizer(ElevenLabsConfig{Endpoint: server.URL, DefaultVoice: "multilingual", SampleRate: 16000})
+	if err != nil {
+		t.Fatalf("NewElevenLabsSynthesizer: %v", err)
+	}
+	segment, err := synthesizer.Synthesize(context.Background(), "bonjour", VoiceProfile{Language: "fr"})
+	if err != nil {
+		t.Fatalf("Synthesize: %v", err)
+	}
+	if segment.SampleRate != 16000 || len(segment.PCMData) != 32000 || segment.Duration != time.Second {
+		t.Fatalf("expected a second of mono speech at 16kHz, got %d bytes at %d Hz", len(segment.PCMData), segment.SampleRate)
+	}
+	// Channels are averaged.
+	if sample := int16(binary.LittleEndian.Uint16(segment.PCMData[16000:])); sample < 1990 || sample > 2010 {
+		t.Fatalf("expected the channels mixed down, got sample %d", sample)
+	}
+}
+
+func TestElevenLabsSynthesizerClassifiesFailures(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, `{"detail":{"status":"quota_exceeded"}}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	synthesizer, err := NewElevenLabsSynthesizer(ElevenLabsConfig{Endpoint: server.URL, DefaultVoice: "voice"})
+	if err != nil {
+		t.Fatalf("NewElevenLabsSynthesizer: %v", err)
+	}
+	_, err = synthesizer.Synthesize(context.Background(), "hello", VoiceProfile{Language: "en"})
+	var stageErr *statuspkg.StageError
+	if !errors.As(err, &stageErr) || stageErr.Code != statuspkg.CodeDubbingFailed || errors.Is(err, statuspkg.ErrTransient) {
+		t.Fatalf("expected a permanent dubbing failure, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected a rejected key not to be retried, got %d requests", calls.Load())
+	}
+	if health := synthesizer.Health(); health.Healthy {
+		t.Fatal("expected the failure to show in the health")
+	}
+
+	unvoiced, err := NewElevenLabsSynthesizer(ElevenLabsConfig{Endpoint: server.URL, Voices: map[string][]VoiceProfile{"en": {{ID: "voice"}}}})
+	if err != nil {
+		t.Fatalf("NewElevenLabsSynthesizer: %v", err)
+	}
+	if _, err := unvoiced.Synthesize(context.Background(), "hallo", VoiceProfile{Language: "de"}); err == nil || calls.Load() != 1 {
+		t.Fatalf("expected a language without a voice to fail without a request, got %v", err)
+	}
+	if _, err := NewElevenLabsSynthesizer(ElevenLabsConfig{SampleRate: 48001}); err == nil {
+		t.Fatal("expected an unsupported sample rate to be rejected")
+	}
+}
@@ -0,0 +1,182 @@
+package tts
+
+import (
+	"errors"
+	"fmt"
+
+	"streamlation/packages/backend/media"
+)
+
+// Codecs a SpeechEncoder encodes speech in.
+const (
+	// CodecAAC is AAC-LC in ADTS frames, as HLS and DASH package audio.
+	CodecAAC = "aac"
+	// CodecOpus is Opus in packets of media.OpusFrameDuration, as WebRTC
+	// carries audio.
+	CodecOpus = "opus"
+)
+
+// Defaults of SpeechEncodingConfig.
+const (
+	// DefaultEncodedSampleRate is a rate both codecs encode and players
+	// take without resampling.
+	DefaultEncodedSampleRate = 48000
+	// DefaultAACSpeechBitrate and DefaultOpusSpeechBitrate keep mono speech
+	// clear.
+	DefaultAACSpeechBitrate  = 64000
+	DefaultOpusSpeechBitrate = 32000
+)
+
+// SpeechEncodingConfig configures a SpeechEncoder. Zero values fall back to
+// the defaults.
+type SpeechEncodingConfig struct {
+	// Codec is CodecAAC or CodecOpus. It is required.
+	Codec string
+	// Bitrate is the bitrate of the encoded speech in bits per second.
+	// Defaults to DefaultAACSpeechBitrate or DefaultOpusSpeechBitrate.
+	Bitrate int
+	// SampleRate is the rate speech is encoded at; speech at another rate
+	// is resampled to it. Defaults to DefaultEncodedSampleRate.
+	SampleRate int
+}
+
+// speechEncoder is the encoder of either codec.
+type speechEncoder interface {
+	Encode(pcm []byte) ([][]byte, error)
+	Flush() ([][]byte, error)
+	Close() error
+}
+
+// SpeechEncoder encodes the synthesized speech of one stream into AAC or
+// Opus frames that can be packaged directly, rather than passing on raw
+// PCM. Every utterance is encoded on its own and ends in a whole frame,
+// padded with silence, so that its frames can be packaged without those of
+// the next; the chunks of streamed speech are encoded as they arrive, and
+// the utterance ends with its last chunk. A SpeechEncoder is not safe for
+// concurrent use.
+type SpeechEncoder struct {
+	cfg SpeechEncodingConfig
+	// newEncoder returns the encoder of an utterance.
+	newEncoder func() (speechEncoder, error)
+
+	// encoder and resampler encode the current utterance; they are nil
+	// between utterances. inputRate is the rate of its speech.
+	encoder   speechEncoder
+	resampler *media.Resampler
+	inputRate int
+}
+
+// NewSpeechEncoder returns an encoder of one stream of speech. It fails for
+// a codec the build cannot encode, with media.ErrAACEncodingUnsupported or
+// media.ErrOpusEncodingUnsupported.
+func NewSpeechEncoder(cfg SpeechEncodingConfig) (*SpeechEncoder, error) {
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = DefaultEncodedSampleRate
+	}
+	e := &SpeechEncoder{cfg: cfg}
+	switch cfg.Codec {
+	case CodecAAC:
+		if e.cfg.Bitrate <= 0 {
+			e.cfg.Bitrate = DefaultAACSpeechBitrate
+		}
+		e.newEncoder = func() (speechEncoder, error) {
+			return media.NewAACEncoder(e.cfg.SampleRate, 1, e.cfg.Bitrate)
+		}
+	case CodecOpus:
+		if e.cfg.Bitrate <= 0 {
+			e.cfg.Bitrate = DefaultOpusSpeechBitrate
+		}
+		e.newEncoder = func() (speechEncoder, error) {
+			return media.NewOpusEncoder(e.cfg.SampleRate, 1, e.cfg.Bitrate)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported speech codec %q", cfg.Codec)
+	}
+	// Open an encoder up front so that a build without the codec fails
+	// here rather than with the first speech.
+	encoder, err := e.newEncoder()
+	if err != nil {
+		return nil, err
+	}
+	_ = encoder.Close()
+	return e, nil
+}
+
+// Encode returns segment, which must be mono 16-bit PCM, with its speech
+// encoded into Frames at the encoder's sample rate in place of PCMData. The
+// frames of a chunk that more of its utterance follows hold the speech
+// encoded so far; the last chunk's frames hold the rest. Duration and
+// Timestamp are those of the speech.
+func (e *SpeechEncoder) Encode(segment AudioSegment) (AudioSegment, error) {
+	if segment.SampleRate <= 0 {
+		return AudioSegment{}, errors.New("speech without a sample rate")
+	}
+	if e.encoder != nil && segment.SampleRate != e.inputRate {
+		return AudioSegment{}, fmt.Errorf("speech at %d Hz in an utterance at %d Hz", segment.SampleRate, e.inputRate)
+	}
+	if e.encoder == nil {
+		if err := e.start(segment.SampleRate); err != nil {
+			return AudioSegment{}, err
+		}
+	}
+
+	pcm := segment.PCMData
+	if e.resampler != nil {
+		pcm = e.resampler.Process(pcm)
+		if !segment.Partial {
+			pcm = append(pcm, e.resampler.Flush()...)
+		}
+	}
+	frames, err := e.encoder.Encode(pcm)
+	if err == nil && !segment.Partial {
+		var last [][]byte
+		last, err = e.encoder.Flush()
+		frames = append(frames, last...)
+		if closeErr := e.end(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		_ = e.end()
+		return AudioSegment{}, fmt.Errorf("encode %s speech: %w", e.cfg.Codec, err)
+	}
+
+	segment.PCMData = nil
+	segment.SampleRate = e.cfg.SampleRate
+	segment.Codec = e.cfg.Codec
+	segment.Frames = frames
+	return segment, nil
+}
+
+// start opens the encoder of an utterance of speech at inputRate.
+func (e *SpeechEncoder) start(inputRate int) error {
+	encoder, err := e.newEncoder()
+	if err != nil {
+		return fmt.Errorf("open %s encoder: %w", e.cfg.Codec, err)
+	}
+	var resampler *media.Resampler
+	if inputRate != e.cfg.SampleRate {
+		resampler, err = media.NewResampler(media.ResamplerConfig{InputRate: inputRate, OutputRate: e.cfg.SampleRate})
+		if err != nil {
+			_ = encoder.Close()
+			return fmt.Errorf("resample speech: %w", err)
+		}
+	}
+	e.encoder, e.resampler, e.inputRate = encoder, resampler, inputRate
+	return nil
+}
+
+// end releases the encoder of the current utterance.
+func (e *SpeechEncoder) end() error {
+	if e.encoder == nil {
+		return nil
+	}
+	err := e.encoder.Close()
+	e.encoder, e.resampler = nil, nil
+	return err
+}
+
+// Close releases the encoder of an utterance that did not end.
+func (e *SpeechEncoder) Close() error {
+	return e.end()
+}
@@ -0,0 +1,107 @@
+package tts
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+// frameEncoder "encodes" every 480 samples into a frame of their first
+// byte, padding the rest on Flush, and counts the encoders open.
+type frameEncoder struct {
+	open    *int
+	pending []byte
+}
+
+func (f *frameEncoder) Encode(pcm []byte) ([][]byte, error) {
+	f.pending = append(f.pending, pcm...)
+	var frames [][]byte
+	for len(f.pending) >= 960 {
+		frames = append(frames, f.pending[:1])
+		f.pending = f.pending[960:]
+	}
+	return frames, nil
+}
+
+func (f *frameEncoder) Flush() ([][]byte, error) {
+	if len(f.pending) == 0 {
+		return nil, nil
+	}
+	frame := f.pending[:1]
+	f.pending = nil
+	return [][]byte{frame}, nil
+}
+
+func (f *frameEncoder) Close() error {
+	*f.open--
+	return nil
+}
+
+func TestSpeechEncoderEncodesUtterancesIntoWholeFrames(t *testing.T) {
+	t.Parallel()
+
+	var open int
+	encoder := &SpeechEncoder{
+		cfg: SpeechEncodingConfig{Codec: CodecOpus, SampleRate: 24000},
+		newEncoder: func() (speechEncoder, error) {
+			open++
+			return &frameEncoder{open: &open}, nil
+		},
+	}
+
+	// 25ms of streamed speech completes one frame and keeps the rest.
+	first, err := encoder.Encode(AudioSegment{PCMData: constantPCM(600, 1000), SampleRate: 24000, Duration: 25 * time.Millisecond, Partial: true})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if len(first.Frames) != 1 || first.PCMData != nil || first.Codec != CodecOpus || first.SampleRate != 24000 || !first.Partial {
+		t.Fatalf("unexpected first chunk %+v", first)
+	}
+	// The utterance's last 10ms end it in a padded frame.
+	last, err := encoder.Encode(AudioSegment{PCMData: constantPCM(240, 1000), SampleRate: 24000, Duration: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if len(last.Frames) != 1 || open != 0 {
+		t.Fatalf("expected the utterance to end in 1 frame, got %d with %d encoders open", len(last.Frames), open)
+	}
+
+	// Speech at 16kHz is resampled to 24kHz: 40ms is two frames.
+	resampled, err := encoder.Encode(AudioSegment{PCMData: constantPCM(640, 1000), SampleRate: 16000, Duration: 40 * time.Millisecond, Timestamp: time.Second})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if len(resampled.Frames) != 2 || resampled.SampleRate != 24000 || resampled.Timestamp != time.Second || resampled.Duration != 40*time.Millisecond {
+		t.Fatalf("unexpected resampled segment %+v with %d frames", resampled, len(resampled.Frames))
+	}
+
+	if _, err := encoder.Encode(AudioSegment{PCMData: constantPCM(240, 1000), SampleRate: 16000, Partial: true}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if _, err := encoder.Encode(AudioSegment{PCMData: constantPCM(240, 1000), SampleRate: 22050}); err == nil {
+		t.Fatal("expected an utterance changing rate to fail")
+	}
+	if err := encoder.Close(); err != nil || open != 0 {
+		t.Fatalf("expected Close to release the encoder, got %v with %d open", err, open)
+	}
+}
+
+func TestNewSpeechEncoderRequiresACodecTheBuildEncodes(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewSpeechEncoder(SpeechEncodingConfig{Codec: "mp3"}); err == nil {
+		t.Fatal("expected an unsupported codec to fail")
+	}
+	if _, err := media.NewAACEncoder(DefaultEncodedSampleRate, 1, DefaultAACSpeechBitrate); errors.Is(err, media.ErrAACEncodingUnsupported) {
+		if _, err := NewSpeechEncoder(SpeechEncodingConfig{Codec: CodecAAC}); !errors.Is(err, media.ErrAACEncodingUnsupported) {
+			t.Fatalf("expected ErrAACEncodingUnsupported, got %v", err)
+		}
+	}
+	if _, err := media.NewOpusEncoder(DefaultEncodedSampleRate, 1, DefaultOpusSpeechBitrate); errors.Is(err, media.ErrOpusEncodingUnsupported) {
+		if _, err := NewSpeechEncoder(SpeechEncodingConfig{Codec: CodecOpus}); !errors.Is(err, media.ErrOpusEncodingUnsupported) {
+			t.Fatalf("expected ErrOpusEncodingUnsupported, got %v", err)
+		}
+	}
+}
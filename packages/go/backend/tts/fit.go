@@ -0,0 +1,116 @@
+package tts
+
+import (
+	"context"
+	"time"
+
+	"streamlation/packages/backend/media"
+	"streamlation/packages/backend/translation"
+)
+
+// Defaults of DurationFitConfig.
+const (
+	// DefaultMaxFitRate is the most speech is sped up to fit, beyond which
+	// it sounds rushed.
+	DefaultMaxFitRate = 1.25
+	// DefaultFitTolerance is how much longer than the source speech may be
+	// before it is fitted.
+	DefaultFitTolerance = 100 * time.Millisecond
+)
+
+// RateSynthesizer is a Synthesizer whose provider can speak faster or
+// slower than a voice's natural rate.
+type RateSynthesizer interface {
+	Synthesizer
+	// SynthesizeAtRate synthesizes text like Synthesize, at rate times the
+	// natural speaking rate clamped to the range the provider supports. The
+	// segment's Rate is the rate applied.
+	SynthesizeAtRate(ctx context.Context, text string, voice VoiceProfile, rate float64) (AudioSegment, error)
+}
+
+// DurationFitConfig configures a DurationFitter. Zero values fall back to
+// the defaults.
+type DurationFitConfig struct {
+	// MaxRate is the most speech is sped up, above 1. Defaults to
+	// DefaultMaxFitRate.
+	MaxRate float64
+	// Tolerance is how much longer than the source speech may be left
+	// as synthesized. Defaults to DefaultFitTolerance.
+	Tolerance time.Duration
+}
+
+// DurationFitter keeps a dub in sync with its source by fitting the speech
+// synthesized for each translation into the time of the source speech it
+// translates. Speech that runs longer is synthesized again at a faster
+// speaking rate when the synthesizer is a RateSynthesizer, and whatever is
+// still too long is time-stretched without changing its pitch, both within
+// cfg.MaxRate. The Drift of the segments reports what could not be fitted.
+type DurationFitter struct {
+	synthesizer Synthesizer
+	cfg         DurationFitConfig
+}
+
+// NewDurationFitter returns a fitter of the speech of synthesizer.
+func NewDurationFitter(synthesizer Synthesizer, cfg DurationFitConfig) *DurationFitter {
+	if cfg.MaxRate <= 1 {
+		cfg.MaxRate = DefaultMaxFitRate
+	}
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = DefaultFitTolerance
+	}
+	return &DurationFitter{synthesizer: synthesizer, cfg: cfg}
+}
+
+// Synthesize synthesizes text, which has no source speech to fit, as the
+// wrapped synthesizer does.
+func (f *DurationFitter) Synthesize(ctx context.Context, text string, voice VoiceProfile) (AudioSegment, error) {
+	return f.synthesizer.Synthesize(ctx, text, voice)
+}
+
+// SynthesizeStream synthesizes and fits each translation in voice.
+func (f *DurationFitter) SynthesizeStream(ctx context.Context, sessionID string, translations <-chan translation.Translation, voice VoiceProfile) (<-chan AudioSegment, error) {
+	return SynthesizeSpeakers(ctx, f, sessionID, translations, NewVoiceCast(nil, voice))
+}
+
+// AvailableVoices returns the voices of the wrapped synthesizer.
+func (f *DurationFitter) AvailableVoices(lang string) []VoiceProfile {
+	return f.synthesizer.AvailableVoices(lang)
+}
+
+// Health returns the health of the wrapped synthesizer.
+func (f *DurationFitter) Health() HealthStatus {
+	return f.synthesizer.Health()
+}
+
+// Fit synthesizes trans in voice, fitted into the time between its
+// StartTime and EndTime. Translations without an end are not fitted.
+func (f *DurationFitter) Fit(ctx context.Context, trans translation.Translation, voice VoiceProfile) (AudioSegment, error) {
+	segment, err := f.synthesizer.Synthesize(ctx, trans.TranslatedText, voice)
+	target := trans.EndTime - trans.StartTime
+	if err != nil || target <= 0 || segment.SampleRate <= 0 {
+		return segment, err
+	}
+	rate := 1.0
+	if speechDuration(segment) > target+f.cfg.Tolerance {
+		want := min(f.cfg.MaxRate, float64(speechDuration(segment))/float64(target))
+		if rater, ok := f.synthesizer.(RateSynthesizer); ok {
+			faster, err := rater.SynthesizeAtRate(ctx, trans.TranslatedText, voice, want)
+			if err != nil {
+				return AudioSegment{}, err
+			}
+			segment, rate = faster, max(1, faster.Rate)
+		}
+		if stretch := min(f.cfg.MaxRate/rate, float64(speechDuration(segment))/float64(target)); speechDuration(segment) > target+f.cfg.Tolerance && stretch > 1 {
+			segment.PCMData = media.TimeStretch(segment.PCMData, segment.SampleRate, stretch)
+			rate *= stretch
+		}
+	}
+	segment.Duration = speechDuration(segment)
+	segment.Rate, segment.Drift = rate, max(0, segment.Duration-target)
+	return segment, nil
+}
+
+// speechDuration returns the duration of the mono 16-bit PCM of segment.
+func speechDuration(segment AudioSegment) time.Duration {
+	return time.Duration(len(segment.PCMData)/2) * time.Second / time.Duration(segment.SampleRate)
+}
@@ -0,0 +1,81 @@
+package tts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/translation"
+)
+
+// lengthSynthesizer synthesizes length of speech at 16kHz for any text.
+type lengthSynthesizer struct {
+	*StubSynthesizer
+	length time.Duration
+}
+
+func (s lengthSynthesizer) Synthesize(_ context.Context, _ string, voice VoiceProfile) (AudioSegment, error) {
+	return AudioSegment{PCMData: constantPCM(int(s.length*16000/time.Second), 1000), SampleRate: 16000, Duration: s.length, Language: voice.Language}, nil
+}
+
+// ratedSynthesizer speaks up to 1.1 times faster.
+type ratedSynthesizer struct {
+	lengthSynthesizer
+}
+
+func (s ratedSynthesizer) SynthesizeAtRate(ctx context.Context, text string, voice VoiceProfile, rate float64) (AudioSegment, error) {
+	rate = min(rate, 1.1)
+	faster := lengthSynthesizer{length: time.Duration(float64(s.length) / rate)}
+	segment, err := faster.Synthesize(ctx, text, voice)
+	segment.Rate = rate
+	return segment, err
+}
+
+func TestDurationFitterFitsSpeechIntoSourceSpeech(t *testing.T) {
+	t.Parallel()
+
+	stub := NewStubSynthesizer(&StubSynthesizerConfig{SampleRate: 16000})
+	source := translation.Translation{TranslatedText: "hola", StartTime: time.Second, EndTime: 2500 * time.Millisecond}
+	for _, check := range []struct {
+		name        string
+		synthesizer Synthesizer
+		rate        float64
+		length      time.Duration
+		drift       time.Duration
+	}{
+		{"fitting as synthesized", lengthSynthesizer{stub, 1550 * time.Millisecond}, 1, 1550 * time.Millisecond, 50 * time.Millisecond},
+		{"stretched", lengthSynthesizer{stub, 1800 * time.Millisecond}, 1.2, 1500 * time.Millisecond, 0},
+		// The provider speeds up by 1.1, and stretching the rest stops at
+		// the maximum rate.
+		{"too long", ratedSynthesizer{lengthSynthesizer{stub, 2 * time.Second}}, 1.25, 1600 * time.Millisecond, 100 * time.Millisecond},
+	} {
+		fitter := NewDurationFitter(check.synthesizer, DurationFitConfig{})
+		segment, err := fitter.Fit(context.Background(), source, VoiceProfile{Language: "es"})
+		if err != nil {
+			t.Fatalf("%s: Fit: %v", check.name, err)
+		}
+		if segment.Rate < check.rate-0.01 || segment.Rate > check.rate+0.01 {
+			t.Fatalf("%s: expected rate %v, got %v", check.name, check.rate, segment.Rate)
+		}
+		if diff := segment.Duration - check.length; diff < -5*time.Millisecond || diff > 5*time.Millisecond || len(segment.PCMData) != int(segment.Duration*32000/time.Second) {
+			t.Fatalf("%s: expected %v of speech, got %v in %d bytes", check.name, check.length, segment.Duration, len(segment.PCMData))
+		}
+		if diff := segment.Drift - check.drift; diff < -5*time.Millisecond || diff > 5*time.Millisecond {
+			t.Fatalf("%s: expected %v of drift, got %v", check.name, check.drift, segment.Drift)
+		}
+	}
+
+	// Speech without a source end is left as synthesized.
+	fitter := NewDurationFitter(lengthSynthesizer{stub, 3 * time.Second}, DurationFitConfig{})
+	translations := make(chan translation.Translation, 1)
+	translations <- translation.Translation{TranslatedText: "hola", StartTime: time.Second, Speaker: "S1"}
+	close(translations)
+	out, err := fitter.SynthesizeStream(context.Background(), "session", translations, VoiceProfile{Language: "es"})
+	if err != nil {
+		t.Fatalf("SynthesizeStream: %v", err)
+	}
+	segment := <-out
+	if segment.Rate != 0 || segment.Duration != 3*time.Second || segment.Timestamp != time.Second || segment.SessionID != "session" || segment.Speaker != "S1" {
+		t.Fatalf("unexpected segment %+v", segment)
+	}
+}
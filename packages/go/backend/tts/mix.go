@@ -0,0 +1,187 @@
+package tts
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+// Defaults of DubMixConfig.
+const (
+	// DefaultDuckGain lowers the source audio by 12 dB under speech.
+	DefaultDuckGain = 0.25
+	// DefaultDuckRamp is how long the source audio takes to fade down
+	// before speech and back up after it.
+	DefaultDuckRamp = 150 * time.Millisecond
+)
+
+// DubMixConfig configures a DubMixer. Zero values fall back to the
+// defaults.
+type DubMixConfig struct {
+	// SampleRate is the sample rate of the source audio and of the mix.
+	// It is required.
+	SampleRate int
+	// DuckGain is the gain of the source audio while speech plays, between
+	// 0 and 1. Defaults to DefaultDuckGain.
+	DuckGain float64
+	// DuckRamp is how long the gain takes to change. Defaults to
+	// DefaultDuckRamp.
+	DuckRamp time.Duration
+}
+
+// DubMixer mixes synthesized speech into the source audio of a stream, so
+// that the dub keeps the music and ambience of the source: the source is
+// ducked while speech plays, fading down ahead of it and back up after it,
+// and the speech is overlaid at the time of the speech it dubs.
+//
+// Speech is scheduled on the timeline of the source audio by its
+// Timestamp. Speech that would overlap the speech before it, or that
+// arrives after the source audio at its time was mixed, starts as soon as
+// possible instead, so that no speech is cut or talks over other speech.
+// Speech should therefore be added before the source audio at its time is
+// mixed, such as by mixing the source with a delay. A DubMixer is not safe
+// for concurrent use.
+type DubMixer struct {
+	cfg  DubMixConfig
+	ramp int64 // samples
+
+	// speech holds the scheduled speech that was not mixed entirely, in
+	// order; end is where the last of it ends.
+	speech []scheduledSpeech
+	end    int64
+	// mixed is the position of the next sample of the mix, and gain the
+	// gain of the source audio there.
+	mixed int64
+	gain  float64
+}
+
+// scheduledSpeech is mono speech starting at sample start of the mix.
+type scheduledSpeech struct {
+	start   int64
+	samples []int16
+}
+
+// NewDubMixer returns a mixer of one stream.
+func NewDubMixer(cfg DubMixConfig) (*DubMixer, error) {
+	if cfg.SampleRate <= 0 {
+		return nil, errors.New("mix sample rate required")
+	}
+	if cfg.DuckGain <= 0 || cfg.DuckGain > 1 {
+		cfg.DuckGain = DefaultDuckGain
+	}
+	if cfg.DuckRamp <= 0 {
+		cfg.DuckRamp = DefaultDuckRamp
+	}
+	return &DubMixer{
+		cfg:  cfg,
+		ramp: max(1, int64(cfg.DuckRamp)*int64(cfg.SampleRate)/int64(time.Second)),
+		gain: 1,
+	}, nil
+}
+
+// AddSpeech schedules segment, which must be mono 16-bit PCM, for mixing.
+// Speech at another sample rate is resampled to the rate of the mix.
+func (m *DubMixer) AddSpeech(segment AudioSegment) error {
+	pcm := segment.PCMData
+	if segment.SampleRate <= 0 {
+		return errors.New("speech without a sample rate")
+	}
+	if segment.SampleRate != m.cfg.SampleRate {
+		resampler, err := media.NewResampler(media.ResamplerConfig{InputRate: segment.SampleRate, OutputRate: m.cfg.SampleRate})
+		if err != nil {
+			return fmt.Errorf("resample speech: %w", err)
+		}
+		pcm = append(resampler.Process(pcm), resampler.Flush()...)
+	}
+	samples := make([]int16, len(pcm)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	start := max(m.position(segment.Timestamp), m.end, m.mixed)
+	m.speech = append(m.speech, scheduledSpeech{start: start, samples: samples})
+	m.end = start + int64(len(samples))
+	return nil
+}
+
+// Mix returns chunk of source audio, mixed down to mono, with the speech
+// scheduled in its time mixed in. The chunk must be at the sample rate of
+// the mix.
+func (m *DubMixer) Mix(chunk media.AudioChunk) (media.AudioChunk, error) {
+	if chunk.SampleRate != m.cfg.SampleRate || chunk.Channels <= 0 {
+		return media.AudioChunk{}, fmt.Errorf("source audio at %d Hz with %d channels, want %d Hz", chunk.SampleRate, chunk.Channels, m.cfg.SampleRate)
+	}
+	frameSize := 2 * chunk.Channels
+	frames := len(chunk.PCMData) / frameSize
+	start := m.position(chunk.Timestamp)
+	step := (1 - m.cfg.DuckGain) / float64(m.ramp)
+
+	out := make([]byte, 2*frames)
+	for frame := 0; frame < frames; frame++ {
+		var source float64
+		for channel := 0; channel < chunk.Channels; channel++ {
+			source += float64(int16(binary.LittleEndian.Uint16(chunk.PCMData[frame*frameSize+2*channel:])))
+		}
+		source /= float64(chunk.Channels)
+
+		position := start + int64(frame)
+		speech, ahead := m.speechAt(position)
+		// The gain reaches the duck gain as the speech starts.
+		if ahead {
+			m.gain = max(m.cfg.DuckGain, m.gain-step)
+		} else {
+			m.gain = min(1, m.gain+step)
+		}
+		sample := math.Round(source*m.gain + speech)
+		binary.LittleEndian.PutUint16(out[2*frame:], uint16(int16(max(math.MinInt16, min(math.MaxInt16, sample)))))
+	}
+	m.mixed = start + int64(frames)
+	m.forget()
+
+	chunk.PCMData, chunk.Channels = out, 1
+	chunk.Duration = time.Duration(frames) * time.Second / time.Duration(m.cfg.SampleRate)
+	return chunk, nil
+}
+
+// speechAt returns the speech sample at position, and whether speech plays
+// within a ramp of it.
+func (m *DubMixer) speechAt(position int64) (float64, bool) {
+	var (
+		sample float64
+		ahead  bool
+	)
+	for _, speech := range m.speech {
+		if speech.start > position+m.ramp {
+			break
+		}
+		end := speech.start + int64(len(speech.samples))
+		if end <= position {
+			continue
+		}
+		ahead = true
+		if position >= speech.start {
+			sample += float64(speech.samples[position-speech.start])
+		}
+	}
+	return sample, ahead
+}
+
+// forget drops the speech mixed entirely.
+func (m *DubMixer) forget() {
+	done := 0
+	for done < len(m.speech) && m.speech[done].start+int64(len(m.speech[done].samples)) <= m.mixed {
+		done++
+	}
+	m.speech = m.speech[done:]
+}
+
+// position returns the sample of the mix at d.
+func (m *DubMixer) position(d time.Duration) int64 {
+	return int64(d) * int64(m.cfg.SampleRate) / int64(time.Second)
+}
@@ -0,0 +1,90 @@
+package tts
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"streamlation/packages/backend/media"
+)
+
+// constantPCM returns samples of value.
+func constantPCM(samples int, value int16) []byte {
+	pcm := make([]byte, 2*samples)
+	for i := 0; i < samples; i++ {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(value))
+	}
+	return pcm
+}
+
+func TestDubMixerDucksSourceUnderSpeech(t *testing.T) {
+	t.Parallel()
+
+	mixer, err := NewDubMixer(DubMixConfig{SampleRate: 1000, DuckGain: 0.5, DuckRamp: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewDubMixer: %v", err)
+	}
+	// The second speech would overlap the first, so it follows it.
+	for _, segment := range []AudioSegment{
+		{PCMData: constantPCM(100, 2000), SampleRate: 1000, Timestamp: 500 * time.Millisecond},
+		{PCMData: constantPCM(50, 3000), SampleRate: 1000, Timestamp: 550 * time.Millisecond},
+	} {
+		if err := mixer.AddSpeech(segment); err != nil {
+			t.Fatalf("AddSpeech: %v", err)
+		}
+	}
+
+	// Stereo source, mixed down to mono.
+	source := make([]byte, 4*1000)
+	for frame := 0; frame < 1000; frame++ {
+		binary.LittleEndian.PutUint16(source[4*frame:], uint16(int16(800)))
+		binary.LittleEndian.PutUint16(source[4*frame+2:], uint16(int16(1200)))
+	}
+	mixed, err := mixer.Mix(media.AudioChunk{SampleRate: 1000, Channels: 2, PCMData: source})
+	if err != nil {
+		t.Fatalf("Mix: %v", err)
+	}
+	if mixed.Channels != 1 || len(mixed.PCMData) != 2000 || mixed.Duration != time.Second {
+		t.Fatalf("unexpected mix %d bytes of %d channels for %v", len(mixed.PCMData), mixed.Channels, mixed.Duration)
+	}
+	sample := func(ms int) int16 {
+		return int16(binary.LittleEndian.Uint16(mixed.PCMData[2*ms:]))
+	}
+	for _, check := range []struct {
+		ms   int
+		want int16
+	}{
+		{100, 1000},
+		{495, 750}, // fading down ahead of the speech
+		{500, 2500},
+		{599, 2500},
+		{600, 3500},
+		{649, 3500},
+		{655, 750}, // fading back up
+		{700, 1000},
+	} {
+		if got := sample(check.ms); got < check.want-60 || got > check.want+60 {
+			t.Fatalf("expected about %d at %dms, got %d", check.want, check.ms, got)
+		}
+	}
+
+	// Speech arriving after its time was mixed starts with the next mix,
+	// and speech at another rate is resampled.
+	if err := mixer.AddSpeech(AudioSegment{PCMData: constantPCM(200, 2000), SampleRate: 2000, Timestamp: 200 * time.Millisecond}); err != nil {
+		t.Fatalf("AddSpeech: %v", err)
+	}
+	next, err := mixer.Mix(media.AudioChunk{Timestamp: time.Second, SampleRate: 1000, Channels: 1, PCMData: constantPCM(200, 1000)})
+	if err != nil {
+		t.Fatalf("Mix: %v", err)
+	}
+	if got := int16(binary.LittleEndian.Uint16(next.PCMData[2*50:])); got < 2400 || got > 2600 {
+		t.Fatalf("expected the late speech mixed in, got %d", got)
+	}
+	if got := int16(binary.LittleEndian.Uint16(next.PCMData[2*150:])); got != 1000 {
+		t.Fatalf("expected the late speech to end after 100ms, got %d", got)
+	}
+
+	if _, err := mixer.Mix(media.AudioChunk{SampleRate: 16000, Channels: 1, PCMData: constantPCM(10, 0)}); err == nil {
+		t.Fatal("expected source audio at another rate to be rejected")
+	}
+}
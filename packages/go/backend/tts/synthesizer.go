@@ -19,6 +19,26 @@ type AudioSegment struct {
 	Timestamp time.Duration `json:"timestamp"`
 	// SessionID identifies the translation session.
 	SessionID string `json:"sessionId"`
+	// Language is the language of the speech, when known.
+	Language string `json:"language,omitempty"`
+	// Speaker is the speaker of the source speech the segment dubs, when
+	// known.
+	Speaker string `json:"speaker,omitempty"`
+	// Rate is the tempo the speech was fitted to the source speech at, 1
+	// when it fit as synthesized. It is 0 for speech that was not fitted.
+	Rate float64 `json:"rate,omitempty"`
+	// Drift is how much longer fitted speech still is than the source
+	// speech it dubs.
+	Drift time.Duration `json:"drift,omitempty"`
+	// Partial marks a chunk of speech that more of the same utterance
+	// follows, from synthesizers that stream speech as it is generated.
+	Partial bool `json:"partial,omitempty"`
+	// Codec is the codec Frames are encoded in, CodecAAC or CodecOpus. It
+	// is empty for speech in PCMData.
+	Codec string `json:"codec,omitempty"`
+	// Frames holds the speech encoded by a SpeechEncoder in place of
+	// PCMData: AAC-LC in ADTS frames, or Opus packets.
+	Frames [][]byte `json:"frames,omitempty"`
 }
 
 // VoiceProfile specifies voice characteristics for synthesis.
@@ -31,6 +51,9 @@ type VoiceProfile struct {
 	Language string `json:"language"`
 	// Gender is the voice gender (male, female, neutral).
 	Gender string `json:"gender"`
+	// Style describes how the voice speaks, such as "narration" or
+	// "conversational", when known.
+	Style string `json:"style,omitempty"`
 }
 
 // HealthStatus represents the health of a component.
@@ -53,3 +76,14 @@ type Synthesizer interface {
 	// Health returns the current health status of the synthesizer.
 	Health() HealthStatus
 }
+
+// StreamingSynthesizer is a Synthesizer that passes on the speech of an
+// utterance in chunks as it is generated, so that dubbing need not wait
+// for whole utterances to be synthesized.
+type StreamingSynthesizer interface {
+	Synthesizer
+	// SynthesizeChunks synthesizes text in voice like Synthesize, calling
+	// emit with consecutive chunks of the speech as they are generated. It
+	// stops at the first error emit returns and returns it.
+	SynthesizeChunks(ctx context.Context, text string, voice VoiceProfile, emit func(AudioSegment) error) error
+}
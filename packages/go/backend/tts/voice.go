@@ -0,0 +1,50 @@
+package tts
+
+import (
+	"slices"
+	"strings"
+)
+
+// VoicePreference describes the voice a session prefers to be dubbed in.
+// Empty fields express no preference.
+type VoicePreference struct {
+	// ID is the ID of the voice to speak in.
+	ID string
+	// Gender is the preferred gender of the voice.
+	Gender string
+	// Style is a word the preferred voice's style or name mentions.
+	Style string
+}
+
+// PreferVoices returns voices ordered by how well they match preference:
+// the voice with its ID first, then those matching both its gender and
+// style, then those matching its gender, then those matching its style.
+// Voices that match equally well keep their order, so without a preference
+// the order, and with it each language's default voice, is unchanged.
+func PreferVoices(voices []VoiceProfile, preference VoicePreference) []VoiceProfile {
+	score := func(voice VoiceProfile) int {
+		var score int
+		if preference.ID != "" && voice.ID == preference.ID {
+			score += 4
+		}
+		if preference.Gender != "" && strings.EqualFold(voice.Gender, preference.Gender) {
+			score += 2
+		}
+		if style := strings.ToLower(preference.Style); style != "" && (strings.Contains(strings.ToLower(voice.Style), style) || strings.Contains(strings.ToLower(voice.Name), style)) {
+			score++
+		}
+		return score
+	}
+	ordered := slices.Clone(voices)
+	slices.SortStableFunc(ordered, func(a, b VoiceProfile) int {
+		return score(b) - score(a)
+	})
+	return ordered
+}
+
+// OffersVoice reports whether voices include the voice with id.
+func OffersVoice(voices []VoiceProfile, id string) bool {
+	return slices.ContainsFunc(voices, func(voice VoiceProfile) bool {
+		return voice.ID == id
+	})
+}
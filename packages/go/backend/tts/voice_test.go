@@ -0,0 +1,41 @@
+package tts
+
+import "testing"
+
+func TestPreferVoicesOrdersByPreference(t *testing.T) {
+	t.Parallel()
+
+	voices := []VoiceProfile{
+		{ID: "a", Gender: "male", Name: "Calm"},
+		{ID: "b", Gender: "female", Style: "conversational"},
+		{ID: "c", Gender: "female", Style: "narration"},
+		{ID: "d", Gender: "male", Style: "Narration"},
+	}
+	order := func(preference VoicePreference) string {
+		var ids string
+		for _, voice := range PreferVoices(voices, preference) {
+			ids += voice.ID
+		}
+		return ids
+	}
+	for _, check := range []struct {
+		preference VoicePreference
+		want       string
+	}{
+		{VoicePreference{}, "abcd"},
+		{VoicePreference{Gender: "female"}, "bcad"},
+		{VoicePreference{Style: "narration"}, "cdab"},
+		{VoicePreference{Gender: "FEMALE", Style: "narration"}, "cbda"},
+		{VoicePreference{ID: "d", Style: "calm"}, "dabc"},
+	} {
+		if got := order(check.preference); got != check.want {
+			t.Fatalf("expected %s for %+v, got %s", check.want, check.preference, got)
+		}
+	}
+	if voices[0].ID != "a" {
+		t.Fatal("expected the voices to be left in their order")
+	}
+	if !OffersVoice(voices, "c") || OffersVoice(voices, "e") {
+		t.Fatal("expected only offered voices to be reported")
+	}
+}
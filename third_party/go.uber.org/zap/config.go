@@ -0,0 +1,206 @@
+package zap
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Level represents logging severity.
+type Level int8
+
+const (
+	DebugLevel Level = -1
+	InfoLevel  Level = 0
+	WarnLevel  Level = 1
+	ErrorLevel Level = 2
+	FatalLevel Level = 3
+)
+
+// String returns the lower-case name of the level, as JSON entries carry it.
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	case FatalLevel:
+		return "fatal"
+	default:
+		return "info"
+	}
+}
+
+// CapitalString returns the upper-case name of the level, as console
+// entries carry it.
+func (l Level) CapitalString() string {
+	return strings.ToUpper(l.String())
+}
+
+// ParseLevel parses a level name such as "debug" or "WARN".
+func ParseLevel(text string) (Level, error) {
+	switch strings.ToLower(text) {
+	case "debug":
+		return DebugLevel, nil
+	case "info", "":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	case "fatal":
+		return FatalLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("unrecognized level: %q", text)
+}
+
+// AtomicLevel stores a log level that can be shared across loggers. Copies
+// share the level, so that changing it affects every logger built with it.
+// The zero value reads as InfoLevel and ignores SetLevel.
+type AtomicLevel struct {
+	level *atomic.Int32
+}
+
+// NewAtomicLevel creates an AtomicLevel at InfoLevel.
+func NewAtomicLevel() AtomicLevel {
+	return NewAtomicLevelAt(InfoLevel)
+}
+
+// NewAtomicLevelAt creates an AtomicLevel seeded with the provided level.
+func NewAtomicLevelAt(l Level) AtomicLevel {
+	a := AtomicLevel{level: new(atomic.Int32)}
+	a.level.Store(int32(l))
+	return a
+}
+
+// Level returns the current severity threshold.
+func (a AtomicLevel) Level() Level {
+	if a.level == nil {
+		return InfoLevel
+	}
+	return Level(a.level.Load())
+}
+
+// SetLevel updates the severity threshold.
+func (a AtomicLevel) SetLevel(l Level) {
+	if a.level != nil {
+		a.level.Store(int32(l))
+	}
+}
+
+// Enabled reports whether entries at l are logged.
+func (a AtomicLevel) Enabled(l Level) bool {
+	return l >= a.Level()
+}
+
+// SamplingConfig caps the entries logged with the same level and message
+// each second: the first Initial are logged, then every Thereafter-th.
+// Errors and fatal entries are never sampled.
+type SamplingConfig struct {
+	Initial    int
+	Thereafter int
+}
+
+// RotationConfig rotates the files logs are written to once they would
+// grow past MaxSize megabytes. The rotated file becomes <path>.1, shifting
+// earlier ones up to <path>.<MaxBackups>; older files are removed. At
+// least one backup is kept.
+type RotationConfig struct {
+	MaxSize    int
+	MaxBackups int
+}
+
+// Config mirrors the subset of zap.Config used within this project, along
+// with the rotation of file outputs.
+type Config struct {
+	Level AtomicLevel
+	// Encoding is "json" (the default) or "console".
+	Encoding string
+	// Sampling, when set, caps repeated entries.
+	Sampling *SamplingConfig
+	// OutputPaths are where entries are written: "stdout", "stderr", or
+	// file paths. Without any, entries go to stdout.
+	OutputPaths []string
+	// ErrorOutputPaths are where entries at ErrorLevel and above are
+	// written instead, and the logger's own write failures. Without any,
+	// they go to OutputPaths.
+	ErrorOutputPaths []string
+	// Rotation, when set, rotates the files of both lists.
+	Rotation *RotationConfig
+	// InitialFields are added to every entry.
+	InitialFields map[string]interface{}
+}
+
+// NewProductionConfig returns a Config pre-configured for production use:
+// JSON entries at InfoLevel, sampled, with errors routed to stderr.
+func NewProductionConfig() Config {
+	return Config{
+		Level:            NewAtomicLevelAt(InfoLevel),
+		Encoding:         "json",
+		Sampling:         &SamplingConfig{Initial: 100, Thereafter: 100},
+		OutputPaths:      []string{"stdout"},
+		ErrorOutputPaths: []string{"stderr"},
+	}
+}
+
+// NewDevelopmentConfig returns a Config for local use: console entries at
+// DebugLevel, unsampled, with errors routed to stderr.
+func NewDevelopmentConfig() Config {
+	return Config{
+		Level:            NewAtomicLevelAt(DebugLevel),
+		Encoding:         "console",
+		OutputPaths:      []string{"stdout"},
+		ErrorOutputPaths: []string{"stderr"},
+	}
+}
+
+// Build constructs a Logger from the config.
+func (c Config) Build() (*Logger, error) {
+	var encode encoder
+	switch c.Encoding {
+	case "", "json":
+		encode = encodeJSON
+	case "console":
+		encode = encodeConsole
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", c.Encoding)
+	}
+
+	sinks := make(map[string]writeSyncer)
+	out, err := openSinks(sinks, c.OutputPaths, c.Rotation)
+	if err != nil {
+		return nil, err
+	}
+	var errOut writeSyncer
+	if len(c.ErrorOutputPaths) > 0 {
+		if errOut, err = openSinks(sinks, c.ErrorOutputPaths, c.Rotation); err != nil {
+			return nil, err
+		}
+	}
+
+	level := c.Level
+	if level.level == nil {
+		level = NewAtomicLevel()
+	}
+	logger := &Logger{core: &core{level: level, encode: encode, out: out, errOut: errOut}}
+	if c.Sampling != nil {
+		logger.core.sampler = newSampler(*c.Sampling, time.Second)
+	}
+	for _, key := range sortedKeys(c.InitialFields) {
+		logger.fields = append(logger.fields, Any(key, c.InitialFields[key]))
+	}
+	return logger, nil
+}
+
+// NewProduction builds a Logger from NewProductionConfig.
+func NewProduction() (*Logger, error) {
+	return NewProductionConfig().Build()
+}
+
+// NewDevelopment builds a Logger from NewDevelopmentConfig.
+func NewDevelopment() (*Logger, error) {
+	return NewDevelopmentConfig().Build()
+}
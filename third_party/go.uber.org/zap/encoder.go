@@ -0,0 +1,134 @@
+package zap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TimeFormat is the layout of entry timestamps.
+const TimeFormat = "2006-01-02T15:04:05.000Z0700"
+
+// entry is a log entry before its fields are encoded.
+type entry struct {
+	Time    time.Time
+	Level   Level
+	Name    string
+	Message string
+}
+
+// encoder renders an entry and its fields as a line.
+type encoder func(entry, []Field) []byte
+
+// encodeJSON renders an entry as a JSON object holding level, ts, logger,
+// and msg ahead of its fields.
+func encodeJSON(e entry, fields []Field) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"level":`)
+	writeJSONString(&buf, e.Level.String())
+	buf.WriteString(`,"ts":`)
+	writeJSONString(&buf, e.Time.Format(TimeFormat))
+	if e.Name != "" {
+		buf.WriteString(`,"logger":`)
+		writeJSONString(&buf, e.Name)
+	}
+	buf.WriteString(`,"msg":`)
+	writeJSONString(&buf, e.Message)
+	writeFields(&buf, fields, true)
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// encodeConsole renders an entry as tab-separated time, level, logger, and
+// message, followed by its fields as a JSON object.
+func encodeConsole(e entry, fields []Field) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(e.Time.Format(TimeFormat))
+	buf.WriteByte('\t')
+	buf.WriteString(e.Level.CapitalString())
+	if e.Name != "" {
+		buf.WriteByte('\t')
+		buf.WriteString(e.Name)
+	}
+	buf.WriteByte('\t')
+	buf.WriteString(e.Message)
+	var rendered bytes.Buffer
+	writeFields(&rendered, fields, false)
+	if rendered.Len() > 0 {
+		buf.WriteString("\t{")
+		buf.Write(rendered.Bytes())
+		buf.WriteByte('}')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// writeFields writes the fields as JSON members, each preceded by a comma
+// unless it is the first and leadingComma is false.
+func writeFields(buf *bytes.Buffer, fields []Field, leadingComma bool) {
+	first := !leadingComma
+	for _, field := range fields {
+		if field.skip {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		writeJSONString(buf, field.Key)
+		buf.WriteByte(':')
+		buf.Write(encodeValue(field.Value))
+	}
+}
+
+// encodeValue renders value as JSON. Values that cannot be marshalled are
+// written as their %+v formatting.
+func encodeValue(value interface{}) (encoded []byte) {
+	defer func() {
+		// A Stringer or Marshaler with a nil receiver may panic.
+		if recovered := recover(); recovered != nil {
+			encoded = jsonString(fmt.Sprintf("<panic: %v>", recovered))
+		}
+	}()
+	switch v := value.(type) {
+	case nil:
+		return []byte("null")
+	case error:
+		return jsonString(v.Error())
+	case time.Time:
+		return jsonString(v.Format(time.RFC3339Nano))
+	case time.Duration:
+		return jsonString(v.String())
+	case json.Marshaler:
+		// Marshalled below, ahead of its String method.
+	case fmt.Stringer:
+		return jsonString(v.String())
+	}
+	data, err := marshal(value)
+	if err != nil {
+		return jsonString(fmt.Sprintf("%+v", value))
+	}
+	return data
+}
+
+// marshal renders value as JSON without escaping HTML characters, so that
+// messages stay readable.
+func marshal(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func jsonString(s string) []byte {
+	data, _ := marshal(s)
+	return data
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.Write(jsonString(s))
+}
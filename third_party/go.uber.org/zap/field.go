@@ -0,0 +1,81 @@
+package zap
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Field is a key and value added to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+	// skip drops the field, as Error does for nil errors.
+	skip bool
+}
+
+// String adds a string value.
+func String(key, value string) Field { return Field{Key: key, Value: value} }
+
+// Int adds an int value.
+func Int(key string, value int) Field { return Field{Key: key, Value: value} }
+
+// Int64 adds an int64 value.
+func Int64(key string, value int64) Field { return Field{Key: key, Value: value} }
+
+// Float64 adds a float64 value.
+func Float64(key string, value float64) Field { return Field{Key: key, Value: value} }
+
+// Bool adds a bool value.
+func Bool(key string, value bool) Field { return Field{Key: key, Value: value} }
+
+// Duration adds a duration, written like "1.5s".
+func Duration(key string, value time.Duration) Field { return Field{Key: key, Value: value} }
+
+// Time adds a time, written in RFC 3339 with nanoseconds.
+func Time(key string, value time.Time) Field { return Field{Key: key, Value: value} }
+
+// Error adds err under "error", or nothing when it is nil.
+func Error(err error) Field { return NamedError("error", err) }
+
+// NamedError adds err under key, or nothing when it is nil.
+func NamedError(key string, err error) Field {
+	return Field{Key: key, Value: err, skip: err == nil}
+}
+
+// Any adds a value of any type, written as JSON unless it is an error,
+// time, duration, or fmt.Stringer.
+func Any(key string, value interface{}) Field { return Field{Key: key, Value: value} }
+
+// sweetenFields turns the alternating keys and values of a sugared call
+// into fields. Fields among them are taken as they are, and a key left
+// without a value is kept with a null one.
+func sweetenFields(keysAndValues []interface{}) []Field {
+	fields := make([]Field, 0, len(keysAndValues)/2)
+	for i := 0; i < len(keysAndValues); i++ {
+		if field, ok := keysAndValues[i].(Field); ok {
+			fields = append(fields, field)
+			continue
+		}
+		key := fmt.Sprint(keysAndValues[i])
+		if s, ok := keysAndValues[i].(string); ok {
+			key = s
+		}
+		var value interface{}
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+			i++
+		}
+		fields = append(fields, Any(key, value))
+	}
+	return fields
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
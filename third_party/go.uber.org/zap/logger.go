@@ -2,76 +2,57 @@ package zap
 
 import (
 	"fmt"
-	"log"
+	"io"
 	"os"
-	"strings"
-	"sync"
 	"time"
 )
 
-// Level represents logging severity.
-type Level int8
-
-const (
-	DebugLevel Level = -1
-	InfoLevel  Level = 0
-	WarnLevel  Level = 1
-	ErrorLevel Level = 2
-	FatalLevel Level = 3
-)
-
-// AtomicLevel stores a log level that can be shared across loggers.
-type AtomicLevel struct {
-	level Level
-	mu    sync.RWMutex
-}
-
-// NewAtomicLevelAt creates an AtomicLevel seeded with the provided level.
-func NewAtomicLevelAt(l Level) AtomicLevel {
-	return AtomicLevel{level: l}
-}
-
-// Level returns the current severity threshold.
-func (a *AtomicLevel) Level() Level {
-	a.mu.RLock()
-	defer a.mu.RUnlock()
-	return a.level
-}
-
-// SetLevel updates the severity threshold.
-func (a *AtomicLevel) SetLevel(l Level) {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-	a.level = l
-}
-
-// Config mirrors the subset of zap.Config used within this project.
-type Config struct {
-	Level AtomicLevel
+// Core represents the logger core exposed by zap.
+type Core interface {
+	Enabled(Level) bool
 }
 
-// NewProductionConfig returns a Config pre-configured for production use.
-func NewProductionConfig() Config {
-	return Config{Level: NewAtomicLevelAt(InfoLevel)}
+// core holds what the loggers derived from one Build share.
+type core struct {
+	level  AtomicLevel
+	encode encoder
+	out    writeSyncer
+	// errOut receives entries at ErrorLevel and above, unless it is nil
+	// and they go to out.
+	errOut  writeSyncer
+	sampler *sampler
 }
 
-// Core represents the logger core exposed by zap.
-type Core interface {
-	Enabled(Level) bool
+func (c *core) Enabled(l Level) bool {
+	return c.level.Enabled(l)
 }
 
-type simpleCore struct {
-	level Level
+func (c *core) write(e entry, fields []Field) {
+	if !c.Enabled(e.Level) || !c.sampler.allow(e.Level, e.Message, e.Time) {
+		return
+	}
+	out := c.out
+	if e.Level >= ErrorLevel {
+		out = c.errorOutput()
+	}
+	if _, err := out.Write(c.encode(e, fields)); err != nil {
+		_, _ = fmt.Fprintf(c.errorOutput(), "%s write error: %v\n", e.Time.Format(TimeFormat), err)
+	}
 }
 
-func (c *simpleCore) Enabled(l Level) bool {
-	return l >= c.level
+func (c *core) errorOutput() writeSyncer {
+	if c.errOut == nil {
+		return c.out
+	}
+	return c.errOut
 }
 
-// Logger is a minimal stand-in for zap.Logger.
+// Logger is a minimal stand-in for zap.Logger that writes structured
+// entries.
 type Logger struct {
-	core   *simpleCore
-	logger *log.Logger
+	core   *core
+	name   string
+	fields []Field
 }
 
 // SugaredLogger mimics zap.SugaredLogger.
@@ -79,15 +60,18 @@ type SugaredLogger struct {
 	base *Logger
 }
 
-// Build constructs a Logger from the config.
-func (c Config) Build() (*Logger, error) {
-	std := log.New(os.Stdout, "", log.LstdFlags|log.Lmicroseconds|log.LUTC)
-	return &Logger{
-		core:   &simpleCore{level: c.Level.Level()},
-		logger: std,
-	}, nil
+// NewNop returns a Logger that writes nothing.
+func NewNop() *Logger {
+	discard := nopSyncer{io.Discard}
+	return &Logger{core: &core{level: NewAtomicLevelAt(FatalLevel + 1), encode: encodeJSON, out: discard}}
+}
+
+type nopSyncer struct {
+	io.Writer
 }
 
+func (nopSyncer) Sync() error { return nil }
+
 // Sugar returns a SugaredLogger wrapper.
 func (l *Logger) Sugar() *SugaredLogger {
 	return &SugaredLogger{base: l}
@@ -108,125 +92,186 @@ func (s *SugaredLogger) Core() Core {
 	return s.base.core
 }
 
-// Sync is a no-op retained for API parity.
-func (l *Logger) Sync() error { return nil }
+// Sync flushes the files entries are written to.
+func (l *Logger) Sync() error {
+	err := l.core.out.Sync()
+	if l.core.errOut != nil {
+		if errOutErr := l.core.errOut.Sync(); err == nil {
+			err = errOutErr
+		}
+	}
+	return err
+}
 
-// Sync is a no-op for SugaredLogger.
+// Sync flushes the files entries are written to.
 func (s *SugaredLogger) Sync() error { return s.base.Sync() }
 
-// Infow logs at info level with structured context.
-func (s *SugaredLogger) Infow(msg string, keysAndValues ...interface{}) {
-	s.log(InfoLevel, msg, keysAndValues...)
+// Named returns a logger whose entries carry name, joined to the names of
+// l with a period.
+func (l *Logger) Named(name string) *Logger {
+	if name == "" {
+		return l
+	}
+	named := l.clone()
+	if named.name != "" {
+		name = named.name + "." + name
+	}
+	named.name = name
+	return named
 }
 
-// Errorw logs at error level with structured context.
-func (s *SugaredLogger) Errorw(msg string, keysAndValues ...interface{}) {
-	s.log(ErrorLevel, msg, keysAndValues...)
+// With returns a logger that adds fields to each entry, after those of l.
+func (l *Logger) With(fields ...Field) *Logger {
+	if len(fields) == 0 {
+		return l
+	}
+	with := l.clone()
+	with.fields = append(with.fields, fields...)
+	return with
 }
 
-// Fatalw logs at fatal level and exits the process.
-func (s *SugaredLogger) Fatalw(msg string, keysAndValues ...interface{}) {
-	s.log(FatalLevel, msg, keysAndValues...)
-	os.Exit(1)
+// Option configures a Logger.
+type Option func(*Logger)
+
+// Fields adds fields to the entries of the logger it configures.
+func Fields(fields ...Field) Option {
+	return func(l *Logger) {
+		l.fields = append(l.fields, fields...)
+	}
 }
 
-// Debugw logs at debug level.
-func (s *SugaredLogger) Debugw(msg string, keysAndValues ...interface{}) {
-	s.log(DebugLevel, msg, keysAndValues...)
+// WithOptions returns a logger configured by options.
+func (l *Logger) WithOptions(options ...Option) *Logger {
+	configured := l.clone()
+	for _, option := range options {
+		option(configured)
+	}
+	return configured
 }
 
-func (s *SugaredLogger) log(level Level, msg string, keysAndValues ...interface{}) {
-	if !s.base.core.Enabled(level) {
+func (l *Logger) clone() *Logger {
+	copied := *l
+	copied.fields = append([]Field(nil), l.fields...)
+	return &copied
+}
+
+// Check reports whether an entry at level would be logged.
+func (l *Logger) Check(level Level, msg string) bool {
+	return l.core.Enabled(level)
+}
+
+func (l *Logger) log(level Level, msg string, fields []Field) {
+	if !l.core.Enabled(level) {
 		return
 	}
-	s.base.logger.Printf("%s\t%s", levelString(level), formatMessage(msg, keysAndValues...))
-}
-
-func levelString(l Level) string {
-	switch l {
-	case DebugLevel:
-		return "DEBUG"
-	case InfoLevel:
-		return "INFO"
-	case WarnLevel:
-		return "WARN"
-	case ErrorLevel:
-		return "ERROR"
-	case FatalLevel:
-		return "FATAL"
-	default:
-		return "INFO"
+	all := l.fields
+	if len(fields) > 0 {
+		all = append(append(make([]Field, 0, len(l.fields)+len(fields)), l.fields...), fields...)
 	}
+	l.core.write(entry{Time: time.Now().UTC(), Level: level, Name: l.name, Message: msg}, all)
 }
 
-func formatMessage(msg string, keysAndValues ...interface{}) string {
-	if len(keysAndValues) == 0 {
-		return msg
-	}
-	builder := strings.Builder{}
-	builder.WriteString(msg)
-	builder.WriteRune('\t')
-	for i := 0; i < len(keysAndValues); i += 2 {
-		key := fmt.Sprint(keysAndValues[i])
-		var value interface{}
-		if i+1 < len(keysAndValues) {
-			value = keysAndValues[i+1]
-		}
-		builder.WriteString(key)
-		builder.WriteRune('=')
-		builder.WriteString(fmt.Sprint(value))
-		if i+2 < len(keysAndValues) {
-			builder.WriteRune(' ')
-		}
-	}
-	return builder.String()
+// Debug logs at debug level.
+func (l *Logger) Debug(msg string, fields ...Field) { l.log(DebugLevel, msg, fields) }
+
+// Info logs at info level.
+func (l *Logger) Info(msg string, fields ...Field) { l.log(InfoLevel, msg, fields) }
+
+// Warn logs at warn level.
+func (l *Logger) Warn(msg string, fields ...Field) { l.log(WarnLevel, msg, fields) }
+
+// Error logs at error level.
+func (l *Logger) Error(msg string, fields ...Field) { l.log(ErrorLevel, msg, fields) }
+
+// Fatal logs at fatal level, flushes, and exits the process.
+func (l *Logger) Fatal(msg string, fields ...Field) {
+	l.log(FatalLevel, msg, fields)
+	_ = l.Sync()
+	os.Exit(1)
 }
 
-// With returns the same logger for compatibility.
-func (s *SugaredLogger) With(keysAndValues ...interface{}) *SugaredLogger {
-	_ = keysAndValues
-	return s
+// Named returns a logger whose entries carry name, as Logger.Named does.
+func (s *SugaredLogger) Named(name string) *SugaredLogger {
+	return s.base.Named(name).Sugar()
 }
 
-// WithOptions returns the same logger to preserve compatibility.
-func (l *Logger) WithOptions(options ...interface{}) *Logger {
-	_ = options
-	return l
+// With returns a logger that adds the alternating keys and values, or
+// fields, to each entry.
+func (s *SugaredLogger) With(keysAndValues ...interface{}) *SugaredLogger {
+	return s.base.With(sweetenFields(keysAndValues)...).Sugar()
 }
 
-// Named returns the same logger (namespace not supported in stub).
-func (l *Logger) Named(name string) *Logger {
-	_ = name
-	return l
+// Debugw logs at debug level with structured context.
+func (s *SugaredLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	s.logw(DebugLevel, msg, keysAndValues)
 }
 
-// With adds context and returns the same logger for compatibility.
-func (l *Logger) With(fields ...interface{}) *Logger {
-	_ = fields
-	return l
+// Infow logs at info level with structured context.
+func (s *SugaredLogger) Infow(msg string, keysAndValues ...interface{}) {
+	s.logw(InfoLevel, msg, keysAndValues)
 }
 
-// Sugar returns the SugaredLogger wrapper (already implemented above but provided for completeness).
-func (l *Logger) WithSugared(fields ...interface{}) *SugaredLogger {
-	_ = fields
-	return l.Sugar()
+// Warnw logs at warn level with structured context.
+func (s *SugaredLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	s.logw(WarnLevel, msg, keysAndValues)
 }
 
-// Check ensures compatibility with zap's API surface used in tests.
-func (l *Logger) Check(level Level, msg string) bool {
-	return l.core.Enabled(level)
+// Errorw logs at error level with structured context.
+func (s *SugaredLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	s.logw(ErrorLevel, msg, keysAndValues)
 }
 
-// Warnw logs at warn level.
-func (s *SugaredLogger) Warnw(msg string, keysAndValues ...interface{}) {
-	s.log(WarnLevel, msg, keysAndValues...)
+// Fatalw logs at fatal level, flushes, and exits the process.
+func (s *SugaredLogger) Fatalw(msg string, keysAndValues ...interface{}) {
+	s.logw(FatalLevel, msg, keysAndValues)
+	_ = s.Sync()
+	os.Exit(1)
 }
 
-// Panicw logs and panics for compatibility.
+// Panicw logs at fatal level and panics with msg.
 func (s *SugaredLogger) Panicw(msg string, keysAndValues ...interface{}) {
-	s.log(FatalLevel, msg, keysAndValues...)
+	s.logw(FatalLevel, msg, keysAndValues)
 	panic(msg)
 }
 
-// TimeFormat is exposed for compatibility with zap but unused here.
-const TimeFormat = time.RFC3339Nano
+// Debugf logs a formatted message at debug level.
+func (s *SugaredLogger) Debugf(template string, args ...interface{}) {
+	s.logf(DebugLevel, template, args)
+}
+
+// Infof logs a formatted message at info level.
+func (s *SugaredLogger) Infof(template string, args ...interface{}) {
+	s.logf(InfoLevel, template, args)
+}
+
+// Warnf logs a formatted message at warn level.
+func (s *SugaredLogger) Warnf(template string, args ...interface{}) {
+	s.logf(WarnLevel, template, args)
+}
+
+// Errorf logs a formatted message at error level.
+func (s *SugaredLogger) Errorf(template string, args ...interface{}) {
+	s.logf(ErrorLevel, template, args)
+}
+
+// Fatalf logs a formatted message at fatal level, flushes, and exits the
+// process.
+func (s *SugaredLogger) Fatalf(template string, args ...interface{}) {
+	s.logf(FatalLevel, template, args)
+	_ = s.Sync()
+	os.Exit(1)
+}
+
+func (s *SugaredLogger) logw(level Level, msg string, keysAndValues []interface{}) {
+	if !s.base.core.Enabled(level) {
+		return
+	}
+	s.base.log(level, msg, sweetenFields(keysAndValues))
+}
+
+func (s *SugaredLogger) logf(level Level, template string, args []interface{}) {
+	if !s.base.core.Enabled(level) {
+		return
+	}
+	s.base.log(level, fmt.Sprintf(template, args...), nil)
+}
@@ -0,0 +1,145 @@
+package zap
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestLoggerWritesJSONAndRoutesErrors(t *testing.T) {
+	dir := t.TempDir()
+	cfg := NewProductionConfig()
+	cfg.OutputPaths = []string{filepath.Join(dir, "out.log")}
+	cfg.ErrorOutputPaths = []string{filepath.Join(dir, "err.log")}
+	cfg.InitialFields = map[string]interface{}{"service": "api"}
+	logger, err := cfg.Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	sugar := logger.Named("http").Sugar().With("sessionID", "abc")
+	sugar.Infow("request <completed>", "status", 200, "duration", 1500*time.Millisecond)
+	sugar.Debugw("hidden")
+	sugar.Errorw("request failed", "error", errors.New("boom"), "dangling")
+	cfg.Level.SetLevel(DebugLevel)
+	sugar.Debugf("shown %d", 1)
+	if err := logger.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	out := readLines(t, filepath.Join(dir, "out.log"))
+	if len(out) != 2 {
+		t.Fatalf("expected two entries, got %q", out)
+	}
+	var info map[string]interface{}
+	if err := json.Unmarshal([]byte(out[0]), &info); err != nil {
+		t.Fatalf("decode %q: %v", out[0], err)
+	}
+	if info["level"] != "info" || info["logger"] != "http" || info["msg"] != "request <completed>" ||
+		info["service"] != "api" || info["sessionID"] != "abc" || info["status"] != float64(200) || info["duration"] != "1.5s" || info["ts"] == nil {
+		t.Fatalf("unexpected entry %s", out[0])
+	}
+	if !strings.Contains(out[1], `"msg":"shown 1"`) {
+		t.Fatalf("expected the raised level to apply, got %s", out[1])
+	}
+
+	errs := readLines(t, filepath.Join(dir, "err.log"))
+	if len(errs) != 1 || !strings.Contains(errs[0], `"level":"error"`) || !strings.Contains(errs[0], `"error":"boom"`) || !strings.Contains(errs[0], `"dangling":null`) {
+		t.Fatalf("expected the error routed apart, got %q", errs)
+	}
+}
+
+func TestLoggerWritesConsoleEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	cfg := NewDevelopmentConfig()
+	cfg.OutputPaths = []string{path}
+	cfg.ErrorOutputPaths = nil
+	logger, err := cfg.Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	logger.With(String("sessionID", "abc")).Warn("slow", Int("ms", 20), Error(nil))
+	logger.Error("failed")
+
+	lines := readLines(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("expected two entries, got %q", lines)
+	}
+	parts := strings.Split(lines[0], "\t")
+	if len(parts) != 4 || parts[1] != "WARN" || parts[2] != "slow" || parts[3] != `{"sessionID":"abc","ms":20}` {
+		t.Fatalf("unexpected entry %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "\tERROR\tfailed") {
+		t.Fatalf("unexpected entry %q", lines[1])
+	}
+}
+
+func TestLoggerSamplesRepeatedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	cfg := NewProductionConfig()
+	cfg.Sampling = &SamplingConfig{Initial: 2, Thereafter: 2}
+	cfg.OutputPaths = []string{path}
+	cfg.ErrorOutputPaths = nil
+	logger, err := cfg.Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		logger.Info("tick", Int("i", i))
+		logger.Error("failed", Int("i", i))
+	}
+
+	var ticks, failures []string
+	for _, line := range readLines(t, path) {
+		if strings.Contains(line, `"msg":"tick"`) {
+			ticks = append(ticks, line)
+		} else {
+			failures = append(failures, line)
+		}
+	}
+	if len(ticks) != 4 || !strings.Contains(ticks[2], `"i":3`) || !strings.Contains(ticks[3], `"i":5`) {
+		t.Fatalf("expected the first two and then every second entry, got %q", ticks)
+	}
+	if len(failures) != 6 {
+		t.Fatalf("expected errors to be kept, got %d", len(failures))
+	}
+}
+
+func TestRotatingFileKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "worker.log")
+	file, err := openRotatingFile(path, &RotationConfig{MaxSize: 1, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	file.maxSize = 10
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	for name, want := range map[string]string{path: "fourth", path + ".1": "third", path + ".2": "second"} {
+		if got := readLines(t, name); len(got) != 1 || got[0] != want {
+			t.Fatalf("expected %s to hold %q, got %q", name, want, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected older backups to be removed, got %v", err)
+	}
+}
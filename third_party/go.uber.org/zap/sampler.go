@@ -0,0 +1,49 @@
+package zap
+
+import (
+	"sync"
+	"time"
+)
+
+// sampler counts the entries logged with each level and message per tick
+// to cap repeated ones.
+type sampler struct {
+	initial    int
+	thereafter int
+	tick       time.Duration
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[sampleKey]int
+}
+
+type sampleKey struct {
+	level   Level
+	message string
+}
+
+func newSampler(cfg SamplingConfig, tick time.Duration) *sampler {
+	return &sampler{initial: cfg.Initial, thereafter: cfg.Thereafter, tick: tick, counts: make(map[sampleKey]int)}
+}
+
+// allow reports whether an entry is logged: the first initial of a tick
+// with the same level and message are, then every thereafter-th. A nil
+// sampler allows every entry, as it does errors and fatal entries.
+func (s *sampler) allow(level Level, message string, now time.Time) bool {
+	if s == nil || level >= ErrorLevel {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.start) >= s.tick {
+		s.start = now
+		clear(s.counts)
+	}
+	key := sampleKey{level: level, message: message}
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= s.initial {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.initial)%s.thereafter == 0
+}
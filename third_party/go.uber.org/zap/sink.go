@@ -0,0 +1,172 @@
+package zap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// writeSyncer is a destination of log entries.
+type writeSyncer interface {
+	io.Writer
+	Sync() error
+}
+
+// openSinks opens the outputs of paths, reusing those in opened so that a
+// file listed for both entries and errors is written by one writer.
+func openSinks(opened map[string]writeSyncer, paths []string, rotation *RotationConfig) (writeSyncer, error) {
+	if len(paths) == 0 {
+		paths = []string{"stdout"}
+	}
+	sinks := make(multiWriteSyncer, 0, len(paths))
+	for _, path := range paths {
+		sink, ok := opened[path]
+		if !ok {
+			switch path {
+			case "stdout":
+				sink = &lockedWriteSyncer{ws: stdStream{os.Stdout}}
+			case "stderr":
+				sink = &lockedWriteSyncer{ws: stdStream{os.Stderr}}
+			default:
+				file, err := openRotatingFile(path, rotation)
+				if err != nil {
+					return nil, err
+				}
+				sink = &lockedWriteSyncer{ws: file}
+			}
+			opened[path] = sink
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
+
+// lockedWriteSyncer serializes the writes of concurrent loggers.
+type lockedWriteSyncer struct {
+	mu sync.Mutex
+	ws writeSyncer
+}
+
+func (s *lockedWriteSyncer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ws.Write(p)
+}
+
+func (s *lockedWriteSyncer) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ws.Sync()
+}
+
+// multiWriteSyncer writes each entry to every sink.
+type multiWriteSyncer []writeSyncer
+
+func (m multiWriteSyncer) Write(p []byte) (int, error) {
+	var errs []error
+	for _, ws := range m {
+		if _, err := ws.Write(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(p), errors.Join(errs...)
+}
+
+func (m multiWriteSyncer) Sync() error {
+	var errs []error
+	for _, ws := range m {
+		if err := ws.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stdStream is stdout or stderr, which cannot be synced when they are
+// terminals or pipes.
+type stdStream struct {
+	*os.File
+}
+
+func (stdStream) Sync() error { return nil }
+
+// rotatingFile appends to a file, rotating it once it would grow past
+// maxSize bytes. A maxSize of zero never rotates.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, rotation *RotationConfig) (*rotatingFile, error) {
+	f := &rotatingFile{path: path}
+	if rotation != nil && rotation.MaxSize > 0 {
+		f.maxSize = int64(rotation.MaxSize) << 20
+		f.maxBackups = max(rotation.MaxBackups, 1)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create log directory: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("stat log file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Sync() error {
+	return f.file.Sync()
+}
+
+// rotate moves the file to <path>.1, shifting the backups before it up
+// and dropping the oldest, and starts a new file.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("close log file: %w", err)
+	}
+	for i := f.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(backupPath(f.path, i), backupPath(f.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("rotate log file: %w", err)
+		}
+	}
+	if err := os.Rename(f.path, backupPath(f.path, 1)); err != nil {
+		return fmt.Errorf("rotate log file: %w", err)
+	}
+	return f.open()
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}